@@ -2,12 +2,80 @@ package constants
 
 // Constants for the application.
 
-var TRANSACTION_TYPES = []string{"income", "expense"}
+// TRANSACTION_TYPES lists the accepted transaction types. Amounts are always
+// stored as positive values, the direction of the money flow is carried by the type.
+var TRANSACTION_TYPES = []string{"income", "expense", "transfer"}
 
 var TRANSACTION_CATEGORIES = []string{"food", "transport", "shopping", "bills", "others"}
 
 var USER_ROLES = []string{"user", "admin"}
 
+var ACCOUNT_TYPES = []string{"checking", "savings", "credit_card", "cash", "investment", "loan"}
+
+// ACCOUNT_MEMBER_ROLES lists the roles of the members of a shared account,
+// from the most to the least privileged.
+var ACCOUNT_MEMBER_ROLES = []string{"owner", "editor", "viewer"}
+
+// LIABILITY_ACCOUNT_TYPES lists the account types holding money owed rather than owned.
+var LIABILITY_ACCOUNT_TYPES = []string{"credit_card", "loan"}
+
+// COMPOUNDING_FREQUENCIES lists how often the interest of a savings account is credited.
+var COMPOUNDING_FREQUENCIES = []string{"daily", "monthly", "quarterly", "yearly"}
+
+// BUDGET_PERIOD_TYPES lists how a budget is cut in periods. Custom budgets
+// have a single period between their start and end dates.
+var BUDGET_PERIOD_TYPES = []string{"weekly", "monthly", "yearly", "custom"}
+
+// BUDGET_ALERT_THRESHOLDS lists the default percentages of the limit of a
+// budget that are notified when crossed.
+var BUDGET_ALERT_THRESHOLDS = []int{50, 80, 100}
+
+// NOTIFICATION_EVENTS lists the events a user can be notified of.
+var NOTIFICATION_EVENTS = []string{
+	"budget_threshold",
+	"budget_exceeded",
+	"large_transaction",
+	"goal_completed",
+	"payment_due",
+	"bill_due",
+	"bill_overdue",
+	"subscription_detected",
+	"subscription_price_increase",
+	"low_balance",
+	"new_device_login",
+	"weekly_digest",
+	"scheduled_report_failed",
+	"scheduled_report_paused",
+	"privacy_export_ready",
+	"billing_payment_failed",
+	"billing_downgraded",
+}
+
+// NOTIFICATION_CHANNELS lists the channels a notification is delivered on.
+var NOTIFICATION_CHANNELS = []string{"in_app", "email", "push"}
+
+// SECURITY_NOTIFICATION_EVENTS lists the events always sent by email, the
+// user cannot turn their email channel off.
+var SECURITY_NOTIFICATION_EVENTS = []string{"new_device_login", "privacy_export_ready", "billing_payment_failed", "billing_downgraded"}
+
+// SCHEDULED_REPORTS lists the reports that can be emailed on a schedule:
+// the custom reports saved by the user and the canned ones.
+var SCHEDULED_REPORTS = []string{"custom", "health_metrics", "merchants"}
+
+// PRIVACY_REQUEST_STATUSES lists the statuses of the privacy requests. An
+// export is pending until its archive is ready, and expired once the
+// archive is deleted; an erasure awaits its confirmation by email, then is
+// scheduled until the end of its grace period, and pending while it runs.
+var PRIVACY_REQUEST_STATUSES = []string{"pending", "ready", "expired", "awaiting_confirmation", "scheduled", "completed", "canceled", "failed"}
+
+// OPEN_PRIVACY_REQUEST_STATUSES lists the statuses of the privacy requests
+// still to be handled.
+var OPEN_PRIVACY_REQUEST_STATUSES = []string{"pending", "awaiting_confirmation", "scheduled", "failed"}
+
+// SHARE_RESOURCES lists the resources a share grant may give access to:
+// the transactions, and the reports computed from them.
+var SHARE_RESOURCES = []string{"transactions", "reports"}
+
 func GetTransactionTypes() []string {
 	return append([]string(nil), TRANSACTION_TYPES...)
 }
@@ -19,3 +87,51 @@ func GetTransactionCategories() []string {
 func GetUserRoles() []string {
 	return append([]string(nil), USER_ROLES...)
 }
+
+func GetAccountTypes() []string {
+	return append([]string(nil), ACCOUNT_TYPES...)
+}
+
+func GetLiabilityAccountTypes() []string {
+	return append([]string(nil), LIABILITY_ACCOUNT_TYPES...)
+}
+
+func GetAccountMemberRoles() []string {
+	return append([]string(nil), ACCOUNT_MEMBER_ROLES...)
+}
+
+func GetBudgetPeriodTypes() []string {
+	return append([]string(nil), BUDGET_PERIOD_TYPES...)
+}
+
+func GetCompoundingFrequencies() []string {
+	return append([]string(nil), COMPOUNDING_FREQUENCIES...)
+}
+
+func GetBudgetAlertThresholds() []int {
+	return append([]int(nil), BUDGET_ALERT_THRESHOLDS...)
+}
+
+func GetNotificationEvents() []string {
+	return append([]string(nil), NOTIFICATION_EVENTS...)
+}
+
+func GetNotificationChannels() []string {
+	return append([]string(nil), NOTIFICATION_CHANNELS...)
+}
+
+func GetSecurityNotificationEvents() []string {
+	return append([]string(nil), SECURITY_NOTIFICATION_EVENTS...)
+}
+
+func GetPrivacyRequestStatuses() []string {
+	return append([]string(nil), PRIVACY_REQUEST_STATUSES...)
+}
+
+func GetOpenPrivacyRequestStatuses() []string {
+	return append([]string(nil), OPEN_PRIVACY_REQUEST_STATUSES...)
+}
+
+func GetShareResources() []string {
+	return append([]string(nil), SHARE_RESOURCES...)
+}
@@ -0,0 +1,161 @@
+// Package avatars turns the pictures uploaded by the users into their
+// avatars: square, upright, in fixed sizes and without metadata.
+package avatars
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+// MaxSize is the largest picture accepted, in bytes.
+const MaxSize = 2 << 20
+
+// maxPixels bounds the pictures decoded, a small file may declare a huge
+// image.
+const maxPixels = 16_000_000
+
+// Sizes are the widths of the avatars rendered, in pixels, the smallest
+// first.
+var Sizes = []int{64, 256}
+
+var (
+	// ErrUnsupportedFormat is returned for the files that are not JPEG, PNG
+	// or WebP pictures, whatever their name or declared type.
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	// ErrInvalidImage is returned for the pictures that cannot be decoded,
+	// or too large to be.
+	ErrInvalidImage = errors.New("invalid image")
+)
+
+// Formats are the formats accepted, as listed to the users.
+var Formats = []string{"JPEG", "PNG", "WebP"}
+
+// Avatar is a picture rendered at one of the sizes.
+type Avatar struct {
+	Size        int
+	ContentType string
+	Data        []byte
+}
+
+// Format returns the format of the picture sniffed from its content,
+// "jpeg", "png" or "webp", or ErrUnsupportedFormat. An SVG or an HTML page
+// is refused even named .png.
+func Format(data []byte) (string, error) {
+	switch http.DetectContentType(data) {
+	case "image/jpeg":
+		return "jpeg", nil
+	case "image/png":
+		return "png", nil
+	case "image/webp":
+		return "webp", nil
+	}
+	return "", ErrUnsupportedFormat
+}
+
+// Render decodes the picture and renders it at every size, cropped to its
+// center square and turned upright after its EXIF orientation. The avatars
+// are encoded again, so that nothing of the upload but its pixels is kept:
+// JPEG for the opaque pictures, PNG for the others.
+func Render(data []byte) ([]Avatar, error) {
+	format, err := Format(data)
+	if err != nil {
+		return nil, err
+	}
+
+	decodeConfig, decode := png.DecodeConfig, png.Decode
+	switch format {
+	case "jpeg":
+		decodeConfig, decode = jpeg.DecodeConfig, jpeg.Decode
+	case "webp":
+		decodeConfig, decode = webp.DecodeConfig, webp.Decode
+	}
+
+	config, err := decodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxPixels {
+		return nil, fmt.Errorf("%w: %dx%d pixels", ErrInvalidImage, config.Width, config.Height)
+	}
+	picture, err := decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	orientation := exifOrientation(format, data)
+
+	avatars := make([]Avatar, 0, len(Sizes))
+	for _, size := range Sizes {
+		avatar, err := render(picture, size, orientation)
+		if err != nil {
+			return nil, err
+		}
+		avatars = append(avatars, avatar)
+	}
+	return avatars, nil
+}
+
+// render scales the center square of the picture to size, then orients it.
+func render(picture image.Image, size, orientation int) (Avatar, error) {
+	bounds := picture.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	crop := image.Rect(0, 0, side, side).Add(bounds.Min).
+		Add(image.Pt((bounds.Dx()-side)/2, (bounds.Dy()-side)/2))
+
+	scaled := image.NewNRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(scaled, scaled.Bounds(), picture, crop, draw.Src, nil)
+	upright := orient(scaled, orientation)
+
+	var buf bytes.Buffer
+	if upright.Opaque() {
+		if err := jpeg.Encode(&buf, upright, &jpeg.Options{Quality: 85}); err != nil {
+			return Avatar{}, err
+		}
+		return Avatar{Size: size, ContentType: "image/jpeg", Data: buf.Bytes()}, nil
+	}
+	if err := png.Encode(&buf, upright); err != nil {
+		return Avatar{}, err
+	}
+	return Avatar{Size: size, ContentType: "image/png", Data: buf.Bytes()}, nil
+}
+
+// orient applies the EXIF orientation, 1 to 8, to the square picture.
+func orient(src *image.NRGBA, orientation int) *image.NRGBA {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+
+	n := src.Bounds().Dx()
+	last := n - 1
+	dst := image.NewNRGBA(src.Bounds())
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // Mirrored
+				sx, sy = last-x, y
+			case 3: // Upside down
+				sx, sy = last-x, last-y
+			case 4: // Mirrored upside down
+				sx, sy = x, last-y
+			case 5: // Mirrored, rotated a quarter counterclockwise
+				sx, sy = y, x
+			case 6: // Rotated a quarter counterclockwise, turned clockwise
+				sx, sy = y, last-x
+			case 7: // Mirrored, rotated a quarter clockwise
+				sx, sy = last-y, last-x
+			case 8: // Rotated a quarter clockwise, turned counterclockwise
+				sx, sy = last-y, x
+			}
+			dst.SetNRGBA(x, y, src.NRGBAAt(sx, sy))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,171 @@
+package avatars
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+var (
+	red  = color.NRGBA{R: 255, A: 255}
+	blue = color.NRGBA{B: 255, A: 255}
+)
+
+// portrait returns a picture twice as tall as wide, red on top and blue at
+// the bottom.
+func portrait(alpha uint8) *image.NRGBA {
+	picture := image.NewNRGBA(image.Rect(0, 0, 100, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 100; x++ {
+			c := red
+			if y >= 100 {
+				c = blue
+			}
+			c.A = alpha
+			picture.SetNRGBA(x, y, c)
+		}
+	}
+	return picture
+}
+
+// withOrientation inserts an APP1 segment with the EXIF orientation right
+// after the start of the JPEG.
+func withOrientation(t *testing.T, picture []byte, orientation uint16) []byte {
+	t.Helper()
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	tiff = binary.BigEndian.AppendUint16(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, orientationTag)
+	tiff = binary.BigEndian.AppendUint16(tiff, 3)
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1}
+	app1 = binary.BigEndian.AppendUint16(app1, uint16(len(segment)+2))
+	app1 = append(app1, segment...)
+	return append(append(append([]byte{}, picture[:2]...), app1...), picture[2:]...)
+}
+
+func encodeJPEG(t *testing.T, picture image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, picture, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decode(t *testing.T, avatar Avatar) image.Image {
+	t.Helper()
+	picture, _, err := image.Decode(bytes.NewReader(avatar.Data))
+	if err != nil {
+		t.Fatalf("could not decode the %dpx avatar: %v", avatar.Size, err)
+	}
+	if picture.Bounds().Dx() != avatar.Size || picture.Bounds().Dy() != avatar.Size {
+		t.Errorf("expected %dx%[1]d pixels; got %v", avatar.Size, picture.Bounds())
+	}
+	return picture
+}
+
+// isRed reports whether the pixel is mostly red, after the JPEG losses.
+func isRed(c color.Color) bool {
+	r, _, b, _ := c.RGBA()
+	return r > 0xC000 && b < 0x4000
+}
+
+func TestRenderCropsAndResizes(t *testing.T) {
+	avatars, err := Render(encodeJPEG(t, portrait(255)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(avatars) != len(Sizes) {
+		t.Fatalf("expected %d avatars; got %d", len(Sizes), len(avatars))
+	}
+	for i, avatar := range avatars {
+		if avatar.Size != Sizes[i] || avatar.ContentType != "image/jpeg" {
+			t.Errorf("expected a %dpx JPEG; got %dpx %s", Sizes[i], avatar.Size, avatar.ContentType)
+		}
+		// The center square, red on top
+		picture := decode(t, avatar)
+		if !isRed(picture.At(avatar.Size/2, avatar.Size/8)) || isRed(picture.At(avatar.Size/2, avatar.Size*7/8)) {
+			t.Errorf("%dpx: expected red on top and blue at the bottom", avatar.Size)
+		}
+	}
+}
+
+func TestRenderRespectsOrientationAndStripsMetadata(t *testing.T) {
+	// Rotated a quarter counterclockwise by the camera: turned clockwise the
+	// top goes to the right
+	avatars, err := Render(withOrientation(t, encodeJPEG(t, portrait(255)), 6))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, avatar := range avatars {
+		picture := decode(t, avatar)
+		if isRed(picture.At(avatar.Size/8, avatar.Size/2)) || !isRed(picture.At(avatar.Size*7/8, avatar.Size/2)) {
+			t.Errorf("%dpx: expected blue on the left and red on the right", avatar.Size)
+		}
+		if bytes.Contains(avatar.Data, []byte("Exif")) {
+			t.Errorf("%dpx: expected the EXIF stripped", avatar.Size)
+		}
+	}
+}
+
+func TestRenderKeepsTransparency(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, portrait(128)); err != nil {
+		t.Fatal(err)
+	}
+	avatars, err := Render(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, avatar := range avatars {
+		if avatar.ContentType != "image/png" {
+			t.Errorf("expected a PNG for a translucent picture; got %s", avatar.ContentType)
+		}
+		if _, _, _, a := decode(t, avatar).At(0, 0).RGBA(); a == 0xFFFF {
+			t.Errorf("%dpx: expected the transparency kept", avatar.Size)
+		}
+	}
+}
+
+func TestRenderRefusesDisguisedFiles(t *testing.T) {
+	for name, data := range map[string]string{
+		"svg":  `<svg xmlns="http://www.w3.org/2000/svg" onload="alert(1)"><rect width="10" height="10"/></svg>`,
+		"xml":  `<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"></svg>`,
+		"html": `<!DOCTYPE html><html><script>alert(1)</script></html>`,
+		"text": "not a picture",
+		"gif":  "GIF89a\x01\x00\x01\x00\x00\x00\x00;",
+	} {
+		if _, err := Render([]byte(data)); !errors.Is(err, ErrUnsupportedFormat) {
+			t.Errorf("%s: expected an unsupported format; got %v", name, err)
+		}
+	}
+
+	if format, err := Format([]byte("RIFF\x24\x00\x00\x00WEBPVP8 \x18\x00\x00\x00")); err != nil || format != "webp" {
+		t.Errorf("expected a WebP; got %q, %v", format, err)
+	}
+}
+
+func TestRenderRefusesHugeImages(t *testing.T) {
+	// A PNG header declaring 10000x10000 pixels, without their data
+	ihdr := binary.BigEndian.AppendUint32([]byte("IHDR"), 10000)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, 10000)
+	ihdr = append(ihdr, 8, 6, 0, 0, 0)
+	data := []byte("\x89PNG\r\n\x1a\n")
+	data = binary.BigEndian.AppendUint32(data, uint32(len(ihdr)-4))
+	data = append(data, ihdr...)
+	data = binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(ihdr))
+
+	if _, err := Render(data); !errors.Is(err, ErrInvalidImage) {
+		t.Errorf("expected an invalid image; got %v", err)
+	}
+}
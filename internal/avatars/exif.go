@@ -0,0 +1,112 @@
+package avatars
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// orientationTag is the EXIF tag of the orientation of the picture.
+const orientationTag = 0x0112
+
+// exifOrientation returns the EXIF orientation of the picture, 1 when it
+// has none: the cameras store the pictures as shot and tell the viewers how
+// to turn them.
+func exifOrientation(format string, data []byte) int {
+	var exif []byte
+	switch format {
+	case "jpeg":
+		exif = jpegExif(data)
+	case "png":
+		exif = pngExif(data)
+	case "webp":
+		exif = webpExif(data)
+	}
+	return tiffOrientation(bytes.TrimPrefix(exif, []byte("Exif\x00\x00")))
+}
+
+// jpegExif returns the EXIF of the APP1 segment, before the image data.
+func jpegExif(data []byte) []byte {
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == 0xDA || length < 2 || i+2+length > len(data) {
+			return nil
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment
+		}
+		i += 2 + length
+	}
+	return nil
+}
+
+// pngExif returns the eXIf chunk, before the image data.
+func pngExif(data []byte) []byte {
+	for i := 8; i+8 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		kind := string(data[i+4 : i+8])
+		if kind == "IDAT" || i+8+length > len(data) {
+			return nil
+		}
+		if kind == "eXIf" {
+			return data[i+8 : i+8+length]
+		}
+		i += 12 + length
+	}
+	return nil
+}
+
+// webpExif returns the EXIF chunk of the RIFF container.
+func webpExif(data []byte) []byte {
+	for i := 12; i+8 <= len(data); {
+		length := int(binary.LittleEndian.Uint32(data[i+4:]))
+		if i+8+length > len(data) {
+			return nil
+		}
+		if string(data[i:i+4]) == "EXIF" {
+			return data[i+8 : i+8+length]
+		}
+		// The chunks are padded to an even length
+		i += 8 + length + length%2
+	}
+	return nil
+}
+
+// tiffOrientation reads the orientation in the first IFD of the TIFF
+// structure of the EXIF, 1 when missing or invalid.
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == orientationTag {
+			// A SHORT, held in the first bytes of the value
+			orientation := int(order.Uint16(tiff[entry+8:]))
+			if orientation < 1 || orientation > 8 {
+				return 1
+			}
+			return orientation
+		}
+	}
+	return 1
+}
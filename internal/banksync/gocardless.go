@@ -0,0 +1,307 @@
+package banksync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"FinMa/internal/logging"
+	"FinMa/types"
+)
+
+const goCardlessBaseURL = "https://bankaccountdata.gocardless.com/api/v2"
+
+// GoCardlessProvider implements BankSyncProvider with the GoCardless Bank
+// Account Data API (formerly Nordigen).
+type GoCardlessProvider struct {
+	secretID  string
+	secretKey string
+	baseURL   string
+	client    *http.Client
+
+	mu                  sync.Mutex
+	accessToken         string
+	accessTokenExpires  time.Time
+	refreshToken        string
+	refreshTokenExpires time.Time
+}
+
+func NewGoCardlessProvider(secretID, secretKey string) *GoCardlessProvider {
+	return &GoCardlessProvider{
+		secretID:  secretID,
+		secretKey: secretKey,
+		baseURL:   goCardlessBaseURL,
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (p *GoCardlessProvider) Name() string {
+	return "gocardless"
+}
+
+func (p *GoCardlessProvider) ListInstitutions(ctx context.Context, country string) ([]Institution, error) {
+	var response []struct {
+		ID        string   `json:"id"`
+		Name      string   `json:"name"`
+		BIC       string   `json:"bic"`
+		Logo      string   `json:"logo"`
+		Countries []string `json:"countries"`
+	}
+
+	if err := p.do(ctx, http.MethodGet, "/institutions/?country="+url.QueryEscape(country), nil, &response); err != nil {
+		return nil, err
+	}
+
+	institutions := make([]Institution, 0, len(response))
+	for _, institution := range response {
+		institutions = append(institutions, Institution{
+			ID:      institution.ID,
+			Name:    institution.Name,
+			BIC:     institution.BIC,
+			Logo:    institution.Logo,
+			Country: country,
+		})
+	}
+	return institutions, nil
+}
+
+func (p *GoCardlessProvider) CreateLink(ctx context.Context, institutionID, redirectURL, reference string) (Link, error) {
+	request := map[string]string{
+		"institution_id": institutionID,
+		"redirect":       redirectURL,
+		"reference":      reference,
+	}
+
+	var response struct {
+		ID   string `json:"id"`
+		Link string `json:"link"`
+	}
+
+	if err := p.do(ctx, http.MethodPost, "/requisitions/", request, &response); err != nil {
+		return Link{}, err
+	}
+	return Link{ID: response.ID, URL: response.Link}, nil
+}
+
+func (p *GoCardlessProvider) FetchAccounts(ctx context.Context, linkID string) ([]ExternalAccount, error) {
+	var requisition struct {
+		Status   string   `json:"status"`
+		Accounts []string `json:"accounts"`
+	}
+
+	if err := p.do(ctx, http.MethodGet, "/requisitions/"+url.PathEscape(linkID)+"/", nil, &requisition); err != nil {
+		return nil, err
+	}
+
+	if requisition.Status == "EX" || requisition.Status == "RJ" {
+		return nil, ErrLinkExpired
+	}
+
+	accounts := make([]ExternalAccount, 0, len(requisition.Accounts))
+	for _, accountID := range requisition.Accounts {
+		var details struct {
+			Account struct {
+				IBAN     string `json:"iban"`
+				Name     string `json:"name"`
+				Currency string `json:"currency"`
+			} `json:"account"`
+		}
+
+		if err := p.do(ctx, http.MethodGet, "/accounts/"+url.PathEscape(accountID)+"/details/", nil, &details); err != nil {
+			return nil, fmt.Errorf("failed to fetch account %s details: %w", logging.Mask(accountID), err)
+		}
+
+		accounts = append(accounts, ExternalAccount{
+			ID:       accountID,
+			IBAN:     details.Account.IBAN,
+			Name:     details.Account.Name,
+			Currency: details.Account.Currency,
+		})
+	}
+	return accounts, nil
+}
+
+// FetchTransactions uses the booking date of the most recent transaction as
+// cursor. The day of the cursor is fetched again, duplicates are expected to
+// be skipped using the transaction IDs.
+func (p *GoCardlessProvider) FetchTransactions(ctx context.Context, accountID, cursor string) ([]ExternalTransaction, string, error) {
+	path := "/accounts/" + url.PathEscape(accountID) + "/transactions/"
+	if cursor != "" {
+		path += "?date_from=" + url.QueryEscape(cursor)
+	}
+
+	var response struct {
+		Transactions struct {
+			Booked []struct {
+				TransactionID     string `json:"transactionId"`
+				InternalID        string `json:"internalTransactionId"`
+				BookingDate       string `json:"bookingDate"`
+				TransactionAmount struct {
+					Amount   string `json:"amount"`
+					Currency string `json:"currency"`
+				} `json:"transactionAmount"`
+				CreditorName                      string `json:"creditorName"`
+				DebtorName                        string `json:"debtorName"`
+				RemittanceInformationUnstructured string `json:"remittanceInformationUnstructured"`
+			} `json:"booked"`
+		} `json:"transactions"`
+	}
+
+	if err := p.do(ctx, http.MethodGet, path, nil, &response); err != nil {
+		return nil, cursor, err
+	}
+
+	next := cursor
+	transactions := make([]ExternalTransaction, 0, len(response.Transactions.Booked))
+	for _, booked := range response.Transactions.Booked {
+		amount, err := types.ParseMoney(booked.TransactionAmount.Amount, booked.TransactionAmount.Currency)
+		if err != nil {
+			return nil, cursor, fmt.Errorf("invalid amount %s: %w", logging.Amount(booked.TransactionAmount.Amount), err)
+		}
+
+		date, err := time.Parse("2006-01-02", booked.BookingDate)
+		if err != nil {
+			return nil, cursor, fmt.Errorf("invalid booking date %q: %w", booked.BookingDate, err)
+		}
+
+		id := booked.TransactionID
+		if id == "" {
+			id = booked.InternalID
+		}
+
+		description := booked.RemittanceInformationUnstructured
+		if description == "" {
+			description = booked.CreditorName
+		}
+		if description == "" {
+			description = booked.DebtorName
+		}
+
+		transactions = append(transactions, ExternalTransaction{
+			ID:          id,
+			Amount:      amount,
+			Currency:    booked.TransactionAmount.Currency,
+			Date:        date,
+			Description: strings.TrimSpace(description),
+		})
+
+		if booked.BookingDate > next {
+			next = booked.BookingDate
+		}
+	}
+
+	return transactions, next, nil
+}
+
+// token returns a valid access token, refreshing or requesting a new one when needed.
+func (p *GoCardlessProvider) token(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	if p.accessToken != "" && now.Before(p.accessTokenExpires) {
+		return p.accessToken, nil
+	}
+
+	var response struct {
+		Access         string `json:"access"`
+		AccessExpires  int    `json:"access_expires"`
+		Refresh        string `json:"refresh"`
+		RefreshExpires int    `json:"refresh_expires"`
+	}
+
+	if p.refreshToken != "" && now.Before(p.refreshTokenExpires) {
+		err := p.send(ctx, http.MethodPost, "/token/refresh/", "", map[string]string{"refresh": p.refreshToken}, &response)
+		if err == nil {
+			p.accessToken = response.Access
+			p.accessTokenExpires = now.Add(time.Duration(response.AccessExpires)*time.Second - time.Minute)
+			return p.accessToken, nil
+		}
+	}
+
+	request := map[string]string{"secret_id": p.secretID, "secret_key": p.secretKey}
+	if err := p.send(ctx, http.MethodPost, "/token/new/", "", request, &response); err != nil {
+		return "", fmt.Errorf("failed to get an access token: %w", err)
+	}
+
+	p.accessToken = response.Access
+	p.accessTokenExpires = now.Add(time.Duration(response.AccessExpires)*time.Second - time.Minute)
+	p.refreshToken = response.Refresh
+	p.refreshTokenExpires = now.Add(time.Duration(response.RefreshExpires)*time.Second - time.Minute)
+
+	return p.accessToken, nil
+}
+
+// do sends an authenticated request.
+func (p *GoCardlessProvider) do(ctx context.Context, method, path string, body interface{}, out interface{}) error {
+	token, err := p.token(ctx)
+	if err != nil {
+		return err
+	}
+	return p.send(ctx, method, path, token, body, out)
+}
+
+func (p *GoCardlessProvider) send(ctx context.Context, method, path, token string, body interface{}, out interface{}) error {
+	var reader *bytes.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, p.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		retryAfter, _ := strconv.Atoi(resp.Header.Get("HTTP_X_RATELIMIT_ACCOUNT_SUCCESS_RESET"))
+		if retryAfter == 0 {
+			retryAfter, _ = strconv.Atoi(resp.Header.Get("Retry-After"))
+		}
+		return &ErrRateLimited{RetryAfter: time.Duration(retryAfter) * time.Second}
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized && token != "" {
+		// The token was revoked, request a new one on the next call
+		p.mu.Lock()
+		p.accessToken = ""
+		p.mu.Unlock()
+	}
+
+	if resp.StatusCode >= 300 {
+		var apiError struct {
+			Summary string `json:"summary"`
+			Detail  string `json:"detail"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiError)
+		return fmt.Errorf("gocardless %s %s: %d %s %s", method, path, resp.StatusCode, apiError.Summary, apiError.Detail)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
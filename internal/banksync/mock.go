@@ -0,0 +1,92 @@
+package banksync
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MockProvider is an in-memory provider used in tests and local development.
+type MockProvider struct {
+	mu sync.Mutex
+
+	Institutions []Institution
+	Accounts     map[string][]ExternalAccount
+	Transactions map[string][]ExternalTransaction
+	// Errors makes FetchTransactions fail for the given account IDs.
+	Errors map[string]error
+}
+
+func NewMockProvider() *MockProvider {
+	return &MockProvider{
+		Accounts:     map[string][]ExternalAccount{},
+		Transactions: map[string][]ExternalTransaction{},
+		Errors:       map[string]error{},
+	}
+}
+
+func (p *MockProvider) Name() string {
+	return "mock"
+}
+
+func (p *MockProvider) ListInstitutions(ctx context.Context, country string) ([]Institution, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	institutions := []Institution{}
+	for _, institution := range p.Institutions {
+		if institution.Country == country {
+			institutions = append(institutions, institution)
+		}
+	}
+	return institutions, nil
+}
+
+func (p *MockProvider) CreateLink(ctx context.Context, institutionID, redirectURL, reference string) (Link, error) {
+	id := fmt.Sprintf("link-%s-%s", institutionID, reference)
+	return Link{ID: id, URL: redirectURL + "?ref=" + reference}, nil
+}
+
+func (p *MockProvider) FetchAccounts(ctx context.Context, linkID string) ([]ExternalAccount, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.Accounts[linkID], nil
+}
+
+// FetchTransactions uses the RFC3339 date of the last returned transaction as cursor.
+func (p *MockProvider) FetchTransactions(ctx context.Context, accountID, cursor string) ([]ExternalTransaction, string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.Errors[accountID]; err != nil {
+		return nil, cursor, err
+	}
+
+	var since time.Time
+	if cursor != "" {
+		parsed, err := time.Parse(time.RFC3339, cursor)
+		if err != nil {
+			return nil, cursor, err
+		}
+		since = parsed
+	}
+
+	transactions := []ExternalTransaction{}
+	latest := since
+	for _, transaction := range p.Transactions[accountID] {
+		if !transaction.Date.After(since) {
+			continue
+		}
+		transactions = append(transactions, transaction)
+		if transaction.Date.After(latest) {
+			latest = transaction.Date
+		}
+	}
+
+	if latest.Equal(since) {
+		return transactions, cursor, nil
+	}
+	return transactions, latest.Format(time.RFC3339), nil
+}
@@ -0,0 +1,74 @@
+package banksync
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"FinMa/types"
+)
+
+// ErrRateLimited is returned when the provider refuses a request because of
+// its rate limits. RetryAfter tells when the request can be retried.
+type ErrRateLimited struct {
+	RetryAfter time.Duration
+}
+
+func (e *ErrRateLimited) Error() string {
+	return "bank sync provider rate limit reached, retry after " + e.RetryAfter.String()
+}
+
+// ErrLinkExpired is returned when the user consent expired and the link must
+// be created again.
+var ErrLinkExpired = errors.New("bank link expired")
+
+// Institution is a bank supported by the provider.
+type Institution struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	BIC     string `json:"bic"`
+	Logo    string `json:"logo"`
+	Country string `json:"country"`
+}
+
+// Link is a consent flow started with the provider. The user must visit URL
+// to give their consent.
+type Link struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+}
+
+// ExternalAccount is an account exposed by the provider once the consent is given.
+type ExternalAccount struct {
+	ID       string `json:"id"`
+	IBAN     string `json:"iban"`
+	Name     string `json:"name"`
+	Currency string `json:"currency"`
+}
+
+// ExternalTransaction is a booked transaction fetched from the provider.
+// Amount is signed: negative amounts leave the account.
+type ExternalTransaction struct {
+	ID          string      `json:"id"`
+	Amount      types.Money `json:"amount"` // Minor units of Currency
+	Currency    string      `json:"currency"`
+	Date        time.Time   `json:"date"`
+	Description string      `json:"description"`
+}
+
+// BankSyncProvider pulls accounts and transactions from banks on behalf of users.
+type BankSyncProvider interface {
+	// Name identifies the provider in the stored connections.
+	Name() string
+	// ListInstitutions lists the banks available in a country (ISO 3166 code).
+	ListInstitutions(ctx context.Context, country string) ([]Institution, error)
+	// CreateLink starts a consent flow for an institution. The user is sent
+	// back to redirectURL once done, reference is echoed back by the provider.
+	CreateLink(ctx context.Context, institutionID, redirectURL, reference string) (Link, error)
+	// FetchAccounts lists the accounts the user gave access to through a link.
+	FetchAccounts(ctx context.Context, linkID string) ([]ExternalAccount, error)
+	// FetchTransactions returns the transactions of an account booked after
+	// the cursor and the cursor to use for the next call. An empty cursor
+	// fetches the whole available history.
+	FetchTransactions(ctx context.Context, accountID, cursor string) ([]ExternalTransaction, string, error)
+}
@@ -0,0 +1,59 @@
+// Package billing sells the subscriptions to the pro plan through a payment
+// provider: its hosted checkout and customer portal, and the webhook events
+// telling the state of the subscriptions.
+package billing
+
+import (
+	"context"
+	"time"
+)
+
+// Session is a checkout started with the provider. The user must visit URL
+// to pay.
+type Session struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+}
+
+// Subscription is the state of a subscription sent in a webhook event.
+type Subscription struct {
+	ID                string
+	CustomerID        string
+	Status            string // "active", "trialing", "past_due", "unpaid", "canceled", "incomplete" or "incomplete_expired"
+	CurrentPeriodEnd  time.Time
+	CancelAtPeriodEnd bool
+}
+
+// Event is a webhook event of the provider.
+type Event struct {
+	ID      string
+	Type    string
+	Created time.Time
+	// Subscription is set for the subscription events, nil for the others
+	Subscription *Subscription
+}
+
+// The webhook events about subscriptions, the others are acknowledged and
+// ignored.
+const (
+	EventSubscriptionCreated = "customer.subscription.created"
+	EventSubscriptionUpdated = "customer.subscription.updated"
+	EventSubscriptionDeleted = "customer.subscription.deleted"
+)
+
+// Provider is a payment provider selling the subscription to the pro plan.
+type Provider interface {
+	// CreateCustomer creates the customer of a user, reference is echoed
+	// back in the metadata of the customer.
+	CreateCustomer(ctx context.Context, email, reference string) (string, error)
+	// CreateCheckoutSession starts the checkout of the subscription by the
+	// customer. The user is sent back to successURL once paid, to cancelURL
+	// otherwise.
+	CreateCheckoutSession(ctx context.Context, customerID, reference, successURL, cancelURL string) (Session, error)
+	// CreatePortalSession returns the URL of the portal where the customer
+	// manages their subscription, sending them back to returnURL.
+	CreatePortalSession(ctx context.Context, customerID, returnURL string) (string, error)
+	// ParseEvent decodes the event of a webhook payload, its signature
+	// verified beforehand.
+	ParseEvent(payload []byte) (Event, error)
+}
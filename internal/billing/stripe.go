@@ -0,0 +1,151 @@
+package billing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const stripeBaseURL = "https://api.stripe.com/v1"
+
+// StripeProvider implements Provider with the Stripe API, selling the
+// subscription to a price of the pro plan.
+type StripeProvider struct {
+	secretKey string
+	priceID   string
+	baseURL   string
+	client    *http.Client
+}
+
+func NewStripeProvider(secretKey, priceID string) *StripeProvider {
+	return &StripeProvider{
+		secretKey: secretKey,
+		priceID:   priceID,
+		baseURL:   stripeBaseURL,
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (p *StripeProvider) CreateCustomer(ctx context.Context, email, reference string) (string, error) {
+	var response struct {
+		ID string `json:"id"`
+	}
+	form := url.Values{"email": {email}, "metadata[user_id]": {reference}}
+	if err := p.do(ctx, "/customers", form, &response); err != nil {
+		return "", err
+	}
+	return response.ID, nil
+}
+
+func (p *StripeProvider) CreateCheckoutSession(ctx context.Context, customerID, reference, successURL, cancelURL string) (Session, error) {
+	var response struct {
+		ID  string `json:"id"`
+		URL string `json:"url"`
+	}
+	form := url.Values{
+		"mode":                                 {"subscription"},
+		"customer":                             {customerID},
+		"client_reference_id":                  {reference},
+		"line_items[0][price]":                 {p.priceID},
+		"line_items[0][quantity]":              {"1"},
+		"subscription_data[metadata][user_id]": {reference},
+		"success_url":                          {successURL},
+		"cancel_url":                           {cancelURL},
+	}
+	if err := p.do(ctx, "/checkout/sessions", form, &response); err != nil {
+		return Session{}, err
+	}
+	return Session{ID: response.ID, URL: response.URL}, nil
+}
+
+func (p *StripeProvider) CreatePortalSession(ctx context.Context, customerID, returnURL string) (string, error) {
+	var response struct {
+		URL string `json:"url"`
+	}
+	form := url.Values{"customer": {customerID}, "return_url": {returnURL}}
+	if err := p.do(ctx, "/billing_portal/sessions", form, &response); err != nil {
+		return "", err
+	}
+	return response.URL, nil
+}
+
+// ParseEvent decodes a Stripe event, the subscription of the
+// customer.subscription.* ones.
+func (p *StripeProvider) ParseEvent(payload []byte) (Event, error) {
+	var event struct {
+		ID      string `json:"id"`
+		Type    string `json:"type"`
+		Created int64  `json:"created"`
+		Data    struct {
+			Object json.RawMessage `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return Event{}, fmt.Errorf("invalid stripe event: %w", err)
+	}
+	parsed := Event{ID: event.ID, Type: event.Type, Created: time.Unix(event.Created, 0)}
+
+	switch event.Type {
+	case EventSubscriptionCreated, EventSubscriptionUpdated, EventSubscriptionDeleted:
+		var subscription struct {
+			ID                string `json:"id"`
+			Customer          string `json:"customer"`
+			Status            string `json:"status"`
+			CurrentPeriodEnd  int64  `json:"current_period_end"`
+			CancelAtPeriodEnd bool   `json:"cancel_at_period_end"`
+			// The recent API versions moved the period to the items
+			Items struct {
+				Data []struct {
+					CurrentPeriodEnd int64 `json:"current_period_end"`
+				} `json:"data"`
+			} `json:"items"`
+		}
+		if err := json.Unmarshal(event.Data.Object, &subscription); err != nil {
+			return Event{}, fmt.Errorf("invalid stripe subscription: %w", err)
+		}
+		periodEnd := subscription.CurrentPeriodEnd
+		if periodEnd == 0 && len(subscription.Items.Data) > 0 {
+			periodEnd = subscription.Items.Data[0].CurrentPeriodEnd
+		}
+		parsed.Subscription = &Subscription{
+			ID:                subscription.ID,
+			CustomerID:        subscription.Customer,
+			Status:            subscription.Status,
+			CurrentPeriodEnd:  time.Unix(periodEnd, 0),
+			CancelAtPeriodEnd: subscription.CancelAtPeriodEnd,
+		}
+	}
+	return parsed, nil
+}
+
+// do posts the form to the API and decodes the response.
+func (p *StripeProvider) do(ctx context.Context, path string, form url.Values, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.secretKey)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var apiError struct {
+			Error struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiError)
+		return fmt.Errorf("stripe POST %s: %d %s %s", path, resp.StatusCode, apiError.Error.Type, apiError.Error.Message)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
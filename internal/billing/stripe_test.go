@@ -0,0 +1,57 @@
+package billing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStripeParseEvent(t *testing.T) {
+	p := NewStripeProvider("sk_test", "price_pro")
+	payload := `{"id":"evt_1","type":"customer.subscription.updated","created":1760000000,"data":{"object":{"id":"sub_1","customer":"cus_1","status":"past_due","cancel_at_period_end":true,"items":{"data":[{"current_period_end":1762000000}]}}}}`
+
+	event, err := p.ParseEvent([]byte(payload))
+	if err != nil {
+		t.Fatalf("expected the event parsed; got %v", err)
+	}
+	subscription := event.Subscription
+	if event.ID != "evt_1" || subscription == nil || subscription.CustomerID != "cus_1" || subscription.Status != "past_due" ||
+		!subscription.CancelAtPeriodEnd || subscription.CurrentPeriodEnd.Unix() != 1762000000 {
+		t.Errorf("unexpected event: %+v %+v", event, subscription)
+	}
+
+	other := `{"id":"evt_2","type":"invoice.paid","created":1760000000,"data":{"object":{}}}`
+	if event, err := p.ParseEvent([]byte(other)); err != nil || event.Subscription != nil {
+		t.Errorf("expected the other events parsed without a subscription; got %+v %v", event, err)
+	}
+}
+
+func TestStripeCheckoutSession(t *testing.T) {
+	var form map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/checkout/sessions" || r.Header.Get("Authorization") != "Bearer sk_test" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"type":"invalid_request_error","message":"No such path"}}`))
+			return
+		}
+		r.ParseForm()
+		form = r.PostForm
+		w.Write([]byte(`{"id":"cs_1","url":"https://checkout.stripe.com/c/cs_1"}`))
+	}))
+	defer server.Close()
+
+	p := NewStripeProvider("sk_test", "price_pro")
+	p.baseURL = server.URL
+	session, err := p.CreateCheckoutSession(context.Background(), "cus_1", "user-1", "https://app/success", "https://app/cancel")
+	if err != nil || session.ID != "cs_1" || session.URL == "" {
+		t.Fatalf("expected the session created; got %+v %v", session, err)
+	}
+	if form["customer"][0] != "cus_1" || form["line_items[0][price]"][0] != "price_pro" || form["mode"][0] != "subscription" {
+		t.Errorf("unexpected form: %v", form)
+	}
+
+	if _, err := p.CreatePortalSession(context.Background(), "cus_1", "https://app"); err == nil {
+		t.Error("expected the errors of the API returned")
+	}
+}
@@ -0,0 +1,21 @@
+// Package cache keeps computed values for a short time, in the memory of
+// the instance or in a Redis server shared by every instance of the server.
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Cache stores values under keys for a time to live. The values are opaque
+// bytes, the callers encode them.
+type Cache interface {
+	// Get returns the value stored under the key, ok is false when the key
+	// is unknown or expired.
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	// Set stores the value under the key for ttl, replacing the value
+	// stored under it.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete removes the keys, the missing ones are not an error.
+	Delete(ctx context.Context, keys ...string) error
+}
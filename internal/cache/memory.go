@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Memory keeps the values in the memory of the instance, for the
+// deployments running a single instance: the other instances would not see
+// its deletions.
+type Memory struct {
+	mu         sync.Mutex
+	entries    map[string]memoryEntry
+	maxEntries int
+	now        func() time.Time
+}
+
+type memoryEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// NewMemory returns an empty cache holding at most maxEntries values.
+func NewMemory(maxEntries int) *Memory {
+	return &Memory{
+		entries:    map[string]memoryEntry{},
+		maxEntries: maxEntries,
+		now:        time.Now,
+	}
+}
+
+func (m *Memory) Get(_ context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if !m.now().Before(entry.expiresAt) {
+		delete(m.entries, key)
+		return nil, false, nil
+	}
+	return entry.value, true, nil
+}
+
+func (m *Memory) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if _, ok := m.entries[key]; !ok && len(m.entries) >= m.maxEntries {
+		m.evict(now)
+	}
+	// The caller may reuse its buffer
+	m.entries[key] = memoryEntry{value: append([]byte(nil), value...), expiresAt: now.Add(ttl)}
+	return nil
+}
+
+func (m *Memory) Delete(_ context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, key := range keys {
+		delete(m.entries, key)
+	}
+	return nil
+}
+
+// evict makes room for an entry: it removes the expired entries, or the one
+// expiring first when none is.
+func (m *Memory) evict(now time.Time) {
+	var first string
+	var firstExpiresAt time.Time
+	evicted := false
+	for key, entry := range m.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(m.entries, key)
+			evicted = true
+			continue
+		}
+		if first == "" || entry.expiresAt.Before(firstExpiresAt) {
+			first, firstExpiresAt = key, entry.expiresAt
+		}
+	}
+	if !evicted && first != "" {
+		delete(m.entries, first)
+	}
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryExpiry(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	memory := NewMemory(10)
+	memory.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	value := []byte("dashboard")
+	if err := memory.Set(ctx, "key", value, time.Minute); err != nil {
+		t.Fatalf("error setting the value. Err: %v", err)
+	}
+	value[0] = 'D'
+	if got, ok, _ := memory.Get(ctx, "key"); !ok || string(got) != "dashboard" {
+		t.Errorf("expected the stored value; got %q, %v", got, ok)
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok, _ := memory.Get(ctx, "key"); ok {
+		t.Errorf("expected the value expired")
+	}
+
+	memory.Set(ctx, "key", value, time.Minute)
+	memory.Delete(ctx, "key", "missing")
+	if _, ok, _ := memory.Get(ctx, "key"); ok {
+		t.Errorf("expected the value deleted")
+	}
+}
+
+func TestMemoryEviction(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	memory := NewMemory(3)
+	memory.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	memory.Set(ctx, "short", []byte("1"), time.Second)
+	memory.Set(ctx, "long", []byte("2"), time.Hour)
+	memory.Set(ctx, "medium", []byte("3"), time.Minute)
+
+	// Full: the entry expiring first makes room
+	memory.Set(ctx, "new", []byte("4"), time.Hour)
+	if _, ok, _ := memory.Get(ctx, "short"); ok {
+		t.Errorf("expected the entry expiring first evicted")
+	}
+	for _, key := range []string{"long", "medium", "new"} {
+		if _, ok, _ := memory.Get(ctx, key); !ok {
+			t.Errorf("expected %s kept", key)
+		}
+	}
+
+	// Replacing an entry evicts nothing
+	memory.Set(ctx, "new", []byte("5"), time.Hour)
+	if len(memory.entries) != 3 {
+		t.Errorf("expected 3 entries; got %d", len(memory.entries))
+	}
+
+	now = now.Add(2 * time.Minute)
+	memory.Set(ctx, "later", []byte("6"), time.Hour)
+	if _, ok := memory.entries["medium"]; ok {
+		t.Errorf("expected the expired entry evicted")
+	}
+	if _, ok := memory.entries["long"]; !ok {
+		t.Errorf("expected the entries not expired kept")
+	}
+}
@@ -0,0 +1,241 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RedisConfig configures the connection to the Redis server.
+type RedisConfig struct {
+	Addr     string // host:port
+	Password string
+	DB       int
+	// Timeout bounds the dial and each command, the requests fall back to
+	// computing the values rather than waiting on a slow server
+	Timeout time.Duration
+	// PoolSize is the number of idle connections kept
+	PoolSize int
+}
+
+// Redis keeps the values in a Redis server, speaking its protocol (RESP)
+// over a small pool of connections. Only the commands the cache needs are
+// implemented.
+type Redis struct {
+	config RedisConfig
+	idle   chan *redisConn
+	dialer net.Dialer
+}
+
+// redisConn is a connection and the reader of its replies.
+type redisConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// redisError is an error reply of the server, the connection stays usable.
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// NewRedis returns the cache of the server, the connections are opened on
+// the first commands.
+func NewRedis(cfg RedisConfig) *Redis {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = time.Second
+	}
+	if cfg.PoolSize <= 0 {
+		cfg.PoolSize = 10
+	}
+	return &Redis{
+		config: cfg,
+		idle:   make(chan *redisConn, cfg.PoolSize),
+		dialer: net.Dialer{Timeout: cfg.Timeout},
+	}
+}
+
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	reply, err := r.do(ctx, "GET", key)
+	if err != nil || reply == nil {
+		return nil, false, err
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("redis: unexpected reply %v to GET", reply)
+	}
+	return value, true, nil
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	_, err := r.do(ctx, "SET", key, string(value), "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
+
+func (r *Redis) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err := r.do(ctx, "DEL", keys...)
+	return err
+}
+
+// Ping checks that the server answers.
+func (r *Redis) Ping(ctx context.Context) error {
+	_, err := r.do(ctx, "PING")
+	return err
+}
+
+// Close closes the idle connections.
+func (r *Redis) Close() error {
+	for {
+		select {
+		case conn := <-r.idle:
+			conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// do sends the command and returns its reply: nil, a string, an int64, a
+// []byte or a []any. A pooled connection the server closed in the meantime
+// is replaced once, the commands of the cache are safe to send again.
+func (r *Redis) do(ctx context.Context, name string, args ...string) (any, error) {
+	for attempt := 0; ; attempt++ {
+		conn, pooled, err := r.conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		reply, err := conn.command(ctx, r.config.Timeout, name, args...)
+		var replyErr redisError
+		if err != nil && !errors.As(err, &replyErr) {
+			conn.Close()
+			if pooled && attempt == 0 && ctx.Err() == nil {
+				continue
+			}
+			return nil, fmt.Errorf("redis %s: %w", name, err)
+		}
+
+		r.release(conn)
+		return reply, err
+	}
+}
+
+// conn returns an idle connection, or a new one authenticated and on the
+// database of the configuration. pooled tells which.
+func (r *Redis) conn(ctx context.Context) (*redisConn, bool, error) {
+	select {
+	case conn := <-r.idle:
+		return conn, true, nil
+	default:
+	}
+
+	c, err := r.dialer.DialContext(ctx, "tcp", r.config.Addr)
+	if err != nil {
+		return nil, false, fmt.Errorf("redis: %w", err)
+	}
+	conn := &redisConn{Conn: c, reader: bufio.NewReader(c)}
+
+	if r.config.Password != "" {
+		if _, err := conn.command(ctx, r.config.Timeout, "AUTH", r.config.Password); err != nil {
+			conn.Close()
+			return nil, false, err
+		}
+	}
+	if r.config.DB != 0 {
+		if _, err := conn.command(ctx, r.config.Timeout, "SELECT", strconv.Itoa(r.config.DB)); err != nil {
+			conn.Close()
+			return nil, false, err
+		}
+	}
+	return conn, false, nil
+}
+
+// release keeps the connection for the next commands, or closes it when
+// the pool is full.
+func (r *Redis) release(conn *redisConn) {
+	select {
+	case r.idle <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+// command writes the command as an array of bulk strings and reads its
+// reply, within the timeout or the deadline of ctx, whichever comes first.
+func (c *redisConn) command(ctx context.Context, timeout time.Duration, name string, args ...string) (any, error) {
+	deadline := time.Now().Add(timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if err := c.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n$%d\r\n%s\r\n", len(args)+1, len(name), name)
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c, b.String()); err != nil {
+		return nil, err
+	}
+	return readReply(c.reader)
+}
+
+// readReply reads a reply of the server. A nil bulk string or array is
+// returned as nil, an error reply as a redisError.
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("redis: invalid reply %q", line)
+	}
+	kind, line := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return line, nil
+	case '-':
+		return nil, redisError(line)
+	case ':':
+		return strconv.ParseInt(line, 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line)
+		if err != nil || size < 0 {
+			return nil, err
+		}
+		value := make([]byte, size+2)
+		if _, err := io.ReadFull(r, value); err != nil {
+			return nil, err
+		}
+		if string(value[size:]) != "\r\n" {
+			return nil, fmt.Errorf("redis: invalid bulk string")
+		}
+		return value[:size], nil
+	case '*':
+		count, err := strconv.Atoi(line)
+		if err != nil || count < 0 {
+			return nil, err
+		}
+		items := make([]any, count)
+		for i := range items {
+			if items[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: invalid reply %q", string(kind)+line)
+}
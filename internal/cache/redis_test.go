@@ -0,0 +1,181 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis answers the commands of the cache, keeping the values in a map.
+// The TTLs are recorded, not applied.
+type fakeRedis struct {
+	listener net.Listener
+	password string
+
+	mu       sync.Mutex
+	values   map[string]string
+	ttls     map[string]string
+	commands []string
+	// closeAfter closes each connection after this many commands when
+	// positive, like a server timing out the idle clients
+	closeAfter int
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening. Err: %v", err)
+	}
+	server := &fakeRedis{listener: listener, password: password, values: map[string]string{}, ttls: map[string]string{}}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	authenticated := f.password == ""
+
+	for served := 1; ; served++ {
+		request, err := readReply(reader)
+		if err != nil {
+			return
+		}
+		args := []string{}
+		for _, arg := range request.([]any) {
+			args = append(args, string(arg.([]byte)))
+		}
+
+		f.mu.Lock()
+		f.commands = append(f.commands, strings.Join(args, " "))
+		var reply string
+		switch {
+		case args[0] == "AUTH":
+			authenticated = args[1] == f.password
+			reply = "+OK\r\n"
+			if !authenticated {
+				reply = "-WRONGPASS invalid username-password pair\r\n"
+			}
+		case !authenticated:
+			reply = "-NOAUTH Authentication required.\r\n"
+		case args[0] == "PING":
+			reply = "+PONG\r\n"
+		case args[0] == "SELECT":
+			reply = "+OK\r\n"
+		case args[0] == "GET":
+			value, ok := f.values[args[1]]
+			reply = "$-1\r\n"
+			if ok {
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+			}
+		case args[0] == "SET":
+			f.values[args[1]] = args[2]
+			f.ttls[args[1]] = strings.Join(args[3:], " ")
+			reply = "+OK\r\n"
+		case args[0] == "DEL":
+			deleted := 0
+			for _, key := range args[1:] {
+				if _, ok := f.values[key]; ok {
+					delete(f.values, key)
+					deleted++
+				}
+			}
+			reply = fmt.Sprintf(":%d\r\n", deleted)
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		closeAfter := f.closeAfter
+		f.mu.Unlock()
+
+		conn.Write([]byte(reply))
+		if closeAfter > 0 && served >= closeAfter {
+			return
+		}
+	}
+}
+
+func TestRedisCommands(t *testing.T) {
+	server := newFakeRedis(t, "secret")
+	redis := NewRedis(RedisConfig{Addr: server.listener.Addr().String(), Password: "secret", DB: 2})
+	defer redis.Close()
+	ctx := context.Background()
+
+	if _, ok, err := redis.Get(ctx, "missing"); ok || err != nil {
+		t.Errorf("expected a miss; got %v, %v", ok, err)
+	}
+
+	value := "{\"total\":12.5}\r\n$3\r\nbin\x00ary"
+	if err := redis.Set(ctx, "finma:dashboard", []byte(value), 90*time.Second); err != nil {
+		t.Fatalf("error setting the value. Err: %v", err)
+	}
+	got, ok, err := redis.Get(ctx, "finma:dashboard")
+	if err != nil || !ok || string(got) != value {
+		t.Errorf("expected %q; got %q, %v, %v", value, got, ok, err)
+	}
+	server.mu.Lock()
+	ttl := server.ttls["finma:dashboard"]
+	server.mu.Unlock()
+	if ttl != "PX 90000" {
+		t.Errorf("expected PX 90000; got %q", ttl)
+	}
+
+	if err := redis.Delete(ctx, "finma:dashboard", "missing"); err != nil {
+		t.Fatalf("error deleting the keys. Err: %v", err)
+	}
+	if _, ok, _ := redis.Get(ctx, "finma:dashboard"); ok {
+		t.Errorf("expected the key deleted")
+	}
+
+	// One connection, authenticated and on the database once
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.commands[0] != "AUTH secret" || server.commands[1] != "SELECT 2" || len(server.commands) != 7 {
+		t.Errorf("expected AUTH and SELECT once; got %q", server.commands)
+	}
+}
+
+func TestRedisErrors(t *testing.T) {
+	server := newFakeRedis(t, "secret")
+	ctx := context.Background()
+
+	wrong := NewRedis(RedisConfig{Addr: server.listener.Addr().String(), Password: "wrong"})
+	if err := wrong.Ping(ctx); err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Errorf("expected WRONGPASS; got %v", err)
+	}
+
+	unreachable := NewRedis(RedisConfig{Addr: "127.0.0.1:1", Timeout: 100 * time.Millisecond})
+	if _, _, err := unreachable.Get(ctx, "key"); err == nil {
+		t.Errorf("expected an error from an unreachable server")
+	}
+}
+
+func TestRedisReplacesClosedConnections(t *testing.T) {
+	server := newFakeRedis(t, "")
+	server.closeAfter = 1
+	redis := NewRedis(RedisConfig{Addr: server.listener.Addr().String()})
+	defer redis.Close()
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if err := redis.Ping(ctx); err != nil {
+			t.Fatalf("expected the closed connection replaced; got %v", err)
+		}
+		// Let the server close the connection
+		time.Sleep(10 * time.Millisecond)
+	}
+}
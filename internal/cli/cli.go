@@ -0,0 +1,232 @@
+// Package cli implements the finma command: the server and the tasks run by
+// the operators, in containers and cron jobs. Each command builds only the
+// dependencies it needs from the configuration.
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"FinMa/internal/config"
+	"FinMa/internal/logging"
+)
+
+// The exit codes of the commands.
+const (
+	ExitOK      = 0
+	ExitFailure = 1 // The command failed, see the error
+	ExitUsage   = 2 // The arguments are invalid
+	ExitPending = 3 // "migrate status": the schema is not up to date
+)
+
+// errPending is returned by "migrate status" when migrations are pending.
+var errPending = errors.New("migrations are pending, run finma migrate up")
+
+// usageError is an invalid invocation of a command, answered with its help.
+type usageError struct {
+	message string
+}
+
+func (e usageError) Error() string {
+	return e.message
+}
+
+func usagef(format string, args ...any) error {
+	return usageError{message: fmt.Sprintf(format, args...)}
+}
+
+// env is what a command runs with.
+type env struct {
+	stdin  *bufio.Reader
+	stdout io.Writer
+	stderr io.Writer
+	// loadConfig returns the configuration, loaded by the commands that
+	// need it
+	loadConfig func() (config.Config, error)
+}
+
+// command is a subcommand of finma.
+type command struct {
+	name    string
+	args    string // Synopsis of the arguments, after the flags
+	summary string
+	// flags declares the flags of the command on the set, and returns the
+	// function running it with the remaining arguments
+	flags func(fs *flag.FlagSet) func(ctx context.Context, e *env, args []string) error
+}
+
+// commands are the subcommands, in the order of the help.
+var commands = []command{
+	serveCommand,
+	migrateCommand,
+	seedCommand,
+	createAdminCommand,
+	exportCommand,
+	migrateStorageCommand,
+	maintenanceCommand,
+	encryptionCommand,
+}
+
+// Run runs the command of the arguments, without the program name, and
+// returns its exit code. Without arguments the server is started. The log
+// is written to stderr, redacted.
+func Run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	logging.SetOutput(stderr)
+	e := &env{
+		stdin:      bufio.NewReader(stdin),
+		stdout:     stdout,
+		stderr:     stderr,
+		loadConfig: config.Load,
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	return run(ctx, e, args)
+}
+
+func run(ctx context.Context, e *env, args []string) int {
+	if len(args) == 0 {
+		args = []string{serveCommand.name}
+	}
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		if len(args) > 1 {
+			if cmd, ok := findCommand(args[1]); ok {
+				fs := newFlagSet(cmd, e.stdout)
+				cmd.flags(fs)
+				printCommandUsage(e.stdout, cmd, fs)
+				return ExitOK
+			}
+		}
+		printUsage(e.stdout)
+		return ExitOK
+	}
+
+	cmd, ok := findCommand(args[0])
+	if !ok {
+		fmt.Fprintf(e.stderr, "finma: unknown command %q\n\n", args[0])
+		printUsage(e.stderr)
+		return ExitUsage
+	}
+
+	fs := newFlagSet(cmd, e.stderr)
+	runCmd := cmd.flags(fs)
+	positional, err := parseFlags(fs, args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK
+		}
+		return ExitUsage
+	}
+
+	err = runCmd(ctx, e, positional)
+	var usageErr usageError
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.As(err, &usageErr):
+		fmt.Fprintf(e.stderr, "finma %s: %s\n\n", cmd.name, usageErr.message)
+		printCommandUsage(e.stderr, cmd, fs)
+		return ExitUsage
+	case errors.Is(err, errPending):
+		fmt.Fprintf(e.stderr, "finma %s: %s\n", cmd.name, err)
+		return ExitPending
+	default:
+		fmt.Fprintf(e.stderr, "finma %s: %s\n", cmd.name, err)
+		return ExitFailure
+	}
+}
+
+// parseFlags parses the flags of the arguments, before or after the
+// positional arguments as in "migrate down --yes", and returns the
+// positional arguments. The arguments after "--" are all positional.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		if args[0] == "--" {
+			return append(positional, args[1:]...), nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+func newFlagSet(cmd command, output io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet("finma "+cmd.name, flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.Usage = func() { printCommandUsage(output, cmd, fs) }
+	return fs
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprint(w, `FinMa personal finance server.
+
+Usage:
+  finma <command> [flags] [arguments]
+
+Commands:
+`)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-16s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprint(w, `
+Without a command the server is started. The configuration is read from the
+file named by FINMA_CONFIG_FILE and from the environment, see README.md.
+Run "finma help <command>" for the flags of a command.
+
+Exit codes: 0 success, 1 failure, 2 invalid arguments, 3 migrations pending.
+`)
+}
+
+func printCommandUsage(w io.Writer, cmd command, fs *flag.FlagSet) {
+	synopsis := "finma " + cmd.name
+	hasFlags := false
+	fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+	if hasFlags {
+		synopsis += " [flags]"
+	}
+	if cmd.args != "" {
+		synopsis += " " + cmd.args
+	}
+	fmt.Fprintf(w, "Usage:\n  %s\n\n%s\n", synopsis, cmd.summary)
+	if hasFlags {
+		fmt.Fprint(w, "\nFlags:\n")
+		fs.SetOutput(w)
+		fs.PrintDefaults()
+	}
+}
+
+// prompt reads a line answering the question from stdin, written on
+// stderr so that the output of the command stays clean. It fails on an
+// empty answer, or when stdin is closed as in a container without a terminal.
+func (e *env) prompt(question string) (string, error) {
+	fmt.Fprint(e.stderr, question)
+	line, err := e.stdin.ReadString('\n')
+	line = strings.TrimSpace(line)
+	if line == "" || (err != nil && err != io.EOF) {
+		return "", fmt.Errorf("no answer to %q, pass it as a flag", strings.TrimSuffix(strings.TrimSpace(question), ":"))
+	}
+	return line, nil
+}
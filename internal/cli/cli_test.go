@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+
+	"FinMa/internal/config"
+)
+
+// errNoConfig fails the commands reaching for the database.
+var errNoConfig = errors.New("no configuration in tests")
+
+func runTest(stdin string, args ...string) (code int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	e := &env{
+		stdin:  bufio.NewReader(strings.NewReader(stdin)),
+		stdout: &out,
+		stderr: &errOut,
+		loadConfig: func() (config.Config, error) {
+			return config.Config{}, errNoConfig
+		},
+	}
+	code = run(context.Background(), e, args)
+	return code, out.String(), errOut.String()
+}
+
+func TestHelp(t *testing.T) {
+	code, stdout, _ := runTest("", "help")
+	if code != ExitOK {
+		t.Errorf("expected exit code 0; got %d", code)
+	}
+	for _, cmd := range commands {
+		if !strings.Contains(stdout, cmd.name) {
+			t.Errorf("expected the help to list %s; got %q", cmd.name, stdout)
+		}
+	}
+
+	code, stdout, _ = runTest("", "help", "export")
+	if code != ExitOK || !strings.Contains(stdout, "-user") || !strings.Contains(stdout, "-out") {
+		t.Errorf("expected the flags of export; got %d, %q", code, stdout)
+	}
+
+	if code, _, _ := runTest("", "seed", "-h"); code != ExitOK {
+		t.Errorf("expected exit code 0 for -h; got %d", code)
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	tests := []struct {
+		args   []string
+		stderr string
+	}{
+		{[]string{"bogus"}, `unknown command "bogus"`},
+		{[]string{"seed", "--unknown"}, "flag provided but not defined"},
+		{[]string{"export"}, "--user is required"},
+		{[]string{"migrate"}, "expected one of up, down or status"},
+		{[]string{"migrate", "sideways"}, `unknown action "sideways"`},
+		{[]string{"migrate", "down"}, "pass --yes to confirm"},
+		{[]string{"maintenance"}, "expected one of on, off or status"},
+		{[]string{"maintenance", "later"}, `unknown action "later"`},
+		{[]string{"maintenance", "off", "--message", "Back soon"}, "--message only applies to on"},
+		{[]string{"encryption"}, "expected rotate"},
+		{[]string{"encryption", "decrypt"}, `unknown action "decrypt"`},
+		{[]string{"create-admin", "--email", "not-an-email", "--password", "Correct-horse-1"}, "is not a valid email"},
+		{[]string{"create-admin", "--email", "ada@example.com", "--password", "weak"}, "password must be"},
+		{[]string{"serve", "--port", "70000"}, "is not a valid port"},
+	}
+
+	for _, tt := range tests {
+		code, _, stderr := runTest("", tt.args...)
+		if code != ExitUsage {
+			t.Errorf("%v: expected exit code 2; got %d", tt.args, code)
+		}
+		if !strings.Contains(stderr, tt.stderr) {
+			t.Errorf("%v: expected %q in the output; got %q", tt.args, tt.stderr, stderr)
+		}
+	}
+}
+
+func TestCommandFailure(t *testing.T) {
+	code, _, stderr := runTest("", "migrate", "down", "--yes")
+	if code != ExitFailure || !strings.Contains(stderr, errNoConfig.Error()) {
+		t.Errorf("expected the configuration error with exit code 1; got %d, %q", code, stderr)
+	}
+}
+
+func TestCreateAdminPrompts(t *testing.T) {
+	// The answers are valid, the command fails on the configuration
+	code, _, stderr := runTest("ada@example.com\nCorrect-horse-1\n", "create-admin")
+	if code != ExitFailure || !strings.Contains(stderr, "Email: Password: ") {
+		t.Errorf("expected both values prompted; got %d, %q", code, stderr)
+	}
+
+	code, _, stderr = runTest("ada@example.com\n", "create-admin")
+	if code != ExitFailure || !strings.Contains(stderr, `no answer to "Password"`) {
+		t.Errorf("expected the missing answer to fail; got %d, %q", code, stderr)
+	}
+}
+
+func TestParseFlags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	yes := fs.Bool("yes", false, "")
+	out := fs.String("out", "", "")
+
+	positional, err := parseFlags(fs, []string{"down", "--yes", "--out", "file.json", "--", "--raw"})
+	if err != nil {
+		t.Fatalf("error parsing the flags. Err: %v", err)
+	}
+	if !*yes || *out != "file.json" {
+		t.Errorf("expected the flags after the arguments to be parsed; got %v, %q", *yes, *out)
+	}
+	if !reflect.DeepEqual(positional, []string{"down", "--raw"}) {
+		t.Errorf("expected [down --raw]; got %v", positional)
+	}
+}
@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+)
+
+var encryptionCommand = command{
+	name:    "encryption",
+	args:    "rotate",
+	summary: "Encrypt the sensitive columns again with ENCRYPTION_KEY, once the replaced key is in ENCRYPTION_PREVIOUS_KEYS",
+	flags: func(fs *flag.FlagSet) func(context.Context, *env, []string) error {
+		return func(ctx context.Context, e *env, args []string) error {
+			if len(args) != 1 {
+				return usagef("expected rotate")
+			}
+			if args[0] != "rotate" {
+				return usagef("unknown action %q, expected rotate", args[0])
+			}
+
+			db, err := openMigratedDatabase(e)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			rotated, err := db.RotateEncryptionKey()
+			if err != nil {
+				return fmt.Errorf("rotated %d values before failing: %w", rotated, err)
+			}
+			fmt.Fprintf(e.stdout, "Rotated %d values, ENCRYPTION_PREVIOUS_KEYS can be removed\n", rotated)
+			return nil
+		}
+	},
+}
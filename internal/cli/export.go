@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/google/uuid"
+)
+
+var exportCommand = command{
+	name:    "export",
+	summary: "Export the data of a user as JSON, to a file or to stdout",
+	flags: func(fs *flag.FlagSet) func(context.Context, *env, []string) error {
+		email := fs.String("user", "", "email of the user to export (required)")
+		out := fs.String("out", "-", "file to write the export to, - for stdout")
+		return func(ctx context.Context, e *env, args []string) error {
+			if len(args) > 0 {
+				return usagef("unexpected arguments %v", args)
+			}
+			if *email == "" {
+				return usagef("--user is required")
+			}
+
+			db, err := openMigratedDatabase(e)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			user := db.GetUserByEmail(*email)
+			if user.ID == uuid.Nil {
+				return fmt.Errorf("no user has the email %s", *email)
+			}
+			export, err := db.ExportUser(&user)
+			if err != nil {
+				return err
+			}
+
+			if *out == "-" {
+				return writeJSON(e.stdout, export)
+			}
+			// The export holds personal data, readable by the owner only
+			file, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+			if err != nil {
+				return err
+			}
+			if err := writeJSON(file, export); err != nil {
+				file.Close()
+				return err
+			}
+			if err := file.Close(); err != nil {
+				return err
+			}
+			fmt.Fprintf(e.stderr, "Exported %s to %s\n", user.Email, *out)
+			return nil
+		}
+	},
+}
+
+func writeJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"FinMa/types"
+)
+
+var maintenanceCommand = command{
+	name:    "maintenance",
+	args:    "on|off|status",
+	summary: "Turn the maintenance mode of the API on or off, the running instances apply it within seconds",
+	flags: func(fs *flag.FlagSet) func(context.Context, *env, []string) error {
+		message := fs.String("message", "", "message shown to the refused users, with on")
+		return func(ctx context.Context, e *env, args []string) error {
+			if len(args) != 1 {
+				return usagef("expected one of on, off or status")
+			}
+			action := args[0]
+			if action != "on" && action != "off" && action != "status" {
+				return usagef("unknown action %q, expected one of on, off or status", action)
+			}
+			if *message != "" && action != "on" {
+				return usagef("--message only applies to on")
+			}
+
+			// The maintenance mode is turned on before migrating, the
+			// schema is not checked
+			db, err := openDatabase(e)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			if action != "status" {
+				maintenance := types.Maintenance{Enabled: action == "on", Message: *message, UpdatedAt: time.Now()}
+				if err := db.SetMaintenance(&maintenance); err != nil {
+					return err
+				}
+			}
+
+			maintenance, err := db.GetMaintenance()
+			if err != nil {
+				return err
+			}
+			switch {
+			case maintenance == nil:
+				fmt.Fprintln(e.stdout, "The maintenance mode was never set, MAINTENANCE_MODE applies")
+			case maintenance.Enabled && maintenance.Message != "":
+				fmt.Fprintf(e.stdout, "The maintenance mode is on since %s: %s\n", maintenance.UpdatedAt.Format(time.RFC3339), maintenance.Message)
+			case maintenance.Enabled:
+				fmt.Fprintf(e.stdout, "The maintenance mode is on since %s\n", maintenance.UpdatedAt.Format(time.RFC3339))
+			default:
+				fmt.Fprintf(e.stdout, "The maintenance mode is off since %s\n", maintenance.UpdatedAt.Format(time.RFC3339))
+			}
+			return nil
+		}
+	},
+}
@@ -0,0 +1,141 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"FinMa/internal/database"
+	"FinMa/internal/server"
+)
+
+var migrateCommand = command{
+	name:    "migrate",
+	args:    "up|down|status",
+	summary: "Migrate the database schema: up creates or updates the tables, down drops them, status lists the pending changes",
+	flags: func(fs *flag.FlagSet) func(context.Context, *env, []string) error {
+		yes := fs.Bool("yes", false, "confirm \"migrate down\", which deletes every table with its data")
+		return func(ctx context.Context, e *env, args []string) error {
+			if len(args) != 1 {
+				return usagef("expected one of up, down or status")
+			}
+			action := args[0]
+			if action != "up" && action != "down" && action != "status" {
+				return usagef("unknown action %q, expected one of up, down or status", action)
+			}
+			if action == "down" && !*yes {
+				return usagef("\"migrate down\" deletes every table with its data, pass --yes to confirm")
+			}
+
+			db, err := openDatabase(e)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			switch action {
+			case "up":
+				if err := db.Migrate(); err != nil {
+					return err
+				}
+				fmt.Fprintln(e.stdout, "The database is up to date")
+			case "down":
+				if err := db.DropTables(); err != nil {
+					return err
+				}
+				fmt.Fprintln(e.stdout, "The tables are dropped")
+			case "status":
+				return printMigrationStatus(e, db)
+			}
+			return nil
+		}
+	},
+}
+
+// printMigrationStatus lists the tables and their missing columns, and
+// returns errPending when the schema is not up to date.
+func printMigrationStatus(e *env, db database.Service) error {
+	statuses, err := db.MigrationStatus()
+	if err != nil {
+		return err
+	}
+
+	pending := false
+	for _, status := range statuses {
+		switch {
+		case !status.Exists:
+			pending = true
+			fmt.Fprintf(e.stdout, "%-32s missing\n", status.Table)
+		case len(status.MissingColumns) > 0:
+			pending = true
+			fmt.Fprintf(e.stdout, "%-32s missing columns: %s\n", status.Table, strings.Join(status.MissingColumns, ", "))
+		default:
+			fmt.Fprintf(e.stdout, "%-32s up to date\n", status.Table)
+		}
+	}
+	if pending {
+		return errPending
+	}
+	return nil
+}
+
+// openDatabase connects to the database of the configuration without
+// migrating it.
+func openDatabase(e *env) (database.Service, error) {
+	cfg, err := e.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	return database.Open(cfg.DB)
+}
+
+// openMigratedDatabase connects to the database of the configuration, which
+// must be up to date: the commands writing data never migrate it silently.
+func openMigratedDatabase(e *env) (database.Service, error) {
+	db, err := openDatabase(e)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkMigrated(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// checkMigrated returns errPending when the schema is not up to date.
+func checkMigrated(db database.Service) error {
+	statuses, err := db.MigrationStatus()
+	if err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		if !status.Exists || len(status.MissingColumns) > 0 {
+			return errPending
+		}
+	}
+	return nil
+}
+
+var migrateStorageCommand = command{
+	name:    "migrate-storage",
+	summary: "Copy the uploaded files of the local directory to the S3 bucket, before switching STORAGE_DRIVER to s3",
+	flags: func(fs *flag.FlagSet) func(context.Context, *env, []string) error {
+		return func(ctx context.Context, e *env, args []string) error {
+			if len(args) > 0 {
+				return usagef("unexpected arguments %v", args)
+			}
+			cfg, err := e.loadConfig()
+			if err != nil {
+				return err
+			}
+			copied, err := server.MigrateStorage(ctx, cfg.Storage)
+			if err != nil {
+				return fmt.Errorf("storage migration failed: %w", err)
+			}
+			fmt.Fprintf(e.stdout, "Copied %d files to the bucket %s, set STORAGE_DRIVER=s3 to use it\n", copied, cfg.Storage.S3Bucket)
+			return nil
+		}
+	},
+}
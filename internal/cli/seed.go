@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"FinMa/internal/seed"
+)
+
+var seedCommand = command{
+	name:    "seed",
+	summary: "Create a demo user with accounts, transactions and a budget, for development",
+	flags: func(fs *flag.FlagSet) func(context.Context, *env, []string) error {
+		email := fs.String("email", "demo@finma.local", "email of the demo user")
+		password := fs.String("password", "Demo-password-1", "password of the demo user")
+		return func(ctx context.Context, e *env, args []string) error {
+			if len(args) > 0 {
+				return usagef("unexpected arguments %v", args)
+			}
+			user, err := newUser(*email, *password, "Demo", "User", "user")
+			if err != nil {
+				return err
+			}
+
+			db, err := openMigratedDatabase(e)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			// Seeding twice leaves the first demo user as is
+			if existing := db.GetUserByEmail(user.Email); existing.ID != uuid.Nil {
+				fmt.Fprintf(e.stdout, "The demo user %s already exists\n", user.Email)
+				return nil
+			}
+			if err := db.CreateUser(user); err != nil {
+				return err
+			}
+			if err := seed.Create(db, user.ID, time.Now()); err != nil {
+				return err
+			}
+			fmt.Fprintf(e.stdout, "Created the demo user %s with the password %s\n", user.Email, *password)
+			return nil
+		}
+	},
+}
@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2/middleware/helmet"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+
+	"FinMa/internal/server"
+)
+
+var serveCommand = command{
+	name:    "serve",
+	summary: "Start the API server and its background jobs, migrating the database first",
+	flags: func(fs *flag.FlagSet) func(context.Context, *env, []string) error {
+		port := fs.Int("port", 0, "port to listen on, overriding PORT")
+		return func(ctx context.Context, e *env, args []string) error {
+			if len(args) > 0 {
+				return usagef("unexpected arguments %v", args)
+			}
+			if *port < 0 || *port > 65535 {
+				return usagef("%d is not a valid port", *port)
+			}
+			cfg, err := e.loadConfig()
+			if err != nil {
+				return err
+			}
+			if *port != 0 {
+				cfg.Server.Port = *port
+			}
+
+			server := server.New(cfg)
+
+			server.RegisterFiberRoutes()
+			server.StartBalanceCheck(time.Hour)
+			server.StartBankSync(6 * time.Hour)
+			server.StartDueReminders(24 * time.Hour)
+			server.StartBillReminders(6 * time.Hour)
+			server.StartSubscriptionDetection(24 * time.Hour)
+			server.StartBalanceSnapshots(24 * time.Hour)
+			server.StartWeeklyDigests(time.Hour)
+			server.StartReportSchedules(15 * time.Minute)
+			server.StartNotificationCleanup(6 * time.Hour)
+			server.StartPrivacyRequests(time.Minute)
+			server.StartDemoCleanup(time.Hour)
+			server.StartBillingGrace(time.Hour)
+			server.StartSyncCleanup(6 * time.Hour)
+			server.Use(helmet.New())
+			server.Use(limiter.New())
+
+			err = server.ListenUntilSignal(
+				fmt.Sprintf(":%d", cfg.Server.Port),
+				time.Duration(cfg.Server.ReadinessDelay)*time.Second,
+				time.Duration(cfg.Server.ShutdownGracePeriod)*time.Second,
+			)
+			if err != nil {
+				return fmt.Errorf("cannot start server: %w", err)
+			}
+			return nil
+		}
+	},
+}
@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/mail"
+	"time"
+
+	"github.com/google/uuid"
+
+	"FinMa/internal/database"
+	"FinMa/types"
+	"FinMa/utils"
+)
+
+var createAdminCommand = command{
+	name:    "create-admin",
+	summary: "Create an admin account, prompting on stdin for the values not passed as flags",
+	flags: func(fs *flag.FlagSet) func(context.Context, *env, []string) error {
+		email := fs.String("email", "", "email of the admin")
+		password := fs.String("password", "", "password of the admin, 8 to 30 characters with a digit, an upper and a lower case letter")
+		firstName := fs.String("first-name", "Admin", "first name of the admin")
+		lastName := fs.String("last-name", "FinMa", "last name of the admin")
+		return func(ctx context.Context, e *env, args []string) error {
+			if len(args) > 0 {
+				return usagef("unexpected arguments %v", args)
+			}
+			var err error
+			if *email == "" {
+				if *email, err = e.prompt("Email: "); err != nil {
+					return err
+				}
+			}
+			if *password == "" {
+				// The password is echoed, pipe it in or pass the flag to hide it
+				if *password, err = e.prompt("Password: "); err != nil {
+					return err
+				}
+			}
+
+			user, err := newUser(*email, *password, *firstName, *lastName, "admin")
+			if err != nil {
+				return err
+			}
+
+			db, err := openMigratedDatabase(e)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			if err := createUser(db, user); err != nil {
+				return err
+			}
+			fmt.Fprintf(e.stdout, "Created the admin %s (%s)\n", user.Email, user.ID)
+			return nil
+		}
+	},
+}
+
+// newUser validates the email and the password of a user and returns it,
+// its password hashed.
+func newUser(email, password, firstName, lastName, role string) (types.User, error) {
+	if _, err := mail.ParseAddress(email); err != nil {
+		return types.User{}, usagef("%q is not a valid email", email)
+	}
+	if err := utils.ValidatePassword(password); err != nil {
+		return types.User{}, usagef("%s", err)
+	}
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		return types.User{}, err
+	}
+
+	now := time.Now()
+	return types.User{
+		ID:        uuid.New(),
+		FirstName: firstName,
+		LastName:  lastName,
+		Email:     email,
+		Password:  hashedPassword,
+		Role:      role,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, nil
+}
+
+// createUser stores the user, whose email must not be taken.
+func createUser(db database.Service, user types.User) error {
+	if existing := db.GetUserByEmail(user.Email); existing.ID != uuid.Nil {
+		return fmt.Errorf("an account already uses the email %s", user.Email)
+	}
+	return db.CreateUser(user)
+}
@@ -0,0 +1,617 @@
+// Package config loads the configuration of the application once at
+// startup: the defaults, overridden by the file named by FINMA_CONFIG_FILE,
+// overridden by the environment.
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"FinMa/internal/flags"
+	"FinMa/internal/fx"
+)
+
+// FileEnv names the optional YAML or JSON configuration file.
+const FileEnv = "FINMA_CONFIG_FILE"
+
+// Config is the configuration of the application. Each field is read from
+// the environment variable of its env tag, or from the file under the path
+// of its JSON tags, like "db.host".
+type Config struct {
+	Server   Server   `json:"server"`
+	DB       DB       `json:"db"`
+	Auth     Auth     `json:"auth"`
+	SMTP     SMTP     `json:"smtp"`
+	Push     Push     `json:"push"`
+	BankSync BankSync `json:"bank_sync"`
+	FX       FX       `json:"fx"`
+	Storage  Storage  `json:"storage"`
+	Cache    Cache    `json:"cache"`
+	Features Features `json:"features"`
+	Plans    Plans    `json:"plans"`
+	Billing  Billing  `json:"billing"`
+}
+
+// Server configures the HTTP server.
+type Server struct {
+	Port   int    `json:"port" env:"PORT"`
+	Env    string `json:"env" env:"APP_ENV"`
+	AppURL string `json:"app_url" env:"APP_URL"` // Public URL of the API, used in the links of the emails
+
+	ShutdownGracePeriod int `json:"shutdown_grace_period" env:"SHUTDOWN_GRACE_PERIOD"`       // Seconds
+	ReadinessDelay      int `json:"shutdown_readiness_delay" env:"SHUTDOWN_READINESS_DELAY"` // Seconds
+
+	RequestTimeout       int `json:"request_timeout" env:"REQUEST_TIMEOUT"`                  // Seconds a request may run before a 504
+	LongRequestTimeout   int `json:"long_request_timeout" env:"LONG_REQUEST_TIMEOUT"`        // Seconds, for the routes known to be slow
+	SlowRequestThreshold int `json:"slow_request_threshold" env:"SLOW_REQUEST_THRESHOLD_MS"` // Milliseconds after which a request is logged as slow
+
+	BodyLimit       int `json:"body_limit_kb" env:"BODY_LIMIT_KB"`               // Largest request body, in KB
+	UploadBodyLimit int `json:"upload_body_limit_kb" env:"UPLOAD_BODY_LIMIT_KB"` // Largest request body of the upload routes, in KB
+
+	LegacyAliases bool   `json:"api_legacy_aliases" env:"API_LEGACY_ALIASES"`
+	LegacySunset  string `json:"api_legacy_sunset" env:"API_LEGACY_SUNSET"` // YYYY-MM-DD
+	APIDocs       bool   `json:"api_docs_enabled" env:"API_DOCS_ENABLED"`
+	MetricsToken  string `json:"metrics_token" env:"METRICS_TOKEN"`
+
+	Maintenance           bool `json:"maintenance" env:"MAINTENANCE_MODE"`                    // Until an admin sets the maintenance mode
+	MaintenanceRetryAfter int  `json:"maintenance_retry_after" env:"MAINTENANCE_RETRY_AFTER"` // Seconds, in the Retry-After of the refused requests
+
+	TLS  TLS  `json:"tls"`
+	CORS CORS `json:"cors"`
+	Log  Log  `json:"log"`
+}
+
+// TLS configures the HTTPS listener, for the deployments without a TLS
+// terminating proxy. It is off without a certificate nor autocert hosts.
+type TLS struct {
+	CertFile         string   `json:"cert_file" env:"TLS_CERT_FILE"` // Reloaded on SIGHUP
+	KeyFile          string   `json:"key_file" env:"TLS_KEY_FILE"`
+	AutocertHosts    []string `json:"autocert_hosts" env:"TLS_AUTOCERT_HOSTS"` // Hostnames the Let's Encrypt certificates are requested for
+	AutocertCacheDir string   `json:"autocert_cache_dir" env:"TLS_AUTOCERT_CACHE_DIR"`
+	AutocertEmail    string   `json:"autocert_email" env:"TLS_AUTOCERT_EMAIL"`
+	RedirectAddr     string   `json:"redirect_addr" env:"TLS_REDIRECT_ADDR"` // Plain HTTP listener redirecting to HTTPS, like ":80", none when empty
+	HSTSMaxAge       int      `json:"hsts_max_age" env:"TLS_HSTS_MAX_AGE"`   // Seconds, 0 disables the Strict-Transport-Security header
+}
+
+// CORS configures which browser origins may call the API.
+type CORS struct {
+	AllowedOrigins   []string `json:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"` // Exact origins, like "https://app.example.com", or "*" without credentials
+	AllowedMethods   []string `json:"allowed_methods" env:"CORS_ALLOWED_METHODS"`
+	AllowedHeaders   []string `json:"allowed_headers" env:"CORS_ALLOWED_HEADERS"`
+	AllowCredentials bool     `json:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS"` // Let the browsers send cookies and authorization headers
+	MaxAge           int      `json:"max_age" env:"CORS_MAX_AGE"`                     // Seconds the browsers cache a preflight response
+}
+
+// Log configures the request log.
+type Log struct {
+	Format            string `json:"format" env:"LOG_FORMAT"` // "json" or "text"
+	Level             string `json:"level" env:"LOG_LEVEL"`
+	RequestBodies     bool   `json:"request_bodies" env:"LOG_REQUEST_BODIES"`
+	RequestBodyLength int    `json:"request_body_length" env:"LOG_REQUEST_BODY_LENGTH"`
+}
+
+// DB configures the connection to Postgres.
+type DB struct {
+	Host     string `json:"host" env:"DB_HOST"`
+	Port     int    `json:"port" env:"DB_PORT"`
+	Database string `json:"database" env:"DB_DATABASE"`
+	Username string `json:"username" env:"DB_USERNAME"`
+	Password string `json:"password" env:"DB_PASSWORD"`
+	Schema   string `json:"schema" env:"DB_SCHEMA"`
+	// Keys of the encrypted columns, base64 encoded 32 bytes keys: the
+	// values are encrypted with EncryptionKey and read with it or one of the
+	// previous keys until "finma encryption rotate" ran
+	EncryptionKey          string   `json:"encryption_key" env:"ENCRYPTION_KEY"`
+	PreviousEncryptionKeys []string `json:"previous_encryption_keys" env:"ENCRYPTION_PREVIOUS_KEYS"`
+}
+
+// Auth holds the secrets of the tokens.
+type Auth struct {
+	AccessTokenSecret  string `json:"access_token_secret" env:"ACCESS_TOKEN_SECRET"`
+	RefreshTokenSecret string `json:"refresh_token_secret" env:"REFRESH_TOKEN_SECRET"`
+	// Cookies returns the tokens of a login in HttpOnly cookies, which
+	// requires TLS unless InsecureCookies is set, behind a TLS terminating
+	// proxy or in development
+	Cookies         bool `json:"cookies" env:"AUTH_COOKIES"`
+	InsecureCookies bool `json:"insecure_cookies" env:"AUTH_INSECURE_COOKIES"`
+}
+
+// SMTP configures the emails and their queue.
+type SMTP struct {
+	Driver    string `json:"driver" env:"MAIL_DRIVER"` // "smtp", or "log" to only log the emails
+	Host      string `json:"host" env:"SMTP_HOST"`
+	Port      int    `json:"port" env:"SMTP_PORT"`
+	Username  string `json:"username" env:"SMTP_USERNAME"`
+	Password  string `json:"password" env:"SMTP_PASSWORD"`
+	TLS       string `json:"tls" env:"SMTP_TLS"` // "starttls", "tls" or "none"
+	From      string `json:"from" env:"MAIL_FROM"`
+	Workers   int    `json:"workers" env:"MAIL_WORKERS"`
+	QueueSize int    `json:"queue_size" env:"MAIL_QUEUE_SIZE"`
+	Attempts  int    `json:"attempts" env:"MAIL_ATTEMPTS"`
+}
+
+// Push configures the Web Push notifications, disabled without the keys.
+type Push struct {
+	VAPIDPublicKey  string `json:"vapid_public_key" env:"VAPID_PUBLIC_KEY"`
+	VAPIDPrivateKey string `json:"vapid_private_key" env:"VAPID_PRIVATE_KEY"`
+	VAPIDSubject    string `json:"vapid_subject" env:"VAPID_SUBJECT"`
+	HourlyLimit     int    `json:"hourly_limit" env:"PUSH_HOURLY_LIMIT"`
+}
+
+// BankSync configures the bank data provider, disabled without the secrets.
+type BankSync struct {
+	GoCardlessSecretID  string `json:"gocardless_secret_id" env:"GOCARDLESS_SECRET_ID"`
+	GoCardlessSecretKey string `json:"gocardless_secret_key" env:"GOCARDLESS_SECRET_KEY"`
+	// WebhookSecret signs the webhooks of the provider, they are refused
+	// without it
+	WebhookSecret string `json:"webhook_secret" env:"BANK_SYNC_WEBHOOK_SECRET"`
+}
+
+// FX configures the exchange rates: fetched from a Frankfurter API, or read
+// from a static file when the API cannot be reached.
+type FX struct {
+	Provider    string `json:"provider" env:"FX_PROVIDER"`         // "frankfurter", or "none" to only use the static file
+	ProviderURL string `json:"provider_url" env:"FX_PROVIDER_URL"` // Frankfurter compatible API
+	StaticFile  string `json:"static_file" env:"FX_STATIC_FILE"`   // JSON file of rates, see fx.StaticProvider
+	Timeout     int    `json:"timeout" env:"FX_TIMEOUT"`           // Seconds a request to the API may take
+}
+
+// Storage configures where the uploaded files are kept: on the local disk,
+// or in an S3 compatible bucket when several instances run.
+type Storage struct {
+	Driver            string `json:"driver" env:"STORAGE_DRIVER"` // "local" or "s3"
+	LocalDir          string `json:"local_dir" env:"STORAGE_LOCAL_DIR"`
+	S3Endpoint        string `json:"s3_endpoint" env:"S3_ENDPOINT"`
+	S3Region          string `json:"s3_region" env:"S3_REGION"`
+	S3Bucket          string `json:"s3_bucket" env:"S3_BUCKET"`
+	S3AccessKeyID     string `json:"s3_access_key_id" env:"S3_ACCESS_KEY_ID"`
+	S3SecretAccessKey string `json:"s3_secret_access_key" env:"S3_SECRET_ACCESS_KEY"`
+	S3PathStyle       bool   `json:"s3_path_style" env:"S3_PATH_STYLE"`                 // Required by MinIO
+	SignedURLExpiry   int    `json:"signed_url_expiry" env:"STORAGE_SIGNED_URL_EXPIRY"` // Seconds
+}
+
+// Cache configures the cache of the dashboard and of the reports: in the
+// memory of the instance, or in Redis when several instances run.
+type Cache struct {
+	Driver        string `json:"driver" env:"CACHE_DRIVER"` // "memory", "redis" or "none"
+	TTL           int    `json:"ttl" env:"CACHE_TTL"`       // Seconds a response is served from the cache
+	MemoryEntries int    `json:"memory_entries" env:"CACHE_MEMORY_ENTRIES"`
+	RedisAddr     string `json:"redis_addr" env:"REDIS_ADDR"` // host:port
+	RedisPassword string `json:"redis_password" env:"REDIS_PASSWORD"`
+	RedisDB       int    `json:"redis_db" env:"REDIS_DB"`
+}
+
+// Plans configures the limits of the plans of a hosted offering, 0 for
+// unlimited. The users are on the default plan until an admin moves them.
+type Plans struct {
+	Default                 string `json:"default" env:"PLAN_DEFAULT"` // "free" or "pro"
+	FreeAccounts            int64  `json:"free_max_accounts" env:"PLAN_FREE_MAX_ACCOUNTS"`
+	FreeMonthlyTransactions int64  `json:"free_max_monthly_transactions" env:"PLAN_FREE_MAX_MONTHLY_TRANSACTIONS"`
+	ProAccounts             int64  `json:"pro_max_accounts" env:"PLAN_PRO_MAX_ACCOUNTS"`
+	ProMonthlyTransactions  int64  `json:"pro_max_monthly_transactions" env:"PLAN_PRO_MAX_MONTHLY_TRANSACTIONS"`
+}
+
+// PlanNames lists the plans, see Plans.
+var PlanNames = []string{"free", "pro"}
+
+// Limits returns the limits of the plan, the default plan when empty.
+func (p Plans) Limits(plan string) (accounts, monthlyTransactions int64) {
+	if plan == "" {
+		plan = p.Default
+	}
+	if plan == "pro" {
+		return p.ProAccounts, p.ProMonthlyTransactions
+	}
+	return p.FreeAccounts, p.FreeMonthlyTransactions
+}
+
+// Billing configures the subscriptions to the pro plan, paid with Stripe.
+// Billing is off without STRIPE_SECRET_KEY.
+type Billing struct {
+	StripeSecretKey     string `json:"stripe_secret_key" env:"STRIPE_SECRET_KEY"`
+	StripeWebhookSecret string `json:"stripe_webhook_secret" env:"STRIPE_WEBHOOK_SECRET"`
+	StripeProPriceID    string `json:"stripe_pro_price_id" env:"STRIPE_PRO_PRICE_ID"` // Price of the subscription to the pro plan
+	ReturnURL           string `json:"return_url" env:"BILLING_RETURN_URL"`           // Page of the app the checkout and the portal send the users back to, APP_URL when empty
+	GraceDays           int    `json:"grace_days" env:"BILLING_GRACE_DAYS"`           // Days the pro plan is kept once a payment failed
+}
+
+// Features holds the switches and the tuning of the features.
+type Features struct {
+	Flags                             []string `json:"flags" env:"FEATURE_FLAGS"`           // "name=true" or "name=false", over the defaults of the flags
+	Households                        bool     `json:"households" env:"HOUSEHOLDS_ENABLED"` // Turns the households flag on, unless FEATURE_FLAGS sets it
+	AllowTransactionsBeforeOpening    bool     `json:"allow_transactions_before_opening" env:"ALLOW_TRANSACTIONS_BEFORE_OPENING"`
+	BudgetRolloverFloor               float64  `json:"budget_rollover_floor" env:"BUDGET_ROLLOVER_FLOOR"` // Share of the amount a budget may carry over negatively
+	AnomalyMultiplier                 float64  `json:"anomaly_multiplier" env:"ANOMALY_MULTIPLIER"`
+	AnomalyMinAmount                  float64  `json:"anomaly_min_amount" env:"ANOMALY_MIN_AMOUNT"`
+	AnomalyMinSampleSize              int      `json:"anomaly_min_sample_size" env:"ANOMALY_MIN_SAMPLE_SIZE"`
+	DigestHour                        int      `json:"digest_hour" env:"DIGEST_HOUR"`           // Local hour the weekly digest is sent from
+	EventsRetention                   int      `json:"events_retention" env:"EVENTS_RETENTION"` // Latest real-time events kept per user
+	NotificationReadRetentionDays     int      `json:"notification_read_retention_days" env:"NOTIFICATION_READ_RETENTION_DAYS"`
+	NotificationUnreadRetentionDays   int      `json:"notification_unread_retention_days" env:"NOTIFICATION_UNREAD_RETENTION_DAYS"`
+	NotificationSecurityRetentionDays int      `json:"notification_security_retention_days" env:"NOTIFICATION_SECURITY_RETENTION_DAYS"`
+	PrivacyExportRetentionDays        int      `json:"privacy_export_retention_days" env:"PRIVACY_EXPORT_RETENTION_DAYS"` // Days the data export archives can be downloaded
+	PrivacyErasureGraceDays           int      `json:"privacy_erasure_grace_days" env:"PRIVACY_ERASURE_GRACE_DAYS"`       // Days a confirmed erasure can be canceled before it runs
+	SyncRetentionDays                 int      `json:"sync_retention_days" env:"SYNC_RETENTION_DAYS"`                     // Days the changes are kept for the delta sync, the clients offline longer sync everything again
+	Currency                          string   `json:"currency" env:"CURRENCY"`                                           // ISO 4217 code of the amounts, written with its symbol in the notifications and the emails
+	Demo                              bool     `json:"demo" env:"DEMO_ENABLED"`                                           // Lets anyone start a sandbox user loaded with the seed data
+	DemoLifetimeHours                 int      `json:"demo_lifetime_hours" env:"DEMO_LIFETIME_HOURS"`                     // Hours before a demo user and their data are purged
+	DemoHourlyLimit                   int      `json:"demo_hourly_limit" env:"DEMO_HOURLY_LIMIT"`                         // Demo users created per IP per hour
+}
+
+// Default returns the configuration used for the values set nowhere.
+func Default() Config {
+	return Config{
+		Server: Server{
+			Port:                  8080,
+			Env:                   "local",
+			AppURL:                "http://localhost:8080",
+			ShutdownGracePeriod:   30,
+			ReadinessDelay:        5,
+			RequestTimeout:        15,
+			LongRequestTimeout:    120,
+			SlowRequestThreshold:  2000,
+			BodyLimit:             1024,
+			UploadBodyLimit:       25 * 1024,
+			LegacyAliases:         true,
+			LegacySunset:          "2027-06-30",
+			MaintenanceRetryAfter: 300,
+			TLS:                   TLS{AutocertCacheDir: "autocert", HSTSMaxAge: 31536000},
+			CORS: CORS{
+				AllowedOrigins: []string{"*"},
+				AllowedMethods: []string{"GET", "POST", "HEAD", "PUT", "DELETE", "PATCH"},
+				AllowedHeaders: []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Share-Grant"},
+				MaxAge:         600,
+			},
+			Log: Log{Format: "json", Level: "info", RequestBodyLength: 2048},
+		},
+		DB:   DB{Port: 5432, Schema: "public"},
+		Auth: Auth{Cookies: true},
+		SMTP: SMTP{
+			Driver:    "log",
+			Port:      587,
+			TLS:       "starttls",
+			Workers:   2,
+			QueueSize: 1000,
+			Attempts:  5,
+		},
+		Push: Push{VAPIDSubject: "mailto:admin@finma.local", HourlyLimit: 20},
+		FX:   FX{Provider: "frankfurter", ProviderURL: fx.FrankfurterURL, Timeout: 10},
+		Storage: Storage{
+			Driver:          "local",
+			LocalDir:        "storage",
+			S3Region:        "us-east-1",
+			SignedURLExpiry: 900,
+		},
+		Cache: Cache{
+			Driver:        "memory",
+			TTL:           60,
+			MemoryEntries: 10000,
+			RedisAddr:     "localhost:6379",
+		},
+		Features: Features{
+			BudgetRolloverFloor:               0.5,
+			AnomalyMultiplier:                 3,
+			AnomalyMinAmount:                  50,
+			AnomalyMinSampleSize:              5,
+			DigestHour:                        8,
+			EventsRetention:                   100,
+			NotificationReadRetentionDays:     90,
+			NotificationUnreadRetentionDays:   180,
+			NotificationSecurityRetentionDays: 365,
+			PrivacyExportRetentionDays:        7,
+			PrivacyErasureGraceDays:           30,
+			SyncRetentionDays:                 30,
+			Currency:                          "EUR",
+			DemoLifetimeHours:                 24,
+			DemoHourlyLimit:                   5,
+		},
+		Plans:   Plans{Default: "free"},
+		Billing: Billing{GraceDays: 7},
+	}
+}
+
+// Load reads the configuration from the file named by FINMA_CONFIG_FILE,
+// if any, and from the environment. Every problem found is reported in the
+// error, not only the first one.
+func Load() (Config, error) {
+	return load(os.LookupEnv)
+}
+
+func load(lookup func(string) (string, bool)) (Config, error) {
+	cfg := Default()
+
+	if path, ok := lookup(FileEnv); ok && path != "" {
+		if err := loadFile(path, &cfg); err != nil {
+			return cfg, fmt.Errorf("invalid configuration file %s: %w", path, err)
+		}
+	}
+
+	errs := applyEnv(reflect.ValueOf(&cfg).Elem(), lookup)
+	if err := cfg.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return cfg, fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return cfg, nil
+}
+
+// applyEnv sets the fields from the environment variables of their env tag.
+// An empty variable counts as unset.
+func applyEnv(v reflect.Value, lookup func(string) (string, bool)) []error {
+	var errs []error
+	for i := 0; i < v.NumField(); i++ {
+		field, value := v.Type().Field(i), v.Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			errs = append(errs, applyEnv(value, lookup)...)
+			continue
+		}
+
+		name := field.Tag.Get("env")
+		raw, ok := lookup(name)
+		if name == "" || !ok || raw == "" {
+			continue
+		}
+		if err := setValue(value, raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errs
+}
+
+// setValue parses raw into the field, the lists are comma separated.
+func setValue(value reflect.Value, raw string) error {
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Int, reflect.Int64:
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", raw)
+		}
+		value.SetInt(parsed)
+	case reflect.Float64:
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", raw)
+		}
+		value.SetFloat(parsed)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", raw)
+		}
+		value.SetBool(parsed)
+	case reflect.Slice:
+		items := []string{}
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		value.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", value.Type())
+	}
+	return nil
+}
+
+// Validate checks the values, the error lists every problem.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Port > 0 && c.Server.Port < 65536, "PORT: %d is not a valid port", c.Server.Port)
+	check(c.Server.ShutdownGracePeriod >= 0, "SHUTDOWN_GRACE_PERIOD must not be negative")
+	check(c.Server.ReadinessDelay >= 0, "SHUTDOWN_READINESS_DELAY must not be negative")
+	check(c.Server.RequestTimeout > 0, "REQUEST_TIMEOUT must be positive")
+	check(c.Server.LongRequestTimeout >= c.Server.RequestTimeout, "LONG_REQUEST_TIMEOUT must not be shorter than REQUEST_TIMEOUT")
+	check(c.Server.SlowRequestThreshold > 0, "SLOW_REQUEST_THRESHOLD_MS must be positive")
+	check(c.Server.BodyLimit > 0, "BODY_LIMIT_KB must be positive")
+	check(c.Server.UploadBodyLimit >= c.Server.BodyLimit, "UPLOAD_BODY_LIMIT_KB must not be smaller than BODY_LIMIT_KB")
+	if _, err := time.Parse(time.DateOnly, c.Server.LegacySunset); err != nil {
+		check(false, "API_LEGACY_SUNSET: %q is not a YYYY-MM-DD date", c.Server.LegacySunset)
+	}
+	if err := c.Server.CORS.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("CORS: %w", err))
+	}
+	if err := c.Server.TLS.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	check(c.Server.MaintenanceRetryAfter > 0, "MAINTENANCE_RETRY_AFTER must be positive")
+	check(c.Server.Log.Format == "json" || c.Server.Log.Format == "text", "LOG_FORMAT: %q is not json or text", c.Server.Log.Format)
+
+	check(c.DB.Host != "", "DB_HOST is required")
+	check(c.DB.Port > 0 && c.DB.Port < 65536, "DB_PORT: %d is not a valid port", c.DB.Port)
+	check(c.DB.Database != "", "DB_DATABASE is required")
+	check(c.DB.Username != "", "DB_USERNAME is required")
+	if c.DB.EncryptionKey != "" {
+		key, err := base64.StdEncoding.DecodeString(c.DB.EncryptionKey)
+		check(err == nil && len(key) == 32, "ENCRYPTION_KEY must be a base64 encoded 32 bytes key")
+	}
+	for _, previous := range c.DB.PreviousEncryptionKeys {
+		key, err := base64.StdEncoding.DecodeString(previous)
+		check(err == nil && len(key) == 32, "ENCRYPTION_PREVIOUS_KEYS must be base64 encoded 32 bytes keys")
+	}
+	check(c.DB.EncryptionKey != "" || len(c.DB.PreviousEncryptionKeys) == 0, "ENCRYPTION_PREVIOUS_KEYS requires ENCRYPTION_KEY")
+	check(c.DB.EncryptionKey != "" || c.BankSync.GoCardlessSecretID == "", "ENCRYPTION_KEY is required to store the bank connections")
+
+	check(c.Auth.AccessTokenSecret != "", "ACCESS_TOKEN_SECRET is required")
+	check(c.Auth.RefreshTokenSecret != "", "REFRESH_TOKEN_SECRET is required")
+	check(!c.Auth.Cookies || c.Server.TLS.Enabled() || c.Auth.InsecureCookies,
+		"AUTH_COOKIES requires TLS: set TLS_CERT_FILE and TLS_KEY_FILE or TLS_AUTOCERT_HOSTS, or AUTH_INSECURE_COOKIES=true behind a TLS terminating proxy")
+
+	check(c.SMTP.Driver == "smtp" || c.SMTP.Driver == "log", "MAIL_DRIVER: %q is not smtp or log", c.SMTP.Driver)
+	if c.SMTP.Driver == "smtp" {
+		check(c.SMTP.Host != "", "SMTP_HOST is required with the smtp driver")
+		check(c.SMTP.From != "", "MAIL_FROM is required with the smtp driver")
+		check(c.SMTP.TLS == "starttls" || c.SMTP.TLS == "tls" || c.SMTP.TLS == "none", "SMTP_TLS: %q is not starttls, tls or none", c.SMTP.TLS)
+	}
+
+	check((c.Push.VAPIDPublicKey == "") == (c.Push.VAPIDPrivateKey == ""), "VAPID_PUBLIC_KEY and VAPID_PRIVATE_KEY must be set together")
+	check(c.BankSync.GoCardlessSecretID == "" || c.BankSync.GoCardlessSecretKey != "", "GOCARDLESS_SECRET_KEY is required with GOCARDLESS_SECRET_ID")
+	check(c.BankSync.WebhookSecret == "" || c.BankSync.GoCardlessSecretID != "", "BANK_SYNC_WEBHOOK_SECRET requires GOCARDLESS_SECRET_ID")
+
+	check(c.FX.Provider == "frankfurter" || c.FX.Provider == "none", "FX_PROVIDER: %q is not frankfurter or none", c.FX.Provider)
+	if c.FX.Provider == "frankfurter" {
+		parsed, err := url.Parse(c.FX.ProviderURL)
+		check(err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != "", "FX_PROVIDER_URL: %q is not an http(s) URL", c.FX.ProviderURL)
+	}
+	check(c.FX.Timeout > 0, "FX_TIMEOUT must be positive")
+
+	check(c.Storage.Driver == "local" || c.Storage.Driver == "s3", "STORAGE_DRIVER: %q is not local or s3", c.Storage.Driver)
+	if c.Storage.Driver == "s3" {
+		check(c.Storage.S3Endpoint != "", "S3_ENDPOINT is required with the s3 driver")
+		check(c.Storage.S3Bucket != "", "S3_BUCKET is required with the s3 driver")
+		check(c.Storage.S3AccessKeyID != "" && c.Storage.S3SecretAccessKey != "", "S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY are required with the s3 driver")
+	}
+	check(c.Storage.SignedURLExpiry > 0 && c.Storage.SignedURLExpiry <= 7*24*3600, "STORAGE_SIGNED_URL_EXPIRY: %d is not between 1 second and 7 days", c.Storage.SignedURLExpiry)
+
+	check(c.Cache.Driver == "memory" || c.Cache.Driver == "redis" || c.Cache.Driver == "none", "CACHE_DRIVER: %q is not memory, redis or none", c.Cache.Driver)
+	check(c.Cache.TTL > 0, "CACHE_TTL must be positive")
+	check(c.Cache.MemoryEntries > 0, "CACHE_MEMORY_ENTRIES must be positive")
+	if c.Cache.Driver == "redis" {
+		check(c.Cache.RedisAddr != "", "REDIS_ADDR is required with the redis driver")
+		check(c.Cache.RedisDB >= 0, "REDIS_DB must not be negative")
+	}
+
+	if _, err := flags.ParseOverrides(c.Features.Flags); err != nil {
+		errs = append(errs, fmt.Errorf("FEATURE_FLAGS: %w", err))
+	}
+	check(c.Features.DigestHour >= 0 && c.Features.DigestHour < 24, "DIGEST_HOUR: %d is not an hour", c.Features.DigestHour)
+	check(c.Features.EventsRetention >= 0, "EVENTS_RETENTION must not be negative")
+	check(c.Features.PrivacyExportRetentionDays > 0, "PRIVACY_EXPORT_RETENTION_DAYS must be positive")
+	check(c.Features.PrivacyErasureGraceDays >= 0, "PRIVACY_ERASURE_GRACE_DAYS must not be negative")
+	check(c.Features.SyncRetentionDays > 0, "SYNC_RETENTION_DAYS must be positive")
+	check(fx.IsCurrencyCode(c.Features.Currency), "CURRENCY: %q is not an ISO 4217 code", c.Features.Currency)
+	check(c.Features.DemoLifetimeHours > 0, "DEMO_LIFETIME_HOURS must be positive")
+	check(c.Features.DemoHourlyLimit > 0, "DEMO_HOURLY_LIMIT must be positive")
+
+	check(slices.Contains(PlanNames, c.Plans.Default), "PLAN_DEFAULT: %q is not free or pro", c.Plans.Default)
+	check(c.Plans.FreeAccounts >= 0 && c.Plans.FreeMonthlyTransactions >= 0 && c.Plans.ProAccounts >= 0 && c.Plans.ProMonthlyTransactions >= 0,
+		"PLAN_*_MAX_* limits must not be negative")
+	if c.Billing.StripeSecretKey != "" {
+		check(c.Billing.StripeWebhookSecret != "", "STRIPE_WEBHOOK_SECRET is required with STRIPE_SECRET_KEY")
+		check(c.Billing.StripeProPriceID != "", "STRIPE_PRO_PRICE_ID is required with STRIPE_SECRET_KEY")
+	}
+	if c.Billing.ReturnURL != "" {
+		parsed, err := url.Parse(c.Billing.ReturnURL)
+		check(err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != "", "BILLING_RETURN_URL: %q is not an http(s) URL", c.Billing.ReturnURL)
+	}
+	check(c.Billing.GraceDays >= 0, "BILLING_GRACE_DAYS must not be negative")
+
+	return errors.Join(errs...)
+}
+
+// FlagOverrides returns the flags the configuration turns on or off for
+// every user. HOUSEHOLDS_ENABLED, from before the flags, turns the
+// households flag on.
+func (f Features) FlagOverrides() map[string]bool {
+	overrides, err := flags.ParseOverrides(f.Flags)
+	if err != nil {
+		// Refused by Validate
+		overrides = map[string]bool{}
+	}
+	if _, set := overrides[flags.Households.Name]; !set && f.Households {
+		overrides[flags.Households.Name] = true
+	}
+	return overrides
+}
+
+// Validate refuses the settings the browsers would reject: a wildcard
+// origin with credentials, or origins that are not scheme://host[:port].
+func (c CORS) Validate() error {
+	if len(c.AllowedOrigins) == 0 {
+		return errors.New("at least one allowed origin is required")
+	}
+
+	for _, origin := range c.AllowedOrigins {
+		if strings.Contains(origin, "*") {
+			if c.AllowCredentials {
+				return fmt.Errorf("wildcard origin %q cannot be combined with credentials, list the origins", origin)
+			}
+			if origin != "*" || len(c.AllowedOrigins) > 1 {
+				return fmt.Errorf("invalid origin %q, the wildcard must be the only origin", origin)
+			}
+			continue
+		}
+
+		parsed, err := url.Parse(origin)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" || (parsed.Path != "" && parsed.Path != "/") {
+			return fmt.Errorf("invalid origin %q, expected scheme://host[:port]", origin)
+		}
+	}
+
+	if c.MaxAge < 0 {
+		return errors.New("max age must not be negative")
+	}
+	return nil
+}
+
+// Enabled reports whether the server listens with TLS.
+func (t TLS) Enabled() bool {
+	return t.CertFile != "" || len(t.AutocertHosts) > 0
+}
+
+// Validate checks that a single source of certificates is configured.
+func (t TLS) Validate() error {
+	var errs []error
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		errs = append(errs, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together"))
+	}
+	if t.CertFile != "" && len(t.AutocertHosts) > 0 {
+		errs = append(errs, errors.New("TLS_CERT_FILE and TLS_AUTOCERT_HOSTS cannot be combined"))
+	}
+	if len(t.AutocertHosts) > 0 && t.AutocertCacheDir == "" {
+		errs = append(errs, errors.New("TLS_AUTOCERT_CACHE_DIR is required with TLS_AUTOCERT_HOSTS"))
+	}
+	if t.RedirectAddr != "" && !t.Enabled() {
+		errs = append(errs, errors.New("TLS_REDIRECT_ADDR requires TLS"))
+	}
+	if t.HSTSMaxAge < 0 {
+		errs = append(errs, errors.New("TLS_HSTS_MAX_AGE must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// Sunset returns the removal date of the deprecated API aliases.
+func (s Server) Sunset() time.Time {
+	sunset, _ := time.Parse(time.DateOnly, s.LegacySunset)
+	return sunset
+}
+
+// connectionURL returns the URL of the database.
+func (db DB) connectionURL() *url.URL {
+	return &url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(db.Username, db.Password),
+		Host:     net.JoinHostPort(db.Host, strconv.Itoa(db.Port)),
+		Path:     "/" + db.Database,
+		RawQuery: "sslmode=disable&search_path=" + url.QueryEscape(db.Schema),
+	}
+}
+
+// DSN returns the connection string of the database, with its password:
+// log String instead.
+func (db DB) DSN() string {
+	return db.connectionURL().String()
+}
+
+// String returns the connection string of the database with its password
+// redacted, and never the encryption keys, for the logs.
+func (db DB) String() string {
+	return db.connectionURL().Redacted()
+}
@@ -0,0 +1,211 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// loadFile overrides cfg with the values of the JSON or YAML file, chosen by
+// its extension. Unknown keys are refused, they are usually typos.
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+	case ".yaml", ".yml":
+		document, err := parseYAML(data)
+		if err != nil {
+			return err
+		}
+		if data, err = json.Marshal(document); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported extension %q, expected .json, .yaml or .yml", filepath.Ext(path))
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(cfg)
+}
+
+// yamlLine is a significant line of a YAML document.
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+}
+
+// parseYAML parses the subset of YAML a configuration file needs: nested
+// mappings, scalars, and lists of scalars written inline ([a, b]) or as
+// "- item" lines. Anchors, multi-line strings and multiple documents are
+// not supported.
+func parseYAML(data []byte) (map[string]any, error) {
+	var lines []yamlLine
+	for i, raw := range strings.Split(string(data), "\n") {
+		text := strings.TrimRight(stripYAMLComment(raw), " \r")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed in the indentation", i+1)
+		}
+		lines = append(lines, yamlLine{number: i + 1, indent: len(text) - len(trimmed), text: trimmed})
+	}
+	if len(lines) == 0 {
+		return map[string]any{}, nil
+	}
+
+	document, rest, err := parseYAMLMapping(lines, lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("line %d: unexpected indentation", rest[0].number)
+	}
+	return document, nil
+}
+
+// parseYAMLMapping parses the keys at the indentation and their values,
+// returning the lines after the mapping.
+func parseYAMLMapping(lines []yamlLine, indent int) (map[string]any, []yamlLine, error) {
+	mapping := map[string]any{}
+	for len(lines) > 0 && lines[0].indent == indent {
+		line := lines[0]
+		lines = lines[1:]
+		if isYAMLListItem(line.text) {
+			return nil, nil, fmt.Errorf("line %d: unexpected list item", line.number)
+		}
+
+		key, value, ok := strings.Cut(line.text, ":")
+		if !ok || (value != "" && value[0] != ' ') {
+			return nil, nil, fmt.Errorf("line %d: expected \"key: value\"", line.number)
+		}
+		key = unquoteYAML(strings.TrimSpace(key))
+		if _, duplicate := mapping[key]; duplicate {
+			return nil, nil, fmt.Errorf("line %d: duplicate key %q", line.number, key)
+		}
+
+		value = strings.TrimSpace(value)
+		var err error
+		switch {
+		case value != "":
+			mapping[key], err = parseYAMLValue(value)
+		case len(lines) > 0 && isYAMLListItem(lines[0].text) && lines[0].indent >= indent:
+			mapping[key], lines, err = parseYAMLList(lines, lines[0].indent)
+		case len(lines) > 0 && lines[0].indent > indent:
+			mapping[key], lines, err = parseYAMLMapping(lines, lines[0].indent)
+		default:
+			mapping[key] = nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(lines) > 0 && lines[0].indent > indent {
+		return nil, nil, fmt.Errorf("line %d: unexpected indentation", lines[0].number)
+	}
+	return mapping, lines, nil
+}
+
+// parseYAMLList parses the "- item" lines at the indentation.
+func parseYAMLList(lines []yamlLine, indent int) ([]any, []yamlLine, error) {
+	list := []any{}
+	for len(lines) > 0 && lines[0].indent == indent && isYAMLListItem(lines[0].text) {
+		line := lines[0]
+		lines = lines[1:]
+		item := strings.TrimSpace(strings.TrimPrefix(line.text, "-"))
+		if len(lines) > 0 && lines[0].indent > indent {
+			return nil, nil, fmt.Errorf("line %d: only lists of scalars are supported", line.number)
+		}
+		value, err := parseYAMLValue(item)
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %w", line.number, err)
+		}
+		list = append(list, value)
+	}
+	return list, lines, nil
+}
+
+func isYAMLListItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// parseYAMLValue parses a scalar or an inline list of scalars.
+func parseYAMLValue(value string) (any, error) {
+	if !strings.HasPrefix(value, "[") {
+		return parseYAMLScalar(value), nil
+	}
+	if !strings.HasSuffix(value, "]") {
+		return nil, fmt.Errorf("unterminated list %s", value)
+	}
+
+	list := []any{}
+	inner := strings.TrimSpace(value[1 : len(value)-1])
+	if inner == "" {
+		return list, nil
+	}
+	for _, item := range strings.Split(inner, ",") {
+		list = append(list, parseYAMLScalar(strings.TrimSpace(item)))
+	}
+	return list, nil
+}
+
+// parseYAMLScalar returns the quoted values as strings, and the others as
+// null, a boolean, a number or a string.
+func parseYAMLScalar(value string) any {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') {
+		return unquoteYAML(value)
+	}
+	switch value {
+	case "", "~", "null":
+		return nil
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if number, err := strconv.ParseFloat(value, 64); err == nil {
+		return number
+	}
+	return value
+}
+
+func unquoteYAML(value string) string {
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			return unquoted
+		}
+	}
+	if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'")
+	}
+	return value
+}
+
+// stripYAMLComment removes a # comment, outside of the quoted values.
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' '):
+			return line[:i]
+		}
+	}
+	return line
+}
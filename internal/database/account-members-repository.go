@@ -0,0 +1,94 @@
+package database
+
+import (
+	"FinMa/types"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// accessibleAccountsQuery selects the IDs of the accounts the user owns, is
+// an active member of, or that are shared in their household (unless the
+// user sees their own data only). It is the scope of every account and
+// transaction listing.
+func (s *service) accessibleAccountsQuery(user *types.User, excludeShared bool) *gorm.DB {
+	owned := s.db.Model(&types.BankAccount{}).Select("id").Where("user_id = ?", user.ID)
+	if excludeShared {
+		return owned
+	}
+
+	shared := s.db.Model(&types.AccountMember{}).Select("bank_account_id").Where("user_id = ? AND status = 'active'", user.ID)
+	return s.db.Model(&types.BankAccount{}).Select("id").
+		Where("id IN (?) OR id IN (?) OR household_id IN (?)", owned, shared, s.visibleHouseholdsQuery(user))
+}
+
+func (s *service) CreateAccountMember(member *types.AccountMember) error {
+	result := s.db.Create(member)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+func (s *service) GetAccountMembers(accountID uuid.UUID) []types.AccountMember {
+	var members []types.AccountMember
+	result := s.db.Where("bank_account_id = ?", accountID).Order("created_at").Find(&members)
+
+	if result.Error != nil {
+		log.Error("Error fetching account members: ", result.Error)
+		return nil
+	}
+	return members
+}
+
+func (s *service) GetAccountMemberByID(id string) types.AccountMember {
+	var member types.AccountMember
+	result := s.db.Where("id = ?", id).First(&member)
+
+	if result.Error != nil {
+		log.Error("Error fetching account member: ", result.Error)
+		return types.AccountMember{}
+	}
+	return member
+}
+
+// GetAccountMembership returns the active membership of the user on the
+// account, or an empty member when there is none.
+func (s *service) GetAccountMembership(accountID uuid.UUID, userID uuid.UUID) types.AccountMember {
+	var member types.AccountMember
+	s.db.Where("bank_account_id = ? AND user_id = ? AND status = 'active'", accountID, userID).Limit(1).Find(&member)
+	return member
+}
+
+// GetPendingInvites returns the invites sent to the email address that were not accepted yet.
+func (s *service) GetPendingInvites(email string) []types.AccountMember {
+	var members []types.AccountMember
+	result := s.db.Where("email = ? AND status = 'pending'", email).Find(&members)
+
+	if result.Error != nil {
+		log.Error("Error fetching pending invites: ", result.Error)
+		return nil
+	}
+	return members
+}
+
+func (s *service) AcceptAccountInvite(member *types.AccountMember, user *types.User) error {
+	member.UserID = &user.ID
+	member.Status = "active"
+
+	result := s.db.Omit("BankAccount").Save(member)
+	return s.changed(result.Error, accountChange(member.BankAccountID))
+}
+
+// DeleteAccountMember removes the member from the account. The transactions
+// they created are kept.
+func (s *service) DeleteAccountMember(member *types.AccountMember) error {
+	result := s.db.Where("id = ?", member.ID).Delete(&types.AccountMember{})
+	change := accountChange(member.BankAccountID)
+	if member.UserID != nil {
+		// No longer a member, they would be missed
+		change.userIDs = []uuid.UUID{*member.UserID}
+	}
+	return s.changed(result.Error, change)
+}
@@ -0,0 +1,22 @@
+package database
+
+import (
+	"FinMa/types"
+	"time"
+)
+
+// GetAdminStats counts the users and the transactions, measures the
+// database, and counts as active sessions the devices seen since
+// activeSince.
+func (s *service) GetAdminStats(activeSince time.Time) (types.AdminStats, error) {
+	var stats types.AdminStats
+	result := s.db.Raw(`
+		SELECT
+			(SELECT COUNT(*) FROM users) AS users,
+			(SELECT COUNT(*) FROM transactions) AS transactions,
+			pg_database_size(current_database()) AS database_size_bytes,
+			(SELECT COUNT(*) FROM known_devices WHERE last_seen_at >= ?) AS active_sessions`,
+		activeSince).Scan(&stats)
+
+	return stats, result.Error
+}
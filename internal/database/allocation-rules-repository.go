@@ -0,0 +1,81 @@
+package database
+
+import (
+	"FinMa/types"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CreateAllocationRule stores the rule with its steps.
+func (s *service) CreateAllocationRule(rule *types.AllocationRule) error {
+	return s.db.Create(rule).Error
+}
+
+func preloadAllocationRuleSteps(query *gorm.DB) *gorm.DB {
+	return query.Preload("Steps", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position")
+	})
+}
+
+// GetAllocationRules returns the rules of the user, oldest first, which is
+// the order they are tried in.
+func (s *service) GetAllocationRules(userID uuid.UUID) []types.AllocationRule {
+	var rules []types.AllocationRule
+	result := preloadAllocationRuleSteps(s.db).Where("user_id = ?", userID).Order("created_at").Find(&rules)
+
+	if result.Error != nil {
+		log.Error("Error fetching allocation rules: ", result.Error)
+		return nil
+	}
+	return rules
+}
+
+func (s *service) GetAllocationRuleByID(id string) types.AllocationRule {
+	var rule types.AllocationRule
+	result := preloadAllocationRuleSteps(s.db).Where("id = ?", id).First(&rule)
+
+	if result.Error != nil {
+		log.Error("Error fetching allocation rule: ", result.Error)
+		return types.AllocationRule{}
+	}
+	return rule
+}
+
+// DeleteAllocationRule deletes the rule and its steps. What it already
+// allocated is kept.
+func (s *service) DeleteAllocationRule(rule *types.AllocationRule) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("rule_id = ?", rule.ID).Delete(&types.AllocationRuleStep{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(rule).Error
+	})
+}
+
+// GetRuleMatchingIncome returns the most recent income of the owner of the
+// rule that the rule matches, newest first.
+func (s *service) GetRuleMatchingIncome(rule *types.AllocationRule, limit int) []types.Transaction {
+	var transactions []types.Transaction
+	result := s.db.
+		Where("user_id = ? AND type = 'income' AND amount >= ?", rule.UserID, rule.MinAmount).
+		Where("STRPOS(LOWER(description), LOWER(?)) > 0", rule.Merchant).
+		Order("date DESC").
+		Limit(limit).
+		Find(&transactions)
+
+	if result.Error != nil {
+		log.Error("Error fetching matching income: ", result.Error)
+		return nil
+	}
+	return transactions
+}
+
+// CreateAllocationRuleRun records the run of a rule on a transaction. It
+// returns false when the transaction was already distributed.
+func (s *service) CreateAllocationRuleRun(run *types.AllocationRuleRun) (bool, error) {
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(run)
+	return result.RowsAffected > 0, result.Error
+}
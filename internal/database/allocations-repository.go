@@ -0,0 +1,130 @@
+package database
+
+import (
+	"FinMa/types"
+	"errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrAllocationExceedsPool is returned when allocations exceed the income of
+// the user not allocated yet, or what is left of their source transaction.
+var ErrAllocationExceedsPool = errors.New("allocations exceed the unassigned income")
+
+// allocationPool sums the income of the user and their allocations.
+func allocationPool(tx *gorm.DB, user *types.User) (types.AllocationPool, error) {
+	var pool types.AllocationPool
+	if err := tx.Model(&types.Transaction{}).
+		Where("user_id = ? AND type = 'income'", user.ID).
+		Select("COALESCE(SUM(amount), 0)").Scan(&pool.Income).Error; err != nil {
+		return pool, err
+	}
+
+	if err := tx.Model(&types.Allocation{}).
+		Where("user_id = ?", user.ID).
+		Select("COALESCE(SUM(amount), 0)").Scan(&pool.Allocated).Error; err != nil {
+		return pool, err
+	}
+
+	unassigned, err := pool.Income.Sub(pool.Allocated)
+	if err != nil {
+		return pool, err
+	}
+	pool.Unassigned = unassigned
+	return pool, nil
+}
+
+func (s *service) GetAllocationPool(user *types.User) (types.AllocationPool, error) {
+	return allocationPool(s.db, user)
+}
+
+// CreateAllocations stores the allocations if they fit in the unassigned
+// income of the user and, when they come from a source income transaction,
+// in what is left of it. The user row is locked so that concurrent
+// allocations cannot both spend the same money.
+func (s *service) CreateAllocations(user *types.User, allocations []types.Allocation, source *types.Transaction) error {
+	amounts := make([]types.Money, len(allocations))
+	for i, allocation := range allocations {
+		amounts[i] = allocation.Amount.Unbound()
+	}
+	total, err := types.SumMoney(amounts...)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", user.ID).First(&types.User{}).Error; err != nil {
+			return err
+		}
+
+		pool, err := allocationPool(tx, user)
+		if err != nil {
+			return err
+		}
+		exceeds, err := total.Cmp(pool.Unassigned)
+		if err != nil {
+			return err
+		}
+		if exceeds > 0 {
+			return ErrAllocationExceedsPool
+		}
+
+		if source != nil {
+			var allocated types.Money
+			if err := tx.Model(&types.Allocation{}).
+				Where("transaction_id = ?", source.ID).
+				Select("COALESCE(SUM(amount), 0)").Scan(&allocated).Error; err != nil {
+				return err
+			}
+			left, err := source.Amount.Unbound().Sub(allocated)
+			if err != nil {
+				return err
+			}
+			if exceeds, err = total.Cmp(left); err != nil {
+				return err
+			}
+			if exceeds > 0 {
+				return ErrAllocationExceedsPool
+			}
+		}
+
+		return tx.Create(&allocations).Error
+	})
+	return s.changed(err, dataChange{userIDs: []uuid.UUID{user.ID}})
+}
+
+// GetBudgetsAllocated returns the total allocated to the budget of each
+// period, in the order of the periods, in a single grouped query.
+func (s *service) GetBudgetsAllocated(periods []types.BudgetPeriodRange) ([]types.Money, error) {
+	allocated := make([]types.Money, len(periods))
+	if len(periods) == 0 {
+		return allocated, nil
+	}
+
+	values, args := budgetPeriodsValues(periods)
+	var rows []struct {
+		Position  int
+		Allocated types.Money
+	}
+	result := s.db.Raw(`
+		SELECT p.position, COALESCE(SUM(a.amount), 0) AS allocated
+		FROM `+values+`
+		LEFT JOIN allocations a ON a.budget_id = p.budget_id
+			AND a.date >= p.period_start AND a.date < p.period_end
+		GROUP BY p.position`, args...).Scan(&rows)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	for _, row := range rows {
+		allocated[row.Position] = row.Allocated
+	}
+	return allocated, nil
+}
+
+func (s *service) UpdateBudgetingMode(user *types.User) error {
+	err := s.db.Model(&types.User{}).Where("id = ?", user.ID).Update("budgeting_mode", user.BudgetingMode).Error
+	return s.changed(err, dataChange{userIDs: []uuid.UUID{user.ID}})
+}
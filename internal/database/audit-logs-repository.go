@@ -0,0 +1,54 @@
+package database
+
+import (
+	"FinMa/types"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+)
+
+func (s *service) CreateAuditLog(entry *types.AuditLog) error {
+	result := s.db.Create(entry)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+// CreateAuditLogs inserts the entries in batches, for the operations writing
+// many of them like an import.
+func (s *service) CreateAuditLogs(entries []types.AuditLog) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	return s.db.CreateInBatches(entries, 500).Error
+}
+
+// GetAuditActivity lists the entries of the user with one of the actions of
+// the filter, the latest first, the entries of a batch grouped in one item
+// with their count. The item of a batch has its ID, and the entity of a
+// single entry.
+func (s *service) GetAuditActivity(userID uuid.UUID, filter types.ActivityFilter) []types.ActivityItem {
+	if len(filter.Actions) == 0 {
+		return nil
+	}
+
+	query := s.db.Model(&types.AuditLog{}).
+		Select(`COALESCE(batch_id, id) AS id, action AS type, MAX(created_at) AS occurred_at, COUNT(*) AS count,
+			MIN(entity_type) AS entity_type,
+			CASE WHEN COUNT(*) = 1 THEN (array_agg(entity_id))[1] END AS entity_id,
+			(array_agg(batch_id))[1] AS batch_id,
+			(array_agg(details ORDER BY created_at DESC))[1] AS details`).
+		Where("user_id = ? AND action IN ?", userID, filter.Actions).
+		Group("COALESCE(batch_id, id), action")
+	if filter.Before != nil {
+		query = query.Having("(MAX(created_at), COALESCE(batch_id, id)) < (?, ?)", *filter.Before, filter.BeforeID)
+	}
+
+	var items []types.ActivityItem
+	if err := query.Order("occurred_at DESC, id DESC").Limit(filter.Limit).Scan(&items).Error; err != nil {
+		log.Error("Error fetching audit activity: ", err)
+		return nil
+	}
+	return items
+}
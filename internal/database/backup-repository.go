@@ -0,0 +1,356 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"FinMa/types"
+)
+
+// ErrDatabaseNotEmpty is returned by Restore when the database holds data
+// and the restore is not forced to replace it.
+var ErrDatabaseNotEmpty = errors.New("the database holds data")
+
+// ErrInvalidBackup is returned by Restore when the backup cannot be
+// restored: malformed, of another schema version, with an unknown table or
+// with rows breaking a foreign key. Nothing is written.
+var ErrInvalidBackup = errors.New("invalid backup")
+
+// restoreBatchSize is the number of rows inserted per statement.
+const restoreBatchSize = 500
+
+// setupTables are the tables filled while an instance is set up, by the
+// admin restoring a backup: their user, devices, notifications, emails and
+// audit log, and the maintenance mode. Their rows do not count as data.
+var setupTables = []string{"users", "known_devices", "notifications", "email_deliveries", "audit_logs", "maintenances"}
+
+// foreignKey is a foreign key constraint of the schema, as created.
+type foreignKey struct {
+	Table      string
+	Name       string
+	Definition string
+}
+
+// quoteIdentifier quotes the name of a table or a column for Postgres.
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// backupTables returns the tables of the models.
+func (s *service) backupTables() ([]string, error) {
+	var tables []string
+	for _, model := range models() {
+		stmt := &gorm.Statement{DB: s.db}
+		if err := stmt.Parse(model); err != nil {
+			return nil, err
+		}
+		tables = append(tables, stmt.Schema.Table)
+	}
+	return tables, nil
+}
+
+// Backup writes the rows of every table to w from one snapshot, as a JSON
+// document versioned like the user exports: its schema version, when it was
+// taken, then the rows of each table with their columns. The rows are
+// streamed, the backup is never held in memory.
+func (s *service) Backup(w io.Writer) error {
+	tables, err := s.backupTables()
+	if err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SET TRANSACTION ISOLATION LEVEL REPEATABLE READ READ ONLY").Error; err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, `{"schema_version":%d,"backed_up_at":"%s","tables":{`,
+			types.ExportSchemaVersion, time.Now().UTC().Format(time.RFC3339Nano)); err != nil {
+			return err
+		}
+
+		for i, table := range tables {
+			separator := ","
+			if i == 0 {
+				separator = ""
+			}
+			if _, err := fmt.Fprintf(w, "%s\n%q:[", separator, table); err != nil {
+				return err
+			}
+
+			rows, err := tx.Raw("SELECT row_to_json(t)::text FROM " + quoteIdentifier(table) + " t").Rows()
+			if err != nil {
+				return err
+			}
+			for first := true; rows.Next(); first = false {
+				var row string
+				if err := rows.Scan(&row); err != nil {
+					rows.Close()
+					return err
+				}
+				if !first {
+					row = "," + row
+				}
+				if _, err := io.WriteString(w, "\n"+row); err != nil {
+					rows.Close()
+					return err
+				}
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return err
+			}
+			if _, err := io.WriteString(w, "]"); err != nil {
+				return err
+			}
+		}
+
+		_, err := io.WriteString(w, "\n}}\n")
+		return err
+	})
+}
+
+// Restore replaces the data of every table with the rows of the backup
+// read from r, in one transaction. A database holding data is refused with
+// ErrDatabaseNotEmpty, unless force is set. The foreign keys are dropped
+// while the rows are inserted, then created again, which checks every row
+// before the commit; the sequences restart after the restored IDs, the
+// UUIDs are kept.
+func (s *service) Restore(r io.Reader, force bool) (types.RestoreSummary, error) {
+	tables, err := s.backupTables()
+	if err != nil {
+		return types.RestoreSummary{}, err
+	}
+
+	summary := types.RestoreSummary{Rows: map[string]int64{}}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if !force {
+			hasData, err := databaseHasData(tx, tables)
+			if err != nil {
+				return err
+			}
+			if hasData {
+				return ErrDatabaseNotEmpty
+			}
+		}
+
+		var foreignKeys []foreignKey
+		err := tx.Raw(`SELECT conrelid::regclass::text AS "table", conname AS name, pg_get_constraintdef(oid) AS definition
+			FROM pg_constraint WHERE contype = 'f' AND connamespace = current_schema()::regnamespace`).Scan(&foreignKeys).Error
+		if err != nil {
+			return err
+		}
+		for _, key := range foreignKeys {
+			if err := tx.Exec("ALTER TABLE " + key.Table + " DROP CONSTRAINT " + quoteIdentifier(key.Name)).Error; err != nil {
+				return err
+			}
+		}
+
+		quoted := make([]string, len(tables))
+		for i, table := range tables {
+			quoted[i] = quoteIdentifier(table)
+		}
+		if err := tx.Exec("TRUNCATE " + strings.Join(quoted, ", ")).Error; err != nil {
+			return err
+		}
+
+		if err := restoreTables(tx, json.NewDecoder(r), tables, &summary); err != nil {
+			return err
+		}
+		if err := resetSequences(tx); err != nil {
+			return err
+		}
+		if err := resetSyncChanges(tx); err != nil {
+			return err
+		}
+
+		for _, key := range foreignKeys {
+			err := tx.Exec("ALTER TABLE " + key.Table + " ADD CONSTRAINT " + quoteIdentifier(key.Name) + " " + key.Definition).Error
+			if err != nil {
+				return fmt.Errorf("%w: the rows of %s break %s: %v", ErrInvalidBackup, key.Table, key.Name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return types.RestoreSummary{}, err
+	}
+
+	var userIDs []uuid.UUID
+	if err := s.db.Model(&types.User{}).Pluck("id", &userIDs).Error; err != nil {
+		return summary, err
+	}
+	return summary, s.changed(nil, dataChange{userIDs: userIDs})
+}
+
+// databaseHasData reports whether the database holds data: more than the
+// user of the admin, or any row outside of the setup tables.
+func databaseHasData(tx *gorm.DB, tables []string) (bool, error) {
+	var users int64
+	if err := tx.Model(&types.User{}).Count(&users).Error; err != nil {
+		return false, err
+	}
+	if users > 1 {
+		return true, nil
+	}
+
+	for _, table := range tables {
+		if slices.Contains(setupTables, table) {
+			continue
+		}
+		var exists bool
+		if err := tx.Raw("SELECT EXISTS (SELECT 1 FROM " + quoteIdentifier(table) + ")").Scan(&exists).Error; err != nil {
+			return false, err
+		}
+		if exists {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// restoreTables inserts the rows of the backup read by the decoder, in
+// batches. The schema version is checked before any row is read.
+func restoreTables(tx *gorm.DB, decoder *json.Decoder, tables []string, summary *types.RestoreSummary) error {
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w: %s", ErrInvalidBackup, fmt.Sprintf(format, args...))
+	}
+	expect := func(delim json.Delim) error {
+		token, err := decoder.Token()
+		if err != nil {
+			return invalid("%v", err)
+		}
+		if token != delim {
+			return invalid("expected %s, got %v", delim, token)
+		}
+		return nil
+	}
+
+	if err := expect('{'); err != nil {
+		return err
+	}
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return invalid("%v", err)
+		}
+
+		switch key {
+		case "schema_version":
+			if err := decoder.Decode(&summary.SchemaVersion); err != nil {
+				return invalid("schema_version: %v", err)
+			}
+			if summary.SchemaVersion != types.ExportSchemaVersion {
+				return invalid("schema version %d, this version of FinMa restores version %d", summary.SchemaVersion, types.ExportSchemaVersion)
+			}
+		case "backed_up_at":
+			if err := decoder.Decode(&summary.BackedUpAt); err != nil {
+				return invalid("backed_up_at: %v", err)
+			}
+		case "tables":
+			if summary.SchemaVersion == 0 {
+				return invalid("the schema version must come before the tables")
+			}
+			if err := expect('{'); err != nil {
+				return err
+			}
+			for decoder.More() {
+				token, err := decoder.Token()
+				if err != nil {
+					return invalid("%v", err)
+				}
+				table, _ := token.(string)
+				if !slices.Contains(tables, table) {
+					return invalid("unknown table %v", token)
+				}
+				if err := expect('['); err != nil {
+					return err
+				}
+
+				var batch []json.RawMessage
+				for decoder.More() {
+					var row json.RawMessage
+					if err := decoder.Decode(&row); err != nil {
+						return invalid("%s: %v", table, err)
+					}
+					if batch = append(batch, row); len(batch) == restoreBatchSize {
+						if err := insertRows(tx, table, batch); err != nil {
+							return err
+						}
+						summary.Rows[table] += int64(len(batch))
+						batch = batch[:0]
+					}
+				}
+				if len(batch) > 0 {
+					if err := insertRows(tx, table, batch); err != nil {
+						return err
+					}
+					summary.Rows[table] += int64(len(batch))
+				}
+				if err := expect(']'); err != nil {
+					return err
+				}
+			}
+			if err := expect('}'); err != nil {
+				return err
+			}
+		default:
+			var skipped json.RawMessage
+			if err := decoder.Decode(&skipped); err != nil {
+				return invalid("%v", err)
+			}
+		}
+	}
+	if err := expect('}'); err != nil {
+		return err
+	}
+	if summary.SchemaVersion == 0 {
+		return invalid("the schema version is missing")
+	}
+	return nil
+}
+
+// insertRows inserts the rows, JSON objects of the columns of the table.
+// The columns missing from a row are set to NULL.
+func insertRows(tx *gorm.DB, table string, rows []json.RawMessage) error {
+	values := make([]string, len(rows))
+	for i, row := range rows {
+		values[i] = string(row)
+	}
+	err := tx.Exec("INSERT INTO "+quoteIdentifier(table)+" SELECT * FROM json_populate_recordset(NULL::"+quoteIdentifier(table)+", ?::json)",
+		"["+strings.Join(values, ",")+"]").Error
+	if err != nil {
+		return fmt.Errorf("%w: the rows of %s: %v", ErrInvalidBackup, table, err)
+	}
+	return nil
+}
+
+// resetSequences restarts the sequences of the serial and identity columns
+// after the largest restored value.
+func resetSequences(tx *gorm.DB) error {
+	var columns []struct {
+		Table  string
+		Column string
+	}
+	err := tx.Raw(`SELECT table_name AS "table", column_name AS "column" FROM information_schema.columns
+		WHERE table_schema = current_schema() AND (column_default LIKE 'nextval(%' OR is_identity = 'YES')`).Scan(&columns).Error
+	if err != nil {
+		return err
+	}
+
+	for _, column := range columns {
+		table, name := quoteIdentifier(column.Table), quoteIdentifier(column.Column)
+		err := tx.Exec("SELECT setval(pg_get_serial_sequence(?, ?), COALESCE(MAX("+name+"), 0) + 1, false) FROM "+table, table, column.Column).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
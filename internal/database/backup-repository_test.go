@@ -0,0 +1,134 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"FinMa/types"
+)
+
+// backupTablesOf decodes a backup into the rows of each table, sorted, to
+// compare backups regardless of the order of the rows.
+func backupTablesOf(t *testing.T, backup []byte) map[string][]string {
+	t.Helper()
+	var document struct {
+		SchemaVersion int                          `json:"schema_version"`
+		Tables        map[string][]json.RawMessage `json:"tables"`
+	}
+	if err := json.Unmarshal(backup, &document); err != nil {
+		t.Fatalf("could not decode the backup: %v", err)
+	}
+	if document.SchemaVersion != types.ExportSchemaVersion {
+		t.Fatalf("expected schema version %d; got %d", types.ExportSchemaVersion, document.SchemaVersion)
+	}
+	tables := map[string][]string{}
+	for table, rows := range document.Tables {
+		tables[table] = make([]string, len(rows))
+		for i, row := range rows {
+			tables[table][i] = string(row)
+		}
+		sort.Strings(tables[table])
+	}
+	return tables
+}
+
+func TestBackupRestoreRoundTrip(t *testing.T) {
+	s := New(testConfig).(*service)
+
+	user := types.User{ID: uuid.New(), Email: uuid.NewString() + "@example.com", Role: "user", Timezone: "Europe/Paris"}
+	if err := s.db.Create(&user).Error; err != nil {
+		t.Fatalf("could not create user: %v", err)
+	}
+	account := types.BankAccount{ID: uuid.New(), AccountNumber: uuid.NewString(), UserID: user.ID}
+	if err := s.CreateBankAccount(&account); err != nil {
+		t.Fatalf("could not create account: %v", err)
+	}
+	var transaction types.Transaction
+	for i := range 3 {
+		transaction = types.Transaction{ID: uuid.New(), Amount: money(float64(10 + i)), Type: "expense", Category: "food",
+			Date: time.Now().AddDate(0, 0, -i), BankAccountID: account.ID, UserID: user.ID}
+		if err := s.CreateTransaction(&transaction); err != nil {
+			t.Fatalf("could not create transaction: %v", err)
+		}
+	}
+	budget := types.Budget{ID: uuid.New(), Name: "Food", Amount: money(100), PeriodType: "monthly", StartDate: time.Now().AddDate(0, -1, 0),
+		UserID: user.ID, Categories: []types.BudgetCategory{{Category: "food"}}}
+	if err := s.CreateBudget(&budget); err != nil {
+		t.Fatalf("could not create budget: %v", err)
+	}
+
+	if err := s.db.Save(&types.Maintenance{ID: 1, Message: "Before the backup"}).Error; err != nil {
+		t.Fatalf("could not set the maintenance: %v", err)
+	}
+
+	var backup bytes.Buffer
+	if err := s.Backup(&backup); err != nil {
+		t.Fatalf("could not back up: %v", err)
+	}
+	original := backupTablesOf(t, backup.Bytes())
+	if len(original["transactions"]) < 3 || len(original["budgets"]) < 1 {
+		t.Fatalf("expected the data in the backup; got %d transactions", len(original["transactions"]))
+	}
+
+	if _, err := s.Restore(bytes.NewReader(backup.Bytes()), false); !errors.Is(err, ErrDatabaseNotEmpty) {
+		t.Fatalf("expected a database holding data refused; got %v", err)
+	}
+
+	tables, err := s.backupTables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.db.Exec("TRUNCATE " + strings.Join(tables, ", ") + " CASCADE").Error; err != nil {
+		t.Fatalf("could not wipe the database: %v", err)
+	}
+
+	summary, err := s.Restore(bytes.NewReader(backup.Bytes()), false)
+	if err != nil {
+		t.Fatalf("could not restore to an empty database: %v", err)
+	}
+	if summary.SchemaVersion != types.ExportSchemaVersion || summary.Rows["transactions"] != int64(len(original["transactions"])) {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+
+	var restored bytes.Buffer
+	if err := s.Backup(&restored); err != nil {
+		t.Fatalf("could not back up the restored database: %v", err)
+	}
+	if got := backupTablesOf(t, restored.Bytes()); !reflect.DeepEqual(got, original) {
+		for table := range original {
+			if !reflect.DeepEqual(got[table], original[table]) {
+				t.Errorf("%s: expected the rows restored as backed up; got %d rows for %d", table, len(got[table]), len(original[table]))
+			}
+		}
+	}
+
+	// The sequences restart after the restored IDs
+	next := types.Maintenance{Message: "After the restore"}
+	if err := s.db.Create(&next).Error; err != nil || next.ID != 2 {
+		t.Errorf("expected the sequence restarted after the restored maintenance; got %d %v", next.ID, err)
+	}
+
+	// A backup breaking a foreign key is refused and nothing is written
+	var broken map[string]any
+	json.Unmarshal(backup.Bytes(), &broken)
+	broken["tables"].(map[string]any)["bank_accounts"] = []any{}
+	brokenBackup, _ := json.Marshal(broken)
+	if _, err := s.Restore(bytes.NewReader(brokenBackup), true); !errors.Is(err, ErrInvalidBackup) {
+		t.Fatalf("expected transactions without their account refused; got %v", err)
+	}
+	if s.GetTransactionByID(transaction.ID.String()).ID == uuid.Nil {
+		t.Error("expected the data kept after a refused restore")
+	}
+
+	if _, err := s.Restore(strings.NewReader(`{"schema_version":99,"tables":{}}`), true); !errors.Is(err, ErrInvalidBackup) {
+		t.Errorf("expected another schema version refused; got %v", err)
+	}
+}
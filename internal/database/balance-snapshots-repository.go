@@ -0,0 +1,103 @@
+package database
+
+import (
+	"FinMa/types"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// snapshotDate returns the snapshot date covering the given instant.
+// Snapshots hold the balance at the end of a UTC day.
+func snapshotDate(at time.Time) string {
+	return at.UTC().Format("2006-01-02")
+}
+
+// shiftBalanceSnapshots adds delta to the snapshots of the account dated on or
+// after the given date.
+func shiftBalanceSnapshots(tx *gorm.DB, accountID uuid.UUID, delta types.Money, from time.Time) error {
+	if delta.IsZero() {
+		return nil
+	}
+	return tx.Model(&types.BalanceSnapshot{}).
+		Where("bank_account_id = ? AND date >= ?", accountID, snapshotDate(from)).
+		Update("balance", gorm.Expr("balance + ?", delta)).Error
+}
+
+// SnapshotBalances computes the end of day balance of the active accounts,
+// or of the given account only, for every day between from and to
+// (inclusive) from the transaction history, and stores it. Existing
+// snapshots are overwritten.
+func (s *service) SnapshotBalances(accountID *uuid.UUID, from, to time.Time) (int64, error) {
+	query := `
+		INSERT INTO balance_snapshots (bank_account_id, date, balance)
+		SELECT a.id, d::date, a.initial_balance + COALESCE((
+			SELECT SUM(f.net) FROM (` + accountFlowsSQL + `) f
+			WHERE f.account_id = a.id AND f.date < d + INTERVAL '1 day'
+		), 0)
+		FROM bank_accounts a
+		CROSS JOIN generate_series(?::date, ?::date, INTERVAL '1 day') d
+		WHERE a.archived_at IS NULL`
+	args := []interface{}{snapshotDate(from), snapshotDate(to)}
+
+	if accountID != nil {
+		query += " AND a.id = ?"
+		args = append(args, *accountID)
+	}
+	query += " ON CONFLICT (bank_account_id, date) DO UPDATE SET balance = EXCLUDED.balance"
+
+	result := s.db.Exec(query, args...)
+	return result.RowsAffected, result.Error
+}
+
+// BackfillBalanceSnapshots snapshots every day of the account history, from
+// its opening date or its first transaction, until today.
+func (s *service) BackfillBalanceSnapshots(accountID uuid.UUID) (int64, error) {
+	var first *time.Time
+	if err := s.db.Raw("SELECT MIN(date) FROM ("+accountFlowsSQL+") flows WHERE account_id = ?", accountID).
+		Scan(&first).Error; err != nil {
+		return 0, err
+	}
+
+	var account types.BankAccount
+	if err := s.db.Where("id = ?", accountID).First(&account).Error; err != nil {
+		return 0, err
+	}
+
+	from := time.Now()
+	if first != nil && first.Before(from) {
+		from = *first
+	}
+	if account.OpeningDate != nil && account.OpeningDate.Before(from) {
+		from = *account.OpeningDate
+	}
+
+	return s.SnapshotBalances(&accountID, from, time.Now())
+}
+
+// GetBalanceSnapshots returns the snapshots of the account between from and
+// to (inclusive), oldest first, preceded by the last snapshot before from
+// when there is one.
+func (s *service) GetBalanceSnapshots(accountID uuid.UUID, from, to time.Time) ([]types.BalanceSnapshot, error) {
+	snapshots := []types.BalanceSnapshot{}
+
+	var previous types.BalanceSnapshot
+	result := s.db.Where("bank_account_id = ? AND date < ?", accountID, snapshotDate(from)).
+		Order("date DESC").Limit(1).Find(&previous)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected > 0 {
+		snapshots = append(snapshots, previous)
+	}
+
+	var inRange []types.BalanceSnapshot
+	result = s.db.Where("bank_account_id = ? AND date BETWEEN ? AND ?", accountID, snapshotDate(from), snapshotDate(to)).
+		Order("date").Find(&inRange)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return append(snapshots, inRange...), nil
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"FinMa/types"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func snapshotBalances(t *testing.T, s *service, accountID uuid.UUID) map[string]float64 {
+	t.Helper()
+
+	var snapshots []types.BalanceSnapshot
+	if err := s.db.Where("bank_account_id = ?", accountID).Order("date").Find(&snapshots).Error; err != nil {
+		t.Fatalf("could not fetch snapshots: %v", err)
+	}
+
+	balances := map[string]float64{}
+	for _, snapshot := range snapshots {
+		balances[snapshot.Date.Format("2006-01-02")] = snapshot.Balance.Float64()
+	}
+	return balances
+}
+
+func expectSnapshots(t *testing.T, got map[string]float64, expected map[string]float64) {
+	t.Helper()
+
+	for date, balance := range expected {
+		if got[date] != balance {
+			t.Errorf("expected balance %v on %s; got %v", balance, date, got[date])
+		}
+	}
+}
+
+func TestBackDatedTransactionUpdatesSnapshots(t *testing.T) {
+	s := New(testConfig).(*service)
+
+	user := types.User{ID: uuid.New(), Email: uuid.NewString() + "@example.com", Role: "user"}
+	if err := s.db.Create(&user).Error; err != nil {
+		t.Fatalf("could not create user: %v", err)
+	}
+
+	account := types.BankAccount{ID: uuid.New(), AccountNumber: uuid.NewString(), InitialBalance: money(100), Balance: money(100), UserID: user.ID}
+	if err := s.CreateBankAccount(&account); err != nil {
+		t.Fatalf("could not create account: %v", err)
+	}
+
+	day1 := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+	day3 := day1.AddDate(0, 0, 2)
+
+	income := types.Transaction{ID: uuid.New(), Amount: money(50), Type: "income", Date: day1, BankAccountID: account.ID, UserID: user.ID}
+	if err := s.CreateTransaction(&income); err != nil {
+		t.Fatalf("could not create transaction: %v", err)
+	}
+
+	if _, err := s.SnapshotBalances(&account.ID, day1, day3); err != nil {
+		t.Fatalf("could not snapshot balances: %v", err)
+	}
+	expectSnapshots(t, snapshotBalances(t, s, account.ID), map[string]float64{
+		"2024-03-01": 150, "2024-03-02": 150, "2024-03-03": 150,
+	})
+
+	// A back-dated expense shifts the snapshots from its date on
+	expense := types.Transaction{ID: uuid.New(), Amount: money(30), Type: "expense", Date: day2, BankAccountID: account.ID, UserID: user.ID}
+	if err := s.CreateTransaction(&expense); err != nil {
+		t.Fatalf("could not create transaction: %v", err)
+	}
+	expectSnapshots(t, snapshotBalances(t, s, account.ID), map[string]float64{
+		"2024-03-01": 150, "2024-03-02": 120, "2024-03-03": 120,
+	})
+
+	// Moving it earlier and changing its amount moves the shift
+	expense.Date = day1
+	expense.Amount = money(40)
+	if err := s.UpdateTransaction(&expense); err != nil {
+		t.Fatalf("could not update transaction: %v", err)
+	}
+	expectSnapshots(t, snapshotBalances(t, s, account.ID), map[string]float64{
+		"2024-03-01": 110, "2024-03-02": 110, "2024-03-03": 110,
+	})
+
+	// The shifted snapshots match a full recomputation
+	if _, err := s.SnapshotBalances(&account.ID, day1, day3); err != nil {
+		t.Fatalf("could not snapshot balances: %v", err)
+	}
+	expectSnapshots(t, snapshotBalances(t, s, account.ID), map[string]float64{
+		"2024-03-01": 110, "2024-03-02": 110, "2024-03-03": 110,
+	})
+
+	if err := s.DeleteTransaction(&expense); err != nil {
+		t.Fatalf("could not delete transaction: %v", err)
+	}
+	expectSnapshots(t, snapshotBalances(t, s, account.ID), map[string]float64{
+		"2024-03-01": 150, "2024-03-02": 150, "2024-03-03": 150,
+	})
+}
@@ -1 +1,306 @@
 package database
+
+import (
+	"FinMa/types"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// signedAmountSQL is the contribution of a transaction to its account balance.
+const signedAmountSQL = "CASE WHEN type = 'income' THEN amount ELSE -amount END"
+
+// accountFlowsSQL lists the contribution of every transaction to the balance
+// of the accounts it touches: its own account, and the account credited by a transfer.
+const accountFlowsSQL = `
+	SELECT id, bank_account_id AS account_id, date, ` + signedAmountSQL + ` AS net FROM transactions
+	UNION ALL
+	SELECT id, transfer_account_id AS account_id, date, amount AS net FROM transactions
+	WHERE type = 'transfer' AND transfer_account_id IS NOT NULL`
+
+// CreateBankAccount stores the account at the end of the user's accounts order.
+func (s *service) CreateBankAccount(account *types.BankAccount) error {
+	var last int
+	if err := s.db.Model(&types.BankAccount{}).
+		Select("COALESCE(MAX(sort_order), 0)").
+		Where("user_id = ?", account.UserID).
+		Scan(&last).Error; err != nil {
+		return err
+	}
+	account.SortOrder = last + 1
+
+	result := s.db.Create(account)
+	return s.changed(result.Error, accountChange(account.ID))
+}
+
+// GetBankAccounts lists the accounts the user owns or is a member of,
+// favorites first, then by sort order and name. Archived accounts are only
+// included when includeArchived is set.
+func (s *service) GetBankAccounts(user *types.User, includeArchived bool) []types.BankAccount {
+	var accounts []types.BankAccount
+	query := s.db.Where("id IN (?)", s.accessibleAccountsQuery(user, false))
+	if !includeArchived {
+		query = query.Where("archived_at IS NULL")
+	}
+	result := query.Order("is_favorite DESC, sort_order, bank_name").Find(&accounts)
+
+	if result.Error != nil {
+		log.Error("Error fetching bank accounts: ", result.Error)
+		return nil
+	}
+	return accounts
+}
+
+func (s *service) GetBankAccountByID(id string) types.BankAccount {
+	var account types.BankAccount
+	result := s.db.Where("id = ?", id).First(&account)
+
+	if result.Error != nil {
+		log.Error("Error fetching bank account: ", result.Error)
+		return types.BankAccount{}
+	}
+	return account
+}
+
+// UpdateBankAccount saves the editable fields of the account. The balance is
+// left untouched as it is maintained from the transactions.
+func (s *service) UpdateBankAccount(account *types.BankAccount) error {
+	result := s.db.Model(&types.BankAccount{}).
+		Where("id = ?", account.ID).
+		Updates(map[string]interface{}{
+			"bank_name":             account.BankName,
+			"account_type":          account.AccountType,
+			"credit_limit":          account.CreditLimit,
+			"initial_balance":       account.InitialBalance,
+			"opening_date":          account.OpeningDate,
+			"statement_day":         account.StatementDay,
+			"payment_due_day":       account.PaymentDueDay,
+			"due_reminder_days":     account.DueReminderDays,
+			"low_balance_threshold": account.LowBalanceThreshold,
+			// A balance already below a new threshold is not notified
+			"low_balance_alerted":   gorm.Expr("COALESCE(balance < ?::numeric, false)", account.LowBalanceThreshold),
+			"compounding_frequency": account.CompoundingFrequency,
+			"color":                 account.Color,
+			"is_favorite":           account.IsFavorite,
+			"updated_at":            time.Now(),
+		})
+	return s.changed(result.Error, accountChange(account.ID))
+}
+
+// ReorderBankAccounts sets the sort order of the accounts of the user to
+// their position in accountIDs, in a single database transaction.
+func (s *service) ReorderBankAccounts(userID uuid.UUID, accountIDs []uuid.UUID) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for i, id := range accountIDs {
+			result := tx.Model(&types.BankAccount{}).
+				Where("id = ? AND user_id = ?", id, userID).
+				Update("sort_order", i+1)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return gorm.ErrRecordNotFound
+			}
+		}
+		return nil
+	})
+	return s.changed(err, dataChange{userIDs: []uuid.UUID{userID}})
+}
+
+// SetBankAccountArchived archives or unarchives the account.
+func (s *service) SetBankAccountArchived(account *types.BankAccount, archived bool, keepInNetWorth bool) error {
+	if archived {
+		now := time.Now()
+		account.ArchivedAt = &now
+		account.KeepInNetWorth = keepInNetWorth
+	} else {
+		account.ArchivedAt = nil
+		account.KeepInNetWorth = false
+	}
+
+	result := s.db.Model(&types.BankAccount{}).
+		Where("id = ?", account.ID).
+		Updates(map[string]interface{}{
+			"archived_at":       account.ArchivedAt,
+			"keep_in_net_worth": account.KeepInNetWorth,
+		})
+	return s.changed(result.Error, accountChange(account.ID))
+}
+
+// RecomputeBalance recalculates the balance of the account from its initial
+// balance and its transactions and stores it, the balance snapshots are
+// shifted by the same difference. It returns the stored balance before and after.
+func (s *service) RecomputeBalance(accountID uuid.UUID) (types.BalanceDrift, error) {
+	drift := types.BalanceDrift{AccountID: accountID}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var account types.BankAccount
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", accountID).First(&account).Error; err != nil {
+			return err
+		}
+		drift.Stored = account.Balance
+
+		if err := tx.Raw("SELECT COALESCE(SUM(net), 0) FROM ("+accountFlowsSQL+") flows WHERE account_id = ?", accountID).
+			Scan(&drift.Computed).Error; err != nil {
+			return err
+		}
+		computed, err := drift.Computed.Add(account.InitialBalance)
+		if err != nil {
+			return err
+		}
+		drift.Computed = computed
+
+		if err := tx.Model(&types.BankAccount{}).Where("id = ?", accountID).Update("balance", drift.Computed).Error; err != nil {
+			return err
+		}
+		shift, err := drift.Computed.Sub(drift.Stored)
+		if err != nil {
+			return err
+		}
+		return shiftBalanceSnapshots(tx, accountID, shift, time.Time{})
+	})
+
+	return drift, s.changed(err, accountChange(accountID))
+}
+
+// accountChange is the change of the account, seen by its owner, its
+// members and the household of its owner.
+func accountChange(accountID uuid.UUID) dataChange {
+	return dataChange{accountIDs: []uuid.UUID{accountID}}
+}
+
+// GetBalanceDrifts returns the accounts whose stored balance does not match
+// their initial balance plus the sum of their transactions.
+func (s *service) GetBalanceDrifts() ([]types.BalanceDrift, error) {
+	drifts := []types.BalanceDrift{}
+	result := s.db.Raw(`
+		SELECT a.id AS account_id, a.balance AS stored, a.initial_balance + COALESCE(SUM(f.net), 0) AS computed
+		FROM bank_accounts a
+		LEFT JOIN (` + accountFlowsSQL + `) f ON f.account_id = a.id
+		GROUP BY a.id, a.balance, a.initial_balance
+		HAVING ABS(a.balance - a.initial_balance - COALESCE(SUM(f.net), 0)) > 0.001`).Scan(&drifts)
+
+	return drifts, result.Error
+}
+
+// signedAmount returns the contribution of a transaction to its account balance.
+func signedAmount(transaction *types.Transaction) types.Money {
+	if transaction.Type == "income" {
+		return transaction.Amount
+	}
+	return transaction.Amount.Neg()
+}
+
+// LowBalanceHook is called once a committed change to a transaction took the
+// balance of an account below its low balance threshold. account holds the
+// balance as of the commit.
+type LowBalanceHook func(account types.BankAccount, transaction *types.Transaction)
+
+// OnLowBalance registers a hook called when a transaction takes the balance
+// of an account below its threshold. Hooks must be registered before the
+// server starts.
+func (s *service) OnLowBalance(hook LowBalanceHook) {
+	s.lowBalanceHooks = append(s.lowBalanceHooks, hook)
+}
+
+func (s *service) runLowBalanceHooks(accounts []types.BankAccount, transaction *types.Transaction) {
+	for _, account := range accounts {
+		for _, hook := range s.lowBalanceHooks {
+			hook(account, transaction)
+		}
+	}
+}
+
+// updateLowBalanceAlerts is called in the database transaction that changed
+// the balance of the accounts, once their rows are locked by the update. It
+// re-arms the alert of the accounts back at or above their threshold, and
+// returns the accounts that went below it, so that each crossing is
+// notified once.
+func updateLowBalanceAlerts(tx *gorm.DB, accountIDs ...*uuid.UUID) ([]types.BankAccount, error) {
+	ids := make([]uuid.UUID, 0, len(accountIDs))
+	for _, id := range accountIDs {
+		if id != nil && *id != uuid.Nil {
+			ids = append(ids, *id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	if err := tx.Model(&types.BankAccount{}).
+		Where("id IN ? AND low_balance_alerted AND (low_balance_threshold IS NULL OR balance >= low_balance_threshold)", ids).
+		Update("low_balance_alerted", false).Error; err != nil {
+		return nil, err
+	}
+
+	var crossed []types.BankAccount
+	err := tx.Raw(`UPDATE bank_accounts SET low_balance_alerted = true
+		WHERE id IN ? AND NOT low_balance_alerted AND low_balance_threshold IS NOT NULL AND balance < low_balance_threshold
+		RETURNING *`, ids).Scan(&crossed).Error
+	return crossed, err
+}
+
+// adjustTransferBalance applies the credit of a transfer to the account it was
+// sent to, direction is 1 to apply it and -1 to revert it.
+func adjustTransferBalance(tx *gorm.DB, transaction *types.Transaction, direction int) error {
+	if transaction.Type != "transfer" || transaction.TransferAccountID == nil {
+		return nil
+	}
+	delta := transaction.Amount
+	if direction < 0 {
+		delta = delta.Neg()
+	}
+	return adjustBalance(tx, *transaction.TransferAccountID, delta, transaction.Date)
+}
+
+// adjustBalance atomically adds delta to the account balance, without reading
+// it first. The balance snapshots from the date of the change on are shifted
+// too, so back-dated transactions keep the balance history right.
+func adjustBalance(tx *gorm.DB, accountID uuid.UUID, delta types.Money, date time.Time) error {
+	if accountID == uuid.Nil || delta.IsZero() {
+		return nil
+	}
+	if err := tx.Model(&types.BankAccount{}).
+		Where("id = ?", accountID).
+		Update("balance", gorm.Expr("balance + ?", delta)).Error; err != nil {
+		return err
+	}
+	return shiftBalanceSnapshots(tx, accountID, delta, date)
+}
+
+// GetCardCycleTotals returns the charges and the payments of a card account
+// dated in [from, to). Payments are the credits to the account: refunds and
+// transfers received from another account.
+func (s *service) GetCardCycleTotals(accountID uuid.UUID, from, to time.Time) (types.CardCycleTotals, error) {
+	var totals types.CardCycleTotals
+	result := s.db.Raw(`
+		SELECT COALESCE(SUM(CASE WHEN net < 0 THEN -net ELSE 0 END), 0) AS charges,
+			COALESCE(SUM(CASE WHEN net > 0 THEN net ELSE 0 END), 0) AS payments
+		FROM (`+accountFlowsSQL+`) flows
+		WHERE account_id = ? AND date >= ? AND date < ?`, accountID, from, to).Scan(&totals)
+
+	return totals, result.Error
+}
+
+// GetCreditCardsDueReminder lists the active credit card accounts with a
+// statement cycle and the due date reminder enabled.
+func (s *service) GetCreditCardsDueReminder() []types.BankAccount {
+	var accounts []types.BankAccount
+	result := s.db.Preload("User").
+		Where("account_type = 'credit_card' AND statement_day > 0 AND payment_due_day > 0 AND due_reminder_days > 0 AND archived_at IS NULL").
+		Find(&accounts)
+
+	if result.Error != nil {
+		log.Error("Error fetching credit card accounts: ", result.Error)
+		return nil
+	}
+	return accounts
+}
+
+// SetDueReminderSent records that the reminder for the given due date was sent.
+func (s *service) SetDueReminderSent(accountID uuid.UUID, dueDate time.Time) error {
+	return s.db.Model(&types.BankAccount{}).Where("id = ?", accountID).Update("due_reminder_sent_for", dueDate).Error
+}
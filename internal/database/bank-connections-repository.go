@@ -0,0 +1,101 @@
+package database
+
+import (
+	"FinMa/types"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+)
+
+func (s *service) CreateBankConnection(connection *types.BankConnection) error {
+	result := s.db.Omit("Accounts").Create(connection)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+func (s *service) UpdateBankConnection(connection *types.BankConnection) error {
+	result := s.db.Omit("Accounts").Save(connection)
+	return result.Error
+}
+
+func (s *service) GetBankConnections(user *types.User) []types.BankConnection {
+	var connections []types.BankConnection
+	result := s.db.Preload("Accounts").Where("user_id = ?", user.ID).Order("created_at").Find(&connections)
+
+	if result.Error != nil {
+		log.Error("Error fetching bank connections: ", result.Error)
+		return nil
+	}
+	return connections
+}
+
+func (s *service) GetBankConnectionByID(id string) types.BankConnection {
+	var connection types.BankConnection
+	result := s.db.Preload("Accounts").Where("id = ?", id).First(&connection)
+
+	if result.Error != nil {
+		log.Error("Error fetching bank connection: ", result.Error)
+		return types.BankConnection{}
+	}
+	return connection
+}
+
+// GetSyncableBankConnections returns the connections with attached accounts
+// that are not expired nor waiting for the provider rate limit to reset.
+func (s *service) GetSyncableBankConnections() []types.BankConnection {
+	var connections []types.BankConnection
+	result := s.db.Preload("Accounts", "archived_at IS NULL").
+		Where("status <> 'expired' AND status <> 'pending'").
+		Where("retry_after IS NULL OR retry_after < ?", time.Now()).
+		Find(&connections)
+
+	if result.Error != nil {
+		log.Error("Error fetching bank connections: ", result.Error)
+		return nil
+	}
+	return connections
+}
+
+func (s *service) AttachExternalAccount(account *types.BankAccount, connectionID uuid.UUID, externalAccountID string) error {
+	account.BankConnectionID = &connectionID
+	account.ExternalAccountID = externalAccountID
+	account.SyncCursor = ""
+
+	// Updated from the struct, the external account ID is encrypted
+	result := s.db.Model(account).
+		Select("bank_connection_id", "encrypted_external_account_id", "sync_cursor").
+		Updates(account)
+	return result.Error
+}
+
+// UpdateBankAccountSync saves the sync cursor and error of the account.
+func (s *service) UpdateBankAccountSync(account *types.BankAccount) error {
+	result := s.db.Model(&types.BankAccount{}).
+		Where("id = ?", account.ID).
+		Updates(map[string]interface{}{
+			"sync_cursor": account.SyncCursor,
+			"sync_error":  account.SyncError,
+		})
+	return result.Error
+}
+
+// AccountHasTransactions reports whether any transaction is recorded in or
+// transferred to the account.
+func (s *service) AccountHasTransactions(accountID uuid.UUID) bool {
+	var count int64
+	s.db.Model(&types.Transaction{}).
+		Where("bank_account_id = ? OR transfer_account_id = ?", accountID, accountID).
+		Count(&count)
+	return count > 0
+}
+
+func (s *service) ExternalTransactionExists(accountID uuid.UUID, externalID string) bool {
+	var count int64
+	s.db.Model(&types.Transaction{}).
+		Where("bank_account_id = ? AND external_id = ?", accountID, externalID).
+		Count(&count)
+	return count > 0
+}
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"FinMa/types"
+)
+
+// GetBillingAccount returns the billing account of the user, with a nil
+// UserID when they have none.
+func (s *service) GetBillingAccount(userID uuid.UUID) types.BillingAccount {
+	var account types.BillingAccount
+	s.db.Where("user_id = ?", userID).Limit(1).Find(&account)
+	return account
+}
+
+// GetBillingAccountByCustomer returns the billing account of the customer
+// of the payment provider, with a nil UserID when unknown.
+func (s *service) GetBillingAccountByCustomer(customerID string) types.BillingAccount {
+	var account types.BillingAccount
+	s.db.Where("customer_id = ?", customerID).Limit(1).Find(&account)
+	return account
+}
+
+// SaveBillingAccount stores the billing account and moves its user to the
+// plan in one transaction, an empty plan leaves theirs unchanged.
+func (s *service) SaveBillingAccount(account *types.BillingAccount, plan string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(account).Error; err != nil {
+			return err
+		}
+		if plan == "" {
+			return nil
+		}
+		return tx.Model(&types.User{}).Where("id = ?", account.UserID).Update("plan", plan).Error
+	})
+}
+
+// GetBillingAccountsPastDue returns the billing accounts whose payments
+// failed since before the time and not yet downgraded.
+func (s *service) GetBillingAccountsPastDue(before time.Time) []types.BillingAccount {
+	var accounts []types.BillingAccount
+	s.db.Where("past_due_since <= ? AND downgraded_at IS NULL", before).Find(&accounts)
+	return accounts
+}
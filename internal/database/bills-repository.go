@@ -0,0 +1,136 @@
+package database
+
+import (
+	"FinMa/types"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func (s *service) CreateBill(bill *types.Bill) error {
+	return s.db.Omit("User").Create(bill).Error
+}
+
+func (s *service) GetBills(user *types.User) []types.Bill {
+	var bills []types.Bill
+	result := s.db.Where("user_id = ?", user.ID).Order("created_at").Find(&bills)
+
+	if result.Error != nil {
+		log.Error("Error fetching bills: ", result.Error)
+		return nil
+	}
+	return bills
+}
+
+func (s *service) GetBillByID(id string) types.Bill {
+	var bill types.Bill
+	result := s.db.Where("id = ?", id).First(&bill)
+
+	if result.Error != nil {
+		log.Error("Error fetching bill: ", result.Error)
+		return types.Bill{}
+	}
+	return bill
+}
+
+func (s *service) UpdateBill(bill *types.Bill) error {
+	return s.db.Omit("User").Save(bill).Error
+}
+
+// DeleteBill deletes the bill and the payments recorded for it.
+func (s *service) DeleteBill(bill *types.Bill) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("bill_id = ?", bill.ID).Delete(&types.BillPayment{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(bill).Error
+	})
+}
+
+// GetAllBills lists the bills of every user with their owner, for the
+// reminder job.
+func (s *service) GetAllBills() []types.Bill {
+	var bills []types.Bill
+	result := s.db.Preload("User").Find(&bills)
+
+	if result.Error != nil {
+		log.Error("Error fetching bills: ", result.Error)
+		return nil
+	}
+	return bills
+}
+
+// GetBillsForTransaction lists the bills the transaction may pay: the bills
+// of its user, and the bills paid from its account.
+func (s *service) GetBillsForTransaction(transaction *types.Transaction) []types.Bill {
+	var bills []types.Bill
+	result := s.db.Preload("User").
+		Where("user_id = ? OR bank_account_id = ?", transaction.UserID, transaction.BankAccountID).
+		Find(&bills)
+
+	if result.Error != nil {
+		log.Error("Error fetching bills: ", result.Error)
+		return nil
+	}
+	return bills
+}
+
+// GetBillPayments returns the payments of the bills for the occurrences due
+// between from and to, both included.
+func (s *service) GetBillPayments(billIDs []uuid.UUID, from, to time.Time) []types.BillPayment {
+	if len(billIDs) == 0 {
+		return nil
+	}
+
+	var payments []types.BillPayment
+	result := s.db.Where("bill_id IN ? AND due_date BETWEEN ? AND ?", billIDs, from, to).Find(&payments)
+
+	if result.Error != nil {
+		log.Error("Error fetching bill payments: ", result.Error)
+		return nil
+	}
+	return payments
+}
+
+// MarkBillPaid records the transaction as the payment of the occurrence of
+// the bill due on dueDate. It returns false when the occurrence was already paid.
+func (s *service) MarkBillPaid(billID uuid.UUID, dueDate time.Time, transactionID uuid.UUID, paidAt time.Time) (bool, error) {
+	payment := &types.BillPayment{BillID: billID, DueDate: dueDate, PaidAt: &paidAt, TransactionID: &transactionID}
+	result := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "bill_id"}, {Name: "due_date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"paid_at", "transaction_id", "updated_at"}),
+		Where:     clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "bill_payments.paid_at IS NULL"}}},
+	}).Create(payment)
+	return result.RowsAffected == 1, result.Error
+}
+
+// ClaimBillNotification records that the reminder ("reminder") or the
+// overdue notification ("overdue") of the occurrence due on dueDate is sent.
+// It returns false when it was already sent or the occurrence is paid, so
+// that each is sent once.
+func (s *service) ClaimBillNotification(billID uuid.UUID, dueDate time.Time, kind string, now time.Time) (bool, error) {
+	column := "reminder_sent_at"
+	if kind == "overdue" {
+		column = "overdue_sent_at"
+	}
+
+	payment := &types.BillPayment{BillID: billID, DueDate: dueDate}
+	if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(payment).Error; err != nil {
+		return false, err
+	}
+
+	result := s.db.Model(&types.BillPayment{}).
+		Where("bill_id = ? AND due_date = ? AND paid_at IS NULL AND "+column+" IS NULL", billID, dueDate).
+		Update(column, now)
+	return result.RowsAffected > 0, result.Error
+}
+
+// UnmarkBillPaid reopens the occurrences paid by the transaction, once it is deleted.
+func (s *service) UnmarkBillPaid(transactionID uuid.UUID) error {
+	return s.db.Model(&types.BillPayment{}).
+		Where("transaction_id = ?", transactionID).
+		Updates(map[string]interface{}{"paid_at": nil, "transaction_id": nil}).Error
+}
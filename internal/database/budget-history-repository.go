@@ -0,0 +1,66 @@
+package database
+
+import (
+	"FinMa/types"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GetLatestClosedBudgetPeriods returns the most recent closed period
+// recorded for each of the budgets, by budget.
+func (s *service) GetLatestClosedBudgetPeriods(budgetIDs []uuid.UUID) (map[uuid.UUID]types.ClosedBudgetPeriod, error) {
+	latest := make(map[uuid.UUID]types.ClosedBudgetPeriod, len(budgetIDs))
+	if len(budgetIDs) == 0 {
+		return latest, nil
+	}
+
+	var records []types.ClosedBudgetPeriod
+	result := s.db.Raw(`
+		SELECT DISTINCT ON (budget_id) * FROM closed_budget_periods
+		WHERE budget_id IN ?
+		ORDER BY budget_id, period_start DESC`, budgetIDs).Scan(&records)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	for _, record := range records {
+		latest[record.BudgetID] = record
+	}
+	return latest, nil
+}
+
+// GetClosedBudgetPeriods returns the closed periods recorded for the budget,
+// oldest first.
+func (s *service) GetClosedBudgetPeriods(budgetID uuid.UUID) []types.ClosedBudgetPeriod {
+	var records []types.ClosedBudgetPeriod
+	result := s.db.Where("budget_id = ?", budgetID).Order("period_start").Find(&records)
+
+	if result.Error != nil {
+		log.Error("Error fetching closed budget periods: ", result.Error)
+		return nil
+	}
+	return records
+}
+
+// CreateClosedBudgetPeriods stores the records of closed periods. Periods
+// already recorded, by a concurrent request for instance, are kept as is.
+func (s *service) CreateClosedBudgetPeriods(records []types.ClosedBudgetPeriod) error {
+	if len(records) == 0 {
+		return nil
+	}
+	return s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&records).Error
+}
+
+func (s *service) UpdateClosedBudgetPeriods(records []types.ClosedBudgetPeriod) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for i := range records {
+			if err := tx.Save(&records[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,41 @@
+package database
+
+import (
+	"FinMa/types"
+
+	"github.com/charmbracelet/log"
+	"gorm.io/gorm"
+)
+
+// CreateBudgetTemplate stores the template with its items.
+func (s *service) CreateBudgetTemplate(template *types.BudgetTemplate) error {
+	return s.db.Create(template).Error
+}
+
+func preloadBudgetTemplateItems(query *gorm.DB) *gorm.DB {
+	return query.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("name")
+	})
+}
+
+func (s *service) GetBudgetTemplates(user *types.User) []types.BudgetTemplate {
+	var templates []types.BudgetTemplate
+	result := preloadBudgetTemplateItems(s.db).Where("user_id = ?", user.ID).Order("name").Find(&templates)
+
+	if result.Error != nil {
+		log.Error("Error fetching budget templates: ", result.Error)
+		return nil
+	}
+	return templates
+}
+
+func (s *service) GetBudgetTemplateByID(id string) types.BudgetTemplate {
+	var template types.BudgetTemplate
+	result := preloadBudgetTemplateItems(s.db).Where("id = ?", id).First(&template)
+
+	if result.Error != nil {
+		log.Error("Error fetching budget template: ", result.Error)
+		return types.BudgetTemplate{}
+	}
+	return template
+}
@@ -0,0 +1,404 @@
+package database
+
+import (
+	"FinMa/types"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// userTimezoneSQL selects the timezone of the user of the ID it is given.
+const userTimezoneSQL = "(SELECT COALESCE(NULLIF(u.timezone, ''), 'UTC') FROM users u WHERE u.id = %s)"
+
+// dayEndSQL returns the SQL of the midnight ending the day of the instant,
+// in the timezone: the next day starts 23 or 25 hours later on the days
+// the clocks change.
+func dayEndSQL(instant, timezone string) string {
+	return fmt.Sprintf("((%[1]s AT TIME ZONE %[2]s)::date + 1)::timestamp AT TIME ZONE %[2]s", instant, timezone)
+}
+
+// budgetCoversSQL matches the budgets running at a date: custom budgets
+// include their whole end day in the timezone of their owner, recurring
+// budgets have no end.
+var budgetCoversSQL = "start_date <= @date AND (period_type <> 'custom' OR @date < " +
+	dayEndSQL("end_date", fmt.Sprintf(userTimezoneSQL, "budgets.user_id")) + ")"
+
+// budgetMatchesCategorySQL matches the budgets counting the expenses of
+// @category: the category is listed in an including budget or missing from
+// an excluding one.
+const budgetMatchesCategorySQL = `EXISTS (
+	SELECT 1 FROM budget_categories bc WHERE bc.budget_id = budgets.id AND bc.category = @category
+) <> budgets.exclude_categories`
+
+// budgetExpensesQuery selects the expenses in the categories of the budget,
+// whatever their date and attribution. A household budget covers the
+// expenses of every member. Expenses excluded from the budgets are left out.
+// It returns false when no category matches.
+func (s *service) budgetExpensesQuery(tx *gorm.DB, budget *types.Budget) (*gorm.DB, bool) {
+	query := tx.Model(&types.Transaction{}).Where("type = 'expense' AND NOT exclude_from_budgets")
+	if budget.HouseholdID != nil {
+		query = query.Where("user_id IN (?)", s.householdUsersQuery(*budget.HouseholdID))
+	} else {
+		query = query.Where("user_id = ?", budget.UserID)
+	}
+
+	categories := budget.CategoryNames()
+	switch {
+	case len(categories) > 0 && budget.ExcludeCategories:
+		query = query.Where("category NOT IN ?", categories)
+	case len(categories) > 0:
+		query = query.Where("category IN ?", categories)
+	case !budget.ExcludeCategories:
+		return query, false
+	}
+	return query, true
+}
+
+// attributeBudgetExpenses counts against the budget the expenses that fall
+// into its categories and dates and are not counted against another budget yet.
+func (s *service) attributeBudgetExpenses(tx *gorm.DB, budget *types.Budget) error {
+	query, ok := s.budgetExpensesQuery(tx, budget)
+	if !ok {
+		return nil
+	}
+
+	query = query.Where("budget_id IS NULL AND date >= ?", budget.StartDate)
+	if budget.PeriodType == "custom" {
+		timezone := fmt.Sprintf(userTimezoneSQL, "@owner")
+		query = query.Where("date < "+dayEndSQL("@end::timestamptz", timezone),
+			sql.Named("end", budget.EndDate), sql.Named("owner", budget.UserID))
+	}
+	return query.Updates(map[string]interface{}{"budget_id": budget.ID, "version": gorm.Expr("version + 1")}).Error
+}
+
+// GetBudgetRecurringExpenses returns the recurring expenses in the categories
+// of the budget dated after since, oldest first.
+func (s *service) GetBudgetRecurringExpenses(budget *types.Budget, since time.Time) []types.Transaction {
+	query, ok := s.budgetExpensesQuery(s.db, budget)
+	if !ok {
+		return nil
+	}
+
+	var transactions []types.Transaction
+	result := query.Where("is_recurring AND date >= ?", since).Order("date").Find(&transactions)
+
+	if result.Error != nil {
+		log.Error("Error fetching recurring expenses: ", result.Error)
+		return nil
+	}
+	return transactions
+}
+
+// CreateBudget creates the budget with its categories and first period
+// setting, and attributes the matching existing expenses to it.
+func (s *service) CreateBudget(budget *types.Budget) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		return s.createBudget(tx, budget)
+	})
+	return s.changed(err, budgetChange(budget))
+}
+
+// createBudget creates the budget with its categories and its first period,
+// and counts the matching expenses against it, in the transaction.
+func (s *service) createBudget(tx *gorm.DB, budget *types.Budget) error {
+	if err := tx.Omit("User").Create(budget).Error; err != nil {
+		return err
+	}
+
+	period := types.BudgetPeriod{
+		ID:            uuid.New(),
+		PeriodType:    budget.PeriodType,
+		WeekStartDay:  budget.WeekStartDay,
+		EffectiveFrom: budget.StartDate,
+		BudgetID:      budget.ID,
+	}
+	if err := tx.Create(&period).Error; err != nil {
+		return err
+	}
+	budget.Periods = []types.BudgetPeriod{period}
+
+	return s.attributeBudgetExpenses(tx, budget)
+}
+
+// UpdateBudgetCategories replaces the categories of the budget and moves the
+// expenses that no longer match it, or now match it, accordingly.
+func (s *service) UpdateBudgetCategories(budget *types.Budget) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("budget_id = ?", budget.ID).Delete(&types.BudgetCategory{}).Error; err != nil {
+			return err
+		}
+		for i := range budget.Categories {
+			budget.Categories[i].BudgetID = budget.ID
+		}
+		if len(budget.Categories) > 0 {
+			if err := tx.Create(&budget.Categories).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(&types.Budget{}).Where("id = ?", budget.ID).
+			Updates(map[string]interface{}{"exclude_categories": budget.ExcludeCategories, "version": gorm.Expr("version + 1")}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&types.Transaction{}).Where("budget_id = ?", budget.ID).
+			Updates(map[string]interface{}{"budget_id": nil, "version": gorm.Expr("version + 1")}).Error; err != nil {
+			return err
+		}
+		return s.attributeBudgetExpenses(tx, budget)
+	})
+	if err == nil {
+		budget.Version++
+	}
+	return s.changed(err, budgetChange(budget))
+}
+
+// migrateBudgetSoftDelete clears the zero deletion dates stored before
+// budgets were soft deleted, as they would hide every budget.
+func (s *service) migrateBudgetSoftDelete() error {
+	return s.db.Exec("UPDATE budgets SET deleted_at = NULL WHERE deleted_at < '0002-01-01'").Error
+}
+
+// DeleteBudget soft deletes the budget. The expenses counted against it keep
+// their attribution so it still appears in the reports of past periods.
+func (s *service) DeleteBudget(budget *types.Budget) error {
+	return s.changed(s.db.Delete(budget).Error, budgetChange(budget))
+}
+
+// GetBudgetsForReport returns the budgets of the user and of their
+// household, including the ones deleted after the given date.
+func (s *service) GetBudgetsForReport(user *types.User, deletedAfter time.Time) []types.Budget {
+	var budgets []types.Budget
+	result := preloadBudgetSettings(s.db.Unscoped()).
+		Where("user_id = ? OR household_id IN (?)", user.ID, s.visibleHouseholdsQuery(user)).
+		Where("deleted_at IS NULL OR deleted_at > ?", deletedAfter).
+		Order("start_date").
+		Find(&budgets)
+
+	if result.Error != nil {
+		log.Error("Error fetching budgets: ", result.Error)
+		return nil
+	}
+	return budgets
+}
+
+// migrateBudgetCategories moves the single category of the budgets created
+// before budgets could span several categories to budget_categories.
+func (s *service) migrateBudgetCategories() error {
+	if !s.db.Migrator().HasColumn(&types.Budget{}, "category") {
+		return nil
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`
+			INSERT INTO budget_categories (budget_id, category)
+			SELECT id, category FROM budgets WHERE category IS NOT NULL AND category <> ''
+			ON CONFLICT DO NOTHING`).Error; err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&types.Budget{}, "category")
+	})
+}
+
+// UpdateBudget saves the name, the amount, the rollover and alert settings
+// and the current period type of the budget, if its version is still the
+// stored one, and bumps the version.
+func (s *service) UpdateBudget(budget *types.Budget) error {
+	result := s.db.Model(&types.Budget{}).
+		Where("id = ? AND version = ?", budget.ID, budget.Version).
+		Updates(map[string]interface{}{
+			"version":          gorm.Expr("version + 1"),
+			"name":             budget.Name,
+			"amount":           budget.Amount,
+			"rollover":         budget.Rollover,
+			"alert_thresholds": budget.AlertThresholds,
+			"rearm_alerts":     budget.RearmAlerts,
+			"period_type":      budget.PeriodType,
+			"week_start_day":   budget.WeekStartDay,
+			"updated_at":       time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrVersionConflict
+	}
+	budget.Version++
+	return s.changed(nil, budgetChange(budget))
+}
+
+// ChangeBudgetPeriod adds a period setting to the budget and makes it its
+// current period type. Periods before its effective date are left as they were.
+func (s *service) ChangeBudgetPeriod(budget *types.Budget, period *types.BudgetPeriod) error {
+	budget.PeriodType = period.PeriodType
+	budget.WeekStartDay = period.WeekStartDay
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(period).Error; err != nil {
+			return err
+		}
+		budget.Periods = append(budget.Periods, *period)
+
+		return tx.Model(&types.Budget{}).
+			Where("id = ?", budget.ID).
+			Updates(map[string]interface{}{
+				"period_type":    budget.PeriodType,
+				"week_start_day": budget.WeekStartDay,
+				"version":        gorm.Expr("version + 1"),
+			}).Error
+	})
+	if err == nil {
+		budget.Version++
+	}
+	return s.changed(err, budgetChange(budget))
+}
+
+// budgetChange is the change of the budget, seen by its owner and by their
+// household.
+func budgetChange(budget *types.Budget) dataChange {
+	return dataChange{userIDs: []uuid.UUID{budget.UserID}, householdID: budget.HouseholdID}
+}
+
+// preloadBudgetSettings loads the categories and the period settings of the
+// budgets, oldest period first.
+func preloadBudgetSettings(query *gorm.DB) *gorm.DB {
+	return query.Preload("Categories", func(db *gorm.DB) *gorm.DB {
+		return db.Order("category")
+	}).Preload("Periods", func(db *gorm.DB) *gorm.DB {
+		return db.Order("effective_from, created_at")
+	})
+}
+
+// GetBudgets returns the budgets of the user and the budgets shared in their
+// household, unless the user sees their own data only.
+func (s *service) GetBudgets(user *types.User) []types.Budget {
+	var budgets []types.Budget
+	result := preloadBudgetSettings(s.db).
+		Where("user_id = ? OR household_id IN (?)", user.ID, s.visibleHouseholdsQuery(user)).
+		Order("start_date DESC").
+		Find(&budgets)
+
+	if result.Error != nil {
+		log.Error("Error fetching budgets: ", result.Error)
+		return nil
+	}
+	return budgets
+}
+
+func (s *service) GetBudgetByID(id string) types.Budget {
+	var budget types.Budget
+	result := preloadBudgetSettings(s.db).Where("id = ?", id).First(&budget)
+
+	if result.Error != nil {
+		log.Error("Error fetching budget: ", result.Error)
+		return types.Budget{}
+	}
+	return budget
+}
+
+// budgetPeriodsValues returns the periods as a VALUES list aliased as p with
+// the columns position, budget_id, period_start and period_end, and its arguments.
+func budgetPeriodsValues(periods []types.BudgetPeriodRange) (string, []interface{}) {
+	values := make([]string, 0, len(periods))
+	args := make([]interface{}, 0, len(periods)*4)
+	for i, period := range periods {
+		values = append(values, "(?::int, ?::uuid, ?::timestamptz, ?::timestamptz)")
+		args = append(args, i, period.BudgetID, period.Start, period.End)
+	}
+	return "(VALUES " + strings.Join(values, ", ") + ") AS p(position, budget_id, period_start, period_end)", args
+}
+
+// GetBudgetsSpent returns the total of the expenses counted against the
+// budget of each period, in the order of the periods, in a single grouped
+// query. The limits being in the base currency of the owner of the budget,
+// the expenses are converted to it at the rate of their day.
+func (s *service) GetBudgetsSpent(periods []types.BudgetPeriodRange) ([]types.Money, error) {
+	spent := make([]types.Money, len(periods))
+	if len(periods) == 0 {
+		return spent, nil
+	}
+
+	values, args := budgetPeriodsValues(periods)
+	var rows []struct {
+		Position int
+		Spent    types.Money
+	}
+	currency := s.userBaseCurrencySQL("b.user_id")
+	amount := convertedSQL("t.amount", "a.currency", currency, fmt.Sprintf(utcDaySQL, "t.date"), types.CurrencyDigitsSQL(currency))
+	result := s.db.Raw(`
+		SELECT p.position, COALESCE(SUM(`+amount+`), 0) AS spent
+		FROM `+values+`
+		JOIN budgets b ON b.id = p.budget_id
+		LEFT JOIN transactions t ON t.budget_id = p.budget_id AND t.type = 'expense' AND NOT t.exclude_from_budgets
+			AND t.date >= p.period_start AND t.date < p.period_end
+		LEFT JOIN bank_accounts a ON a.id = t.bank_account_id
+		GROUP BY p.position`, args...).Scan(&rows)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	for _, row := range rows {
+		spent[row.Position] = row.Spent
+	}
+	return spent, nil
+}
+
+// GetBudgetTransactions returns the transactions counted against the budget
+// dated in [from, to).
+func (s *service) GetBudgetTransactions(budget *types.Budget, from, to time.Time, filter types.TransactionFilter) []types.Transaction {
+	var transactions []types.Transaction
+	query := s.db.Where("budget_id = ? AND date >= ? AND date < ?", budget.ID, from, to)
+	result := paginateTransactions(filterTransactions(query, filter), filter).Find(&transactions)
+
+	if result.Error != nil {
+		log.Error("Error fetching budget transactions: ", result.Error)
+		return nil
+	}
+
+	if filter.WithBalance {
+		if err := s.setRunningBalances(transactions); err != nil {
+			log.Error("Error computing running balances: ", err)
+			return nil
+		}
+	}
+	return transactions
+}
+
+// GetBudgetAlerts returns the thresholds of the budget already notified for
+// the period starting at periodStart.
+func (s *service) GetBudgetAlerts(budgetID uuid.UUID, periodStart time.Time) []int {
+	var thresholds []int
+	result := s.db.Model(&types.BudgetAlert{}).
+		Where("budget_id = ? AND period_start = ?", budgetID, periodStart).
+		Pluck("threshold", &thresholds)
+
+	if result.Error != nil {
+		log.Error("Error fetching budget alerts: ", result.Error)
+		return nil
+	}
+	return thresholds
+}
+
+// CreateBudgetAlert records a notified threshold. It returns false when the
+// threshold was already recorded for the period, so concurrent changes
+// notify it only once.
+func (s *service) CreateBudgetAlert(alert *types.BudgetAlert) (bool, error) {
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(alert)
+	return result.RowsAffected == 1, result.Error
+}
+
+// DeleteBudgetAlerts forgets notified thresholds so they can be notified
+// again in the same period.
+func (s *service) DeleteBudgetAlerts(budgetID uuid.UUID, periodStart time.Time, thresholds []int) error {
+	if len(thresholds) == 0 {
+		return nil
+	}
+	return s.db.Where("budget_id = ? AND period_start = ? AND threshold IN ?", budgetID, periodStart, thresholds).
+		Delete(&types.BudgetAlert{}).Error
+}
@@ -0,0 +1,129 @@
+package database
+
+import (
+	"FinMa/types"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCustomBudgetEndsAtMidnightInTheOwnerTimezone(t *testing.T) {
+	s := New(testConfig).(*service)
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Fatalf("could not load the timezone: %v", err)
+	}
+
+	user := types.User{ID: uuid.New(), Email: uuid.NewString() + "@example.com", Role: "user", Timezone: "Europe/Paris"}
+	if err := s.db.Create(&user).Error; err != nil {
+		t.Fatalf("could not create user: %v", err)
+	}
+	account := types.BankAccount{ID: uuid.New(), AccountNumber: uuid.NewString(), UserID: user.ID}
+	if err := s.CreateBankAccount(&account); err != nil {
+		t.Fatalf("could not create account: %v", err)
+	}
+
+	create := func(date time.Time) types.Transaction {
+		transaction := types.Transaction{ID: uuid.New(), Amount: money(10), Type: "expense", Category: "food", Date: date, BankAccountID: account.ID, UserID: user.ID}
+		if err := s.CreateTransaction(&transaction); err != nil {
+			t.Fatalf("could not create transaction: %v", err)
+		}
+		return transaction
+	}
+
+	// The clocks go forward on March 31, 2024 in Paris, the day lasts 23
+	// hours: it ends at 22:00 UTC, not at midnight UTC
+	lastEvening := time.Date(2024, time.March, 31, 23, 30, 0, 0, paris)
+	nextMorning := time.Date(2024, time.April, 1, 0, 30, 0, 0, paris)
+	before := []types.Transaction{create(lastEvening), create(nextMorning)}
+
+	budget := types.Budget{
+		ID:         uuid.New(),
+		Name:       "March",
+		Amount:     money(100),
+		PeriodType: "custom",
+		StartDate:  time.Date(2024, time.March, 1, 0, 0, 0, 0, paris),
+		EndDate:    time.Date(2024, time.March, 31, 0, 0, 0, 0, paris),
+		UserID:     user.ID,
+		Categories: []types.BudgetCategory{{Category: "food"}},
+	}
+	if err := s.CreateBudget(&budget); err != nil {
+		t.Fatalf("could not create budget: %v", err)
+	}
+	after := []types.Transaction{create(lastEvening), create(nextMorning)}
+
+	for name, transactions := range map[string][]types.Transaction{"attributed": before, "created": after} {
+		inside := s.GetTransactionByID(transactions[0].ID.String())
+		if inside.BudgetID == nil || *inside.BudgetID != budget.ID {
+			t.Errorf("%s: expected the expense of the last evening counted against the budget; got %v", name, inside.BudgetID)
+		}
+		outside := s.GetTransactionByID(transactions[1].ID.String())
+		if outside.BudgetID != nil {
+			t.Errorf("%s: expected the expense of the next morning outside the budget; got %v", name, outside.BudgetID)
+		}
+	}
+}
+
+func TestUpdateDetectsLostUpdates(t *testing.T) {
+	s := New(testConfig).(*service)
+
+	user := types.User{ID: uuid.New(), Email: uuid.NewString() + "@example.com", Role: "user"}
+	if err := s.db.Create(&user).Error; err != nil {
+		t.Fatalf("could not create user: %v", err)
+	}
+	account := types.BankAccount{ID: uuid.New(), AccountNumber: uuid.NewString(), UserID: user.ID}
+	if err := s.CreateBankAccount(&account); err != nil {
+		t.Fatalf("could not create account: %v", err)
+	}
+	transaction := types.Transaction{ID: uuid.New(), Amount: money(10), Type: "expense", Category: "food", Date: time.Now(), BankAccountID: account.ID, UserID: user.ID}
+	if err := s.CreateTransaction(&transaction); err != nil {
+		t.Fatalf("could not create transaction: %v", err)
+	}
+	if transaction.Version != 1 {
+		t.Fatalf("expected a new transaction at version 1; got %d", transaction.Version)
+	}
+
+	// Two clients read the transaction, the second one to write loses
+	first, second := s.GetTransactionByID(transaction.ID.String()), s.GetTransactionByID(transaction.ID.String())
+	first.Description = "Groceries"
+	if err := s.UpdateTransaction(&first); err != nil || first.Version != 2 {
+		t.Fatalf("expected the first update applied; got version %d, %v", first.Version, err)
+	}
+	second.Description = "Restaurant"
+	if err := s.UpdateTransaction(&second); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("expected the second update refused; got %v", err)
+	}
+	if stored := s.GetTransactionByID(transaction.ID.String()); stored.Description != "Groceries" || stored.Version != 2 {
+		t.Errorf("expected the first update kept; got %q at version %d", stored.Description, stored.Version)
+	}
+
+	// The other writes of the transaction bump its version too
+	read := s.GetTransactionByID(transaction.ID.String())
+	if err := s.UnreconcileTransaction(&first); err != nil || first.Version != 3 {
+		t.Fatalf("expected the unreconcile to bump the version; got version %d, %v", first.Version, err)
+	}
+	read.Description = "Restaurant"
+	if err := s.UpdateTransaction(&read); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("expected an update read before the unreconcile refused; got %v", err)
+	}
+
+	budget := types.Budget{ID: uuid.New(), Name: "Food", Amount: money(100), PeriodType: "monthly", StartDate: time.Now(), UserID: user.ID,
+		Categories: []types.BudgetCategory{{Category: "food"}}}
+	if err := s.CreateBudget(&budget); err != nil {
+		t.Fatalf("could not create budget: %v", err)
+	}
+	firstBudget, secondBudget := s.GetBudgetByID(budget.ID.String()), s.GetBudgetByID(budget.ID.String())
+	firstBudget.Amount = money(200)
+	if err := s.UpdateBudget(&firstBudget); err != nil || firstBudget.Version != 2 {
+		t.Fatalf("expected the first update applied; got version %d, %v", firstBudget.Version, err)
+	}
+	secondBudget.Amount = money(300)
+	if err := s.UpdateBudget(&secondBudget); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("expected the second update refused; got %v", err)
+	}
+	if stored := s.GetBudgetByID(budget.ID.String()); stored.Amount != money(200) || stored.Version != 2 {
+		t.Errorf("expected the first update kept; got %v at version %d", stored.Amount, stored.Version)
+	}
+}
@@ -0,0 +1,45 @@
+package database
+
+import (
+	"FinMa/types"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+	"gorm.io/gorm/clause"
+)
+
+func (s *service) GetCategorySettings(userID uuid.UUID) []types.CategorySetting {
+	var settings []types.CategorySetting
+	result := s.db.Where("user_id = ?", userID).Order("category").Find(&settings)
+
+	if result.Error != nil {
+		log.Error("Error fetching category settings: ", result.Error)
+		return nil
+	}
+	return settings
+}
+
+// IsCategoryExcludedByDefault reports whether the new transactions of the
+// category are excluded from the budgets of the user.
+func (s *service) IsCategoryExcludedByDefault(userID uuid.UUID, category string) bool {
+	var count int64
+	s.db.Model(&types.CategorySetting{}).
+		Where("user_id = ? AND category = ? AND exclude_by_default", userID, category).
+		Count(&count)
+	return count > 0
+}
+
+// SaveCategorySetting creates the setting or replaces the existing one of
+// the same user and category, then reloads it with its stored ID. The
+// essential flag changes the health metrics, the change is notified.
+func (s *service) SaveCategorySetting(setting *types.CategorySetting) error {
+	err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "category"}},
+		DoUpdates: clause.AssignmentColumns([]string{"exclude_by_default", "essential", "updated_at"}),
+	}).Omit("User").Create(setting).Error
+	if err != nil {
+		return err
+	}
+	err = s.db.Where("user_id = ? AND category = ?", setting.UserID, setting.Category).First(setting).Error
+	return s.changed(err, dataChange{userIDs: []uuid.UUID{setting.UserID}})
+}
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"FinMa/types"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// changeToken summarizes the rows selected by the query as their count and
+// their latest update. A created or updated row moves the latest update and
+// a deleted one lowers the count: the latest update alone would miss the
+// deletions, and the count alone the updates.
+func changeToken(query *gorm.DB) (string, error) {
+	var row struct {
+		Count      int64
+		LastUpdate *time.Time
+	}
+	if err := query.Select("COUNT(*) AS count, MAX(updated_at) AS last_update").Scan(&row).Error; err != nil {
+		return "", err
+	}
+
+	token := strconv.FormatInt(row.Count, 10)
+	if row.LastUpdate != nil {
+		token += "." + strconv.FormatInt(row.LastUpdate.UnixMicro(), 36)
+	}
+	return token, nil
+}
+
+// joinChangeTokens computes the token of each query, in order, and joins them.
+func joinChangeTokens(queries ...*gorm.DB) (string, error) {
+	tokens := make([]string, 0, len(queries))
+	for _, query := range queries {
+		token, err := changeToken(query)
+		if err != nil {
+			return "", err
+		}
+		tokens = append(tokens, token)
+	}
+	return strings.Join(tokens, "-"), nil
+}
+
+// TransactionsChangeToken returns a token that changes whenever the
+// transactions GetTransactions lists with the filter change, without
+// loading them. The pagination is left out, the callers key the token with
+// it. The running balances depend on every transaction of the accounts and
+// on their initial balance, the token then covers them all.
+func (s *service) TransactionsChangeToken(user *types.User, filter types.TransactionFilter) (string, error) {
+	if !filter.WithBalance {
+		return changeToken(s.userTransactionsQuery(user, filter))
+	}
+
+	scope := types.TransactionFilter{AccountID: filter.AccountID, ExcludeShared: filter.ExcludeShared}
+	return joinChangeTokens(
+		s.userTransactionsQuery(user, scope),
+		s.db.Model(&types.BankAccount{}).Where("id IN (?)", s.accessibleAccountsQuery(user, filter.ExcludeShared)),
+	)
+}
+
+// BankAccountsChangeToken returns a token that changes whenever an account
+// the user can access changes, archived ones included. The balances are
+// updated with the account, so they are covered too.
+func (s *service) BankAccountsChangeToken(user *types.User) (string, error) {
+	return changeToken(s.db.Model(&types.BankAccount{}).Where("id IN (?)", s.accessibleAccountsQuery(user, false)))
+}
+
+// CategorySettingsChangeToken returns a token that changes whenever the
+// user changes the settings of a category.
+func (s *service) CategorySettingsChangeToken(userID uuid.UUID) (string, error) {
+	return changeToken(s.db.Model(&types.CategorySetting{}).Where("user_id = ?", userID))
+}
+
+// DashboardChangeToken returns a token that changes whenever the data of the
+// dashboard changes: the transactions, the accounts, the budgets, the
+// category settings and the notifications of the user. The dashboard also
+// depends on the current date, which the callers add.
+func (s *service) DashboardChangeToken(user *types.User) (string, error) {
+	return joinChangeTokens(
+		s.userTransactionsQuery(user, types.TransactionFilter{}),
+		s.db.Model(&types.BankAccount{}).Where("id IN (?)", s.accessibleAccountsQuery(user, false)),
+		s.db.Model(&types.Budget{}).Where("user_id = ? OR household_id IN (?)", user.ID, s.visibleHouseholdsQuery(user)),
+		s.db.Model(&types.CategorySetting{}).Where("user_id = ?", user.ID),
+		s.db.Model(&types.Notification{}).Where("user_id = ?", user.ID),
+	)
+}
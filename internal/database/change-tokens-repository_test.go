@@ -0,0 +1,60 @@
+package database
+
+import (
+	"FinMa/types"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestTransactionsChangeTokenFollowsDeletes(t *testing.T) {
+	s := New(testConfig).(*service)
+
+	user := types.User{ID: uuid.New(), Email: uuid.NewString() + "@example.com", Role: "user"}
+	if err := s.db.Create(&user).Error; err != nil {
+		t.Fatalf("could not create user: %v", err)
+	}
+
+	account := types.BankAccount{ID: uuid.New(), AccountNumber: uuid.NewString(), UserID: user.ID}
+	if err := s.CreateBankAccount(&account); err != nil {
+		t.Fatalf("could not create account: %v", err)
+	}
+
+	create := func() types.Transaction {
+		transaction := types.Transaction{ID: uuid.New(), Amount: money(10), Type: "expense", Date: time.Now(), BankAccountID: account.ID, UserID: user.ID}
+		if err := s.CreateTransaction(&transaction); err != nil {
+			t.Fatalf("could not create transaction: %v", err)
+		}
+		return transaction
+	}
+	token := func() string {
+		token, err := s.TransactionsChangeToken(&user, types.TransactionFilter{})
+		if err != nil {
+			t.Fatalf("could not compute the change token: %v", err)
+		}
+		return token
+	}
+
+	first := create()
+	create()
+	before := token()
+	if again := token(); again != before {
+		t.Errorf("expected the token to be stable; got %s then %s", before, again)
+	}
+
+	// The oldest transaction is deleted: the count changes, not the latest update
+	if err := s.DeleteTransaction(&first); err != nil {
+		t.Fatalf("could not delete transaction: %v", err)
+	}
+	afterDelete := token()
+	if afterDelete == before {
+		t.Errorf("expected the token to change on a deletion")
+	}
+
+	// Back to the same count, the latest update moved
+	create()
+	if afterCreate := token(); afterCreate == before || afterCreate == afterDelete {
+		t.Errorf("expected the token to change on a creation; got %s", afterCreate)
+	}
+}
@@ -0,0 +1,192 @@
+package database
+
+import (
+	"FinMa/types"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// fxRateFunctionSQL creates fx_rate(base, quote, day), how much 1 base is
+// worth in quote on the day with the stored rates: the last one stored on
+// or before the day, else the first one after it. The conversions never
+// fail: the days the server could not fetch use the closest rate, and a
+// pair without any stored rate is converted at 1. The same currency, or an
+// unknown one, is 1 without reading the rates.
+const fxRateFunctionSQL = `
+	CREATE OR REPLACE FUNCTION fx_rate(base text, quote text, day date) RETURNS numeric
+	LANGUAGE sql STABLE AS $$
+		SELECT CASE WHEN $1 IS NULL OR $1 = '' OR $1 = $2 THEN 1 ELSE COALESCE(
+			(SELECT r.rate FROM exchange_rates r WHERE r.base = $1 AND r.quote = $2 AND r.date <= $3 ORDER BY r.date DESC LIMIT 1),
+			(SELECT r.rate FROM exchange_rates r WHERE r.base = $1 AND r.quote = $2 AND r.date > $3 ORDER BY r.date LIMIT 1),
+			1
+		) END
+	$$`
+
+// utcDaySQL is the UTC day of the date of a transaction, the day of its rate.
+const utcDaySQL = "(%s AT TIME ZONE 'UTC')::date"
+
+// utcTodaySQL is the current UTC day, the day of the rates of the balances.
+const utcTodaySQL = "(now() AT TIME ZONE 'UTC')::date"
+
+// migrateExchangeRateFunction creates or replaces fx_rate.
+func (s *service) migrateExchangeRateFunction() error {
+	return s.db.Exec(fxRateFunctionSQL).Error
+}
+
+// unboundMoneyColumns are the amounts that are not tied to an account, in
+// the base currency of their user or percentages for the steps of the
+// allocation rules.
+var unboundMoneyColumns = []struct{ table, column string }{
+	{"budgets", "amount"},
+	{"closed_budget_periods", "base_limit"},
+	{"closed_budget_periods", "effective_limit"},
+	{"closed_budget_periods", "spent"},
+	{"budget_template_items", "amount"},
+	{"goals", "target_amount"},
+	{"goal_contributions", "amount"},
+	{"bills", "amount"},
+	{"subscriptions", "amount"},
+	{"allocations", "amount"},
+	{"allocation_rules", "min_amount"},
+	{"allocation_rule_steps", "value"},
+}
+
+// migrateMoneyAmounts rounds the amounts stored before they were decimal
+// to the minor unit of the currency of their account, 2 decimals for the
+// accounts without a currency yet, so that they are read exactly. The
+// amounts without an account keep the 4 decimals of an amount without a
+// currency.
+func (s *service) migrateMoneyAmounts() error {
+	digits := types.CurrencyDigitsSQL("a.currency")
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for _, column := range []string{"balance", "initial_balance", "credit_limit", "low_balance_threshold"} {
+			if err := tx.Exec(fmt.Sprintf(`
+				UPDATE bank_accounts a SET %[1]s = ROUND(a.%[1]s, %[2]s)
+				WHERE a.%[1]s <> ROUND(a.%[1]s, %[2]s)`, column, digits)).Error; err != nil {
+				return err
+			}
+		}
+		for _, table := range []struct{ name, column string }{
+			{"transactions", "amount"},
+			{"balance_snapshots", "balance"},
+			{"reconciliations", "statement_balance"},
+		} {
+			if err := tx.Exec(fmt.Sprintf(`
+				UPDATE %[1]s r SET %[2]s = ROUND(r.%[2]s, %[3]s)
+				FROM bank_accounts a
+				WHERE a.id = r.bank_account_id AND r.%[2]s <> ROUND(r.%[2]s, %[3]s)`, table.name, table.column, digits)).Error; err != nil {
+				return err
+			}
+		}
+		for _, money := range unboundMoneyColumns {
+			if err := tx.Exec(fmt.Sprintf(`
+				UPDATE %[1]s SET %[2]s = ROUND(%[2]s, %[3]d)
+				WHERE %[2]s <> ROUND(%[2]s, %[3]d)`, money.table, money.column, types.CurrencyDigits(""))).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SetDefaultCurrency sets the currency of the instance: the base currency
+// of the users without one, and the currency of the accounts created
+// before the accounts had one, which are updated.
+func (s *service) SetDefaultCurrency(currency string) error {
+	s.currency = currency
+	return s.db.Model(&types.BankAccount{}).
+		Where("currency IS NULL OR currency = ''").
+		Update("currency", currency).Error
+}
+
+// baseCurrency returns the currency the reports of the user are converted
+// to.
+func (s *service) baseCurrency(user *types.User) string {
+	if user.BaseCurrency != "" {
+		return user.BaseCurrency
+	}
+	return s.currency
+}
+
+// userBaseCurrencySQL returns the SQL of the base currency of the user of
+// the ID column.
+func (s *service) userBaseCurrencySQL(column string) string {
+	// The default is an ISO 4217 code checked by the configuration
+	return fmt.Sprintf("(SELECT COALESCE(NULLIF(u.base_currency, ''), '%s') FROM users u WHERE u.id = %s)", s.currency, column)
+}
+
+// transactionColumns returns the columns of the transactions, in the order
+// of the fields of the model.
+var transactionColumns = sync.OnceValue(func() []string {
+	transaction, err := schema.Parse(&types.Transaction{}, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		panic(err)
+	}
+	return transaction.DBNames
+})
+
+// convertedSQL is the SQL of the amount converted from the currency to the
+// quote at the rate of the day, rounded to the digits of the minor unit of
+// the quote: the converted amounts are exact money, and so are their sums.
+func convertedSQL(amount, currency, quote, day, digits string) string {
+	return fmt.Sprintf("ROUND(%s * fx_rate(%s, %s, %s), %s)", amount, currency, quote, day, digits)
+}
+
+// convertedTransactions selects from db the transactions as a transactions
+// table whose amounts are converted from the currency of their account to
+// currency, at the rate of their UTC day. The aggregations read it in place
+// of the table: the stored amounts are never rewritten.
+func (s *service) convertedTransactions(db *gorm.DB, currency string) *gorm.DB {
+	columns := make([]string, 0, len(transactionColumns()))
+	for _, name := range transactionColumns() {
+		if name == "amount" {
+			digits := strconv.Itoa(types.CurrencyDigits(currency))
+			columns = append(columns, convertedSQL("t.amount", "a.currency", "?", fmt.Sprintf(utcDaySQL, "t.date"), digits)+" AS amount")
+			continue
+		}
+		columns = append(columns, "t."+name)
+	}
+	converted := db.Raw("SELECT "+strings.Join(columns, ", ")+
+		" FROM transactions t LEFT JOIN bank_accounts a ON a.id = t.bank_account_id", currency)
+	return db.Table("(?) AS transactions", converted)
+}
+
+// GetMissingExchangeRates returns up to limit currencies and UTC days the
+// reports of the user lack a stored rate to currency for, the oldest days
+// first: the days of the transactions of the accounts in another currency,
+// and today for the balance of the accounts in another currency without a
+// rate stored in the last week.
+func (s *service) GetMissingExchangeRates(user *types.User, currency string, limit int) ([]types.MissingExchangeRate, error) {
+	missing := []types.MissingExchangeRate{}
+	day := fmt.Sprintf(utcDaySQL, "t.date")
+	result := s.db.Raw(`
+		SELECT currency, day FROM (
+			SELECT a.currency, `+day+` AS day
+			FROM transactions t JOIN bank_accounts a ON a.id = t.bank_account_id
+			WHERE t.user_id = @user AND a.currency <> '' AND a.currency <> @currency
+			AND NOT EXISTS (
+				SELECT 1 FROM exchange_rates r WHERE r.base = a.currency AND r.quote = @currency AND r.date = `+day+`
+			)
+			UNION
+			SELECT a.currency, `+utcTodaySQL+` AS day
+			FROM bank_accounts a
+			WHERE a.id IN (@accounts) AND a.archived_at IS NULL AND a.currency <> '' AND a.currency <> @currency
+			AND NOT EXISTS (
+				SELECT 1 FROM exchange_rates r WHERE r.base = a.currency AND r.quote = @currency AND r.date > `+utcTodaySQL+` - 7
+			)
+		) missing
+		ORDER BY day, currency
+		LIMIT @limit`,
+		map[string]interface{}{
+			"user":     user.ID,
+			"currency": currency,
+			"accounts": s.accessibleAccountsQuery(user, false),
+			"limit":    limit,
+		}).Scan(&missing)
+	return missing, result.Error
+}
@@ -0,0 +1,150 @@
+package database
+
+import (
+	"FinMa/types"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestReportsAreConvertedToTheBaseCurrency(t *testing.T) {
+	s := New(testConfig).(*service)
+	if err := s.SetDefaultCurrency("EUR"); err != nil {
+		t.Fatalf("could not set the currency: %v", err)
+	}
+
+	user := types.User{ID: uuid.New(), Email: uuid.NewString() + "@example.com", Role: "user"}
+	if err := s.db.Create(&user).Error; err != nil {
+		t.Fatalf("could not create user: %v", err)
+	}
+	euros := types.BankAccount{ID: uuid.New(), AccountNumber: uuid.NewString(), Currency: "EUR", InitialBalance: money(1000), Balance: money(1000), UserID: user.ID}
+	dollars := types.BankAccount{ID: uuid.New(), AccountNumber: uuid.NewString(), Currency: "USD", UserID: user.ID}
+	for _, account := range []*types.BankAccount{&euros, &dollars} {
+		if err := s.CreateBankAccount(account); err != nil {
+			t.Fatalf("could not create account: %v", err)
+		}
+	}
+
+	// 1 USD is 0.9 EUR on Friday, 0.8 EUR from Monday on
+	friday := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	monday := time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)
+	for day, rate := range map[time.Time]float64{friday: 0.9, monday: 0.8} {
+		if err := s.SaveExchangeRate(&types.ExchangeRate{ID: uuid.New(), Base: "USD", Quote: "EUR", Date: day, RateDate: day, Rate: rate, Source: "test"}); err != nil {
+			t.Fatalf("could not store the rate: %v", err)
+		}
+	}
+
+	budget := types.Budget{
+		ID:         uuid.New(),
+		Name:       "Groceries",
+		Amount:     money(300),
+		PeriodType: "monthly",
+		StartDate:  friday,
+		UserID:     user.ID,
+		Categories: []types.BudgetCategory{{Category: "groceries"}},
+	}
+	if err := s.CreateBudget(&budget); err != nil {
+		t.Fatalf("could not create budget: %v", err)
+	}
+
+	for _, transaction := range []types.Transaction{
+		{Amount: money(100), Type: "expense", Category: "groceries", Date: friday.Add(10 * time.Hour), BankAccountID: euros.ID},
+		{Amount: money(50), Type: "expense", Category: "groceries", Date: friday.Add(12 * time.Hour), BankAccountID: dollars.ID},
+		// No rate on Saturday, the one of Friday is used
+		{Amount: money(200), Type: "income", Category: "salary", Date: friday.AddDate(0, 0, 1), BankAccountID: dollars.ID},
+		{Amount: money(100), Type: "expense", Category: "groceries", Date: monday.Add(9 * time.Hour), BankAccountID: dollars.ID},
+	} {
+		transaction.ID = uuid.New()
+		transaction.UserID = user.ID
+		if err := s.CreateTransaction(&transaction); err != nil {
+			t.Fatalf("could not create transaction: %v", err)
+		}
+	}
+
+	from, to := friday, friday.AddDate(0, 1, 0)
+	income, expenses, err := s.GetIncomeAndExpenses(&user, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 200 × 0.9 = 180, 100 + 50 × 0.9 + 100 × 0.8 = 225
+	if income != money(180) || expenses != money(225) {
+		t.Errorf("expected 180 of income and 225 of expenses in EUR; got %v and %v", income, expenses)
+	}
+
+	spent, err := s.GetBudgetsSpent([]types.BudgetPeriodRange{{BudgetID: budget.ID, Start: from, End: to}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spent[0] != money(225) {
+		t.Errorf("expected 225 spent in EUR; got %v", spent[0])
+	}
+
+	// 900 EUR and 200 - 150 = 50 USD at the rate of today, the last one
+	balances, err := s.GetTotalBalance(&user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balances.Total != money(940) {
+		t.Errorf("expected a total balance of 940 EUR; got %v", balances.Total)
+	}
+
+	// The stored amounts are kept in the currency of their account
+	user.BaseCurrency = "USD"
+	if err := s.UpdateUserBaseCurrency(&user); err != nil {
+		t.Fatal(err)
+	}
+	income, _, err = s.GetIncomeAndExpenses(&user, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if income != money(200) {
+		t.Errorf("expected the income of the USD account as stored; got %v", income)
+	}
+
+	missing, err := s.GetMissingExchangeRates(&user, "USD", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The EUR expense of Friday, and the EUR balance of today
+	if len(missing) != 2 || missing[0].Currency != "EUR" || !missing[0].Day.Equal(friday) {
+		t.Errorf("expected the rates of EUR to USD missing; got %+v", missing)
+	}
+}
+
+func TestMigrateMoneyAmountsRoundsToTheMinorUnit(t *testing.T) {
+	s := New(testConfig).(*service)
+
+	user := types.User{ID: uuid.New(), Email: uuid.NewString() + "@example.com", Role: "user"}
+	if err := s.db.Create(&user).Error; err != nil {
+		t.Fatalf("could not create user: %v", err)
+	}
+	yens := types.BankAccount{ID: uuid.New(), AccountNumber: uuid.NewString(), Currency: "JPY", UserID: user.ID}
+	euros := types.BankAccount{ID: uuid.New(), AccountNumber: uuid.NewString(), Currency: "EUR", UserID: user.ID}
+	for _, account := range []*types.BankAccount{&yens, &euros} {
+		if err := s.CreateBankAccount(account); err != nil {
+			t.Fatalf("could not create account: %v", err)
+		}
+	}
+
+	// Amounts stored as floats before the migration
+	if err := s.db.Exec("UPDATE bank_accounts SET balance = 1500.4 WHERE id = ?", yens.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := s.db.Exec("UPDATE bank_accounts SET balance = 0.30000000000000004 WHERE id = ?", euros.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := s.migrateMoneyAmounts(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		account  types.BankAccount
+		expected string
+	}{{yens, "1500.00"}, {euros, "0.30"}} {
+		account := s.GetBankAccountByID(tt.account.ID.String())
+		if account.Balance.String() != tt.expected {
+			t.Errorf("%s: expected %s; got %s", tt.account.Currency, tt.expected, account.Balance)
+		}
+	}
+}
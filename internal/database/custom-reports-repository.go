@@ -0,0 +1,144 @@
+package database
+
+import (
+	"FinMa/types"
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// customReportTimeout bounds the run of a custom report in the database.
+const customReportTimeout = 5 * time.Second
+
+// customReportMetrics are the SQL of the metrics of the custom reports.
+var customReportMetrics = map[string]string{
+	"sum":   "SUM(amount)",
+	"count": "COUNT(*)",
+	"avg":   "AVG(amount)",
+}
+
+// customReportGroups are the SQL of the groups of the custom reports. The
+// month takes the timezone as its argument.
+var customReportGroups = map[string]string{
+	"category": "category",
+	"merchant": merchantSQL,
+	"account":  "bank_account_id::text",
+	"month":    "to_char(date AT TIME ZONE ?, 'YYYY-MM')",
+	"type":     "type",
+}
+
+func (s *service) CreateReportDefinition(definition *types.ReportDefinition) error {
+	return s.db.Omit("User").Create(definition).Error
+}
+
+func (s *service) GetReportDefinitions(userID uuid.UUID) []types.ReportDefinition {
+	var definitions []types.ReportDefinition
+	result := s.db.Where("user_id = ?", userID).Order("name").Find(&definitions)
+
+	if result.Error != nil {
+		log.Error("Error fetching report definitions: ", result.Error)
+		return nil
+	}
+	return definitions
+}
+
+func (s *service) GetReportDefinitionByID(id string) types.ReportDefinition {
+	var definition types.ReportDefinition
+	result := s.db.Where("id = ?", id).First(&definition)
+
+	if result.Error != nil {
+		log.Error("Error fetching report definition: ", result.Error)
+		return types.ReportDefinition{}
+	}
+	return definition
+}
+
+func (s *service) UpdateReportDefinition(definition *types.ReportDefinition) error {
+	return s.db.Omit("User").Save(definition).Error
+}
+
+// DeleteReportDefinition deletes the custom report and its schedules.
+func (s *service) DeleteReportDefinition(definition *types.ReportDefinition) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("report_definition_id = ?", definition.ID).Delete(&types.ReportSchedule{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(definition).Error
+	})
+}
+
+// RunCustomReport computes the metric of the transactions of the user
+// matching the filters of the spec, dated in [from, to), by group, in the
+// given timezone and in their base currency: the limit groups with the
+// largest values, or the first months, and whether there were more. The SQL
+// is only built from the fixed metrics and groups, the values of the
+// filters are arguments. The query is canceled past customReportTimeout.
+func (s *service) RunCustomReport(user *types.User, spec types.CustomReportSpec, from, to time.Time, timezone string, limit int) ([]types.CustomReportRow, bool, error) {
+	metric, ok := customReportMetrics[spec.Metric]
+	if !ok {
+		return nil, false, fmt.Errorf("unknown custom report metric %q", spec.Metric)
+	}
+	group, ok := customReportGroups[spec.GroupBy]
+	if !ok {
+		return nil, false, fmt.Errorf("unknown custom report group %q", spec.GroupBy)
+	}
+	currency := s.baseCurrency(user)
+	if spec.Metric == "avg" {
+		// The average of the converted amounts, rounded to exact money
+		metric = fmt.Sprintf("ROUND(%s, %d)", metric, types.CurrencyDigits(currency))
+	}
+	var groupArgs []interface{}
+	if spec.GroupBy == "month" {
+		groupArgs = append(groupArgs, timezone)
+	}
+	transactionTypes := spec.Types
+	if len(transactionTypes) == 0 {
+		transactionTypes = []string{"expense"}
+	}
+
+	rows := []types.CustomReportRow{}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(fmt.Sprintf("SET LOCAL statement_timeout = %d", customReportTimeout.Milliseconds())).Error; err != nil {
+			return err
+		}
+
+		query := s.convertedTransactions(tx, currency).
+			Select(`COALESCE(`+group+`, '') AS "group", COALESCE(`+metric+`, 0) AS value, COUNT(*) AS count`, groupArgs...).
+			Where("user_id = ? AND type IN ? AND date >= ? AND date < ?", user.ID, transactionTypes, from, to)
+		if !spec.IncludeExcluded {
+			query = query.Where("NOT exclude_from_budgets")
+		}
+		if len(spec.Categories) > 0 {
+			query = query.Where("category IN ?", spec.Categories)
+		}
+		if len(spec.AccountIDs) > 0 {
+			query = query.Where("bank_account_id IN ?", spec.AccountIDs)
+		}
+		if spec.Search != "" {
+			query = query.Where("strpos(lower(description), lower(?)) > 0", spec.Search)
+		}
+		if spec.MinAmount != nil {
+			query = query.Where("amount >= ?", *spec.MinAmount)
+		}
+		if spec.MaxAmount != nil {
+			query = query.Where("amount <= ?", *spec.MaxAmount)
+		}
+
+		order := "2 DESC, 1"
+		if spec.GroupBy == "month" {
+			order = "1"
+		}
+		return query.Group("1").Order(order).Limit(limit + 1).Scan(&rows).Error
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(rows) > limit {
+		return rows[:limit], true, nil
+	}
+	return rows, false, nil
+}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"FinMa/types"
+	"strconv"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+)
+
+// GetTotalBalance sums the balances of the accounts the user can access,
+// archived accounts left out, in a single query. The balances are converted
+// to the base currency of the user at the rate of today.
+func (s *service) GetTotalBalance(user *types.User) (types.DashboardBalances, error) {
+	var balances types.DashboardBalances
+	currency := s.baseCurrency(user)
+	balance := convertedSQL("balance", "currency", "?", utcTodaySQL, strconv.Itoa(types.CurrencyDigits(currency)))
+	result := s.db.Model(&types.BankAccount{}).
+		Select("COALESCE(SUM("+balance+"), 0) AS total, COUNT(*) AS accounts", currency).
+		Where("id IN (?) AND archived_at IS NULL", s.accessibleAccountsQuery(user, false)).
+		Scan(&balances)
+
+	return balances, result.Error
+}
+
+// GetIncomeAndExpenses sums the income and the expenses of the user dated in
+// [from, to), leaving out the transactions excluded from the budgets.
+func (s *service) GetIncomeAndExpenses(user *types.User, from, to time.Time) (types.Money, types.Money, error) {
+	var totals struct {
+		Income   types.Money
+		Expenses types.Money
+	}
+	result := s.incomeAndExpensesQuery(user, from, to, types.ReportFilter{}).
+		Select(incomeAndExpensesSQL).
+		Scan(&totals)
+
+	return totals.Income, totals.Expenses, result.Error
+}
+
+// GetTopCategories returns the limit categories the user spent the most in
+// between from and to, largest first, in their base currency. Expenses
+// excluded from the budgets are left out.
+func (s *service) GetTopCategories(user *types.User, from, to time.Time, limit int) ([]types.CategoryTotal, error) {
+	categories := []types.CategoryTotal{}
+	result := s.convertedTransactions(s.db, s.baseCurrency(user)).
+		Select("category, SUM(amount) AS total, COUNT(*) AS count").
+		Where("user_id = ? AND type = 'expense' AND NOT exclude_from_budgets AND date >= ? AND date < ?", user.ID, from, to).
+		Group("category").
+		Order("total DESC, category").
+		Limit(limit).
+		Scan(&categories)
+
+	return categories, result.Error
+}
+
+// GetRecurringTransactions returns the recurring income and expenses of the
+// user dated after since, oldest first.
+func (s *service) GetRecurringTransactions(user *types.User, since time.Time) []types.Transaction {
+	var transactions []types.Transaction
+	result := s.db.
+		Where("user_id = ? AND is_recurring AND type IN ('income', 'expense') AND date >= ?", user.ID, since).
+		Order("date").
+		Find(&transactions)
+
+	if result.Error != nil {
+		log.Error("Error fetching recurring transactions: ", result.Error)
+		return nil
+	}
+	return transactions
+}
+
+// CountUnreadNotifications counts the notifications of the user still active.
+func (s *service) CountUnreadNotifications(userID uuid.UUID) (int64, error) {
+	var count int64
+	result := s.db.Model(&types.Notification{}).
+		Where("user_id = ? AND is_active", userID).
+		Count(&count)
+
+	return count, result.Error
+}
@@ -0,0 +1,89 @@
+package database
+
+import (
+	"database/sql"
+	"slices"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+)
+
+// DataChangeHook is called once a change to the transactions, the budgets,
+// the accounts or their sharing, or to the category settings, is committed,
+// with the users who see the changed data.
+type DataChangeHook func(userIDs []uuid.UUID)
+
+// OnDataChange registers a hook called after every committed change to the
+// data the dashboard and the reports are computed from. Hooks must be
+// registered before the server starts.
+func (s *service) OnDataChange(hook DataChangeHook) {
+	s.dataChangeHooks = append(s.dataChangeHooks, hook)
+}
+
+// dataChange names the data a committed change touched.
+type dataChange struct {
+	userIDs     []uuid.UUID // Owners of the data, seen by the members of their household
+	accountIDs  []uuid.UUID // Accounts seen by their owner and members
+	householdID *uuid.UUID  // Household whose members see the change
+}
+
+// changed runs the data change hooks when err is nil, once the change is
+// committed, and returns err.
+func (s *service) changed(err error, change dataChange) error {
+	if err != nil || len(s.dataChangeHooks) == 0 {
+		return err
+	}
+
+	userIDs, queryErr := s.dataAudience(change)
+	if queryErr != nil {
+		// The owners are known, the members are missed
+		log.Error("Error fetching the users seeing a change: ", queryErr)
+	}
+	for _, hook := range s.dataChangeHooks {
+		hook(userIDs)
+	}
+	return nil
+}
+
+// dataAudience returns the users seeing the changed data: its owners and
+// the owners of the accounts, the active members of the accounts, and the
+// active members of the household of any of them.
+func (s *service) dataAudience(change dataChange) ([]uuid.UUID, error) {
+	userIDs := slices.Clone(change.userIDs)
+	if len(change.accountIDs) == 0 && change.householdID == nil && len(change.userIDs) == 0 {
+		return userIDs, nil
+	}
+
+	var members []uuid.UUID
+	err := s.db.Raw(`
+		WITH owners AS (
+			SELECT id AS user_id FROM users WHERE id IN @users
+			UNION SELECT user_id FROM bank_accounts WHERE id IN @accounts
+		)
+		SELECT user_id FROM owners
+		UNION SELECT user_id FROM account_members
+			WHERE bank_account_id IN @accounts AND status = 'active' AND user_id IS NOT NULL
+		UNION SELECT user_id FROM household_members
+			WHERE status = 'active' AND user_id IS NOT NULL AND (household_id = @household OR household_id IN (
+				SELECT household_id FROM household_members WHERE status = 'active' AND user_id IN (SELECT user_id FROM owners)))`,
+		sql.Named("users", nonEmpty(change.userIDs)),
+		sql.Named("accounts", nonEmpty(change.accountIDs)),
+		sql.Named("household", change.householdID),
+	).Scan(&members).Error
+
+	for _, id := range members {
+		if !slices.Contains(userIDs, id) {
+			userIDs = append(userIDs, id)
+		}
+	}
+	return userIDs, err
+}
+
+// nonEmpty returns the IDs, or the nil UUID alone so that "IN" stays valid
+// SQL without matching anything.
+func nonEmpty(ids []uuid.UUID) []uuid.UUID {
+	if len(ids) == 0 {
+		return []uuid.UUID{uuid.Nil}
+	}
+	return ids
+}
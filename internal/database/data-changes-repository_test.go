@@ -0,0 +1,68 @@
+package database
+
+import (
+	"FinMa/types"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestDataChangesReachTheUsersSeeingTheData(t *testing.T) {
+	// A copy, so that the hook stays out of the other tests
+	s := *New(testConfig).(*service)
+	var seen [][]uuid.UUID
+	s.dataChangeHooks = []DataChangeHook{func(userIDs []uuid.UUID) { seen = append(seen, userIDs) }}
+
+	newUser := func() types.User {
+		user := types.User{ID: uuid.New(), Email: uuid.NewString() + "@example.com", Role: "user"}
+		if err := s.db.Create(&user).Error; err != nil {
+			t.Fatalf("could not create user: %v", err)
+		}
+		return user
+	}
+	owner, member, partner, stranger := newUser(), newUser(), newUser(), newUser()
+
+	account := types.BankAccount{ID: uuid.New(), AccountNumber: uuid.NewString(), UserID: owner.ID}
+	if err := s.CreateBankAccount(&account); err != nil {
+		t.Fatalf("could not create account: %v", err)
+	}
+	if err := s.db.Create(&types.AccountMember{ID: uuid.New(), Role: "editor", Status: "active", BankAccountID: account.ID, UserID: &member.ID}).Error; err != nil {
+		t.Fatalf("could not create account member: %v", err)
+	}
+	household := types.Household{ID: uuid.New(), Name: "Home", OwnerID: owner.ID, Members: []types.HouseholdMember{
+		{ID: uuid.New(), Role: "owner", Status: "active", UserID: &owner.ID},
+		{ID: uuid.New(), Role: "member", Status: "active", UserID: &partner.ID},
+	}}
+	if err := s.CreateHousehold(&household); err != nil {
+		t.Fatalf("could not create household: %v", err)
+	}
+
+	// Created by the member of the account
+	seen = nil
+	transaction := types.Transaction{ID: uuid.New(), Amount: money(10), Type: "expense", Category: "food", BankAccountID: account.ID, UserID: member.ID}
+	if err := s.CreateTransaction(&transaction); err != nil {
+		t.Fatalf("could not create transaction: %v", err)
+	}
+	if len(seen) != 1 {
+		t.Fatalf("expected one change; got %d", len(seen))
+	}
+	for _, user := range []types.User{owner, member, partner} {
+		if !slices.Contains(seen[0], user.ID) {
+			t.Errorf("expected the change seen by %s", user.Email)
+		}
+	}
+	if slices.Contains(seen[0], stranger.ID) {
+		t.Errorf("expected the change not seen by a stranger")
+	}
+
+	// The budget of a user without household is theirs alone
+	seen = nil
+	budget := types.Budget{ID: uuid.New(), Name: "Food", Amount: money(100), PeriodType: "monthly", UserID: stranger.ID}
+	if err := s.CreateBudget(&budget); err != nil {
+		t.Fatalf("could not create budget: %v", err)
+	}
+	if len(seen) != 1 || !slices.Equal(seen[0], []uuid.UUID{stranger.ID}) {
+		t.Errorf("expected the change seen by its owner only; got %v", seen)
+	}
+}
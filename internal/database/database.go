@@ -1,10 +1,16 @@
 package database
 
 import (
+	"FinMa/internal/config"
+	"FinMa/internal/logging"
 	"FinMa/types"
+	"FinMa/utils"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"io"
+	stdlog "log"
 	"os"
 	"strconv"
 	"time"
@@ -12,9 +18,9 @@ import (
 	"github.com/charmbracelet/log"
 	"github.com/google/uuid"
 	_ "github.com/jackc/pgx/v5/stdlib"
-	_ "github.com/joho/godotenv/autoload"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 )
 
 // Service represents a service that interacts with a database.
@@ -23,37 +29,419 @@ type Service interface {
 	// The keys and values in the map are service-specific.
 	Health() map[string]string
 
+	// Ready returns an error when the database cannot serve requests: it
+	// is unreachable or the migrations did not complete.
+	Ready(ctx context.Context) error
+
+	// Stats returns the statistics of the connection pool.
+	Stats() sql.DBStats
+
 	// Close terminates the database connection.
 	// It returns an error if the connection cannot be closed.
 	Close() error
 
+	// Migrate creates or updates the schema, MigrationStatus tells what is
+	// missing from it and DropTables drops it.
+	Migrate() error
+	MigrationStatus() ([]TableStatus, error)
+	DropTables() error
+
+	// WithContext returns the service running its queries with ctx, so
+	// that they are canceled with it. The hooks are shared.
+	WithContext(ctx context.Context) Service
+
+	// TryAdvisoryLock takes the session advisory lock of the key on a
+	// dedicated connection, so that a job runs on one instance at a time.
+	// It returns false when another session holds it; unlock releases it.
+	TryAdvisoryLock(ctx context.Context, key int64) (unlock func(), locked bool, err error)
+
 	// User related methods
 	GetUsers() []types.User
 	GetUser(id int) types.User
 	CreateUser(user types.User) error
 	GetUserByEmail(email string) types.User
 	GetUserByID(id uuid.UUID) types.User
+	UpdateUserPassword(userID uuid.UUID, hashedPassword string) error
+	UpdateUserLocale(user *types.User) error
+	UpdateUserTimezone(user *types.User) error
+	UpdateUserBaseCurrency(user *types.User) error
+	UpdateUserAvatarVersion(user *types.User) error
+	GetExpiredDemoUsers(createdBefore time.Time, limit int) []types.User
+
+	// Admin related methods
+	GetAdminStats(activeSince time.Time) (types.AdminStats, error)
+	ExportUser(user *types.User) (types.UserExport, error)
+	Backup(w io.Writer) error
+	Restore(r io.Reader, force bool) (types.RestoreSummary, error)
+	RotateEncryptionKey() (int64, error)
+
+	// Feature flag related methods
+	GetFeatureFlagOverrides(userID uuid.UUID) (map[string]bool, error)
+	SetFeatureFlagOverrides(userID uuid.UUID, overrides map[string]*bool) error
+
+	// Plan related methods
+	GetUsage(userID uuid.UUID, since time.Time) (types.Usage, error)
+	SetUserPlan(userID uuid.UUID, plan string, overrides map[string]int64) error
+
+	// Billing related methods
+	GetBillingAccount(userID uuid.UUID) types.BillingAccount
+	GetBillingAccountByCustomer(customerID string) types.BillingAccount
+	SaveBillingAccount(account *types.BillingAccount, plan string) error
+	GetBillingAccountsPastDue(before time.Time) []types.BillingAccount
+
+	// Webhook related methods
+	ClaimWebhookEvent(event *types.WebhookEvent) (bool, error)
+	ReleaseWebhookEvent(provider, id string) error
+
+	// Delta sync related methods
+	LatestSyncCursor() (int64, error)
+	GetSyncChanges(user *types.User, since int64, limit int) (types.SyncPage, error)
+	DeleteSyncChanges(before time.Time) (int64, error)
+
+	// Maintenance related methods
+	GetMaintenance() (*types.Maintenance, error)
+	SetMaintenance(maintenance *types.Maintenance) error
+
+	// Bank account related methods
+	CreateBankAccount(account *types.BankAccount) error
+	GetBankAccounts(user *types.User, includeArchived bool) []types.BankAccount
+	SetBankAccountArchived(account *types.BankAccount, archived bool, keepInNetWorth bool) error
+	UpdateBankAccount(account *types.BankAccount) error
+	ReorderBankAccounts(userID uuid.UUID, accountIDs []uuid.UUID) error
+	GetBankAccountByID(id string) types.BankAccount
+	RecomputeBalance(accountID uuid.UUID) (types.BalanceDrift, error)
+	GetBalanceDrifts() ([]types.BalanceDrift, error)
+	GetCardCycleTotals(accountID uuid.UUID, from, to time.Time) (types.CardCycleTotals, error)
+	OnLowBalance(hook LowBalanceHook)
+	GetCreditCardsDueReminder() []types.BankAccount
+	SetDueReminderSent(accountID uuid.UUID, dueDate time.Time) error
+	CreateInterestRate(rate *types.InterestRate) error
+	GetInterestRates(accountID uuid.UUID) []types.InterestRate
+	GetRecurringInflow(accountID uuid.UUID, since time.Time) (types.Money, error)
+
+	// Exchange rate related methods
+	GetExchangeRate(base, quote string, date time.Time) (*types.ExchangeRate, error)
+	GetLatestExchangeRate(base, quote string, date time.Time) (*types.ExchangeRate, error)
+	SaveExchangeRate(rate *types.ExchangeRate) error
+	GetExchangeRates(filter types.ExchangeRateFilter) []types.ExchangeRate
+	GetExchangeRateByID(id string) types.ExchangeRate
+	UpdateExchangeRate(rate *types.ExchangeRate) error
+
+	// Currency conversion related methods
+	SetDefaultCurrency(currency string) error
+	GetMissingExchangeRates(user *types.User, currency string, limit int) ([]types.MissingExchangeRate, error)
+
+	// Balance snapshot related methods
+	SnapshotBalances(accountID *uuid.UUID, from, to time.Time) (int64, error)
+	BackfillBalanceSnapshots(accountID uuid.UUID) (int64, error)
+	GetBalanceSnapshots(accountID uuid.UUID, from, to time.Time) ([]types.BalanceSnapshot, error)
+
+	// Bank connection related methods
+	CreateBankConnection(connection *types.BankConnection) error
+	UpdateBankConnection(connection *types.BankConnection) error
+	GetBankConnections(user *types.User) []types.BankConnection
+	GetBankConnectionByID(id string) types.BankConnection
+	GetSyncableBankConnections() []types.BankConnection
+	AttachExternalAccount(account *types.BankAccount, connectionID uuid.UUID, externalAccountID string) error
+	UpdateBankAccountSync(account *types.BankAccount) error
+	ExternalTransactionExists(accountID uuid.UUID, externalID string) bool
+	AccountHasTransactions(accountID uuid.UUID) bool
+
+	// Account member related methods
+	CreateAccountMember(member *types.AccountMember) error
+	GetAccountMembers(accountID uuid.UUID) []types.AccountMember
+	GetAccountMemberByID(id string) types.AccountMember
+	GetAccountMembership(accountID uuid.UUID, userID uuid.UUID) types.AccountMember
+	GetPendingInvites(email string) []types.AccountMember
+	AcceptAccountInvite(member *types.AccountMember, user *types.User) error
+	DeleteAccountMember(member *types.AccountMember) error
+
+	// Household related methods
+	CreateHousehold(household *types.Household) error
+	GetUserHousehold(userID uuid.UUID) types.Household
+	GetHouseholdMemberByID(id string) types.HouseholdMember
+	CreateHouseholdMember(member *types.HouseholdMember) error
+	GetPendingHouseholdInvites(email string) []types.HouseholdMember
+	AcceptHouseholdInvite(member *types.HouseholdMember, user *types.User) error
+	RemoveHouseholdMember(member *types.HouseholdMember) error
+	IsHouseholdMember(householdID uuid.UUID, userID uuid.UUID) bool
+	SetBankAccountHousehold(account *types.BankAccount) error
+	SetBudgetHousehold(budget *types.Budget) error
+	UpdateHouseholdView(user *types.User) error
+
+	// Reconciliation related methods
+	CreateReconciliation(reconciliation *types.Reconciliation) error
+	GetReconciliations(accountID uuid.UUID) []types.Reconciliation
+	GetReconciliationByID(id string) types.Reconciliation
+	GetOpenReconciliation(accountID uuid.UUID) types.Reconciliation
+	GetReconciledTotal(accountID uuid.UUID, until time.Time) (types.Money, error)
+	ReconcileTransactions(reconciliation *types.Reconciliation, transactionIDs []uuid.UUID) (int64, error)
+	CloseReconciliation(reconciliation *types.Reconciliation) error
+	UnreconcileTransaction(transaction *types.Transaction) error
+
+	// Change tokens of the listings, for their ETags
+	TransactionsChangeToken(user *types.User, filter types.TransactionFilter) (string, error)
+	BankAccountsChangeToken(user *types.User) (string, error)
+	CategorySettingsChangeToken(userID uuid.UUID) (string, error)
+	DashboardChangeToken(user *types.User) (string, error)
+
+	// OnDataChange registers a hook called once a change to the data of
+	// the dashboard and of the reports is committed
+	OnDataChange(hook DataChangeHook)
 
 	// Transaction related methods
+	OnTransactionChange(hook TransactionHook)
 	CreateTransaction(transaction *types.Transaction) error
-	GetTransactions(user *types.User) []types.Transaction
+	UpdateTransaction(transaction *types.Transaction) error
+	DeleteTransaction(transaction *types.Transaction) error
+	GetTransactions(user *types.User, filter types.TransactionFilter) []types.Transaction
+	CountTransactions(user *types.User, filter types.TransactionFilter) (int64, error)
+	GetPendingTotal(accountID uuid.UUID) (types.Money, error)
 	GetTransactionByID(id string) types.Transaction
+	GetCategoryStatistics(transaction *types.Transaction, since time.Time) (types.CategoryStatistics, error)
+	IsMerchantMuted(userID uuid.UUID, merchant string) bool
+	MuteMerchant(userID uuid.UUID, merchant string) error
+	GetMutedMerchants(userID uuid.UUID) []string
+
+	// Category setting related methods
+	GetCategorySettings(userID uuid.UUID) []types.CategorySetting
+	IsCategoryExcludedByDefault(userID uuid.UUID, category string) bool
+	SaveCategorySetting(setting *types.CategorySetting) error
+
+	// Tax setting related methods
+	GetTaxSetting(userID uuid.UUID) (types.TaxSetting, bool)
+	SaveTaxSetting(setting *types.TaxSetting) error
+	DeleteTaxSetting(userID uuid.UUID) error
+
+	// Dashboard related methods
+	GetTotalBalance(user *types.User) (types.DashboardBalances, error)
+	GetIncomeAndExpenses(user *types.User, from, to time.Time) (types.Money, types.Money, error)
+	GetTopCategories(user *types.User, from, to time.Time, limit int) ([]types.CategoryTotal, error)
+	GetRecurringTransactions(user *types.User, since time.Time) []types.Transaction
+	CountUnreadNotifications(userID uuid.UUID) (int64, error)
+
+	// Audit log related methods
+	CreateAuditLog(entry *types.AuditLog) error
+	CreateAuditLogs(entries []types.AuditLog) error
+	GetAuditActivity(userID uuid.UUID, filter types.ActivityFilter) []types.ActivityItem
+	GetNotificationActivity(userID uuid.UUID, filter types.ActivityFilter) []types.ActivityItem
+
+	// Onboarding related methods
+	Onboard(user *types.User, onboarding *types.Onboarding) error
+
+	// Settings related methods
+	ImportSettings(userID uuid.UUID, settings *types.SettingsImport) error
+
+	// Privacy request related methods
+	CreatePrivacyRequest(request *types.PrivacyRequest) error
+	UpdatePrivacyRequest(request *types.PrivacyRequest) error
+	GetPrivacyRequests(userID uuid.UUID) []types.PrivacyRequest
+	GetPrivacyRequestByID(id string) types.PrivacyRequest
+	GetPrivacyRequestsByStatus(statuses []string, limit int) []types.PrivacyRequest
+	GetDuePrivacyRequests(now time.Time, limit int) []types.PrivacyRequest
+	ClaimPrivacyRequest(request *types.PrivacyRequest, next string) (bool, error)
+	EraseUser(user *types.User) (deleted, anonymized map[string]int64, err error)
+
+	// Share grant related methods
+	CreateShareGrant(grant *types.ShareGrant) error
+	GetShareGrants(userID uuid.UUID) []types.ShareGrant
+	GetReceivedShareGrants(granteeID uuid.UUID, now time.Time) []types.ShareGrant
+	GetShareGrantByID(id string) types.ShareGrant
+	RevokeShareGrant(grant *types.ShareGrant, at time.Time) error
+
+	// Notification related methods
+	CreateNotification(notification *types.Notification) error
+	GetNotificationPreferences(userID uuid.UUID) []types.NotificationPreference
+	GetNotificationPreference(userID uuid.UUID, event string) (types.NotificationPreference, bool)
+	SaveNotificationPreferences(preferences []types.NotificationPreference) error
+	RecordKnownDevice(device *types.KnownDevice) (bool, error)
+	SaveEmailDelivery(delivery *types.EmailDelivery) error
+	GetUnreadNotifications(userID uuid.UUID, events []string, limit int) []types.Notification
+	DeleteExpiredNotifications(retention types.NotificationRetention, limit int) (int64, error)
+	GetDigestSubscribers(after uuid.UUID, limit int) []types.User
+	ClaimDigest(userID uuid.UUID, scheduledAt, now time.Time) (bool, error)
+	SavePushSubscription(subscription *types.PushSubscription) error
+	GetPushSubscriptions(userID uuid.UUID) []types.PushSubscription
+	DeletePushSubscription(userID uuid.UUID, endpoint string) (bool, error)
+	DeletePushSubscriptionByEndpoint(endpoint string) error
+
+	// Budget related methods
+	CreateBudget(budget *types.Budget) error
+	GetBudgets(user *types.User) []types.Budget
+	GetBudgetByID(id string) types.Budget
+	UpdateBudget(budget *types.Budget) error
+	ChangeBudgetPeriod(budget *types.Budget, period *types.BudgetPeriod) error
+	UpdateBudgetCategories(budget *types.Budget) error
+	DeleteBudget(budget *types.Budget) error
+	GetBudgetsForReport(user *types.User, deletedAfter time.Time) []types.Budget
+	GetBudgetsSpent(periods []types.BudgetPeriodRange) ([]types.Money, error)
+	GetBudgetRecurringExpenses(budget *types.Budget, since time.Time) []types.Transaction
+	GetBudgetsAllocated(periods []types.BudgetPeriodRange) ([]types.Money, error)
+	GetLatestClosedBudgetPeriods(budgetIDs []uuid.UUID) (map[uuid.UUID]types.ClosedBudgetPeriod, error)
+	GetClosedBudgetPeriods(budgetID uuid.UUID) []types.ClosedBudgetPeriod
+	CreateClosedBudgetPeriods(records []types.ClosedBudgetPeriod) error
+	UpdateClosedBudgetPeriods(records []types.ClosedBudgetPeriod) error
+	GetAllocationPool(user *types.User) (types.AllocationPool, error)
+	CreateAllocations(user *types.User, allocations []types.Allocation, source *types.Transaction) error
+	UpdateBudgetingMode(user *types.User) error
+	CreateAllocationRule(rule *types.AllocationRule) error
+	GetAllocationRules(userID uuid.UUID) []types.AllocationRule
+	GetAllocationRuleByID(id string) types.AllocationRule
+	DeleteAllocationRule(rule *types.AllocationRule) error
+	GetRuleMatchingIncome(rule *types.AllocationRule, limit int) []types.Transaction
+	CreateAllocationRuleRun(run *types.AllocationRuleRun) (bool, error)
+	GetBudgetTransactions(budget *types.Budget, from, to time.Time, filter types.TransactionFilter) []types.Transaction
+	CreateBudgetTemplate(template *types.BudgetTemplate) error
+	GetBudgetTemplates(user *types.User) []types.BudgetTemplate
+	GetBudgetTemplateByID(id string) types.BudgetTemplate
+	GetBudgetAlerts(budgetID uuid.UUID, periodStart time.Time) []int
+	CreateBudgetAlert(alert *types.BudgetAlert) (bool, error)
+	DeleteBudgetAlerts(budgetID uuid.UUID, periodStart time.Time, thresholds []int) error
+
+	// Goal related methods
+	CreateGoal(goal *types.Goal) error
+	GetGoals(user *types.User) []types.Goal
+	GetGoalByID(id string) types.Goal
+	UpdateGoal(goal *types.Goal) error
+	DeleteGoal(goal *types.Goal) error
+	GetGoalsContributed(goalIDs []uuid.UUID) (map[uuid.UUID]types.Money, error)
+	GetGoalContributions(goalID uuid.UUID) []types.GoalContribution
+	CreateGoalContribution(contribution *types.GoalContribution) error
+	DeleteGoalContribution(contribution *types.GoalContribution) error
+	GetGoalContributionByID(id string) types.GoalContribution
+	GetGoalsFundedBy(transaction *types.Transaction) []types.Goal
+	GetActiveGoalsForAccount(accountID uuid.UUID) []types.Goal
+	SyncTransactionContributions(transaction *types.Transaction) error
+	DeleteTransactionContributions(transactionID uuid.UUID) error
+
+	// Bill related methods
+	CreateBill(bill *types.Bill) error
+	GetBills(user *types.User) []types.Bill
+	GetBillByID(id string) types.Bill
+	UpdateBill(bill *types.Bill) error
+	DeleteBill(bill *types.Bill) error
+	GetAllBills() []types.Bill
+	GetBillsForTransaction(transaction *types.Transaction) []types.Bill
+	GetBillPayments(billIDs []uuid.UUID, from, to time.Time) []types.BillPayment
+	MarkBillPaid(billID uuid.UUID, dueDate time.Time, transactionID uuid.UUID, paidAt time.Time) (bool, error)
+	UnmarkBillPaid(transactionID uuid.UUID) error
+	ClaimBillNotification(billID uuid.UUID, dueDate time.Time, kind string, now time.Time) (bool, error)
+
+	// Subscription related methods
+	GetMerchantCharges(userID uuid.UUID, since time.Time) ([]types.MerchantCharge, error)
+	GetSubscriptions(userID uuid.UUID) []types.Subscription
+	SuggestSubscription(subscription *types.Subscription) (bool, error)
+	SaveSubscription(subscription *types.Subscription) error
+	ConfirmSubscription(subscription *types.Subscription, bill *types.Bill) error
+
+	// Report related methods
+	GetSpendingPatterns(user *types.User, from, to time.Time, category, timezone string) (types.SpendingPatterns, error)
+	GetMonthlyAccountFlows(user *types.User, timezone string, excludeShared bool) []types.AccountMonthlyFlow
+	GetCashFlow(user *types.User, from, to time.Time, granularity, timezone string, filter types.ReportFilter) ([]types.CashFlowBucket, error)
+	GetFirstTransactionDate(user *types.User) (*time.Time, error)
+	GetCategoryMonthlyTotals(user *types.User, from, to time.Time, timezone string) ([]types.CategoryMonthTotal, error)
+	GetMerchantSpending(user *types.User, from, to time.Time, limit, offset int) ([]types.MerchantSpending, int64, error)
+	GetFlowTotals(user *types.User, from, to time.Time) ([]types.FlowTotal, error)
+	GetScheduledFlows(accountID uuid.UUID, after, until time.Time) ([]types.ForecastItem, error)
+	GetDiscretionarySpending(accountID uuid.UUID, from, to time.Time) (types.Money, error)
+	GetCardPaymentAccount(cardID uuid.UUID) (*uuid.UUID, error)
+	GetTaxTransactions(user *types.User, categories []string, from, to time.Time) ([]types.TaxTransaction, error)
+	GetDailySpending(user *types.User, from, to time.Time, timezone string) ([]types.DailySpending, error)
+	GetDailyExpenses(user *types.User, from, to time.Time, timezone string, filter types.ReportFilter) ([]types.DayTotal, error)
+
+	// Custom report related methods
+	CreateReportDefinition(definition *types.ReportDefinition) error
+	GetReportDefinitions(userID uuid.UUID) []types.ReportDefinition
+	GetReportDefinitionByID(id string) types.ReportDefinition
+	UpdateReportDefinition(definition *types.ReportDefinition) error
+	DeleteReportDefinition(definition *types.ReportDefinition) error
+	RunCustomReport(user *types.User, spec types.CustomReportSpec, from, to time.Time, timezone string, limit int) ([]types.CustomReportRow, bool, error)
+
+	// Report schedule related methods
+	CreateReportSchedule(schedule *types.ReportSchedule) error
+	GetReportSchedules(userID uuid.UUID) []types.ReportSchedule
+	GetReportScheduleByID(id string) types.ReportSchedule
+	UpdateReportSchedule(schedule *types.ReportSchedule) error
+	DeleteReportSchedule(schedule *types.ReportSchedule) error
+	GetDueReportSchedules(now time.Time, after uuid.UUID, limit int) []types.ReportSchedule
+	ClaimReportSchedule(schedule *types.ReportSchedule, next time.Time) (bool, error)
+	RecordReportDelivery(schedule *types.ReportSchedule, delivery *types.ReportDelivery) error
+	GetReportDeliveries(scheduleID *uuid.UUID, limit int) []types.ReportDelivery
 }
 
 type service struct {
 	db     *gorm.DB
 	baseDB *sql.DB
+
+	transactionHooks []TransactionHook
+	lowBalanceHooks  []LowBalanceHook
+	dataChangeHooks  []DataChangeHook
+
+	// migrated is set once every migration of New completed, before the
+	// service is returned
+	migrated bool
+	// name of the database, logged on close
+	name string
+	// currency of the instance, see SetDefaultCurrency
+	currency string
+	// cipher of the encrypted columns
+	cipher utils.Cipher
 }
 
-var (
-	database   = os.Getenv("DB_DATABASE")
-	password   = os.Getenv("DB_PASSWORD")
-	username   = os.Getenv("DB_USERNAME")
-	port       = os.Getenv("DB_PORT")
-	host       = os.Getenv("DB_HOST")
-	schema     = os.Getenv("DB_SCHEMA")
-	dbInstance *service
-)
+var dbInstance *service
+
+// models returns every model managed by the migrations.
+func models() []interface{} {
+	return []interface{}{
+		&types.User{},
+		&types.BankAccount{},
+		&types.Transaction{},
+		&types.Budget{},
+		&types.BudgetPeriod{},
+		&types.BudgetCategory{},
+		&types.BudgetAlert{},
+		&types.ClosedBudgetPeriod{},
+		&types.Allocation{},
+		&types.AllocationRule{},
+		&types.AllocationRuleStep{},
+		&types.AllocationRuleRun{},
+		&types.Goal{},
+		&types.GoalContribution{},
+		&types.Bill{},
+		&types.BillPayment{},
+		&types.Subscription{},
+		&types.BudgetTemplate{},
+		&types.BudgetTemplateItem{},
+		&types.Notification{},
+		&types.NotificationPreference{},
+		&types.KnownDevice{},
+		&types.EmailDelivery{},
+		&types.PushSubscription{},
+		&types.AnomalyMute{},
+		&types.CategorySetting{},
+		&types.TaxSetting{},
+		&types.TaxCategory{},
+		&types.ReportDefinition{},
+		&types.ReportSchedule{},
+		&types.ReportDelivery{},
+		&types.Reconciliation{},
+		&types.AuditLog{},
+		&types.PrivacyRequest{},
+		&types.AccountMember{},
+		&types.ShareGrant{},
+		&types.Household{},
+		&types.HouseholdMember{},
+		&types.BankConnection{},
+		&types.InterestRate{},
+		&types.ExchangeRate{},
+		&types.BalanceSnapshot{},
+		&types.FeatureFlagOverride{},
+		&types.BillingAccount{},
+		&types.WebhookEvent{},
+		&types.SyncChange{},
+		&types.Maintenance{},
+	}
+}
 
 func Get() service {
 	if dbInstance == nil {
@@ -63,36 +451,64 @@ func Get() service {
 	return *dbInstance
 }
 
-func New() Service {
+// New connects to the database of the configuration and migrates it. The
+// connection is opened once and shared by the next calls.
+func New(cfg config.DB) Service {
 	// Reuse Connection
 	if dbInstance != nil {
 		return dbInstance
 	}
-	connStr := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable&search_path=%s", username, password, host, port, database, schema)
-	db, err := sql.Open("pgx", connStr)
 
+	service, err := open(cfg)
 	if err != nil {
 		log.Fatal(err)
 	}
+	if err := service.Migrate(); err != nil {
+		log.Fatal(err)
+	}
 
-	gormDB, err := gorm.Open(postgres.New(postgres.Config{
-		Conn: db,
-	}), &gorm.Config{})
+	dbInstance = service
+	return dbInstance
+}
+
+// Open connects to the database of the configuration without migrating it,
+// for the commands managing the schema.
+func Open(cfg config.DB) (Service, error) {
+	return open(cfg)
+}
 
+func open(cfg config.DB) (*service, error) {
+	db, err := sql.Open("pgx", cfg.DSN())
 	if err != nil {
-		log.Fatal("Error connecting with gorm: ", err)
+		return nil, fmt.Errorf("error opening %s: %w", cfg, err)
 	}
 
-	err = gormDB.AutoMigrate(&types.User{}, &types.BankAccount{}, &types.Transaction{}, &types.Budget{}, &types.Notification{})
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: db,
+	}), &gorm.Config{
+		// The errors and the slow queries are logged without the values of
+		// their parameters, emails or amounts
+		Logger: logger.New(stdlog.New(logging.NewWriter(os.Stdout), "\r\n", stdlog.LstdFlags), logger.Config{
+			SlowThreshold:        200 * time.Millisecond,
+			LogLevel:             logger.Warn,
+			Colorful:             true,
+			ParameterizedQueries: true,
+		}),
+	})
 	if err != nil {
-		log.Fatal("Error with migration: ", err)
+		return nil, fmt.Errorf("error connecting to %s with gorm: %w", cfg, err)
 	}
 
-	dbInstance = &service{
+	s := &service{
 		db:     gormDB,
 		baseDB: db,
+		name:   cfg.Database,
+		cipher: utils.Cipher{Key: cfg.EncryptionKey, PreviousKeys: cfg.PreviousEncryptionKeys},
 	}
-	return dbInstance
+	if err := s.registerEncryption(); err != nil {
+		return nil, fmt.Errorf("error registering the encrypted columns: %w", err)
+	}
+	return s, nil
 }
 
 // Health checks the health of the database connection by pinging the database.
@@ -108,7 +524,7 @@ func (s *service) Health() map[string]string {
 	if err != nil {
 		stats["status"] = "down"
 		stats["error"] = fmt.Sprintf("db down: %v", err)
-		log.Fatalf("db down: %v", err) // Log the error and terminate the program
+		log.Errorf("db down: %v", err)
 		return stats
 	}
 
@@ -146,21 +562,139 @@ func (s *service) Health() map[string]string {
 	return stats
 }
 
+// Ready pings the database once the migrations completed.
+func (s *service) Ready(ctx context.Context) error {
+	if !s.migrated {
+		return errors.New("migrations have not completed")
+	}
+	return s.baseDB.PingContext(ctx)
+}
+
+// Stats returns the statistics of the connection pool.
+func (s *service) Stats() sql.DBStats {
+	return s.baseDB.Stats()
+}
+
+// WithContext returns a copy of the service whose queries use ctx.
+func (s *service) WithContext(ctx context.Context) Service {
+	scoped := *s
+	scoped.db = s.db.WithContext(ctx)
+	return &scoped
+}
+
 // Close closes the database connection.
 // It logs a message indicating the disconnection from the specific database.
 // If the connection is successfully closed, it returns nil.
 // If an error occurs while closing the connection, it returns the error.
 func (s *service) Close() error {
-	log.Printf("Disconnected from database: %s", database)
+	log.Printf("Disconnected from database: %s", s.name)
 	return s.baseDB.Close()
 }
 
+// TryAdvisoryLock takes the advisory lock on a connection of its own: the
+// lock belongs to the session, a pooled connection could be reused by
+// another query while it is held.
+func (s *service) TryAdvisoryLock(ctx context.Context, key int64) (func(), bool, error) {
+	conn, err := s.baseDB.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&locked); err != nil || !locked {
+		conn.Close()
+		return nil, false, err
+	}
+
+	unlock := func() {
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", key); err != nil {
+			log.Error("Error releasing advisory lock: ", err)
+		}
+		conn.Close()
+	}
+	return unlock, true, nil
+}
+
+// Migrate creates or updates the tables of the models, then migrates the
+// data of the previous versions. Every step can be run again.
 func (s *service) Migrate() error {
-	err := s.db.AutoMigrate(&types.User{}, &types.BankAccount{}, &types.Transaction{}, &types.Budget{}, &types.Notification{})
+	if err := s.db.AutoMigrate(models()...); err != nil {
+		return fmt.Errorf("error with migration: %w", err)
+	}
 
-	if err != nil {
+	if err := s.migrateExternalAccountIDs(); err != nil {
+		return fmt.Errorf("error encrypting the external account IDs: %w", err)
+	}
+
+	if err := s.checkEncryptedColumns(); err != nil {
 		return err
 	}
 
+	if err := s.normalizeTransactionAmounts(); err != nil {
+		return fmt.Errorf("error normalizing transaction amounts: %w", err)
+	}
+
+	if err := s.migrateMoneyAmounts(); err != nil {
+		return fmt.Errorf("error rounding the amounts: %w", err)
+	}
+
+	if err := s.migrateBudgetSoftDelete(); err != nil {
+		return fmt.Errorf("error migrating budget deletion dates: %w", err)
+	}
+
+	if err := s.migrateBudgetCategories(); err != nil {
+		return fmt.Errorf("error migrating budget categories: %w", err)
+	}
+
+	if err := s.migrateExchangeRateFunction(); err != nil {
+		return fmt.Errorf("error creating the exchange rate function: %w", err)
+	}
+
+	if err := s.migrateSyncTriggers(); err != nil {
+		return fmt.Errorf("error creating the sync triggers: %w", err)
+	}
+	s.migrated = true
+
 	return nil
 }
+
+// TableStatus tells whether the table of a model matches it.
+type TableStatus struct {
+	Table          string
+	Exists         bool
+	MissingColumns []string
+}
+
+// MigrationStatus compares the tables with the models: the migrations are
+// pending when a table or a column is missing.
+func (s *service) MigrationStatus() ([]TableStatus, error) {
+	migrator := s.db.Migrator()
+	var statuses []TableStatus
+	for _, model := range models() {
+		stmt := &gorm.Statement{DB: s.db}
+		if err := stmt.Parse(model); err != nil {
+			return nil, err
+		}
+
+		status := TableStatus{Table: stmt.Schema.Table, Exists: migrator.HasTable(model)}
+		if status.Exists {
+			for _, field := range stmt.Schema.Fields {
+				if field.DBName != "" && !migrator.HasColumn(model, field.DBName) {
+					status.MissingColumns = append(status.MissingColumns, field.DBName)
+				}
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// DropTables drops the tables of the models, with their data.
+func (s *service) DropTables() error {
+	tables := models()
+	// In the reverse order of creation, the referencing tables first
+	for i, j := 0, len(tables)-1; i < j; i, j = i+1, j-1 {
+		tables[i], tables[j] = tables[j], tables[i]
+	}
+	return s.db.Migrator().DropTable(tables...)
+}
@@ -1,6 +1,8 @@
 package database
 
 import (
+	"FinMa/internal/config"
+	"FinMa/types"
 	"context"
 	"log"
 	"testing"
@@ -11,6 +13,14 @@ import (
 	"github.com/testcontainers/testcontainers-go/wait"
 )
 
+// testConfig points at the container started by TestMain.
+var testConfig = config.Default().DB
+
+// money returns the amount without a currency, as read from the database.
+func money(amount float64) types.Money {
+	return types.MoneyFromFloat(amount, "")
+}
+
 func mustStartPostgresContainer() (func(context.Context) error, error) {
 	var (
 		dbName = "database"
@@ -33,9 +43,9 @@ func mustStartPostgresContainer() (func(context.Context) error, error) {
 		return nil, err
 	}
 
-	database = dbName
-	password = dbPwd
-	username = dbUser
+	testConfig.Database = dbName
+	testConfig.Password = dbPwd
+	testConfig.Username = dbUser
 
 	dbHost, err := dbContainer.Host(context.Background())
 	if err != nil {
@@ -47,8 +57,8 @@ func mustStartPostgresContainer() (func(context.Context) error, error) {
 		return dbContainer.Terminate, err
 	}
 
-	host = dbHost
-	port = dbPort.Port()
+	testConfig.Host = dbHost
+	testConfig.Port = dbPort.Int()
 
 	return dbContainer.Terminate, err
 }
@@ -67,14 +77,14 @@ func TestMain(m *testing.M) {
 }
 
 func TestNew(t *testing.T) {
-	srv := New()
+	srv := New(testConfig)
 	if srv == nil {
 		t.Fatal("New() returned nil")
 	}
 }
 
 func TestHealth(t *testing.T) {
-	srv := New()
+	srv := New(testConfig)
 
 	stats := srv.Health()
 
@@ -91,8 +101,29 @@ func TestHealth(t *testing.T) {
 	}
 }
 
+func TestWithContextCancelsQueries(t *testing.T) {
+	srv := New(testConfig)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := srv.WithContext(ctx).(*service).db.Exec("SELECT pg_sleep(5)").Error
+	if err == nil {
+		t.Fatalf("expected the query to be canceled")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the query to stop at the deadline; took %s", elapsed)
+	}
+
+	// The service itself is not bound to the context
+	if err := srv.(*service).db.Exec("SELECT 1").Error; err != nil {
+		t.Errorf("unexpected error. Err: %v", err)
+	}
+}
+
 func TestClose(t *testing.T) {
-	srv := New()
+	srv := New(testConfig)
 
 	if srv.Close() != nil {
 		t.Fatalf("expected Close() to return nil")
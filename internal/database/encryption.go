@@ -0,0 +1,320 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+
+	"FinMa/types"
+	"FinMa/utils"
+)
+
+// ErrEncryptedColumn is returned by the queries filtering on an encrypted
+// column or updating one from a map, which would compare or store the
+// plaintext: the encrypted values can only be read and written whole.
+var ErrEncryptedColumn = errors.New("encrypted columns cannot be searched nor updated from a map")
+
+// encryptedSerializerName is the gorm serializer of the encrypted columns,
+// set with the `serializer:encrypted` tag on a string field.
+const encryptedSerializerName = "encrypted"
+
+// encryptedSerializer encrypts the value of the field with the cipher of
+// the service on write and decrypts it on read. The empty values are
+// stored as is.
+type encryptedSerializer struct {
+	cipher *utils.Cipher
+}
+
+func (e encryptedSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var value string
+	switch v := dbValue.(type) {
+	case string:
+		value = v
+	case []byte:
+		value = string(v)
+	case nil:
+	default:
+		return fmt.Errorf("%s: unexpected encrypted value %T", field.DBName, dbValue)
+	}
+
+	if value != "" {
+		plaintext, err := e.cipher.Decrypt(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", field.DBName, err)
+		}
+		value = plaintext
+	}
+	field.ReflectValueOf(ctx, dst).SetString(value)
+	return nil
+}
+
+func (e encryptedSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	value, _ := fieldValue.(string)
+	if value == "" {
+		return "", nil
+	}
+	return e.cipher.Encrypt(value)
+}
+
+// encryptedColumn is a column holding encrypted values.
+type encryptedColumn struct {
+	Table  string
+	Column string
+}
+
+// encryptedFields returns the database names of the encrypted fields.
+func encryptedFields(s *schema.Schema) []string {
+	var columns []string
+	for _, field := range s.Fields {
+		if field.DBName != "" && field.TagSettings["SERIALIZER"] == encryptedSerializerName {
+			columns = append(columns, field.DBName)
+		}
+	}
+	return columns
+}
+
+// encryptedColumns returns the encrypted columns of the models.
+func (s *service) encryptedColumns() ([]encryptedColumn, error) {
+	var columns []encryptedColumn
+	for _, model := range models() {
+		stmt := &gorm.Statement{DB: s.db}
+		if err := stmt.Parse(model); err != nil {
+			return nil, err
+		}
+		for _, column := range encryptedFields(stmt.Schema) {
+			columns = append(columns, encryptedColumn{Table: stmt.Schema.Table, Column: column})
+		}
+	}
+	return columns, nil
+}
+
+// refuseEncryptedConditions fails the statements of a model filtering on
+// one of its encrypted columns, whose values are encrypted with a random
+// nonce and never equal, or updating one from a map, which bypasses the
+// serializer. The raw queries are not checked.
+func refuseEncryptedConditions(db *gorm.DB) {
+	if db.Statement.Schema == nil {
+		return
+	}
+	columns := encryptedFields(db.Statement.Schema)
+	if len(columns) == 0 {
+		return
+	}
+
+	if where, ok := db.Statement.Clauses["WHERE"].Expression.(clause.Where); ok {
+		if column := referencedColumn(where.Exprs, columns); column != "" {
+			db.AddError(fmt.Errorf("%w: %s", ErrEncryptedColumn, column))
+			return
+		}
+	}
+	if values, ok := db.Statement.Dest.(map[string]interface{}); ok {
+		for key := range values {
+			if field := db.Statement.Schema.LookUpField(key); field != nil && slices.Contains(columns, field.DBName) {
+				db.AddError(fmt.Errorf("%w: %s", ErrEncryptedColumn, field.DBName))
+				return
+			}
+		}
+	}
+}
+
+// referencedColumn returns the first of the columns referenced by the
+// expressions, "" if none.
+func referencedColumn(exprs []clause.Expression, columns []string) string {
+	var names []string
+	for _, expr := range exprs {
+		switch e := expr.(type) {
+		case clause.Expr:
+			names = append(names, e.SQL)
+		case clause.NamedExpr:
+			names = append(names, e.SQL)
+		case clause.Eq:
+			names = append(names, columnName(e.Column))
+		case clause.Neq:
+			names = append(names, columnName(e.Column))
+		case clause.IN:
+			names = append(names, columnName(e.Column))
+		case clause.Like:
+			names = append(names, columnName(e.Column))
+		case clause.AndConditions:
+			if column := referencedColumn(e.Exprs, columns); column != "" {
+				return column
+			}
+		case clause.OrConditions:
+			if column := referencedColumn(e.Exprs, columns); column != "" {
+				return column
+			}
+		case clause.NotConditions:
+			if column := referencedColumn(e.Exprs, columns); column != "" {
+				return column
+			}
+		}
+	}
+
+	for _, column := range columns {
+		for _, name := range names {
+			if mentions(name, column) {
+				return column
+			}
+		}
+	}
+	return ""
+}
+
+// mentions reports whether the SQL mentions the column as a whole word.
+func mentions(sql, column string) bool {
+	isWord := func(c byte) bool {
+		return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+	}
+	for i := strings.Index(sql, column); i >= 0; {
+		end := i + len(column)
+		if (i == 0 || !isWord(sql[i-1])) && (end == len(sql) || !isWord(sql[end])) {
+			return true
+		}
+		next := strings.Index(sql[i+1:], column)
+		if next < 0 {
+			return false
+		}
+		i += next + 1
+	}
+	return false
+}
+
+func columnName(column interface{}) string {
+	switch c := column.(type) {
+	case string:
+		return c
+	case clause.Column:
+		return c.Name
+	}
+	return ""
+}
+
+// registerEncryption registers the serializer of the encrypted columns with
+// the cipher of the service, and the callbacks refusing to search them.
+func (s *service) registerEncryption() error {
+	schema.RegisterSerializer(encryptedSerializerName, encryptedSerializer{cipher: &s.cipher})
+
+	callbacks := s.db.Callback()
+	for _, err := range []error{
+		callbacks.Query().Before("gorm:query").Register("finma:encrypted_columns", refuseEncryptedConditions),
+		callbacks.Row().Before("gorm:row").Register("finma:encrypted_columns", refuseEncryptedConditions),
+		callbacks.Update().Before("gorm:update").Register("finma:encrypted_columns", refuseEncryptedConditions),
+		callbacks.Delete().Before("gorm:delete").Register("finma:encrypted_columns", refuseEncryptedConditions),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkEncryptedColumns fails when the encrypted columns hold values the
+// configuration cannot read: without ENCRYPTION_KEY, or with keys none of
+// which decrypts them.
+func (s *service) checkEncryptedColumns() error {
+	columns, err := s.encryptedColumns()
+	if err != nil {
+		return err
+	}
+	for _, column := range columns {
+		var values []string
+		err := s.db.Raw("SELECT " + quoteIdentifier(column.Column) + " FROM " + quoteIdentifier(column.Table) +
+			" WHERE " + quoteIdentifier(column.Column) + " <> '' LIMIT 1").Scan(&values).Error
+		if err != nil {
+			return err
+		}
+		if len(values) == 0 {
+			continue
+		}
+		if s.cipher.Key == "" {
+			return fmt.Errorf("ENCRYPTION_KEY is required: %s.%s holds encrypted values", column.Table, column.Column)
+		}
+		if _, err := s.cipher.Decrypt(values[0]); err != nil {
+			return fmt.Errorf("the encryption keys do not decrypt %s.%s: %w", column.Table, column.Column, err)
+		}
+	}
+	return nil
+}
+
+// migrateExternalAccountIDs encrypts the external account IDs stored in
+// plaintext before they were encrypted, and drops their old column.
+func (s *service) migrateExternalAccountIDs() error {
+	if !s.db.Migrator().HasColumn(&types.BankAccount{}, "external_account_id") {
+		return nil
+	}
+
+	var accounts []struct {
+		ID                uuid.UUID
+		ExternalAccountID string
+	}
+	err := s.db.Raw("SELECT id, external_account_id FROM bank_accounts WHERE external_account_id <> ''").Scan(&accounts).Error
+	if err != nil {
+		return err
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for _, account := range accounts {
+			encrypted, err := s.cipher.Encrypt(account.ExternalAccountID)
+			if err != nil {
+				return fmt.Errorf("ENCRYPTION_KEY is required to encrypt the external account IDs: %w", err)
+			}
+			if err := tx.Exec("UPDATE bank_accounts SET encrypted_external_account_id = ? WHERE id = ?", encrypted, account.ID).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Exec("ALTER TABLE bank_accounts DROP COLUMN external_account_id").Error
+	})
+}
+
+// RotateEncryptionKey encrypts with ENCRYPTION_KEY the values of the
+// encrypted columns still encrypted with one of the previous keys, and
+// returns how many were. A rotation interrupted can run again, the values
+// already rotated are left.
+func (s *service) RotateEncryptionKey() (int64, error) {
+	columns, err := s.encryptedColumns()
+	if err != nil {
+		return 0, err
+	}
+
+	var rotated int64
+	for _, column := range columns {
+		table, name := quoteIdentifier(column.Table), quoteIdentifier(column.Column)
+		var changedRows int64
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			var rows []struct {
+				ID    uuid.UUID
+				Value string
+			}
+			err := tx.Raw("SELECT id, " + name + " AS value FROM " + table + " WHERE " + name + " <> '' FOR UPDATE").Scan(&rows).Error
+			if err != nil {
+				return err
+			}
+			for _, row := range rows {
+				value, changed, err := s.cipher.Reencrypt(row.Value)
+				if err != nil {
+					return fmt.Errorf("%s.%s of %s: %w", column.Table, column.Column, row.ID, err)
+				}
+				if !changed {
+					continue
+				}
+				if err := tx.Exec("UPDATE "+table+" SET "+name+" = ? WHERE id = ?", value, row.ID).Error; err != nil {
+					return err
+				}
+				changedRows++
+			}
+			return nil
+		})
+		if err != nil {
+			return rotated, err
+		}
+		rotated += changedRows
+	}
+	return rotated, nil
+}
@@ -0,0 +1,83 @@
+package database
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"FinMa/types"
+	"FinMa/utils"
+)
+
+func TestEncryptedColumns(t *testing.T) {
+	s := New(testConfig).(*service)
+	oldKey, newKey := "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=", "ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA="
+	s.cipher = utils.Cipher{Key: oldKey}
+	t.Cleanup(func() { s.cipher = utils.Cipher{Key: testConfig.EncryptionKey} })
+
+	user := types.User{ID: uuid.New(), Email: uuid.NewString() + "@example.com", Role: "user"}
+	if err := s.db.Create(&user).Error; err != nil {
+		t.Fatalf("could not create user: %v", err)
+	}
+	connection := types.BankConnection{ID: uuid.New(), Provider: "gocardless", Consent: "link-1", Status: "linked", UserID: user.ID}
+	if err := s.CreateBankConnection(&connection); err != nil {
+		t.Fatalf("could not create connection: %v", err)
+	}
+	account := types.BankAccount{ID: uuid.New(), AccountNumber: uuid.NewString(), UserID: user.ID}
+	if err := s.CreateBankAccount(&account); err != nil {
+		t.Fatalf("could not create account: %v", err)
+	}
+	if err := s.AttachExternalAccount(&account, connection.ID, "external-1"); err != nil {
+		t.Fatalf("could not attach the account: %v", err)
+	}
+
+	var stored string
+	s.db.Raw("SELECT encrypted_external_account_id FROM bank_accounts WHERE id = ?", account.ID).Scan(&stored)
+	if stored == "" || stored == "external-1" {
+		t.Fatalf("expected the external account ID encrypted; got %q", stored)
+	}
+	if got := s.GetBankConnectionByID(connection.ID.String()); got.Consent != "link-1" {
+		t.Errorf("expected the consent decrypted; got %q", got.Consent)
+	}
+	if got := s.GetBankAccountByID(account.ID.String()); got.ExternalAccountID != "external-1" {
+		t.Errorf("expected the external account ID decrypted; got %q", got.ExternalAccountID)
+	}
+
+	// Searching an encrypted column fails rather than matching nothing
+	var found []types.BankAccount
+	err := s.db.Where("encrypted_external_account_id = ?", "external-1").Find(&found).Error
+	if !errors.Is(err, ErrEncryptedColumn) {
+		t.Errorf("expected the search refused; got %v", err)
+	}
+	err = s.db.Model(&types.BankConnection{}).Where("id = ?", connection.ID).Update("consent", "link-2").Error
+	if !errors.Is(err, ErrEncryptedColumn) {
+		t.Errorf("expected the update from a map refused; got %v", err)
+	}
+
+	// The values are read with the previous key until rotated
+	s.cipher = utils.Cipher{Key: newKey, PreviousKeys: []string{oldKey}}
+	if got := s.GetBankConnectionByID(connection.ID.String()); got.Consent != "link-1" {
+		t.Errorf("expected the consent read with the previous key; got %q", got.Consent)
+	}
+	rotated, err := s.RotateEncryptionKey()
+	if err != nil || rotated < 2 {
+		t.Fatalf("expected the values rotated; got %d %v", rotated, err)
+	}
+	if rotated, err := s.RotateEncryptionKey(); err != nil || rotated != 0 {
+		t.Errorf("expected nothing left to rotate; got %d %v", rotated, err)
+	}
+
+	s.cipher = utils.Cipher{Key: newKey}
+	if got := s.GetBankAccountByID(account.ID.String()); got.ExternalAccountID != "external-1" {
+		t.Errorf("expected the external account ID read with the new key; got %q", got.ExternalAccountID)
+	}
+	if err := s.checkEncryptedColumns(); err != nil {
+		t.Errorf("expected the new key to read the columns; got %v", err)
+	}
+
+	s.cipher = utils.Cipher{}
+	if err := s.checkEncryptedColumns(); err == nil {
+		t.Error("expected encrypted values without a key refused")
+	}
+}
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"FinMa/types"
+	"errors"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GetExchangeRate returns the rate of the pair stored for the day, nil when
+// none is.
+func (s *service) GetExchangeRate(base, quote string, date time.Time) (*types.ExchangeRate, error) {
+	var rate types.ExchangeRate
+	err := s.db.Where("base = ? AND quote = ? AND date = ?", base, quote, date.Format(time.DateOnly)).First(&rate).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rate, nil
+}
+
+// GetLatestExchangeRate returns the last rate of the pair stored on or
+// before the day, nil when none is.
+func (s *service) GetLatestExchangeRate(base, quote string, date time.Time) (*types.ExchangeRate, error) {
+	var rate types.ExchangeRate
+	err := s.db.Where("base = ? AND quote = ? AND date <= ?", base, quote, date.Format(time.DateOnly)).
+		Order("date DESC").First(&rate).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rate, nil
+}
+
+// SaveExchangeRate stores the rate of the pair for its day, replacing the
+// one stored by a concurrent request.
+func (s *service) SaveExchangeRate(rate *types.ExchangeRate) error {
+	return s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "base"}, {Name: "quote"}, {Name: "date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "rate_date", "fallback", "source", "updated_at"}),
+	}).Create(rate).Error
+}
+
+// GetExchangeRates returns the stored rates matching the filter, the latest
+// days first.
+func (s *service) GetExchangeRates(filter types.ExchangeRateFilter) []types.ExchangeRate {
+	rates := []types.ExchangeRate{}
+	query := s.db.Order("date DESC, base, quote")
+	if filter.Base != "" {
+		query = query.Where("base = ?", filter.Base)
+	}
+	if filter.Quote != "" {
+		query = query.Where("quote = ?", filter.Quote)
+	}
+	if filter.From != nil {
+		query = query.Where("date >= ?", filter.From.Format(time.DateOnly))
+	}
+	if filter.To != nil {
+		query = query.Where("date <= ?", filter.To.Format(time.DateOnly))
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+
+	if result := query.Find(&rates); result.Error != nil {
+		log.Error("Error fetching exchange rates: ", result.Error)
+		return nil
+	}
+	return rates
+}
+
+func (s *service) GetExchangeRateByID(id string) types.ExchangeRate {
+	var rate types.ExchangeRate
+	result := s.db.Where("id = ?", id).First(&rate)
+
+	if result.Error != nil {
+		log.Error("Error fetching exchange rate: ", result.Error)
+		return types.ExchangeRate{}
+	}
+	return rate
+}
+
+func (s *service) UpdateExchangeRate(rate *types.ExchangeRate) error {
+	return s.db.Save(rate).Error
+}
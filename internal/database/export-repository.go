@@ -0,0 +1,74 @@
+package database
+
+import (
+	"FinMa/types"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ExportUser returns the data owned by the user, including the deleted
+// budgets. The password hash is left out. Every row is checked to belong to
+// the user, the export fails rather than leak the data of another one.
+func (s *service) ExportUser(user *types.User) (types.UserExport, error) {
+	export := types.UserExport{SchemaVersion: types.ExportSchemaVersion, ExportedAt: time.Now().UTC(), User: *user}
+	export.User.Password = ""
+
+	owned := []any{
+		&export.BankAccounts,
+		&export.Transactions,
+		&export.Budgets,
+		&export.BudgetTemplates,
+		&export.Goals,
+		&export.Bills,
+		&export.AllocationRules,
+		&export.CategorySettings,
+		&export.NotificationPreferences,
+		&export.Notifications,
+		&export.Subscriptions,
+		&export.ReportDefinitions,
+		&export.ReportSchedules,
+		&export.KnownDevices,
+		&export.ShareGrants,
+		&export.AuditLogs,
+	}
+	for _, rows := range owned {
+		if err := s.db.Unscoped().Where("user_id = ?", user.ID).Find(rows).Error; err != nil {
+			return types.UserExport{}, err
+		}
+	}
+	if err := checkExportOwner(export); err != nil {
+		return types.UserExport{}, err
+	}
+	return export, nil
+}
+
+// checkExportOwner returns an error when a row of the export belongs to
+// another user than the exported one: its UserID differs, or it embeds
+// another user.
+func checkExportOwner(export types.UserExport) error {
+	owner := export.User.ID
+	value := reflect.ValueOf(export)
+	for i := 0; i < value.NumField(); i++ {
+		rows := value.Field(i)
+		if rows.Kind() != reflect.Slice {
+			continue
+		}
+		for j := 0; j < rows.Len(); j++ {
+			row := rows.Index(j)
+			if userID := row.FieldByName("UserID"); userID.IsValid() {
+				if id, ok := userID.Interface().(uuid.UUID); ok && id != owner {
+					return fmt.Errorf("%s row %d belongs to user %s", value.Type().Field(i).Name, j, id)
+				}
+			}
+			if embedded := row.FieldByName("User"); embedded.IsValid() {
+				if id := embedded.FieldByName("ID").Interface().(uuid.UUID); id != uuid.Nil && id != owner {
+					return fmt.Errorf("%s row %d embeds user %s", value.Type().Field(i).Name, j, id)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"FinMa/types"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GetFeatureFlagOverrides returns the flags turned on or off for the user,
+// by name.
+func (s *service) GetFeatureFlagOverrides(userID uuid.UUID) (map[string]bool, error) {
+	var rows []types.FeatureFlagOverride
+	if err := s.db.Where("user_id = ?", userID).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	overrides := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		overrides[row.Flag] = row.Enabled
+	}
+	return overrides, nil
+}
+
+// SetFeatureFlagOverrides stores the overrides of the user in one database
+// transaction. A nil value removes the override, the flag then follows the
+// configuration again. The flags left out are unchanged.
+func (s *service) SetFeatureFlagOverrides(userID uuid.UUID, overrides map[string]*bool) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for flag, enabled := range overrides {
+			if enabled == nil {
+				if err := tx.Where("user_id = ? AND flag = ?", userID, flag).Delete(&types.FeatureFlagOverride{}).Error; err != nil {
+					return err
+				}
+				continue
+			}
+
+			override := types.FeatureFlagOverride{UserID: userID, Flag: flag, Enabled: *enabled}
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "user_id"}, {Name: "flag"}},
+				DoUpdates: clause.AssignmentColumns([]string{"enabled", "updated_at"}),
+			}).Create(&override).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,153 @@
+package database
+
+import (
+	"FinMa/types"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func (s *service) CreateGoal(goal *types.Goal) error {
+	return s.db.Create(goal).Error
+}
+
+func (s *service) GetGoals(user *types.User) []types.Goal {
+	var goals []types.Goal
+	result := s.db.Where("user_id = ?", user.ID).Order("created_at").Find(&goals)
+
+	if result.Error != nil {
+		log.Error("Error fetching goals: ", result.Error)
+		return nil
+	}
+	return goals
+}
+
+func (s *service) GetGoalByID(id string) types.Goal {
+	var goal types.Goal
+	result := s.db.Where("id = ?", id).First(&goal)
+
+	if result.Error != nil {
+		log.Error("Error fetching goal: ", result.Error)
+		return types.Goal{}
+	}
+	return goal
+}
+
+func (s *service) UpdateGoal(goal *types.Goal) error {
+	return s.db.Save(goal).Error
+}
+
+// DeleteGoal deletes the goal and its contributions. The transactions the
+// contributions were linked to are left untouched.
+func (s *service) DeleteGoal(goal *types.Goal) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("goal_id = ?", goal.ID).Delete(&types.GoalContribution{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(goal).Error
+	})
+}
+
+// GetGoalsContributed returns the total contributed to each of the goals.
+func (s *service) GetGoalsContributed(goalIDs []uuid.UUID) (map[uuid.UUID]types.Money, error) {
+	contributed := make(map[uuid.UUID]types.Money, len(goalIDs))
+	if len(goalIDs) == 0 {
+		return contributed, nil
+	}
+
+	var rows []struct {
+		GoalID uuid.UUID
+		Total  types.Money
+	}
+	result := s.db.Model(&types.GoalContribution{}).
+		Select("goal_id, SUM(amount) AS total").
+		Where("goal_id IN ?", goalIDs).
+		Group("goal_id").
+		Scan(&rows)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	for _, row := range rows {
+		contributed[row.GoalID] = row.Total
+	}
+	return contributed, nil
+}
+
+func (s *service) GetGoalContributions(goalID uuid.UUID) []types.GoalContribution {
+	var contributions []types.GoalContribution
+	result := s.db.Where("goal_id = ?", goalID).Order("date DESC").Find(&contributions)
+
+	if result.Error != nil {
+		log.Error("Error fetching goal contributions: ", result.Error)
+		return nil
+	}
+	return contributions
+}
+
+func (s *service) GetGoalContributionByID(id string) types.GoalContribution {
+	var contribution types.GoalContribution
+	result := s.db.Where("id = ?", id).First(&contribution)
+
+	if result.Error != nil {
+		log.Error("Error fetching goal contribution: ", result.Error)
+		return types.GoalContribution{}
+	}
+	return contribution
+}
+
+func (s *service) CreateGoalContribution(contribution *types.GoalContribution) error {
+	return s.db.Create(contribution).Error
+}
+
+func (s *service) DeleteGoalContribution(contribution *types.GoalContribution) error {
+	return s.db.Delete(contribution).Error
+}
+
+// GetGoalsFundedBy returns the goals the transaction contributes to.
+func (s *service) GetGoalsFundedBy(transaction *types.Transaction) []types.Goal {
+	var goals []types.Goal
+	result := s.db.Where("id IN (?)", s.db.Model(&types.GoalContribution{}).
+		Select("goal_id").Where("transaction_id = ?", transaction.ID)).
+		Find(&goals)
+
+	if result.Error != nil {
+		log.Error("Error fetching goals: ", result.Error)
+		return nil
+	}
+	return goals
+}
+
+// GetActiveGoalsForAccount returns the goals saved on the account that are
+// not completed yet.
+func (s *service) GetActiveGoalsForAccount(accountID uuid.UUID) []types.Goal {
+	var goals []types.Goal
+	result := s.db.Where("bank_account_id = ? AND completed_at IS NULL", accountID).Find(&goals)
+
+	if result.Error != nil {
+		log.Error("Error fetching goals: ", result.Error)
+		return nil
+	}
+	return goals
+}
+
+// SyncTransactionContributions copies the amount and date of the transaction
+// to the contributions linked to it. Contributions sent by an allocation
+// rule are a share of the transaction and keep their amount.
+func (s *service) SyncTransactionContributions(transaction *types.Transaction) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&types.GoalContribution{}).
+			Where("transaction_id = ?", transaction.ID).
+			Update("date", transaction.Date).Error; err != nil {
+			return err
+		}
+		return tx.Model(&types.GoalContribution{}).
+			Where("transaction_id = ? AND rule_id IS NULL", transaction.ID).
+			Update("amount", transaction.Amount).Error
+	})
+}
+
+func (s *service) DeleteTransactionContributions(transactionID uuid.UUID) error {
+	return s.db.Where("transaction_id = ?", transactionID).Delete(&types.GoalContribution{}).Error
+}
@@ -0,0 +1,162 @@
+package database
+
+import (
+	"FinMa/types"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// householdsQuery selects the IDs of the households the user is an active
+// member of.
+func (s *service) householdsQuery(userID uuid.UUID) *gorm.DB {
+	return s.db.Model(&types.HouseholdMember{}).Select("household_id").Where("user_id = ? AND status = 'active'", userID)
+}
+
+// visibleHouseholdsQuery selects the IDs of the households whose shared data
+// the user sees: none when the user chose to see their own data only.
+func (s *service) visibleHouseholdsQuery(user *types.User) *gorm.DB {
+	if user.HouseholdView == "mine" {
+		return s.db.Model(&types.HouseholdMember{}).Select("household_id").Where("1 = 0")
+	}
+	return s.householdsQuery(user.ID)
+}
+
+// householdUsersQuery selects the IDs of the active members of the household.
+func (s *service) householdUsersQuery(householdID uuid.UUID) *gorm.DB {
+	return s.db.Model(&types.HouseholdMember{}).Select("user_id").Where("household_id = ? AND status = 'active'", householdID)
+}
+
+// CreateHousehold creates the household with its owner as first member.
+func (s *service) CreateHousehold(household *types.Household) error {
+	return s.db.Create(household).Error
+}
+
+// GetUserHousehold returns the household the user is an active member of,
+// with its members, or an empty household when there is none.
+func (s *service) GetUserHousehold(userID uuid.UUID) types.Household {
+	var household types.Household
+	result := s.db.Preload("Members", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at")
+	}).Where("id IN (?)", s.householdsQuery(userID)).Limit(1).Find(&household)
+
+	if result.Error != nil {
+		log.Error("Error fetching household: ", result.Error)
+		return types.Household{}
+	}
+	return household
+}
+
+func (s *service) GetHouseholdMemberByID(id string) types.HouseholdMember {
+	var member types.HouseholdMember
+	result := s.db.Where("id = ?", id).First(&member)
+
+	if result.Error != nil {
+		log.Error("Error fetching household member: ", result.Error)
+		return types.HouseholdMember{}
+	}
+	return member
+}
+
+func (s *service) CreateHouseholdMember(member *types.HouseholdMember) error {
+	return s.db.Create(member).Error
+}
+
+// GetPendingHouseholdInvites returns the household invites sent to the email
+// address that were not accepted yet.
+func (s *service) GetPendingHouseholdInvites(email string) []types.HouseholdMember {
+	var members []types.HouseholdMember
+	result := s.db.Where("email = ? AND status = 'pending'", email).Find(&members)
+
+	if result.Error != nil {
+		log.Error("Error fetching pending household invites: ", result.Error)
+		return nil
+	}
+	return members
+}
+
+func (s *service) AcceptHouseholdInvite(member *types.HouseholdMember, user *types.User) error {
+	member.UserID = &user.ID
+	member.Status = "active"
+
+	return s.changed(s.db.Save(member).Error, dataChange{householdID: &member.HouseholdID})
+}
+
+// RemoveHouseholdMember removes the member from the household. The accounts
+// and budgets they shared leave the household but are kept, and their
+// expenses stop counting against the budgets of the household.
+func (s *service) RemoveHouseholdMember(member *types.HouseholdMember) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ?", member.ID).Delete(&types.HouseholdMember{}).Error; err != nil {
+			return err
+		}
+		if member.UserID == nil {
+			return nil
+		}
+
+		if err := tx.Model(&types.BankAccount{}).
+			Where("user_id = ? AND household_id = ?", *member.UserID, member.HouseholdID).
+			Update("household_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&types.Budget{}).
+			Where("user_id = ? AND household_id = ?", *member.UserID, member.HouseholdID).
+			Updates(map[string]interface{}{"household_id": nil, "version": gorm.Expr("version + 1")}).Error; err != nil {
+			return err
+		}
+
+		householdBudgets := tx.Model(&types.Budget{}).Select("id").Where("household_id = ?", member.HouseholdID)
+		return tx.Model(&types.Transaction{}).
+			Where("user_id = ? AND budget_id IN (?)", *member.UserID, householdBudgets).
+			Updates(map[string]interface{}{"budget_id": nil, "version": gorm.Expr("version + 1")}).Error
+	})
+
+	// No longer a member, they would be missed
+	change := dataChange{householdID: &member.HouseholdID}
+	if member.UserID != nil {
+		change.userIDs = []uuid.UUID{*member.UserID}
+	}
+	return s.changed(err, change)
+}
+
+// IsHouseholdMember reports whether the user is an active member of the household.
+func (s *service) IsHouseholdMember(householdID uuid.UUID, userID uuid.UUID) bool {
+	var count int64
+	s.db.Model(&types.HouseholdMember{}).
+		Where("household_id = ? AND user_id = ? AND status = 'active'", householdID, userID).
+		Count(&count)
+	return count > 0
+}
+
+// SetBankAccountHousehold shares the account with a household, or stops
+// sharing it when its household ID is nil.
+func (s *service) SetBankAccountHousehold(account *types.BankAccount) error {
+	err := s.db.Model(&types.BankAccount{}).Where("id = ?", account.ID).Update("household_id", account.HouseholdID).Error
+	return s.changed(err, accountChange(account.ID))
+}
+
+// SetBudgetHousehold shares the budget with a household, or stops sharing
+// it, and moves the expenses it counts accordingly.
+func (s *service) SetBudgetHousehold(budget *types.Budget) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&types.Budget{}).Where("id = ?", budget.ID).
+			Updates(map[string]interface{}{"household_id": budget.HouseholdID, "version": gorm.Expr("version + 1")}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&types.Transaction{}).Where("budget_id = ?", budget.ID).
+			Updates(map[string]interface{}{"budget_id": nil, "version": gorm.Expr("version + 1")}).Error; err != nil {
+			return err
+		}
+		return s.attributeBudgetExpenses(tx, budget)
+	})
+	if err == nil {
+		budget.Version++
+	}
+	return s.changed(err, budgetChange(budget))
+}
+
+func (s *service) UpdateHouseholdView(user *types.User) error {
+	err := s.db.Model(&types.User{}).Where("id = ?", user.ID).Update("household_view", user.HouseholdView).Error
+	return s.changed(err, dataChange{userIDs: []uuid.UUID{user.ID}})
+}
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"FinMa/types"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+)
+
+func (s *service) CreateInterestRate(rate *types.InterestRate) error {
+	result := s.db.Create(rate)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+// GetInterestRates returns the rate history of the account, oldest first.
+func (s *service) GetInterestRates(accountID uuid.UUID) []types.InterestRate {
+	rates := []types.InterestRate{}
+	result := s.db.Where("bank_account_id = ?", accountID).Order("effective_from").Find(&rates)
+
+	if result.Error != nil {
+		log.Error("Error fetching interest rates: ", result.Error)
+		return nil
+	}
+	return rates
+}
+
+// GetRecurringInflow returns the total of the recurring money credited to the
+// account since the given date: recurring incomes and recurring transfers
+// received from another account.
+func (s *service) GetRecurringInflow(accountID uuid.UUID, since time.Time) (types.Money, error) {
+	var total types.Money
+	result := s.db.Model(&types.Transaction{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("is_recurring AND date >= ?", since).
+		Where("(bank_account_id = ? AND type = 'income') OR (transfer_account_id = ? AND type = 'transfer')", accountID, accountID).
+		Scan(&total)
+
+	return total, result.Error
+}
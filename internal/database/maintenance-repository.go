@@ -0,0 +1,35 @@
+package database
+
+import (
+	"FinMa/types"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maintenanceID is the ID of the single row of the maintenance mode.
+const maintenanceID = 1
+
+// GetMaintenance returns the maintenance mode set by the admins, nil when it
+// was never set.
+func (s *service) GetMaintenance() (*types.Maintenance, error) {
+	var maintenance types.Maintenance
+	err := s.db.First(&maintenance, maintenanceID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &maintenance, nil
+}
+
+// SetMaintenance stores the maintenance mode, replacing the previous one.
+func (s *service) SetMaintenance(maintenance *types.Maintenance) error {
+	maintenance.ID = maintenanceID
+	return s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"enabled", "message", "updated_by", "updated_at"}),
+	}).Create(maintenance).Error
+}
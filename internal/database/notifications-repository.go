@@ -0,0 +1,175 @@
+package database
+
+import (
+	"FinMa/types"
+	"errors"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func (s *service) CreateNotification(notification *types.Notification) error {
+	result := s.db.Create(notification)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+// GetNotificationPreferences returns the preferences the user stored, the
+// events left to their defaults are missing.
+func (s *service) GetNotificationPreferences(userID uuid.UUID) []types.NotificationPreference {
+	var preferences []types.NotificationPreference
+	result := s.db.Where("user_id = ?", userID).Order("event").Find(&preferences)
+
+	if result.Error != nil {
+		log.Error("Error fetching notification preferences: ", result.Error)
+		return nil
+	}
+	return preferences
+}
+
+// GetNotificationPreference returns the preference the user stored for the
+// event, and false when there is none.
+func (s *service) GetNotificationPreference(userID uuid.UUID, event string) (types.NotificationPreference, bool) {
+	var preference types.NotificationPreference
+	result := s.db.Where("user_id = ? AND event = ?", userID, event).First(&preference)
+
+	if result.Error != nil {
+		if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			log.Error("Error fetching notification preference: ", result.Error)
+		}
+		return types.NotificationPreference{}, false
+	}
+	return preference, true
+}
+
+// SaveNotificationPreferences creates or replaces the preferences, in a
+// single statement.
+func (s *service) SaveNotificationPreferences(preferences []types.NotificationPreference) error {
+	if len(preferences) == 0 {
+		return nil
+	}
+	return s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "event"}},
+		DoUpdates: clause.AssignmentColumns([]string{"in_app", "email", "push", "updated_at"}),
+	}).Create(&preferences).Error
+}
+
+// RecordKnownDevice stores the device of a login, or refreshes when it was
+// last seen. It returns true when the device is new for a user who already
+// logged in from another one, so that the very first login is not reported.
+func (s *service) RecordKnownDevice(device *types.KnownDevice) (bool, error) {
+	isNew := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&types.KnownDevice{}).
+			Where("user_id = ? AND fingerprint = ?", device.UserID, device.Fingerprint).
+			Update("last_seen_at", device.LastSeenAt)
+		if result.Error != nil || result.RowsAffected > 0 {
+			return result.Error
+		}
+
+		var known int64
+		if err := tx.Model(&types.KnownDevice{}).Where("user_id = ?", device.UserID).Count(&known).Error; err != nil {
+			return err
+		}
+
+		result = tx.Clauses(clause.OnConflict{DoNothing: true}).Omit("User").Create(device)
+		if result.Error != nil {
+			return result.Error
+		}
+		isNew = known > 0 && result.RowsAffected > 0
+		return nil
+	})
+	return isNew, err
+}
+
+// SaveEmailDelivery creates or updates the delivery record of an email.
+func (s *service) SaveEmailDelivery(delivery *types.EmailDelivery) error {
+	return s.db.Save(delivery).Error
+}
+
+// GetUnreadNotifications returns the latest active notifications of the
+// user for the given events.
+func (s *service) GetUnreadNotifications(userID uuid.UUID, events []string, limit int) []types.Notification {
+	var notifications []types.Notification
+	result := s.db.Where("user_id = ? AND is_active AND type IN ?", userID, events).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&notifications)
+
+	if result.Error != nil {
+		log.Error("Error fetching unread notifications: ", result.Error)
+		return nil
+	}
+	return notifications
+}
+
+// GetDigestSubscribers returns up to limit users who turned on the weekly
+// digest email, by id after the given one, to iterate them in batches.
+func (s *service) GetDigestSubscribers(after uuid.UUID, limit int) []types.User {
+	var users []types.User
+	result := s.db.
+		Joins("JOIN notification_preferences ON notification_preferences.user_id = users.id").
+		Where("notification_preferences.event = 'weekly_digest' AND notification_preferences.email AND NOT users.is_demo").
+		Where("users.id > ?", after).
+		Order("users.id").
+		Limit(limit).
+		Find(&users)
+
+	if result.Error != nil {
+		log.Error("Error fetching digest subscribers: ", result.Error)
+		return nil
+	}
+	return users
+}
+
+// ClaimDigest records that the digest scheduled at scheduledAt is being sent
+// to the user. It returns false when it was already claimed, so that a run
+// resuming after a crash or a concurrent one never sends it twice.
+func (s *service) ClaimDigest(userID uuid.UUID, scheduledAt, now time.Time) (bool, error) {
+	result := s.db.Model(&types.User{}).
+		Where("id = ? AND (digest_sent_at IS NULL OR digest_sent_at < ?)", userID, scheduledAt).
+		Update("digest_sent_at", now)
+	return result.RowsAffected > 0, result.Error
+}
+
+// DeleteExpiredNotifications deletes up to limit notifications past their
+// retention and returns how many were deleted. Deleting in small batches
+// keeps the locks short while the application uses the table.
+func (s *service) DeleteExpiredNotifications(retention types.NotificationRetention, limit int) (int64, error) {
+	expired := s.db.Model(&types.Notification{}).Select("id").
+		Where(s.db.
+			Where("type NOT IN ? AND NOT is_active AND created_at < ?", retention.SecurityEvents, retention.ReadBefore).
+			Or("type NOT IN ? AND is_active AND created_at < ?", retention.SecurityEvents, retention.UnreadBefore).
+			Or("type IN ? AND created_at < ?", retention.SecurityEvents, retention.SecurityBefore)).
+		Limit(limit)
+
+	result := s.db.Where("id IN (?)", expired).Delete(&types.Notification{})
+	return result.RowsAffected, result.Error
+}
+
+// GetNotificationActivity lists the notifications of the user with one of
+// the events of the filter, the latest first.
+func (s *service) GetNotificationActivity(userID uuid.UUID, filter types.ActivityFilter) []types.ActivityItem {
+	if len(filter.Events) == 0 {
+		return nil
+	}
+
+	query := s.db.Model(&types.Notification{}).
+		Select("id, type, created_at AS occurred_at, 1 AS count, payload").
+		Where("user_id = ? AND type IN ?", userID, filter.Events)
+	if filter.Before != nil {
+		query = query.Where("(created_at, id) < (?, ?)", *filter.Before, filter.BeforeID)
+	}
+
+	var items []types.ActivityItem
+	if err := query.Order("created_at DESC, id DESC").Limit(filter.Limit).Scan(&items).Error; err != nil {
+		log.Error("Error fetching notification activity: ", err)
+		return nil
+	}
+	return items
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"FinMa/types"
+	"errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrUserHasData is returned when onboarding a user who already has
+// accounts, transactions, budgets or bills.
+var ErrUserHasData = errors.New("the user already has data")
+
+// userHasDataSQL matches the users owning any data onboarding would create,
+// or any transaction.
+const userHasDataSQL = `EXISTS (SELECT 1 FROM bank_accounts WHERE user_id = @user)
+	OR EXISTS (SELECT 1 FROM transactions WHERE user_id = @user)
+	OR EXISTS (SELECT 1 FROM budgets WHERE user_id = @user)
+	OR EXISTS (SELECT 1 FROM bills WHERE user_id = @user)`
+
+// Onboard stores the base currency of the user and creates the accounts,
+// the budgets and the bills of the onboarding, in one transaction. The user
+// row is locked so that two onboardings cannot both pass the check of the
+// user having no data yet.
+func (s *service) Onboard(user *types.User, onboarding *types.Onboarding) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", user.ID).First(&types.User{}).Error; err != nil {
+			return err
+		}
+
+		var hasData bool
+		if err := tx.Raw("SELECT "+userHasDataSQL, map[string]any{"user": user.ID}).Scan(&hasData).Error; err != nil {
+			return err
+		}
+		if hasData {
+			return ErrUserHasData
+		}
+
+		if err := tx.Model(&types.User{}).Where("id = ?", user.ID).Update("base_currency", onboarding.Currency).Error; err != nil {
+			return err
+		}
+		for i := range onboarding.Accounts {
+			onboarding.Accounts[i].SortOrder = i + 1
+		}
+		if len(onboarding.Accounts) > 0 {
+			if err := tx.Create(&onboarding.Accounts).Error; err != nil {
+				return err
+			}
+		}
+		for i := range onboarding.Budgets {
+			if err := s.createBudget(tx, &onboarding.Budgets[i]); err != nil {
+				return err
+			}
+		}
+		if len(onboarding.Bills) > 0 {
+			if err := tx.Omit("User").Create(&onboarding.Bills).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		user.BaseCurrency = onboarding.Currency
+	}
+	return s.changed(err, dataChange{userIDs: []uuid.UUID{user.ID}})
+}
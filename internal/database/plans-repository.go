@@ -0,0 +1,27 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"FinMa/types"
+)
+
+// GetUsage counts the bank accounts the user owns and the transactions they
+// created since the time, in one query.
+func (s *service) GetUsage(userID uuid.UUID, since time.Time) (types.Usage, error) {
+	var usage types.Usage
+	err := s.db.Raw(`SELECT
+		(SELECT COUNT(*) FROM bank_accounts WHERE user_id = ?) AS accounts,
+		(SELECT COUNT(*) FROM transactions WHERE user_id = ? AND created_at >= ?) AS monthly_transactions`,
+		userID, userID, since).Scan(&usage).Error
+	return usage, err
+}
+
+// SetUserPlan stores the plan of the user and the limits set for them over
+// it.
+func (s *service) SetUserPlan(userID uuid.UUID, plan string, overrides map[string]int64) error {
+	return s.db.Model(&types.User{ID: userID}).Select("plan", "limit_overrides").
+		Updates(&types.User{Plan: plan, LimitOverrides: overrides}).Error
+}
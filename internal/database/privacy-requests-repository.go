@@ -0,0 +1,196 @@
+package database
+
+import (
+	"FinMa/types"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func (s *service) CreatePrivacyRequest(request *types.PrivacyRequest) error {
+	return s.db.Create(request).Error
+}
+
+func (s *service) UpdatePrivacyRequest(request *types.PrivacyRequest) error {
+	return s.db.Save(request).Error
+}
+
+// GetPrivacyRequests lists the privacy requests of the user, the latest
+// first.
+func (s *service) GetPrivacyRequests(userID uuid.UUID) []types.PrivacyRequest {
+	var requests []types.PrivacyRequest
+	if err := s.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&requests).Error; err != nil {
+		log.Error("Error fetching privacy requests: ", err)
+		return nil
+	}
+	return requests
+}
+
+func (s *service) GetPrivacyRequestByID(id string) types.PrivacyRequest {
+	var request types.PrivacyRequest
+	s.db.Where("id = ?", id).First(&request)
+	return request
+}
+
+// GetPrivacyRequestsByStatus lists the privacy requests in one of the
+// statuses, the oldest first.
+func (s *service) GetPrivacyRequestsByStatus(statuses []string, limit int) []types.PrivacyRequest {
+	var requests []types.PrivacyRequest
+	if err := s.db.Where("status IN ?", statuses).Order("created_at").Limit(limit).Find(&requests).Error; err != nil {
+		log.Error("Error fetching privacy requests: ", err)
+		return nil
+	}
+	return requests
+}
+
+// GetDuePrivacyRequests lists the scheduled erasures whose grace period is
+// over and the ready exports whose archive expired.
+func (s *service) GetDuePrivacyRequests(now time.Time, limit int) []types.PrivacyRequest {
+	var requests []types.PrivacyRequest
+	err := s.db.
+		Where("(status = 'scheduled' AND scheduled_for <= ?) OR (status = 'ready' AND expires_at <= ?)", now, now).
+		Order("created_at").
+		Limit(limit).
+		Find(&requests).Error
+	if err != nil {
+		log.Error("Error fetching due privacy requests: ", err)
+		return nil
+	}
+	return requests
+}
+
+// ClaimPrivacyRequest moves the request from the status to the next one,
+// and returns false when another status was set since it was loaded, like
+// an erasure canceled as it was about to run.
+func (s *service) ClaimPrivacyRequest(request *types.PrivacyRequest, next string) (bool, error) {
+	result := s.db.Model(&types.PrivacyRequest{}).
+		Where("id = ? AND status = ?", request.ID, request.Status).
+		Updates(map[string]any{"status": next, "updated_at": time.Now()})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	request.Status = next
+	return true, nil
+}
+
+// erasureStatement is a statement of EraseUser, counted under its table.
+// @user is the erased user, @email their email and @nil the nil UUID.
+type erasureStatement struct {
+	table string
+	sql   string
+}
+
+const (
+	erasedAccounts     = "SELECT id FROM bank_accounts WHERE user_id = @user"
+	erasedTransactions = "SELECT id FROM transactions WHERE user_id = @user OR bank_account_id IN (" + erasedAccounts + ")"
+	erasedBudgets      = "SELECT id FROM budgets WHERE user_id = @user"
+	erasedHouseholds   = "SELECT id FROM households WHERE owner_id = @user"
+)
+
+// erasureAnonymizations keep the rows the other users still need, without
+// the erased user: their transactions and reconciliations on the accounts
+// of others pass to the owner of the account, the audit log keeps the
+// events without their actor. The links of the data of others to the
+// erased data are cut.
+var erasureAnonymizations = []erasureStatement{
+	{"transactions", `UPDATE transactions SET user_id = bank_accounts.user_id, version = transactions.version + 1 FROM bank_accounts
+		WHERE transactions.bank_account_id = bank_accounts.id AND transactions.user_id = @user AND bank_accounts.user_id <> @user`},
+	{"reconciliations", `UPDATE reconciliations SET user_id = bank_accounts.user_id FROM bank_accounts
+		WHERE reconciliations.bank_account_id = bank_accounts.id AND reconciliations.user_id = @user AND bank_accounts.user_id <> @user`},
+	{"audit_logs", `UPDATE audit_logs SET
+			user_id = CASE WHEN user_id = @user THEN @nil ELSE user_id END,
+			entity_id = CASE WHEN entity_type = 'user' AND entity_id = @user THEN @nil ELSE entity_id END,
+			details = CASE WHEN @email <> '' THEN replace(details, @email, '[erased]') ELSE details END
+		WHERE user_id = @user OR (entity_type = 'user' AND entity_id = @user) OR (@email <> '' AND strpos(details, @email) > 0)`},
+	{"", "UPDATE transactions SET transfer_account_id = NULL, version = version + 1 WHERE transfer_account_id IN (" + erasedAccounts + ") AND id NOT IN (" + erasedTransactions + ")"},
+	{"", "UPDATE transactions SET budget_id = NULL, version = version + 1 WHERE budget_id IN (" + erasedBudgets + ") AND id NOT IN (" + erasedTransactions + ")"},
+	{"", "UPDATE goal_contributions SET transaction_id = NULL WHERE transaction_id IN (" + erasedTransactions + ") AND goal_id NOT IN (SELECT id FROM goals WHERE user_id = @user)"},
+	{"", "UPDATE bill_payments SET transaction_id = NULL WHERE transaction_id IN (" + erasedTransactions + ") AND bill_id NOT IN (SELECT id FROM bills WHERE user_id = @user)"},
+	{"", "UPDATE allocation_rule_steps SET budget_id = NULL WHERE budget_id IN (" + erasedBudgets + ") AND rule_id NOT IN (SELECT id FROM allocation_rules WHERE user_id = @user)"},
+	{"", "UPDATE allocations SET transaction_id = NULL WHERE transaction_id IN (" + erasedTransactions + ") AND user_id <> @user"},
+	{"", "UPDATE bank_accounts SET household_id = NULL WHERE household_id IN (" + erasedHouseholds + ") AND user_id <> @user"},
+	{"", "UPDATE budgets SET household_id = NULL WHERE household_id IN (" + erasedHouseholds + ") AND user_id <> @user"},
+}
+
+// erasureDeletions delete the data of the erased user, the rows
+// referencing others before them.
+var erasureDeletions = []erasureStatement{
+	{"goal_contributions", "DELETE FROM goal_contributions WHERE goal_id IN (SELECT id FROM goals WHERE user_id = @user)"},
+	{"allocation_rule_runs", "DELETE FROM allocation_rule_runs WHERE rule_id IN (SELECT id FROM allocation_rules WHERE user_id = @user) OR transaction_id IN (" + erasedTransactions + ")"},
+	{"allocation_rule_steps", "DELETE FROM allocation_rule_steps WHERE rule_id IN (SELECT id FROM allocation_rules WHERE user_id = @user)"},
+	{"allocations", "DELETE FROM allocations WHERE user_id = @user OR budget_id IN (" + erasedBudgets + ")"},
+	{"bill_payments", "DELETE FROM bill_payments WHERE bill_id IN (SELECT id FROM bills WHERE user_id = @user)"},
+	{"budget_periods", "DELETE FROM budget_periods WHERE budget_id IN (" + erasedBudgets + ")"},
+	{"budget_categories", "DELETE FROM budget_categories WHERE budget_id IN (" + erasedBudgets + ")"},
+	{"budget_alerts", "DELETE FROM budget_alerts WHERE budget_id IN (" + erasedBudgets + ")"},
+	{"closed_budget_periods", "DELETE FROM closed_budget_periods WHERE budget_id IN (" + erasedBudgets + ")"},
+	{"budget_template_items", "DELETE FROM budget_template_items WHERE template_id IN (SELECT id FROM budget_templates WHERE user_id = @user)"},
+	{"tax_categories", "DELETE FROM tax_categories WHERE setting_id IN (SELECT id FROM tax_settings WHERE user_id = @user)"},
+	{"report_deliveries", "DELETE FROM report_deliveries WHERE user_id = @user"},
+	{"report_schedules", "DELETE FROM report_schedules WHERE user_id = @user"},
+	{"report_definitions", "DELETE FROM report_definitions WHERE user_id = @user"},
+	{"transactions", "DELETE FROM transactions WHERE id IN (" + erasedTransactions + ")"},
+	{"balance_snapshots", "DELETE FROM balance_snapshots WHERE bank_account_id IN (" + erasedAccounts + ")"},
+	{"interest_rates", "DELETE FROM interest_rates WHERE bank_account_id IN (" + erasedAccounts + ")"},
+	{"reconciliations", "DELETE FROM reconciliations WHERE bank_account_id IN (" + erasedAccounts + ")"},
+	{"account_members", "DELETE FROM account_members WHERE bank_account_id IN (" + erasedAccounts + ") OR user_id = @user OR email = @email"},
+	{"bank_accounts", "DELETE FROM bank_accounts WHERE user_id = @user"},
+	{"bank_connections", "DELETE FROM bank_connections WHERE user_id = @user"},
+	{"household_members", "DELETE FROM household_members WHERE household_id IN (" + erasedHouseholds + ") OR user_id = @user OR email = @email"},
+	{"households", "DELETE FROM households WHERE owner_id = @user"},
+	{"budgets", "DELETE FROM budgets WHERE user_id = @user"},
+	{"budget_templates", "DELETE FROM budget_templates WHERE user_id = @user"},
+	{"goals", "DELETE FROM goals WHERE user_id = @user"},
+	{"bills", "DELETE FROM bills WHERE user_id = @user"},
+	{"subscriptions", "DELETE FROM subscriptions WHERE user_id = @user"},
+	{"allocation_rules", "DELETE FROM allocation_rules WHERE user_id = @user"},
+	{"category_settings", "DELETE FROM category_settings WHERE user_id = @user"},
+	{"tax_settings", "DELETE FROM tax_settings WHERE user_id = @user"},
+	{"anomaly_mutes", "DELETE FROM anomaly_mutes WHERE user_id = @user"},
+	{"feature_flag_overrides", "DELETE FROM feature_flag_overrides WHERE user_id = @user"},
+	{"billing_accounts", "DELETE FROM billing_accounts WHERE user_id = @user"},
+	{"notification_preferences", "DELETE FROM notification_preferences WHERE user_id = @user"},
+	{"notifications", "DELETE FROM notifications WHERE user_id = @user"},
+	{"push_subscriptions", "DELETE FROM push_subscriptions WHERE user_id = @user"},
+	{"known_devices", "DELETE FROM known_devices WHERE user_id = @user"},
+	{"share_grants", "DELETE FROM share_grants WHERE user_id = @user OR grantee_id = @user"},
+	{"email_deliveries", "DELETE FROM email_deliveries WHERE user_id = @user OR recipient = @email"},
+	{"privacy_requests", "DELETE FROM privacy_requests WHERE user_id = @user AND kind = 'export'"},
+	{"users", "DELETE FROM users WHERE id = @user"},
+}
+
+// EraseUser deletes the user and every row of their data, in one
+// transaction, and returns the rows deleted and anonymized per table. The
+// erasure requests of the user are kept, for their certificate.
+func (s *service) EraseUser(user *types.User) (deleted, anonymized map[string]int64, err error) {
+	deleted, anonymized = map[string]int64{}, map[string]int64{}
+	params := map[string]any{"user": user.ID, "email": user.Email, "nil": uuid.Nil}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		for _, statement := range erasureAnonymizations {
+			result := tx.Exec(statement.sql, params)
+			if result.Error != nil {
+				return result.Error
+			}
+			if statement.table != "" && result.RowsAffected > 0 {
+				anonymized[statement.table] += result.RowsAffected
+			}
+		}
+		for _, statement := range erasureDeletions {
+			result := tx.Exec(statement.sql, params)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				deleted[statement.table] += result.RowsAffected
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return deleted, anonymized, nil
+}
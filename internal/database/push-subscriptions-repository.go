@@ -0,0 +1,42 @@
+package database
+
+import (
+	"FinMa/types"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+	"gorm.io/gorm/clause"
+)
+
+// SavePushSubscription stores the subscription of a browser. A browser
+// subscribing again keeps its endpoint, the keys and owner are replaced.
+func (s *service) SavePushSubscription(subscription *types.PushSubscription) error {
+	return s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "endpoint"}},
+		DoUpdates: clause.AssignmentColumns([]string{"p256dh", "auth", "user_agent", "user_id", "updated_at"}),
+	}).Omit("User").Create(subscription).Error
+}
+
+func (s *service) GetPushSubscriptions(userID uuid.UUID) []types.PushSubscription {
+	var subscriptions []types.PushSubscription
+	result := s.db.Where("user_id = ?", userID).Order("created_at").Find(&subscriptions)
+
+	if result.Error != nil {
+		log.Error("Error fetching push subscriptions: ", result.Error)
+		return nil
+	}
+	return subscriptions
+}
+
+// DeletePushSubscription removes a subscription of the user, it returns
+// false when the user has no subscription with that endpoint.
+func (s *service) DeletePushSubscription(userID uuid.UUID, endpoint string) (bool, error) {
+	result := s.db.Where("user_id = ? AND endpoint = ?", userID, endpoint).Delete(&types.PushSubscription{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// DeletePushSubscriptionByEndpoint removes a subscription the push service
+// reported as expired.
+func (s *service) DeletePushSubscriptionByEndpoint(endpoint string) error {
+	return s.db.Where("endpoint = ?", endpoint).Delete(&types.PushSubscription{}).Error
+}
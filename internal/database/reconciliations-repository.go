@@ -0,0 +1,100 @@
+package database
+
+import (
+	"FinMa/types"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func (s *service) CreateReconciliation(reconciliation *types.Reconciliation) error {
+	result := s.db.Create(reconciliation)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+func (s *service) GetReconciliations(accountID uuid.UUID) []types.Reconciliation {
+	var reconciliations []types.Reconciliation
+	result := s.db.Where("bank_account_id = ?", accountID).Order("statement_date DESC").Find(&reconciliations)
+
+	if result.Error != nil {
+		log.Error("Error fetching reconciliations: ", result.Error)
+		return nil
+	}
+	return reconciliations
+}
+
+func (s *service) GetReconciliationByID(id string) types.Reconciliation {
+	var reconciliation types.Reconciliation
+	result := s.db.Where("id = ?", id).First(&reconciliation)
+
+	if result.Error != nil {
+		log.Error("Error fetching reconciliation: ", result.Error)
+		return types.Reconciliation{}
+	}
+	return reconciliation
+}
+
+func (s *service) GetOpenReconciliation(accountID uuid.UUID) types.Reconciliation {
+	var reconciliation types.Reconciliation
+	s.db.Where("bank_account_id = ? AND status = 'open'", accountID).Limit(1).Find(&reconciliation)
+	return reconciliation
+}
+
+// GetReconciledTotal returns the sum of the reconciled transactions of the
+// account dated up to the given date.
+func (s *service) GetReconciledTotal(accountID uuid.UUID, until time.Time) (types.Money, error) {
+	var total types.Money
+	result := s.db.Model(&types.Transaction{}).
+		Select("COALESCE(SUM("+signedAmountSQL+"), 0)").
+		Where("bank_account_id = ? AND is_reconciled AND date <= ?", accountID, until).
+		Scan(&total)
+
+	return total, result.Error
+}
+
+// ReconcileTransactions marks the given transactions of the reconciliation
+// account as reconciled. Transactions of other accounts, dated after the
+// statement or already reconciled are ignored.
+func (s *service) ReconcileTransactions(reconciliation *types.Reconciliation, transactionIDs []uuid.UUID) (int64, error) {
+	result := s.db.Model(&types.Transaction{}).
+		Where("id IN ? AND bank_account_id = ? AND date <= ? AND NOT is_reconciled",
+			transactionIDs, reconciliation.BankAccountID, reconciliation.StatementDate).
+		Updates(map[string]interface{}{
+			"is_reconciled":     true,
+			"reconciliation_id": reconciliation.ID,
+			"version":           gorm.Expr("version + 1"),
+		})
+
+	return result.RowsAffected, result.Error
+}
+
+func (s *service) CloseReconciliation(reconciliation *types.Reconciliation) error {
+	now := time.Now()
+	reconciliation.Status = "closed"
+	reconciliation.ClosedAt = &now
+
+	result := s.db.Save(reconciliation)
+	return result.Error
+}
+
+func (s *service) UnreconcileTransaction(transaction *types.Transaction) error {
+	transaction.IsReconciled = false
+	transaction.ReconciliationID = nil
+
+	result := s.db.Model(&types.Transaction{}).
+		Where("id = ?", transaction.ID).
+		Updates(map[string]interface{}{
+			"is_reconciled":     false,
+			"reconciliation_id": nil,
+			"version":           gorm.Expr("version + 1"),
+		})
+	if result.Error == nil {
+		transaction.Version++
+	}
+	return result.Error
+}
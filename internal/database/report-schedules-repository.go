@@ -0,0 +1,105 @@
+package database
+
+import (
+	"FinMa/types"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func (s *service) CreateReportSchedule(schedule *types.ReportSchedule) error {
+	return s.db.Omit("User").Create(schedule).Error
+}
+
+func (s *service) GetReportSchedules(userID uuid.UUID) []types.ReportSchedule {
+	var schedules []types.ReportSchedule
+	result := s.db.Where("user_id = ?", userID).Order("created_at").Find(&schedules)
+
+	if result.Error != nil {
+		log.Error("Error fetching report schedules: ", result.Error)
+		return nil
+	}
+	return schedules
+}
+
+func (s *service) GetReportScheduleByID(id string) types.ReportSchedule {
+	var schedule types.ReportSchedule
+	result := s.db.Where("id = ?", id).First(&schedule)
+
+	if result.Error != nil {
+		log.Error("Error fetching report schedule: ", result.Error)
+		return types.ReportSchedule{}
+	}
+	return schedule
+}
+
+func (s *service) UpdateReportSchedule(schedule *types.ReportSchedule) error {
+	return s.db.Omit("User").Save(schedule).Error
+}
+
+// DeleteReportSchedule deletes the schedule, its deliveries are kept.
+func (s *service) DeleteReportSchedule(schedule *types.ReportSchedule) error {
+	return s.db.Delete(schedule).Error
+}
+
+// GetDueReportSchedules returns up to limit schedules not paused whose next
+// run is at now or before, by id after the given one, with their user, to
+// iterate them in batches.
+func (s *service) GetDueReportSchedules(now time.Time, after uuid.UUID, limit int) []types.ReportSchedule {
+	var schedules []types.ReportSchedule
+	result := s.db.Preload("User").
+		Where("NOT paused AND next_run_at <= ? AND id > ?", now, after).
+		Order("id").
+		Limit(limit).
+		Find(&schedules)
+
+	if result.Error != nil {
+		log.Error("Error fetching due report schedules: ", result.Error)
+		return nil
+	}
+	return schedules
+}
+
+// ClaimReportSchedule moves the next run of the schedule to next. It
+// returns false when the run was already claimed or the schedule paused or
+// changed since it was loaded, so that a run is never delivered twice.
+func (s *service) ClaimReportSchedule(schedule *types.ReportSchedule, next time.Time) (bool, error) {
+	result := s.db.Model(&types.ReportSchedule{}).
+		Where("id = ? AND next_run_at = ? AND NOT paused", schedule.ID, schedule.NextRunAt).
+		Update("next_run_at", next)
+	return result.RowsAffected > 0, result.Error
+}
+
+// RecordReportDelivery saves the delivery and the status of the last run of
+// its schedule: its failures and whether it is paused.
+func (s *service) RecordReportDelivery(schedule *types.ReportSchedule, delivery *types.ReportDelivery) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(delivery).Error; err != nil {
+			return err
+		}
+		return tx.Model(schedule).
+			Select("paused", "failures", "last_run_at", "last_status", "last_error").
+			Updates(schedule).Error
+	})
+}
+
+// GetReportDeliveries returns the latest deliveries of the schedule, or of
+// every schedule when nil, with the status of their email.
+func (s *service) GetReportDeliveries(scheduleID *uuid.UUID, limit int) []types.ReportDelivery {
+	var deliveries []types.ReportDelivery
+	query := s.db.Model(&types.ReportDelivery{}).
+		Select("report_deliveries.*, email_deliveries.status AS email_status").
+		Joins("LEFT JOIN email_deliveries ON email_deliveries.id = report_deliveries.email_delivery_id")
+	if scheduleID != nil {
+		query = query.Where("report_deliveries.schedule_id = ?", *scheduleID)
+	}
+	result := query.Order("report_deliveries.created_at DESC").Limit(limit).Find(&deliveries)
+
+	if result.Error != nil {
+		log.Error("Error fetching report deliveries: ", result.Error)
+		return nil
+	}
+	return deliveries
+}
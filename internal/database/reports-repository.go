@@ -0,0 +1,321 @@
+package database
+
+import (
+	"FinMa/types"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// incomeAndExpensesSQL sums the income and the expenses of the rows of
+// incomeAndExpensesQuery.
+const incomeAndExpensesSQL = `COALESCE(SUM(amount) FILTER (WHERE type = 'income'), 0) AS income,
+	COALESCE(SUM(amount) FILTER (WHERE type = 'expense'), 0) AS expenses`
+
+// incomeAndExpensesQuery selects the income and the expenses of the user
+// dated in [from, to), restricted by the filter, in their base currency.
+// The transfers and the transactions excluded from the budgets are left
+// out. It is shared by the monthly totals of the dashboard and the reports,
+// which select incomeAndExpensesSQL and group it as they need.
+func (s *service) incomeAndExpensesQuery(user *types.User, from, to time.Time, filter types.ReportFilter) *gorm.DB {
+	query := s.convertedTransactions(s.db, s.baseCurrency(user)).
+		Where("user_id = ? AND type IN ('income', 'expense') AND NOT exclude_from_budgets AND date >= ? AND date < ?", user.ID, from, to)
+	if len(filter.AccountIDs) > 0 {
+		query = query.Where("bank_account_id IN ?", filter.AccountIDs)
+	}
+	if filter.Category != "" {
+		query = query.Where("category = ?", filter.Category)
+	}
+	return query
+}
+
+// GetSpendingPatterns aggregates the expenses of the user between from and to
+// by day of the week and by day of the month, in the given timezone and in
+// their base currency.
+// An empty category includes every category. Expenses excluded from the
+// budgets are only summed in Excluded.
+func (s *service) GetSpendingPatterns(user *types.User, from, to time.Time, category, timezone string) (types.SpendingPatterns, error) {
+	patterns := types.SpendingPatterns{
+		From:     from,
+		To:       to,
+		Timezone: timezone,
+	}
+
+	var err error
+	patterns.ByWeekday, err = s.spendingPatternBuckets("DOW", user, from, to, category, timezone)
+	if err != nil {
+		return patterns, err
+	}
+
+	patterns.ByDayOfMonth, err = s.spendingPatternBuckets("DAY", user, from, to, category, timezone)
+	if err != nil {
+		return patterns, err
+	}
+
+	query := s.convertedTransactions(s.db, s.baseCurrency(user)).
+		Select("COALESCE(SUM(amount), 0) AS total, COUNT(*) AS count").
+		Where("user_id = ? AND type = 'expense' AND exclude_from_budgets AND date BETWEEN ? AND ?", user.ID, from, to)
+	if category != "" {
+		query = query.Where("category = ?", category)
+	}
+	if err := query.Scan(&patterns.Excluded).Error; err != nil {
+		return patterns, err
+	}
+
+	return patterns, nil
+}
+
+// spendingPatternBuckets runs the grouped query for one EXTRACT field.
+// field is never user provided, it is either "DOW" or "DAY".
+func (s *service) spendingPatternBuckets(field string, user *types.User, from, to time.Time, category, timezone string) ([]types.SpendingPatternBucket, error) {
+	buckets := []types.SpendingPatternBucket{}
+
+	query := s.convertedTransactions(s.db, s.baseCurrency(user)).
+		Select("EXTRACT("+field+" FROM date AT TIME ZONE ?)::int AS bucket, SUM(amount) AS total, ROUND(AVG(amount), ?) AS average, COUNT(*) AS count", timezone, types.CurrencyDigits(s.baseCurrency(user))).
+		Where("user_id = ? AND type = 'expense' AND NOT exclude_from_budgets AND date BETWEEN ? AND ?", user.ID, from, to)
+
+	if category != "" {
+		query = query.Where("category = ?", category)
+	}
+
+	result := query.Group("bucket").Order("bucket").Scan(&buckets)
+	return buckets, result.Error
+}
+
+// GetMonthlyAccountFlows returns, for every account the user can access, the
+// net amount of its transactions grouped by month in the given timezone.
+func (s *service) GetMonthlyAccountFlows(user *types.User, timezone string, excludeShared bool) []types.AccountMonthlyFlow {
+	flows := []types.AccountMonthlyFlow{}
+	result := s.db.Raw(`
+		SELECT account_id, date_trunc('month', date AT TIME ZONE ?) AS month, SUM(net) AS net
+		FROM (`+accountFlowsSQL+`) flows
+		WHERE account_id IN (?)
+		GROUP BY account_id, month
+		ORDER BY month`, timezone, s.accessibleAccountsQuery(user, excludeShared)).
+		Scan(&flows)
+
+	if result.Error != nil {
+		log.Error("Error fetching monthly account flows: ", result.Error)
+		return nil
+	}
+	return flows
+}
+
+// GetCashFlow sums the income and the expenses of the user dated in
+// [from, to), restricted by the filter, by month or by week, in the given timezone, in one grouped
+// query. Only the buckets holding transactions are returned, oldest first,
+// their start is the local date at midnight. granularity is never user
+// provided, it is either "month" or "week".
+func (s *service) GetCashFlow(user *types.User, from, to time.Time, granularity, timezone string, filter types.ReportFilter) ([]types.CashFlowBucket, error) {
+	buckets := []types.CashFlowBucket{}
+	result := s.incomeAndExpensesQuery(user, from, to, filter).
+		Select("date_trunc('"+granularity+"', date AT TIME ZONE ?) AS start, "+incomeAndExpensesSQL, timezone).
+		Group("1").
+		Order("1").
+		Scan(&buckets)
+
+	return buckets, result.Error
+}
+
+// GetFirstTransactionDate returns the date of the oldest transaction of the
+// user, nil without transactions. The reports tell the months before it,
+// not covered by the history, from the months without spending.
+func (s *service) GetFirstTransactionDate(user *types.User) (*time.Time, error) {
+	var first *time.Time
+	result := s.db.Model(&types.Transaction{}).
+		Select("MIN(date)").
+		Where("user_id = ?", user.ID).
+		Scan(&first)
+
+	return first, result.Error
+}
+
+// GetCategoryMonthlyTotals sums the expenses of the user dated in [from, to)
+// by category and by month, in the given timezone, in one grouped query. The
+// month is the local date at midnight. The expenses excluded from the
+// budgets are left out.
+func (s *service) GetCategoryMonthlyTotals(user *types.User, from, to time.Time, timezone string) ([]types.CategoryMonthTotal, error) {
+	totals := []types.CategoryMonthTotal{}
+	result := s.incomeAndExpensesQuery(user, from, to, types.ReportFilter{}).
+		Select("category, date_trunc('month', date AT TIME ZONE ?) AS month, SUM(amount) AS total, COUNT(*) AS count", timezone).
+		Where("type = 'expense'").
+		Group("category, 2").
+		Order("category, 2").
+		Scan(&totals)
+
+	return totals, result.Error
+}
+
+// merchantSQL is the merchant of a transaction: its description lowercased,
+// without its digits and punctuation, so that "CARREFOUR 0412" and
+// "Carrefour #0519" group together. It is null for the descriptions without
+// letters.
+const merchantSQL = `NULLIF(btrim(regexp_replace(lower(description), '[^[:alpha:]]+', ' ', 'g')), '')`
+
+// GetMerchantSpending ranks the merchants of the expenses of the user dated
+// in [from, to) by total spent, with the page of limit merchants from offset
+// and the number of merchants. A merchant charged at least three times is
+// recurring when every charge follows the previous one by a month, give or
+// take three days, or by a week, give or take a day. The expenses excluded
+// from the budgets are left out.
+func (s *service) GetMerchantSpending(user *types.User, from, to time.Time, limit, offset int) ([]types.MerchantSpending, int64, error) {
+	expenses := s.incomeAndExpensesQuery(user, from, to, types.ReportFilter{}).
+		Select(merchantSQL + " AS merchant, amount, date").
+		Where("type = 'expense'")
+
+	var rows []struct {
+		types.MerchantSpending
+		Merchants int64
+	}
+	result := s.db.Raw(`
+		WITH charges AS (
+			SELECT merchant, amount, date,
+				EXTRACT(EPOCH FROM date - LAG(date) OVER (PARTITION BY merchant ORDER BY date)) / 86400 AS gap
+			FROM (?) expenses
+			WHERE merchant IS NOT NULL
+		)
+		SELECT merchant, SUM(amount) AS total, COUNT(*) AS count, ROUND(AVG(amount), ?) AS average,
+			MIN(date) AS first_seen, MAX(date) AS last_seen,
+			CASE
+				WHEN COUNT(*) < 3 THEN NULL
+				WHEN bool_and(gap IS NULL OR gap BETWEEN 25 AND 34) THEN 'monthly'
+				WHEN bool_and(gap IS NULL OR gap BETWEEN 6 AND 8) THEN 'weekly'
+			END AS cadence,
+			COUNT(*) OVER () AS merchants
+		FROM charges
+		GROUP BY merchant
+		ORDER BY total DESC, merchant
+		LIMIT ? OFFSET ?`, expenses, types.CurrencyDigits(s.baseCurrency(user)), limit, offset).
+		Scan(&rows)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+
+	merchants := make([]types.MerchantSpending, len(rows))
+	var count int64
+	for i, row := range rows {
+		merchants[i] = row.MerchantSpending
+		merchants[i].Recurring = row.Cadence != nil
+		count = row.Merchants
+	}
+	// Past the last page the count is unknown, the page is empty anyway
+	return merchants, count, nil
+}
+
+// GetFlowTotals sums the transactions of the user dated in [from, to) by
+// account and counterpart, in their base currency: the income by merchant,
+// or by category without one, the expenses by category and the transfers by
+// account credited. The transactions excluded from the budgets are left
+// out, but for the transfers.
+func (s *service) GetFlowTotals(user *types.User, from, to time.Time) ([]types.FlowTotal, error) {
+	income := s.incomeAndExpensesQuery(user, from, to, types.ReportFilter{}).
+		Select("'income' AS type, bank_account_id AS account_id, COALESCE(" + merchantSQL + ", category) AS counterpart, SUM(amount) AS total").
+		Where("type = 'income'").
+		Group("2, 3")
+	expenses := s.incomeAndExpensesQuery(user, from, to, types.ReportFilter{}).
+		Select("'expense' AS type, bank_account_id AS account_id, category AS counterpart, SUM(amount) AS total").
+		Where("type = 'expense'").
+		Group("2, 3")
+	transfers := s.convertedTransactions(s.db, s.baseCurrency(user)).
+		Select("'transfer' AS type, bank_account_id AS account_id, transfer_account_id::text AS counterpart, SUM(amount) AS total").
+		Where("user_id = ? AND type = 'transfer' AND transfer_account_id IS NOT NULL AND date >= ? AND date < ?", user.ID, from, to).
+		Group("2, 3")
+
+	totals := []types.FlowTotal{}
+	result := s.db.Raw("(?) UNION ALL (?) UNION ALL (?)", income, expenses, transfers).Scan(&totals)
+	return totals, result.Error
+}
+
+// GetScheduledFlows lists the transactions of the account dated in
+// (after, until], the ones already entered ahead of their date, with their
+// signed contribution to its balance. The transfers credited to the account
+// are included.
+func (s *service) GetScheduledFlows(accountID uuid.UUID, after, until time.Time) ([]types.ForecastItem, error) {
+	items := []types.ForecastItem{}
+	result := s.db.Raw(`
+		SELECT flows.date, flows.net AS amount, transactions.description, 'scheduled' AS source
+		FROM (`+accountFlowsSQL+`) flows
+		JOIN transactions ON transactions.id = flows.id
+		WHERE flows.account_id = ? AND flows.date > ? AND flows.date <= ?
+		ORDER BY flows.date`, accountID, after, until).
+		Scan(&items)
+	return items, result.Error
+}
+
+// GetDiscretionarySpending sums the expenses of the account dated in
+// [from, to) that are neither recurring nor the payment of a bill.
+func (s *service) GetDiscretionarySpending(accountID uuid.UUID, from, to time.Time) (types.Money, error) {
+	var total types.Money
+	result := s.db.Model(&types.Transaction{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("bank_account_id = ? AND type = 'expense' AND NOT is_recurring AND date >= ? AND date < ?", accountID, from, to).
+		Where("id NOT IN (?)", s.db.Model(&types.BillPayment{}).Select("transaction_id").Where("transaction_id IS NOT NULL")).
+		Scan(&total)
+	return total, result.Error
+}
+
+// GetCardPaymentAccount returns the account the credit card was last paid
+// from, the account of the last transfer to it, nil when it never was.
+func (s *service) GetCardPaymentAccount(cardID uuid.UUID) (*uuid.UUID, error) {
+	var accountIDs []uuid.UUID
+	result := s.db.Model(&types.Transaction{}).
+		Where("type = 'transfer' AND transfer_account_id = ?", cardID).
+		Order("date DESC").
+		Limit(1).
+		Pluck("bank_account_id", &accountIDs)
+	if result.Error != nil || len(accountIDs) == 0 {
+		return nil, result.Error
+	}
+	return &accountIDs[0], nil
+}
+
+// GetTaxTransactions lists the expenses and the income of the user in the
+// categories dated in [from, to), by date, the income counted against the
+// expenses as refunds, in their base currency. The transactions excluded
+// from the budgets are included: the tax return does not follow the budgets.
+func (s *service) GetTaxTransactions(user *types.User, categories []string, from, to time.Time) ([]types.TaxTransaction, error) {
+	transactions := []types.TaxTransaction{}
+	result := s.convertedTransactions(s.db, s.baseCurrency(user)).
+		Select("id, date, description, category, CASE WHEN type = 'income' THEN -amount ELSE amount END AS amount, bank_account_id").
+		Where("user_id = ? AND type IN ('income', 'expense') AND category IN ? AND date >= ? AND date < ?", user.ID, categories, from, to).
+		Order("date, id").
+		Scan(&transactions)
+	return transactions, result.Error
+}
+
+// GetDailySpending sums the income and the expenses of the user dated in
+// [from, to) by day, in the given timezone, the expenses of the categories
+// the user flagged essential apart. The day is the local date at midnight,
+// the days without transactions are left out. The transfers and the
+// transactions excluded from the budgets are left out.
+func (s *service) GetDailySpending(user *types.User, from, to time.Time, timezone string) ([]types.DailySpending, error) {
+	essential := s.db.Model(&types.CategorySetting{}).Select("category").Where("user_id = ? AND essential", user.ID)
+
+	days := []types.DailySpending{}
+	result := s.incomeAndExpensesQuery(user, from, to, types.ReportFilter{}).
+		Select(`date_trunc('day', date AT TIME ZONE ?) AS day,
+			COALESCE(SUM(amount) FILTER (WHERE type = 'income'), 0) AS income,
+			COALESCE(SUM(amount) FILTER (WHERE type = 'expense' AND category IN (?)), 0) AS essential,
+			COALESCE(SUM(amount) FILTER (WHERE type = 'expense' AND category NOT IN (?)), 0) AS discretionary`, timezone, essential, essential).
+		Group("1").
+		Order("1").
+		Scan(&days)
+	return days, result.Error
+}
+
+// GetDailyExpenses sums the expenses of the user dated in [from, to) by day,
+// in the given timezone, restricted by the filter. The day is the local date
+// at midnight, the days without expenses are left out. The expenses
+// excluded from the budgets are left out.
+func (s *service) GetDailyExpenses(user *types.User, from, to time.Time, timezone string, filter types.ReportFilter) ([]types.DayTotal, error) {
+	totals := []types.DayTotal{}
+	result := s.incomeAndExpensesQuery(user, from, to, filter).
+		Select("date_trunc('day', date AT TIME ZONE ?) AS day, SUM(amount) AS total, COUNT(*) AS count", timezone).
+		Where("type = 'expense'").
+		Group("1").
+		Order("1").
+		Scan(&totals)
+	return totals, result.Error
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"FinMa/types"
+)
+
+// ImportSettings writes the settings imported by the user in one
+// transaction, nothing is written when any of them fails.
+func (s *service) ImportSettings(userID uuid.UUID, settings *types.SettingsImport) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if len(settings.Preferences) > 0 {
+			if err := tx.Model(&types.User{}).Where("id = ?", userID).Updates(settings.Preferences).Error; err != nil {
+				return err
+			}
+		}
+
+		if len(settings.Categories) > 0 {
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "user_id"}, {Name: "category"}},
+				DoUpdates: clause.AssignmentColumns([]string{"exclude_by_default", "essential", "updated_at"}),
+			}).Omit("User").Create(&settings.Categories).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		if settings.Tax != nil {
+			if err := tx.Where("setting_id IN (?)", tx.Model(&types.TaxSetting{}).Select("id").Where("user_id = ?", userID)).Delete(&types.TaxCategory{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("user_id = ?", userID).Delete(&types.TaxSetting{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Omit("User").Create(settings.Tax).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, merchant := range settings.MutedMerchants {
+			mute := types.AnomalyMute{ID: uuid.New(), Merchant: normalizeMerchant(merchant), UserID: userID}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Omit("User").Create(&mute).Error; err != nil {
+				return err
+			}
+		}
+
+		if len(settings.ReplacedTemplateIDs) > 0 {
+			if err := tx.Where("template_id IN ?", settings.ReplacedTemplateIDs).Delete(&types.BudgetTemplateItem{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("id IN ? AND user_id = ?", settings.ReplacedTemplateIDs, userID).Delete(&types.BudgetTemplate{}).Error; err != nil {
+				return err
+			}
+		}
+		for i := range settings.BudgetTemplates {
+			if err := tx.Create(&settings.BudgetTemplates[i]).Error; err != nil {
+				return err
+			}
+		}
+
+		if len(settings.NotificationPreferences) > 0 {
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "user_id"}, {Name: "event"}},
+				DoUpdates: clause.AssignmentColumns([]string{"in_app", "email", "push", "updated_at"}),
+			}).Create(&settings.NotificationPreferences).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return s.changed(err, dataChange{userIDs: []uuid.UUID{userID}})
+}
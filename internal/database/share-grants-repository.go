@@ -0,0 +1,57 @@
+package database
+
+import (
+	"FinMa/types"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+)
+
+func (s *service) CreateShareGrant(grant *types.ShareGrant) error {
+	return s.db.Create(grant).Error
+}
+
+// GetShareGrants lists the grants given by the user, the revoked and
+// expired ones included, the latest first.
+func (s *service) GetShareGrants(userID uuid.UUID) []types.ShareGrant {
+	var grants []types.ShareGrant
+	if err := s.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&grants).Error; err != nil {
+		log.Error("Error fetching share grants: ", err)
+		return nil
+	}
+	return grants
+}
+
+// GetReceivedShareGrants lists the active grants given to the user, the
+// latest first.
+func (s *service) GetReceivedShareGrants(granteeID uuid.UUID, now time.Time) []types.ShareGrant {
+	var grants []types.ShareGrant
+	err := s.db.
+		Where("grantee_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", granteeID, now).
+		Order("created_at DESC").
+		Find(&grants).Error
+	if err != nil {
+		log.Error("Error fetching received share grants: ", err)
+		return nil
+	}
+	return grants
+}
+
+func (s *service) GetShareGrantByID(id string) types.ShareGrant {
+	var grant types.ShareGrant
+	s.db.Where("id = ?", id).First(&grant)
+	return grant
+}
+
+// RevokeShareGrant revokes the grant at the time, once.
+func (s *service) RevokeShareGrant(grant *types.ShareGrant, at time.Time) error {
+	err := s.db.Model(&types.ShareGrant{}).
+		Where("id = ? AND revoked_at IS NULL", grant.ID).
+		Update("revoked_at", at).Error
+	if err != nil {
+		return err
+	}
+	grant.RevokedAt = &at
+	return nil
+}
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"FinMa/types"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GetMerchantCharges lists the expenses of the user dated from since with
+// their merchant, by merchant and date. The expenses without letters in
+// their description have no merchant and are left out.
+func (s *service) GetMerchantCharges(userID uuid.UUID, since time.Time) ([]types.MerchantCharge, error) {
+	charges := []types.MerchantCharge{}
+	result := s.db.Table("(?) charges", s.db.Model(&types.Transaction{}).
+		Select(merchantSQL+" AS merchant, amount, date, category, bank_account_id").
+		Where("user_id = ? AND type = 'expense' AND date >= ?", userID, since)).
+		Where("merchant IS NOT NULL").
+		Order("merchant, date").
+		Scan(&charges)
+	return charges, result.Error
+}
+
+// GetSubscriptions lists the subscriptions suggested to the user, confirmed
+// or dismissed by them, by merchant.
+func (s *service) GetSubscriptions(userID uuid.UUID) []types.Subscription {
+	var subscriptions []types.Subscription
+	result := s.db.Where("user_id = ?", userID).Order("merchant").Find(&subscriptions)
+
+	if result.Error != nil {
+		log.Error("Error fetching subscriptions: ", result.Error)
+		return nil
+	}
+	return subscriptions
+}
+
+// SuggestSubscription records the suggestion of a subscription. It returns
+// false when the merchant was already suggested, confirmed or dismissed.
+func (s *service) SuggestSubscription(subscription *types.Subscription) (bool, error) {
+	result := s.db.Omit("User").Clauses(clause.OnConflict{DoNothing: true}).Create(subscription)
+	return result.RowsAffected > 0, result.Error
+}
+
+// SaveSubscription stores the subscription, over the one of its merchant.
+func (s *service) SaveSubscription(subscription *types.Subscription) error {
+	return s.saveSubscription(s.db, subscription)
+}
+
+func (s *service) saveSubscription(db *gorm.DB, subscription *types.Subscription) error {
+	return db.Omit("User").Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "merchant"}},
+		DoUpdates: clause.AssignmentColumns([]string{"status", "cadence", "amount", "bill_id", "last_charge_at", "updated_at"}),
+	}).Create(subscription).Error
+}
+
+// ConfirmSubscription creates the bill tracking the subscription and stores
+// the subscription as confirmed, at once.
+func (s *service) ConfirmSubscription(subscription *types.Subscription, bill *types.Bill) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("User").Create(bill).Error; err != nil {
+			return err
+		}
+		subscription.Status = "confirmed"
+		subscription.BillID = &bill.ID
+		return s.saveSubscription(tx, subscription)
+	})
+}
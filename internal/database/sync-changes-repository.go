@@ -0,0 +1,231 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"FinMa/types"
+)
+
+// ErrSyncCursorExpired is returned for a cursor older than the changes kept,
+// or unknown: the client must sync everything again.
+var ErrSyncCursorExpired = errors.New("the sync cursor expired")
+
+// syncSequenceLock is the advisory lock key held while the changes are
+// numbered, so that two numberings never interleave.
+const syncSequenceLock int64 = 0x46696e4d6153796e
+
+// syncChangeFunctionSQL creates the trigger function recording the changes
+// of a synced table, its argument naming the entity. The owners of the row
+// are read from its JSON so that one function serves every table: the
+// columns a table lacks are null.
+const syncChangeFunctionSQL = `
+	CREATE OR REPLACE FUNCTION record_sync_change() RETURNS trigger
+	LANGUAGE plpgsql AS $$
+	DECLARE
+		r jsonb;
+	BEGIN
+		IF TG_OP = 'DELETE' THEN r := to_jsonb(OLD); ELSE r := to_jsonb(NEW); END IF;
+		INSERT INTO sync_changes (tx_id, entity, entity_id, user_id, bank_account_id, household_id, created_at)
+		VALUES (pg_current_xact_id(), TG_ARGV[0], (r->>'id')::uuid, (r->>'user_id')::uuid,
+			CASE WHEN TG_ARGV[0] = 'account' THEN (r->>'id')::uuid ELSE (r->>'bank_account_id')::uuid END,
+			(r->>'household_id')::uuid, now());
+		RETURN NULL;
+	END $$`
+
+// syncedTables are the tables whose changes are recorded, with their entity.
+var syncedTables = []struct{ table, entity string }{
+	{"transactions", "transaction"},
+	{"bank_accounts", "account"},
+	{"budgets", "budget"},
+	{"category_settings", "category"},
+}
+
+// migrateSyncTriggers creates the sequence numbering the changes and
+// creates or replaces the triggers recording them.
+func (s *service) migrateSyncTriggers() error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("CREATE SEQUENCE IF NOT EXISTS sync_change_seq").Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(syncChangeFunctionSQL).Error; err != nil {
+			return err
+		}
+		for _, synced := range syncedTables {
+			if err := tx.Exec("DROP TRIGGER IF EXISTS record_sync_change ON " + synced.table).Error; err != nil {
+				return err
+			}
+			if err := tx.Exec("CREATE TRIGGER record_sync_change AFTER INSERT OR UPDATE OR DELETE ON " + synced.table +
+				" FOR EACH ROW EXECUTE FUNCTION record_sync_change('" + synced.entity + "')").Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// syncBounds numbers the changes whose transaction, and every transaction
+// started before it, finished, then returns the range of the valid
+// cursors. A number drawn when the row is written would let a change
+// committed late fall below a cursor already handed out; numbering batches
+// closed to new rows keeps the numbers in the order the changes became
+// visible.
+func (s *service) syncBounds() (floor, last int64, err error) {
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", syncSequenceLock).Error; err != nil {
+			return err
+		}
+		// Since Postgres 9.6 nextval runs once the rows are sorted
+		err := tx.Exec(`
+			UPDATE sync_changes c SET seq = n.seq FROM (
+				SELECT id, nextval('sync_change_seq') AS seq FROM sync_changes
+				WHERE seq IS NULL AND tx_id < pg_snapshot_xmin(pg_current_snapshot())
+				ORDER BY tx_id, id
+			) n
+			WHERE c.id = n.id`).Error
+		if err != nil {
+			return err
+		}
+		floor, last, err = syncFloor(tx)
+		return err
+	})
+	return floor, last, err
+}
+
+// syncFloor returns the oldest valid cursor, the one before the first
+// change kept, and the last number drawn. The changes are pruned from the
+// first, the ones after the floor are all kept.
+func syncFloor(tx *gorm.DB) (int64, int64, error) {
+	var bounds struct {
+		First *int64
+		Last  int64
+	}
+	err := tx.Raw(`SELECT (SELECT MIN(seq) FROM sync_changes) AS first,
+		(SELECT CASE WHEN is_called THEN last_value ELSE 0 END FROM sync_change_seq) AS last`).Scan(&bounds).Error
+	if err != nil || bounds.First == nil {
+		return bounds.Last, bounds.Last, err
+	}
+	return *bounds.First - 1, bounds.Last, nil
+}
+
+// LatestSyncCursor returns the cursor of the last change, the starting
+// point of a client syncing everything.
+func (s *service) LatestSyncCursor() (int64, error) {
+	_, last, err := s.syncBounds()
+	return last, err
+}
+
+// GetSyncChanges returns the entities the user sees that changed after the
+// cursor, at most limit changes, as they are now. The entities deleted or
+// no longer visible are returned as tombstones. The cursor of the page
+// follows its last change, so the next page starts right after it.
+func (s *service) GetSyncChanges(user *types.User, since int64, limit int) (types.SyncPage, error) {
+	floor, last, err := s.syncBounds()
+	if err != nil {
+		return types.SyncPage{}, err
+	}
+	if since < floor || since > last {
+		return types.SyncPage{}, ErrSyncCursorExpired
+	}
+
+	var changes []types.SyncChange
+	err = s.db.Select("seq, entity, entity_id").Where("seq > ? AND seq <= ?", since, last).
+		Where("user_id = ? OR bank_account_id IN (?) OR household_id IN (?)",
+			user.ID, s.accessibleAccountsQuery(user, false), s.visibleHouseholdsQuery(user)).
+		Order("seq").Limit(limit + 1).Find(&changes).Error
+	if err != nil {
+		return types.SyncPage{}, err
+	}
+	// The changes after the cursor may have been pruned while they were read
+	floor, _, err = syncFloor(s.db)
+	if err != nil {
+		return types.SyncPage{}, err
+	}
+	if since < floor {
+		return types.SyncPage{}, ErrSyncCursorExpired
+	}
+
+	page := types.SyncPage{Cursor: last}
+	if len(changes) > limit {
+		changes = changes[:limit]
+		page.Cursor = *changes[limit-1].Seq
+		page.HasMore = true
+	}
+
+	ids := map[string][]uuid.UUID{}
+	for _, change := range changes {
+		ids[change.Entity] = append(ids[change.Entity], change.EntityID)
+	}
+	found := map[uuid.UUID]bool{}
+	if len(ids["transaction"]) > 0 {
+		err := s.userTransactionsQuery(user, types.TransactionFilter{}).Where("id IN ?", ids["transaction"]).Find(&page.Transactions).Error
+		if err != nil {
+			return types.SyncPage{}, err
+		}
+		for _, transaction := range page.Transactions {
+			found[transaction.ID] = true
+		}
+	}
+	if len(ids["account"]) > 0 {
+		err := s.db.Where("id IN (?) AND id IN ?", s.accessibleAccountsQuery(user, false), ids["account"]).Find(&page.Accounts).Error
+		if err != nil {
+			return types.SyncPage{}, err
+		}
+		for _, account := range page.Accounts {
+			found[account.ID] = true
+		}
+	}
+	if len(ids["budget"]) > 0 {
+		err := preloadBudgetSettings(s.db).Where("user_id = ? OR household_id IN (?)", user.ID, s.visibleHouseholdsQuery(user)).
+			Where("id IN ?", ids["budget"]).Find(&page.Budgets).Error
+		if err != nil {
+			return types.SyncPage{}, err
+		}
+		for _, budget := range page.Budgets {
+			found[budget.ID] = true
+		}
+	}
+	if len(ids["category"]) > 0 {
+		err := s.db.Where("user_id = ? AND id IN ?", user.ID, ids["category"]).Find(&page.Categories).Error
+		if err != nil {
+			return types.SyncPage{}, err
+		}
+		for _, setting := range page.Categories {
+			found[setting.ID] = true
+		}
+	}
+
+	for _, change := range changes {
+		if !found[change.EntityID] {
+			page.Deleted = append(page.Deleted, types.SyncTombstone{Entity: change.Entity, ID: change.EntityID})
+			found[change.EntityID] = true
+		}
+	}
+	return page, nil
+}
+
+// DeleteSyncChanges deletes the changes recorded before the date, numbering
+// them first so that none is lost unnumbered. The changes are deleted up to
+// the last one numbered before the date, so the ones left follow the floor.
+func (s *service) DeleteSyncChanges(before time.Time) (int64, error) {
+	if _, _, err := s.syncBounds(); err != nil {
+		return 0, err
+	}
+	result := s.db.Exec("DELETE FROM sync_changes WHERE seq <= (SELECT MAX(seq) FROM sync_changes WHERE created_at < ?)", before)
+	return result.RowsAffected, result.Error
+}
+
+// resetSyncChanges forgets the changes and moves the floor past every
+// cursor handed out, in the transaction: the clients sync everything again.
+func resetSyncChanges(tx *gorm.DB) error {
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", syncSequenceLock).Error; err != nil {
+		return err
+	}
+	if err := tx.Exec("DELETE FROM sync_changes").Error; err != nil {
+		return err
+	}
+	return tx.Exec("SELECT nextval('sync_change_seq')").Error
+}
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"FinMa/types"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestSyncChanges(t *testing.T) {
+	s := New(testConfig).(*service)
+
+	var users []types.User
+	for range 2 {
+		user := types.User{ID: uuid.New(), Email: uuid.NewString() + "@example.com", Role: "user"}
+		if err := s.db.Create(&user).Error; err != nil {
+			t.Fatalf("could not create user: %v", err)
+		}
+		users = append(users, user)
+	}
+	user, other := users[0], users[1]
+
+	start, err := s.LatestSyncCursor()
+	if err != nil {
+		t.Fatalf("could not get the cursor: %v", err)
+	}
+
+	account := types.BankAccount{ID: uuid.New(), AccountNumber: uuid.NewString(), UserID: user.ID}
+	if err := s.CreateBankAccount(&account); err != nil {
+		t.Fatalf("could not create account: %v", err)
+	}
+	var transactions []types.Transaction
+	for range 3 {
+		transaction := types.Transaction{ID: uuid.New(), Amount: money(10), Type: "expense", Date: time.Now(), BankAccountID: account.ID, UserID: user.ID}
+		if err := s.CreateTransaction(&transaction); err != nil {
+			t.Fatalf("could not create transaction: %v", err)
+		}
+		transactions = append(transactions, transaction)
+	}
+
+	// sync pages through the changes after the cursor, one per page
+	sync := func(user types.User, cursor int64) (int64, map[uuid.UUID]bool, map[uuid.UUID]bool) {
+		seen, deleted := map[uuid.UUID]bool{}, map[uuid.UUID]bool{}
+		for {
+			page, err := s.GetSyncChanges(&user, cursor, 1)
+			if err != nil {
+				t.Fatalf("could not sync from %d: %v", cursor, err)
+			}
+			if page.Cursor < cursor {
+				t.Fatalf("expected the cursor to move forward; got %d after %d", page.Cursor, cursor)
+			}
+			for _, transaction := range page.Transactions {
+				seen[transaction.ID] = true
+			}
+			for _, account := range page.Accounts {
+				seen[account.ID] = true
+			}
+			for _, tombstone := range page.Deleted {
+				deleted[tombstone.ID] = true
+			}
+			cursor = page.Cursor
+			if !page.HasMore {
+				return cursor, seen, deleted
+			}
+		}
+	}
+
+	cursor, seen, _ := sync(user, start)
+	if !seen[account.ID] || !seen[transactions[0].ID] || !seen[transactions[2].ID] {
+		t.Fatalf("expected the account and the transactions synced; got %v", seen)
+	}
+	if _, seen, _ := sync(other, start); seen[account.ID] || seen[transactions[0].ID] {
+		t.Errorf("expected the changes of another user hidden; got %v", seen)
+	}
+
+	if err := s.DeleteTransaction(&transactions[1]); err != nil {
+		t.Fatalf("could not delete transaction: %v", err)
+	}
+	cursor, seen, deleted := sync(user, cursor)
+	if !deleted[transactions[1].ID] || seen[transactions[0].ID] {
+		t.Errorf("expected the deletion synced alone; got %v %v", seen, deleted)
+	}
+
+	// The client offline past the retention syncs everything again
+	if _, err := s.DeleteSyncChanges(time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("could not delete the changes: %v", err)
+	}
+	if _, err := s.GetSyncChanges(&user, start, 100); !errors.Is(err, ErrSyncCursorExpired) {
+		t.Errorf("expected the pruned cursor expired; got %v", err)
+	}
+	if _, err := s.GetSyncChanges(&user, cursor, 100); err != nil {
+		t.Errorf("expected the latest cursor still valid; got %v", err)
+	}
+	if _, err := s.GetSyncChanges(&user, cursor+1000, 100); !errors.Is(err, ErrSyncCursorExpired) {
+		t.Errorf("expected an unknown cursor expired; got %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package database
+
+import (
+	"FinMa/types"
+	"errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// GetTaxSetting returns the tax configuration of the user with its
+// categories, by label. It returns false when the user has none.
+func (s *service) GetTaxSetting(userID uuid.UUID) (types.TaxSetting, bool) {
+	var setting types.TaxSetting
+	err := s.db.Preload("Categories", func(db *gorm.DB) *gorm.DB {
+		return db.Order("label, category")
+	}).Where("user_id = ?", userID).First(&setting).Error
+	return setting, err == nil
+}
+
+// SaveTaxSetting replaces the tax configuration of the user, keeping its ID
+// when there was one, with its categories, at once.
+func (s *service) SaveTaxSetting(setting *types.TaxSetting) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var existing types.TaxSetting
+		err := tx.Where("user_id = ?", setting.UserID).First(&existing).Error
+		switch {
+		case err == nil:
+			setting.ID = existing.ID
+			if err := tx.Where("setting_id = ?", existing.ID).Delete(&types.TaxCategory{}).Error; err != nil {
+				return err
+			}
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+
+		for i := range setting.Categories {
+			setting.Categories[i].SettingID = setting.ID
+		}
+		return tx.Omit("User").Save(setting).Error
+	})
+}
+
+// DeleteTaxSetting removes the tax configuration of the user and its
+// categories.
+func (s *service) DeleteTaxSetting(userID uuid.UUID) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		settings := tx.Model(&types.TaxSetting{}).Select("id").Where("user_id = ?", userID)
+		if err := tx.Where("setting_id IN (?)", settings).Delete(&types.TaxCategory{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&types.TaxSetting{}).Error
+	})
+}
@@ -2,36 +2,422 @@ package database
 
 import (
 	"FinMa/types"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
 
 	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// TransactionHook is called once a change to a transaction is committed.
+// previous is nil for a created transaction and current is nil for a
+// deleted one.
+type TransactionHook func(previous, current *types.Transaction)
+
+// OnTransactionChange registers a hook called after every committed
+// creation, update or deletion of a transaction. Hooks must be registered
+// before the server starts.
+func (s *service) OnTransactionChange(hook TransactionHook) {
+	s.transactionHooks = append(s.transactionHooks, hook)
+}
+
+func (s *service) runTransactionHooks(previous, current *types.Transaction) {
+	for _, hook := range s.transactionHooks {
+		hook(previous, current)
+	}
+
+	var change dataChange
+	for _, transaction := range []*types.Transaction{previous, current} {
+		if transaction == nil {
+			continue
+		}
+		change.userIDs = append(change.userIDs, transaction.UserID)
+		change.accountIDs = append(change.accountIDs, transaction.BankAccountID)
+		if transaction.TransferAccountID != nil {
+			change.accountIDs = append(change.accountIDs, *transaction.TransferAccountID)
+		}
+	}
+	s.changed(nil, change)
+}
+
+// CreateTransaction stores the transaction and updates the balance of its
+// account in the same database transaction.
 func (s *service) CreateTransaction(transaction *types.Transaction) error {
-	s.db.Create(transaction)
-	if s.db.Error != nil {
-		return s.db.Error
+	transaction.BudgetID = s.findBudgetForTransaction(transaction)
+
+	var lowBalance []types.BankAccount
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("User", "BankAccount").Create(transaction).Error; err != nil {
+			return err
+		}
+		if err := adjustBalance(tx, transaction.BankAccountID, signedAmount(transaction), transaction.Date); err != nil {
+			return err
+		}
+		if err := adjustTransferBalance(tx, transaction, 1); err != nil {
+			return err
+		}
+
+		var err error
+		lowBalance, err = updateLowBalanceAlerts(tx, &transaction.BankAccountID, transaction.TransferAccountID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	s.runTransactionHooks(nil, transaction)
+	s.runLowBalanceHooks(lowBalance, transaction)
+	return nil
+}
+
+// ErrVersionConflict is returned for an update of a transaction or a budget
+// whose version is no longer the stored one: it was changed since it was
+// read.
+var ErrVersionConflict = errors.New("the version is not the current one")
+
+// UpdateTransaction saves the transaction, moves its budget attribution if
+// the category, type or date changed and applies the difference to the
+// balance of the accounts involved. The version of the transaction must be
+// the stored one, it is bumped by the update.
+func (s *service) UpdateTransaction(transaction *types.Transaction) error {
+	transaction.BudgetID = s.findBudgetForTransaction(transaction)
+
+	var previous types.Transaction
+	var lowBalance []types.BankAccount
+	read := transaction.Version
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ?", transaction.ID).First(&previous).Error; err != nil {
+			return err
+		}
+		if previous.Version != read {
+			return ErrVersionConflict
+		}
+
+		// Every write of a transaction bumps its version: the row is only
+		// updated if it is still the one read, which the balances are
+		// adjusted from
+		transaction.Version = read + 1
+		result := tx.Model(transaction).Where("version = ?", read).
+			Select("*").Omit("User", "BankAccount", "CreatedAt").Updates(transaction)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrVersionConflict
+		}
+
+		if err := adjustBalance(tx, previous.BankAccountID, signedAmount(&previous).Neg(), previous.Date); err != nil {
+			return err
+		}
+		if err := adjustTransferBalance(tx, &previous, -1); err != nil {
+			return err
+		}
+		if err := adjustBalance(tx, transaction.BankAccountID, signedAmount(transaction), transaction.Date); err != nil {
+			return err
+		}
+		if err := adjustTransferBalance(tx, transaction, 1); err != nil {
+			return err
+		}
+
+		// The alerts are evaluated on the final balances only, the revert
+		// of the previous version must not re-arm them
+		var err error
+		lowBalance, err = updateLowBalanceAlerts(tx, &previous.BankAccountID, previous.TransferAccountID,
+			&transaction.BankAccountID, transaction.TransferAccountID)
+		return err
+	})
+	if err != nil {
+		transaction.Version = read
+		return err
+	}
+
+	s.runTransactionHooks(&previous, transaction)
+	s.runLowBalanceHooks(lowBalance, transaction)
+	return nil
+}
+
+// DeleteTransaction deletes the transaction and reverts its effect on the
+// balance of its account. The row is locked and read again first: the
+// balance is reverted by the amount stored, even if the transaction was
+// edited since the caller read it, and a concurrent delete waits then finds
+// nothing to revert.
+func (s *service) DeleteTransaction(transaction *types.Transaction) error {
+	deleted := false
+	var lowBalance []types.BankAccount
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var stored types.Transaction
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", transaction.ID).First(&stored).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		*transaction = stored
+
+		if err := tx.Where("id = ?", transaction.ID).Delete(&types.Transaction{}).Error; err != nil {
+			return err
+		}
+		if err := adjustBalance(tx, transaction.BankAccountID, signedAmount(transaction).Neg(), transaction.Date); err != nil {
+			return err
+		}
+		deleted = true
+		if err := adjustTransferBalance(tx, transaction, -1); err != nil {
+			return err
+		}
+
+		lowBalance, err = updateLowBalanceAlerts(tx, &transaction.BankAccountID, transaction.TransferAccountID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if deleted {
+		s.runTransactionHooks(transaction, nil)
+		s.runLowBalanceHooks(lowBalance, transaction)
 	}
 	return nil
 }
 
-func (s *service) GetTransactions(user *types.User) []types.Transaction {
+// userTransactionsQuery selects the transactions of the accounts the user can
+// access, and the transactions the user created without an account.
+func (s *service) userTransactionsQuery(user *types.User, filter types.TransactionFilter) *gorm.DB {
+	query := s.db.Model(&types.Transaction{}).Where("(bank_account_id IN (?) OR (user_id = ? AND bank_account_id = ?))",
+		s.accessibleAccountsQuery(user, filter.ExcludeShared), user.ID, uuid.Nil)
+	return filterTransactions(query, filter)
+}
+
+// GetTransactions lists the transactions of the accounts the user can access,
+// and the transactions the user created without an account.
+func (s *service) GetTransactions(user *types.User, filter types.TransactionFilter) []types.Transaction {
 	var transactions []types.Transaction
-	s.db.Where("user_id = ?", user.ID).Find(&transactions)
+	result := paginateTransactions(s.userTransactionsQuery(user, filter), filter).Find(&transactions)
 
-	if s.db.Error != nil {
-		log.Error("Error fetching transactions: ", s.db.Error)
+	if result.Error != nil {
+		log.Error("Error fetching transactions: ", result.Error)
 		return nil
 	}
+
+	if filter.WithBalance {
+		if err := s.setRunningBalances(transactions); err != nil {
+			log.Error("Error computing running balances: ", err)
+			return nil
+		}
+	}
 	return transactions
 }
 
+// CountTransactions counts the transactions GetTransactions would list
+// without pagination.
+func (s *service) CountTransactions(user *types.User, filter types.TransactionFilter) (int64, error) {
+	var count int64
+	result := s.userTransactionsQuery(user, filter).Count(&count)
+	return count, result.Error
+}
+
+// GetPendingTotal returns the net amount of the transactions of the account
+// dated after now.
+func (s *service) GetPendingTotal(accountID uuid.UUID) (types.Money, error) {
+	var total types.Money
+	result := s.db.Raw("SELECT COALESCE(SUM(net), 0) FROM ("+accountFlowsSQL+") flows WHERE account_id = ? AND date > ?", accountID, time.Now()).
+		Scan(&total)
+	return total, result.Error
+}
+
+// setRunningBalances sets the balance of its account after each transaction.
+// The running balance is computed over the whole history of the account,
+// whatever the filters, in the order of the listings (date, then ID).
+func (s *service) setRunningBalances(transactions []types.Transaction) error {
+	if len(transactions) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(transactions))
+	accountIDs := make([]uuid.UUID, 0, len(transactions))
+	for _, transaction := range transactions {
+		ids = append(ids, transaction.ID)
+		if transaction.BankAccountID != uuid.Nil {
+			accountIDs = append(accountIDs, transaction.BankAccountID)
+		}
+	}
+
+	var balances []struct {
+		ID      uuid.UUID
+		Balance types.Money
+	}
+	result := s.db.Raw(`
+		SELECT r.id, a.initial_balance + r.running AS balance
+		FROM (
+			SELECT id, account_id, SUM(net) OVER (PARTITION BY account_id ORDER BY date, id) AS running
+			FROM (`+accountFlowsSQL+`) flows
+			WHERE account_id IN (?)
+		) r
+		JOIN bank_accounts a ON a.id = r.account_id
+		JOIN transactions t ON t.id = r.id AND t.bank_account_id = r.account_id
+		WHERE r.id IN (?)`, accountIDs, ids).Scan(&balances)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	byID := make(map[uuid.UUID]types.Money, len(balances))
+	for _, balance := range balances {
+		byID[balance.ID] = balance.Balance
+	}
+	for i := range transactions {
+		if balance, ok := byID[transactions[i].ID]; ok {
+			transactions[i].RunningBalance = &balance
+		}
+	}
+	return nil
+}
+
 func (s *service) GetTransactionByID(id string) types.Transaction {
 	var transaction types.Transaction
-	s.db.First(&transaction, id)
+	result := s.db.Where("id = ?", id).First(&transaction)
 
-	if s.db.Error != nil {
-		log.Error("Error fetching transaction: ", s.db.Error)
+	if result.Error != nil {
+		log.Error("Error fetching transaction: ", result.Error)
 		return types.Transaction{}
 	}
 	return transaction
 }
+
+// filterTransactions adds the filtering clauses shared by every transaction
+// listing query.
+func filterTransactions(query *gorm.DB, filter types.TransactionFilter) *gorm.DB {
+	if filter.AccountID != nil {
+		query = query.Where("bank_account_id = ?", *filter.AccountID)
+	}
+	if filter.From != nil {
+		query = query.Where("date >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("date <= ?", *filter.To)
+	}
+	if filter.Category != "" {
+		query = query.Where("category = ?", filter.Category)
+	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.Flagged != nil {
+		query = query.Where("is_flagged = ?", *filter.Flagged)
+	}
+	if filter.Excluded != nil {
+		query = query.Where("exclude_from_budgets = ?", *filter.Excluded)
+	}
+	if filter.BatchID != nil {
+		query = query.Where("id IN (SELECT entity_id FROM audit_logs WHERE batch_id = ? AND entity_type = 'transaction')", *filter.BatchID)
+	}
+	return query
+}
+
+// paginateTransactions adds the ordering and pagination clauses shared by
+// every transaction listing query.
+func paginateTransactions(query *gorm.DB, filter types.TransactionFilter) *gorm.DB {
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	return query.Order("date DESC, id DESC").Offset(filter.Offset)
+}
+
+// normalizeTransactionAmounts rewrites legacy rows that stored the direction of
+// the money flow in the sign of the amount. Negative amounts become positive
+// expenses so every aggregation can rely on the type column alone.
+func (s *service) normalizeTransactionAmounts() error {
+	return s.db.Exec(`
+		UPDATE transactions
+		SET amount = ABS(amount),
+			type = CASE WHEN type = 'transfer' THEN type ELSE 'expense' END
+		WHERE amount < 0`).Error
+}
+
+// findBudgetForTransaction returns the budget an expense is counted against:
+// a budget of the same user or of their household, matching its category, running at the
+// transaction date. When budgets of different period types match, the most
+// recently started one wins so the expense is never counted twice.
+// Expenses excluded from the budgets are counted against none.
+func (s *service) findBudgetForTransaction(transaction *types.Transaction) *uuid.UUID {
+	if transaction.Type != "expense" || transaction.ExcludeFromBudgets {
+		return nil
+	}
+
+	var budget types.Budget
+	result := s.db.
+		Where("user_id = ? OR household_id IN (?)", transaction.UserID, s.householdsQuery(transaction.UserID)).
+		Where(budgetMatchesCategorySQL, sql.Named("category", transaction.Category)).
+		Where(budgetCoversSQL, sql.Named("date", transaction.Date)).
+		Order("start_date DESC").
+		Limit(1).
+		Find(&budget)
+
+	if result.Error != nil {
+		log.Error("Error finding budget for transaction: ", result.Error)
+		return nil
+	}
+	if budget.ID == uuid.Nil {
+		return nil
+	}
+	return &budget.ID
+}
+
+// GetCategoryStatistics returns the count, mean and standard deviation of the
+// user's expenses in the category of the transaction from the given date up
+// to the transaction, in a single query. The transaction itself and the
+// expenses after it are left out, so a transaction is only compared to the
+// ones preceding it, and so are the expenses excluded from the budgets so
+// that a one-off bill does not skew the statistics.
+func (s *service) GetCategoryStatistics(transaction *types.Transaction, since time.Time) (types.CategoryStatistics, error) {
+	var stats types.CategoryStatistics
+	result := s.db.Model(&types.Transaction{}).
+		Select("COUNT(*) AS count, ROUND(COALESCE(AVG(amount), 0), ?) AS mean, ROUND(COALESCE(STDDEV_SAMP(amount), 0), ?) AS std_dev",
+			types.CurrencyDigits(""), types.CurrencyDigits("")).
+		Where("user_id = ? AND category = ? AND type = 'expense' AND NOT exclude_from_budgets AND date >= ? AND date < ? AND id <> ?",
+			transaction.UserID, transaction.Category, since, transaction.Date, transaction.ID).
+		Scan(&stats)
+
+	return stats, result.Error
+}
+
+// IsMerchantMuted reports whether the user dismissed a large transaction alert
+// for this merchant before.
+func (s *service) IsMerchantMuted(userID uuid.UUID, merchant string) bool {
+	var count int64
+	s.db.Model(&types.AnomalyMute{}).
+		Where("user_id = ? AND merchant = ?", userID, normalizeMerchant(merchant)).
+		Count(&count)
+	return count > 0
+}
+
+func (s *service) MuteMerchant(userID uuid.UUID, merchant string) error {
+	if s.IsMerchantMuted(userID, merchant) {
+		return nil
+	}
+
+	mute := types.AnomalyMute{
+		ID:       uuid.New(),
+		Merchant: normalizeMerchant(merchant),
+		UserID:   userID,
+	}
+	return s.db.Create(&mute).Error
+}
+
+// GetMutedMerchants lists the merchants the user muted the alerts of.
+func (s *service) GetMutedMerchants(userID uuid.UUID) []string {
+	var merchants []string
+	result := s.db.Model(&types.AnomalyMute{}).Where("user_id = ?", userID).Order("merchant").Pluck("merchant", &merchants)
+	if result.Error != nil {
+		log.Error("Error fetching muted merchants: ", result.Error)
+		return nil
+	}
+	return merchants
+}
+
+func normalizeMerchant(merchant string) string {
+	return strings.ToLower(strings.TrimSpace(merchant))
+}
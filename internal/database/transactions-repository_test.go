@@ -0,0 +1,128 @@
+package database
+
+import (
+	"FinMa/types"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCategoryStatisticsPrecedeTheTransaction(t *testing.T) {
+	s := New(testConfig).(*service)
+
+	user := types.User{ID: uuid.New(), Email: uuid.NewString() + "@example.com", Role: "user"}
+	if err := s.db.Create(&user).Error; err != nil {
+		t.Fatalf("could not create user: %v", err)
+	}
+	account := types.BankAccount{ID: uuid.New(), AccountNumber: uuid.NewString(), UserID: user.ID}
+	if err := s.CreateBankAccount(&account); err != nil {
+		t.Fatalf("could not create account: %v", err)
+	}
+
+	now := time.Now()
+	create := func(amount float64, date time.Time) types.Transaction {
+		transaction := types.Transaction{ID: uuid.New(), Amount: money(amount), Type: "expense", Category: "food", Date: date, BankAccountID: account.ID, UserID: user.ID}
+		if err := s.CreateTransaction(&transaction); err != nil {
+			t.Fatalf("could not create transaction: %v", err)
+		}
+		return transaction
+	}
+	create(10, now.AddDate(0, 0, -3))
+	create(30, now.AddDate(0, 0, -2))
+	current := create(500, now.AddDate(0, 0, -1))
+	create(1000, now)
+
+	// Recomputed for a stored transaction, only the expenses before it count
+	stats, err := s.GetCategoryStatistics(&current, now.AddDate(0, 0, -90))
+	if err != nil {
+		t.Fatalf("could not compute the statistics: %v", err)
+	}
+	if stats.Count != 2 || stats.Mean != money(20) {
+		t.Errorf("expected the 2 preceding expenses alone; got %+v", stats)
+	}
+}
+
+func TestDeleteRevertsTheStoredTransaction(t *testing.T) {
+	s := New(testConfig).(*service)
+
+	user := types.User{ID: uuid.New(), Email: uuid.NewString() + "@example.com", Role: "user"}
+	if err := s.db.Create(&user).Error; err != nil {
+		t.Fatalf("could not create user: %v", err)
+	}
+	account := types.BankAccount{ID: uuid.New(), AccountNumber: uuid.NewString(), UserID: user.ID}
+	if err := s.CreateBankAccount(&account); err != nil {
+		t.Fatalf("could not create account: %v", err)
+	}
+	transaction := types.Transaction{ID: uuid.New(), Amount: money(10), Type: "expense", Category: "food", Date: time.Now(), BankAccountID: account.ID, UserID: user.ID}
+	if err := s.CreateTransaction(&transaction); err != nil {
+		t.Fatalf("could not create transaction: %v", err)
+	}
+
+	// The amount is edited after the copy deleted was read
+	stale := s.GetTransactionByID(transaction.ID.String())
+	edited := s.GetTransactionByID(transaction.ID.String())
+	edited.Amount = money(50)
+	if err := s.UpdateTransaction(&edited); err != nil {
+		t.Fatalf("could not update transaction: %v", err)
+	}
+	if err := s.DeleteTransaction(&stale); err != nil {
+		t.Fatalf("could not delete transaction: %v", err)
+	}
+	if balance := s.GetBankAccountByID(account.ID.String()).Balance; !balance.IsZero() {
+		t.Errorf("expected the stored amount reverted; got a balance of %v", balance)
+	}
+}
+
+func TestConcurrentWritesKeepTheBalance(t *testing.T) {
+	s := New(testConfig).(*service)
+
+	user := types.User{ID: uuid.New(), Email: uuid.NewString() + "@example.com", Role: "user"}
+	if err := s.db.Create(&user).Error; err != nil {
+		t.Fatalf("could not create user: %v", err)
+	}
+	account := types.BankAccount{ID: uuid.New(), AccountNumber: uuid.NewString(), UserID: user.ID, InitialBalance: money(100), Balance: money(100)}
+	if err := s.CreateBankAccount(&account); err != nil {
+		t.Fatalf("could not create account: %v", err)
+	}
+
+	transactions := make([]types.Transaction, 20)
+	var wg sync.WaitGroup
+	for i := range transactions {
+		transactions[i] = types.Transaction{ID: uuid.New(), Amount: money(1), Type: "expense", Category: "food", Date: time.Now(), BankAccountID: account.ID, UserID: user.ID}
+		wg.Add(1)
+		go func(transaction *types.Transaction) {
+			defer wg.Done()
+			if err := s.CreateTransaction(transaction); err != nil {
+				t.Errorf("could not create transaction: %v", err)
+			}
+		}(&transactions[i])
+	}
+	wg.Wait()
+
+	// Every other transaction is deleted twice at once, reverted once
+	for i := 0; i < len(transactions); i += 2 {
+		for j := 0; j < 2; j++ {
+			wg.Add(1)
+			go func(transaction types.Transaction) {
+				defer wg.Done()
+				if err := s.DeleteTransaction(&transaction); err != nil {
+					t.Errorf("could not delete transaction: %v", err)
+				}
+			}(transactions[i])
+		}
+	}
+	wg.Wait()
+
+	if balance := s.GetBankAccountByID(account.ID.String()).Balance; balance.Float64() != 90 {
+		t.Errorf("expected 10 expenses of 1 left out of 100; got a balance of %v", balance)
+	}
+	drift, err := s.RecomputeBalance(account.ID)
+	if err != nil {
+		t.Fatalf("could not recompute the balance: %v", err)
+	}
+	if drift.Stored.Float64() != drift.Computed.Float64() || drift.Computed.Float64() != 90 {
+		t.Errorf("expected no drift from the recomputed balance; got %+v", drift)
+	}
+}
@@ -3,8 +3,10 @@ package database
 import (
 	"FinMa/types"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 func (s *service) GetUsers() []types.User {
@@ -42,3 +44,45 @@ func (s *service) GetUserByID(id uuid.UUID) types.User {
 	s.db.Where("id = ?", id).First(&user)
 	return user
 }
+
+// UpdateUserLocale stores the language the user chose.
+func (s *service) UpdateUserLocale(user *types.User) error {
+	return s.db.Model(&types.User{}).Where("id = ?", user.ID).Update("locale", user.Locale).Error
+}
+
+// UpdateUserTimezone stores the timezone the dates of the user are counted in.
+func (s *service) UpdateUserTimezone(user *types.User) error {
+	return s.db.Model(&types.User{}).Where("id = ?", user.ID).Update("timezone", user.Timezone).Error
+}
+
+// UpdateUserBaseCurrency stores the currency the reports of the user are
+// converted to.
+func (s *service) UpdateUserBaseCurrency(user *types.User) error {
+	return s.db.Model(&types.User{}).Where("id = ?", user.ID).Update("base_currency", user.BaseCurrency).Error
+}
+
+// UpdateUserAvatarVersion stores the version of the avatar of the user, 0
+// once removed.
+func (s *service) UpdateUserAvatarVersion(user *types.User) error {
+	return s.db.Model(&types.User{}).Where("id = ?", user.ID).Update("avatar_version", user.AvatarVersion).Error
+}
+
+// UpdateUserPassword replaces the password hash of the user.
+func (s *service) UpdateUserPassword(userID uuid.UUID, hashedPassword string) error {
+	result := s.db.Model(&types.User{}).Where("id = ?", userID).Update("password", hashedPassword)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetExpiredDemoUsers returns the demo users created before createdBefore,
+// the oldest first.
+func (s *service) GetExpiredDemoUsers(createdBefore time.Time, limit int) []types.User {
+	var users []types.User
+	s.db.Where("is_demo AND created_at < ?", createdBefore).Order("created_at").Limit(limit).Find(&users)
+	return users
+}
@@ -0,0 +1,24 @@
+package database
+
+import (
+	"gorm.io/gorm/clause"
+
+	"FinMa/types"
+)
+
+// ClaimWebhookEvent records the webhook event before it is handled. It
+// reports false when the event was claimed before, by an earlier or a
+// concurrent delivery: the primary key lets a single insert through.
+func (s *service) ClaimWebhookEvent(event *types.WebhookEvent) (bool, error) {
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(event)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// ReleaseWebhookEvent deletes the claim of the webhook event, whose handling
+// failed, so that the next delivery handles it.
+func (s *service) ReleaseWebhookEvent(provider, id string) error {
+	return s.db.Where("provider = ? AND id = ?", provider, id).Delete(&types.WebhookEvent{}).Error
+}
@@ -0,0 +1,46 @@
+package database
+
+import (
+	"FinMa/types"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestClaimWebhookEventOnce(t *testing.T) {
+	s := New(testConfig).(*service)
+	id := uuid.NewString()
+
+	var claimed atomic.Int32
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := s.ClaimWebhookEvent(&types.WebhookEvent{Provider: "stripe", ID: id})
+			if err != nil {
+				t.Errorf("could not claim the event: %v", err)
+			}
+			if ok {
+				claimed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if claimed.Load() != 1 {
+		t.Fatalf("expected the event claimed once; got %d", claimed.Load())
+	}
+
+	// Released, the next delivery claims it again
+	if err := s.ReleaseWebhookEvent("stripe", id); err != nil {
+		t.Fatalf("could not release the event: %v", err)
+	}
+	if ok, err := s.ClaimWebhookEvent(&types.WebhookEvent{Provider: "stripe", ID: id}); err != nil || !ok {
+		t.Errorf("expected the released event claimed again; got %v, %v", ok, err)
+	}
+	if ok, _ := s.ClaimWebhookEvent(&types.WebhookEvent{Provider: "bank_sync", ID: id}); !ok {
+		t.Errorf("expected the same ID of another provider claimed")
+	}
+}
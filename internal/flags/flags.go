@@ -0,0 +1,196 @@
+// Package flags gates the features rolled out gradually. Each flag is
+// defined here with its default, which the configuration overrides for every
+// user and the admins override for some users.
+package flags
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Flag is a feature that can be turned on or off per user.
+type Flag struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Default     bool   `json:"default"`
+}
+
+var registry = map[string]Flag{}
+
+func define(name, description string, enabled bool) Flag {
+	flag := Flag{Name: name, Description: description, Default: enabled}
+	registry[name] = flag
+	return flag
+}
+
+var (
+	Households        = define("households", "Share accounts and budgets within a household", false)
+	EnvelopeBudgeting = define("envelope_budgeting", "Measure the budgets against the income allocated to them", true)
+	BankSync          = define("bank_sync", "Connect bank accounts to import their transactions", true)
+)
+
+// All returns the flags by name.
+func All() []Flag {
+	all := make([]Flag, 0, len(registry))
+	for _, flag := range registry {
+		all = append(all, flag)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+	return all
+}
+
+// Lookup returns the flag of the name, ok is false for an unknown name.
+func Lookup(name string) (flag Flag, ok bool) {
+	flag, ok = registry[name]
+	return flag, ok
+}
+
+// ParseOverrides reads the "name=true" or "name=false" entries of the
+// configuration. The unknown names are refused, a typo would otherwise go
+// unnoticed.
+func ParseOverrides(entries []string) (map[string]bool, error) {
+	overrides := make(map[string]bool, len(entries))
+	var problems []string
+	for _, entry := range entries {
+		name, value, _ := strings.Cut(entry, "=")
+		enabled, err := strconv.ParseBool(value)
+		_, known := Lookup(name)
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("%q is not name=true or name=false", entry))
+		case !known:
+			problems = append(problems, fmt.Sprintf("unknown flag %q", name))
+		default:
+			overrides[name] = enabled
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%s", strings.Join(problems, ", "))
+	}
+	return overrides, nil
+}
+
+// Set is the state of every flag for a user.
+type Set map[string]bool
+
+// Enabled reports whether the flag is on.
+func (s Set) Enabled(flag Flag) bool {
+	if enabled, ok := s[flag.Name]; ok {
+		return enabled
+	}
+	return flag.Default
+}
+
+// Evaluate returns the state of every flag: its default, replaced by the
+// global override, replaced by the override of the user.
+func Evaluate(global, user map[string]bool) Set {
+	set := make(Set, len(registry))
+	for name, flag := range registry {
+		set[name] = flag.Default
+		if enabled, ok := global[name]; ok {
+			set[name] = enabled
+		}
+		if enabled, ok := user[name]; ok {
+			set[name] = enabled
+		}
+	}
+	return set
+}
+
+// Loader reads the overrides of the user from the database.
+type Loader func(userID uuid.UUID) (map[string]bool, error)
+
+// maxCachedUsers bounds the overrides kept in memory.
+const maxCachedUsers = 10000
+
+// Evaluator evaluates the flags of the users, keeping their overrides in
+// memory for a TTL so that checking a flag costs no query. The instance
+// writing an override invalidates it at once, the others see it once their
+// copy expires.
+type Evaluator struct {
+	global map[string]bool
+	load   Loader
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	users map[uuid.UUID]cachedOverrides
+	// invalidations counts the calls to Invalidate, the overrides loaded
+	// across one are not kept: they may predate the change
+	invalidations uint64
+	now           func() time.Time
+}
+
+type cachedOverrides struct {
+	overrides map[string]bool
+	expiresAt time.Time
+}
+
+// NewEvaluator returns the evaluator of the global overrides and of the
+// overrides of the users read by load.
+func NewEvaluator(global map[string]bool, ttl time.Duration, load Loader) *Evaluator {
+	return &Evaluator{
+		global: global,
+		load:   load,
+		ttl:    ttl,
+		users:  map[uuid.UUID]cachedOverrides{},
+		now:    time.Now,
+	}
+}
+
+// For returns the flags of the user. When the overrides of the user cannot
+// be read the global flags are returned with the error, uncached. A nil
+// Evaluator returns the defaults.
+func (e *Evaluator) For(userID uuid.UUID) (Set, error) {
+	if e == nil {
+		return Evaluate(nil, nil), nil
+	}
+
+	now := e.now()
+	e.mu.Lock()
+	cached, ok := e.users[userID]
+	invalidations := e.invalidations
+	e.mu.Unlock()
+	if ok && now.Before(cached.expiresAt) {
+		return Evaluate(e.global, cached.overrides), nil
+	}
+
+	overrides, err := e.load(userID)
+	if err != nil {
+		return Evaluate(e.global, nil), err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if invalidations != e.invalidations {
+		return Evaluate(e.global, overrides), nil
+	}
+	if len(e.users) >= maxCachedUsers {
+		for id, cached := range e.users {
+			if !now.Before(cached.expiresAt) {
+				delete(e.users, id)
+			}
+		}
+		if len(e.users) >= maxCachedUsers {
+			e.users = map[uuid.UUID]cachedOverrides{}
+		}
+	}
+	e.users[userID] = cachedOverrides{overrides: overrides, expiresAt: now.Add(e.ttl)}
+	return Evaluate(e.global, overrides), nil
+}
+
+// Invalidate drops the overrides of the user kept in memory, once changed.
+func (e *Evaluator) Invalidate(userID uuid.UUID) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	delete(e.users, userID)
+	e.invalidations++
+	e.mu.Unlock()
+}
@@ -0,0 +1,95 @@
+package flags
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestParseOverrides(t *testing.T) {
+	overrides, err := ParseOverrides([]string{"households=true", "bank_sync=0"})
+	if err != nil || !overrides["households"] || overrides["bank_sync"] || len(overrides) != 2 {
+		t.Errorf("expected both overrides; got %v, %v", overrides, err)
+	}
+
+	_, err = ParseOverrides([]string{"househods=true", "bank_sync", "households=true"})
+	if err == nil || !strings.Contains(err.Error(), `unknown flag "househods"`) || !strings.Contains(err.Error(), `"bank_sync" is not`) {
+		t.Errorf("expected every problem reported; got %v", err)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	set := Evaluate(map[string]bool{"households": true, "bank_sync": false}, map[string]bool{"bank_sync": true})
+	if !set.Enabled(Households) || !set.Enabled(BankSync) || !set.Enabled(EnvelopeBudgeting) {
+		t.Errorf("expected the user over the global overrides over the defaults; got %v", set)
+	}
+	if Evaluate(nil, nil).Enabled(Households) {
+		t.Errorf("expected households off by default")
+	}
+	if len(Evaluate(nil, nil)) != len(All()) {
+		t.Errorf("expected every flag in the set")
+	}
+}
+
+func TestEvaluator(t *testing.T) {
+	userID := uuid.New()
+	stored := map[string]bool{}
+	loads := 0
+	var failure error
+	e := NewEvaluator(map[string]bool{"households": true}, time.Minute, func(id uuid.UUID) (map[string]bool, error) {
+		loads++
+		overrides := map[string]bool{}
+		for name, enabled := range stored {
+			overrides[name] = enabled
+		}
+		return overrides, failure
+	})
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	e.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if set, err := e.For(userID); err != nil || !set.Enabled(Households) {
+			t.Errorf("expected the global override; got %v, %v", set, err)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("expected the overrides loaded once; got %d", loads)
+	}
+
+	// Seen once invalidated
+	stored["households"] = false
+	if set, _ := e.For(userID); !set.Enabled(Households) {
+		t.Errorf("expected the cached overrides before the invalidation")
+	}
+	e.Invalidate(userID)
+	if set, _ := e.For(userID); set.Enabled(Households) || loads != 2 {
+		t.Errorf("expected the new override after the invalidation; got %v after %d loads", set, loads)
+	}
+
+	// Or once expired
+	delete(stored, "households")
+	now = now.Add(2 * time.Minute)
+	if set, _ := e.For(userID); !set.Enabled(Households) || loads != 3 {
+		t.Errorf("expected the overrides reloaded once expired; got %v after %d loads", set, loads)
+	}
+
+	// A failing load falls back on the global flags, uncached
+	failure = errors.New("connection refused")
+	e.Invalidate(userID)
+	if set, err := e.For(userID); err == nil || !set.Enabled(Households) {
+		t.Errorf("expected the global flags with the error; got %v, %v", set, err)
+	}
+	failure = nil
+	if _, err := e.For(userID); err != nil || loads != 5 {
+		t.Errorf("expected the failed load not cached; got %v after %d loads", err, loads)
+	}
+
+	var disabled *Evaluator
+	if set, err := disabled.For(userID); err != nil || set.Enabled(Households) {
+		t.Errorf("expected the defaults of a nil evaluator; got %v, %v", set, err)
+	}
+	disabled.Invalidate(userID)
+}
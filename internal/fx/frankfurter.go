@@ -0,0 +1,74 @@
+package fx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// FrankfurterURL is the public instance of Frankfurter, which serves the
+// reference rates of the European Central Bank.
+const FrankfurterURL = "https://api.frankfurter.app"
+
+// FrankfurterProvider implements Provider with the API of Frankfurter, or
+// of a self-hosted instance. The ECB publishes a rate per working day, the
+// API answers the last one for the other days.
+type FrankfurterProvider struct {
+	baseURL string
+	client  *http.Client
+}
+
+func NewFrankfurterProvider(baseURL string, timeout time.Duration) *FrankfurterProvider {
+	return &FrankfurterProvider{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+func (p *FrankfurterProvider) Name() string {
+	return "frankfurter"
+}
+
+func (p *FrankfurterProvider) Rate(ctx context.Context, base, quote string, date time.Time) (float64, time.Time, error) {
+	query := url.Values{"from": {base}, "to": {quote}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/"+date.Format(time.DateOnly)+"?"+query.Encode(), nil)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	// Unknown currencies are answered with a 404 or a 422
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusUnprocessableEntity {
+		return 0, time.Time{}, fmt.Errorf("%w: %s or %s", ErrUnknownCurrency, base, quote)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, time.Time{}, fmt.Errorf("frankfurter answered %s", resp.Status)
+	}
+
+	var response struct {
+		Date  string             `json:"date"`
+		Rates map[string]float64 `json:"rates"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return 0, time.Time{}, fmt.Errorf("invalid frankfurter response: %w", err)
+	}
+	rate, ok := response.Rates[quote]
+	if !ok || rate <= 0 {
+		return 0, time.Time{}, fmt.Errorf("%w: %s", ErrUnknownCurrency, quote)
+	}
+	published, err := time.Parse(time.DateOnly, response.Date)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("invalid frankfurter date %q", response.Date)
+	}
+	return rate, published, nil
+}
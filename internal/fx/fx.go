@@ -0,0 +1,155 @@
+// Package fx converts between currencies. The rates are fetched from
+// providers tried in order, an API then a static file, and stored once per
+// pair and day so that the conversions of a past day are reproducible and
+// the API is asked once. When every provider fails the last stored rate is
+// used, flagged as stale, rather than failing the caller.
+package fx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+
+	"FinMa/types"
+)
+
+// ErrUnavailable is returned when no provider gives the rate and none is
+// stored before the day.
+var ErrUnavailable = errors.New("fx: exchange rate unavailable")
+
+// ErrUnknownCurrency is returned by the providers for a currency they do
+// not quote.
+var ErrUnknownCurrency = errors.New("fx: unknown currency")
+
+// Provider gives the published exchange rates.
+type Provider interface {
+	// Name identifies the provider in the stored rates.
+	Name() string
+	// Rate returns how much 1 base is worth in quote on the UTC day, or on
+	// the last day before it with a published rate, and that day.
+	Rate(ctx context.Context, base, quote string, date time.Time) (float64, time.Time, error)
+}
+
+// Store keeps the rates fetched: database.Service implements it.
+type Store interface {
+	GetExchangeRate(base, quote string, date time.Time) (*types.ExchangeRate, error)
+	GetLatestExchangeRate(base, quote string, date time.Time) (*types.ExchangeRate, error)
+	SaveExchangeRate(rate *types.ExchangeRate) error
+}
+
+// Rate is an exchange rate answered by the Service.
+type Rate struct {
+	types.ExchangeRate
+	// Stale is set when the providers failed: the rate is the last one
+	// stored before the day
+	Stale bool `json:"stale"`
+}
+
+// Service answers the exchange rates from the store, or from the providers
+// for the days not stored yet.
+type Service struct {
+	store     Store
+	providers []Provider
+	// now returns the current time, replaced by the tests
+	now func() time.Time
+}
+
+// NewService returns the service of the rates kept in the store, fetched
+// from the providers in order.
+func NewService(store Store, providers ...Provider) *Service {
+	return &Service{store: store, providers: providers, now: time.Now}
+}
+
+// Rate returns how much 1 from is worth in to on the UTC day of date, the
+// future days being today. A weekend or a holiday has the rate of the last
+// day before it, flagged as a fallback. When the providers fail the last
+// rate stored before the day is returned, flagged as stale, with a warning
+// logged: the error is ErrUnavailable only when there is none.
+func (s *Service) Rate(ctx context.Context, from, to string, date time.Time) (Rate, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	today := Day(s.now())
+	day := Day(date)
+	if day.After(today) {
+		day = today
+	}
+	if from == to {
+		return Rate{ExchangeRate: types.ExchangeRate{Base: from, Quote: to, Date: day, Rate: 1, RateDate: day, Source: "identity"}}, nil
+	}
+
+	stored, err := s.store.GetExchangeRate(from, to, day)
+	if err != nil {
+		log.Warn("Could not read the stored exchange rate", "base", from, "quote", to, "date", day.Format(time.DateOnly), "err", err)
+	}
+	if stored != nil {
+		return Rate{ExchangeRate: *stored}, nil
+	}
+
+	var errs []error
+	for _, provider := range s.providers {
+		value, published, err := provider.Rate(ctx, from, to, day)
+		if err != nil {
+			log.Warn("Exchange rate provider failed", "provider", provider.Name(), "base", from, "quote", to, "date", day.Format(time.DateOnly), "err", err)
+			errs = append(errs, fmt.Errorf("%s: %w", provider.Name(), err))
+			continue
+		}
+
+		published = Day(published)
+		rate := types.ExchangeRate{
+			ID:       uuid.New(),
+			Base:     from,
+			Quote:    to,
+			Date:     day,
+			Rate:     value,
+			RateDate: published,
+			Fallback: published.Before(day),
+			Source:   provider.Name(),
+		}
+		// The rate of today may not be published yet, its fallback is
+		// fetched again later
+		if !rate.Fallback || day.Before(today) {
+			if err := s.store.SaveExchangeRate(&rate); err != nil {
+				log.Warn("Could not store the exchange rate", "base", from, "quote", to, "date", day.Format(time.DateOnly), "err", err)
+			}
+		}
+		return Rate{ExchangeRate: rate}, nil
+	}
+
+	latest, err := s.store.GetLatestExchangeRate(from, to, day)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if latest == nil {
+		err := fmt.Errorf("%w: %s to %s on %s", ErrUnavailable, from, to, day.Format(time.DateOnly))
+		return Rate{}, errors.Join(append([]error{err}, errs...)...)
+	}
+	log.Warn("Exchange rate providers unavailable, using a stale rate", "base", from, "quote", to, "date", day.Format(time.DateOnly), "rate_date", latest.Date.Format(time.DateOnly))
+	rate := *latest
+	rate.Date = day
+	rate.Fallback = rate.RateDate.Before(day)
+	return Rate{ExchangeRate: rate, Stale: true}, nil
+}
+
+// Day returns the UTC day of the time, at midnight.
+func Day(t time.Time) time.Time {
+	year, month, day := t.UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// IsCurrencyCode reports whether code looks like an ISO 4217 code, three
+// uppercase letters.
+func IsCurrencyCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, letter := range code {
+		if letter < 'A' || letter > 'Z' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,223 @@
+package fx
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"FinMa/types"
+)
+
+// memoryStore keeps the rates by pair and day.
+type memoryStore struct {
+	rates map[string]types.ExchangeRate
+	saved int
+}
+
+func (m *memoryStore) key(base, quote string, date time.Time) string {
+	return base + quote + date.Format(time.DateOnly)
+}
+
+func (m *memoryStore) GetExchangeRate(base, quote string, date time.Time) (*types.ExchangeRate, error) {
+	if rate, ok := m.rates[m.key(base, quote, date)]; ok {
+		return &rate, nil
+	}
+	return nil, nil
+}
+
+func (m *memoryStore) GetLatestExchangeRate(base, quote string, date time.Time) (*types.ExchangeRate, error) {
+	var latest *types.ExchangeRate
+	for _, rate := range m.rates {
+		if rate.Base == base && rate.Quote == quote && !rate.Date.After(date) && (latest == nil || rate.Date.After(latest.Date)) {
+			latest = &rate
+		}
+	}
+	return latest, nil
+}
+
+func (m *memoryStore) SaveExchangeRate(rate *types.ExchangeRate) error {
+	m.saved++
+	m.rates[m.key(rate.Base, rate.Quote, rate.Date)] = *rate
+	return nil
+}
+
+// fakeProvider answers its rate, published on the last weekday.
+type fakeProvider struct {
+	rate  float64
+	err   error
+	calls int
+}
+
+func (p *fakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *fakeProvider) Rate(_ context.Context, base, quote string, date time.Time) (float64, time.Time, error) {
+	p.calls++
+	for date.Weekday() == time.Saturday || date.Weekday() == time.Sunday {
+		date = date.AddDate(0, 0, -1)
+	}
+	return p.rate, date, p.err
+}
+
+func newTestService(providers ...Provider) (*Service, *memoryStore) {
+	store := &memoryStore{rates: map[string]types.ExchangeRate{}}
+	s := NewService(store, providers...)
+	// A Wednesday
+	s.now = func() time.Time { return time.Date(2024, time.March, 6, 15, 0, 0, 0, time.UTC) }
+	return s, store
+}
+
+func TestRateIsFetchedOnce(t *testing.T) {
+	provider := &fakeProvider{rate: 1.08}
+	s, store := newTestService(provider)
+
+	for i := 0; i < 2; i++ {
+		rate, err := s.Rate(context.Background(), "eur", "USD", time.Date(2024, time.March, 1, 22, 30, 0, 0, time.UTC))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rate.Rate != 1.08 || rate.Base != "EUR" || rate.Date.Format(time.DateOnly) != "2024-03-01" || rate.Fallback || rate.Stale {
+			t.Errorf("expected the rate of the day; got %+v", rate)
+		}
+	}
+	if provider.calls != 1 || store.saved != 1 {
+		t.Errorf("expected the rate fetched and stored once; got %d calls and %d saves", provider.calls, store.saved)
+	}
+}
+
+func TestRateFallsBackOnWeekends(t *testing.T) {
+	s, store := newTestService(&fakeProvider{rate: 1.08})
+
+	rate, err := s.Rate(context.Background(), "EUR", "USD", time.Date(2024, time.March, 3, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rate.Fallback || rate.RateDate.Format(time.DateOnly) != "2024-03-01" || rate.Date.Format(time.DateOnly) != "2024-03-03" {
+		t.Errorf("expected the Friday rate flagged as a fallback; got %+v", rate)
+	}
+	if store.saved != 1 {
+		t.Errorf("expected the fallback of a past day stored; got %d saves", store.saved)
+	}
+
+	// The future is today, whose rate may be published later
+	s.now = func() time.Time { return time.Date(2024, time.March, 9, 10, 0, 0, 0, time.UTC) }
+	rate, err = s.Rate(context.Background(), "EUR", "USD", time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate.Date.Format(time.DateOnly) != "2024-03-09" || !rate.Fallback {
+		t.Errorf("expected the fallback of today; got %+v", rate)
+	}
+	if store.saved != 1 {
+		t.Errorf("expected the fallback of today not stored; got %d saves", store.saved)
+	}
+}
+
+func TestRateDegradesToStale(t *testing.T) {
+	outage := errors.New("connection refused")
+	failing := &fakeProvider{err: outage}
+	s, store := newTestService(failing, &fakeProvider{err: ErrUnknownCurrency})
+
+	if _, err := s.Rate(context.Background(), "EUR", "USD", time.Date(2024, time.March, 5, 0, 0, 0, 0, time.UTC)); !errors.Is(err, ErrUnavailable) || !errors.Is(err, outage) {
+		t.Errorf("expected ErrUnavailable with the provider errors; got %v", err)
+	}
+
+	friday := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	store.rates[store.key("EUR", "USD", friday)] = types.ExchangeRate{Base: "EUR", Quote: "USD", Date: friday, RateDate: friday, Rate: 1.07, Source: "fake"}
+	rate, err := s.Rate(context.Background(), "EUR", "USD", time.Date(2024, time.March, 5, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("expected the stale rate; got %v", err)
+	}
+	if !rate.Stale || !rate.Fallback || rate.Rate != 1.07 || rate.Date.Format(time.DateOnly) != "2024-03-05" {
+		t.Errorf("expected the stored Friday rate, stale; got %+v", rate)
+	}
+	if store.saved != 0 {
+		t.Errorf("expected the stale rate not stored; got %d saves", store.saved)
+	}
+}
+
+func TestRateOfTheSameCurrency(t *testing.T) {
+	provider := &fakeProvider{rate: 2}
+	s, _ := newTestService(provider)
+
+	rate, err := s.Rate(context.Background(), "EUR", "eur", time.Now())
+	if err != nil || rate.Rate != 1 || provider.calls != 0 {
+		t.Errorf("expected 1 without asking the provider; got %+v, %v", rate, err)
+	}
+}
+
+func TestFrankfurterProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("to") == "XXX" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"not found"}`))
+			return
+		}
+		if r.URL.Path != "/2024-03-03" || r.URL.Query().Get("from") != "EUR" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		w.Write([]byte(`{"amount":1.0,"base":"EUR","date":"2024-03-01","rates":{"USD":1.0838}}`))
+	}))
+	defer server.Close()
+
+	p := NewFrankfurterProvider(server.URL+"/", time.Second)
+	rate, published, err := p.Rate(context.Background(), "EUR", "USD", time.Date(2024, time.March, 3, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate != 1.0838 || published.Format(time.DateOnly) != "2024-03-01" {
+		t.Errorf("expected the Friday rate; got %v on %s", rate, published)
+	}
+
+	if _, _, err := p.Rate(context.Background(), "EUR", "XXX", time.Now()); !errors.Is(err, ErrUnknownCurrency) {
+		t.Errorf("expected ErrUnknownCurrency; got %v", err)
+	}
+}
+
+func TestStaticProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.json")
+	content := `{"base": "EUR", "rates": {
+		"2024-03-01": {"USD": 1.08, "GBP": 0.86},
+		"2024-03-04": {"USD": 1.09}
+	}}`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewStaticProvider(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		base, quote string
+		date        string
+		rate        float64
+		published   string
+	}{
+		{"EUR", "USD", "2024-03-04", 1.09, "2024-03-04"},
+		{"USD", "EUR", "2024-03-02", 1 / 1.08, "2024-03-01"},
+		// The last day quoting both
+		{"GBP", "USD", "2024-03-05", 1.08 / 0.86, "2024-03-01"},
+	}
+	for _, tt := range tests {
+		date, _ := time.Parse(time.DateOnly, tt.date)
+		rate, published, err := p.Rate(context.Background(), tt.base, tt.quote, date)
+		if err != nil {
+			t.Fatalf("%s to %s: %v", tt.base, tt.quote, err)
+		}
+		if math.Abs(rate-tt.rate) > 1e-12 || published.Format(time.DateOnly) != tt.published {
+			t.Errorf("%s to %s on %s: expected %v on %s; got %v on %s", tt.base, tt.quote, tt.date, tt.rate, tt.published, rate, published.Format(time.DateOnly))
+		}
+	}
+
+	if _, _, err := p.Rate(context.Background(), "EUR", "USD", time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)); !errors.Is(err, ErrUnknownCurrency) {
+		t.Errorf("expected no rate before the file; got %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package fx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// StaticProvider implements Provider with the rates of a JSON file, the
+// fallback of the API when it cannot be reached:
+//
+//	{"base": "EUR", "rates": {"2024-03-01": {"USD": 1.0838, "GBP": 0.8556}}}
+//
+// The rates of a day are against the base, the other pairs are crossed
+// through it. A day missing from the file has the rate of the last day
+// before it.
+type StaticProvider struct {
+	base  string
+	days  []time.Time // Sorted
+	rates map[time.Time]map[string]float64
+}
+
+// NewStaticProvider reads the rates of the file.
+func NewStaticProvider(path string) (*StaticProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Base  string                        `json:"base"`
+		Rates map[string]map[string]float64 `json:"rates"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid exchange rates file %s: %w", path, err)
+	}
+	if !IsCurrencyCode(file.Base) {
+		return nil, fmt.Errorf("invalid exchange rates file %s: base %q is not an ISO 4217 code", path, file.Base)
+	}
+
+	p := &StaticProvider{base: file.Base, rates: map[time.Time]map[string]float64{}}
+	for date, rates := range file.Rates {
+		day, err := time.Parse(time.DateOnly, date)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exchange rates file %s: %q is not a YYYY-MM-DD date", path, date)
+		}
+		for currency, rate := range rates {
+			if rate <= 0 {
+				return nil, fmt.Errorf("invalid exchange rates file %s: the rate of %s on %s must be positive", path, currency, date)
+			}
+		}
+		p.days = append(p.days, day)
+		p.rates[day] = rates
+	}
+	sort.Slice(p.days, func(i, j int) bool { return p.days[i].Before(p.days[j]) })
+	return p, nil
+}
+
+func (p *StaticProvider) Name() string {
+	return "static"
+}
+
+func (p *StaticProvider) Rate(_ context.Context, base, quote string, date time.Time) (float64, time.Time, error) {
+	// The last day on or before the date
+	i := sort.Search(len(p.days), func(i int) bool { return p.days[i].After(date) }) - 1
+	for ; i >= 0; i-- {
+		day := p.days[i]
+		from, ok := p.against(day, base)
+		if !ok {
+			continue
+		}
+		to, ok := p.against(day, quote)
+		if !ok {
+			continue
+		}
+		return to / from, day, nil
+	}
+	return 0, time.Time{}, fmt.Errorf("%w: no rate of %s to %s on or before %s in the file", ErrUnknownCurrency, base, quote, date.Format(time.DateOnly))
+}
+
+// against returns the rate of the currency against the base of the file on
+// the day.
+func (p *StaticProvider) against(day time.Time, currency string) (float64, bool) {
+	if currency == p.base {
+		return 1, true
+	}
+	rate, ok := p.rates[day][currency]
+	return rate, ok
+}
@@ -0,0 +1,134 @@
+package i18n
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DateStyle is the length of a formatted date, its pattern is the
+// "format.date_<style>" message of the locale.
+type DateStyle string
+
+const (
+	DateShort  DateStyle = "short"  // Jan 2
+	DateMedium DateStyle = "medium" // Jan 2, 2006
+	DateLong   DateStyle = "long"   // Monday, January 2
+	DateDay    DateStyle = "day"    // Mon Jan 2
+)
+
+// currencySymbols are the symbols of the common currencies, the others are
+// written with their code.
+var currencySymbols = map[string]string{
+	"EUR": "€",
+	"USD": "$",
+	"GBP": "£",
+}
+
+// Number formats the number with the decimals, and the group and decimal
+// separators of the locale: 1,234.56 in English, 1 234,56 in French.
+func (l Localizer) Number(value float64, decimals int) string {
+	text := strconv.FormatFloat(math.Abs(value), 'f', decimals, 64)
+	integer, fraction, _ := strings.Cut(text, ".")
+
+	group := message(l.Locale, "format.group")
+	var b strings.Builder
+	if value < 0 && strings.Trim(text, "0.") != "" {
+		b.WriteByte('-')
+	}
+	for i, digit := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			b.WriteString(group)
+		}
+		b.WriteRune(digit)
+	}
+	if fraction != "" {
+		b.WriteString(message(l.Locale, "format.decimal"))
+		b.WriteString(fraction)
+	}
+	return b.String()
+}
+
+// Amount formats the sum of money in the currency of the Localizer:
+// €1,234.56 in English, 1 234,56 € in French.
+func (l Localizer) Amount(value float64) string {
+	symbol, ok := currencySymbols[l.Currency]
+	if !ok {
+		symbol = l.Currency
+	}
+	number := l.Number(value, 2)
+	sign := ""
+	if rest, negative := strings.CutPrefix(number, "-"); negative {
+		sign, number = "-", rest
+	}
+	return sign + replace(message(l.Locale, "format.amount"), func(name string) (string, bool) {
+		switch name {
+		case "number":
+			return number, true
+		case "symbol":
+			return symbol, true
+		}
+		return "", false
+	})
+}
+
+// AmountFormat returns the spreadsheet number format of the amounts in the
+// currency of the Localizer, after the pattern of the locale: "€"#,##0.00
+// in English, #,##0.00" €" in French. The spreadsheet applies the
+// separators of its own locale.
+func (l Localizer) AmountFormat() string {
+	symbol, ok := currencySymbols[l.Currency]
+	if !ok {
+		symbol = l.Currency
+	}
+	pattern := replace(message(l.Locale, "format.amount"), func(name string) (string, bool) {
+		switch name {
+		case "number":
+			return "\x00", true
+		case "symbol":
+			return symbol, true
+		}
+		return "", false
+	})
+
+	prefix, suffix, _ := strings.Cut(pattern, "\x00")
+	quote := func(text string) string {
+		if text == "" {
+			return ""
+		}
+		return `"` + strings.ReplaceAll(text, `"`, "") + `"`
+	}
+	return quote(prefix) + "#,##0.00" + quote(suffix)
+}
+
+// Percent formats the percentage without decimals: 85% in English, 85 %
+// in French.
+func (l Localizer) Percent(value float64) string {
+	number := l.Number(value, 0)
+	return replace(message(l.Locale, "format.percent"), func(name string) (string, bool) {
+		return number, name == "number"
+	})
+}
+
+// Date formats the date in the style of the locale, with the names of its
+// months and days.
+func (l Localizer) Date(t time.Time, style DateStyle) string {
+	return replace(message(l.Locale, "format.date_"+string(style)), func(name string) (string, bool) {
+		switch name {
+		case "day":
+			return strconv.Itoa(t.Day()), true
+		case "year":
+			return strconv.Itoa(t.Year()), true
+		case "month":
+			return message(l.Locale, "month."+strconv.Itoa(int(t.Month()))), true
+		case "month_abbr":
+			return message(l.Locale, "month_abbr."+strconv.Itoa(int(t.Month()))), true
+		case "weekday":
+			return message(l.Locale, "weekday."+strconv.Itoa(int(t.Weekday()))), true
+		case "weekday_abbr":
+			return message(l.Locale, "weekday_abbr."+strconv.Itoa(int(t.Weekday()))), true
+		}
+		return "", false
+	})
+}
@@ -0,0 +1,201 @@
+// Package i18n holds the message catalogs of the server, embedded in the
+// binary, and formats the numbers, the amounts and the dates of a locale.
+//
+// A catalog is a flat JSON object of the messages by key: "errors.<code>"
+// for the error codes of the API, "validation.<rule>" for the rules of the
+// validator, "notifications.<event>.title" and ".message" for the
+// notifications, and "format.*", "month.*" and "weekday.*" for the
+// formatting. Placeholders are written {name}.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// Default is the locale of the users without a preference, and the one
+// the messages missing from the other catalogs are taken from.
+const Default = "en"
+
+//go:embed locales/*.json
+var files embed.FS
+
+// catalogs are the messages of each locale, by key.
+var catalogs = loadCatalogs()
+
+// warned records the missing keys already logged, "locale:key".
+var warned sync.Map
+
+func loadCatalogs() map[string]map[string]string {
+	names, err := fs.Glob(files, "locales/*.json")
+	if err != nil {
+		panic(err)
+	}
+	catalogs := make(map[string]map[string]string, len(names))
+	for _, name := range names {
+		content, err := files.ReadFile(name)
+		if err != nil {
+			panic(err)
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(content, &messages); err != nil {
+			panic(fmt.Sprintf("invalid catalog %s: %v", name, err))
+		}
+		catalogs[strings.TrimSuffix(path.Base(name), ".json")] = messages
+	}
+	return catalogs
+}
+
+// Supported lists the locales with a catalog.
+func Supported() []string {
+	locales := make([]string, 0, len(catalogs))
+	for locale := range catalogs {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// IsSupported reports whether the locale has a catalog.
+func IsSupported(locale string) bool {
+	_, ok := catalogs[locale]
+	return ok
+}
+
+// Match returns the supported locale an Accept-Language header prefers,
+// like "fr" for "fr-CH, fr;q=0.9, en;q=0.8", or "" when it names none.
+func Match(header string) string {
+	best, bestQuality := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+
+		language, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if language == "*" {
+			language = Default
+		}
+		if IsSupported(language) && quality > bestQuality {
+			best, bestQuality = language, quality
+		}
+	}
+	return best
+}
+
+// Lookup returns the message of the key in the catalog of the locale,
+// without falling back.
+func Lookup(locale, key string) (string, bool) {
+	message, ok := catalogs[locale][key]
+	return message, ok
+}
+
+// message returns the message of the key in the locale, falling back to
+// English with a warning logged once per key. A key English lacks too is
+// a bug: it is logged and returned as is.
+func message(locale, key string) string {
+	if message, ok := Lookup(locale, key); ok {
+		return message
+	}
+	if _, seen := warned.LoadOrStore(locale+":"+key, true); !seen {
+		log.Warn("Missing translation, falling back to English", "locale", locale, "key", key)
+	}
+	if message, ok := Lookup(Default, key); ok {
+		return message
+	}
+	log.Error("Unknown message key", "key", key)
+	return key
+}
+
+// Params are the values of the placeholders of a message. Amount, Percent
+// and time.Time values are formatted in the locale of the message.
+type Params map[string]any
+
+// Amount is a sum of money, formatted with the currency of the Localizer.
+type Amount float64
+
+// Percent is a percentage out of 100, formatted without decimals.
+type Percent float64
+
+// Localizer translates and formats in a locale.
+type Localizer struct {
+	Locale   string
+	Currency string // ISO 4217 code of the amounts
+}
+
+// For returns the Localizer of the locale, the default one when it is not
+// supported.
+func For(locale, currency string) Localizer {
+	if !IsSupported(locale) {
+		locale = Default
+	}
+	return Localizer{Locale: locale, Currency: currency}
+}
+
+// T returns the message of the key with its placeholders replaced.
+func (l Localizer) T(key string, params Params) string {
+	return replace(message(l.Locale, key), func(name string) (string, bool) {
+		value, ok := params[name]
+		if !ok {
+			return "", false
+		}
+		return l.format(value), true
+	})
+}
+
+// format returns a placeholder value as text.
+func (l Localizer) format(value any) string {
+	switch value := value.(type) {
+	case Amount:
+		return l.Amount(float64(value))
+	case Percent:
+		return l.Percent(float64(value))
+	case time.Time:
+		return l.Date(value, DateMedium)
+	case float64:
+		return l.Number(value, 2)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// replace substitutes the {name} placeholders of the message with the
+// values lookup returns, keeping the unknown ones.
+func replace(message string, lookup func(name string) (string, bool)) string {
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(message, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(message[start:], '}')
+		if end < 0 {
+			break
+		}
+		end += start
+		b.WriteString(message[:start])
+		if value, ok := lookup(message[start+1 : end]); ok {
+			b.WriteString(value)
+		} else {
+			b.WriteString(message[start : end+1])
+		}
+		message = message[end+1:]
+	}
+	b.WriteString(message)
+	return b.String()
+}
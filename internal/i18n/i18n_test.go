@@ -0,0 +1,108 @@
+package i18n
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCatalogsHaveTheSameKeys(t *testing.T) {
+	for _, locale := range Supported() {
+		for key := range catalogs[Default] {
+			if _, ok := catalogs[locale][key]; !ok {
+				t.Errorf("%s: missing %q", locale, key)
+			}
+		}
+		for key := range catalogs[locale] {
+			if _, ok := catalogs[Default][key]; !ok {
+				t.Errorf("%s: %q is not in the default catalog", locale, key)
+			}
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := map[string]string{
+		"fr":                             "fr",
+		"fr-CH, fr;q=0.9, en;q=0.8":      "fr",
+		"en-US,en;q=0.9,fr;q=0.8":        "en",
+		"de-DE, fr;q=0.5":                "fr",
+		"de-DE, it":                      "",
+		"*":                              "en",
+		"":                               "",
+		"en;q=0.2, fr;q=0.7, de;q=bogus": "fr",
+	}
+	for header, expected := range tests {
+		if got := Match(header); got != expected {
+			t.Errorf("%q: expected %q; got %q", header, expected, got)
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	due := time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)
+	params := Params{"bill": "Rent", "amount": Amount(1234.5), "due_date": due}
+
+	tests := []struct {
+		locale   string
+		expected string
+	}{
+		{"en", "Rent bill of €1,234.50 due on Mar 5, 2024"},
+		{"fr", "Facture Rent de 1\u202f234,50\u00a0€ à payer le 5 mars 2024"},
+		{"de", "Rent bill of €1,234.50 due on Mar 5, 2024"},
+	}
+	for _, tt := range tests {
+		if got := For(tt.locale, "EUR").T("notifications.bill_due.message", params); got != tt.expected {
+			t.Errorf("%s: expected %q; got %q", tt.locale, tt.expected, got)
+		}
+	}
+}
+
+func TestTFallsBack(t *testing.T) {
+	catalogs["fr"]["test.only_fr"] = "seulement {name}"
+	catalogs[Default]["test.only_en"] = "only {name}"
+	t.Cleanup(func() {
+		delete(catalogs["fr"], "test.only_fr")
+		delete(catalogs[Default], "test.only_en")
+	})
+
+	fr := For("fr", "EUR")
+	if got := fr.T("test.only_en", Params{"name": "Ada"}); got != "only Ada" {
+		t.Errorf("expected the English message; got %q", got)
+	}
+	if got := fr.T("test.only_fr", nil); got != "seulement {name}" {
+		t.Errorf("expected the unknown placeholder kept; got %q", got)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	en, fr := For("en", "EUR"), For("fr", "EUR")
+	date := time.Date(2024, 2, 26, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		got, expected string
+	}{
+		{en.Amount(1234.56), "€1,234.56"},
+		{fr.Amount(1234.56), "1\u202f234,56\u00a0€"},
+		{en.Amount(-1234567.891), "-€1,234,567.89"},
+		{fr.Amount(-12), "-12,00\u00a0€"},
+		{en.Amount(-0.001), "€0.00"},
+		{For("en", "CHF").Amount(5), "CHF5.00"},
+		{en.AmountFormat(), `"€"#,##0.00`},
+		{fr.AmountFormat(), "#,##0.00\"\u00a0€\""},
+		{en.Number(999, 0), "999"},
+		{en.Number(1000, 1), "1,000.0"},
+		{en.Percent(84.6), "85%"},
+		{fr.Percent(84.6), "85\u00a0%"},
+		{en.Date(date, DateShort), "Feb 26"},
+		{fr.Date(date, DateShort), "26 févr."},
+		{en.Date(date, DateLong), "Monday, February 26"},
+		{fr.Date(date, DateLong), "lundi 26 février"},
+		{en.Date(date, DateDay), "Mon Feb 26"},
+		{fr.Date(date, DateMedium), "26 févr. 2024"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.expected {
+			t.Errorf("expected %q; got %q", tt.expected, tt.got)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package importers
+
+import "strings"
+
+// categoryKeywords map the categories of the apps onto the categories of
+// FinMa, by the words of their names. The more specific words come first:
+// "Gas & Fuel" is transport, a "Gas" bill is not.
+var categoryKeywords = []struct {
+	keyword, category string
+}{
+	{"fuel", "transport"},
+	{"auto", "transport"},
+	{"transport", "transport"},
+	{"parking", "transport"},
+	{"taxi", "transport"},
+	{"ride share", "transport"},
+	{"car ", "transport"},
+	{"travel", "transport"},
+	{"grocer", "food"},
+	{"food", "food"},
+	{"restaurant", "food"},
+	{"dining", "food"},
+	{"coffee", "food"},
+	{"alcohol", "food"},
+	{"utilit", "bills"},
+	{"bill", "bills"},
+	{"rent", "bills"},
+	{"mortgage", "bills"},
+	{"electric", "bills"},
+	{"water", "bills"},
+	{"internet", "bills"},
+	{"phone", "bills"},
+	{"insurance", "bills"},
+	{"subscription", "bills"},
+	{"television", "bills"},
+	{"shopping", "shopping"},
+	{"clothing", "shopping"},
+	{"electronics", "shopping"},
+	{"books", "shopping"},
+	{"hobbies", "shopping"},
+	{"gift", "shopping"},
+	{"home improvement", "shopping"},
+}
+
+// Category returns the category of FinMa of a category of the apps, like
+// "food" for "Groceries" or "bills" for "Monthly Bills: Electric", "others"
+// when none matches. For "Group: Category" the category is matched before
+// its group.
+func Category(category string) string {
+	parts := strings.Split(category, ":")
+	for i := len(parts) - 1; i >= 0; i-- {
+		name := " " + strings.ToLower(strings.TrimSpace(parts[i])) + " "
+		for _, candidate := range categoryKeywords {
+			if strings.Contains(name, candidate.keyword) {
+				return candidate.category
+			}
+		}
+	}
+	return "others"
+}
+
+// accountKeywords guess the type of an account by its name, the exports not
+// holding it.
+var accountKeywords = []struct {
+	keyword, accountType string
+}{
+	{"credit", "credit_card"},
+	{"card", "credit_card"},
+	{"visa", "credit_card"},
+	{"mastercard", "credit_card"},
+	{"amex", "credit_card"},
+	{"saving", "savings"},
+	{"cash", "cash"},
+	{"wallet", "cash"},
+	{"mortgage", "loan"},
+	{"loan", "loan"},
+	{"brokerage", "investment"},
+	{"invest", "investment"},
+	{"401k", "investment"},
+	{"ira", "investment"},
+}
+
+// AccountType guesses the type of the account by its name, "checking" by
+// default.
+func AccountType(name string) string {
+	words := strings.Fields(strings.ToLower(name))
+	for _, candidate := range accountKeywords {
+		for _, word := range words {
+			if strings.HasPrefix(word, candidate.keyword) {
+				return candidate.accountType
+			}
+		}
+	}
+	return "checking"
+}
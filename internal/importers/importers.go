@@ -0,0 +1,233 @@
+// Package importers reads the exports of the finance apps the users move
+// from, Mint and YNAB, into their accounts, transactions and budgets. It
+// only parses: the server maps the result onto the data of the user.
+package importers
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"FinMa/types"
+)
+
+// ErrInvalidExport is returned for a file that is not an export of the app,
+// like a CSV without the columns of its layout.
+var ErrInvalidExport = errors.New("invalid export")
+
+// Transaction is a transaction of the export.
+type Transaction struct {
+	// ID is stable across the imports of the same row, so that importing an
+	// export again skips the rows already imported
+	ID       string
+	File     string // File of the export holding the row
+	Line     int
+	Account  string
+	Date     time.Time
+	Amount   types.Money // Signed, negative for the outflows, without a currency
+	Payee    string
+	Memo     string
+	Category string // Category of the app, like "Bills: Electric"
+	// TransferAccount is the account credited by a transfer, when the app
+	// links both sides
+	TransferAccount string
+	// Transfer is set for the transfers the app does not link, like the
+	// credit card payments of Mint, kept out of the budgets
+	Transfer bool
+	Split    bool // Part of a split transaction, each part is a transaction
+	// OpeningBalance is set for the balance of the account when it was
+	// added to the app, like the "Starting Balance" rows of YNAB
+	OpeningBalance bool
+}
+
+// Description returns the payee, with the memo when there is one.
+func (t Transaction) Description() string {
+	switch {
+	case t.Memo == "":
+		return t.Payee
+	case t.Payee == "":
+		return t.Memo
+	}
+	return t.Payee + " (" + t.Memo + ")"
+}
+
+// Budget is the amount assigned to a category of the app in a month.
+type Budget struct {
+	Month    time.Time
+	Category string
+	Amount   types.Money
+}
+
+// Export is what was read from an export.
+type Export struct {
+	Source       string // "mint" or "ynab"
+	Transactions []Transaction
+	Budgets      []Budget
+	Errors       []types.ImportRowError
+}
+
+// rowIDs gives the IDs of the rows: a hash of their fields, numbered when
+// the same row appears several times, like two coffees on the same day.
+type rowIDs struct {
+	source string
+	seen   map[string]int
+}
+
+func newRowIDs(source string) *rowIDs {
+	return &rowIDs{source: source, seen: map[string]int{}}
+}
+
+func (ids *rowIDs) next(fields ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\x1f")))
+	hash := hex.EncodeToString(sum[:12])
+	ids.seen[hash]++
+	return fmt.Sprintf("%s:%s:%d", ids.source, hash, ids.seen[hash])
+}
+
+// table reads a CSV whose first row names the columns.
+type table struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+// newTable reads the header of the CSV and checks it has the columns.
+func newTable(r io.Reader, required ...string) (*table, error) {
+	// The exports of YNAB start with a UTF-8 BOM
+	buffered := bufio.NewReader(r)
+	if bom, err := buffered.Peek(3); err == nil && string(bom) == "\xEF\xBB\xBF" {
+		buffered.Discard(3)
+	}
+	reader := csv.NewReader(buffered)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidExport, err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range required {
+		if _, ok := columns[strings.ToLower(name)]; !ok {
+			return nil, fmt.Errorf("%w: no %q column", ErrInvalidExport, name)
+		}
+	}
+	return &table{reader: reader, columns: columns}, nil
+}
+
+// has reports whether the CSV has the column.
+func (t *table) has(column string) bool {
+	_, ok := t.columns[strings.ToLower(column)]
+	return ok
+}
+
+// next returns the next row and its line, io.EOF after the last one.
+func (t *table) next() (func(column string) string, int, error) {
+	record, err := t.reader.Read()
+	if err != nil {
+		return nil, 0, err
+	}
+	line, _ := t.reader.FieldPos(0)
+	get := func(column string) string {
+		i, ok := t.columns[strings.ToLower(column)]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+	return get, line, nil
+}
+
+// amountPattern matches the amounts as the apps write them, with their
+// currency symbol or code and their separators, like "$1,234.56",
+// "-12,34 €" or "($5.00)".
+var amountPattern = regexp.MustCompile(`^[(-]?\s*[^\d\s.,()-]{0,3}\s*-?\s*(\d[\d.,' ]*\d|\d)\s*[^\d\s.,()-]{0,3}\s*\)?$`)
+
+// parseAmount parses an amount of the export. The last of the "." and ","
+// separators followed by one or two digits is the decimal one, the others
+// group the thousands.
+func parseAmount(text string) (types.Money, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return types.Money{}, nil
+	}
+	match := amountPattern.FindStringSubmatch(text)
+	if match == nil {
+		return types.Money{}, fmt.Errorf("invalid amount %q", text)
+	}
+	negative := strings.Contains(text, "-") || strings.HasPrefix(text, "(")
+
+	digits := strings.NewReplacer(" ", "", "'", "").Replace(match[1])
+	decimal := strings.LastIndexAny(digits, ".,")
+	if decimal >= 0 && len(digits)-decimal-1 <= 2 {
+		digits = strings.NewReplacer(".", "", ",", "").Replace(digits[:decimal]) + "." + digits[decimal+1:]
+	} else {
+		digits = strings.NewReplacer(".", "", ",", "").Replace(digits)
+	}
+	if negative {
+		digits = "-" + digits
+	}
+
+	amount, err := types.ParseMoney(digits, "")
+	if err != nil {
+		return types.Money{}, fmt.Errorf("invalid amount %q", text)
+	}
+	return amount, nil
+}
+
+// dateLayouts are the layouts of the dates of the exports, which follow the
+// settings of the user. A file is read with the first layout parsing all
+// its dates, so that 03/04 is the same day on every row.
+var dateLayouts = []string{"1/2/2006", "2/1/2006", "2006-01-02", "2.1.2006", "2006/01/02"}
+
+// dateLayout returns the first layout parsing every date.
+func dateLayout(dates []string) (string, error) {
+	for _, layout := range dateLayouts {
+		valid := true
+		for _, date := range dates {
+			if _, err := time.Parse(layout, date); err != nil {
+				valid = false
+				break
+			}
+		}
+		if valid {
+			return layout, nil
+		}
+	}
+	return "", errors.New("the dates are not in a known format")
+}
+
+// parseDates parses the dates of the rows with the layout of the file.
+func parseDates(dates []string) ([]time.Time, error) {
+	layout, err := dateLayout(dates)
+	if err != nil {
+		return nil, err
+	}
+	parsed := make([]time.Time, len(dates))
+	for i, date := range dates {
+		parsed[i], _ = time.Parse(layout, date)
+	}
+	return parsed, nil
+}
+
+// splitPattern matches the memo of the parts of a split transaction in
+// YNAB, like "Split (1/3) Dinner".
+var splitPattern = regexp.MustCompile(`^Split \((\d+)/(\d+)\)\s*`)
+
+// cleanMemo removes the split prefix of the memo, and reports whether there
+// was one.
+func cleanMemo(memo string) (string, bool) {
+	if loc := splitPattern.FindStringIndex(memo); loc != nil {
+		return strings.TrimSpace(memo[loc[1]:]), true
+	}
+	return memo, false
+}
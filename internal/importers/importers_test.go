@@ -0,0 +1,192 @@
+package importers
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMint(t *testing.T) {
+	f, err := os.Open("testdata/mint-transactions.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	export, err := ParseMint(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(export.Transactions) != 10 {
+		t.Fatalf("expected 10 transactions; got %d", len(export.Transactions))
+	}
+	if len(export.Errors) != 1 || export.Errors[0].Line != 12 {
+		t.Errorf("expected the row of line 12 refused; got %+v", export.Errors)
+	}
+
+	groceries := export.Transactions[0]
+	if groceries.Amount.String() != "-54.21" || groceries.Account != "Chase Checking" ||
+		!groceries.Date.Equal(time.Date(2023, time.January, 5, 0, 0, 0, 0, time.UTC)) || Category(groceries.Category) != "food" {
+		t.Errorf("unexpected groceries: %+v", groceries)
+	}
+	if paycheck := export.Transactions[4]; paycheck.Amount.String() != "2450.00" {
+		t.Errorf("expected the paycheck as a credit of 2450; got %s", paycheck.Amount)
+	}
+	if payment := export.Transactions[5]; !payment.Transfer {
+		t.Errorf("expected the card payment as a transfer; got %+v", payment)
+	}
+	if comcast := export.Transactions[7]; comcast.Description() != "Comcast (Promo ends in June)" {
+		t.Errorf("expected the notes in the description; got %q", comcast.Description())
+	}
+
+	// The same coffee twice on the same day are two transactions
+	if first, second := export.Transactions[1].ID, export.Transactions[2].ID; first == second || !strings.HasPrefix(first, "mint:") {
+		t.Errorf("expected distinct IDs for the two coffees; got %s and %s", first, second)
+	}
+}
+
+func TestParseMintIDsAreStable(t *testing.T) {
+	read := func() *Export {
+		data, err := os.ReadFile("testdata/mint-transactions.csv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		export, err := ParseMint(strings.NewReader(string(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return export
+	}
+	first, second := read(), read()
+	for i := range first.Transactions {
+		if first.Transactions[i].ID != second.Transactions[i].ID {
+			t.Errorf("row %d: expected the same ID on each import", i)
+		}
+	}
+}
+
+func TestParseYNABZip(t *testing.T) {
+	f, err := os.Open("testdata/ynab-export.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	info, _ := f.Stat()
+
+	export, err := ParseYNAB(f, info.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(export.Errors) != 0 {
+		t.Errorf("expected no errors; got %+v", export.Errors)
+	}
+
+	// The inflow side of the transfer is carried by its outflow side
+	if len(export.Transactions) != 7 {
+		t.Fatalf("expected 7 transactions; got %d", len(export.Transactions))
+	}
+	split := export.Transactions[1]
+	if !split.Split || split.Memo != "Weekly shop" || split.Amount.String() != "-62.30" || Category(split.Category) != "food" {
+		t.Errorf("unexpected split part: %+v", split)
+	}
+	transfer := export.Transactions[3]
+	if transfer.TransferAccount != "Savings" || transfer.Account != "Checking" || transfer.Amount.String() != "-300.00" {
+		t.Errorf("unexpected transfer: %+v", transfer)
+	}
+	if income := export.Transactions[4]; income.Amount.String() != "3100.00" {
+		t.Errorf("expected the income of 3100; got %s", income.Amount)
+	}
+
+	// The card payments are not budgets
+	if len(export.Budgets) != 6 {
+		t.Fatalf("expected 6 budgets; got %d", len(export.Budgets))
+	}
+	if rent := export.Budgets[0]; rent.Month != time.Date(2023, time.December, 1, 0, 0, 0, 0, time.UTC) || rent.Amount.String() != "1200.00" || Category(rent.Category) != "bills" {
+		t.Errorf("unexpected rent budget: %+v", rent)
+	}
+}
+
+func TestParseYNABStartingBalance(t *testing.T) {
+	data, err := os.ReadFile("testdata/ynab-register.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	export, err := ParseYNAB(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(export.Transactions) != 3 {
+		t.Fatalf("expected 3 transactions; got %d", len(export.Transactions))
+	}
+	for i, transaction := range export.Transactions {
+		if opening := i == 2; transaction.OpeningBalance != opening {
+			t.Errorf("expected only the starting balance as the opening balance; got %+v", transaction)
+		}
+	}
+	if opening := export.Transactions[2]; opening.Account != "Checking" || opening.Amount.String() != "1500.00" {
+		t.Errorf("unexpected opening balance: %+v", opening)
+	}
+}
+
+func TestParseYNABRefusesOtherFiles(t *testing.T) {
+	for name, data := range map[string]string{
+		"mint":  `"Date","Description","Amount"` + "\n",
+		"empty": "",
+		"text":  "hello",
+	} {
+		if _, err := ParseYNAB(strings.NewReader(data), int64(len(data))); !errors.Is(err, ErrInvalidExport) {
+			t.Errorf("%s: expected an invalid export; got %v", name, err)
+		}
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := map[string]string{
+		"$1,234.56": "1234.56",
+		"-$5.00":    "-5.00",
+		"($5.00)":   "-5.00",
+		"12,34 €":   "12.34",
+		"1.234,5":   "1234.50",
+		"1,234":     "1234.00",
+		"€-0.99":    "-0.99",
+		"0":         "0.00",
+	}
+	for text, expected := range tests {
+		amount, err := parseAmount(text)
+		if err != nil || amount.String() != expected {
+			t.Errorf("%s: expected %s; got %s, %v", text, expected, amount, err)
+		}
+	}
+	for _, invalid := range []string{"abc", "1-2", "12 EUR 34", "$$$$12"} {
+		if amount, err := parseAmount(invalid); err == nil {
+			t.Errorf("%s: expected an error; got %s", invalid, amount)
+		}
+	}
+}
+
+func TestCategory(t *testing.T) {
+	tests := map[string]string{
+		"Groceries":                    "food",
+		"Gas & Fuel":                   "transport",
+		"Monthly Bills: Gas":           "bills",
+		"Monthly Bills: Electric":      "bills",
+		"Everyday Expenses: Household": "others",
+		"Shopping":                     "shopping",
+		"Auto & Transport":             "transport",
+		"":                             "others",
+	}
+	for category, expected := range tests {
+		if got := Category(category); got != expected {
+			t.Errorf("%q: expected %s; got %s", category, expected, got)
+		}
+	}
+	for name, expected := range map[string]string{"Chase Freedom Card": "credit_card", "Ally Savings": "savings", "Checking": "checking", "Roth IRA": "investment"} {
+		if got := AccountType(name); got != expected {
+			t.Errorf("%q: expected %s; got %s", name, expected, got)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package importers
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"FinMa/types"
+)
+
+// mintTransfers are the categories of Mint for the money moved between the
+// accounts of the user. Mint does not link both sides.
+var mintTransfers = map[string]bool{
+	"transfer":                   true,
+	"credit card payment":        true,
+	"transfer for cash spending": true,
+}
+
+// ParseMint reads the transactions.csv export of Mint: one row per
+// transaction, its amount always positive and its direction in the
+// "Transaction Type" column, debit or credit.
+func ParseMint(r io.Reader) (*Export, error) {
+	t, err := newTable(r, "Date", "Description", "Amount", "Transaction Type", "Category", "Account Name")
+	if err != nil {
+		return nil, err
+	}
+
+	export := &Export{Source: "mint"}
+	ids := newRowIDs("mint")
+	type row struct {
+		get  func(string) string
+		line int
+	}
+	var rows []row
+	var dates []string
+	for {
+		get, line, err := t.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidExport, err)
+		}
+		if get("Date") == "" && get("Amount") == "" {
+			continue
+		}
+		rows = append(rows, row{get, line})
+		dates = append(dates, get("Date"))
+	}
+	parsed, err := parseDates(dates)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidExport, err)
+	}
+
+	for i, row := range rows {
+		get := row.get
+		rowError := func(message string) {
+			export.Errors = append(export.Errors, types.ImportRowError{File: "transactions.csv", Line: row.line, Message: message})
+		}
+
+		amount, err := parseAmount(get("Amount"))
+		if err != nil {
+			rowError(err.Error())
+			continue
+		}
+		switch strings.ToLower(get("Transaction Type")) {
+		case "debit":
+			if amount.Sign() > 0 {
+				amount = amount.Neg()
+			}
+		case "credit":
+		default:
+			rowError(fmt.Sprintf("unknown transaction type %q", get("Transaction Type")))
+			continue
+		}
+		if amount.IsZero() {
+			rowError("zero amount")
+			continue
+		}
+		if get("Account Name") == "" {
+			rowError("no account")
+			continue
+		}
+
+		category := get("Category")
+		export.Transactions = append(export.Transactions, Transaction{
+			ID:       ids.next(get("Account Name"), get("Date"), amount.String(), get("Original Description"), get("Description"), category),
+			File:     "transactions.csv",
+			Line:     row.line,
+			Account:  get("Account Name"),
+			Date:     parsed[i],
+			Amount:   amount,
+			Payee:    get("Description"),
+			Memo:     get("Notes"),
+			Category: category,
+			Transfer: mintTransfers[strings.ToLower(category)],
+		})
+	}
+	return export, nil
+}
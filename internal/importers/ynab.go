@@ -0,0 +1,238 @@
+package importers
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"FinMa/types"
+)
+
+// maxEntrySize bounds the files read from a zip, whose entries may unpack
+// to far more than the upload.
+const maxEntrySize = 64 << 20
+
+// ynabTransferPrefix starts the payee of the transfers in YNAB, followed by
+// the name of the other account.
+const ynabTransferPrefix = "Transfer : "
+
+// ynabStartingBalance is the payee of the row YNAB adds with the balance of
+// an account when it is added.
+const ynabStartingBalance = "Starting Balance"
+
+// ParseYNAB reads an export of YNAB: the zip holding the register and the
+// plan CSVs of a budget, or one of these CSVs alone. The register lists the
+// transactions, the parts of a split transaction on rows of their own; the
+// plan lists the amounts assigned to each category every month.
+func ParseYNAB(r io.ReaderAt, size int64) (*Export, error) {
+	export := &Export{Source: "ynab"}
+	ids := newRowIDs("ynab")
+
+	magic := make([]byte, 4)
+	if _, err := r.ReadAt(magic, 0); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidExport, err)
+	}
+	if !bytes.Equal(magic, []byte("PK\x03\x04")) {
+		if err := parseYNABFile(export, ids, "export.csv", io.NewSectionReader(r, 0, size)); err != nil {
+			return nil, err
+		}
+		return export, nil
+	}
+
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidExport, err)
+	}
+	found := false
+	for _, file := range archive.File {
+		if file.FileInfo().IsDir() || !strings.EqualFold(path.Ext(file.Name), ".csv") {
+			continue
+		}
+		f, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidExport, err)
+		}
+		err = parseYNABFile(export, ids, path.Base(file.Name), &limitedReader{r: f, n: maxEntrySize})
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		found = true
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: no CSV in the zip", ErrInvalidExport)
+	}
+	return export, nil
+}
+
+// limitedReader fails past n bytes, where io.LimitReader would truncate.
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n, fmt.Errorf("%w: file larger than %d MB unpacked", ErrInvalidExport, maxEntrySize>>20)
+	}
+	return n, err
+}
+
+// parseYNABFile reads the register or the plan CSV, told apart by their
+// columns.
+func parseYNABFile(export *Export, ids *rowIDs, name string, r io.Reader) error {
+	t, err := newTable(r, "Category Group/Category")
+	if err != nil {
+		return err
+	}
+	switch {
+	case t.has("Account") && t.has("Outflow") && t.has("Inflow"):
+		return parseYNABRegister(export, ids, name, t)
+	case t.has("Month") && (t.has("Assigned") || t.has("Budgeted")):
+		return parseYNABPlan(export, name, t)
+	}
+	return fmt.Errorf("%w: %s is neither a register nor a plan", ErrInvalidExport, name)
+}
+
+// ynabCategory returns the "Group: Category" of the row, empty for the
+// transfers and the uncategorized rows.
+func ynabCategory(get func(string) string) string {
+	category := get("Category Group/Category")
+	if category == "" && get("Category") != "" {
+		category = get("Category Group") + ": " + get("Category")
+	}
+	return strings.TrimSpace(category)
+}
+
+func parseYNABRegister(export *Export, ids *rowIDs, name string, t *table) error {
+	type row struct {
+		get  func(string) string
+		line int
+	}
+	var rows []row
+	var dates []string
+	for {
+		get, line, err := t.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidExport, err)
+		}
+		if get("Date") == "" {
+			continue
+		}
+		rows = append(rows, row{get, line})
+		dates = append(dates, get("Date"))
+	}
+	parsed, err := parseDates(dates)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidExport, err)
+	}
+
+	for i, row := range rows {
+		get := row.get
+		rowError := func(message string) {
+			export.Errors = append(export.Errors, types.ImportRowError{File: name, Line: row.line, Message: message})
+		}
+
+		outflow, err := parseAmount(get("Outflow"))
+		if err != nil {
+			rowError(err.Error())
+			continue
+		}
+		inflow, err := parseAmount(get("Inflow"))
+		if err != nil {
+			rowError(err.Error())
+			continue
+		}
+		amount, err := inflow.Sub(outflow)
+		if err != nil || amount.IsZero() {
+			rowError("zero amount")
+			continue
+		}
+		if get("Account") == "" {
+			rowError("no account")
+			continue
+		}
+
+		payee := get("Payee")
+		memo, split := cleanMemo(get("Memo"))
+		transaction := Transaction{
+			ID:       ids.next(get("Account"), get("Date"), amount.String(), payee, get("Memo"), ynabCategory(get)),
+			File:     name,
+			Line:     row.line,
+			Account:  get("Account"),
+			Date:     parsed[i],
+			Amount:   amount,
+			Payee:    payee,
+			Memo:     memo,
+			Category: ynabCategory(get),
+			Split:    split,
+
+			OpeningBalance: strings.EqualFold(payee, ynabStartingBalance),
+		}
+		if other, ok := strings.CutPrefix(payee, ynabTransferPrefix); ok {
+			// Both sides are in the register, the outflow side carries the
+			// transfer
+			if amount.Sign() > 0 {
+				continue
+			}
+			transaction.TransferAccount = strings.TrimSpace(other)
+		}
+		export.Transactions = append(export.Transactions, transaction)
+	}
+	return nil
+}
+
+// ynabSkippedGroups are the category groups of the plan that are not
+// spending: the income waiting to be assigned and the card payments.
+var ynabSkippedGroups = map[string]bool{
+	"inflow":                   true,
+	"credit card payments":     true,
+	"internal master category": true,
+}
+
+func parseYNABPlan(export *Export, name string, t *table) error {
+	assigned := "Assigned"
+	if !t.has(assigned) {
+		assigned = "Budgeted"
+	}
+
+	for {
+		get, line, err := t.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidExport, err)
+		}
+		if get("Month") == "" || ynabSkippedGroups[strings.ToLower(get("Category Group"))] {
+			continue
+		}
+		rowError := func(message string) {
+			export.Errors = append(export.Errors, types.ImportRowError{File: name, Line: line, Message: message})
+		}
+
+		month, err := time.Parse("Jan 2006", get("Month"))
+		if err != nil {
+			rowError(fmt.Sprintf("invalid month %q", get("Month")))
+			continue
+		}
+		amount, err := parseAmount(get(assigned))
+		if err != nil {
+			rowError(err.Error())
+			continue
+		}
+		if amount.Sign() <= 0 {
+			continue
+		}
+		export.Budgets = append(export.Budgets, Budget{Month: month, Category: ynabCategory(get), Amount: amount})
+	}
+}
@@ -0,0 +1,126 @@
+// Package logging keeps the personal data and the secrets out of the logs:
+// the helpers redact the values logged on purpose, and the writer and the
+// handler scrub the emails, the tokens and the credentials of every line.
+package logging
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/log"
+)
+
+var (
+	urlCredentials = regexp.MustCompile(`(://)[^/@\s]+@`)
+	emails         = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	bearerTokens   = regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]+`)
+	jwts           = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	// The values of the keys naming a secret, in the JSON bodies, and in the
+	// query strings and key=value pairs
+	jsonSecrets = regexp.MustCompile(`(?i)("[a-z_]*(?:password|secret|token|cookie|authorization)[a-z_]*"\s*:\s*")[^"]*`)
+	pairSecrets = regexp.MustCompile(`(?i)\b([a-z_]*(?:password|secret|token|cookie|authorization)[a-z_]*=)[^\s&"]+`)
+)
+
+// Email returns a stable short token standing for the email, the same for
+// every line logging it so that they can be correlated.
+func Email(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return "email:" + hex.EncodeToString(sum[:4])
+}
+
+// Mask masks every character of the identifier but the last 4.
+func Mask(id string) string {
+	if len(id) <= 4 {
+		return strings.Repeat("*", len(id))
+	}
+	return strings.Repeat("*", len(id)-4) + id[len(id)-4:]
+}
+
+// Amount stands for an amount of money, never logged.
+func Amount(any) string {
+	return "[amount]"
+}
+
+// Redact scrubs the text: the credentials of the URLs, the emails, the
+// bearer tokens, the JWTs and the values of the secret keys.
+func Redact(text string) string {
+	text = urlCredentials.ReplaceAllString(text, "${1}[redacted]@")
+	text = emails.ReplaceAllStringFunc(text, Email)
+	text = bearerTokens.ReplaceAllString(text, "${1}[redacted]")
+	text = jwts.ReplaceAllString(text, "[redacted]")
+	text = jsonSecrets.ReplaceAllString(text, "${1}[redacted]")
+	return pairSecrets.ReplaceAllString(text, "${1}[redacted]")
+}
+
+// writer redacts the lines written to w.
+type writer struct {
+	w io.Writer
+}
+
+// NewWriter returns a writer redacting what it writes to w, one log line
+// per write.
+func NewWriter(w io.Writer) io.Writer {
+	return writer{w: w}
+}
+
+func (w writer) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.w, Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// SetOutput writes the log of the application to w, redacted.
+func SetOutput(w io.Writer) {
+	log.SetOutput(NewWriter(w))
+}
+
+// handler redacts the message and the string attributes of the records.
+type handler struct {
+	slog.Handler
+}
+
+// NewHandler returns a handler redacting the records before h handles them.
+func NewHandler(h slog.Handler) slog.Handler {
+	return handler{Handler: h}
+}
+
+func (h handler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, Redact(record.Message), record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(redactAttr(attr))
+		return true
+	})
+	return h.Handler.Handle(ctx, redacted)
+}
+
+func (h handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	for i, attr := range attrs {
+		attrs[i] = redactAttr(attr)
+	}
+	return handler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h handler) WithGroup(name string) slog.Handler {
+	return handler{Handler: h.Handler.WithGroup(name)}
+}
+
+func redactAttr(attr slog.Attr) slog.Attr {
+	switch attr.Value.Kind() {
+	case slog.KindString:
+		attr.Value = slog.StringValue(Redact(attr.Value.String()))
+	case slog.KindGroup:
+		group := attr.Value.Group()
+		redacted := make([]slog.Attr, len(group))
+		for i, member := range group {
+			redacted[i] = redactAttr(member)
+		}
+		attr.Value = slog.GroupValue(redacted...)
+	}
+	return attr
+}
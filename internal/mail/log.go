@@ -0,0 +1,18 @@
+package mail
+
+import (
+	"context"
+
+	"github.com/charmbracelet/log"
+
+	"FinMa/internal/logging"
+)
+
+// LogMailer only logs the emails, it is the default in development.
+type LogMailer struct{}
+
+func (LogMailer) Send(ctx context.Context, message Message) error {
+	log.Info("Email not sent, log only mailer", "to", logging.Email(message.To), "subject", message.Subject, "template", message.Template)
+	log.Debug(message.Text)
+	return nil
+}
@@ -0,0 +1,172 @@
+package mail
+
+import (
+	"FinMa/internal/i18n"
+	"FinMa/types"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	netmail "net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRender(t *testing.T) {
+	data := struct {
+		FirstName string
+		Title     string
+		Message   string
+	}{"Ada", "Budget exceeded", "Groceries <budget> exceeded its limit"}
+
+	message, err := Render("notification", i18n.For("en", "EUR"), "ada@example.com", data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if message.Subject != "FinMa: Budget exceeded" {
+		t.Errorf("expected subject %q; got %q", "FinMa: Budget exceeded", message.Subject)
+	}
+	if !strings.Contains(message.Text, "Hello Ada,") || !strings.Contains(message.Text, "Groceries <budget> exceeded") {
+		t.Errorf("expected the greeting and the raw message in the text; got %q", message.Text)
+	}
+	if !strings.Contains(message.HTML, "Groceries &lt;budget&gt; exceeded") {
+		t.Errorf("expected the message escaped in the HTML; got %q", message.HTML)
+	}
+	if message.To != "ada@example.com" || message.Template != "notification" {
+		t.Errorf("expected recipient and template to be set; got %+v", message)
+	}
+
+	if _, err := Render("missing", i18n.For("en", "EUR"), "ada@example.com", data); !errors.Is(err, ErrUnknownTemplate) {
+		t.Errorf("expected ErrUnknownTemplate; got %v", err)
+	}
+}
+
+func TestRenderLocale(t *testing.T) {
+	data := struct {
+		FirstName string
+		Title     string
+		Message   string
+	}{"Léa", "Budget dépassé", "Le budget Courses a dépassé sa limite"}
+
+	message, err := Render("notification", i18n.For("fr", "EUR"), "lea@example.com", data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if message.Subject != "FinMa : Budget dépassé" || !strings.Contains(message.Text, "Bonjour Léa,") {
+		t.Errorf("expected the French template; got %q %q", message.Subject, message.Text)
+	}
+	if !strings.Contains(message.HTML, `<html lang="fr">`) {
+		t.Errorf("expected the French layout; got %q", message.HTML)
+	}
+
+	message, err = Render("notification", i18n.For("de", "EUR"), "lea@example.com", data)
+	if err != nil || !strings.Contains(message.Text, "Hello Léa,") {
+		t.Errorf("expected the English template for an unsupported locale; got %q, %v", message.Text, err)
+	}
+}
+
+// recorder keeps the last state of each delivery.
+type recorder struct {
+	mu         sync.Mutex
+	deliveries map[string]types.EmailDelivery
+}
+
+func (r *recorder) SaveEmailDelivery(delivery *types.EmailDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deliveries[delivery.Recipient] = *delivery
+	return nil
+}
+
+func TestQueueRetriesFailedSends(t *testing.T) {
+	mailer := NewMockMailer()
+	mailer.Failures = []error{errors.New("connection refused"), errors.New("connection refused")}
+	deliveries := &recorder{deliveries: map[string]types.EmailDelivery{}}
+
+	queue := NewQueue(mailer, deliveries, QueueConfig{Workers: 1, Size: 10, Attempts: 3, Backoff: time.Millisecond})
+	if err := queue.Enqueue(Message{To: "ada@example.com", Subject: "Hello", Template: "notification"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	queue.Close()
+
+	if len(mailer.Messages()) != 1 {
+		t.Fatalf("expected 1 message sent; got %d", len(mailer.Messages()))
+	}
+	delivery := deliveries.deliveries["ada@example.com"]
+	if delivery.Status != "sent" || delivery.Attempts != 3 || delivery.SentAt == nil {
+		t.Errorf("expected a sent delivery after 3 attempts; got %+v", delivery)
+	}
+
+	if err := queue.Enqueue(Message{To: "bob@example.com"}); !errors.Is(err, ErrQueueClosed) {
+		t.Errorf("expected ErrQueueClosed; got %v", err)
+	}
+}
+
+func TestQueueGivesUp(t *testing.T) {
+	mailer := NewMockMailer()
+	mailer.Failures = []error{errors.New("mailbox unavailable"), errors.New("mailbox unavailable")}
+	deliveries := &recorder{deliveries: map[string]types.EmailDelivery{}}
+
+	queue := NewQueue(mailer, deliveries, QueueConfig{Workers: 1, Size: 10, Attempts: 2, Backoff: time.Millisecond})
+	if err := queue.Enqueue(Message{To: "ada@example.com"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	queue.Close()
+
+	delivery := deliveries.deliveries["ada@example.com"]
+	if delivery.Status != "failed" || delivery.Attempts != 2 || delivery.LastError != "mailbox unavailable" {
+		t.Errorf("expected a failed delivery after 2 attempts; got %+v", delivery)
+	}
+}
+
+func TestBuildMIMEAttachments(t *testing.T) {
+	message := Message{To: "ada@example.com", Subject: "Report", Text: "Attached", HTML: "<p>Attached</p>"}
+	email, err := buildMIME("finma@example.com", message)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(email), "Content-Type: multipart/alternative;") {
+		t.Errorf("expected a multipart/alternative email without attachments; got %q", email)
+	}
+
+	data := []byte(strings.Repeat("date,amount\n", 20))
+	message.Attachments = []Attachment{{Filename: "report.csv", ContentType: "text/csv", Data: data}}
+	email, err = buildMIME("finma@example.com", message)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	parsed, err := netmail.ReadMessage(bytes.NewReader(email))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("expected a multipart/mixed email; got %q (%v)", mediaType, err)
+	}
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	alternative, err := reader.NextPart()
+	if err != nil || !strings.HasPrefix(alternative.Header.Get("Content-Type"), "multipart/alternative;") {
+		t.Fatalf("expected the bodies first; got %v (%v)", alternative.Header, err)
+	}
+	attachment, err := reader.NextPart()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if attachment.FileName() != "report.csv" {
+		t.Errorf("expected the attachment report.csv; got %q", attachment.FileName())
+	}
+	// The multipart reader does not decode base64
+	encoded, err := io.ReadAll(attachment)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(encoded), "\r\n", ""))
+	if err != nil || !bytes.Equal(decoded, data) {
+		t.Errorf("expected the attached data; got %q (%v)", decoded, err)
+	}
+}
@@ -0,0 +1,35 @@
+package mail
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// Message is an email ready to be sent, with a plaintext and an HTML body,
+// and its attachments.
+type Message struct {
+	To          string
+	Subject     string
+	Text        string
+	HTML        string
+	Attachments []Attachment
+
+	// UserID and Template describe the message in the delivery records, of
+	// ID DeliveryID when set
+	UserID     *uuid.UUID
+	Template   string
+	DeliveryID uuid.UUID
+}
+
+// Attachment is a file attached to a message.
+type Attachment struct {
+	Filename    string
+	ContentType string // The media type, without parameters
+	Data        []byte
+}
+
+// Mailer sends emails.
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
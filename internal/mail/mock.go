@@ -0,0 +1,39 @@
+package mail
+
+import (
+	"context"
+	"sync"
+)
+
+// MockMailer captures the emails instead of sending them, it is used in tests.
+type MockMailer struct {
+	mu       sync.Mutex
+	messages []Message
+
+	// Failures makes the next Send calls fail, one error per call
+	Failures []error
+}
+
+func NewMockMailer() *MockMailer {
+	return &MockMailer{}
+}
+
+func (m *MockMailer) Send(ctx context.Context, message Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.Failures) > 0 {
+		err := m.Failures[0]
+		m.Failures = m.Failures[1:]
+		return err
+	}
+	m.messages = append(m.messages, message)
+	return nil
+}
+
+// Messages returns the emails sent so far.
+func (m *MockMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
@@ -0,0 +1,172 @@
+package mail
+
+import (
+	"FinMa/internal/logging"
+	"FinMa/types"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+)
+
+// sendTimeout bounds each attempt to send a message.
+const sendTimeout = 30 * time.Second
+
+var (
+	// ErrQueueFull is returned when the queue cannot take more messages.
+	ErrQueueFull = errors.New("email queue is full")
+	// ErrQueueClosed is returned when enqueuing after Close.
+	ErrQueueClosed = errors.New("email queue is closed")
+)
+
+// DeliveryRecorder stores the delivery records of the messages.
+type DeliveryRecorder interface {
+	SaveEmailDelivery(delivery *types.EmailDelivery) error
+}
+
+// QueueConfig sizes the queue and its retries.
+type QueueConfig struct {
+	Workers int
+	Size    int
+	// Attempts is the number of times a message is tried before failing
+	Attempts int
+	// Backoff is the wait before the first retry, doubled for each next one
+	Backoff time.Duration
+}
+
+type job struct {
+	message  Message
+	delivery *types.EmailDelivery
+}
+
+// Queue sends messages in the background so that request handlers never
+// wait for the SMTP server. Failed sends are retried with an exponential
+// backoff and every message has a delivery record.
+type Queue struct {
+	mailer   Mailer
+	recorder DeliveryRecorder
+	config   QueueConfig
+
+	mu     sync.RWMutex
+	closed bool
+	jobs   chan job
+	wg     sync.WaitGroup
+}
+
+// NewQueue starts the workers of a queue sending through mailer. recorder
+// may be nil to keep no delivery records.
+func NewQueue(mailer Mailer, recorder DeliveryRecorder, config QueueConfig) *Queue {
+	config.Workers = max(config.Workers, 1)
+	config.Attempts = max(config.Attempts, 1)
+
+	q := &Queue{
+		mailer:   mailer,
+		recorder: recorder,
+		config:   config,
+		jobs:     make(chan job, max(config.Size, 0)),
+	}
+	for i := 0; i < config.Workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+	return q
+}
+
+// Enqueue records the message as queued and hands it to the workers
+// without blocking.
+func (q *Queue) Enqueue(message Message) error {
+	id := message.DeliveryID
+	if id == uuid.Nil {
+		id = uuid.New()
+	}
+	delivery := &types.EmailDelivery{
+		ID:        id,
+		UserID:    message.UserID,
+		Recipient: message.To,
+		Template:  message.Template,
+		Subject:   message.Subject,
+		Status:    "queued",
+	}
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	q.record(delivery)
+	select {
+	case q.jobs <- job{message: message, delivery: delivery}:
+		return nil
+	default:
+		delivery.Status = "failed"
+		delivery.LastError = ErrQueueFull.Error()
+		q.record(delivery)
+		return ErrQueueFull
+	}
+}
+
+// Close stops accepting messages and waits for the queued ones to be sent.
+func (q *Queue) Close() {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.jobs)
+	}
+	q.mu.Unlock()
+	q.wg.Wait()
+}
+
+func (q *Queue) work() {
+	defer q.wg.Done()
+	for job := range q.jobs {
+		q.deliver(job)
+	}
+}
+
+// deliver tries to send the message until it succeeds or runs out of attempts.
+func (q *Queue) deliver(job job) {
+	delivery := job.delivery
+	backoff := q.config.Backoff
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		err := q.mailer.Send(ctx, job.message)
+		cancel()
+
+		delivery.Attempts++
+		if err == nil {
+			now := time.Now()
+			delivery.Status = "sent"
+			delivery.LastError = ""
+			delivery.SentAt = &now
+			q.record(delivery)
+			return
+		}
+
+		delivery.LastError = err.Error()
+		if delivery.Attempts >= q.config.Attempts {
+			log.Errorf("Email %s to %s failed after %d attempts: %v", delivery.Template, logging.Email(delivery.Recipient), delivery.Attempts, err)
+			delivery.Status = "failed"
+			q.record(delivery)
+			return
+		}
+
+		log.Warnf("Email %s to %s failed, retrying in %s: %v", delivery.Template, logging.Email(delivery.Recipient), backoff, err)
+		q.record(delivery)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (q *Queue) record(delivery *types.EmailDelivery) {
+	if q.recorder == nil {
+		return
+	}
+	if err := q.recorder.SaveEmailDelivery(delivery); err != nil {
+		log.Error("Error recording email delivery: ", err)
+	}
+}
@@ -0,0 +1,106 @@
+package mail
+
+import (
+	"FinMa/internal/i18n"
+	"FinMa/types"
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+//go:embed templates
+var templates embed.FS
+
+// ErrUnknownTemplate is returned when rendering a template that does not exist.
+var ErrUnknownTemplate = errors.New("unknown email template")
+
+// HasTemplate reports whether the template exists, in English at least.
+func HasTemplate(name string) bool {
+	_, err := fs.Stat(templates, "templates/"+name+".txt")
+	return err == nil
+}
+
+// templateFiles returns the layout and the template of the format in the
+// locale: the ones of templates/<locale>/ when translated, the English ones
+// otherwise.
+func templateFiles(name, locale, format string) []string {
+	files := make([]string, 0, 2)
+	for _, file := range []string{"layout", name} {
+		path := "templates/" + locale + "/" + file + "." + format
+		if _, err := fs.Stat(templates, path); err != nil {
+			if locale != i18n.Default {
+				log.Warn("Missing email template translation, falling back to English", "locale", locale, "template", file+"."+format)
+			}
+			path = "templates/" + file + "." + format
+		}
+		files = append(files, path)
+	}
+	return files
+}
+
+// funcs are the functions of the templates formatting in the locale:
+// amount, of a number or of a types.Money, number, percent and date, whose
+// style is short, medium, long or day.
+func funcs(l i18n.Localizer) map[string]any {
+	return map[string]any{
+		"amount": func(value any) (string, error) {
+			switch value := value.(type) {
+			case float64:
+				return l.Amount(value), nil
+			case types.Money:
+				return l.Amount(value.Float64()), nil
+			}
+			return "", fmt.Errorf("cannot format %T as an amount", value)
+		},
+		"number":  l.Number,
+		"percent": l.Percent,
+		"date": func(style string, t time.Time) string {
+			return l.Date(t, i18n.DateStyle(style))
+		},
+	}
+}
+
+// Render builds a message from the plaintext and HTML versions of the
+// template, in the language of the Localizer. Each version defines
+// "subject" and "content" and is wrapped in the layout of its format; the
+// subject is taken from the plaintext one.
+func Render(name string, l i18n.Localizer, to string, data any) (Message, error) {
+	if !HasTemplate(name) {
+		return Message{}, ErrUnknownTemplate
+	}
+	message := Message{To: to, Template: name}
+
+	text, err := texttemplate.New(name).Funcs(funcs(l)).ParseFS(templates, templateFiles(name, l.Locale, "txt")...)
+	if err != nil {
+		return message, err
+	}
+	var subject, body bytes.Buffer
+	if err := text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return message, err
+	}
+	if err := text.ExecuteTemplate(&body, "layout", data); err != nil {
+		return message, err
+	}
+	message.Subject = strings.TrimSpace(subject.String())
+	message.Text = strings.TrimSpace(body.String()) + "\n"
+
+	html, err := htmltemplate.New(name).Funcs(funcs(l)).ParseFS(templates, templateFiles(name, l.Locale, "html")...)
+	if err != nil {
+		return message, err
+	}
+	body.Reset()
+	if err := html.ExecuteTemplate(&body, "layout", data); err != nil {
+		return message, err
+	}
+	message.HTML = body.String()
+
+	return message, nil
+}
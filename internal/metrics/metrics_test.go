@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistryWriteTo(t *testing.T) {
+	registry := NewRegistry()
+	requests := registry.NewCounter("finma_requests_total", "Requests handled.", "method", "route")
+	latency := registry.NewHistogram("finma_request_duration_seconds", "Request latency.", []float64{0.1, 1}, "route")
+	registry.NewGaugeFunc("finma_connections", "Open connections.", func() float64 { return 3 })
+
+	requests.Inc("GET", "/accounts/:id")
+	requests.Inc("GET", "/accounts/:id")
+	requests.Inc("POST", `/say "hi"`)
+	latency.Observe(0.05, "/")
+	latency.Observe(0.5, "/")
+	latency.Observe(5, "/")
+
+	var out strings.Builder
+	if _, err := registry.WriteTo(&out); err != nil {
+		t.Fatalf("error writing the metrics. Err: %v", err)
+	}
+
+	expected := `# HELP finma_requests_total Requests handled.
+# TYPE finma_requests_total counter
+finma_requests_total{method="GET",route="/accounts/:id"} 2
+finma_requests_total{method="POST",route="/say \"hi\""} 1
+# HELP finma_request_duration_seconds Request latency.
+# TYPE finma_request_duration_seconds histogram
+finma_request_duration_seconds_bucket{route="/",le="0.1"} 1
+finma_request_duration_seconds_bucket{route="/",le="1"} 2
+finma_request_duration_seconds_bucket{route="/",le="+Inf"} 3
+finma_request_duration_seconds_sum{route="/"} 5.55
+finma_request_duration_seconds_count{route="/"} 3
+# HELP finma_connections Open connections.
+# TYPE finma_connections gauge
+finma_connections 3
+`
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestCounterValue(t *testing.T) {
+	counter := NewRegistry().NewCounter("finma_emails_total", "Emails.", "status")
+	counter.Inc("sent")
+	counter.Add(2, "sent")
+
+	if got := counter.Value("sent"); got != 3 {
+		t.Errorf("expected 3; got %v", got)
+	}
+	if got := counter.Value("failed"); got != 0 {
+		t.Errorf("expected 0; got %v", got)
+	}
+}
+
+func TestRegisterTwicePanics(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewCounter("finma_total", "Total.")
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected registering the same name twice to panic")
+		}
+	}()
+	registry.NewCounter("finma_total", "Total.")
+}
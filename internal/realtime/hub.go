@@ -0,0 +1,179 @@
+package realtime
+
+import (
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+)
+
+// subscriptionBuffer is the number of events queued for a slow connection
+// before new ones are dropped.
+const subscriptionBuffer = 32
+
+// Event is pushed to the connections of a user as it happens.
+type Event struct {
+	// ID increases with every event published, across restarts of the hub
+	ID   uint64 `json:"id"`
+	Type string `json:"type"` // "notification" or "transaction.created"
+	Data any    `json:"data"`
+}
+
+// Subscription receives the events published to a user. Each connection
+// has its own, so every device of the user receives every event.
+type Subscription struct {
+	UserID uuid.UUID
+	Events chan Event
+}
+
+// userEvents holds the subscriptions of a user and their latest events.
+type userEvents struct {
+	subscriptions map[*Subscription]struct{}
+	recent        *ring
+}
+
+// Hub is an in-process publish/subscribe hub keyed by user ID. It keeps the
+// latest events of each user so that a reconnecting client can catch up.
+type Hub struct {
+	mu        sync.Mutex
+	retention int
+	sequence  uint64
+	users     map[uuid.UUID]*userEvents
+}
+
+// NewHub returns a hub keeping the last retention events of each user.
+func NewHub(retention int) *Hub {
+	return &Hub{
+		retention: retention,
+		// Seeded with the clock so that IDs keep increasing after a restart
+		sequence: uint64(time.Now().UnixMicro()),
+		users:    make(map[uuid.UUID]*userEvents),
+	}
+}
+
+// user returns the events of the user, creating them. h.mu must be held.
+func (h *Hub) user(userID uuid.UUID) *userEvents {
+	user, ok := h.users[userID]
+	if !ok {
+		user = &userEvents{
+			subscriptions: make(map[*Subscription]struct{}),
+			recent:        newRing(h.retention),
+		}
+		h.users[userID] = user
+	}
+	return user
+}
+
+// Subscribe registers a new subscription to the events of the user. It must
+// be released with Unsubscribe.
+func (h *Hub) Subscribe(userID uuid.UUID) *Subscription {
+	subscription, _, _ := h.Resume(userID, 0)
+	return subscription
+}
+
+// Resume registers a new subscription like Subscribe and returns the
+// retained events published after lastID, oldest first. complete is false
+// when events after lastID were already dropped from the retention buffer.
+// A lastID of zero resumes nothing.
+func (h *Hub) Resume(userID uuid.UUID, lastID uint64) (*Subscription, []Event, bool) {
+	subscription := &Subscription{UserID: userID, Events: make(chan Event, subscriptionBuffer)}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	user := h.user(userID)
+	user.subscriptions[subscription] = struct{}{}
+	if lastID == 0 {
+		return subscription, nil, true
+	}
+	missed, complete := user.recent.since(lastID)
+	return subscription, missed, complete
+}
+
+// Unsubscribe removes the subscription and closes its channel. It is safe to
+// call more than once.
+func (h *Hub) Unsubscribe(subscription *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	user, ok := h.users[subscription.UserID]
+	if !ok {
+		return
+	}
+	if _, ok := user.subscriptions[subscription]; !ok {
+		return
+	}
+	delete(user.subscriptions, subscription)
+	close(subscription.Events)
+}
+
+// Publish numbers the event, retains it and sends it to every subscription
+// of the user without blocking: a subscription whose buffer is full misses
+// the event.
+func (h *Hub) Publish(userID uuid.UUID, event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.sequence++
+	event.ID = h.sequence
+	user := h.user(userID)
+	user.recent.push(event)
+
+	for subscription := range user.subscriptions {
+		select {
+		case subscription.Events <- event:
+		default:
+			log.Warnf("Dropped %s event for user %s, the connection is too slow", event.Type, userID)
+		}
+	}
+}
+
+// Subscribers returns the number of subscriptions of the user.
+func (h *Hub) Subscribers(userID uuid.UUID) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if user, ok := h.users[userID]; ok {
+		return len(user.subscriptions)
+	}
+	return 0
+}
+
+// ring is a fixed size buffer of the latest events, oldest first.
+type ring struct {
+	events  []Event
+	start   int
+	count   int
+	evicted uint64 // ID of the latest event overwritten
+}
+
+func newRing(size int) *ring {
+	return &ring{events: make([]Event, size)}
+}
+
+func (r *ring) push(event Event) {
+	if len(r.events) == 0 {
+		r.evicted = event.ID
+		return
+	}
+	if r.count < len(r.events) {
+		r.events[(r.start+r.count)%len(r.events)] = event
+		r.count++
+		return
+	}
+	r.evicted = r.events[r.start].ID
+	r.events[r.start] = event
+	r.start = (r.start + 1) % len(r.events)
+}
+
+// since returns the events with an ID greater than lastID, and false when
+// some of them were overwritten already.
+func (r *ring) since(lastID uint64) ([]Event, bool) {
+	events := make([]Event, 0)
+	for i := 0; i < r.count; i++ {
+		event := r.events[(r.start+i)%len(r.events)]
+		if event.ID > lastID {
+			events = append(events, event)
+		}
+	}
+	return events, lastID >= r.evicted
+}
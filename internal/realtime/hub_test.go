@@ -0,0 +1,61 @@
+package realtime
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestHubResume(t *testing.T) {
+	hub := NewHub(3)
+	userID := uuid.New()
+
+	for i := 0; i < 5; i++ {
+		hub.Publish(userID, Event{Type: "notification"})
+	}
+	hub.Publish(uuid.New(), Event{Type: "notification"})
+
+	subscription, missed, complete := hub.Resume(userID, 0)
+	if len(missed) != 0 || !complete {
+		t.Errorf("expected nothing to resume without a last ID; got %d events", len(missed))
+	}
+	hub.Unsubscribe(subscription)
+
+	subscription, retained, complete := hub.Resume(userID, 1)
+	if len(retained) != 3 || complete {
+		t.Fatalf("expected the 3 retained events and a gap; got %d events, complete %v", len(retained), complete)
+	}
+	hub.Unsubscribe(subscription)
+
+	subscription, missed, complete = hub.Resume(userID, retained[0].ID)
+	defer hub.Unsubscribe(subscription)
+	if len(missed) != 2 || !complete {
+		t.Fatalf("expected 2 missed events without a gap; got %d, complete %v", len(missed), complete)
+	}
+	if missed[0].ID != retained[1].ID || missed[1].ID != retained[2].ID {
+		t.Errorf("expected events %d and %d; got %d and %d", retained[1].ID, retained[2].ID, missed[0].ID, missed[1].ID)
+	}
+}
+
+func TestHubPublishesToEverySubscription(t *testing.T) {
+	hub := NewHub(0)
+	userID := uuid.New()
+	phone := hub.Subscribe(userID)
+	laptop := hub.Subscribe(userID)
+
+	hub.Publish(userID, Event{Type: "transaction.created"})
+	for _, subscription := range []*Subscription{phone, laptop} {
+		if event := <-subscription.Events; event.Type != "transaction.created" || event.ID == 0 {
+			t.Errorf("expected a numbered transaction.created event; got %+v", event)
+		}
+	}
+
+	hub.Unsubscribe(phone)
+	hub.Unsubscribe(phone)
+	if hub.Subscribers(userID) != 1 {
+		t.Errorf("expected 1 subscriber; got %d", hub.Subscribers(userID))
+	}
+	if _, ok := <-phone.Events; ok {
+		t.Error("expected the channel of a released subscription to be closed")
+	}
+}
@@ -0,0 +1,222 @@
+package realtime
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// websocketGUID is appended to the key of the client to compute the accept
+// header of the handshake (RFC 6455, section 1.3).
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// maxControlPayload is the largest payload of a control frame.
+const maxControlPayload = 125
+
+// maxMessageSize is the largest frame accepted from a client. Clients are
+// not expected to send more than control frames and small messages.
+const maxMessageSize = 4096
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// ErrMessageTooLarge is returned when a client frame exceeds maxMessageSize.
+var ErrMessageTooLarge = errors.New("websocket message too large")
+
+// IsUpgrade reports whether the request asks for a websocket connection.
+func IsUpgrade(c *fiber.Ctx) bool {
+	return strings.EqualFold(c.Get(fiber.HeaderUpgrade), "websocket") &&
+		strings.Contains(strings.ToLower(c.Get(fiber.HeaderConnection)), "upgrade")
+}
+
+// Upgrade answers the websocket handshake and hands the connection to
+// handler once the response is sent. The connection is closed when handler
+// returns. It returns false, without writing a response, when the request
+// is not a valid version 13 handshake.
+func Upgrade(c *fiber.Ctx, handler func(conn *Conn)) bool {
+	key := c.Get("Sec-WebSocket-Key")
+	if !IsUpgrade(c) || key == "" || c.Get("Sec-WebSocket-Version") != "13" {
+		return false
+	}
+
+	accept := sha1.Sum([]byte(key + websocketGUID))
+	c.Set(fiber.HeaderUpgrade, "websocket")
+	c.Set(fiber.HeaderConnection, "Upgrade")
+	c.Set("Sec-WebSocket-Accept", base64.StdEncoding.EncodeToString(accept[:]))
+	c.Status(fiber.StatusSwitchingProtocols)
+
+	c.Context().Hijack(func(netConn net.Conn) {
+		conn := &Conn{conn: netConn, reader: bufio.NewReader(netConn)}
+		defer conn.Close()
+		handler(conn)
+	})
+	return true
+}
+
+// Conn is a server side websocket connection. Writes are safe to call from
+// several goroutines, reads must happen in a single one.
+type Conn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+
+	writeMu sync.Mutex
+	closed  bool
+}
+
+// WriteText sends a text message, failing if it is not written before deadline.
+func (c *Conn) WriteText(data []byte, deadline time.Time) error {
+	return c.writeFrame(opText, data, deadline)
+}
+
+// WritePing sends a ping the client must answer with a pong.
+func (c *Conn) WritePing(deadline time.Time) error {
+	return c.writeFrame(opPing, nil, deadline)
+}
+
+// Close sends a normal closure frame, if not sent yet, and closes the
+// connection.
+func (c *Conn) Close() error {
+	c.writeMu.Lock()
+	if !c.closed {
+		c.closed = true
+		// Status 1000, normal closure
+		_ = c.writeFrameLocked(opClose, []byte{0x03, 0xE8}, time.Now().Add(time.Second))
+	}
+	c.writeMu.Unlock()
+	return c.conn.Close()
+}
+
+func (c *Conn) writeFrame(opcode byte, payload []byte, deadline time.Time) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+	return c.writeFrameLocked(opcode, payload, deadline)
+}
+
+// writeFrameLocked writes a single final frame. Server frames are not masked.
+func (c *Conn) writeFrameLocked(opcode byte, payload []byte, deadline time.Time) error {
+	header := []byte{0x80 | opcode}
+	switch length := len(payload); {
+	case length <= 125:
+		header = append(header, byte(length))
+	case length <= 0xFFFF:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(length))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(length))
+	}
+
+	if err := c.conn.SetWriteDeadline(deadline); err != nil {
+		return err
+	}
+	if _, err := c.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// SetReadDeadline sets the time after which ReadMessage fails if nothing,
+// not even a pong, was received.
+func (c *Conn) SetReadDeadline(deadline time.Time) error {
+	return c.conn.SetReadDeadline(deadline)
+}
+
+// ReadMessage returns the next data message of the client. Pings are
+// answered, pongs call onPong, and a close frame from the client ends the
+// connection with io.EOF.
+func (c *Conn) ReadMessage(onPong func()) ([]byte, error) {
+	var message []byte
+	for {
+		final, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case opPing:
+			if err := c.writeFrame(opPong, payload, time.Now().Add(time.Second)); err != nil {
+				return nil, err
+			}
+		case opPong:
+			if onPong != nil {
+				onPong()
+			}
+		case opClose:
+			return nil, io.EOF
+		case opText, opBinary, opContinuation:
+			message = append(message, payload...)
+			if len(message) > maxMessageSize {
+				return nil, ErrMessageTooLarge
+			}
+			if final {
+				return message, nil
+			}
+		default:
+			return nil, errors.New("unknown websocket opcode")
+		}
+	}
+}
+
+// readFrame reads and unmasks one frame of the client.
+func (c *Conn) readFrame() (bool, byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.reader, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	final := head[0]&0x80 != 0
+	opcode := head[0] & 0x0F
+	masked := head[1]&0x80 != 0
+	if !masked {
+		return false, 0, nil, errors.New("websocket client frames must be masked")
+	}
+
+	length := uint64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	if length > maxMessageSize || (opcode >= opClose && length > maxControlPayload) {
+		return false, 0, nil, ErrMessageTooLarge
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return final, opcode, payload, nil
+}
@@ -0,0 +1,71 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEvery(t *testing.T) {
+	at := time.Date(2024, 6, 30, 12, 20, 5, 0, time.UTC)
+
+	tests := []struct {
+		interval time.Duration
+		after    time.Time
+		expected time.Time
+	}{
+		{time.Hour, at, time.Date(2024, 6, 30, 13, 0, 0, 0, time.UTC)},
+		{15 * time.Minute, at, time.Date(2024, 6, 30, 12, 30, 0, 0, time.UTC)},
+		{time.Hour, time.Date(2024, 6, 30, 13, 0, 0, 0, time.UTC), time.Date(2024, 6, 30, 14, 0, 0, 0, time.UTC)},
+		{6 * time.Hour, at, time.Date(2024, 6, 30, 18, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		if got := Every(tt.interval).Next(tt.after); !got.Equal(tt.expected) {
+			t.Errorf("every %v after %v: expected %v; got %v", tt.interval, tt.after, tt.expected, got)
+		}
+	}
+}
+
+func TestCron(t *testing.T) {
+	// A Sunday
+	at := time.Date(2024, 6, 30, 12, 20, 5, 0, time.UTC)
+
+	tests := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2024, 6, 30, 12, 21, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 6, 30, 12, 30, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2024, 7, 1, 3, 0, 0, 0, time.UTC)},
+		{"30 8 * * 1-5", time.Date(2024, 7, 1, 8, 30, 0, 0, time.UTC)},
+		{"0 9 * * 0", time.Date(2024, 7, 7, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 7", time.Date(2024, 7, 7, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 12,18 * * *", time.Date(2024, 6, 30, 18, 0, 0, 0, time.UTC)},
+		// Either day matches when both are restricted: the 15th or a Monday
+		{"0 0 15 * 1", time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		schedule, err := Cron(tt.expr)
+		if err != nil {
+			t.Fatalf("error parsing %q. Err: %v", tt.expr, err)
+		}
+		if got := schedule.Next(at); !got.Equal(tt.expected) {
+			t.Errorf("%q: expected %v; got %v", tt.expr, tt.expected, got)
+		}
+	}
+
+	if got := MustCron("0 0 30 2 *").Next(at); !got.IsZero() {
+		t.Errorf("expected no run for a date that never comes; got %v", got)
+	}
+}
+
+func TestCronInvalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "a * * * *", "5-1 * * * *"} {
+		if _, err := Cron(expr); err == nil {
+			t.Errorf("expected %q to be refused", expr)
+		}
+	}
+}
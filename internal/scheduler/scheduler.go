@@ -0,0 +1,265 @@
+// Package scheduler runs the periodic jobs of the server in process: each
+// job runs on its schedule, never overlapping itself, and on one instance
+// of the deployment at a time when the scheduler has a Locker.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// ErrRunning is returned when a job is started while it is running, on this
+// instance or on another one holding its lock.
+var ErrRunning = errors.New("the job is already running")
+
+// Func is the work of a job. ctx is canceled when the shutdown grace period
+// is over; now is the time of the tick, or of the request of an on-demand run.
+type Func func(ctx context.Context, now time.Time) error
+
+// Job is a named function run on a schedule.
+type Job struct {
+	Name     string
+	Schedule Schedule
+	Run      Func
+}
+
+// Locker takes the Postgres advisory locks: database.Service implements it.
+type Locker interface {
+	TryAdvisoryLock(ctx context.Context, key int64) (unlock func(), locked bool, err error)
+}
+
+// Status is what a job did on this instance.
+type Status struct {
+	Name           string     `json:"name"`
+	Schedule       string     `json:"schedule,omitempty"` // Empty when only run on demand
+	Running        bool       `json:"running"`
+	Runs           int64      `json:"runs"`
+	Skipped        int64      `json:"skipped"` // Ticks skipped because a run was in progress, here or on another instance, or the scheduler was paused
+	LastRunAt      *time.Time `json:"last_run_at"`
+	LastDurationMs int64      `json:"last_duration_ms"`
+	LastError      string     `json:"last_error,omitempty"`
+	NextRunAt      *time.Time `json:"next_run_at,omitempty"`
+}
+
+// Scheduler runs the jobs until it is stopped. Its zero value is ready to
+// use, without a lock: set Locker, OnRun and Paused before scheduling the
+// jobs.
+type Scheduler struct {
+	// Locker guards each run with an advisory lock derived from the name of
+	// the job, when set
+	Locker Locker
+	// OnRun is called after each run with its duration and its error, for
+	// the metrics
+	OnRun func(name string, elapsed time.Duration, err error)
+	// Paused skips the scheduled runs while it returns true, the runs on
+	// demand still happen
+	Paused func() bool
+
+	mu      sync.Mutex
+	jobs    map[string]*Status
+	stop    chan struct{}
+	stopped bool
+	wg      sync.WaitGroup
+	// ctx is passed to the runs, canceled once the shutdown gives up waiting
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// init prepares the zero value. The lock must be held.
+func (s *Scheduler) init() {
+	if s.jobs == nil {
+		s.jobs = map[string]*Status{}
+		s.stop = make(chan struct{})
+		s.ctx, s.cancel = context.WithCancel(context.Background())
+	}
+}
+
+// job returns the status of the job, created on its first use. The lock
+// must be held.
+func (s *Scheduler) job(name string) *Status {
+	s.init()
+	status, ok := s.jobs[name]
+	if !ok {
+		status = &Status{Name: name}
+		s.jobs[name] = status
+	}
+	return status
+}
+
+// Schedule runs the job on its schedule until the scheduler is stopped.
+// Scheduling a job once stopped does nothing.
+func (s *Scheduler) Schedule(job Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return
+	}
+	status := s.job(job.Name)
+	status.Schedule = job.Schedule.String()
+	stop := s.stop
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			next := job.Schedule.Next(time.Now())
+			if next.IsZero() {
+				log.Warn("Job never runs again", "job", job.Name, "schedule", job.Schedule)
+				return
+			}
+			s.mu.Lock()
+			status.NextRunAt = &next
+			s.mu.Unlock()
+
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-stop:
+				timer.Stop()
+				return
+			case <-timer.C:
+				if s.Paused != nil && s.Paused() {
+					s.mu.Lock()
+					status.Skipped++
+					s.mu.Unlock()
+					continue
+				}
+				s.Do(job.Name, next, job.Run)
+			}
+		}
+	}()
+}
+
+// Do runs fn as the job of the name, which needs not be scheduled: the runs
+// of a job never overlap, whether scheduled or requested by an admin. A
+// panic of fn is recovered and returned as its error.
+func (s *Scheduler) Do(name string, now time.Time, fn Func) error {
+	s.mu.Lock()
+	status := s.job(name)
+	if status.Running {
+		status.Skipped++
+		s.mu.Unlock()
+		return ErrRunning
+	}
+	status.Running = true
+	ctx := s.ctx
+	s.mu.Unlock()
+
+	unlock, err := s.lock(ctx, name)
+	if err != nil || unlock == nil {
+		s.mu.Lock()
+		status.Running = false
+		if err == nil {
+			status.Skipped++
+			err = ErrRunning
+		}
+		s.mu.Unlock()
+		return err
+	}
+	defer unlock()
+
+	start := time.Now()
+	err = call(ctx, now, fn)
+	elapsed := time.Since(start)
+	if err != nil {
+		log.Error("Job failed", "job", name, "err", err)
+	}
+
+	s.mu.Lock()
+	status.Running = false
+	status.Runs++
+	status.LastRunAt = &now
+	status.LastDurationMs = elapsed.Milliseconds()
+	status.LastError = ""
+	if err != nil {
+		status.LastError = err.Error()
+	}
+	onRun := s.OnRun
+	s.mu.Unlock()
+
+	if onRun != nil {
+		onRun(name, elapsed, err)
+	}
+	return err
+}
+
+// lock takes the advisory lock of the job, and returns its unlock function,
+// nil when another instance holds it.
+func (s *Scheduler) lock(ctx context.Context, name string) (func(), error) {
+	if s.Locker == nil {
+		return func() {}, nil
+	}
+	unlock, locked, err := s.Locker.TryAdvisoryLock(ctx, LockKey(name))
+	if err != nil {
+		return nil, fmt.Errorf("error locking the job %s: %w", name, err)
+	}
+	if !locked {
+		return nil, nil
+	}
+	return unlock, nil
+}
+
+// call runs fn, turning its panic into an error so that a failing job does
+// not take the server down.
+func call(ctx context.Context, now time.Time, fn Func) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+			log.Error("Job panicked", "panic", r, "stack", string(debug.Stack()))
+		}
+	}()
+	return fn(ctx, now)
+}
+
+// LockKey returns the advisory lock key of the job of the name.
+func LockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("finma.job." + name))
+	return int64(h.Sum64())
+}
+
+// Status returns the status of the jobs, by name.
+func (s *Scheduler) Status() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]Status, 0, len(s.jobs))
+	for _, status := range s.jobs {
+		jobs = append(jobs, *status)
+	}
+	sort.Slice(jobs, func(a, b int) bool { return jobs[a].Name < jobs[b].Name })
+	return jobs
+}
+
+// Stop prevents the jobs from running again and waits for the running ones
+// to finish. Once ctx is done their context is canceled and Stop returns.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	s.init()
+	if !s.stopped {
+		s.stopped = true
+		close(s.stop)
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.cancel()
+		return ctx.Err()
+	}
+}
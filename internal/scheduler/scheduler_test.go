@@ -0,0 +1,174 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeLocker holds the locks taken, as another instance would.
+type fakeLocker struct {
+	mu   sync.Mutex
+	held map[int64]bool
+}
+
+func (l *fakeLocker) TryAdvisoryLock(_ context.Context, key int64) (func(), bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.held[key] {
+		return nil, false, nil
+	}
+	l.held[key] = true
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.held, key)
+	}, true, nil
+}
+
+func TestRunsDoNotOverlap(t *testing.T) {
+	var jobs Scheduler
+	started, release := make(chan struct{}), make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- jobs.Do("sync", time.Now(), func(context.Context, time.Time) error {
+			close(started)
+			<-release
+			return errors.New("provider down")
+		})
+	}()
+
+	<-started
+	if err := jobs.Do("sync", time.Now(), func(context.Context, time.Time) error { return nil }); !errors.Is(err, ErrRunning) {
+		t.Errorf("expected ErrRunning; got %v", err)
+	}
+	close(release)
+	<-done
+
+	status := jobs.Status()
+	if len(status) != 1 || status[0].Runs != 1 || status[0].Skipped != 1 || status[0].LastError != "provider down" || status[0].Running {
+		t.Errorf("expected one failed run and one skipped recorded; got %+v", status)
+	}
+}
+
+func TestRunLockedByAnotherInstance(t *testing.T) {
+	locker := &fakeLocker{held: map[int64]bool{LockKey("sync"): true}}
+	jobs := Scheduler{Locker: locker}
+
+	ran := false
+	err := jobs.Do("sync", time.Now(), func(context.Context, time.Time) error {
+		ran = true
+		return nil
+	})
+	if !errors.Is(err, ErrRunning) || ran {
+		t.Errorf("expected the run to be skipped; got %v, ran %v", err, ran)
+	}
+
+	delete(locker.held, LockKey("sync"))
+	if err := jobs.Do("sync", time.Now(), func(context.Context, time.Time) error { return nil }); err != nil {
+		t.Fatalf("expected the run once the lock is free; got %v", err)
+	}
+	if len(locker.held) != 0 {
+		t.Errorf("expected the lock to be released after the run")
+	}
+}
+
+func TestPanicIsRecovered(t *testing.T) {
+	var recorded error
+	jobs := Scheduler{OnRun: func(name string, elapsed time.Duration, err error) { recorded = err }}
+
+	err := jobs.Do("digest", time.Now(), func(context.Context, time.Time) error {
+		panic("nil map")
+	})
+	if err == nil || err.Error() != "panic: nil map" || recorded != err {
+		t.Errorf("expected the panic as the error of the run; got %v, recorded %v", err, recorded)
+	}
+	if status := jobs.Status(); status[0].Running || status[0].LastError != "panic: nil map" {
+		t.Errorf("expected the run to be finished; got %+v", status[0])
+	}
+}
+
+func TestStop(t *testing.T) {
+	var jobs Scheduler
+	var runs atomic.Int64
+	jobs.Schedule(Job{Name: "count", Schedule: Every(10 * time.Millisecond), Run: func(context.Context, time.Time) error {
+		runs.Add(1)
+		return nil
+	}})
+
+	for deadline := time.Now().Add(time.Second); runs.Load() == 0; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the job to run")
+		}
+	}
+	if err := jobs.Stop(context.Background()); err != nil {
+		t.Fatalf("error stopping. Err: %v", err)
+	}
+	stoppedAt := runs.Load()
+	time.Sleep(30 * time.Millisecond)
+	if runs.Load() != stoppedAt {
+		t.Errorf("expected no run after the stop")
+	}
+	if status := jobs.Status(); status[0].Schedule != "every 10ms" || status[0].NextRunAt == nil {
+		t.Errorf("expected the schedule in the status; got %+v", status[0])
+	}
+}
+
+func TestPaused(t *testing.T) {
+	var paused atomic.Bool
+	paused.Store(true)
+	jobs := Scheduler{Paused: paused.Load}
+	defer jobs.Stop(context.Background())
+
+	var runs atomic.Int64
+	jobs.Schedule(Job{Name: "count", Schedule: Every(5 * time.Millisecond), Run: func(context.Context, time.Time) error {
+		runs.Add(1)
+		return nil
+	}})
+
+	for deadline := time.Now().Add(time.Second); jobs.Status()[0].Skipped < 2; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the ticks to be skipped")
+		}
+	}
+	if runs.Load() != 0 {
+		t.Errorf("expected no run while paused; got %d", runs.Load())
+	}
+	if err := jobs.Do("count", time.Now(), func(context.Context, time.Time) error { return nil }); err != nil {
+		t.Errorf("expected the runs on demand while paused; got %v", err)
+	}
+
+	paused.Store(false)
+	for deadline := time.Now().Add(time.Second); runs.Load() == 0; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the job to run once resumed")
+		}
+	}
+}
+
+func TestStopCancelsAfterGracePeriod(t *testing.T) {
+	var jobs Scheduler
+	started := make(chan struct{})
+	canceled := make(chan struct{})
+	jobs.Schedule(Job{Name: "slow", Schedule: Every(time.Millisecond), Run: func(ctx context.Context, _ time.Time) error {
+		close(started)
+		<-ctx.Done()
+		close(canceled)
+		return ctx.Err()
+	}})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := jobs.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the grace period to expire; got %v", err)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("expected the context of the run to be canceled")
+	}
+}
@@ -0,0 +1,96 @@
+// Package seed generates the demo dataset: a checking and a savings
+// account, the transactions of the last months and a monthly food budget.
+// It loads the user of the seed command and the users of the demo mode.
+package seed
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/google/uuid"
+
+	"FinMa/constants"
+	"FinMa/internal/database"
+	"FinMa/types"
+)
+
+// Months is the number of months of transactions of the dataset.
+const Months = 3
+
+// Create loads the dataset for the existing user, with the transactions of
+// the months before now.
+func Create(db database.Service, userID uuid.UUID, now time.Time) error {
+	random := rand.New(rand.NewSource(now.UnixNano()))
+	opening := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, -Months, 0)
+	checking := &types.BankAccount{
+		ID:             uuid.New(),
+		BankName:       "Demo Bank",
+		AccountType:    "checking",
+		AccountNumber:  fmt.Sprintf("DEMO%012d", random.Int63n(1e12)),
+		Balance:        types.MoneyFromFloat(1500, ""),
+		InitialBalance: types.MoneyFromFloat(1500, ""),
+		OpeningDate:    &opening,
+		UserID:         userID,
+	}
+	savings := &types.BankAccount{
+		ID:                   uuid.New(),
+		BankName:             "Demo Bank",
+		AccountType:          "savings",
+		AccountNumber:        fmt.Sprintf("DEMO%012d", random.Int63n(1e12)),
+		Balance:              types.MoneyFromFloat(5000, ""),
+		InitialBalance:       types.MoneyFromFloat(5000, ""),
+		OpeningDate:          &opening,
+		CompoundingFrequency: "monthly",
+		UserID:               userID,
+	}
+	for _, account := range []*types.BankAccount{checking, savings} {
+		if err := db.CreateBankAccount(account); err != nil {
+			return err
+		}
+	}
+
+	budget := &types.Budget{
+		ID:         uuid.New(),
+		Name:       "Groceries",
+		Amount:     types.MoneyFromFloat(400, ""),
+		StartDate:  opening,
+		PeriodType: "monthly",
+		UserID:     userID,
+		Categories: []types.BudgetCategory{{Category: "food"}},
+	}
+	if err := db.CreateBudget(budget); err != nil {
+		return err
+	}
+
+	categories := constants.GetTransactionCategories()
+	for month := opening; month.Before(now); month = month.AddDate(0, 1, 0) {
+		transactions := []types.Transaction{
+			{Category: "others", Amount: types.MoneyFromFloat(2400, ""), Date: month, Type: "income", IsRecurring: true, Description: "Salary"},
+			{Category: "bills", Amount: types.MoneyFromFloat(850, ""), Date: month.AddDate(0, 0, 2), Type: "expense", IsRecurring: true, Description: "Rent"},
+		}
+		for i := 0; i < 12; i++ {
+			transactions = append(transactions, types.Transaction{
+				Category:    categories[random.Intn(len(categories))],
+				Amount:      types.MoneyFromFloat(float64(5+random.Intn(9500))/100, ""),
+				Date:        month.AddDate(0, 0, random.Intn(28)),
+				Type:        "expense",
+				Description: "Demo expense",
+			})
+		}
+
+		for _, transaction := range transactions {
+			if transaction.Date.After(now) {
+				continue
+			}
+			transaction.ID = uuid.New()
+			transaction.UserID = userID
+			transaction.BankAccountID = checking.ID
+			transaction.CreatedAt = now
+			if err := db.CreateTransaction(&transaction); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"FinMa/constants"
+	"FinMa/types"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// accountRoleRank returns the privilege level of a role, higher is more privileged.
+func accountRoleRank(role string) int {
+	roles := constants.GetAccountMemberRoles()
+	for i, r := range roles {
+		if r == role {
+			return len(roles) - i
+		}
+	}
+	return 0
+}
+
+// hasAccountRole reports whether role grants at least the required role.
+func hasAccountRole(role string, required string) bool {
+	return role != "" && accountRoleRank(role) >= accountRoleRank(required)
+}
+
+// accountRole returns the role of the user on the account: "owner" for the
+// user who created it, the member role for shared accounts, "editor" for
+// accounts shared in the household of the user, "" otherwise.
+func (s *FiberServer) accountRole(user types.User, account types.BankAccount) string {
+	if account.UserID == user.ID {
+		return "owner"
+	}
+
+	role := s.db.GetAccountMembership(account.ID, user.ID).Role
+	if account.HouseholdID != nil && accountRoleRank(role) < accountRoleRank("editor") &&
+		s.db.IsHouseholdMember(*account.HouseholdID, user.ID) {
+		return "editor"
+	}
+	return role
+}
+
+// InviteAccountMember invites a user by email to a shared account.
+// The invite stays pending until the invited user accepts it, which lets
+// users who do not have an account yet accept it after signing up.
+// Only owners can manage members.
+func (s *FiberServer) InviteAccountMember(c *fiber.Ctx) error {
+	type InviteAccountMemberRequest struct {
+		Email string `json:"email" validate:"required,email"`
+		Role  string `json:"role" validate:"required"`
+	}
+
+	var body InviteAccountMemberRequest
+	if err := c.BodyParser(&body); err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+
+	if err := validate.Struct(body); err != nil {
+		return err
+	}
+
+	if accountRoleRank(body.Role) == 0 {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid member role")
+	}
+
+	user := c.Locals("user").(types.User)
+	account, ok := s.findUserBankAccount(user, c.Params("id"), "owner")
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Bank account not found")
+	}
+
+	email := strings.ToLower(strings.TrimSpace(body.Email))
+	if email == strings.ToLower(user.Email) {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "You cannot invite yourself")
+	}
+
+	for _, member := range s.db.GetAccountMembers(account.ID) {
+		if member.Email == email {
+			return NewAPIError(fiber.StatusConflict, CodeAlreadyInvited, "This user is already invited")
+		}
+	}
+
+	member := &types.AccountMember{
+		ID:            uuid.New(),
+		Email:         email,
+		Role:          body.Role,
+		Status:        "pending",
+		BankAccountID: account.ID,
+		InvitedByID:   user.ID,
+	}
+
+	if err := s.db.CreateAccountMember(member); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not invite member")
+	}
+
+	s.audit(user.ID, "account.member_invited", "bank_account", account.ID,
+		fmt.Sprintf("%s invited as %s", email, body.Role))
+
+	return c.Status(fiber.StatusCreated).JSON(member)
+}
+
+// GetAccountMembers lists the members and pending invites of an account.
+func (s *FiberServer) GetAccountMembers(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	account, ok := s.findUserBankAccount(user, c.Params("id"), "viewer")
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Bank account not found")
+	}
+
+	return c.JSON(s.db.GetAccountMembers(account.ID))
+}
+
+// RemoveAccountMember removes a member or a pending invite from an account.
+// The transactions created by the member are kept.
+func (s *FiberServer) RemoveAccountMember(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	account, ok := s.findUserBankAccount(user, c.Params("id"), "owner")
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Bank account not found")
+	}
+
+	member := s.db.GetAccountMemberByID(c.Params("memberId"))
+	if member.ID == uuid.Nil || member.BankAccountID != account.ID {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Member not found")
+	}
+
+	if err := s.db.DeleteAccountMember(&member); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not remove member")
+	}
+
+	s.audit(user.ID, "account.member_removed", "bank_account", account.ID,
+		fmt.Sprintf("%s removed", member.Email))
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// GetAccountInvites lists the pending invites sent to the authenticated user.
+func (s *FiberServer) GetAccountInvites(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	return c.JSON(s.db.GetPendingInvites(strings.ToLower(user.Email)))
+}
+
+// AcceptAccountInvite accepts a pending invite sent to the authenticated user.
+func (s *FiberServer) AcceptAccountInvite(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	member := s.db.GetAccountMemberByID(c.Params("id"))
+
+	if member.ID == uuid.Nil || member.Status != "pending" || member.Email != strings.ToLower(user.Email) {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Invite not found")
+	}
+
+	if err := s.db.AcceptAccountInvite(&member, &user); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not accept invite")
+	}
+
+	return c.JSON(member)
+}
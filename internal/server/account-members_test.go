@@ -0,0 +1,110 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/types"
+)
+
+// accountMembersDB stores the invites of the shared accounts, an accepted
+// invite makes its user a member.
+type accountMembersDB struct {
+	*bankAccountsDB
+	invites map[uuid.UUID]types.AccountMember
+}
+
+func (db *accountMembersDB) GetAccountMembers(accountID uuid.UUID) []types.AccountMember {
+	members := []types.AccountMember{}
+	for _, member := range db.invites {
+		if member.BankAccountID == accountID {
+			members = append(members, member)
+		}
+	}
+	return members
+}
+
+func (db *accountMembersDB) CreateAccountMember(member *types.AccountMember) error {
+	db.invites[member.ID] = *member
+	return nil
+}
+
+func (db *accountMembersDB) GetAccountMemberByID(id string) types.AccountMember {
+	return db.invites[uuid.MustParse(id)]
+}
+
+func (db *accountMembersDB) AcceptAccountInvite(member *types.AccountMember, user *types.User) error {
+	member.Status, member.UserID = "active", &user.ID
+	db.invites[member.ID] = *member
+	db.members[user.ID] = *member
+	return nil
+}
+
+func (db *accountMembersDB) DeleteAccountMember(member *types.AccountMember) error {
+	delete(db.invites, member.ID)
+	delete(db.members, *member.UserID)
+	return nil
+}
+
+func TestAccountMembers(t *testing.T) {
+	s, admin, _, owner := newAdminTestServer(t)
+	partner := types.User{ID: uuid.New(), Email: "grace@example.com", Role: "user"}
+	admin.users[partner.ID] = partner
+	account := types.BankAccount{ID: uuid.New(), BankName: "Joint", AccountType: "checking", UserID: owner.ID}
+	db := &accountMembersDB{bankAccountsDB: &bankAccountsDB{adminDB: admin, accounts: map[uuid.UUID]types.BankAccount{account.ID: account},
+		members: map[uuid.UUID]types.AccountMember{}}, invites: map[uuid.UUID]types.AccountMember{}}
+	s.db = db
+	path := "/api/v1/accounts/" + account.ID.String() + "/members"
+
+	resp := adminRequest(t, s, owner, "POST", path, `{"email":"Grace@example.com","role":"viewer"}`)
+	var invite types.AccountMember
+	json.NewDecoder(resp.Body).Decode(&invite)
+	if resp.StatusCode != fiber.StatusCreated || invite.Status != "pending" || invite.Email != partner.Email {
+		t.Fatalf("expected a pending invite; got %d %+v", resp.StatusCode, invite)
+	}
+	if resp := adminRequest(t, s, owner, "POST", path, `{"email":"grace@example.com","role":"editor"}`); resp.StatusCode != fiber.StatusConflict {
+		t.Errorf("expected a second invite refused; got %d", resp.StatusCode)
+	}
+
+	// The account stays hidden until the invite is accepted
+	if resp := adminRequest(t, s, partner, "GET", path, ""); resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("expected the account hidden before the invite is accepted; got %d", resp.StatusCode)
+	}
+	if resp := adminRequest(t, s, partner, "POST", "/api/v1/account-invites/"+invite.ID.String()+"/accept", ""); resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("expected the invite accepted; got %d", resp.StatusCode)
+	}
+
+	// A viewer reads the account but cannot write to it nor manage its members
+	var members []types.AccountMember
+	resp = adminRequest(t, s, partner, "GET", path, "")
+	json.NewDecoder(resp.Body).Decode(&members)
+	if resp.StatusCode != fiber.StatusOK || len(members) != 1 || members[0].Status != "active" {
+		t.Errorf("expected the viewer to list the members; got %d %+v", resp.StatusCode, members)
+	}
+	resp = adminRequest(t, s, partner, "POST", "/api/v1/transactions", `{"bank_account_id":"`+account.ID.String()+
+		`","amount":-12,"type":"expense","category":"food","description":"Lunch","date":"2024-03-10T12:00:00Z"}`)
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("expected a viewer refused to add transactions; got %d", resp.StatusCode)
+	}
+
+	// Only owners manage the members, editors included
+	member := db.members[partner.ID]
+	member.Role = "editor"
+	db.members[partner.ID] = member
+	if resp := adminRequest(t, s, partner, "POST", path, `{"email":"linus@example.com","role":"viewer"}`); resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("expected an editor refused to invite; got %d", resp.StatusCode)
+	}
+	if resp := adminRequest(t, s, partner, "DELETE", path+"/"+invite.ID.String(), ""); resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("expected an editor refused to remove members; got %d", resp.StatusCode)
+	}
+
+	if resp := adminRequest(t, s, owner, "DELETE", path+"/"+invite.ID.String(), ""); resp.StatusCode != fiber.StatusNoContent {
+		t.Fatalf("expected the member removed by the owner; got %d", resp.StatusCode)
+	}
+	if resp := adminRequest(t, s, partner, "GET", path, ""); resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("expected the account hidden from a removed member; got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/types"
+)
+
+// activityType is a type of item of the activity feed, read from an action
+// of the audit log or from an event of the notifications.
+type activityType struct {
+	name   string
+	action string
+	event  string
+}
+
+// activityTypes are the types of item of the activity feed. The
+// notifications are the ones recorded in the app, the events the user
+// turned off there are missing.
+var activityTypes = []activityType{
+	{name: "transaction_created", action: "transaction.created"},
+	{name: "transaction_updated", action: "transaction.updated"},
+	{name: "account_created", action: "account.created"},
+	{name: "import_completed", action: "import.completed"},
+	{name: "budget_exceeded", event: "budget_exceeded"},
+	{name: "new_device_login", event: "new_device_login"},
+}
+
+// activityTypeNames returns the names of the types of item of the feed.
+func activityTypeNames() []string {
+	names := make([]string, 0, len(activityTypes))
+	for _, activity := range activityTypes {
+		names = append(names, activity.name)
+	}
+	return names
+}
+
+// encodeActivityCursor returns the cursor of the page following the item.
+func encodeActivityCursor(item types.ActivityItem) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(item.OccurredAt.Format(time.RFC3339Nano) + "_" + item.ID.String()))
+}
+
+// decodeActivityCursor returns the date and the ID of the item a cursor
+// follows.
+func decodeActivityCursor(cursor string) (time.Time, uuid.UUID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, uuid.Nil, err
+	}
+	date, id, ok := strings.Cut(string(raw), "_")
+	if !ok {
+		return time.Time{}, uuid.Nil, errors.New("invalid cursor")
+	}
+	before, err := time.Parse(time.RFC3339Nano, date)
+	if err != nil {
+		return time.Time{}, uuid.Nil, err
+	}
+	beforeID, err := uuid.Parse(id)
+	if err != nil {
+		return time.Time{}, uuid.Nil, err
+	}
+	return before, beforeID, nil
+}
+
+// activityLink returns the path of the screen of the app showing the item:
+// the transaction, or the transactions of a batch, the account, the budget
+// or the security settings.
+func activityLink(item types.ActivityItem) string {
+	switch item.Type {
+	case "transaction_created", "transaction_updated":
+		if item.EntityID != nil {
+			return "/transactions/" + item.EntityID.String()
+		}
+		return "/transactions?batch_id=" + item.ID.String()
+	case "import_completed":
+		return "/transactions?batch_id=" + item.EntityID.String()
+	case "account_created":
+		return "/accounts/" + item.EntityID.String()
+	case "budget_exceeded":
+		var payload struct {
+			BudgetID uuid.UUID `json:"budget_id"`
+		}
+		if json.Unmarshal(item.Payload, &payload) == nil && payload.BudgetID != uuid.Nil {
+			return "/budgets/" + payload.BudgetID.String()
+		}
+		return "/budgets"
+	case "new_device_login":
+		return "/settings/security"
+	}
+	return ""
+}
+
+// GetActivity returns the recent events of the user, the latest first, read
+// from the audit log and the notifications: the transactions created and
+// edited, the accounts created, the imports completed, the budgets exceeded
+// and the logins from a new device. The transactions created or edited by
+// one operation, like an import or a bulk update, are one item with their
+// count, linking to the list of them.
+// - type: comma separated types of item listed, all by default
+// - cursor: next_cursor of the previous page
+// - limit: defaults to 50 and is capped at 100
+func (s *FiberServer) GetActivity(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+
+	filter := types.ActivityFilter{Limit: c.QueryInt("limit", 50)}
+	if filter.Limit <= 0 || filter.Limit > 100 {
+		filter.Limit = 50
+	}
+
+	var invalid []FieldError
+	names := activityTypeNames()
+	if value := c.Query("type"); value != "" {
+		names = nil
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if !slices.Contains(activityTypeNames(), name) {
+				invalid = append(invalid, FieldError{Field: "type", Message: "Must be one of " + strings.Join(activityTypeNames(), ", "), Value: name})
+			}
+			names = append(names, name)
+		}
+	}
+	if cursor := c.Query("cursor"); cursor != "" {
+		before, beforeID, err := decodeActivityCursor(cursor)
+		if err != nil {
+			invalid = append(invalid, FieldError{Field: "cursor", Message: "Invalid cursor", Value: cursor})
+		}
+		filter.Before, filter.BeforeID = &before, beforeID
+	}
+	if len(invalid) > 0 {
+		return NewAPIError(fiber.StatusUnprocessableEntity, CodeValidationFailed, "Invalid activity filter").WithDetails(invalid...)
+	}
+
+	byAction, byEvent := map[string]string{}, map[string]string{}
+	for _, activity := range activityTypes {
+		if !slices.Contains(names, activity.name) {
+			continue
+		}
+		if activity.action != "" {
+			filter.Actions = append(filter.Actions, activity.action)
+			byAction[activity.action] = activity.name
+		} else {
+			filter.Events = append(filter.Events, activity.event)
+			byEvent[activity.event] = activity.name
+		}
+	}
+
+	// One more item than the page tells whether another page follows
+	page := filter
+	page.Limit++
+	db := s.dbFor(c)
+	var items []types.ActivityItem
+	for _, item := range db.GetAuditActivity(user.ID, page) {
+		item.Type = byAction[item.Type]
+		items = append(items, item)
+	}
+	for _, item := range db.GetNotificationActivity(user.ID, page) {
+		item.Type = byEvent[item.Type]
+		items = append(items, item)
+	}
+	slices.SortFunc(items, func(a, b types.ActivityItem) int {
+		if !a.OccurredAt.Equal(b.OccurredAt) {
+			return b.OccurredAt.Compare(a.OccurredAt)
+		}
+		return strings.Compare(b.ID.String(), a.ID.String())
+	})
+
+	response := types.ActivityPage{Items: []types.ActivityItem{}}
+	if len(items) > filter.Limit {
+		items = items[:filter.Limit]
+		response.NextCursor = encodeActivityCursor(items[len(items)-1])
+	}
+	for _, item := range items {
+		item.Link = activityLink(item)
+		response.Items = append(response.Items, item)
+	}
+	return c.JSON(response)
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/internal/database"
+	"FinMa/types"
+)
+
+// activityDB pages the items of each source like the queries do, the
+// latest first from the cursor excluded.
+type activityDB struct {
+	*adminDB
+	audit         []types.ActivityItem
+	notifications []types.ActivityItem
+	filters       []types.ActivityFilter
+}
+
+func (db *activityDB) WithContext(context.Context) database.Service {
+	return db
+}
+
+func pageActivity(items []types.ActivityItem, kinds []string, filter types.ActivityFilter) []types.ActivityItem {
+	var page []types.ActivityItem
+	for _, item := range items {
+		if !slices.Contains(kinds, item.Type) {
+			continue
+		}
+		if filter.Before != nil && (item.OccurredAt.After(*filter.Before) ||
+			item.OccurredAt.Equal(*filter.Before) && item.ID.String() >= filter.BeforeID.String()) {
+			continue
+		}
+		if len(page) < filter.Limit {
+			page = append(page, item)
+		}
+	}
+	return page
+}
+
+func (db *activityDB) GetAuditActivity(userID uuid.UUID, filter types.ActivityFilter) []types.ActivityItem {
+	db.filters = append(db.filters, filter)
+	return pageActivity(db.audit, filter.Actions, filter)
+}
+
+func (db *activityDB) GetNotificationActivity(userID uuid.UUID, filter types.ActivityFilter) []types.ActivityItem {
+	return pageActivity(db.notifications, filter.Events, filter)
+}
+
+func getActivity(t *testing.T, s *FiberServer, user types.User, query string) types.ActivityPage {
+	t.Helper()
+	resp := adminRequest(t, s, user, "GET", "/api/v1/activity"+query, "")
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("expected status 200 for %q; got %d", query, resp.StatusCode)
+	}
+	var page types.ActivityPage
+	json.NewDecoder(resp.Body).Decode(&page)
+	return page
+}
+
+func TestGetActivity(t *testing.T) {
+	s, admin, _, user := newAdminTestServer(t)
+	db := &activityDB{adminDB: admin}
+	s.db = db
+
+	now := time.Now().UTC().Truncate(time.Second)
+	transactionID, accountID, budgetID := uuid.New(), uuid.New(), uuid.New()
+	batchID := uuid.New()
+	db.audit = []types.ActivityItem{
+		{ID: uuid.New(), Type: "import.completed", OccurredAt: now.Add(-time.Minute), Count: 1, EntityType: "import", EntityID: &batchID},
+		{ID: batchID, Type: "transaction.created", OccurredAt: now.Add(-time.Minute), Count: 500, EntityType: "transaction", BatchID: &batchID},
+		{ID: uuid.New(), Type: "account.created", OccurredAt: now.Add(-2 * time.Minute), Count: 1, EntityType: "bank_account", EntityID: &accountID},
+		{ID: uuid.New(), Type: "transaction.updated", OccurredAt: now.Add(-4 * time.Minute), Count: 1, EntityType: "transaction", EntityID: &transactionID},
+	}
+	slices.SortFunc(db.audit, func(a, b types.ActivityItem) int {
+		if !a.OccurredAt.Equal(b.OccurredAt) {
+			return b.OccurredAt.Compare(a.OccurredAt)
+		}
+		return strings.Compare(b.ID.String(), a.ID.String())
+	})
+	db.notifications = []types.ActivityItem{
+		{ID: uuid.New(), Type: "budget_exceeded", OccurredAt: now, Count: 1, Payload: json.RawMessage(`{"budget_id":"` + budgetID.String() + `"}`)},
+		{ID: uuid.New(), Type: "new_device_login", OccurredAt: now.Add(-3 * time.Minute), Count: 1},
+	}
+
+	// The pages of both sources are merged, the latest first
+	var items []types.ActivityItem
+	cursor := ""
+	for pages := 0; pages < 10; pages++ {
+		page := getActivity(t, s, user, "?limit=2&cursor="+cursor)
+		items = append(items, page.Items...)
+		if cursor = page.NextCursor; cursor == "" {
+			break
+		}
+	}
+	var kinds []string
+	for _, item := range items {
+		kinds = append(kinds, item.Type)
+	}
+	// The import and its transactions happened together, in the order of their IDs
+	slices.Sort(kinds[1:3])
+	want := []string{"budget_exceeded", "import_completed", "transaction_created", "account_created", "new_device_login", "transaction_updated"}
+	if !slices.Equal(kinds, want) {
+		t.Fatalf("expected the feed %v; got %v", want, kinds)
+	}
+
+	links := map[string]string{}
+	for _, item := range items {
+		links[item.Type] = item.Link
+	}
+	for kind, link := range map[string]string{
+		"budget_exceeded":     "/budgets/" + budgetID.String(),
+		"import_completed":    "/transactions?batch_id=" + batchID.String(),
+		"transaction_created": "/transactions?batch_id=" + batchID.String(),
+		"account_created":     "/accounts/" + accountID.String(),
+		"new_device_login":    "/settings/security",
+		"transaction_updated": "/transactions/" + transactionID.String(),
+	} {
+		if links[kind] != link {
+			t.Errorf("expected the %s linked to %s; got %s", kind, link, links[kind])
+		}
+	}
+
+	page := getActivity(t, s, user, "?type=transaction_created,new_device_login")
+	if len(page.Items) != 2 || page.Items[0].Count != 500 || page.Items[1].Type != "new_device_login" || page.NextCursor != "" {
+		t.Errorf("expected the import batch and the login; got %+v", page)
+	}
+	if filter := db.filters[len(db.filters)-1]; !slices.Equal(filter.Actions, []string{"transaction.created"}) {
+		t.Errorf("expected only the created transactions read from the audit log; got %+v", filter)
+	}
+
+	for _, query := range []string{"?type=password_reset", "?cursor=nope"} {
+		if resp := adminRequest(t, s, user, "GET", "/api/v1/activity"+query, ""); resp.StatusCode != fiber.StatusUnprocessableEntity {
+			t.Errorf("expected status 422 for %s; got %d", query, resp.StatusCode)
+		}
+	}
+}
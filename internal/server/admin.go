@@ -0,0 +1,149 @@
+package server
+
+import (
+	"FinMa/internal/scheduler"
+	"FinMa/types"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+	"github.com/google/uuid"
+)
+
+const (
+	// adminRateLimit is the number of admin requests an admin may send per
+	// minute.
+	adminRateLimit = 60
+	// sessionLifetime is the lifetime of a refresh token: a device seen
+	// within it may still hold a valid session.
+	sessionLifetime = 7 * 24 * time.Hour
+)
+
+// adminRateLimiter limits the admin requests of each admin, the maintenance
+// tasks are expensive.
+func adminRateLimiter() fiber.Handler {
+	return limiter.New(limiter.Config{
+		Max:        adminRateLimit,
+		Expiration: time.Minute,
+		KeyGenerator: func(c *fiber.Ctx) string {
+			return c.Locals("user").(types.User).ID.String()
+		},
+		LimitReached: func(c *fiber.Ctx) error {
+			return NewAPIError(fiber.StatusTooManyRequests, CodeRateLimited, "Too many admin requests, retry in a minute")
+		},
+	})
+}
+
+// auditAdminActions records every admin request in the audit log with the
+// acting admin, once answered. The entity is the user or the account of the
+// route, if any.
+func (s *FiberServer) auditAdminActions(c *fiber.Ctx) error {
+	if err := c.Next(); err != nil {
+		// Let the error handler write the response before auditing its status
+		if handlerErr := c.App().ErrorHandler(c, err); handlerErr != nil {
+			c.Status(fiber.StatusInternalServerError)
+		}
+	}
+
+	admin := c.Locals("user").(types.User)
+	entityID, _ := uuid.Parse(c.Params("id"))
+	s.audit(admin.ID, "admin_request", "admin", entityID, fmt.Sprintf("%s %s: %d", c.Method(), c.Route().Path, c.Response().StatusCode()))
+	return nil
+}
+
+// GetAdminStats returns the counts of the instance. Admin only.
+func (s *FiberServer) GetAdminStats(c *fiber.Ctx) error {
+	stats, err := s.db.GetAdminStats(time.Now().Add(-sessionLifetime))
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not compute the stats")
+	}
+
+	return c.JSON(stats)
+}
+
+// GetAdminUsers lists the users, without their password hash. Admin only.
+func (s *FiberServer) GetAdminUsers(c *fiber.Ctx) error {
+	users := s.db.GetUsers()
+	for i := range users {
+		users[i].Password = ""
+	}
+
+	return c.JSON(users)
+}
+
+// CreatePasswordResetLink returns a password reset link of the user for the
+// support to hand over, no email is sent. Admin only.
+func (s *FiberServer) CreatePasswordResetLink(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "User not found")
+	}
+	user := s.db.GetUserByID(id)
+	if user.ID == uuid.Nil {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "User not found")
+	}
+
+	token, expiresAt, err := s.tokens.GeneratePasswordResetToken(user.ID, user.Password)
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not generate the reset link")
+	}
+
+	return c.JSON(fiber.Map{
+		"user_id":    user.ID,
+		"reset_url":  s.config.Server.AppURL + "/reset-password?token=" + url.QueryEscape(token),
+		"expires_at": expiresAt,
+	})
+}
+
+// GetJobs returns the status of the background jobs on this instance and
+// the latest scheduled report deliveries. Admin only.
+func (s *FiberServer) GetJobs(c *fiber.Ctx) error {
+	deliveries := s.db.GetReportDeliveries(nil, reportDeliveriesListed)
+	if deliveries == nil {
+		deliveries = []types.ReportDelivery{}
+	}
+	return c.JSON(fiber.Map{"jobs": s.jobs.Status(), "report_deliveries": deliveries})
+}
+
+// RunBalanceRecompute repairs the balances of every account now, and
+// returns the drifts it found. Admin only.
+func (s *FiberServer) RunBalanceRecompute(c *fiber.Ctx) error {
+	var drifts []types.BalanceDrift
+	err := s.jobs.Do(balanceCheckJob, time.Now(), func(context.Context, time.Time) error {
+		var err error
+		drifts, err = s.checkBalances()
+		return err
+	})
+	if errors.Is(err, scheduler.ErrRunning) {
+		return NewAPIError(fiber.StatusConflict, CodeConflict, "The balances are being recomputed")
+	}
+	if err != nil {
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not recompute the balances")
+	}
+
+	if drifts == nil {
+		drifts = []types.BalanceDrift{}
+	}
+	return c.JSON(fiber.Map{"repaired": drifts})
+}
+
+// RunCleanupNow deletes the notifications past their retention now.
+// Admin only.
+func (s *FiberServer) RunCleanupNow(c *fiber.Ctx) error {
+	err := s.jobs.Do(notificationCleanupJob, time.Now(), s.cleanupNotifications)
+	if errors.Is(err, scheduler.ErrRunning) {
+		return NewAPIError(fiber.StatusConflict, CodeConflict, "The cleanup is running")
+	}
+	if err != nil {
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not clean up the notifications")
+	}
+
+	return s.GetNotificationCleanup(c)
+}
@@ -0,0 +1,242 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/internal/config"
+	"FinMa/internal/database"
+	"FinMa/internal/scheduler"
+	"FinMa/types"
+	"FinMa/utils"
+)
+
+// adminDB knows an admin and a user, and records the audit log.
+type adminDB struct {
+	database.Service
+	mu     sync.Mutex
+	users  map[uuid.UUID]types.User
+	audits []types.AuditLog
+}
+
+func (db *adminDB) GetUserByEmail(email string) types.User {
+	for _, user := range db.users {
+		if user.Email == email {
+			return user
+		}
+	}
+	return types.User{}
+}
+
+func (db *adminDB) GetUserByID(id uuid.UUID) types.User {
+	return db.users[id]
+}
+
+func (db *adminDB) UpdateUserPassword(userID uuid.UUID, hashedPassword string) error {
+	user := db.users[userID]
+	user.Password = hashedPassword
+	db.users[userID] = user
+	return nil
+}
+
+func (db *adminDB) CreateAuditLog(entry *types.AuditLog) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.audits = append(db.audits, *entry)
+	return nil
+}
+
+func (db *adminDB) CreateAuditLogs(entries []types.AuditLog) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.audits = append(db.audits, entries...)
+	return nil
+}
+
+func (db *adminDB) GetReportDeliveries(scheduleID *uuid.UUID, limit int) []types.ReportDelivery {
+	return []types.ReportDelivery{{ID: uuid.New(), Report: "merchants", Status: "queued", EmailStatus: "sent"}}
+}
+
+func (db *adminDB) GetAdminStats(time.Time) (types.AdminStats, error) {
+	return types.AdminStats{Users: int64(len(db.users)), Transactions: 12}, nil
+}
+
+func (db *adminDB) GetBalanceDrifts() ([]types.BalanceDrift, error) {
+	return []types.BalanceDrift{{AccountID: uuid.New(), Stored: money(100), Computed: money(90)}}, nil
+}
+
+func (db *adminDB) RecomputeBalance(uuid.UUID) (types.BalanceDrift, error) {
+	return types.BalanceDrift{}, nil
+}
+
+func (db *adminDB) TryAdvisoryLock(context.Context, int64) (func(), bool, error) {
+	return func() {}, true, nil
+}
+
+func (db *adminDB) WithContext(context.Context) database.Service {
+	return db
+}
+
+func (db *adminDB) DeleteExpiredNotifications(types.NotificationRetention, int) (int64, error) {
+	return 3, nil
+}
+
+// newAdminTestServer returns a server with the routes of the API, and the
+// access tokens of its admin and of its user.
+func newAdminTestServer(t *testing.T) (s *FiberServer, db *adminDB, admin, user types.User) {
+	hashed, err := utils.HashPassword("Correct-horse-1")
+	if err != nil {
+		t.Fatalf("error hashing the password. Err: %v", err)
+	}
+	admin = types.User{ID: uuid.New(), Email: "admin@example.com", Password: hashed, Role: "admin"}
+	user = types.User{ID: uuid.New(), Email: "ada@example.com", Password: hashed, Role: "user"}
+	db = &adminDB{users: map[uuid.UUID]types.User{admin.ID: admin, user.ID: user}}
+
+	cfg := config.Default()
+	cfg.Auth.AccessTokenSecret, cfg.Auth.RefreshTokenSecret = "access", "refresh"
+	s = &FiberServer{
+		App:    fiber.New(fiber.Config{ErrorHandler: errorHandler}),
+		config: cfg,
+		db:     db,
+		tokens: utils.Tokens{AccessSecret: "access", RefreshSecret: "refresh"},
+	}
+	s.handlers = NewHandler(db, cfg.Auth, nil, notificationDispatcher{s})
+	s.RegisterFiberRoutes()
+	return s, db, admin, user
+}
+
+func adminRequest(t *testing.T, s *FiberServer, as types.User, method, path, body string) *http.Response {
+	token, err := s.tokens.GenerateAccessToken(utils.Payload{UserID: as.ID, Email: as.Email})
+	if err != nil {
+		t.Fatalf("error generating the token. Err: %v", err)
+	}
+	req, err := http.NewRequest(method, path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("error creating request. Err: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.Test(req)
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+	return resp
+}
+
+func TestAdminRoutesRequireAdmin(t *testing.T) {
+	s, db, _, user := newAdminTestServer(t)
+
+	routes := []struct{ method, path string }{
+		{"GET", "/api/v1/admin/stats"},
+		{"GET", "/api/v1/admin/users"},
+		{"POST", "/api/v1/admin/users/" + user.ID.String() + "/reset-password"},
+		{"GET", "/api/v1/admin/jobs"},
+		{"POST", "/api/v1/admin/maintenance/recompute-balances"},
+		{"POST", "/api/v1/admin/maintenance/cleanup-now"},
+	}
+	for _, route := range routes {
+		if resp := adminRequest(t, s, user, route.method, route.path, ""); resp.StatusCode != fiber.StatusForbidden {
+			t.Errorf("expected status 403 for %s %s; got %d", route.method, route.path, resp.StatusCode)
+		}
+	}
+	if len(db.audits) != 0 {
+		t.Errorf("expected the refused requests not to be audited; got %d entries", len(db.audits))
+	}
+}
+
+func TestAdminMaintenance(t *testing.T) {
+	s, db, admin, _ := newAdminTestServer(t)
+
+	resp := adminRequest(t, s, admin, "GET", "/api/v1/admin/stats", "")
+	var stats types.AdminStats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil || stats.Users != 2 {
+		t.Errorf("expected the stats; got %+v, %v", stats, err)
+	}
+
+	resp = adminRequest(t, s, admin, "POST", "/api/v1/admin/maintenance/recompute-balances", "")
+	var recomputed struct {
+		Repaired []types.BalanceDrift `json:"repaired"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&recomputed); err != nil || len(recomputed.Repaired) != 1 {
+		t.Errorf("expected the repaired drift; got %+v, %v", recomputed, err)
+	}
+	adminRequest(t, s, admin, "POST", "/api/v1/admin/maintenance/cleanup-now", "")
+
+	resp = adminRequest(t, s, admin, "GET", "/api/v1/admin/jobs", "")
+	var jobs struct {
+		Jobs             []scheduler.Status     `json:"jobs"`
+		ReportDeliveries []types.ReportDelivery `json:"report_deliveries"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&jobs); err != nil || len(jobs.Jobs) != 2 {
+		t.Fatalf("expected the 2 jobs run; got %+v, %v", jobs, err)
+	}
+	if len(jobs.ReportDeliveries) != 1 || jobs.ReportDeliveries[0].EmailStatus != "sent" {
+		t.Errorf("expected the report deliveries; got %+v", jobs.ReportDeliveries)
+	}
+	if jobs.Jobs[0].Name != balanceCheckJob || jobs.Jobs[0].Runs != 1 || jobs.Jobs[0].LastRunAt == nil {
+		t.Errorf("expected the balance check run once; got %+v", jobs.Jobs[0])
+	}
+
+	if len(db.audits) != 4 {
+		t.Fatalf("expected the 4 admin requests audited; got %d", len(db.audits))
+	}
+	for _, entry := range db.audits {
+		if entry.UserID != admin.ID {
+			t.Errorf("expected the audit entry of the admin; got %+v", entry)
+		}
+	}
+	if db.audits[1].Details != "POST /api/v1/admin/maintenance/recompute-balances: 200" {
+		t.Errorf("unexpected audit details %q", db.audits[1].Details)
+	}
+}
+
+func TestAdminPasswordResetLink(t *testing.T) {
+	s, db, admin, user := newAdminTestServer(t)
+
+	resp := adminRequest(t, s, admin, "POST", "/api/v1/admin/users/"+user.ID.String()+"/reset-password", "")
+	var link struct {
+		ResetURL string `json:"reset_url"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&link); err != nil || resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("expected a reset link; got %d, %v", resp.StatusCode, err)
+	}
+	if len(db.audits) != 1 || db.audits[0].EntityID != user.ID {
+		t.Errorf("expected the link to be audited against the user; got %+v", db.audits)
+	}
+	parsed, err := url.Parse(link.ResetURL)
+	if err != nil || !strings.HasPrefix(link.ResetURL, s.config.Server.AppURL) {
+		t.Fatalf("expected a link to the app; got %q", link.ResetURL)
+	}
+	token := parsed.Query().Get("token")
+
+	reset := func() int {
+		req, err := http.NewRequest("POST", "/api/v1/auth/reset-password", strings.NewReader(`{"token":"`+token+`","password":"New-password-2"}`))
+		if err != nil {
+			t.Fatalf("error creating request. Err: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := s.Test(req)
+		if err != nil {
+			t.Fatalf("error making request to server. Err: %v", err)
+		}
+		return resp.StatusCode
+	}
+	if status := reset(); status != fiber.StatusNoContent {
+		t.Fatalf("expected status 204; got %d", status)
+	}
+	if err := utils.ComparePasswords(db.users[user.ID].Password, "New-password-2"); err != nil {
+		t.Errorf("expected the password to be changed")
+	}
+	if status := reset(); status != fiber.StatusUnauthorized {
+		t.Errorf("expected the link to work once; got %d", status)
+	}
+}
@@ -0,0 +1,315 @@
+package server
+
+import (
+	"FinMa/types"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// allocationPreviewCount is the number of past income payments previewed.
+const allocationPreviewCount = 3
+
+// validateAllocationSteps checks that each step sends a positive percentage
+// or fixed amount to exactly one goal or budget, and that the steps cannot
+// ask for more than the smallest income the rule matches.
+func validateAllocationSteps(minAmount types.Money, steps []types.AllocationRuleStep) error {
+	if len(steps) == 0 {
+		return errors.New("at least one step is required")
+	}
+
+	percentage, fixed := 0.0, types.Money{}
+	goals := make(map[uuid.UUID]bool)
+	for _, step := range steps {
+		if (step.GoalID == nil) == (step.BudgetID == nil) {
+			return errors.New("each step must target either a goal or a budget")
+		}
+		if step.GoalID != nil {
+			if goals[*step.GoalID] {
+				return errors.New("a goal can only be targeted once per rule")
+			}
+			goals[*step.GoalID] = true
+		}
+		if step.Value.Sign() <= 0 {
+			return errors.New("step values must be positive")
+		}
+
+		switch step.Kind {
+		case "percentage":
+			percentage += step.Value.Float64()
+		case "fixed":
+			fixed = types.NewMoney(fixed.Minor+step.Value.Unbound().Minor, "")
+		default:
+			return errors.New(`step kind must be "percentage" or "fixed"`)
+		}
+	}
+
+	if percentage > 100 || fixed.Minor > minAmount.Unbound().Mul(1-percentage/100).Minor {
+		return errors.New("steps exceed 100% of the smallest matched income")
+	}
+	return nil
+}
+
+// allocationRuleMatches tells whether the rule distributes the transaction.
+func allocationRuleMatches(rule types.AllocationRule, transaction types.Transaction) bool {
+	return transaction.Type == "income" &&
+		transaction.Amount.Unbound().Minor >= rule.MinAmount.Unbound().Minor &&
+		strings.Contains(strings.ToLower(transaction.Description), strings.ToLower(rule.Merchant))
+}
+
+// planAllocation runs the steps of the rule in order on an income amount.
+// Each step is capped by what the previous ones left, the remainder stays
+// unallocated. The percentages are rounded to the minor unit of currency.
+func planAllocation(rule types.AllocationRule, amount types.Money, currency string) ([]types.AllocationStepResult, types.Money) {
+	amount = amount.Unbound()
+	remaining := amount
+	results := make([]types.AllocationStepResult, 0, len(rule.Steps))
+	for _, step := range rule.Steps {
+		share := step.Value.Unbound()
+		if step.Kind == "percentage" {
+			share = amount.Mul(step.Value.Float64() / 100).Round(currency)
+		}
+		if share.Minor > remaining.Minor {
+			share = remaining
+		}
+		remaining = types.NewMoney(remaining.Minor-share.Minor, "")
+
+		results = append(results, types.AllocationStepResult{
+			Position: step.Position,
+			GoalID:   step.GoalID,
+			BudgetID: step.BudgetID,
+			Amount:   share,
+		})
+	}
+	return results, remaining
+}
+
+// applyAllocationRules is called after a transaction change is committed
+// and distributes new or edited income with the first rule of its owner
+// matching it. A transaction is only ever distributed once.
+func (s *FiberServer) applyAllocationRules(previous, current *types.Transaction) {
+	if current == nil || current.Type != "income" {
+		return
+	}
+
+	var rule *types.AllocationRule
+	rules := s.db.GetAllocationRules(current.UserID)
+	for i := range rules {
+		if allocationRuleMatches(rules[i], *current) {
+			rule = &rules[i]
+			break
+		}
+	}
+	if rule == nil {
+		return
+	}
+
+	created, err := s.db.CreateAllocationRuleRun(&types.AllocationRuleRun{TransactionID: current.ID, RuleID: rule.ID})
+	if err != nil {
+		log.Error("Error recording allocation rule run: ", err)
+		return
+	}
+	if !created {
+		return
+	}
+
+	user := s.db.GetUserByID(current.UserID)
+	results, _ := planAllocation(*rule, current.Amount, s.baseCurrency(user))
+	var allocations []types.Allocation
+	for _, result := range results {
+		if result.Amount.Sign() <= 0 {
+			continue
+		}
+
+		if result.BudgetID != nil {
+			allocations = append(allocations, types.Allocation{
+				ID:            uuid.New(),
+				Amount:        result.Amount,
+				Date:          current.Date,
+				UserID:        current.UserID,
+				BudgetID:      *result.BudgetID,
+				TransactionID: &current.ID,
+			})
+			continue
+		}
+
+		goal := s.db.GetGoalByID(result.GoalID.String())
+		if goal.ID == uuid.Nil || goal.CompletedAt != nil {
+			continue
+		}
+		contribution := &types.GoalContribution{
+			ID:            uuid.New(),
+			Amount:        result.Amount,
+			Date:          current.Date,
+			Note:          rule.Name,
+			GoalID:        goal.ID,
+			TransactionID: &current.ID,
+			RuleID:        &rule.ID,
+		}
+		if err := s.db.CreateGoalContribution(contribution); err != nil {
+			log.Error("Error creating goal contribution: ", err)
+			continue
+		}
+		s.completeGoal(goal)
+	}
+
+	if len(allocations) == 0 {
+		return
+	}
+
+	if user.BudgetingMode != "envelope" {
+		log.Warnf("Allocation rule %s skipped its budget steps, envelope budgeting is not enabled", rule.ID)
+		return
+	}
+	if err := s.db.CreateAllocations(&user, allocations, current); err != nil {
+		log.Error("Error creating allocations: ", err)
+		return
+	}
+
+	now := time.Now()
+	for _, allocation := range allocations {
+		s.amendBudgetPeriods(allocation.BudgetID, allocation.Date, now)
+	}
+}
+
+// CreateAllocationRule creates a rule distributing the income whose
+// description contains merchant and whose amount is at least min_amount.
+// Each step sends a percentage of the income, or a fixed amount, to a goal
+// or a budget of the user; the steps cannot exceed the smallest income
+// matched. Rules are tried oldest first, only the first matching one runs.
+func (s *FiberServer) CreateAllocationRule(c *fiber.Ctx) error {
+	type AllocationRuleStepRequest struct {
+		Kind     string      `json:"kind"`
+		Value    types.Money `json:"value"`
+		GoalID   *uuid.UUID  `json:"goal_id"`
+		BudgetID *uuid.UUID  `json:"budget_id"`
+	}
+	type CreateAllocationRuleRequest struct {
+		Name      string                      `json:"name"`
+		Merchant  string                      `json:"merchant"`
+		MinAmount types.Money                 `json:"min_amount"`
+		Steps     []AllocationRuleStepRequest `json:"steps"`
+	}
+
+	var body CreateAllocationRuleRequest
+	if err := c.BodyParser(&body); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+
+	merchant := strings.TrimSpace(body.Merchant)
+	if merchant == "" {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Merchant is required")
+	}
+	if body.MinAmount.Sign() < 0 {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Minimum amount cannot be negative")
+	}
+
+	user := c.Locals("user").(types.User)
+	rule := &types.AllocationRule{
+		ID:        uuid.New(),
+		Name:      strings.TrimSpace(body.Name),
+		Merchant:  merchant,
+		MinAmount: body.MinAmount,
+		UserID:    user.ID,
+	}
+
+	for i, step := range body.Steps {
+		rule.Steps = append(rule.Steps, types.AllocationRuleStep{
+			ID:       uuid.New(),
+			Position: i,
+			Kind:     step.Kind,
+			Value:    step.Value,
+			GoalID:   step.GoalID,
+			BudgetID: step.BudgetID,
+		})
+	}
+
+	if err := validateAllocationSteps(rule.MinAmount, rule.Steps); err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, err.Error())
+	}
+
+	for _, step := range rule.Steps {
+		if step.GoalID != nil {
+			if _, ok := s.findUserGoal(user, step.GoalID.String()); !ok {
+				return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Goal not found").
+					WithDetails(FieldError{Field: "goal_id", Message: "Goal not found", Value: step.GoalID})
+			}
+		}
+		if step.BudgetID != nil {
+			if _, ok := s.findUserBudget(user, step.BudgetID.String(), true); !ok {
+				return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Budget not found").
+					WithDetails(FieldError{Field: "budget_id", Message: "Budget not found", Value: step.BudgetID})
+			}
+		}
+	}
+
+	if err := s.db.CreateAllocationRule(rule); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not create allocation rule")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(rule)
+}
+
+// GetAllocationRules lists the allocation rules of the user, in the order
+// they are tried.
+func (s *FiberServer) GetAllocationRules(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	return c.JSON(s.db.GetAllocationRules(user.ID))
+}
+
+// findUserAllocationRule returns the rule from the route params if the user owns it.
+func (s *FiberServer) findUserAllocationRule(user types.User, id string) (types.AllocationRule, bool) {
+	rule := s.db.GetAllocationRuleByID(id)
+	if rule.ID == uuid.Nil || rule.UserID != user.ID {
+		return types.AllocationRule{}, false
+	}
+	return rule, true
+}
+
+// DeleteAllocationRule deletes a rule, what it already allocated is kept.
+func (s *FiberServer) DeleteAllocationRule(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	rule, ok := s.findUserAllocationRule(user, c.Params("id"))
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Allocation rule not found")
+	}
+
+	if err := s.db.DeleteAllocationRule(&rule); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not delete allocation rule")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// PreviewAllocationRule shows what the rule would have done to the last
+// three income payments it matches. Nothing is written.
+func (s *FiberServer) PreviewAllocationRule(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	rule, ok := s.findUserAllocationRule(user, c.Params("id"))
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Allocation rule not found")
+	}
+
+	transactions := s.db.GetRuleMatchingIncome(&rule, allocationPreviewCount)
+	previews := make([]types.AllocationPreview, 0, len(transactions))
+	for _, transaction := range transactions {
+		steps, unallocated := planAllocation(rule, transaction.Amount, s.baseCurrency(user))
+		previews = append(previews, types.AllocationPreview{
+			TransactionID: transaction.ID,
+			Date:          transaction.Date,
+			Description:   transaction.Description,
+			Amount:        transaction.Amount,
+			Steps:         steps,
+			Unallocated:   unallocated,
+		})
+	}
+
+	return c.JSON(previews)
+}
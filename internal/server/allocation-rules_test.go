@@ -0,0 +1,93 @@
+package server
+
+import (
+	"FinMa/types"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestValidateAllocationSteps(t *testing.T) {
+	goal, budget := uuid.New(), uuid.New()
+	tests := []struct {
+		name      string
+		minAmount float64
+		steps     []types.AllocationRuleStep
+		expectErr bool
+	}{
+		{"percentage and fixed", 2000, []types.AllocationRuleStep{
+			{Kind: "percentage", Value: money(20), GoalID: &goal},
+			{Kind: "fixed", Value: money(400), BudgetID: &budget},
+		}, false},
+		{"fixed over the remaining share", 500, []types.AllocationRuleStep{
+			{Kind: "percentage", Value: money(20), GoalID: &goal},
+			{Kind: "fixed", Value: money(450), BudgetID: &budget},
+		}, true},
+		{"percentages over 100", 0, []types.AllocationRuleStep{
+			{Kind: "percentage", Value: money(60), GoalID: &goal},
+			{Kind: "percentage", Value: money(50), BudgetID: &budget},
+		}, true},
+		{"no step", 100, nil, true},
+		{"no target", 100, []types.AllocationRuleStep{{Kind: "fixed", Value: money(10)}}, true},
+		{"two targets", 100, []types.AllocationRuleStep{{Kind: "fixed", Value: money(10), GoalID: &goal, BudgetID: &budget}}, true},
+		{"same goal twice", 100, []types.AllocationRuleStep{
+			{Kind: "fixed", Value: money(10), GoalID: &goal},
+			{Kind: "fixed", Value: money(10), GoalID: &goal},
+		}, true},
+		{"unknown kind", 100, []types.AllocationRuleStep{{Kind: "half", Value: money(10), GoalID: &goal}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAllocationSteps(money(tt.minAmount), tt.steps)
+			if tt.expectErr && err == nil {
+				t.Errorf("expected an error")
+			}
+			if !tt.expectErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestAllocationRuleMatches(t *testing.T) {
+	rule := types.AllocationRule{Merchant: "ACME", MinAmount: money(1500)}
+
+	tests := []struct {
+		name        string
+		transaction types.Transaction
+		expected    bool
+	}{
+		{"salary", types.Transaction{Type: "income", Amount: money(2000), Description: "Salary Acme Corp"}, true},
+		{"too small", types.Transaction{Type: "income", Amount: money(100), Description: "Acme refund"}, false},
+		{"expense", types.Transaction{Type: "expense", Amount: money(2000), Description: "Acme"}, false},
+		{"other merchant", types.Transaction{Type: "income", Amount: money(2000), Description: "Bonus"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if matches := allocationRuleMatches(rule, tt.transaction); matches != tt.expected {
+				t.Errorf("expected %v; got %v", tt.expected, matches)
+			}
+		})
+	}
+}
+
+func TestPlanAllocation(t *testing.T) {
+	goal, budget := uuid.New(), uuid.New()
+	rule := types.AllocationRule{Steps: []types.AllocationRuleStep{
+		{Position: 0, Kind: "percentage", Value: money(20), GoalID: &goal},
+		{Position: 1, Kind: "fixed", Value: money(400), BudgetID: &budget},
+	}}
+
+	steps, unallocated := planAllocation(rule, money(2500), "EUR")
+	if steps[0].Amount != money(500) || steps[1].Amount != money(400) || unallocated != money(1600) {
+		t.Errorf("unexpected plan %+v, %v unallocated", steps, unallocated)
+	}
+
+	// A smaller income caps the fixed step to what is left
+	steps, unallocated = planAllocation(rule, money(450), "EUR")
+	if steps[0].Amount != money(90) || steps[1].Amount != money(360) || unallocated != money(0) {
+		t.Errorf("expected the fixed step to be capped; got %+v, %v unallocated", steps, unallocated)
+	}
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"FinMa/internal/database"
+	"FinMa/internal/flags"
+	"FinMa/types"
+	"errors"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// SetBudgetingMode switches the user between classic budgeting, where
+// budgets are measured against their limit, and envelope budgeting, where
+// they are measured against the income allocated to them.
+func (s *FiberServer) SetBudgetingMode(c *fiber.Ctx) error {
+	type SetBudgetingModeRequest struct {
+		Mode string `json:"mode"`
+	}
+
+	var body SetBudgetingModeRequest
+	if err := c.BodyParser(&body); err != nil || (body.Mode != "classic" && body.Mode != "envelope") {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, `Mode must be "classic" or "envelope"`)
+	}
+	if body.Mode == "envelope" && !s.flagEnabled(c, flags.EnvelopeBudgeting) {
+		return featureDisabled(flags.EnvelopeBudgeting)
+	}
+
+	user := c.Locals("user").(types.User)
+	user.BudgetingMode = body.Mode
+	if err := s.db.UpdateBudgetingMode(&user); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not update budgeting mode")
+	}
+
+	return c.JSON(fiber.Map{"mode": user.BudgetingMode})
+}
+
+// CreateAllocations distributes income across budgets in envelope budgeting
+// mode. When transaction_id is set the money comes from that income
+// transaction and the allocations are dated with it, otherwise they are
+// dated with date (RFC3339) or now. The allocations cannot exceed the
+// unassigned income of the user, nor what is left of the transaction.
+func (s *FiberServer) CreateAllocations(c *fiber.Ctx) error {
+	type AllocationItem struct {
+		BudgetID uuid.UUID   `json:"budget_id"`
+		Amount   types.Money `json:"amount"`
+	}
+	type CreateAllocationsRequest struct {
+		TransactionID *uuid.UUID       `json:"transaction_id"`
+		Date          string           `json:"date"`
+		Allocations   []AllocationItem `json:"allocations"`
+	}
+
+	var body CreateAllocationsRequest
+	if err := c.BodyParser(&body); err != nil || len(body.Allocations) == 0 {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+
+	user := c.Locals("user").(types.User)
+	if user.BudgetingMode != "envelope" {
+		return NewAPIError(fiber.StatusConflict, CodeConflict, "Envelope budgeting is not enabled")
+	}
+
+	date := time.Now()
+	if body.Date != "" {
+		parsed, err := time.Parse(time.RFC3339, body.Date)
+		if err != nil {
+			return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid date format")
+		}
+		date = parsed
+	}
+
+	var source *types.Transaction
+	if body.TransactionID != nil {
+		transaction, ok := s.findUserTransaction(user, body.TransactionID.String(), "viewer")
+		if !ok || transaction.UserID != user.ID {
+			return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Transaction not found")
+		}
+		if transaction.Type != "income" {
+			return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Only income can be allocated")
+		}
+		source = &transaction
+		date = transaction.Date
+	}
+
+	allocations := make([]types.Allocation, 0, len(body.Allocations))
+	for _, item := range body.Allocations {
+		if item.Amount.Sign() <= 0 {
+			return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Allocation amounts must be positive")
+		}
+		if _, ok := s.findUserBudget(user, item.BudgetID.String(), true); !ok {
+			return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Budget not found").
+				WithDetails(FieldError{Field: "budget_id", Message: "Budget not found", Value: item.BudgetID})
+		}
+
+		allocations = append(allocations, types.Allocation{
+			ID:            uuid.New(),
+			Amount:        item.Amount,
+			Date:          date,
+			UserID:        user.ID,
+			BudgetID:      item.BudgetID,
+			TransactionID: body.TransactionID,
+		})
+	}
+
+	if err := s.db.CreateAllocations(&user, allocations, source); err != nil {
+		if errors.Is(err, database.ErrAllocationExceedsPool) {
+			return NewAPIError(fiber.StatusUnprocessableEntity, CodeUnprocessable, "Allocations exceed the unassigned income")
+		}
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not create allocations")
+	}
+
+	// Income dated in a closed period changes what was allocated to it
+	now := time.Now()
+	for _, allocation := range allocations {
+		s.amendBudgetPeriods(allocation.BudgetID, allocation.Date, now)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(allocations)
+}
+
+// GetUnassignedIncome reports the income of the user not given a job yet.
+func (s *FiberServer) GetUnassignedIncome(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+
+	pool, err := s.db.GetAllocationPool(&user)
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not compute unassigned income")
+	}
+
+	return c.JSON(pool)
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"FinMa/internal/config"
+	"FinMa/internal/i18n"
+	"FinMa/types"
+	"context"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+)
+
+// isAnomalous reports whether the amount is unusually large compared to the
+// trailing statistics of its category: more than the multiplier of standard
+// deviations above the mean, once the category has enough past expenses and
+// the amount is above the minimum.
+func isAnomalous(amount types.Money, stats types.CategoryStatistics, cfg config.Features) bool {
+	amount = amount.Unbound()
+	if stats.Count < cfg.AnomalyMinSampleSize || amount.Minor < types.MoneyFromFloat(cfg.AnomalyMinAmount, "").Minor {
+		return false
+	}
+	return amount.Minor > stats.Mean.Unbound().Minor+stats.StdDev.Unbound().Mul(cfg.AnomalyMultiplier).Minor
+}
+
+// flagAnomaly sets IsFlagged on an expense that is unusually large for its
+// category over the 90 days preceding it.
+func (s *FiberServer) flagAnomaly(transaction *types.Transaction) {
+	if transaction.Type != "expense" {
+		return
+	}
+
+	stats, err := s.db.GetCategoryStatistics(transaction, transaction.Date.AddDate(0, 0, -90))
+	if err != nil {
+		log.Error("Error computing category statistics: ", err)
+		return
+	}
+
+	if !isAnomalous(transaction.Amount, stats, s.config.Features) {
+		return
+	}
+
+	if s.db.IsMerchantMuted(transaction.UserID, transaction.Description) {
+		return
+	}
+
+	transaction.IsFlagged = true
+}
+
+// notifyAnomaly creates a notification for a flagged transaction.
+func (s *FiberServer) notifyAnomaly(transaction *types.Transaction) {
+	if !transaction.IsFlagged {
+		return
+	}
+
+	err := s.Notify(context.Background(), transaction.UserID, "large_transaction", NotificationPayload{
+		Params:  i18n.Params{"category": transaction.Category, "amount": i18n.Amount(transaction.Amount.Float64()), "description": transaction.Description},
+		Details: fiber.Map{"transaction_id": transaction.ID},
+	})
+	if err != nil {
+		log.Error("Error notifying large transaction: ", err)
+	}
+}
+
+// DismissTransactionFlag clears the flag of a transaction and stops flagging
+// future transactions from the same merchant.
+func (s *FiberServer) DismissTransactionFlag(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	transaction, ok := s.findUserTransaction(user, c.Params("id"), "editor")
+
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Transaction not found")
+	}
+
+	transaction.IsFlagged = false
+	transaction.UpdatedAt = time.Now()
+	if err := s.db.UpdateTransaction(&transaction); err != nil {
+		return s.updateTransactionError(err, transaction.ID)
+	}
+
+	if err := s.db.MuteMerchant(user.ID, transaction.Description); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not mute merchant")
+	}
+
+	return c.JSON(transaction)
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/internal/config"
+	"FinMa/types"
+)
+
+// anomaliesDB answers the statistics of the category and remembers the
+// merchants muted.
+type anomaliesDB struct {
+	*versionsDB
+	stats types.CategoryStatistics
+	muted map[string]bool
+}
+
+func (db *anomaliesDB) GetCategoryStatistics(transaction *types.Transaction, since time.Time) (types.CategoryStatistics, error) {
+	return db.stats, nil
+}
+
+func (db *anomaliesDB) IsMerchantMuted(userID uuid.UUID, merchant string) bool {
+	return db.muted[merchant]
+}
+
+func (db *anomaliesDB) MuteMerchant(userID uuid.UUID, merchant string) error {
+	db.muted[merchant] = true
+	return nil
+}
+
+func TestIsAnomalous(t *testing.T) {
+	cfg := config.Default().Features
+	stats := types.CategoryStatistics{Count: cfg.AnomalyMinSampleSize, Mean: money(40), StdDev: money(10)}
+
+	if !isAnomalous(money(100), stats, cfg) {
+		t.Errorf("expected an expense above the mean plus %v deviations flagged", cfg.AnomalyMultiplier)
+	}
+	if isAnomalous(money(65), stats, cfg) {
+		t.Errorf("expected an expense within the deviations not flagged")
+	}
+
+	// Too few past expenses to tell what is usual
+	stats.Count = cfg.AnomalyMinSampleSize - 1
+	if isAnomalous(money(1000), stats, cfg) {
+		t.Errorf("expected no flag below the minimum sample size")
+	}
+
+	stats = types.CategoryStatistics{Count: 20, Mean: money(5), StdDev: money(1)}
+	if isAnomalous(money(cfg.AnomalyMinAmount-1), stats, cfg) {
+		t.Errorf("expected no flag below the minimum amount")
+	}
+}
+
+func TestFlagAnomaly(t *testing.T) {
+	s, admin, _, user := newAdminTestServer(t)
+	db := &anomaliesDB{versionsDB: &versionsDB{adminDB: admin}, muted: map[string]bool{}}
+	s.db = db
+
+	flag := func(transactionType string) bool {
+		transaction := &types.Transaction{ID: uuid.New(), Amount: types.MoneyFromFloat(500, "EUR"), Type: transactionType, Category: "food",
+			Description: "Caterer", Date: time.Now(), UserID: user.ID}
+		s.flagAnomaly(transaction)
+		return transaction.IsFlagged
+	}
+
+	db.stats = types.CategoryStatistics{Count: 2, Mean: money(40), StdDev: money(10)}
+	if flag("expense") {
+		t.Errorf("expected no flag with too few past expenses")
+	}
+
+	db.stats.Count = 10
+	if !flag("expense") {
+		t.Errorf("expected the large expense flagged")
+	}
+	if flag("income") {
+		t.Errorf("expected the incomes never flagged")
+	}
+
+	db.muted["Caterer"] = true
+	if flag("expense") {
+		t.Errorf("expected no flag for a muted merchant")
+	}
+}
+
+func TestDismissTransactionFlag(t *testing.T) {
+	s, admin, _, user := newAdminTestServer(t)
+	flagged := types.Transaction{ID: uuid.New(), Amount: types.MoneyFromFloat(500, "EUR"), Type: "expense", Category: "food",
+		Description: "Caterer", UserID: user.ID, IsFlagged: true, Version: 1}
+	db := &anomaliesDB{versionsDB: &versionsDB{adminDB: admin, transactions: map[uuid.UUID]types.Transaction{flagged.ID: flagged}},
+		muted: map[string]bool{}}
+	s.db = db
+
+	resp := adminRequest(t, s, user, "POST", "/api/v1/transactions/"+flagged.ID.String()+"/dismiss-flag", "")
+	var dismissed types.Transaction
+	json.NewDecoder(resp.Body).Decode(&dismissed)
+	if resp.StatusCode != fiber.StatusOK || dismissed.IsFlagged || db.transactions[flagged.ID].IsFlagged {
+		t.Fatalf("expected the flag cleared; got %d %+v", resp.StatusCode, dismissed)
+	}
+	if !db.muted["Caterer"] {
+		t.Errorf("expected the merchant muted")
+	}
+
+	// The next large expense of the merchant is not flagged
+	db.stats = types.CategoryStatistics{Count: 10, Mean: money(40), StdDev: money(10)}
+	next := &types.Transaction{ID: uuid.New(), Amount: types.MoneyFromFloat(600, "EUR"), Type: "expense", Category: "food",
+		Description: "Caterer", Date: time.Now(), UserID: user.ID}
+	s.flagAnomaly(next)
+	if next.IsFlagged {
+		t.Errorf("expected the muted merchant not flagged again")
+	}
+
+	resp = adminRequest(t, s, user, "POST", "/api/v1/transactions/"+uuid.NewString()+"/dismiss-flag", "")
+	var body errorBody
+	json.NewDecoder(resp.Body).Decode(&body)
+	if resp.StatusCode != fiber.StatusNotFound || body.Error.Code != CodeNotFound {
+		t.Errorf("expected an unknown transaction refused; got %d %+v", resp.StatusCode, body)
+	}
+}
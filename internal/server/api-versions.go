@@ -0,0 +1,59 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"FinMa/internal/config"
+)
+
+// APIPrefix is the prefix of the current version of the API.
+const APIPrefix = "/api/v1"
+
+// legacyAPIPrefix is the prefix of the unversioned API, kept as an alias of
+// the current version until its sunset.
+const legacyAPIPrefix = "/api"
+
+// LegacyAPISettings configures the unversioned aliases of the API.
+type LegacyAPISettings struct {
+	Enabled bool      // Serve the routes under /api as well as /api/v1
+	Sunset  time.Time // Date the aliases are removed, announced in the Sunset header
+}
+
+// legacyAPISettings returns the settings of the aliases from the server
+// configuration, validated when it was loaded.
+func legacyAPISettings(cfg config.Server) LegacyAPISettings {
+	return LegacyAPISettings{
+		Enabled: cfg.LegacyAliases,
+		Sunset:  cfg.Sunset(),
+	}
+}
+
+// isCurrentAPIPath reports whether the path is under the current version.
+func isCurrentAPIPath(path string) bool {
+	return path == APIPrefix || strings.HasPrefix(path, APIPrefix+"/")
+}
+
+// deprecatedAPI marks the responses of the unversioned aliases as
+// deprecated (RFC 9745 and RFC 8594), linking to the same route under the
+// current version. The websocket handshake and the event stream carry the
+// headers too. The group of the aliases also sees the requests of the
+// current version, they are left untouched.
+func deprecatedAPI(settings LegacyAPISettings) fiber.Handler {
+	sunset := settings.Sunset.UTC().Format(http.TimeFormat)
+	return func(c *fiber.Ctx) error {
+		path := c.Path()
+		if isCurrentAPIPath(path) {
+			return c.Next()
+		}
+
+		c.Set("Deprecation", "true")
+		c.Set("Sunset", sunset)
+		c.Set(fiber.HeaderLink, fmt.Sprintf(`<%s%s>; rel="successor-version"`, APIPrefix, strings.TrimPrefix(path, legacyAPIPrefix)))
+		return c.Next()
+	}
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"FinMa/internal/database"
+	"FinMa/types"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+)
+
+// audit records a sensitive change in the audit log. Failures are logged but
+// never fail the request that triggered them.
+func (s *FiberServer) audit(userID uuid.UUID, action, entityType string, entityID uuid.UUID, details string) {
+	writeAudit(s.db, userID, action, entityType, entityID, details)
+}
+
+// writeAudit records the change in the audit log of db.
+func writeAudit(db database.Service, userID uuid.UUID, action, entityType string, entityID uuid.UUID, details string) {
+	entry := &types.AuditLog{
+		ID:         uuid.New(),
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		Details:    details,
+		UserID:     userID,
+	}
+
+	if err := db.CreateAuditLog(entry); err != nil {
+		log.Error("Error writing audit log: ", err)
+	}
+}
+
+// auditBatch records the same change of every entity of one operation, under
+// the batch, so that the activity feed shows them as one item.
+func (s *FiberServer) auditBatch(batchID, userID uuid.UUID, action, entityType string, entityIDs []uuid.UUID, details string) {
+	entries := make([]types.AuditLog, 0, len(entityIDs))
+	for _, entityID := range entityIDs {
+		entries = append(entries, types.AuditLog{
+			ID:         uuid.New(),
+			Action:     action,
+			EntityType: entityType,
+			EntityID:   entityID,
+			Details:    details,
+			BatchID:    &batchID,
+			UserID:     userID,
+		})
+	}
+
+	if err := s.db.CreateAuditLogs(entries); err != nil {
+		log.Error("Error writing audit log: ", err)
+	}
+}
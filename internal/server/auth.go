@@ -1,36 +1,42 @@
 package server
 
 import (
+	"FinMa/internal/i18n"
+	"FinMa/internal/logging"
 	"FinMa/types"
 	"FinMa/utils"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"time"
 
 	"github.com/charmbracelet/log"
-	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 )
 
-var validate = validator.New()
+var validate = newValidator()
 
-// SignUpHandler is a handler that creates a new user.
+// SignUp creates a new user.
 // It expects a JSON object with the following fields:
 // - email: the user's email address
 // - password: the user's password
 // - first_name: the user's first name
 // - last_name: the user's last name
-func (s *FiberServer) SignUpHandler(c *fiber.Ctx) error {
+func (h *Handler) SignUp(c *fiber.Ctx) error {
 	var user types.User
 
 	if err := c.BodyParser(&user); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, err.Error())
 	}
 
 	if err := validate.Struct(user); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		return err
+	}
+
+	if existing := h.db.GetUserByEmail(user.Email); existing.ID != uuid.Nil {
+		return NewAPIError(fiber.StatusConflict, CodeEmailTaken, "An account already uses this email").
+			WithDetails(FieldError{Field: "email", Message: "is already registered"})
 	}
 
 	user.ID = uuid.New()
@@ -39,25 +45,24 @@ func (s *FiberServer) SignUpHandler(c *fiber.Ctx) error {
 	user.Role = "user"
 
 	if err := utils.ValidatePassword(user.Password); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, err.Error())
 	}
 
 	hashedPassword, err := utils.HashPassword(user.Password)
 	if err != nil {
 		log.Error(err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "cannot hash password"})
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "cannot hash password")
 	}
 	user.Password = hashedPassword
 
-	if err := s.db.CreateUser(user); err != nil {
-		log.Error(err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	if err := h.db.CreateUser(user); err != nil {
+		return err
 	}
 
 	return c.JSON(user)
 }
 
-func (s *FiberServer) LoginHandler(c *fiber.Ctx) error {
+func (h *Handler) Login(c *fiber.Ctx) error {
 	var loginRequest struct {
 		Email    string `json:"email" validate:"required,email"`
 		Password string `json:"password" validate:"required"`
@@ -66,61 +71,83 @@ func (s *FiberServer) LoginHandler(c *fiber.Ctx) error {
 	if err := c.BodyParser(&loginRequest); err != nil {
 		// Log the error
 		log.Error(fmt.Sprintf("error parsing login request: %s", err))
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
 	}
 
 	if err := validate.Struct(loginRequest); err != nil {
 		// Log the error
 		log.Error(fmt.Sprintf("error validating login request: %s", err))
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid email or password format"})
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid email or password format")
 	}
 
-	user := s.db.GetUserByEmail(loginRequest.Email)
+	user := h.db.GetUserByEmail(loginRequest.Email)
 
 	if user.ID == uuid.Nil {
 		// Log the error
-		log.Info(fmt.Sprintf("user not found: %s", loginRequest.Email))
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User not found"})
+		log.Info(fmt.Sprintf("user not found: %s", logging.Email(loginRequest.Email)))
+		return NewAPIError(fiber.StatusUnauthorized, CodeInvalidCredentials, "User not found")
 	}
 
 	if err := utils.ComparePasswords(user.Password, loginRequest.Password); err != nil {
 		// Log the error
-		log.Warn(fmt.Sprintf("invalid password for user: %s", loginRequest.Email))
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid password"})
+		log.Warn(fmt.Sprintf("invalid password for user: %s", logging.Email(loginRequest.Email)))
+		return NewAPIError(fiber.StatusUnauthorized, CodeInvalidCredentials, "Invalid password")
 	}
 
+	h.checkLoginDevice(c, user)
+
+	return h.startSession(c, user, time.Now().Add(sessionLifetime))
+}
+
+// startSession answers with the tokens of the user, the refresh token
+// expiring at refreshExpiresAt: in the body, or in HttpOnly cookies when
+// the configuration says so.
+func (h *Handler) startSession(c *fiber.Ctx, user types.User, refreshExpiresAt time.Time) error {
 	// Generate an access token
 	payload := utils.Payload{
 		UserID: user.ID,
 		Email:  user.Email,
 	}
 
-	accessToken, err := utils.GenerateAccessToken(payload)
+	accessToken, err := h.tokens.GenerateAccessToken(payload)
 
 	if err != nil {
 		log.Error(fmt.Sprintf("cannot generate access token: %s", err))
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Cannot generate access token"})
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Cannot generate access token")
 	}
 
-	refreshToken, err := utils.GenerateRefreshToken(payload)
+	refreshToken, err := h.tokens.GenerateRefreshTokenUntil(payload, refreshExpiresAt)
 
 	if err != nil {
 		log.Error(fmt.Sprintf("cannot generate refresh token: %s", err))
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Cannot generate refresh token"})
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Cannot generate refresh token")
+	}
+
+	if !h.auth.Cookies {
+		return c.JSON(fiber.Map{
+			"id":            user.ID,
+			"email":         user.Email,
+			"access_token":  accessToken,
+			"refresh_token": refreshToken,
+		})
 	}
 
-	// return access token as a cookie
+	// return the tokens as cookies, only sent over HTTPS when the server
+	// terminates TLS
+	secure := h.secureCookies
 	c.Cookie(&fiber.Cookie{
 		Name:     "access_token",
 		Value:    accessToken,
 		Expires:  time.Now().Add(time.Minute * 5),
 		HTTPOnly: true,
+		Secure:   secure,
 	})
 	c.Cookie(&fiber.Cookie{
 		Name:     "refresh_token",
 		Value:    refreshToken,
-		Expires:  time.Now().Add(time.Hour * 24 * 7),
+		Expires:  refreshExpiresAt,
 		HTTPOnly: true,
+		Secure:   secure,
 	})
 	// Return user data without exposing sensitive information
 	return c.JSON(fiber.Map{
@@ -129,46 +156,115 @@ func (s *FiberServer) LoginHandler(c *fiber.Ctx) error {
 	})
 }
 
-func (s *FiberServer) RefreshHandler(c *fiber.Ctx) error {
+func (h *Handler) Refresh(c *fiber.Ctx) error {
 	var req struct {
 		RefreshToken string `json:"refresh_token" validate:"required"`
 	}
 
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Refresh Token is missing",
-		})
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Refresh Token is missing")
 	}
 
 	if err := validate.Struct(req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	// Verify the refresh token
-	payload, err := utils.VerifyRefreshToken(req.RefreshToken)
+	payload, err := h.tokens.VerifyRefreshToken(req.RefreshToken)
 
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Invalid Refresh Token",
-		})
+		return NewAPIError(fiber.StatusUnauthorized, CodeUnauthorized, "Invalid Refresh Token")
 	}
 
-	existingUser := s.db.GetUserByEmail(payload.Email)
+	existingUser := h.db.GetUserByEmail(payload.Email)
 
 	if existingUser.ID == uuid.Nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "User not found",
-		})
+		return NewAPIError(fiber.StatusUnauthorized, CodeInvalidCredentials, "User not found")
 	}
 
-	accessToken, err := utils.GenerateAccessToken(payload)
+	accessToken, err := h.tokens.GenerateAccessToken(payload)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Cannot generate access token",
-		})
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Cannot generate access token")
 	}
 
 	return c.JSON(fiber.Map{
 		"access_token": accessToken,
 	})
 }
+
+// ResetPassword sets the password of the user of a password reset
+// link. The link stops working once the password is changed.
+func (h *Handler) ResetPassword(c *fiber.Ctx) error {
+	var req struct {
+		Token    string `json:"token" validate:"required"`
+		Password string `json:"password" validate:"required"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+
+	if err := validate.Struct(req); err != nil {
+		return err
+	}
+
+	userID, err := h.tokens.VerifyPasswordResetToken(req.Token, func(userID uuid.UUID) string {
+		return h.db.GetUserByID(userID).Password
+	})
+	if err != nil {
+		log.Warn("Invalid password reset token: ", err)
+		return NewAPIError(fiber.StatusUnauthorized, CodeUnauthorized, "Invalid or expired reset link")
+	}
+
+	if err := utils.ValidatePassword(req.Password); err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, err.Error())
+	}
+
+	hashedPassword, err := utils.HashPassword(req.Password)
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "cannot hash password")
+	}
+	if err := h.db.UpdateUserPassword(userID, hashedPassword); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not reset the password")
+	}
+	writeAudit(h.db, userID, "password_reset", "user", userID, "")
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// checkLoginDevice records the device of a successful login, identified by
+// its user agent, and notifies the user when it was never seen before.
+func (h *Handler) checkLoginDevice(c *fiber.Ctx, user types.User) {
+	userAgent := c.Get(fiber.HeaderUserAgent)
+	fingerprint := sha256.Sum256([]byte(userAgent))
+	now := time.Now()
+
+	isNew, err := h.db.RecordKnownDevice(&types.KnownDevice{
+		ID:          uuid.New(),
+		Fingerprint: hex.EncodeToString(fingerprint[:]),
+		UserAgent:   userAgent,
+		UserID:      user.ID,
+		LastSeenAt:  now,
+	})
+	if err != nil {
+		log.Error("Error recording login device: ", err)
+		return
+	}
+	if !isNew {
+		return
+	}
+
+	err = h.notify(c.UserContext(), user, "new_device_login", NotificationPayload{
+		Params: i18n.Params{"user_agent": userAgent},
+		Details: fiber.Map{
+			"user_agent": userAgent,
+			"ip":         c.IP(),
+			"logged_at":  now,
+		},
+	})
+	if err != nil {
+		log.Error("Error notifying new device login: ", err)
+	}
+}
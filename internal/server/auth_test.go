@@ -0,0 +1,140 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/internal/config"
+	"FinMa/internal/database"
+	"FinMa/types"
+	"FinMa/utils"
+)
+
+// authDB knows a single user, whose devices are all known.
+type authDB struct {
+	database.Service
+	user types.User
+}
+
+func (db *authDB) GetUserByEmail(email string) types.User {
+	if email == db.user.Email {
+		return db.user
+	}
+	return types.User{}
+}
+
+func (db *authDB) RecordKnownDevice(*types.KnownDevice) (bool, error) {
+	return false, nil
+}
+
+// newAuthTestServer returns a server signing its tokens with the secret,
+// the tokens returned in the body of the login.
+func newAuthTestServer(t *testing.T, secret string) *FiberServer {
+	hashed, err := utils.HashPassword("Correct-horse-1")
+	if err != nil {
+		t.Fatalf("error hashing the password. Err: %v", err)
+	}
+	cfg := config.Default()
+	cfg.Auth.Cookies = false
+	cfg.Auth.AccessTokenSecret = secret + "-access"
+	cfg.Auth.RefreshTokenSecret = secret + "-refresh"
+	db := &authDB{user: types.User{ID: uuid.New(), Email: "ada@example.com", Password: hashed, Role: "user"}}
+
+	s := &FiberServer{
+		App:      fiber.New(fiber.Config{ErrorHandler: errorHandler}),
+		config:   cfg,
+		db:       db,
+		tokens:   utils.Tokens{AccessSecret: cfg.Auth.AccessTokenSecret, RefreshSecret: cfg.Auth.RefreshTokenSecret},
+		handlers: NewHandler(db, cfg.Auth, nil, nil),
+	}
+	s.Post("/login", s.handlers.Login)
+	s.Post("/refresh", s.handlers.Refresh)
+	s.Get("/me", s.Authorize("user"), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+	return s
+}
+
+// login returns the access and refresh tokens of a login to the server.
+func login(t *testing.T, s *FiberServer, password string) (*http.Response, map[string]string) {
+	req, err := http.NewRequest("POST", "/login", strings.NewReader(`{"email":"ada@example.com","password":"`+password+`"}`))
+	if err != nil {
+		t.Fatalf("error creating request. Err: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.Test(req)
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+	var body map[string]string
+	json.NewDecoder(resp.Body).Decode(&body)
+	return resp, body
+}
+
+func authorized(t *testing.T, s *FiberServer, token string) int {
+	req, err := http.NewRequest("GET", "/me", nil)
+	if err != nil {
+		t.Fatalf("error creating request. Err: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := s.Test(req)
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+	return resp.StatusCode
+}
+
+func TestLogin(t *testing.T) {
+	s := newAuthTestServer(t, "first")
+
+	if resp, _ := login(t, s, "wrong-password"); resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("expected status 401 for a wrong password; got %d", resp.StatusCode)
+	}
+
+	resp, tokens := login(t, s, "Correct-horse-1")
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("expected status 200; got %d", resp.StatusCode)
+	}
+	if tokens["access_token"] == "" || tokens["refresh_token"] == "" {
+		t.Fatalf("expected the tokens in the body; got %v", tokens)
+	}
+	if status := authorized(t, s, tokens["access_token"]); status != fiber.StatusOK {
+		t.Errorf("expected the access token to be accepted; got %d", status)
+	}
+	if status := authorized(t, s, tokens["refresh_token"]); status != fiber.StatusUnauthorized {
+		t.Errorf("expected the refresh token to be refused as an access token; got %d", status)
+	}
+
+	req, err := http.NewRequest("POST", "/refresh", strings.NewReader(`{"refresh_token":"`+tokens["refresh_token"]+`"}`))
+	if err != nil {
+		t.Fatalf("error creating request. Err: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = s.Test(req)
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+	var refreshed map[string]string
+	json.NewDecoder(resp.Body).Decode(&refreshed)
+	if resp.StatusCode != fiber.StatusOK || authorized(t, s, refreshed["access_token"]) != fiber.StatusOK {
+		t.Errorf("expected the refresh to return a valid access token; got %d", resp.StatusCode)
+	}
+}
+
+func TestServersWithDifferentSecrets(t *testing.T) {
+	first := newAuthTestServer(t, "first")
+	second := newAuthTestServer(t, "second")
+
+	_, tokens := login(t, first, "Correct-horse-1")
+	if status := authorized(t, first, tokens["access_token"]); status != fiber.StatusOK {
+		t.Errorf("expected the token to be accepted by its server; got %d", status)
+	}
+	if status := authorized(t, second, tokens["access_token"]); status != fiber.StatusUnauthorized {
+		t.Errorf("expected the token to be refused by the other server; got %d", status)
+	}
+}
@@ -0,0 +1,205 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/internal/avatars"
+	"FinMa/internal/i18n"
+	"FinMa/internal/storage"
+	"FinMa/types"
+)
+
+// avatarExtensions are the extensions of the avatar files by content type,
+// which the local storage reads the type from.
+var avatarExtensions = map[string]string{"image/jpeg": ".jpg", "image/png": ".png"}
+
+// avatarKey returns the storage key of the avatar of the user at the
+// version, the size and the content type.
+func avatarKey(userID uuid.UUID, version int64, size int, contentType string) string {
+	return fmt.Sprintf("avatars/%s/%d/%d%s", userID, version, size, avatarExtensions[contentType])
+}
+
+// avatarURLs returns the URLs of the avatar of the user by size, with its
+// version so that a new upload busts the caches.
+func avatarURLs(user types.User) map[string]string {
+	urls := map[string]string{}
+	if user.AvatarVersion == 0 {
+		return urls
+	}
+	for _, size := range avatars.Sizes {
+		urls[strconv.Itoa(size)] = fmt.Sprintf("%s/users/%s/avatar?size=%d&v=%d", APIPrefix, user.ID, size, user.AvatarVersion)
+	}
+	return urls
+}
+
+// removeAvatarFiles deletes the files of the avatar of the user at the
+// version. A file left behind is only logged, it is never served again.
+func (s *FiberServer) removeAvatarFiles(ctx context.Context, userID uuid.UUID, version int64) {
+	for _, size := range avatars.Sizes {
+		for contentType := range avatarExtensions {
+			if err := s.storage.Delete(ctx, avatarKey(userID, version, size, contentType)); err != nil {
+				log.Error("Error deleting an avatar file: ", err)
+			}
+		}
+	}
+}
+
+// UploadAvatar replaces the avatar of the user with the JPEG, PNG or WebP
+// picture of the "avatar" field of the multipart form, up to 2 MB. The type
+// is sniffed from the content, the declared one is ignored. The picture is
+// rendered at every size, and the files of the previous avatar are deleted.
+func (s *FiberServer) UploadAvatar(c *fiber.Ctx) error {
+	file, err := c.FormFile("avatar")
+	if err != nil {
+		return NewAPIError(fiber.StatusUnprocessableEntity, CodeValidationFailed, "Invalid avatar").
+			WithDetails(FieldError{Field: "avatar", Message: "Required"})
+	}
+	if file.Size > avatars.MaxSize {
+		limit := formatBytes(avatars.MaxSize)
+		return NewAPIError(fiber.StatusRequestEntityTooLarge, CodePayloadTooLarge,
+			fmt.Sprintf("The avatar is larger than the %s allowed", limit)).
+			WithParams(i18n.Params{"limit": limit})
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Could not read the avatar")
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, avatars.MaxSize))
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Could not read the avatar")
+	}
+
+	rendered, err := avatars.Render(data)
+	if errors.Is(err, avatars.ErrUnsupportedFormat) {
+		formats := strings.Join(avatars.Formats, ", ")
+		return NewAPIError(fiber.StatusUnsupportedMediaType, CodeUnsupportedMedia,
+			"The file type is not supported, expected one of: "+formats).
+			WithParams(i18n.Params{"formats": formats})
+	}
+	if err != nil {
+		return NewAPIError(fiber.StatusUnprocessableEntity, CodeValidationFailed, "Invalid avatar").
+			WithDetails(FieldError{Field: "avatar", Message: "Must be a valid picture of at most 16 megapixels"})
+	}
+
+	user := c.Locals("user").(types.User)
+	// The versions are upload times, so that an avatar removed then uploaded
+	// again never reuses the URL of the previous one
+	previous := user.AvatarVersion
+	user.AvatarVersion = max(time.Now().UnixMilli(), previous+1)
+	for _, avatar := range rendered {
+		key := avatarKey(user.ID, user.AvatarVersion, avatar.Size, avatar.ContentType)
+		if err := s.storage.Put(c.UserContext(), key, bytes.NewReader(avatar.Data), int64(len(avatar.Data)), avatar.ContentType); err != nil {
+			log.Error("Error storing the avatar: ", err)
+			s.removeAvatarFiles(c.UserContext(), user.ID, user.AvatarVersion)
+			return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not store the avatar")
+		}
+	}
+	if err := s.db.UpdateUserAvatarVersion(&user); err != nil {
+		log.Error(err)
+		s.removeAvatarFiles(c.UserContext(), user.ID, user.AvatarVersion)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not store the avatar")
+	}
+	if previous > 0 {
+		s.removeAvatarFiles(c.UserContext(), user.ID, previous)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"avatar_version": user.AvatarVersion,
+		"avatar_urls":    avatarURLs(user),
+	})
+}
+
+// DeleteAvatar removes the avatar of the user and its files.
+func (s *FiberServer) DeleteAvatar(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	if user.AvatarVersion == 0 {
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+
+	previous := user.AvatarVersion
+	user.AvatarVersion = 0
+	if err := s.db.UpdateUserAvatarVersion(&user); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not remove the avatar")
+	}
+	s.removeAvatarFiles(c.UserContext(), user.ID, previous)
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// GetAvatar serves the avatar of the user at the size of the "size" query,
+// 256 by default. It is public, for the img tags, the user IDs not being
+// guessable. The URLs with the current version, as returned by the upload,
+// are cached for a year: a new upload changes them.
+func (s *FiberServer) GetAvatar(c *fiber.Ctx) error {
+	size := c.QueryInt("size", avatars.Sizes[len(avatars.Sizes)-1])
+	known := false
+	for _, candidate := range avatars.Sizes {
+		known = known || candidate == size
+	}
+	if !known {
+		return NewAPIError(fiber.StatusUnprocessableEntity, CodeValidationFailed, "Invalid size").
+			WithDetails(FieldError{Field: "size", Message: "Must be one of " + joinInts(avatars.Sizes), Value: c.Query("size")})
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Avatar not found")
+	}
+	user := s.db.GetUserByID(id)
+	if user.ID == uuid.Nil || user.AvatarVersion == 0 {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Avatar not found")
+	}
+
+	etag := fmt.Sprintf(`"%d-%d"`, user.AvatarVersion, size)
+	c.Set(fiber.HeaderETag, etag)
+	if c.Query("v") == strconv.FormatInt(user.AvatarVersion, 10) {
+		c.Set(fiber.HeaderCacheControl, "public, max-age=31536000, immutable")
+	} else {
+		c.Set(fiber.HeaderCacheControl, "public, no-cache")
+	}
+	if etagMatches(c.Get(fiber.HeaderIfNoneMatch), etag) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	// The opaque avatars are JPEG, the others PNG
+	for _, contentType := range []string{"image/jpeg", "image/png"} {
+		r, object, err := s.storage.Get(c.UserContext(), avatarKey(user.ID, user.AvatarVersion, size, contentType))
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			log.Error("Error reading the avatar: ", err)
+			return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not read the avatar")
+		}
+
+		c.Set(fiber.HeaderContentType, contentType)
+		c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+		return c.SendStream(r, int(object.Size))
+	}
+	return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Avatar not found")
+}
+
+// joinInts lists the numbers, like "64, 256".
+func joinInts(numbers []int) string {
+	texts := make([]string, len(numbers))
+	for i, number := range numbers {
+		texts[i] = strconv.Itoa(number)
+	}
+	return strings.Join(texts, ", ")
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"sort"
+	"testing"
+
+	"FinMa/internal/storage"
+	"FinMa/types"
+	"FinMa/utils"
+)
+
+func (db *adminDB) UpdateUserAvatarVersion(user *types.User) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	stored := db.users[user.ID]
+	stored.AvatarVersion = user.AvatarVersion
+	db.users[user.ID] = stored
+	return nil
+}
+
+// newAvatarTestServer returns the admin test server storing its files in a
+// temporary directory.
+func newAvatarTestServer(t *testing.T) (*FiberServer, *storage.Local, types.User) {
+	s, _, _, user := newAdminTestServer(t)
+	store, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.storage = store
+	return s, store, user
+}
+
+// uploadAvatar posts the file as the avatar of the user, with the declared
+// content type.
+func uploadAvatar(t *testing.T, s *FiberServer, as types.User, data []byte, contentType string) *http.Response {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="avatar"; filename="avatar.png"`)
+	header.Set("Content-Type", contentType)
+	part, err := form.CreatePart(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	form.Close()
+
+	token, err := s.tokens.GenerateAccessToken(utils.Payload{UserID: as.ID, Email: as.Email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("POST", "/api/v1/users/me/avatar", &body)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	resp, err := s.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func jpegPicture(t *testing.T, c color.Color) []byte {
+	t.Helper()
+	picture := image.NewRGBA(image.Rect(0, 0, 300, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 300; x++ {
+			picture.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, picture, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// storedKeys lists the keys of the storage.
+func storedKeys(t *testing.T, store *storage.Local) []string {
+	t.Helper()
+	var keys []string
+	if err := store.Walk(context.Background(), func(key string) error {
+		keys = append(keys, key)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type avatarResponse struct {
+	AvatarVersion int64             `json:"avatar_version"`
+	AvatarURLs    map[string]string `json:"avatar_urls"`
+}
+
+func TestUploadAvatarIsServedWithCacheHeaders(t *testing.T) {
+	s, store, user := newAvatarTestServer(t)
+
+	resp := uploadAvatar(t, s, user, jpegPicture(t, color.RGBA{R: 200, A: 255}), "image/jpeg")
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201; got %d", resp.StatusCode)
+	}
+	var uploaded avatarResponse
+	json.NewDecoder(resp.Body).Decode(&uploaded)
+	if uploaded.AvatarVersion == 0 || len(uploaded.AvatarURLs) != 2 || len(storedKeys(t, store)) != 2 {
+		t.Fatalf("expected a version and 2 sizes stored; got %+v", uploaded)
+	}
+
+	// Anonymous, like an img tag
+	req, _ := http.NewRequest("GET", uploaded.AvatarURLs["64"], nil)
+	resp, _ = s.Test(req)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "image/jpeg" {
+		t.Fatalf("expected the JPEG; got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if resp.Header.Get("Cache-Control") != "public, max-age=31536000, immutable" || resp.Header.Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("expected a long cache; got %q", resp.Header.Get("Cache-Control"))
+	}
+	picture, err := jpeg.Decode(resp.Body)
+	if err != nil || picture.Bounds().Dx() != 64 {
+		t.Fatalf("expected a 64px picture; got %v, %v", picture, err)
+	}
+
+	req, _ = http.NewRequest("GET", uploaded.AvatarURLs["64"], nil)
+	req.Header.Set("If-None-Match", resp.Header.Get("ETag"))
+	if resp, _ := s.Test(req); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("expected 304 for the same ETag; got %d", resp.StatusCode)
+	}
+
+	// Without the version the URL is revalidated
+	req, _ = http.NewRequest("GET", "/api/v1/users/"+user.ID.String()+"/avatar", nil)
+	if resp, _ := s.Test(req); resp.StatusCode != http.StatusOK || resp.Header.Get("Cache-Control") != "public, no-cache" {
+		t.Errorf("expected the 256px avatar revalidated; got %d %q", resp.StatusCode, resp.Header.Get("Cache-Control"))
+	}
+
+	req, _ = http.NewRequest("GET", "/api/v1/users/"+user.ID.String()+"/avatar?size=32", nil)
+	if resp, _ := s.Test(req); resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 for an unknown size; got %d", resp.StatusCode)
+	}
+}
+
+func TestUploadAvatarReplacesThePreviousOne(t *testing.T) {
+	s, store, user := newAvatarTestServer(t)
+
+	resp := uploadAvatar(t, s, user, jpegPicture(t, color.RGBA{R: 200, A: 255}), "image/jpeg")
+	var first avatarResponse
+	json.NewDecoder(resp.Body).Decode(&first)
+	firstKeys := storedKeys(t, store)
+
+	user.AvatarVersion = first.AvatarVersion
+	resp = uploadAvatar(t, s, user, jpegPicture(t, color.RGBA{B: 200, A: 255}), "image/jpeg")
+	var second avatarResponse
+	json.NewDecoder(resp.Body).Decode(&second)
+	if second.AvatarVersion <= first.AvatarVersion || second.AvatarURLs["64"] == first.AvatarURLs["64"] {
+		t.Errorf("expected a new version in the URLs; got %+v then %+v", first, second)
+	}
+	keys := storedKeys(t, store)
+	if len(keys) != 2 || keys[0] == firstKeys[0] {
+		t.Errorf("expected the previous files removed; got %v", keys)
+	}
+
+	// The cached URL of the first avatar is no longer immutable
+	req, _ := http.NewRequest("GET", first.AvatarURLs["64"], nil)
+	if resp, _ := s.Test(req); resp.Header.Get("Cache-Control") != "public, no-cache" {
+		t.Errorf("expected the previous URL revalidated; got %q", resp.Header.Get("Cache-Control"))
+	}
+}
+
+func TestUploadAvatarRefusesDisguisedAndLargeFiles(t *testing.T) {
+	s, store, user := newAvatarTestServer(t)
+
+	svg := []byte(`<svg xmlns="http://www.w3.org/2000/svg" onload="alert(document.cookie)"/>`)
+	html := []byte(`<html><script>alert(document.cookie)</script></html>`)
+	for _, data := range [][]byte{svg, html} {
+		if resp := uploadAvatar(t, s, user, data, "image/png"); resp.StatusCode != http.StatusUnsupportedMediaType {
+			t.Errorf("expected 415 for %.20q; got %d", data, resp.StatusCode)
+		}
+	}
+
+	large := append(jpegPicture(t, color.Black), make([]byte, 2<<20)...)
+	if resp := uploadAvatar(t, s, user, large, "image/jpeg"); resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 past 2 MB; got %d", resp.StatusCode)
+	}
+	if keys := storedKeys(t, store); len(keys) != 0 {
+		t.Errorf("expected nothing stored; got %v", keys)
+	}
+}
+
+func TestDeleteAvatarRemovesTheFiles(t *testing.T) {
+	s, store, user := newAvatarTestServer(t)
+
+	resp := uploadAvatar(t, s, user, jpegPicture(t, color.White), "image/jpeg")
+	var uploaded avatarResponse
+	json.NewDecoder(resp.Body).Decode(&uploaded)
+
+	user.AvatarVersion = uploaded.AvatarVersion
+	if resp := adminRequest(t, s, user, "DELETE", "/api/v1/users/me/avatar", ""); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204; got %d", resp.StatusCode)
+	}
+	if keys := storedKeys(t, store); len(keys) != 0 {
+		t.Errorf("expected the files removed; got %v", keys)
+	}
+	req, _ := http.NewRequest("GET", uploaded.AvatarURLs["256"], nil)
+	if resp, _ := s.Test(req); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 once removed; got %d", resp.StatusCode)
+	}
+}
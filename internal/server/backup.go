@@ -0,0 +1,85 @@
+package server
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+
+	"FinMa/internal/database"
+)
+
+// CreateBackup streams a gzip compressed backup of the data of every user
+// and of the instance, to be restored with RestoreBackup. The backup is
+// read from one snapshot while it is sent: a failure past the headers
+// leaves a truncated archive, which the restore refuses. Admin only.
+func (s *FiberServer) CreateBackup(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, "application/gzip")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="finma-backup-%s.json.gz"`, time.Now().UTC().Format(time.DateOnly)))
+
+	// Written once the handler returned, the request context is gone
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		archive := gzip.NewWriter(w)
+		if err := s.db.Backup(archive); err != nil {
+			log.Error("Error backing up the database: ", err)
+			return
+		}
+		if err := archive.Close(); err != nil {
+			log.Error("Error writing the backup: ", err)
+			return
+		}
+		if err := w.Flush(); err != nil {
+			log.Error("Error sending the backup: ", err)
+		}
+	})
+	return nil
+}
+
+// RestoreBackup replaces the data of the instance with the backup uploaded
+// in the "file" field of a multipart form, compressed or not. A database
+// holding data is refused with a 409 unless ?force=true. The backup is
+// restored whole or not at all. Admin only.
+func (s *FiberServer) RestoreBackup(c *fiber.Ctx) error {
+	header, err := c.FormFile("file")
+	if err != nil {
+		return NewAPIError(fiber.StatusUnprocessableEntity, CodeValidationFailed, "Invalid backup").
+			WithDetails(FieldError{Field: "file", Message: "Required"})
+	}
+	file, err := header.Open()
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Could not read the backup")
+	}
+	defer file.Close()
+
+	var r io.Reader = bufio.NewReader(file)
+	if magic, _ := r.(*bufio.Reader).Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return NewAPIError(fiber.StatusUnprocessableEntity, CodeValidationFailed, "Invalid backup").
+				WithDetails(FieldError{Field: "file", Message: "Not a valid gzip archive"})
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	summary, err := s.dbFor(c).Restore(r, c.QueryBool("force"))
+	switch {
+	case errors.Is(err, database.ErrDatabaseNotEmpty):
+		return NewAPIError(fiber.StatusConflict, CodeConflict, "The database holds data, restore with ?force=true to replace it")
+	case errors.Is(err, database.ErrInvalidBackup):
+		return NewAPIError(fiber.StatusUnprocessableEntity, CodeValidationFailed, "Invalid backup").
+			WithDetails(FieldError{Field: "file", Message: err.Error()})
+	case err != nil:
+		log.Error("Error restoring a backup: ", err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not restore the backup")
+	}
+
+	log.Infof("Restored the backup of %s", summary.BackedUpAt.Format(time.RFC3339))
+	return c.JSON(summary)
+}
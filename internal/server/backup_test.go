@@ -0,0 +1,131 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"FinMa/internal/database"
+	"FinMa/types"
+	"FinMa/utils"
+)
+
+// backupDB backs up a fixed document and restores the backups it reads,
+// refusing to replace data unless forced like the database does.
+type backupDB struct {
+	*adminDB
+	hasData  bool
+	restored string
+}
+
+func (db *backupDB) WithContext(context.Context) database.Service {
+	return db
+}
+
+const testBackup = `{"schema_version":1,"tables":{"users":[]}}`
+
+func (db *backupDB) Backup(w io.Writer) error {
+	_, err := io.WriteString(w, testBackup)
+	return err
+}
+
+func (db *backupDB) Restore(r io.Reader, force bool) (types.RestoreSummary, error) {
+	if db.hasData && !force {
+		return types.RestoreSummary{}, database.ErrDatabaseNotEmpty
+	}
+	backup, err := io.ReadAll(r)
+	if err != nil {
+		return types.RestoreSummary{}, err
+	}
+	if !json.Valid(backup) {
+		return types.RestoreSummary{}, database.ErrInvalidBackup
+	}
+	db.restored = string(backup)
+	return types.RestoreSummary{SchemaVersion: 1, Rows: map[string]int64{"users": 0}}, nil
+}
+
+// restoreRequest uploads the backup to the restore route, no file if nil.
+func restoreRequest(t *testing.T, s *FiberServer, as types.User, path string, backup []byte) *http.Response {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if backup != nil {
+		part, _ := form.CreateFormFile("file", "backup.json.gz")
+		part.Write(backup)
+	}
+	form.Close()
+
+	token, err := s.tokens.GenerateAccessToken(utils.Payload{UserID: as.ID, Email: as.Email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("POST", path, &body)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	resp, err := s.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	s, admin, adminUser, user := newAdminTestServer(t)
+	db := &backupDB{adminDB: admin, hasData: true}
+	s.db = db
+
+	if resp := adminRequest(t, s, user, "POST", "/api/v1/admin/backup", ""); resp.StatusCode != fiber.StatusForbidden {
+		t.Fatalf("expected the backup refused to a user; got %d", resp.StatusCode)
+	}
+
+	resp := adminRequest(t, s, adminUser, "POST", "/api/v1/admin/backup", "")
+	if resp.StatusCode != fiber.StatusOK || resp.Header.Get("Content-Type") != "application/gzip" {
+		t.Fatalf("expected a gzip backup; got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	archive, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatalf("expected a gzip archive: %v", err)
+	}
+	backup, _ := io.ReadAll(archive)
+	if string(backup) != testBackup {
+		t.Fatalf("expected the backup streamed; got %q", backup)
+	}
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write(backup)
+	gz.Close()
+
+	resp = restoreRequest(t, s, adminUser, "/api/v1/admin/restore", compressed.Bytes())
+	if resp.StatusCode != fiber.StatusConflict {
+		t.Fatalf("expected status 409 for a database holding data; got %d", resp.StatusCode)
+	}
+
+	resp = restoreRequest(t, s, adminUser, "/api/v1/admin/restore?force=true", compressed.Bytes())
+	if resp.StatusCode != fiber.StatusOK || db.restored != testBackup {
+		t.Fatalf("expected the compressed backup restored; got %d %q", resp.StatusCode, db.restored)
+	}
+
+	db.hasData = false
+	if resp := restoreRequest(t, s, adminUser, "/api/v1/admin/restore", backup); resp.StatusCode != fiber.StatusOK {
+		t.Errorf("expected a plain backup restored to an empty database; got %d", resp.StatusCode)
+	}
+
+	resp = restoreRequest(t, s, adminUser, "/api/v1/admin/restore", []byte("{not json"))
+	var body errorBody
+	json.NewDecoder(resp.Body).Decode(&body)
+	if resp.StatusCode != fiber.StatusUnprocessableEntity || len(body.Error.Details) != 1 || body.Error.Details[0].Field != "file" {
+		t.Errorf("expected an invalid backup refused; got %d %+v", resp.StatusCode, body.Error.Details)
+	}
+
+	if resp := restoreRequest(t, s, adminUser, "/api/v1/admin/restore", nil); resp.StatusCode != fiber.StatusUnprocessableEntity {
+		t.Errorf("expected status 422 without a backup; got %d", resp.StatusCode)
+	}
+}
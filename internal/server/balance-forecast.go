@@ -0,0 +1,283 @@
+package server
+
+import (
+	"FinMa/internal/database"
+	"FinMa/types"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	// balanceForecastDefaultDays is the horizon of the balance forecast.
+	balanceForecastDefaultDays = 90
+	// balanceForecastMaxDays bounds the horizon of the balance forecast.
+	balanceForecastMaxDays = 365
+	// balanceForecastTrailingDays is the window the daily discretionary
+	// spending is averaged over.
+	balanceForecastTrailingDays = 90
+)
+
+// recurringForecastItems returns the next occurrences of the recurring
+// transactions of the account in (now, end), signed. The recurring
+// transactions already entered ahead of their date are left to the
+// scheduled ones: their group is not projected again.
+func recurringForecastItems(recurring []types.Transaction, accountID uuid.UUID, now, end time.Time) []types.ForecastItem {
+	entered := map[string]bool{}
+	for _, transaction := range recurring {
+		if transaction.BankAccountID == accountID && transaction.Date.After(now) {
+			entered[transaction.Type+":"+strings.ToLower(strings.TrimSpace(transaction.Description))] = true
+		}
+	}
+
+	byType := map[string][]types.Transaction{}
+	for _, transaction := range recurring {
+		key := transaction.Type + ":" + strings.ToLower(strings.TrimSpace(transaction.Description))
+		if transaction.BankAccountID != accountID || entered[key] {
+			continue
+		}
+		byType[transaction.Type] = append(byType[transaction.Type], transaction)
+	}
+
+	items := []types.ForecastItem{}
+	for _, transactionType := range []string{"income", "expense"} {
+		for _, occurrence := range upcomingRecurring(byType[transactionType], now, end) {
+			amount := occurrence.Amount.Unbound()
+			if transactionType == "expense" {
+				amount = amount.Neg()
+			}
+			items = append(items, types.ForecastItem{Date: occurrence.DueDate, Description: occurrence.Description, Amount: amount, Source: "recurring"})
+		}
+	}
+	return items
+}
+
+// billForecastItems returns the unpaid occurrences of the bills paid from the
+// account due in the days days starting today, a calendar date, dated at the
+// start of their due day in loc. An occurrence is left out when a committed
+// expense of the month of its due date already pays it.
+func billForecastItems(bills []types.Bill, payments []types.BillPayment, committed []types.ForecastItem, accountID uuid.UUID, today time.Time, days int, loc *time.Location) []types.ForecastItem {
+	byID := map[uuid.UUID]types.Bill{}
+	for _, bill := range bills {
+		if bill.BankAccountID != nil && *bill.BankAccountID == accountID {
+			byID[bill.ID] = bill
+		}
+	}
+
+	items := []types.ForecastItem{}
+	for _, occurrence := range upcomingBills(bills, payments, today, days) {
+		bill, ok := byID[occurrence.BillID]
+		if !ok || occurrence.Status == "paid" {
+			continue
+		}
+		due := time.Date(occurrence.DueDate.Year(), occurrence.DueDate.Month(), occurrence.DueDate.Day(), 0, 0, 0, 0, loc)
+
+		paid := false
+		for _, item := range committed {
+			date := item.Date.In(loc)
+			expense := types.Transaction{Type: "expense", Description: item.Description, Amount: item.Amount.Neg(), BankAccountID: accountID}
+			if date.Year() == due.Year() && date.Month() == due.Month() && billMatches(bill, expense) {
+				paid = true
+				break
+			}
+		}
+		if !paid {
+			items = append(items, types.ForecastItem{Date: due, Description: bill.Name, Amount: bill.Amount.Unbound().Neg(), Source: "bill"})
+		}
+	}
+	return items
+}
+
+// buildBalanceForecast sets the points of the forecast, the balance at the
+// end of each day from today, the start of the current day, to Days days
+// later, and the first days each projection goes below the floor. The
+// committed items are applied on their day, the ones past on today; the
+// daily discretionary spending is taken from the estimated balance every
+// day after today. The amounts are summed in unbound minor units.
+func buildBalanceForecast(forecast *types.BalanceForecast, items []types.ForecastItem, today time.Time) {
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Date.Before(items[j].Date)
+	})
+	for i := range items {
+		items[i].Amount = items[i].Amount.Unbound()
+	}
+	forecast.Items = items
+
+	committed := forecast.StartingBalance.Unbound().Minor
+	estimated := committed
+	daily := forecast.DailyDiscretionary.Unbound().Minor
+	forecast.Points = make([]types.ForecastPoint, 0, forecast.Days+1)
+	next := 0
+	for day := 0; day <= forecast.Days; day++ {
+		date := today.AddDate(0, 0, day)
+		end := date.AddDate(0, 0, 1)
+		for ; next < len(items) && items[next].Date.Before(end); next++ {
+			committed += items[next].Amount.Minor
+			estimated += items[next].Amount.Minor
+		}
+		if day > 0 {
+			estimated -= daily
+		}
+		forecast.Points = append(forecast.Points, types.ForecastPoint{Date: date, Committed: types.NewMoney(committed, ""), Estimated: types.NewMoney(estimated, "")})
+
+		if forecast.Floor == nil {
+			continue
+		}
+		floor := forecast.Floor.Unbound().Minor
+		if forecast.FirstNegativeCommitted == nil && committed < floor {
+			forecast.FirstNegativeCommitted = &date
+		}
+		if forecast.FirstNegativeEstimated == nil && estimated < floor {
+			forecast.FirstNegativeEstimated = &date
+		}
+	}
+}
+
+// cardForecastItems returns the payments of the credit cards due up to end,
+// from the statement cycles: what remains to pay of the last statement on
+// its due date, and the spend of the current cycle on the following one. A
+// card is credited by them, the account it was last paid from debited.
+func (s *FiberServer) cardForecastItems(db database.Service, user types.User, account types.BankAccount, now, today, end time.Time, loc *time.Location) ([]types.ForecastItem, error) {
+	cards := []types.BankAccount{account}
+	sign := 1
+	if account.AccountType != "credit_card" {
+		cards, sign = nil, -1
+		for _, card := range db.GetBankAccounts(&user, false) {
+			if card.AccountType != "credit_card" {
+				continue
+			}
+			payer, err := db.GetCardPaymentAccount(card.ID)
+			if err != nil {
+				return nil, err
+			}
+			if payer != nil && *payer == account.ID {
+				cards = append(cards, card)
+			}
+		}
+	}
+
+	items := []types.ForecastItem{}
+	for _, card := range cards {
+		if card.StatementDay == 0 || card.PaymentDueDay == 0 {
+			continue
+		}
+		cycle, err := s.buildStatementCycle(card, now, loc)
+		if err != nil {
+			return nil, err
+		}
+
+		// An overdue payment is still due today
+		due := cycle.DueDate
+		if due.Before(today) {
+			due = today
+		}
+		if cycle.RemainingToPay.Sign() > 0 && !due.After(end) {
+			items = append(items, types.ForecastItem{Date: due, Description: card.BankName, Amount: cycle.RemainingToPay.Unbound().Mul(float64(sign)), Source: "card_payment"})
+		}
+		if next := paymentDueDate(cycle.CycleEnd, card.PaymentDueDay, loc); cycle.CycleSpend.Sign() > 0 && !next.After(end) {
+			items = append(items, types.ForecastItem{Date: next, Description: card.BankName, Amount: cycle.CycleSpend.Unbound().Mul(float64(sign)), Source: "card_payment"})
+		}
+	}
+	return items, nil
+}
+
+// GetBalanceForecast projects the balance of ?account_id= at the end of each
+// day of the next ?days=90 (365 at most), in the user's timezone. The
+// committed projection applies the transactions already entered ahead of
+// their date, the next occurrences of the recurring ones, the unpaid bills
+// paid from the account and the payments of the credit cards due; the
+// estimated one also takes the average daily discretionary spending of the
+// last 90 days, without the recurring expenses and the bill payments. It is
+// an estimate, flagged as such, and nothing is stored. The CSV holds the
+// points.
+func (s *FiberServer) GetBalanceForecast(c *fiber.Ctx) error {
+	db := s.dbFor(c)
+
+	user := c.Locals("user").(types.User)
+
+	account, ok := s.findUserBankAccount(user, c.Query("account_id"), "viewer")
+	if !ok {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid bank account").
+			WithDetails(FieldError{Field: "account_id", Message: "unknown bank account", Value: c.Query("account_id")})
+	}
+	days := c.QueryInt("days", balanceForecastDefaultDays)
+	if days <= 0 || days > balanceForecastMaxDays {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "days must be between 1 and 365")
+	}
+
+	location := userLocation(user)
+	now := time.Now()
+	local := now.In(location)
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, location)
+	end := today.AddDate(0, 0, days+1)
+
+	// The projection moves with the day
+	key := []string{account.ID.String(), strconv.Itoa(days), today.Format(time.DateOnly)}
+	return cachedReport(s, c, "balance_forecast", key, func() (types.BalanceForecast, error) {
+		forecast := types.BalanceForecast{
+			Estimate:  true,
+			AccountID: account.ID,
+			Days:      days,
+			Timezone:  userTimezone(user),
+			Currency:  s.accountCurrency(account),
+		}
+		failed := func(err error) (types.BalanceForecast, error) {
+			log.Error(err)
+			return forecast, NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not compute the balance forecast")
+		}
+
+		pending, err := db.GetPendingTotal(account.ID)
+		if err != nil {
+			return failed(err)
+		}
+		settled, err := account.Balance.Sub(pending)
+		if err != nil {
+			return failed(err)
+		}
+		forecast.StartingBalance = settled.Unbound()
+		if !isLiability(account.AccountType) {
+			forecast.Floor = new(types.Money)
+		} else if account.CreditLimit.Sign() > 0 {
+			floor := account.CreditLimit.Unbound().Neg()
+			forecast.Floor = &floor
+		}
+
+		discretionary, err := db.GetDiscretionarySpending(account.ID, now.AddDate(0, 0, -balanceForecastTrailingDays), now)
+		if err != nil {
+			return failed(err)
+		}
+		forecast.DailyDiscretionary = discretionary.Unbound().Mul(1.0 / balanceForecastTrailingDays).Round(forecast.Currency)
+
+		items, err := db.GetScheduledFlows(account.ID, now, end)
+		if err != nil {
+			return failed(err)
+		}
+		recurring := db.GetRecurringTransactions(&user, now.AddDate(0, -forecastRecurringLookback, 0))
+		items = append(items, recurringForecastItems(recurring, account.ID, now, end)...)
+
+		bills := db.GetBills(&user)
+		ids := make([]uuid.UUID, 0, len(bills))
+		for _, bill := range bills {
+			ids = append(ids, bill.ID)
+		}
+		billsToday := calendarDate(now, location)
+		payments := db.GetBillPayments(ids, billsToday, billsToday.AddDate(0, 0, days))
+		items = append(items, billForecastItems(bills, payments, items, account.ID, billsToday, days, location)...)
+
+		cards, err := s.cardForecastItems(db, user, account, now, today, end, location)
+		if err != nil {
+			return failed(err)
+		}
+		items = append(items, cards...)
+
+		buildBalanceForecast(&forecast, items, today)
+		return forecast, nil
+	}, func(forecast types.BalanceForecast) any {
+		return forecast.Points
+	})
+}
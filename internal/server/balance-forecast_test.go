@@ -0,0 +1,84 @@
+package server
+
+import (
+	"FinMa/types"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestBuildBalanceForecast(t *testing.T) {
+	// A salary on the 25th and a rent on the 1st, on March 10
+	account := uuid.New()
+	date := func(month time.Month, day int) time.Time {
+		return time.Date(2024, month, day, 0, 0, 0, 0, time.UTC)
+	}
+	today := date(time.March, 10)
+	now := today.Add(9 * time.Hour)
+	recurring := []types.Transaction{
+		{Type: "income", Description: "ACME Salary", Amount: money(2500), Date: date(time.February, 25), BankAccountID: account},
+		{Type: "expense", Description: "Rent", Amount: money(900), Date: date(time.March, 1), BankAccountID: account},
+		// Already entered ahead of its date, among the scheduled flows
+		{Type: "expense", Description: "Gym", Amount: money(30), Date: date(time.February, 15), BankAccountID: account},
+		{Type: "expense", Description: "Gym", Amount: money(30), Date: date(time.March, 15), BankAccountID: account},
+		// Another account
+		{Type: "expense", Description: "Insurance", Amount: money(60), Date: date(time.March, 2), BankAccountID: uuid.New()},
+	}
+
+	items := recurringForecastItems(recurring, account, now, today.AddDate(0, 0, 31))
+	if len(items) != 2 || items[0].Amount != money(2500) || !items[0].Date.Equal(date(time.March, 25)) || items[1].Amount != money(-900) || !items[1].Date.Equal(date(time.April, 1)) {
+		t.Fatalf("expected the salary and the rent; got %+v", items)
+	}
+	items = append(items, types.ForecastItem{Date: date(time.March, 15), Description: "Gym", Amount: money(-30), Source: "scheduled"})
+
+	forecast := types.BalanceForecast{Days: 30, StartingBalance: money(200), Floor: new(types.Money), DailyDiscretionary: money(20)}
+	buildBalanceForecast(&forecast, items, today)
+
+	if len(forecast.Points) != 31 {
+		t.Fatalf("expected a point per day; got %d", len(forecast.Points))
+	}
+	for day, expected := range map[int][2]float64{
+		0:  {200, 200},
+		5:  {170, 70},    // The gym
+		9:  {170, -10},   // 9 days of discretionary spending
+		15: {2670, 2370}, // The salary
+		22: {1770, 1330}, // The rent
+		30: {1770, 1170},
+	} {
+		point := forecast.Points[day]
+		if point.Committed != money(expected[0]) || point.Estimated != money(expected[1]) {
+			t.Errorf("expected %v on day %d; got %+v", expected, day, point)
+		}
+	}
+	if forecast.FirstNegativeCommitted != nil {
+		t.Errorf("expected the committed balance to stay positive; got %v", forecast.FirstNegativeCommitted)
+	}
+	if first := forecast.FirstNegativeEstimated; first == nil || !first.Equal(date(time.March, 19)) {
+		t.Errorf("expected the estimated balance negative on March 19; got %v", first)
+	}
+}
+
+func TestBillForecastItems(t *testing.T) {
+	account := uuid.New()
+	today := time.Date(2024, time.March, 10, 0, 0, 0, 0, time.UTC)
+	bills := []types.Bill{
+		{ID: uuid.New(), Name: "Rent", Merchant: "rent", Amount: money(900), DueDay: 1, Tolerance: 5, BankAccountID: &account},
+		{ID: uuid.New(), Name: "Internet", Merchant: "fiber", Amount: money(40), DueDay: 20, Tolerance: 5, BankAccountID: &account},
+		{ID: uuid.New(), Name: "Phone", Merchant: "phone", Amount: money(15), DueDay: 12, Tolerance: 5},
+	}
+	paid := time.Date(2024, time.March, 9, 0, 0, 0, 0, time.UTC)
+	payments := []types.BillPayment{{BillID: bills[1].ID, DueDate: time.Date(2024, time.March, 20, 0, 0, 0, 0, time.UTC), PaidAt: &paid}}
+	// The recurring rent pays the bill of April
+	committed := []types.ForecastItem{{Date: time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC), Description: "Rent", Amount: money(-900)}}
+
+	items := billForecastItems(bills, payments, committed, account, today, 30, time.UTC)
+	if len(items) != 0 {
+		t.Errorf("expected the rent paid by the recurring one, the internet paid and the phone from no account; got %+v", items)
+	}
+
+	items = billForecastItems(bills, nil, committed, account, today, 30, time.UTC)
+	if len(items) != 1 || items[0].Description != "Internet" || items[0].Amount != money(-40) {
+		t.Errorf("expected the internet bill; got %+v", items)
+	}
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"FinMa/types"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// bucketStart returns the first day of the day, week (starting on Monday) or
+// month containing the date.
+func bucketStart(date time.Time, granularity string) time.Time {
+	switch granularity {
+	case "week":
+		offset := (int(date.Weekday()) + 6) % 7
+		return date.AddDate(0, 0, -offset)
+	case "month":
+		return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return date
+	}
+}
+
+// fillBalanceHistory turns sparse daily snapshots into one point per day, week
+// or month between from and to. Days without a snapshot carry the balance of
+// the previous one, days before the first snapshot use the initial balance.
+// Week and month points hold the balance at the end of the period, or at to
+// for the last one.
+func fillBalanceHistory(initialBalance types.Money, snapshots []types.BalanceSnapshot, from, to time.Time, granularity string) []types.BalancePoint {
+	points := []types.BalancePoint{}
+	day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	last := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+
+	balance := initialBalance
+	next := 0
+
+	for ; !day.After(last); day = day.AddDate(0, 0, 1) {
+		for next < len(snapshots) && !snapshots[next].Date.UTC().After(day) {
+			balance = snapshots[next].Balance
+			next++
+		}
+
+		tomorrow := day.AddDate(0, 0, 1)
+		if tomorrow.After(last) || !bucketStart(tomorrow, granularity).Equal(bucketStart(day, granularity)) {
+			points = append(points, types.BalancePoint{
+				Date:    bucketStart(day, granularity),
+				Balance: balance,
+			})
+		}
+	}
+
+	return points
+}
+
+// GetBalanceHistory returns the balance of an account over time, read from
+// the daily snapshots: ?from= and ?to= (RFC3339, the last 90 days by default)
+// and ?granularity=day|week|month.
+func (s *FiberServer) GetBalanceHistory(c *fiber.Ctx) error {
+	from, to, err := parseReportRange(c)
+	if err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, err.Error())
+	}
+
+	granularity := c.Query("granularity", "day")
+	if granularity != "day" && granularity != "week" && granularity != "month" {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid granularity")
+	}
+
+	user := c.Locals("user").(types.User)
+	account, ok := s.findUserBankAccount(user, c.Params("id"), "viewer")
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Bank account not found")
+	}
+
+	snapshots, err := s.db.GetBalanceSnapshots(account.ID, from, to)
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not fetch balance history")
+	}
+
+	return c.JSON(fillBalanceHistory(account.InitialBalance, snapshots, from.UTC(), to.UTC(), granularity))
+}
+
+// BackfillBalanceSnapshots rebuilds the balance snapshots of an account from
+// its whole transaction history. Admin only.
+func (s *FiberServer) BackfillBalanceSnapshots(c *fiber.Ctx) error {
+	account := s.db.GetBankAccountByID(c.Params("id"))
+	if account.ID == uuid.Nil {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Bank account not found")
+	}
+
+	count, err := s.db.BackfillBalanceSnapshots(account.ID)
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not backfill balance snapshots")
+	}
+
+	return c.JSON(fiber.Map{
+		"account_id": account.ID,
+		"snapshots":  count,
+	})
+}
+
+// StartBalanceSnapshots periodically snapshots the balance of every active
+// account for yesterday and today. Today's snapshot is refreshed by the next run.
+func (s *FiberServer) StartBalanceSnapshots(interval time.Duration) {
+	s.every("balance_snapshots", interval, func(now time.Time) error {
+		_, err := s.db.SnapshotBalances(nil, now.AddDate(0, 0, -1), now)
+		if err != nil {
+			log.Error("Error snapshotting balances: ", err)
+		}
+		return err
+	})
+}
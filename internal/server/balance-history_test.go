@@ -0,0 +1,67 @@
+package server
+
+import (
+	"FinMa/types"
+	"testing"
+	"time"
+)
+
+func day(year int, m time.Month, d int) time.Time {
+	return time.Date(year, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestFillBalanceHistory(t *testing.T) {
+	snapshots := []types.BalanceSnapshot{
+		// Snapshot before the range, it seeds the first days
+		{Date: day(2024, time.January, 28), Balance: money(100)},
+		{Date: day(2024, time.February, 1), Balance: money(150)},
+		{Date: day(2024, time.February, 4), Balance: money(120)},
+	}
+
+	points := fillBalanceHistory(money(0), snapshots, day(2024, time.January, 30), day(2024, time.February, 5), "day")
+	expected := []float64{100, 100, 150, 150, 150, 120, 120}
+
+	if len(points) != len(expected) {
+		t.Fatalf("expected %d points; got %d", len(expected), len(points))
+	}
+	for i, point := range points {
+		if point.Balance != money(expected[i]) {
+			t.Errorf("expected balance %v on %v; got %v", expected[i], point.Date.Format("2006-01-02"), point.Balance)
+		}
+	}
+}
+
+func TestFillBalanceHistoryGranularity(t *testing.T) {
+	snapshots := []types.BalanceSnapshot{
+		{Date: day(2024, time.January, 10), Balance: money(100)},
+		{Date: day(2024, time.February, 20), Balance: money(300)},
+	}
+
+	// Days before the first snapshot use the initial balance
+	months := fillBalanceHistory(money(50), snapshots, day(2023, time.December, 15), day(2024, time.February, 10), "month")
+	expectedMonths := []types.BalancePoint{
+		{Date: day(2023, time.December, 1), Balance: money(50)},
+		{Date: day(2024, time.January, 1), Balance: money(100)},
+		{Date: day(2024, time.February, 1), Balance: money(100)},
+	}
+	if len(months) != len(expectedMonths) {
+		t.Fatalf("expected %d monthly points; got %d", len(expectedMonths), len(months))
+	}
+	for i := range months {
+		if !months[i].Date.Equal(expectedMonths[i].Date) || months[i].Balance != expectedMonths[i].Balance {
+			t.Errorf("expected %v; got %v", expectedMonths[i], months[i])
+		}
+	}
+
+	// 2024-02-19 is a Monday, the first week is cut by the range start
+	weeks := fillBalanceHistory(money(0), snapshots, day(2024, time.February, 14), day(2024, time.February, 21), "week")
+	if len(weeks) != 2 {
+		t.Fatalf("expected 2 weekly points; got %d", len(weeks))
+	}
+	if !weeks[0].Date.Equal(day(2024, time.February, 12)) || weeks[0].Balance != money(100) {
+		t.Errorf("unexpected first week %v", weeks[0])
+	}
+	if !weeks[1].Date.Equal(day(2024, time.February, 19)) || weeks[1].Balance != money(300) {
+		t.Errorf("unexpected second week %v", weeks[1])
+	}
+}
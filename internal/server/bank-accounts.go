@@ -1,11 +1,523 @@
 package server
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"FinMa/constants"
+	"FinMa/internal/fx"
+	"FinMa/internal/logging"
+	"FinMa/types"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 
-func (s *FiberServer) CreateBankAccount(c *fiber.Ctx) error {
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+func isValidAccountType(accountType string) bool {
+	for _, t := range constants.GetAccountTypes() {
+		if t == accountType {
+			return true
+		}
+	}
+	return false
+}
+
+// isLiability reports whether the account holds money owed, like a credit card or a loan.
+func isLiability(accountType string) bool {
+	for _, t := range constants.GetLiabilityAccountTypes() {
+		if t == accountType {
+			return true
+		}
+	}
+	return false
+}
+
+// accountClass returns "liability" for credit cards and loans, "asset" otherwise.
+func accountClass(accountType string) string {
+	if isLiability(accountType) {
+		return "liability"
+	}
+	return "asset"
+}
+
+// availableBalance returns the money that can still be spent from the account.
+// Liability accounts carry a negative balance while money is owed, what is
+// available is what remains of their credit limit.
+func availableBalance(account types.BankAccount) (types.Money, error) {
+	if isLiability(account.AccountType) {
+		return account.CreditLimit.Add(account.Balance)
+	}
+	return account.Balance, nil
+}
+
+// isBeforeOpening reports whether the date is before the opening date of the account.
+func isBeforeOpening(account types.BankAccount, date time.Time) bool {
+	return account.OpeningDate != nil && date.Before(*account.OpeningDate)
+}
+
+// validateStatementCycle checks the statement cycle settings, which only
+// apply to credit cards. Days are between 1 and 31, 0 disables the cycle.
+func validateStatementCycle(accountType string, statementDay, paymentDueDay, dueReminderDays int) error {
+	if statementDay < 0 || statementDay > 31 || paymentDueDay < 0 || paymentDueDay > 31 {
+		return errors.New("statement and payment due days must be between 1 and 31")
+	}
+	if dueReminderDays < 0 {
+		return errors.New("due reminder days must not be negative")
+	}
+	if accountType != "credit_card" && (statementDay != 0 || paymentDueDay != 0) {
+		return errors.New("statement cycles are only available on credit cards")
+	}
 	return nil
 }
 
+// parseOpeningDate parses an optional RFC3339 opening date.
+func parseOpeningDate(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	openingDate, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &openingDate, nil
+}
+
+// CreateBankAccount creates a bank account for the authenticated user.
+// The balance starts at the initial balance and is maintained from the
+// account transactions. The currency of the account, the currency of the
+// instance by default, cannot be changed afterwards: the amounts are
+// stored in it.
+func (s *FiberServer) CreateBankAccount(c *fiber.Ctx) error {
+	type CreateBankAccountRequest struct {
+		BankName       string      `json:"bank_name" validate:"required"`
+		AccountType    string      `json:"account_type" validate:"required"`
+		AccountNumber  string      `json:"account_number" validate:"required"`
+		CreditLimit    types.Money `json:"credit_limit"`
+		InitialBalance types.Money `json:"initial_balance"`
+		OpeningDate    string      `json:"opening_date"`
+		StatementDay   int         `json:"statement_day"`
+		PaymentDueDay  int         `json:"payment_due_day"`
+		Compounding    string      `json:"compounding_frequency"` // Savings accounts, defaults to "monthly"
+		Currency       string      `json:"currency"`              // ISO 4217 code, defaults to the currency of the instance
+	}
+
+	var body CreateBankAccountRequest
+	if err := c.BodyParser(&body); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+
+	if err := validate.Struct(body); err != nil {
+		return err
+	}
+
+	if !isValidAccountType(body.AccountType) {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid account type")
+	}
+
+	if body.CreditLimit.Sign() < 0 {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Credit limit must not be negative")
+	}
+
+	if err := validateStatementCycle(body.AccountType, body.StatementDay, body.PaymentDueDay, 0); err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, err.Error())
+	}
+
+	if body.Compounding != "" && !isValidCompoundingFrequency(body.Compounding) {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid compounding frequency")
+	}
+
+	openingDate, err := parseOpeningDate(body.OpeningDate)
+	if err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid opening date format")
+	}
+
+	currency := strings.ToUpper(body.Currency)
+	if currency == "" {
+		currency = s.config.Features.Currency
+	}
+	if !fx.IsCurrencyCode(currency) {
+		return NewAPIError(fiber.StatusUnprocessableEntity, CodeValidationFailed, "Invalid currency").
+			WithDetails(FieldError{Field: "currency", Message: "Must be an ISO 4217 code", Value: body.Currency})
+	}
+
+	user := c.Locals("user").(types.User)
+	if err := s.checkLimit(c, user, limitAccounts, 1); err != nil {
+		return err
+	}
+
+	account := &types.BankAccount{Currency: currency}
+	if err := s.checkAccountAmount("credit_limit", body.CreditLimit, *account); err != nil {
+		return err
+	}
+	if err := s.checkAccountAmount("initial_balance", body.InitialBalance, *account); err != nil {
+		return err
+	}
+
+	account = &types.BankAccount{
+		ID:                   uuid.New(),
+		BankName:             body.BankName,
+		AccountType:          body.AccountType,
+		AccountNumber:        body.AccountNumber,
+		Balance:              body.InitialBalance,
+		Currency:             currency,
+		CreditLimit:          body.CreditLimit,
+		InitialBalance:       body.InitialBalance,
+		OpeningDate:          openingDate,
+		StatementDay:         body.StatementDay,
+		PaymentDueDay:        body.PaymentDueDay,
+		CompoundingFrequency: body.Compounding,
+		Class:                accountClass(body.AccountType),
+		UserID:               user.ID,
+	}
+
+	if err := s.db.CreateBankAccount(account); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not create bank account")
+	}
+	s.audit(user.ID, "account.created", "bank_account", account.ID, account.BankName)
+
+	return c.Status(fiber.StatusCreated).JSON(account)
+}
+
 func (s *FiberServer) RegisterExistingBankAccount(c *fiber.Ctx) error {
 	return nil
 }
+
+// GetBankAccounts lists the bank accounts of the authenticated user with their
+// balance, favorites first, then in the order set by the user.
+// Archived accounts are only listed with ?include_archived=true.
+func (s *FiberServer) GetBankAccounts(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+
+	class := c.Query("class")
+	if class != "" && class != "asset" && class != "liability" {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid account class")
+	}
+	sel, err := bankAccountResource.selection(c)
+	if err != nil {
+		return err
+	}
+
+	token, err := s.db.BankAccountsChangeToken(&user)
+	if err != nil {
+		return err
+	}
+	if notModified(c, token) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	accounts := s.db.GetBankAccounts(&user, c.QueryBool("include_archived"))
+
+	filtered := []types.BankAccount{}
+	for _, account := range accounts {
+		account.Class = accountClass(account.AccountType)
+		if class == "" || account.Class == class {
+			filtered = append(filtered, account)
+		}
+	}
+
+	shaped, err := bankAccountResource.list(s, c, sel, filtered)
+	if err != nil {
+		return err
+	}
+	return c.JSON(shaped)
+}
+
+// UpdateBankAccount partially updates an account. Changing the type or the
+// initial balance of an account is allowed and recorded in the audit log, a
+// new initial balance recomputes the account balance.
+func (s *FiberServer) UpdateBankAccount(c *fiber.Ctx) error {
+	type UpdateBankAccountRequest struct {
+		BankName             *string         `json:"bank_name"`
+		AccountType          *string         `json:"account_type"`
+		CreditLimit          *types.Money    `json:"credit_limit"`
+		InitialBalance       *types.Money    `json:"initial_balance"`
+		OpeningDate          *string         `json:"opening_date"` // An empty string clears the opening date
+		StatementDay         *int            `json:"statement_day"`
+		PaymentDueDay        *int            `json:"payment_due_day"`
+		DueReminderDays      *int            `json:"due_reminder_days"`
+		CompoundingFrequency *string         `json:"compounding_frequency"`
+		Color                *string         `json:"color"`
+		IsFavorite           *bool           `json:"is_favorite"`
+		LowBalanceThreshold  json.RawMessage `json:"low_balance_threshold"` // A number, or null to remove the threshold
+	}
+
+	var body UpdateBankAccountRequest
+	if err := c.BodyParser(&body); err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+
+	user := c.Locals("user").(types.User)
+	account, ok := s.findUserBankAccount(user, c.Params("id"), "owner")
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Bank account not found")
+	}
+
+	previousType := account.AccountType
+	previousInitialBalance := account.InitialBalance
+
+	if body.BankName != nil {
+		account.BankName = *body.BankName
+	}
+	if body.AccountType != nil {
+		if !isValidAccountType(*body.AccountType) {
+			return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid account type")
+		}
+		account.AccountType = *body.AccountType
+	}
+	if body.CreditLimit != nil {
+		if body.CreditLimit.Sign() < 0 {
+			return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Credit limit must not be negative")
+		}
+		if err := s.checkAccountAmount("credit_limit", *body.CreditLimit, account); err != nil {
+			return err
+		}
+		account.CreditLimit = *body.CreditLimit
+	}
+	if body.InitialBalance != nil {
+		if err := s.checkAccountAmount("initial_balance", *body.InitialBalance, account); err != nil {
+			return err
+		}
+		account.InitialBalance = *body.InitialBalance
+	}
+	if body.OpeningDate != nil {
+		openingDate, err := parseOpeningDate(*body.OpeningDate)
+		if err != nil {
+			return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid opening date format")
+		}
+		account.OpeningDate = openingDate
+	}
+	if body.StatementDay != nil {
+		account.StatementDay = *body.StatementDay
+	}
+	if body.PaymentDueDay != nil {
+		account.PaymentDueDay = *body.PaymentDueDay
+	}
+	if body.DueReminderDays != nil {
+		account.DueReminderDays = *body.DueReminderDays
+	}
+	if body.LowBalanceThreshold != nil {
+		threshold, err := parseLowBalanceThreshold(body.LowBalanceThreshold)
+		if err != nil {
+			return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, err.Error())
+		}
+		if threshold != nil {
+			if err := s.checkAccountAmount("low_balance_threshold", *threshold, account); err != nil {
+				return err
+			}
+		}
+		account.LowBalanceThreshold = threshold
+	}
+	if body.CompoundingFrequency != nil {
+		if !isValidCompoundingFrequency(*body.CompoundingFrequency) {
+			return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid compounding frequency")
+		}
+		account.CompoundingFrequency = *body.CompoundingFrequency
+	}
+	if body.Color != nil {
+		if *body.Color != "" && validate.Var(*body.Color, "hexcolor") != nil {
+			return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid color")
+		}
+		account.Color = *body.Color
+	}
+	if body.IsFavorite != nil {
+		account.IsFavorite = *body.IsFavorite
+	}
+	if err := validateStatementCycle(account.AccountType, account.StatementDay, account.PaymentDueDay, account.DueReminderDays); err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, err.Error())
+	}
+
+	if err := s.db.UpdateBankAccount(&account); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not update bank account")
+	}
+
+	if account.AccountType != previousType {
+		s.audit(user.ID, "account.type_changed", "bank_account", account.ID,
+			fmt.Sprintf("account type changed from %s to %s", previousType, account.AccountType))
+	}
+
+	if account.InitialBalance != previousInitialBalance {
+		drift, err := s.db.RecomputeBalance(account.ID)
+		if err != nil {
+			log.Error(err)
+			return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not recompute balance")
+		}
+		account.Balance = drift.Computed
+
+		s.audit(user.ID, "account.initial_balance_changed", "bank_account", account.ID,
+			fmt.Sprintf("initial balance changed from %s to %s", previousInitialBalance, account.InitialBalance))
+	}
+
+	account.Class = accountClass(account.AccountType)
+	return c.JSON(account)
+}
+
+// ReorderBankAccounts rewrites the order of the accounts of the user. The
+// body lists the IDs of every active account the user owns, in the new order.
+func (s *FiberServer) ReorderBankAccounts(c *fiber.Ctx) error {
+	type ReorderBankAccountsRequest struct {
+		AccountIDs []uuid.UUID `json:"account_ids"`
+	}
+
+	var body ReorderBankAccountsRequest
+	if err := c.BodyParser(&body); err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+
+	user := c.Locals("user").(types.User)
+	owned := map[uuid.UUID]bool{}
+	for _, account := range s.db.GetBankAccounts(&user, false) {
+		if account.UserID == user.ID {
+			owned[account.ID] = true
+		}
+	}
+
+	seen := map[uuid.UUID]bool{}
+	for _, id := range body.AccountIDs {
+		if !owned[id] || seen[id] {
+			return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "The order must list each of your accounts exactly once")
+		}
+		seen[id] = true
+	}
+	if len(seen) != len(owned) {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "The order must list each of your accounts exactly once")
+	}
+
+	if err := s.db.ReorderBankAccounts(user.ID, body.AccountIDs); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not reorder bank accounts")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// findUserBankAccount returns the bank account with the given ID if the user
+// has at least the given role on it ("owner", "editor" or "viewer").
+func (s *FiberServer) findUserBankAccount(user types.User, id string, role string) (types.BankAccount, bool) {
+	account := s.db.GetBankAccountByID(id)
+	if account.ID == uuid.Nil || !hasAccountRole(s.accountRole(user, account), role) {
+		return types.BankAccount{}, false
+	}
+	return account, true
+}
+
+// GetBankAccountBalance returns the current balance of an account.
+func (s *FiberServer) GetBankAccountBalance(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	account, ok := s.findUserBankAccount(user, c.Params("id"), "viewer")
+
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Bank account not found")
+	}
+
+	available, err := availableBalance(account)
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not compute the available balance")
+	}
+
+	return c.JSON(fiber.Map{
+		"account_id":   account.ID,
+		"balance":      account.Balance,
+		"available":    available,
+		"credit_limit": account.CreditLimit,
+		"class":        accountClass(account.AccountType),
+	})
+}
+
+// ArchiveBankAccount archives an account: its history is kept but it is
+// hidden from the default accounts list and refuses new transactions.
+// The optional keep_in_net_worth body field keeps its balance in the net worth.
+func (s *FiberServer) ArchiveBankAccount(c *fiber.Ctx) error {
+	var body struct {
+		KeepInNetWorth bool `json:"keep_in_net_worth"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+		}
+	}
+
+	return s.setBankAccountArchived(c, true, body.KeepInNetWorth)
+}
+
+// UnarchiveBankAccount restores an archived account.
+func (s *FiberServer) UnarchiveBankAccount(c *fiber.Ctx) error {
+	return s.setBankAccountArchived(c, false, false)
+}
+
+func (s *FiberServer) setBankAccountArchived(c *fiber.Ctx, archived bool, keepInNetWorth bool) error {
+	user := c.Locals("user").(types.User)
+	account, ok := s.findUserBankAccount(user, c.Params("id"), "owner")
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Bank account not found")
+	}
+
+	if err := s.db.SetBankAccountArchived(&account, archived, keepInNetWorth); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not update bank account")
+	}
+
+	return c.JSON(account)
+}
+
+// RecomputeBankAccountBalance recalculates the balance of any account from
+// its transactions and repairs it. Admin only.
+func (s *FiberServer) RecomputeBankAccountBalance(c *fiber.Ctx) error {
+	account := s.db.GetBankAccountByID(c.Params("id"))
+
+	if account.ID == uuid.Nil {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Bank account not found")
+	}
+
+	drift, err := s.db.RecomputeBalance(account.ID)
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not recompute balance")
+	}
+
+	if drift.Stored != drift.Computed {
+		log.Warnf("Repaired balance drift on account %s: stored %s, computed %s", account.ID, logging.Amount(drift.Stored), logging.Amount(drift.Computed))
+	}
+
+	return c.JSON(drift)
+}
+
+// balanceCheckJob is the name of the job repairing the balances.
+const balanceCheckJob = "balance_check"
+
+// StartBalanceCheck periodically compares the stored balances with the sum
+// of the transactions and repairs the accounts that drifted.
+func (s *FiberServer) StartBalanceCheck(interval time.Duration) {
+	s.every(balanceCheckJob, interval, func(time.Time) error {
+		_, err := s.checkBalances()
+		return err
+	})
+}
+
+// checkBalances repairs the accounts whose balance drifted and returns
+// their drifts. The first repair failing is returned, the others are tried.
+func (s *FiberServer) checkBalances() ([]types.BalanceDrift, error) {
+	drifts, err := s.db.GetBalanceDrifts()
+	if err != nil {
+		log.Error("Error checking balances: ", err)
+		return nil, err
+	}
+
+	var repairErr error
+	for _, drift := range drifts {
+		log.Warnf("Balance drift on account %s: stored %s, computed %s", drift.AccountID, logging.Amount(drift.Stored), logging.Amount(drift.Computed))
+		if _, err := s.db.RecomputeBalance(drift.AccountID); err != nil {
+			log.Error("Error repairing balance: ", err)
+			if repairErr == nil {
+				repairErr = err
+			}
+		}
+	}
+	return drifts, repairErr
+}
@@ -0,0 +1,299 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/internal/database"
+	"FinMa/types"
+)
+
+// bankAccountsDB stores the bank accounts of the users and the members of
+// the shared ones.
+type bankAccountsDB struct {
+	*adminDB
+	accounts map[uuid.UUID]types.BankAccount
+	members  map[uuid.UUID]types.AccountMember
+}
+
+func (db *bankAccountsDB) GetBankAccountByID(id string) types.BankAccount {
+	return db.accounts[uuid.MustParse(id)]
+}
+
+func (db *bankAccountsDB) GetAccountMembership(accountID, userID uuid.UUID) types.AccountMember {
+	if member := db.members[userID]; member.BankAccountID == accountID {
+		return member
+	}
+	return types.AccountMember{}
+}
+
+func (db *bankAccountsDB) BankAccountsChangeToken(user *types.User) (string, error) {
+	return "", nil
+}
+
+func (db *bankAccountsDB) GetBankAccounts(user *types.User, includeArchived bool) []types.BankAccount {
+	accounts := []types.BankAccount{}
+	for _, account := range db.accounts {
+		if account.UserID == user.ID && (includeArchived || account.ArchivedAt == nil) {
+			accounts = append(accounts, account)
+		}
+	}
+	return accounts
+}
+
+func (db *bankAccountsDB) SetBankAccountArchived(account *types.BankAccount, archived bool, keepInNetWorth bool) error {
+	account.ArchivedAt, account.KeepInNetWorth = nil, false
+	if archived {
+		now := time.Now()
+		account.ArchivedAt, account.KeepInNetWorth = &now, keepInNetWorth
+	}
+	db.accounts[account.ID] = *account
+	return nil
+}
+
+func TestArchiveBankAccount(t *testing.T) {
+	s, admin, _, user := newAdminTestServer(t)
+	checking := types.BankAccount{ID: uuid.New(), BankName: "Checking", AccountType: "checking", UserID: user.ID}
+	closed := types.BankAccount{ID: uuid.New(), BankName: "Old savings", AccountType: "savings", UserID: user.ID}
+	db := &bankAccountsDB{adminDB: admin, accounts: map[uuid.UUID]types.BankAccount{checking.ID: checking, closed.ID: closed}}
+	s.db = db
+
+	resp := adminRequest(t, s, user, "POST", "/api/v1/accounts/"+closed.ID.String()+"/archive", `{"keep_in_net_worth":true}`)
+	var archived types.BankAccount
+	json.NewDecoder(resp.Body).Decode(&archived)
+	if resp.StatusCode != fiber.StatusOK || archived.ArchivedAt == nil || !archived.KeepInNetWorth {
+		t.Fatalf("expected the account archived; got %d %+v", resp.StatusCode, archived)
+	}
+
+	list := func(path string) []types.BankAccount {
+		var accounts []types.BankAccount
+		json.NewDecoder(adminRequest(t, s, user, "GET", path, "").Body).Decode(&accounts)
+		return accounts
+	}
+	if accounts := list("/api/v1/accounts"); len(accounts) != 1 || accounts[0].ID != checking.ID {
+		t.Errorf("expected the archived account hidden; got %+v", accounts)
+	}
+	if accounts := list("/api/v1/accounts?include_archived=true"); len(accounts) != 2 {
+		t.Errorf("expected the archived account listed on demand; got %+v", accounts)
+	}
+
+	// An archived account refuses new transactions
+	resp = adminRequest(t, s, user, "POST", "/api/v1/transactions", `{"bank_account_id":"`+closed.ID.String()+
+		`","amount":-12,"type":"expense","category":"food","description":"Lunch","date":"2024-03-10T12:00:00Z"}`)
+	var body errorBody
+	json.NewDecoder(resp.Body).Decode(&body)
+	if resp.StatusCode != fiber.StatusConflict || body.Error.Code != CodeAccountArchived {
+		t.Errorf("expected a transaction on an archived account refused; got %d %+v", resp.StatusCode, body)
+	}
+
+	resp = adminRequest(t, s, user, "POST", "/api/v1/accounts/"+closed.ID.String()+"/unarchive", "")
+	if resp.StatusCode != fiber.StatusOK || db.accounts[closed.ID].ArchivedAt != nil || db.accounts[closed.ID].KeepInNetWorth {
+		t.Errorf("expected the account restored; got %d %+v", resp.StatusCode, db.accounts[closed.ID])
+	}
+	if resp := adminRequest(t, s, user, "POST", "/api/v1/accounts/"+uuid.NewString()+"/archive", ""); resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("expected an unknown account not found; got %d", resp.StatusCode)
+	}
+}
+
+func (db *bankAccountsDB) CreateBankAccount(account *types.BankAccount) error {
+	db.accounts[account.ID] = *account
+	return nil
+}
+
+func (db *bankAccountsDB) UpdateBankAccount(account *types.BankAccount) error {
+	db.accounts[account.ID] = *account
+	return nil
+}
+
+func TestBankAccountTypes(t *testing.T) {
+	s, admin, _, user := newAdminTestServer(t)
+	db := &bankAccountsDB{adminDB: admin, accounts: map[uuid.UUID]types.BankAccount{}}
+	s.db = db
+
+	resp := adminRequest(t, s, user, "POST", "/api/v1/accounts", `{"bank_name":"Bank","account_type":"crypto","account_number":"FR76"}`)
+	var body errorBody
+	json.NewDecoder(resp.Body).Decode(&body)
+	if resp.StatusCode != fiber.StatusBadRequest || body.Error.Code != CodeInvalidRequest {
+		t.Fatalf("expected an unknown account type refused; got %d %+v", resp.StatusCode, body)
+	}
+
+	resp = adminRequest(t, s, user, "POST", "/api/v1/accounts", `{"bank_name":"Visa","account_type":"credit_card","account_number":"4970","credit_limit":"1500","initial_balance":"-200"}`)
+	var card types.BankAccount
+	json.NewDecoder(resp.Body).Decode(&card)
+	if resp.StatusCode != fiber.StatusCreated || card.Class != "liability" {
+		t.Fatalf("expected a liability account created; got %d %+v", resp.StatusCode, card)
+	}
+
+	// What is available on a credit card is what remains of its limit
+	var balance struct {
+		Available types.Money `json:"available"`
+		Class     string      `json:"class"`
+	}
+	json.NewDecoder(adminRequest(t, s, user, "GET", "/api/v1/accounts/"+card.ID.String()+"/balance", "").Body).Decode(&balance)
+	if balance.Available != money(1300) || balance.Class != "liability" {
+		t.Errorf("expected 1300 available on the card; got %+v", balance)
+	}
+
+	resp = adminRequest(t, s, user, "PATCH", "/api/v1/accounts/"+card.ID.String(), `{"account_type":"loan"}`)
+	var updated types.BankAccount
+	json.NewDecoder(resp.Body).Decode(&updated)
+	if resp.StatusCode != fiber.StatusOK || updated.AccountType != "loan" || updated.Class != "liability" {
+		t.Fatalf("expected the type changed; got %d %+v", resp.StatusCode, updated)
+	}
+	var changed []types.AuditLog
+	for _, entry := range admin.audits {
+		if entry.Action == "account.type_changed" {
+			changed = append(changed, entry)
+		}
+	}
+	if len(changed) != 1 || changed[0].EntityID != card.ID || changed[0].Details != "account type changed from credit_card to loan" {
+		t.Errorf("expected the type change audited; got %+v", admin.audits)
+	}
+	if resp := adminRequest(t, s, user, "PATCH", "/api/v1/accounts/"+card.ID.String(), `{"account_type":"crypto"}`); resp.StatusCode != fiber.StatusBadRequest || db.accounts[card.ID].AccountType != "loan" {
+		t.Errorf("expected an unknown account type refused; got %d", resp.StatusCode)
+	}
+}
+
+func (db *bankAccountsDB) ReorderBankAccounts(userID uuid.UUID, accountIDs []uuid.UUID) error {
+	for i, id := range accountIDs {
+		account := db.accounts[id]
+		account.SortOrder = i
+		db.accounts[id] = account
+	}
+	return nil
+}
+
+func TestReorderBankAccounts(t *testing.T) {
+	s, admin, _, user := newAdminTestServer(t)
+	checking := types.BankAccount{ID: uuid.New(), BankName: "Checking", UserID: user.ID, SortOrder: 0}
+	savings := types.BankAccount{ID: uuid.New(), BankName: "Savings", UserID: user.ID, SortOrder: 1}
+	cash := types.BankAccount{ID: uuid.New(), BankName: "Cash", UserID: user.ID, SortOrder: 2}
+	foreign := types.BankAccount{ID: uuid.New(), BankName: "Someone else's", UserID: uuid.New()}
+	db := &bankAccountsDB{adminDB: admin, accounts: map[uuid.UUID]types.BankAccount{
+		checking.ID: checking, savings.ID: savings, cash.ID: cash, foreign.ID: foreign}}
+	s.db = db
+
+	order := func(ids ...uuid.UUID) string {
+		body, _ := json.Marshal(map[string][]uuid.UUID{"account_ids": ids})
+		return string(body)
+	}
+	for name, body := range map[string]string{
+		"missing account":   order(cash.ID, checking.ID),
+		"duplicate account": order(cash.ID, checking.ID, checking.ID),
+		"foreign account":   order(cash.ID, checking.ID, savings.ID, foreign.ID),
+	} {
+		resp := adminRequest(t, s, user, "PUT", "/api/v1/accounts/order", body)
+		var errBody errorBody
+		json.NewDecoder(resp.Body).Decode(&errBody)
+		if resp.StatusCode != fiber.StatusBadRequest || errBody.Error.Code != CodeInvalidRequest {
+			t.Errorf("%s: expected the order refused; got %d %+v", name, resp.StatusCode, errBody)
+		}
+	}
+	if db.accounts[checking.ID].SortOrder != 0 || db.accounts[cash.ID].SortOrder != 2 {
+		t.Fatalf("expected a refused order not applied; got %+v", db.accounts)
+	}
+
+	if resp := adminRequest(t, s, user, "PUT", "/api/v1/accounts/order", order(cash.ID, checking.ID, savings.ID)); resp.StatusCode != fiber.StatusNoContent {
+		t.Fatalf("expected the order applied; got %d", resp.StatusCode)
+	}
+	if db.accounts[cash.ID].SortOrder != 0 || db.accounts[checking.ID].SortOrder != 1 || db.accounts[savings.ID].SortOrder != 2 {
+		t.Errorf("expected the accounts reordered; got %+v", db.accounts)
+	}
+}
+
+// accountTransactionsDB lists the transactions of the accounts of a
+// bankAccountsDB and records the filter it was given.
+type accountTransactionsDB struct {
+	*bankAccountsDB
+	transactions []types.Transaction
+	filter       types.TransactionFilter
+}
+
+func (db *accountTransactionsDB) WithContext(context.Context) database.Service {
+	return db
+}
+
+func (db *accountTransactionsDB) matching(filter types.TransactionFilter) []types.Transaction {
+	db.filter = filter
+	transactions := []types.Transaction{}
+	for _, transaction := range db.transactions {
+		if transaction.BankAccountID == *filter.AccountID && (filter.From == nil || !transaction.Date.Before(*filter.From)) {
+			transactions = append(transactions, transaction)
+		}
+	}
+	return transactions
+}
+
+func (db *accountTransactionsDB) GetTransactions(user *types.User, filter types.TransactionFilter) []types.Transaction {
+	transactions := db.matching(filter)
+	return transactions[:min(filter.Limit, len(transactions))]
+}
+
+func (db *accountTransactionsDB) CountTransactions(user *types.User, filter types.TransactionFilter) (int64, error) {
+	return int64(len(db.matching(filter))), nil
+}
+
+func (db *accountTransactionsDB) GetPendingTotal(accountID uuid.UUID) (types.Money, error) {
+	return money(-40), nil
+}
+
+func TestGetAccountTransactions(t *testing.T) {
+	s, admin, _, user := newAdminTestServer(t)
+	partner := types.User{ID: uuid.New(), Email: "grace@example.com", Role: "user"}
+	stranger := types.User{ID: uuid.New(), Email: "linus@example.com", Role: "user"}
+	admin.users[partner.ID], admin.users[stranger.ID] = partner, stranger
+	checking := types.BankAccount{ID: uuid.New(), BankName: "Checking", Balance: money(860), UserID: user.ID}
+	savings := types.BankAccount{ID: uuid.New(), BankName: "Savings", UserID: user.ID}
+	march := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	db := &accountTransactionsDB{
+		bankAccountsDB: &bankAccountsDB{adminDB: admin, accounts: map[uuid.UUID]types.BankAccount{checking.ID: checking, savings.ID: savings},
+			members: map[uuid.UUID]types.AccountMember{partner.ID: {Role: "viewer", Status: "active", BankAccountID: checking.ID}}},
+		transactions: []types.Transaction{
+			{ID: uuid.New(), Amount: money(-20), Date: march.AddDate(0, 0, -3), BankAccountID: checking.ID},
+			{ID: uuid.New(), Amount: money(-30), Date: march.AddDate(0, 0, 4), BankAccountID: checking.ID},
+			{ID: uuid.New(), Amount: money(-50), Date: march.AddDate(0, 0, 9), BankAccountID: checking.ID},
+			{ID: uuid.New(), Amount: money(500), Date: march.AddDate(0, 0, 9), BankAccountID: savings.ID},
+		},
+	}
+	s.db = db
+	path := "/api/v1/accounts/" + checking.ID.String() + "/transactions"
+
+	var list struct {
+		Transactions []types.Transaction           `json:"transactions"`
+		Meta         types.AccountTransactionsMeta `json:"meta"`
+	}
+	resp := adminRequest(t, s, user, "GET", path+"?from=2024-03-01T00:00:00Z&limit=1&with_balance=true", "")
+	json.NewDecoder(resp.Body).Decode(&list)
+	if resp.StatusCode != fiber.StatusOK || len(list.Transactions) != 1 || list.Transactions[0].BankAccountID != checking.ID {
+		t.Fatalf("expected a page of the transactions of the account; got %d %+v", resp.StatusCode, list)
+	}
+	if list.Meta != (types.AccountTransactionsMeta{AccountID: checking.ID, Balance: money(860), PendingTotal: money(-40), TransactionCount: 2}) {
+		t.Errorf("expected the summary of the account in the range; got %+v", list.Meta)
+	}
+	if !db.filter.WithBalance || db.filter.Limit != 1 || db.filter.From == nil || !db.filter.From.Equal(march) {
+		t.Errorf("expected the filters of the transactions list; got %+v", db.filter)
+	}
+
+	// Members see the transactions of the shared account
+	if resp := adminRequest(t, s, partner, "GET", path, ""); resp.StatusCode != fiber.StatusOK {
+		t.Errorf("expected a member to list the transactions; got %d", resp.StatusCode)
+	}
+	for name, request := range map[string]struct {
+		as     types.User
+		path   string
+		status int
+	}{
+		"account of another user": {stranger, path, fiber.StatusNotFound},
+		"unshared account":        {partner, "/api/v1/accounts/" + savings.ID.String() + "/transactions", fiber.StatusNotFound},
+		"invalid date":            {user, path + "?from=2024-03-01", fiber.StatusBadRequest},
+	} {
+		if resp := adminRequest(t, s, request.as, "GET", request.path, ""); resp.StatusCode != request.status {
+			t.Errorf("%s: expected %d; got %d", name, request.status, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,355 @@
+package server
+
+import (
+	"FinMa/internal/banksync"
+	"FinMa/types"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// requireBankSync returns a 503 error when no bank sync provider is configured.
+func (s *FiberServer) requireBankSync(c *fiber.Ctx) error {
+	if s.bankSync == nil {
+		return NewAPIError(fiber.StatusServiceUnavailable, CodeUnavailable, "Bank sync is not configured")
+	}
+	return c.Next()
+}
+
+// GetInstitutions lists the banks available for ?country= (ISO 3166 code).
+func (s *FiberServer) GetInstitutions(c *fiber.Ctx) error {
+	country := c.Query("country")
+	if len(country) != 2 {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid country code")
+	}
+
+	institutions, err := s.bankSync.ListInstitutions(c.Context(), country)
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusBadGateway, CodeUpstreamError, "Could not list institutions")
+	}
+
+	return c.JSON(institutions)
+}
+
+// CreateBankConnection starts a consent flow with a bank. The response holds
+// the URL the user must visit to give access to their accounts.
+func (s *FiberServer) CreateBankConnection(c *fiber.Ctx) error {
+	type CreateBankConnectionRequest struct {
+		InstitutionID string `json:"institution_id" validate:"required"`
+		RedirectURL   string `json:"redirect_url" validate:"required,url"`
+	}
+
+	var body CreateBankConnectionRequest
+	if err := c.BodyParser(&body); err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+
+	if err := validate.Struct(body); err != nil {
+		return err
+	}
+
+	user := c.Locals("user").(types.User)
+	connection := types.BankConnection{
+		ID:            uuid.New(),
+		Provider:      s.bankSync.Name(),
+		InstitutionID: body.InstitutionID,
+		Status:        "pending",
+		UserID:        user.ID,
+	}
+
+	link, err := s.bankSync.CreateLink(c.Context(), body.InstitutionID, body.RedirectURL, connection.ID.String())
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusBadGateway, CodeUpstreamError, "Could not create bank link")
+	}
+
+	connection.Consent = link.ID
+	if err := s.db.CreateBankConnection(&connection); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not store bank link")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"connection": connection,
+		"link":       link.URL,
+	})
+}
+
+// GetBankConnections lists the bank connections of the user with their sync
+// status and the status of each attached account.
+func (s *FiberServer) GetBankConnections(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	return c.JSON(s.db.GetBankConnections(&user))
+}
+
+// findUserBankConnection returns the connection from the route params if it
+// belongs to the user, with its provider link ID.
+func (s *FiberServer) findUserBankConnection(c *fiber.Ctx) (types.BankConnection, string, bool) {
+	user := c.Locals("user").(types.User)
+	connection := s.db.GetBankConnectionByID(c.Params("id"))
+	if connection.ID == uuid.Nil || connection.UserID != user.ID {
+		return types.BankConnection{}, "", false
+	}
+
+	return connection, connection.Consent, true
+}
+
+// GetExternalAccounts lists the accounts the user gave access to through a connection.
+func (s *FiberServer) GetExternalAccounts(c *fiber.Ctx) error {
+	connection, linkID, ok := s.findUserBankConnection(c)
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Bank connection not found")
+	}
+
+	accounts, err := s.bankSync.FetchAccounts(c.Context(), linkID)
+	if errors.Is(err, banksync.ErrLinkExpired) {
+		connection.Status = "expired"
+		s.db.UpdateBankConnection(&connection)
+		return NewAPIError(fiber.StatusConflict, CodeBankLinkExpired, "Bank link expired, create a new connection")
+	}
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusBadGateway, CodeUpstreamError, "Could not fetch bank accounts")
+	}
+
+	if connection.Status == "pending" {
+		connection.Status = "linked"
+		if err := s.db.UpdateBankConnection(&connection); err != nil {
+			log.Error(err)
+		}
+	}
+
+	return c.JSON(accounts)
+}
+
+// AttachExternalAccount attaches an account of a connection to a local bank
+// account. Its transactions are imported by the next sync.
+func (s *FiberServer) AttachExternalAccount(c *fiber.Ctx) error {
+	type AttachExternalAccountRequest struct {
+		ExternalAccountID string    `json:"external_account_id" validate:"required"`
+		BankAccountID     uuid.UUID `json:"bank_account_id" validate:"required"`
+	}
+
+	var body AttachExternalAccountRequest
+	if err := c.BodyParser(&body); err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+
+	if err := validate.Struct(body); err != nil {
+		return err
+	}
+
+	connection, linkID, ok := s.findUserBankConnection(c)
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Bank connection not found")
+	}
+
+	user := c.Locals("user").(types.User)
+	account, ok := s.findUserBankAccount(user, body.BankAccountID.String(), "owner")
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Bank account not found")
+	}
+
+	externalAccounts, err := s.bankSync.FetchAccounts(c.Context(), linkID)
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusBadGateway, CodeUpstreamError, "Could not fetch bank accounts")
+	}
+
+	found := false
+	for _, externalAccount := range externalAccounts {
+		if externalAccount.ID == body.ExternalAccountID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "External account not found")
+	}
+
+	if err := s.db.AttachExternalAccount(&account, connection.ID, body.ExternalAccountID); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not attach account")
+	}
+
+	if connection.Status == "pending" {
+		connection.Status = "linked"
+		s.db.UpdateBankConnection(&connection)
+	}
+
+	return c.JSON(account)
+}
+
+// StartBankSync periodically imports the new transactions of the accounts
+// attached to a bank connection.
+func (s *FiberServer) StartBankSync(interval time.Duration) {
+	if s.bankSync == nil {
+		return
+	}
+
+	s.every("bank_sync", interval, func(time.Time) error {
+		for _, connection := range s.db.GetSyncableBankConnections() {
+			s.syncBankConnection(context.Background(), connection)
+		}
+		return nil
+	})
+}
+
+// BankSyncWebhook syncs the connection whose link the provider reports a
+// change of, verified by verifyWebhook. The reference of the event is the
+// one given when the link was created, the ID of the connection. The
+// connections that cannot be synced now are left to the bank sync job.
+func (s *FiberServer) BankSyncWebhook(c *fiber.Ctx) error {
+	var event struct {
+		ID        string `json:"id"`
+		Type      string `json:"type"`
+		Reference string `json:"reference"`
+	}
+	if err := json.Unmarshal(webhookBody(c), &event); err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid event")
+	}
+
+	id, err := uuid.Parse(event.Reference)
+	if err != nil {
+		return c.JSON(fiber.Map{"received": true})
+	}
+	connection := s.db.GetBankConnectionByID(id.String())
+	syncable := connection.Status != "pending" && connection.Status != "expired" &&
+		(connection.RetryAfter == nil || connection.RetryAfter.Before(time.Now()))
+	if connection.ID == uuid.Nil || !syncable {
+		return c.JSON(fiber.Map{"received": true})
+	}
+
+	accounts := connection.Accounts[:0]
+	for _, account := range connection.Accounts {
+		if account.ArchivedAt == nil {
+			accounts = append(accounts, account)
+		}
+	}
+	connection.Accounts = accounts
+	s.syncBankConnection(c.UserContext(), connection)
+	return c.JSON(fiber.Map{"received": true})
+}
+
+// syncBankConnection imports the new transactions of every account attached
+// to the connection. A failing account does not prevent the others from being
+// synced, the connection is then marked "partial_error".
+func (s *FiberServer) syncBankConnection(ctx context.Context, connection types.BankConnection) {
+	failures := 0
+
+	for _, account := range connection.Accounts {
+		if account.ExternalAccountID == "" {
+			continue
+		}
+
+		err := s.syncBankAccount(ctx, &account)
+
+		var rateLimited *banksync.ErrRateLimited
+		if errors.As(err, &rateLimited) {
+			retryAfter := time.Now().Add(rateLimited.RetryAfter)
+			connection.Status = "rate_limited"
+			connection.RetryAfter = &retryAfter
+			connection.LastError = err.Error()
+			if err := s.db.UpdateBankConnection(&connection); err != nil {
+				log.Error(err)
+			}
+			s.metrics.countBankSync(connection.Status)
+			return
+		}
+
+		if errors.Is(err, banksync.ErrLinkExpired) {
+			connection.Status = "expired"
+			connection.LastError = err.Error()
+			if err := s.db.UpdateBankConnection(&connection); err != nil {
+				log.Error(err)
+			}
+			s.metrics.countBankSync(connection.Status)
+			return
+		}
+
+		if err != nil {
+			log.Errorf("Error syncing account %s: %v", account.ID, err)
+			account.SyncError = err.Error()
+			failures++
+		} else {
+			account.SyncError = ""
+		}
+
+		if err := s.db.UpdateBankAccountSync(&account); err != nil {
+			log.Error(err)
+		}
+	}
+
+	now := time.Now()
+	connection.LastSyncedAt = &now
+	connection.RetryAfter = nil
+	switch {
+	case failures == 0:
+		connection.Status = "linked"
+		connection.LastError = ""
+	case failures == len(connection.Accounts):
+		connection.Status = "error"
+		connection.LastError = "every account failed to sync"
+	default:
+		connection.Status = "partial_error"
+		connection.LastError = fmt.Sprintf("%d of %d accounts failed to sync", failures, len(connection.Accounts))
+	}
+
+	if err := s.db.UpdateBankConnection(&connection); err != nil {
+		log.Error(err)
+	}
+	s.metrics.countBankSync(connection.Status)
+}
+
+// syncBankAccount imports the transactions booked since the account cursor,
+// skipping the ones already imported.
+func (s *FiberServer) syncBankAccount(ctx context.Context, account *types.BankAccount) error {
+	transactions, cursor, err := s.bankSync.FetchTransactions(ctx, account.ExternalAccountID, account.SyncCursor)
+	if err != nil {
+		return err
+	}
+
+	var created []uuid.UUID
+	defer func() {
+		s.auditBatch(uuid.New(), account.UserID, "transaction.created", "transaction", created, "bank sync")
+	}()
+	for _, external := range transactions {
+		if external.Amount.IsZero() || s.db.ExternalTransactionExists(account.ID, external.ID) {
+			continue
+		}
+
+		transactionType, amount := "income", external.Amount
+		if amount.Sign() < 0 {
+			transactionType, amount = "expense", amount.Neg()
+		}
+
+		transaction := &types.Transaction{
+			ID:            uuid.New(),
+			Category:      "others",
+			Amount:        amount.Unbound(),
+			Date:          external.Date,
+			Type:          transactionType,
+			Description:   external.Description,
+			ExternalID:    external.ID,
+			Source:        "bank_sync",
+			BankAccountID: account.ID,
+			UserID:        account.UserID,
+		}
+		transaction.ExcludeFromBudgets = s.db.IsCategoryExcludedByDefault(account.UserID, transaction.Category)
+
+		if err := s.db.CreateTransaction(transaction); err != nil {
+			return fmt.Errorf("failed to import transaction %s: %w", external.ID, err)
+		}
+		created = append(created, transaction.ID)
+	}
+
+	account.SyncCursor = cursor
+	return nil
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"FinMa/internal/banksync"
+	"FinMa/types"
+)
+
+// bankSyncDB keeps the transactions imported by the syncs and the last
+// state of the connection and of the accounts.
+type bankSyncDB struct {
+	*adminDB
+	transactions []types.Transaction
+	connection   types.BankConnection
+	accounts     map[uuid.UUID]types.BankAccount
+}
+
+func (db *bankSyncDB) ExternalTransactionExists(accountID uuid.UUID, externalID string) bool {
+	for _, transaction := range db.transactions {
+		if transaction.BankAccountID == accountID && transaction.ExternalID == externalID {
+			return true
+		}
+	}
+	return false
+}
+
+func (db *bankSyncDB) IsCategoryExcludedByDefault(userID uuid.UUID, category string) bool {
+	return false
+}
+
+func (db *bankSyncDB) CreateTransaction(transaction *types.Transaction) error {
+	db.transactions = append(db.transactions, *transaction)
+	return nil
+}
+
+func (db *bankSyncDB) UpdateBankConnection(connection *types.BankConnection) error {
+	db.connection = *connection
+	return nil
+}
+
+func (db *bankSyncDB) UpdateBankAccountSync(account *types.BankAccount) error {
+	db.accounts[account.ID] = *account
+	return nil
+}
+
+// newBankSyncTestServer returns a server syncing through the mock provider
+// a connection of two accounts, each with a transaction at the bank.
+func newBankSyncTestServer(t *testing.T) (*FiberServer, *bankSyncDB, *banksync.MockProvider, types.BankConnection) {
+	s, admin, _, user := newAdminTestServer(t)
+	db := &bankSyncDB{adminDB: admin, accounts: map[uuid.UUID]types.BankAccount{}}
+	s.db = db
+
+	provider := banksync.NewMockProvider()
+	s.bankSync = provider
+	day := time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)
+	provider.Transactions["ext-checking"] = []banksync.ExternalTransaction{
+		{ID: "tx-1", Amount: types.NewMoney(-1250, "EUR"), Currency: "EUR", Date: day, Description: "Bakery"},
+	}
+	provider.Transactions["ext-savings"] = []banksync.ExternalTransaction{
+		{ID: "tx-2", Amount: types.NewMoney(50000, "EUR"), Currency: "EUR", Date: day, Description: "Salary"},
+	}
+
+	connection := types.BankConnection{ID: uuid.New(), Provider: "mock", Status: "linked", UserID: user.ID, Accounts: []types.BankAccount{
+		{ID: uuid.New(), BankName: "Checking", ExternalAccountID: "ext-checking", UserID: user.ID},
+		{ID: uuid.New(), BankName: "Savings", ExternalAccountID: "ext-savings", UserID: user.ID},
+	}}
+	return s, db, provider, connection
+}
+
+func TestSyncBankConnection(t *testing.T) {
+	s, db, _, connection := newBankSyncTestServer(t)
+
+	s.syncBankConnection(context.Background(), connection)
+	if db.connection.Status != "linked" || db.connection.LastSyncedAt == nil || len(db.transactions) != 2 {
+		t.Fatalf("expected both accounts synced; got %+v with %d transactions", db.connection, len(db.transactions))
+	}
+	bakery := db.transactions[0]
+	if bakery.Type != "expense" || bakery.Amount.String() != "12.50" || bakery.ExternalID != "tx-1" || bakery.Source != "bank_sync" {
+		t.Errorf("unexpected synced expense: %+v", bakery)
+	}
+	if cursor := db.accounts[connection.Accounts[0].ID].SyncCursor; cursor != "2024-03-04T00:00:00Z" {
+		t.Errorf("expected the cursor moved to the last transaction; got %q", cursor)
+	}
+}
+
+func TestSyncBankConnectionSkipsImportedTransactions(t *testing.T) {
+	s, db, provider, connection := newBankSyncTestServer(t)
+	s.syncBankConnection(context.Background(), connection)
+
+	// The cursor lost, the bank returns the transactions again with a new one
+	provider.Transactions["ext-checking"] = append(provider.Transactions["ext-checking"], banksync.ExternalTransaction{
+		ID: "tx-3", Amount: types.NewMoney(-400, "EUR"), Currency: "EUR", Date: time.Date(2024, time.March, 5, 0, 0, 0, 0, time.UTC), Description: "Coffee",
+	})
+	s.syncBankConnection(context.Background(), connection)
+	if len(db.transactions) != 3 || db.transactions[2].ExternalID != "tx-3" {
+		t.Errorf("expected only the new transaction imported; got %+v", db.transactions)
+	}
+}
+
+func TestSyncBankConnectionPartialFailure(t *testing.T) {
+	s, db, provider, connection := newBankSyncTestServer(t)
+	provider.Errors["ext-savings"] = errors.New("upstream unavailable")
+
+	s.syncBankConnection(context.Background(), connection)
+	if db.connection.Status != "partial_error" || db.connection.LastError != "1 of 2 accounts failed to sync" {
+		t.Errorf("expected a partial error; got %+v", db.connection)
+	}
+	if len(db.transactions) != 1 || db.transactions[0].ExternalID != "tx-1" {
+		t.Errorf("expected the checking account synced anyway; got %+v", db.transactions)
+	}
+	if savings := db.accounts[connection.Accounts[1].ID]; savings.SyncError != "upstream unavailable" || savings.SyncCursor != "" {
+		t.Errorf("expected the error on the savings account; got %+v", savings)
+	}
+
+	provider.Errors["ext-checking"] = errors.New("upstream unavailable")
+	s.syncBankConnection(context.Background(), connection)
+	if db.connection.Status != "error" {
+		t.Errorf("expected an error when every account fails; got %+v", db.connection)
+	}
+}
+
+func TestSyncBankConnectionRateLimited(t *testing.T) {
+	s, db, provider, connection := newBankSyncTestServer(t)
+	provider.Errors["ext-checking"] = &banksync.ErrRateLimited{RetryAfter: time.Hour}
+
+	before := time.Now()
+	s.syncBankConnection(context.Background(), connection)
+	if db.connection.Status != "rate_limited" || db.connection.RetryAfter == nil || db.connection.RetryAfter.Before(before.Add(time.Hour)) {
+		t.Fatalf("expected the connection retried in an hour; got %+v", db.connection)
+	}
+	// The sync stops at the limit, the next accounts wait for the retry
+	if len(db.transactions) != 0 || db.connection.LastSyncedAt != nil {
+		t.Errorf("expected nothing synced; got %d transactions", len(db.transactions))
+	}
+}
+
+func TestSyncBankConnectionExpiredLink(t *testing.T) {
+	s, db, provider, connection := newBankSyncTestServer(t)
+	provider.Errors["ext-checking"] = banksync.ErrLinkExpired
+
+	s.syncBankConnection(context.Background(), connection)
+	if db.connection.Status != "expired" || db.connection.LastError != banksync.ErrLinkExpired.Error() {
+		t.Errorf("expected the connection expired; got %+v", db.connection)
+	}
+	if len(db.transactions) != 0 {
+		t.Errorf("expected nothing synced; got %d transactions", len(db.transactions))
+	}
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+
+	"FinMa/internal/fx"
+	"FinMa/types"
+)
+
+// exchangeRateWarmLimit bounds the rates fetched before a report. The days
+// past it are converted at the closest stored rate until the next reports
+// fetch them.
+const exchangeRateWarmLimit = 100
+
+// baseCurrency returns the currency the reports of the user are converted
+// to: theirs, else the currency of the instance.
+func (s *FiberServer) baseCurrency(user types.User) string {
+	if user.BaseCurrency != "" {
+		return user.BaseCurrency
+	}
+	return s.config.Features.Currency
+}
+
+// accountCurrency returns the currency of the account, the currency of the
+// instance for the accounts created before the accounts had one.
+func (s *FiberServer) accountCurrency(account types.BankAccount) string {
+	if account.Currency != "" {
+		return account.Currency
+	}
+	return s.config.Features.Currency
+}
+
+// checkAccountAmount refuses an amount of the field finer than the minor
+// unit of the currency of the account, like 12.345 euros.
+func (s *FiberServer) checkAccountAmount(field string, amount types.Money, account types.BankAccount) error {
+	currency := s.accountCurrency(account)
+	if _, err := amount.In(currency); err != nil {
+		return NewAPIError(fiber.StatusUnprocessableEntity, CodeValidationFailed, "Invalid amount").
+			WithDetails(FieldError{Field: field, Message: "Must not be finer than the minor unit of " + currency, Value: amount})
+	}
+	return nil
+}
+
+// checkBaseAmount refuses an amount of the field finer than the minor unit
+// of the base currency of the user, which the budgets and the goals are in.
+func (s *FiberServer) checkBaseAmount(field string, amount types.Money, user types.User) error {
+	currency := s.baseCurrency(user)
+	if _, err := amount.In(currency); err != nil {
+		return NewAPIError(fiber.StatusUnprocessableEntity, CodeValidationFailed, "Invalid amount").
+			WithDetails(FieldError{Field: field, Message: "Must not be finer than the minor unit of " + currency, Value: amount})
+	}
+	return nil
+}
+
+// fetchMissingRates fetches the exchange rates the reports of the user
+// lack before they are computed: the database converts the amounts with
+// the stored rates only. It gives up at the first rate the providers
+// cannot give, the next reports try again.
+func (s *FiberServer) fetchMissingRates(c *fiber.Ctx, user types.User) {
+	if s.fx == nil {
+		return
+	}
+
+	base := s.baseCurrency(user)
+	missing, err := s.dbFor(c).GetMissingExchangeRates(&user, base, exchangeRateWarmLimit)
+	if err != nil {
+		log.Error("Error listing the missing exchange rates: ", err)
+		return
+	}
+	for _, rate := range missing {
+		fetched, err := s.fx.Rate(c.UserContext(), rate.Currency, base, rate.Day)
+		if err != nil || fetched.Stale {
+			log.Warn("Reports converted with the closest exchange rates", "user", user.ID, "currency", rate.Currency, "date", rate.Day.Format(time.DateOnly), "err", err)
+			return
+		}
+	}
+}
+
+// currencyConverter converts amounts to a currency, asking the exchange
+// rate service once per currency and day.
+type currencyConverter struct {
+	ctx   context.Context
+	fx    *fx.Service
+	to    string
+	rates map[string]float64
+}
+
+// converter returns the converter of the amounts to the base currency of
+// the user. Without an exchange rate service the amounts are kept.
+func (s *FiberServer) converter(c *fiber.Ctx, user types.User) *currencyConverter {
+	return &currencyConverter{ctx: c.UserContext(), fx: s.fx, to: s.baseCurrency(user), rates: map[string]float64{}}
+}
+
+// rate returns how much 1 currency is worth in the currency of the
+// converter on the UTC day of date. An account without a currency is in the
+// currency of the converter.
+func (cv *currencyConverter) rate(currency string, date time.Time) (float64, error) {
+	if cv.fx == nil || currency == "" || currency == cv.to {
+		return 1, nil
+	}
+
+	key := currency + fx.Day(date).Format(time.DateOnly)
+	if rate, ok := cv.rates[key]; ok {
+		return rate, nil
+	}
+	rate, err := cv.fx.Rate(cv.ctx, currency, cv.to, date)
+	if err != nil {
+		return 0, err
+	}
+	cv.rates[key] = rate.Rate
+	return rate.Rate, nil
+}
+
+// SetBaseCurrency stores the ISO 4217 currency the reports, the net worth,
+// the budgets and the dashboard of the user are converted to, like "USD".
+// The amounts stay stored in the currency of their account: changing it
+// only changes the conversions. An empty currency follows the currency of
+// the instance again.
+func (s *FiberServer) SetBaseCurrency(c *fiber.Ctx) error {
+	type SetBaseCurrencyRequest struct {
+		BaseCurrency string `json:"base_currency"`
+	}
+
+	var body SetBaseCurrencyRequest
+	err := c.BodyParser(&body)
+	currency := strings.ToUpper(body.BaseCurrency)
+	if err != nil || (currency != "" && !fx.IsCurrencyCode(currency)) {
+		return NewAPIError(fiber.StatusUnprocessableEntity, CodeValidationFailed, "Invalid currency").
+			WithDetails(FieldError{Field: "base_currency", Message: "Must be an ISO 4217 code", Value: body.BaseCurrency})
+	}
+
+	user := c.Locals("user").(types.User)
+	user.BaseCurrency = currency
+	if err := s.db.UpdateUserBaseCurrency(&user); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not update the base currency")
+	}
+
+	return c.JSON(fiber.Map{"base_currency": s.baseCurrency(user)})
+}
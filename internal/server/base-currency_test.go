@@ -0,0 +1,157 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/internal/database"
+	"FinMa/internal/fx"
+	"FinMa/types"
+)
+
+// baseCurrencyDB holds a EUR and a USD account, and the rates of the
+// missing days it is told about.
+type baseCurrencyDB struct {
+	*exchangeRatesDB
+	accounts []types.BankAccount
+	missing  []types.MissingExchangeRate
+}
+
+func (db *baseCurrencyDB) WithContext(context.Context) database.Service {
+	return db
+}
+
+func (db *baseCurrencyDB) UpdateUserBaseCurrency(user *types.User) error {
+	stored := db.users[user.ID]
+	stored.BaseCurrency = user.BaseCurrency
+	db.users[user.ID] = stored
+	return nil
+}
+
+func (db *baseCurrencyDB) GetBankAccounts(*types.User, bool) []types.BankAccount {
+	return db.accounts
+}
+
+func (db *baseCurrencyDB) GetMonthlyAccountFlows(*types.User, string, bool) []types.AccountMonthlyFlow {
+	return nil
+}
+
+func (db *baseCurrencyDB) GetMissingExchangeRates(_ *types.User, currency string, _ int) ([]types.MissingExchangeRate, error) {
+	var missing []types.MissingExchangeRate
+	for _, rate := range db.missing {
+		if rate.Currency != currency {
+			missing = append(missing, rate)
+		}
+	}
+	return missing, nil
+}
+
+func TestSetBaseCurrency(t *testing.T) {
+	s, db, user := newBaseCurrencyTestServer(t)
+
+	for _, body := range []string{`{"base_currency": "dollar"}`, `{"base_currency": "US"}`, `not json`} {
+		if resp := adminRequest(t, s, user, "PUT", "/api/v1/base-currency", body); resp.StatusCode != fiber.StatusUnprocessableEntity {
+			t.Errorf("%s: expected status 422; got %d", body, resp.StatusCode)
+		}
+	}
+
+	resp := adminRequest(t, s, user, "PUT", "/api/v1/base-currency", `{"base_currency": "usd"}`)
+	var result map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || result["base_currency"] != "USD" {
+		t.Errorf("expected USD; got %v, %v", result, err)
+	}
+	if db.users[user.ID].BaseCurrency != "USD" {
+		t.Errorf("expected the base currency stored; got %q", db.users[user.ID].BaseCurrency)
+	}
+
+	// Empty follows the currency of the instance again
+	resp = adminRequest(t, s, user, "PUT", "/api/v1/base-currency", `{"base_currency": ""}`)
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || result["base_currency"] != "EUR" {
+		t.Errorf("expected the currency of the instance; got %v, %v", result, err)
+	}
+}
+
+func TestNetWorthInBaseCurrency(t *testing.T) {
+	s, db, user := newBaseCurrencyTestServer(t)
+
+	// 1 USD is 0.92 EUR, and the provider answers 0.92 for EUR to USD too
+	tests := []struct {
+		base                string
+		assets, liabilities float64
+	}{
+		// 1000 + 500 × 0.92 = 1460, the card 200 × 0.92 = 184
+		{"EUR", 1460, 184},
+		// 1000 × 0.92 + 500 = 1420, the card 200
+		{"USD", 1420, 200},
+	}
+	for _, tt := range tests {
+		adminRequest(t, s, user, "PUT", "/api/v1/base-currency", `{"base_currency": "`+tt.base+`"}`)
+
+		resp := adminRequest(t, s, user, "GET", "/api/v1/reports/net-worth?months=1", "")
+		var netWorth types.NetWorth
+		if err := json.NewDecoder(resp.Body).Decode(&netWorth); err != nil || resp.StatusCode != fiber.StatusOK {
+			t.Fatalf("%s: expected the net worth; got %d, %v", tt.base, resp.StatusCode, err)
+		}
+		if netWorth.Currency != tt.base || netWorth.Assets != money(tt.assets) || netWorth.Liabilities != money(tt.liabilities) {
+			t.Errorf("%s: expected %v of assets and %v of liabilities; got %+v", tt.base, tt.assets, tt.liabilities, netWorth)
+		}
+		if current := money(tt.assets - tt.liabilities); netWorth.Current != current || netWorth.History[0].NetWorth != current {
+			t.Errorf("%s: expected a net worth of %v; got %+v", tt.base, current, netWorth)
+		}
+	}
+
+	// The stored balances are left as they are
+	if db.accounts[1].Balance != money(500) || db.accounts[1].Currency != "USD" {
+		t.Errorf("expected the USD account unchanged; got %+v", db.accounts[1])
+	}
+}
+
+func TestCheckBaseAmount(t *testing.T) {
+	s, _, user := newBaseCurrencyTestServer(t)
+
+	if err := s.checkBaseAmount("amount", money(12.34), user); err != nil {
+		t.Errorf("expected cents accepted in EUR; got %v", err)
+	}
+	var apiErr *APIError
+	if err := s.checkBaseAmount("amount", money(12.345), user); !errors.As(err, &apiErr) || apiErr.Code != CodeValidationFailed {
+		t.Errorf("expected a fraction of a cent refused; got %v", err)
+	}
+
+	user.BaseCurrency = "JPY"
+	if err := s.checkBaseAmount("amount", money(12.5), user); err == nil {
+		t.Error("expected a fraction of a yen refused")
+	}
+}
+
+func TestMissingRatesAreFetchedBeforeReports(t *testing.T) {
+	s, db, user := newBaseCurrencyTestServer(t)
+	monday := time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)
+	db.missing = []types.MissingExchangeRate{{Currency: "USD", Day: monday}}
+
+	adminRequest(t, s, user, "GET", "/api/v1/reports/net-worth", "")
+	rate, _ := db.GetExchangeRate("USD", "EUR", monday)
+	if rate == nil || rate.Rate != 0.92 {
+		t.Errorf("expected the rate of the day stored; got %+v", rate)
+	}
+}
+
+// newBaseCurrencyTestServer returns the admin test server with the accounts
+// of the user in EUR, the currency of the instance, and in USD.
+func newBaseCurrencyTestServer(t *testing.T) (*FiberServer, *baseCurrencyDB, types.User) {
+	s, _, user := newAdminTestServerWithRates(t)
+	rates := s.db.(*exchangeRatesDB)
+	db := &baseCurrencyDB{exchangeRatesDB: rates, accounts: []types.BankAccount{
+		{ID: uuid.New(), AccountType: "checking", Currency: "EUR", Balance: money(1000), InitialBalance: money(1000), UserID: user.ID},
+		{ID: uuid.New(), AccountType: "savings", Currency: "USD", Balance: money(500), InitialBalance: money(500), UserID: user.ID},
+		{ID: uuid.New(), AccountType: "credit_card", Currency: "USD", Balance: money(-200), InitialBalance: money(-200), UserID: user.ID},
+	}}
+	s.db = db
+	s.fx = fx.NewService(db, fridayProvider{})
+	return s, db, user
+}
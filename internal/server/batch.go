@@ -0,0 +1,235 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// batchLimit is the number of sub-requests a batch may hold.
+const batchLimit = 20
+
+// batchPaths are the read endpoints a batch may call, below the API prefix.
+// The streams, the admin routes and the GET routes changing data, such as
+// the digest unsubscribe links, are left out.
+var batchPaths = []string{
+	"/accounts/", "/account-invites/",
+	"/household/", "/household-invites/",
+	"/transactions/", "/categories/",
+	"/budgets/", "/budget-templates/",
+	"/allocations/unassigned", "/allocation-rules/",
+	"/goals/", "/bills/",
+	"/notifications/preferences", "/push/public-key",
+	"/flags", "/dashboard", "/reports/",
+}
+
+// batchRequestHeaders are the headers of the batch passed on to its
+// sub-requests: they run as the caller, in their language.
+var batchRequestHeaders = []string{
+	fiber.HeaderAuthorization,
+	fiber.HeaderAcceptLanguage,
+	fiber.HeaderAccept,
+}
+
+// batchResponseHeaders are the headers of the sub-responses returned in the
+// batch, the others describe the connection rather than the response.
+var batchResponseHeaders = []string{
+	fiber.HeaderContentType,
+	fiber.HeaderContentLanguage,
+	fiber.HeaderCacheControl,
+	fiber.HeaderETag,
+	fiber.HeaderLink,
+	fiber.HeaderRetryAfter,
+	"Deprecation",
+	"Sunset",
+	"X-Cache",
+	RequestIDHeader,
+}
+
+// batchRequest is a sub-request of a batch. The path is the one the caller
+// would request, with the API prefix and the query string.
+type batchRequest struct {
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// batchResponse is the response of a sub-request. The JSON bodies are
+// embedded as is, the others as a string.
+type batchResponse struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	Body    any               `json:"body"`
+}
+
+// Batch runs up to 20 read requests at once and returns their responses in
+// order, so that the apps load their screens in one round trip. The
+// sub-requests run concurrently through every middleware, as requests of
+// their own: they are authenticated with the Authorization header of the
+// batch, logged, measured and counted against the rate limits of their
+// route. A failing sub-request is returned with its status, the batch
+// itself only fails when malformed.
+func (s *FiberServer) Batch(c *fiber.Ctx) error {
+	type BatchRequest struct {
+		Requests []batchRequest `json:"requests"`
+	}
+
+	var body BatchRequest
+	if err := c.BodyParser(&body); err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+	if len(body.Requests) == 0 || len(body.Requests) > batchLimit {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("Between 1 and %d requests are required", batchLimit))
+	}
+
+	var invalid []FieldError
+	for i, request := range body.Requests {
+		if problem := batchProblem(request); problem != "" {
+			invalid = append(invalid, FieldError{Field: fmt.Sprintf("requests[%d]", i), Message: problem, Value: request.Method + " " + request.Path})
+		}
+	}
+	if len(invalid) > 0 {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid batch requests").WithDetails(invalid...)
+	}
+
+	// The context of the batch is not safe for concurrent use, the
+	// sub-requests get what they need of it beforehand
+	requestID, _ := c.Locals("request_id").(string)
+	caller := batchCaller{
+		handler:    c.App().Handler(),
+		host:       string(c.Request().Host()),
+		remoteAddr: c.Context().RemoteAddr(),
+		headers:    map[string]string{},
+		locale:     requestLocale(c),
+		timeout:    time.Duration(s.config.Server.RequestTimeout) * time.Second,
+	}
+	for _, name := range batchRequestHeaders {
+		if value := c.Get(name); value != "" {
+			caller.headers[name] = value
+		}
+	}
+
+	responses := make([]batchResponse, len(body.Requests))
+	var wg sync.WaitGroup
+	for i, request := range body.Requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var subRequestID string
+			if requestID != "" {
+				subRequestID = fmt.Sprintf("%s.%d", requestID, i)
+			}
+			responses[i] = caller.run(request, subRequestID)
+		}()
+	}
+	wg.Wait()
+
+	return c.JSON(fiber.Map{"responses": responses})
+}
+
+// batchProblem returns why the sub-request may not be batched, empty when
+// it may.
+func batchProblem(request batchRequest) string {
+	if request.Method != fiber.MethodGet {
+		return "only GET requests may be batched"
+	}
+
+	target, _, _ := strings.Cut(request.Path, "?")
+	var relative string
+	switch {
+	case strings.HasPrefix(target, APIPrefix+"/"):
+		relative = strings.TrimPrefix(target, APIPrefix)
+	case strings.HasPrefix(target, legacyAPIPrefix+"/"):
+		relative = strings.TrimPrefix(target, legacyAPIPrefix)
+	default:
+		return "the path must start with " + APIPrefix
+	}
+	// The paths are compared as routed, "/transactions/../admin" must not
+	// pass for a transaction route
+	if path.Clean(relative) != relative {
+		return "the path must be clean"
+	}
+	if relative == "/batch" {
+		return "batches may not be nested"
+	}
+	if !hasPathPrefix(relative, batchPaths) {
+		return "this endpoint may not be batched"
+	}
+	return ""
+}
+
+// batchCaller runs the sub-requests of a batch as its caller.
+type batchCaller struct {
+	handler    fasthttp.RequestHandler
+	host       string
+	remoteAddr net.Addr
+	headers    map[string]string
+	locale     string
+	// timeout bounds each sub-request
+	timeout time.Duration
+}
+
+// run runs the sub-request through the handler of the app and returns its
+// response. Its request ID is the one of the batch suffixed by its index. A
+// sub-request still running past the timeout is answered with a 504, it is
+// left to finish on its own.
+func (b batchCaller) run(request batchRequest, requestID string) batchResponse {
+	var req fasthttp.Request
+	req.Header.SetMethod(request.Method)
+	req.SetRequestURI(request.Path)
+	req.Header.SetHost(b.host)
+	for name, value := range b.headers {
+		req.Header.Set(name, value)
+	}
+	if requestID != "" {
+		req.Header.Set(RequestIDHeader, requestID)
+	}
+	if len(request.Body) > 0 {
+		req.Header.SetContentType(fiber.MIMEApplicationJSON)
+		req.SetBody(request.Body)
+	}
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Init(&req, b.remoteAddr, nil)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.handler(ctx)
+	}()
+
+	timer := time.NewTimer(b.timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		apiErr := NewAPIError(fiber.StatusGatewayTimeout, CodeTimeout, "The request took too long")
+		message, _ := translateError(apiErr, CodeTimeout, b.locale)
+		return batchResponse{
+			Status:  apiErr.Status,
+			Headers: map[string]string{RequestIDHeader: requestID},
+			Body:    errorBody{Error: errorContent{Code: CodeTimeout, Message: message, RequestID: requestID}},
+		}
+	}
+
+	response := batchResponse{Status: ctx.Response.StatusCode(), Headers: map[string]string{}}
+	for _, name := range batchResponseHeaders {
+		if value := ctx.Response.Header.Peek(name); len(value) > 0 {
+			response.Headers[name] = string(value)
+		}
+	}
+	if body := ctx.Response.Body(); len(body) > 0 {
+		if strings.HasPrefix(string(ctx.Response.Header.ContentType()), fiber.MIMEApplicationJSON) && json.Valid(body) {
+			response.Body = json.RawMessage(append([]byte(nil), body...))
+		} else {
+			response.Body = string(body)
+		}
+	}
+	return response
+}
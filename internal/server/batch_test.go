@@ -0,0 +1,136 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"FinMa/utils"
+)
+
+type batchResult struct {
+	Responses []struct {
+		Status  int               `json:"status"`
+		Headers map[string]string `json:"headers"`
+		Body    json.RawMessage   `json:"body"`
+	} `json:"responses"`
+}
+
+func TestBatch(t *testing.T) {
+	s, _, _, user := newAdminTestServer(t)
+	s.config.Server.RequestTimeout = 1
+	s.Get("/api/v1/reports/slow", func(c *fiber.Ctx) error {
+		time.Sleep(1500 * time.Millisecond)
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	token, err := s.tokens.GenerateAccessToken(utils.Payload{UserID: user.ID, Email: user.Email})
+	if err != nil {
+		t.Fatalf("error generating the token. Err: %v", err)
+	}
+	req, err := http.NewRequest("POST", "/api/v1/batch", strings.NewReader(`{"requests": [
+		{"method": "GET", "path": "/api/v1/flags"},
+		{"method": "GET", "path": "/api/v1/reports/unknown"},
+		{"method": "GET", "path": "/api/v1/reports/slow"},
+		{"method": "GET", "path": "/api/flags?unused=1"}
+	]}`))
+	if err != nil {
+		t.Fatalf("error creating request. Err: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	// Past the timeout of the slow sub-request
+	resp, err := s.Test(req, 5000)
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("expected status 200; got %d", resp.StatusCode)
+	}
+	var result batchResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("error decoding the response. Err: %v", err)
+	}
+	if len(result.Responses) != 4 {
+		t.Fatalf("expected 4 responses; got %d", len(result.Responses))
+	}
+
+	// In order, run as the caller
+	flags := result.Responses[0]
+	if flags.Status != fiber.StatusOK || !strings.Contains(string(flags.Body), `"households":false`) {
+		t.Errorf("expected the flags of the user; got %d %s", flags.Status, flags.Body)
+	}
+	if !strings.HasPrefix(flags.Headers[fiber.HeaderContentType], fiber.MIMEApplicationJSON) {
+		t.Errorf("expected the content type of the response; got %v", flags.Headers)
+	}
+	// A failing sub-request is returned as is
+	if unknown := result.Responses[1]; unknown.Status != fiber.StatusNotFound || !strings.Contains(string(unknown.Body), `"code":"not_found"`) {
+		t.Errorf("expected a 404 error; got %d %s", unknown.Status, unknown.Body)
+	}
+	if slow := result.Responses[2]; slow.Status != fiber.StatusGatewayTimeout || !strings.Contains(string(slow.Body), `"code":"timeout"`) {
+		t.Errorf("expected the slow request to time out; got %d %s", slow.Status, slow.Body)
+	}
+	if legacy := result.Responses[3]; legacy.Status != fiber.StatusOK {
+		t.Errorf("expected the deprecated path to be served; got %d %s", legacy.Status, legacy.Body)
+	}
+}
+
+func TestBatchRequiresAuthentication(t *testing.T) {
+	s, _, _, _ := newAdminTestServer(t)
+
+	req, err := http.NewRequest("POST", "/api/v1/batch", strings.NewReader(`{"requests": [{"method": "GET", "path": "/api/v1/flags"}]}`))
+	if err != nil {
+		t.Fatalf("error creating request. Err: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.Test(req)
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("expected status 401; got %d", resp.StatusCode)
+	}
+}
+
+func TestInvalidBatches(t *testing.T) {
+	s, _, _, user := newAdminTestServer(t)
+
+	tests := []struct {
+		name    string
+		body    string
+		problem string
+	}{
+		{"empty", `{"requests": []}`, "Between 1 and 20 requests are required"},
+		{"too many", `{"requests": [` + strings.Repeat(`{"method": "GET", "path": "/api/v1/flags"},`, 20) + `{"method": "GET", "path": "/api/v1/flags"}]}`, "Between 1 and 20 requests are required"},
+		{"nested", `{"requests": [{"method": "GET", "path": "/api/v1/flags"}, {"method": "GET", "path": "/api/v1/batch"}]}`, "batches may not be nested"},
+		{"nested legacy", `{"requests": [{"method": "GET", "path": "/api/batch"}]}`, "batches may not be nested"},
+		{"write", `{"requests": [{"method": "DELETE", "path": "/api/v1/transactions/1"}]}`, "only GET requests may be batched"},
+		{"admin", `{"requests": [{"method": "GET", "path": "/api/v1/admin/users"}]}`, "this endpoint may not be batched"},
+		{"unsubscribe", `{"requests": [{"method": "GET", "path": "/api/v1/digest/unsubscribe?token=x"}]}`, "this endpoint may not be batched"},
+		{"traversal", `{"requests": [{"method": "GET", "path": "/api/v1/transactions/../admin/users"}]}`, "the path must be clean"},
+		{"outside the API", `{"requests": [{"method": "GET", "path": "/metrics"}]}`, "the path must start with /api/v1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := adminRequest(t, s, user, "POST", "/api/v1/batch", tt.body)
+			if resp.StatusCode != fiber.StatusBadRequest {
+				t.Fatalf("expected status 400; got %d", resp.StatusCode)
+			}
+			var body errorBody
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatalf("error decoding the response. Err: %v", err)
+			}
+			found := body.Error.Message == tt.problem
+			for _, detail := range body.Error.Details {
+				found = found || detail.Message == tt.problem
+			}
+			if !found {
+				t.Errorf("expected %q; got %+v", tt.problem, body.Error)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/internal/billing"
+	"FinMa/internal/i18n"
+	"FinMa/types"
+)
+
+// requireBilling returns a 503 error when no payment provider is configured.
+func (s *FiberServer) requireBilling(c *fiber.Ctx) error {
+	if s.billing == nil {
+		return NewAPIError(fiber.StatusServiceUnavailable, CodeUnavailable, "Billing is not configured")
+	}
+	return c.Next()
+}
+
+// billingReturnURL returns the page of the app the checkout and the portal
+// send the users back to.
+func (s *FiberServer) billingReturnURL() string {
+	if s.config.Billing.ReturnURL != "" {
+		return s.config.Billing.ReturnURL
+	}
+	return s.config.Server.AppURL
+}
+
+// isSubscribed reports whether the status is of a subscription still
+// running, paid or not.
+func isSubscribed(status string) bool {
+	switch status {
+	case "active", "trialing", "past_due", "unpaid":
+		return true
+	}
+	return false
+}
+
+// downgradeAt returns when the user of a billing account failing to pay is
+// moved to the free plan, nil when they pay.
+func (s *FiberServer) downgradeAt(account types.BillingAccount) *time.Time {
+	if account.PastDueSince == nil || account.DowngradedAt != nil {
+		return nil
+	}
+	at := account.PastDueSince.AddDate(0, 0, s.config.Billing.GraceDays)
+	return &at
+}
+
+// CreateCheckoutSession starts the checkout of the subscription to the pro
+// plan, creating the customer of the user at the payment provider the
+// first time. The app sends the user to the URL of the session; the plan
+// changes once the webhook tells the subscription is paid.
+func (s *FiberServer) CreateCheckoutSession(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	account := s.db.GetBillingAccount(user.ID)
+	if isSubscribed(account.Status) {
+		return NewAPIError(fiber.StatusConflict, CodeConflict, "The user is already subscribed, manage the subscription in the portal")
+	}
+
+	if account.CustomerID == "" {
+		customerID, err := s.billing.CreateCustomer(c.UserContext(), user.Email, user.ID.String())
+		if err != nil {
+			log.Error("Error creating a billing customer: ", err)
+			return NewAPIError(fiber.StatusBadGateway, CodeUpstreamError, "Could not start the checkout")
+		}
+		account = types.BillingAccount{UserID: user.ID, CustomerID: customerID}
+		if err := s.db.SaveBillingAccount(&account, ""); err != nil {
+			log.Error(err)
+			return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not start the checkout")
+		}
+	}
+
+	returnURL := s.billingReturnURL()
+	session, err := s.billing.CreateCheckoutSession(c.UserContext(), account.CustomerID, user.ID.String(),
+		returnURL+"?checkout=success", returnURL+"?checkout=canceled")
+	if err != nil {
+		log.Error("Error creating a checkout session: ", err)
+		return NewAPIError(fiber.StatusBadGateway, CodeUpstreamError, "Could not start the checkout")
+	}
+	return c.Status(fiber.StatusCreated).JSON(session)
+}
+
+// CreatePortalSession returns the URL of the portal of the payment provider
+// where the user manages their subscription and their payment methods.
+func (s *FiberServer) CreatePortalSession(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	account := s.db.GetBillingAccount(user.ID)
+	if account.CustomerID == "" {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "The user never subscribed")
+	}
+
+	url, err := s.billing.CreatePortalSession(c.UserContext(), account.CustomerID, s.billingReturnURL())
+	if err != nil {
+		log.Error("Error creating a portal session: ", err)
+		return NewAPIError(fiber.StatusBadGateway, CodeUpstreamError, "Could not open the billing portal")
+	}
+	return c.JSON(fiber.Map{"url": url})
+}
+
+// GetBillingStatus returns the plan of the user and the state of their
+// subscription.
+func (s *FiberServer) GetBillingStatus(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	account := s.db.GetBillingAccount(user.ID)
+	return c.JSON(types.BillingStatus{
+		Plan:              s.userPlan(user),
+		Enabled:           s.billing != nil,
+		Status:            account.Status,
+		CurrentPeriodEnd:  account.CurrentPeriodEnd,
+		CancelAtPeriodEnd: account.CancelAtPeriodEnd,
+		PastDueSince:      account.PastDueSince,
+		DowngradeAt:       s.downgradeAt(account),
+	})
+}
+
+// StripeWebhook handles the events of Stripe, verified by verifyWebhook.
+// The subscription events move the user to the plan the subscription pays
+// for; the others are acknowledged and ignored.
+func (s *FiberServer) StripeWebhook(c *fiber.Ctx) error {
+	event, err := s.billing.ParseEvent(webhookBody(c))
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid event")
+	}
+
+	if event.Subscription != nil {
+		// The provider retries the events failing, until they are handled
+		if err := s.applySubscription(c.UserContext(), event); err != nil {
+			log.Error("Error handling a billing event: ", err)
+			return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not handle the event")
+		}
+	}
+	return c.JSON(fiber.Map{"received": true})
+}
+
+// applySubscription stores the state of the subscription of the event and
+// moves its user to the plan it pays for: pro while active, kept for the
+// grace period once a payment failed, free once canceled. The events older
+// than the last one applied are ignored, the provider does not deliver
+// them in order.
+func (s *FiberServer) applySubscription(ctx context.Context, event billing.Event) error {
+	subscription := event.Subscription
+	account := s.db.GetBillingAccountByCustomer(subscription.CustomerID)
+	if account.UserID == uuid.Nil {
+		log.Warn("Billing event for an unknown customer: ", event.ID)
+		return nil
+	}
+	if event.Created.Before(account.EventAt) {
+		return nil
+	}
+
+	status := subscription.Status
+	if event.Type == billing.EventSubscriptionDeleted {
+		status = "canceled"
+	}
+	periodEnd := subscription.CurrentPeriodEnd
+	account.SubscriptionID = subscription.ID
+	account.Status = status
+	account.CurrentPeriodEnd = &periodEnd
+	account.CancelAtPeriodEnd = subscription.CancelAtPeriodEnd
+	account.EventAt = event.Created
+
+	var plan string
+	failed := false
+	switch status {
+	case "active", "trialing":
+		plan = "pro"
+		account.PastDueSince, account.DowngradedAt = nil, nil
+	case "past_due", "unpaid":
+		if account.PastDueSince == nil {
+			account.PastDueSince = &event.Created
+			failed = true
+		}
+		if account.DowngradedAt == nil {
+			plan = "pro"
+		}
+	case "canceled", "incomplete_expired":
+		plan = "free"
+		account.PastDueSince = nil
+	}
+	if err := s.db.SaveBillingAccount(&account, plan); err != nil {
+		return err
+	}
+
+	if failed {
+		downgradeAt := s.downgradeAt(account)
+		err := s.Notify(ctx, account.UserID, "billing_payment_failed", NotificationPayload{
+			Params:  i18n.Params{"date": *downgradeAt},
+			Details: fiber.Map{"downgrade_at": downgradeAt.Format(time.DateOnly)},
+		})
+		if err != nil {
+			log.Error("Error notifying a failed payment: ", err)
+		}
+	}
+	return nil
+}
+
+// StartBillingGrace periodically moves to the free plan the users whose
+// payments failed for longer than the grace period.
+func (s *FiberServer) StartBillingGrace(interval time.Duration) {
+	s.every("billing_grace", interval, s.downgradeUnpaid)
+}
+
+func (s *FiberServer) downgradeUnpaid(now time.Time) error {
+	grace := time.Duration(s.config.Billing.GraceDays) * 24 * time.Hour
+	for _, account := range s.db.GetBillingAccountsPastDue(now.Add(-grace)) {
+		account.DowngradedAt = &now
+		if err := s.db.SaveBillingAccount(&account, "free"); err != nil {
+			return fmt.Errorf("failed to downgrade the user %s: %w", account.UserID, err)
+		}
+		err := s.Notify(context.Background(), account.UserID, "billing_downgraded", NotificationPayload{
+			Details: fiber.Map{"past_due_since": account.PastDueSince},
+		})
+		if err != nil {
+			log.Error("Error notifying a downgrade: ", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/internal/billing"
+	"FinMa/internal/realtime"
+	"FinMa/types"
+)
+
+// fakeBilling returns the events queued by the ID of the payload.
+type fakeBilling struct {
+	customers int
+	events    map[string]billing.Event
+}
+
+func (p *fakeBilling) CreateCustomer(ctx context.Context, email, reference string) (string, error) {
+	p.customers++
+	return "cus_1", nil
+}
+
+func (p *fakeBilling) CreateCheckoutSession(ctx context.Context, customerID, reference, successURL, cancelURL string) (billing.Session, error) {
+	return billing.Session{ID: "cs_1", URL: "https://checkout.example.com/" + customerID}, nil
+}
+
+func (p *fakeBilling) CreatePortalSession(ctx context.Context, customerID, returnURL string) (string, error) {
+	return "https://portal.example.com/" + customerID, nil
+}
+
+func (p *fakeBilling) ParseEvent(payload []byte) (billing.Event, error) {
+	var event struct {
+		ID string `json:"id"`
+	}
+	err := json.Unmarshal(payload, &event)
+	return p.events[event.ID], err
+}
+
+// billingDB keeps the billing accounts and the events handled in memory,
+// moving the users to the plan saved with their account.
+type billingDB struct {
+	*adminDB
+	webhookEvents
+	accounts      map[uuid.UUID]types.BillingAccount
+	notifications []string
+}
+
+func (db *billingDB) GetBillingAccount(userID uuid.UUID) types.BillingAccount {
+	return db.accounts[userID]
+}
+
+func (db *billingDB) GetBillingAccountByCustomer(customerID string) types.BillingAccount {
+	for _, account := range db.accounts {
+		if account.CustomerID == customerID {
+			return account
+		}
+	}
+	return types.BillingAccount{}
+}
+
+func (db *billingDB) SaveBillingAccount(account *types.BillingAccount, plan string) error {
+	db.accounts[account.UserID] = *account
+	if plan != "" {
+		user := db.users[account.UserID]
+		user.Plan = plan
+		db.users[account.UserID] = user
+	}
+	return nil
+}
+
+func (db *billingDB) GetBillingAccountsPastDue(before time.Time) []types.BillingAccount {
+	var accounts []types.BillingAccount
+	for _, account := range db.accounts {
+		if account.PastDueSince != nil && !account.PastDueSince.After(before) && account.DowngradedAt == nil {
+			accounts = append(accounts, account)
+		}
+	}
+	return accounts
+}
+
+func (db *billingDB) GetNotificationPreference(userID uuid.UUID, event string) (types.NotificationPreference, bool) {
+	return types.NotificationPreference{}, false
+}
+
+func (db *billingDB) CreateNotification(notification *types.Notification) error {
+	db.notifications = append(db.notifications, notification.Type)
+	return nil
+}
+
+func TestBilling(t *testing.T) {
+	s, admin, _, user := newAdminTestServer(t)
+	db := &billingDB{adminDB: admin, accounts: map[uuid.UUID]types.BillingAccount{}}
+	s.db = db
+	s.hub = realtime.NewHub(0)
+
+	if resp := adminRequest(t, s, user, "POST", "/api/v1/billing/checkout-session", ""); resp.StatusCode != fiber.StatusServiceUnavailable {
+		t.Fatalf("expected status 503 without billing; got %d", resp.StatusCode)
+	}
+
+	provider := &fakeBilling{events: map[string]billing.Event{}}
+	s.billing = provider
+	s.config.Billing.GraceDays = 7
+	s.config.Billing.StripeWebhookSecret = "whsec"
+
+	if resp := adminRequest(t, s, user, "POST", "/api/v1/billing/portal", ""); resp.StatusCode != fiber.StatusNotFound {
+		t.Fatalf("expected status 404 for the portal before a checkout; got %d", resp.StatusCode)
+	}
+	for range 2 {
+		resp := adminRequest(t, s, user, "POST", "/api/v1/billing/checkout-session", "")
+		var session billing.Session
+		json.NewDecoder(resp.Body).Decode(&session)
+		if resp.StatusCode != fiber.StatusCreated || session.URL != "https://checkout.example.com/cus_1" {
+			t.Fatalf("expected the checkout started; got %d %+v", resp.StatusCode, session)
+		}
+	}
+	if provider.customers != 1 {
+		t.Errorf("expected the customer created once; got %d", provider.customers)
+	}
+
+	webhook := func(id, secret string) int {
+		payload := `{"id":"` + id + `"}`
+		req, _ := http.NewRequest("POST", "/api/v1/billing/stripe-webhook", strings.NewReader(payload))
+		timestamp, signature := signWebhook(payload, secret, time.Now())
+		req.Header.Set("Stripe-Signature", "t="+timestamp+",v1="+signature)
+		resp, err := s.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+	event := func(id, status string, created time.Time) {
+		provider.events[id] = billing.Event{ID: id, Type: billing.EventSubscriptionUpdated, Created: created,
+			Subscription: &billing.Subscription{ID: "sub_1", CustomerID: "cus_1", Status: status, CurrentPeriodEnd: created.AddDate(0, 1, 0)}}
+	}
+	plan := func() string {
+		return db.users[user.ID].Plan
+	}
+
+	start := time.Now().Add(-time.Hour)
+	event("evt_active", "active", start)
+	if status := webhook("evt_active", "whsec_other"); status != fiber.StatusUnauthorized {
+		t.Fatalf("expected a forged event refused; got %d", status)
+	}
+	if status := webhook("evt_active", "whsec"); status != fiber.StatusOK || plan() != "pro" {
+		t.Fatalf("expected the user moved to the pro plan; got %d %q", status, plan())
+	}
+	if resp := adminRequest(t, s, user, "POST", "/api/v1/billing/checkout-session", ""); resp.StatusCode != fiber.StatusConflict {
+		t.Errorf("expected a second subscription refused; got %d", resp.StatusCode)
+	}
+
+	// An older event delivered late is ignored, a duplicate is skipped
+	event("evt_stale", "canceled", start.Add(-time.Minute))
+	event("evt_failed", "past_due", start.Add(time.Minute))
+	for _, id := range []string{"evt_stale", "evt_failed", "evt_failed"} {
+		if status := webhook(id, "whsec"); status != fiber.StatusOK {
+			t.Fatalf("expected %s acknowledged; got %d", id, status)
+		}
+	}
+	if plan() != "pro" || len(db.notifications) != 1 || db.notifications[0] != "billing_payment_failed" {
+		t.Fatalf("expected the user kept on the pro plan and notified once; got %q %v", plan(), db.notifications)
+	}
+
+	resp := adminRequest(t, s, user, "GET", "/api/v1/billing/status", "")
+	var status types.BillingStatus
+	json.NewDecoder(resp.Body).Decode(&status)
+	if status.Plan != "pro" || !status.Enabled || status.Status != "past_due" || status.DowngradeAt == nil ||
+		!status.DowngradeAt.Equal(start.Add(time.Minute).AddDate(0, 0, 7)) {
+		t.Errorf("unexpected status: %+v", status)
+	}
+
+	// The user is downgraded once the grace period is over
+	if err := s.downgradeUnpaid(start.AddDate(0, 0, 6)); err != nil || plan() != "pro" {
+		t.Fatalf("expected the user kept on the pro plan during the grace period; got %q %v", plan(), err)
+	}
+	if err := s.downgradeUnpaid(start.AddDate(0, 0, 8)); err != nil || plan() != "free" {
+		t.Fatalf("expected the user downgraded; got %q %v", plan(), err)
+	}
+	if len(db.notifications) != 2 || db.notifications[1] != "billing_downgraded" {
+		t.Errorf("expected the user notified of the downgrade; got %v", db.notifications)
+	}
+
+	// Paying again restores the pro plan
+	event("evt_paid", "active", start.Add(2*time.Minute))
+	if status := webhook("evt_paid", "whsec"); status != fiber.StatusOK || plan() != "pro" || db.accounts[user.ID].PastDueSince != nil {
+		t.Fatalf("expected the user back on the pro plan; got %d %q", status, plan())
+	}
+	provider.events["evt_deleted"] = billing.Event{ID: "evt_deleted", Type: billing.EventSubscriptionDeleted, Created: start.Add(3 * time.Minute),
+		Subscription: &billing.Subscription{ID: "sub_1", CustomerID: "cus_1", Status: "canceled"}}
+	if status := webhook("evt_deleted", "whsec"); status != fiber.StatusOK || plan() != "free" {
+		t.Errorf("expected the user moved to the free plan once canceled; got %d %q", status, plan())
+	}
+}
@@ -0,0 +1,464 @@
+package server
+
+import (
+	"FinMa/internal/i18n"
+	"FinMa/types"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	// upcomingBillsDays is how far GET /api/v1/bills/upcoming looks ahead.
+	upcomingBillsDays = 30
+	// billOverdueLookbackDays is how long after its due date an unpaid
+	// occurrence is still notified as overdue.
+	billOverdueLookbackDays = 30
+)
+
+// calendarDate returns the day of t in loc as a UTC date, the way the due
+// dates of the bills are stored.
+func calendarDate(t time.Time, loc *time.Location) time.Time {
+	local := t.In(loc)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// billDueDates returns the due dates of the bill between from and to, both
+// included. Monthly due days are clamped to the month length.
+func billDueDates(bill types.Bill, from, to time.Time) []time.Time {
+	var dates []time.Time
+	if bill.DueDay == 0 {
+		for _, date := range bill.DueDates {
+			if !date.Before(from) && !date.After(to) {
+				dates = append(dates, date)
+			}
+		}
+		sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+		return dates
+	}
+
+	for month := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC); !month.After(to); month = month.AddDate(0, 1, 0) {
+		date := clampedDate(month.Year(), month.Month(), bill.DueDay, time.UTC)
+		if !date.Before(from) && !date.After(to) {
+			dates = append(dates, date)
+		}
+	}
+	return dates
+}
+
+// billMatches tells whether the expense pays the bill: its description
+// contains the merchant of the bill, it is paid from the account of the
+// bill if it has one, and its amount is within the tolerance.
+func billMatches(bill types.Bill, transaction types.Transaction) bool {
+	if transaction.Type != "expense" || bill.Merchant == "" {
+		return false
+	}
+	if bill.BankAccountID != nil && *bill.BankAccountID != transaction.BankAccountID {
+		return false
+	}
+	if !strings.Contains(strings.ToLower(transaction.Description), strings.ToLower(bill.Merchant)) {
+		return false
+	}
+	difference := transaction.Amount.Unbound().Minor - bill.Amount.Unbound().Minor
+	return max(difference, -difference) <= bill.Amount.Unbound().Mul(bill.Tolerance/100).Minor
+}
+
+// upcomingBills lists the occurrences of the bills due in the days days
+// starting today, by due date, with their payment.
+func upcomingBills(bills []types.Bill, payments []types.BillPayment, today time.Time, days int) []types.BillOccurrence {
+	type key struct {
+		billID  uuid.UUID
+		dueDate string
+	}
+	paid := make(map[key]types.BillPayment, len(payments))
+	for _, payment := range payments {
+		paid[key{payment.BillID, payment.DueDate.Format(time.DateOnly)}] = payment
+	}
+
+	occurrences := []types.BillOccurrence{}
+	for _, bill := range bills {
+		for _, dueDate := range billDueDates(bill, today, today.AddDate(0, 0, days)) {
+			occurrence := types.BillOccurrence{
+				BillID:  bill.ID,
+				Name:    bill.Name,
+				Amount:  bill.Amount,
+				DueDate: dueDate,
+				Autopay: bill.Autopay,
+				Status:  "unpaid",
+			}
+			if payment, ok := paid[key{bill.ID, dueDate.Format(time.DateOnly)}]; ok && payment.PaidAt != nil {
+				occurrence.Status = "paid"
+				occurrence.PaidAt = payment.PaidAt
+				occurrence.TransactionID = payment.TransactionID
+			}
+			occurrences = append(occurrences, occurrence)
+		}
+	}
+
+	sort.SliceStable(occurrences, func(i, j int) bool {
+		return occurrences[i].DueDate.Before(occurrences[j].DueDate)
+	})
+	return occurrences
+}
+
+// matchBillPayments is called after a transaction change is committed. An
+// expense matching a bill pays the first unpaid occurrence due in the month
+// of the expense. Edited expenses are matched again, deleted ones no longer
+// pay anything.
+func (s *FiberServer) matchBillPayments(previous, current *types.Transaction) {
+	if previous != nil {
+		if err := s.db.UnmarkBillPaid(previous.ID); err != nil {
+			log.Error("Error reopening bill payments: ", err)
+			return
+		}
+	}
+	if current == nil || current.Type != "expense" {
+		return
+	}
+
+	for _, bill := range s.db.GetBillsForTransaction(current) {
+		if !billMatches(bill, *current) {
+			continue
+		}
+
+		date := calendarDate(current.Date, userLocation(bill.User))
+		monthStart := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+		for _, dueDate := range billDueDates(bill, monthStart, monthStart.AddDate(0, 1, -1)) {
+			paid, err := s.db.MarkBillPaid(bill.ID, dueDate, current.ID, time.Now())
+			if err != nil {
+				log.Error("Error marking bill as paid: ", err)
+				break
+			}
+			if paid {
+				break
+			}
+		}
+	}
+}
+
+// StartBillReminders periodically notifies the users of their bills due
+// soon, and once of the bills left unpaid past their due date.
+func (s *FiberServer) StartBillReminders(interval time.Duration) {
+	s.every("bill_reminders", interval, func(now time.Time) error {
+		s.sendBillReminders(now)
+		return nil
+	})
+}
+
+func (s *FiberServer) sendBillReminders(now time.Time) {
+	for _, bill := range s.db.GetAllBills() {
+		today := calendarDate(now, userLocation(bill.User))
+
+		if !bill.Autopay && bill.ReminderDays > 0 {
+			for _, dueDate := range billDueDates(bill, today, today.AddDate(0, 0, bill.ReminderDays)) {
+				s.notifyBill(bill, dueDate, "reminder", now)
+			}
+		}
+
+		created := calendarDate(bill.CreatedAt, userLocation(bill.User))
+		for _, dueDate := range billDueDates(bill, today.AddDate(0, 0, -billOverdueLookbackDays), today.AddDate(0, 0, -1)) {
+			if !dueDate.Before(created) {
+				s.notifyBill(bill, dueDate, "overdue", now)
+			}
+		}
+	}
+}
+
+// notifyBill sends the reminder or the overdue notification of an
+// occurrence of the bill, unless it is paid or was already notified.
+func (s *FiberServer) notifyBill(bill types.Bill, dueDate time.Time, kind string, now time.Time) {
+	claimed, err := s.db.ClaimBillNotification(bill.ID, dueDate, kind, now)
+	if err != nil {
+		log.Error("Error recording bill notification: ", err)
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	event := "bill_due"
+	if kind == "overdue" {
+		event = "bill_overdue"
+	}
+
+	err = s.Notify(context.Background(), bill.UserID, event, NotificationPayload{
+		Params: i18n.Params{"bill": bill.Name, "amount": i18n.Amount(bill.Amount.Float64()), "due_date": dueDate},
+		Details: fiber.Map{
+			"bill_id":  bill.ID,
+			"name":     bill.Name,
+			"amount":   bill.Amount,
+			"due_date": dueDate.Format(time.DateOnly),
+		},
+	})
+	if err != nil {
+		log.Error("Error notifying bill: ", err)
+	}
+}
+
+// parseBillSchedule validates the due day or the explicit schedule of a
+// bill, exactly one of them must be set.
+func parseBillSchedule(dueDay int, dueDates []string) (types.Dates, error) {
+	if dueDay != 0 && len(dueDates) > 0 {
+		return nil, errors.New("due_day and due_dates cannot be combined")
+	}
+	if dueDay != 0 {
+		if dueDay < 1 || dueDay > 31 {
+			return nil, errors.New("due_day must be between 1 and 31")
+		}
+		return nil, nil
+	}
+	if len(dueDates) == 0 {
+		return nil, errors.New("due_day or due_dates is required")
+	}
+
+	dates := make(types.Dates, 0, len(dueDates))
+	for _, value := range dueDates {
+		date, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid due date %q, expected YYYY-MM-DD", value)
+		}
+		dates = append(dates, date)
+	}
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+	return dates, nil
+}
+
+// findUserBill returns the bill from the route params if the user owns it.
+func (s *FiberServer) findUserBill(user types.User, id string) (types.Bill, bool) {
+	bill := s.db.GetBillByID(id)
+	if bill.ID == uuid.Nil || bill.UserID != user.ID {
+		return types.Bill{}, false
+	}
+	return bill, true
+}
+
+// CreateBill creates a bill for the authenticated user, due on due_day every
+// month or on the dates of due_dates (YYYY-MM-DD).
+func (s *FiberServer) CreateBill(c *fiber.Ctx) error {
+	type CreateBillRequest struct {
+		Name          string      `json:"name"`
+		Amount        types.Money `json:"amount"`
+		DueDay        int         `json:"due_day"`
+		DueDates      []string    `json:"due_dates"`
+		Merchant      string      `json:"merchant"`
+		Tolerance     *float64    `json:"tolerance"`
+		Category      string      `json:"category"`
+		ReminderDays  *int        `json:"reminder_days"`
+		Autopay       bool        `json:"autopay"`
+		BankAccountID *uuid.UUID  `json:"bank_account_id"`
+	}
+
+	var body CreateBillRequest
+	if err := c.BodyParser(&body); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+
+	name := strings.TrimSpace(body.Name)
+	if name == "" {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Bill name is required")
+	}
+	if body.Amount.Sign() <= 0 {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Amount must be positive")
+	}
+	if body.Category != "" && !isValidCategory(body.Category) {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid category")
+	}
+
+	dueDates, err := parseBillSchedule(body.DueDay, body.DueDates)
+	if err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, err.Error())
+	}
+
+	user := c.Locals("user").(types.User)
+	bill := &types.Bill{
+		ID:           uuid.New(),
+		Name:         name,
+		Amount:       body.Amount,
+		DueDay:       body.DueDay,
+		DueDates:     dueDates,
+		Merchant:     strings.TrimSpace(body.Merchant),
+		Tolerance:    5,
+		Category:     body.Category,
+		ReminderDays: 3,
+		Autopay:      body.Autopay,
+		UserID:       user.ID,
+	}
+
+	if body.Tolerance != nil {
+		if *body.Tolerance < 0 || *body.Tolerance > 100 {
+			return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Tolerance must be a percentage between 0 and 100")
+		}
+		bill.Tolerance = *body.Tolerance
+	}
+	if body.ReminderDays != nil {
+		if *body.ReminderDays < 0 || *body.ReminderDays > 31 {
+			return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Reminder days must be between 0 and 31")
+		}
+		bill.ReminderDays = *body.ReminderDays
+	}
+
+	if body.BankAccountID != nil {
+		if _, ok := s.findUserBankAccount(user, body.BankAccountID.String(), "viewer"); !ok {
+			return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Bank account not found")
+		}
+		bill.BankAccountID = body.BankAccountID
+	}
+
+	if err := s.db.CreateBill(bill); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not create bill")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(bill)
+}
+
+// GetBills lists the bills of the user.
+func (s *FiberServer) GetBills(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	return c.JSON(s.db.GetBills(&user))
+}
+
+// GetBill returns a bill.
+func (s *FiberServer) GetBill(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	bill, ok := s.findUserBill(user, c.Params("id"))
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Bill not found")
+	}
+
+	return c.JSON(bill)
+}
+
+// GetUpcomingBills lists the bills due in the next 30 days, in the timezone
+// of the user, with whether each occurrence was paid.
+func (s *FiberServer) GetUpcomingBills(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	bills := s.db.GetBills(&user)
+
+	ids := make([]uuid.UUID, 0, len(bills))
+	for _, bill := range bills {
+		ids = append(ids, bill.ID)
+	}
+
+	today := calendarDate(time.Now(), userLocation(user))
+	payments := s.db.GetBillPayments(ids, today, today.AddDate(0, 0, upcomingBillsDays))
+
+	return c.JSON(upcomingBills(bills, payments, today, upcomingBillsDays))
+}
+
+// UpdateBill updates the fields of a bill present in the body. Setting
+// due_day replaces the explicit schedule and the other way around.
+func (s *FiberServer) UpdateBill(c *fiber.Ctx) error {
+	type UpdateBillRequest struct {
+		Name          *string      `json:"name"`
+		Amount        *types.Money `json:"amount"`
+		DueDay        *int         `json:"due_day"`
+		DueDates      []string     `json:"due_dates"`
+		Merchant      *string      `json:"merchant"`
+		Tolerance     *float64     `json:"tolerance"`
+		Category      *string      `json:"category"`
+		ReminderDays  *int         `json:"reminder_days"`
+		Autopay       *bool        `json:"autopay"`
+		BankAccountID *uuid.UUID   `json:"bank_account_id"`
+	}
+
+	var body UpdateBillRequest
+	if err := c.BodyParser(&body); err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+
+	user := c.Locals("user").(types.User)
+	bill, ok := s.findUserBill(user, c.Params("id"))
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Bill not found")
+	}
+
+	if body.Name != nil {
+		if bill.Name = strings.TrimSpace(*body.Name); bill.Name == "" {
+			return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Bill name is required")
+		}
+	}
+	if body.Amount != nil {
+		if body.Amount.Sign() <= 0 {
+			return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Amount must be positive")
+		}
+		bill.Amount = *body.Amount
+	}
+
+	if body.DueDay != nil || body.DueDates != nil {
+		dueDay := 0
+		if body.DueDay != nil {
+			dueDay = *body.DueDay
+		}
+		dueDates, err := parseBillSchedule(dueDay, body.DueDates)
+		if err != nil {
+			return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, err.Error())
+		}
+		bill.DueDay = dueDay
+		bill.DueDates = dueDates
+	}
+
+	if body.Merchant != nil {
+		bill.Merchant = strings.TrimSpace(*body.Merchant)
+	}
+	if body.Tolerance != nil {
+		if *body.Tolerance < 0 || *body.Tolerance > 100 {
+			return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Tolerance must be a percentage between 0 and 100")
+		}
+		bill.Tolerance = *body.Tolerance
+	}
+	if body.Category != nil {
+		if *body.Category != "" && !isValidCategory(*body.Category) {
+			return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid category")
+		}
+		bill.Category = *body.Category
+	}
+	if body.ReminderDays != nil {
+		if *body.ReminderDays < 0 || *body.ReminderDays > 31 {
+			return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Reminder days must be between 0 and 31")
+		}
+		bill.ReminderDays = *body.ReminderDays
+	}
+	if body.Autopay != nil {
+		bill.Autopay = *body.Autopay
+	}
+
+	if body.BankAccountID != nil {
+		if _, ok := s.findUserBankAccount(user, body.BankAccountID.String(), "viewer"); !ok {
+			return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Bank account not found")
+		}
+		bill.BankAccountID = body.BankAccountID
+	}
+
+	if err := s.db.UpdateBill(&bill); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not update bill")
+	}
+
+	return c.JSON(bill)
+}
+
+// DeleteBill deletes a bill and its payment history, the matched
+// transactions are kept.
+func (s *FiberServer) DeleteBill(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	bill, ok := s.findUserBill(user, c.Params("id"))
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Bill not found")
+	}
+
+	if err := s.db.DeleteBill(&bill); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not delete bill")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
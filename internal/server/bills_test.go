@@ -0,0 +1,73 @@
+package server
+
+import (
+	"FinMa/types"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestBillDueDates(t *testing.T) {
+	monthly := types.Bill{DueDay: 31}
+	dates := billDueDates(monthly, day(2024, time.January, 15), day(2024, time.April, 15))
+	expected := []time.Time{day(2024, time.January, 31), day(2024, time.February, 29), day(2024, time.March, 31)}
+	if len(dates) != len(expected) {
+		t.Fatalf("expected %v; got %v", expected, dates)
+	}
+	for i := range expected {
+		if !dates[i].Equal(expected[i]) {
+			t.Errorf("expected due date %v; got %v", expected[i], dates[i])
+		}
+	}
+
+	scheduled := types.Bill{DueDates: types.Dates{day(2024, time.June, 1), day(2024, time.March, 1), day(2024, time.September, 1)}}
+	dates = billDueDates(scheduled, day(2024, time.March, 1), day(2024, time.June, 1))
+	if len(dates) != 2 || !dates[0].Equal(day(2024, time.March, 1)) || !dates[1].Equal(day(2024, time.June, 1)) {
+		t.Errorf("expected the explicit dates in the range, sorted; got %v", dates)
+	}
+}
+
+func TestBillMatches(t *testing.T) {
+	account := uuid.New()
+	bill := types.Bill{Merchant: "Netflix", Amount: money(15.99), Tolerance: 5, BankAccountID: &account}
+
+	tests := []struct {
+		name        string
+		transaction types.Transaction
+		expected    bool
+	}{
+		{"same amount", types.Transaction{Type: "expense", Description: "NETFLIX.COM", Amount: money(15.99), BankAccountID: account}, true},
+		{"within tolerance", types.Transaction{Type: "expense", Description: "netflix", Amount: money(16.75), BankAccountID: account}, true},
+		{"over tolerance", types.Transaction{Type: "expense", Description: "netflix", Amount: money(17.99), BankAccountID: account}, false},
+		{"other merchant", types.Transaction{Type: "expense", Description: "Spotify", Amount: money(15.99), BankAccountID: account}, false},
+		{"other account", types.Transaction{Type: "expense", Description: "Netflix", Amount: money(15.99), BankAccountID: uuid.New()}, false},
+		{"refund", types.Transaction{Type: "income", Description: "Netflix", Amount: money(15.99), BankAccountID: account}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if matched := billMatches(bill, tt.transaction); matched != tt.expected {
+				t.Errorf("expected match %v; got %v", tt.expected, matched)
+			}
+		})
+	}
+}
+
+func TestUpcomingBills(t *testing.T) {
+	rent := types.Bill{ID: uuid.New(), Name: "Rent", Amount: money(900), DueDay: 1}
+	phone := types.Bill{ID: uuid.New(), Name: "Phone", Amount: money(20), DueDay: 20}
+	paidAt := day(2024, time.May, 30)
+	payments := []types.BillPayment{{BillID: rent.ID, DueDate: day(2024, time.June, 1), PaidAt: &paidAt}}
+
+	occurrences := upcomingBills([]types.Bill{rent, phone}, payments, day(2024, time.May, 15), 30)
+	if len(occurrences) != 2 {
+		t.Fatalf("expected 2 occurrences; got %+v", occurrences)
+	}
+	if occurrences[0].Name != "Phone" || occurrences[0].Status != "unpaid" {
+		t.Errorf("expected the unpaid phone bill first; got %+v", occurrences[0])
+	}
+	if occurrences[1].Name != "Rent" || occurrences[1].Status != "paid" || occurrences[1].PaidAt == nil {
+		t.Errorf("expected the paid rent second; got %+v", occurrences[1])
+	}
+}
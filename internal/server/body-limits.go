@@ -0,0 +1,74 @@
+package server
+
+import (
+	"FinMa/internal/i18n"
+	"fmt"
+	"io"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// uploadPaths are the routes receiving files, given the upload body limit.
+// Their handlers read the multipart forms with c.MultipartForm, which
+// streams the files to temporary files rather than holding them in memory.
+var uploadPaths = []string{
+	APIPrefix + "/users/me/avatar",
+	"/api/users/me/avatar",
+	APIPrefix + "/import/",
+	"/api/import/",
+	APIPrefix + "/admin/restore",
+	"/api/admin/restore",
+}
+
+// bodyLimits answers a 413 to the requests whose body is larger than the
+// limit of their route, before the body is read. The server streams the
+// bodies past the limit of the JSON routes, so that an upload is never held
+// in memory whole; a chunked body of unknown length is read up to the limit.
+func bodyLimits(limit, uploadLimit int) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		max := limit
+		if hasPathPrefix(c.Path(), uploadPaths) {
+			max = uploadLimit
+		}
+
+		length := c.Request().Header.ContentLength()
+		if length > max {
+			return bodyTooLarge(c, max)
+		}
+		if stream := c.Context().RequestBodyStream(); length < 0 && stream != nil {
+			body, err := io.ReadAll(io.LimitReader(stream, int64(max)+1))
+			if err != nil {
+				return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Could not read the request body")
+			}
+			if len(body) > max {
+				return bodyTooLarge(c, max)
+			}
+			c.Request().SetBody(body)
+		}
+
+		return c.Next()
+	}
+}
+
+// bodyTooLarge refuses the request without reading the rest of its body,
+// the connection is closed once answered.
+func bodyTooLarge(c *fiber.Ctx, max int) error {
+	c.Context().SetConnectionClose()
+	c.Request().CloseBodyStream()
+	limit := formatBytes(max)
+	return NewAPIError(fiber.StatusRequestEntityTooLarge, CodePayloadTooLarge,
+		fmt.Sprintf("The request body is larger than the %s allowed", limit)).
+		WithParams(i18n.Params{"limit": limit})
+}
+
+// formatBytes returns the size in the largest unit dividing it.
+func formatBytes(size int) string {
+	switch {
+	case size >= 1<<20 && size%(1<<20) == 0:
+		return fmt.Sprintf("%d MB", size>>20)
+	case size >= 1<<10 && size%(1<<10) == 0:
+		return fmt.Sprintf("%d KB", size>>10)
+	default:
+		return fmt.Sprintf("%d bytes", size)
+	}
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func newBodyLimitTestApp(t *testing.T) *fiber.App {
+	previous := uploadPaths
+	uploadPaths = []string{"/upload"}
+	t.Cleanup(func() { uploadPaths = previous })
+
+	app := fiber.New(fiber.Config{
+		ErrorHandler:                 errorHandler,
+		BodyLimit:                    1024,
+		StreamRequestBody:            true,
+		DisablePreParseMultipartForm: true,
+	})
+	app.Use(bodyLimits(1024, 4096))
+	echo := func(c *fiber.Ctx) error {
+		return c.SendString(string(c.Body()))
+	}
+	app.Post("/json", echo)
+	app.Post("/upload", echo)
+	return app
+}
+
+func TestBodyLimits(t *testing.T) {
+	app := newBodyLimitTestApp(t)
+
+	tests := []struct {
+		name     string
+		path     string
+		size     int
+		chunked  bool
+		expected int
+		message  string
+	}{
+		{"under the limit", "/json", 1000, false, fiber.StatusOK, ""},
+		{"over the limit", "/json", 2000, false, fiber.StatusRequestEntityTooLarge, "The request body is larger than the 1 KB allowed"},
+		{"chunked under the limit", "/json", 1000, true, fiber.StatusOK, ""},
+		{"chunked over the limit", "/json", 2000, true, fiber.StatusRequestEntityTooLarge, "The request body is larger than the 1 KB allowed"},
+		{"upload", "/upload", 3000, false, fiber.StatusOK, ""},
+		{"upload over the limit", "/upload", 5000, false, fiber.StatusRequestEntityTooLarge, "The request body is larger than the 4 KB allowed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := strings.Repeat("a", tt.size)
+			req, err := http.NewRequest("POST", tt.path, strings.NewReader(body))
+			if err != nil {
+				t.Fatalf("error creating request. Err: %v", err)
+			}
+			if tt.chunked {
+				req.ContentLength = -1
+				req.TransferEncoding = []string{"chunked"}
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("error making request to server. Err: %v", err)
+			}
+			if resp.StatusCode != tt.expected {
+				t.Fatalf("expected status %d; got %d", tt.expected, resp.StatusCode)
+			}
+
+			if tt.expected == fiber.StatusOK {
+				echoed, _ := io.ReadAll(resp.Body)
+				if len(echoed) != tt.size {
+					t.Errorf("expected the %d bytes of the body; got %d", tt.size, len(echoed))
+				}
+				return
+			}
+			var envelope struct {
+				Error struct {
+					Code    string `json:"code"`
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+				t.Fatalf("error decoding the error. Err: %v", err)
+			}
+			if envelope.Error.Code != CodePayloadTooLarge || envelope.Error.Message != tt.message {
+				t.Errorf("expected %s %q; got %+v", CodePayloadTooLarge, tt.message, envelope.Error)
+			}
+		})
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[int]string{1 << 20: "1 MB", 25 << 20: "25 MB", 2048: "2 KB", 1536: "1536 bytes", 1000: "1000 bytes"}
+	for size, expected := range tests {
+		if got := formatBytes(size); got != expected {
+			t.Errorf("%d: expected %q; got %q", size, expected, got)
+		}
+	}
+}
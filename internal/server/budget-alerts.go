@@ -0,0 +1,160 @@
+package server
+
+import (
+	"FinMa/internal/i18n"
+	"FinMa/types"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// budgetName returns the name of the budget, or a label built from its
+// categories when it has none.
+func budgetName(budget types.Budget) string {
+	if budget.Name != "" {
+		return budget.Name
+	}
+
+	categories := strings.Join(budget.CategoryNames(), ", ")
+	if !budget.ExcludeCategories {
+		return categories
+	}
+	if categories == "" {
+		return "Everything"
+	}
+	return "Everything except " + categories
+}
+
+// parseAlertThresholds validates the alert thresholds of a budget, removes
+// duplicates and sorts them.
+func parseAlertThresholds(thresholds []int) (types.Thresholds, error) {
+	seen := make(map[int]bool, len(thresholds))
+	parsed := make(types.Thresholds, 0, len(thresholds))
+	for _, threshold := range thresholds {
+		if threshold <= 0 || threshold > 1000 {
+			return nil, fmt.Errorf("invalid alert threshold %d, it must be a percentage between 1 and 1000", threshold)
+		}
+		if !seen[threshold] {
+			seen[threshold] = true
+			parsed = append(parsed, threshold)
+		}
+	}
+	sort.Ints(parsed)
+	return parsed, nil
+}
+
+// budgetAlertChanges compares the percentage spent with the thresholds of a
+// budget and the ones already notified in the period. It returns the
+// thresholds to notify, and the ones to re-arm when the spending dropped
+// back below them and re-arming is on.
+func budgetAlertChanges(thresholds []int, percentage float64, notified []int, rearm bool) (notify []int, rearmed []int) {
+	sent := make(map[int]bool, len(notified))
+	for _, threshold := range notified {
+		sent[threshold] = true
+	}
+
+	for _, threshold := range thresholds {
+		crossed := percentage >= float64(threshold)
+		switch {
+		case crossed && !sent[threshold]:
+			notify = append(notify, threshold)
+		case !crossed && sent[threshold] && rearm:
+			rearmed = append(rearmed, threshold)
+		}
+	}
+	return notify, rearmed
+}
+
+// checkBudgetAlerts is called after a transaction change is committed and
+// evaluates the budgets the transaction was, or now is, counted against.
+func (s *FiberServer) checkBudgetAlerts(previous, current *types.Transaction) {
+	budgetIDs := make(map[uuid.UUID]bool)
+	for _, transaction := range []*types.Transaction{previous, current} {
+		if transaction != nil && transaction.BudgetID != nil {
+			budgetIDs[*transaction.BudgetID] = true
+		}
+	}
+
+	for budgetID := range budgetIDs {
+		s.evaluateBudgetAlerts(budgetID, time.Now())
+	}
+}
+
+// evaluateBudgetAlerts notifies the thresholds of the budget crossed in its
+// current period, each one once per period.
+func (s *FiberServer) evaluateBudgetAlerts(budgetID uuid.UUID, now time.Time) {
+	budget := s.db.GetBudgetByID(budgetID.String())
+	if budget.ID == uuid.Nil || len(budget.AlertThresholds) == 0 {
+		return
+	}
+
+	user := s.db.GetUserByID(budget.UserID)
+	progress, err := s.budgetsProgress(user, []types.Budget{budget}, now)
+	if err != nil {
+		log.Error("Error computing budget progress: ", err)
+		return
+	}
+	if len(progress) == 0 {
+		return
+	}
+	current := progress[0]
+
+	notified := s.db.GetBudgetAlerts(budget.ID, current.PeriodStart)
+	notify, rearmed := budgetAlertChanges(budget.AlertThresholds, current.Percentage, notified, budget.RearmAlerts)
+
+	if err := s.db.DeleteBudgetAlerts(budget.ID, current.PeriodStart, rearmed); err != nil {
+		log.Error("Error re-arming budget alerts: ", err)
+	}
+
+	for _, threshold := range notify {
+		created, err := s.db.CreateBudgetAlert(&types.BudgetAlert{
+			BudgetID:    budget.ID,
+			Threshold:   threshold,
+			PeriodStart: current.PeriodStart,
+		})
+		if err != nil {
+			log.Error("Error recording budget alert: ", err)
+			continue
+		}
+		if !created {
+			continue
+		}
+
+		s.notifyBudgetThreshold(budget, current, threshold)
+	}
+}
+
+// notifyBudgetThreshold notifies the owner of the budget of a crossed threshold.
+func (s *FiberServer) notifyBudgetThreshold(budget types.Budget, progress types.BudgetProgress, threshold int) {
+	name := budgetName(budget)
+	event := "budget_threshold"
+	if threshold >= 100 {
+		event = "budget_exceeded"
+	}
+
+	err := s.Notify(context.Background(), budget.UserID, event, NotificationPayload{
+		Params: i18n.Params{
+			"budget":     name,
+			"percentage": i18n.Percent(progress.Percentage),
+			"remaining":  i18n.Amount(progress.Remaining.Float64()),
+		},
+		Details: fiber.Map{
+			"budget_id":   budget.ID,
+			"budget_name": name,
+			"threshold":   threshold,
+			"percentage":  progress.Percentage,
+			"remaining":   progress.Remaining,
+			"limit":       progress.EffectiveLimit,
+			"period_end":  progress.PeriodEnd,
+		},
+	})
+	if err != nil {
+		log.Error("Error notifying budget alert: ", err)
+	}
+}
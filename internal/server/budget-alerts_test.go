@@ -0,0 +1,74 @@
+package server
+
+import (
+	"FinMa/types"
+	"reflect"
+	"testing"
+)
+
+func TestBudgetAlertChanges(t *testing.T) {
+	thresholds := []int{50, 80, 100}
+
+	tests := []struct {
+		name            string
+		percentage      float64
+		notified        []int
+		rearm           bool
+		expectedNotify  []int
+		expectedRearmed []int
+	}{
+		{"below every threshold", 20, nil, false, nil, nil},
+		{"crosses the first threshold", 55, nil, false, []int{50}, nil},
+		{"crosses several thresholds at once", 120, nil, false, []int{50, 80, 100}, nil},
+		{"already notified", 85, []int{50, 80}, false, nil, nil},
+		{"drops back below without re-arming", 60, []int{50, 80}, false, nil, nil},
+		{"drops back below with re-arming", 60, []int{50, 80}, true, nil, []int{80}},
+		{"crosses again after re-arming", 82, []int{50}, true, []int{80}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notify, rearmed := budgetAlertChanges(thresholds, tt.percentage, tt.notified, tt.rearm)
+			if !reflect.DeepEqual(notify, tt.expectedNotify) || !reflect.DeepEqual(rearmed, tt.expectedRearmed) {
+				t.Errorf("expected (%v, %v); got (%v, %v)", tt.expectedNotify, tt.expectedRearmed, notify, rearmed)
+			}
+		})
+	}
+}
+
+func TestParseAlertThresholds(t *testing.T) {
+	thresholds, err := parseAlertThresholds([]int{100, 50, 100, 75})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(thresholds, types.Thresholds{50, 75, 100}) {
+		t.Errorf("expected [50 75 100]; got %v", thresholds)
+	}
+
+	if _, err := parseAlertThresholds([]int{0}); err == nil {
+		t.Error("expected an error for a zero threshold")
+	}
+}
+
+func TestBudgetName(t *testing.T) {
+	categories := []types.BudgetCategory{{Category: "bills"}, {Category: "food"}}
+
+	tests := []struct {
+		name     string
+		budget   types.Budget
+		expected string
+	}{
+		{"named", types.Budget{Name: "Groceries", Categories: categories}, "Groceries"},
+		{"categories", types.Budget{Categories: categories}, "bills, food"},
+		{"excluded categories", types.Budget{Categories: categories, ExcludeCategories: true}, "Everything except bills, food"},
+		{"everything", types.Budget{ExcludeCategories: true}, "Everything"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if name := budgetName(tt.budget); name != tt.expected {
+				t.Errorf("expected %q; got %q", tt.expected, name)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"FinMa/constants"
+	"FinMa/types"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// parseBudgetCategories validates the categories of a budget and removes
+// duplicates. A budget excluding categories may have none to cover everything.
+func parseBudgetCategories(categories []string, exclude bool) ([]types.BudgetCategory, error) {
+	seen := make(map[string]bool, len(categories))
+	for _, category := range categories {
+		if !isValidCategory(category) {
+			return nil, fmt.Errorf("invalid budget category %q", category)
+		}
+		seen[category] = true
+	}
+
+	if len(seen) == 0 && !exclude {
+		return nil, errors.New("a budget needs at least one category")
+	}
+
+	names := make([]string, 0, len(seen))
+	for category := range seen {
+		names = append(names, category)
+	}
+	sort.Strings(names)
+
+	budgetCategories := make([]types.BudgetCategory, 0, len(names))
+	for _, name := range names {
+		budgetCategories = append(budgetCategories, types.BudgetCategory{Category: name})
+	}
+	return budgetCategories, nil
+}
+
+// budgetCategorySet returns the categories whose expenses the budget counts.
+func budgetCategorySet(budget types.Budget) map[string]bool {
+	listed := make(map[string]bool, len(budget.Categories))
+	for _, category := range budget.Categories {
+		listed[category.Category] = true
+	}
+
+	set := make(map[string]bool)
+	for _, category := range constants.GetTransactionCategories() {
+		if listed[category] != budget.ExcludeCategories {
+			set[category] = true
+		}
+	}
+	return set
+}
+
+// budgetEnd returns the end of the last period of a custom budget, or the
+// zero time for recurring budgets which never end.
+func budgetEnd(budget types.Budget) time.Time {
+	if budget.PeriodType != "custom" {
+		return time.Time{}
+	}
+	return budget.EndDate.AddDate(0, 0, 1)
+}
+
+// budgetsOverlap reports whether two budgets of the same period type run at
+// the same time over a common category. Such budgets are refused: an expense
+// is only counted against one budget, so the other would silently miss it.
+// Budgets of different period types (a monthly and a yearly one) may share
+// categories, the most recently started budget counts the expense.
+func budgetsOverlap(a, b types.Budget) bool {
+	if a.PeriodType != b.PeriodType {
+		return false
+	}
+
+	bEnd := budgetEnd(b)
+	if bEnd.IsZero() {
+		bEnd = maxTime
+	}
+	return budgetRunsBetween(a, b.StartDate, bEnd) && budgetsShareCategories(a, b)
+}
+
+// maxTime is used as the end of a range without end.
+var maxTime = time.Date(9999, time.December, 31, 0, 0, 0, 0, time.UTC)
+
+// budgetRunsBetween reports whether the budget runs at some point in [from, to).
+func budgetRunsBetween(budget types.Budget, from, to time.Time) bool {
+	end := budgetEnd(budget)
+	return budget.StartDate.Before(to) && (end.IsZero() || end.After(from))
+}
+
+// budgetsShareCategories reports whether two budgets count the expenses of a
+// common category.
+func budgetsShareCategories(a, b types.Budget) bool {
+	aSet := budgetCategorySet(a)
+	for category := range budgetCategorySet(b) {
+		if aSet[category] {
+			return true
+		}
+	}
+	return false
+}
+
+// findOverlappingBudget returns another budget of the user overlapping the
+// given one, if any.
+func (s *FiberServer) findOverlappingBudget(user types.User, budget types.Budget) (types.Budget, bool) {
+	for _, other := range s.db.GetBudgets(&user) {
+		if other.ID != budget.ID && budgetsOverlap(budget, other) {
+			return other, true
+		}
+	}
+	return types.Budget{}, false
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"FinMa/types"
+	"testing"
+	"time"
+)
+
+func TestParseBudgetCategories(t *testing.T) {
+	categories, err := parseBudgetCategories([]string{"food", "bills", "food"}, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(categories) != 2 || categories[0].Category != "bills" || categories[1].Category != "food" {
+		t.Errorf("expected [bills food]; got %v", categories)
+	}
+
+	if _, err := parseBudgetCategories([]string{"gifts"}, false); err == nil {
+		t.Error("expected an error for an unknown category")
+	}
+	if _, err := parseBudgetCategories(nil, false); err == nil {
+		t.Error("expected an error for a budget without categories")
+	}
+	if _, err := parseBudgetCategories(nil, true); err != nil {
+		t.Errorf("expected a budget excluding nothing to be valid; got %v", err)
+	}
+}
+
+func TestBudgetsOverlap(t *testing.T) {
+	budget := func(periodType string, exclude bool, categories ...string) types.Budget {
+		b := types.Budget{
+			PeriodType:        periodType,
+			ExcludeCategories: exclude,
+			StartDate:         day(2024, time.January, 1),
+			EndDate:           day(2024, time.January, 31),
+		}
+		for _, category := range categories {
+			b.Categories = append(b.Categories, types.BudgetCategory{Category: category})
+		}
+		return b
+	}
+
+	later := budget("custom", false, "food")
+	later.StartDate = day(2024, time.February, 1)
+	later.EndDate = day(2024, time.February, 29)
+
+	tests := []struct {
+		name     string
+		a, b     types.Budget
+		expected bool
+	}{
+		{"same category", budget("monthly", false, "food"), budget("monthly", false, "food", "bills"), true},
+		{"disjoint categories", budget("monthly", false, "food"), budget("monthly", false, "bills"), false},
+		{"different period types", budget("monthly", false, "food"), budget("yearly", false, "food"), false},
+		{"everything except food", budget("monthly", true, "food"), budget("monthly", false, "bills"), true},
+		{"except covers the rest", budget("monthly", true, "food"), budget("monthly", false, "food"), false},
+		{"consecutive custom budgets", budget("custom", false, "food"), later, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if overlap := budgetsOverlap(tt.a, tt.b); overlap != tt.expected {
+				t.Errorf("expected %v; got %v", tt.expected, overlap)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package server
+
+import (
+	"FinMa/types"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// forecastTrailingDays is the window of recent spending weighted more
+	// than the period average in the daily run rate.
+	forecastTrailingDays = 14
+	// forecastTrailingWeight is the weight of the trailing window rate.
+	forecastTrailingWeight = 0.7
+	// forecastRecurringLookback is how far back recurring expenses are
+	// searched to find their last occurrence.
+	forecastRecurringLookback = 3 // Months
+)
+
+// upcomingRecurring returns the occurrences of the recurring expenses due in
+// (now, end), by due date. Expenses are grouped by description. Occurrences
+// already recorded with a future date are used as is, otherwise the expense
+// is assumed to recur monthly from its last occurrence.
+func upcomingRecurring(expenses []types.Transaction, now, end time.Time) []types.CommittedExpense {
+	type recurring struct {
+		last     *types.Transaction
+		upcoming []types.CommittedExpense
+	}
+
+	groups := make(map[string]*recurring)
+	keys := make([]string, 0)
+	for i := range expenses {
+		expense := &expenses[i]
+		key := strings.ToLower(strings.TrimSpace(expense.Description))
+		group, ok := groups[key]
+		if !ok {
+			group = &recurring{}
+			groups[key] = group
+			keys = append(keys, key)
+		}
+
+		switch {
+		case !expense.Date.After(now):
+			if group.last == nil || expense.Date.After(group.last.Date) {
+				group.last = expense
+			}
+		case expense.Date.Before(end):
+			group.upcoming = append(group.upcoming, types.CommittedExpense{
+				Description: expense.Description,
+				Amount:      expense.Amount.Unbound(),
+				DueDate:     expense.Date,
+			})
+		}
+	}
+
+	committed := make([]types.CommittedExpense, 0)
+	for _, key := range keys {
+		group := groups[key]
+		if len(group.upcoming) > 0 || group.last == nil {
+			committed = append(committed, group.upcoming...)
+			continue
+		}
+
+		for months := 1; ; months++ {
+			due := group.last.Date.AddDate(0, months, 0)
+			if !due.Before(end) {
+				break
+			}
+			if due.After(now) {
+				committed = append(committed, types.CommittedExpense{
+					Description: group.last.Description,
+					Amount:      group.last.Amount.Unbound(),
+					DueDate:     due,
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(committed, func(i, j int) bool {
+		return committed[i].DueDate.Before(committed[j].DueDate)
+	})
+	return committed
+}
+
+// weightedDailyRate blends the daily spending of the trailing window with the
+// average of the period so far, the trailing window weighing more.
+func weightedDailyRate(periodSpent, periodDays, trailingSpent, trailingDays float64) float64 {
+	if periodDays <= 0 {
+		return 0
+	}
+	periodRate := periodSpent / periodDays
+	if trailingDays <= 0 {
+		return periodRate
+	}
+	return forecastTrailingWeight*trailingSpent/trailingDays + (1-forecastTrailingWeight)*periodRate
+}
+
+// daysBetween returns the number of days between from and to, as a fraction.
+func daysBetween(from, to time.Time) float64 {
+	return to.Sub(from).Hours() / 24
+}
+
+// forecastBudget projects the spending of the current period of a budget:
+// the committed expenses are added on their due date and the daily rate is
+// extrapolated in between. The exhaustion date is the first time the
+// projected spending reaches the effective limit before the period end. The
+// amounts extrapolated from the rate are rounded to the minor unit of the
+// currency of the budget, the others summed exactly.
+func forecastBudget(progress types.BudgetProgress, spent types.Money, committed []types.CommittedExpense, rate float64, now time.Time) types.BudgetForecast {
+	limit := progress.EffectiveLimit.Unbound()
+	end := progress.PeriodEnd
+	forecast := types.BudgetForecast{
+		BudgetID:       progress.BudgetID,
+		PeriodEnd:      end,
+		Limit:          limit,
+		SpentToDate:    spent.Unbound(),
+		CommittedItems: committed,
+		DailyRate:      types.MoneyFromFloat(rate, "").Round(progress.Currency),
+	}
+
+	var committedTotal int64
+	for _, expense := range committed {
+		committedTotal += expense.Amount.Unbound().Minor
+	}
+	extrapolated := types.MoneyFromFloat(rate*math.Max(0, daysBetween(now, end)), "").Round(progress.Currency)
+	total := forecast.SpentToDate.Minor + committedTotal + extrapolated.Minor
+
+	forecast.Committed = types.NewMoney(committedTotal, "")
+	forecast.Extrapolated = extrapolated
+	forecast.ProjectedTotal = types.NewMoney(total, "")
+	forecast.ProjectedOvershoot = types.NewMoney(max(0, total-limit.Minor), "")
+
+	if limit.Sign() <= 0 || total < limit.Minor {
+		return forecast
+	}
+	if forecast.SpentToDate.Minor >= limit.Minor {
+		forecast.ExhaustionDate = &now
+		return forecast
+	}
+
+	// The period end closes the last stretch of extrapolation, the date
+	// search runs on whole units
+	steps := append(append([]types.CommittedExpense{}, committed...), types.CommittedExpense{DueDate: end})
+	cursor, cumulative := now, spent.Float64()
+	for _, expense := range steps {
+		// The run rate alone reaches the limit before the next expense
+		if rate > 0 {
+			reached := cursor.Add(time.Duration((limit.Float64() - cumulative) / rate * 24 * float64(time.Hour)))
+			if !reached.After(expense.DueDate) {
+				forecast.ExhaustionDate = &reached
+				return forecast
+			}
+		}
+
+		cumulative += rate*daysBetween(cursor, expense.DueDate) + expense.Amount.Float64()
+		cursor = expense.DueDate
+		if cumulative >= limit.Float64() {
+			due := expense.DueDate
+			forecast.ExhaustionDate = &due
+			return forecast
+		}
+	}
+	return forecast
+}
+
+// budgetForecast projects the spending of a budget at the end of the period
+// of its progress. The run rate only accounts for the expenses that are not
+// recurring, recurring ones are committed on their next due date instead.
+func (s *FiberServer) budgetForecast(budget types.Budget, progress types.BudgetProgress, now time.Time) (*types.BudgetForecast, error) {
+	start := progress.PeriodStart
+	trailingStart := now.AddDate(0, 0, -forecastTrailingDays)
+	if trailingStart.Before(start) {
+		trailingStart = start
+	}
+
+	spent, err := s.db.GetBudgetsSpent([]types.BudgetPeriodRange{
+		{BudgetID: budget.ID, Start: start, End: now},
+		{BudgetID: budget.ID, Start: trailingStart, End: now},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	recurring := s.db.GetBudgetRecurringExpenses(&budget, start.AddDate(0, -forecastRecurringLookback, 0))
+	periodSpent, trailingSpent := spent[0].Float64(), spent[1].Float64()
+	for _, expense := range recurring {
+		if expense.BudgetID == nil || *expense.BudgetID != budget.ID || !expense.Date.Before(now) {
+			continue
+		}
+		if !expense.Date.Before(start) {
+			periodSpent -= expense.Amount.Float64()
+		}
+		if !expense.Date.Before(trailingStart) {
+			trailingSpent -= expense.Amount.Float64()
+		}
+	}
+
+	rate := weightedDailyRate(
+		math.Max(0, periodSpent), math.Max(1, daysBetween(start, now)),
+		math.Max(0, trailingSpent), math.Max(1, daysBetween(trailingStart, now)),
+	)
+	forecast := forecastBudget(progress, spent[0], upcomingRecurring(recurring, now, progress.PeriodEnd), rate, now)
+	return &forecast, nil
+}
+
+// GetBudgetForecast projects the spending of a budget at the end of its
+// current period. Nothing is stored, the forecast is computed on each call.
+func (s *FiberServer) GetBudgetForecast(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	budget, ok := s.findUserBudget(user, c.Params("id"), false)
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Budget not found")
+	}
+	s.fetchMissingRates(c, user)
+
+	now := time.Now()
+	progress, err := s.budgetsProgress(user, []types.Budget{budget}, now)
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not compute budget forecast")
+	}
+
+	if len(progress) == 0 {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Budget is not running")
+	}
+
+	forecast, err := s.budgetForecast(budget, progress[0], now)
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not compute budget forecast")
+	}
+
+	return c.JSON(forecast)
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"FinMa/types"
+	"testing"
+)
+
+func TestUpcomingRecurring(t *testing.T) {
+	now := day(2024, 4, 10)
+	end := day(2024, 5, 1)
+	expenses := []types.Transaction{
+		{Description: "Rent", Amount: money(800), Date: day(2024, 2, 15)},
+		{Description: "rent ", Amount: money(800), Date: day(2024, 3, 15)},
+		// Already paid this month, next one is due in May
+		{Description: "Gym", Amount: money(30), Date: day(2024, 4, 2)},
+		// Recorded ahead of time, used instead of the monthly assumption
+		{Description: "Phone", Amount: money(20), Date: day(2024, 3, 5)},
+		{Description: "Phone", Amount: money(25), Date: day(2024, 4, 28)},
+	}
+
+	committed := upcomingRecurring(expenses, now, end)
+	if len(committed) != 2 {
+		t.Fatalf("expected 2 committed expenses; got %+v", committed)
+	}
+	if !committed[0].DueDate.Equal(day(2024, 4, 15)) || committed[0].Amount != money(800) {
+		t.Errorf("expected the rent due on April 15; got %+v", committed[0])
+	}
+	if !committed[1].DueDate.Equal(day(2024, 4, 28)) || committed[1].Amount != money(25) {
+		t.Errorf("expected the recorded phone bill; got %+v", committed[1])
+	}
+}
+
+func TestWeightedDailyRate(t *testing.T) {
+	tests := []struct {
+		name                                                 string
+		periodSpent, periodDays, trailingSpent, trailingDays float64
+		expected                                             float64
+	}{
+		{"steady", 200, 20, 140, 14, 10},
+		{"recent surge", 200, 20, 280, 14, 17},
+		{"no trailing window", 200, 20, 0, 0, 10},
+		{"period not started", 0, 0, 0, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate := weightedDailyRate(tt.periodSpent, tt.periodDays, tt.trailingSpent, tt.trailingDays)
+			if rate < tt.expected-1e-9 || rate > tt.expected+1e-9 {
+				t.Errorf("expected %v; got %v", tt.expected, rate)
+			}
+		})
+	}
+}
+
+func TestForecastBudget(t *testing.T) {
+	now := day(2024, 4, 11)
+	progress := types.BudgetProgress{EffectiveLimit: money(500), PeriodEnd: day(2024, 5, 1)}
+	committed := []types.CommittedExpense{{Description: "Rent", Amount: money(100), DueDate: day(2024, 4, 15)}}
+
+	// 200 + 100 committed + 20 days at 5 a day
+	forecast := forecastBudget(progress, money(200), committed, 5, now)
+	if forecast.Committed != money(100) || forecast.Extrapolated != money(100) || forecast.ProjectedTotal != money(400) {
+		t.Errorf("unexpected projection %+v", forecast)
+	}
+	if forecast.ProjectedOvershoot != money(0) || forecast.ExhaustionDate != nil {
+		t.Errorf("expected the budget to hold; got %+v", forecast)
+	}
+
+	// 200 + 20 a day reaches 280 on April 15, then 380 with the rent,
+	// and the remaining 120 takes 6 more days
+	forecast = forecastBudget(progress, money(200), committed, 20, now)
+	if forecast.ProjectedOvershoot != money(200) {
+		t.Errorf("expected an overshoot of 200; got %v", forecast.ProjectedOvershoot)
+	}
+	if forecast.ExhaustionDate == nil || !forecast.ExhaustionDate.Equal(day(2024, 4, 21)) {
+		t.Errorf("expected the budget to be exhausted on April 21; got %v", forecast.ExhaustionDate)
+	}
+
+	// The committed expense alone exhausts the budget on its due date
+	committed = []types.CommittedExpense{{Description: "Rent", Amount: money(400), DueDate: day(2024, 4, 15)}}
+	forecast = forecastBudget(progress, money(200), committed, 0, now)
+	if forecast.ExhaustionDate == nil || !forecast.ExhaustionDate.Equal(day(2024, 4, 15)) {
+		t.Errorf("expected the budget to be exhausted on April 15; got %v", forecast.ExhaustionDate)
+	}
+
+	forecast = forecastBudget(progress, money(600), nil, 0, now)
+	if forecast.ExhaustionDate == nil || !forecast.ExhaustionDate.Equal(now) {
+		t.Errorf("expected an already exhausted budget; got %v", forecast.ExhaustionDate)
+	}
+}
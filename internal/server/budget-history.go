@@ -0,0 +1,238 @@
+package server
+
+import (
+	"FinMa/types"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// periodRollover returns what the closed period carries over to the next
+// one: the full balance in envelope budgeting mode, the balance down to the
+// rollover floor for rollover budgets, nothing otherwise. The floor caps
+// the negative rollover as a share of the limit, so that one overspent
+// period cannot wipe out the following ones.
+func periodRollover(budget types.Budget, previous types.ClosedBudgetPeriod, envelope bool, floor float64) types.Money {
+	limit, spent := []types.Money{previous.EffectiveLimit}, []types.Money{previous.Spent}
+	switch {
+	case envelope:
+		return envelopeRollover(limit, spent)
+	case budget.Rollover:
+		minimum := budget.Amount.Unbound().Mul(-floor)
+		return carryOver(limit, spent, &minimum)
+	}
+	return types.Money{}
+}
+
+// chainClosedPeriods builds the records of consecutive closed periods of a
+// budget, following previous (nil for the first period of the budget).
+// limits are the base limits of the periods.
+func chainClosedPeriods(budget types.Budget, previous *types.ClosedBudgetPeriod, periods []types.BudgetPeriodRange, limits, spent []types.Money, envelope bool, floor float64) []types.ClosedBudgetPeriod {
+	records := make([]types.ClosedBudgetPeriod, 0, len(periods))
+	for i, period := range periods {
+		var rollover types.Money
+		if previous != nil {
+			rollover = periodRollover(budget, *previous, envelope, floor)
+		}
+
+		record := types.ClosedBudgetPeriod{
+			BudgetID:       budget.ID,
+			PeriodStart:    period.Start,
+			PeriodEnd:      period.End,
+			Limit:          limits[i].Unbound(),
+			EffectiveLimit: types.NewMoney(limits[i].Unbound().Minor+rollover.Minor, ""),
+			Spent:          spent[i].Unbound(),
+			Status:         "within_budget",
+		}
+		if record.Spent.Minor > record.EffectiveLimit.Minor {
+			record.Status = "over_budget"
+		}
+
+		records = append(records, record)
+		previous = &records[len(records)-1]
+	}
+	return records
+}
+
+// amendedClosedPeriods compares the stored records with the recomputed ones,
+// period by period, and returns the recomputed records that changed, marked
+// as amended at now.
+func amendedClosedPeriods(stored, recomputed []types.ClosedBudgetPeriod, now time.Time) []types.ClosedBudgetPeriod {
+	var amended []types.ClosedBudgetPeriod
+	for i, record := range recomputed {
+		previous := stored[i]
+		if record.Spent == previous.Spent && record.EffectiveLimit == previous.EffectiveLimit && record.Limit == previous.Limit {
+			continue
+		}
+
+		record.CreatedAt = previous.CreatedAt
+		record.Amended = true
+		record.AmendedAt = &now
+		amended = append(amended, record)
+	}
+	return amended
+}
+
+// closeBudgetPeriods records the periods of the budgets that closed since
+// their last recorded period, in the timezone and budgeting mode of the
+// user, and returns the last closed period of each budget. Only budgets
+// with newly closed periods cost a query.
+func (s *FiberServer) closeBudgetPeriods(user types.User, budgets []types.Budget, now time.Time) (map[uuid.UUID]types.ClosedBudgetPeriod, error) {
+	loc := userLocation(user)
+	envelope := user.BudgetingMode == "envelope"
+
+	ids := make([]uuid.UUID, 0, len(budgets))
+	for _, budget := range budgets {
+		ids = append(ids, budget.ID)
+	}
+	latest, err := s.db.GetLatestClosedBudgetPeriods(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	type pendingBudget struct {
+		budget   types.Budget
+		from, to int // Range of its periods
+	}
+
+	var periods []types.BudgetPeriodRange
+	var limits []types.Money
+	var pending []pendingBudget
+	for _, budget := range budgets {
+		closed := budgetClosedPeriods(budget, now, loc)
+		if last, ok := latest[budget.ID]; ok {
+			for len(closed) > 0 && closed[0].Start.Before(last.PeriodEnd) {
+				closed = closed[1:]
+			}
+		}
+		if len(closed) == 0 {
+			continue
+		}
+
+		pending = append(pending, pendingBudget{budget: budget, from: len(periods), to: len(periods) + len(closed)})
+		periods = append(periods, closed...)
+		for range closed {
+			limits = append(limits, budget.Amount)
+		}
+	}
+	if len(pending) == 0 {
+		return latest, nil
+	}
+
+	spent, err := s.db.GetBudgetsSpent(periods)
+	if err != nil {
+		return nil, err
+	}
+	if envelope {
+		if limits, err = s.db.GetBudgetsAllocated(periods); err != nil {
+			return nil, err
+		}
+	}
+
+	var records []types.ClosedBudgetPeriod
+	for _, p := range pending {
+		var previous *types.ClosedBudgetPeriod
+		if last, ok := latest[p.budget.ID]; ok {
+			previous = &last
+		}
+
+		chain := chainClosedPeriods(p.budget, previous, periods[p.from:p.to], limits[p.from:p.to], spent[p.from:p.to], envelope, s.config.Features.BudgetRolloverFloor)
+		records = append(records, chain...)
+		latest[p.budget.ID] = chain[len(chain)-1]
+	}
+
+	if err := s.db.CreateClosedBudgetPeriods(records); err != nil {
+		return nil, err
+	}
+	return latest, nil
+}
+
+// amendBudgetPeriods recomputes the recorded closed periods of the budget
+// from the one containing date on, as the rollover ripples through the
+// following periods, and stores those that changed as amended.
+func (s *FiberServer) amendBudgetPeriods(budgetID uuid.UUID, date time.Time, now time.Time) {
+	records := s.db.GetClosedBudgetPeriods(budgetID)
+	first := -1
+	for i, record := range records {
+		if !date.Before(record.PeriodStart) && date.Before(record.PeriodEnd) {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return
+	}
+
+	budget := s.db.GetBudgetByID(budgetID.String())
+	if budget.ID == uuid.Nil {
+		return
+	}
+	envelope := s.db.GetUserByID(budget.UserID).BudgetingMode == "envelope"
+
+	var previous *types.ClosedBudgetPeriod
+	if first > 0 {
+		previous = &records[first-1]
+	}
+
+	stored := records[first:]
+	periods := make([]types.BudgetPeriodRange, 0, len(stored))
+	limits := make([]types.Money, 0, len(stored))
+	for _, record := range stored {
+		periods = append(periods, types.BudgetPeriodRange{BudgetID: budgetID, Start: record.PeriodStart, End: record.PeriodEnd})
+		limits = append(limits, record.Limit)
+	}
+
+	spent, err := s.db.GetBudgetsSpent(periods)
+	if err != nil {
+		log.Error("Error amending closed budget periods: ", err)
+		return
+	}
+	if envelope {
+		if limits, err = s.db.GetBudgetsAllocated(periods); err != nil {
+			log.Error("Error amending closed budget periods: ", err)
+			return
+		}
+	}
+
+	recomputed := chainClosedPeriods(budget, previous, periods, limits, spent, envelope, s.config.Features.BudgetRolloverFloor)
+	if err := s.db.UpdateClosedBudgetPeriods(amendedClosedPeriods(stored, recomputed, now)); err != nil {
+		log.Error("Error amending closed budget periods: ", err)
+	}
+}
+
+// checkClosedBudgetPeriods is called after a transaction change is committed
+// and amends the closed periods the transaction was, or now is, dated in.
+func (s *FiberServer) checkClosedBudgetPeriods(previous, current *types.Transaction) {
+	now := time.Now()
+	for _, transaction := range []*types.Transaction{previous, current} {
+		if transaction != nil && transaction.BudgetID != nil {
+			s.amendBudgetPeriods(*transaction.BudgetID, transaction.Date, now)
+		}
+	}
+}
+
+// GetBudgetHistory returns how each closed period of a budget finished,
+// newest first. Periods closed since the last read are recorded first.
+func (s *FiberServer) GetBudgetHistory(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	budget, ok := s.findUserBudget(user, c.Params("id"), false)
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Budget not found")
+	}
+	s.fetchMissingRates(c, user)
+
+	if _, err := s.closeBudgetPeriods(user, []types.Budget{budget}, time.Now()); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not record closed budget periods")
+	}
+
+	records := s.db.GetClosedBudgetPeriods(budget.ID)
+	history := make([]types.ClosedBudgetPeriod, 0, len(records))
+	for i := len(records) - 1; i >= 0; i-- {
+		history = append(history, records[i])
+	}
+
+	return c.JSON(history)
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"FinMa/types"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestChainClosedPeriods(t *testing.T) {
+	budget := types.Budget{ID: uuid.New(), Amount: money(500), Rollover: true}
+	periods := []types.BudgetPeriodRange{
+		{Start: day(2024, time.January, 1), End: day(2024, time.February, 1)},
+		{Start: day(2024, time.February, 1), End: day(2024, time.March, 1)},
+		{Start: day(2024, time.March, 1), End: day(2024, time.April, 1)},
+	}
+	limits := moneys(500, 500, 500)
+
+	records := chainClosedPeriods(budget, nil, periods, limits, moneys(450, 480, 600), false, defaultRolloverFloor)
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records; got %d", len(records))
+	}
+	if records[1].EffectiveLimit != money(550) || records[2].EffectiveLimit != money(570) {
+		t.Errorf("expected the rollover to chain; got %v and %v", records[1].EffectiveLimit, records[2].EffectiveLimit)
+	}
+	if records[1].Status != "within_budget" || records[2].Status != "over_budget" {
+		t.Errorf("unexpected statuses %s and %s", records[1].Status, records[2].Status)
+	}
+
+	// The chain matches the rollover recomputed from the raw spending
+	if rollover := periodRollover(budget, records[2], false, defaultRolloverFloor); rollover != budgetRollover(money(500), moneys(450, 480, 600), defaultRolloverFloor) {
+		t.Errorf("expected the rollover from the records to match the recomputed one; got %v", rollover)
+	}
+
+	// Continuing from a recorded period
+	more := chainClosedPeriods(budget, &records[2], periods[:1], limits[:1], moneys(500), false, defaultRolloverFloor)
+	if more[0].EffectiveLimit != money(470) {
+		t.Errorf("expected the chain to continue from the last record; got %v", more[0].EffectiveLimit)
+	}
+
+	budget.Rollover = false
+	records = chainClosedPeriods(budget, nil, periods, limits, moneys(450, 480, 600), false, defaultRolloverFloor)
+	if records[2].EffectiveLimit != money(500) {
+		t.Errorf("expected no rollover; got %v", records[2].EffectiveLimit)
+	}
+
+	// Envelopes carry over their full balance, whatever the rollover setting
+	records = chainClosedPeriods(budget, nil, periods, moneys(100, 0, 200), moneys(1000, 0, 0), true, defaultRolloverFloor)
+	if records[2].EffectiveLimit != money(-700) {
+		t.Errorf("expected the envelope to carry the overspending; got %v", records[2].EffectiveLimit)
+	}
+}
+
+func TestAmendedClosedPeriods(t *testing.T) {
+	created := day(2024, time.February, 1)
+	now := day(2024, time.April, 10)
+	stored := []types.ClosedBudgetPeriod{
+		{Spent: money(450), EffectiveLimit: money(500), Limit: money(500), CreatedAt: created},
+		{Spent: money(480), EffectiveLimit: money(550), Limit: money(500), CreatedAt: created},
+	}
+	recomputed := []types.ClosedBudgetPeriod{
+		{Spent: money(450), EffectiveLimit: money(500), Limit: money(500)},
+		{Spent: money(520), EffectiveLimit: money(550), Limit: money(500)},
+	}
+
+	amended := amendedClosedPeriods(stored, recomputed, now)
+	if len(amended) != 1 {
+		t.Fatalf("expected 1 amended period; got %d", len(amended))
+	}
+	if !amended[0].Amended || amended[0].AmendedAt == nil || !amended[0].AmendedAt.Equal(now) {
+		t.Errorf("expected the period to be flagged as amended; got %+v", amended[0])
+	}
+	if !amended[0].CreatedAt.Equal(created) {
+		t.Errorf("expected the creation date to be kept; got %v", amended[0].CreatedAt)
+	}
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"FinMa/constants"
+	"FinMa/types"
+	"time"
+)
+
+func isValidBudgetPeriodType(periodType string) bool {
+	for _, t := range constants.GetBudgetPeriodTypes() {
+		if t == periodType {
+			return true
+		}
+	}
+	return false
+}
+
+// calendarPeriod returns the week, month or year containing at, in the given
+// timezone. Weeks start on weekStartDay (0 is Sunday) and may span two months.
+func calendarPeriod(periodType string, weekStartDay int, at time.Time, loc *time.Location) (time.Time, time.Time) {
+	local := at.In(loc)
+
+	switch periodType {
+	case "weekly":
+		day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+		start := day.AddDate(0, 0, -((int(local.Weekday()) - weekStartDay + 7) % 7))
+		return start, start.AddDate(0, 0, 7)
+	case "yearly":
+		start := time.Date(local.Year(), time.January, 1, 0, 0, 0, 0, loc)
+		return start, start.AddDate(1, 0, 0)
+	default:
+		start := time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, loc)
+		return start, start.AddDate(0, 1, 0)
+	}
+}
+
+// budgetPeriods returns the period settings of the budget, oldest first.
+// Budgets without history use their current period type from their start date.
+func budgetPeriods(budget types.Budget) []types.BudgetPeriod {
+	if len(budget.Periods) > 0 {
+		return budget.Periods
+	}
+	return []types.BudgetPeriod{{
+		PeriodType:    budget.PeriodType,
+		WeekStartDay:  budget.WeekStartDay,
+		EffectiveFrom: budget.StartDate,
+	}}
+}
+
+// budgetPeriodAt returns the period of the budget containing at, as a
+// half-open range [start, end). Custom budgets have a single period including
+// the whole end day. The first period starts on the budget start date, so a
+// yearly budget created mid-year starts with a partial year, and a period
+// setting changed mid-stream only applies from its effective date on.
+// ok is false when the budget is not running at that date.
+func budgetPeriodAt(budget types.Budget, at time.Time, loc *time.Location) (start time.Time, end time.Time, ok bool) {
+	if at.Before(budget.StartDate) {
+		return time.Time{}, time.Time{}, false
+	}
+
+	periods := budgetPeriods(budget)
+	current := 0
+	for i, period := range periods {
+		if !period.EffectiveFrom.After(at) {
+			current = i
+		}
+	}
+	period := periods[current]
+
+	if period.PeriodType == "custom" {
+		endDay := budget.EndDate.In(loc)
+		end = time.Date(endDay.Year(), endDay.Month(), endDay.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, 1)
+		if !at.Before(end) {
+			return time.Time{}, time.Time{}, false
+		}
+		return budget.StartDate, end, true
+	}
+
+	start, end = calendarPeriod(period.PeriodType, period.WeekStartDay, at, loc)
+	if start.Before(period.EffectiveFrom) {
+		start = period.EffectiveFrom
+	}
+	if start.Before(budget.StartDate) {
+		start = budget.StartDate
+	}
+	if current+1 < len(periods) && periods[current+1].EffectiveFrom.Before(end) {
+		end = periods[current+1].EffectiveFrom
+	}
+	return start, end, true
+}
+
+// budgetPeriodRanges returns the periods of the budget starting before
+// until, oldest first, from the budget creation.
+func budgetPeriodRanges(budget types.Budget, until time.Time, loc *time.Location) []types.BudgetPeriodRange {
+	var periods []types.BudgetPeriodRange
+
+	at := budget.StartDate
+	for at.Before(until) {
+		start, end, ok := budgetPeriodAt(budget, at, loc)
+		if !ok || !end.After(at) {
+			break
+		}
+		periods = append(periods, types.BudgetPeriodRange{BudgetID: budget.ID, Start: start, End: end})
+		at = end
+	}
+	return periods
+}
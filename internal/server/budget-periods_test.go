@@ -0,0 +1,105 @@
+package server
+
+import (
+	"FinMa/types"
+	"testing"
+	"time"
+)
+
+func TestBudgetPeriodAt(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip("timezone database not available")
+	}
+
+	tests := []struct {
+		name          string
+		budget        types.Budget
+		at            time.Time
+		loc           *time.Location
+		expectedStart time.Time
+		expectedEnd   time.Time
+		expectedOk    bool
+	}{
+		{
+			"weekly budget crossing a month boundary",
+			types.Budget{PeriodType: "weekly", WeekStartDay: int(time.Monday), StartDate: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)},
+			time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC),
+			time.UTC,
+			time.Date(2024, time.February, 26, 0, 0, 0, 0, time.UTC),
+			time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC),
+			true,
+		},
+		{
+			"yearly budget created mid-year",
+			types.Budget{PeriodType: "yearly", StartDate: time.Date(2024, time.June, 15, 0, 0, 0, 0, time.UTC)},
+			time.Date(2024, time.August, 1, 0, 0, 0, 0, time.UTC),
+			time.UTC,
+			time.Date(2024, time.June, 15, 0, 0, 0, 0, time.UTC),
+			time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC),
+			true,
+		},
+		{
+			"monthly budget in the user's timezone",
+			types.Budget{PeriodType: "monthly", StartDate: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)},
+			// Still February 29 in UTC, already March 1 in Paris
+			time.Date(2024, time.February, 29, 23, 30, 0, 0, time.UTC),
+			paris,
+			time.Date(2024, time.March, 1, 0, 0, 0, 0, paris),
+			time.Date(2024, time.April, 1, 0, 0, 0, 0, paris),
+			true,
+		},
+		{
+			"custom budget includes its end day",
+			types.Budget{PeriodType: "custom", StartDate: time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2024, time.May, 10, 0, 0, 0, 0, time.UTC)},
+			time.Date(2024, time.May, 10, 18, 0, 0, 0, time.UTC),
+			time.UTC,
+			time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2024, time.May, 11, 0, 0, 0, 0, time.UTC),
+			true,
+		},
+		{
+			"budget not started yet",
+			types.Budget{PeriodType: "monthly", StartDate: time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)},
+			time.Date(2024, time.April, 10, 0, 0, 0, 0, time.UTC),
+			time.UTC,
+			time.Time{},
+			time.Time{},
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, ok := budgetPeriodAt(tt.budget, tt.at, tt.loc)
+			if ok != tt.expectedOk {
+				t.Fatalf("expected ok %v; got %v", tt.expectedOk, ok)
+			}
+			if !start.Equal(tt.expectedStart) || !end.Equal(tt.expectedEnd) {
+				t.Errorf("expected [%v, %v); got [%v, %v)", tt.expectedStart, tt.expectedEnd, start, end)
+			}
+		})
+	}
+}
+
+func TestBudgetPeriodChangeKeepsHistory(t *testing.T) {
+	budget := types.Budget{
+		PeriodType: "weekly",
+		StartDate:  time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+		Periods: []types.BudgetPeriod{
+			{PeriodType: "monthly", EffectiveFrom: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)},
+			// Switched to weekly during March, effective from the end of March
+			{PeriodType: "weekly", WeekStartDay: int(time.Monday), EffectiveFrom: time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		},
+	}
+
+	start, end, _ := budgetPeriodAt(budget, time.Date(2024, time.February, 10, 0, 0, 0, 0, time.UTC), time.UTC)
+	if !start.Equal(time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)) || !end.Equal(time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected February to stay a monthly period; got [%v, %v)", start, end)
+	}
+
+	start, end, _ = budgetPeriodAt(budget, time.Date(2024, time.April, 3, 0, 0, 0, 0, time.UTC), time.UTC)
+	if !start.Equal(time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)) || !end.Equal(time.Date(2024, time.April, 8, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected a weekly period from April on; got [%v, %v)", start, end)
+	}
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"FinMa/types"
+	"math"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// budgetProgress compares the spending of a period with a linear burn-down
+// of the effective limit (the base plus the rollover): the budget is over
+// pace when more was spent than the share of the limit matching the elapsed
+// share of the period. The base is the budget amount, or what was allocated
+// to the period in envelope budgeting mode.
+func budgetProgress(budget types.Budget, start, end time.Time, base, spent, rollover types.Money, now time.Time) types.BudgetProgress {
+	limit := types.NewMoney(base.Unbound().Minor+rollover.Unbound().Minor, "")
+	spent = spent.Unbound()
+	progress := types.BudgetProgress{
+		BudgetID:          budget.ID,
+		Categories:        budget.CategoryNames(),
+		ExcludeCategories: budget.ExcludeCategories,
+		PeriodStart:       start,
+		PeriodEnd:         end,
+		Limit:             budget.Amount,
+		RolloverAmount:    rollover.Unbound(),
+		EffectiveLimit:    limit,
+		Spent:             spent,
+		Remaining:         types.NewMoney(limit.Minor-spent.Minor, ""),
+		DaysLeft:          int(math.Ceil(end.Sub(now).Hours() / 24)),
+		Pace:              "on_track",
+	}
+
+	if limit.Sign() > 0 {
+		progress.Percentage = math.Round(float64(spent.Minor)/float64(limit.Minor)*10000) / 100
+	}
+
+	elapsed := now.Sub(start).Seconds() / end.Sub(start).Seconds()
+	if spent.Minor > limit.Mul(math.Min(1, math.Max(0, elapsed))).Minor {
+		progress.Pace = "over_pace"
+	}
+
+	return progress
+}
+
+// budgetsProgress computes the progress of the budgets running at now, in
+// the timezone and budgeting mode of the user, with a single query for the
+// spending of every budget. The rollover comes from the record of the last
+// closed period, written on the fly for the periods that closed since the
+// last call. In envelope budgeting mode every budget is measured against
+// what was allocated to it, and its balance always carries over. The limit
+// of a budget is in the base currency of its owner, the expenses in other
+// currencies are converted at the rate of their day.
+func (s *FiberServer) budgetsProgress(user types.User, budgets []types.Budget, now time.Time) ([]types.BudgetProgress, error) {
+	loc := userLocation(user)
+	envelope := user.BudgetingMode == "envelope"
+
+	latest, err := s.closeBudgetPeriods(user, budgets, now)
+	if err != nil {
+		return nil, err
+	}
+
+	periods := make([]types.BudgetPeriodRange, 0, len(budgets))
+	running := make([]types.Budget, 0, len(budgets))
+	for _, budget := range budgets {
+		start, end, ok := budgetPeriodAt(budget, now, loc)
+		if !ok {
+			continue
+		}
+		periods = append(periods, types.BudgetPeriodRange{BudgetID: budget.ID, Start: start, End: end})
+		running = append(running, budget)
+	}
+
+	spent, err := s.db.GetBudgetsSpent(periods)
+	if err != nil {
+		return nil, err
+	}
+
+	limits := make([]types.Money, len(running))
+	for i, budget := range running {
+		limits[i] = budget.Amount
+	}
+	if envelope {
+		if limits, err = s.db.GetBudgetsAllocated(periods); err != nil {
+			return nil, err
+		}
+	}
+
+	currencies := map[uuid.UUID]string{user.ID: s.baseCurrency(user)}
+	progress := make([]types.BudgetProgress, 0, len(running))
+	for i, budget := range running {
+		var rollover types.Money
+		if last, ok := latest[budget.ID]; ok {
+			rollover = periodRollover(budget, last, envelope, s.config.Features.BudgetRolloverFloor)
+		}
+
+		current := budgetProgress(budget, periods[i].Start, periods[i].End, limits[i], spent[i], rollover, now)
+		// The household budgets of the other members are in their currency
+		if _, ok := currencies[budget.UserID]; !ok {
+			currencies[budget.UserID] = s.baseCurrency(s.db.GetUserByID(budget.UserID))
+		}
+		current.Currency = currencies[budget.UserID]
+		if envelope {
+			current.Allocated = &limits[i]
+		}
+		progress = append(progress, current)
+	}
+	return progress, nil
+}
+
+// GetBudgetProgress returns the progress of a budget in its current period.
+func (s *FiberServer) GetBudgetProgress(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	budget, ok := s.findUserBudget(user, c.Params("id"), false)
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Budget not found")
+	}
+	s.fetchMissingRates(c, user)
+
+	progress, err := s.budgetsProgress(user, []types.Budget{budget}, time.Now())
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not compute budget progress")
+	}
+
+	if len(progress) == 0 {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Budget is not running")
+	}
+
+	return c.JSON(progress[0])
+}
+
+// GetBudgetsProgress returns the progress of every running budget of the user.
+// The forecast of each budget is included with ?include=forecast.
+func (s *FiberServer) GetBudgetsProgress(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	budgets := s.db.GetBudgets(&user)
+	now := time.Now()
+	s.fetchMissingRates(c, user)
+
+	progress, err := s.budgetsProgress(user, budgets, now)
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not compute budget progress")
+	}
+
+	if c.Query("include") == "forecast" {
+		byID := make(map[uuid.UUID]types.Budget, len(budgets))
+		for _, budget := range budgets {
+			byID[budget.ID] = budget
+		}
+
+		for i := range progress {
+			progress[i].Forecast, err = s.budgetForecast(byID[progress[i].BudgetID], progress[i], now)
+			if err != nil {
+				log.Error(err)
+				return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not compute budget forecast")
+			}
+		}
+	}
+
+	return c.JSON(progress)
+}
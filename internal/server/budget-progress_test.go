@@ -0,0 +1,71 @@
+package server
+
+import (
+	"FinMa/types"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestBudgetProgress(t *testing.T) {
+	budget := types.Budget{ID: uuid.New(), Categories: []types.BudgetCategory{{Category: "food"}}, Amount: money(300)}
+	start := time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)
+	// A third of the period is elapsed
+	now := time.Date(2024, time.April, 11, 0, 0, 0, 0, time.UTC)
+
+	progress := budgetProgress(budget, start, end, budget.Amount, money(90), money(0), now)
+	if progress.Remaining != money(210) || progress.Percentage != 30 || progress.DaysLeft != 20 {
+		t.Errorf("unexpected progress %+v", progress)
+	}
+	if progress.Pace != "on_track" {
+		t.Errorf("expected on_track with 90 spent out of 100 expected; got %s", progress.Pace)
+	}
+
+	progress = budgetProgress(budget, start, end, budget.Amount, money(120), money(0), now)
+	if progress.Pace != "over_pace" {
+		t.Errorf("expected over_pace with 120 spent out of 100 expected; got %s", progress.Pace)
+	}
+
+	progress = budgetProgress(budget, start, end, budget.Amount, money(350), money(0), now)
+	if progress.Remaining != money(-50) || progress.Percentage != 116.67 {
+		t.Errorf("expected an overspent budget; got %+v", progress)
+	}
+
+	progress = budgetProgress(budget, start, end, budget.Amount, money(90), money(50), now)
+	if progress.Limit != money(300) || progress.EffectiveLimit != money(350) || progress.Remaining != money(260) {
+		t.Errorf("expected the rollover to increase the effective limit; got %+v", progress)
+	}
+
+	// In envelope budgeting mode the allocated amount replaces the limit
+	progress = budgetProgress(budget, start, end, money(100), money(90), money(20), now)
+	if progress.Limit != money(300) || progress.EffectiveLimit != money(120) || progress.Remaining != money(30) || progress.Percentage != 75 {
+		t.Errorf("expected the progress against the allocated amount; got %+v", progress)
+	}
+}
+
+// BenchmarkBudgetProgress measures the work done in Go for the budgets
+// progress endpoint: resolving the current period of each budget and
+// computing its progress.
+func BenchmarkBudgetProgress(b *testing.B) {
+	budgets := make([]types.Budget, 0, 50)
+	periodTypes := []string{"weekly", "monthly", "yearly"}
+	for i := 0; i < 50; i++ {
+		budgets = append(budgets, types.Budget{
+			ID:         uuid.New(),
+			Amount:     money(500),
+			PeriodType: periodTypes[i%len(periodTypes)],
+			StartDate:  time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC),
+		})
+	}
+	now := time.Date(2024, time.April, 11, 15, 0, 0, 0, time.UTC)
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, budget := range budgets {
+			start, end, _ := budgetPeriodAt(budget, now, time.UTC)
+			budgetProgress(budget, start, end, budget.Amount, money(120), money(0), now)
+		}
+	}
+}
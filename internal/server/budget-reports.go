@@ -0,0 +1,184 @@
+package server
+
+import (
+	"FinMa/types"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+)
+
+// budgetHistory is a budget with its periods up to now (or its deletion)
+// and what was spent in each of them.
+type budgetHistory struct {
+	budget  types.Budget
+	periods []types.BudgetPeriodRange
+	spent   []types.Money
+}
+
+// buildBudgetVsActual groups by period the budget periods ending after from.
+// The effective limit includes the rollover of the previous periods, so the
+// history of rollover budgets must start at their creation. floor caps the
+// negative rollover as a share of the limit. The totals are summed in
+// unbound minor units.
+func buildBudgetVsActual(histories []budgetHistory, from time.Time, floor float64) []types.BudgetVsActualPeriod {
+	type periodKey struct{ start, end int64 }
+	byPeriod := make(map[periodKey]*types.BudgetVsActualPeriod)
+
+	for _, history := range histories {
+		budget := history.budget
+		for i, period := range history.periods {
+			if !period.End.After(from) {
+				continue
+			}
+
+			limit := budget.Amount.Unbound()
+			if budget.Rollover {
+				limit = types.NewMoney(limit.Minor+budgetRollover(budget.Amount, history.spent[:i], floor).Minor, "")
+			}
+			actual := history.spent[i].Unbound()
+
+			key := periodKey{period.Start.Unix(), period.End.Unix()}
+			group, ok := byPeriod[key]
+			if !ok {
+				group = &types.BudgetVsActualPeriod{PeriodStart: period.Start, PeriodEnd: period.End}
+				byPeriod[key] = group
+			}
+
+			group.Budgets = append(group.Budgets, types.BudgetVsActual{
+				BudgetID:       budget.ID,
+				Name:           budgetName(budget),
+				Deleted:        budget.DeletedAt.Valid,
+				Limit:          budget.Amount,
+				EffectiveLimit: limit,
+				Actual:         actual,
+				Variance:       types.NewMoney(limit.Minor-actual.Minor, ""),
+			})
+			group.TotalLimit = types.NewMoney(group.TotalLimit.Minor+limit.Minor, "")
+			group.TotalActual = types.NewMoney(group.TotalActual.Minor+actual.Minor, "")
+			group.TotalVariance = types.NewMoney(group.TotalLimit.Minor-group.TotalActual.Minor, "")
+		}
+	}
+
+	periods := make([]types.BudgetVsActualPeriod, 0, len(byPeriod))
+	for _, group := range byPeriod {
+		periods = append(periods, *group)
+	}
+	sort.Slice(periods, func(i, j int) bool {
+		if !periods[i].PeriodStart.Equal(periods[j].PeriodStart) {
+			return periods[i].PeriodStart.Before(periods[j].PeriodStart)
+		}
+		return periods[i].PeriodEnd.Before(periods[j].PeriodEnd)
+	})
+	return periods
+}
+
+// GetBudgetVsActual returns, for each period of the last ?months=6 months,
+// the effective limit, the actual spending and the variance of every budget
+// running in it, with totals per period. Periods before a budget was created
+// are omitted, deleted budgets still appear for the periods they covered.
+// The spending of every period is read in a single grouped query. The CSV
+// holds a row per budget and period, the XLSX adds a sheet of the totals.
+func (s *FiberServer) GetBudgetVsActual(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+
+	months := c.QueryInt("months", 6)
+	if months <= 0 || months > 36 {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "months must be between 1 and 36")
+	}
+
+	return cachedSheetsReport(s, c, user, "budget_vs_actual", []string{strconv.Itoa(months)}, func() ([]types.BudgetVsActualPeriod, error) {
+		return s.computeBudgetVsActual(c, user, months)
+	}, budgetVsActualSheets)
+}
+
+// budgetVsActualRow is a budget in one of its periods, in CSV.
+type budgetVsActualRow struct {
+	PeriodStart time.Time `csv:"period_start" xlsx:"date"`
+	PeriodEnd   time.Time `csv:"period_end" xlsx:"date"`
+	types.BudgetVsActual
+}
+
+// budgetVsActualTotals are the totals of a period, in XLSX.
+type budgetVsActualTotals struct {
+	PeriodStart   time.Time   `csv:"period_start" xlsx:"date"`
+	PeriodEnd     time.Time   `csv:"period_end" xlsx:"date"`
+	TotalLimit    types.Money `csv:"total_limit" xlsx:"amount"`
+	TotalActual   types.Money `csv:"total_actual" xlsx:"amount"`
+	TotalVariance types.Money `csv:"total_variance" xlsx:"amount"`
+}
+
+// budgetVsActualSheets returns the budgets of every period, then the totals
+// of the periods.
+func budgetVsActualSheets(periods []types.BudgetVsActualPeriod) []xlsxSheet {
+	totals := make([]budgetVsActualTotals, len(periods))
+	for i, period := range periods {
+		totals[i] = budgetVsActualTotals{
+			PeriodStart:   period.PeriodStart,
+			PeriodEnd:     period.PeriodEnd,
+			TotalLimit:    period.TotalLimit,
+			TotalActual:   period.TotalActual,
+			TotalVariance: period.TotalVariance,
+		}
+	}
+	return []xlsxSheet{{"Budgets", budgetVsActualRows(periods)}, {"Periods", totals}}
+}
+
+// budgetVsActualRows returns a row per budget and period, the totals are
+// left to the spreadsheet.
+func budgetVsActualRows(periods []types.BudgetVsActualPeriod) any {
+	var rows []budgetVsActualRow
+	for _, period := range periods {
+		for _, budget := range period.Budgets {
+			rows = append(rows, budgetVsActualRow{PeriodStart: period.PeriodStart, PeriodEnd: period.PeriodEnd, BudgetVsActual: budget})
+		}
+	}
+	return rows
+}
+
+// computeBudgetVsActual computes the budgeted and spent amounts of the
+// budgets of the user over the last months.
+func (s *FiberServer) computeBudgetVsActual(c *fiber.Ctx, user types.User, months int) ([]types.BudgetVsActualPeriod, error) {
+	db := s.dbFor(c)
+
+	location := userLocation(user)
+	now := time.Now().In(location)
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, location).AddDate(0, -(months - 1), 0)
+
+	budgets := db.GetBudgetsForReport(&user, from)
+	histories := make([]budgetHistory, 0, len(budgets))
+	var periods []types.BudgetPeriodRange
+	for _, budget := range budgets {
+		until := now
+		if budget.DeletedAt.Valid && budget.DeletedAt.Time.Before(until) {
+			until = budget.DeletedAt.Time
+		}
+
+		ranges := budgetPeriodRanges(budget, until, location)
+		if !budget.Rollover {
+			// Without rollover the periods before the report are not needed
+			for len(ranges) > 0 && !ranges[0].End.After(from) {
+				ranges = ranges[1:]
+			}
+		}
+
+		histories = append(histories, budgetHistory{budget: budget, periods: ranges})
+		periods = append(periods, ranges...)
+	}
+
+	spent, err := db.GetBudgetsSpent(periods)
+	if err != nil {
+		log.Error(err)
+		return nil, NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not compute budget spending")
+	}
+
+	offset := 0
+	for i := range histories {
+		histories[i].spent = spent[offset : offset+len(histories[i].periods)]
+		offset += len(histories[i].periods)
+	}
+
+	return buildBudgetVsActual(histories, from, s.config.Features.BudgetRolloverFloor), nil
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"FinMa/types"
+	"testing"
+	"testing/quick"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func TestBuildBudgetVsActual(t *testing.T) {
+	month := func(m time.Month) types.BudgetPeriodRange {
+		return types.BudgetPeriodRange{Start: day(2024, m, 1), End: day(2024, m+1, 1)}
+	}
+
+	food := types.Budget{ID: uuid.New(), Name: "Food", Amount: money(300), Rollover: true}
+	bills := types.Budget{
+		ID:        uuid.New(),
+		Name:      "Bills",
+		Amount:    money(100),
+		DeletedAt: gorm.DeletedAt{Time: day(2024, time.March, 15), Valid: true},
+	}
+
+	histories := []budgetHistory{
+		// Created in January, before the report starts, with a rollover
+		{food, []types.BudgetPeriodRange{month(time.January), month(time.February), month(time.March)}, moneys(250, 320, 280)},
+		// Created in March and deleted during March
+		{bills, []types.BudgetPeriodRange{month(time.March)}, moneys(120)},
+	}
+
+	periods := buildBudgetVsActual(histories, day(2024, time.February, 1), defaultRolloverFloor)
+	if len(periods) != 2 {
+		t.Fatalf("expected February and March; got %d periods", len(periods))
+	}
+
+	february := periods[0]
+	if len(february.Budgets) != 1 || february.Budgets[0].EffectiveLimit != money(350) || february.Budgets[0].Variance != money(30) {
+		t.Errorf("expected the January rollover in February; got %+v", february.Budgets)
+	}
+
+	march := periods[1]
+	if len(march.Budgets) != 2 {
+		t.Fatalf("expected both budgets in March; got %+v", march.Budgets)
+	}
+	if march.Budgets[0].EffectiveLimit != money(330) {
+		t.Errorf("expected an effective limit of 330 for food in March; got %v", march.Budgets[0].EffectiveLimit)
+	}
+	if !march.Budgets[1].Deleted {
+		t.Error("expected the bills budget to be flagged as deleted")
+	}
+	if march.TotalLimit != money(430) || march.TotalActual != money(400) || march.TotalVariance != money(30) {
+		t.Errorf("expected totals (430, 400, 30); got (%v, %v, %v)", march.TotalLimit, march.TotalActual, march.TotalVariance)
+	}
+}
+
+func TestBudgetPeriodRanges(t *testing.T) {
+	budget := types.Budget{PeriodType: "monthly", StartDate: day(2024, time.January, 15)}
+
+	periods := budgetPeriodRanges(budget, day(2024, time.March, 10), time.UTC)
+	if len(periods) != 3 {
+		t.Fatalf("expected 3 periods; got %d", len(periods))
+	}
+	if !periods[2].Start.Equal(day(2024, time.March, 1)) || !periods[2].End.Equal(day(2024, time.April, 1)) {
+		t.Errorf("expected the running period to be March; got %v - %v", periods[2].Start, periods[2].End)
+	}
+}
+
+func TestBudgetVsActualTotalsAreExact(t *testing.T) {
+	months := []types.BudgetPeriodRange{
+		{Start: day(2024, time.January, 1), End: day(2024, time.February, 1)},
+		{Start: day(2024, time.February, 1), End: day(2024, time.March, 1)},
+		{Start: day(2024, time.March, 1), End: day(2024, time.April, 1)},
+	}
+	sums := func(limits [4]uint32, spent [4][3]uint32, rollover [4]bool) bool {
+		histories := make([]budgetHistory, len(limits))
+		for i, limit := range limits {
+			// Amounts in cents
+			history := budgetHistory{types.Budget{ID: uuid.New(), Amount: types.NewMoney(int64(limit%1_000_000)*100, ""), Rollover: rollover[i]}, months, nil}
+			for _, amount := range spent[i] {
+				history.spent = append(history.spent, types.NewMoney(int64(amount%1_000_000)*100, ""))
+			}
+			histories[i] = history
+		}
+
+		for _, period := range buildBudgetVsActual(histories, months[0].Start, defaultRolloverFloor) {
+			var limit, actual, variance int64
+			for _, row := range period.Budgets {
+				if row.EffectiveLimit.Minor-row.Actual.Minor != row.Variance.Minor {
+					return false
+				}
+				limit, actual, variance = limit+row.EffectiveLimit.Minor, actual+row.Actual.Minor, variance+row.Variance.Minor
+			}
+			if period.TotalLimit.Minor != limit || period.TotalActual.Minor != actual || period.TotalVariance.Minor != variance {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(sums, nil); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"FinMa/types"
+	"time"
+)
+
+// budgetClosedPeriods returns the periods of the budget that ended before
+// the period running at now, oldest first, starting at the budget creation.
+func budgetClosedPeriods(budget types.Budget, now time.Time, loc *time.Location) []types.BudgetPeriodRange {
+	periods := budgetPeriodRanges(budget, now, loc)
+	if len(periods) > 0 && periods[len(periods)-1].End.After(now) {
+		periods = periods[:len(periods)-1]
+	}
+	return periods
+}
+
+// budgetRollover chains the closed periods of a budget: what was left (or
+// overspent) of the effective limit of a period is carried over to the next
+// one. The carried amount never goes below floor times the limit.
+// It is recomputed from the spending of every period, so editing a past
+// transaction ripples through the following periods.
+func budgetRollover(limit types.Money, spent []types.Money, floor float64) types.Money {
+	limits := make([]types.Money, len(spent))
+	for i := range limits {
+		limits[i] = limit
+	}
+	minimum := limit.Unbound().Mul(-floor)
+	return carryOver(limits, spent, &minimum)
+}
+
+// envelopeRollover chains the closed periods of a budget in envelope
+// budgeting mode: the balance of the envelope, what was allocated minus
+// what was spent, carries over in full, overspending included.
+func envelopeRollover(allocated, spent []types.Money) types.Money {
+	return carryOver(allocated, spent, nil)
+}
+
+// carryOver carries what was left of each period over to the next one,
+// never going below minimum when there is one. The amounts are summed in
+// unbound minor units.
+func carryOver(limits, spent []types.Money, minimum *types.Money) types.Money {
+	var rollover int64
+	for i, amount := range spent {
+		rollover += limits[i].Unbound().Minor - amount.Unbound().Minor
+		if minimum != nil {
+			rollover = max(rollover, minimum.Unbound().Minor)
+		}
+	}
+	return types.NewMoney(rollover, "")
+}
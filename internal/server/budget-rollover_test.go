@@ -0,0 +1,75 @@
+package server
+
+import (
+	"FinMa/internal/config"
+	"FinMa/types"
+	"testing"
+	"time"
+)
+
+// defaultRolloverFloor is the rollover floor of the default configuration.
+var defaultRolloverFloor = config.Default().Features.BudgetRolloverFloor
+
+func TestBudgetClosedPeriods(t *testing.T) {
+	budget := types.Budget{
+		PeriodType: "monthly",
+		StartDate:  day(2024, time.January, 15),
+	}
+	now := day(2024, time.April, 10)
+
+	periods := budgetClosedPeriods(budget, now, time.UTC)
+	if len(periods) != 3 {
+		t.Fatalf("expected 3 closed periods; got %d", len(periods))
+	}
+	if !periods[0].Start.Equal(budget.StartDate) || !periods[0].End.Equal(day(2024, time.February, 1)) {
+		t.Errorf("expected the chain to start at the budget creation; got %v - %v", periods[0].Start, periods[0].End)
+	}
+	if !periods[2].End.Equal(day(2024, time.April, 1)) {
+		t.Errorf("expected the last closed period to end on April 1; got %v", periods[2].End)
+	}
+}
+
+func TestBudgetRollover(t *testing.T) {
+	tests := []struct {
+		name     string
+		spent    []float64
+		expected float64
+	}{
+		{"no closed period", nil, 0},
+		{"unused amount", []float64{450}, 50},
+		{"overspent", []float64{550}, -50},
+		{"chained", []float64{450, 480, 600}, -30},
+		{"capped at the floor", []float64{2000}, -250},
+		{"recovers after the floor", []float64{2000, 100}, 150},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rollover := budgetRollover(money(500), moneys(tt.spent...), 0.5); rollover != money(tt.expected) {
+				t.Errorf("expected %v; got %v", tt.expected, rollover)
+			}
+		})
+	}
+}
+
+func TestEnvelopeRollover(t *testing.T) {
+	tests := []struct {
+		name      string
+		allocated []float64
+		spent     []float64
+		expected  float64
+	}{
+		{"no closed period", nil, nil, 0},
+		{"unspent allocation", []float64{300}, []float64{250}, 50},
+		{"chained", []float64{300, 0, 200}, []float64{250, 20, 100}, 130},
+		{"overspent without floor", []float64{100}, []float64{1000}, -900},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rollover := envelopeRollover(moneys(tt.allocated...), moneys(tt.spent...)); rollover != money(tt.expected) {
+				t.Errorf("expected %v; got %v", tt.expected, rollover)
+			}
+		})
+	}
+}
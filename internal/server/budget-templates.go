@@ -0,0 +1,226 @@
+package server
+
+import (
+	"FinMa/constants"
+	"FinMa/types"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// monthStart returns the first day of the month of t in loc.
+func monthStart(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+}
+
+// templateItemFromBudget copies the settings of a budget into a template item.
+func templateItemFromBudget(budget types.Budget) types.BudgetTemplateItem {
+	return types.BudgetTemplateItem{
+		ID:                uuid.New(),
+		Name:              budget.Name,
+		Categories:        budget.CategoryNames(),
+		ExcludeCategories: budget.ExcludeCategories,
+		Amount:            budget.Amount,
+		Rollover:          budget.Rollover,
+		AlertThresholds:   budget.AlertThresholds,
+		RearmAlerts:       budget.RearmAlerts,
+	}
+}
+
+// budgetFromTemplateItem builds a custom budget running over the month
+// starting at month, with its amount adjusted by a percentage and rounded to
+// the minor unit of the currency.
+func budgetFromTemplateItem(item types.BudgetTemplateItem, userID uuid.UUID, currency string, month time.Time, adjustment float64) (types.Budget, error) {
+	categories, err := parseBudgetCategories(item.Categories, item.ExcludeCategories)
+	if err != nil {
+		return types.Budget{}, err
+	}
+
+	thresholds := item.AlertThresholds
+	if thresholds == nil {
+		thresholds = constants.GetBudgetAlertThresholds()
+	}
+
+	return types.Budget{
+		ID:                uuid.New(),
+		Name:              item.Name,
+		Categories:        categories,
+		ExcludeCategories: item.ExcludeCategories,
+		Amount:            item.Amount.Unbound().Mul(1 + adjustment/100).Round(currency),
+		StartDate:         month,
+		EndDate:           month.AddDate(0, 1, -1),
+		PeriodType:        "custom",
+		Rollover:          item.Rollover,
+		AlertThresholds:   thresholds,
+		RearmAlerts:       item.RearmAlerts,
+		UserID:            userID,
+	}, nil
+}
+
+// findCoveringBudget returns an existing budget running in [from, to) that
+// counts a category of the candidate, which would make the candidate a duplicate.
+func findCoveringBudget(existing []types.Budget, candidate types.Budget, from, to time.Time) (types.Budget, bool) {
+	for _, budget := range existing {
+		if budgetRunsBetween(budget, from, to) && budgetsShareCategories(budget, candidate) {
+			return budget, true
+		}
+	}
+	return types.Budget{}, false
+}
+
+// applyBudgetItems creates a budget for the month starting at month from each
+// item, skipping the ones a budget already covers. Applying the same items
+// twice creates nothing the second time.
+func (s *FiberServer) applyBudgetItems(user types.User, items []types.BudgetTemplateItem, month time.Time, adjustment float64) ([]types.BudgetApplyResult, error) {
+	existing := s.db.GetBudgets(&user)
+	next := month.AddDate(0, 1, 0)
+
+	results := make([]types.BudgetApplyResult, 0, len(items))
+	for _, item := range items {
+		result := types.BudgetApplyResult{Name: item.Name, Categories: item.Categories}
+
+		budget, err := budgetFromTemplateItem(item, user.ID, s.baseCurrency(user), month, adjustment)
+		if err != nil {
+			result.Status = "skipped"
+			result.Reason = err.Error()
+			results = append(results, result)
+			continue
+		}
+		result.Name = budgetName(budget)
+
+		if covering, ok := findCoveringBudget(existing, budget, month, next); ok {
+			result.Status = "skipped"
+			result.BudgetID = &covering.ID
+			result.Reason = "a budget already covers these categories in this month"
+			results = append(results, result)
+			continue
+		}
+
+		if err := s.db.CreateBudget(&budget); err != nil {
+			return results, err
+		}
+		existing = append(existing, budget)
+
+		result.Status = "created"
+		result.BudgetID = &budget.ID
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// CopyBudgetsFromPrevious creates for the current month a copy of every
+// budget that ran in the previous month, in the user's timezone. Recurring
+// budgets and budgets already recreated are reported as skipped.
+func (s *FiberServer) CopyBudgetsFromPrevious(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	current := monthStart(time.Now(), userLocation(user))
+	previous := current.AddDate(0, -1, 0)
+
+	items := []types.BudgetTemplateItem{}
+	for _, budget := range s.db.GetBudgets(&user) {
+		if budgetRunsBetween(budget, previous, current) {
+			items = append(items, templateItemFromBudget(budget))
+		}
+	}
+
+	results, err := s.applyBudgetItems(user, items, current, 0)
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not copy budgets")
+	}
+
+	return c.JSON(results)
+}
+
+// CreateBudgetTemplate saves the budgets running now as a named template.
+func (s *FiberServer) CreateBudgetTemplate(c *fiber.Ctx) error {
+	type CreateBudgetTemplateRequest struct {
+		Name string `json:"name"`
+	}
+
+	var body CreateBudgetTemplateRequest
+	if err := c.BodyParser(&body); err != nil || strings.TrimSpace(body.Name) == "" {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Template name is required")
+	}
+
+	user := c.Locals("user").(types.User)
+	now := time.Now()
+	location := userLocation(user)
+
+	template := &types.BudgetTemplate{
+		ID:     uuid.New(),
+		Name:   strings.TrimSpace(body.Name),
+		UserID: user.ID,
+	}
+	for _, budget := range s.db.GetBudgets(&user) {
+		if _, _, ok := budgetPeriodAt(budget, now, location); ok {
+			template.Items = append(template.Items, templateItemFromBudget(budget))
+		}
+	}
+
+	if len(template.Items) == 0 {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "No running budget to save")
+	}
+
+	if err := s.db.CreateBudgetTemplate(template); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not create budget template")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(template)
+}
+
+// GetBudgetTemplates lists the budget templates of the user.
+func (s *FiberServer) GetBudgetTemplates(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	return c.JSON(s.db.GetBudgetTemplates(&user))
+}
+
+// ApplyBudgetTemplate creates the budgets of a template for a month
+// (YYYY-MM, the current month by default). adjustment_percent changes every
+// amount, 5 adds 5%. Budgets already covered in the month are skipped, so
+// applying a template again is harmless.
+func (s *FiberServer) ApplyBudgetTemplate(c *fiber.Ctx) error {
+	type ApplyBudgetTemplateRequest struct {
+		Month             string  `json:"month"`
+		AdjustmentPercent float64 `json:"adjustment_percent"`
+	}
+
+	var body ApplyBudgetTemplateRequest
+	if err := c.BodyParser(&body); err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+
+	if body.AdjustmentPercent <= -100 {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Adjustment must be greater than -100%")
+	}
+
+	user := c.Locals("user").(types.User)
+	location := userLocation(user)
+
+	month := monthStart(time.Now(), location)
+	if body.Month != "" {
+		parsed, err := time.ParseInLocation("2006-01", body.Month, location)
+		if err != nil {
+			return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid month format, expected YYYY-MM")
+		}
+		month = parsed
+	}
+
+	template := s.db.GetBudgetTemplateByID(c.Params("id"))
+	if template.ID == uuid.Nil || template.UserID != user.ID {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Budget template not found")
+	}
+
+	results, err := s.applyBudgetItems(user, template.Items, month, body.AdjustmentPercent)
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not apply budget template")
+	}
+
+	return c.JSON(results)
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"FinMa/types"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestBudgetFromTemplateItem(t *testing.T) {
+	item := types.BudgetTemplateItem{Name: "Groceries", Categories: types.Categories{"food"}, Amount: money(200)}
+	month := day(2024, time.May, 1)
+
+	budget, err := budgetFromTemplateItem(item, uuid.New(), "EUR", month, 5)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if budget.Amount != money(210) {
+		t.Errorf("expected the amount to be adjusted by 5%% to 210; got %v", budget.Amount)
+	}
+	if budget.PeriodType != "custom" || !budget.StartDate.Equal(month) || !budget.EndDate.Equal(day(2024, time.May, 31)) {
+		t.Errorf("expected a custom budget over May; got %s %v - %v", budget.PeriodType, budget.StartDate, budget.EndDate)
+	}
+	if len(budget.AlertThresholds) == 0 {
+		t.Error("expected the default alert thresholds")
+	}
+
+	item.Categories = types.Categories{"gifts"}
+	if _, err := budgetFromTemplateItem(item, uuid.New(), "EUR", month, 0); err == nil {
+		t.Error("expected an error for an unknown category")
+	}
+}
+
+func TestFindCoveringBudget(t *testing.T) {
+	may, june := day(2024, time.May, 1), day(2024, time.June, 1)
+	categories := func(names ...string) []types.BudgetCategory {
+		list := []types.BudgetCategory{}
+		for _, name := range names {
+			list = append(list, types.BudgetCategory{Category: name})
+		}
+		return list
+	}
+
+	april := types.Budget{PeriodType: "custom", StartDate: day(2024, time.April, 1), EndDate: day(2024, time.April, 30), Categories: categories("food")}
+	monthly := types.Budget{PeriodType: "monthly", StartDate: day(2024, time.January, 1), Categories: categories("bills")}
+	existing := []types.Budget{april, monthly}
+
+	food := types.Budget{Categories: categories("food")}
+	if _, ok := findCoveringBudget(existing, food, may, june); ok {
+		t.Error("expected the April budget not to cover May")
+	}
+
+	bills := types.Budget{Categories: categories("bills", "shopping")}
+	if _, ok := findCoveringBudget(existing, bills, may, june); !ok {
+		t.Error("expected the recurring budget to cover bills in May")
+	}
+}
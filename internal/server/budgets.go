@@ -0,0 +1,457 @@
+package server
+
+import (
+	"FinMa/constants"
+	"FinMa/internal/database"
+	"FinMa/types"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// budgetResponse is a budget with its current period and what was spent in it.
+type budgetResponse struct {
+	types.Budget
+	Categories         []string     `json:"categories" csv:"categories"`
+	CurrentPeriodStart *time.Time   `json:"current_period_start" csv:"current_period_start"`
+	CurrentPeriodEnd   *time.Time   `json:"current_period_end" csv:"current_period_end"`
+	Spent              types.Money  `json:"spent" csv:"spent"`
+	Limit              types.Money  `json:"limit" csv:"limit"`
+	EffectiveLimit     types.Money  `json:"effective_limit" csv:"effective_limit"`
+	Allocated          *types.Money `json:"allocated,omitempty" csv:"allocated"` // In envelope budgeting mode
+}
+
+// newBudgetResponse builds the response of a budget from its progress, or
+// with null period fields when the budget is not running.
+func newBudgetResponse(budget types.Budget, progress *types.BudgetProgress) budgetResponse {
+	response := budgetResponse{
+		Budget:         budget,
+		Categories:     budget.CategoryNames(),
+		Limit:          budget.Amount,
+		EffectiveLimit: budget.Amount,
+	}
+	if progress != nil {
+		response.CurrentPeriodStart = &progress.PeriodStart
+		response.CurrentPeriodEnd = &progress.PeriodEnd
+		response.Spent = progress.Spent
+		response.EffectiveLimit = progress.EffectiveLimit
+		response.Allocated = progress.Allocated
+	}
+	return response
+}
+
+// findUserBudget returns the budget from the route params if the user owns
+// it or, unless ownership is required, if it is shared in their household.
+func (s *FiberServer) findUserBudget(user types.User, id string, requireOwner bool) (types.Budget, bool) {
+	budget := s.db.GetBudgetByID(id)
+	if budget.ID == uuid.Nil {
+		return types.Budget{}, false
+	}
+	if budget.UserID == user.ID {
+		return budget, true
+	}
+	if requireOwner || budget.HouseholdID == nil || !s.db.IsHouseholdMember(*budget.HouseholdID, user.ID) {
+		return types.Budget{}, false
+	}
+	return budget, true
+}
+
+// buildBudgetResponse resolves the period of the budget running at now.
+func (s *FiberServer) buildBudgetResponse(user types.User, budget types.Budget, now time.Time) (budgetResponse, error) {
+	progress, err := s.budgetsProgress(user, []types.Budget{budget}, now)
+	if err != nil {
+		return budgetResponse{}, err
+	}
+
+	if len(progress) == 0 {
+		return newBudgetResponse(budget, nil), nil
+	}
+	return newBudgetResponse(budget, &progress[0]), nil
+}
+
+// CreateBudget creates a budget for the authenticated user.
+// The budget counts the expenses of its categories, or of every category
+// except them when exclude_categories is set. Existing matching expenses
+// within the budget dates are attributed to the new budget.
+// Two budgets of the same period type running at the same time cannot share
+// a category, they are refused with a 409.
+// alert_thresholds are the percentages of the limit notified once per period,
+// 50, 80 and 100 by default.
+// period_type is "weekly" (starting on week_start_day, 0 is Sunday),
+// "monthly", "yearly" or "custom" (the default, requires end_date).
+func (s *FiberServer) CreateBudget(c *fiber.Ctx) error {
+	type CreateBudgetRequest struct {
+		Name              string      `json:"name"`
+		Categories        []string    `json:"categories"`
+		ExcludeCategories bool        `json:"exclude_categories"`
+		Amount            types.Money `json:"amount"`
+		StartDate         string      `json:"start_date"`
+		EndDate           string      `json:"end_date"`
+		PeriodType        string      `json:"period_type"`
+		WeekStartDay      int         `json:"week_start_day"`
+		Rollover          bool        `json:"rollover"`
+
+		AlertThresholds *[]int `json:"alert_thresholds"`
+		RearmAlerts     bool   `json:"rearm_alerts"`
+	}
+
+	var body CreateBudgetRequest
+	if err := c.BodyParser(&body); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+
+	startDate, err := time.Parse(time.RFC3339, body.StartDate)
+	if err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid start date format")
+	}
+
+	if body.PeriodType == "" {
+		body.PeriodType = "custom"
+	}
+	if !isValidBudgetPeriodType(body.PeriodType) {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid budget period type")
+	}
+	if body.WeekStartDay < 0 || body.WeekStartDay > 6 {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Week start day must be between 0 (Sunday) and 6 (Saturday)")
+	}
+
+	var endDate time.Time
+	if body.PeriodType == "custom" {
+		endDate, err = time.Parse(time.RFC3339, body.EndDate)
+		if err != nil || endDate.Before(startDate) {
+			return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid end date")
+		}
+	}
+
+	categories, err := parseBudgetCategories(body.Categories, body.ExcludeCategories)
+	if err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, err.Error())
+	}
+
+	if body.Amount.Sign() <= 0 {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Budget amount must be positive")
+	}
+	user := c.Locals("user").(types.User)
+	if err := s.checkBaseAmount("amount", body.Amount, user); err != nil {
+		return err
+	}
+
+	thresholds := constants.GetBudgetAlertThresholds()
+	if body.AlertThresholds != nil {
+		thresholds = *body.AlertThresholds
+	}
+	alertThresholds, err := parseAlertThresholds(thresholds)
+	if err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, err.Error())
+	}
+
+	budget := &types.Budget{
+		ID:                uuid.New(),
+		Name:              strings.TrimSpace(body.Name),
+		Categories:        categories,
+		ExcludeCategories: body.ExcludeCategories,
+		Amount:            body.Amount,
+		StartDate:         startDate,
+		EndDate:           endDate,
+		PeriodType:        body.PeriodType,
+		WeekStartDay:      body.WeekStartDay,
+		Rollover:          body.Rollover,
+		AlertThresholds:   alertThresholds,
+		RearmAlerts:       body.RearmAlerts,
+		UserID:            user.ID,
+	}
+
+	if other, ok := s.findOverlappingBudget(user, *budget); ok {
+		return NewAPIError(fiber.StatusConflict, CodeBudgetOverlap, "Another budget of the same period type already covers some of these categories").
+			WithDetails(FieldError{Field: "categories", Message: "Already covered by another budget", Value: other.ID})
+	}
+
+	if err := s.db.CreateBudget(budget); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not create budget")
+	}
+
+	response, err := s.buildBudgetResponse(user, *budget, time.Now())
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not compute budget period")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+// GetBudgets lists the budgets of the user with their current period, in the
+// user's timezone, and what was spent in it, as CSV with ?format=csv or
+// Accept: text/csv.
+func (s *FiberServer) GetBudgets(c *fiber.Ctx) error {
+	format, err := responseFormat(c, formatJSON, formatCSV)
+	if err != nil {
+		return err
+	}
+
+	user := c.Locals("user").(types.User)
+	budgets := s.db.GetBudgets(&user)
+
+	progress, err := s.budgetsProgress(user, budgets, time.Now())
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not compute budget periods")
+	}
+
+	byID := make(map[uuid.UUID]types.BudgetProgress, len(progress))
+	for _, p := range progress {
+		byID[p.BudgetID] = p
+	}
+
+	responses := make([]budgetResponse, 0, len(budgets))
+	for _, budget := range budgets {
+		if p, ok := byID[budget.ID]; ok {
+			responses = append(responses, newBudgetResponse(budget, &p))
+		} else {
+			responses = append(responses, newBudgetResponse(budget, nil))
+		}
+	}
+
+	if format == formatCSV {
+		return sendCSV(c, "budgets", responses)
+	}
+	c.Vary(fiber.HeaderAccept)
+	return c.JSON(responses)
+}
+
+// updateBudgetRequest holds the fields of a budget to change, the ones left
+// out are kept.
+type updateBudgetRequest struct {
+	Version           *int64       `json:"version"`
+	Name              *string      `json:"name"`
+	Categories        *[]string    `json:"categories"`
+	ExcludeCategories *bool        `json:"exclude_categories"`
+	Amount            *types.Money `json:"amount"`
+	PeriodType        *string      `json:"period_type"`
+	WeekStartDay      *int         `json:"week_start_day"`
+	Rollover          *bool        `json:"rollover"`
+
+	AlertThresholds *[]int `json:"alert_thresholds"`
+	RearmAlerts     *bool  `json:"rearm_alerts"`
+}
+
+// UpdateBudget partially updates a budget. A new period type only applies
+// from the end of the current period, past and current periods are kept.
+// Recurring budgets cannot become custom ones and the other way around.
+// Changing the categories moves the expenses counted against the budget.
+// The version read is required, a budget changed since is not updated.
+func (s *FiberServer) UpdateBudget(c *fiber.Ctx) error {
+	var body updateBudgetRequest
+	if err := c.BodyParser(&body); err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+	version, err := expectedVersion(c, body.Version)
+	if err != nil {
+		return err
+	}
+
+	user := c.Locals("user").(types.User)
+	response, err := s.updateBudget(user, c.Params("id"), version, body)
+	if err != nil {
+		return err
+	}
+	return c.JSON(response)
+}
+
+// updateBudget applies the changes to the budget if the user owns it and it
+// is still at the version read.
+func (s *FiberServer) updateBudget(user types.User, id string, version int64, body updateBudgetRequest) (budgetResponse, error) {
+	budget, ok := s.findUserBudget(user, id, true)
+	if !ok {
+		return budgetResponse{}, NewAPIError(fiber.StatusNotFound, CodeNotFound, "Budget not found")
+	}
+	if budget.Version != version {
+		return budgetResponse{}, s.budgetConflict(user, budget)
+	}
+
+	// Everything is checked before the first write, the one bumping the
+	// version, so that a stale update changes nothing
+	categoriesChanged := body.Categories != nil || body.ExcludeCategories != nil
+	if categoriesChanged {
+		names := budget.CategoryNames()
+		if body.Categories != nil {
+			names = *body.Categories
+		}
+		if body.ExcludeCategories != nil {
+			budget.ExcludeCategories = *body.ExcludeCategories
+		}
+
+		categories, err := parseBudgetCategories(names, budget.ExcludeCategories)
+		if err != nil {
+			return budgetResponse{}, NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, err.Error())
+		}
+		budget.Categories = categories
+
+		if other, ok := s.findOverlappingBudget(user, budget); ok {
+			return budgetResponse{}, NewAPIError(fiber.StatusConflict, CodeBudgetOverlap, "Another budget of the same period type already covers some of these categories").
+				WithDetails(FieldError{Field: "categories", Message: "Already covered by another budget", Value: other.ID})
+		}
+	}
+
+	if body.Name != nil {
+		budget.Name = strings.TrimSpace(*body.Name)
+	}
+	if body.AlertThresholds != nil {
+		thresholds, err := parseAlertThresholds(*body.AlertThresholds)
+		if err != nil {
+			return budgetResponse{}, NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, err.Error())
+		}
+		budget.AlertThresholds = thresholds
+	}
+	if body.RearmAlerts != nil {
+		budget.RearmAlerts = *body.RearmAlerts
+	}
+	if body.Amount != nil {
+		if body.Amount.Sign() <= 0 {
+			return budgetResponse{}, NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Budget amount must be positive")
+		}
+		if err := s.checkBaseAmount("amount", *body.Amount, user); err != nil {
+			return budgetResponse{}, err
+		}
+		budget.Amount = *body.Amount
+	}
+	if body.Rollover != nil {
+		budget.Rollover = *body.Rollover
+	}
+
+	now := time.Now()
+	location := userLocation(user)
+
+	var newPeriod *types.BudgetPeriod
+	if body.PeriodType != nil || body.WeekStartDay != nil {
+		period := types.BudgetPeriod{
+			ID:           uuid.New(),
+			PeriodType:   budget.PeriodType,
+			WeekStartDay: budget.WeekStartDay,
+			BudgetID:     budget.ID,
+		}
+		if body.PeriodType != nil {
+			period.PeriodType = *body.PeriodType
+		}
+		if body.WeekStartDay != nil {
+			period.WeekStartDay = *body.WeekStartDay
+		}
+
+		if !isValidBudgetPeriodType(period.PeriodType) || period.WeekStartDay < 0 || period.WeekStartDay > 6 {
+			return budgetResponse{}, NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid budget period")
+		}
+		if (period.PeriodType == "custom") != (budget.PeriodType == "custom") {
+			return budgetResponse{}, NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Custom budgets cannot become recurring ones and the other way around")
+		}
+
+		candidate := budget
+		candidate.PeriodType = period.PeriodType
+		if other, ok := s.findOverlappingBudget(user, candidate); ok {
+			return budgetResponse{}, NewAPIError(fiber.StatusConflict, CodeBudgetOverlap, "Another budget of the same period type already covers some of these categories").
+				WithDetails(FieldError{Field: "categories", Message: "Already covered by another budget", Value: other.ID})
+		}
+
+		if period.PeriodType != budget.PeriodType || period.WeekStartDay != budget.WeekStartDay {
+			period.EffectiveFrom = budget.StartDate
+			if _, end, ok := budgetPeriodAt(budget, now, location); ok {
+				period.EffectiveFrom = end
+			}
+			newPeriod = &period
+		}
+	}
+
+	if err := s.db.UpdateBudget(&budget); err != nil {
+		if errors.Is(err, database.ErrVersionConflict) {
+			current, ok := s.findUserBudget(user, id, true)
+			if !ok {
+				return budgetResponse{}, NewAPIError(fiber.StatusNotFound, CodeNotFound, "Budget not found")
+			}
+			return budgetResponse{}, s.budgetConflict(user, current)
+		}
+		log.Error(err)
+		return budgetResponse{}, NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not update budget")
+	}
+	if categoriesChanged {
+		if err := s.db.UpdateBudgetCategories(&budget); err != nil {
+			log.Error(err)
+			return budgetResponse{}, NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not update budget categories")
+		}
+	}
+	if newPeriod != nil {
+		if err := s.db.ChangeBudgetPeriod(&budget, newPeriod); err != nil {
+			log.Error(err)
+			return budgetResponse{}, NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not update budget period")
+		}
+	}
+
+	response, err := s.buildBudgetResponse(user, budget, now)
+	if err != nil {
+		log.Error(err)
+		return budgetResponse{}, NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not compute budget period")
+	}
+	return response, nil
+}
+
+// budgetConflict is the error of an update of a budget changed since the
+// client read it, with the budget as it is now.
+func (s *FiberServer) budgetConflict(user types.User, budget types.Budget) error {
+	response, err := s.buildBudgetResponse(user, budget, time.Now())
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not compute budget period")
+	}
+	return versionConflict(response)
+}
+
+// GetBudgetTransactions lists the transactions counted against a budget for
+// its current period. It accepts the same query parameters as GetTransactions.
+func (s *FiberServer) GetBudgetTransactions(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	budget, ok := s.findUserBudget(user, c.Params("id"), false)
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Budget not found")
+	}
+
+	filter, err := parseTransactionFilter(c)
+	if err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, err.Error())
+	}
+	sel, err := transactionResource.selection(c)
+	if err != nil {
+		return err
+	}
+
+	start, end, ok := budgetPeriodAt(budget, time.Now(), userLocation(user))
+	if !ok {
+		return c.JSON([]types.Transaction{})
+	}
+
+	transactions, err := transactionResource.list(s, c, sel, s.db.GetBudgetTransactions(&budget, start, end, filter))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(transactions)
+}
+
+// DeleteBudget soft deletes a budget. It no longer counts new expenses but
+// still appears in the reports of the periods it covered.
+func (s *FiberServer) DeleteBudget(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	budget, ok := s.findUserBudget(user, c.Params("id"), true)
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Budget not found")
+	}
+
+	if err := s.db.DeleteBudget(&budget); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not delete budget")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
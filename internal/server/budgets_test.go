@@ -0,0 +1,78 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/types"
+)
+
+// budgetTransactionsDB answers the transactions counted against the budget
+// and records the period and the filter they were asked for.
+type budgetTransactionsDB struct {
+	*adminDB
+	budget       types.Budget
+	transactions []types.Transaction
+	from, to     time.Time
+	filter       types.TransactionFilter
+}
+
+func (db *budgetTransactionsDB) GetBudgetByID(id string) types.Budget {
+	if id != db.budget.ID.String() {
+		return types.Budget{}
+	}
+	return db.budget
+}
+
+func (db *budgetTransactionsDB) IsHouseholdMember(householdID, userID uuid.UUID) bool {
+	return false
+}
+
+func (db *budgetTransactionsDB) GetBudgetTransactions(budget *types.Budget, from, to time.Time, filter types.TransactionFilter) []types.Transaction {
+	db.from, db.to, db.filter = from, to, filter
+	return db.transactions
+}
+
+func TestGetBudgetTransactions(t *testing.T) {
+	s, admin, _, user := newAdminTestServer(t)
+	other := types.User{ID: uuid.New(), Email: "grace@example.com", Role: "user"}
+	admin.users[other.ID] = other
+	budget := types.Budget{ID: uuid.New(), Name: "Groceries", Amount: money(400), PeriodType: "monthly",
+		StartDate: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC), UserID: user.ID}
+	groceries := types.Transaction{ID: uuid.New(), Category: "food", Amount: money(62.3), Type: "expense", BudgetID: &budget.ID, UserID: user.ID}
+	db := &budgetTransactionsDB{adminDB: admin, budget: budget, transactions: []types.Transaction{groceries}}
+	s.db = db
+	path := "/api/v1/budgets/" + budget.ID.String() + "/transactions"
+
+	resp := adminRequest(t, s, user, "GET", path+"?category=food&limit=10", "")
+	var transactions []types.Transaction
+	json.NewDecoder(resp.Body).Decode(&transactions)
+	if resp.StatusCode != fiber.StatusOK || len(transactions) != 1 || transactions[0].ID != groceries.ID {
+		t.Fatalf("expected the transaction counted against the budget; got %d %+v", resp.StatusCode, transactions)
+	}
+	now := time.Now().UTC()
+	if month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC); !db.from.Equal(month) || !db.to.Equal(month.AddDate(0, 1, 0)) {
+		t.Errorf("expected the current month; got %v to %v", db.from, db.to)
+	}
+	if db.filter.Category != "food" || db.filter.Limit != 10 {
+		t.Errorf("expected the filter of the transactions list; got %+v", db.filter)
+	}
+
+	for name, request := range map[string]struct {
+		as     types.User
+		path   string
+		status int
+	}{
+		"unknown budget":         {user, "/api/v1/budgets/" + uuid.NewString() + "/transactions", fiber.StatusNotFound},
+		"budget of another user": {other, path, fiber.StatusNotFound},
+		"invalid date":           {user, path + "?from=yesterday", fiber.StatusBadRequest},
+	} {
+		if resp := adminRequest(t, s, request.as, "GET", request.path, ""); resp.StatusCode != request.status {
+			t.Errorf("%s: expected status %d; got %d", name, request.status, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"context"
+	"net/url"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/internal/cache"
+	"FinMa/internal/config"
+	"FinMa/types"
+)
+
+// cacheSchemaVersion is part of the keys of the cached responses, bump it
+// when the shape of one changes. The keys also hold the build revision, so
+// that the instances of a rolling deploy do not read each other's entries,
+// but the builds without VCS information only have this version.
+const cacheSchemaVersion = 2
+
+// cacheGenerationTTL keeps the generations of the users long past the
+// entries keyed by them. An expired generation only costs misses.
+const cacheGenerationTTL = 24 * time.Hour
+
+// cacheVersion returns the version of the cached responses of this build.
+var cacheVersion = sync.OnceValue(func() string {
+	version := "v" + strconv.Itoa(cacheSchemaVersion)
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" && len(setting.Value) >= 12 {
+				version += "-" + setting.Value[:12]
+			}
+		}
+	}
+	return version
+})
+
+// newCache returns the cache of the configuration, nil when disabled.
+func newCache(cfg config.Cache) cache.Cache {
+	switch cfg.Driver {
+	case "redis":
+		redis := cache.NewRedis(cache.RedisConfig{
+			Addr:     cfg.RedisAddr,
+			Password: cfg.RedisPassword,
+			DB:       cfg.RedisDB,
+		})
+		// The requests skip an unreachable cache, the server starts anyway
+		if err := redis.Ping(context.Background()); err != nil {
+			log.Warn("Redis cache unreachable: ", err)
+		}
+		return redis
+	case "none":
+		return nil
+	}
+	return cache.NewMemory(cfg.MemoryEntries)
+}
+
+// cachedJSON answers with the JSON of compute, kept in the cache of the user
+// for CACHE_TTL under the name and the parts of the key. The X-Cache header
+// tells whether it came from the cache. A failing cache is skipped, the
+// response is then computed as without one; the errors of compute are not
+// cached. The missing exchange rates are fetched before computing it.
+func (s *FiberServer) cachedJSON(c *fiber.Ctx, name string, parts []string, compute func() (any, error)) error {
+	user := c.Locals("user").(types.User)
+	run := func() (any, error) {
+		s.fetchMissingRates(c, user)
+		return compute()
+	}
+
+	// The responses read through a share grant are narrowed to it
+	if _, shared := sharedGrant(c); s.cache == nil || shared {
+		value, err := run()
+		if err != nil {
+			return err
+		}
+		return c.JSON(value)
+	}
+
+	ctx := c.UserContext()
+	key, err := s.cacheKey(ctx, user, name, parts)
+	if err == nil {
+		var body []byte
+		var hit bool
+		if body, hit, err = s.cache.Get(ctx, key); hit {
+			s.metrics.countCacheRequest(name, "hit")
+			c.Set("X-Cache", "HIT")
+			c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			return c.Send(body)
+		}
+	}
+	if err != nil {
+		log.Error("Error reading the cache: ", err)
+		key = ""
+	}
+	s.metrics.countCacheRequest(name, "miss")
+	c.Set("X-Cache", "MISS")
+
+	value, err := run()
+	if err != nil {
+		return err
+	}
+	body, err := c.App().Config().JSONEncoder(value)
+	if err != nil {
+		return err
+	}
+	if key != "" {
+		if err := s.cache.Set(ctx, key, body, time.Duration(s.config.Cache.TTL)*time.Second); err != nil {
+			log.Error("Error writing the cache: ", err)
+		}
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Send(body)
+}
+
+// cacheKey returns the key of the cached response of the user, with the
+// version of the responses, the current generation of the user, their
+// timezone, which the periods of every response depend on, and their base
+// currency, which the amounts are converted to.
+func (s *FiberServer) cacheKey(ctx context.Context, user types.User, name string, parts []string) (string, error) {
+	generation, err := s.cacheGeneration(ctx, user.ID)
+	if err != nil {
+		return "", err
+	}
+
+	key := []string{"finma:cache", cacheVersion(), user.ID.String(), generation, name, url.QueryEscape(user.Timezone), s.baseCurrency(user)}
+	for _, part := range parts {
+		key = append(key, url.QueryEscape(part))
+	}
+	return strings.Join(key, ":"), nil
+}
+
+// cacheGenerationKey is the key of the generation of the user, shared by the
+// versions so that every instance of a rolling deploy sees the invalidations.
+func cacheGenerationKey(userID uuid.UUID) string {
+	return "finma:cache:generation:" + userID.String()
+}
+
+// cacheGeneration returns the generation of the cached responses of the
+// user, starting a new one when there is none. Deleting it invalidates
+// every response of the user at once: their keys are never read again. A
+// response computed while its generation is deleted is stored under the
+// deleted one, it cannot outlive the change.
+func (s *FiberServer) cacheGeneration(ctx context.Context, userID uuid.UUID) (string, error) {
+	key := cacheGenerationKey(userID)
+	generation, ok, err := s.cache.Get(ctx, key)
+	if err != nil || ok {
+		return string(generation), err
+	}
+
+	fresh := uuid.NewString()
+	return fresh, s.cache.Set(ctx, key, []byte(fresh), cacheGenerationTTL)
+}
+
+// invalidateCaches is the data change hook dropping the cached responses of
+// the users seeing the changed data.
+func (s *FiberServer) invalidateCaches(userIDs []uuid.UUID) {
+	keys := make([]string, 0, len(userIDs))
+	for _, userID := range userIDs {
+		keys = append(keys, cacheGenerationKey(userID))
+	}
+	// Not canceled with the request: the change is committed
+	if err := s.cache.Delete(context.Background(), keys...); err != nil {
+		log.Error("Error invalidating the cache: ", err)
+	}
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/internal/cache"
+	"FinMa/internal/config"
+	"FinMa/types"
+)
+
+// failingCache fails every command, like an unreachable Redis server.
+type failingCache struct{}
+
+func (failingCache) Get(context.Context, string) ([]byte, bool, error) {
+	return nil, false, errors.New("connection refused")
+}
+
+func (failingCache) Set(context.Context, string, []byte, time.Duration) error {
+	return errors.New("connection refused")
+}
+
+func (failingCache) Delete(context.Context, ...string) error {
+	return errors.New("connection refused")
+}
+
+func newCachedServer(store cache.Cache, user types.User, computed *int) *FiberServer {
+	cfg := config.Default()
+	s := &FiberServer{App: fiber.New(fiber.Config{ErrorHandler: errorHandler}), config: cfg, cache: store}
+	s.Get("/report", func(c *fiber.Ctx) error {
+		c.Locals("user", user)
+		return c.Next()
+	}, func(c *fiber.Ctx) error {
+		return s.cachedJSON(c, "report", []string{c.Query("months")}, func() (any, error) {
+			*computed++
+			if c.Query("months") == "0" {
+				return nil, NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "months must be positive")
+			}
+			return fiber.Map{"computed": *computed}, nil
+		})
+	})
+	return s
+}
+
+func getCached(t *testing.T, s *FiberServer, path string) (int, string, string) {
+	req, err := http.NewRequest("GET", path, nil)
+	if err != nil {
+		t.Fatalf("error creating request. Err: %v", err)
+	}
+	resp, err := s.Test(req)
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, resp.Header.Get("X-Cache"), string(body)
+}
+
+func TestCachedResponses(t *testing.T) {
+	user := types.User{ID: uuid.New(), Timezone: "Europe/Paris"}
+	other := types.User{ID: uuid.New()}
+	store := cache.NewMemory(100)
+	computed := 0
+	s := newCachedServer(store, user, &computed)
+
+	if _, header, body := getCached(t, s, "/report?months=6"); header != "MISS" || body != `{"computed":1}` {
+		t.Errorf("expected a miss; got %s %s", header, body)
+	}
+	if _, header, body := getCached(t, s, "/report?months=6"); header != "HIT" || body != `{"computed":1}` {
+		t.Errorf("expected a hit; got %s %s", header, body)
+	}
+	if _, header, _ := getCached(t, s, "/report?months=12"); header != "MISS" {
+		t.Errorf("expected other parameters to miss; got %s", header)
+	}
+
+	// A change seen by another user keeps the responses of the user
+	s.invalidateCaches([]uuid.UUID{other.ID})
+	if _, header, _ := getCached(t, s, "/report?months=6"); header != "HIT" {
+		t.Errorf("expected a hit after a change of another user; got %s", header)
+	}
+	s.invalidateCaches([]uuid.UUID{other.ID, user.ID})
+	if _, header, body := getCached(t, s, "/report?months=6"); header != "MISS" || body != `{"computed":3}` {
+		t.Errorf("expected a miss after a change; got %s %s", header, body)
+	}
+
+	// The errors are not cached
+	for i := 0; i < 2; i++ {
+		if status, header, _ := getCached(t, s, "/report?months=0"); status != fiber.StatusBadRequest || header != "MISS" {
+			t.Errorf("expected an uncached 400; got %d %s", status, header)
+		}
+	}
+	if computed != 5 {
+		t.Errorf("expected 5 computations; got %d", computed)
+	}
+}
+
+func TestCachedResponsesAreVersioned(t *testing.T) {
+	user := types.User{ID: uuid.New(), BaseCurrency: "USD"}
+	s := &FiberServer{cache: cache.NewMemory(10)}
+	key, err := s.cacheKey(context.Background(), user, "report", []string{"6:include"})
+	if err != nil {
+		t.Fatalf("error computing the key. Err: %v", err)
+	}
+	if !strings.HasPrefix(key, "finma:cache:"+cacheVersion()+":"+user.ID.String()+":") || !strings.HasSuffix(key, ":report::USD:6%3Ainclude") {
+		t.Errorf("expected the versioned key of the user; got %s", key)
+	}
+}
+
+func TestFailingCacheIsSkipped(t *testing.T) {
+	computed := 0
+	s := newCachedServer(failingCache{}, types.User{ID: uuid.New()}, &computed)
+
+	for i := 1; i <= 2; i++ {
+		status, header, _ := getCached(t, s, "/report?months=6")
+		if status != fiber.StatusOK || header != "MISS" || computed != i {
+			t.Errorf("expected the response computed; got %d %s after %d computations", status, header, computed)
+		}
+	}
+	s.invalidateCaches([]uuid.UUID{uuid.New()})
+}
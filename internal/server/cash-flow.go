@@ -0,0 +1,124 @@
+package server
+
+import (
+	"FinMa/types"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+)
+
+// cashFlowMaxBuckets bounds the buckets of a cash flow report, five years of
+// weeks.
+const cashFlowMaxBuckets = 260
+
+// cashFlowStart returns the start of the bucket holding the date, in the
+// location: the first of the month, or the Monday of the week.
+func cashFlowStart(date time.Time, granularity string, location *time.Location) time.Time {
+	date = date.In(location)
+	if granularity == "week" {
+		daysSinceMonday := (int(date.Weekday()) + 6) % 7
+		return time.Date(date.Year(), date.Month(), date.Day()-daysSinceMonday, 0, 0, 0, 0, location)
+	}
+	return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, location)
+}
+
+// nextCashFlowStart returns the start of the bucket following the one
+// starting at start.
+func nextCashFlowStart(start time.Time, granularity string) time.Time {
+	if granularity == "week" {
+		return start.AddDate(0, 0, 7)
+	}
+	return start.AddDate(0, 1, 0)
+}
+
+// buildCashFlow returns a bucket for each month or week of [from, to), the
+// ones without transactions zero, with their net and the net cumulated since
+// from. The totals are matched on the local date of their start.
+func buildCashFlow(totals []types.CashFlowBucket, from, to time.Time, granularity string) []types.CashFlowBucket {
+	byDate := make(map[string]types.CashFlowBucket, len(totals))
+	for _, bucket := range totals {
+		byDate[bucket.Start.Format(time.DateOnly)] = bucket
+	}
+
+	buckets := []types.CashFlowBucket{}
+	var cumulative int64
+	for start := from; start.Before(to); start = nextCashFlowStart(start, granularity) {
+		total := byDate[start.Format(time.DateOnly)]
+		income, expenses := total.Income.Unbound(), total.Expenses.Unbound()
+		net := income.Minor - expenses.Minor
+		cumulative += net
+		buckets = append(buckets, types.CashFlowBucket{
+			Start:         start,
+			Income:        income,
+			Expenses:      expenses,
+			Net:           types.NewMoney(net, ""),
+			CumulativeNet: types.NewMoney(cumulative, ""),
+		})
+	}
+	return buckets
+}
+
+// GetCashFlow returns the income, the expenses, the net and the cumulative
+// net of the user per ?granularity=month (default) or week between ?from=
+// and ?to= (RFC3339, the last 90 days by default), in their timezone. The
+// range is widened to whole buckets and the empty ones are zero, ready for a
+// chart. The transfers and the transactions excluded from the budgets are
+// left out. ?account_ids=id,id restricts it to some accounts. The CSV and
+// the XLSX hold the buckets.
+func (s *FiberServer) GetCashFlow(c *fiber.Ctx) error {
+	db := s.dbFor(c)
+
+	user := c.Locals("user").(types.User)
+
+	from, to, err := parseReportRange(c)
+	if err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, err.Error())
+	}
+
+	granularity := c.Query("granularity", "month")
+	if granularity != "month" && granularity != "week" {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "granularity must be month or week")
+	}
+
+	var filter types.ReportFilter
+	if filter.AccountIDs, err = s.parseReportAccounts(c, user); err != nil {
+		return err
+	}
+
+	timezone := userTimezone(user)
+	location := userLocation(user)
+	start := cashFlowStart(from, granularity, location)
+	end := nextCashFlowStart(cashFlowStart(to, granularity, location), granularity)
+	count := 0
+	for bucket := start; bucket.Before(end); bucket = nextCashFlowStart(bucket, granularity) {
+		if count++; count > cashFlowMaxBuckets {
+			return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "The range holds too many buckets, narrow it or use a monthly granularity")
+		}
+	}
+
+	key := []string{start.Format(time.DateOnly), end.Format(time.DateOnly), granularity, c.Query("account_ids")}
+	return cachedSheetsReport(s, c, user, "cash_flow", key, func() (types.CashFlow, error) {
+		cashFlow := types.CashFlow{
+			From:        start,
+			To:          end,
+			Granularity: granularity,
+			Timezone:    timezone,
+			Currency:    s.baseCurrency(user),
+		}
+		// The buckets at the edges of a share grant are partial
+		queryStart, queryEnd := start, end
+		if grant, ok := sharedGrant(c); ok {
+			queryStart, queryEnd = clampToGrant(grant, start, end)
+		}
+		totals, err := db.GetCashFlow(&user, queryStart, queryEnd, granularity, timezone, filter)
+		if err != nil {
+			log.Error(err)
+			return cashFlow, NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not compute the cash flow")
+		}
+		cashFlow.Buckets = buildCashFlow(totals, start, end, granularity)
+		return cashFlow, nil
+	}, func(cashFlow types.CashFlow) []xlsxSheet {
+		return []xlsxSheet{{"Cash flow", cashFlow.Buckets}}
+	})
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"FinMa/types"
+	"testing"
+	"testing/quick"
+	"time"
+)
+
+func TestCashFlowStart(t *testing.T) {
+	paris, _ := time.LoadLocation("Europe/Paris")
+	// Sunday evening in UTC is already Monday in Paris
+	date := time.Date(2024, time.March, 31, 23, 30, 0, 0, time.UTC)
+
+	if start := cashFlowStart(date, "month", paris); !start.Equal(time.Date(2024, time.April, 1, 0, 0, 0, 0, paris)) {
+		t.Errorf("expected April in Paris; got %v", start)
+	}
+	if start := cashFlowStart(date, "week", paris); !start.Equal(time.Date(2024, time.April, 1, 0, 0, 0, 0, paris)) {
+		t.Errorf("expected the Monday in Paris; got %v", start)
+	}
+	if start := cashFlowStart(date, "week", time.UTC); !start.Equal(time.Date(2024, time.March, 25, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the previous Monday in UTC; got %v", start)
+	}
+}
+
+func TestBuildCashFlow(t *testing.T) {
+	paris, _ := time.LoadLocation("Europe/Paris")
+	from := time.Date(2024, time.January, 1, 0, 0, 0, 0, paris)
+	to := time.Date(2024, time.May, 1, 0, 0, 0, 0, paris)
+	// The database returns the local dates, without a location
+	totals := []types.CashFlowBucket{
+		{Start: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC), Income: money(2500), Expenses: money(1800.45)},
+		{Start: time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC), Income: money(2500), Expenses: money(3100)},
+		{Start: time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC), Expenses: money(120.1)},
+	}
+
+	buckets := buildCashFlow(totals, from, to, "month")
+
+	expected := []struct {
+		month      time.Month
+		net        float64
+		cumulative float64
+	}{
+		{time.January, 699.55, 699.55},
+		{time.February, 0, 699.55}, // No transactions, zero filled
+		{time.March, -600, 99.55},
+		{time.April, -120.1, -20.55},
+	}
+	if len(buckets) != len(expected) {
+		t.Fatalf("expected %d buckets; got %d", len(expected), len(buckets))
+	}
+	for i, bucket := range buckets {
+		if bucket.Start.Month() != expected[i].month || bucket.Start.Location() != paris {
+			t.Errorf("expected %v in Paris; got %v", expected[i].month, bucket.Start)
+		}
+		if bucket.Net != money(expected[i].net) || bucket.CumulativeNet != money(expected[i].cumulative) {
+			t.Errorf("expected net %v and cumulative %v in %v; got %v and %v", expected[i].net, expected[i].cumulative, expected[i].month, bucket.Net, bucket.CumulativeNet)
+		}
+	}
+
+	weeks := buildCashFlow(nil, time.Date(2024, time.January, 1, 0, 0, 0, 0, paris), time.Date(2024, time.January, 29, 0, 0, 0, 0, paris), "week")
+	if len(weeks) != 4 || weeks[3].Start.Day() != 22 {
+		t.Errorf("expected 4 weeks; got %v", weeks)
+	}
+}
+
+func TestCashFlowCumulativeIsExact(t *testing.T) {
+	from := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	sums := func(income, expenses [12]int32) bool {
+		totals := make([]types.CashFlowBucket, len(income))
+		for i := range income {
+			// Amounts in cents, the expenses of a bucket may be refunds
+			totals[i] = types.CashFlowBucket{Start: from.AddDate(0, i, 0), Income: types.NewMoney(int64(income[i])*100, ""), Expenses: types.NewMoney(int64(expenses[i])*100, "")}
+		}
+
+		var cumulative int64
+		for i, bucket := range buildCashFlow(totals, from, from.AddDate(1, 0, 0), "month") {
+			net := int64(income[i])*100 - int64(expenses[i])*100
+			cumulative += net
+			if bucket.Net.Minor != net || bucket.CumulativeNet.Minor != cumulative {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(sums, nil); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"FinMa/constants"
+	"FinMa/types"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// mergeCategorySettings returns the settings of every transaction category,
+// in the order of the categories. Categories the user never configured get
+// the default settings.
+func mergeCategorySettings(userID uuid.UUID, stored []types.CategorySetting) []types.CategorySetting {
+	byCategory := make(map[string]types.CategorySetting, len(stored))
+	for _, setting := range stored {
+		byCategory[setting.Category] = setting
+	}
+
+	categories := constants.GetTransactionCategories()
+	settings := make([]types.CategorySetting, 0, len(categories))
+	for _, category := range categories {
+		setting, ok := byCategory[category]
+		if !ok {
+			setting = types.CategorySetting{Category: category, UserID: userID}
+		}
+		settings = append(settings, setting)
+	}
+	return settings
+}
+
+// GetCategories lists the transaction categories with the settings of the user.
+func (s *FiberServer) GetCategories(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	return c.JSON(mergeCategorySettings(user.ID, s.db.GetCategorySettings(user.ID)))
+}
+
+// UpdateCategorySetting changes the settings of a category. When
+// exclude_by_default is set, the transactions created in the category are
+// excluded from the budgets unless they say otherwise; the existing ones are
+// left unchanged. The expenses of an essential category count as essential
+// in the health metrics, the past ones included.
+func (s *FiberServer) UpdateCategorySetting(c *fiber.Ctx) error {
+	type UpdateCategorySettingRequest struct {
+		ExcludeByDefault bool `json:"exclude_by_default"`
+		Essential        bool `json:"essential"`
+	}
+
+	category := c.Params("category")
+	if !isValidCategory(category) {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Category not found")
+	}
+
+	var body UpdateCategorySettingRequest
+	if err := c.BodyParser(&body); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+
+	user := c.Locals("user").(types.User)
+	setting := &types.CategorySetting{
+		ID:               uuid.New(),
+		Category:         category,
+		ExcludeByDefault: body.ExcludeByDefault,
+		Essential:        body.Essential,
+		UserID:           user.ID,
+	}
+
+	if err := s.db.SaveCategorySetting(setting); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not update category")
+	}
+
+	return c.JSON(setting)
+}
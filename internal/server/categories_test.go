@@ -0,0 +1,34 @@
+package server
+
+import (
+	"FinMa/constants"
+	"FinMa/types"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestMergeCategorySettings(t *testing.T) {
+	userID := uuid.New()
+	stored := []types.CategorySetting{
+		{ID: uuid.New(), Category: "bills", ExcludeByDefault: true, UserID: userID},
+	}
+
+	settings := mergeCategorySettings(userID, stored)
+	categories := constants.GetTransactionCategories()
+	if len(settings) != len(categories) {
+		t.Fatalf("expected %d settings; got %d", len(categories), len(settings))
+	}
+
+	for i, setting := range settings {
+		if setting.Category != categories[i] {
+			t.Errorf("expected category %q at %d; got %q", categories[i], i, setting.Category)
+		}
+		if setting.UserID != userID {
+			t.Errorf("expected setting of %q to belong to the user", setting.Category)
+		}
+		if expected := setting.Category == "bills"; setting.ExcludeByDefault != expected {
+			t.Errorf("expected exclude_by_default %v for %q; got %v", expected, setting.Category, setting.ExcludeByDefault)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"FinMa/types"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// categoryTrendOther is the category of the series lumping the
+	// categories out of the top.
+	categoryTrendOther = "other"
+	// categoryTrendDefaultTop is the number of categories of the stacked
+	// series, without a category filter.
+	categoryTrendDefaultTop = 3
+)
+
+// linearSlope returns the slope of the least squares line through the
+// values, taken one month apart.
+func linearSlope(values []float64) float64 {
+	n := float64(len(values))
+	if n < 2 {
+		return 0
+	}
+	var sumX, sumY, sumXY, sumXX float64
+	for i, y := range values {
+		x := float64(i)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	return (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX)
+}
+
+// categoryTrendSeries returns the series of the monthly totals, by local
+// date of the month, over the months. The averages and the slope are
+// rounded to the minor unit of the currency.
+func categoryTrendSeries(category string, totals map[string]types.CategoryMonthTotal, months []time.Time, currency string) types.CategoryTrendSeries {
+	series := types.CategoryTrendSeries{Category: category, Points: make([]types.CategoryTrendPoint, len(months))}
+	minors := make([]int64, len(months))
+	values := make([]float64, len(months))
+	for i, month := range months {
+		total := totals[month.Format(time.DateOnly)].Total.Unbound()
+		minors[i], values[i] = total.Minor, total.Float64()
+		series.Total = types.NewMoney(series.Total.Minor+total.Minor, "")
+
+		// The first months average the months of the window only
+		window := minors[max(0, i-2) : i+1]
+		var sum int64
+		for _, value := range window {
+			sum += value
+		}
+		series.Points[i] = types.CategoryTrendPoint{
+			Month:          month,
+			Total:          total,
+			Count:          totals[month.Format(time.DateOnly)].Count,
+			RollingAverage: types.NewMoney(sum, "").Mul(1 / float64(len(window))).Round(currency),
+		}
+	}
+
+	slope := linearSlope(values)
+	series.Slope = types.MoneyFromFloat(slope, "").Round(currency)
+	if mean := series.Total.Float64() / float64(len(months)); mean > 0 {
+		percent := math.Round(slope/mean*10000) / 100
+		series.SlopePercent = &percent
+	}
+	return series
+}
+
+// buildCategoryTrend returns the series of the categories over the months,
+// from the monthly totals of every category. Without categories, the top
+// categories by total get a series each and the others are lumped into one.
+func buildCategoryTrend(totals []types.CategoryMonthTotal, months []time.Time, categories []string, top int, currency string) []types.CategoryTrendSeries {
+	byCategory := map[string]map[string]types.CategoryMonthTotal{}
+	sums := map[string]int64{}
+	for _, total := range totals {
+		if byCategory[total.Category] == nil {
+			byCategory[total.Category] = map[string]types.CategoryMonthTotal{}
+		}
+		byCategory[total.Category][total.Month.Format(time.DateOnly)] = total
+		sums[total.Category] += total.Total.Unbound().Minor
+	}
+
+	series := []types.CategoryTrendSeries{}
+	if len(categories) > 0 {
+		for _, category := range categories {
+			series = append(series, categoryTrendSeries(category, byCategory[category], months, currency))
+		}
+		return series
+	}
+
+	ranked := sortedKeys(sums)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return sums[ranked[i]] > sums[ranked[j]]
+	})
+	for _, category := range ranked[:min(top, len(ranked))] {
+		series = append(series, categoryTrendSeries(category, byCategory[category], months, currency))
+	}
+	if len(ranked) <= top {
+		return series
+	}
+
+	rest := map[string]types.CategoryMonthTotal{}
+	for _, category := range ranked[top:] {
+		for month, total := range byCategory[category] {
+			lumped := rest[month]
+			lumped.Total = types.NewMoney(lumped.Total.Unbound().Minor+total.Total.Unbound().Minor, "")
+			lumped.Count += total.Count
+			rest[month] = lumped
+		}
+	}
+	other := categoryTrendSeries(categoryTrendOther, rest, months, currency)
+	other.Other = true
+	other.Categories = ranked[top:]
+	return append(series, other)
+}
+
+// categoryTrendRow is a month of a series in CSV.
+type categoryTrendRow struct {
+	Category string `csv:"category"`
+	types.CategoryTrendPoint
+}
+
+// categoryTrendRows returns a row per series and month.
+func categoryTrendRows(trend types.CategoryTrend) any {
+	rows := []categoryTrendRow{}
+	for _, series := range trend.Series {
+		for _, point := range series.Points {
+			rows = append(rows, categoryTrendRow{Category: series.Category, CategoryTrendPoint: point})
+		}
+	}
+	return rows
+}
+
+// GetCategoryTrend returns the expenses of ?category= (repeated or comma
+// separated) over the last ?months=12 completed months, in the user's
+// timezone: the total and the number of transactions of each month, the
+// rolling average of three months and the slope of the linear trend. The
+// categories are fixed names, their history is never split by a rename.
+// Without a category the ?top=3 categories of the window get a series each
+// and the others are lumped into "other", for a stacked chart. The
+// expenses excluded from the budgets are left out.
+func (s *FiberServer) GetCategoryTrend(c *fiber.Ctx) error {
+	db := s.dbFor(c)
+
+	user := c.Locals("user").(types.User)
+
+	months := c.QueryInt("months", 12)
+	if months < 2 || months > 36 {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "months must be between 2 and 36")
+	}
+	top := c.QueryInt("top", categoryTrendDefaultTop)
+	if top <= 0 || top > 10 {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "top must be between 1 and 10")
+	}
+
+	categories := []string{}
+	seen := map[string]bool{}
+	for _, value := range c.Context().QueryArgs().PeekMulti("category") {
+		for _, category := range strings.Split(string(value), ",") {
+			category = strings.TrimSpace(category)
+			if !isValidCategory(category) {
+				return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid transaction category").
+					WithDetails(FieldError{Field: "category", Message: "unknown category", Value: category})
+			}
+			if !seen[category] {
+				seen[category] = true
+				categories = append(categories, category)
+			}
+		}
+	}
+
+	timezone := userTimezone(user)
+	location := userLocation(user)
+	now := time.Now().In(location)
+	// The month in progress would drag the trend down
+	window := lastMonths(time.Date(now.Year(), now.Month()-1, 1, 0, 0, 0, 0, location), months)
+	for i, month := range window {
+		window[i] = time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, location)
+	}
+	from, to := window[0], window[len(window)-1].AddDate(0, 1, 0)
+
+	// The completed months move with the month
+	key := []string{strconv.Itoa(months), strconv.Itoa(top), strings.Join(categories, ","), now.Format("2006-01")}
+	return cachedReport(s, c, "category_trend", key, func() (types.CategoryTrend, error) {
+		trend := types.CategoryTrend{From: from, To: to, Timezone: timezone, Currency: s.baseCurrency(user)}
+		totals, err := db.GetCategoryMonthlyTotals(&user, from, to, timezone)
+		if err != nil {
+			log.Error(err)
+			return trend, NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not compute the category trend")
+		}
+		trend.Series = buildCategoryTrend(totals, window, categories, top, trend.Currency)
+		return trend, nil
+	}, categoryTrendRows)
+}
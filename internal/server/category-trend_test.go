@@ -0,0 +1,141 @@
+package server
+
+import (
+	"FinMa/internal/database"
+	"FinMa/types"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// categoryTrendDB answers the food expenses of the first two months of the
+// window.
+type categoryTrendDB struct {
+	database.Service
+}
+
+func (db *categoryTrendDB) WithContext(context.Context) database.Service {
+	return db
+}
+
+func (db *categoryTrendDB) GetCategoryMonthlyTotals(user *types.User, from, to time.Time, timezone string) ([]types.CategoryMonthTotal, error) {
+	return []types.CategoryMonthTotal{
+		{Category: "food", Month: from, Total: money(100), Count: 4},
+		{Category: "food", Month: from.AddDate(0, 1, 0), Total: money(120.5), Count: 5},
+	}, nil
+}
+
+func TestLinearSlope(t *testing.T) {
+	if slope := linearSlope([]float64{100, 104, 108, 112}); slope != 4 {
+		t.Errorf("expected a slope of 4; got %v", slope)
+	}
+	if slope := linearSlope([]float64{50}); slope != 0 {
+		t.Errorf("expected no slope for a single month; got %v", slope)
+	}
+}
+
+func TestBuildCategoryTrend(t *testing.T) {
+	months := []time.Time{month(2024, time.January), month(2024, time.February), month(2024, time.March), month(2024, time.April)}
+	totals := []types.CategoryMonthTotal{
+		{Category: "food", Month: month(2024, time.January), Total: money(100), Count: 4},
+		{Category: "food", Month: month(2024, time.February), Total: money(110), Count: 5},
+		{Category: "food", Month: month(2024, time.March), Total: money(120), Count: 5},
+		{Category: "food", Month: month(2024, time.April), Total: money(130), Count: 6},
+		{Category: "bills", Month: month(2024, time.January), Total: money(300), Count: 2},
+		{Category: "transport", Month: month(2024, time.March), Total: money(40), Count: 1},
+		{Category: "shopping", Month: month(2024, time.April), Total: money(25), Count: 1},
+	}
+
+	series := buildCategoryTrend(totals, months, []string{"food"}, 3, "EUR")
+	if len(series) != 1 {
+		t.Fatalf("expected the food series; got %v", series)
+	}
+	food := series[0]
+	if food.Total != money(460) || food.Slope != money(10) || food.SlopePercent == nil || *food.SlopePercent != 8.7 {
+		t.Errorf("expected food trending up 10 a month, 8.7%%; got %+v", food)
+	}
+	if food.Points[0].RollingAverage != money(100) || food.Points[3].RollingAverage != money(120) || food.Points[3].Count != 6 {
+		t.Errorf("expected the rolling averages and counts; got %+v", food.Points)
+	}
+
+	// A category without expenses is a flat series
+	series = buildCategoryTrend(totals, months, []string{"others"}, 3, "EUR")
+	if series[0].Total != money(0) || series[0].SlopePercent != nil || len(series[0].Points) != 4 {
+		t.Errorf("expected an empty series; got %+v", series[0])
+	}
+
+	// The top categories, the rest lumped
+	series = buildCategoryTrend(totals, months, nil, 2, "EUR")
+	if len(series) != 3 || series[0].Category != "food" || series[1].Category != "bills" {
+		t.Fatalf("expected food, bills and other; got %+v", series)
+	}
+	other := series[2]
+	if !other.Other || other.Category != "other" || other.Total != money(65) || len(other.Categories) != 2 {
+		t.Errorf("expected transport and shopping lumped; got %+v", other)
+	}
+	if other.Points[2].Total != money(40) || other.Points[3].Total != money(25) {
+		t.Errorf("expected the lumped monthly totals; got %+v", other.Points)
+	}
+}
+
+func TestCategoryTrendRows(t *testing.T) {
+	trend := types.CategoryTrend{Series: []types.CategoryTrendSeries{{
+		Category: "food",
+		Points:   []types.CategoryTrendPoint{{Month: month(2024, time.March), Total: money(412.3), Count: 18, RollingAverage: money(398.7)}},
+	}}}
+
+	var out bytes.Buffer
+	if err := writeCSV(&out, categoryTrendRows(trend)); err != nil {
+		t.Fatalf("error writing the rows. Err: %v", err)
+	}
+	if header, _, _ := strings.Cut(out.String(), "\n"); header != "category,month,total,count,rolling_average" {
+		t.Errorf("expected a column per field of the points; got %q", header)
+	}
+}
+
+func TestGetCategoryTrendCSV(t *testing.T) {
+	s := &FiberServer{App: fiber.New(fiber.Config{ErrorHandler: errorHandler}), db: &categoryTrendDB{}}
+	s.Use(func(c *fiber.Ctx) error {
+		c.Locals("user", types.User{ID: uuid.New()})
+		return c.Next()
+	})
+	s.Get("/reports/category-trend", s.GetCategoryTrend)
+
+	get := func(path string) (*http.Response, string) {
+		req, _ := http.NewRequest("GET", path, nil)
+		req.Header.Set("Accept", "text/csv")
+		resp, err := s.Test(req)
+		if err != nil {
+			t.Fatalf("error making request to server. Err: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	resp, body := get("/reports/category-trend?category=food&months=2")
+	if resp.StatusCode != fiber.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/csv") {
+		t.Fatalf("expected a CSV; got %v %s: %s", resp.Status, resp.Header.Get("Content-Type"), body)
+	}
+
+	now := time.Now().UTC()
+	first := time.Date(now.Year(), now.Month()-2, 1, 0, 0, 0, 0, time.UTC)
+	second := first.AddDate(0, 1, 0)
+	expected := "category,month,total,count,rolling_average\n" +
+		"food," + first.Format(time.RFC3339) + ",100.00,4,100.00\n" +
+		"food," + second.Format(time.RFC3339) + ",120.50,5,110.25\n"
+	// The BOM tells the spreadsheets the CSV is UTF-8
+	if got := strings.ReplaceAll(strings.TrimPrefix(body, "\ufeff"), "\r\n", "\n"); got != expected {
+		t.Errorf("expected a row per month of the food series:\n%s\ngot:\n%s", expected, got)
+	}
+
+	if resp, _ := get("/reports/category-trend?months=1"); resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("expected a window of a month refused; got %v", resp.Status)
+	}
+}
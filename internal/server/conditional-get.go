@@ -0,0 +1,65 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/compress"
+
+	"FinMa/types"
+)
+
+// streamingPaths are the long-lived responses, never compressed: the
+// compression would hold the events back, and the backups are compressed
+// as they are written.
+var streamingPaths = []string{
+	APIPrefix + "/events", APIPrefix + "/ws", APIPrefix + "/admin/backup",
+	"/api/events", "/api/ws", "/api/admin/backup",
+}
+
+// compression compresses the responses with brotli or gzip, as accepted by
+// the caller. The bodies under 200 bytes, the responses already encoded and
+// the content types that do not compress, such as images, are sent as is.
+func compression() fiber.Handler {
+	return compress.New(compress.Config{
+		Next: func(c *fiber.Ctx) bool {
+			return hasPathPrefix(c.Path(), streamingPaths)
+		},
+	})
+}
+
+// notModified sets the ETag of the response from the change token of its
+// data, and reports whether the caller already has this version, in which
+// case the handler answers 304 without loading the data. The ETag is weak,
+// the compressed and the plain bodies share it, and keyed by the URL, with
+// its filters and its field selection, and by the user as the token only
+// covers the rows.
+func notModified(c *fiber.Ctx, token string) bool {
+	var userID string
+	if user, ok := c.Locals("user").(types.User); ok {
+		userID = user.ID.String()
+	}
+
+	sum := sha256.Sum256([]byte(userID + "\n" + c.OriginalURL() + "\n" + token))
+	etag := `W/"` + hex.EncodeToString(sum[:16]) + `"`
+	c.Set(fiber.HeaderETag, etag)
+	c.Set(fiber.HeaderCacheControl, "private, no-cache")
+
+	return etagMatches(c.Get(fiber.HeaderIfNoneMatch), etag)
+}
+
+// etagMatches reports whether the If-None-Match header lists the ETag, with
+// the weak comparison of RFC 9110.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
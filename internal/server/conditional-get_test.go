@@ -0,0 +1,131 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/types"
+)
+
+func TestNotModified(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: errorHandler})
+	token := "3.abc"
+	loads := 0
+	app.Get("/transactions", func(c *fiber.Ctx) error {
+		if notModified(c, token) {
+			return c.SendStatus(fiber.StatusNotModified)
+		}
+		loads++
+		return c.JSON([]string{"a", "b", "c"})
+	})
+
+	get := func(ifNoneMatch string) *http.Response {
+		req, err := http.NewRequest("GET", "/transactions", nil)
+		if err != nil {
+			t.Fatalf("error creating request. Err: %v", err)
+		}
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("error making request to server. Err: %v", err)
+		}
+		return resp
+	}
+
+	first := get("")
+	etag := first.Header.Get("ETag")
+	if first.StatusCode != fiber.StatusOK || etag == "" {
+		t.Fatalf("expected a 200 with an ETag; got %d %q", first.StatusCode, etag)
+	}
+
+	if resp := get(etag); resp.StatusCode != fiber.StatusNotModified {
+		t.Errorf("expected status 304 for the same token; got %d", resp.StatusCode)
+	}
+	if loads != 1 {
+		t.Errorf("expected the data to be loaded once; got %d", loads)
+	}
+
+	// A deletion followed by a creation keeps the count but moves the latest update
+	token = "3.abd"
+	if resp := get(etag); resp.StatusCode != fiber.StatusOK {
+		t.Errorf("expected status 200 once the token changed; got %d", resp.StatusCode)
+	}
+}
+
+func TestEtagMatches(t *testing.T) {
+	tests := []struct {
+		ifNoneMatch string
+		expected    bool
+	}{
+		{`W/"abc"`, true},
+		{`"abc"`, true},
+		{`"xyz", W/"abc"`, true},
+		{`*`, true},
+		{`W/"abd"`, false},
+		{``, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.ifNoneMatch, `W/"abc"`); got != tt.expected {
+			t.Errorf("expected %v for %q; got %v", tt.expected, tt.ifNoneMatch, got)
+		}
+	}
+}
+
+func TestCompression(t *testing.T) {
+	transactions := make([]types.Transaction, 200)
+	for i := range transactions {
+		transactions[i] = types.Transaction{
+			ID:          uuid.New(),
+			Category:    "Groceries",
+			Amount:      money(float64(i) + 0.99),
+			Date:        time.Date(2024, time.March, 1+i%28, 0, 0, 0, 0, time.UTC),
+			Type:        "expense",
+			Description: fmt.Sprintf("Card payment %d", i),
+		}
+	}
+
+	app := fiber.New()
+	app.Use(compression())
+	app.Get("/api/v1/transactions", func(c *fiber.Ctx) error {
+		return c.JSON(transactions)
+	})
+	app.Get("/api/v1/small", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"status": "ok"})
+	})
+	app.Get("/api/v1/events", func(c *fiber.Ctx) error {
+		return c.JSON(transactions)
+	})
+
+	tests := []struct {
+		path     string
+		encoding string
+		expected string
+	}{
+		{"/api/v1/transactions", "gzip", "gzip"},
+		{"/api/v1/transactions", "br, gzip", "br"},
+		{"/api/v1/transactions", "", ""},
+		{"/api/v1/small", "gzip", ""},
+		{"/api/v1/events", "gzip", ""},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", tt.path, nil)
+		if err != nil {
+			t.Fatalf("error creating request. Err: %v", err)
+		}
+		req.Header.Set("Accept-Encoding", tt.encoding)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("error making request to server. Err: %v", err)
+		}
+		if got := resp.Header.Get("Content-Encoding"); got != tt.expected {
+			t.Errorf("expected %s with %q to be encoded %q; got %q", tt.path, tt.encoding, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2/middleware/cors"
+
+	"FinMa/internal/config"
+)
+
+// corsConfig validates the CORS settings and builds the configuration of
+// the CORS middleware. A wildcard origin with credentials is refused:
+// browsers reject the responses it produces.
+func corsConfig(settings config.CORS) (cors.Config, error) {
+	if err := settings.Validate(); err != nil {
+		return cors.Config{}, err
+	}
+
+	return cors.Config{
+		AllowOrigins:     strings.Join(settings.AllowedOrigins, ","),
+		AllowMethods:     strings.Join(settings.AllowedMethods, ","),
+		AllowHeaders:     strings.Join(settings.AllowedHeaders, ","),
+		AllowCredentials: settings.AllowCredentials,
+		MaxAge:           settings.MaxAge,
+	}, nil
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+
+	"FinMa/internal/config"
+)
+
+func TestCORSConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings config.CORS
+		valid    bool
+	}{
+		{"any origin", config.CORS{AllowedOrigins: []string{"*"}}, true},
+		{"listed origins with credentials", config.CORS{AllowedOrigins: []string{"https://app.example.com", "http://localhost:3000"}, AllowCredentials: true}, true},
+		{"any origin with credentials", config.CORS{AllowedOrigins: []string{"*"}, AllowCredentials: true}, false},
+		{"wildcard subdomain with credentials", config.CORS{AllowedOrigins: []string{"https://*.example.com"}, AllowCredentials: true}, false},
+		{"wildcard among origins", config.CORS{AllowedOrigins: []string{"https://app.example.com", "*"}}, false},
+		{"origin without scheme", config.CORS{AllowedOrigins: []string{"app.example.com"}}, false},
+		{"origin with a path", config.CORS{AllowedOrigins: []string{"https://app.example.com/login"}}, false},
+		{"no origin", config.CORS{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := corsConfig(tt.settings)
+			if (err == nil) != tt.valid {
+				t.Errorf("expected valid %v; got %v", tt.valid, err)
+			}
+		})
+	}
+}
+
+func newCORSTestApp(t *testing.T) *fiber.App {
+	t.Helper()
+	corsSettings, err := corsConfig(config.CORS{
+		AllowedOrigins:   []string{"https://app.example.com"},
+		AllowedMethods:   []string{"GET", "POST"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		AllowCredentials: true,
+		MaxAge:           600,
+	})
+	if err != nil {
+		t.Fatalf("unexpected invalid configuration. Err: %v", err)
+	}
+
+	app := fiber.New()
+	s := &FiberServer{App: app}
+	app.Use(cors.New(corsSettings))
+	app.Get("/api/accounts", s.Authorize("user"), s.HelloWorldHandler)
+	return app
+}
+
+func TestCORSPreflightSkipsAuthorization(t *testing.T) {
+	app := newCORSTestApp(t)
+
+	req, err := http.NewRequest("OPTIONS", "/api/accounts", nil)
+	if err != nil {
+		t.Fatalf("error creating request. Err: %v", err)
+	}
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	req.Header.Set("Access-Control-Request-Headers", "Authorization")
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("expected status 204; got %v", resp.Status)
+	}
+
+	expected := map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET,POST",
+		"Access-Control-Allow-Headers":     "Content-Type,Authorization",
+		"Access-Control-Max-Age":           "600",
+	}
+	for header, value := range expected {
+		if got := resp.Header.Get(header); got != value {
+			t.Errorf("expected %s to be %q; got %q", header, value, got)
+		}
+	}
+}
+
+func TestCORSDisallowedOrigin(t *testing.T) {
+	app := newCORSTestApp(t)
+
+	req, err := http.NewRequest("GET", "/api/accounts", nil)
+	if err != nil {
+		t.Fatalf("error creating request. Err: %v", err)
+	}
+	req.Header.Set("Origin", "https://evil.example.com")
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+	for _, header := range []string{"Access-Control-Allow-Origin", "Access-Control-Allow-Credentials"} {
+		if got := resp.Header.Get(header); got != "" {
+			t.Errorf("expected no %s for a disallowed origin; got %q", header, got)
+		}
+	}
+	if vary := resp.Header.Get("Vary"); vary != "Origin" {
+		t.Errorf("expected Vary: Origin; got %q", vary)
+	}
+}
@@ -0,0 +1,236 @@
+package server
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"FinMa/internal/i18n"
+	"FinMa/internal/xlsx"
+	"FinMa/types"
+)
+
+// The formats a list or a report may be answered in, with ?format= or the
+// Accept header.
+const (
+	formatJSON = "json"
+	formatCSV  = "csv"
+	formatXLSX = "xlsx"
+)
+
+// formatTypes are the media types of the formats, in the Accept header.
+var formatTypes = map[string]string{
+	formatJSON: fiber.MIMEApplicationJSON,
+	formatCSV:  "text/csv",
+	formatXLSX: xlsx.ContentType,
+}
+
+// csvRowLimit bounds the rows of a CSV. The lists are not paginated in CSV,
+// the whole filtered set is sent up to this limit.
+const csvRowLimit = 10000
+
+// utf8BOM starts the CSV files so that Excel reads them as UTF-8.
+const utf8BOM = "\xEF\xBB\xBF"
+
+// responseFormat returns the format the request asks for among the formats
+// of the endpoint, with ?format= or else the Accept header. The first format
+// is the default, a request accepting none of them is refused with a 406
+// listing them.
+func responseFormat(c *fiber.Ctx, formats ...string) (string, error) {
+	if format := c.Query("format"); format != "" {
+		for _, supported := range formats {
+			if format == supported {
+				return format, nil
+			}
+		}
+		return "", notAcceptable(formats)
+	}
+
+	// Accepts returns the first offer without an Accept header
+	offers := make([]string, len(formats))
+	for i, format := range formats {
+		offers[i] = formatTypes[format]
+	}
+	accepted := c.Accepts(offers...)
+	for _, format := range formats {
+		if formatTypes[format] == accepted {
+			return format, nil
+		}
+	}
+	return "", notAcceptable(formats)
+}
+
+// notAcceptable is the error of a request for a format the endpoint does
+// not support.
+func notAcceptable(formats []string) error {
+	supported := strings.Join(formats, ", ")
+	return NewAPIError(fiber.StatusNotAcceptable, CodeNotAcceptable, "The format is not supported, expected one of: "+supported).
+		WithParams(i18n.Params{"formats": supported})
+}
+
+// sendCSV answers with the rows as a CSV file named after the report. The
+// response varies with the Accept header, which may have chosen the format.
+func sendCSV(c *fiber.Ctx, name string, rows any) error {
+	c.Vary(fiber.HeaderAccept)
+	c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s.csv"`, name))
+
+	body := c.Response().BodyWriter()
+	if _, err := io.WriteString(body, utf8BOM); err != nil {
+		return err
+	}
+	return writeCSV(body, rows)
+}
+
+// cachedReport answers with the report of compute, cached as by cachedJSON,
+// or with its rows as CSV when the request asks for it. The CSV is computed
+// on every request, its rows come from the same report.
+func cachedReport[T any](s *FiberServer, c *fiber.Ctx, name string, parts []string, compute func() (T, error), rows func(T) any) error {
+	format, err := responseFormat(c, formatJSON, formatCSV)
+	if err != nil {
+		return err
+	}
+	if format == formatCSV {
+		s.fetchMissingRates(c, c.Locals("user").(types.User))
+		report, err := compute()
+		if err != nil {
+			return err
+		}
+		return sendCSV(c, strings.ReplaceAll(name, "_", "-"), rows(report))
+	}
+
+	c.Vary(fiber.HeaderAccept)
+	return s.cachedJSON(c, name, parts, func() (any, error) {
+		return compute()
+	})
+}
+
+// csvColumn is a column of the CSV of a struct: a field tagged with its
+// name, csv:"amount". The fields of the embedded structs are columns of
+// their own, the fields without a tag are left out.
+type csvColumn struct {
+	name  string
+	index []int
+}
+
+// csvColumns returns the columns of the struct, in the order of its fields.
+func csvColumns(t reflect.Type) []csvColumn {
+	var columns []csvColumn
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("csv")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			for _, column := range csvColumns(field.Type) {
+				column.index = append([]int{i}, column.index...)
+				columns = append(columns, column)
+			}
+			continue
+		}
+		if name == "" || name == "-" || !field.IsExported() {
+			continue
+		}
+		columns = append(columns, csvColumn{name: name, index: field.Index})
+	}
+	return columns
+}
+
+// writeCSV writes the rows, a slice of structs, with a header row naming
+// their columns.
+func writeCSV(w io.Writer, rows any) error {
+	value := reflect.ValueOf(rows)
+	if value.Kind() != reflect.Slice || value.Type().Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("csv rows must be a slice of structs, got %T", rows)
+	}
+
+	columns := csvColumns(value.Type().Elem())
+	writer := csv.NewWriter(w)
+	record := make([]string, len(columns))
+	for i, column := range columns {
+		record[i] = column.name
+	}
+	if err := writer.Write(record); err != nil {
+		return err
+	}
+
+	for i := 0; i < value.Len(); i++ {
+		row := value.Index(i)
+		for j, column := range columns {
+			record[j] = csvValue(row.FieldByIndex(column.index))
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// csvTable returns the header and the records of the rows, a slice of
+// structs, formatted as by writeCSV.
+func csvTable(rows any) ([]string, [][]string, error) {
+	value := reflect.ValueOf(rows)
+	if value.Kind() != reflect.Slice || value.Type().Elem().Kind() != reflect.Struct {
+		return nil, nil, fmt.Errorf("csv rows must be a slice of structs, got %T", rows)
+	}
+
+	columns := csvColumns(value.Type().Elem())
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.name
+	}
+	records := make([][]string, value.Len())
+	for i := range records {
+		row := value.Index(i)
+		records[i] = make([]string, len(columns))
+		for j, column := range columns {
+			records[i][j] = csvValue(row.FieldByIndex(column.index))
+		}
+	}
+	return header, records, nil
+}
+
+// csvValue formats a field of a row. Nil pointers and zero dates are empty,
+// lists are joined with semicolons. The texts starting like a formula are
+// prefixed with a quote so that the spreadsheets do not run them.
+func csvValue(value reflect.Value) string {
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return ""
+		}
+		value = value.Elem()
+	}
+
+	switch v := value.Interface().(type) {
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.Format(time.RFC3339)
+	case fmt.Stringer:
+		return v.String()
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		text := value.String()
+		if text != "" && strings.ContainsRune("=+-@", rune(text[0])) {
+			return "'" + text
+		}
+		return text
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(value.Float(), 'f', -1, 64)
+	case reflect.Slice:
+		items := make([]string, value.Len())
+		for i := range items {
+			items[i] = csvValue(value.Index(i))
+		}
+		return strings.Join(items, ";")
+	}
+	return fmt.Sprint(value.Interface())
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"FinMa/types"
+)
+
+func TestWriteCSV(t *testing.T) {
+	type row struct {
+		Name    string     `csv:"name"`
+		Ignored string     `json:"ignored"`
+		Amount  float64    `csv:"amount"`
+		Tags    []string   `csv:"tags"`
+		Due     *time.Time `csv:"due"`
+		types.NetWorthPoint
+	}
+	due := time.Date(2024, time.March, 5, 0, 0, 0, 0, time.UTC)
+	rows := []row{
+		{Name: `Rent, "flat"`, Amount: 950.5, Tags: []string{"home", "monthly"}, Due: &due, NetWorthPoint: types.NetWorthPoint{Month: due, NetWorth: money(1200)}},
+		{Name: "=HYPERLINK(\"x\")", Amount: -12, NetWorthPoint: types.NetWorthPoint{NetWorth: money(0.1)}},
+	}
+
+	var out bytes.Buffer
+	if err := writeCSV(&out, rows); err != nil {
+		t.Fatalf("error writing the CSV. Err: %v", err)
+	}
+
+	expected := "name,amount,tags,due,month,net_worth\n" +
+		`"Rent, ""flat""",950.5,home;monthly,2024-03-05T00:00:00Z,2024-03-05T00:00:00Z,1200.00` + "\n" +
+		`"'=HYPERLINK(""x"")",-12,,,,0.10` + "\n"
+	if out.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, out.String())
+	}
+
+	if err := writeCSV(&out, row{}); err == nil {
+		t.Error("expected an error for rows that are not a slice")
+	}
+}
+
+func TestTransactionsCSV(t *testing.T) {
+	s, _ := newFieldsetsTestServer(3)
+
+	tests := []struct {
+		name   string
+		path   string
+		accept string
+	}{
+		{"accept header", "/transactions", "text/csv"},
+		{"query parameter", "/transactions?format=csv&limit=1", "application/json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tt.path, nil)
+			if err != nil {
+				t.Fatalf("error creating request. Err: %v", err)
+			}
+			req.Header.Set("Accept", tt.accept)
+			resp, err := s.Test(req)
+			if err != nil {
+				t.Fatalf("error making request to server. Err: %v", err)
+			}
+			if resp.StatusCode != fiber.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/csv") {
+				t.Fatalf("expected a CSV; got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+			}
+			var body bytes.Buffer
+			body.ReadFrom(resp.Body)
+			if !strings.HasPrefix(body.String(), utf8BOM+"id,category,amount,date,type,") {
+				t.Errorf("expected the BOM and the header row; got %q", body.String())
+			}
+			// Not paginated
+			if lines := strings.Count(body.String(), "\n"); lines != 4 {
+				t.Errorf("expected the header and 3 rows; got %d lines", lines)
+			}
+		})
+	}
+
+	// JSON stays the default
+	resp, body := getFieldsets(t, s, "/transactions", "")
+	var transactions []types.Transaction
+	if err := json.Unmarshal(body, &transactions); err != nil || resp.Header.Get("Vary") == "" {
+		t.Errorf("expected JSON varying with Accept; got %s, %v", body, err)
+	}
+}
+
+func TestUnsupportedFormat(t *testing.T) {
+	s, _ := newFieldsetsTestServer(1)
+
+	for _, query := range []string{"?format=xml", ""} {
+		req, err := http.NewRequest("GET", "/transactions"+query, nil)
+		if err != nil {
+			t.Fatalf("error creating request. Err: %v", err)
+		}
+		if query == "" {
+			req.Header.Set("Accept", "application/xml")
+		}
+		resp, err := s.Test(req)
+		if err != nil {
+			t.Fatalf("error making request to server. Err: %v", err)
+		}
+		if resp.StatusCode != fiber.StatusNotAcceptable {
+			t.Fatalf("expected status 406; got %d", resp.StatusCode)
+		}
+		var body errorBody
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("error decoding the response. Err: %v", err)
+		}
+		if body.Error.Code != CodeNotAcceptable || !strings.HasSuffix(body.Error.Message, "json, csv, xlsx") {
+			t.Errorf("expected the supported formats; got %+v", body.Error)
+		}
+	}
+}
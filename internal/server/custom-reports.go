@@ -0,0 +1,301 @@
+package server
+
+import (
+	"FinMa/internal/database"
+	"FinMa/internal/i18n"
+	"FinMa/types"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	// customReportDefaultLimit is the number of groups of a custom report
+	// without a limit.
+	customReportDefaultLimit = 100
+	// customReportMaxDays bounds the custom windows of the custom reports.
+	customReportMaxDays = 3660
+)
+
+// customReportWindow returns the bounds of the window of the spec at now,
+// in loc. The calendar windows start at the local midnight, the rolling
+// ones end now.
+func customReportWindow(spec types.CustomReportSpec, now time.Time, loc *time.Location) (time.Time, time.Time, error) {
+	local := now.In(loc)
+	month := time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, loc)
+	year := time.Date(local.Year(), time.January, 1, 0, 0, 0, 0, loc)
+
+	switch spec.Window {
+	case "", "last_90_days":
+		return now.AddDate(0, 0, -90), now, nil
+	case "last_30_days":
+		return now.AddDate(0, 0, -30), now, nil
+	case "last_365_days":
+		return now.AddDate(0, 0, -365), now, nil
+	case "month_to_date":
+		return month, now, nil
+	case "year_to_date":
+		return year, now, nil
+	case "previous_month":
+		return month.AddDate(0, -1, 0), month, nil
+	case "previous_year":
+		return year.AddDate(-1, 0, 0), year, nil
+	case "custom":
+		if spec.From == nil || spec.To == nil {
+			return time.Time{}, time.Time{}, errors.New("a custom window needs from and to")
+		}
+		if !spec.From.Before(*spec.To) {
+			return time.Time{}, time.Time{}, errors.New("from must be before to")
+		}
+		if spec.To.Sub(*spec.From) > customReportMaxDays*24*time.Hour {
+			return time.Time{}, time.Time{}, errors.New("a custom window spans 10 years at most")
+		}
+		return *spec.From, *spec.To, nil
+	}
+	return time.Time{}, time.Time{}, errors.New("unknown window")
+}
+
+// validateCustomReport checks the spec of a custom report: the values of
+// its fields, its categories and its window, and that the user can view its
+// accounts.
+func (s *FiberServer) validateCustomReport(user types.User, spec types.CustomReportSpec) error {
+	if err := validate.Struct(spec); err != nil {
+		return err
+	}
+	// The amounts are not numbers to the validator, their bound is checked
+	// here and reported like its own
+	invalid := NewAPIError(fiber.StatusUnprocessableEntity, CodeValidationFailed, "Some fields are invalid")
+	for i, amount := range []*types.Money{spec.MinAmount, spec.MaxAmount} {
+		if amount != nil && amount.Sign() < 0 {
+			detail := FieldError{Field: []string{"min_amount", "max_amount"}[i], Value: amount, rule: "gte", param: "0"}
+			detail.Message = validationMessage(i18n.Default, detail)
+			invalid.Details = append(invalid.Details, detail)
+		}
+	}
+	if len(invalid.Details) > 0 {
+		return invalid
+	}
+	for _, category := range spec.Categories {
+		if !isValidCategory(category) {
+			return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid transaction category").
+				WithDetails(FieldError{Field: "categories", Message: "unknown category", Value: category})
+		}
+	}
+	for _, id := range spec.AccountIDs {
+		if _, ok := s.findUserBankAccount(user, id.String(), "viewer"); !ok {
+			return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid bank account").
+				WithDetails(FieldError{Field: "account_ids", Message: "unknown bank account", Value: id.String()})
+		}
+	}
+	if spec.MinAmount != nil && spec.MaxAmount != nil && spec.MinAmount.Unbound().Minor > spec.MaxAmount.Unbound().Minor {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "min_amount must not be above max_amount")
+	}
+	if _, _, err := customReportWindow(spec, time.Now(), time.UTC); err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, err.Error())
+	}
+	return nil
+}
+
+// runCustomReport runs the spec for the user, with the bank names as the
+// labels of the account groups.
+func (s *FiberServer) runCustomReport(db database.Service, user types.User, spec types.CustomReportSpec, now time.Time) (types.CustomReport, error) {
+	location := userLocation(user)
+	from, to, err := customReportWindow(spec, now, location)
+	if err != nil {
+		return types.CustomReport{}, NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, err.Error())
+	}
+	report := types.CustomReport{
+		Definition: spec,
+		From:       from,
+		To:         to,
+		Timezone:   userTimezone(user),
+		Currency:   s.baseCurrency(user),
+	}
+
+	limit := spec.Limit
+	if limit == 0 {
+		limit = customReportDefaultLimit
+	}
+	rows, truncated, err := db.RunCustomReport(&user, spec, from, to, report.Timezone, limit)
+	if err != nil {
+		log.Error(err)
+		return report, NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not run the custom report")
+	}
+
+	names := map[string]string{}
+	if spec.GroupBy == "account" {
+		for _, account := range db.GetBankAccounts(&user, false) {
+			names[account.ID.String()] = account.BankName
+		}
+	}
+	for i := range rows {
+		rows[i].Label = names[rows[i].Group]
+	}
+	report.Rows = rows
+	report.Truncated = truncated
+	return report, nil
+}
+
+// findUserReportDefinition returns the report definition of the user.
+func (s *FiberServer) findUserReportDefinition(user types.User, id string) (types.ReportDefinition, bool) {
+	definition := s.db.GetReportDefinitionByID(id)
+	if definition.ID == uuid.Nil || definition.UserID != user.ID {
+		return types.ReportDefinition{}, false
+	}
+	return definition, true
+}
+
+// reportDefinitionRequest is the body saving a custom report.
+type reportDefinitionRequest struct {
+	Name       string                 `json:"name"`
+	Definition types.CustomReportSpec `json:"definition"`
+}
+
+// parseReportDefinition reads and checks the body saving a custom report.
+func (s *FiberServer) parseReportDefinition(c *fiber.Ctx, user types.User) (reportDefinitionRequest, error) {
+	var body reportDefinitionRequest
+	if err := c.BodyParser(&body); err != nil {
+		log.Error(err)
+		return body, NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" || len(body.Name) > 100 {
+		return body, NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "A name of 100 characters at most is required")
+	}
+	return body, s.validateCustomReport(user, body.Definition)
+}
+
+// CreateReportDefinition saves a custom report of the user, to be run with
+// GetCustomReport.
+func (s *FiberServer) CreateReportDefinition(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	body, err := s.parseReportDefinition(c, user)
+	if err != nil {
+		return err
+	}
+
+	definition := &types.ReportDefinition{
+		ID:         uuid.New(),
+		Name:       body.Name,
+		Definition: body.Definition,
+		UserID:     user.ID,
+	}
+	if err := s.db.CreateReportDefinition(definition); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not save the custom report")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(definition)
+}
+
+// GetReportDefinitions lists the custom reports saved by the user, by name.
+func (s *FiberServer) GetReportDefinitions(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+
+	definitions := s.db.GetReportDefinitions(user.ID)
+	if definitions == nil {
+		definitions = []types.ReportDefinition{}
+	}
+	return c.JSON(definitions)
+}
+
+// UpdateReportDefinition replaces the name and the definition of a custom
+// report of the user.
+func (s *FiberServer) UpdateReportDefinition(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	definition, ok := s.findUserReportDefinition(user, c.Params("id"))
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Custom report not found")
+	}
+	body, err := s.parseReportDefinition(c, user)
+	if err != nil {
+		return err
+	}
+
+	definition.Name = body.Name
+	definition.Definition = body.Definition
+	if err := s.db.UpdateReportDefinition(&definition); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not update the custom report")
+	}
+
+	return c.JSON(definition)
+}
+
+// DeleteReportDefinition deletes a custom report of the user.
+func (s *FiberServer) DeleteReportDefinition(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	definition, ok := s.findUserReportDefinition(user, c.Params("id"))
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Custom report not found")
+	}
+
+	if err := s.db.DeleteReportDefinition(&definition); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not delete the custom report")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// GetCustomReport runs a custom report saved by the user, its window taken
+// at the time of the request. The CSV holds the rows.
+func (s *FiberServer) GetCustomReport(c *fiber.Ctx) error {
+	db := s.dbFor(c)
+
+	user := c.Locals("user").(types.User)
+	definition, ok := s.findUserReportDefinition(user, c.Params("id"))
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Custom report not found")
+	}
+
+	now := time.Now()
+	from, to, err := customReportWindow(definition.Definition, now, userLocation(user))
+	if err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, err.Error())
+	}
+	// The rolling windows end now, they are cached by the minute
+	key := []string{definition.ID.String(), definition.UpdatedAt.Format(time.RFC3339Nano), from.Truncate(time.Minute).Format(time.RFC3339), to.Truncate(time.Minute).Format(time.RFC3339)}
+	return cachedReport(s, c, "custom_report", key, func() (types.CustomReport, error) {
+		report, err := s.runCustomReport(db, user, definition.Definition, now)
+		report.ReportID = &definition.ID
+		report.Name = definition.Name
+		return report, err
+	}, func(report types.CustomReport) any {
+		return report.Rows
+	})
+}
+
+// RunCustomReport runs the custom report of the body without saving it.
+// The CSV holds the rows.
+func (s *FiberServer) RunCustomReport(c *fiber.Ctx) error {
+	db := s.dbFor(c)
+
+	format, err := responseFormat(c, formatJSON, formatCSV)
+	if err != nil {
+		return err
+	}
+
+	var spec types.CustomReportSpec
+	if err := c.BodyParser(&spec); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+	user := c.Locals("user").(types.User)
+	if err := s.validateCustomReport(user, spec); err != nil {
+		return err
+	}
+
+	report, err := s.runCustomReport(db, user, spec, time.Now())
+	if err != nil {
+		return err
+	}
+	if format == formatCSV {
+		return sendCSV(c, "custom-report", report.Rows)
+	}
+	c.Vary(fiber.HeaderAccept)
+	return c.JSON(report)
+}
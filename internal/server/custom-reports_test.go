@@ -0,0 +1,82 @@
+package server
+
+import (
+	"FinMa/types"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+func TestCustomReportWindow(t *testing.T) {
+	location, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, time.March, 15, 10, 0, 0, 0, location)
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, location)
+	}
+
+	for window, expected := range map[string][2]time.Time{
+		"":               {now.AddDate(0, 0, -90), now},
+		"last_30_days":   {now.AddDate(0, 0, -30), now},
+		"month_to_date":  {date(2024, time.March, 1), now},
+		"year_to_date":   {date(2024, time.January, 1), now},
+		"previous_month": {date(2024, time.February, 1), date(2024, time.March, 1)},
+		"previous_year":  {date(2023, time.January, 1), date(2024, time.January, 1)},
+	} {
+		from, to, err := customReportWindow(types.CustomReportSpec{Window: window}, now, location)
+		if err != nil || !from.Equal(expected[0]) || !to.Equal(expected[1]) {
+			t.Errorf("expected %v for %q; got %v to %v (%v)", expected, window, from, to, err)
+		}
+	}
+
+	from, to := date(2024, time.January, 1), date(2024, time.February, 1)
+	if _, _, err := customReportWindow(types.CustomReportSpec{Window: "custom", From: &from}, now, location); err == nil {
+		t.Error("expected a custom window without its end to be refused")
+	}
+	if _, _, err := customReportWindow(types.CustomReportSpec{Window: "custom", From: &to, To: &from}, now, location); err == nil {
+		t.Error("expected a custom window ending before its start to be refused")
+	}
+	found, _, err := customReportWindow(types.CustomReportSpec{Window: "custom", From: &from, To: &to}, now, location)
+	if err != nil || !found.Equal(from) {
+		t.Errorf("expected the custom window; got %v (%v)", found, err)
+	}
+}
+
+func TestValidateCustomReport(t *testing.T) {
+	s := &FiberServer{}
+	valid := types.CustomReportSpec{Metric: "sum", GroupBy: "category", Types: []string{"expense", "income"}, Categories: []string{"food"}}
+	if err := s.validateCustomReport(types.User{}, valid); err != nil {
+		t.Errorf("expected the spec to be valid; got %v", err)
+	}
+
+	for name, spec := range map[string]types.CustomReportSpec{
+		"metric":   {Metric: "max", GroupBy: "category"},
+		"group_by": {Metric: "sum", GroupBy: "category; DROP TABLE transactions"},
+		"types":    {Metric: "sum", GroupBy: "category", Types: []string{"refund"}},
+		"window":   {Metric: "sum", GroupBy: "month", Window: "forever"},
+		"limit":    {Metric: "count", GroupBy: "merchant", Limit: 5000},
+	} {
+		var errs validator.ValidationErrors
+		if err := s.validateCustomReport(types.User{}, spec); !errors.As(err, &errs) {
+			t.Errorf("expected the %s to be refused; got %v", name, err)
+		}
+	}
+
+	for name, spec := range map[string]types.CustomReportSpec{
+		"category": {Metric: "sum", GroupBy: "category", Categories: []string{"casino"}},
+		"amounts":  {Metric: "sum", GroupBy: "category", MinAmount: new(types.Money), MaxAmount: new(types.Money)},
+		"custom":   {Metric: "sum", GroupBy: "category", Window: "custom"},
+	} {
+		if name == "amounts" {
+			*spec.MinAmount = money(10)
+		}
+		var apiErr *APIError
+		if err := s.validateCustomReport(types.User{}, spec); !errors.As(err, &apiErr) {
+			t.Errorf("expected the %s to be refused; got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package server
+
+import (
+	"FinMa/types"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// dashboardTopCategories is the number of categories in top_categories.
+	dashboardTopCategories = 5
+	// dashboardRecentTransactions is the number of transactions in recent_transactions.
+	dashboardRecentTransactions = 10
+	// dashboardUpcomingDays is how far ahead upcoming lists recurring transactions.
+	dashboardUpcomingDays = 7
+)
+
+// dashboardSections lists the sections of the dashboard, in response order.
+var dashboardSections = []string{
+	"balances",
+	"month",
+	"top_categories",
+	"budgets",
+	"recent_transactions",
+	"upcoming",
+	"health",
+	"unread_notifications",
+}
+
+// parseDashboardSections reads the comma separated list of sections to
+// compute. An empty list selects every section.
+func parseDashboardSections(value string) (map[string]bool, error) {
+	sections := make(map[string]bool, len(dashboardSections))
+	if strings.TrimSpace(value) == "" {
+		for _, section := range dashboardSections {
+			sections[section] = true
+		}
+		return sections, nil
+	}
+
+	known := make(map[string]bool, len(dashboardSections))
+	for _, section := range dashboardSections {
+		known[section] = true
+	}
+	for _, section := range strings.Split(value, ",") {
+		section = strings.TrimSpace(section)
+		if !known[section] {
+			return nil, fmt.Errorf("unknown dashboard section %q", section)
+		}
+		sections[section] = true
+	}
+	return sections, nil
+}
+
+// upcomingTransactions returns the occurrences of the recurring income and
+// expenses due in (now, end), by due date. Income and expenses sharing a
+// description are tracked apart.
+func upcomingTransactions(recurring []types.Transaction, now, end time.Time) []types.UpcomingTransaction {
+	byType := make(map[string][]types.Transaction)
+	for _, transaction := range recurring {
+		byType[transaction.Type] = append(byType[transaction.Type], transaction)
+	}
+
+	upcoming := make([]types.UpcomingTransaction, 0)
+	for _, transactionType := range []string{"income", "expense"} {
+		for _, occurrence := range upcomingRecurring(byType[transactionType], now, end) {
+			upcoming = append(upcoming, types.UpcomingTransaction{
+				Description: occurrence.Description,
+				Type:        transactionType,
+				Amount:      occurrence.Amount,
+				DueDate:     occurrence.DueDate,
+			})
+		}
+	}
+
+	sort.SliceStable(upcoming, func(i, j int) bool {
+		return upcoming[i].DueDate.Before(upcoming[j].DueDate)
+	})
+	return upcoming
+}
+
+// GetDashboard aggregates the home screen of the app in one response: the
+// total balance, the income and expenses of the current month in the user's
+// timezone, the top categories of the month, the progress of every budget,
+// the latest transactions, the recurring transactions due in the next week,
+// the health metrics of the month and the number of unread notifications.
+// The amounts are in the base currency of the user, given as currency.
+// ?sections=balances,budgets restricts the response to the listed sections,
+// the others are not computed.
+func (s *FiberServer) GetDashboard(c *fiber.Ctx) error {
+	db := s.dbFor(c)
+
+	sections, err := parseDashboardSections(c.Query("sections"))
+	if err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, err.Error()).
+			WithDetails(FieldError{Field: "sections", Message: "must be among: " + strings.Join(dashboardSections, ", ")})
+	}
+
+	user := c.Locals("user").(types.User)
+	now := time.Now()
+
+	// The budgets and the upcoming transactions move with the day, the
+	// amounts with the base currency
+	token, err := db.DashboardChangeToken(&user)
+	if err != nil {
+		return err
+	}
+	day := now.In(userLocation(user)).Format(time.DateOnly)
+	if notModified(c, day+"-"+s.baseCurrency(user)+"-"+token) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	// The change token also covers the notifications, which do not
+	// invalidate the cache
+	selected := []string{day, token}
+	for _, section := range dashboardSections {
+		if sections[section] {
+			selected = append(selected, section)
+		}
+	}
+	return s.cachedJSON(c, "dashboard", selected, func() (any, error) {
+		return s.computeDashboard(c, user, sections, now)
+	})
+}
+
+// computeDashboard computes the sections of the dashboard of the user.
+func (s *FiberServer) computeDashboard(c *fiber.Ctx, user types.User, sections map[string]bool, now time.Time) (fiber.Map, error) {
+	db := s.dbFor(c)
+
+	from := monthStart(now, userLocation(user))
+	to := from.AddDate(0, 1, 0)
+
+	failed := func(err error, section string) error {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not compute dashboard "+section)
+	}
+
+	dashboard := fiber.Map{"currency": s.baseCurrency(user)}
+
+	if sections["balances"] {
+		balances, err := db.GetTotalBalance(&user)
+		if err != nil {
+			return nil, failed(err, "balances")
+		}
+		dashboard["balances"] = balances
+	}
+
+	if sections["month"] {
+		income, expenses, err := db.GetIncomeAndExpenses(&user, from, to)
+		if err != nil {
+			return nil, failed(err, "month")
+		}
+		net, err := income.Sub(expenses)
+		if err != nil {
+			return nil, failed(err, "month")
+		}
+		dashboard["month"] = types.DashboardMonth{
+			From:     from,
+			Income:   income,
+			Expenses: expenses,
+			Net:      net,
+		}
+	}
+
+	if sections["top_categories"] {
+		categories, err := db.GetTopCategories(&user, from, to, dashboardTopCategories)
+		if err != nil {
+			return nil, failed(err, "top categories")
+		}
+		dashboard["top_categories"] = categories
+	}
+
+	if sections["budgets"] {
+		progress, err := s.budgetsProgress(user, db.GetBudgets(&user), now)
+		if err != nil {
+			return nil, failed(err, "budgets")
+		}
+		dashboard["budgets"] = progress
+	}
+
+	if sections["recent_transactions"] {
+		transactions := db.GetTransactions(&user, types.TransactionFilter{Limit: dashboardRecentTransactions})
+		if transactions == nil {
+			transactions = []types.Transaction{}
+		}
+		dashboard["recent_transactions"] = transactions
+	}
+
+	if sections["upcoming"] {
+		recurring := db.GetRecurringTransactions(&user, now.AddDate(0, -forecastRecurringLookback, 0))
+		dashboard["upcoming"] = upcomingTransactions(recurring, now, now.AddDate(0, 0, dashboardUpcomingDays))
+	}
+
+	if sections["health"] {
+		// The month with its change since the previous one
+		report, err := s.healthMetrics(db, user, 2, now)
+		if err != nil {
+			return nil, failed(err, "health")
+		}
+		dashboard["health"] = report.Monthly[len(report.Monthly)-1]
+	}
+
+	if sections["unread_notifications"] {
+		count, err := db.CountUnreadNotifications(user.ID)
+		if err != nil {
+			return nil, failed(err, "notifications")
+		}
+		dashboard["unread_notifications"] = count
+	}
+
+	return dashboard, nil
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"FinMa/types"
+	"testing"
+)
+
+func TestParseDashboardSections(t *testing.T) {
+	sections, err := parseDashboardSections("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(sections) != len(dashboardSections) {
+		t.Errorf("expected every section by default; got %v", sections)
+	}
+
+	sections, err = parseDashboardSections("balances, budgets")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(sections) != 2 || !sections["balances"] || !sections["budgets"] {
+		t.Errorf("expected balances and budgets; got %v", sections)
+	}
+
+	if _, err := parseDashboardSections("balances,weather"); err == nil {
+		t.Error("expected an error for an unknown section")
+	}
+}
+
+func TestUpcomingTransactions(t *testing.T) {
+	now := day(2024, 3, 10)
+	recurring := []types.Transaction{
+		{Description: "Salary", Type: "income", Amount: money(3000), Date: day(2024, 2, 15)},
+		{Description: "Rent", Type: "expense", Amount: money(900), Date: day(2024, 2, 12)},
+		{Description: "Gym", Type: "expense", Amount: money(30), Date: day(2024, 2, 25)},
+	}
+
+	upcoming := upcomingTransactions(recurring, now, now.AddDate(0, 0, dashboardUpcomingDays))
+	if len(upcoming) != 2 {
+		t.Fatalf("expected 2 upcoming transactions; got %d", len(upcoming))
+	}
+	if upcoming[0].Description != "Rent" || !upcoming[0].DueDate.Equal(day(2024, 3, 12)) || upcoming[0].Type != "expense" {
+		t.Errorf("expected rent due on March 12; got %+v", upcoming[0])
+	}
+	if upcoming[1].Description != "Salary" || !upcoming[1].DueDate.Equal(day(2024, 3, 15)) || upcoming[1].Type != "income" {
+		t.Errorf("expected salary due on March 15; got %+v", upcoming[1])
+	}
+}
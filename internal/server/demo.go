@@ -0,0 +1,133 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+	"github.com/google/uuid"
+
+	"FinMa/internal/seed"
+	"FinMa/types"
+	"FinMa/utils"
+)
+
+// demoCleanupBatch is the number of expired demo users read per query.
+const demoCleanupBatch = 100
+
+// demoDeniedRoutes are the routes refused to the demo users per method,
+// relative to the prefix of the API: they send emails, reach outside of the
+// instance or leave files the purge does not remove.
+var demoDeniedRoutes = map[string][]string{
+	fiber.MethodPost: {
+		"/users/me/avatar",
+		"/accounts/:id/members",
+		"/household/members",
+		"/bank-connections",
+		"/bank-connections/:id/attach",
+		"/shares",
+		"/privacy/export",
+		"/privacy/erasure-request",
+		"/push/subscribe",
+		"/reports/schedules",
+		"/reports/schedules/:id/resume",
+	},
+	fiber.MethodPut: {"/reports/schedules/:id"},
+}
+
+// deniedToDemo reports whether the route of the request is refused to the
+// demo users.
+func deniedToDemo(c *fiber.Ctx) bool {
+	return slices.Contains(demoDeniedRoutes[c.Method()], shareRoute(c.Route().Path))
+}
+
+// requireDemo refuses the requests when the demo mode is off.
+func (s *FiberServer) requireDemo(c *fiber.Ctx) error {
+	if !s.config.Features.Demo {
+		return NewAPIError(fiber.StatusServiceUnavailable, CodeUnavailable, "The demo is not enabled")
+	}
+	return c.Next()
+}
+
+// demoRateLimiter limits the demo users created from each IP per hour.
+func demoRateLimiter(max int) fiber.Handler {
+	return limiter.New(limiter.Config{
+		Max:        max,
+		Expiration: time.Hour,
+		KeyGenerator: func(c *fiber.Ctx) string {
+			return c.IP()
+		},
+		LimitReached: func(c *fiber.Ctx) error {
+			return NewAPIError(fiber.StatusTooManyRequests, CodeRateLimited, "Too many demos started, retry in an hour")
+		},
+	})
+}
+
+// StartDemo creates a sandbox user loaded with the seed data and logs them
+// in, like a login does. The session ends with the lifetime of the demo
+// user, who is then purged with their data. Public.
+func (s *FiberServer) StartDemo(c *fiber.Ctx) error {
+	// Nobody knows the password, the demo user only has this session
+	password, err := utils.HashPassword(uuid.NewString())
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not start the demo")
+	}
+
+	now := time.Now()
+	id := uuid.New()
+	user := types.User{
+		ID:        id,
+		FirstName: "Demo",
+		LastName:  "User",
+		Email:     fmt.Sprintf("demo-%s@demo.finma.local", id),
+		Password:  password,
+		Role:      "user",
+		IsDemo:    true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.db.CreateUser(user); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not start the demo")
+	}
+	// A demo left half seeded is purged with the others
+	if err := seed.Create(s.db, user.ID, now); err != nil {
+		log.Error("Error seeding a demo user: ", err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not start the demo")
+	}
+
+	lifetime := time.Duration(s.config.Features.DemoLifetimeHours) * time.Hour
+	return s.handlers.startSession(c, user, now.Add(lifetime))
+}
+
+// StartDemoCleanup periodically purges the demo users past their lifetime,
+// with their data.
+func (s *FiberServer) StartDemoCleanup(interval time.Duration) {
+	s.every("demo_cleanup", interval, s.purgeDemoUsers)
+}
+
+func (s *FiberServer) purgeDemoUsers(now time.Time) error {
+	lifetime := time.Duration(s.config.Features.DemoLifetimeHours) * time.Hour
+	purged := 0
+	for {
+		users := s.db.GetExpiredDemoUsers(now.Add(-lifetime), demoCleanupBatch)
+		for _, user := range users {
+			if _, _, err := s.db.EraseUser(&user); err != nil {
+				return fmt.Errorf("failed to purge the demo user %s: %w", user.ID, err)
+			}
+			purged++
+		}
+		if len(users) < demoCleanupBatch {
+			break
+		}
+	}
+
+	if purged > 0 {
+		log.Infof("Purged %d demo users", purged)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/internal/seed"
+	"FinMa/types"
+)
+
+// demoDB keeps the users created and counts the seed data, and erases the
+// users like the erasure does.
+type demoDB struct {
+	*adminDB
+	accounts     int
+	budgets      int
+	transactions int
+	erased       []uuid.UUID
+}
+
+func (db *demoDB) CreateUser(user types.User) error {
+	db.users[user.ID] = user
+	return nil
+}
+
+func (db *demoDB) CreateBankAccount(account *types.BankAccount) error {
+	db.accounts++
+	return nil
+}
+
+func (db *demoDB) CreateBudget(budget *types.Budget) error {
+	db.budgets++
+	return nil
+}
+
+func (db *demoDB) CreateTransaction(transaction *types.Transaction) error {
+	db.transactions++
+	return nil
+}
+
+func (db *demoDB) GetExpiredDemoUsers(createdBefore time.Time, limit int) []types.User {
+	var users []types.User
+	for _, user := range db.users {
+		if user.IsDemo && user.CreatedAt.Before(createdBefore) && len(users) < limit {
+			users = append(users, user)
+		}
+	}
+	return users
+}
+
+func (db *demoDB) EraseUser(user *types.User) (deleted, anonymized map[string]int64, err error) {
+	delete(db.users, user.ID)
+	db.erased = append(db.erased, user.ID)
+	return map[string]int64{"users": 1}, map[string]int64{}, nil
+}
+
+func startDemo(t *testing.T, s *FiberServer) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest("GET", "/api/v1/demo/start", nil)
+	resp, err := s.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestStartDemo(t *testing.T) {
+	s, admin, _, user := newAdminTestServer(t)
+	db := &demoDB{adminDB: admin}
+	s.db = db
+	s.handlers.auth.Cookies = false
+
+	if resp := startDemo(t, s); resp.StatusCode != fiber.StatusServiceUnavailable {
+		t.Fatalf("expected status 503 with the demo off; got %d", resp.StatusCode)
+	}
+	s.config.Features.Demo = true
+
+	resp := startDemo(t, s)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("expected status 200; got %d", resp.StatusCode)
+	}
+	var session struct {
+		ID           uuid.UUID `json:"id"`
+		AccessToken  string    `json:"access_token"`
+		RefreshToken string    `json:"refresh_token"`
+	}
+	json.NewDecoder(resp.Body).Decode(&session)
+
+	demo := db.users[session.ID]
+	if !demo.IsDemo || session.AccessToken == "" {
+		t.Fatalf("expected a demo user logged in; got %+v", demo)
+	}
+	if db.accounts != 2 || db.budgets != 1 || db.transactions < seed.Months*14 {
+		t.Errorf("expected the demo seeded; got %d accounts, %d budgets and %d transactions", db.accounts, db.budgets, db.transactions)
+	}
+	if _, err := s.tokens.VerifyRefreshToken(session.RefreshToken); err != nil {
+		t.Errorf("expected a valid refresh token; got %v", err)
+	}
+
+	// The demo users cannot reach outside of the instance
+	resp = adminRequest(t, s, demo, "POST", "/api/v1/shares", `{}`)
+	var body errorBody
+	json.NewDecoder(resp.Body).Decode(&body)
+	if resp.StatusCode != fiber.StatusForbidden || body.Error.Code != CodeDemoRestricted {
+		t.Errorf("expected the share refused to the demo user; got %d %s", resp.StatusCode, body.Error.Code)
+	}
+	if resp := adminRequest(t, s, user, "POST", "/api/v1/shares", `{}`); resp.StatusCode != fiber.StatusUnprocessableEntity {
+		t.Errorf("expected the share of a user validated; got %d", resp.StatusCode)
+	}
+
+	// Each IP starts a limited number of demos per hour
+	for i := 1; i < s.config.Features.DemoHourlyLimit; i++ {
+		startDemo(t, s)
+	}
+	if resp := startDemo(t, s); resp.StatusCode != fiber.StatusTooManyRequests {
+		t.Errorf("expected status 429 past the limit; got %d", resp.StatusCode)
+	}
+
+	if err := s.purgeDemoUsers(time.Now()); err != nil || len(db.erased) != 0 {
+		t.Fatalf("expected no demo purged before its lifetime; got %v %v", db.erased, err)
+	}
+	if err := s.purgeDemoUsers(time.Now().Add(25 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.erased) != s.config.Features.DemoHourlyLimit || db.users[user.ID].ID != user.ID {
+		t.Errorf("expected only the %d demo users purged; got %v", s.config.Features.DemoHourlyLimit, db.erased)
+	}
+}
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"FinMa/internal/mail"
+	"FinMa/types"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	// digestBatchSize is the number of subscribers loaded at once.
+	digestBatchSize = 100
+	// digestTopCategories is the number of categories listed in a digest.
+	digestTopCategories = 5
+	// digestNotifications is the number of unread notifications listed in a digest.
+	digestNotifications = 5
+)
+
+// digestImportantEvents are the notifications repeated in the digest while unread.
+var digestImportantEvents = []string{"budget_exceeded", "payment_due", "bill_overdue", "large_transaction", "new_device_login"}
+
+// digestSchedule returns when the digest of the week containing now is due
+// in loc: Monday at the given hour.
+func digestSchedule(now time.Time, loc *time.Location, hour int) time.Time {
+	now = now.In(loc)
+	daysSinceMonday := (int(now.Weekday()) + 6) % 7
+	return time.Date(now.Year(), now.Month(), now.Day()-daysSinceMonday, hour, 0, 0, 0, loc)
+}
+
+// digestDue reports whether the digest scheduled at scheduledAt is due at
+// now and was not sent yet.
+func digestDue(now, scheduledAt time.Time, sentAt *time.Time) bool {
+	return !now.Before(scheduledAt) && (sentAt == nil || sentAt.Before(scheduledAt))
+}
+
+// digestBudget is the status of a budget in the digest.
+type digestBudget struct {
+	Name       string
+	Spent      types.Money
+	Limit      types.Money
+	Percentage float64
+}
+
+// weeklyDigestEmail is the data of the weekly_digest template. From and To
+// are the first and last day of the week summarized.
+type weeklyDigestEmail struct {
+	FirstName      string
+	From           time.Time
+	To             time.Time
+	Spent          types.Money
+	PreviousSpent  types.Money
+	Change         types.Money // Spent minus PreviousSpent
+	TopCategories  []types.CategoryTotal
+	Budgets        []digestBudget
+	Upcoming       []types.UpcomingTransaction
+	Notifications  []types.Notification
+	UnsubscribeURL string
+}
+
+// StartWeeklyDigests periodically sends the weekly digest to the subscribed
+// users whose digest is due. The interval should be an hour at most so that
+// the digest is sent close to the digest hour in every timezone.
+func (s *FiberServer) StartWeeklyDigests(interval time.Duration) {
+	s.every("weekly_digests", interval, func(now time.Time) error {
+		s.sendWeeklyDigests(now)
+		return nil
+	})
+}
+
+func (s *FiberServer) sendWeeklyDigests(now time.Time) {
+	after := uuid.Nil
+	for {
+		users := s.db.GetDigestSubscribers(after, digestBatchSize)
+		for _, user := range users {
+			scheduledAt := digestSchedule(now, userLocation(user), s.config.Features.DigestHour)
+			if !digestDue(now, scheduledAt, user.DigestSentAt) {
+				continue
+			}
+
+			// Claimed before sending: a digest lost in a crash is better than
+			// one sent twice
+			claimed, err := s.db.ClaimDigest(user.ID, scheduledAt, now)
+			if err != nil {
+				log.Error("Error claiming weekly digest: ", err)
+				continue
+			}
+			if !claimed {
+				continue
+			}
+
+			if err := s.sendWeeklyDigest(user, scheduledAt); err != nil {
+				log.Error("Error sending weekly digest: ", err)
+			}
+		}
+
+		if len(users) < digestBatchSize {
+			return
+		}
+		after = users[len(users)-1].ID
+	}
+}
+
+// sendWeeklyDigest summarizes the 7 days before the Monday the digest is
+// scheduled on and queues the email.
+func (s *FiberServer) sendWeeklyDigest(user types.User, scheduledAt time.Time) error {
+	loc := userLocation(user)
+	to := time.Date(scheduledAt.Year(), scheduledAt.Month(), scheduledAt.Day(), 0, 0, 0, 0, loc)
+	from := to.AddDate(0, 0, -7)
+
+	_, spent, err := s.db.GetIncomeAndExpenses(&user, from, to)
+	if err != nil {
+		return err
+	}
+	_, previousSpent, err := s.db.GetIncomeAndExpenses(&user, from.AddDate(0, 0, -7), from)
+	if err != nil {
+		return err
+	}
+	categories, err := s.db.GetTopCategories(&user, from, to, digestTopCategories)
+	if err != nil {
+		return err
+	}
+
+	budgets := s.db.GetBudgets(&user)
+	names := make(map[uuid.UUID]string, len(budgets))
+	for _, budget := range budgets {
+		names[budget.ID] = budget.Name
+	}
+	progress, err := s.budgetsProgress(user, budgets, scheduledAt)
+	if err != nil {
+		return err
+	}
+	statuses := make([]digestBudget, 0, len(progress))
+	for _, budget := range progress {
+		statuses = append(statuses, digestBudget{
+			Name:       names[budget.BudgetID],
+			Spent:      budget.Spent,
+			Limit:      budget.EffectiveLimit,
+			Percentage: budget.Percentage,
+		})
+	}
+
+	recurring := s.db.GetRecurringTransactions(&user, scheduledAt.AddDate(0, -forecastRecurringLookback, 0))
+
+	change, err := spent.Sub(previousSpent)
+	if err != nil {
+		return err
+	}
+
+	token, err := s.tokens.GenerateUnsubscribeToken(user.ID, "weekly_digest")
+	if err != nil {
+		return err
+	}
+
+	message, err := mail.Render("weekly_digest", s.localizer(user), user.Email, weeklyDigestEmail{
+		FirstName:      user.FirstName,
+		From:           from,
+		To:             to.AddDate(0, 0, -1),
+		Spent:          spent,
+		PreviousSpent:  previousSpent,
+		Change:         change,
+		TopCategories:  categories,
+		Budgets:        statuses,
+		Upcoming:       upcomingTransactions(recurring, scheduledAt, scheduledAt.AddDate(0, 0, 7)),
+		Notifications:  s.db.GetUnreadNotifications(user.ID, digestImportantEvents, digestNotifications),
+		UnsubscribeURL: fmt.Sprintf("%s%s/digest/unsubscribe?token=%s", s.config.Server.AppURL, APIPrefix, url.QueryEscape(token)),
+	})
+	if err != nil {
+		return err
+	}
+	message.UserID = &user.ID
+
+	return s.mailQueue.Enqueue(message)
+}
+
+// UnsubscribeDigest turns off the email of the event in the signed token of
+// an unsubscribe link, without requiring the user to log in. The other
+// channels of the event are left unchanged.
+func (s *FiberServer) UnsubscribeDigest(c *fiber.Ctx) error {
+	userID, event, err := s.tokens.VerifyUnsubscribeToken(c.Query("token"))
+	if err != nil || !isValidNotificationEvent(event) || isSecurityNotificationEvent(event) {
+		log.Warn("Invalid unsubscribe token: ", err)
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid unsubscribe link")
+	}
+
+	preference, ok := s.db.GetNotificationPreference(userID, event)
+	if !ok {
+		preference = defaultNotificationPreference(userID, event)
+	}
+	preference.Email = false
+	preference.UpdatedAt = time.Now()
+
+	if err := s.db.SaveNotificationPreferences([]types.NotificationPreference{preference}); err != nil {
+		log.Error("Error unsubscribing: ", err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Failed to unsubscribe")
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "You will no longer receive this email",
+		"event":   event,
+	})
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"FinMa/internal/i18n"
+	"FinMa/internal/mail"
+	"FinMa/types"
+	"FinMa/utils"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestDigestSchedule(t *testing.T) {
+	paris, _ := time.LoadLocation("Europe/Paris")
+	auckland, _ := time.LoadLocation("Pacific/Auckland")
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		loc      *time.Location
+		expected time.Time
+	}{
+		{"wednesday", time.Date(2024, 3, 6, 12, 0, 0, 0, time.UTC), time.UTC, time.Date(2024, 3, 4, 8, 0, 0, 0, time.UTC)},
+		{"monday before the hour", time.Date(2024, 3, 4, 5, 0, 0, 0, time.UTC), time.UTC, time.Date(2024, 3, 4, 8, 0, 0, 0, time.UTC)},
+		{"sunday", time.Date(2024, 3, 10, 23, 0, 0, 0, time.UTC), time.UTC, time.Date(2024, 3, 4, 8, 0, 0, 0, time.UTC)},
+		{"paris", time.Date(2024, 3, 4, 7, 30, 0, 0, time.UTC), paris, time.Date(2024, 3, 4, 8, 0, 0, 0, paris)},
+		// Sunday evening in UTC is already Monday in Auckland
+		{"auckland", time.Date(2024, 3, 10, 20, 0, 0, 0, time.UTC), auckland, time.Date(2024, 3, 11, 8, 0, 0, 0, auckland)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := digestSchedule(tt.now, tt.loc, 8); !got.Equal(tt.expected) {
+				t.Errorf("expected %v; got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestDigestDue(t *testing.T) {
+	scheduledAt := time.Date(2024, 3, 4, 8, 0, 0, 0, time.UTC)
+	lastWeek := scheduledAt.AddDate(0, 0, -7)
+	sentToday := scheduledAt.Add(time.Minute)
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		sentAt   *time.Time
+		expected bool
+	}{
+		{"never sent", scheduledAt.Add(time.Hour), nil, true},
+		{"sent last week", scheduledAt.Add(time.Hour), &lastWeek, true},
+		{"already sent", scheduledAt.Add(time.Hour), &sentToday, false},
+		{"not yet", scheduledAt.Add(-time.Hour), &lastWeek, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := digestDue(tt.now, scheduledAt, tt.sentAt); got != tt.expected {
+				t.Errorf("expected %v; got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestWeeklyDigestTemplate(t *testing.T) {
+	message, err := mail.Render("weekly_digest", i18n.For("en", "EUR"), "ada@example.com", weeklyDigestEmail{
+		FirstName:      "Ada",
+		From:           time.Date(2024, 2, 26, 0, 0, 0, 0, time.UTC),
+		To:             time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC),
+		Spent:          money(120.5),
+		PreviousSpent:  money(150),
+		Change:         money(-29.5),
+		TopCategories:  []types.CategoryTotal{{Category: "Groceries", Total: money(80)}},
+		Budgets:        []digestBudget{{Name: "Food", Spent: money(80), Limit: money(400), Percentage: 20}},
+		UnsubscribeURL: "http://localhost:8080/api/digest/unsubscribe?token=abc",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if message.Subject != "FinMa: Your week from Feb 26 to Mar 3" {
+		t.Errorf("unexpected subject %q", message.Subject)
+	}
+	for _, expected := range []string{"You spent €120.50, down from €150.00", "- Groceries: €80.00", "- Food: €80.00 of €400.00 (20%)", "token=abc"} {
+		if !strings.Contains(message.Text, expected) {
+			t.Errorf("expected %q in the text; got %q", expected, message.Text)
+		}
+	}
+	if strings.Contains(message.Text, "Coming up") {
+		t.Errorf("expected no upcoming section without upcoming transactions; got %q", message.Text)
+	}
+
+	message, err = mail.Render("weekly_digest", i18n.For("fr", "EUR"), "ada@example.com", weeklyDigestEmail{
+		FirstName: "Ada",
+		From:      time.Date(2024, 2, 26, 0, 0, 0, 0, time.UTC),
+		To:        time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC),
+		Spent:     money(1234.56),
+		Change:    money(1234.56),
+		Budgets:   []digestBudget{{Name: "Food", Spent: money(80), Limit: money(400), Percentage: 20}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if message.Subject != "FinMa : votre semaine du 26 févr. au 3 mars" {
+		t.Errorf("unexpected subject %q", message.Subject)
+	}
+	for _, expected := range []string{"lundi 26 février", "Vous avez dépensé 1\u202f234,56\u00a0€, en hausse", "- Food : 80,00\u00a0€ sur 400,00\u00a0€ (20\u00a0%)"} {
+		if !strings.Contains(message.Text, expected) {
+			t.Errorf("expected %q in the text; got %q", expected, message.Text)
+		}
+	}
+}
+
+func TestUnsubscribeToken(t *testing.T) {
+	tokens := utils.Tokens{AccessSecret: "test-secret", RefreshSecret: "test-refresh-secret"}
+
+	userID := uuid.New()
+	token, err := tokens.GenerateUnsubscribeToken(userID, "weekly_digest")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	gotUser, gotEvent, err := tokens.VerifyUnsubscribeToken(token)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotUser != userID || gotEvent != "weekly_digest" {
+		t.Errorf("expected %s weekly_digest; got %s %s", userID, gotUser, gotEvent)
+	}
+
+	// An access token must not be accepted as an unsubscribe token
+	access, _ := tokens.GenerateAccessToken(utils.Payload{UserID: userID, Email: "ada@example.com"})
+	if _, _, err := tokens.VerifyUnsubscribeToken(access); err == nil {
+		t.Error("expected an access token to be refused")
+	}
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"FinMa/internal/config"
+	"FinMa/internal/i18n"
+	"FinMa/internal/mail"
+	"FinMa/types"
+	"context"
+	"time"
+)
+
+// newMailer returns the mailer selected by the driver: "smtp" sends
+// through the SMTP server, anything else only logs the emails.
+func newMailer(cfg config.SMTP) mail.Mailer {
+	if cfg.Driver != "smtp" {
+		return mail.LogMailer{}
+	}
+	return mail.NewSMTPMailer(mail.SMTPConfig{
+		Host:     cfg.Host,
+		Port:     cfg.Port,
+		Username: cfg.Username,
+		Password: cfg.Password,
+		From:     cfg.From,
+		TLS:      cfg.TLS,
+	})
+}
+
+// newMailQueue starts the queue sending the emails of the server.
+func newMailQueue(cfg config.SMTP, mailer mail.Mailer, recorder mail.DeliveryRecorder) *mail.Queue {
+	return mail.NewQueue(mailer, recorder, mail.QueueConfig{
+		Workers:  cfg.Workers,
+		Size:     cfg.QueueSize,
+		Attempts: cfg.Attempts,
+		Backoff:  30 * time.Second,
+	})
+}
+
+// notificationEmail is the data of the notification email templates.
+type notificationEmail struct {
+	FirstName string
+	Title     string
+	Message   string
+}
+
+// emailNotifier delivers notifications by email through the mail queue.
+// Events with a template of their own use it, the others share the
+// generic notification template.
+type emailNotifier struct {
+	queue    *mail.Queue
+	currency string
+}
+
+func (n *emailNotifier) Send(ctx context.Context, user types.User, notification *types.Notification) error {
+	template := notification.Type
+	if !mail.HasTemplate(template) {
+		template = "notification"
+	}
+
+	message, err := mail.Render(template, i18n.For(user.Locale, n.currency), user.Email, notificationEmail{
+		FirstName: user.FirstName,
+		Title:     notificationTitle(user.Locale, notification.Type),
+		Message:   notification.Message,
+	})
+	if err != nil {
+		return err
+	}
+	message.UserID = &user.ID
+
+	return n.queue.Enqueue(message)
+}
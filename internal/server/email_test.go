@@ -0,0 +1,44 @@
+package server
+
+import (
+	"FinMa/internal/mail"
+	"FinMa/types"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestEmailNotifier(t *testing.T) {
+	mailer := mail.NewMockMailer()
+	queue := mail.NewQueue(mailer, nil, mail.QueueConfig{Size: 10, Backoff: time.Millisecond})
+	notifier := &emailNotifier{queue: queue}
+
+	user := types.User{ID: uuid.New(), FirstName: "Ada", Email: "ada@example.com"}
+	notifications := []*types.Notification{
+		{Type: "budget_exceeded", Message: "Groceries budget exceeded its limit, 110% spent"},
+		{Type: "new_device_login", Message: "New login to your account from curl/8.0"},
+	}
+	for _, notification := range notifications {
+		if err := notifier.Send(context.Background(), user, notification); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	queue.Close()
+
+	messages := mailer.Messages()
+	if len(messages) != 2 {
+		t.Fatalf("expected 2 emails; got %d", len(messages))
+	}
+	if messages[0].Template != "notification" || messages[0].Subject != "FinMa: Budget exceeded" {
+		t.Errorf("expected the generic template for budget_exceeded; got %s, %q", messages[0].Template, messages[0].Subject)
+	}
+	if messages[1].Template != "new_device_login" || !strings.Contains(messages[1].Text, "curl/8.0") {
+		t.Errorf("expected the new_device_login template; got %s, %q", messages[1].Template, messages[1].Text)
+	}
+	if messages[0].UserID == nil || *messages[0].UserID != user.ID || messages[0].To != user.Email {
+		t.Errorf("expected the email to be addressed to the user; got %+v", messages[0])
+	}
+}
@@ -0,0 +1,274 @@
+package server
+
+import (
+	"FinMa/internal/i18n"
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+// The error codes returned in the "code" of the error responses. They are
+// stable, the clients switch on them rather than on the messages, which may
+// change.
+const (
+	// Generic codes, one per status
+	CodeInvalidRequest   = "invalid_request"    // 400, the request is malformed or a value is invalid
+	CodeUnauthorized     = "unauthorized"       // 401, the caller is not authenticated
+	CodeForbidden        = "forbidden"          // 403, the caller may not access the resource
+	CodeNotFound         = "not_found"          // 404, the resource does not exist or is not the caller's
+	CodeMethodNotAllowed = "method_not_allowed" // 405
+	CodeNotAcceptable    = "not_acceptable"     // 406, the endpoint does not support the format asked for
+	CodeConflict         = "conflict"           // 409, the request conflicts with the state of the resource
+	CodePayloadTooLarge  = "payload_too_large"  // 413
+	CodeUnsupportedMedia = "unsupported_media"  // 415, the file is not of a type the endpoint accepts
+	CodeUpgradeRequired  = "upgrade_required"   // 426, the endpoint is a websocket
+	CodeUnprocessable    = "unprocessable"      // 422, the request is well formed but not allowed
+	CodeRateLimited      = "rate_limited"       // 429
+	CodeInternal         = "internal_error"     // 500, the details are in the server log under the request ID
+	CodeUpstreamError    = "upstream_error"     // 502, a provider (bank sync) failed
+	CodeUnavailable      = "unavailable"        // 503, the feature is not configured or the server is shutting down
+	CodeTimeout          = "timeout"            // 504, the request ran past its deadline
+
+	// Specific codes
+	CodeValidationFailed      = "validation_failed"      // 422, the fields listed in the details are invalid
+	CodeEmailTaken            = "email_taken"            // 409, an account already uses the email
+	CodeInvalidCredentials    = "invalid_credentials"    // 401, the email or the password is wrong
+	CodeTokenExpired          = "token_expired"          // 401, the access token expired, refresh it
+	CodeAlreadyMember         = "already_member"         // 409, the user already belongs to a household
+	CodeAlreadyInvited        = "already_invited"        // 409, the user is already invited
+	CodeBudgetOverlap         = "budget_overlap"         // 409, another budget covers the categories, see the details
+	CodeAccountArchived       = "account_archived"       // 409, the bank account is archived
+	CodeTransactionReconciled = "transaction_reconciled" // 409, the transaction belongs to a reconciliation
+	CodeReconciliationClosed  = "reconciliation_closed"  // 409, the reconciliation is closed
+	CodeBankLinkExpired       = "bank_link_expired"      // 409, the bank link expired, create a new connection
+	CodeFeatureDisabled       = "feature_disabled"       // 403, the feature is not enabled for the user, see GET /api/flags
+	CodeDemoRestricted        = "demo_restricted"        // 403, the action is not available to the demo users
+	CodeLimitExceeded         = "limit_exceeded"         // 403, the user reached a limit of their plan, see the details and GET /api/usage
+	CodeMaintenance           = "maintenance"            // 503, the API is in maintenance mode, retry after the Retry-After header
+	CodeResyncRequired        = "resync_required"        // 410, the sync cursor expired, sync everything again
+	CodeVersionConflict       = "version_conflict"       // 409, the resource changed since it was read, see its current state in "current"
+	CodeVersionRequired       = "version_required"       // 428, send the version of the resource read in the body or the If-Match header
+)
+
+// statusCodes is the generic code of each status, used for the errors
+// raised without a code.
+var statusCodes = map[int]string{
+	fiber.StatusBadRequest:            CodeInvalidRequest,
+	fiber.StatusUnauthorized:          CodeUnauthorized,
+	fiber.StatusForbidden:             CodeForbidden,
+	fiber.StatusNotFound:              CodeNotFound,
+	fiber.StatusMethodNotAllowed:      CodeMethodNotAllowed,
+	fiber.StatusNotAcceptable:         CodeNotAcceptable,
+	fiber.StatusConflict:              CodeConflict,
+	fiber.StatusRequestEntityTooLarge: CodePayloadTooLarge,
+	fiber.StatusUnsupportedMediaType:  CodeUnsupportedMedia,
+	fiber.StatusUnprocessableEntity:   CodeUnprocessable,
+	fiber.StatusUpgradeRequired:       CodeUpgradeRequired,
+	fiber.StatusTooManyRequests:       CodeRateLimited,
+	fiber.StatusInternalServerError:   CodeInternal,
+	fiber.StatusBadGateway:            CodeUpstreamError,
+	fiber.StatusServiceUnavailable:    CodeUnavailable,
+	fiber.StatusGatewayTimeout:        CodeTimeout,
+}
+
+// codeForStatus returns the generic code of the status.
+func codeForStatus(status int) string {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	if status >= fiber.StatusInternalServerError {
+		return CodeInternal
+	}
+	return CodeInvalidRequest
+}
+
+// FieldError tells what is wrong with one field of the request.
+type FieldError struct {
+	Field   string      `json:"field"`
+	Message string      `json:"message"`
+	Value   interface{} `json:"value,omitempty"`
+
+	// rule and param are the validator rule the field breaks, to translate
+	// the message
+	rule, param string
+}
+
+// APIError is an error returned by the handlers, written by the error
+// handler as the error envelope with its status.
+type APIError struct {
+	Status  int
+	Code    string
+	Message string
+	Details []FieldError
+	// Params are the values of the placeholders of the translations of the
+	// message, like the limit of payload_too_large
+	Params i18n.Params
+	// Current is the resource as it is now, returned with version_conflict
+	Current interface{}
+}
+
+// NewAPIError returns the error with the status, the code, and the message
+// shown to the user.
+func NewAPIError(status int, code string, message string) *APIError {
+	return &APIError{Status: status, Code: code, Message: message}
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// WithDetails adds the field errors to the error.
+func (e *APIError) WithDetails(details ...FieldError) *APIError {
+	e.Details = append(e.Details, details...)
+	return e
+}
+
+// WithParams sets the values of the placeholders of the translations of
+// the message.
+func (e *APIError) WithParams(params i18n.Params) *APIError {
+	e.Params = params
+	return e
+}
+
+// WithCurrent sets the current state of the resource the request conflicts
+// with.
+func (e *APIError) WithCurrent(current interface{}) *APIError {
+	e.Current = current
+	return e
+}
+
+// errorBody is the JSON envelope of the error responses:
+// {"error": {"code": ..., "message": ..., "details": [...], "request_id": ...}}
+type errorBody struct {
+	Error errorContent `json:"error"`
+}
+
+type errorContent struct {
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	Details   []FieldError `json:"details,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	Current   interface{}  `json:"current,omitempty"`
+}
+
+// newValidator returns the validator of the request bodies, naming the
+// fields by their JSON name in the errors.
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || name == "" {
+			return field.Name
+		}
+		return name
+	})
+	return v
+}
+
+// validationErrors turns the errors of the validator into a 422 listing the
+// invalid fields.
+func validationErrors(errs validator.ValidationErrors) *APIError {
+	apiErr := NewAPIError(fiber.StatusUnprocessableEntity, CodeValidationFailed, "Some fields are invalid")
+	for _, fieldErr := range errs {
+		detail := FieldError{Field: fieldErr.Field(), rule: fieldErr.Tag(), param: fieldErr.Param()}
+		detail.Message = validationMessage(i18n.Default, detail)
+		apiErr.Details = append(apiErr.Details, detail)
+	}
+	return apiErr
+}
+
+// validationMessages are the keys of the messages of the rules, the other
+// rules share "validation.invalid".
+var validationMessages = map[string]string{
+	"required": "validation.required",
+	"email":    "validation.email",
+	"oneof":    "validation.oneof",
+	"min":      "validation.min",
+	"gte":      "validation.min",
+	"max":      "validation.max",
+	"lte":      "validation.max",
+	"gt":       "validation.gt",
+	"lt":       "validation.lt",
+	"timezone": "validation.timezone",
+}
+
+// validationMessage describes the rule the field breaks in the locale.
+func validationMessage(locale string, detail FieldError) string {
+	key, ok := validationMessages[detail.rule]
+	if !ok {
+		key = "validation.invalid"
+	}
+	return i18n.For(locale, "").T(key, i18n.Params{"param": detail.param, "rule": detail.rule})
+}
+
+// translateError returns the error in the locale: its message is the one
+// of its code in the catalog, the details of the validator are described
+// in the locale too. English errors keep the message of the handler, more
+// specific than the one of the catalog.
+func translateError(apiErr *APIError, code, locale string) (string, []FieldError) {
+	if locale == i18n.Default {
+		return apiErr.Message, apiErr.Details
+	}
+
+	details := make([]FieldError, len(apiErr.Details))
+	for i, detail := range apiErr.Details {
+		if detail.rule != "" {
+			detail.Message = validationMessage(locale, detail)
+		}
+		details[i] = detail
+	}
+	return i18n.For(locale, "").T("errors."+code, apiErr.Params), details
+}
+
+// toAPIError converts any error returned by a handler to an APIError. The
+// unknown errors become a 500 without their message, which may leak
+// internals.
+func toAPIError(err error) (*APIError, bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr, true
+	}
+
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return NewAPIError(fiberErr.Code, codeForStatus(fiberErr.Code), fiberErr.Message), true
+	}
+
+	var validationErr validator.ValidationErrors
+	if errors.As(err, &validationErr) {
+		return validationErrors(validationErr), true
+	}
+
+	return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Internal server error"), false
+}
+
+// errorHandler writes the errors returned by the handlers and the
+// middlewares as the error envelope, in the language of the request.
+func errorHandler(c *fiber.Ctx, err error) error {
+	apiErr, known := toAPIError(err)
+	requestID, _ := c.Locals("request_id").(string)
+	if !known {
+		log.Error("Unhandled error", "request_id", requestID, "method", c.Method(), "path", c.Path(), "err", err)
+	}
+
+	code := apiErr.Code
+	if code == "" {
+		code = codeForStatus(apiErr.Status)
+	}
+
+	locale := requestLocale(c)
+	message, details := translateError(apiErr, code, locale)
+	c.Set(fiber.HeaderContentLanguage, locale)
+
+	return c.Status(apiErr.Status).JSON(errorBody{Error: errorContent{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: requestID,
+		Current:   apiErr.Current,
+	}})
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"FinMa/types"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestErrorHandler(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: errorHandler})
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("request_id", "req-1")
+		return c.Next()
+	})
+	app.Get("/api", func(c *fiber.Ctx) error {
+		return NewAPIError(fiber.StatusConflict, CodeEmailTaken, "An account already uses this email").
+			WithDetails(FieldError{Field: "email", Message: "is already registered"})
+	})
+	app.Get("/fiber", func(c *fiber.Ctx) error {
+		return fiber.ErrTooManyRequests
+	})
+	app.Get("/validation", func(c *fiber.Ctx) error {
+		body := struct {
+			Email string `json:"email" validate:"required,email"`
+		}{Email: "nope"}
+		return validate.Struct(body)
+	})
+	app.Get("/unknown", func(c *fiber.Ctx) error {
+		return errors.New("pq: relation users does not exist")
+	})
+
+	tests := []struct {
+		path    string
+		status  int
+		code    string
+		message string
+		field   string
+	}{
+		{"/api", fiber.StatusConflict, CodeEmailTaken, "An account already uses this email", "email"},
+		{"/fiber", fiber.StatusTooManyRequests, CodeRateLimited, "Too Many Requests", ""},
+		{"/validation", fiber.StatusUnprocessableEntity, CodeValidationFailed, "Some fields are invalid", "email"},
+		{"/unknown", fiber.StatusInternalServerError, CodeInternal, "Internal server error", ""},
+		{"/missing", fiber.StatusNotFound, CodeNotFound, "Cannot GET /missing", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tt.path, nil)
+			if err != nil {
+				t.Fatalf("error creating request. Err: %v", err)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("error making request to server. Err: %v", err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Errorf("expected status %d; got %d", tt.status, resp.StatusCode)
+			}
+
+			var body errorBody
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatalf("error decoding response body. Err: %v", err)
+			}
+			if body.Error.Code != tt.code || body.Error.Message != tt.message {
+				t.Errorf("expected %s %q; got %s %q", tt.code, tt.message, body.Error.Code, body.Error.Message)
+			}
+			if body.Error.RequestID != "req-1" {
+				t.Errorf("expected request ID req-1; got %q", body.Error.RequestID)
+			}
+			if tt.field != "" && (len(body.Error.Details) != 1 || body.Error.Details[0].Field != tt.field) {
+				t.Errorf("expected a detail on %s; got %+v", tt.field, body.Error.Details)
+			}
+		})
+	}
+}
+
+func TestErrorHandlerTranslates(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: errorHandler})
+	app.Use(func(c *fiber.Ctx) error {
+		if c.Query("locale") != "" {
+			c.Locals("user", types.User{Locale: c.Query("locale")})
+		}
+		return c.Next()
+	})
+	app.Get("/validation", func(c *fiber.Ctx) error {
+		body := struct {
+			Email string `json:"email" validate:"required,email"`
+			Type  string `json:"type" validate:"oneof=income expense"`
+		}{Email: "nope", Type: "gift"}
+		return validate.Struct(body)
+	})
+	app.Get("/too-large", func(c *fiber.Ctx) error {
+		return bodyTooLarge(c, 1<<20)
+	})
+
+	tests := []struct {
+		path           string
+		acceptLanguage string
+		locale         string
+		message        string
+		details        []string
+	}{
+		{"/validation", "fr-FR,fr;q=0.9", "fr", "Certains champs sont invalides", []string{"doit être une adresse e-mail valide", "doit être l'une des valeurs\u00a0: income expense"}},
+		{"/validation", "en-US", "en", "Some fields are invalid", []string{"must be a valid email", "must be one of: income expense"}},
+		{"/validation", "", "en", "Some fields are invalid", []string{"must be a valid email", "must be one of: income expense"}},
+		{"/validation?locale=en", "fr", "en", "Some fields are invalid", []string{"must be a valid email", "must be one of: income expense"}},
+		{"/too-large", "de, fr;q=0.5", "fr", "Le corps de la requête dépasse la limite de 1 MB", nil},
+		{"/too-large?locale=fr", "", "fr", "Le corps de la requête dépasse la limite de 1 MB", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path+" "+tt.acceptLanguage, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tt.path, nil)
+			if err != nil {
+				t.Fatalf("error creating request. Err: %v", err)
+			}
+			req.Header.Set("Accept-Language", tt.acceptLanguage)
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("error making request to server. Err: %v", err)
+			}
+			if language := resp.Header.Get("Content-Language"); language != tt.locale {
+				t.Errorf("expected Content-Language %q; got %q", tt.locale, language)
+			}
+
+			var body errorBody
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatalf("error decoding response body. Err: %v", err)
+			}
+			if body.Error.Message != tt.message {
+				t.Errorf("expected %q; got %q", tt.message, body.Error.Message)
+			}
+			if len(body.Error.Details) != len(tt.details) {
+				t.Fatalf("expected %d details; got %+v", len(tt.details), body.Error.Details)
+			}
+			for i, message := range tt.details {
+				if body.Error.Details[i].Message != message {
+					t.Errorf("expected %q; got %q", message, body.Error.Details[i].Message)
+				}
+			}
+		})
+	}
+}
+
+func TestErrorHandlerHidesInternalMessages(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: errorHandler})
+	app.Get("/", func(c *fiber.Ctx) error {
+		return errors.New("dial tcp 10.0.0.3:5432: connection refused")
+	})
+
+	req, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatalf("error creating request. Err: %v", err)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("error reading response body. Err: %v", err)
+	}
+	if strings.Contains(string(body), "5432") {
+		t.Errorf("expected the internal message to be hidden; got %s", body)
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"FinMa/internal/realtime"
+	"FinMa/types"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+)
+
+// eventsHeartbeat is how often a comment is sent on an event stream so that
+// proxies do not close it. It also bounds how long a stream outlives its client.
+var eventsHeartbeat = 25 * time.Second
+
+// writeServerSentEvent writes the event in the text/event-stream format.
+func writeServerSentEvent(w *bufio.Writer, event realtime.Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
+
+// GetEvents streams the same events as the websocket as Server-Sent Events.
+// A client reconnecting with a Last-Event-ID header (or ?last_event_id=)
+// first receives the retained events it missed; when some were already
+// dropped it receives a "resync" event telling it to reload its data.
+// A comment is sent every 25 seconds to keep the connection open.
+func (s *FiberServer) GetEvents(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+
+	lastEventID := c.Get("Last-Event-ID", c.Query("last_event_id"))
+	var lastID uint64
+	if lastEventID != "" {
+		parsed, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid last event ID")
+		}
+		lastID = parsed
+	}
+
+	subscription, missed, complete := s.hub.Resume(user.ID, lastID)
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer s.hub.Unsubscribe(subscription)
+
+		if !complete {
+			fmt.Fprintf(w, "event: resync\ndata: {}\n\n")
+		}
+		for _, event := range missed {
+			if err := writeServerSentEvent(w, event); err != nil {
+				log.Error("Error encoding server-sent event: ", err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		heartbeat := time.NewTicker(eventsHeartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case event, ok := <-subscription.Events:
+				if !ok {
+					return
+				}
+				if err := writeServerSentEvent(w, event); err != nil {
+					log.Error("Error encoding server-sent event: ", err)
+					continue
+				}
+			case <-heartbeat.C:
+				fmt.Fprintf(w, ": heartbeat\n\n")
+			}
+
+			// A failed flush means the client went away
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+	return nil
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"FinMa/internal/realtime"
+	"FinMa/types"
+	"bufio"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// readServerSentEvent reads the next event of the stream, skipping comments.
+func readServerSentEvent(t *testing.T, reader *bufio.Reader) map[string]string {
+	t.Helper()
+	event := make(map[string]string)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("error reading event stream. Err: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			if len(event) > 0 {
+				return event
+			}
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		field, value, _ := strings.Cut(line, ": ")
+		event[field] = value
+	}
+}
+
+func TestGetEventsResumesFromLastEventID(t *testing.T) {
+	heartbeat := eventsHeartbeat
+	eventsHeartbeat = 20 * time.Millisecond
+	defer func() { eventsHeartbeat = heartbeat }()
+
+	userID := uuid.New()
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	s := &FiberServer{App: app, hub: realtime.NewHub(10)}
+	app.Get("/events", func(c *fiber.Ctx) error {
+		c.Locals("user", types.User{ID: userID})
+		return c.Next()
+	}, s.GetEvents)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening. Err: %v", err)
+	}
+	go app.Listener(listener)
+	defer app.Shutdown()
+
+	observer := s.hub.Subscribe(userID)
+	s.hub.Publish(userID, realtime.Event{Type: "notification", Data: fiber.Map{"message": "seen"}})
+	s.hub.Publish(userID, realtime.Event{Type: "notification", Data: fiber.Map{"message": "missed"}})
+	published := []realtime.Event{<-observer.Events, <-observer.Events}
+	s.hub.Unsubscribe(observer)
+
+	req, err := http.NewRequest("GET", "http://"+listener.Addr().String()+"/events", nil)
+	if err != nil {
+		t.Fatalf("error creating request. Err: %v", err)
+	}
+	req.Header.Set("Last-Event-ID", strconv.FormatUint(published[0].ID, 10))
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Fatalf("expected text/event-stream; got %s", contentType)
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	event := readServerSentEvent(t, reader)
+	if event["id"] != strconv.FormatUint(published[1].ID, 10) || event["data"] != `{"message":"missed"}` {
+		t.Errorf("expected the missed event first; got %v", event)
+	}
+
+	s.hub.Publish(userID, realtime.Event{Type: "transaction.created", Data: fiber.Map{"amount": 12.5}})
+	event = readServerSentEvent(t, reader)
+	if event["event"] != "transaction.created" || event["data"] != `{"amount":12.5}` {
+		t.Errorf("expected the live transaction.created event; got %v", event)
+	}
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/internal/config"
+	"FinMa/internal/fx"
+	"FinMa/types"
+)
+
+// newFX returns the exchange rate service of the configuration: the rates
+// stored in the database, then the API, then the static file.
+func newFX(cfg config.FX, store fx.Store) (*fx.Service, error) {
+	var providers []fx.Provider
+	if cfg.Provider == "frankfurter" {
+		providers = append(providers, fx.NewFrankfurterProvider(cfg.ProviderURL, time.Duration(cfg.Timeout)*time.Second))
+	}
+	if cfg.StaticFile != "" {
+		static, err := fx.NewStaticProvider(cfg.StaticFile)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, static)
+	}
+	return fx.NewService(store, providers...), nil
+}
+
+// exchangeRateDay parses the YYYY-MM-DD day of the query parameter, the
+// fallback when it is empty.
+func exchangeRateDay(c *fiber.Ctx, name string, fallback *time.Time) (*time.Time, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return fallback, nil
+	}
+	day, err := time.Parse(time.DateOnly, raw)
+	if err != nil {
+		return nil, NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, name+" must be a YYYY-MM-DD date")
+	}
+	return &day, nil
+}
+
+// exchangeRateCurrency returns the currency of the query parameter, in
+// uppercase, the fallback when it is empty.
+func exchangeRateCurrency(c *fiber.Ctx, name, fallback string) (string, error) {
+	currency := strings.ToUpper(c.Query(name, fallback))
+	if currency != "" && !fx.IsCurrencyCode(currency) {
+		return "", NewAPIError(fiber.StatusUnprocessableEntity, CodeValidationFailed, "Invalid currency").
+			WithDetails(FieldError{Field: name, Message: "Must be an ISO 4217 code", Value: c.Query(name)})
+	}
+	return currency, nil
+}
+
+// GetExchangeRate returns how much 1 ?from= is worth in ?to= (the base
+// currency of the user by default) on the UTC ?date= (YYYY-MM-DD, today by
+// default). A weekend or a holiday has the rate of the last day before it,
+// flagged as a fallback. While the providers are unreachable the last stored
+// rate is answered, flagged as stale.
+func (s *FiberServer) GetExchangeRate(c *fiber.Ctx) error {
+	from, err := exchangeRateCurrency(c, "from", "")
+	if err != nil {
+		return err
+	}
+	if from == "" {
+		return NewAPIError(fiber.StatusUnprocessableEntity, CodeValidationFailed, "Invalid currency").
+			WithDetails(FieldError{Field: "from", Message: "Required"})
+	}
+	to, err := exchangeRateCurrency(c, "to", s.baseCurrency(c.Locals("user").(types.User)))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	date, err := exchangeRateDay(c, "date", &now)
+	if err != nil {
+		return err
+	}
+
+	rate, err := s.fx.Rate(c.UserContext(), from, to, *date)
+	if err != nil {
+		return exchangeRateUnavailable(err)
+	}
+	return c.JSON(rate)
+}
+
+// exchangeRateUnavailable is the error of a report needing a rate that
+// cannot be fetched and was never stored.
+func exchangeRateUnavailable(err error) error {
+	if errors.Is(err, fx.ErrUnavailable) {
+		log.Warn(err)
+		return NewAPIError(fiber.StatusBadGateway, CodeUpstreamError, "The exchange rate is unavailable")
+	}
+	log.Error(err)
+	return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not get the exchange rate")
+}
+
+// GetExchangeRates lists the stored exchange rates, the latest days first,
+// filtered by ?base=, ?quote=, and the days between ?from= and ?to=
+// (YYYY-MM-DD), up to ?limit=100. Admin only.
+func (s *FiberServer) GetExchangeRates(c *fiber.Ctx) error {
+	var filter types.ExchangeRateFilter
+	var err error
+	if filter.Base, err = exchangeRateCurrency(c, "base", ""); err != nil {
+		return err
+	}
+	if filter.Quote, err = exchangeRateCurrency(c, "quote", ""); err != nil {
+		return err
+	}
+	if filter.From, err = exchangeRateDay(c, "from", nil); err != nil {
+		return err
+	}
+	if filter.To, err = exchangeRateDay(c, "to", nil); err != nil {
+		return err
+	}
+	filter.Limit = c.QueryInt("limit", 100)
+	if filter.Limit <= 0 || filter.Limit > 1000 {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "limit must be between 1 and 1000")
+	}
+
+	return c.JSON(s.db.GetExchangeRates(filter))
+}
+
+// UpdateExchangeRate corrects a stored exchange rate, which is then marked
+// as manual and kept as is. Admin only.
+func (s *FiberServer) UpdateExchangeRate(c *fiber.Ctx) error {
+	type UpdateExchangeRateRequest struct {
+		Rate float64 `json:"rate" validate:"gt=0"`
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Exchange rate not found")
+	}
+	rate := s.db.GetExchangeRateByID(id.String())
+	if rate.ID == uuid.Nil {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Exchange rate not found")
+	}
+
+	var body UpdateExchangeRateRequest
+	if err := c.BodyParser(&body); err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+	if err := validate.Struct(body); err != nil {
+		return err
+	}
+
+	admin := c.Locals("user").(types.User)
+	previous := rate.Rate
+	rate.Rate = body.Rate
+	rate.Source = "manual"
+	if err := s.db.UpdateExchangeRate(&rate); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not update the exchange rate")
+	}
+	log.Info("Exchange rate corrected", "base", rate.Base, "quote", rate.Quote, "date", rate.Date.Format(time.DateOnly), "from", previous, "to", rate.Rate, "admin", admin.ID)
+
+	return c.JSON(rate)
+}
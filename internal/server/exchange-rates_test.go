@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/internal/fx"
+	"FinMa/types"
+)
+
+// exchangeRatesDB keeps the exchange rates in memory.
+type exchangeRatesDB struct {
+	*adminDB
+	rates []types.ExchangeRate
+}
+
+func (db *exchangeRatesDB) GetExchangeRate(base, quote string, date time.Time) (*types.ExchangeRate, error) {
+	for _, rate := range db.rates {
+		if rate.Base == base && rate.Quote == quote && rate.Date.Equal(date) {
+			return &rate, nil
+		}
+	}
+	return nil, nil
+}
+
+func (db *exchangeRatesDB) GetLatestExchangeRate(base, quote string, date time.Time) (*types.ExchangeRate, error) {
+	return nil, nil
+}
+
+func (db *exchangeRatesDB) SaveExchangeRate(rate *types.ExchangeRate) error {
+	db.rates = append(db.rates, *rate)
+	return nil
+}
+
+func (db *exchangeRatesDB) GetExchangeRates(filter types.ExchangeRateFilter) []types.ExchangeRate {
+	var rates []types.ExchangeRate
+	for _, rate := range db.rates {
+		if filter.Base == "" || rate.Base == filter.Base {
+			rates = append(rates, rate)
+		}
+	}
+	return rates
+}
+
+func (db *exchangeRatesDB) GetExchangeRateByID(id string) types.ExchangeRate {
+	for _, rate := range db.rates {
+		if rate.ID.String() == id {
+			return rate
+		}
+	}
+	return types.ExchangeRate{}
+}
+
+func (db *exchangeRatesDB) UpdateExchangeRate(rate *types.ExchangeRate) error {
+	for i := range db.rates {
+		if db.rates[i].ID == rate.ID {
+			db.rates[i] = *rate
+		}
+	}
+	return nil
+}
+
+// fridayProvider publishes its rate on Fridays only.
+type fridayProvider struct{}
+
+func (fridayProvider) Name() string {
+	return "friday"
+}
+
+func (fridayProvider) Rate(_ context.Context, _, _ string, date time.Time) (float64, time.Time, error) {
+	for date.Weekday() != time.Friday {
+		date = date.AddDate(0, 0, -1)
+	}
+	return 0.92, date, nil
+}
+
+func TestExchangeRates(t *testing.T) {
+	s, admin, user := newAdminTestServerWithRates(t)
+
+	resp := adminRequest(t, s, user, "GET", "/api/v1/exchange-rates?from=usd&date=2024-03-02", "")
+	var rate fx.Rate
+	if err := json.NewDecoder(resp.Body).Decode(&rate); err != nil || resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("expected the rate; got %d, %v", resp.StatusCode, err)
+	}
+	if rate.Base != "USD" || rate.Quote != "EUR" || rate.Rate != 0.92 || !rate.Fallback || rate.RateDate.Format(time.DateOnly) != "2024-03-01" {
+		t.Errorf("expected the Friday rate of USD in EUR; got %+v", rate)
+	}
+
+	for _, path := range []string{"/api/v1/exchange-rates?from=dollar", "/api/v1/exchange-rates?to=USD"} {
+		if resp := adminRequest(t, s, user, "GET", path, ""); resp.StatusCode != fiber.StatusUnprocessableEntity {
+			t.Errorf("%s: expected status 422; got %d", path, resp.StatusCode)
+		}
+	}
+	if resp := adminRequest(t, s, user, "GET", "/api/v1/admin/exchange-rates", ""); resp.StatusCode != fiber.StatusForbidden {
+		t.Errorf("expected the stored rates refused to users; got %d", resp.StatusCode)
+	}
+
+	resp = adminRequest(t, s, admin, "GET", "/api/v1/admin/exchange-rates?base=USD", "")
+	var rates []types.ExchangeRate
+	if err := json.NewDecoder(resp.Body).Decode(&rates); err != nil || len(rates) != 1 {
+		t.Fatalf("expected the stored rate; got %+v, %v", rates, err)
+	}
+
+	path := "/api/v1/admin/exchange-rates/" + rates[0].ID.String()
+	if resp := adminRequest(t, s, admin, "PUT", path, `{"rate": 0}`); resp.StatusCode != fiber.StatusUnprocessableEntity {
+		t.Errorf("expected a zero rate refused; got %d", resp.StatusCode)
+	}
+	if resp := adminRequest(t, s, admin, "PUT", "/api/v1/admin/exchange-rates/"+uuid.NewString(), `{"rate": 1}`); resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("expected status 404 for an unknown rate; got %d", resp.StatusCode)
+	}
+	resp = adminRequest(t, s, admin, "PUT", path, `{"rate": 0.93}`)
+	var corrected types.ExchangeRate
+	if err := json.NewDecoder(resp.Body).Decode(&corrected); err != nil || corrected.Rate != 0.93 || corrected.Source != "manual" {
+		t.Errorf("expected the manual rate; got %+v, %v", corrected, err)
+	}
+
+	// The corrected rate is answered from then on
+	resp = adminRequest(t, s, user, "GET", "/api/v1/exchange-rates?from=USD&to=EUR&date=2024-03-02", "")
+	if err := json.NewDecoder(resp.Body).Decode(&rate); err != nil || rate.Rate != 0.93 {
+		t.Errorf("expected the corrected rate; got %+v, %v", rate, err)
+	}
+}
+
+// newAdminTestServerWithRates returns the admin test server with its
+// exchange rates in memory.
+func newAdminTestServerWithRates(t *testing.T) (s *FiberServer, admin, user types.User) {
+	s, db, admin, user := newAdminTestServer(t)
+	rates := &exchangeRatesDB{adminDB: db}
+	s.db = rates
+	s.fx = fx.NewService(rates, fridayProvider{})
+	return s, admin, user
+}
@@ -0,0 +1,250 @@
+package server
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/types"
+)
+
+// embeddedKey is the key of the related resources embedded with ?include=,
+// apart from the fields so that their names never collide.
+const embeddedKey = "_embedded"
+
+// resource is what the callers may select of a resource on the read
+// endpoints: the fields of its JSON with ?fields=id,date,amount and the
+// related resources embedded with ?include=account. Without either the
+// resource is answered whole, as before.
+type resource[T any] struct {
+	fields   map[string]bool
+	includes map[string]embedding[T]
+}
+
+// embedding is a related resource embedded on demand, loaded once for every
+// item of the response.
+type embedding[T any] struct {
+	// load returns the related resource of an item, nil when it has none
+	load func(s *FiberServer, c *fiber.Ctx, items []T) (func(item T) any, error)
+	// token changes whenever the related resources change, it is part of
+	// the ETag of the responses embedding them
+	token func(s *FiberServer, c *fiber.Ctx) (string, error)
+}
+
+// newResource returns the resource whose selectable fields are the JSON
+// fields of T, except the hidden ones, such as the relations never loaded.
+func newResource[T any](hidden []string, includes map[string]embedding[T]) resource[T] {
+	fields := map[string]bool{}
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" && t.Field(i).IsExported() {
+			fields[name] = true
+		}
+	}
+	for _, name := range hidden {
+		delete(fields, name)
+	}
+	return resource[T]{fields: fields, includes: includes}
+}
+
+// selection is the part of a resource a request asks for.
+type selection struct {
+	fields   []string
+	includes []string
+}
+
+// whole reports whether the resource is answered as is.
+func (sel selection) whole() bool {
+	return sel.fields == nil && len(sel.includes) == 0
+}
+
+// selection reads ?fields= and ?include=, comma separated. The unknown
+// names are refused with a 400 listing them.
+func (r resource[T]) selection(c *fiber.Ctx) (selection, error) {
+	var sel selection
+	var unknown []FieldError
+	if fields := c.Query("fields"); fields != "" {
+		sel.fields = []string{}
+		for _, name := range strings.Split(fields, ",") {
+			name = strings.TrimSpace(name)
+			if !r.fields[name] {
+				unknown = append(unknown, FieldError{Field: "fields", Message: "unknown field, expected one of " + strings.Join(sortedKeys(r.fields), ", "), Value: name})
+				continue
+			}
+			sel.fields = append(sel.fields, name)
+		}
+	}
+	if includes := c.Query("include"); includes != "" {
+		for _, name := range strings.Split(includes, ",") {
+			name = strings.TrimSpace(name)
+			if _, ok := r.includes[name]; !ok {
+				unknown = append(unknown, FieldError{Field: "include", Message: "unknown resource, expected one of " + strings.Join(sortedKeys(r.includes), ", "), Value: name})
+				continue
+			}
+			sel.includes = append(sel.includes, name)
+		}
+	}
+
+	if len(unknown) > 0 {
+		return selection{}, NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid field selection").WithDetails(unknown...)
+	}
+	return sel, nil
+}
+
+// changeToken returns the change tokens of the embedded resources, to add
+// to the token of the response. The selection itself is in the URL, which
+// the ETags are keyed by.
+func (r resource[T]) changeToken(s *FiberServer, c *fiber.Ctx, sel selection) (string, error) {
+	var tokens []string
+	for _, name := range sel.includes {
+		token, err := r.includes[name].token(s, c)
+		if err != nil {
+			return "", err
+		}
+		tokens = append(tokens, name+":"+token)
+	}
+	return strings.Join(tokens, "-"), nil
+}
+
+// all selects every field of the resource but the hidden ones.
+func (r resource[T]) all() selection {
+	return selection{fields: sortedKeys(r.fields)}
+}
+
+// list returns the items restricted to the selection, with their embedded
+// resources. Only embedding resources selects every field but the hidden
+// ones.
+func (r resource[T]) list(s *FiberServer, c *fiber.Ctx, sel selection, items []T) (any, error) {
+	if sel.whole() {
+		return items, nil
+	}
+	if sel.fields == nil {
+		sel.fields = r.all().fields
+	}
+
+	embed := make(map[string]func(T) any, len(sel.includes))
+	for _, name := range sel.includes {
+		resolve, err := r.includes[name].load(s, c, items)
+		if err != nil {
+			return nil, err
+		}
+		embed[name] = resolve
+	}
+
+	shaped := make([]map[string]any, len(items))
+	for i, item := range items {
+		var err error
+		if shaped[i], err = shape(sel, item, embed); err != nil {
+			return nil, err
+		}
+	}
+	return shaped, nil
+}
+
+// one returns the item restricted to the selection.
+func (r resource[T]) one(s *FiberServer, c *fiber.Ctx, sel selection, item T) (any, error) {
+	if sel.whole() {
+		return item, nil
+	}
+	items, err := r.list(s, c, sel, []T{item})
+	if err != nil {
+		return nil, err
+	}
+	return items.([]map[string]any)[0], nil
+}
+
+// shape returns the selected fields of the JSON of the item, and its
+// embedded resources under _embedded.
+func shape[T any](sel selection, item T, embed map[string]func(T) any) (map[string]any, error) {
+	body, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(body, &all); err != nil {
+		return nil, err
+	}
+
+	shaped := make(map[string]any, len(sel.fields)+1)
+	for _, name := range sel.fields {
+		// The fields omitted when empty stay omitted
+		if value, ok := all[name]; ok {
+			shaped[name] = value
+		}
+	}
+	if len(embed) > 0 {
+		embedded := make(map[string]any, len(embed))
+		for name, resolve := range embed {
+			embedded[name] = resolve(item)
+		}
+		shaped[embeddedKey] = embedded
+	}
+	return shaped, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// transactionResource is the transaction of the read endpoints. The user and
+// the account relations are never loaded: the account is embedded with
+// ?include=account.
+var transactionResource = newResource([]string{"user", "bank_account"}, map[string]embedding[types.Transaction]{
+	"account": {
+		load: func(s *FiberServer, c *fiber.Ctx, _ []types.Transaction) (func(types.Transaction) any, error) {
+			user := c.Locals("user").(types.User)
+			accounts := map[uuid.UUID]map[string]any{}
+			for _, account := range s.dbFor(c).GetBankAccounts(&user, true) {
+				account.Class = accountClass(account.AccountType)
+				shaped, err := shape(bankAccountResource.all(), account, nil)
+				if err != nil {
+					return nil, err
+				}
+				accounts[account.ID] = shaped
+			}
+			return func(transaction types.Transaction) any {
+				if account, ok := accounts[transaction.BankAccountID]; ok {
+					return account
+				}
+				return nil
+			}, nil
+		},
+		token: func(s *FiberServer, c *fiber.Ctx) (string, error) {
+			user := c.Locals("user").(types.User)
+			return s.dbFor(c).BankAccountsChangeToken(&user)
+		},
+	},
+	"category": {
+		load: func(s *FiberServer, c *fiber.Ctx, _ []types.Transaction) (func(types.Transaction) any, error) {
+			user := c.Locals("user").(types.User)
+			settings := map[string]types.CategorySetting{}
+			for _, setting := range mergeCategorySettings(user.ID, s.dbFor(c).GetCategorySettings(user.ID)) {
+				settings[setting.Category] = setting
+			}
+			return func(transaction types.Transaction) any {
+				if setting, ok := settings[transaction.Category]; ok {
+					return setting
+				}
+				return nil
+			}, nil
+		},
+		token: func(s *FiberServer, c *fiber.Ctx) (string, error) {
+			user := c.Locals("user").(types.User)
+			return s.dbFor(c).CategorySettingsChangeToken(user.ID)
+		},
+	},
+})
+
+// bankAccountResource is the bank account of the read endpoints, without
+// the relations never loaded.
+var bankAccountResource = newResource[types.BankAccount]([]string{"user", "transactions"}, nil)
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/internal/database"
+	"FinMa/types"
+)
+
+// fieldsetsDB lists the transactions and the accounts of the test, with the
+// change tokens set by the test.
+type fieldsetsDB struct {
+	database.Service
+	transactions  []types.Transaction
+	accounts      []types.BankAccount
+	accountsToken string
+}
+
+func (db *fieldsetsDB) WithContext(context.Context) database.Service {
+	return db
+}
+
+func (db *fieldsetsDB) GetTransactions(*types.User, types.TransactionFilter) []types.Transaction {
+	return db.transactions
+}
+
+func (db *fieldsetsDB) TransactionsChangeToken(*types.User, types.TransactionFilter) (string, error) {
+	return fmt.Sprint(len(db.transactions)), nil
+}
+
+func (db *fieldsetsDB) GetBankAccounts(*types.User, bool) []types.BankAccount {
+	return db.accounts
+}
+
+func (db *fieldsetsDB) BankAccountsChangeToken(*types.User) (string, error) {
+	return db.accountsToken, nil
+}
+
+func (db *fieldsetsDB) GetCategorySettings(uuid.UUID) []types.CategorySetting {
+	return []types.CategorySetting{{ID: uuid.New(), Category: "food", ExcludeByDefault: true}}
+}
+
+func (db *fieldsetsDB) CategorySettingsChangeToken(uuid.UUID) (string, error) {
+	return "1", nil
+}
+
+func newFieldsetsTestServer(transactions int) (*FiberServer, *fieldsetsDB) {
+	account := types.BankAccount{ID: uuid.New(), BankName: "Boursorama", AccountType: "checking", Balance: money(1250)}
+	db := &fieldsetsDB{accounts: []types.BankAccount{account}, accountsToken: "1"}
+	for i := 0; i < transactions; i++ {
+		db.transactions = append(db.transactions, types.Transaction{
+			ID:            uuid.New(),
+			Category:      "food",
+			Amount:        money(float64(i) + 0.99),
+			Date:          time.Date(2024, time.March, 1+i%28, 0, 0, 0, 0, time.UTC),
+			Type:          "expense",
+			Description:   fmt.Sprintf("Card payment %d", i),
+			BankAccountID: account.ID,
+		})
+	}
+
+	s := &FiberServer{App: fiber.New(fiber.Config{ErrorHandler: errorHandler}), db: db}
+	user := types.User{ID: uuid.New()}
+	s.Use(func(c *fiber.Ctx) error {
+		c.Locals("user", user)
+		return c.Next()
+	})
+	s.Get("/transactions", s.GetTransactions)
+	s.Get("/accounts", s.GetBankAccounts)
+	return s, db
+}
+
+func getFieldsets(t testing.TB, s *FiberServer, path, ifNoneMatch string) (*http.Response, []byte) {
+	req, err := http.NewRequest("GET", path, nil)
+	if err != nil {
+		t.Fatalf("error creating request. Err: %v", err)
+	}
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	resp, err := s.Test(req)
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	return resp, body
+}
+
+func TestSparseFieldsets(t *testing.T) {
+	s, _ := newFieldsetsTestServer(2)
+
+	_, body := getFieldsets(t, s, "/transactions?fields=id,date,amount", "")
+	var selected []map[string]any
+	if err := json.Unmarshal(body, &selected); err != nil || len(selected) != 2 {
+		t.Fatalf("expected the transactions; got %s, %v", body, err)
+	}
+	if len(selected[0]) != 3 || selected[0]["amount"] != "0.99" || selected[0]["date"] == nil || selected[0]["id"] == nil {
+		t.Errorf("expected only the selected fields; got %v", selected[0])
+	}
+
+	// Without a selection the transactions are answered whole
+	_, body = getFieldsets(t, s, "/transactions", "")
+	var whole []map[string]any
+	if err := json.Unmarshal(body, &whole); err != nil || whole[0]["bank_account"] == nil || whole[0]["_embedded"] != nil {
+		t.Errorf("expected the whole transactions; got %s, %v", body, err)
+	}
+
+	_, body = getFieldsets(t, s, "/accounts?fields=id,bank_name", "")
+	var accounts []map[string]any
+	if err := json.Unmarshal(body, &accounts); err != nil || len(accounts) != 1 || len(accounts[0]) != 2 || accounts[0]["bank_name"] != "Boursorama" {
+		t.Errorf("expected the selected fields of the accounts; got %s, %v", body, err)
+	}
+}
+
+func TestEmbeddedResources(t *testing.T) {
+	s, _ := newFieldsetsTestServer(1)
+
+	_, body := getFieldsets(t, s, "/transactions?fields=id,category&include=account,category", "")
+	var transactions []struct {
+		ID       uuid.UUID `json:"id"`
+		Category string    `json:"category"`
+		Embedded struct {
+			Account  map[string]any        `json:"account"`
+			Category types.CategorySetting `json:"category"`
+		} `json:"_embedded"`
+	}
+	if err := json.Unmarshal(body, &transactions); err != nil || len(transactions) != 1 {
+		t.Fatalf("expected the transaction; got %s, %v", body, err)
+	}
+	embedded := transactions[0].Embedded
+	if embedded.Account["bank_name"] != "Boursorama" || embedded.Account["class"] != "asset" || embedded.Account["user"] != nil {
+		t.Errorf("expected the account embedded without its relations; got %v", embedded.Account)
+	}
+	if embedded.Category.Category != "food" || !embedded.Category.ExcludeByDefault {
+		t.Errorf("expected the settings of the category embedded; got %+v", embedded.Category)
+	}
+
+	// Every field but the relations never loaded
+	_, body = getFieldsets(t, s, "/transactions?include=category", "")
+	var all []map[string]any
+	if err := json.Unmarshal(body, &all); err != nil || all[0]["description"] != "Card payment 0" || all[0]["bank_account"] != nil {
+		t.Errorf("expected every field with the embedded category; got %s, %v", body, err)
+	}
+}
+
+func TestInvalidFieldSelection(t *testing.T) {
+	s, _ := newFieldsetsTestServer(1)
+
+	for _, path := range []string{"/transactions?fields=id,password", "/transactions?include=user", "/transactions?fields=bank_account", "/accounts?include=account"} {
+		resp, body := getFieldsets(t, s, path, "")
+		var parsed errorBody
+		if err := json.Unmarshal(body, &parsed); err != nil || resp.StatusCode != fiber.StatusBadRequest || len(parsed.Error.Details) != 1 {
+			t.Errorf("%s: expected a 400 listing the unknown name; got %d %s", path, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestFieldSelectionETags(t *testing.T) {
+	s, db := newFieldsetsTestServer(3)
+
+	whole, _ := getFieldsets(t, s, "/transactions", "")
+	selected, _ := getFieldsets(t, s, "/transactions?fields=id,amount", "")
+	if whole.Header.Get("ETag") == selected.Header.Get("ETag") {
+		t.Errorf("expected the selection in the ETag")
+	}
+
+	embedded, _ := getFieldsets(t, s, "/transactions?include=account", "")
+	etag := embedded.Header.Get("ETag")
+	if resp, _ := getFieldsets(t, s, "/transactions?include=account", etag); resp.StatusCode != fiber.StatusNotModified {
+		t.Errorf("expected status 304 while nothing changed; got %d", resp.StatusCode)
+	}
+
+	// The transactions are unchanged, the embedded account is not
+	db.accountsToken = "2"
+	if resp, _ := getFieldsets(t, s, "/transactions?include=account", etag); resp.StatusCode != fiber.StatusOK {
+		t.Errorf("expected status 200 once the embedded account changed; got %d", resp.StatusCode)
+	}
+	if resp, _ := getFieldsets(t, s, "/transactions", whole.Header.Get("ETag")); resp.StatusCode != fiber.StatusNotModified {
+		t.Errorf("expected the responses without the account unaffected; got %d", resp.StatusCode)
+	}
+}
+
+// BenchmarkTransactionFieldsets measures the listing of 200 transactions,
+// whole and restricted to the fields of a list row, and reports the size of
+// the responses.
+func BenchmarkTransactionFieldsets(b *testing.B) {
+	s, _ := newFieldsetsTestServer(200)
+
+	for _, path := range []string{"/transactions", "/transactions?fields=id,date,amount,category", "/transactions?fields=id,date,amount,category&include=category"} {
+		b.Run(path, func(b *testing.B) {
+			var size int
+			for n := 0; n < b.N; n++ {
+				_, body := getFieldsets(b, s, path, "")
+				size = len(body)
+			}
+			b.ReportMetric(float64(size), "bytes/response")
+		})
+	}
+}
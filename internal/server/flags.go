@@ -0,0 +1,130 @@
+package server
+
+import (
+	"FinMa/internal/flags"
+	"FinMa/types"
+	"fmt"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// userFlags returns the feature flags of the user. The servers built
+// without an evaluator only apply the configuration.
+func (s *FiberServer) userFlags(user types.User) flags.Set {
+	if s.flags == nil {
+		return flags.Evaluate(s.config.Features.FlagOverrides(), nil)
+	}
+	set, err := s.flags.For(user.ID)
+	if err != nil {
+		log.Error("Error fetching feature flag overrides: ", err)
+	}
+	return set
+}
+
+// flagEnabled reports whether the feature is enabled for the user of the
+// request.
+func (s *FiberServer) flagEnabled(c *fiber.Ctx, flag flags.Flag) bool {
+	return s.userFlags(c.Locals("user").(types.User)).Enabled(flag)
+}
+
+// requireFlag returns a 403 error when the feature is not enabled for the
+// user, the endpoints of a feature are gated while it is rolled out. It
+// follows Authorize.
+func (s *FiberServer) requireFlag(flag flags.Flag) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !s.flagEnabled(c, flag) {
+			return featureDisabled(flag)
+		}
+		return c.Next()
+	}
+}
+
+// featureDisabled is the error of the requests using a feature not enabled
+// for the user.
+func featureDisabled(flag flags.Flag) *APIError {
+	return NewAPIError(fiber.StatusForbidden, CodeFeatureDisabled, fmt.Sprintf("The %s feature is not enabled", flag.Name))
+}
+
+// GetFlags returns the state of every feature flag for the user, so that the
+// apps hide the features not enabled.
+func (s *FiberServer) GetFlags(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"flags": s.userFlags(c.Locals("user").(types.User))})
+}
+
+// GetUserFlags returns the feature flags of the user and the overrides set
+// for them. Admin only.
+func (s *FiberServer) GetUserFlags(c *fiber.Ctx) error {
+	user, err := s.adminTargetUser(c)
+	if err != nil {
+		return err
+	}
+	return s.userFlagsResponse(c, user)
+}
+
+// SetUserFlags turns feature flags on or off for the user, over the
+// configuration: {"flags": {"households": true, "bank_sync": null}}. A null
+// removes the override, the flags left out are unchanged. Unknown flags are
+// refused. Admin only.
+func (s *FiberServer) SetUserFlags(c *fiber.Ctx) error {
+	type SetUserFlagsRequest struct {
+		Flags map[string]*bool `json:"flags"`
+	}
+
+	var body SetUserFlagsRequest
+	if err := c.BodyParser(&body); err != nil || len(body.Flags) == 0 {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body").
+			WithDetails(FieldError{Field: "flags", Message: "must map flag names to true, false or null"})
+	}
+
+	var unknown []FieldError
+	for name := range body.Flags {
+		if _, ok := flags.Lookup(name); !ok {
+			unknown = append(unknown, FieldError{Field: "flags." + name, Message: "unknown flag", Value: name})
+		}
+	}
+	if len(unknown) > 0 {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Unknown feature flags").WithDetails(unknown...)
+	}
+
+	user, err := s.adminTargetUser(c)
+	if err != nil {
+		return err
+	}
+	if err := s.db.SetFeatureFlagOverrides(user.ID, body.Flags); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not update the feature flags")
+	}
+	s.flags.Invalidate(user.ID)
+
+	return s.userFlagsResponse(c, user)
+}
+
+// adminTargetUser returns the user of the :id of an admin route.
+func (s *FiberServer) adminTargetUser(c *fiber.Ctx) (types.User, error) {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return types.User{}, NewAPIError(fiber.StatusNotFound, CodeNotFound, "User not found")
+	}
+	user := s.db.GetUserByID(id)
+	if user.ID == uuid.Nil {
+		return types.User{}, NewAPIError(fiber.StatusNotFound, CodeNotFound, "User not found")
+	}
+	return user, nil
+}
+
+func (s *FiberServer) userFlagsResponse(c *fiber.Ctx, user types.User) error {
+	overrides, err := s.db.GetFeatureFlagOverrides(user.ID)
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not fetch the feature flags")
+	}
+
+	return c.JSON(fiber.Map{
+		"user_id":   user.ID,
+		"flags":     s.userFlags(user),
+		"overrides": overrides,
+		"available": flags.All(),
+	})
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/internal/flags"
+	"FinMa/types"
+)
+
+// flagsDB stores the feature flag overrides of the users of an adminDB.
+type flagsDB struct {
+	*adminDB
+	overrides map[uuid.UUID]map[string]bool
+}
+
+func (db *flagsDB) GetFeatureFlagOverrides(userID uuid.UUID) (map[string]bool, error) {
+	overrides := map[string]bool{}
+	for name, enabled := range db.overrides[userID] {
+		overrides[name] = enabled
+	}
+	return overrides, nil
+}
+
+func (db *flagsDB) SetFeatureFlagOverrides(userID uuid.UUID, overrides map[string]*bool) error {
+	if db.overrides[userID] == nil {
+		db.overrides[userID] = map[string]bool{}
+	}
+	for name, enabled := range overrides {
+		if enabled == nil {
+			delete(db.overrides[userID], name)
+		} else {
+			db.overrides[userID][name] = *enabled
+		}
+	}
+	return nil
+}
+
+func (db *flagsDB) GetUserHousehold(uuid.UUID) types.Household {
+	return types.Household{}
+}
+
+func newFlagsTestServer(t *testing.T) (*FiberServer, *flagsDB, types.User, types.User) {
+	s, admins, admin, user := newAdminTestServer(t)
+	db := &flagsDB{adminDB: admins, overrides: map[uuid.UUID]map[string]bool{}}
+	s.db = db
+	s.flags = flags.NewEvaluator(s.config.Features.FlagOverrides(), time.Minute, db.GetFeatureFlagOverrides)
+	return s, db, admin, user
+}
+
+func TestFeatureFlagGate(t *testing.T) {
+	s, _, admin, user := newFlagsTestServer(t)
+
+	resp := adminRequest(t, s, user, "GET", "/api/v1/household", "")
+	var body struct {
+		Error APIError `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || resp.StatusCode != fiber.StatusForbidden || body.Error.Code != CodeFeatureDisabled {
+		t.Fatalf("expected the households gated; got %d %+v", resp.StatusCode, body.Error)
+	}
+
+	resp = adminRequest(t, s, admin, "POST", "/api/v1/admin/users/"+user.ID.String()+"/flags", `{"flags": {"households": true}}`)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("expected the flag turned on; got %d", resp.StatusCode)
+	}
+	// Applied at once, despite the overrides kept in memory
+	if resp := adminRequest(t, s, user, "GET", "/api/v1/household", ""); resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("expected the household endpoint reached; got %d", resp.StatusCode)
+	}
+	if resp := adminRequest(t, s, admin, "GET", "/api/v1/household", ""); resp.StatusCode != fiber.StatusForbidden {
+		t.Errorf("expected the households still gated for the other users; got %d", resp.StatusCode)
+	}
+
+	resp = adminRequest(t, s, user, "GET", "/api/v1/flags", "")
+	var listed struct {
+		Flags map[string]bool `json:"flags"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&listed); err != nil || !listed.Flags["households"] || !listed.Flags["bank_sync"] {
+		t.Errorf("expected the flags of the user; got %+v, %v", listed, err)
+	}
+
+	adminRequest(t, s, admin, "POST", "/api/v1/admin/users/"+user.ID.String()+"/flags", `{"flags": {"households": null}}`)
+	if resp := adminRequest(t, s, user, "GET", "/api/v1/household", ""); resp.StatusCode != fiber.StatusForbidden {
+		t.Errorf("expected the households gated once the override removed; got %d", resp.StatusCode)
+	}
+}
+
+func TestSetUserFlagsRefusesUnknownFlags(t *testing.T) {
+	s, db, admin, user := newFlagsTestServer(t)
+
+	resp := adminRequest(t, s, admin, "POST", "/api/v1/admin/users/"+user.ID.String()+"/flags", `{"flags": {"households": true, "househods": true}}`)
+	var body struct {
+		Error APIError `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || resp.StatusCode != fiber.StatusBadRequest {
+		t.Fatalf("expected status 400; got %d, %v", resp.StatusCode, err)
+	}
+	if len(body.Error.Details) != 1 || body.Error.Details[0].Field != "flags.househods" {
+		t.Errorf("expected the unknown flag in the details; got %+v", body.Error.Details)
+	}
+	if len(db.overrides) != 0 {
+		t.Errorf("expected nothing stored; got %v", db.overrides)
+	}
+
+	if resp := adminRequest(t, s, admin, "POST", "/api/v1/admin/users/"+uuid.NewString()+"/flags", `{"flags": {"households": true}}`); resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("expected status 404 for an unknown user; got %d", resp.StatusCode)
+	}
+	if resp := adminRequest(t, s, user, "GET", "/api/v1/admin/users/"+user.ID.String()+"/flags", ""); resp.StatusCode != fiber.StatusForbidden {
+		t.Errorf("expected the admin routes refused to users; got %d", resp.StatusCode)
+	}
+}
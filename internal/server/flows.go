@@ -0,0 +1,240 @@
+package server
+
+import (
+	"FinMa/types"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	// flowsDefaultMinPercent is the share of the income or of the expenses
+	// under which a source or a category is merged into "other".
+	flowsDefaultMinPercent = 2.0
+	// flowNetSaved and flowNetDrawn are the nodes balancing the accounts.
+	flowNetSaved = "net_saved"
+	flowNetDrawn = "net_drawn"
+)
+
+// flowLinkKinds orders the links, from the left of the diagram to the right.
+var flowLinkKinds = map[string]int{"income": 0, "transfer": 1, "expense": 2, "balance": 3}
+
+// mergeSmallFlows returns the node of each of the sums, by name: its own,
+// prefix + name, or prefix + "other" for the ones under the share of the
+// total, listed in merged from the largest.
+func mergeSmallFlows(sums map[string]int64, prefix string, minPercent float64) (nodes map[string]string, merged []string) {
+	var total int64
+	for _, sum := range sums {
+		total += sum
+	}
+
+	nodes = make(map[string]string, len(sums))
+	for _, name := range sortedKeys(sums) {
+		if float64(sums[name]) < float64(total)*minPercent/100 {
+			nodes[name] = prefix + "other"
+			merged = append(merged, name)
+			continue
+		}
+		nodes[name] = prefix + name
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		return sums[merged[i]] > sums[merged[j]]
+	})
+	return nodes, merged
+}
+
+// buildFlows sets the nodes and the links of the flows from the totals of
+// the range: the income sources into the accounts, the net transfers
+// between the accounts, and the accounts into the expense categories. The
+// sources and the categories under MinPercent of their side are merged into
+// an "other" node each. What an account received beyond what it spent is
+// linked to the net saved, the rest drawn from the net drawn, so that both
+// sides balance. The accounts are labelled from labels, by ID. The sums are
+// made in unbound minor units, so both sides balance exactly.
+func buildFlows(flows *types.Flows, totals []types.FlowTotal, labels map[uuid.UUID]string) {
+	sources := map[string]int64{}
+	categories := map[string]int64{}
+	for _, total := range totals {
+		switch total.Type {
+		case "income":
+			sources[total.Counterpart] += total.Total.Unbound().Minor
+		case "expense":
+			categories[total.Counterpart] += total.Total.Unbound().Minor
+		}
+	}
+	sourceNodes, mergedSources := mergeSmallFlows(sources, "income:", flows.MinPercent)
+	categoryNodes, mergedCategories := mergeSmallFlows(categories, "category:", flows.MinPercent)
+
+	values := map[[2]string]int64{}
+	kinds := map[[2]string]string{}
+	link := func(source, target, kind string, value int64) {
+		key := [2]string{source, target}
+		values[key] += value
+		kinds[key] = kind
+	}
+	accountNode := func(id uuid.UUID) string {
+		return "account:" + id.String()
+	}
+
+	balances := map[uuid.UUID]int64{}
+	// Transfers back and forth between two accounts net out, keyed by the
+	// accounts in order
+	transfers := map[[2]uuid.UUID]int64{}
+	var income, expenses, netSaved, netDrawn int64
+	for _, total := range totals {
+		amount := total.Total.Unbound().Minor
+		switch total.Type {
+		case "income":
+			link(sourceNodes[total.Counterpart], accountNode(total.AccountID), "income", amount)
+			balances[total.AccountID] += amount
+			income += amount
+		case "expense":
+			link(accountNode(total.AccountID), categoryNodes[total.Counterpart], "expense", amount)
+			balances[total.AccountID] -= amount
+			expenses += amount
+		case "transfer":
+			target, err := uuid.Parse(total.Counterpart)
+			if err != nil || target == total.AccountID {
+				continue
+			}
+			if total.AccountID.String() < target.String() {
+				transfers[[2]uuid.UUID{total.AccountID, target}] += amount
+			} else {
+				transfers[[2]uuid.UUID{target, total.AccountID}] -= amount
+			}
+		}
+	}
+	for pair, net := range transfers {
+		from, to := pair[0], pair[1]
+		if net < 0 {
+			from, to, net = to, from, -net
+		}
+		if net == 0 {
+			continue
+		}
+		link(accountNode(from), accountNode(to), "transfer", net)
+		balances[from] -= net
+		balances[to] += net
+	}
+	for id, balance := range balances {
+		switch {
+		case balance > 0:
+			link(accountNode(id), flowNetSaved, "balance", balance)
+			netSaved += balance
+		case balance < 0:
+			link(flowNetDrawn, accountNode(id), "balance", -balance)
+			netDrawn -= balance
+		}
+	}
+	flows.Income = types.NewMoney(income, "")
+	flows.Expenses = types.NewMoney(expenses, "")
+	flows.NetSaved = types.NewMoney(netSaved, "")
+	flows.NetDrawn = types.NewMoney(netDrawn, "")
+
+	flows.Links = make([]types.FlowLink, 0, len(values))
+	in, out := map[string]int64{}, map[string]int64{}
+	for key, value := range values {
+		flows.Links = append(flows.Links, types.FlowLink{Source: key[0], Target: key[1], Kind: kinds[key], Value: types.NewMoney(value, "")})
+		out[key[0]] += value
+		in[key[1]] += value
+	}
+	sort.Slice(flows.Links, func(i, j int) bool {
+		a, b := flows.Links[i], flows.Links[j]
+		if a.Kind != b.Kind {
+			return flowLinkKinds[a.Kind] < flowLinkKinds[b.Kind]
+		}
+		if a.Value.Minor != b.Value.Minor {
+			return a.Value.Minor > b.Value.Minor
+		}
+		if a.Source != b.Source {
+			return a.Source < b.Source
+		}
+		return a.Target < b.Target
+	})
+
+	// The nodes follow the order of their first link
+	flows.Nodes = []types.FlowNode{}
+	seen := map[string]bool{}
+	node := func(id string) {
+		if seen[id] {
+			return
+		}
+		seen[id] = true
+		n := types.FlowNode{ID: id, Total: types.NewMoney(max(in[id], out[id]), "")}
+		switch id {
+		case flowNetSaved:
+			n.Kind, n.Label = "balance", "Net saved"
+		case flowNetDrawn:
+			n.Kind, n.Label = "balance", "Net drawn"
+		case "income:other":
+			n.Kind, n.Label, n.Other, n.Merged = "income", "Other income", true, mergedSources
+		case "category:other":
+			n.Kind, n.Label, n.Other, n.Merged = "category", "Other expenses", true, mergedCategories
+		default:
+			n.Kind, n.Label, _ = strings.Cut(id, ":")
+			if n.Kind == "account" {
+				accountID, _ := uuid.Parse(n.Label)
+				n.Label = labels[accountID]
+				if n.Label == "" {
+					n.Label = "Other account"
+				}
+			}
+		}
+		flows.Nodes = append(flows.Nodes, n)
+	}
+	for _, l := range flows.Links {
+		node(l.Source)
+		node(l.Target)
+	}
+}
+
+// GetFlows returns the flows of the money of the user between ?from= and
+// ?to= (RFC3339, the last 90 days by default), for a Sankey diagram: the
+// income by source into the accounts, the transfers between the accounts,
+// netted per pair, and the accounts into the expense categories. The
+// sources and the categories under ?min_percent=2 of the income or of the
+// expenses are merged into an "other" node each. What the accounts kept or
+// lost over the range balances both sides, as the net saved or drawn. The
+// transactions excluded from the budgets are left out. The CSV holds the
+// links.
+func (s *FiberServer) GetFlows(c *fiber.Ctx) error {
+	db := s.dbFor(c)
+
+	user := c.Locals("user").(types.User)
+
+	from, to, err := parseReportRange(c)
+	if err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, err.Error())
+	}
+
+	minPercent := flowsDefaultMinPercent
+	if value := c.Query("min_percent"); value != "" {
+		minPercent, err = strconv.ParseFloat(value, 64)
+		if err != nil || minPercent < 0 || minPercent > 50 {
+			return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "min_percent must be a number between 0 and 50")
+		}
+	}
+
+	key := []string{c.Query("from"), c.Query("to"), strconv.FormatFloat(minPercent, 'f', -1, 64)}
+	return cachedReport(s, c, "flows", key, func() (types.Flows, error) {
+		flows := types.Flows{From: from, To: to, Currency: s.baseCurrency(user), MinPercent: minPercent}
+		totals, err := db.GetFlowTotals(&user, from, to)
+		if err != nil {
+			log.Error(err)
+			return flows, NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not compute the flows")
+		}
+
+		labels := map[uuid.UUID]string{}
+		for _, account := range db.GetBankAccounts(&user, true) {
+			labels[account.ID] = account.BankName
+		}
+		buildFlows(&flows, totals, labels)
+		return flows, nil
+	}, func(flows types.Flows) any {
+		return flows.Links
+	})
+}
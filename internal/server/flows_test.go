@@ -0,0 +1,104 @@
+package server
+
+import (
+	"FinMa/types"
+	"fmt"
+	"testing"
+	"testing/quick"
+
+	"github.com/google/uuid"
+)
+
+func TestBuildFlows(t *testing.T) {
+	checking, savings := uuid.New(), uuid.New()
+	totals := []types.FlowTotal{
+		{Type: "income", AccountID: checking, Counterpart: "acme", Total: money(3000)},
+		{Type: "income", AccountID: checking, Counterpart: "refund", Total: money(20)},
+		{Type: "income", AccountID: checking, Counterpart: "cashback", Total: money(10.004)},
+		{Type: "expense", AccountID: checking, Counterpart: "bills", Total: money(1200)},
+		{Type: "expense", AccountID: checking, Counterpart: "food", Total: money(600)},
+		{Type: "expense", AccountID: savings, Counterpart: "shopping", Total: money(250)},
+		{Type: "transfer", AccountID: checking, Counterpart: savings.String(), Total: money(1000)},
+		{Type: "transfer", AccountID: savings, Counterpart: checking.String(), Total: money(100)},
+	}
+
+	flows := types.Flows{MinPercent: 2}
+	buildFlows(&flows, totals, map[uuid.UUID]string{checking: "Boursorama"})
+
+	if flows.Income != money(3030.004) || flows.Expenses != money(2050) {
+		t.Fatalf("expected 3030.004 of income and 2050 of expenses; got %v and %v", flows.Income, flows.Expenses)
+	}
+	// Both sides balance
+	if flows.Income.Minor+flows.NetDrawn.Minor != flows.Expenses.Minor+flows.NetSaved.Minor {
+		t.Errorf("expected the sides to balance; got %+v", flows)
+	}
+
+	links := map[[2]string]types.Money{}
+	for _, link := range flows.Links {
+		links[[2]string{link.Source, link.Target}] = link.Value
+	}
+	checkingNode, savingsNode := "account:"+checking.String(), "account:"+savings.String()
+	// The small sources are merged
+	if links[[2]string{"income:other", checkingNode}] != money(30.004) {
+		t.Errorf("expected the refund and the cashback in other income; got %v", flows.Links)
+	}
+	// The transfers are netted
+	if links[[2]string{checkingNode, savingsNode}] != money(900) || links[[2]string{savingsNode, checkingNode}] != money(0) {
+		t.Errorf("expected a net transfer of 900; got %v", flows.Links)
+	}
+	if links[[2]string{checkingNode, flowNetSaved}] != money(330.004) || links[[2]string{savingsNode, flowNetSaved}] != money(650) {
+		t.Errorf("expected both accounts to save; got %v", flows.Links)
+	}
+	if flows.Links[0].Kind != "income" || flows.Links[len(flows.Links)-1].Kind != "balance" {
+		t.Errorf("expected the links from left to right; got %v", flows.Links)
+	}
+
+	labels := map[string]string{}
+	for _, node := range flows.Nodes {
+		labels[node.ID] = node.Label
+		if node.ID == "income:other" && (len(node.Merged) != 2 || node.Merged[0] != "refund" || node.Total != money(30.004)) {
+			t.Errorf("expected the merged sources listed; got %+v", node)
+		}
+	}
+	if labels[checkingNode] != "Boursorama" || labels[savingsNode] != "Other account" || labels["category:food"] != "food" {
+		t.Errorf("expected the nodes labelled; got %v", labels)
+	}
+}
+
+func TestFlowsBalanceExactly(t *testing.T) {
+	accounts := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	balance := func(amounts [12]uint32, minPercent uint8) bool {
+		totals := make([]types.FlowTotal, 0, len(amounts))
+		for i, amount := range amounts {
+			// Amounts in ten-thousandths, the finest unbound unit
+			total := types.FlowTotal{AccountID: accounts[i%len(accounts)], Total: types.NewMoney(int64(amount%100_000_000), "")}
+			switch i % 3 {
+			case 0:
+				total.Type, total.Counterpart = "income", fmt.Sprintf("source %d", i)
+			case 1:
+				total.Type, total.Counterpart = "expense", fmt.Sprintf("category %d", i)
+			default:
+				total.Type, total.Counterpart = "transfer", accounts[(i+1)%len(accounts)].String()
+			}
+			totals = append(totals, total)
+		}
+
+		flows := types.Flows{MinPercent: float64(minPercent % 20)}
+		buildFlows(&flows, totals, nil)
+
+		var income, expenses int64
+		for _, total := range totals {
+			switch total.Type {
+			case "income":
+				income += total.Total.Minor
+			case "expense":
+				expenses += total.Total.Minor
+			}
+		}
+		return flows.Income.Minor == income && flows.Expenses.Minor == expenses &&
+			flows.Income.Minor+flows.NetDrawn.Minor == flows.Expenses.Minor+flows.NetSaved.Minor
+	}
+	if err := quick.Check(balance, nil); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,474 @@
+package server
+
+import (
+	"FinMa/internal/i18n"
+	"FinMa/types"
+	"context"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// monthsUntil returns the number of monthly contributions left from now to
+// target: the whole months between them, plus one for a partial month.
+func monthsUntil(now, target time.Time) int {
+	months := (target.Year()-now.Year())*12 + int(target.Month()-now.Month())
+	if target.Day() > now.Day() {
+		months++
+	}
+	return months
+}
+
+// goalProgress computes how far a goal is from its target. With a target
+// date, the required monthly contribution spreads the remaining amount over
+// the months left (all of it once the date passed), and the goal is behind
+// when less was contributed than a steady pace from its creation would give.
+// The required contribution is rounded to the minor unit of the currency of
+// the goal.
+func goalProgress(goal types.Goal, contributed types.Money, currency string, now time.Time) types.GoalProgress {
+	target := goal.TargetAmount.Unbound()
+	contributed = contributed.Unbound()
+	remaining := types.NewMoney(max(0, target.Minor-contributed.Minor), "")
+	progress := types.GoalProgress{
+		Goal:        goal,
+		Contributed: contributed,
+		Remaining:   remaining,
+	}
+	if target.Sign() > 0 {
+		progress.Percentage = math.Round(float64(contributed.Minor)/float64(target.Minor)*10000) / 100
+	}
+
+	if goal.TargetDate == nil {
+		return progress
+	}
+
+	required := types.Money{}
+	if remaining.Sign() > 0 {
+		required = remaining
+		if months := monthsUntil(now, *goal.TargetDate); months > 1 {
+			required = remaining.Mul(1 / float64(months)).Round(currency)
+		}
+
+		total := goal.TargetDate.Sub(goal.CreatedAt).Seconds()
+		elapsed := now.Sub(goal.CreatedAt).Seconds()
+		expected := target
+		if total > 0 && elapsed < total {
+			expected = target.Mul(math.Max(0, elapsed) / total)
+		}
+		progress.Behind = contributed.Minor < expected.Minor
+	}
+	progress.RequiredMonthly = &required
+
+	return progress
+}
+
+// goalsProgress computes the progress of the goals of the user with a single
+// query for their contributions.
+func (s *FiberServer) goalsProgress(user types.User, goals []types.Goal, now time.Time) ([]types.GoalProgress, error) {
+	ids := make([]uuid.UUID, 0, len(goals))
+	for _, goal := range goals {
+		ids = append(ids, goal.ID)
+	}
+
+	contributed, err := s.db.GetGoalsContributed(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	progress := make([]types.GoalProgress, 0, len(goals))
+	for _, goal := range goals {
+		progress = append(progress, goalProgress(goal, contributed[goal.ID], s.baseCurrency(user), now))
+	}
+	return progress, nil
+}
+
+// findUserGoal returns the goal from the route params if the user owns it.
+func (s *FiberServer) findUserGoal(user types.User, id string) (types.Goal, bool) {
+	goal := s.db.GetGoalByID(id)
+	if goal.ID == uuid.Nil || goal.UserID != user.ID {
+		return types.Goal{}, false
+	}
+	return goal, true
+}
+
+// completeGoal marks the goal as completed and notifies its owner once the
+// contributions reach the target. Completed goals stop receiving the money
+// reaching their account.
+func (s *FiberServer) completeGoal(goal types.Goal) {
+	if goal.CompletedAt != nil {
+		return
+	}
+
+	contributed, err := s.db.GetGoalsContributed([]uuid.UUID{goal.ID})
+	if err != nil {
+		log.Error("Error computing goal contributions: ", err)
+		return
+	}
+	if contributed[goal.ID].Unbound().Minor < goal.TargetAmount.Unbound().Minor {
+		return
+	}
+
+	now := time.Now()
+	goal.CompletedAt = &now
+	if err := s.db.UpdateGoal(&goal); err != nil {
+		log.Error("Error completing goal: ", err)
+		return
+	}
+
+	err = s.Notify(context.Background(), goal.UserID, "goal_completed", NotificationPayload{
+		Params: i18n.Params{"goal": goal.Name, "target": i18n.Amount(goal.TargetAmount.Float64())},
+		Details: fiber.Map{
+			"goal_id":       goal.ID,
+			"goal_name":     goal.Name,
+			"target_amount": goal.TargetAmount,
+			"contributed":   contributed[goal.ID],
+		},
+	})
+	if err != nil {
+		log.Error("Error notifying goal completion: ", err)
+	}
+}
+
+// checkGoalContributions is called after a transaction change is committed.
+// New income or transfers reaching the account of an active goal contribute
+// to it, and the contributions linked to a transaction follow its changes.
+func (s *FiberServer) checkGoalContributions(previous, current *types.Transaction) {
+	if current == nil {
+		if err := s.db.DeleteTransactionContributions(previous.ID); err != nil {
+			log.Error("Error deleting goal contributions: ", err)
+		}
+		return
+	}
+
+	if previous != nil {
+		if err := s.db.SyncTransactionContributions(current); err != nil {
+			log.Error("Error updating goal contributions: ", err)
+			return
+		}
+		for _, goal := range s.db.GetGoalsFundedBy(current) {
+			s.completeGoal(goal)
+		}
+		return
+	}
+
+	var credited *uuid.UUID
+	switch current.Type {
+	case "income":
+		credited = &current.BankAccountID
+	case "transfer":
+		credited = current.TransferAccountID
+	}
+	if credited == nil || *credited == uuid.Nil {
+		return
+	}
+
+	for _, goal := range s.db.GetActiveGoalsForAccount(*credited) {
+		if current.Date.Before(goal.CreatedAt) {
+			continue
+		}
+
+		contribution := &types.GoalContribution{
+			ID:            uuid.New(),
+			Amount:        current.Amount.Unbound(),
+			Date:          current.Date,
+			Note:          current.Description,
+			GoalID:        goal.ID,
+			TransactionID: &current.ID,
+		}
+		if err := s.db.CreateGoalContribution(contribution); err != nil {
+			log.Error("Error creating goal contribution: ", err)
+			continue
+		}
+		s.completeGoal(goal)
+	}
+}
+
+// CreateGoal creates a savings goal for the authenticated user. The target
+// date (RFC3339) and the account the money is saved on are optional.
+func (s *FiberServer) CreateGoal(c *fiber.Ctx) error {
+	type CreateGoalRequest struct {
+		Name          string      `json:"name"`
+		TargetAmount  types.Money `json:"target_amount"`
+		TargetDate    string      `json:"target_date"`
+		BankAccountID *uuid.UUID  `json:"bank_account_id"`
+	}
+
+	var body CreateGoalRequest
+	if err := c.BodyParser(&body); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+
+	name := strings.TrimSpace(body.Name)
+	if name == "" {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Goal name is required")
+	}
+	if body.TargetAmount.Sign() <= 0 {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Target amount must be positive")
+	}
+
+	user := c.Locals("user").(types.User)
+	if err := s.checkBaseAmount("target_amount", body.TargetAmount, user); err != nil {
+		return err
+	}
+	goal := &types.Goal{
+		ID:           uuid.New(),
+		Name:         name,
+		TargetAmount: body.TargetAmount,
+		UserID:       user.ID,
+	}
+
+	if body.TargetDate != "" {
+		targetDate, err := time.Parse(time.RFC3339, body.TargetDate)
+		if err != nil {
+			return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid target date format")
+		}
+		goal.TargetDate = &targetDate
+	}
+
+	if body.BankAccountID != nil {
+		if _, ok := s.findUserBankAccount(user, body.BankAccountID.String(), "viewer"); !ok {
+			return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Bank account not found")
+		}
+		goal.BankAccountID = body.BankAccountID
+	}
+
+	if err := s.db.CreateGoal(goal); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not create goal")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(goalProgress(*goal, types.Money{}, s.baseCurrency(user), time.Now()))
+}
+
+// GetGoals lists the goals of the user with their progress.
+func (s *FiberServer) GetGoals(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+
+	progress, err := s.goalsProgress(user, s.db.GetGoals(&user), time.Now())
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not compute goal progress")
+	}
+
+	return c.JSON(progress)
+}
+
+// GetGoal returns a goal with its progress.
+func (s *FiberServer) GetGoal(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	goal, ok := s.findUserGoal(user, c.Params("id"))
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Goal not found")
+	}
+
+	progress, err := s.goalsProgress(user, []types.Goal{goal}, time.Now())
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not compute goal progress")
+	}
+
+	return c.JSON(progress[0])
+}
+
+// UpdateGoal updates the name, target or account of a goal. An empty
+// target_date removes the target date. Raising the target of a completed
+// goal does not reopen it.
+func (s *FiberServer) UpdateGoal(c *fiber.Ctx) error {
+	type UpdateGoalRequest struct {
+		Name          *string      `json:"name"`
+		TargetAmount  *types.Money `json:"target_amount"`
+		TargetDate    *string      `json:"target_date"`
+		BankAccountID *uuid.UUID   `json:"bank_account_id"`
+	}
+
+	var body UpdateGoalRequest
+	if err := c.BodyParser(&body); err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+
+	user := c.Locals("user").(types.User)
+	goal, ok := s.findUserGoal(user, c.Params("id"))
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Goal not found")
+	}
+
+	if body.Name != nil {
+		if goal.Name = strings.TrimSpace(*body.Name); goal.Name == "" {
+			return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Goal name is required")
+		}
+	}
+
+	if body.TargetAmount != nil {
+		if body.TargetAmount.Sign() <= 0 {
+			return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Target amount must be positive")
+		}
+		if err := s.checkBaseAmount("target_amount", *body.TargetAmount, user); err != nil {
+			return err
+		}
+		goal.TargetAmount = *body.TargetAmount
+	}
+
+	if body.TargetDate != nil {
+		goal.TargetDate = nil
+		if *body.TargetDate != "" {
+			targetDate, err := time.Parse(time.RFC3339, *body.TargetDate)
+			if err != nil {
+				return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid target date format")
+			}
+			goal.TargetDate = &targetDate
+		}
+	}
+
+	if body.BankAccountID != nil {
+		if _, ok := s.findUserBankAccount(user, body.BankAccountID.String(), "viewer"); !ok {
+			return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Bank account not found")
+		}
+		goal.BankAccountID = body.BankAccountID
+	}
+
+	if err := s.db.UpdateGoal(&goal); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not update goal")
+	}
+
+	// Lowering the target may complete the goal
+	s.completeGoal(goal)
+	goal = s.db.GetGoalByID(goal.ID.String())
+
+	progress, err := s.goalsProgress(user, []types.Goal{goal}, time.Now())
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not compute goal progress")
+	}
+
+	return c.JSON(progress[0])
+}
+
+// DeleteGoal deletes a goal and its contributions, the transactions linked
+// to it are kept.
+func (s *FiberServer) DeleteGoal(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	goal, ok := s.findUserGoal(user, c.Params("id"))
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Goal not found")
+	}
+
+	if err := s.db.DeleteGoal(&goal); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not delete goal")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// CreateGoalContribution records a contribution to a goal: either a manual
+// amount, dated with date (RFC3339) or now, or the amount of the transaction
+// given by transaction_id. A transaction can only be linked once to a goal.
+func (s *FiberServer) CreateGoalContribution(c *fiber.Ctx) error {
+	type CreateGoalContributionRequest struct {
+		Amount        types.Money `json:"amount"`
+		Date          string      `json:"date"`
+		Note          string      `json:"note"`
+		TransactionID *uuid.UUID  `json:"transaction_id"`
+	}
+
+	var body CreateGoalContributionRequest
+	if err := c.BodyParser(&body); err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+
+	user := c.Locals("user").(types.User)
+	goal, ok := s.findUserGoal(user, c.Params("id"))
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Goal not found")
+	}
+
+	contribution := &types.GoalContribution{
+		ID:     uuid.New(),
+		Amount: body.Amount,
+		Date:   time.Now(),
+		Note:   strings.TrimSpace(body.Note),
+		GoalID: goal.ID,
+	}
+
+	if body.TransactionID != nil {
+		transaction, ok := s.findUserTransaction(user, body.TransactionID.String(), "viewer")
+		if !ok {
+			return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Transaction not found")
+		}
+
+		for _, existing := range s.db.GetGoalContributions(goal.ID) {
+			if existing.TransactionID != nil && *existing.TransactionID == transaction.ID {
+				return NewAPIError(fiber.StatusConflict, CodeConflict, "Transaction already contributes to this goal")
+			}
+		}
+
+		contribution.Amount = transaction.Amount.Unbound()
+		contribution.Date = transaction.Date
+		contribution.TransactionID = &transaction.ID
+		if contribution.Note == "" {
+			contribution.Note = transaction.Description
+		}
+	} else {
+		if body.Amount.Sign() <= 0 {
+			return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Contribution amount must be positive")
+		}
+		if err := s.checkBaseAmount("amount", body.Amount, user); err != nil {
+			return err
+		}
+		if body.Date != "" {
+			date, err := time.Parse(time.RFC3339, body.Date)
+			if err != nil {
+				return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid date format")
+			}
+			contribution.Date = date
+		}
+	}
+
+	if err := s.db.CreateGoalContribution(contribution); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not create goal contribution")
+	}
+
+	s.completeGoal(goal)
+
+	return c.Status(fiber.StatusCreated).JSON(contribution)
+}
+
+// GetGoalContributions lists the contributions to a goal, newest first.
+func (s *FiberServer) GetGoalContributions(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	goal, ok := s.findUserGoal(user, c.Params("id"))
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Goal not found")
+	}
+
+	return c.JSON(s.db.GetGoalContributions(goal.ID))
+}
+
+// DeleteGoalContribution removes a contribution from a goal. A linked
+// transaction is kept, only the link is removed.
+func (s *FiberServer) DeleteGoalContribution(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	goal, ok := s.findUserGoal(user, c.Params("id"))
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Goal not found")
+	}
+
+	contribution := s.db.GetGoalContributionByID(c.Params("contributionId"))
+	if contribution.ID == uuid.Nil || contribution.GoalID != goal.ID {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Contribution not found")
+	}
+
+	if err := s.db.DeleteGoalContribution(&contribution); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not delete goal contribution")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"FinMa/types"
+	"testing"
+	"time"
+)
+
+func TestMonthsUntil(t *testing.T) {
+	tests := []struct {
+		now, target time.Time
+		expected    int
+	}{
+		{day(2024, time.July, 2), day(2025, time.January, 1), 6},
+		{day(2024, time.July, 2), day(2025, time.January, 5), 7},
+		{day(2024, time.July, 2), day(2024, time.July, 20), 1},
+		{day(2024, time.July, 2), day(2024, time.June, 1), -1},
+	}
+
+	for _, tt := range tests {
+		if months := monthsUntil(tt.now, tt.target); months != tt.expected {
+			t.Errorf("expected %d months from %v to %v; got %d", tt.expected, tt.now, tt.target, months)
+		}
+	}
+}
+
+func TestGoalProgress(t *testing.T) {
+	created := day(2024, time.January, 1)
+	target := day(2025, time.January, 1)
+	goal := types.Goal{Name: "Holidays", TargetAmount: money(1200), TargetDate: &target, CreatedAt: created}
+	// Half of the time to the target date is elapsed
+	now := day(2024, time.July, 2)
+
+	progress := goalProgress(goal, money(600), "EUR", now)
+	if progress.Remaining != money(600) || progress.Percentage != 50 {
+		t.Errorf("unexpected progress %+v", progress)
+	}
+	if progress.RequiredMonthly == nil || *progress.RequiredMonthly != money(100) {
+		t.Errorf("expected 100 a month over the 6 months left; got %v", progress.RequiredMonthly)
+	}
+	if progress.Behind {
+		t.Errorf("expected the goal to be on track with half of the target saved")
+	}
+
+	progress = goalProgress(goal, money(300), "EUR", now)
+	if !progress.Behind {
+		t.Errorf("expected the goal to be behind with a quarter of the target saved")
+	}
+
+	// Past the target date, the whole remaining amount is due
+	progress = goalProgress(goal, money(1000), "EUR", day(2025, time.February, 1))
+	if *progress.RequiredMonthly != money(200) || !progress.Behind {
+		t.Errorf("expected 200 due now and the goal behind; got %+v", progress)
+	}
+
+	progress = goalProgress(goal, money(1500), "EUR", now)
+	if progress.Remaining != money(0) || progress.Percentage != 125 || *progress.RequiredMonthly != money(0) || progress.Behind {
+		t.Errorf("expected a reached goal; got %+v", progress)
+	}
+
+	goal.TargetDate = nil
+	progress = goalProgress(goal, money(300), "EUR", now)
+	if progress.RequiredMonthly != nil || progress.Behind {
+		t.Errorf("expected no pace without a target date; got %+v", progress)
+	}
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"context"
+
+	"FinMa/internal/config"
+	"FinMa/internal/database"
+	"FinMa/internal/i18n"
+	"FinMa/internal/mail"
+	"FinMa/types"
+	"FinMa/utils"
+)
+
+// Handler serves the authentication routes: the sign up, the login, the
+// refresh of the tokens and the password reset. It holds its dependencies
+// instead of reaching them through the server, so that it is built with
+// fakes in the tests and two handlers with different secrets coexist.
+type Handler struct {
+	db   database.Service
+	auth config.Auth
+	// tokens signs the tokens with the secrets of auth
+	tokens utils.Tokens
+	// mailer sends the emails the handlers write themselves, the
+	// notifications go through notifier
+	mailer mail.Mailer
+	// notifier delivers the notifications on the channels the user enabled
+	notifier Notifier
+	// secureCookies marks the session cookies Secure, when the server
+	// terminates TLS
+	secureCookies bool
+}
+
+// NewHandler returns the handler of the authentication routes.
+func NewHandler(db database.Service, cfg config.Auth, mailer mail.Mailer, notifier Notifier) *Handler {
+	return &Handler{
+		db:   db,
+		auth: cfg,
+		tokens: utils.Tokens{
+			AccessSecret:  cfg.AccessTokenSecret,
+			RefreshSecret: cfg.RefreshTokenSecret,
+		},
+		mailer:   mailer,
+		notifier: notifier,
+	}
+}
+
+// notify writes the notification of the event in the language of the user
+// and hands it to the notifier.
+func (h *Handler) notify(ctx context.Context, user types.User, event string, payload NotificationPayload) error {
+	notification, err := newNotification(i18n.For(user.Locale, user.BaseCurrency), user.ID, event, payload)
+	if err != nil {
+		return err
+	}
+	return h.notifier.Send(ctx, user, notification)
+}
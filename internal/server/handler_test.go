@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/internal/config"
+	"FinMa/types"
+	"FinMa/utils"
+)
+
+// deviceDB knows a single user and sees every device for the first time.
+// It keeps the users signed up.
+type deviceDB struct {
+	authDB
+	created []types.User
+}
+
+func (db *deviceDB) RecordKnownDevice(*types.KnownDevice) (bool, error) {
+	return true, nil
+}
+
+func (db *deviceDB) CreateUser(user types.User) error {
+	db.created = append(db.created, user)
+	return nil
+}
+
+// recordingNotifier keeps the notifications sent.
+type recordingNotifier struct {
+	sent []*types.Notification
+}
+
+func (n *recordingNotifier) Send(ctx context.Context, user types.User, notification *types.Notification) error {
+	n.sent = append(n.sent, notification)
+	return nil
+}
+
+// newTestHandler returns a handler with its fakes, the tokens signed with
+// the secret and returned in the body, and an app serving its routes.
+func newTestHandler(t *testing.T, secret string) (*Handler, *fiber.App, *deviceDB, *recordingNotifier) {
+	hashed, err := utils.HashPassword("Correct-horse-1")
+	if err != nil {
+		t.Fatalf("error hashing the password. Err: %v", err)
+	}
+	db := &deviceDB{authDB: authDB{user: types.User{ID: uuid.New(), Email: "ada@example.com", Password: hashed, Role: "user", Locale: "fr"}}}
+	notifier := &recordingNotifier{}
+	h := NewHandler(db, config.Auth{AccessTokenSecret: secret + "-access", RefreshTokenSecret: secret + "-refresh"}, nil, notifier)
+
+	app := fiber.New(fiber.Config{ErrorHandler: errorHandler})
+	app.Post("/signup", h.SignUp)
+	app.Post("/login", h.Login)
+	app.Post("/refresh", h.Refresh)
+	return h, app, db, notifier
+}
+
+func post(t *testing.T, app *fiber.App, path, body string) (*http.Response, map[string]string) {
+	req, err := http.NewRequest("POST", path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("error creating request. Err: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+	var fields map[string]string
+	json.NewDecoder(resp.Body).Decode(&fields)
+	return resp, fields
+}
+
+func TestHandlerLoginNotifiesNewDevice(t *testing.T) {
+	_, app, _, notifier := newTestHandler(t, "first")
+
+	resp, _ := post(t, app, "/login", `{"email":"ada@example.com","password":"Correct-horse-1"}`)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("expected status 200; got %d", resp.StatusCode)
+	}
+	if len(notifier.sent) != 1 || notifier.sent[0].Type != "new_device_login" {
+		t.Fatalf("expected the new device notified; got %+v", notifier.sent)
+	}
+	if !strings.HasPrefix(notifier.sent[0].Message, "Nouvelle connexion") {
+		t.Errorf("expected the message in the language of the user; got %q", notifier.sent[0].Message)
+	}
+}
+
+func TestHandlersWithDifferentSecrets(t *testing.T) {
+	first, firstApp, _, _ := newTestHandler(t, "first")
+	second, secondApp, _, _ := newTestHandler(t, "second")
+
+	_, tokens := post(t, firstApp, "/login", `{"email":"ada@example.com","password":"Correct-horse-1"}`)
+	if _, err := first.tokens.VerifyAccessToken(tokens["access_token"]); err != nil {
+		t.Errorf("expected the token accepted by its handler; got %v", err)
+	}
+	if _, err := second.tokens.VerifyAccessToken(tokens["access_token"]); err == nil {
+		t.Errorf("expected the token refused by the other handler")
+	}
+	if resp, _ := post(t, secondApp, "/refresh", `{"refresh_token":"`+tokens["refresh_token"]+`"}`); resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("expected the refresh token refused by the other handler; got %d", resp.StatusCode)
+	}
+}
+
+func TestHandlerSignUp(t *testing.T) {
+	_, app, db, _ := newTestHandler(t, "first")
+
+	resp, _ := post(t, app, "/signup", `{"email":"grace@example.com","password":"Correct-horse-1","first_name":"Grace","last_name":"Hopper"}`)
+	if resp.StatusCode != fiber.StatusOK || len(db.created) != 1 {
+		t.Fatalf("expected the user created; got %d %+v", resp.StatusCode, db.created)
+	}
+	if created := db.created[0]; created.Role != "user" || created.Password == "Correct-horse-1" {
+		t.Errorf("expected a user with a hashed password; got %+v", created)
+	}
+
+	if resp, _ := post(t, app, "/signup", `{"email":"ada@example.com","password":"Correct-horse-1","first_name":"Ada","last_name":"Lovelace"}`); resp.StatusCode != fiber.StatusConflict {
+		t.Errorf("expected a taken email refused; got %d", resp.StatusCode)
+	}
+}
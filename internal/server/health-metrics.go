@@ -0,0 +1,170 @@
+package server
+
+import (
+	"FinMa/internal/database"
+	"FinMa/types"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+)
+
+// healthMetricsDefaultMonths is the number of months of the health metrics,
+// the current one included.
+const healthMetricsDefaultMonths = 3
+
+// healthTotals accumulates the spending of the days of a period, in unbound
+// minor units.
+type healthTotals struct {
+	days, noSpendDays                int
+	income, essential, discretionary int64
+}
+
+// add counts the day, without spending when it has no expenses.
+func (t *healthTotals) add(day types.DailySpending) {
+	t.days++
+	t.income += day.Income.Unbound().Minor
+	t.essential += day.Essential.Unbound().Minor
+	t.discretionary += day.Discretionary.Unbound().Minor
+	if day.Essential.IsZero() && day.Discretionary.IsZero() {
+		t.noSpendDays++
+	}
+}
+
+// metrics returns the health metrics of the totals, the rates rounded and
+// the average daily spend rounded to the minor unit of the currency.
+func (t healthTotals) metrics(currency string) types.HealthMetrics {
+	round := func(value float64) float64 {
+		return math.Round(value*100) / 100
+	}
+	expenses := t.essential + t.discretionary
+	metrics := types.HealthMetrics{
+		Days:          t.days,
+		Income:        types.NewMoney(t.income, ""),
+		Expenses:      types.NewMoney(expenses, ""),
+		NoIncome:      t.income <= 0,
+		Essential:     types.NewMoney(t.essential, ""),
+		Discretionary: types.NewMoney(t.discretionary, ""),
+		NoSpendDays:   t.noSpendDays,
+	}
+	if !metrics.NoIncome {
+		rate := round(float64(t.income-expenses) / float64(t.income) * 100)
+		metrics.SavingsRate = &rate
+	}
+	if expenses > 0 {
+		share := round(float64(t.essential) / float64(expenses) * 100)
+		metrics.EssentialShare = &share
+	}
+	if t.days > 0 {
+		metrics.AverageDailySpend = metrics.Expenses.Mul(1 / float64(t.days)).Round(currency)
+	}
+	return metrics
+}
+
+// pointsChange returns the change of a rate in percentage points, nil when
+// either rate is.
+func pointsChange(previous, current *float64) *float64 {
+	if previous == nil || current == nil {
+		return nil
+	}
+	change := math.Round((*current-*previous)*100) / 100
+	return &change
+}
+
+// healthMetricsChange returns the change of the metrics from previous to
+// current.
+func healthMetricsChange(previous, current types.HealthMetrics) *types.HealthMetricsChange {
+	return &types.HealthMetricsChange{
+		SavingsRate:       pointsChange(previous.SavingsRate, current.SavingsRate),
+		EssentialShare:    pointsChange(previous.EssentialShare, current.EssentialShare),
+		Essential:         types.NewMoney(current.Essential.Minor-previous.Essential.Minor, ""),
+		Discretionary:     types.NewMoney(current.Discretionary.Minor-previous.Discretionary.Minor, ""),
+		AverageDailySpend: types.NewMoney(current.AverageDailySpend.Minor-previous.AverageDailySpend.Minor, ""),
+		NoSpendDays:       current.NoSpendDays - previous.NoSpendDays,
+	}
+}
+
+// buildHealthMetrics sets the summary and the months of the report from the
+// daily spending of its range, From to To excluded, both local midnights.
+// Every day of the range counts, the ones without transactions as days
+// without spending.
+func buildHealthMetrics(report *types.HealthMetricsReport, days []types.DailySpending) {
+	byDay := make(map[string]types.DailySpending, len(days))
+	for _, day := range days {
+		byDay[day.Day.Format(time.DateOnly)] = day
+	}
+
+	var summary healthTotals
+	report.Monthly = []types.HealthMonth{}
+	for month := report.From; month.Before(report.To); month = month.AddDate(0, 1, 0) {
+		var totals healthTotals
+		for day := month; day.Before(report.To) && day.Before(month.AddDate(0, 1, 0)); day = day.AddDate(0, 0, 1) {
+			spending := byDay[day.Format(time.DateOnly)]
+			totals.add(spending)
+			summary.add(spending)
+		}
+
+		current := types.HealthMonth{Month: month, HealthMetrics: totals.metrics(report.Currency)}
+		if previous := len(report.Monthly) - 1; previous >= 0 {
+			current.Change = healthMetricsChange(report.Monthly[previous].HealthMetrics, current.HealthMetrics)
+		}
+		report.Monthly = append(report.Monthly, current)
+	}
+	report.Summary = summary.metrics(report.Currency)
+}
+
+// healthMetrics computes the health metrics of the user over the months
+// ending with the current one, counted up to today included.
+func (s *FiberServer) healthMetrics(db database.Service, user types.User, months int, now time.Time) (types.HealthMetricsReport, error) {
+	location := userLocation(user)
+	local := now.In(location)
+	report := types.HealthMetricsReport{
+		Months:   months,
+		From:     monthStart(now, location).AddDate(0, 1-months, 0),
+		To:       time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, location),
+		Timezone: userTimezone(user),
+		Currency: s.baseCurrency(user),
+	}
+
+	days, err := db.GetDailySpending(&user, report.From, report.To, report.Timezone)
+	if err != nil {
+		return report, err
+	}
+	buildHealthMetrics(&report, days)
+	return report, nil
+}
+
+// GetHealthMetrics returns the financial health metrics of the user over the
+// last ?months=3 (24 at most), the current one up to today included, and
+// month by month with their change since the previous month: the savings
+// rate, null with no_income set without income, the split of the expenses
+// between the essential categories and the others, the average daily spend
+// and the days without spending, in the user's timezone. The transfers and
+// the transactions excluded from the budgets are left out. The CSV holds a
+// row per month.
+func (s *FiberServer) GetHealthMetrics(c *fiber.Ctx) error {
+	db := s.dbFor(c)
+
+	user := c.Locals("user").(types.User)
+
+	months := c.QueryInt("months", healthMetricsDefaultMonths)
+	if months <= 0 || months > 24 {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "months must be between 1 and 24")
+	}
+
+	now := time.Now()
+	// The current month moves with the day
+	key := []string{strconv.Itoa(months), now.In(userLocation(user)).Format(time.DateOnly)}
+	return cachedReport(s, c, "health_metrics", key, func() (types.HealthMetricsReport, error) {
+		report, err := s.healthMetrics(db, user, months, now)
+		if err != nil {
+			log.Error(err)
+			return report, NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not compute the health metrics")
+		}
+		return report, nil
+	}, func(report types.HealthMetricsReport) any {
+		return report.Monthly
+	})
+}
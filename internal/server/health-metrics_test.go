@@ -0,0 +1,54 @@
+package server
+
+import (
+	"FinMa/types"
+	"testing"
+	"time"
+)
+
+func TestBuildHealthMetrics(t *testing.T) {
+	location, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Dated as the database buckets them, the local date at midnight
+	day := func(month time.Month, day int) time.Time {
+		return time.Date(2024, month, day, 0, 0, 0, 0, time.UTC)
+	}
+	days := []types.DailySpending{
+		{Day: day(time.February, 1), Income: money(2000), Essential: money(900)},
+		{Day: day(time.February, 10), Essential: money(100), Discretionary: money(500)},
+		// No income in March
+		{Day: day(time.March, 5), Essential: money(300), Discretionary: money(100)},
+	}
+
+	// February and March up to the 10th
+	report := types.HealthMetricsReport{
+		From:     time.Date(2024, time.February, 1, 0, 0, 0, 0, location),
+		To:       time.Date(2024, time.March, 11, 0, 0, 0, 0, location),
+		Currency: "EUR",
+	}
+	buildHealthMetrics(&report, days)
+
+	if len(report.Monthly) != 2 {
+		t.Fatalf("expected February and March; got %+v", report.Monthly)
+	}
+	february, march := report.Monthly[0], report.Monthly[1]
+	if february.Days != 29 || february.Expenses != money(1500) || *february.SavingsRate != 25 || *february.EssentialShare != 66.67 || february.NoSpendDays != 27 || february.AverageDailySpend != money(51.72) {
+		t.Errorf("expected the metrics of February; got %+v", february.HealthMetrics)
+	}
+	if february.Change != nil {
+		t.Errorf("expected no change for the first month; got %+v", february.Change)
+	}
+
+	if march.Days != 10 || march.SavingsRate != nil || !march.NoIncome || march.NoSpendDays != 9 || march.AverageDailySpend != money(40) {
+		t.Errorf("expected March without income; got %+v", march.HealthMetrics)
+	}
+	if change := march.Change; change == nil || change.SavingsRate != nil || *change.EssentialShare != 8.33 || change.Discretionary != money(-400) || change.AverageDailySpend != money(-11.72) || change.NoSpendDays != -18 {
+		t.Errorf("expected the change since February; got %+v", change)
+	}
+
+	if summary := report.Summary; summary.Days != 39 || summary.Income != money(2000) || summary.Expenses != money(1900) || *summary.SavingsRate != 5 || summary.NoSpendDays != 36 {
+		t.Errorf("expected the metrics over the range; got %+v", summary)
+	}
+}
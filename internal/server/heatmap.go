@@ -0,0 +1,142 @@
+package server
+
+import (
+	"FinMa/types"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+)
+
+// quantile returns the q quantile of the sorted values, interpolated
+// between the closest ranks.
+func quantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	position := q * float64(len(sorted)-1)
+	lower := int(math.Floor(position))
+	if lower+1 >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[lower] + (sorted[lower+1]-sorted[lower])*(position-float64(lower))
+}
+
+// heatmapLevel returns the intensity of a day: 0 without spending, else 1
+// plus the number of thresholds it is above.
+func heatmapLevel(total types.Money, thresholds []types.Money) int {
+	if total.Sign() <= 0 {
+		return 0
+	}
+	level := 1
+	for _, threshold := range thresholds {
+		if total.Unbound().Minor > threshold.Unbound().Minor {
+			level++
+		}
+	}
+	return level
+}
+
+// buildHeatmap sets the days of the heatmap from the daily totals, a day per
+// date from from to to excluded, local midnights, the days without expenses
+// at zero. The thresholds are the quartiles of the days with spending, so
+// that one large purchase does not flatten the other days. They are rounded
+// to the minor unit of the currency of the heatmap.
+func buildHeatmap(heatmap *types.Heatmap, totals []types.DayTotal, from, to time.Time) {
+	byDay := make(map[string]types.DayTotal, len(totals))
+	spent := make([]float64, 0, len(totals))
+	for _, total := range totals {
+		byDay[total.Day.Format(time.DateOnly)] = total
+		if total.Total.Sign() > 0 {
+			spent = append(spent, total.Total.Float64())
+		}
+	}
+
+	sort.Float64s(spent)
+	heatmap.Thresholds = []types.Money{}
+	if len(spent) > 0 {
+		for _, q := range []float64{0.25, 0.5, 0.75} {
+			heatmap.Thresholds = append(heatmap.Thresholds, types.MoneyFromFloat(quantile(spent, q), "").Round(heatmap.Currency))
+		}
+	}
+
+	var sum int64
+	heatmap.Days = []types.HeatmapDay{}
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		total := byDay[day.Format(time.DateOnly)]
+		amount := total.Total.Unbound()
+		heatmap.Days = append(heatmap.Days, types.HeatmapDay{
+			Date:  day,
+			Total: amount,
+			Count: total.Count,
+			Level: heatmapLevel(amount, heatmap.Thresholds),
+		})
+		sum += amount.Minor
+	}
+	heatmap.Total = types.NewMoney(sum, "")
+}
+
+// GetHeatmap returns the expenses of the user on each day of ?year= (the
+// current one by default) in their timezone, with their count and their
+// intensity from 0 to 4, and the thresholds of the intensities. The current
+// year stops at today. ?category= and ?account_ids=id,id restrict it. The
+// transfers and the expenses excluded from the budgets are left out. The
+// CSV holds the days.
+func (s *FiberServer) GetHeatmap(c *fiber.Ctx) error {
+	db := s.dbFor(c)
+
+	user := c.Locals("user").(types.User)
+	location := userLocation(user)
+	now := time.Now().In(location)
+
+	year := now.Year()
+	if value := c.Query("year"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1970 || parsed > now.Year() {
+			return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "year must be a year up to the current one").
+				WithDetails(FieldError{Field: "year", Message: "invalid year", Value: value})
+		}
+		year = parsed
+	}
+	var filter types.ReportFilter
+	filter.Category = c.Query("category")
+	if filter.Category != "" && !isValidCategory(filter.Category) {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid transaction category").
+			WithDetails(FieldError{Field: "category", Message: "unknown category", Value: filter.Category})
+	}
+	var err error
+	if filter.AccountIDs, err = s.parseReportAccounts(c, user); err != nil {
+		return err
+	}
+
+	from := time.Date(year, time.January, 1, 0, 0, 0, 0, location)
+	to := from.AddDate(1, 0, 0)
+	partial := year == now.Year()
+	if partial {
+		to = time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, location)
+	}
+
+	// The current year moves with the day
+	key := []string{strconv.Itoa(year), filter.Category, c.Query("account_ids"), to.Format(time.DateOnly)}
+	return cachedReport(s, c, "heatmap", key, func() (types.Heatmap, error) {
+		heatmap := types.Heatmap{
+			Year:     year,
+			Timezone: userTimezone(user),
+			Currency: s.baseCurrency(user),
+			Category: filter.Category,
+			Partial:  partial,
+		}
+		totals, err := db.GetDailyExpenses(&user, from, to, heatmap.Timezone, filter)
+		if err != nil {
+			log.Error(err)
+			return heatmap, NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not compute the heatmap")
+		}
+		buildHeatmap(&heatmap, totals, from, to)
+		return heatmap, nil
+	}, func(heatmap types.Heatmap) any {
+		return heatmap.Days
+	})
+}
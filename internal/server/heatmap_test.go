@@ -0,0 +1,58 @@
+package server
+
+import (
+	"FinMa/types"
+	"testing"
+	"time"
+)
+
+func TestBuildHeatmap(t *testing.T) {
+	location, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Dated as the database buckets them, the local date at midnight
+	day := func(month time.Month, day int) time.Time {
+		return time.Date(2024, month, day, 0, 0, 0, 0, time.UTC)
+	}
+	totals := []types.DayTotal{
+		{Day: day(time.January, 2), Total: money(10), Count: 1},
+		{Day: day(time.January, 3), Total: money(20), Count: 2},
+		{Day: day(time.March, 31), Total: money(30), Count: 1}, // The day of the DST change
+		{Day: day(time.June, 15), Total: money(40), Count: 3},
+		{Day: day(time.December, 31), Total: money(5000), Count: 1}, // A car
+	}
+
+	heatmap := types.Heatmap{}
+	from := time.Date(2024, time.January, 1, 0, 0, 0, 0, location)
+	buildHeatmap(&heatmap, totals, from, from.AddDate(1, 0, 0))
+
+	if len(heatmap.Days) != 366 {
+		t.Fatalf("expected a day per day of the leap year; got %d", len(heatmap.Days))
+	}
+	if thresholds := heatmap.Thresholds; len(thresholds) != 3 || thresholds[0] != money(20) || thresholds[1] != money(30) || thresholds[2] != money(40) {
+		t.Errorf("expected the quartiles of the days with spending; got %v", thresholds)
+	}
+	for date, level := range map[time.Time]int{
+		time.Date(2024, time.January, 1, 0, 0, 0, 0, location):   0,
+		time.Date(2024, time.January, 2, 0, 0, 0, 0, location):   1,
+		time.Date(2024, time.March, 31, 0, 0, 0, 0, location):    2,
+		time.Date(2024, time.June, 15, 0, 0, 0, 0, location):     3,
+		time.Date(2024, time.December, 31, 0, 0, 0, 0, location): 4,
+	} {
+		index := date.YearDay() - 1
+		if found := heatmap.Days[index]; !found.Date.Equal(date) || found.Level != level {
+			t.Errorf("expected the level %d on %v; got %+v", level, date, found)
+		}
+	}
+	if heatmap.Total != money(5100) {
+		t.Errorf("expected a total of 5100; got %v", heatmap.Total)
+	}
+
+	// Without spending every day is at 0
+	heatmap = types.Heatmap{}
+	buildHeatmap(&heatmap, nil, from, from.AddDate(0, 0, 10))
+	if len(heatmap.Days) != 10 || len(heatmap.Thresholds) != 0 || heatmap.Days[9].Level != 0 {
+		t.Errorf("expected 10 empty days; got %+v", heatmap)
+	}
+}
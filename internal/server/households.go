@@ -0,0 +1,270 @@
+package server
+
+import (
+	"FinMa/types"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// householdRole returns the role of the user in the household, "" when the
+// user is not an active member.
+func householdRole(household types.Household, userID uuid.UUID) string {
+	for _, member := range household.Members {
+		if member.UserID != nil && *member.UserID == userID && member.Status == "active" {
+			return member.Role
+		}
+	}
+	return ""
+}
+
+// CreateHousehold creates a household owned by the authenticated user.
+// A user belongs to one household at most.
+func (s *FiberServer) CreateHousehold(c *fiber.Ctx) error {
+	type CreateHouseholdRequest struct {
+		Name string `json:"name"`
+	}
+
+	var body CreateHouseholdRequest
+	if err := c.BodyParser(&body); err != nil || strings.TrimSpace(body.Name) == "" {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Household name is required")
+	}
+
+	user := c.Locals("user").(types.User)
+	if existing := s.db.GetUserHousehold(user.ID); existing.ID != uuid.Nil {
+		return NewAPIError(fiber.StatusConflict, CodeAlreadyMember, "You already belong to a household")
+	}
+
+	household := &types.Household{
+		ID:      uuid.New(),
+		Name:    strings.TrimSpace(body.Name),
+		OwnerID: user.ID,
+	}
+	household.Members = []types.HouseholdMember{{
+		ID:          uuid.New(),
+		Email:       strings.ToLower(user.Email),
+		Role:        "owner",
+		Status:      "active",
+		HouseholdID: household.ID,
+		UserID:      &user.ID,
+		InvitedByID: user.ID,
+	}}
+
+	if err := s.db.CreateHousehold(household); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not create household")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(household)
+}
+
+// GetHousehold returns the household of the authenticated user with its
+// members and pending invites.
+func (s *FiberServer) GetHousehold(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	household := s.db.GetUserHousehold(user.ID)
+
+	if household.ID == uuid.Nil {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Household not found")
+	}
+
+	return c.JSON(household)
+}
+
+// InviteHouseholdMember invites a user by email to the household. Only the
+// owner can manage members.
+func (s *FiberServer) InviteHouseholdMember(c *fiber.Ctx) error {
+	type InviteHouseholdMemberRequest struct {
+		Email string `json:"email" validate:"required,email"`
+	}
+
+	var body InviteHouseholdMemberRequest
+	if err := c.BodyParser(&body); err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+
+	if err := validate.Struct(body); err != nil {
+		return err
+	}
+
+	user := c.Locals("user").(types.User)
+	household := s.db.GetUserHousehold(user.ID)
+	if household.ID == uuid.Nil || householdRole(household, user.ID) != "owner" {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Household not found")
+	}
+
+	email := strings.ToLower(strings.TrimSpace(body.Email))
+	for _, member := range household.Members {
+		if member.Email == email {
+			return NewAPIError(fiber.StatusConflict, CodeAlreadyInvited, "This user is already invited")
+		}
+	}
+
+	member := &types.HouseholdMember{
+		ID:          uuid.New(),
+		Email:       email,
+		Role:        "member",
+		Status:      "pending",
+		HouseholdID: household.ID,
+		InvitedByID: user.ID,
+	}
+
+	if err := s.db.CreateHouseholdMember(member); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not invite member")
+	}
+
+	s.audit(user.ID, "household.member_invited", "household", household.ID, fmt.Sprintf("%s invited", email))
+
+	return c.Status(fiber.StatusCreated).JSON(member)
+}
+
+// GetHouseholdInvites lists the pending household invites sent to the
+// authenticated user.
+func (s *FiberServer) GetHouseholdInvites(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	return c.JSON(s.db.GetPendingHouseholdInvites(strings.ToLower(user.Email)))
+}
+
+// AcceptHouseholdInvite accepts a pending household invite sent to the
+// authenticated user, who must not belong to another household.
+func (s *FiberServer) AcceptHouseholdInvite(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	member := s.db.GetHouseholdMemberByID(c.Params("id"))
+
+	if member.ID == uuid.Nil || member.Status != "pending" || member.Email != strings.ToLower(user.Email) {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Invite not found")
+	}
+
+	if existing := s.db.GetUserHousehold(user.ID); existing.ID != uuid.Nil {
+		return NewAPIError(fiber.StatusConflict, CodeAlreadyMember, "You already belong to a household")
+	}
+
+	if err := s.db.AcceptHouseholdInvite(&member, &user); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not accept invite")
+	}
+
+	return c.JSON(member)
+}
+
+// RemoveHouseholdMember removes a member or a pending invite from the
+// household. The owner can remove anyone but themselves, members can leave.
+// The accounts and budgets the member shared leave the household view but
+// are not deleted.
+func (s *FiberServer) RemoveHouseholdMember(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	household := s.db.GetUserHousehold(user.ID)
+	if household.ID == uuid.Nil {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Household not found")
+	}
+
+	member := s.db.GetHouseholdMemberByID(c.Params("memberId"))
+	if member.ID == uuid.Nil || member.HouseholdID != household.ID {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Member not found")
+	}
+
+	self := member.UserID != nil && *member.UserID == user.ID
+	if !self && householdRole(household, user.ID) != "owner" {
+		return NewAPIError(fiber.StatusForbidden, CodeForbidden, "Only the owner can remove members")
+	}
+	if member.Role == "owner" {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "The owner cannot leave the household")
+	}
+
+	if err := s.db.RemoveHouseholdMember(&member); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not remove member")
+	}
+
+	s.audit(user.ID, "household.member_removed", "household", household.ID, fmt.Sprintf("%s removed", member.Email))
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// SetHouseholdView switches the data the user sees between their own data
+// ("mine") and the data shared in their household ("household").
+func (s *FiberServer) SetHouseholdView(c *fiber.Ctx) error {
+	type SetHouseholdViewRequest struct {
+		View string `json:"view"`
+	}
+
+	var body SetHouseholdViewRequest
+	if err := c.BodyParser(&body); err != nil || (body.View != "mine" && body.View != "household") {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, `View must be "mine" or "household"`)
+	}
+
+	user := c.Locals("user").(types.User)
+	user.HouseholdView = body.View
+	if err := s.db.UpdateHouseholdView(&user); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not update household view")
+	}
+
+	return c.JSON(fiber.Map{"view": user.HouseholdView})
+}
+
+// householdToShare returns the household to share a resource with when
+// sharing (PUT), or nil when unsharing (DELETE).
+func (s *FiberServer) householdToShare(c *fiber.Ctx, user types.User) (*uuid.UUID, bool) {
+	if c.Method() == fiber.MethodDelete {
+		return nil, true
+	}
+
+	household := s.db.GetUserHousehold(user.ID)
+	if household.ID == uuid.Nil {
+		return nil, false
+	}
+	return &household.ID, true
+}
+
+// ShareBankAccountWithHousehold shares an account the user owns with their
+// household (PUT), or stops sharing it (DELETE). Household members get the
+// editor role on it.
+func (s *FiberServer) ShareBankAccountWithHousehold(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	account, ok := s.findUserBankAccount(user, c.Params("id"), "owner")
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Bank account not found")
+	}
+
+	householdID, ok := s.householdToShare(c, user)
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Household not found")
+	}
+
+	account.HouseholdID = householdID
+	if err := s.db.SetBankAccountHousehold(&account); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not update bank account")
+	}
+
+	return c.JSON(account)
+}
+
+// ShareBudgetWithHousehold shares a budget the user owns with their household
+// (PUT), or stops sharing it (DELETE). A shared budget counts the expenses of
+// every member.
+func (s *FiberServer) ShareBudgetWithHousehold(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	budget, ok := s.findUserBudget(user, c.Params("id"), true)
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Budget not found")
+	}
+
+	householdID, ok := s.householdToShare(c, user)
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Household not found")
+	}
+
+	budget.HouseholdID = householdID
+	if err := s.db.SetBudgetHousehold(&budget); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not update budget")
+	}
+
+	return c.JSON(budget)
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"FinMa/types"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestHouseholdRole(t *testing.T) {
+	owner, member, invited := uuid.New(), uuid.New(), uuid.New()
+	household := types.Household{Members: []types.HouseholdMember{
+		{UserID: &owner, Role: "owner", Status: "active"},
+		{UserID: &member, Role: "member", Status: "active"},
+		{UserID: &invited, Role: "member", Status: "pending"},
+	}}
+
+	tests := []struct {
+		name     string
+		userID   uuid.UUID
+		expected string
+	}{
+		{"owner", owner, "owner"},
+		{"member", member, "member"},
+		{"pending invite", invited, ""},
+		{"stranger", uuid.New(), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if role := householdRole(household, tt.userID); role != tt.expected {
+				t.Errorf("expected %q; got %q", tt.expected, role)
+			}
+		})
+	}
+}
@@ -0,0 +1,400 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/constants"
+	"FinMa/internal/importers"
+	"FinMa/types"
+)
+
+// ImportMint imports the transactions.csv export of Mint, see importExport.
+func (s *FiberServer) ImportMint(c *fiber.Ctx) error {
+	return s.importExport(c, func(file multipart.File, size int64) (*importers.Export, error) {
+		return importers.ParseMint(file)
+	})
+}
+
+// ImportYNAB imports the zip export of a YNAB budget, or its register or
+// plan CSV alone, see importExport. The plan creates a monthly budget per
+// category from the amounts assigned the last month.
+func (s *FiberServer) ImportYNAB(c *fiber.Ctx) error {
+	return s.importExport(c, func(file multipart.File, size int64) (*importers.Export, error) {
+		return importers.ParseYNAB(file, size)
+	})
+}
+
+// importExport imports the export of the "file" field of the multipart
+// form. The accounts are matched by name to the accounts of the user, the
+// others created; the categories of the app are mapped onto the categories
+// of FinMa. The rows imported before are skipped, so that an export can be
+// imported again, and the rows that cannot be imported are listed in the
+// summary. With ?dry_run=true nothing is written. With
+// ?initial_balance=true the opening balance of an account in the export
+// sets its initial balance, when the account has no transactions before the
+// import, instead of being imported as a transaction.
+func (s *FiberServer) importExport(c *fiber.Ctx, parse func(multipart.File, int64) (*importers.Export, error)) error {
+	header, err := c.FormFile("file")
+	if err != nil {
+		return NewAPIError(fiber.StatusUnprocessableEntity, CodeValidationFailed, "Invalid export").
+			WithDetails(FieldError{Field: "file", Message: "Required"})
+	}
+	file, err := header.Open()
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Could not read the export")
+	}
+	defer file.Close()
+
+	export, err := parse(file, header.Size)
+	if errors.Is(err, importers.ErrInvalidExport) {
+		return NewAPIError(fiber.StatusUnprocessableEntity, CodeValidationFailed, "Invalid export").
+			WithDetails(FieldError{Field: "file", Message: err.Error()})
+	}
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Could not read the export")
+	}
+
+	user := c.Locals("user").(types.User)
+	options := importOptions{dryRun: c.QueryBool("dry_run"), initialBalances: c.QueryBool("initial_balance")}
+	if !options.dryRun {
+		if err := s.checkImportLimits(c, user, export, options); err != nil {
+			return err
+		}
+	}
+	summary, err := s.runImport(user, export, options)
+	if err != nil {
+		// The rows imported so far are skipped by the next import
+		log.Error("Error importing an export: ", err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not import the export, import it again to resume")
+	}
+
+	if options.dryRun {
+		return c.JSON(summary)
+	}
+	s.metrics.countImport(export.Source)
+	return c.Status(fiber.StatusCreated).JSON(summary)
+}
+
+// checkImportLimits refuses the import when the accounts and the
+// transactions it would create go past the limits of the plan of the user,
+// before anything is written. The import is run dry to count them.
+func (s *FiberServer) checkImportLimits(c *fiber.Ctx, user types.User, export *importers.Export, options importOptions) error {
+	if limits := s.planLimits(user); limits.Accounts == 0 && limits.MonthlyTransactions == 0 {
+		return nil
+	}
+	options.dryRun = true
+	summary, err := s.runImport(user, export, options)
+	if err != nil {
+		log.Error("Error importing an export: ", err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not import the export")
+	}
+	if err := s.checkLimit(c, user, limitAccounts, int64(summary.Accounts.Created)); err != nil {
+		return err
+	}
+	return s.checkLimit(c, user, limitMonthlyTransactions, int64(summary.Transactions.Created))
+}
+
+// importOptions are the query parameters of an import.
+type importOptions struct {
+	dryRun          bool
+	initialBalances bool // Set the initial balance of the accounts from their opening balance
+}
+
+// importRun maps an export onto the data of a user.
+type importRun struct {
+	s      *FiberServer
+	user   types.User
+	export *importers.Export
+	importOptions
+	summary types.ImportSummary
+
+	owned    []types.BankAccount
+	accounts map[string]*types.BankAccount // By name in the export
+	created  map[uuid.UUID]bool
+	empty    map[uuid.UUID]bool // Accounts without transactions before the import
+	excluded map[string]bool    // Categories excluded from the budgets by default
+
+	batchID      uuid.UUID   // Of the transactions created in the audit log
+	transactions []uuid.UUID // Created
+}
+
+func (s *FiberServer) runImport(user types.User, export *importers.Export, options importOptions) (types.ImportSummary, error) {
+	dryRun := options.dryRun
+	run := &importRun{
+		s:             s,
+		user:          user,
+		export:        export,
+		importOptions: options,
+		accounts:      map[string]*types.BankAccount{},
+		created:       map[uuid.UUID]bool{},
+		empty:         map[uuid.UUID]bool{},
+		batchID:       uuid.New(),
+		summary: types.ImportSummary{
+			DryRun:     dryRun,
+			Categories: map[string]string{},
+			Errors:     append([]types.ImportRowError{}, export.Errors...),
+		},
+	}
+	for _, account := range s.db.GetBankAccounts(&user, true) {
+		if account.UserID == user.ID {
+			run.owned = append(run.owned, account)
+		}
+	}
+
+	if !dryRun {
+		// The transactions created are recorded even when the import fails
+		defer func() {
+			s.auditBatch(run.batchID, user.ID, "transaction.created", "transaction", run.transactions, export.Source+" import")
+		}()
+	}
+
+	for _, transaction := range export.Transactions {
+		if err := run.importTransaction(transaction); err != nil {
+			return run.summary, err
+		}
+	}
+	if err := run.importBudgets(); err != nil {
+		return run.summary, err
+	}
+
+	if !dryRun {
+		// The import is its batch, listing its transactions
+		s.audit(user.ID, "import.completed", "import", run.batchID, fmt.Sprintf("%s import: %d transactions, %d accounts and %d budgets created",
+			export.Source, run.summary.Transactions.Created, run.summary.Accounts.Created, run.summary.Budgets.Created))
+	}
+	return run.summary, nil
+}
+
+// account returns the account of the user with the name, created when the
+// user has none.
+func (run *importRun) account(name string) (*types.BankAccount, error) {
+	if account, ok := run.accounts[name]; ok {
+		return account, nil
+	}
+	for i := range run.owned {
+		if strings.EqualFold(strings.TrimSpace(run.owned[i].BankName), name) {
+			run.accounts[name] = &run.owned[i]
+			run.summary.Accounts.Skipped++
+			if run.initialBalances {
+				run.empty[run.owned[i].ID] = !run.s.db.AccountHasTransactions(run.owned[i].ID)
+			}
+			return &run.owned[i], nil
+		}
+	}
+
+	accountType := importers.AccountType(name)
+	account := &types.BankAccount{
+		ID:            uuid.New(),
+		BankName:      name,
+		AccountType:   accountType,
+		AccountNumber: run.export.Source + "-" + uuid.NewString(),
+		Class:         accountClass(accountType),
+		Currency:      run.s.baseCurrency(run.user),
+		UserID:        run.user.ID,
+	}
+	if !run.dryRun {
+		if err := run.s.db.CreateBankAccount(account); err != nil {
+			return nil, err
+		}
+		run.s.audit(run.user.ID, "account.created", "bank_account", account.ID, account.BankName)
+	}
+	run.accounts[name] = account
+	run.created[account.ID] = true
+	run.empty[account.ID] = true
+	run.summary.Accounts.Created++
+	return account, nil
+}
+
+func (run *importRun) importTransaction(row importers.Transaction) error {
+	rowError := func(message string) {
+		run.summary.Errors = append(run.summary.Errors, types.ImportRowError{File: row.File, Line: row.Line, Message: message})
+	}
+
+	account, err := run.account(row.Account)
+	if err != nil {
+		return err
+	}
+	if account.ArchivedAt != nil {
+		rowError("the account " + account.BankName + " is archived")
+		return nil
+	}
+	if _, err := row.Amount.In(run.s.accountCurrency(*account)); err != nil {
+		rowError("the amount is finer than the minor unit of " + run.s.accountCurrency(*account))
+		return nil
+	}
+	if row.OpeningBalance && run.initialBalances {
+		if set, err := run.setInitialBalance(account, row.Amount.Unbound()); set || err != nil {
+			return err
+		}
+	}
+	beforeOpening := isBeforeOpening(*account, row.Date)
+	if beforeOpening && !run.s.config.Features.AllowTransactionsBeforeOpening {
+		rowError("the date is before the opening date of " + account.BankName)
+		return nil
+	}
+	if !run.created[account.ID] && run.s.db.ExternalTransactionExists(account.ID, row.ID) {
+		run.summary.Transactions.Skipped++
+		return nil
+	}
+
+	category := importers.Category(row.Category)
+	if row.Category != "" {
+		run.summary.Categories[row.Category] = category
+	}
+	transaction := &types.Transaction{
+		ID:            uuid.New(),
+		Category:      category,
+		Amount:        row.Amount.Unbound(),
+		Date:          row.Date,
+		Type:          "income",
+		Description:   row.Description(),
+		ExternalID:    row.ID,
+		Source:        "import",
+		BankAccountID: account.ID,
+		UserID:        run.user.ID,
+		BeforeOpening: beforeOpening,
+	}
+	if row.Amount.Sign() < 0 {
+		transaction.Type, transaction.Amount = "expense", transaction.Amount.Neg()
+	}
+	if row.TransferAccount != "" {
+		other, err := run.account(row.TransferAccount)
+		if err != nil {
+			return err
+		}
+		transaction.Type, transaction.TransferAccountID = "transfer", &other.ID
+	}
+	transaction.ExcludeFromBudgets = row.Transfer || run.excludedByDefault(category)
+
+	if row.Split {
+		run.summary.SplitRows++
+	}
+	run.summary.Transactions.Created++
+	if run.dryRun {
+		return nil
+	}
+	if err := run.s.db.CreateTransaction(transaction); err != nil {
+		return err
+	}
+	run.transactions = append(run.transactions, transaction.ID)
+	return nil
+}
+
+// setInitialBalance sets the opening balance of the export as the initial
+// balance of an account without transactions before the import, and
+// reports whether it did. Importing again, the opening balance already set
+// is skipped; the one of an account with transactions is imported as a
+// transaction.
+func (run *importRun) setInitialBalance(account *types.BankAccount, amount types.Money) (bool, error) {
+	if !run.empty[account.ID] {
+		if same, err := account.InitialBalance.Unbound().Cmp(amount); err == nil && same == 0 {
+			run.summary.Transactions.Skipped++
+			return true, nil
+		}
+		return false, nil
+	}
+	// A second opening balance of the account is a transaction
+	run.empty[account.ID] = false
+
+	previous := account.InitialBalance
+	account.InitialBalance = amount
+	run.summary.InitialBalances++
+	if run.dryRun {
+		return true, nil
+	}
+	if err := run.s.db.UpdateBankAccount(account); err != nil {
+		return false, err
+	}
+	drift, err := run.s.db.RecomputeBalance(account.ID)
+	if err != nil {
+		return false, err
+	}
+	account.Balance = drift.Computed
+	run.s.audit(run.user.ID, "account.initial_balance_changed", "bank_account", account.ID,
+		fmt.Sprintf("initial balance changed from %s to %s", previous, account.InitialBalance))
+	return true, nil
+}
+
+// excludedByDefault reports whether the user excludes the category from
+// the budgets by default.
+func (run *importRun) excludedByDefault(category string) bool {
+	if run.excluded == nil {
+		run.excluded = map[string]bool{}
+		for _, category := range constants.GetTransactionCategories() {
+			run.excluded[category] = run.s.db.IsCategoryExcludedByDefault(run.user.ID, category)
+		}
+	}
+	return run.excluded[category]
+}
+
+// importBudgets creates a monthly budget per category of FinMa, of the sum
+// of the amounts assigned to its categories of the app the last month of
+// the export. A category already covered by a monthly budget is skipped.
+func (run *importRun) importBudgets() error {
+	var last time.Time
+	for _, budget := range run.export.Budgets {
+		if budget.Month.After(last) {
+			last = budget.Month
+		}
+	}
+
+	amounts := map[string]types.Money{}
+	names := map[string][]string{}
+	for _, budget := range run.export.Budgets {
+		if !budget.Month.Equal(last) {
+			continue
+		}
+		category := importers.Category(budget.Category)
+		run.summary.Categories[budget.Category] = category
+		amounts[category] = types.NewMoney(amounts[category].Minor+budget.Amount.Unbound().Minor, "")
+		_, name, _ := strings.Cut(budget.Category, ": ")
+		names[category] = append(names[category], strings.TrimSpace(name))
+	}
+
+	categories := make([]string, 0, len(amounts))
+	for category := range amounts {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	thresholds, err := parseAlertThresholds(constants.GetBudgetAlertThresholds())
+	if err != nil {
+		return err
+	}
+	for _, category := range categories {
+		budget := &types.Budget{
+			ID:              uuid.New(),
+			Name:            strings.Join(names[category], ", "),
+			Categories:      []types.BudgetCategory{{Category: category}},
+			Amount:          amounts[category],
+			StartDate:       last,
+			PeriodType:      "monthly",
+			AlertThresholds: thresholds,
+			UserID:          run.user.ID,
+		}
+		budget.Categories[0].BudgetID = budget.ID
+		if _, ok := run.s.findOverlappingBudget(run.user, *budget); ok {
+			run.summary.Budgets.Skipped++
+			continue
+		}
+		run.summary.Budgets.Created++
+		if run.dryRun {
+			continue
+		}
+		if err := run.s.db.CreateBudget(budget); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/types"
+	"FinMa/utils"
+)
+
+// importsDB keeps the accounts, transactions and budgets created by the
+// imports.
+type importsDB struct {
+	*adminDB
+	accounts     []types.BankAccount
+	transactions []types.Transaction
+	budgets      []types.Budget
+}
+
+func (db *importsDB) GetBankAccounts(user *types.User, includeArchived bool) []types.BankAccount {
+	return db.accounts
+}
+
+func (db *importsDB) CreateBankAccount(account *types.BankAccount) error {
+	db.accounts = append(db.accounts, *account)
+	return nil
+}
+
+func (db *importsDB) UpdateBankAccount(account *types.BankAccount) error {
+	for i := range db.accounts {
+		if db.accounts[i].ID == account.ID {
+			db.accounts[i] = *account
+		}
+	}
+	return nil
+}
+
+func (db *importsDB) RecomputeBalance(accountID uuid.UUID) (types.BalanceDrift, error) {
+	return types.BalanceDrift{AccountID: accountID}, nil
+}
+
+func (db *importsDB) AccountHasTransactions(accountID uuid.UUID) bool {
+	for _, transaction := range db.transactions {
+		if transaction.BankAccountID == accountID {
+			return true
+		}
+	}
+	return false
+}
+
+func (db *importsDB) CreateTransaction(transaction *types.Transaction) error {
+	db.transactions = append(db.transactions, *transaction)
+	return nil
+}
+
+func (db *importsDB) ExternalTransactionExists(accountID uuid.UUID, externalID string) bool {
+	for _, transaction := range db.transactions {
+		if transaction.BankAccountID == accountID && transaction.ExternalID == externalID {
+			return true
+		}
+	}
+	return false
+}
+
+func (db *importsDB) IsCategoryExcludedByDefault(userID uuid.UUID, category string) bool {
+	return false
+}
+
+func (db *importsDB) GetBudgets(user *types.User) []types.Budget {
+	return db.budgets
+}
+
+func (db *importsDB) CreateBudget(budget *types.Budget) error {
+	db.budgets = append(db.budgets, *budget)
+	return nil
+}
+
+func newImportsTestServer(t *testing.T) (*FiberServer, *importsDB, types.User) {
+	s, admin, _, user := newAdminTestServer(t)
+	db := &importsDB{adminDB: admin}
+	s.db = db
+	return s, db, user
+}
+
+// importFile posts the file of the importers testdata to the import route.
+func importFile(t *testing.T, s *FiberServer, as types.User, path, name string) (*http.Response, types.ImportSummary) {
+	t.Helper()
+	data, err := os.ReadFile("../importers/testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	form.Close()
+
+	token, err := s.tokens.GenerateAccessToken(utils.Payload{UserID: as.ID, Email: as.Email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("POST", path, &body)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	resp, err := s.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var summary types.ImportSummary
+	json.NewDecoder(resp.Body).Decode(&summary)
+	return resp, summary
+}
+
+func TestImportMint(t *testing.T) {
+	s, db, user := newImportsTestServer(t)
+	checking := types.BankAccount{ID: uuid.New(), BankName: "Chase Checking", AccountType: "checking", Currency: "EUR", UserID: user.ID}
+	db.accounts = []types.BankAccount{checking}
+
+	resp, summary := importFile(t, s, user, "/api/v1/import/mint?dry_run=true", "mint-transactions.csv")
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("expected status 200 for a dry run; got %d", resp.StatusCode)
+	}
+	if !summary.DryRun || summary.Transactions.Created != 10 || len(db.transactions) != 0 || len(db.accounts) != 1 {
+		t.Fatalf("expected nothing written by the dry run; got %+v", summary)
+	}
+
+	resp, summary = importFile(t, s, user, "/api/v1/import/mint", "mint-transactions.csv")
+	if resp.StatusCode != fiber.StatusCreated {
+		t.Fatalf("expected status 201; got %d", resp.StatusCode)
+	}
+	if summary.Accounts != (types.ImportCount{Created: 2, Skipped: 1}) {
+		t.Errorf("expected Chase Checking matched and 2 accounts created; got %+v", summary.Accounts)
+	}
+	if summary.Transactions.Created != 10 || len(db.transactions) != 10 {
+		t.Errorf("expected 10 transactions; got %+v", summary.Transactions)
+	}
+	if len(summary.Errors) != 1 || summary.Errors[0].Line != 12 || summary.Errors[0].File != "transactions.csv" {
+		t.Errorf("expected the row of line 12 refused; got %+v", summary.Errors)
+	}
+	if summary.Categories["Groceries"] != "food" || summary.Categories["Gas & Fuel"] != "transport" {
+		t.Errorf("unexpected category mapping: %+v", summary.Categories)
+	}
+
+	groceries := db.transactions[0]
+	if groceries.BankAccountID != checking.ID || groceries.Type != "expense" || groceries.Amount.String() != "54.21" || groceries.Category != "food" {
+		t.Errorf("unexpected groceries: %+v", groceries)
+	}
+	if payment := db.transactions[6]; !payment.ExcludeFromBudgets {
+		t.Errorf("expected the card payment kept out of the budgets; got %+v", payment)
+	}
+
+	// The transactions are one batch of the audit log, named by the import
+	var batch []uuid.UUID
+	var completed types.AuditLog
+	for _, entry := range db.audits {
+		switch entry.Action {
+		case "transaction.created":
+			batch = append(batch, *entry.BatchID)
+		case "import.completed":
+			completed = entry
+		}
+	}
+	if len(batch) != 10 || batch[0] != batch[9] || completed.EntityID != batch[0] {
+		t.Errorf("expected the 10 transactions audited in the batch of the import; got %v, %+v", batch, completed)
+	}
+
+	// Importing the export again skips every row
+	_, summary = importFile(t, s, user, "/api/v1/import/mint", "mint-transactions.csv")
+	if summary.Transactions != (types.ImportCount{Skipped: 10}) || summary.Accounts != (types.ImportCount{Skipped: 3}) || len(db.transactions) != 10 {
+		t.Errorf("expected the second import to skip everything; got %+v", summary)
+	}
+}
+
+func TestImportYNAB(t *testing.T) {
+	s, db, user := newImportsTestServer(t)
+
+	resp, summary := importFile(t, s, user, "/api/v1/import/ynab", "ynab-export.zip")
+	if resp.StatusCode != fiber.StatusCreated {
+		t.Fatalf("expected status 201; got %d", resp.StatusCode)
+	}
+	if summary.Accounts.Created != 3 || summary.Transactions.Created != 7 || summary.SplitRows != 2 || len(summary.Errors) != 0 {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+
+	savings := db.accounts[1]
+	transfer := db.transactions[3]
+	if savings.BankName != "Savings" || savings.AccountType != "savings" ||
+		transfer.Type != "transfer" || transfer.TransferAccountID == nil || *transfer.TransferAccountID != savings.ID {
+		t.Errorf("expected a transfer to Savings; got %+v", transfer)
+	}
+
+	// The rent, electric, groceries, restaurants and fuel of January
+	if summary.Budgets.Created != 3 || len(db.budgets) != 3 {
+		t.Fatalf("expected 3 budgets; got %+v", summary.Budgets)
+	}
+	bills := db.budgets[0]
+	if bills.Categories[0].Category != "bills" || bills.Amount != money(1280) || bills.Name != "Rent, Electric" || bills.PeriodType != "monthly" || bills.StartDate.Format("2006-01-02") != "2024-01-01" {
+		t.Errorf("unexpected bills budget: %+v", bills)
+	}
+
+	_, summary = importFile(t, s, user, "/api/v1/import/ynab", "ynab-export.zip")
+	if summary.Budgets != (types.ImportCount{Skipped: 3}) || summary.Transactions != (types.ImportCount{Skipped: 7}) {
+		t.Errorf("expected the second import to skip everything; got %+v", summary)
+	}
+}
+
+func TestImportInitialBalance(t *testing.T) {
+	s, db, user := newImportsTestServer(t)
+	s.metrics = newServerMetrics(nil)
+
+	_, summary := importFile(t, s, user, "/api/v1/import/ynab?initial_balance=true&dry_run=true", "ynab-register.csv")
+	if summary.InitialBalances != 1 || summary.Transactions.Created != 2 || len(db.accounts) != 0 {
+		t.Fatalf("expected the initial balance counted and nothing written; got %+v", summary)
+	}
+
+	resp, summary := importFile(t, s, user, "/api/v1/import/ynab?initial_balance=true", "ynab-register.csv")
+	if resp.StatusCode != fiber.StatusCreated || summary.InitialBalances != 1 || summary.Transactions.Created != 2 || len(db.transactions) != 2 {
+		t.Fatalf("expected the starting balance set as the initial balance; got %d %+v", resp.StatusCode, summary)
+	}
+	if checking := db.accounts[0]; checking.InitialBalance.String() != "1500.00" {
+		t.Errorf("expected an initial balance of 1500; got %+v", checking)
+	}
+	if got := s.metrics.imports.Value("ynab"); got != 1 {
+		t.Errorf("expected the import written counted once; got %v", got)
+	}
+
+	// Importing again skips the opening balance already set
+	_, summary = importFile(t, s, user, "/api/v1/import/ynab?initial_balance=true", "ynab-register.csv")
+	if summary.InitialBalances != 0 || summary.Transactions != (types.ImportCount{Skipped: 3}) || len(db.transactions) != 2 {
+		t.Errorf("expected the second import to skip everything; got %+v", summary)
+	}
+}
+
+func TestImportInitialBalanceOfAccountWithTransactions(t *testing.T) {
+	s, db, user := newImportsTestServer(t)
+	checking := types.BankAccount{ID: uuid.New(), BankName: "Checking", AccountType: "checking", Currency: "EUR", UserID: user.ID}
+	db.accounts = []types.BankAccount{checking}
+	db.transactions = []types.Transaction{{ID: uuid.New(), Type: "income", BankAccountID: checking.ID}}
+
+	_, summary := importFile(t, s, user, "/api/v1/import/ynab?initial_balance=true", "ynab-register.csv")
+	if summary.InitialBalances != 0 || summary.Transactions.Created != 3 || !db.accounts[0].InitialBalance.IsZero() {
+		t.Errorf("expected the starting balance imported as a transaction; got %+v", summary)
+	}
+}
+
+func TestImportRefusesOtherFiles(t *testing.T) {
+	s, db, user := newImportsTestServer(t)
+
+	resp, _ := importFile(t, s, user, "/api/v1/import/ynab", "mint-transactions.csv")
+	if resp.StatusCode != fiber.StatusUnprocessableEntity {
+		t.Errorf("expected status 422 for a Mint export imported as YNAB; got %d", resp.StatusCode)
+	}
+	resp, _ = importFile(t, s, user, "/api/v1/import/mint", "ynab-export.zip")
+	if resp.StatusCode != fiber.StatusUnprocessableEntity {
+		t.Errorf("expected status 422 for a zip imported as Mint; got %d", resp.StatusCode)
+	}
+	if len(db.accounts) != 0 {
+		t.Errorf("expected nothing created; got %d accounts", len(db.accounts))
+	}
+}
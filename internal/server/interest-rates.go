@@ -0,0 +1,190 @@
+package server
+
+import (
+	"FinMa/constants"
+	"FinMa/types"
+	"math"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+func isValidCompoundingFrequency(frequency string) bool {
+	for _, f := range constants.GetCompoundingFrequencies() {
+		if f == frequency {
+			return true
+		}
+	}
+	return false
+}
+
+// compoundingPeriods returns the number of times the interest is compounded per year.
+func compoundingPeriods(frequency string) int {
+	switch frequency {
+	case "daily":
+		return 365
+	case "quarterly":
+		return 4
+	case "yearly":
+		return 1
+	default:
+		return 12
+	}
+}
+
+// rateAt returns the annual rate in effect at the given date, rates being
+// sorted by effective date.
+func rateAt(rates []types.InterestRate, at time.Time) float64 {
+	rate := 0.0
+	for _, r := range rates {
+		if r.EffectiveFrom.After(at) {
+			break
+		}
+		rate = r.Rate
+	}
+	return rate
+}
+
+// projectBalance projects the balance at the end of each of the months
+// following start. The contribution is added at the end of every month.
+// Daily and monthly compounding credit the interest every month, quarterly
+// and yearly compounding accrue it monthly and credit it at the end of the
+// period. The interest credited is rounded to the minor unit of the currency.
+func projectBalance(balance, contribution types.Money, rates []types.InterestRate, frequency, currency string, start time.Time, months int) []types.ProjectionPoint {
+	periods := compoundingPeriods(frequency)
+	points := make([]types.ProjectionPoint, 0, months)
+	month := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, start.Location())
+	balance, contribution = balance.Unbound(), contribution.Unbound()
+	var accrued int64
+
+	for i := 1; i <= months; i++ {
+		month = month.AddDate(0, 1, 0)
+		rate := rateAt(rates, month)
+
+		interest := types.Money{}
+		if periods >= 12 {
+			interest = balance.Mul(math.Pow(1+rate/100/float64(periods), float64(periods)/12) - 1).Round(currency)
+		} else {
+			accrued += balance.Mul(rate / 100 / 12).Minor
+			if i%(12/periods) == 0 {
+				interest = types.NewMoney(accrued, "").Round(currency)
+				accrued = 0
+			}
+		}
+
+		balance = types.NewMoney(balance.Minor+interest.Minor+contribution.Minor, "")
+		points = append(points, types.ProjectionPoint{
+			Month:        month,
+			Rate:         rate,
+			Interest:     interest,
+			Contribution: contribution,
+			Balance:      balance,
+		})
+	}
+
+	return points
+}
+
+// CreateInterestRate sets the annual interest rate of a savings account from
+// a date on. Previous rates are kept in the history.
+func (s *FiberServer) CreateInterestRate(c *fiber.Ctx) error {
+	type CreateInterestRateRequest struct {
+		Rate          float64 `json:"rate" validate:"gte=0,lte=100"`
+		EffectiveFrom string  `json:"effective_from" validate:"required"`
+	}
+
+	var body CreateInterestRateRequest
+	if err := c.BodyParser(&body); err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+
+	if err := validate.Struct(body); err != nil {
+		return err
+	}
+
+	effectiveFrom, err := time.Parse(time.RFC3339, body.EffectiveFrom)
+	if err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid effective date format")
+	}
+
+	user := c.Locals("user").(types.User)
+	account, ok := s.findUserBankAccount(user, c.Params("id"), "owner")
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Bank account not found")
+	}
+
+	if account.AccountType != "savings" {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Interest rates are only available on savings accounts")
+	}
+
+	rate := types.InterestRate{
+		ID:            uuid.New(),
+		Rate:          body.Rate,
+		EffectiveFrom: effectiveFrom,
+		BankAccountID: account.ID,
+	}
+
+	if err := s.db.CreateInterestRate(&rate); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not create interest rate")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(rate)
+}
+
+// GetInterestRates returns the rate history of an account.
+func (s *FiberServer) GetInterestRates(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	account, ok := s.findUserBankAccount(user, c.Params("id"), "viewer")
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Bank account not found")
+	}
+
+	return c.JSON(s.db.GetInterestRates(account.ID))
+}
+
+// GetBalanceProjection estimates the balance of a savings account for the
+// next ?months=12 months from its current balance, its recurring inflows
+// over the last three months and its interest rate history.
+func (s *FiberServer) GetBalanceProjection(c *fiber.Ctx) error {
+	months := c.QueryInt("months", 12)
+	if months <= 0 || months > 600 {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "months must be between 1 and 600")
+	}
+
+	user := c.Locals("user").(types.User)
+	account, ok := s.findUserBankAccount(user, c.Params("id"), "viewer")
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Bank account not found")
+	}
+
+	if account.AccountType != "savings" {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Projections are only available on savings accounts")
+	}
+
+	now := time.Now()
+	inflow, err := s.db.GetRecurringInflow(account.ID, now.AddDate(0, -3, 0))
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not compute recurring inflows")
+	}
+	currency := s.accountCurrency(account)
+	contribution := inflow.Unbound().Mul(1.0 / 3).Round(currency)
+
+	frequency := account.CompoundingFrequency
+	if frequency == "" {
+		frequency = "monthly"
+	}
+
+	return c.JSON(types.BalanceProjection{
+		AccountID:            account.ID,
+		IsEstimate:           true,
+		Disclaimer:           "Estimate assuming the current rates and recurring inflows stay unchanged",
+		CompoundingFrequency: frequency,
+		StartingBalance:      account.Balance.Unbound(),
+		MonthlyContribution:  contribution,
+		Points:               projectBalance(account.Balance, contribution, s.db.GetInterestRates(account.ID), frequency, currency, now, months),
+	})
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"FinMa/types"
+	"testing"
+	"time"
+)
+
+func TestProjectBalance(t *testing.T) {
+	start := time.Date(2024, time.January, 15, 0, 0, 0, 0, time.UTC)
+	rates := []types.InterestRate{
+		{Rate: 12, EffectiveFrom: time.Date(2023, time.June, 1, 0, 0, 0, 0, time.UTC)},
+		// The rate drops from the third projected month on
+		{Rate: 0, EffectiveFrom: time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	points := projectBalance(money(1000), money(100), rates, "monthly", "EUR", start, 3)
+	expected := []float64{1110, 1221.1, 1321.1}
+
+	if len(points) != len(expected) {
+		t.Fatalf("expected %d points; got %d", len(expected), len(points))
+	}
+	for i, point := range points {
+		if point.Balance != money(expected[i]) {
+			t.Errorf("expected balance %v for %v; got %v", expected[i], point.Month.Month(), point.Balance)
+		}
+	}
+	if points[2].Rate != 0 {
+		t.Errorf("expected the rate to change in April; got %v", points[2].Rate)
+	}
+}
+
+func TestProjectBalanceQuarterly(t *testing.T) {
+	start := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	rates := []types.InterestRate{{Rate: 12, EffectiveFrom: start}}
+
+	points := projectBalance(money(1000), money(0), rates, "quarterly", "EUR", start, 3)
+
+	// Interest accrues monthly and is credited at the end of the quarter
+	if points[0].Balance != money(1000) || points[1].Balance != money(1000) {
+		t.Errorf("expected no interest credited before the end of the quarter; got %v, %v", points[0].Balance, points[1].Balance)
+	}
+	if points[2].Balance != money(1030) {
+		t.Errorf("expected 1030 at the end of the quarter; got %v", points[2].Balance)
+	}
+}
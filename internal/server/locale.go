@@ -0,0 +1,53 @@
+package server
+
+import (
+	"FinMa/internal/i18n"
+	"FinMa/types"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+)
+
+// requestLocale returns the language of the messages of the request: the
+// one the user chose, else the one the Accept-Language header prefers,
+// else English.
+func requestLocale(c *fiber.Ctx) string {
+	if user, ok := c.Locals("user").(types.User); ok && i18n.IsSupported(user.Locale) {
+		return user.Locale
+	}
+	if locale := i18n.Match(c.Get(fiber.HeaderAcceptLanguage)); locale != "" {
+		return locale
+	}
+	return i18n.Default
+}
+
+// localizer returns the Localizer of the language the user chose, writing
+// the amounts in their base currency.
+func (s *FiberServer) localizer(user types.User) i18n.Localizer {
+	return i18n.For(user.Locale, s.baseCurrency(user))
+}
+
+// SetLocale stores the language of the user, used for the errors, the
+// notifications and the emails. An empty locale follows the Accept-Language
+// of the requests again, the emails are then in English.
+func (s *FiberServer) SetLocale(c *fiber.Ctx) error {
+	type SetLocaleRequest struct {
+		Locale string `json:"locale"`
+	}
+
+	var body SetLocaleRequest
+	if err := c.BodyParser(&body); err != nil || (body.Locale != "" && !i18n.IsSupported(body.Locale)) {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid locale").
+			WithDetails(FieldError{Field: "locale", Message: "must be one of: " + strings.Join(i18n.Supported(), " "), Value: body.Locale})
+	}
+
+	user := c.Locals("user").(types.User)
+	user.Locale = body.Locale
+	if err := s.db.UpdateUserLocale(&user); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not update the locale")
+	}
+
+	return c.JSON(fiber.Map{"locale": user.Locale, "supported": i18n.Supported()})
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"FinMa/internal/i18n"
+	"FinMa/internal/realtime"
+	"FinMa/types"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+)
+
+// parseLowBalanceThreshold reads the low balance threshold of an account
+// update: null removes the threshold, a number sets it.
+func parseLowBalanceThreshold(raw json.RawMessage) (*types.Money, error) {
+	if string(raw) == "null" {
+		return nil, nil
+	}
+
+	var threshold types.Money
+	if err := json.Unmarshal(raw, &threshold); err != nil {
+		return nil, fmt.Errorf("low balance threshold must be an amount or null")
+	}
+	return &threshold, nil
+}
+
+// notifyLowBalance is called once a transaction change took the balance of
+// an account below its low balance threshold. The owner of the account is
+// notified, and the event is pushed to their real-time connections.
+func (s *FiberServer) notifyLowBalance(account types.BankAccount, transaction *types.Transaction) {
+	details := fiber.Map{
+		"bank_account_id": account.ID,
+		"bank_name":       account.BankName,
+		"balance":         account.Balance,
+		"threshold":       *account.LowBalanceThreshold,
+		"transaction_id":  transaction.ID,
+	}
+
+	s.hub.Publish(account.UserID, realtime.Event{Type: "account.low_balance", Data: details})
+
+	err := s.Notify(context.Background(), account.UserID, "low_balance", NotificationPayload{
+		Params: i18n.Params{
+			"account":   account.BankName,
+			"balance":   i18n.Amount(account.Balance.Float64()),
+			"threshold": i18n.Amount(account.LowBalanceThreshold.Float64()),
+		},
+		Details: details,
+	})
+	if err != nil {
+		log.Error("Error notifying low balance: ", err)
+	}
+}
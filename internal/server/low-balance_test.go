@@ -0,0 +1,32 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseLowBalanceThreshold(t *testing.T) {
+	threshold, err := parseLowBalanceThreshold(json.RawMessage("200"))
+	if err != nil || threshold == nil || *threshold != money(200) {
+		t.Errorf("expected a threshold of 200; got %v, %v", threshold, err)
+	}
+
+	threshold, err = parseLowBalanceThreshold(json.RawMessage("-50.5"))
+	if err != nil || threshold == nil || *threshold != money(-50.5) {
+		t.Errorf("expected an overdraft threshold of -50.5; got %v, %v", threshold, err)
+	}
+
+	threshold, err = parseLowBalanceThreshold(json.RawMessage("null"))
+	if err != nil || threshold != nil {
+		t.Errorf("expected null to remove the threshold; got %v, %v", threshold, err)
+	}
+
+	threshold, err = parseLowBalanceThreshold(json.RawMessage(`"200.10"`))
+	if err != nil || threshold == nil || *threshold != money(200.1) {
+		t.Errorf("expected a decimal string threshold of 200.10; got %v, %v", threshold, err)
+	}
+
+	if _, err := parseLowBalanceThreshold(json.RawMessage("true")); err == nil {
+		t.Errorf("expected a boolean threshold to be refused")
+	}
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+
+	"FinMa/types"
+)
+
+// maintenanceRefresh is how long an instance keeps the maintenance mode it
+// read: the change of an admin reaches the other instances within it.
+const maintenanceRefresh = 5 * time.Second
+
+// defaultMaintenanceMessage is shown when the admin gave no message.
+const defaultMaintenanceMessage = "FinMa is down for maintenance, please retry later"
+
+// maintenanceState is the maintenance mode last read by the instance.
+type maintenanceState struct {
+	mu        sync.Mutex
+	current   *types.Maintenance
+	checkedAt time.Time
+}
+
+// maintenance returns the maintenance mode, read again from the database
+// once maintenanceRefresh passed. Until an admin sets it, MAINTENANCE_MODE
+// applies, as on the servers built without a database. When the database
+// cannot be read, during a migration, the last mode read is kept.
+func (s *FiberServer) maintenance() types.Maintenance {
+	state := &s.maintenanceState
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if s.db != nil && time.Since(state.checkedAt) >= maintenanceRefresh {
+		ctx, cancel := context.WithTimeout(context.Background(), readinessTimeout)
+		defer cancel()
+		stored, err := s.db.WithContext(ctx).GetMaintenance()
+		if err != nil {
+			log.Warn("Error reading the maintenance mode: ", err)
+		} else {
+			state.current = stored
+		}
+		state.checkedAt = time.Now()
+	}
+
+	if state.current == nil {
+		return types.Maintenance{Enabled: s.config.Server.Maintenance}
+	}
+	return *state.current
+}
+
+// inMaintenance pauses the background jobs in maintenance mode.
+func (s *FiberServer) inMaintenance() bool {
+	return s.maintenance().Enabled
+}
+
+// maintenanceError is the error of the requests refused in maintenance mode.
+func maintenanceError(maintenance types.Maintenance) *APIError {
+	message := maintenance.Message
+	if message == "" {
+		message = defaultMaintenanceMessage
+	}
+	return NewAPIError(fiber.StatusServiceUnavailable, CodeMaintenance, message)
+}
+
+// maintenanceExempt tells whether the request is served in maintenance
+// mode: the probes and the metrics, the CORS preflights, and the login and
+// the admin routes so that the admins can sign in and turn it off.
+func maintenanceExempt(c *fiber.Ctx) bool {
+	path := c.Path()
+	if c.Method() == fiber.MethodOptions || path == livenessPath || path == readinessPath || path == "/metrics" {
+		return true
+	}
+	for _, prefix := range []string{APIPrefix, legacyAPIPrefix} {
+		rest, ok := strings.CutPrefix(path, prefix)
+		if ok && (rest == "/auth/login" || rest == "/admin" || strings.HasPrefix(rest, "/admin/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// rejectInMaintenance refuses the requests with a 503 in maintenance mode,
+// telling the clients when to retry.
+func (s *FiberServer) rejectInMaintenance(c *fiber.Ctx) error {
+	if maintenanceExempt(c) {
+		return c.Next()
+	}
+	maintenance := s.maintenance()
+	if !maintenance.Enabled {
+		return c.Next()
+	}
+
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(s.config.Server.MaintenanceRetryAfter))
+	return maintenanceError(maintenance)
+}
+
+// GetMaintenance returns the maintenance mode. Admin only.
+func (s *FiberServer) GetMaintenance(c *fiber.Ctx) error {
+	return c.JSON(s.maintenance())
+}
+
+// SetMaintenance turns the maintenance mode on or off for every instance,
+// until it is set again: it outlives the restarts and overrides
+// MAINTENANCE_MODE. Admin only.
+func (s *FiberServer) SetMaintenance(c *fiber.Ctx) error {
+	type SetMaintenanceRequest struct {
+		Enabled *bool  `json:"enabled" validate:"required"`
+		Message string `json:"message" validate:"max=500"`
+	}
+
+	var body SetMaintenanceRequest
+	if err := c.BodyParser(&body); err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+	if err := validate.Struct(body); err != nil {
+		return err
+	}
+
+	admin := c.Locals("user").(types.User)
+	maintenance := types.Maintenance{Enabled: *body.Enabled, Message: body.Message, UpdatedBy: &admin.ID, UpdatedAt: time.Now()}
+	if err := s.db.SetMaintenance(&maintenance); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not update the maintenance mode")
+	}
+	log.Info("Maintenance mode updated", "enabled", maintenance.Enabled, "admin", admin.ID)
+
+	// Applied at once on this instance
+	s.maintenanceState.mu.Lock()
+	s.maintenanceState.current = &maintenance
+	s.maintenanceState.checkedAt = time.Now()
+	s.maintenanceState.mu.Unlock()
+
+	return c.JSON(maintenance)
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"FinMa/internal/database"
+	"FinMa/types"
+)
+
+// maintenanceDB stores the maintenance mode next to the users of an adminDB.
+type maintenanceDB struct {
+	*adminDB
+	maintenance *types.Maintenance
+}
+
+func (db *maintenanceDB) WithContext(context.Context) database.Service {
+	return db
+}
+
+func (db *maintenanceDB) GetMaintenance() (*types.Maintenance, error) {
+	return db.maintenance, nil
+}
+
+func (db *maintenanceDB) SetMaintenance(maintenance *types.Maintenance) error {
+	stored := *maintenance
+	db.maintenance = &stored
+	return nil
+}
+
+func TestMaintenanceMode(t *testing.T) {
+	s, admins, admin, user := newAdminTestServer(t)
+	db := &maintenanceDB{adminDB: admins}
+	s.db = db
+	// The routes are registered, the middleware runs before them
+	s.App = fiber.New(fiber.Config{ErrorHandler: errorHandler})
+	s.Use(s.rejectInMaintenance)
+	s.RegisterFiberRoutes()
+
+	if resp := adminRequest(t, s, user, "GET", "/api/v1/", ""); resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("expected the requests served; got %d", resp.StatusCode)
+	}
+
+	resp := adminRequest(t, s, admin, "POST", "/api/v1/admin/maintenance", `{"enabled": true, "message": "Back at 22:00"}`)
+	if resp.StatusCode != fiber.StatusOK || db.maintenance == nil || !db.maintenance.Enabled || *db.maintenance.UpdatedBy != admin.ID {
+		t.Fatalf("expected the maintenance mode stored; got %d %+v", resp.StatusCode, db.maintenance)
+	}
+
+	for _, path := range []string{"/api/v1/", "/api/accounts"} {
+		resp := adminRequest(t, s, user, "GET", path, "")
+		var body errorBody
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || resp.StatusCode != fiber.StatusServiceUnavailable {
+			t.Fatalf("%s: expected status 503; got %d, %v", path, resp.StatusCode, err)
+		}
+		if body.Error.Code != CodeMaintenance || body.Error.Message != "Back at 22:00" || resp.Header.Get("Retry-After") != "300" {
+			t.Errorf("%s: expected the maintenance message and Retry-After; got %+v %q", path, body.Error, resp.Header.Get("Retry-After"))
+		}
+	}
+
+	// The admins still sign in and manage the instance
+	if resp := adminRequest(t, s, admin, "POST", "/api/v1/auth/login", `{}`); resp.StatusCode == fiber.StatusServiceUnavailable {
+		t.Errorf("expected the login served")
+	}
+	if resp := adminRequest(t, s, admin, "GET", "/api/v1/admin/maintenance", ""); resp.StatusCode != fiber.StatusOK {
+		t.Errorf("expected the admin routes served; got %d", resp.StatusCode)
+	}
+	if resp := adminRequest(t, s, admin, "GET", livenessPath, ""); resp.StatusCode != fiber.StatusOK {
+		t.Errorf("expected the liveness probe served; got %d", resp.StatusCode)
+	}
+
+	// Turned off by another instance, seen once the state is read again
+	db.maintenance = &types.Maintenance{Enabled: false, UpdatedAt: time.Now()}
+	if resp := adminRequest(t, s, user, "GET", "/api/v1/", ""); resp.StatusCode != fiber.StatusServiceUnavailable {
+		t.Errorf("expected the state kept for a while; got %d", resp.StatusCode)
+	}
+	s.maintenanceState.checkedAt = time.Time{}
+	if resp := adminRequest(t, s, user, "GET", "/api/v1/", ""); resp.StatusCode != fiber.StatusOK {
+		t.Errorf("expected the requests served once turned off; got %d", resp.StatusCode)
+	}
+
+	if resp := adminRequest(t, s, admin, "POST", "/api/v1/admin/maintenance", `{"message": "Soon"}`); resp.StatusCode != fiber.StatusUnprocessableEntity {
+		t.Errorf("expected enabled to be required; got %d", resp.StatusCode)
+	}
+}
+
+func TestMaintenanceModeFromConfig(t *testing.T) {
+	s := &FiberServer{db: &maintenanceDB{}}
+	s.config.Server.Maintenance = true
+	if !s.inMaintenance() {
+		t.Errorf("expected MAINTENANCE_MODE to apply until the mode is set")
+	}
+
+	s = &FiberServer{db: &maintenanceDB{maintenance: &types.Maintenance{Enabled: false}}}
+	s.config.Server.Maintenance = true
+	if s.inMaintenance() {
+		t.Errorf("expected the mode set by an admin over MAINTENANCE_MODE")
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"FinMa/types"
+	"strconv"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetMerchants ranks the merchants the user spent at between ?from= and
+// ?to= (RFC3339, the last 90 days by default) by total, with the number of
+// expenses, their average, the first and the last seen dates, and whether
+// they recur monthly or weekly, like the subscriptions. The merchants are
+// the descriptions of the expenses without their digits and punctuation.
+// The pages hold ?limit=50 merchants (200 at most) from ?offset=; the CSV
+// holds every merchant up to csvRowLimit. The expenses excluded from the
+// budgets are left out.
+func (s *FiberServer) GetMerchants(c *fiber.Ctx) error {
+	db := s.dbFor(c)
+
+	user := c.Locals("user").(types.User)
+
+	from, to, err := parseReportRange(c)
+	if err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, err.Error())
+	}
+
+	limit := c.QueryInt("limit", 50)
+	offset := c.QueryInt("offset", 0)
+	if limit <= 0 || limit > 200 {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "limit must be between 1 and 200")
+	}
+	if offset < 0 {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "offset must not be negative")
+	}
+	format, err := responseFormat(c, formatJSON, formatCSV)
+	if err != nil {
+		return err
+	}
+	if format == formatCSV {
+		limit, offset = csvRowLimit, 0
+	}
+
+	key := []string{c.Query("from"), c.Query("to"), strconv.Itoa(limit), strconv.Itoa(offset)}
+	return cachedReport(s, c, "merchants", key, func() (types.MerchantReport, error) {
+		report := types.MerchantReport{From: from, To: to, Currency: s.baseCurrency(user), Limit: limit, Offset: offset}
+		merchants, total, err := db.GetMerchantSpending(&user, from, to, limit, offset)
+		if err != nil {
+			log.Error(err)
+			return report, NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not compute the merchants")
+		}
+
+		location := userLocation(user)
+		for i := range merchants {
+			merchants[i].FirstSeen = merchants[i].FirstSeen.In(location)
+			merchants[i].LastSeen = merchants[i].LastSeen.In(location)
+		}
+		report.Merchants = merchants
+		report.Total = total
+		return report, nil
+	}, func(report types.MerchantReport) any {
+		return report.Merchants
+	})
+}
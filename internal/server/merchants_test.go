@@ -0,0 +1,94 @@
+package server
+
+import (
+	"FinMa/internal/database"
+	"FinMa/types"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// merchantsDB records the page requested of the merchants.
+type merchantsDB struct {
+	database.Service
+	limit, offset int
+}
+
+func (db *merchantsDB) WithContext(context.Context) database.Service {
+	return db
+}
+
+func (db *merchantsDB) GetMerchantSpending(user *types.User, from, to time.Time, limit, offset int) ([]types.MerchantSpending, int64, error) {
+	db.limit, db.offset = limit, offset
+	monthly := "monthly"
+	return []types.MerchantSpending{{
+		Merchant:  "netflix",
+		Total:     money(53.94),
+		Count:     6,
+		Average:   money(8.99),
+		FirstSeen: time.Date(2024, time.January, 4, 0, 0, 0, 0, time.UTC),
+		LastSeen:  time.Date(2024, time.June, 4, 0, 0, 0, 0, time.UTC),
+		Recurring: true,
+		Cadence:   &monthly,
+	}}, 120, nil
+}
+
+func TestGetMerchants(t *testing.T) {
+	db := &merchantsDB{}
+	s := &FiberServer{App: fiber.New(fiber.Config{ErrorHandler: errorHandler}), db: db}
+	s.Use(func(c *fiber.Ctx) error {
+		c.Locals("user", types.User{ID: uuid.New()})
+		return c.Next()
+	})
+	s.Get("/reports/merchants", s.GetMerchants)
+
+	get := func(path, accept string) (*http.Response, []byte) {
+		req, _ := http.NewRequest("GET", path, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		resp, err := s.Test(req)
+		if err != nil {
+			t.Fatalf("error making request to server. Err: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return resp, body
+	}
+
+	resp, body := get("/reports/merchants?limit=20&offset=40", "")
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("expected status OK; got %v: %s", resp.Status, body)
+	}
+	var report types.MerchantReport
+	if err := json.Unmarshal(body, &report); err != nil {
+		t.Fatalf("error unmarshalling response body. Err: %v", err)
+	}
+	if db.limit != 20 || db.offset != 40 || report.Total != 120 || report.Limit != 20 {
+		t.Errorf("expected the page of 20 from 40 of 120 merchants; got %+v", report)
+	}
+	if merchant := report.Merchants[0]; merchant.Total != money(53.94) || merchant.Average != money(8.99) || !merchant.Recurring {
+		t.Errorf("expected the totals of the merchant; got %+v", merchant)
+	}
+
+	// The CSV is not paginated
+	resp, body = get("/reports/merchants?limit=20&offset=40", "text/csv")
+	if resp.StatusCode != fiber.StatusOK || db.limit != csvRowLimit || db.offset != 0 {
+		t.Errorf("expected every merchant in CSV; got %v with limit %d offset %d", resp.Status, db.limit, db.offset)
+	}
+	if !strings.Contains(string(body), "netflix,53.94,6,8.99,") {
+		t.Errorf("expected the merchant in CSV; got %s", body)
+	}
+
+	for _, query := range []string{"limit=0", "limit=201", "offset=-1"} {
+		if resp, _ := get("/reports/merchants?"+query, ""); resp.StatusCode != fiber.StatusBadRequest {
+			t.Errorf("expected %s to be refused; got %v", query, resp.Status)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package server
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"FinMa/internal/database"
+	"FinMa/internal/mail"
+	"FinMa/internal/metrics"
+	"FinMa/types"
+)
+
+// unmatchedRoute is the route label of the requests matching no route, so
+// that scanners probing random paths do not add series.
+const unmatchedRoute = "unmatched"
+
+// jobDurationBuckets are the buckets of the job durations, longer than the
+// requests: a bank sync takes minutes.
+var jobDurationBuckets = []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 600}
+
+// serverMetrics are the metrics exposed on /metrics. The names follow the
+// Prometheus conventions: the finma_ prefix, the unit as a suffix
+// (_seconds, _bytes) and _total for the counters.
+type serverMetrics struct {
+	registry *metrics.Registry
+
+	httpRequests *metrics.CounterVec
+	httpDuration *metrics.HistogramVec
+
+	transactionsCreated *metrics.CounterVec
+	bankSyncs           *metrics.CounterVec
+	imports             *metrics.CounterVec
+	emailDeliveries     *metrics.CounterVec
+	panics              *metrics.CounterVec
+	jobRuns             *metrics.CounterVec
+	jobDuration         *metrics.HistogramVec
+	cacheRequests       *metrics.CounterVec
+
+	// routes are the "METHOD /path" of the registered routes, read once
+	// the first request comes in, when every route is registered
+	routesOnce sync.Once
+	routes     map[string]bool
+}
+
+// newServerMetrics registers the metrics of the server, with the gauges of
+// the connection pool of db when it is not nil.
+func newServerMetrics(db database.Service) *serverMetrics {
+	registry := metrics.NewRegistry()
+	m := &serverMetrics{
+		registry: registry,
+		httpRequests: registry.NewCounter("finma_http_requests_total",
+			"HTTP requests handled, by method, route pattern and status class.",
+			"method", "route", "status_class"),
+		httpDuration: registry.NewHistogram("finma_http_request_duration_seconds",
+			"Time taken to handle the HTTP requests, by method, route pattern and status class.",
+			metrics.DefaultBuckets, "method", "route", "status_class"),
+		transactionsCreated: registry.NewCounter("finma_transactions_created_total",
+			"Transactions created, by source (manual, bank_sync or import) and type.",
+			"source", "type"),
+		bankSyncs: registry.NewCounter("finma_bank_syncs_total",
+			"Bank connection syncs, by resulting connection status.",
+			"status"),
+		imports: registry.NewCounter("finma_imports_total",
+			"Imports of the exports of other apps written, by format (mint or ynab).",
+			"format"),
+		emailDeliveries: registry.NewCounter("finma_email_deliveries_total",
+			"Emails whose delivery ended, by status (sent or failed).",
+			"status"),
+		panics: registry.NewCounter("finma_panics_total",
+			"Panics recovered while handling the HTTP requests."),
+		jobRuns: registry.NewCounter("finma_job_runs_total",
+			"Background job runs on this instance, by job and result (ok or failed).",
+			"job", "result"),
+		jobDuration: registry.NewHistogram("finma_job_duration_seconds",
+			"Time taken by the background job runs, by job.",
+			jobDurationBuckets, "job"),
+		cacheRequests: registry.NewCounter("finma_cache_requests_total",
+			"Requests for a cached response, by cache and result (hit or miss).",
+			"cache", "result"),
+	}
+
+	if db != nil {
+		pool := func(stat func(stats sql.DBStats) float64) func() float64 {
+			return func() float64 { return stat(db.Stats()) }
+		}
+		registry.NewGaugeFunc("finma_db_connections_open", "Open connections to the database.",
+			pool(func(s sql.DBStats) float64 { return float64(s.OpenConnections) }))
+		registry.NewGaugeFunc("finma_db_connections_in_use", "Connections to the database in use.",
+			pool(func(s sql.DBStats) float64 { return float64(s.InUse) }))
+		registry.NewGaugeFunc("finma_db_connections_idle", "Idle connections to the database.",
+			pool(func(s sql.DBStats) float64 { return float64(s.Idle) }))
+		registry.NewCounterFunc("finma_db_connection_waits_total", "Times a query waited for a free connection.",
+			pool(func(s sql.DBStats) float64 { return float64(s.WaitCount) }))
+		registry.NewCounterFunc("finma_db_connection_wait_seconds_total", "Time spent waiting for a free connection.",
+			pool(func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }))
+	}
+
+	return m
+}
+
+// routeLabel returns the route pattern of the request once it is handled,
+// such as /api/v1/accounts/:id, never the raw path. The requests stopped by
+// a group middleware, or matching no route, are labeled "unmatched".
+func (m *serverMetrics) routeLabel(c *fiber.Ctx) string {
+	m.routesOnce.Do(func() {
+		m.routes = map[string]bool{}
+		for _, route := range c.App().GetRoutes(true) {
+			m.routes[route.Method+" "+route.Path] = true
+		}
+	})
+
+	route := c.Route()
+	if route == nil || !m.routes[c.Method()+" "+route.Path] {
+		return unmatchedRoute
+	}
+	return route.Path
+}
+
+// middleware counts the requests and measures their latency. It is
+// registered first, the status is final once the request logging, which
+// writes the errors, returns.
+func (m *serverMetrics) middleware(c *fiber.Ctx) error {
+	start := time.Now()
+	err := c.Next()
+	if err != nil {
+		if handlerErr := c.App().ErrorHandler(c, err); handlerErr != nil {
+			c.Status(fiber.StatusInternalServerError)
+		}
+	}
+
+	statusClass := strconv.Itoa(c.Response().StatusCode()/100) + "xx"
+	route := m.routeLabel(c)
+	m.httpRequests.Inc(c.Method(), route, statusClass)
+	m.httpDuration.Observe(time.Since(start).Seconds(), c.Method(), route, statusClass)
+	return nil
+}
+
+// countTransactionCreated is the transaction hook counting the created
+// transactions.
+func (m *serverMetrics) countTransactionCreated(previous, current *types.Transaction) {
+	if previous != nil || current == nil {
+		return
+	}
+	source := current.Source
+	if source == "" {
+		source = "manual"
+	}
+	m.transactionsCreated.Inc(source, current.Type)
+}
+
+// countImport counts an import written by the format of its export. The
+// metrics are nil for the servers built without them.
+func (m *serverMetrics) countImport(format string) {
+	if m == nil {
+		return
+	}
+	m.imports.Inc(format)
+}
+
+// countBankSync counts a sync of a connection by its resulting status. The
+// metrics are nil for the servers built without them.
+func (m *serverMetrics) countBankSync(status string) {
+	if m == nil {
+		return
+	}
+	m.bankSyncs.Inc(status)
+}
+
+// countPanic counts a recovered panic. The metrics are nil for the servers
+// built without them.
+func (m *serverMetrics) countPanic() {
+	if m == nil {
+		return
+	}
+	m.panics.Inc()
+}
+
+// countCacheRequest counts a request for a cached response by its result.
+// The metrics are nil for the servers built without them.
+func (m *serverMetrics) countCacheRequest(name, result string) {
+	if m == nil {
+		return
+	}
+	m.cacheRequests.Inc(name, result)
+}
+
+// observeJobRun counts a run of a background job and its duration.
+func (m *serverMetrics) observeJobRun(name string, elapsed time.Duration, err error) {
+	result := "ok"
+	if err != nil {
+		result = "failed"
+	}
+	m.jobRuns.Inc(name, result)
+	m.jobDuration.Observe(elapsed.Seconds(), name)
+}
+
+// deliveryRecorder counts the emails whose delivery ended before recording
+// them.
+type deliveryRecorder struct {
+	mail.DeliveryRecorder
+	deliveries *metrics.CounterVec
+}
+
+func (r deliveryRecorder) SaveEmailDelivery(delivery *types.EmailDelivery) error {
+	if delivery.Status == "sent" || delivery.Status == "failed" {
+		r.deliveries.Inc(delivery.Status)
+	}
+	return r.DeliveryRecorder.SaveEmailDelivery(delivery)
+}
+
+// GetMetrics serves the metrics in the Prometheus text format. When
+// METRICS_TOKEN is set the scraper must send it as a bearer token.
+func (s *FiberServer) GetMetrics(c *fiber.Ctx) error {
+	if token := s.config.Server.MetricsToken; token != "" {
+		bearer, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+			return NewAPIError(fiber.StatusUnauthorized, CodeUnauthorized, "Unauthorized")
+		}
+	}
+
+	c.Set(fiber.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+	_, err := s.metrics.registry.WriteTo(c)
+	return err
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/internal/config"
+	"FinMa/types"
+)
+
+func newMetricsTestServer(cfg config.Config) *FiberServer {
+	s := &FiberServer{
+		App:     fiber.New(fiber.Config{ErrorHandler: errorHandler}),
+		config:  cfg,
+		metrics: newServerMetrics(nil),
+	}
+	s.Use(s.metrics.middleware)
+	s.Get("/metrics", s.GetMetrics)
+	s.Get("/api/v1/accounts/:id", func(c *fiber.Ctx) error {
+		return c.SendString(c.Params("id"))
+	})
+	s.Get("/api/v1/fail", func(c *fiber.Ctx) error {
+		return NewAPIError(fiber.StatusConflict, CodeConflict, "Conflict")
+	})
+	return s
+}
+
+func TestMetricsLabelRoutePatterns(t *testing.T) {
+	s := newMetricsTestServer(config.Default())
+
+	for _, path := range []string{"/api/v1/accounts/" + uuid.NewString(), "/api/v1/accounts/" + uuid.NewString(), "/api/v1/fail", "/wp-login.php"} {
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatalf("error creating request. Err: %v", err)
+		}
+		if _, err := s.Test(req); err != nil {
+			t.Fatalf("error making request to server. Err: %v", err)
+		}
+	}
+
+	tests := []struct {
+		route       string
+		statusClass string
+		expected    float64
+	}{
+		{"/api/v1/accounts/:id", "2xx", 2},
+		{"/api/v1/fail", "4xx", 1},
+		{unmatchedRoute, "4xx", 1},
+	}
+	for _, tt := range tests {
+		if got := s.metrics.httpRequests.Value("GET", tt.route, tt.statusClass); got != tt.expected {
+			t.Errorf("expected %v requests on %s %s; got %v", tt.expected, tt.route, tt.statusClass, got)
+		}
+		if got := s.metrics.httpDuration.Count("GET", tt.route, tt.statusClass); got != uint64(tt.expected) {
+			t.Errorf("expected %v observations on %s %s; got %v", tt.expected, tt.route, tt.statusClass, got)
+		}
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	cfg := config.Default()
+	cfg.Server.MetricsToken = "scrape-secret"
+	s := newMetricsTestServer(cfg)
+
+	tests := []struct {
+		authorization string
+		status        int
+	}{
+		{"", fiber.StatusUnauthorized},
+		{"Bearer wrong", fiber.StatusUnauthorized},
+		{"Bearer scrape-secret", fiber.StatusOK},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", "/metrics", nil)
+		if err != nil {
+			t.Fatalf("error creating request. Err: %v", err)
+		}
+		if tt.authorization != "" {
+			req.Header.Set("Authorization", tt.authorization)
+		}
+		resp, err := s.Test(req)
+		if err != nil {
+			t.Fatalf("error making request to server. Err: %v", err)
+		}
+		if resp.StatusCode != tt.status {
+			t.Errorf("expected status %d with %q; got %d", tt.status, tt.authorization, resp.StatusCode)
+		}
+
+		if resp.StatusCode == fiber.StatusOK {
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("error reading response body. Err: %v", err)
+			}
+			// The rejected scrapes are counted too
+			expected := `finma_http_requests_total{method="GET",route="/metrics",status_class="4xx"} 2`
+			if !strings.Contains(string(body), expected) {
+				t.Errorf("expected the metrics to contain %s; got %s", expected, body)
+			}
+		}
+	}
+}
+
+func TestMetricsBusinessCounters(t *testing.T) {
+	m := newServerMetrics(nil)
+
+	m.countTransactionCreated(nil, &types.Transaction{Type: "expense"})
+	m.countTransactionCreated(nil, &types.Transaction{Type: "income", ExternalID: "tx-1", Source: "bank_sync"})
+	m.countTransactionCreated(nil, &types.Transaction{Type: "expense", ExternalID: "ynab:1f2e:1", Source: "import"})
+	m.countTransactionCreated(&types.Transaction{Type: "expense"}, &types.Transaction{Type: "expense"})
+	if got := m.transactionsCreated.Value("manual", "expense"); got != 1 {
+		t.Errorf("expected 1 manual expense; got %v", got)
+	}
+	if got := m.transactionsCreated.Value("bank_sync", "income"); got != 1 {
+		t.Errorf("expected 1 synced income; got %v", got)
+	}
+	if got := m.transactionsCreated.Value("import", "expense"); got != 1 {
+		t.Errorf("expected 1 imported expense; got %v", got)
+	}
+
+	m.countImport("ynab")
+	if got := m.imports.Value("ynab"); got != 1 {
+		t.Errorf("expected 1 YNAB import; got %v", got)
+	}
+
+	m.countBankSync("linked")
+	if got := m.bankSyncs.Value("linked"); got != 1 {
+		t.Errorf("expected 1 linked sync; got %v", got)
+	}
+
+	recorder := deliveryRecorder{DeliveryRecorder: &fakeDeliveryRecorder{}, deliveries: m.emailDeliveries}
+	for _, status := range []string{"queued", "sent", "queued", "failed"} {
+		if err := recorder.SaveEmailDelivery(&types.EmailDelivery{Status: status}); err != nil {
+			t.Fatalf("error recording the delivery. Err: %v", err)
+		}
+	}
+	if got := m.emailDeliveries.Value("sent"); got != 1 {
+		t.Errorf("expected 1 sent email; got %v", got)
+	}
+	if got := m.emailDeliveries.Value("failed"); got != 1 {
+		t.Errorf("expected 1 failed email; got %v", got)
+	}
+}
+
+type fakeDeliveryRecorder struct {
+	deliveries []types.EmailDelivery
+}
+
+func (r *fakeDeliveryRecorder) SaveEmailDelivery(delivery *types.EmailDelivery) error {
+	r.deliveries = append(r.deliveries, *delivery)
+	return nil
+}
@@ -17,50 +17,64 @@ func (s *FiberServer) Authorize(allowedRoles ...string) fiber.Handler {
 		authHeader := c.Get("Authorization")
 		if authHeader == "" {
 			log.Warn("Authorization header is missing")
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Unauthorized",
-			})
+			return NewAPIError(fiber.StatusUnauthorized, CodeUnauthorized, "Unauthorized")
 		}
 
 		auth := strings.Fields(authHeader)
+		if len(auth) == 2 && auth[0] == "Share" {
+			// A share link, read without an account
+			grantID, err := s.tokens.VerifyShareToken(auth[1])
+			if err != nil {
+				log.Warn("Invalid share token:", err)
+				return NewAPIError(fiber.StatusUnauthorized, CodeUnauthorized, "Unauthorized")
+			}
+			grant := s.db.GetShareGrantByID(grantID.String())
+			if grant.GranteeID != nil {
+				return NewAPIError(fiber.StatusUnauthorized, CodeUnauthorized, "Unauthorized")
+			}
+			return s.authorizeShare(c, grant, "link", allowedRoles)
+		}
 		if len(auth) != 2 || auth[0] != "Bearer" {
 			log.Warn("Invalid Authorization header")
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Unauthorized",
-			})
+			return NewAPIError(fiber.StatusUnauthorized, CodeUnauthorized, "Unauthorized")
 		}
 
 		// Check if the token is valid
 		token := auth[1]
-		payload, err := utils.VerifyAccessToken(token)
+		payload, err := s.tokens.VerifyAccessToken(token)
 		if err != nil {
 			if err.Error() == jwt.ErrTokenExpired().Error() {
 				log.Warn("Access token expired:", err)
-				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-					"error": "Token expired, please refresh",
-				})
+				return NewAPIError(fiber.StatusUnauthorized, CodeTokenExpired, "Token expired, please refresh")
 			}
 			log.Warn("Invalid access token:", err)
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Unauthorized",
-			})
+			return NewAPIError(fiber.StatusUnauthorized, CodeUnauthorized, "Unauthorized")
 		}
 
 		existingUser := s.db.GetUserByEmail(payload.Email)
 
 		if existingUser.ID == uuid.Nil {
 			log.Warn("User not found")
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Unauthorized",
-			})
+			return NewAPIError(fiber.StatusUnauthorized, CodeUnauthorized, "Unauthorized")
 		}
 
 		// Check if the user has the correct role
 		if !utils.HasRole(existingUser.Role, allowedRoles) {
-			log.Warnf("User %s does not have the required role", existingUser.Email)
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-				"error": "Forbidden: You do not have permission to access this resource",
-			})
+			log.Warnf("User %s does not have the required role", existingUser.ID)
+			return NewAPIError(fiber.StatusForbidden, CodeForbidden, "Forbidden: You do not have permission to access this resource")
+		}
+
+		if existingUser.IsDemo && deniedToDemo(c) {
+			return NewAPIError(fiber.StatusForbidden, CodeDemoRestricted, "This action is not available in the demo")
+		}
+
+		// Read the data of another user through a grant given to this one
+		if grantID := c.Get(shareGrantHeader); grantID != "" {
+			grant := s.db.GetShareGrantByID(grantID)
+			if grant.GranteeID == nil || *grant.GranteeID != existingUser.ID {
+				return NewAPIError(fiber.StatusForbidden, CodeForbidden, "The share is revoked or expired")
+			}
+			return s.authorizeShare(c, grant, existingUser.Email, allowedRoles)
 		}
 
 		// Store the user in the context
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"FinMa/constants"
+	"FinMa/internal/config"
+	"FinMa/internal/scheduler"
+	"FinMa/types"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// notificationCleanupBatch is the number of notifications deleted per statement.
+	notificationCleanupBatch = 1000
+	// notificationCleanupJob is the name of the job deleting the notifications.
+	notificationCleanupJob = "notification_cleanup"
+)
+
+// notificationCleanupStats is what the cleanup job did on this instance.
+type notificationCleanupStats struct {
+	LastRunAt    *time.Time `json:"last_run_at"`
+	LastDeleted  int64      `json:"last_deleted"`
+	LastError    string     `json:"last_error,omitempty"`
+	TotalDeleted int64      `json:"total_deleted"`
+	Runs         int64      `json:"runs"`
+	Skipped      int64      `json:"skipped"` // Runs skipped because another one was in progress
+}
+
+// notificationCleanupTracker counts the notifications deleted by the runs.
+// The scheduler keeps them from overlapping.
+type notificationCleanupTracker struct {
+	mu    sync.Mutex
+	stats notificationCleanupStats
+}
+
+func (t *notificationCleanupTracker) finish(at time.Time, deleted int64, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.stats.LastRunAt = &at
+	t.stats.LastDeleted = deleted
+	t.stats.TotalDeleted += deleted
+	t.stats.Runs++
+	t.stats.LastError = ""
+	if err != nil {
+		t.stats.LastError = err.Error()
+	}
+}
+
+func (t *notificationCleanupTracker) snapshot() notificationCleanupStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.stats
+}
+
+// notificationRetention returns the cutoffs of the retention policy at now.
+// Security notifications are kept the longest, read or not.
+func notificationRetention(now time.Time, cfg config.Features) types.NotificationRetention {
+	return types.NotificationRetention{
+		ReadBefore:     now.AddDate(0, 0, -cfg.NotificationReadRetentionDays),
+		UnreadBefore:   now.AddDate(0, 0, -cfg.NotificationUnreadRetentionDays),
+		SecurityBefore: now.AddDate(0, 0, -cfg.NotificationSecurityRetentionDays),
+		SecurityEvents: constants.GetSecurityNotificationEvents(),
+	}
+}
+
+// StartNotificationCleanup periodically deletes the notifications past
+// their retention, on one instance at a time.
+func (s *FiberServer) StartNotificationCleanup(interval time.Duration) {
+	s.jobs.Schedule(scheduler.Job{
+		Name:     notificationCleanupJob,
+		Schedule: scheduler.Every(interval),
+		Run:      s.cleanupNotifications,
+	})
+}
+
+// cleanupNotifications deletes the expired notifications in batches, until
+// none is left or ctx is canceled by the shutdown.
+func (s *FiberServer) cleanupNotifications(ctx context.Context, now time.Time) error {
+	db := s.db.WithContext(ctx)
+	retention := notificationRetention(now, s.config.Features)
+	var total int64
+	for {
+		deleted, err := db.DeleteExpiredNotifications(retention, notificationCleanupBatch)
+		total += deleted
+		if err != nil {
+			log.Error("Error deleting expired notifications: ", err)
+			s.notificationCleanup.finish(now, total, err)
+			return err
+		}
+		if deleted < notificationCleanupBatch {
+			break
+		}
+	}
+
+	if total > 0 {
+		log.Infof("Deleted %d expired notifications", total)
+	}
+	s.notificationCleanup.finish(now, total, nil)
+	return nil
+}
+
+// GetNotificationCleanup returns the retention policy and what the cleanup
+// job did on this instance. Admin only.
+func (s *FiberServer) GetNotificationCleanup(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"retention_days": fiber.Map{
+			"read":     s.config.Features.NotificationReadRetentionDays,
+			"unread":   s.config.Features.NotificationUnreadRetentionDays,
+			"security": s.config.Features.NotificationSecurityRetentionDays,
+		},
+		"stats": s.notificationCleanupStats(),
+	})
+}
+
+// notificationCleanupStats returns the stats of the cleanup, with the runs
+// the scheduler skipped.
+func (s *FiberServer) notificationCleanupStats() notificationCleanupStats {
+	stats := s.notificationCleanup.snapshot()
+	for _, job := range s.jobs.Status() {
+		if job.Name == notificationCleanupJob {
+			stats.Skipped = job.Skipped
+		}
+	}
+	return stats
+}
+
+// RunNotificationCleanup runs the cleanup job now and returns its stats. Admin only.
+func (s *FiberServer) RunNotificationCleanup(c *fiber.Ctx) error {
+	s.jobs.Do(notificationCleanupJob, time.Now(), s.cleanupNotifications)
+	return s.GetNotificationCleanup(c)
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"FinMa/internal/config"
+)
+
+func TestNotificationRetention(t *testing.T) {
+	now := time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)
+	cfg := config.Default().Features
+	retention := notificationRetention(now, cfg)
+
+	tests := []struct {
+		name     string
+		got      time.Time
+		expected time.Time
+	}{
+		{"read", retention.ReadBefore, now.AddDate(0, 0, -cfg.NotificationReadRetentionDays)},
+		{"unread", retention.UnreadBefore, now.AddDate(0, 0, -cfg.NotificationUnreadRetentionDays)},
+		{"security", retention.SecurityBefore, now.AddDate(0, 0, -cfg.NotificationSecurityRetentionDays)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !tt.got.Equal(tt.expected) {
+				t.Errorf("expected %v; got %v", tt.expected, tt.got)
+			}
+		})
+	}
+
+	if len(retention.SecurityEvents) == 0 || retention.SecurityEvents[0] != "new_device_login" {
+		t.Errorf("expected the security events; got %v", retention.SecurityEvents)
+	}
+	if !retention.SecurityBefore.Before(retention.ReadBefore) {
+		t.Errorf("expected security notifications to be kept longer than read ones")
+	}
+}
+
+func TestNotificationCleanupTracker(t *testing.T) {
+	var tracker notificationCleanupTracker
+	at := time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)
+
+	tracker.finish(at, 1500, nil)
+	tracker.finish(at.Add(time.Hour), 20, errors.New("connection reset"))
+
+	stats := tracker.snapshot()
+	if stats.Runs != 2 {
+		t.Errorf("expected 2 runs; got %d", stats.Runs)
+	}
+	if stats.TotalDeleted != 1520 || stats.LastDeleted != 20 {
+		t.Errorf("expected 1520 deleted in total, 20 last; got %d and %d", stats.TotalDeleted, stats.LastDeleted)
+	}
+	if stats.LastError != "connection reset" {
+		t.Errorf("expected the last error; got %q", stats.LastError)
+	}
+	if stats.LastRunAt == nil || !stats.LastRunAt.Equal(at.Add(time.Hour)) {
+		t.Errorf("expected the last run at %v; got %v", at.Add(time.Hour), stats.LastRunAt)
+	}
+}
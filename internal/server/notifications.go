@@ -0,0 +1,236 @@
+package server
+
+import (
+	"FinMa/constants"
+	"FinMa/internal/i18n"
+	"FinMa/internal/realtime"
+	"FinMa/types"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// Notifier delivers notifications on a channel other than the in-app one,
+// like email or push.
+type Notifier interface {
+	Send(ctx context.Context, user types.User, notification *types.Notification) error
+}
+
+// NotificationPayload is what a notification tells, whatever the channel.
+type NotificationPayload struct {
+	// Params fill the placeholders of the "notifications.<event>.message"
+	// of the catalogs, the message is written in the language of the user
+	Params i18n.Params
+	// Details are stored as the JSON payload of the notification, if set
+	Details any
+}
+
+// notificationTitle returns the title of the event in the locale, the
+// subject of the emails and the title of the pushes.
+func notificationTitle(locale, event string) string {
+	return i18n.For(locale, "").T("notifications."+event+".title", nil)
+}
+
+// isValidNotificationEvent reports whether users can be notified of event.
+func isValidNotificationEvent(event string) bool {
+	return slices.Contains(constants.GetNotificationEvents(), event)
+}
+
+// isSecurityNotificationEvent reports whether event is always sent by email.
+func isSecurityNotificationEvent(event string) bool {
+	return slices.Contains(constants.GetSecurityNotificationEvents(), event)
+}
+
+// defaultNotificationPreference returns the channels of an event for a user
+// who never changed them: in-app only, plus email for security events.
+func defaultNotificationPreference(userID uuid.UUID, event string) types.NotificationPreference {
+	return types.NotificationPreference{
+		UserID: userID,
+		Event:  event,
+		InApp:  true,
+		Email:  isSecurityNotificationEvent(event),
+	}
+}
+
+// enforceNotificationPreference turns the email channel of security events
+// back on and lists it as locked.
+func enforceNotificationPreference(preference types.NotificationPreference) types.NotificationPreference {
+	preference.Locked = nil
+	if isSecurityNotificationEvent(preference.Event) {
+		preference.Email = true
+		preference.Locked = []string{"email"}
+	}
+	return preference
+}
+
+// mergeNotificationPreferences returns the preferences of every event, in
+// the order of the events, the defaults filling the ones never stored.
+func mergeNotificationPreferences(userID uuid.UUID, stored []types.NotificationPreference) []types.NotificationPreference {
+	byEvent := make(map[string]types.NotificationPreference, len(stored))
+	for _, preference := range stored {
+		byEvent[preference.Event] = preference
+	}
+
+	events := constants.GetNotificationEvents()
+	preferences := make([]types.NotificationPreference, 0, len(events))
+	for _, event := range events {
+		preference, ok := byEvent[event]
+		if !ok {
+			preference = defaultNotificationPreference(userID, event)
+		}
+		preferences = append(preferences, enforceNotificationPreference(preference))
+	}
+	return preferences
+}
+
+// Notify is the single entry point creating notifications. It delivers the
+// payload of the event on the channels the user enabled for it: the in-app
+// notification is stored, email and push are handed to their notifier when
+// one is configured. In-app notifications are pushed to the websocket
+// connections of the user too. The message is written once, in the language
+// of the user. Every channel is tried, the errors are joined.
+func (s *FiberServer) Notify(ctx context.Context, userID uuid.UUID, event string, payload NotificationPayload) error {
+	user := s.db.GetUserByID(userID)
+	notification, err := newNotification(s.localizer(user), userID, event, payload)
+	if err != nil {
+		return err
+	}
+	return s.dispatch(ctx, user, notification)
+}
+
+// newNotification writes the notification of the event for the user, its
+// message in the language of the localizer.
+func newNotification(localizer i18n.Localizer, userID uuid.UUID, event string, payload NotificationPayload) (*types.Notification, error) {
+	if !isValidNotificationEvent(event) {
+		return nil, fmt.Errorf("unknown notification event %q", event)
+	}
+
+	notification := &types.Notification{
+		ID:       uuid.New(),
+		Type:     event,
+		Message:  localizer.T("notifications."+event+".message", payload.Params),
+		IsActive: true,
+		UserID:   userID,
+	}
+	if payload.Details != nil {
+		details, err := json.Marshal(payload.Details)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s notification payload: %w", event, err)
+		}
+		notification.Payload = details
+	}
+	return notification, nil
+}
+
+// dispatch delivers the notification on the channels the user enabled for
+// its event.
+func (s *FiberServer) dispatch(ctx context.Context, user types.User, notification *types.Notification) error {
+	event := notification.Type
+	preference, ok := s.db.GetNotificationPreference(user.ID, event)
+	if !ok {
+		preference = defaultNotificationPreference(user.ID, event)
+	}
+	preference = enforceNotificationPreference(preference)
+
+	var errs []error
+	if preference.InApp {
+		if err := s.db.CreateNotification(notification); err != nil {
+			errs = append(errs, fmt.Errorf("failed to create %s notification: %w", event, err))
+		} else {
+			s.hub.Publish(user.ID, realtime.Event{Type: "notification", Data: notification})
+		}
+	}
+
+	// The demo users are only notified in the app, nothing leaves the
+	// instance for them
+	channels := []struct {
+		name    string
+		enabled bool
+	}{{"email", preference.Email && !user.IsDemo}, {"push", preference.Push && !user.IsDemo}}
+
+	for _, channel := range channels {
+		notifier, ok := s.notifiers[channel.name]
+		if !channel.enabled || !ok {
+			continue
+		}
+		if err := notifier.Send(ctx, user, notification); err != nil {
+			errs = append(errs, fmt.Errorf("failed to send %s notification by %s: %w", event, channel.name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// notificationDispatcher is the Notifier of the handlers: it delivers the
+// notifications on every channel of the server, like Notify.
+type notificationDispatcher struct {
+	s *FiberServer
+}
+
+func (d notificationDispatcher) Send(ctx context.Context, user types.User, notification *types.Notification) error {
+	return d.s.dispatch(ctx, user, notification)
+}
+
+// GetNotificationPreferences lists the channels of every event for the user.
+// locked lists the channels that cannot be turned off.
+func (s *FiberServer) GetNotificationPreferences(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	return c.JSON(mergeNotificationPreferences(user.ID, s.db.GetNotificationPreferences(user.ID)))
+}
+
+// UpdateNotificationPreferences replaces the channels of the listed events,
+// the others are left unchanged. Turning off the email channel of a
+// security event is refused.
+func (s *FiberServer) UpdateNotificationPreferences(c *fiber.Ctx) error {
+	type NotificationPreferenceRequest struct {
+		Event string `json:"event"`
+		InApp bool   `json:"in_app"`
+		Email bool   `json:"email"`
+		Push  bool   `json:"push"`
+	}
+
+	var body []NotificationPreferenceRequest
+	if err := c.BodyParser(&body); err != nil || len(body) == 0 {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+
+	user := c.Locals("user").(types.User)
+	now := time.Now()
+	preferences := make([]types.NotificationPreference, 0, len(body))
+	seen := make(map[string]bool, len(body))
+	for _, item := range body {
+		if !isValidNotificationEvent(item.Event) || seen[item.Event] {
+			return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid or duplicate notification event").
+				WithDetails(FieldError{Field: "event", Message: "Invalid or duplicate event", Value: item.Event})
+		}
+		seen[item.Event] = true
+
+		if isSecurityNotificationEvent(item.Event) && !item.Email {
+			return NewAPIError(fiber.StatusUnprocessableEntity, CodeUnprocessable, "Email notifications cannot be turned off for security events").
+				WithDetails(FieldError{Field: "email", Message: "Must stay on for security events", Value: item.Event})
+		}
+
+		preferences = append(preferences, types.NotificationPreference{
+			UserID:    user.ID,
+			Event:     item.Event,
+			InApp:     item.InApp,
+			Email:     item.Email,
+			Push:      item.Push,
+			UpdatedAt: now,
+		})
+	}
+
+	if err := s.db.SaveNotificationPreferences(preferences); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not update notification preferences")
+	}
+
+	return c.JSON(mergeNotificationPreferences(user.ID, s.db.GetNotificationPreferences(user.ID)))
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"FinMa/constants"
+	"FinMa/types"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestMergeNotificationPreferences(t *testing.T) {
+	userID := uuid.New()
+	stored := []types.NotificationPreference{
+		{UserID: userID, Event: "large_transaction", InApp: false, Email: true, Push: true},
+		// Stored before the email channel of security events was locked
+		{UserID: userID, Event: "new_device_login", InApp: false, Email: false},
+	}
+
+	preferences := mergeNotificationPreferences(userID, stored)
+	events := constants.GetNotificationEvents()
+	if len(preferences) != len(events) {
+		t.Fatalf("expected %d preferences; got %d", len(events), len(preferences))
+	}
+
+	byEvent := make(map[string]types.NotificationPreference)
+	for i, preference := range preferences {
+		if preference.Event != events[i] {
+			t.Errorf("expected event %q at %d; got %q", events[i], i, preference.Event)
+		}
+		byEvent[preference.Event] = preference
+	}
+
+	if p := byEvent["budget_exceeded"]; !p.InApp || p.Email || p.Push || len(p.Locked) != 0 {
+		t.Errorf("expected in-app only default for budget_exceeded; got %+v", p)
+	}
+	if p := byEvent["large_transaction"]; p.InApp || !p.Email || !p.Push {
+		t.Errorf("expected stored channels for large_transaction; got %+v", p)
+	}
+	if p := byEvent["new_device_login"]; !p.Email || p.InApp || len(p.Locked) != 1 || p.Locked[0] != "email" {
+		t.Errorf("expected locked email channel for new_device_login; got %+v", p)
+	}
+}
+
+func TestDefaultNotificationPreference(t *testing.T) {
+	tests := []struct {
+		event         string
+		expectedEmail bool
+	}{
+		{"budget_threshold", false},
+		{"weekly_digest", false},
+		{"new_device_login", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.event, func(t *testing.T) {
+			preference := defaultNotificationPreference(uuid.New(), tt.event)
+			if !preference.InApp || preference.Email != tt.expectedEmail || preference.Push {
+				t.Errorf("expected in-app with email %v; got %+v", tt.expectedEmail, preference)
+			}
+		})
+	}
+}
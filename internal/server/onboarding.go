@@ -0,0 +1,213 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/constants"
+	"FinMa/internal/database"
+	"FinMa/internal/fx"
+	"FinMa/internal/importers"
+	"FinMa/types"
+)
+
+// onboardingResponse is the starter data created, the budgets with their
+// current period.
+type onboardingResponse struct {
+	types.Onboarding
+	Budgets []budgetResponse `json:"budgets"`
+}
+
+// Onboard provisions the starter data of a new user from their answers to
+// the first-run questions: their currency, their accounts with their
+// current balance, their monthly income estimate, a monthly budget per
+// category picked and the example bills they kept. The whole payload is
+// validated first and everything is created in one transaction, or
+// nothing. A user who already has data gets a 409.
+func (s *FiberServer) Onboard(c *fiber.Ctx) error {
+	type OnboardingAccount struct {
+		Name        string      `json:"name"`
+		AccountType string      `json:"account_type"` // Guessed from the name by default
+		Balance     types.Money `json:"balance"`
+	}
+	type OnboardingBudget struct {
+		Category string      `json:"category"`
+		Amount   types.Money `json:"amount"`
+	}
+	type OnboardingBill struct {
+		Name     string      `json:"name"`
+		Amount   types.Money `json:"amount"`
+		DueDay   int         `json:"due_day"`
+		Category string      `json:"category"`
+		Account  string      `json:"account"` // Name of one of the accounts the bill is paid from, if any
+	}
+	type OnboardingRequest struct {
+		Currency      string              `json:"currency"`
+		Accounts      []OnboardingAccount `json:"accounts"`
+		MonthlyIncome *types.Money        `json:"monthly_income"`
+		Budgets       []OnboardingBudget  `json:"budgets"`
+		Bills         []OnboardingBill    `json:"bills"`
+	}
+
+	var body OnboardingRequest
+	if err := c.BodyParser(&body); err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+
+	user := c.Locals("user").(types.User)
+	onboarding := &types.Onboarding{Currency: strings.ToUpper(strings.TrimSpace(body.Currency))}
+	var invalid []FieldError
+
+	switch {
+	case onboarding.Currency == "":
+		invalid = append(invalid, FieldError{Field: "currency", Message: "Required"})
+	case !fx.IsCurrencyCode(onboarding.Currency):
+		invalid = append(invalid, FieldError{Field: "currency", Message: "Must be an ISO 4217 code", Value: body.Currency})
+	}
+
+	if len(body.Accounts) == 0 {
+		invalid = append(invalid, FieldError{Field: "accounts", Message: "Required"})
+	}
+	accounts := map[string]uuid.UUID{}
+	for i, item := range body.Accounts {
+		field := fmt.Sprintf("accounts[%d]", i)
+		name := strings.TrimSpace(item.Name)
+		if name == "" {
+			invalid = append(invalid, FieldError{Field: field + ".name", Message: "Required"})
+		} else if _, ok := accounts[strings.ToLower(name)]; ok {
+			invalid = append(invalid, FieldError{Field: field + ".name", Message: "Must be unique", Value: item.Name})
+		}
+		accountType := item.AccountType
+		if accountType == "" {
+			accountType = importers.AccountType(name)
+		}
+		if !isValidAccountType(accountType) {
+			invalid = append(invalid, FieldError{Field: field + ".account_type", Message: "Must be one of " + strings.Join(constants.GetAccountTypes(), ", "), Value: item.AccountType})
+		}
+		if _, err := item.Balance.In(onboarding.Currency); err != nil && fx.IsCurrencyCode(onboarding.Currency) {
+			invalid = append(invalid, FieldError{Field: field + ".balance", Message: "Must not be finer than the minor unit of " + onboarding.Currency, Value: item.Balance})
+		}
+
+		account := types.BankAccount{
+			ID:             uuid.New(),
+			BankName:       name,
+			AccountType:    accountType,
+			AccountNumber:  "onboarding-" + uuid.NewString(),
+			Balance:        item.Balance,
+			InitialBalance: item.Balance,
+			Currency:       onboarding.Currency,
+			Class:          accountClass(accountType),
+			UserID:         user.ID,
+		}
+		accounts[strings.ToLower(name)] = account.ID
+		onboarding.Accounts = append(onboarding.Accounts, account)
+	}
+
+	if body.MonthlyIncome == nil {
+		invalid = append(invalid, FieldError{Field: "monthly_income", Message: "Required"})
+	} else if body.MonthlyIncome.Sign() < 0 {
+		invalid = append(invalid, FieldError{Field: "monthly_income", Message: "Must not be negative", Value: *body.MonthlyIncome})
+	} else {
+		onboarding.MonthlyIncome = body.MonthlyIncome.Unbound()
+	}
+
+	month := monthStart(time.Now(), userLocation(user))
+	budgeted := map[string]bool{}
+	for i, item := range body.Budgets {
+		field := fmt.Sprintf("budgets[%d]", i)
+		switch {
+		case !isValidCategory(item.Category):
+			invalid = append(invalid, FieldError{Field: field + ".category", Message: "Must be one of " + strings.Join(constants.GetTransactionCategories(), ", "), Value: item.Category})
+		case budgeted[item.Category]:
+			invalid = append(invalid, FieldError{Field: field + ".category", Message: "Must be unique", Value: item.Category})
+		}
+		budgeted[item.Category] = true
+		if item.Amount.Sign() <= 0 {
+			invalid = append(invalid, FieldError{Field: field + ".amount", Message: "Must be positive", Value: item.Amount})
+		}
+
+		onboarding.Budgets = append(onboarding.Budgets, types.Budget{
+			ID:              uuid.New(),
+			Categories:      []types.BudgetCategory{{Category: item.Category}},
+			Amount:          item.Amount.Unbound(),
+			StartDate:       month,
+			PeriodType:      "monthly",
+			AlertThresholds: constants.GetBudgetAlertThresholds(),
+			UserID:          user.ID,
+		})
+		onboarding.Unbudgeted = types.NewMoney(onboarding.Unbudgeted.Minor-item.Amount.Unbound().Minor, "")
+	}
+	onboarding.Unbudgeted = types.NewMoney(onboarding.Unbudgeted.Minor+onboarding.MonthlyIncome.Minor, "")
+
+	for i, item := range body.Bills {
+		field := fmt.Sprintf("bills[%d]", i)
+		name := strings.TrimSpace(item.Name)
+		if name == "" {
+			invalid = append(invalid, FieldError{Field: field + ".name", Message: "Required"})
+		}
+		if item.Amount.Sign() <= 0 {
+			invalid = append(invalid, FieldError{Field: field + ".amount", Message: "Must be positive", Value: item.Amount})
+		}
+		if item.DueDay < 1 || item.DueDay > 31 {
+			invalid = append(invalid, FieldError{Field: field + ".due_day", Message: "Must be between 1 and 31", Value: item.DueDay})
+		}
+		if item.Category != "" && !isValidCategory(item.Category) {
+			invalid = append(invalid, FieldError{Field: field + ".category", Message: "Must be one of " + strings.Join(constants.GetTransactionCategories(), ", "), Value: item.Category})
+		}
+
+		bill := types.Bill{
+			ID:           uuid.New(),
+			Name:         name,
+			Amount:       item.Amount.Unbound(),
+			DueDay:       item.DueDay,
+			Tolerance:    5,
+			Category:     item.Category,
+			ReminderDays: 3,
+			UserID:       user.ID,
+		}
+		if item.Account != "" {
+			accountID, ok := accounts[strings.ToLower(strings.TrimSpace(item.Account))]
+			if !ok {
+				invalid = append(invalid, FieldError{Field: field + ".account", Message: "Must be the name of one of the accounts", Value: item.Account})
+			}
+			bill.BankAccountID = &accountID
+		}
+		onboarding.Bills = append(onboarding.Bills, bill)
+	}
+
+	if len(invalid) > 0 {
+		return NewAPIError(fiber.StatusUnprocessableEntity, CodeValidationFailed, "Invalid onboarding").WithDetails(invalid...)
+	}
+	if err := s.checkLimit(c, user, limitAccounts, int64(len(onboarding.Accounts))); err != nil {
+		return err
+	}
+
+	if err := s.db.Onboard(&user, onboarding); err != nil {
+		if errors.Is(err, database.ErrUserHasData) {
+			return NewAPIError(fiber.StatusConflict, CodeConflict, "Onboarding is only for users without data")
+		}
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not create the starter data")
+	}
+	for _, account := range onboarding.Accounts {
+		s.audit(user.ID, "account.created", "bank_account", account.ID, account.BankName)
+	}
+
+	response := onboardingResponse{Onboarding: *onboarding, Budgets: make([]budgetResponse, 0, len(onboarding.Budgets))}
+	for _, budget := range onboarding.Budgets {
+		budgetResponse, err := s.buildBudgetResponse(user, budget, time.Now())
+		if err != nil {
+			log.Error(err)
+			return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not compute budget period")
+		}
+		response.Budgets = append(response.Budgets, budgetResponse)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/internal/database"
+	"FinMa/types"
+)
+
+// onboardingDB records the onboarding, refusing a second one like the
+// check of the user having data does.
+type onboardingDB struct {
+	*adminDB
+	onboarding *types.Onboarding
+}
+
+func (db *onboardingDB) Onboard(user *types.User, onboarding *types.Onboarding) error {
+	if db.onboarding != nil {
+		return database.ErrUserHasData
+	}
+	db.onboarding = onboarding
+	return nil
+}
+
+func (db *onboardingDB) GetLatestClosedBudgetPeriods(budgetIDs []uuid.UUID) (map[uuid.UUID]types.ClosedBudgetPeriod, error) {
+	return map[uuid.UUID]types.ClosedBudgetPeriod{}, nil
+}
+
+func (db *onboardingDB) GetBudgetsSpent(periods []types.BudgetPeriodRange) ([]types.Money, error) {
+	return make([]types.Money, len(periods)), nil
+}
+
+const onboardingBody = `{"currency":"eur","monthly_income":2500,
+	"accounts":[{"name":"Checking","balance":"1200.50"},{"name":"Livret A savings","balance":"3000"}],
+	"budgets":[{"category":"food","amount":400},{"category":"transport","amount":150}],
+	"bills":[{"name":"Rent","amount":900,"due_day":5,"category":"bills","account":"checking"}]}`
+
+func TestOnboard(t *testing.T) {
+	s, admin, _, user := newAdminTestServer(t)
+	db := &onboardingDB{adminDB: admin}
+	s.db = db
+
+	resp := adminRequest(t, s, user, "POST", "/api/v1/onboarding", `{"currency":"euro","monthly_income":-1,
+		"accounts":[{"name":"Checking","balance":"12.345"},{"name":"checking","account_type":"piggy"}],
+		"budgets":[{"category":"food","amount":0},{"category":"food","amount":10}],
+		"bills":[{"name":"","amount":900,"due_day":40,"account":"Savings"}]}`)
+	if resp.StatusCode != fiber.StatusUnprocessableEntity {
+		t.Fatalf("expected status 422; got %d", resp.StatusCode)
+	}
+	var body errorBody
+	json.NewDecoder(resp.Body).Decode(&body)
+	fields := map[string]bool{}
+	for _, detail := range body.Error.Details {
+		fields[detail.Field] = true
+	}
+	for _, field := range []string{"currency", "monthly_income", "accounts[1].name", "accounts[1].account_type",
+		"budgets[0].amount", "budgets[1].category", "bills[0].name", "bills[0].due_day", "bills[0].account"} {
+		if !fields[field] {
+			t.Errorf("expected %s refused; got %+v", field, body.Error.Details)
+		}
+	}
+	if db.onboarding != nil {
+		t.Fatal("expected nothing created for an invalid payload")
+	}
+
+	resp = adminRequest(t, s, user, "POST", "/api/v1/onboarding", onboardingBody)
+	if resp.StatusCode != fiber.StatusCreated {
+		t.Fatalf("expected status 201; got %d", resp.StatusCode)
+	}
+	var created struct {
+		Accounts   []types.BankAccount `json:"accounts"`
+		Budgets    []budgetResponse    `json:"budgets"`
+		Bills      []types.Bill        `json:"bills"`
+		Unbudgeted types.Money         `json:"unbudgeted"`
+	}
+	json.NewDecoder(resp.Body).Decode(&created)
+
+	if len(created.Accounts) != 2 || created.Accounts[0].Balance.String() != "1200.50" || created.Accounts[0].Currency != "EUR" ||
+		created.Accounts[1].AccountType != "savings" || db.onboarding.Currency != "EUR" {
+		t.Errorf("unexpected accounts: %+v", created.Accounts)
+	}
+	if len(created.Budgets) != 2 || created.Budgets[1].Categories[0] != "transport" || created.Budgets[1].PeriodType != "monthly" ||
+		created.Budgets[1].CurrentPeriodStart == nil {
+		t.Errorf("unexpected budgets: %+v", created.Budgets)
+	}
+	if len(created.Bills) != 1 || created.Bills[0].BankAccountID == nil || *created.Bills[0].BankAccountID != created.Accounts[0].ID {
+		t.Errorf("expected the rent paid from the checking account; got %+v", created.Bills)
+	}
+	if created.Unbudgeted != money(1950) {
+		t.Errorf("expected 1950 left to budget; got %v", created.Unbudgeted)
+	}
+
+	resp = adminRequest(t, s, user, "POST", "/api/v1/onboarding", onboardingBody)
+	if resp.StatusCode != fiber.StatusConflict {
+		t.Errorf("expected status 409 for a user with data; got %d", resp.StatusCode)
+	}
+}
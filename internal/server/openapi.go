@@ -0,0 +1,259 @@
+package server
+
+import (
+	_ "embed"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"FinMa/internal/fx"
+	"FinMa/types"
+)
+
+// openAPIDocument is the hand-maintained OpenAPI document: the paths, the
+// request bodies and the security schemes. The schemas of the models are
+// generated from their types and added when the document is served.
+//
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// openAPIModels are the types whose schemas are generated, with the types
+// they reference, named after the type.
+var openAPIModels = []any{
+	types.User{},
+	types.BankAccount{},
+	types.AccountTransactionsMeta{},
+	types.AccountMember{},
+	types.BalancePoint{},
+	types.BalanceDrift{},
+	types.AdminStats{},
+	types.BalanceProjection{},
+	types.StatementCycle{},
+	types.InterestRate{},
+	types.ExchangeRate{},
+	fx.Rate{},
+	types.Household{},
+	types.HouseholdMember{},
+	types.Reconciliation{},
+	types.BankConnection{},
+	types.Transaction{},
+	types.ImportSummary{},
+	types.ActivityPage{},
+	onboardingResponse{},
+	types.RestoreSummary{},
+	types.PlanUsage{},
+	types.BillingStatus{},
+	types.SettingsExport{},
+	types.SettingsImportResult{},
+	syncResponse{},
+	syncPushResponse{},
+	types.PrivacyRequest{},
+	types.ShareGrant{},
+	types.CategorySetting{},
+	types.TaxSetting{},
+	types.Budget{},
+	budgetResponse{},
+	types.BudgetProgress{},
+	types.BudgetForecast{},
+	types.ClosedBudgetPeriod{},
+	types.BudgetTemplate{},
+	types.BudgetApplyResult{},
+	types.BudgetVsActualPeriod{},
+	types.Allocation{},
+	types.AllocationPool{},
+	types.AllocationRule{},
+	types.AllocationPreview{},
+	types.GoalProgress{},
+	types.GoalContribution{},
+	types.Bill{},
+	types.BillOccurrence{},
+	types.Subscription{},
+	types.SubscriptionCandidate{},
+	types.NotificationPreference{},
+	types.PushSubscription{},
+	types.SpendingPatterns{},
+	types.NetWorth{},
+	types.CashFlow{},
+	types.YearOverYear{},
+	types.CategoryTrend{},
+	types.MerchantReport{},
+	types.Flows{},
+	types.BalanceForecast{},
+	types.TaxReport{},
+	types.HealthMetricsReport{},
+	types.Heatmap{},
+	types.ReportDefinition{},
+	types.CustomReport{},
+	types.ReportSchedule{},
+	types.ReportDelivery{},
+	errorBody{},
+}
+
+// openAPISpec returns the document served, built once.
+var openAPISpec = sync.OnceValues(buildOpenAPISpec)
+
+// buildOpenAPISpec adds the schemas of the models to the document.
+func buildOpenAPISpec() ([]byte, error) {
+	var document map[string]any
+	if err := json.Unmarshal(openAPIDocument, &document); err != nil {
+		return nil, err
+	}
+
+	components := document["components"].(map[string]any)
+	schemas := components["schemas"].(map[string]any)
+	builder := schemaBuilder{schemas: schemas}
+	for _, model := range openAPIModels {
+		builder.component(reflect.TypeOf(model))
+	}
+
+	return json.Marshal(document)
+}
+
+// schemaBuilder generates the schemas of Go types from their JSON encoding.
+type schemaBuilder struct {
+	schemas map[string]any
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	uuidType      = reflect.TypeOf(uuid.UUID{})
+	deletedAtType = reflect.TypeOf(gorm.DeletedAt{})
+	rawJSONType   = reflect.TypeOf(json.RawMessage{})
+	moneyType     = reflect.TypeOf(types.Money{})
+)
+
+// schemaName is the name of the component of a struct type.
+func schemaName(t reflect.Type) string {
+	return strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+}
+
+// component adds the schema of the struct type to the components, unless
+// it is already there, and returns its name.
+func (b schemaBuilder) component(t reflect.Type) string {
+	name := schemaName(t)
+	if _, ok := b.schemas[name]; ok {
+		return name
+	}
+
+	// Reserve the name first, the types may reference each other
+	b.schemas[name] = nil
+	properties := map[string]any{}
+	b.addProperties(t, properties)
+	b.schemas[name] = map[string]any{"type": "object", "properties": properties}
+	return name
+}
+
+// addProperties adds the JSON fields of the struct type, the fields of the
+// embedded structs are inlined as encoding/json does.
+func (b schemaBuilder) addProperties(t reflect.Type, properties map[string]any) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			b.addProperties(field.Type, properties)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = b.schema(field.Type)
+	}
+}
+
+// schema returns the schema of a type, the structs are referenced.
+func (b schemaBuilder) schema(t reflect.Type) map[string]any {
+	nullable := false
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+		nullable = true
+	}
+
+	var schema map[string]any
+	switch {
+	case t == timeType:
+		schema = map[string]any{"type": "string", "format": "date-time"}
+	case t == uuidType:
+		schema = map[string]any{"type": "string", "format": "uuid"}
+	case t == deletedAtType:
+		schema = map[string]any{"type": "string", "format": "date-time"}
+		nullable = true
+	case t == rawJSONType:
+		schema = map[string]any{"type": "object"}
+	case t == moneyType:
+		schema = map[string]any{"type": "string", "format": "decimal", "example": "12.34"}
+	default:
+		switch t.Kind() {
+		case reflect.Bool:
+			schema = map[string]any{"type": "boolean"}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			schema = map[string]any{"type": "integer"}
+		case reflect.Float32, reflect.Float64:
+			schema = map[string]any{"type": "number"}
+		case reflect.String:
+			schema = map[string]any{"type": "string"}
+		case reflect.Slice, reflect.Array:
+			schema = map[string]any{"type": "array", "items": b.schema(t.Elem())}
+		case reflect.Map:
+			schema = map[string]any{"type": "object", "additionalProperties": b.schema(t.Elem())}
+		case reflect.Struct:
+			ref := map[string]any{"$ref": "#/components/schemas/" + b.component(t)}
+			if nullable {
+				return map[string]any{"allOf": []any{ref}, "nullable": true}
+			}
+			return ref
+		default:
+			schema = map[string]any{}
+		}
+	}
+
+	if nullable {
+		schema["nullable"] = true
+	}
+	return schema
+}
+
+// apiDocsPage is the Swagger UI of the document, loaded from a CDN.
+const apiDocsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>FinMa API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({ url: "openapi.json", dom_id: "#swagger-ui" });
+  </script>
+</body>
+</html>
+`
+
+// GetOpenAPISpec serves the OpenAPI document of the API.
+func (s *FiberServer) GetOpenAPISpec(c *fiber.Ctx) error {
+	spec, err := openAPISpec()
+	if err != nil {
+		return err
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Send(spec)
+}
+
+// GetAPIDocs serves the Swagger UI of the OpenAPI document, registered when
+// API_DOCS_ENABLED is on.
+func (s *FiberServer) GetAPIDocs(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	return c.SendString(apiDocsPage)
+}
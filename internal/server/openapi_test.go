@@ -0,0 +1,157 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+
+	"FinMa/internal/config"
+)
+
+// documentedOperations lists the "METHOD /path" of the document, with the
+// path parameters as in Fiber (/accounts/:id).
+func documentedOperations(t *testing.T) []string {
+	var document struct {
+		Paths map[string]map[string]any `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPIDocument, &document); err != nil {
+		t.Fatalf("error decoding the OpenAPI document. Err: %v", err)
+	}
+
+	parameter := regexp.MustCompile(`\{(\w+)\}`)
+	operations := []string{}
+	for path, methods := range document.Paths {
+		for method := range methods {
+			operations = append(operations, strings.ToUpper(method)+" "+parameter.ReplaceAllString(path, ":$1"))
+		}
+	}
+	sort.Strings(operations)
+	return operations
+}
+
+func newOpenAPITestServer(t *testing.T) *FiberServer {
+	cfg := config.Default()
+	cfg.Server.APIDocs = true
+	s := &FiberServer{App: fiber.New(fiber.Config{ErrorHandler: errorHandler}), config: cfg}
+	// The handlers reached without authentication have no database
+	s.Use(recover.New())
+	s.RegisterFiberRoutes()
+	return s
+}
+
+func TestOpenAPIDocumentMatchesRoutes(t *testing.T) {
+	s := newOpenAPITestServer(t)
+
+	registered := map[string]bool{}
+	for _, route := range s.GetRoutes(true) {
+		if route.Method == fiber.MethodHead || !isCurrentAPIPath(strings.TrimSuffix(route.Path, "/")) {
+			continue
+		}
+		path := strings.TrimPrefix(route.Path, APIPrefix)
+		if path == "" {
+			path = "/"
+		}
+		registered[route.Method+" "+path] = true
+	}
+
+	documented := map[string]bool{}
+	for _, operation := range documentedOperations(t) {
+		documented[operation] = true
+		if !registered[operation] {
+			t.Errorf("%s is documented but not registered", operation)
+		}
+	}
+	for operation := range registered {
+		if !documented[operation] {
+			t.Errorf("%s is registered but not documented", operation)
+		}
+	}
+}
+
+func TestOpenAPIDocumentedRoutesRespond(t *testing.T) {
+	s := newOpenAPITestServer(t)
+
+	for _, operation := range documentedOperations(t) {
+		method, path, _ := strings.Cut(operation, " ")
+		path = regexp.MustCompile(`:\w+`).ReplaceAllString(path, "2f9c1e4a-7b3d-4c8e-9a6f-5d2b1c0e8f74")
+
+		req, err := http.NewRequest(method, APIPrefix+path, nil)
+		if err != nil {
+			t.Fatalf("error creating request. Err: %v", err)
+		}
+		resp, err := s.Test(req)
+		if err != nil {
+			t.Fatalf("error making request to server. Err: %v", err)
+		}
+		if resp.StatusCode == fiber.StatusNotFound || resp.StatusCode == fiber.StatusMethodNotAllowed {
+			// Not found answered by a handler, for an unknown ID, has a message naming the resource
+			var body errorBody
+			_ = json.NewDecoder(resp.Body).Decode(&body)
+			if strings.HasPrefix(body.Error.Message, "Cannot ") || resp.StatusCode == fiber.StatusMethodNotAllowed {
+				t.Errorf("expected %s to be routed; got %d", operation, resp.StatusCode)
+			}
+		}
+	}
+}
+
+func TestOpenAPIReferencesResolve(t *testing.T) {
+	spec, err := openAPISpec()
+	if err != nil {
+		t.Fatalf("error building the OpenAPI document. Err: %v", err)
+	}
+
+	var document map[string]any
+	if err := json.Unmarshal(spec, &document); err != nil {
+		t.Fatalf("error decoding the OpenAPI document. Err: %v", err)
+	}
+	components := document["components"].(map[string]any)
+
+	var walk func(value any)
+	walk = func(value any) {
+		switch v := value.(type) {
+		case map[string]any:
+			if ref, ok := v["$ref"].(string); ok {
+				parts := strings.Split(strings.TrimPrefix(ref, "#/components/"), "/")
+				section, _ := components[parts[0]].(map[string]any)
+				if len(parts) != 2 || section[parts[1]] == nil {
+					t.Errorf("unresolved reference %s", ref)
+				}
+			}
+			for _, child := range v {
+				walk(child)
+			}
+		case []any:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(document)
+}
+
+func TestSchemaBuilder(t *testing.T) {
+	schemas := map[string]any{}
+	builder := schemaBuilder{schemas: schemas}
+	builder.component(reflect.TypeOf(budgetResponse{}))
+
+	budget := schemas["BudgetResponse"].(map[string]any)["properties"].(map[string]any)
+	if _, ok := budget["amount"]; !ok {
+		t.Errorf("expected the fields of the embedded budget; got %v", budget)
+	}
+	if categories := budget["categories"].(map[string]any); categories["type"] != "array" {
+		t.Errorf("expected the categories of the response to override the hidden ones; got %v", categories)
+	}
+	if end := budget["current_period_end"].(map[string]any); end["format"] != "date-time" || end["nullable"] != true {
+		t.Errorf("expected a nullable date-time; got %v", end)
+	}
+	if _, ok := schemas["User"]; !ok {
+		t.Errorf("expected the referenced user schema to be generated")
+	}
+}
@@ -0,0 +1,230 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+
+	"FinMa/internal/config"
+	"FinMa/types"
+)
+
+// Names of the limits of the plans, in the overrides of the users and the
+// details of the limit_exceeded errors.
+const (
+	limitAccounts            = "accounts"
+	limitMonthlyTransactions = "monthly_transactions"
+)
+
+var limitNames = []string{limitAccounts, limitMonthlyTransactions}
+
+// userPlan returns the plan of the user, the default plan when they have
+// none.
+func (s *FiberServer) userPlan(user types.User) string {
+	if user.Plan == "" {
+		return s.config.Plans.Default
+	}
+	return user.Plan
+}
+
+// planLimits returns the limits of the plan of the user, with the overrides
+// an admin set for them.
+func (s *FiberServer) planLimits(user types.User) types.PlanLimits {
+	accounts, monthlyTransactions := s.config.Plans.Limits(s.userPlan(user))
+	limits := types.PlanLimits{Accounts: accounts, MonthlyTransactions: monthlyTransactions}
+	if limit, ok := user.LimitOverrides[limitAccounts]; ok {
+		limits.Accounts = limit
+	}
+	if limit, ok := user.LimitOverrides[limitMonthlyTransactions]; ok {
+		limits.MonthlyTransactions = limit
+	}
+	return limits
+}
+
+// usagePeriod returns the start of the current month of the user, which the
+// monthly limits count from, and its name.
+func usagePeriod(user types.User) (time.Time, string) {
+	start := monthStart(time.Now(), userLocation(user))
+	return start, start.Format("2006-01")
+}
+
+// usage counts what the user uses of the limits of their plan. The counts
+// are kept in the cache of the user, dropped with it when their data
+// changes, so that the create endpoints do not count the rows of the user
+// on every request.
+func (s *FiberServer) usage(c *fiber.Ctx, user types.User) (types.Usage, string, error) {
+	since, period := usagePeriod(user)
+	if s.cache == nil {
+		usage, err := s.db.GetUsage(user.ID, since)
+		return usage, period, err
+	}
+
+	ctx := c.UserContext()
+	key, err := s.cacheKey(ctx, user, "usage", []string{period})
+	if err == nil {
+		var body []byte
+		var hit bool
+		if body, hit, err = s.cache.Get(ctx, key); hit {
+			var usage types.Usage
+			if err = json.Unmarshal(body, &usage); err == nil {
+				return usage, period, nil
+			}
+		}
+	}
+	if err != nil {
+		log.Error("Error reading the cache: ", err)
+		key = ""
+	}
+
+	usage, err := s.db.GetUsage(user.ID, since)
+	if err != nil {
+		return usage, period, err
+	}
+	if key != "" {
+		body, _ := json.Marshal(usage)
+		if err := s.cache.Set(ctx, key, body, time.Duration(s.config.Cache.TTL)*time.Second); err != nil {
+			log.Error("Error writing the cache: ", err)
+		}
+	}
+	return usage, period, nil
+}
+
+// checkLimit refuses with a 403 limit_exceeded the creation of count more
+// of the limited resource when the user would go past the limit of their
+// plan. The details carry the current usage and the limit.
+func (s *FiberServer) checkLimit(c *fiber.Ctx, user types.User, name string, count int64) error {
+	limits := s.planLimits(user)
+	limit := limits.Accounts
+	if name == limitMonthlyTransactions {
+		limit = limits.MonthlyTransactions
+	}
+	if limit == 0 || count == 0 {
+		return nil
+	}
+
+	usage, _, err := s.usage(c, user)
+	if err != nil {
+		log.Error("Error counting the usage: ", err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not check the limits of the plan")
+	}
+	used := usage.Accounts
+	if name == limitMonthlyTransactions {
+		used = usage.MonthlyTransactions
+	}
+	if used+count <= limit {
+		return nil
+	}
+	return NewAPIError(fiber.StatusForbidden, CodeLimitExceeded, fmt.Sprintf("The %s plan allows %d %s", s.userPlan(user), limit, name)).
+		WithDetails(FieldError{Field: name, Message: fmt.Sprintf("%d of %d used", used, limit), Value: fiber.Map{"used": used, "limit": limit}})
+}
+
+// planUsage returns where the user stands against the limits of their plan.
+func (s *FiberServer) planUsage(c *fiber.Ctx, user types.User) (types.PlanUsage, error) {
+	usage, period, err := s.usage(c, user)
+	if err != nil {
+		log.Error("Error counting the usage: ", err)
+		return types.PlanUsage{}, NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not count the usage")
+	}
+	return types.PlanUsage{
+		Plan:      s.userPlan(user),
+		Period:    period,
+		Usage:     usage,
+		Limits:    s.planLimits(user),
+		Overrides: user.LimitOverrides,
+	}, nil
+}
+
+// GetUsage returns the usage of the user against the limits of their plan,
+// 0 for unlimited.
+func (s *FiberServer) GetUsage(c *fiber.Ctx) error {
+	usage, err := s.planUsage(c, c.Locals("user").(types.User))
+	if err != nil {
+		return err
+	}
+	return c.JSON(usage)
+}
+
+// GetUserUsage returns the usage of the user against the limits of their
+// plan and the overrides set for them. Admin only.
+func (s *FiberServer) GetUserUsage(c *fiber.Ctx) error {
+	user, err := s.adminTargetUser(c)
+	if err != nil {
+		return err
+	}
+	usage, err := s.planUsage(c, user)
+	if err != nil {
+		return err
+	}
+	return c.JSON(usage)
+}
+
+// SetUserLimits moves the user to another plan and overrides its limits
+// for them: {"plan": "pro", "limits": {"accounts": 10, "monthly_transactions":
+// null}}. A null removes the override, the limits left out are unchanged,
+// 0 is unlimited. An empty plan moves the user back to the default plan,
+// a plan left out is unchanged. Admin only.
+func (s *FiberServer) SetUserLimits(c *fiber.Ctx) error {
+	type SetUserLimitsRequest struct {
+		Plan   *string           `json:"plan"`
+		Limits map[string]*int64 `json:"limits"`
+	}
+
+	var body SetUserLimitsRequest
+	if err := c.BodyParser(&body); err != nil || (body.Plan == nil && len(body.Limits) == 0) {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body").
+			WithDetails(FieldError{Field: "limits", Message: "must map limit names to numbers or null"})
+	}
+
+	var invalid []FieldError
+	if body.Plan != nil && *body.Plan != "" && !slices.Contains(config.PlanNames, *body.Plan) {
+		invalid = append(invalid, FieldError{Field: "plan", Message: "must be one of: free, pro", Value: *body.Plan})
+	}
+	for name, limit := range body.Limits {
+		if !slices.Contains(limitNames, name) {
+			invalid = append(invalid, FieldError{Field: "limits." + name, Message: "unknown limit", Value: name})
+		} else if limit != nil && *limit < 0 {
+			invalid = append(invalid, FieldError{Field: "limits." + name, Message: "must not be negative", Value: *limit})
+		}
+	}
+	if len(invalid) > 0 {
+		return NewAPIError(fiber.StatusUnprocessableEntity, CodeValidationFailed, "Invalid limits").WithDetails(invalid...)
+	}
+
+	user, err := s.adminTargetUser(c)
+	if err != nil {
+		return err
+	}
+	if body.Plan != nil {
+		user.Plan = *body.Plan
+	}
+	overrides := map[string]int64{}
+	for name, limit := range user.LimitOverrides {
+		overrides[name] = limit
+	}
+	for name, limit := range body.Limits {
+		if limit == nil {
+			delete(overrides, name)
+		} else {
+			overrides[name] = *limit
+		}
+	}
+	if len(overrides) == 0 {
+		overrides = nil
+	}
+	user.LimitOverrides = overrides
+
+	if err := s.db.SetUserPlan(user.ID, user.Plan, user.LimitOverrides); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not update the limits")
+	}
+
+	usage, err := s.planUsage(c, user)
+	if err != nil {
+		return err
+	}
+	return c.JSON(usage)
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/internal/cache"
+	"FinMa/types"
+)
+
+// plansDB counts the accounts created, and how many times the usage is
+// counted, invalidating the cache of the owner like the data change hooks.
+type plansDB struct {
+	*adminDB
+	s        *FiberServer
+	accounts int64
+	counted  int
+}
+
+func (db *plansDB) GetUsage(userID uuid.UUID, since time.Time) (types.Usage, error) {
+	db.counted++
+	return types.Usage{Accounts: db.accounts, MonthlyTransactions: 7}, nil
+}
+
+func (db *plansDB) SetUserPlan(userID uuid.UUID, plan string, overrides map[string]int64) error {
+	user := db.users[userID]
+	user.Plan, user.LimitOverrides = plan, overrides
+	db.users[userID] = user
+	return nil
+}
+
+func (db *plansDB) CreateBankAccount(account *types.BankAccount) error {
+	db.accounts++
+	db.s.invalidateCaches([]uuid.UUID{account.UserID})
+	return nil
+}
+
+func TestPlanLimits(t *testing.T) {
+	s, admin, adminUser, user := newAdminTestServer(t)
+	db := &plansDB{adminDB: admin, s: s, accounts: 1}
+	s.db = db
+	s.cache = cache.NewMemory(100)
+	s.config.Plans.FreeAccounts = 2
+
+	createAccount := func() *errorBody {
+		resp := adminRequest(t, s, user, "POST", "/api/v1/accounts", `{"bank_name":"Bank","account_type":"checking","account_number":"FR76"}`)
+		if resp.StatusCode == fiber.StatusCreated {
+			return nil
+		}
+		var body errorBody
+		json.NewDecoder(resp.Body).Decode(&body)
+		if resp.StatusCode != fiber.StatusForbidden {
+			t.Fatalf("expected status 403 past the limit; got %d %+v", resp.StatusCode, body)
+		}
+		return &body
+	}
+
+	if body := createAccount(); body != nil {
+		t.Fatalf("expected the second account created; got %+v", body.Error)
+	}
+	body := createAccount()
+	if body == nil || body.Error.Code != CodeLimitExceeded || len(body.Error.Details) != 1 || body.Error.Details[0].Field != "accounts" {
+		t.Fatalf("expected the third account refused with limit_exceeded; got %+v", body)
+	}
+	if value, _ := body.Error.Details[0].Value.(map[string]any); value["used"] != float64(2) || value["limit"] != float64(2) {
+		t.Errorf("expected the usage in the details; got %v", body.Error.Details[0].Value)
+	}
+
+	// The usage is counted once per change of the data of the user
+	counted := db.counted
+	createAccount()
+	resp := adminRequest(t, s, user, "GET", "/api/v1/usage", "")
+	var usage types.PlanUsage
+	json.NewDecoder(resp.Body).Decode(&usage)
+	if db.counted != counted {
+		t.Errorf("expected the usage read from the cache; counted %d times more", db.counted-counted)
+	}
+	if usage.Plan != "free" || usage.Usage.Accounts != 2 || usage.Limits.Accounts != 2 || usage.Period != time.Now().UTC().Format("2006-01") {
+		t.Errorf("unexpected usage: %+v", usage)
+	}
+
+	// An admin raises the limit of the user
+	if resp := adminRequest(t, s, user, "POST", "/api/v1/admin/users/"+user.ID.String()+"/limits", `{"limits":{"accounts":3}}`); resp.StatusCode != fiber.StatusForbidden {
+		t.Fatalf("expected the limits set by admins only; got %d", resp.StatusCode)
+	}
+	resp = adminRequest(t, s, adminUser, "POST", "/api/v1/admin/users/"+user.ID.String()+"/limits", `{"limits":{"accounts":3,"webhooks":1}}`)
+	if resp.StatusCode != fiber.StatusUnprocessableEntity {
+		t.Fatalf("expected an unknown limit refused; got %d", resp.StatusCode)
+	}
+	resp = adminRequest(t, s, adminUser, "POST", "/api/v1/admin/users/"+user.ID.String()+"/limits", `{"limits":{"accounts":3}}`)
+	json.NewDecoder(resp.Body).Decode(&usage)
+	if resp.StatusCode != fiber.StatusOK || usage.Limits.Accounts != 3 || usage.Overrides["accounts"] != 3 {
+		t.Fatalf("expected the limit overridden; got %d %+v", resp.StatusCode, usage)
+	}
+	if body := createAccount(); body != nil {
+		t.Fatalf("expected an account created under the override; got %+v", body.Error)
+	}
+
+	// The pro plan is unlimited once the override is removed
+	resp = adminRequest(t, s, adminUser, "POST", "/api/v1/admin/users/"+user.ID.String()+"/limits", `{"plan":"pro","limits":{"accounts":null}}`)
+	usage = types.PlanUsage{}
+	json.NewDecoder(resp.Body).Decode(&usage)
+	if resp.StatusCode != fiber.StatusOK || usage.Plan != "pro" || usage.Limits.Accounts != 0 || usage.Overrides != nil {
+		t.Fatalf("expected the user moved to the pro plan; got %d %+v", resp.StatusCode, usage)
+	}
+	if body := createAccount(); body != nil {
+		t.Errorf("expected the pro plan unlimited; got %+v", body.Error)
+	}
+}
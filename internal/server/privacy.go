@@ -0,0 +1,451 @@
+package server
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/constants"
+	"FinMa/internal/i18n"
+	"FinMa/internal/mail"
+	"FinMa/internal/storage"
+	"FinMa/types"
+	"FinMa/utils"
+)
+
+// privacyRequestBatchSize is the number of privacy requests handled per
+// query by the job.
+const privacyRequestBatchSize = 20
+
+// adminPrivacyRequestsListed is the number of privacy requests listed to
+// the admins.
+const adminPrivacyRequestsListed = 500
+
+// privacyErasureEmail is the data of the privacy_erasure_confirmation email.
+type privacyErasureEmail struct {
+	FirstName  string
+	ConfirmURL string
+	ExpiresAt  time.Time // Of the link
+	GraceDays  int
+}
+
+// GetPrivacyRequests lists the export and erasure requests of the user, the
+// latest first.
+func (s *FiberServer) GetPrivacyRequests(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+
+	requests := s.db.GetPrivacyRequests(user.ID)
+	if requests == nil {
+		requests = []types.PrivacyRequest{}
+	}
+	return c.JSON(requests)
+}
+
+// CreatePrivacyExport requests an archive of the data of the user, built
+// in the background: a notification tells when it can be downloaded.
+func (s *FiberServer) CreatePrivacyExport(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+
+	for _, request := range s.db.GetPrivacyRequests(user.ID) {
+		if request.Kind == "export" && request.Status == "pending" {
+			return NewAPIError(fiber.StatusConflict, CodeConflict, "An export is already being prepared")
+		}
+	}
+
+	request := types.PrivacyRequest{ID: uuid.New(), Kind: "export", Status: "pending", UserID: user.ID}
+	if err := s.db.CreatePrivacyRequest(&request); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not request the export")
+	}
+	s.audit(user.ID, "privacy_export_requested", "privacy_request", request.ID, "")
+
+	return c.Status(fiber.StatusAccepted).JSON(request)
+}
+
+// GetPrivacyExportArchive downloads the archive of a ready export of the
+// user.
+func (s *FiberServer) GetPrivacyExportArchive(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+
+	request := s.db.GetPrivacyRequestByID(c.Params("id"))
+	if request.ID == uuid.Nil || request.UserID != user.ID || request.Kind != "export" {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Privacy request not found")
+	}
+	if request.Status != "ready" {
+		return NewAPIError(fiber.StatusConflict, CodeConflict, "The archive is not available").
+			WithDetails(FieldError{Field: "status", Message: "Not ready", Value: request.Status})
+	}
+
+	r, object, err := s.storage.Get(c.UserContext(), request.ArchiveKey)
+	if err != nil {
+		log.Error("Error reading an export archive: ", err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not read the archive")
+	}
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="finma-export-%s.zip"`, request.CreatedAt.Format(time.DateOnly)))
+	return c.SendStream(r, int(object.Size))
+}
+
+// CreateErasureRequest starts the erasure of the account of the user, once
+// their password is checked. The erasure is confirmed from the link emailed
+// to them, then runs at the end of the grace period.
+func (s *FiberServer) CreateErasureRequest(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+	if req.Password == "" {
+		return NewAPIError(fiber.StatusUnprocessableEntity, CodeValidationFailed, "Invalid erasure request").
+			WithDetails(FieldError{Field: "password", Message: "Required"})
+	}
+	if err := utils.ComparePasswords(user.Password, req.Password); err != nil {
+		return NewAPIError(fiber.StatusUnauthorized, CodeInvalidCredentials, "Invalid password")
+	}
+
+	for _, request := range s.db.GetPrivacyRequests(user.ID) {
+		if request.Kind == "erasure" && (request.Status == "awaiting_confirmation" || request.Status == "scheduled" || request.Status == "pending") {
+			return NewAPIError(fiber.StatusConflict, CodeConflict, "An erasure is already requested, cancel it first").
+				WithDetails(FieldError{Field: "id", Message: "Open erasure request", Value: request.ID.String()})
+		}
+	}
+
+	request := types.PrivacyRequest{ID: uuid.New(), Kind: "erasure", Status: "awaiting_confirmation", UserID: user.ID}
+	token, expiresAt, err := s.tokens.GenerateErasureToken(request.ID)
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not generate the confirmation link")
+	}
+	message, err := mail.Render("privacy_erasure_confirmation", s.localizer(user), user.Email, privacyErasureEmail{
+		FirstName:  user.FirstName,
+		ConfirmURL: s.config.Server.AppURL + "/privacy/confirm-erasure?token=" + url.QueryEscape(token),
+		ExpiresAt:  expiresAt,
+		GraceDays:  s.config.Features.PrivacyErasureGraceDays,
+	})
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not write the confirmation email")
+	}
+	message.UserID = &user.ID
+
+	if err := s.db.CreatePrivacyRequest(&request); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not request the erasure")
+	}
+	if err := s.mailQueue.Enqueue(message); err != nil {
+		log.Error("Error sending the erasure confirmation: ", err)
+	}
+	s.audit(user.ID, "privacy_erasure_requested", "privacy_request", request.ID, "")
+
+	return c.Status(fiber.StatusAccepted).JSON(request)
+}
+
+// ConfirmErasureRequest confirms an erasure from the token of the emailed
+// link, and schedules it at the end of the grace period. Public, the link
+// may be opened on another device.
+func (s *FiberServer) ConfirmErasureRequest(c *fiber.Ctx) error {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+	if req.Token == "" {
+		return NewAPIError(fiber.StatusUnprocessableEntity, CodeValidationFailed, "Invalid confirmation").
+			WithDetails(FieldError{Field: "token", Message: "Required"})
+	}
+
+	requestID, err := s.tokens.VerifyErasureToken(req.Token)
+	if err != nil {
+		log.Warn("Invalid erasure token: ", err)
+		return NewAPIError(fiber.StatusUnauthorized, CodeUnauthorized, "Invalid or expired confirmation link")
+	}
+	request := s.db.GetPrivacyRequestByID(requestID.String())
+	if request.ID == uuid.Nil || request.Kind != "erasure" {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Privacy request not found")
+	}
+	if request.Status != "awaiting_confirmation" {
+		return NewAPIError(fiber.StatusConflict, CodeConflict, "The erasure is no longer awaiting its confirmation").
+			WithDetails(FieldError{Field: "status", Message: "Not awaiting confirmation", Value: request.Status})
+	}
+
+	claimed, err := s.db.ClaimPrivacyRequest(&request, "scheduled")
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not confirm the erasure")
+	}
+	if !claimed {
+		return NewAPIError(fiber.StatusConflict, CodeConflict, "The erasure is no longer awaiting its confirmation")
+	}
+
+	now := time.Now()
+	scheduledFor := now.AddDate(0, 0, s.config.Features.PrivacyErasureGraceDays)
+	request.ConfirmedAt = &now
+	request.ScheduledFor = &scheduledFor
+	if err := s.db.UpdatePrivacyRequest(&request); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not confirm the erasure")
+	}
+	s.audit(request.UserID, "privacy_erasure_confirmed", "privacy_request", request.ID, "")
+
+	return c.JSON(request)
+}
+
+// CancelPrivacyRequest cancels an erasure of the user, until the end of its
+// grace period.
+func (s *FiberServer) CancelPrivacyRequest(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+
+	request := s.db.GetPrivacyRequestByID(c.Params("id"))
+	if request.ID == uuid.Nil || request.UserID != user.ID {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Privacy request not found")
+	}
+	if request.Kind != "erasure" || (request.Status != "awaiting_confirmation" && request.Status != "scheduled") {
+		return NewAPIError(fiber.StatusConflict, CodeConflict, "The request can no longer be canceled").
+			WithDetails(FieldError{Field: "status", Message: "Not cancelable", Value: request.Status})
+	}
+
+	claimed, err := s.db.ClaimPrivacyRequest(&request, "canceled")
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not cancel the request")
+	}
+	if !claimed {
+		return NewAPIError(fiber.StatusConflict, CodeConflict, "The request can no longer be canceled")
+	}
+	s.audit(user.ID, "privacy_erasure_canceled", "privacy_request", request.ID, "")
+
+	return c.JSON(request)
+}
+
+// GetAdminPrivacyRequests lists the privacy requests in the statuses of the
+// status query parameter, comma separated, the open ones by default, the
+// oldest first. Each is listed with the email of its user, gone for the
+// completed erasures. Admin only.
+func (s *FiberServer) GetAdminPrivacyRequests(c *fiber.Ctx) error {
+	statuses := constants.GetOpenPrivacyRequestStatuses()
+	if status := c.Query("status"); status != "" {
+		statuses = strings.Split(status, ",")
+		for _, status := range statuses {
+			if !slices.Contains(constants.GetPrivacyRequestStatuses(), status) {
+				return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid status").
+					WithDetails(FieldError{Field: "status", Message: "Must be one of " + strings.Join(constants.GetPrivacyRequestStatuses(), ", "), Value: status})
+			}
+		}
+	}
+
+	type adminPrivacyRequest struct {
+		types.PrivacyRequest
+		UserEmail string `json:"user_email"`
+	}
+	requests := s.db.GetPrivacyRequestsByStatus(statuses, adminPrivacyRequestsListed)
+	listed := make([]adminPrivacyRequest, 0, len(requests))
+	emails := map[uuid.UUID]string{}
+	for _, request := range requests {
+		email, ok := emails[request.UserID]
+		if !ok {
+			email = s.db.GetUserByID(request.UserID).Email
+			emails[request.UserID] = email
+		}
+		listed = append(listed, adminPrivacyRequest{PrivacyRequest: request, UserEmail: email})
+	}
+	return c.JSON(listed)
+}
+
+// StartPrivacyRequests periodically builds the archives of the pending
+// exports, deletes the expired ones and runs the erasures at the end of
+// their grace period.
+func (s *FiberServer) StartPrivacyRequests(interval time.Duration) {
+	s.every("privacy_requests", interval, func(now time.Time) error {
+		s.processPrivacyRequests(context.Background(), now)
+		return nil
+	})
+}
+
+func (s *FiberServer) processPrivacyRequests(ctx context.Context, now time.Time) {
+	// The due requests are claimed first: an erasure claimed is pending,
+	// and run with the pending exports below
+	for _, request := range s.db.GetDuePrivacyRequests(now, privacyRequestBatchSize) {
+		switch request.Status {
+		case "scheduled":
+			if _, err := s.db.ClaimPrivacyRequest(&request, "pending"); err != nil {
+				log.Error("Error claiming an erasure: ", err)
+			}
+		case "ready":
+			s.expirePrivacyExport(ctx, request)
+		}
+	}
+
+	for _, request := range s.db.GetPrivacyRequestsByStatus([]string{"pending"}, privacyRequestBatchSize) {
+		var err error
+		if request.Kind == "erasure" {
+			err = s.runErasure(ctx, &request)
+		} else {
+			err = s.buildPrivacyExport(ctx, &request, now)
+		}
+		if err != nil {
+			log.Error("Error processing a privacy request: ", err, "id", request.ID)
+			request.Status = "failed"
+			request.Error = err.Error()
+			if err := s.db.UpdatePrivacyRequest(&request); err != nil {
+				log.Error("Error updating a privacy request: ", err)
+			}
+		}
+	}
+}
+
+// privacyArchiveKey is the storage key of the archive of an export.
+func privacyArchiveKey(request types.PrivacyRequest) string {
+	return fmt.Sprintf("privacy/%s/%s.zip", request.UserID, request.ID)
+}
+
+// buildPrivacyExport stores the archive of the data of the user, the
+// export.json of everything they own and a transactions.csv, then notifies
+// them.
+func (s *FiberServer) buildPrivacyExport(ctx context.Context, request *types.PrivacyRequest, now time.Time) error {
+	user := s.db.GetUserByID(request.UserID)
+	if user.ID == uuid.Nil {
+		return errors.New("user not found")
+	}
+	export, err := s.db.ExportUser(&user)
+	if err != nil {
+		return err
+	}
+
+	// Written to a temporary file, the storage needs the size up front
+	file, err := os.CreateTemp("", "finma-export-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if err := writePrivacyArchive(file, export); err != nil {
+		return err
+	}
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	key := privacyArchiveKey(*request)
+	if err := s.storage.Put(ctx, key, file, size, "application/zip"); err != nil {
+		return err
+	}
+
+	expiresAt := now.AddDate(0, 0, s.config.Features.PrivacyExportRetentionDays)
+	request.Status = "ready"
+	request.ArchiveKey = key
+	request.ArchiveSize = size
+	request.ExpiresAt = &expiresAt
+	request.CompletedAt = &now
+	if err := s.db.UpdatePrivacyRequest(request); err != nil {
+		return err
+	}
+
+	if err := s.Notify(ctx, user.ID, "privacy_export_ready", NotificationPayload{
+		Params:  i18n.Params{"expires_at": expiresAt},
+		Details: fiber.Map{"request_id": request.ID, "expires_at": expiresAt},
+	}); err != nil {
+		log.Error("Error notifying a ready export: ", err)
+	}
+	return nil
+}
+
+// writePrivacyArchive writes the zip of the export.
+func writePrivacyArchive(w io.Writer, export types.UserExport) error {
+	archive := zip.NewWriter(w)
+	entry, err := archive.Create("export.json")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(export); err != nil {
+		return err
+	}
+
+	entry, err = archive.Create("transactions.csv")
+	if err != nil {
+		return err
+	}
+	if err := writeCSV(entry, export.Transactions); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// expirePrivacyExport deletes the archive of an export past its expiry.
+func (s *FiberServer) expirePrivacyExport(ctx context.Context, request types.PrivacyRequest) {
+	if err := s.storage.Delete(ctx, request.ArchiveKey); err != nil {
+		log.Error("Error deleting an export archive: ", err)
+		return
+	}
+	if _, err := s.db.ClaimPrivacyRequest(&request, "expired"); err != nil {
+		log.Error("Error expiring an export: ", err)
+	}
+}
+
+// runErasure deletes the files of the user, then their data, and records
+// the certificate of the erasure on the request. A failed erasure can be
+// run again: the deletion of the data is a single transaction.
+func (s *FiberServer) runErasure(ctx context.Context, request *types.PrivacyRequest) error {
+	user := s.db.GetUserByID(request.UserID)
+	if user.ID == uuid.Nil {
+		return errors.New("user not found")
+	}
+
+	files := 0
+	if user.AvatarVersion != 0 {
+		s.removeAvatarFiles(ctx, user.ID, user.AvatarVersion)
+		files++
+	}
+	for _, export := range s.db.GetPrivacyRequests(user.ID) {
+		if export.ArchiveKey == "" || export.Status != "ready" {
+			continue
+		}
+		if err := s.storage.Delete(ctx, export.ArchiveKey); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+		files++
+	}
+
+	deleted, anonymized, err := s.db.EraseUser(&user)
+	if err != nil {
+		return err
+	}
+
+	erasedAt := time.Now()
+	request.Status = "completed"
+	request.Error = ""
+	request.CompletedAt = &erasedAt
+	request.Certificate = &types.ErasureCertificate{
+		RequestedAt: request.CreatedAt,
+		ErasedAt:    erasedAt,
+		Deleted:     deleted,
+		Anonymized:  anonymized,
+		Files:       files,
+	}
+	if err := s.db.UpdatePrivacyRequest(request); err != nil {
+		return err
+	}
+	s.audit(uuid.Nil, "privacy_erasure_completed", "privacy_request", request.ID, "")
+	return nil
+}
@@ -0,0 +1,309 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/url"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/internal/mail"
+	"FinMa/internal/realtime"
+	"FinMa/internal/storage"
+	"FinMa/types"
+)
+
+// privacyDB keeps the privacy requests in memory, and erases the users by
+// forgetting them.
+type privacyDB struct {
+	*adminDB
+	requests      []types.PrivacyRequest
+	notifications []string
+	transactions  []types.Transaction
+}
+
+func (db *privacyDB) CreatePrivacyRequest(request *types.PrivacyRequest) error {
+	request.CreatedAt = time.Now()
+	db.requests = append(db.requests, *request)
+	return nil
+}
+
+func (db *privacyDB) UpdatePrivacyRequest(request *types.PrivacyRequest) error {
+	for i := range db.requests {
+		if db.requests[i].ID == request.ID {
+			db.requests[i] = *request
+		}
+	}
+	return nil
+}
+
+func (db *privacyDB) GetPrivacyRequests(userID uuid.UUID) []types.PrivacyRequest {
+	var requests []types.PrivacyRequest
+	for _, request := range db.requests {
+		if request.UserID == userID {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+func (db *privacyDB) GetPrivacyRequestByID(id string) types.PrivacyRequest {
+	for _, request := range db.requests {
+		if request.ID.String() == id {
+			return request
+		}
+	}
+	return types.PrivacyRequest{}
+}
+
+func (db *privacyDB) GetPrivacyRequestsByStatus(statuses []string, limit int) []types.PrivacyRequest {
+	var requests []types.PrivacyRequest
+	for _, request := range db.requests {
+		if slices.Contains(statuses, request.Status) {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+func (db *privacyDB) GetDuePrivacyRequests(now time.Time, limit int) []types.PrivacyRequest {
+	var requests []types.PrivacyRequest
+	for _, request := range db.requests {
+		if request.Status == "scheduled" && !request.ScheduledFor.After(now) || request.Status == "ready" && !request.ExpiresAt.After(now) {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+func (db *privacyDB) ClaimPrivacyRequest(request *types.PrivacyRequest, next string) (bool, error) {
+	for i := range db.requests {
+		if db.requests[i].ID == request.ID && db.requests[i].Status == request.Status {
+			db.requests[i].Status = next
+			request.Status = next
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (db *privacyDB) ExportUser(user *types.User) (types.UserExport, error) {
+	return types.UserExport{User: *user, Transactions: db.transactions}, nil
+}
+
+func (db *privacyDB) EraseUser(user *types.User) (map[string]int64, map[string]int64, error) {
+	delete(db.users, user.ID)
+	return map[string]int64{"users": 1, "transactions": int64(len(db.transactions))}, map[string]int64{"audit_logs": 2}, nil
+}
+
+func (db *privacyDB) GetNotificationPreference(userID uuid.UUID, event string) (types.NotificationPreference, bool) {
+	return types.NotificationPreference{}, false
+}
+
+func (db *privacyDB) CreateNotification(notification *types.Notification) error {
+	db.notifications = append(db.notifications, notification.Type)
+	return nil
+}
+
+func newPrivacyTestServer(t *testing.T) (s *FiberServer, db *privacyDB, store *storage.Local, admin, user types.User) {
+	s, adminDB, admin, user := newAdminTestServer(t)
+	store, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db = &privacyDB{adminDB: adminDB}
+	s.db = db
+	s.storage = store
+	s.hub = realtime.NewHub(0)
+	return s, db, store, admin, user
+}
+
+func TestPrivacyExport(t *testing.T) {
+	s, db, store, _, user := newPrivacyTestServer(t)
+	db.transactions = []types.Transaction{{ID: uuid.New(), Description: "Groceries", Amount: money(54.21), Type: "expense", UserID: user.ID}}
+
+	resp := adminRequest(t, s, user, "POST", "/api/v1/privacy/export", "")
+	if resp.StatusCode != fiber.StatusAccepted {
+		t.Fatalf("expected status 202; got %d", resp.StatusCode)
+	}
+	var request types.PrivacyRequest
+	json.NewDecoder(resp.Body).Decode(&request)
+	if request.Kind != "export" || request.Status != "pending" {
+		t.Fatalf("expected a pending export; got %+v", request)
+	}
+	if resp := adminRequest(t, s, user, "POST", "/api/v1/privacy/export", ""); resp.StatusCode != fiber.StatusConflict {
+		t.Errorf("expected status 409 for a second pending export; got %d", resp.StatusCode)
+	}
+	if resp := adminRequest(t, s, user, "GET", "/api/v1/privacy/requests/"+request.ID.String()+"/archive", ""); resp.StatusCode != fiber.StatusConflict {
+		t.Errorf("expected status 409 before the archive is ready; got %d", resp.StatusCode)
+	}
+
+	now := time.Now()
+	s.processPrivacyRequests(context.Background(), now)
+	request = db.requests[0]
+	if request.Status != "ready" || request.ArchiveSize == 0 || !request.ExpiresAt.Equal(now.AddDate(0, 0, 7)) {
+		t.Fatalf("expected the archive ready for 7 days; got %+v", request)
+	}
+	if len(db.notifications) != 1 || db.notifications[0] != "privacy_export_ready" {
+		t.Errorf("expected the user notified; got %v", db.notifications)
+	}
+
+	resp = adminRequest(t, s, user, "GET", "/api/v1/privacy/requests/"+request.ID.String()+"/archive", "")
+	if resp.StatusCode != fiber.StatusOK || resp.Header.Get("Content-Type") != "application/zip" {
+		t.Fatalf("expected the zip; got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	body, _ := io.ReadAll(resp.Body)
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archive.File) != 2 || archive.File[0].Name != "export.json" || archive.File[1].Name != "transactions.csv" {
+		t.Fatalf("expected export.json and transactions.csv; got %v", archive.File)
+	}
+	csv, _ := archive.File[1].Open()
+	rows, _ := io.ReadAll(csv)
+	if !bytes.Contains(rows, []byte("Groceries")) {
+		t.Errorf("expected the transactions in the CSV; got %q", rows)
+	}
+
+	// The archives of others are not found
+	other := types.User{ID: uuid.New(), Email: "grace@example.com", Role: "user"}
+	db.users[other.ID] = other
+	if resp := adminRequest(t, s, other, "GET", "/api/v1/privacy/requests/"+request.ID.String()+"/archive", ""); resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("expected status 404 for the archive of another user; got %d", resp.StatusCode)
+	}
+
+	s.processPrivacyRequests(context.Background(), now.AddDate(0, 0, 7))
+	if request := db.requests[0]; request.Status != "expired" {
+		t.Errorf("expected the export expired; got %+v", request)
+	}
+	if _, _, err := store.Get(context.Background(), request.ArchiveKey); err != storage.ErrNotFound {
+		t.Errorf("expected the archive deleted; got %v", err)
+	}
+}
+
+func TestPrivacyErasure(t *testing.T) {
+	s, db, store, _, user := newPrivacyTestServer(t)
+	mailer := mail.NewMockMailer()
+	s.mailQueue = mail.NewQueue(mailer, nil, mail.QueueConfig{Size: 10, Backoff: time.Millisecond})
+	avatar := user
+	avatar.AvatarVersion = 1
+	db.users[user.ID] = avatar
+	key := avatarKey(user.ID, 1, 64, "image/png")
+	store.Put(context.Background(), key, bytes.NewReader([]byte("png")), 3, "image/png")
+
+	if resp := adminRequest(t, s, user, "POST", "/api/v1/privacy/erasure-request", `{"password":"wrong"}`); resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("expected status 401 for a wrong password; got %d", resp.StatusCode)
+	}
+	resp := adminRequest(t, s, user, "POST", "/api/v1/privacy/erasure-request", `{"password":"Correct-horse-1"}`)
+	if resp.StatusCode != fiber.StatusAccepted {
+		t.Fatalf("expected status 202; got %d", resp.StatusCode)
+	}
+	if resp := adminRequest(t, s, user, "POST", "/api/v1/privacy/erasure-request", `{"password":"Correct-horse-1"}`); resp.StatusCode != fiber.StatusConflict {
+		t.Errorf("expected status 409 for a second erasure; got %d", resp.StatusCode)
+	}
+	s.mailQueue.Close()
+
+	messages := mailer.Messages()
+	if len(messages) != 1 || messages[0].To != user.Email {
+		t.Fatalf("expected the confirmation email; got %+v", messages)
+	}
+	match := regexp.MustCompile(`token=([^\s"]+)`).FindStringSubmatch(messages[0].Text)
+	if match == nil {
+		t.Fatalf("expected the confirmation link; got %q", messages[0].Text)
+	}
+	token, _ := url.QueryUnescape(match[1])
+
+	// Not run before its confirmation
+	s.processPrivacyRequests(context.Background(), time.Now().AddDate(1, 0, 0))
+	if db.requests[0].Status != "awaiting_confirmation" {
+		t.Fatalf("expected the erasure awaiting its confirmation; got %+v", db.requests[0])
+	}
+
+	resp = adminRequest(t, s, types.User{}, "POST", "/api/v1/privacy/erasure-request/confirm", `{"token":"`+token+`"}`)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("expected status 200; got %d", resp.StatusCode)
+	}
+	request := db.requests[0]
+	if request.Status != "scheduled" || request.ScheduledFor == nil || request.ScheduledFor.Sub(*request.ConfirmedAt) != 30*24*time.Hour {
+		t.Fatalf("expected the erasure scheduled in 30 days; got %+v", request)
+	}
+	if resp := adminRequest(t, s, types.User{}, "POST", "/api/v1/privacy/erasure-request/confirm", `{"token":"`+token+`"}`); resp.StatusCode != fiber.StatusConflict {
+		t.Errorf("expected status 409 for a second confirmation; got %d", resp.StatusCode)
+	}
+
+	// Not run during the grace period
+	s.processPrivacyRequests(context.Background(), time.Now().AddDate(0, 0, 29))
+	if db.requests[0].Status != "scheduled" {
+		t.Fatalf("expected the erasure still scheduled; got %+v", db.requests[0])
+	}
+
+	s.processPrivacyRequests(context.Background(), request.ScheduledFor.Add(time.Minute))
+	request = db.requests[0]
+	if request.Status != "completed" || request.Certificate == nil || request.Certificate.Deleted["users"] != 1 ||
+		request.Certificate.Anonymized["audit_logs"] != 2 || request.Certificate.Files != 1 {
+		t.Fatalf("expected the erasure completed with its certificate; got %+v", request)
+	}
+	if _, ok := db.users[user.ID]; ok {
+		t.Error("expected the user erased")
+	}
+	if _, _, err := store.Get(context.Background(), key); err != storage.ErrNotFound {
+		t.Errorf("expected the avatar deleted; got %v", err)
+	}
+	if last := db.audits[len(db.audits)-1]; last.Action != "privacy_erasure_completed" || last.UserID != uuid.Nil {
+		t.Errorf("expected the erasure audited without an actor; got %+v", last)
+	}
+}
+
+func TestCancelPrivacyRequest(t *testing.T) {
+	s, db, _, _, user := newPrivacyTestServer(t)
+	scheduledFor := time.Now().AddDate(0, 0, 30)
+	request := types.PrivacyRequest{ID: uuid.New(), Kind: "erasure", Status: "scheduled", ScheduledFor: &scheduledFor, UserID: user.ID}
+	db.requests = []types.PrivacyRequest{request}
+
+	resp := adminRequest(t, s, user, "POST", "/api/v1/privacy/requests/"+request.ID.String()+"/cancel", "")
+	if resp.StatusCode != fiber.StatusOK || db.requests[0].Status != "canceled" {
+		t.Fatalf("expected the erasure canceled; got %d %+v", resp.StatusCode, db.requests[0])
+	}
+	if resp := adminRequest(t, s, user, "POST", "/api/v1/privacy/requests/"+request.ID.String()+"/cancel", ""); resp.StatusCode != fiber.StatusConflict {
+		t.Errorf("expected status 409 for a canceled request; got %d", resp.StatusCode)
+	}
+
+	s.processPrivacyRequests(context.Background(), scheduledFor.Add(time.Hour))
+	if _, ok := db.users[user.ID]; !ok || db.requests[0].Status != "canceled" {
+		t.Errorf("expected a canceled erasure never run; got %+v", db.requests[0])
+	}
+}
+
+func TestGetAdminPrivacyRequests(t *testing.T) {
+	s, db, _, admin, user := newPrivacyTestServer(t)
+	db.requests = []types.PrivacyRequest{
+		{ID: uuid.New(), Kind: "erasure", Status: "scheduled", UserID: user.ID},
+		{ID: uuid.New(), Kind: "export", Status: "expired", UserID: user.ID},
+	}
+
+	resp := adminRequest(t, s, admin, "GET", "/api/v1/admin/privacy-requests", "")
+	var listed []struct {
+		ID        uuid.UUID `json:"id"`
+		UserEmail string    `json:"user_email"`
+	}
+	json.NewDecoder(resp.Body).Decode(&listed)
+	if len(listed) != 1 || listed[0].ID != db.requests[0].ID || listed[0].UserEmail != user.Email {
+		t.Errorf("expected the scheduled erasure with the email of its user; got %+v", listed)
+	}
+
+	if resp := adminRequest(t, s, admin, "GET", "/api/v1/admin/privacy-requests?status=done", ""); resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("expected status 400 for an unknown status; got %d", resp.StatusCode)
+	}
+	if resp := adminRequest(t, s, user, "GET", "/api/v1/admin/privacy-requests", ""); resp.StatusCode != fiber.StatusForbidden {
+		t.Errorf("expected status 403 for a user; got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+)
+
+// The probes of the orchestrator, served outside of the versioned API.
+const (
+	livenessPath  = "/healthz"
+	readinessPath = "/readyz"
+)
+
+// readinessTimeout bounds the database ping of a readiness probe.
+const readinessTimeout = time.Second
+
+// Liveness answers 200 as long as the process serves requests, without
+// touching the database: a database outage must not get the process
+// restarted.
+func (s *FiberServer) Liveness(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"status": "ok"})
+}
+
+// Readiness answers 200 when the server can handle requests: the database
+// answers a ping and the migrations completed. It answers 503 once the
+// shutdown started, and in maintenance mode so that the load balancers
+// drain the instance.
+func (s *FiberServer) Readiness(c *fiber.Ctx) error {
+	if s.stopping.Load() || s.draining.Load() {
+		return NewAPIError(fiber.StatusServiceUnavailable, CodeUnavailable, "Server is shutting down")
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), readinessTimeout)
+	defer cancel()
+	if err := s.db.Ready(ctx); err != nil {
+		log.Warn("Not ready: ", err)
+		return NewAPIError(fiber.StatusServiceUnavailable, CodeUnavailable, "Database is not ready")
+	}
+	if maintenance := s.maintenance(); maintenance.Enabled {
+		return maintenanceError(maintenance)
+	}
+
+	return c.JSON(fiber.Map{"status": "ready"})
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"FinMa/internal/config"
+	"FinMa/internal/database"
+	"FinMa/types"
+)
+
+// readinessDB is a database whose readiness and maintenance mode are set by
+// the test, the other methods are not implemented.
+type readinessDB struct {
+	database.Service
+	err         error
+	maintenance *types.Maintenance
+}
+
+func (db readinessDB) Ready(ctx context.Context) error {
+	return db.err
+}
+
+func (db readinessDB) WithContext(context.Context) database.Service {
+	return db
+}
+
+func (db readinessDB) GetMaintenance() (*types.Maintenance, error) {
+	return db.maintenance, nil
+}
+
+func TestProbes(t *testing.T) {
+	tests := []struct {
+		name        string
+		dbErr       error
+		stopping    bool
+		draining    bool
+		maintenance bool
+		path        string
+		status      int
+	}{
+		{"live", nil, false, false, false, livenessPath, fiber.StatusOK},
+		{"live without database", errors.New("connection refused"), false, false, false, livenessPath, fiber.StatusOK},
+		{"live while draining", nil, false, true, false, livenessPath, fiber.StatusOK},
+		{"live in maintenance", nil, false, false, true, livenessPath, fiber.StatusOK},
+		{"ready", nil, false, false, false, readinessPath, fiber.StatusOK},
+		{"not ready without database", errors.New("connection refused"), false, false, false, readinessPath, fiber.StatusServiceUnavailable},
+		{"not ready once stopping", nil, true, false, false, readinessPath, fiber.StatusServiceUnavailable},
+		{"not ready while draining", nil, false, true, false, readinessPath, fiber.StatusServiceUnavailable},
+		{"not ready in maintenance", nil, false, false, true, readinessPath, fiber.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New(fiber.Config{ErrorHandler: errorHandler})
+			s := &FiberServer{App: app, db: readinessDB{err: tt.dbErr}}
+			s.config.Server.Maintenance = tt.maintenance
+			app.Use(s.rejectWhileDraining)
+			app.Use(s.rejectInMaintenance)
+			app.Get(livenessPath, s.Liveness)
+			app.Get(readinessPath, s.Readiness)
+			s.stopping.Store(tt.stopping)
+			s.draining.Store(tt.draining)
+
+			req, err := http.NewRequest("GET", tt.path, nil)
+			if err != nil {
+				t.Fatalf("error creating request. Err: %v", err)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("error making request to server. Err: %v", err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Errorf("expected status %d; got %d", tt.status, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestHealthRequiresAuthentication(t *testing.T) {
+	s := &FiberServer{App: fiber.New(fiber.Config{ErrorHandler: errorHandler}), config: config.Default()}
+	s.RegisterFiberRoutes()
+
+	req, err := http.NewRequest("GET", APIPrefix+"/health", nil)
+	if err != nil {
+		t.Fatalf("error creating request. Err: %v", err)
+	}
+	resp, err := s.Test(req)
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("expected status 401; got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"FinMa/internal/config"
+	"FinMa/internal/database"
+	"FinMa/internal/webpush"
+	"FinMa/types"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	// pushTTL is how long push services keep a notification for an offline browser.
+	pushTTL = 24 * time.Hour
+	// pushSendTimeout bounds the delivery of a notification to every
+	// browser of the user.
+	pushSendTimeout = 30 * time.Second
+	// pushBodyLength is the length the notification message is cut to,
+	// push payloads are limited to about 4KB.
+	pushBodyLength = 200
+)
+
+// newPushClient returns the Web Push client signing with the VAPID keys,
+// or nil when they are not configured.
+func newPushClient(cfg config.Push) *webpush.Client {
+	if cfg.VAPIDPublicKey == "" || cfg.VAPIDPrivateKey == "" {
+		return nil
+	}
+	keys, err := webpush.ParseVAPIDKeys(cfg.VAPIDPublicKey, cfg.VAPIDPrivateKey)
+	if err != nil {
+		log.Error("Web Push disabled: ", err)
+		return nil
+	}
+	return webpush.NewClient(keys, cfg.VAPIDSubject)
+}
+
+// pushRateLimiter caps the pushes sent to a user in a sliding window, so
+// that an import triggering many notifications does not flood their devices.
+type pushRateLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	sent   map[uuid.UUID][]time.Time
+}
+
+func newPushRateLimiter(limit int, window time.Duration) *pushRateLimiter {
+	return &pushRateLimiter{limit: limit, window: window, sent: map[uuid.UUID][]time.Time{}}
+}
+
+// allow records a push to the user at now, and returns false when the user
+// already received limit pushes in the window.
+func (l *pushRateLimiter) allow(userID uuid.UUID, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	recent := l.sent[userID][:0]
+	for _, sentAt := range l.sent[userID] {
+		if now.Sub(sentAt) < l.window {
+			recent = append(recent, sentAt)
+		}
+	}
+	if len(recent) >= l.limit {
+		l.sent[userID] = recent
+		return false
+	}
+	l.sent[userID] = append(recent, now)
+	return true
+}
+
+// pushMessage is the payload of a push, kept minimal: the service worker
+// shows the title and body and opens the url when clicked.
+type pushMessage struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	URL   string `json:"url"`
+}
+
+// pushDeepLinks map the identifier found in a notification payload to the
+// page showing it, in order of preference.
+var pushDeepLinks = []struct {
+	key  string
+	path string
+}{
+	{"budget_id", "/budgets/"},
+	{"goal_id", "/goals/"},
+	{"transaction_id", "/transactions/"},
+	{"bank_account_id", "/accounts/"},
+}
+
+// newPushMessage builds the push of a notification, titled in the locale,
+// linking to the object it is about or to the notifications page.
+func newPushMessage(notification *types.Notification, locale string) pushMessage {
+	message := pushMessage{
+		Title: notificationTitle(locale, notification.Type),
+		Body:  notification.Message,
+		URL:   "/notifications",
+	}
+	if runes := []rune(message.Body); len(runes) > pushBodyLength {
+		message.Body = string(runes[:pushBodyLength-1]) + "…"
+	}
+
+	var details map[string]any
+	if json.Unmarshal(notification.Payload, &details) == nil {
+		for _, link := range pushDeepLinks {
+			if id, ok := details[link.key]; ok && id != nil {
+				message.URL = fmt.Sprintf("%s%v", link.path, id)
+				break
+			}
+		}
+	}
+	return message
+}
+
+// pushNotifier delivers notifications to the browsers the user subscribed
+// with Web Push. Pushes are sent in the background, subscriptions the push
+// service reports as gone are deleted.
+type pushNotifier struct {
+	db      database.Service
+	client  *webpush.Client
+	limiter *pushRateLimiter
+}
+
+func (n *pushNotifier) Send(ctx context.Context, user types.User, notification *types.Notification) error {
+	subscriptions := n.db.GetPushSubscriptions(user.ID)
+	if len(subscriptions) == 0 {
+		return nil
+	}
+	if !n.limiter.allow(user.ID, time.Now()) {
+		log.Warn("Push notification rate limit reached", "user", user.ID, "event", notification.Type)
+		return nil
+	}
+
+	payload, err := json.Marshal(newPushMessage(notification, user.Locale))
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), pushSendTimeout)
+		defer cancel()
+
+		for _, subscription := range subscriptions {
+			err := n.client.Send(ctx, webpush.Subscription{
+				Endpoint: subscription.Endpoint,
+				P256dh:   subscription.P256dh,
+				Auth:     subscription.Auth,
+			}, payload, pushTTL)
+
+			switch {
+			case errors.Is(err, webpush.ErrSubscriptionGone):
+				if err := n.db.DeletePushSubscriptionByEndpoint(subscription.Endpoint); err != nil {
+					log.Error("Error deleting expired push subscription: ", err)
+				}
+			case err != nil:
+				log.Error("Error sending push notification: ", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// GetPushPublicKey returns the VAPID public key browsers subscribe with,
+// the applicationServerKey of pushManager.subscribe().
+func (s *FiberServer) GetPushPublicKey(c *fiber.Ctx) error {
+	public := s.config.Push.VAPIDPublicKey
+	if _, ok := s.notifiers["push"]; !ok || public == "" {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Push notifications are not configured")
+	}
+	return c.JSON(fiber.Map{"public_key": public})
+}
+
+// SubscribePush stores the PushSubscription of a browser, as serialized by
+// its toJSON(): {"endpoint", "keys": {"p256dh", "auth"}}.
+func (s *FiberServer) SubscribePush(c *fiber.Ctx) error {
+	type PushSubscriptionRequest struct {
+		Endpoint string `json:"endpoint"`
+		Keys     struct {
+			P256dh string `json:"p256dh"`
+			Auth   string `json:"auth"`
+		} `json:"keys"`
+	}
+
+	var body PushSubscriptionRequest
+	if err := c.BodyParser(&body); err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+	if !strings.HasPrefix(body.Endpoint, "https://") || body.Keys.P256dh == "" || body.Keys.Auth == "" {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "endpoint must be an https URL, keys.p256dh and keys.auth are required")
+	}
+
+	user := c.Locals("user").(types.User)
+	subscription := &types.PushSubscription{
+		ID:        uuid.New(),
+		Endpoint:  body.Endpoint,
+		P256dh:    body.Keys.P256dh,
+		Auth:      body.Keys.Auth,
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+		UserID:    user.ID,
+	}
+	if err := s.db.SavePushSubscription(subscription); err != nil {
+		log.Error("Error saving push subscription: ", err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Failed to save push subscription")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(subscription)
+}
+
+// UnsubscribePush deletes the subscription of the endpoint, when the
+// browser unsubscribes or the user turns push off on a device.
+func (s *FiberServer) UnsubscribePush(c *fiber.Ctx) error {
+	var body struct {
+		Endpoint string `json:"endpoint"`
+	}
+	if err := c.BodyParser(&body); err != nil || body.Endpoint == "" {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "endpoint is required")
+	}
+
+	user := c.Locals("user").(types.User)
+	deleted, err := s.db.DeletePushSubscription(user.ID, body.Endpoint)
+	if err != nil {
+		log.Error("Error deleting push subscription: ", err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Failed to delete push subscription")
+	}
+	if !deleted {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Push subscription not found")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"FinMa/types"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestPushRateLimiter(t *testing.T) {
+	limiter := newPushRateLimiter(2, time.Hour)
+	user, other := uuid.New(), uuid.New()
+	start := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		user     uuid.UUID
+		at       time.Time
+		expected bool
+	}{
+		{"first push", user, start, true},
+		{"second push", user, start.Add(10 * time.Minute), true},
+		{"over the limit", user, start.Add(20 * time.Minute), false},
+		{"other user", other, start.Add(20 * time.Minute), true},
+		{"first push out of the window", user, start.Add(61 * time.Minute), true},
+		{"still over the limit", user, start.Add(65 * time.Minute), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := limiter.allow(tt.user, tt.at); got != tt.expected {
+				t.Errorf("expected %v; got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestNewPushMessage(t *testing.T) {
+	budgetID := uuid.New()
+	budgetPayload, _ := json.Marshal(map[string]any{"budget_id": budgetID, "transaction_id": uuid.New()})
+
+	tests := []struct {
+		name         string
+		notification types.Notification
+		locale       string
+		title        string
+		url          string
+	}{
+		{
+			name:         "links to the budget first",
+			notification: types.Notification{Type: "budget_exceeded", Message: "Groceries exceeded", Payload: budgetPayload},
+			locale:       "en",
+			title:        "Budget exceeded",
+			url:          "/budgets/" + budgetID.String(),
+		},
+		{
+			name:         "falls back to the notifications",
+			notification: types.Notification{Type: "new_device_login", Message: "New login"},
+			locale:       "en",
+			title:        "New device login",
+			url:          "/notifications",
+		},
+		{
+			name:         "titled in the language of the user",
+			notification: types.Notification{Type: "bill_overdue", Message: "Facture en retard"},
+			locale:       "fr",
+			title:        "Facture en retard",
+			url:          "/notifications",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := newPushMessage(&tt.notification, tt.locale)
+			if message.Title != tt.title {
+				t.Errorf("expected title %q; got %q", tt.title, message.Title)
+			}
+			if message.URL != tt.url {
+				t.Errorf("expected url %q; got %q", tt.url, message.URL)
+			}
+			if message.Body != tt.notification.Message {
+				t.Errorf("expected body %q; got %q", tt.notification.Message, message.Body)
+			}
+		})
+	}
+
+	long := newPushMessage(&types.Notification{Type: "weekly_digest", Message: strings.Repeat("é", 500)}, "en")
+	if length := len([]rune(long.Body)); length != pushBodyLength {
+		t.Errorf("expected the body cut to %d characters; got %d", pushBodyLength, length)
+	}
+}
@@ -0,0 +1,205 @@
+package server
+
+import (
+	"FinMa/types"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// reconciliationResponse is a reconciliation with the difference between the
+// statement balance and the reconciled transactions.
+type reconciliationResponse struct {
+	types.Reconciliation
+	ReconciledBalance types.Money `json:"reconciled_balance"`
+	Difference        types.Money `json:"difference"`
+}
+
+func (s *FiberServer) buildReconciliationResponse(reconciliation types.Reconciliation) (reconciliationResponse, error) {
+	reconciled, err := s.db.GetReconciledTotal(reconciliation.BankAccountID, reconciliation.StatementDate)
+	if err != nil {
+		return reconciliationResponse{}, err
+	}
+
+	difference, err := reconciliation.StatementBalance.Unbound().Sub(reconciled.Unbound())
+	if err != nil {
+		return reconciliationResponse{}, err
+	}
+
+	return reconciliationResponse{
+		Reconciliation:    reconciliation,
+		ReconciledBalance: reconciled.Unbound(),
+		Difference:        difference,
+	}, nil
+}
+
+// findAccountReconciliation returns the reconciliation from the route params
+// if it belongs to an account the user has at least the given role on.
+func (s *FiberServer) findAccountReconciliation(c *fiber.Ctx, role string) (types.Reconciliation, bool) {
+	user := c.Locals("user").(types.User)
+	account, ok := s.findUserBankAccount(user, c.Params("id"), role)
+	if !ok {
+		return types.Reconciliation{}, false
+	}
+
+	reconciliation := s.db.GetReconciliationByID(c.Params("reconciliationId"))
+	if reconciliation.ID == uuid.Nil || reconciliation.BankAccountID != account.ID {
+		return types.Reconciliation{}, false
+	}
+	return reconciliation, true
+}
+
+// CreateReconciliation starts a reconciliation session of an account against
+// a bank statement. Only one session can be open at a time per account.
+func (s *FiberServer) CreateReconciliation(c *fiber.Ctx) error {
+	type CreateReconciliationRequest struct {
+		StatementDate    string      `json:"statement_date"`
+		StatementBalance types.Money `json:"statement_balance"`
+	}
+
+	var body CreateReconciliationRequest
+	if err := c.BodyParser(&body); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+
+	statementDate, err := time.Parse(time.RFC3339, body.StatementDate)
+	if err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid statement date format")
+	}
+
+	user := c.Locals("user").(types.User)
+	account, ok := s.findUserBankAccount(user, c.Params("id"), "editor")
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Bank account not found")
+	}
+
+	if err := s.checkAccountAmount("statement_balance", body.StatementBalance, account); err != nil {
+		return err
+	}
+
+	if open := s.db.GetOpenReconciliation(account.ID); open.ID != uuid.Nil {
+		return NewAPIError(fiber.StatusConflict, CodeConflict, "A reconciliation is already open for this account")
+	}
+
+	reconciliation := types.Reconciliation{
+		ID:               uuid.New(),
+		StatementDate:    statementDate,
+		StatementBalance: body.StatementBalance,
+		Status:           "open",
+		BankAccountID:    account.ID,
+		UserID:           user.ID,
+	}
+
+	if err := s.db.CreateReconciliation(&reconciliation); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not create reconciliation")
+	}
+
+	response, err := s.buildReconciliationResponse(reconciliation)
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not compute reconciliation difference")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+// GetReconciliations lists the past and open reconciliations of an account.
+func (s *FiberServer) GetReconciliations(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	account, ok := s.findUserBankAccount(user, c.Params("id"), "viewer")
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Bank account not found")
+	}
+
+	return c.JSON(s.db.GetReconciliations(account.ID))
+}
+
+// GetReconciliation returns a reconciliation with the remaining difference
+// between the statement balance and the reconciled transactions.
+func (s *FiberServer) GetReconciliation(c *fiber.Ctx) error {
+	reconciliation, ok := s.findAccountReconciliation(c, "viewer")
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Reconciliation not found")
+	}
+
+	response, err := s.buildReconciliationResponse(reconciliation)
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not compute reconciliation difference")
+	}
+
+	return c.JSON(response)
+}
+
+// ReconcileTransactions marks transactions as reconciled in an open session.
+// The session is closed and locked as soon as the difference reaches zero.
+func (s *FiberServer) ReconcileTransactions(c *fiber.Ctx) error {
+	type ReconcileTransactionsRequest struct {
+		TransactionIDs []uuid.UUID `json:"transaction_ids"`
+	}
+
+	var body ReconcileTransactionsRequest
+	if err := c.BodyParser(&body); err != nil || len(body.TransactionIDs) == 0 {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+
+	reconciliation, ok := s.findAccountReconciliation(c, "editor")
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Reconciliation not found")
+	}
+
+	if reconciliation.Status != "open" {
+		return NewAPIError(fiber.StatusConflict, CodeReconciliationClosed, "Reconciliation is closed")
+	}
+
+	if _, err := s.db.ReconcileTransactions(&reconciliation, body.TransactionIDs); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not reconcile transactions")
+	}
+
+	response, err := s.buildReconciliationResponse(reconciliation)
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not compute reconciliation difference")
+	}
+
+	if response.Difference.IsZero() {
+		if err := s.db.CloseReconciliation(&reconciliation); err != nil {
+			log.Error(err)
+			return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not close reconciliation")
+		}
+		response.Reconciliation = reconciliation
+	}
+
+	return c.JSON(response)
+}
+
+// UnreconcileTransaction clears the reconciled mark of a transaction so its
+// amount and date can be edited again. Transactions of a closed
+// reconciliation are locked.
+func (s *FiberServer) UnreconcileTransaction(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	transaction, ok := s.findUserTransaction(user, c.Params("id"), "editor")
+
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Transaction not found")
+	}
+
+	if transaction.ReconciliationID != nil {
+		reconciliation := s.db.GetReconciliationByID(transaction.ReconciliationID.String())
+		if reconciliation.Status == "closed" {
+			return NewAPIError(fiber.StatusConflict, CodeReconciliationClosed, "Transaction belongs to a closed reconciliation")
+		}
+	}
+
+	if err := s.db.UnreconcileTransaction(&transaction); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not unreconcile transaction")
+	}
+
+	return c.JSON(transaction)
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/types"
+)
+
+// reconciliationsDB keeps the reconciliations of an account and the
+// transactions they reconcile.
+type reconciliationsDB struct {
+	*adminDB
+	account         types.BankAccount
+	reconciliations map[uuid.UUID]types.Reconciliation
+	transactions    map[uuid.UUID]types.Transaction
+}
+
+func (db *reconciliationsDB) GetBankAccountByID(id string) types.BankAccount {
+	if id != db.account.ID.String() {
+		return types.BankAccount{}
+	}
+	return db.account
+}
+
+func (db *reconciliationsDB) GetAccountMembership(accountID, userID uuid.UUID) types.AccountMember {
+	return types.AccountMember{}
+}
+
+func (db *reconciliationsDB) CreateReconciliation(reconciliation *types.Reconciliation) error {
+	db.reconciliations[reconciliation.ID] = *reconciliation
+	return nil
+}
+
+func (db *reconciliationsDB) GetReconciliationByID(id string) types.Reconciliation {
+	return db.reconciliations[uuid.MustParse(id)]
+}
+
+func (db *reconciliationsDB) GetOpenReconciliation(accountID uuid.UUID) types.Reconciliation {
+	for _, reconciliation := range db.reconciliations {
+		if reconciliation.BankAccountID == accountID && reconciliation.Status == "open" {
+			return reconciliation
+		}
+	}
+	return types.Reconciliation{}
+}
+
+func (db *reconciliationsDB) GetReconciledTotal(accountID uuid.UUID, until time.Time) (types.Money, error) {
+	var total types.Money
+	for _, transaction := range db.transactions {
+		if transaction.IsReconciled && !transaction.Date.After(until) {
+			var err error
+			if total, err = total.Add(transaction.Amount); err != nil {
+				return types.Money{}, err
+			}
+		}
+	}
+	return total, nil
+}
+
+func (db *reconciliationsDB) ReconcileTransactions(reconciliation *types.Reconciliation, transactionIDs []uuid.UUID) (int64, error) {
+	for _, id := range transactionIDs {
+		transaction := db.transactions[id]
+		transaction.IsReconciled, transaction.ReconciliationID = true, &reconciliation.ID
+		db.transactions[id] = transaction
+	}
+	return int64(len(transactionIDs)), nil
+}
+
+func (db *reconciliationsDB) CloseReconciliation(reconciliation *types.Reconciliation) error {
+	now := time.Now()
+	reconciliation.Status, reconciliation.ClosedAt = "closed", &now
+	db.reconciliations[reconciliation.ID] = *reconciliation
+	return nil
+}
+
+func TestReconciliation(t *testing.T) {
+	s, admin, _, user := newAdminTestServer(t)
+	other := types.User{ID: uuid.New(), Email: "grace@example.com", Role: "user"}
+	admin.users[other.ID] = other
+	account := types.BankAccount{ID: uuid.New(), BankName: "Checking", AccountType: "checking", UserID: user.ID}
+	date := time.Date(2024, time.March, 10, 0, 0, 0, 0, time.UTC)
+	rent := types.Transaction{ID: uuid.New(), Type: "income", Amount: money(100), Date: date, BankAccountID: account.ID}
+	refund := types.Transaction{ID: uuid.New(), Type: "income", Amount: money(50), Date: date, BankAccountID: account.ID}
+	db := &reconciliationsDB{adminDB: admin, account: account, reconciliations: map[uuid.UUID]types.Reconciliation{},
+		transactions: map[uuid.UUID]types.Transaction{rent.ID: rent, refund.ID: refund}}
+	s.db = db
+	path := "/api/v1/accounts/" + account.ID.String() + "/reconciliations"
+	statement := `{"statement_date":"2024-03-31T00:00:00Z","statement_balance":150}`
+
+	resp := adminRequest(t, s, user, "POST", path, statement)
+	var created reconciliationResponse
+	json.NewDecoder(resp.Body).Decode(&created)
+	if resp.StatusCode != fiber.StatusCreated || created.Status != "open" || created.Difference != money(150) {
+		t.Fatalf("expected an open reconciliation 150 off; got %d %+v", resp.StatusCode, created)
+	}
+
+	reconcile := func(ids ...uuid.UUID) (*http.Response, reconciliationResponse) {
+		body, _ := json.Marshal(map[string][]uuid.UUID{"transaction_ids": ids})
+		resp := adminRequest(t, s, user, "POST", path+"/"+created.ID.String()+"/transactions", string(body))
+		var response reconciliationResponse
+		json.NewDecoder(resp.Body).Decode(&response)
+		return resp, response
+	}
+	if resp, response := reconcile(rent.ID); resp.StatusCode != fiber.StatusOK || response.Difference != money(50) || response.Status != "open" {
+		t.Errorf("expected 50 left to reconcile; got %d %+v", resp.StatusCode, response)
+	}
+	// The difference reaches zero, the session is closed
+	if resp, response := reconcile(refund.ID); resp.StatusCode != fiber.StatusOK || response.Difference != money(0) || response.Status != "closed" || response.ClosedAt == nil {
+		t.Errorf("expected the reconciliation closed; got %d %+v", resp.StatusCode, response)
+	}
+	if resp, _ := reconcile(rent.ID); resp.StatusCode != fiber.StatusConflict {
+		t.Errorf("expected a closed reconciliation locked; got %d", resp.StatusCode)
+	}
+
+	for name, request := range map[string]struct {
+		as     types.User
+		body   string
+		status int
+		code   string
+	}{
+		"invalid date":            {user, `{"statement_date":"31/03/2024","statement_balance":150}`, fiber.StatusBadRequest, CodeInvalidRequest},
+		"account of another user": {other, statement, fiber.StatusNotFound, CodeNotFound},
+	} {
+		resp := adminRequest(t, s, request.as, "POST", path, request.body)
+		var body errorBody
+		json.NewDecoder(resp.Body).Decode(&body)
+		if resp.StatusCode != request.status || body.Error.Code != request.code {
+			t.Errorf("%s: expected %d %s; got %d %+v", name, request.status, request.code, resp.StatusCode, body)
+		}
+	}
+
+	db.reconciliations[created.ID] = types.Reconciliation{ID: created.ID, Status: "open", BankAccountID: account.ID}
+	resp = adminRequest(t, s, user, "POST", path, statement)
+	if resp.StatusCode != fiber.StatusConflict {
+		t.Errorf("expected a second open reconciliation refused; got %d", resp.StatusCode)
+	}
+}
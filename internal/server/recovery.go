@@ -0,0 +1,45 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+)
+
+// recoverPanics turns a panic below it into the 500 error envelope, logging
+// the stack with the request ID and counting it. It is registered twice:
+// outermost, so that the panics of the middlewares are caught, and right
+// below the request logging, so that the panics of the handlers are still
+// logged and measured as a request answered with a 500.
+//
+// A handler panicking with http.ErrAbortHandler asks for the connection to
+// be dropped, as with net/http. fasthttp has no recovery of its own, a new
+// panic would exit the process: the connection is closed instead, without
+// a response, an error log or a count.
+func (s *FiberServer) recoverPanics(c *fiber.Ctx) (err error) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+
+		if abort, ok := r.(error); ok && errors.Is(abort, http.ErrAbortHandler) {
+			c.Context().SetConnectionClose()
+			c.Context().Conn().Close()
+			err = nil
+			return
+		}
+
+		requestID, _ := c.Locals("request_id").(string)
+		log.Error("Panic while handling a request", "request_id", requestID, "method", c.Method(), "path", c.Path(),
+			"panic", fmt.Sprint(r), "stack", string(debug.Stack()))
+		s.metrics.countPanic()
+		err = NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Internal server error")
+	}()
+
+	return c.Next()
+}
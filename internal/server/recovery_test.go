@@ -0,0 +1,124 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"FinMa/internal/config"
+)
+
+// newRecoveryTestServer returns a server with the middlewares of New, the
+// request log written to output, and routes panicking in a handler and in
+// a middleware.
+func newRecoveryTestServer(output *bytes.Buffer) *FiberServer {
+	s := &FiberServer{
+		App:     fiber.New(fiber.Config{ErrorHandler: errorHandler}),
+		config:  config.Default(),
+		metrics: newServerMetrics(nil),
+	}
+	settings := RequestLogSettings{Level: slog.LevelInfo}
+	s.useMiddlewares(requestLogging(newRequestLogger(output, settings), settings))
+
+	s.Get("/api/v1/panic", func(c *fiber.Ctx) error {
+		var accounts map[string]int
+		accounts["checking"]++
+		return nil
+	})
+	s.Get("/api/v1/abort", func(c *fiber.Ctx) error {
+		panic(http.ErrAbortHandler)
+	})
+	return s
+}
+
+func TestRecoverPanics(t *testing.T) {
+	var output bytes.Buffer
+	s := newRecoveryTestServer(&output)
+
+	req, err := http.NewRequest("GET", "/api/v1/panic", nil)
+	if err != nil {
+		t.Fatalf("error creating request. Err: %v", err)
+	}
+	req.Header.Set(RequestIDHeader, "panic-1")
+	resp, err := s.Test(req)
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusInternalServerError {
+		t.Errorf("expected status 500; got %d", resp.StatusCode)
+	}
+
+	var body errorBody
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("expected the error envelope. Err: %v", err)
+	}
+	if body.Error.Code != CodeInternal || body.Error.RequestID != "panic-1" {
+		t.Errorf("expected an internal error for the request panic-1; got %+v", body.Error)
+	}
+
+	if count := s.metrics.panics.Value(); count != 1 {
+		t.Errorf("expected 1 panic counted; got %v", count)
+	}
+	if count := s.metrics.httpRequests.Value("GET", "/api/v1/panic", "5xx"); count != 1 {
+		t.Errorf("expected the request to be measured as a 5xx; got %v", count)
+	}
+	var line map[string]any
+	if err := json.Unmarshal(output.Bytes(), &line); err != nil || line["status"] != float64(500) {
+		t.Errorf("expected the request to be logged with status 500; got %q", output.String())
+	}
+}
+
+func TestRecoverPanicsInMiddlewares(t *testing.T) {
+	s := &FiberServer{
+		App:     fiber.New(fiber.Config{ErrorHandler: errorHandler}),
+		config:  config.Default(),
+		metrics: newServerMetrics(nil),
+	}
+	// The request logging is above the inner recovery
+	s.useMiddlewares(func(c *fiber.Ctx) error {
+		panic("request log unavailable")
+	})
+	s.Get("/api/v1/accounts", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	req, err := http.NewRequest("GET", "/api/v1/accounts", nil)
+	if err != nil {
+		t.Fatalf("error creating request. Err: %v", err)
+	}
+	resp, err := s.Test(req)
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusInternalServerError {
+		t.Errorf("expected status 500; got %d", resp.StatusCode)
+	}
+
+	var body errorBody
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Error.Code != CodeInternal {
+		t.Errorf("expected the error envelope; got %+v, %v", body, err)
+	}
+	if count := s.metrics.panics.Value(); count != 1 {
+		t.Errorf("expected 1 panic counted; got %v", count)
+	}
+}
+
+func TestRecoverPanicsAbortsConnection(t *testing.T) {
+	var output bytes.Buffer
+	s := newRecoveryTestServer(&output)
+
+	req, err := http.NewRequest("GET", "/api/v1/abort", nil)
+	if err != nil {
+		t.Fatalf("error creating request. Err: %v", err)
+	}
+	if resp, err := s.Test(req); err == nil && resp.StatusCode == fiber.StatusInternalServerError {
+		t.Errorf("expected the connection to be dropped without an error response")
+	}
+	if count := s.metrics.panics.Value(); count != 0 {
+		t.Errorf("expected the aborted request not to be counted as a panic; got %v", count)
+	}
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/internal/config"
+	"FinMa/internal/logging"
+	"FinMa/types"
+	"FinMa/utils"
+)
+
+// leakyDB fails with the errors of a database quoting the values and the
+// connection string.
+type leakyDB struct {
+	*adminDB
+	dsn string
+}
+
+func (db *leakyDB) GetAdminStats(time.Time) (types.AdminStats, error) {
+	return types.AdminStats{}, fmt.Errorf(`duplicate key value violates unique constraint "idx_users_email": Key (email)=(ada@example.com) on %s`, db.dsn)
+}
+
+func TestLogsRedactSensitiveValues(t *testing.T) {
+	var output bytes.Buffer
+	logging.SetOutput(&output)
+	t.Cleanup(func() { logging.SetOutput(os.Stderr) })
+
+	hashed, err := utils.HashPassword("Correct-horse-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := types.User{ID: uuid.New(), Email: "admin@example.com", Password: hashed, Role: "admin"}
+	user := types.User{ID: uuid.New(), Email: "ada@example.com", Password: hashed, Role: "user"}
+	cfg := config.Default()
+	cfg.DB.Password = "db-Pa55word"
+
+	db := &leakyDB{adminDB: &adminDB{users: map[uuid.UUID]types.User{admin.ID: admin, user.ID: user}}, dsn: cfg.DB.DSN()}
+	s := &FiberServer{
+		App:      fiber.New(fiber.Config{ErrorHandler: errorHandler}),
+		config:   cfg,
+		db:       db,
+		tokens:   utils.Tokens{AccessSecret: "access", RefreshSecret: "refresh"},
+		handlers: NewHandler(db, cfg.Auth, nil, nil),
+		metrics:  newServerMetrics(nil),
+	}
+	settings := RequestLogSettings{Level: slog.LevelDebug, LogBodies: true, BodyLength: 2048}
+	s.useMiddlewares(requestLogging(newRequestLogger(&output, settings), settings))
+	s.RegisterFiberRoutes()
+
+	token, err := s.tokens.GenerateAccessToken(utils.Payload{UserID: admin.ID, Email: admin.Email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	send := func(method, path, body string) {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Cookie", "refresh_token=cookie-S3cret")
+		if _, err := s.Test(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	send("POST", "/api/v1/auth/login?access_token="+token, `{"email":"ada@example.com","password":"Wrong-horse-9"}`)
+	send("POST", "/api/v1/auth/login", `{"email":"nobody@example.com","password":"Wrong-horse-9"}`)
+	send("POST", "/api/v1/goals", `{"name":"Trip with ada@example.com","note":"password=hunt3r2"}`)
+	send("GET", "/api/v1/admin/stats", "")
+
+	logged := output.String()
+	for _, sensitive := range []string{"ada@example.com", "nobody@example.com", "Wrong-horse-9", "hunt3r2", token, "cookie-S3cret", "db-Pa55word"} {
+		if strings.Contains(logged, sensitive) {
+			t.Errorf("expected %q not to be logged; got %s", sensitive, logged)
+		}
+	}
+	if !strings.Contains(logged, logging.Email("ada@example.com")) {
+		t.Errorf("expected the email logged as its token; got %s", logged)
+	}
+}
@@ -0,0 +1,480 @@
+package server
+
+import (
+	"FinMa/constants"
+	"FinMa/internal/i18n"
+	"FinMa/internal/mail"
+	"FinMa/types"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	// reportScheduleBatchSize is the number of due schedules loaded at once.
+	reportScheduleBatchSize = 100
+	// reportInlineRows is the number of rows of a report inlined in its
+	// email, the larger reports are attached as CSV.
+	reportInlineRows = 50
+	// reportScheduleMaxFailures is the number of failed runs in a row
+	// pausing a schedule.
+	reportScheduleMaxFailures = 3
+	// reportDeliveriesListed is the number of deliveries listed.
+	reportDeliveriesListed = 50
+	// scheduledHealthMonths is the number of months of the scheduled health
+	// metrics.
+	scheduledHealthMonths = 3
+)
+
+// nextReportRun returns the first run of the schedule after after, at its
+// hour in loc: on its weekday for the weekly ones, on its day of the month
+// for the monthly ones.
+func nextReportRun(schedule types.ReportSchedule, after time.Time, loc *time.Location) time.Time {
+	local := after.In(loc)
+	if schedule.Frequency == "monthly" {
+		run := time.Date(local.Year(), local.Month(), schedule.Day, schedule.Hour, 0, 0, 0, loc)
+		if !run.After(after) {
+			run = time.Date(local.Year(), local.Month()+1, schedule.Day, schedule.Hour, 0, 0, 0, loc)
+		}
+		return run
+	}
+
+	days := (schedule.Weekday - int(local.Weekday()) + 7) % 7
+	run := time.Date(local.Year(), local.Month(), local.Day()+days, schedule.Hour, 0, 0, 0, loc)
+	if !run.After(after) {
+		run = time.Date(local.Year(), local.Month(), local.Day()+days+7, schedule.Hour, 0, 0, 0, loc)
+	}
+	return run
+}
+
+// reportPeriod returns the period summarized by the canned report of the
+// schedule run at scheduledAt, local midnights: the 7 days before the run
+// for the weekly ones, the previous month for the monthly ones.
+func reportPeriod(schedule types.ReportSchedule, scheduledAt time.Time, loc *time.Location) (time.Time, time.Time) {
+	local := scheduledAt.In(loc)
+	if schedule.Frequency == "monthly" {
+		to := monthStart(scheduledAt, loc)
+		return to.AddDate(0, -1, 0), to
+	}
+	to := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	return to.AddDate(0, 0, -7), to
+}
+
+// attachReport reports whether the rows of a report are attached to its
+// email as CSV rather than inlined: when the schedule asks for it, or when
+// they are too many to inline.
+func attachReport(format string, rows int) bool {
+	return format == "csv" || rows > reportInlineRows
+}
+
+// scheduledReport is a report computed for its email, its rows from From
+// to To excluded.
+type scheduledReport struct {
+	Title string
+	From  time.Time
+	To    time.Time
+	Rows  any
+}
+
+// computeScheduledReport computes the report of the schedule run at
+// scheduledAt. The title is set even when it fails, as far as it is known.
+func (s *FiberServer) computeScheduledReport(schedule types.ReportSchedule, user types.User, l i18n.Localizer, scheduledAt time.Time) (scheduledReport, error) {
+	location := userLocation(user)
+	report := scheduledReport{Title: l.T("reports."+schedule.Report, nil)}
+
+	switch schedule.Report {
+	case "custom":
+		if schedule.ReportDefinitionID == nil {
+			return report, errors.New("the custom report no longer exists")
+		}
+		definition, ok := s.findUserReportDefinition(user, schedule.ReportDefinitionID.String())
+		if !ok {
+			return report, errors.New("the custom report no longer exists")
+		}
+		report.Title = definition.Name
+		custom, err := s.runCustomReport(s.db, user, definition.Definition, scheduledAt)
+		if err != nil {
+			return report, err
+		}
+		report.From, report.To, report.Rows = custom.From, custom.To, custom.Rows
+	case "health_metrics":
+		_, to := reportPeriod(schedule, scheduledAt, location)
+		// Up to the day before the run, a monthly run covers full months
+		health, err := s.healthMetrics(s.db, user, scheduledHealthMonths, to.AddDate(0, 0, -1))
+		if err != nil {
+			return report, err
+		}
+		report.From, report.To, report.Rows = health.From, health.To, health.Monthly
+	case "merchants":
+		from, to := reportPeriod(schedule, scheduledAt, location)
+		merchants, _, err := s.db.GetMerchantSpending(&user, from, to, csvRowLimit, 0)
+		if err != nil {
+			return report, err
+		}
+		report.From, report.To, report.Rows = from, to, merchants
+	default:
+		return report, fmt.Errorf("unknown report %q", schedule.Report)
+	}
+	return report, nil
+}
+
+// scheduledReportEmail is the data of the scheduled_report template. Last
+// is the last day of the report. The rows are inlined unless Attached.
+type scheduledReportEmail struct {
+	FirstName string
+	Title     string
+	From      time.Time
+	Last      time.Time
+	Count     int
+	Header    []string
+	Rows      [][]string
+	Attached  bool
+}
+
+// sendScheduledReport computes the report of the schedule run at
+// scheduledAt and queues its email, recording it in the delivery. It
+// returns the title of the report.
+func (s *FiberServer) sendScheduledReport(schedule types.ReportSchedule, user types.User, scheduledAt time.Time, delivery *types.ReportDelivery) (string, error) {
+	l := s.localizer(user)
+	report, err := s.computeScheduledReport(schedule, user, l, scheduledAt)
+	if err != nil {
+		return report.Title, err
+	}
+
+	header, rows, err := csvTable(report.Rows)
+	if err != nil {
+		return report.Title, err
+	}
+	delivery.Rows = len(rows)
+	delivery.Attached = attachReport(schedule.Format, len(rows))
+
+	data := scheduledReportEmail{
+		FirstName: user.FirstName,
+		Title:     report.Title,
+		From:      report.From,
+		Last:      report.To.Add(-time.Nanosecond),
+		Count:     len(rows),
+		Attached:  delivery.Attached,
+	}
+	if !delivery.Attached {
+		data.Header, data.Rows = header, rows
+	}
+	message, err := mail.Render("scheduled_report", l, user.Email, data)
+	if err != nil {
+		return report.Title, err
+	}
+	if delivery.Attached {
+		var attachment bytes.Buffer
+		if _, err := io.WriteString(&attachment, utf8BOM); err != nil {
+			return report.Title, err
+		}
+		if err := writeCSV(&attachment, report.Rows); err != nil {
+			return report.Title, err
+		}
+		message.Attachments = []mail.Attachment{{
+			Filename:    fmt.Sprintf("%s-%s.csv", strings.ReplaceAll(schedule.Report, "_", "-"), scheduledAt.In(userLocation(user)).Format(time.DateOnly)),
+			ContentType: "text/csv",
+			Data:        attachment.Bytes(),
+		}}
+	}
+
+	message.UserID = &user.ID
+	message.DeliveryID = uuid.New()
+	if err := s.mailQueue.Enqueue(message); err != nil {
+		return report.Title, err
+	}
+	delivery.EmailDeliveryID = &message.DeliveryID
+	return report.Title, nil
+}
+
+// StartReportSchedules periodically emails the scheduled reports that are
+// due. The interval should be an hour at most so that the reports are sent
+// close to their hour.
+func (s *FiberServer) StartReportSchedules(interval time.Duration) {
+	s.every("report_schedules", interval, func(now time.Time) error {
+		s.deliverScheduledReports(now)
+		return nil
+	})
+}
+
+func (s *FiberServer) deliverScheduledReports(now time.Time) {
+	after := uuid.Nil
+	for {
+		schedules := s.db.GetDueReportSchedules(now, after, reportScheduleBatchSize)
+		for _, schedule := range schedules {
+			s.deliverScheduledReport(schedule, now)
+		}
+
+		if len(schedules) < reportScheduleBatchSize {
+			return
+		}
+		after = schedules[len(schedules)-1].ID
+	}
+}
+
+// deliverScheduledReport runs a due schedule once, the runs missed while
+// the server was down included, and records the delivery. A failed run
+// notifies the user, and pauses the schedule after
+// reportScheduleMaxFailures in a row.
+func (s *FiberServer) deliverScheduledReport(schedule types.ReportSchedule, now time.Time) {
+	user := schedule.User
+	scheduledAt := schedule.NextRunAt
+
+	// Claimed before sending: a report lost in a crash is better than one
+	// sent twice
+	claimed, err := s.db.ClaimReportSchedule(&schedule, nextReportRun(schedule, now, userLocation(user)))
+	if err != nil {
+		log.Error("Error claiming report schedule: ", err)
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	delivery := &types.ReportDelivery{
+		ID:          uuid.New(),
+		ScheduleID:  schedule.ID,
+		UserID:      user.ID,
+		Report:      schedule.Report,
+		ScheduledAt: scheduledAt,
+		Status:      "queued",
+	}
+	title, err := s.sendScheduledReport(schedule, user, scheduledAt, delivery)
+	if err != nil {
+		log.Error("Error sending scheduled report: ", err)
+		delivery.Status = "failed"
+		delivery.Error = err.Error()
+		schedule.Failures++
+		schedule.Paused = schedule.Failures >= reportScheduleMaxFailures
+	} else {
+		schedule.Failures = 0
+	}
+	schedule.LastRunAt = &now
+	schedule.LastStatus = delivery.Status
+	schedule.LastError = delivery.Error
+
+	if err := s.db.RecordReportDelivery(&schedule, delivery); err != nil {
+		log.Error("Error recording report delivery: ", err)
+	}
+	if delivery.Status != "failed" {
+		return
+	}
+
+	event := "scheduled_report_failed"
+	if schedule.Paused {
+		event = "scheduled_report_paused"
+	}
+	err = s.Notify(context.Background(), user.ID, event, NotificationPayload{
+		Params:  i18n.Params{"report": title, "error": delivery.Error, "failures": schedule.Failures},
+		Details: fiber.Map{"schedule_id": schedule.ID, "report": schedule.Report, "failures": schedule.Failures, "error": delivery.Error},
+	})
+	if err != nil {
+		log.Error("Error notifying scheduled report failure: ", err)
+	}
+}
+
+// findUserReportSchedule returns the report schedule of the user.
+func (s *FiberServer) findUserReportSchedule(user types.User, id string) (types.ReportSchedule, bool) {
+	schedule := s.db.GetReportScheduleByID(id)
+	if schedule.ID == uuid.Nil || schedule.UserID != user.ID {
+		return types.ReportSchedule{}, false
+	}
+	return schedule, true
+}
+
+// reportScheduleRequest is the body saving a report schedule. The omitted
+// fields default to Monday, the 1st of the month, 8am and inline.
+type reportScheduleRequest struct {
+	Report             string     `json:"report"`
+	ReportDefinitionID *uuid.UUID `json:"report_definition_id"`
+	Frequency          string     `json:"frequency"`
+	Weekday            *int       `json:"weekday"`
+	Day                *int       `json:"day"`
+	Hour               *int       `json:"hour"`
+	Format             string     `json:"format"`
+}
+
+// parseReportSchedule reads and checks the body saving a report schedule
+// and sets it on the schedule.
+func (s *FiberServer) parseReportSchedule(c *fiber.Ctx, user types.User, schedule *types.ReportSchedule) error {
+	var body reportScheduleRequest
+	if err := c.BodyParser(&body); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+
+	invalid := func(field, message string, value any) error {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid report schedule").
+			WithDetails(FieldError{Field: field, Message: message, Value: value})
+	}
+	if !slices.Contains(constants.SCHEDULED_REPORTS, body.Report) {
+		return invalid("report", "unknown report", body.Report)
+	}
+	schedule.Report = body.Report
+	schedule.ReportDefinitionID = nil
+	if body.Report == "custom" {
+		if body.ReportDefinitionID == nil {
+			return invalid("report_definition_id", "required for a custom report", nil)
+		}
+		if _, ok := s.findUserReportDefinition(user, body.ReportDefinitionID.String()); !ok {
+			return invalid("report_definition_id", "unknown custom report", body.ReportDefinitionID.String())
+		}
+		schedule.ReportDefinitionID = body.ReportDefinitionID
+	}
+
+	if body.Frequency != "weekly" && body.Frequency != "monthly" {
+		return invalid("frequency", "must be weekly or monthly", body.Frequency)
+	}
+	schedule.Frequency = body.Frequency
+	schedule.Weekday, schedule.Day, schedule.Hour = int(time.Monday), 1, 8
+	if body.Weekday != nil {
+		if *body.Weekday < 0 || *body.Weekday > 6 {
+			return invalid("weekday", "must be between 0 (Sunday) and 6", *body.Weekday)
+		}
+		schedule.Weekday = *body.Weekday
+	}
+	if body.Day != nil {
+		if *body.Day < 1 || *body.Day > 28 {
+			return invalid("day", "must be between 1 and 28", *body.Day)
+		}
+		schedule.Day = *body.Day
+	}
+	if body.Hour != nil {
+		if *body.Hour < 0 || *body.Hour > 23 {
+			return invalid("hour", "must be between 0 and 23", *body.Hour)
+		}
+		schedule.Hour = *body.Hour
+	}
+
+	schedule.Format = body.Format
+	if schedule.Format == "" {
+		schedule.Format = "inline"
+	}
+	if schedule.Format != "inline" && schedule.Format != "csv" {
+		return invalid("format", "must be inline or csv", body.Format)
+	}
+	return nil
+}
+
+// CreateReportSchedule schedules a report of the user, a custom report
+// they saved or a canned one, to be emailed to them weekly or monthly at
+// an hour of their timezone.
+func (s *FiberServer) CreateReportSchedule(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	schedule := &types.ReportSchedule{ID: uuid.New(), UserID: user.ID}
+	if err := s.parseReportSchedule(c, user, schedule); err != nil {
+		return err
+	}
+	schedule.NextRunAt = nextReportRun(*schedule, time.Now(), userLocation(user))
+
+	if err := s.db.CreateReportSchedule(schedule); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not schedule the report")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(schedule)
+}
+
+// GetReportSchedules lists the report schedules of the user, with the
+// status of their last run.
+func (s *FiberServer) GetReportSchedules(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+
+	schedules := s.db.GetReportSchedules(user.ID)
+	if schedules == nil {
+		schedules = []types.ReportSchedule{}
+	}
+	return c.JSON(schedules)
+}
+
+// UpdateReportSchedule replaces the report, the schedule and the format of
+// a report schedule of the user. Its next run follows the new schedule.
+func (s *FiberServer) UpdateReportSchedule(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	schedule, ok := s.findUserReportSchedule(user, c.Params("id"))
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Report schedule not found")
+	}
+	if err := s.parseReportSchedule(c, user, &schedule); err != nil {
+		return err
+	}
+	schedule.NextRunAt = nextReportRun(schedule, time.Now(), userLocation(user))
+
+	if err := s.db.UpdateReportSchedule(&schedule); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not update the report schedule")
+	}
+
+	return c.JSON(schedule)
+}
+
+// DeleteReportSchedule deletes a report schedule of the user.
+func (s *FiberServer) DeleteReportSchedule(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	schedule, ok := s.findUserReportSchedule(user, c.Params("id"))
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Report schedule not found")
+	}
+
+	if err := s.db.DeleteReportSchedule(&schedule); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not delete the report schedule")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// PauseReportSchedule stops emailing a report of the user until resumed.
+func (s *FiberServer) PauseReportSchedule(c *fiber.Ctx) error {
+	return s.setReportSchedulePaused(c, true)
+}
+
+// ResumeReportSchedule emails a paused report of the user again from its
+// next run, its failures forgotten.
+func (s *FiberServer) ResumeReportSchedule(c *fiber.Ctx) error {
+	return s.setReportSchedulePaused(c, false)
+}
+
+func (s *FiberServer) setReportSchedulePaused(c *fiber.Ctx, paused bool) error {
+	user := c.Locals("user").(types.User)
+	schedule, ok := s.findUserReportSchedule(user, c.Params("id"))
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Report schedule not found")
+	}
+
+	schedule.Paused = paused
+	if !paused {
+		schedule.Failures = 0
+		schedule.NextRunAt = nextReportRun(schedule, time.Now(), userLocation(user))
+	}
+	if err := s.db.UpdateReportSchedule(&schedule); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not update the report schedule")
+	}
+
+	return c.JSON(schedule)
+}
+
+// GetReportDeliveries lists the latest runs of a report schedule of the
+// user, with the status of their email.
+func (s *FiberServer) GetReportDeliveries(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	schedule, ok := s.findUserReportSchedule(user, c.Params("id"))
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Report schedule not found")
+	}
+
+	deliveries := s.db.GetReportDeliveries(&schedule.ID, reportDeliveriesListed)
+	if deliveries == nil {
+		deliveries = []types.ReportDelivery{}
+	}
+	return c.JSON(deliveries)
+}
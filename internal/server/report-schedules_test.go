@@ -0,0 +1,201 @@
+package server
+
+import (
+	"FinMa/internal/config"
+	"FinMa/internal/database"
+	"FinMa/internal/mail"
+	"FinMa/internal/realtime"
+	"FinMa/types"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestNextReportRun(t *testing.T) {
+	location, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Fatal(err)
+	}
+	weekly := types.ReportSchedule{Frequency: "weekly", Weekday: int(time.Monday), Hour: 8}
+	monthly := types.ReportSchedule{Frequency: "monthly", Day: 1, Hour: 8}
+
+	tests := []struct {
+		name     string
+		schedule types.ReportSchedule
+		after    time.Time
+		expected time.Time
+	}{
+		{"later this week", weekly, time.Date(2024, time.March, 9, 12, 0, 0, 0, location), time.Date(2024, time.March, 11, 8, 0, 0, 0, location)},
+		{"later today", weekly, time.Date(2024, time.March, 11, 7, 0, 0, 0, location), time.Date(2024, time.March, 11, 8, 0, 0, 0, location)},
+		{"at the run", weekly, time.Date(2024, time.March, 11, 8, 0, 0, 0, location), time.Date(2024, time.March, 18, 8, 0, 0, 0, location)},
+		{"across the DST change", weekly, time.Date(2024, time.March, 29, 12, 0, 0, 0, location), time.Date(2024, time.April, 1, 8, 0, 0, 0, location)},
+		{"next month", monthly, time.Date(2024, time.March, 1, 9, 0, 0, 0, location), time.Date(2024, time.April, 1, 8, 0, 0, 0, location)},
+		{"next year", monthly, time.Date(2024, time.December, 15, 0, 0, 0, 0, location), time.Date(2025, time.January, 1, 8, 0, 0, 0, location)},
+		// 8am in Paris is 7am UTC in the winter
+		{"in the user's timezone", monthly, time.Date(2024, time.February, 1, 7, 30, 0, 0, time.UTC), time.Date(2024, time.March, 1, 8, 0, 0, 0, location)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if run := nextReportRun(tt.schedule, tt.after, location); !run.Equal(tt.expected) {
+				t.Errorf("expected %v; got %v", tt.expected, run)
+			}
+		})
+	}
+}
+
+func TestReportPeriod(t *testing.T) {
+	scheduledAt := time.Date(2024, time.March, 11, 8, 0, 0, 0, time.UTC)
+
+	from, to := reportPeriod(types.ReportSchedule{Frequency: "weekly"}, scheduledAt, time.UTC)
+	if !from.Equal(time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)) || !to.Equal(time.Date(2024, time.March, 11, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the 7 days before the run; got %v to %v", from, to)
+	}
+	from, to = reportPeriod(types.ReportSchedule{Frequency: "monthly"}, scheduledAt, time.UTC)
+	if !from.Equal(time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)) || !to.Equal(time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the previous month; got %v to %v", from, to)
+	}
+}
+
+func TestAttachReport(t *testing.T) {
+	if attachReport("inline", reportInlineRows) {
+		t.Error("expected the rows up to the threshold to be inlined")
+	}
+	if !attachReport("inline", reportInlineRows+1) {
+		t.Error("expected the rows past the threshold to be attached")
+	}
+	if !attachReport("csv", 1) {
+		t.Error("expected the rows to be attached when asked")
+	}
+}
+
+// reportScheduleDB knows the due schedules and the merchants, and records
+// the claims, the deliveries and the notifications.
+type reportScheduleDB struct {
+	database.Service
+	schedules     []types.ReportSchedule
+	merchants     int
+	claimed       map[uuid.UUID]time.Time
+	deliveries    []types.ReportDelivery
+	notifications []string
+}
+
+func (db *reportScheduleDB) GetDueReportSchedules(now time.Time, after uuid.UUID, limit int) []types.ReportSchedule {
+	if after != uuid.Nil {
+		return nil
+	}
+	return db.schedules
+}
+
+func (db *reportScheduleDB) ClaimReportSchedule(schedule *types.ReportSchedule, next time.Time) (bool, error) {
+	if _, ok := db.claimed[schedule.ID]; ok {
+		return false, nil
+	}
+	db.claimed[schedule.ID] = next
+	return true, nil
+}
+
+func (db *reportScheduleDB) RecordReportDelivery(schedule *types.ReportSchedule, delivery *types.ReportDelivery) error {
+	for i := range db.schedules {
+		if db.schedules[i].ID == schedule.ID {
+			db.schedules[i] = *schedule
+		}
+	}
+	db.deliveries = append(db.deliveries, *delivery)
+	return nil
+}
+
+func (db *reportScheduleDB) GetMerchantSpending(user *types.User, from, to time.Time, limit, offset int) ([]types.MerchantSpending, int64, error) {
+	merchants := make([]types.MerchantSpending, db.merchants)
+	for i := range merchants {
+		merchants[i] = types.MerchantSpending{Merchant: fmt.Sprintf("Shop %d", i), Total: money(10), Count: 1}
+	}
+	return merchants, int64(len(merchants)), nil
+}
+
+func (db *reportScheduleDB) GetReportDefinitionByID(id string) types.ReportDefinition {
+	return types.ReportDefinition{}
+}
+
+func (db *reportScheduleDB) GetNotificationPreference(userID uuid.UUID, event string) (types.NotificationPreference, bool) {
+	return types.NotificationPreference{}, false
+}
+
+func (db *reportScheduleDB) GetUserByID(id uuid.UUID) types.User {
+	return types.User{ID: id}
+}
+
+func (db *reportScheduleDB) CreateNotification(notification *types.Notification) error {
+	db.notifications = append(db.notifications, notification.Type)
+	return nil
+}
+
+func TestDeliverScheduledReports(t *testing.T) {
+	user := types.User{ID: uuid.New(), FirstName: "Ada", Email: "ada@example.com"}
+	now := time.Date(2024, time.March, 11, 8, 10, 0, 0, time.UTC)
+	due := time.Date(2024, time.March, 11, 8, 0, 0, 0, time.UTC)
+	inline := types.ReportSchedule{ID: uuid.New(), Report: "merchants", Frequency: "weekly", Weekday: 1, Hour: 8, Format: "inline", NextRunAt: due, UserID: user.ID, User: user}
+	missing := types.ReportSchedule{ID: uuid.New(), Report: "custom", Frequency: "weekly", Weekday: 1, Hour: 8, Format: "inline", NextRunAt: due, UserID: user.ID, User: user}
+	definitionID := uuid.New()
+	missing.ReportDefinitionID = &definitionID
+	missing.Failures = reportScheduleMaxFailures - 1
+
+	mailer := mail.NewMockMailer()
+	queue := mail.NewQueue(mailer, nil, mail.QueueConfig{Size: 10, Backoff: time.Millisecond})
+	db := &reportScheduleDB{schedules: []types.ReportSchedule{inline, missing}, merchants: 3, claimed: map[uuid.UUID]time.Time{}}
+	s := &FiberServer{config: config.Default(), db: db, hub: realtime.NewHub(0), mailQueue: queue}
+
+	s.deliverScheduledReports(now)
+	if next := db.claimed[inline.ID]; !next.Equal(due.AddDate(0, 0, 7)) {
+		t.Errorf("expected the next run a week later; got %v", next)
+	}
+	if len(db.deliveries) != 2 {
+		t.Fatalf("expected 2 deliveries; got %+v", db.deliveries)
+	}
+	if delivery := db.deliveries[0]; delivery.Status != "queued" || delivery.Rows != 3 || delivery.Attached || delivery.EmailDeliveryID == nil {
+		t.Errorf("expected the merchants queued inline; got %+v", delivery)
+	}
+	if delivery := db.deliveries[1]; delivery.Status != "failed" || delivery.Error == "" {
+		t.Errorf("expected the deleted custom report to fail; got %+v", delivery)
+	}
+	if schedule := db.schedules[1]; !schedule.Paused || schedule.Failures != reportScheduleMaxFailures || schedule.LastStatus != "failed" {
+		t.Errorf("expected the failing schedule to be paused; got %+v", schedule)
+	}
+	if len(db.notifications) != 1 || db.notifications[0] != "scheduled_report_paused" {
+		t.Errorf("expected the pause to be notified; got %v", db.notifications)
+	}
+
+	// Claimed runs are not delivered again
+	s.deliverScheduledReports(now)
+	if len(db.deliveries) != 2 {
+		t.Errorf("expected no delivery of a claimed run; got %d", len(db.deliveries))
+	}
+
+	// Past the threshold the rows are attached
+	large := inline
+	large.ID = uuid.New()
+	db.schedules = []types.ReportSchedule{large}
+	db.merchants = reportInlineRows + 1
+	s.deliverScheduledReports(now)
+	queue.Close()
+
+	if delivery := db.deliveries[2]; !delivery.Attached || delivery.Rows != reportInlineRows+1 {
+		t.Errorf("expected the large report attached; got %+v", delivery)
+	}
+	messages := mailer.Messages()
+	if len(messages) != 2 {
+		t.Fatalf("expected 2 emails; got %d", len(messages))
+	}
+	if !strings.Contains(messages[0].HTML, "<td style=\"border-bottom: 1px solid #e4e7eb; padding: 4px 8px;\">Shop 0</td>") || len(messages[0].Attachments) != 0 {
+		t.Errorf("expected the rows inlined in the first email; got %q", messages[0].HTML)
+	}
+	if strings.Contains(messages[1].HTML, "Shop 0") || len(messages[1].Attachments) != 1 || !strings.Contains(string(messages[1].Attachments[0].Data), "Shop 50") {
+		t.Errorf("expected the rows attached to the second email; got %q, %+v", messages[1].HTML, messages[1].Attachments)
+	}
+	if name := messages[1].Attachments[0].Filename; name != "merchants-2024-03-11.csv" {
+		t.Errorf("expected the attachment merchants-2024-03-11.csv; got %q", name)
+	}
+}
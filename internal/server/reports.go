@@ -0,0 +1,269 @@
+package server
+
+import (
+	"FinMa/types"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// parseReportRange reads the from and to query parameters (RFC3339).
+// The range defaults to the last 90 days. Read through a share grant, it
+// defaults to the dates of the grant and is narrowed to them.
+func parseReportRange(c *fiber.Ctx) (time.Time, time.Time, error) {
+	to := time.Now()
+	from := to.AddDate(0, 0, -90)
+	grant, shared := sharedGrant(c)
+	if shared {
+		from, to = grant.From, grant.To
+	}
+
+	if value := c.Query("from"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return from, to, fiber.NewError(fiber.StatusBadRequest, "Invalid from date format")
+		}
+		from = parsed
+	}
+
+	if value := c.Query("to"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return from, to, fiber.NewError(fiber.StatusBadRequest, "Invalid to date format")
+		}
+		to = parsed
+	}
+
+	if to.Before(from) {
+		return from, to, fiber.NewError(fiber.StatusBadRequest, "from must be before to")
+	}
+	if shared {
+		from, to = clampToGrant(grant, from, to)
+	}
+
+	return from, to, nil
+}
+
+// parseReportAccounts reads the accounts the ?account_ids=id,id query
+// parameter restricts a report to, accounts the user can view, none when
+// it is empty.
+func (s *FiberServer) parseReportAccounts(c *fiber.Ctx, user types.User) ([]uuid.UUID, error) {
+	var accountIDs []uuid.UUID
+	var invalid []FieldError
+	if value := c.Query("account_ids"); value != "" {
+		for _, id := range strings.Split(value, ",") {
+			account, ok := s.findUserBankAccount(user, strings.TrimSpace(id), "viewer")
+			if !ok {
+				invalid = append(invalid, FieldError{Field: "account_ids", Message: "unknown bank account", Value: id})
+				continue
+			}
+			accountIDs = append(accountIDs, account.ID)
+		}
+	}
+	if len(invalid) > 0 {
+		return nil, NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid bank accounts").WithDetails(invalid...)
+	}
+	return accountIDs, nil
+}
+
+// GetSpendingPatterns returns the expenses grouped by day of the week and by
+// day of the month, bucketed in the user's timezone.
+// Query parameters: from, to (RFC3339) and an optional category.
+// The CSV holds a row per bucket of both dimensions.
+func (s *FiberServer) GetSpendingPatterns(c *fiber.Ctx) error {
+	db := s.dbFor(c)
+
+	user := c.Locals("user").(types.User)
+
+	from, to, err := parseReportRange(c)
+	if err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, err.Error())
+	}
+
+	category := c.Query("category")
+	if category != "" && !isValidCategory(category) {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid transaction category")
+	}
+
+	// Without dates the range moves with the time, within the TTL
+	key := []string{c.Query("from"), c.Query("to"), category}
+	return cachedReport(s, c, "spending_patterns", key, func() (types.SpendingPatterns, error) {
+		patterns, err := db.GetSpendingPatterns(&user, from, to, category, userTimezone(user))
+		patterns.Currency = s.baseCurrency(user)
+		if err != nil {
+			log.Error(err)
+			return patterns, NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not compute spending patterns")
+		}
+		return patterns, nil
+	}, spendingPatternRows)
+}
+
+// spendingPatternRow is a bucket of the spending patterns in CSV, the
+// dimension is "weekday" or "day_of_month".
+type spendingPatternRow struct {
+	Dimension string `csv:"dimension"`
+	types.SpendingPatternBucket
+}
+
+// spendingPatternRows returns the buckets of both dimensions as CSV rows.
+func spendingPatternRows(patterns types.SpendingPatterns) any {
+	rows := make([]spendingPatternRow, 0, len(patterns.ByWeekday)+len(patterns.ByDayOfMonth))
+	for _, bucket := range patterns.ByWeekday {
+		rows = append(rows, spendingPatternRow{Dimension: "weekday", SpendingPatternBucket: bucket})
+	}
+	for _, bucket := range patterns.ByDayOfMonth {
+		rows = append(rows, spendingPatternRow{Dimension: "day_of_month", SpendingPatternBucket: bucket})
+	}
+	return rows
+}
+
+// countsInNetWorth reports whether the account is part of the net worth at
+// the given date. Archived accounts stop counting once archived, unless the
+// user chose to keep them.
+func countsInNetWorth(account types.BankAccount, at time.Time) bool {
+	return account.ArchivedAt == nil || account.KeepInNetWorth || account.ArchivedAt.After(at)
+}
+
+// netWorthRate returns the rate converting the balance of the account at
+// the end of the month of the series to the base currency.
+type netWorthRate func(account types.BankAccount, month time.Time) float64
+
+// buildNetWorthHistory computes the net worth at the end of each month from
+// the initial balance and the monthly flows of the accounts. months holds the
+// first day of each month of the series; flows dated before the first month
+// are part of the starting balance. The balances are converted with rate,
+// nil when every account is in the base currency, and rounded to the minor
+// unit of currency.
+func buildNetWorthHistory(accounts []types.BankAccount, flows []types.AccountMonthlyFlow, months []time.Time, rate netWorthRate, currency string) []types.NetWorthPoint {
+	history := make([]types.NetWorthPoint, 0, len(months))
+
+	for _, month := range months {
+		monthEnd := month.AddDate(0, 1, 0)
+		var total int64
+
+		for _, account := range accounts {
+			if !countsInNetWorth(account, monthEnd) {
+				continue
+			}
+			var balance int64
+			if account.OpeningDate == nil || account.OpeningDate.Before(monthEnd) {
+				balance += account.InitialBalance.Unbound().Minor
+			}
+			for _, flow := range flows {
+				if flow.AccountID == account.ID && flow.Month.Before(monthEnd) {
+					balance += flow.Net.Unbound().Minor
+				}
+			}
+			if rate != nil {
+				balance = types.NewMoney(balance, "").Mul(rate(account, month)).Round(currency).Minor
+			}
+			total += balance
+		}
+
+		history = append(history, types.NetWorthPoint{
+			Month:    month,
+			NetWorth: types.NewMoney(total, ""),
+		})
+	}
+
+	return history
+}
+
+// lastMonths returns the first day of the last n months, the current month included.
+func lastMonths(now time.Time, n int) []time.Time {
+	current := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	months := make([]time.Time, 0, n)
+	for i := n - 1; i >= 0; i-- {
+		months = append(months, current.AddDate(0, -i, 0))
+	}
+	return months
+}
+
+// GetNetWorth returns the current net worth (assets minus liabilities) and
+// its value at the end of each of the last ?months=12 months, computed from
+// the transaction history, in the base currency of the user: the current
+// balances are converted at the rate of today, the past ones at the rate of
+// the end of their month. Shared accounts are included unless
+// ?include_shared=false. The CSV holds the history.
+func (s *FiberServer) GetNetWorth(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+
+	months := c.QueryInt("months", 12)
+	if months <= 0 || months > 120 {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "months must be between 1 and 120")
+	}
+
+	excludeShared := c.Query("include_shared") == "false"
+	key := []string{strconv.Itoa(months), strconv.FormatBool(excludeShared)}
+	return cachedReport(s, c, "net_worth", key, func() (types.NetWorth, error) {
+		return s.computeNetWorth(c, user, months, excludeShared)
+	}, func(netWorth types.NetWorth) any {
+		return netWorth.History
+	})
+}
+
+// computeNetWorth computes the net worth of the user and its history over
+// the last months.
+func (s *FiberServer) computeNetWorth(c *fiber.Ctx, user types.User, months int, excludeShared bool) (types.NetWorth, error) {
+	db := s.dbFor(c)
+
+	timezone := userTimezone(user)
+	location, _ := time.LoadLocation(timezone)
+	now := time.Now().In(location)
+
+	accounts := []types.BankAccount{}
+	for _, account := range db.GetBankAccounts(&user, true) {
+		if !excludeShared || account.UserID == user.ID {
+			accounts = append(accounts, account)
+		}
+	}
+	flows := db.GetMonthlyAccountFlows(&user, timezone, excludeShared)
+
+	// The rates of the month ends and of today are fetched before
+	// building the history, which cannot fail
+	converter := s.converter(c, user)
+	series := lastMonths(now, months)
+	rates := map[string]float64{}
+	for _, account := range accounts {
+		for _, month := range series {
+			rate, err := converter.rate(account.Currency, month.AddDate(0, 1, -1))
+			if err != nil {
+				return types.NetWorth{}, exchangeRateUnavailable(err)
+			}
+			rates[account.Currency+month.Format(time.DateOnly)] = rate
+		}
+	}
+
+	netWorth := types.NetWorth{
+		Currency: s.baseCurrency(user),
+		History: buildNetWorthHistory(accounts, flows, series, func(account types.BankAccount, month time.Time) float64 {
+			return rates[account.Currency+month.Format(time.DateOnly)]
+		}, s.baseCurrency(user)),
+	}
+
+	var assets, liabilities int64
+	for _, account := range accounts {
+		if !countsInNetWorth(account, now) {
+			continue
+		}
+		rate, err := converter.rate(account.Currency, now)
+		if err != nil {
+			return netWorth, exchangeRateUnavailable(err)
+		}
+		balance := account.Balance.Unbound().Mul(rate).Round(netWorth.Currency)
+		if isLiability(account.AccountType) {
+			liabilities -= balance.Minor
+		} else {
+			assets += balance.Minor
+		}
+	}
+	netWorth.Assets = types.NewMoney(assets, "")
+	netWorth.Liabilities = types.NewMoney(liabilities, "")
+	netWorth.Current = types.NewMoney(assets-liabilities, "")
+
+	return netWorth, nil
+}
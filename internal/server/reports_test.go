@@ -0,0 +1,248 @@
+package server
+
+import (
+	"FinMa/internal/database"
+	"FinMa/types"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+func month(year int, m time.Month) time.Time {
+	return time.Date(year, m, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func TestBuildNetWorthHistory(t *testing.T) {
+	checking := types.BankAccount{ID: uuid.New(), AccountType: "checking"}
+	card := types.BankAccount{ID: uuid.New(), AccountType: "credit_card"}
+	archivedAt := time.Date(2024, time.March, 15, 0, 0, 0, 0, time.UTC)
+	closed := types.BankAccount{ID: uuid.New(), AccountType: "savings", ArchivedAt: &archivedAt}
+
+	flows := []types.AccountMonthlyFlow{
+		// Flows before the series start are part of the opening balance
+		{AccountID: checking.ID, Month: month(2023, time.December), Net: money(1000)},
+		{AccountID: checking.ID, Month: month(2024, time.January), Net: money(200)},
+		{AccountID: card.ID, Month: month(2024, time.January), Net: money(-150)},
+		{AccountID: closed.ID, Month: month(2024, time.January), Net: money(500)},
+		{AccountID: checking.ID, Month: month(2024, time.February), Net: money(-300)},
+		{AccountID: card.ID, Month: month(2024, time.March), Net: money(150)},
+		{AccountID: checking.ID, Month: month(2024, time.March), Net: money(-150)},
+	}
+
+	months := []time.Time{month(2024, time.January), month(2024, time.February), month(2024, time.March)}
+	history := buildNetWorthHistory([]types.BankAccount{checking, card, closed}, flows, months, nil, "")
+
+	// January: 1000 + 200 - 150 + 500 = 1550
+	// February: 1550 - 300 = 1250
+	// March: the savings account is archived in March, 1250 - 500 + 150 - 150 = 750
+	expected := moneys(1550, 1250, 750)
+
+	if len(history) != len(expected) {
+		t.Fatalf("expected %d points; got %d", len(expected), len(history))
+	}
+	for i, point := range history {
+		if !point.Month.Equal(months[i]) {
+			t.Errorf("expected month %v; got %v", months[i], point.Month)
+		}
+		if point.NetWorth != expected[i] {
+			t.Errorf("expected net worth %v for %v; got %v", expected[i], months[i].Month(), point.NetWorth)
+		}
+	}
+
+	// Keeping the archived account in the net worth keeps its balance
+	closed.KeepInNetWorth = true
+	history = buildNetWorthHistory([]types.BankAccount{checking, card, closed}, flows, months, nil, "")
+	if history[2].NetWorth != money(1250) {
+		t.Errorf("expected net worth 1250 when keeping the archived account; got %v", history[2].NetWorth)
+	}
+}
+
+func TestBuildNetWorthHistoryInitialBalance(t *testing.T) {
+	openingDate := time.Date(2024, time.February, 10, 0, 0, 0, 0, time.UTC)
+	savings := types.BankAccount{ID: uuid.New(), AccountType: "savings", InitialBalance: money(5000), OpeningDate: &openingDate}
+	legacy := types.BankAccount{ID: uuid.New(), AccountType: "checking", InitialBalance: money(300)}
+
+	flows := []types.AccountMonthlyFlow{
+		{AccountID: savings.ID, Month: month(2024, time.February), Net: money(100)},
+	}
+
+	months := []time.Time{month(2024, time.January), month(2024, time.February)}
+	history := buildNetWorthHistory([]types.BankAccount{savings, legacy}, flows, months, nil, "")
+
+	// The savings account only counts from its opening date
+	expected := moneys(300, 5400)
+	for i, point := range history {
+		if point.NetWorth != expected[i] {
+			t.Errorf("expected net worth %v for %v; got %v", expected[i], months[i].Month(), point.NetWorth)
+		}
+	}
+}
+
+func TestLastMonths(t *testing.T) {
+	months := lastMonths(time.Date(2024, time.January, 20, 10, 0, 0, 0, time.UTC), 3)
+	expected := []time.Time{month(2023, time.November), month(2023, time.December), month(2024, time.January)}
+
+	for i := range expected {
+		if !months[i].Equal(expected[i]) {
+			t.Errorf("expected %v; got %v", expected[i], months[i])
+		}
+	}
+}
+
+// netWorthDB holds the accounts and the transactions of the net worth
+// fixture. The monthly flows are summed like the query: the signed amount
+// on the account of the transaction, and the amount of a transfer on the
+// account it credits.
+type netWorthDB struct {
+	*adminDB
+	accounts     []types.BankAccount
+	transactions []types.Transaction
+}
+
+func (db *netWorthDB) WithContext(context.Context) database.Service {
+	return db
+}
+
+func (db *netWorthDB) GetBankAccounts(user *types.User, includeArchived bool) []types.BankAccount {
+	return db.accounts
+}
+
+func (db *netWorthDB) GetMonthlyAccountFlows(user *types.User, timezone string, excludeShared bool) []types.AccountMonthlyFlow {
+	nets := map[uuid.UUID]map[time.Time]float64{}
+	add := func(accountID uuid.UUID, date time.Time, net float64) {
+		if nets[accountID] == nil {
+			nets[accountID] = map[time.Time]float64{}
+		}
+		nets[accountID][time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)] += net
+	}
+	for _, transaction := range db.transactions {
+		amount := transaction.Amount.Float64()
+		if transaction.Type == "income" {
+			add(transaction.BankAccountID, transaction.Date, amount)
+		} else {
+			add(transaction.BankAccountID, transaction.Date, -amount)
+		}
+		if transaction.Type == "transfer" && transaction.TransferAccountID != nil {
+			add(*transaction.TransferAccountID, transaction.Date, amount)
+		}
+	}
+
+	flows := []types.AccountMonthlyFlow{}
+	for accountID, months := range nets {
+		for month, net := range months {
+			flows = append(flows, types.AccountMonthlyFlow{AccountID: accountID, Month: month, Net: money(net)})
+		}
+	}
+	return flows
+}
+
+func TestGetNetWorth(t *testing.T) {
+	s, admin, _, user := newAdminTestServer(t)
+	months := lastMonths(time.Now().UTC(), 3)
+	before, first, second, third := months[0].AddDate(0, -1, 0), months[0], months[1], months[2]
+
+	checking := types.BankAccount{ID: uuid.New(), AccountType: "checking", InitialBalance: money(1000), Balance: money(2280)}
+	savings := types.BankAccount{ID: uuid.New(), AccountType: "savings", Balance: money(305)}
+	card := types.BankAccount{ID: uuid.New(), AccountType: "credit_card", Balance: money(-80)}
+	transaction := func(account types.BankAccount, transactionType string, amount float64, date time.Time, to *types.BankAccount) types.Transaction {
+		transaction := types.Transaction{ID: uuid.New(), BankAccountID: account.ID, Type: transactionType, Amount: money(amount), Date: date.AddDate(0, 0, 9)}
+		if to != nil {
+			transaction.TransferAccountID = &to.ID
+		}
+		return transaction
+	}
+	s.db = &netWorthDB{adminDB: admin, accounts: []types.BankAccount{checking, savings, card}, transactions: []types.Transaction{
+		transaction(checking, "income", 2000, before, nil),
+		transaction(checking, "expense", 300, first, nil),
+		transaction(card, "expense", 120, first, nil),
+		transaction(checking, "transfer", 500, first, &savings),
+		transaction(checking, "transfer", 120, second, &card),
+		transaction(savings, "income", 5, second, nil),
+		transaction(card, "expense", 80, third, nil),
+		transaction(savings, "transfer", 200, third, &checking),
+	}}
+
+	resp := adminRequest(t, s, user, "GET", "/api/v1/reports/net-worth?months=3", "")
+	var netWorth types.NetWorth
+	json.NewDecoder(resp.Body).Decode(&netWorth)
+	if resp.StatusCode != fiber.StatusOK || len(netWorth.History) != 3 {
+		t.Fatalf("expected 3 months of history; got %d %+v", resp.StatusCode, netWorth)
+	}
+
+	// Checking, savings and card at the end of each month, the transfers
+	// move money between the accounts without changing the net worth:
+	// first: 1000 + 2000 - 300 - 500 = 2200, 500, -120 = 2580
+	// second: 2200 - 120 = 2080, 500 + 5 = 505, -120 + 120 = 0 = 2585
+	// third: 2080 + 200 = 2280, 505 - 200 = 305, -80 = 2505
+	expected := moneys(2580, 2585, 2505)
+	for i, point := range netWorth.History {
+		if !point.Month.Equal(months[i]) || point.NetWorth != expected[i] {
+			t.Errorf("expected %v at the end of %v; got %v at %v", expected[i], months[i].Month(), point.NetWorth, point.Month)
+		}
+	}
+	if netWorth.Assets != money(2585) || netWorth.Liabilities != money(80) || netWorth.Current != money(2505) {
+		t.Errorf("expected 2585 of assets, 80 of liabilities and a net worth of 2505; got %+v", netWorth)
+	}
+
+	if resp := adminRequest(t, s, user, "GET", "/api/v1/reports/net-worth?months=0", ""); resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("expected a history of no month refused; got %d", resp.StatusCode)
+	}
+}
+
+// spendingPatternsDB answers a Friday bucket and records the range, the
+// category and the timezone asked for.
+type spendingPatternsDB struct {
+	*adminDB
+	from, to           time.Time
+	category, timezone string
+}
+
+func (db *spendingPatternsDB) WithContext(context.Context) database.Service {
+	return db
+}
+
+func (db *spendingPatternsDB) GetSpendingPatterns(user *types.User, from, to time.Time, category, timezone string) (types.SpendingPatterns, error) {
+	db.from, db.to, db.category, db.timezone = from, to, category, timezone
+	return types.SpendingPatterns{
+		From:         from,
+		To:           to,
+		Timezone:     timezone,
+		ByWeekday:    []types.SpendingPatternBucket{{Bucket: 5, Total: money(180), Average: money(60), Count: 3}},
+		ByDayOfMonth: []types.SpendingPatternBucket{{Bucket: 12, Total: money(180), Average: money(90), Count: 2}},
+	}, nil
+}
+
+func TestGetSpendingPatterns(t *testing.T) {
+	s, admin, _, user := newAdminTestServer(t)
+	user.Timezone = "Europe/Paris"
+	admin.users[user.ID] = user
+	db := &spendingPatternsDB{adminDB: admin}
+	s.db = db
+
+	resp := adminRequest(t, s, user, "GET", "/api/v1/reports/patterns?from=2024-03-01T00:00:00Z&to=2024-04-01T00:00:00Z&category=food", "")
+	var patterns types.SpendingPatterns
+	json.NewDecoder(resp.Body).Decode(&patterns)
+	if resp.StatusCode != fiber.StatusOK || len(patterns.ByWeekday) != 1 || patterns.ByWeekday[0].Bucket != 5 || patterns.ByWeekday[0].Count != 3 {
+		t.Fatalf("expected the Friday bucket; got %d %+v", resp.StatusCode, patterns)
+	}
+	if db.timezone != "Europe/Paris" || db.category != "food" || !db.from.Equal(time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the range and the category bucketed in the timezone of the user; got %s %s from %v", db.timezone, db.category, db.from)
+	}
+
+	for name, query := range map[string]string{
+		"unknown category": "?category=unicorns",
+		"invalid date":     "?from=yesterday",
+		"reversed range":   "?from=2024-04-01T00:00:00Z&to=2024-03-01T00:00:00Z",
+	} {
+		resp := adminRequest(t, s, user, "GET", "/api/v1/reports/patterns"+query, "")
+		var body errorBody
+		json.NewDecoder(resp.Body).Decode(&body)
+		if resp.StatusCode != fiber.StatusBadRequest || body.Error.Code != CodeInvalidRequest {
+			t.Errorf("%s: expected the request refused; got %d %+v", name, resp.StatusCode, body)
+		}
+	}
+}
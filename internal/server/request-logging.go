@@ -0,0 +1,164 @@
+package server
+
+import (
+	"FinMa/internal/config"
+	"FinMa/internal/logging"
+	"FinMa/types"
+	"FinMa/utils"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the ID of a request, it is taken from the request
+// when the caller sets it and returned in the response.
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID limits the request IDs accepted from the callers, the
+// others are replaced with a generated one.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// sensitivePathPrefixes are the paths whose request bodies are never
+// logged, they hold passwords and tokens. The deprecated aliases are listed
+// too.
+var sensitivePathPrefixes = []string{
+	APIPrefix + "/auth/", APIPrefix + "/push/", APIPrefix + "/digest/",
+	"/api/auth/", "/api/push/", "/api/digest/",
+}
+
+// quietPaths are the paths logged at the debug level only, the health
+// checks and the scrapes would flood the log.
+var quietPaths = []string{APIPrefix + "/health", "/api/health", "/metrics", livenessPath, readinessPath}
+
+// RequestLogSettings configures the request log.
+type RequestLogSettings struct {
+	Format     string     // "json" or "text"
+	Level      slog.Level // Requests below the level are not logged
+	LogBodies  bool       // Log the request bodies, except on the sensitive paths
+	BodyLength int        // Longest body logged, longer ones are truncated
+	// SlowThreshold is the latency from which a request is logged as slow,
+	// at the warning level at least and with its route
+	SlowThreshold time.Duration
+}
+
+// requestLogSettings returns the request log settings of the configuration.
+func requestLogSettings(cfg config.Server) RequestLogSettings {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Log.Level)); err != nil {
+		level = slog.LevelInfo
+	}
+	return RequestLogSettings{
+		Format:        cfg.Log.Format,
+		Level:         level,
+		LogBodies:     cfg.Log.RequestBodies,
+		BodyLength:    cfg.Log.RequestBodyLength,
+		SlowThreshold: time.Duration(cfg.SlowRequestThreshold) * time.Millisecond,
+	}
+}
+
+// newRequestLogger returns the structured logger of the requests, writing
+// to w in the configured format with the emails and the secrets redacted.
+func newRequestLogger(w io.Writer, settings RequestLogSettings) *slog.Logger {
+	options := &slog.HandlerOptions{Level: settings.Level}
+	if settings.Format == "text" {
+		return slog.New(logging.NewHandler(slog.NewTextHandler(w, options)))
+	}
+	return slog.New(logging.NewHandler(slog.NewJSONHandler(w, options)))
+}
+
+// requestIDFor returns the request ID sent by the caller when it is valid,
+// or a new one.
+func requestIDFor(c *fiber.Ctx) string {
+	if requestID := c.Get(RequestIDHeader); validRequestID.MatchString(requestID) {
+		return requestID
+	}
+	return uuid.NewString()
+}
+
+// hasPathPrefix reports whether path is one of the paths or below them.
+func hasPathPrefix(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if path == strings.TrimSuffix(prefix, "/") || strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestLogging returns the middleware giving every request an ID and
+// logging one line per request once it is handled. The ID is returned in
+// the response headers, and attached to the locals and the user context of
+// the request for the layers below. The query string and the headers are
+// never logged, they may hold access tokens and cookies.
+func requestLogging(logger *slog.Logger, settings RequestLogSettings) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		requestID := requestIDFor(c)
+		c.Set(RequestIDHeader, requestID)
+		c.Locals("request_id", requestID)
+		c.SetUserContext(utils.WithRequestID(c.UserContext(), requestID))
+
+		err := c.Next()
+		if err != nil {
+			// Let the error handler write the response before logging its status
+			if handlerErr := c.App().ErrorHandler(c, err); handlerErr != nil {
+				c.Status(fiber.StatusInternalServerError)
+			}
+		}
+
+		status := c.Response().StatusCode()
+		level := slog.LevelInfo
+		switch {
+		case status >= fiber.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= fiber.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+		path := c.Path()
+		if hasPathPrefix(path, quietPaths) && level == slog.LevelInfo {
+			level = slog.LevelDebug
+		}
+		latency := time.Since(start)
+		slow := settings.SlowThreshold > 0 && latency >= settings.SlowThreshold
+		if slow {
+			level = max(level, slog.LevelWarn)
+		}
+
+		attributes := []slog.Attr{
+			slog.String("request_id", requestID),
+			slog.String("method", c.Method()),
+			slog.String("path", path),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(latency.Microseconds())/1000),
+			slog.Int("bytes", len(c.Response().Body())),
+			slog.String("ip", c.IP()),
+		}
+		if slow {
+			attributes = append(attributes, slog.Bool("slow", true), slog.String("route", c.Route().Path))
+		}
+		if user, ok := c.Locals("user").(types.User); ok {
+			attributes = append(attributes, slog.String("user_id", user.ID.String()))
+		}
+		if settings.LogBodies && !hasPathPrefix(path, sensitivePathPrefixes) {
+			if body := c.Body(); len(body) > 0 {
+				attributes = append(attributes, slog.String("body", string(body[:min(len(body), settings.BodyLength)])))
+			}
+		}
+
+		logger.LogAttrs(c.UserContext(), level, "request", attributes...)
+		return nil
+	}
+}
+
+// defaultRequestLogging logs the requests to the standard output with the
+// settings of the configuration.
+func defaultRequestLogging(cfg config.Server) fiber.Handler {
+	settings := requestLogSettings(cfg)
+	return requestLogging(newRequestLogger(os.Stdout, settings), settings)
+}
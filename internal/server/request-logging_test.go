@@ -0,0 +1,167 @@
+package server
+
+import (
+	"FinMa/types"
+	"FinMa/utils"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+func newRequestLoggingTestApp(output *bytes.Buffer, userID uuid.UUID) *fiber.App {
+	settings := RequestLogSettings{Level: slog.LevelInfo, LogBodies: true, BodyLength: 2048}
+	app := fiber.New()
+	app.Use(requestLogging(newRequestLogger(output, settings), settings))
+
+	app.Get("/api/health", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+	app.Post("/api/auth/login", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	})
+	app.Post("/api/goals", func(c *fiber.Ctx) error {
+		c.Locals("user", types.User{ID: userID})
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{"request_id": utils.RequestID(c.UserContext())})
+	})
+	return app
+}
+
+func TestRequestLogging(t *testing.T) {
+	var output bytes.Buffer
+	userID := uuid.New()
+	app := newRequestLoggingTestApp(&output, userID)
+
+	req, err := http.NewRequest("POST", "/api/goals?access_token=secret", strings.NewReader(`{"name":"Holidays"}`))
+	if err != nil {
+		t.Fatalf("error creating request. Err: %v", err)
+	}
+	req.Header.Set(RequestIDHeader, "client-id-1")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+	if requestID := resp.Header.Get(RequestIDHeader); requestID != "client-id-1" {
+		t.Errorf("expected the request ID of the caller to be propagated; got %q", requestID)
+	}
+
+	var body map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body["request_id"] != "client-id-1" {
+		t.Errorf("expected the request ID in the user context; got %v, %v", body, err)
+	}
+
+	var line map[string]any
+	if err := json.Unmarshal(output.Bytes(), &line); err != nil {
+		t.Fatalf("expected one JSON line; got %q", output.String())
+	}
+	expected := map[string]any{
+		"msg":        "request",
+		"level":      "INFO",
+		"request_id": "client-id-1",
+		"method":     "POST",
+		"path":       "/api/goals",
+		"status":     float64(201),
+		"user_id":    userID.String(),
+		"body":       `{"name":"Holidays"}`,
+	}
+	for key, value := range expected {
+		if line[key] != value {
+			t.Errorf("expected %s to be %v; got %v", key, value, line[key])
+		}
+	}
+	for _, key := range []string{"latency_ms", "bytes", "ip"} {
+		if _, ok := line[key]; !ok {
+			t.Errorf("expected %s to be logged", key)
+		}
+	}
+	if strings.Contains(output.String(), "secret") {
+		t.Errorf("expected the query string not to be logged; got %s", output.String())
+	}
+}
+
+func TestRequestLoggingSensitiveAndQuietPaths(t *testing.T) {
+	var output bytes.Buffer
+	app := newRequestLoggingTestApp(&output, uuid.New())
+
+	req, err := http.NewRequest("GET", "/api/health", nil)
+	if err != nil {
+		t.Fatalf("error creating request. Err: %v", err)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+	if resp.Header.Get(RequestIDHeader) == "" {
+		t.Errorf("expected a generated request ID")
+	}
+	if output.Len() != 0 {
+		t.Errorf("expected the health check not to be logged at the info level; got %s", output.String())
+	}
+
+	req, err = http.NewRequest("POST", "/api/auth/login", strings.NewReader(`{"password":"Secret123"}`))
+	if err != nil {
+		t.Fatalf("error creating request. Err: %v", err)
+	}
+	req.Header.Set(RequestIDHeader, "not a valid id")
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+	if requestID := resp.Header.Get(RequestIDHeader); requestID == "not a valid id" || requestID == "" {
+		t.Errorf("expected an invalid request ID to be replaced; got %q", requestID)
+	}
+	if strings.Contains(output.String(), "Secret123") {
+		t.Errorf("expected the body of an auth request not to be logged; got %s", output.String())
+	}
+	if !strings.Contains(output.String(), `"level":"WARN"`) {
+		t.Errorf("expected a client error to be logged as a warning; got %s", output.String())
+	}
+}
+
+func TestRequestLoggingSlowRequests(t *testing.T) {
+	var output bytes.Buffer
+	settings := RequestLogSettings{Level: slog.LevelInfo, SlowThreshold: 20 * time.Millisecond}
+	app := fiber.New()
+	app.Use(requestLogging(newRequestLogger(&output, settings), settings))
+	app.Get("/api/v1/reports/:name", func(c *fiber.Ctx) error {
+		if c.Params("name") == "net-worth" {
+			time.Sleep(30 * time.Millisecond)
+		}
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	for _, path := range []string{"/api/v1/reports/patterns", "/api/v1/reports/net-worth"} {
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatalf("error creating request. Err: %v", err)
+		}
+		if _, err := app.Test(req); err != nil {
+			t.Fatalf("error making request to server. Err: %v", err)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected two lines; got %q", output.String())
+	}
+	var fast, slow map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &fast); err != nil {
+		t.Fatalf("expected a JSON line; got %q", lines[0])
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &slow); err != nil {
+		t.Fatalf("expected a JSON line; got %q", lines[1])
+	}
+
+	if fast["level"] != "INFO" || fast["slow"] != nil {
+		t.Errorf("expected the fast request to be logged at the info level; got %v", fast)
+	}
+	if slow["level"] != "WARN" || slow["slow"] != true || slow["route"] != "/api/v1/reports/:name" {
+		t.Errorf("expected the slow request to be logged as a warning with its route; got %v", slow)
+	}
+}
@@ -1,13 +1,41 @@
 package server
 
 import (
+	"FinMa/internal/flags"
+
+	"github.com/charmbracelet/log"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
 )
 
 func (s *FiberServer) RegisterFiberRoutes() {
+	// CORS is registered before the routes so that the preflight requests
+	// are answered without going through Authorize
+	corsSettings, err := corsConfig(s.config.Server.CORS)
+	if err != nil {
+		log.Fatal("Invalid CORS configuration: ", err)
+	}
+	s.Use(cors.New(corsSettings))
+
+	// Scraped by Prometheus and probed by the orchestrator, outside of the
+	// versioned API
+	s.Get("/metrics", s.GetMetrics)
+	s.Get(livenessPath, s.Liveness)
+	s.Get(readinessPath, s.Readiness)
+
+	legacy := legacyAPISettings(s.config.Server)
+	s.registerAPIRoutes(s.Group(APIPrefix))
+	if legacy.Enabled {
+		s.registerAPIRoutes(s.Group(legacyAPIPrefix, deprecatedAPI(legacy)))
+	}
+}
+
+// registerAPIRoutes declares the routes of the API on the group, mounted
+// under the current version and under the deprecated aliases.
+func (s *FiberServer) registerAPIRoutes(api fiber.Router) {
 	// [Groups]
-	api := s.Group("/api")
 	auth := api.Group("/auth")
+	admin := api.Group("/admin", s.Authorize("admin"), adminRateLimiter(), s.auditAdminActions)
 
 	// [Middlewares]
 	// api.Use(middlewares.Authorize)
@@ -15,20 +43,260 @@ func (s *FiberServer) RegisterFiberRoutes() {
 	// [Routes]
 	// General routes
 	api.Get("/", s.HelloWorldHandler)
-	api.Get("/health", s.healthHandler)
+	api.Get("/health", s.Authorize("admin"), s.healthHandler)
+	api.Get("/openapi.json", s.GetOpenAPISpec)
+	api.Post("/batch", s.Authorize("user"), s.Batch)
+	if s.config.Server.APIDocs {
+		api.Get("/docs", s.GetAPIDocs)
+	}
 
 	// Auth routes
-	auth.Post("/signup", s.SignUpHandler)
-	auth.Post("/login", s.LoginHandler)
-	auth.Post("/refresh", s.RefreshHandler)
+	auth.Post("/signup", s.handlers.SignUp)
+	auth.Post("/login", s.handlers.Login)
+	auth.Post("/refresh", s.handlers.Refresh)
+	auth.Post("/reset-password", s.handlers.ResetPassword)
+
+	// Demo routes, public
+	api.Get("/demo/start", s.requireDemo, demoRateLimiter(s.config.Features.DemoHourlyLimit), s.StartDemo)
+
+	// User routes
+	api.Post("/users/me/avatar", s.Authorize("user"), s.UploadAvatar)
+	api.Delete("/users/me/avatar", s.Authorize("user"), s.DeleteAvatar)
+	api.Get("/usage", s.Authorize("user"), s.GetUsage)
+
+	// Billing routes, the webhook is public and verified by its signature
+	api.Get("/billing/status", s.Authorize("user"), s.GetBillingStatus)
+	api.Post("/billing/checkout-session", s.Authorize("user"), s.requireBilling, s.CreateCheckoutSession)
+	api.Post("/billing/portal", s.Authorize("user"), s.requireBilling, s.CreatePortalSession)
+	api.Post("/billing/stripe-webhook", s.requireBilling, s.verifyWebhook(stripeWebhooks), s.StripeWebhook)
+	// Public, the avatars are shown in img tags
+	api.Get("/users/:id/avatar", s.GetAvatar)
 
 	// Bank account routes
-	api.Post("/bank-accounts", s.Authorize("user"), s.CreateBankAccount)
+	api.Post("/accounts", s.Authorize("user"), s.CreateBankAccount)
+	api.Get("/accounts", s.Authorize("user"), s.GetBankAccounts)
+	api.Put("/accounts/order", s.Authorize("user"), s.ReorderBankAccounts)
+	api.Patch("/accounts/:id", s.Authorize("user"), s.UpdateBankAccount)
+	api.Get("/accounts/:id/balance", s.Authorize("user"), s.GetBankAccountBalance)
+	api.Get("/accounts/:id/transactions", s.Authorize("user"), s.GetAccountTransactions)
+	api.Get("/accounts/:id/balance-history", s.Authorize("user"), s.GetBalanceHistory)
+	api.Get("/accounts/:id/statement-cycle", s.Authorize("user"), s.GetStatementCycle)
+	api.Post("/accounts/:id/interest-rates", s.Authorize("user"), s.CreateInterestRate)
+	api.Get("/accounts/:id/interest-rates", s.Authorize("user"), s.GetInterestRates)
+	api.Get("/accounts/:id/projection", s.Authorize("user"), s.GetBalanceProjection)
+	api.Post("/accounts/:id/archive", s.Authorize("user"), s.ArchiveBankAccount)
+	api.Post("/accounts/:id/unarchive", s.Authorize("user"), s.UnarchiveBankAccount)
+	api.Post("/accounts/:id/members", s.Authorize("user"), s.InviteAccountMember)
+	api.Get("/accounts/:id/members", s.Authorize("user"), s.GetAccountMembers)
+	api.Delete("/accounts/:id/members/:memberId", s.Authorize("user"), s.RemoveAccountMember)
+	api.Get("/account-invites", s.Authorize("user"), s.GetAccountInvites)
+	api.Post("/account-invites/:id/accept", s.Authorize("user"), s.AcceptAccountInvite)
+
+	// Household routes
+	api.Post("/households", s.Authorize("user"), s.requireFlag(flags.Households), s.CreateHousehold)
+	api.Get("/household", s.Authorize("user"), s.requireFlag(flags.Households), s.GetHousehold)
+	api.Post("/household/members", s.Authorize("user"), s.requireFlag(flags.Households), s.InviteHouseholdMember)
+	api.Delete("/household/members/:memberId", s.Authorize("user"), s.requireFlag(flags.Households), s.RemoveHouseholdMember)
+	api.Put("/household/view", s.Authorize("user"), s.requireFlag(flags.Households), s.SetHouseholdView)
+	api.Get("/household-invites", s.Authorize("user"), s.requireFlag(flags.Households), s.GetHouseholdInvites)
+	api.Post("/household-invites/:id/accept", s.Authorize("user"), s.requireFlag(flags.Households), s.AcceptHouseholdInvite)
+	api.Put("/accounts/:id/household", s.Authorize("user"), s.requireFlag(flags.Households), s.ShareBankAccountWithHousehold)
+	api.Delete("/accounts/:id/household", s.Authorize("user"), s.requireFlag(flags.Households), s.ShareBankAccountWithHousehold)
+	api.Put("/budgets/:id/household", s.Authorize("user"), s.requireFlag(flags.Households), s.ShareBudgetWithHousehold)
+	api.Delete("/budgets/:id/household", s.Authorize("user"), s.requireFlag(flags.Households), s.ShareBudgetWithHousehold)
+	api.Post("/accounts/:id/reconciliations", s.Authorize("user"), s.CreateReconciliation)
+	api.Get("/accounts/:id/reconciliations", s.Authorize("user"), s.GetReconciliations)
+	api.Get("/accounts/:id/reconciliations/:reconciliationId", s.Authorize("user"), s.GetReconciliation)
+	api.Post("/accounts/:id/reconciliations/:reconciliationId/transactions", s.Authorize("user"), s.ReconcileTransactions)
+
+	// Bank connection routes
+	api.Get("/bank-connections", s.Authorize("user"), s.requireFlag(flags.BankSync), s.requireBankSync, s.GetBankConnections)
+	api.Post("/bank-connections", s.Authorize("user"), s.requireFlag(flags.BankSync), s.requireBankSync, s.CreateBankConnection)
+	api.Get("/bank-connections/institutions", s.Authorize("user"), s.requireFlag(flags.BankSync), s.requireBankSync, s.GetInstitutions)
+	api.Get("/bank-connections/:id/accounts", s.Authorize("user"), s.requireFlag(flags.BankSync), s.requireBankSync, s.GetExternalAccounts)
+	api.Post("/bank-connections/:id/attach", s.Authorize("user"), s.requireFlag(flags.BankSync), s.requireBankSync, s.AttachExternalAccount)
+	// Public, verified by its signature
+	api.Post("/bank-connections/webhook", s.requireBankSync, s.verifyWebhook(bankSyncWebhooks), s.BankSyncWebhook)
 
 	// Transaction routes
 	api.Post("/transactions", s.Authorize("user"), s.CreateTransaction)
 	api.Get("/transactions", s.Authorize("user"), s.GetTransactions)
+	api.Patch("/transactions/bulk", s.Authorize("user"), s.BulkUpdateTransactions)
 	api.Get("/transactions/:id", s.Authorize("user"), s.GetTransactionByID)
+	api.Patch("/transactions/:id", s.Authorize("user"), s.UpdateTransaction)
+	api.Delete("/transactions/:id", s.Authorize("user"), s.DeleteTransaction)
+	api.Post("/transactions/:id/dismiss-flag", s.Authorize("user"), s.DismissTransactionFlag)
+	api.Post("/transactions/:id/unreconcile", s.Authorize("user"), s.UnreconcileTransaction)
+
+	// Import routes
+	api.Post("/import/mint", s.Authorize("user"), s.ImportMint)
+	api.Post("/import/ynab", s.Authorize("user"), s.ImportYNAB)
+
+	// Share routes
+	api.Post("/shares", s.Authorize("user"), s.CreateShareGrant)
+	api.Get("/shares", s.Authorize("user"), s.GetShareGrants)
+	api.Get("/shares/received", s.Authorize("user"), s.GetReceivedShareGrants)
+	api.Delete("/shares/:id", s.Authorize("user"), s.RevokeShareGrant)
+
+	// Onboarding routes
+	api.Post("/onboarding", s.Authorize("user"), s.Onboard)
+
+	// Privacy routes
+	api.Get("/privacy/requests", s.Authorize("user"), s.GetPrivacyRequests)
+	api.Post("/privacy/export", s.Authorize("user"), s.CreatePrivacyExport)
+	api.Get("/privacy/requests/:id/archive", s.Authorize("user"), s.GetPrivacyExportArchive)
+	api.Post("/privacy/requests/:id/cancel", s.Authorize("user"), s.CancelPrivacyRequest)
+	api.Post("/privacy/erasure-request", s.Authorize("user"), s.CreateErasureRequest)
+	// Public, the emailed link may be opened on another device
+	api.Post("/privacy/erasure-request/confirm", s.ConfirmErasureRequest)
+
+	// Category routes
+	api.Get("/categories", s.Authorize("user"), s.GetCategories)
+	api.Put("/categories/:category", s.Authorize("user"), s.UpdateCategorySetting)
+
+	// Setting routes
+	api.Get("/settings/tax", s.Authorize("user"), s.GetTaxSetting)
+	api.Put("/settings/tax", s.Authorize("user"), s.UpdateTaxSetting)
+	api.Delete("/settings/tax", s.Authorize("user"), s.DeleteTaxSetting)
+
+	// Budget routes
+	api.Post("/budgets", s.Authorize("user"), s.CreateBudget)
+	api.Get("/budgets", s.Authorize("user"), s.GetBudgets)
+	api.Get("/budgets/progress", s.Authorize("user"), s.GetBudgetsProgress)
+	api.Post("/budgets/copy-from-previous", s.Authorize("user"), s.CopyBudgetsFromPrevious)
+	api.Post("/budget-templates", s.Authorize("user"), s.CreateBudgetTemplate)
+	api.Get("/budget-templates", s.Authorize("user"), s.GetBudgetTemplates)
+	api.Post("/budget-templates/:id/apply", s.Authorize("user"), s.ApplyBudgetTemplate)
+	api.Get("/budgets/:id/progress", s.Authorize("user"), s.GetBudgetProgress)
+	api.Get("/budgets/:id/forecast", s.Authorize("user"), s.GetBudgetForecast)
+	api.Get("/budgets/:id/history", s.Authorize("user"), s.GetBudgetHistory)
+	api.Patch("/budgets/:id", s.Authorize("user"), s.UpdateBudget)
+	api.Delete("/budgets/:id", s.Authorize("user"), s.DeleteBudget)
+	api.Get("/budgets/:id/transactions", s.Authorize("user"), s.GetBudgetTransactions)
+
+	// Envelope budgeting routes
+	api.Put("/budgeting-mode", s.Authorize("user"), s.SetBudgetingMode)
+	api.Post("/allocations", s.Authorize("user"), s.CreateAllocations)
+	api.Get("/allocations/unassigned", s.Authorize("user"), s.GetUnassignedIncome)
+	api.Post("/allocation-rules", s.Authorize("user"), s.CreateAllocationRule)
+	api.Get("/allocation-rules", s.Authorize("user"), s.GetAllocationRules)
+	api.Delete("/allocation-rules/:id", s.Authorize("user"), s.DeleteAllocationRule)
+	api.Get("/allocation-rules/:id/preview", s.Authorize("user"), s.PreviewAllocationRule)
+
+	// Goal routes
+	api.Post("/goals", s.Authorize("user"), s.CreateGoal)
+	api.Get("/goals", s.Authorize("user"), s.GetGoals)
+	api.Get("/goals/:id", s.Authorize("user"), s.GetGoal)
+	api.Patch("/goals/:id", s.Authorize("user"), s.UpdateGoal)
+	api.Delete("/goals/:id", s.Authorize("user"), s.DeleteGoal)
+	api.Post("/goals/:id/contributions", s.Authorize("user"), s.CreateGoalContribution)
+	api.Get("/goals/:id/contributions", s.Authorize("user"), s.GetGoalContributions)
+	api.Delete("/goals/:id/contributions/:contributionId", s.Authorize("user"), s.DeleteGoalContribution)
+
+	// Bill routes
+	api.Post("/bills", s.Authorize("user"), s.CreateBill)
+	api.Get("/bills", s.Authorize("user"), s.GetBills)
+	api.Get("/bills/upcoming", s.Authorize("user"), s.GetUpcomingBills)
+	api.Get("/bills/:id", s.Authorize("user"), s.GetBill)
+	api.Patch("/bills/:id", s.Authorize("user"), s.UpdateBill)
+	api.Delete("/bills/:id", s.Authorize("user"), s.DeleteBill)
+
+	// Subscription routes
+	api.Get("/subscriptions", s.Authorize("user"), s.GetSubscriptions)
+	api.Get("/subscriptions/detect", s.Authorize("user"), s.DetectSubscriptions)
+	api.Post("/subscriptions/confirm", s.Authorize("user"), s.ConfirmSubscription)
+	api.Post("/subscriptions/dismiss", s.Authorize("user"), s.DismissSubscription)
+
+	// Locale routes
+	api.Put("/locale", s.Authorize("user"), s.SetLocale)
+	api.Put("/timezone", s.Authorize("user"), s.SetTimezone)
+	api.Put("/base-currency", s.Authorize("user"), s.SetBaseCurrency)
+
+	// Settings routes
+	api.Get("/settings/export", s.Authorize("user"), s.ExportSettings)
+	api.Post("/settings/import", s.Authorize("user"), s.ImportSettings)
+
+	// Delta sync routes
+	api.Get("/sync", s.Authorize("user"), s.GetSyncChanges)
+	api.Post("/sync", s.Authorize("user"), s.PushSyncChanges)
+
+	// Activity routes
+	api.Get("/activity", s.Authorize("user"), s.GetActivity)
+
+	// Notification routes
+	api.Get("/notifications/preferences", s.Authorize("user"), s.GetNotificationPreferences)
+	api.Put("/notifications/preferences", s.Authorize("user"), s.UpdateNotificationPreferences)
+	// Unsubscribe links are opened from emails, the token authenticates them
+	api.Get("/digest/unsubscribe", s.UnsubscribeDigest)
+	api.Post("/digest/unsubscribe", s.UnsubscribeDigest)
+
+	// Push routes
+	api.Get("/push/public-key", s.Authorize("user"), s.GetPushPublicKey)
+	api.Post("/push/subscribe", s.Authorize("user"), s.SubscribePush)
+	api.Delete("/push/subscribe", s.Authorize("user"), s.UnsubscribePush)
+
+	// Real-time routes
+	api.Get("/ws", queryAccessToken, s.Authorize("user"), s.WebSocket)
+	api.Get("/events", queryAccessToken, s.Authorize("user"), s.GetEvents)
+
+	// Feature flag routes
+	api.Get("/flags", s.Authorize("user"), s.GetFlags)
+
+	// Exchange rate routes
+	api.Get("/exchange-rates", s.Authorize("user"), s.GetExchangeRate)
+
+	// Dashboard routes
+	api.Get("/dashboard", s.Authorize("user"), s.GetDashboard)
+
+	// Report routes
+	api.Get("/reports/patterns", s.Authorize("user"), s.GetSpendingPatterns)
+	api.Get("/reports/net-worth", s.Authorize("user"), s.GetNetWorth)
+	api.Get("/reports/budget-vs-actual", s.Authorize("user"), s.GetBudgetVsActual)
+	api.Get("/reports/cashflow", s.Authorize("user"), s.GetCashFlow)
+	api.Get("/reports/yoy", s.Authorize("user"), s.GetYearOverYear)
+	api.Get("/reports/category-trend", s.Authorize("user"), s.GetCategoryTrend)
+	api.Get("/reports/merchants", s.Authorize("user"), s.GetMerchants)
+	api.Get("/reports/flows", s.Authorize("user"), s.GetFlows)
+	api.Get("/reports/forecast", s.Authorize("user"), s.GetBalanceForecast)
+	api.Get("/reports/tax", s.Authorize("user"), s.GetTaxReport)
+	api.Get("/reports/health-metrics", s.Authorize("user"), s.GetHealthMetrics)
+	api.Get("/reports/heatmap", s.Authorize("user"), s.GetHeatmap)
+	api.Post("/reports/custom", s.Authorize("user"), s.CreateReportDefinition)
+	api.Get("/reports/custom", s.Authorize("user"), s.GetReportDefinitions)
+	api.Post("/reports/custom/run", s.Authorize("user"), s.RunCustomReport)
+	api.Get("/reports/custom/:id", s.Authorize("user"), s.GetCustomReport)
+	api.Put("/reports/custom/:id", s.Authorize("user"), s.UpdateReportDefinition)
+	api.Delete("/reports/custom/:id", s.Authorize("user"), s.DeleteReportDefinition)
+	api.Post("/reports/schedules", s.Authorize("user"), s.CreateReportSchedule)
+	api.Get("/reports/schedules", s.Authorize("user"), s.GetReportSchedules)
+	api.Put("/reports/schedules/:id", s.Authorize("user"), s.UpdateReportSchedule)
+	api.Delete("/reports/schedules/:id", s.Authorize("user"), s.DeleteReportSchedule)
+	api.Post("/reports/schedules/:id/pause", s.Authorize("user"), s.PauseReportSchedule)
+	api.Post("/reports/schedules/:id/resume", s.Authorize("user"), s.ResumeReportSchedule)
+	api.Get("/reports/schedules/:id/deliveries", s.Authorize("user"), s.GetReportDeliveries)
+
+	// Admin routes
+	admin.Get("/stats", s.GetAdminStats)
+	admin.Get("/users", s.GetAdminUsers)
+	admin.Post("/users/:id/reset-password", s.CreatePasswordResetLink)
+	admin.Get("/users/:id/flags", s.GetUserFlags)
+	admin.Post("/users/:id/flags", s.SetUserFlags)
+	admin.Get("/users/:id/limits", s.GetUserUsage)
+	admin.Post("/users/:id/limits", s.SetUserLimits)
+	admin.Get("/jobs", s.GetJobs)
+	admin.Get("/maintenance", s.GetMaintenance)
+	admin.Post("/maintenance", s.SetMaintenance)
+	admin.Post("/maintenance/recompute-balances", s.RunBalanceRecompute)
+	admin.Post("/maintenance/cleanup-now", s.RunCleanupNow)
+	admin.Post("/accounts/:id/recompute-balance", s.RecomputeBankAccountBalance)
+	admin.Post("/accounts/:id/backfill-snapshots", s.BackfillBalanceSnapshots)
+	admin.Get("/notifications/cleanup", s.GetNotificationCleanup)
+	admin.Post("/notifications/cleanup", s.RunNotificationCleanup)
+	admin.Get("/exchange-rates", s.GetExchangeRates)
+	admin.Get("/privacy-requests", s.GetAdminPrivacyRequests)
+	admin.Put("/exchange-rates/:id", s.UpdateExchangeRate)
+	admin.Post("/backup", s.CreateBackup)
+	admin.Post("/restore", s.RestoreBackup)
 
 }
 
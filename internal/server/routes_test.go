@@ -1,6 +1,7 @@
 package server
 
 import (
+	"FinMa/internal/config"
 	"github.com/gofiber/fiber/v2"
 	"io"
 	"net/http"
@@ -37,3 +38,68 @@ func TestHandler(t *testing.T) {
 		t.Errorf("expected response body to be %v; got %v", expected, string(body))
 	}
 }
+
+func TestLegacyAPIAliases(t *testing.T) {
+	cfg := config.Default()
+	cfg.Server.LegacySunset = "2027-06-30"
+	s := &FiberServer{App: fiber.New(fiber.Config{ErrorHandler: errorHandler}), config: cfg}
+	s.RegisterFiberRoutes()
+
+	get := func(path string) (*http.Response, string) {
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatalf("error creating request. Err: %v", err)
+		}
+		resp, err := s.Test(req)
+		if err != nil {
+			t.Fatalf("error making request to server. Err: %v", err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("error reading response body. Err: %v", err)
+		}
+		return resp, string(body)
+	}
+
+	for _, path := range []string{"/", "/accounts", "/transactions/bulk", "/admin/notifications/cleanup", "/ws", "/events"} {
+		t.Run(path, func(t *testing.T) {
+			current, currentBody := get(APIPrefix + path)
+			legacy, legacyBody := get("/api" + path)
+
+			if current.StatusCode != legacy.StatusCode || currentBody != legacyBody {
+				t.Errorf("expected identical responses; got %d %s and %d %s", current.StatusCode, currentBody, legacy.StatusCode, legacyBody)
+			}
+			if current.Header.Get("Deprecation") != "" {
+				t.Errorf("expected no Deprecation header under %s", APIPrefix)
+			}
+			if legacy.Header.Get("Deprecation") != "true" {
+				t.Errorf("expected the Deprecation header on the alias; got %q", legacy.Header.Get("Deprecation"))
+			}
+			if sunset := legacy.Header.Get("Sunset"); sunset != "Wed, 30 Jun 2027 00:00:00 GMT" {
+				t.Errorf("expected the Sunset header on the alias; got %q", sunset)
+			}
+			if link := legacy.Header.Get("Link"); link != "<"+APIPrefix+path+`>; rel="successor-version"` {
+				t.Errorf("expected a link to the successor; got %q", link)
+			}
+		})
+	}
+}
+
+func TestLegacyAPIAliasesDisabled(t *testing.T) {
+	cfg := config.Default()
+	cfg.Server.LegacyAliases = false
+	s := &FiberServer{App: fiber.New(fiber.Config{ErrorHandler: errorHandler}), config: cfg}
+	s.RegisterFiberRoutes()
+
+	req, err := http.NewRequest("GET", "/api/accounts", nil)
+	if err != nil {
+		t.Fatalf("error creating request. Err: %v", err)
+	}
+	resp, err := s.Test(req)
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected status 404; got %v", resp.Status)
+	}
+}
@@ -0,0 +1,20 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"FinMa/internal/scheduler"
+)
+
+// every runs job at each interval, aligned on the clock, until the server
+// shuts down. The runs are guarded by the advisory lock of the job.
+func (s *FiberServer) every(name string, interval time.Duration, job func(now time.Time) error) {
+	s.jobs.Schedule(scheduler.Job{
+		Name:     name,
+		Schedule: scheduler.Every(interval),
+		Run: func(_ context.Context, now time.Time) error {
+			return job(now)
+		},
+	})
+}
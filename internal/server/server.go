@@ -1,26 +1,188 @@
 package server
 
 import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/charmbracelet/log"
 	"github.com/gofiber/fiber/v2"
 
+	"FinMa/internal/banksync"
+	"FinMa/internal/billing"
+	"FinMa/internal/cache"
+	"FinMa/internal/config"
 	"FinMa/internal/database"
+	"FinMa/internal/flags"
+	"FinMa/internal/fx"
+	"FinMa/internal/mail"
+	"FinMa/internal/realtime"
+	"FinMa/internal/scheduler"
+	"FinMa/internal/storage"
+	"FinMa/utils"
 )
 
 type FiberServer struct {
 	*fiber.App
 
-	db database.Service
+	// config is the configuration loaded at startup
+	config   config.Config
+	db       database.Service
+	bankSync banksync.BankSyncProvider
+	// billing sells the pro plan, nil when billing is not configured
+	billing billing.Provider
+	// fx answers the exchange rates
+	fx *fx.Service
+	// tokens signs the access, refresh and unsubscribe tokens
+	tokens utils.Tokens
+	// handlers serves the authentication routes
+	handlers *Handler
+	// notifiers deliver the notifications by channel ("email", "push"),
+	// the channels without one are skipped
+	notifiers map[string]Notifier
+	// hub pushes the events of a user to their websocket connections
+	hub *realtime.Hub
+	// mailQueue sends the emails in the background
+	mailQueue *mail.Queue
+	// notificationCleanup tracks the runs of the notification retention job
+	notificationCleanup notificationCleanupTracker
+	// jobs runs the periodic background jobs
+	jobs scheduler.Scheduler
+	// storage keeps the uploaded files
+	storage storage.Storage
+	// cache keeps the dashboard and the reports for a short time, nil when
+	// disabled
+	cache cache.Cache
+	// flags evaluates the feature flags of the users
+	flags *flags.Evaluator
+	// maintenanceState is the maintenance mode last read from the database
+	maintenanceState maintenanceState
+	// metrics are exposed on /metrics
+	metrics *serverMetrics
+	// tls is the TLS setup of the listener, nil without TLS
+	tls *serverTLS
+	// redirect is the plain HTTP listener redirecting to HTTPS, if any
+	redirect *http.Server
+	// stopping is set once the shutdown signal is received, the readiness
+	// probe fails while the requests are still served
+	stopping atomic.Bool
+	// draining is set once the shutdown started, new requests are refused
+	draining atomic.Bool
 }
 
-func New() *FiberServer {
+// New builds the server from the configuration, connecting to the database
+// and starting the mail queue.
+func New(cfg config.Config) *FiberServer {
 	server := &FiberServer{
 		App: fiber.New(fiber.Config{
 			ServerHeader: "FinMa",
 			AppName:      "FinMa",
+			ErrorHandler: errorHandler,
+			// The bodies past the limit are streamed, bodyLimits refuses
+			// the ones too large for their route
+			BodyLimit:                    cfg.Server.BodyLimit * 1024,
+			StreamRequestBody:            true,
+			DisablePreParseMultipartForm: true,
 		}),
 
-		db: database.New(),
+		config: cfg,
+		db:     database.New(cfg.DB),
+		tokens: utils.Tokens{
+			AccessSecret:  cfg.Auth.AccessTokenSecret,
+			RefreshSecret: cfg.Auth.RefreshTokenSecret,
+		},
+		notifiers: map[string]Notifier{},
+		hub:       realtime.NewHub(cfg.Features.EventsRetention),
+	}
+
+	tls, err := newServerTLS(cfg.Server.TLS)
+	if err != nil {
+		log.Fatal("Invalid TLS configuration: ", err)
+	}
+	server.tls = tls
+
+	store, err := newStorage(cfg.Storage)
+	if err != nil {
+		log.Fatal("Invalid storage configuration: ", err)
+	}
+	server.storage = store
+	server.cache = newCache(cfg.Cache)
+	server.flags = flags.NewEvaluator(cfg.Features.FlagOverrides(), time.Minute, server.db.GetFeatureFlagOverrides)
+
+	if secretID := cfg.BankSync.GoCardlessSecretID; secretID != "" {
+		server.bankSync = banksync.NewGoCardlessProvider(secretID, cfg.BankSync.GoCardlessSecretKey)
+	}
+	if secretKey := cfg.Billing.StripeSecretKey; secretKey != "" {
+		server.billing = billing.NewStripeProvider(secretKey, cfg.Billing.StripeProPriceID)
+	}
+
+	exchangeRates, err := newFX(cfg.FX, server.db)
+	if err != nil {
+		log.Fatal("Invalid exchange rates configuration: ", err)
+	}
+	server.fx = exchangeRates
+	if err := server.db.SetDefaultCurrency(cfg.Features.Currency); err != nil {
+		log.Fatal("Could not set the currency of the accounts: ", err)
+	}
+
+	server.metrics = newServerMetrics(server.db)
+	server.jobs.Locker = server.db
+	server.jobs.OnRun = server.metrics.observeJobRun
+	server.jobs.Paused = server.inMaintenance
+	server.useMiddlewares(defaultRequestLogging(cfg.Server))
+
+	mailer := newMailer(cfg.SMTP)
+	server.mailQueue = newMailQueue(cfg.SMTP, mailer, deliveryRecorder{
+		DeliveryRecorder: server.db,
+		deliveries:       server.metrics.emailDeliveries,
+	})
+	server.notifiers["email"] = &emailNotifier{queue: server.mailQueue, currency: cfg.Features.Currency}
+	if client := newPushClient(cfg.Push); client != nil {
+		server.notifiers["push"] = &pushNotifier{
+			db:      server.db,
+			client:  client,
+			limiter: newPushRateLimiter(cfg.Push.HourlyLimit, time.Hour),
+		}
+	}
+
+	server.handlers = NewHandler(server.db, cfg.Auth, mailer, notificationDispatcher{server})
+	server.handlers.secureCookies = cfg.Server.TLS.Enabled()
+
+	server.db.OnTransactionChange(server.metrics.countTransactionCreated)
+	server.db.OnTransactionChange(server.checkBudgetAlerts)
+	server.db.OnTransactionChange(server.checkClosedBudgetPeriods)
+	server.db.OnTransactionChange(server.checkGoalContributions)
+	server.db.OnTransactionChange(server.applyAllocationRules)
+	// The subscription bills follow the price changes before being matched
+	server.db.OnTransactionChange(server.checkSubscriptionPrice)
+	server.db.OnTransactionChange(server.matchBillPayments)
+	server.db.OnTransactionChange(server.publishTransactionEvents)
+	server.db.OnLowBalance(server.notifyLowBalance)
+	if server.cache != nil {
+		server.db.OnDataChange(server.invalidateCaches)
 	}
 
 	return server
 }
+
+// useMiddlewares registers the middlewares wrapping every route, in order.
+func (s *FiberServer) useMiddlewares(requestLog fiber.Handler) {
+	// Catch the panics of the middlewares below
+	s.Use(s.recoverPanics)
+	// Measure the requests, once the request logging wrote the errors
+	s.Use(s.metrics.middleware)
+	s.Use(requestLog)
+	// Answer the panics of the handlers with a 500, logged and measured
+	s.Use(s.recoverPanics)
+	s.Use(s.rejectWhileDraining)
+	s.Use(s.rejectInMaintenance)
+	s.Use(bodyLimits(s.config.Server.BodyLimit*1024, s.config.Server.UploadBodyLimit*1024))
+	s.Use(requestTimeouts(
+		time.Duration(s.config.Server.RequestTimeout)*time.Second,
+		time.Duration(s.config.Server.LongRequestTimeout)*time.Second,
+	))
+	s.Use(compression())
+	if s.tls != nil && s.config.Server.TLS.HSTSMaxAge > 0 {
+		s.Use(strictTransportSecurity(s.config.Server.TLS.HSTSMaxAge))
+	}
+}
@@ -0,0 +1,431 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/internal/flags"
+	"FinMa/internal/fx"
+	"FinMa/internal/i18n"
+	"FinMa/types"
+)
+
+// settingsExportVersion is the version of the format of the settings
+// exports, the imports refuse the others.
+const settingsExportVersion = 1
+
+// The strategies of an import for the settings the user already has.
+const (
+	settingsSkipExisting     = "skip_existing"
+	settingsOverwrite        = "overwrite"
+	settingsRenameOnConflict = "rename_on_conflict" // The budget templates are created under a free name, the other settings are skipped
+)
+
+// ExportSettings returns the settings of the user as a portable document,
+// to import on another instance: their preferences, the settings of the
+// categories, the tax configuration, the muted merchants, the budget
+// templates and the notification preferences. Neither their transactions
+// nor any ID are exported.
+func (s *FiberServer) ExportSettings(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	export := types.SettingsExport{
+		Version:    settingsExportVersion,
+		ExportedAt: time.Now().UTC(),
+		Preferences: types.SettingsPreferences{
+			Timezone:      user.Timezone,
+			Locale:        user.Locale,
+			BaseCurrency:  user.BaseCurrency,
+			BudgetingMode: user.BudgetingMode,
+		},
+		Categories:              []types.SettingsCategory{},
+		MutedMerchants:          s.db.GetMutedMerchants(user.ID),
+		BudgetTemplates:         []types.SettingsBudgetTemplate{},
+		NotificationPreferences: []types.SettingsNotification{},
+	}
+
+	for _, setting := range s.db.GetCategorySettings(user.ID) {
+		export.Categories = append(export.Categories, types.SettingsCategory{
+			Category:         setting.Category,
+			ExcludeByDefault: setting.ExcludeByDefault,
+			Essential:        setting.Essential,
+		})
+	}
+	if setting, ok := s.db.GetTaxSetting(user.ID); ok {
+		export.Tax = settingsTax(setting)
+	}
+	if export.MutedMerchants == nil {
+		export.MutedMerchants = []string{}
+	}
+	for _, template := range s.db.GetBudgetTemplates(&user) {
+		export.BudgetTemplates = append(export.BudgetTemplates, settingsBudgetTemplate(template))
+	}
+	for _, preference := range s.db.GetNotificationPreferences(user.ID) {
+		export.NotificationPreferences = append(export.NotificationPreferences, types.SettingsNotification{
+			Event: preference.Event,
+			InApp: preference.InApp,
+			Email: preference.Email,
+			Push:  preference.Push,
+		})
+	}
+
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="finma-settings.json"`)
+	return c.JSON(export)
+}
+
+// ImportSettings applies a document of ExportSettings to the settings of
+// the user. ?strategy= tells what to do with the settings the user already
+// has: skip_existing (the default) keeps theirs, overwrite replaces them,
+// rename_on_conflict creates the budget templates under a free name. The
+// categories are matched by name, case insensitively; FinMa has a fixed set
+// of categories, the unknown ones are skipped and listed. With
+// ?dry_run=true nothing is written, the response lists what would change.
+func (s *FiberServer) ImportSettings(c *fiber.Ctx) error {
+	strategy := c.Query("strategy", settingsSkipExisting)
+	if strategy != settingsSkipExisting && strategy != settingsOverwrite && strategy != settingsRenameOnConflict {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid strategy").
+			WithDetails(FieldError{Field: "strategy", Message: "Must be skip_existing, overwrite or rename_on_conflict", Value: strategy})
+	}
+
+	var export types.SettingsExport
+	if err := json.Unmarshal(c.Body(), &export); err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+	if export.Version != settingsExportVersion {
+		return NewAPIError(fiber.StatusUnprocessableEntity, CodeValidationFailed, "Unsupported settings export").
+			WithDetails(FieldError{Field: "version", Message: fmt.Sprintf("Must be %d", settingsExportVersion), Value: export.Version})
+	}
+
+	user := c.Locals("user").(types.User)
+	merge := &settingsMerge{
+		s:        s,
+		user:     user,
+		strategy: strategy,
+		envelope: s.flagEnabled(c, flags.EnvelopeBudgeting),
+		result:   types.SettingsImportResult{DryRun: c.QueryBool("dry_run"), Strategy: strategy, Changes: []types.SettingsChange{}},
+		writes:   types.SettingsImport{Preferences: map[string]any{}},
+		unknown:  map[string]bool{},
+	}
+	merge.preferences(export.Preferences)
+	merge.categories(export.Categories)
+	merge.tax(export.Tax)
+	merge.mutedMerchants(export.MutedMerchants)
+	merge.budgetTemplates(export.BudgetTemplates)
+	merge.notificationPreferences(export.NotificationPreferences)
+
+	if !merge.result.DryRun {
+		if err := s.db.ImportSettings(user.ID, &merge.writes); err != nil {
+			log.Error("Error importing settings: ", err)
+			return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not import the settings")
+		}
+	}
+	return c.JSON(merge.result)
+}
+
+// settingsMerge resolves an import of settings against the settings of the
+// user, recording what it does with each of them.
+type settingsMerge struct {
+	s        *FiberServer
+	user     types.User
+	strategy string
+	envelope bool // Whether the envelope budgeting is enabled for the user
+	result   types.SettingsImportResult
+	writes   types.SettingsImport
+	unknown  map[string]bool // Unknown categories already listed
+}
+
+func (m *settingsMerge) record(kind, key, action, reason string) {
+	m.result.Changes = append(m.result.Changes, types.SettingsChange{Kind: kind, Key: key, Action: action, Reason: reason})
+}
+
+// conflict records the setting the user already has, and reports whether
+// it is overwritten.
+func (m *settingsMerge) conflict(kind, key string) bool {
+	if m.strategy == settingsOverwrite {
+		m.record(kind, key, "update", "")
+		return true
+	}
+	m.record(kind, key, "skip", "exists")
+	return false
+}
+
+// category returns the category of FinMa named name, case insensitively.
+// The unknown ones are listed once.
+func (m *settingsMerge) category(name string) (string, bool) {
+	normalized := strings.ToLower(strings.TrimSpace(name))
+	if isValidCategory(normalized) {
+		return normalized, true
+	}
+	if !m.unknown[normalized] {
+		m.unknown[normalized] = true
+		m.record("category", name, "skip", "unknown_category")
+	}
+	return "", false
+}
+
+// preferences sets the preferences exported. A preference left to its
+// default is not one the user has: it is set whatever the strategy.
+func (m *settingsMerge) preferences(preferences types.SettingsPreferences) {
+	fields := []struct {
+		column, value, current, fallback string
+		valid                            bool
+	}{
+		{"timezone", preferences.Timezone, m.user.Timezone, "UTC", isValidTimezone(preferences.Timezone)},
+		{"locale", preferences.Locale, m.user.Locale, "", i18n.IsSupported(preferences.Locale)},
+		{"base_currency", strings.ToUpper(preferences.BaseCurrency), m.user.BaseCurrency, "", fx.IsCurrencyCode(strings.ToUpper(preferences.BaseCurrency))},
+		{"budgeting_mode", preferences.BudgetingMode, m.user.BudgetingMode, "classic",
+			preferences.BudgetingMode == "classic" || (preferences.BudgetingMode == "envelope" && m.envelope)},
+	}
+	for _, field := range fields {
+		set := field.current != "" && field.current != field.fallback
+		switch {
+		case field.value == "":
+		case !field.valid:
+			m.record("preference", field.column, "skip", "invalid")
+		case field.value == field.current:
+			m.record("preference", field.column, "unchanged", "")
+		case !set:
+			m.record("preference", field.column, "update", "")
+			m.writes.Preferences[field.column] = field.value
+		case m.conflict("preference", field.column):
+			m.writes.Preferences[field.column] = field.value
+		}
+	}
+}
+
+func (m *settingsMerge) categories(categories []types.SettingsCategory) {
+	existing := map[string]types.CategorySetting{}
+	for _, setting := range m.s.db.GetCategorySettings(m.user.ID) {
+		existing[setting.Category] = setting
+	}
+
+	seen := map[string]bool{}
+	for _, imported := range categories {
+		category, ok := m.category(imported.Category)
+		if !ok || seen[category] {
+			continue
+		}
+		seen[category] = true
+
+		setting := types.CategorySetting{
+			ID:               uuid.New(),
+			Category:         category,
+			ExcludeByDefault: imported.ExcludeByDefault,
+			Essential:        imported.Essential,
+			UserID:           m.user.ID,
+		}
+		current, ok := existing[category]
+		switch {
+		case !ok:
+			m.record("category", category, "create", "")
+		case current.ExcludeByDefault == setting.ExcludeByDefault && current.Essential == setting.Essential:
+			m.record("category", category, "unchanged", "")
+			continue
+		case !m.conflict("category", category):
+			continue
+		}
+		m.writes.Categories = append(m.writes.Categories, setting)
+	}
+}
+
+func (m *settingsMerge) tax(tax *types.SettingsTax) {
+	if tax == nil {
+		return
+	}
+	if tax.StartMonth < 1 || tax.StartMonth > 12 {
+		m.record("tax", "tax", "skip", "invalid")
+		return
+	}
+
+	setting := types.TaxSetting{ID: uuid.New(), StartMonth: tax.StartMonth, UserID: m.user.ID}
+	for _, imported := range tax.Categories {
+		if category, ok := m.category(imported.Category); ok {
+			setting.Categories = append(setting.Categories, types.TaxCategory{ID: uuid.New(), Category: category, Label: imported.Label, SettingID: setting.ID})
+		}
+	}
+
+	current, ok := m.s.db.GetTaxSetting(m.user.ID)
+	switch {
+	case !ok:
+		m.record("tax", "tax", "create", "")
+	case sameJSON(settingsTax(current), settingsTax(setting)):
+		m.record("tax", "tax", "unchanged", "")
+		return
+	case !m.conflict("tax", "tax"):
+		return
+	}
+	m.writes.Tax = &setting
+}
+
+func (m *settingsMerge) mutedMerchants(merchants []string) {
+	muted := map[string]bool{}
+	for _, merchant := range m.s.db.GetMutedMerchants(m.user.ID) {
+		muted[merchant] = true
+	}
+	for _, merchant := range merchants {
+		merchant = strings.ToLower(strings.TrimSpace(merchant))
+		switch {
+		case merchant == "":
+			continue
+		case muted[merchant]:
+			m.record("muted_merchant", merchant, "unchanged", "")
+		default:
+			muted[merchant] = true
+			m.record("muted_merchant", merchant, "create", "")
+			m.writes.MutedMerchants = append(m.writes.MutedMerchants, merchant)
+		}
+	}
+}
+
+func (m *settingsMerge) budgetTemplates(templates []types.SettingsBudgetTemplate) {
+	existing := map[string]types.BudgetTemplate{}
+	for _, template := range m.s.db.GetBudgetTemplates(&m.user) {
+		existing[template.Name] = template
+	}
+	taken := func(name string) bool {
+		_, ok := existing[name]
+		return ok
+	}
+
+	for _, imported := range templates {
+		name := strings.TrimSpace(imported.Name)
+		template, ok := m.budgetTemplate(name, imported.Items)
+		if !ok {
+			m.record("budget_template", imported.Name, "skip", "invalid")
+			continue
+		}
+
+		current, exists := existing[name]
+		switch {
+		case !exists:
+			m.record("budget_template", name, "create", "")
+		case sameJSON(settingsBudgetTemplate(current), settingsBudgetTemplate(template)):
+			m.record("budget_template", name, "unchanged", "")
+			continue
+		case m.strategy == settingsRenameOnConflict:
+			for i := 2; taken(template.Name); i++ {
+				template.Name = fmt.Sprintf("%s (%d)", name, i)
+			}
+			m.result.Changes = append(m.result.Changes, types.SettingsChange{Kind: "budget_template", Key: name, Action: "rename", Name: template.Name})
+		case m.conflict("budget_template", name):
+			m.writes.ReplacedTemplateIDs = append(m.writes.ReplacedTemplateIDs, current.ID)
+		default:
+			continue
+		}
+		existing[template.Name] = template
+		m.writes.BudgetTemplates = append(m.writes.BudgetTemplates, template)
+	}
+}
+
+// budgetTemplate builds the template of an import, its categories matched
+// by name. It is invalid without a name or with an item that cannot be
+// applied.
+func (m *settingsMerge) budgetTemplate(name string, items []types.SettingsBudgetTemplateItem) (types.BudgetTemplate, bool) {
+	template := types.BudgetTemplate{ID: uuid.New(), Name: name, UserID: m.user.ID}
+	if name == "" || len(items) == 0 {
+		return template, false
+	}
+	for _, imported := range items {
+		categories := types.Categories{}
+		for _, name := range imported.Categories {
+			if category, ok := m.category(name); ok {
+				categories = append(categories, category)
+			}
+		}
+		if _, err := parseBudgetCategories(categories, imported.ExcludeCategories); err != nil || imported.Amount.Sign() <= 0 {
+			return template, false
+		}
+		template.Items = append(template.Items, types.BudgetTemplateItem{
+			ID:                uuid.New(),
+			Name:              imported.Name,
+			Categories:        categories,
+			ExcludeCategories: imported.ExcludeCategories,
+			Amount:            imported.Amount,
+			Rollover:          imported.Rollover,
+			AlertThresholds:   imported.AlertThresholds,
+			RearmAlerts:       imported.RearmAlerts,
+			TemplateID:        template.ID,
+		})
+	}
+	return template, true
+}
+
+func (m *settingsMerge) notificationPreferences(preferences []types.SettingsNotification) {
+	existing := map[string]types.NotificationPreference{}
+	for _, preference := range m.s.db.GetNotificationPreferences(m.user.ID) {
+		existing[preference.Event] = preference
+	}
+
+	for _, imported := range preferences {
+		if !isValidNotificationEvent(imported.Event) {
+			m.record("notification_preference", imported.Event, "skip", "unknown_event")
+			continue
+		}
+		preference := enforceNotificationPreference(types.NotificationPreference{
+			UserID: m.user.ID,
+			Event:  imported.Event,
+			InApp:  imported.InApp,
+			Email:  imported.Email,
+			Push:   imported.Push,
+		})
+		preference.Locked = nil
+
+		current, ok := existing[imported.Event]
+		switch {
+		case !ok:
+			m.record("notification_preference", imported.Event, "create", "")
+		case current.InApp == preference.InApp && current.Email == preference.Email && current.Push == preference.Push:
+			m.record("notification_preference", imported.Event, "unchanged", "")
+			continue
+		case !m.conflict("notification_preference", imported.Event):
+			continue
+		}
+		existing[imported.Event] = preference
+		m.writes.NotificationPreferences = append(m.writes.NotificationPreferences, preference)
+	}
+}
+
+// settingsTax returns the tax configuration as exported.
+func settingsTax(setting types.TaxSetting) *types.SettingsTax {
+	tax := &types.SettingsTax{StartMonth: setting.StartMonth, Categories: []types.SettingsTaxCategory{}}
+	for _, category := range setting.Categories {
+		tax.Categories = append(tax.Categories, types.SettingsTaxCategory{Category: category.Category, Label: category.Label})
+	}
+	slices.SortFunc(tax.Categories, func(a, b types.SettingsTaxCategory) int {
+		return strings.Compare(a.Category+"\x00"+a.Label, b.Category+"\x00"+b.Label)
+	})
+	return tax
+}
+
+// settingsBudgetTemplate returns the budget template as exported.
+func settingsBudgetTemplate(template types.BudgetTemplate) types.SettingsBudgetTemplate {
+	exported := types.SettingsBudgetTemplate{Name: template.Name, Items: []types.SettingsBudgetTemplateItem{}}
+	for _, item := range template.Items {
+		exported.Items = append(exported.Items, types.SettingsBudgetTemplateItem{
+			Name:              item.Name,
+			Categories:        item.Categories,
+			ExcludeCategories: item.ExcludeCategories,
+			Amount:            item.Amount,
+			Rollover:          item.Rollover,
+			AlertThresholds:   item.AlertThresholds,
+			RearmAlerts:       item.RearmAlerts,
+		})
+	}
+	slices.SortFunc(exported.Items, func(a, b types.SettingsBudgetTemplateItem) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return exported
+}
+
+// sameJSON reports whether a and b are encoded the same.
+func sameJSON(a, b any) bool {
+	encodedA, errA := json.Marshal(a)
+	encodedB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(encodedA) == string(encodedB)
+}
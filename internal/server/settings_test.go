@@ -0,0 +1,146 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/types"
+)
+
+// settingsDB keeps the settings of one user, the imports replacing them.
+type settingsDB struct {
+	*adminDB
+	categories    []types.CategorySetting
+	tax           *types.TaxSetting
+	muted         []string
+	templates     []types.BudgetTemplate
+	notifications []types.NotificationPreference
+	imported      *types.SettingsImport
+}
+
+func (db *settingsDB) GetCategorySettings(userID uuid.UUID) []types.CategorySetting {
+	return db.categories
+}
+
+func (db *settingsDB) GetTaxSetting(userID uuid.UUID) (types.TaxSetting, bool) {
+	if db.tax == nil {
+		return types.TaxSetting{}, false
+	}
+	return *db.tax, true
+}
+
+func (db *settingsDB) GetMutedMerchants(userID uuid.UUID) []string {
+	return db.muted
+}
+
+func (db *settingsDB) GetBudgetTemplates(user *types.User) []types.BudgetTemplate {
+	return db.templates
+}
+
+func (db *settingsDB) GetNotificationPreferences(userID uuid.UUID) []types.NotificationPreference {
+	return db.notifications
+}
+
+func (db *settingsDB) ImportSettings(userID uuid.UUID, settings *types.SettingsImport) error {
+	db.imported = settings
+	return nil
+}
+
+func TestSettingsExportImport(t *testing.T) {
+	s, admin, _, user := newAdminTestServer(t)
+	db := &settingsDB{
+		adminDB: admin,
+		categories: []types.CategorySetting{
+			{Category: "food", Essential: true, UserID: user.ID},
+			{Category: "shopping", ExcludeByDefault: true, UserID: user.ID},
+		},
+		tax:   &types.TaxSetting{StartMonth: 4, Categories: []types.TaxCategory{{Category: "bills", Label: "Utilities"}}},
+		muted: []string{"acme"},
+		templates: []types.BudgetTemplate{{ID: uuid.New(), Name: "Monthly", Items: []types.BudgetTemplateItem{
+			{Name: "Groceries", Categories: types.Categories{"food"}, Amount: money(300)},
+		}}},
+		notifications: []types.NotificationPreference{{Event: "weekly_digest", InApp: true, Email: true}},
+	}
+	s.db = db
+	user.Timezone = "Europe/Paris"
+	admin.users[user.ID] = user
+
+	resp := adminRequest(t, s, user, "GET", "/api/v1/settings/export", "")
+	var export types.SettingsExport
+	json.NewDecoder(resp.Body).Decode(&export)
+	if resp.StatusCode != fiber.StatusOK || export.Version != 1 || export.Preferences.Timezone != "Europe/Paris" || len(export.Categories) != 2 ||
+		export.Tax == nil || export.Tax.StartMonth != 4 || len(export.BudgetTemplates) != 1 || len(export.NotificationPreferences) != 1 {
+		t.Fatalf("unexpected export: %d %+v", resp.StatusCode, export)
+	}
+
+	// Imported on an instance where the user configured other settings
+	export.Preferences = types.SettingsPreferences{Timezone: "America/New_York", Locale: "fr"}
+	export.Categories = append(export.Categories, types.SettingsCategory{Category: "Bills", Essential: true}, types.SettingsCategory{Category: "pets"})
+	export.MutedMerchants = append(export.MutedMerchants, "Corner Shop")
+	export.BudgetTemplates[0].Items = append(export.BudgetTemplates[0].Items,
+		types.SettingsBudgetTemplateItem{Name: "Vet", Categories: types.Categories{"pets", "others"}, Amount: money(50)})
+	document, _ := json.Marshal(export)
+
+	importSettings := func(query string) (int, types.SettingsImportResult, map[string]types.SettingsChange) {
+		db.imported = nil
+		resp := adminRequest(t, s, user, "POST", "/api/v1/settings/import"+query, string(document))
+		var result types.SettingsImportResult
+		json.NewDecoder(resp.Body).Decode(&result)
+		changes := map[string]types.SettingsChange{}
+		for _, change := range result.Changes {
+			changes[change.Kind+"/"+change.Key] = change
+		}
+		return resp.StatusCode, result, changes
+	}
+
+	status, result, changes := importSettings("?dry_run=true")
+	if status != fiber.StatusOK || !result.DryRun || db.imported != nil {
+		t.Fatalf("expected a preview without writes; got %d %+v", status, result)
+	}
+	for key, action := range map[string]string{
+		"preference/timezone":        "skip",
+		"preference/locale":          "update",
+		"category/food":              "unchanged",
+		"category/bills":             "create",
+		"category/pets":              "skip",
+		"tax/tax":                    "unchanged",
+		"muted_merchant/acme":        "unchanged",
+		"muted_merchant/corner shop": "create",
+		"budget_template/Monthly":    "skip",
+	} {
+		if changes[key].Action != action {
+			t.Errorf("%s: expected %q; got %+v", key, action, changes[key])
+		}
+	}
+	if changes["category/pets"].Reason != "unknown_category" || changes["preference/timezone"].Reason != "exists" {
+		t.Errorf("expected the reasons of the skips; got %+v %+v", changes["category/pets"], changes["preference/timezone"])
+	}
+
+	status, _, changes = importSettings("?strategy=overwrite")
+	if status != fiber.StatusOK || db.imported == nil || db.imported.Preferences["timezone"] != "America/New_York" || db.imported.Preferences["locale"] != "fr" {
+		t.Fatalf("expected the preferences overwritten; got %d %+v", status, db.imported)
+	}
+	if len(db.imported.BudgetTemplates) != 1 || len(db.imported.ReplacedTemplateIDs) != 1 || db.imported.ReplacedTemplateIDs[0] != db.templates[0].ID {
+		t.Fatalf("expected the template replaced; got %+v", db.imported)
+	}
+	if items := db.imported.BudgetTemplates[0].Items; len(items) != 2 || len(items[1].Categories) != 1 || items[1].Categories[0] != "others" {
+		t.Errorf("expected the unknown category dropped from the template; got %+v", items)
+	}
+
+	status, _, changes = importSettings("?strategy=rename_on_conflict")
+	if change := changes["budget_template/Monthly"]; status != fiber.StatusOK || change.Action != "rename" || change.Name != "Monthly (2)" ||
+		len(db.imported.BudgetTemplates) != 1 || db.imported.BudgetTemplates[0].Name != "Monthly (2)" || len(db.imported.ReplacedTemplateIDs) != 0 {
+		t.Errorf("expected the template created under another name; got %d %+v %+v", status, change, db.imported)
+	}
+
+	if status, _, _ := importSettings("?strategy=merge"); status != fiber.StatusBadRequest {
+		t.Errorf("expected an unknown strategy refused; got %d", status)
+	}
+	document = []byte(`{"version":2}`)
+	if status, _, _ := importSettings(""); status != fiber.StatusUnprocessableEntity {
+		t.Errorf("expected another version refused; got %d", status)
+	}
+}
@@ -0,0 +1,266 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/constants"
+	"FinMa/types"
+	"FinMa/utils"
+)
+
+// shareGrantHeader names the grant through which a user reads the data of
+// another one.
+const shareGrantHeader = "X-Share-Grant"
+
+// shareRoutes are the routes readable through a grant per resource,
+// relative to the prefix of the API. Only their GET requests are allowed:
+// the budgets, the settings and every other route are never shared.
+var shareRoutes = map[string][]string{
+	"transactions": {"/transactions", "/transactions/:id"},
+	"reports":      {"/reports/patterns", "/reports/cashflow", "/reports/merchants", "/reports/flows"},
+}
+
+// shareIncludes are the embeddings of the transactions allowed through a
+// grant, the category embeds the settings of the owner.
+var shareIncludes = []string{"account"}
+
+// sharedGrant returns the grant the request reads the data through, if any.
+func sharedGrant(c *fiber.Ctx) (types.ShareGrant, bool) {
+	grant, ok := c.Locals("share").(types.ShareGrant)
+	return grant, ok
+}
+
+// clampToGrant narrows the range to the dates of the grant. A range outside
+// of them is emptied at the start of the grant.
+func clampToGrant(grant types.ShareGrant, from, to time.Time) (time.Time, time.Time) {
+	if from.Before(grant.From) {
+		from = grant.From
+	}
+	if to.After(grant.To) {
+		to = grant.To
+	}
+	if to.Before(from) {
+		return grant.From, grant.From
+	}
+	return from, to
+}
+
+// sharesTransaction reports whether the grant of the request, if any, gives
+// access to the transaction: dated in its range, on an account of the owner.
+func (s *FiberServer) sharesTransaction(c *fiber.Ctx, transaction types.Transaction) bool {
+	grant, ok := sharedGrant(c)
+	if !ok {
+		return true
+	}
+	if !grant.Covers(transaction.Date) {
+		return false
+	}
+	if transaction.BankAccountID == uuid.Nil {
+		return transaction.UserID == grant.UserID
+	}
+	return s.db.GetBankAccountByID(transaction.BankAccountID.String()).UserID == grant.UserID
+}
+
+// shareRoute returns the path of the route relative to the prefix of the
+// API.
+func shareRoute(path string) string {
+	if relative, ok := strings.CutPrefix(path, APIPrefix); ok {
+		return relative
+	}
+	return strings.TrimPrefix(path, legacyAPIPrefix)
+}
+
+// authorizeShare serves the request as the owner of the grant, restricted
+// to its scope: a GET request on a route of its resources, while it is
+// active. Every access is recorded in the audit log of the owner with the
+// grantee, the email of the invited user or "link", and its status.
+func (s *FiberServer) authorizeShare(c *fiber.Ctx, grant types.ShareGrant, grantee string, allowedRoles []string) error {
+	if grant.ID == uuid.Nil || !grant.Active(time.Now()) {
+		return NewAPIError(fiber.StatusForbidden, CodeForbidden, "The share is revoked or expired")
+	}
+
+	route := shareRoute(c.Route().Path)
+	allowed := false
+	for _, resource := range grant.Resources {
+		allowed = allowed || slices.Contains(shareRoutes[resource], route)
+	}
+	if c.Method() != fiber.MethodGet || !allowed {
+		s.audit(grant.UserID, "share.denied", "share_grant", grant.ID, fmt.Sprintf("%s %s by %s", c.Method(), c.Path(), grantee))
+		return NewAPIError(fiber.StatusForbidden, CodeForbidden, "This resource is not shared")
+	}
+	if include := c.Query("include"); include != "" {
+		for _, name := range strings.Split(include, ",") {
+			if !slices.Contains(shareIncludes, strings.TrimSpace(name)) {
+				return NewAPIError(fiber.StatusForbidden, CodeForbidden, "This embedding is not shared").
+					WithDetails(FieldError{Field: "include", Message: "Must be one of " + strings.Join(shareIncludes, ", "), Value: name})
+			}
+		}
+	}
+
+	owner := s.db.GetUserByID(grant.UserID)
+	if owner.ID == uuid.Nil || !utils.HasRole(owner.Role, allowedRoles) {
+		return NewAPIError(fiber.StatusForbidden, CodeForbidden, "The share is revoked or expired")
+	}
+	c.Locals("user", owner)
+	c.Locals("share", grant)
+
+	if err := c.Next(); err != nil {
+		// Let the error handler write the response before auditing its status
+		if handlerErr := c.App().ErrorHandler(c, err); handlerErr != nil {
+			c.Status(fiber.StatusInternalServerError)
+		}
+	}
+	s.audit(grant.UserID, "share.accessed", "share_grant", grant.ID, fmt.Sprintf("GET %s by %s: %d", c.OriginalURL(), grantee, c.Response().StatusCode()))
+	return nil
+}
+
+// CreateShareGrant gives read access to the transactions of the user dated
+// between from and to, to the existing user of the email, or to the holders
+// of a link when there is none. The link is returned once, with its token,
+// and needs an expiry.
+func (s *FiberServer) CreateShareGrant(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+
+	var req struct {
+		Label     string     `json:"label"`
+		Resources []string   `json:"resources"`
+		From      *time.Time `json:"from"`
+		To        *time.Time `json:"to"`
+		Email     string     `json:"email"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+
+	now := time.Now()
+	var invalid []FieldError
+	if len(req.Resources) == 0 {
+		invalid = append(invalid, FieldError{Field: "resources", Message: "Required"})
+	}
+	for _, resource := range req.Resources {
+		if !slices.Contains(constants.GetShareResources(), resource) {
+			invalid = append(invalid, FieldError{Field: "resources", Message: "Must be one of " + strings.Join(constants.GetShareResources(), ", "), Value: resource})
+		}
+	}
+	if req.From == nil {
+		invalid = append(invalid, FieldError{Field: "from", Message: "Required"})
+	}
+	if req.To == nil {
+		invalid = append(invalid, FieldError{Field: "to", Message: "Required"})
+	}
+	if req.From != nil && req.To != nil && req.To.Before(*req.From) {
+		invalid = append(invalid, FieldError{Field: "to", Message: "Must not be before from", Value: req.To.Format(time.RFC3339)})
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(now) {
+		invalid = append(invalid, FieldError{Field: "expires_at", Message: "Must be in the future", Value: req.ExpiresAt.Format(time.RFC3339)})
+	}
+	if req.Email == "" && req.ExpiresAt == nil {
+		invalid = append(invalid, FieldError{Field: "expires_at", Message: "Required for a link"})
+	}
+
+	grant := types.ShareGrant{ID: uuid.New(), Label: strings.TrimSpace(req.Label), Resources: slices.Compact(slices.Sorted(slices.Values(req.Resources))), ExpiresAt: req.ExpiresAt, UserID: user.ID}
+	if email := strings.ToLower(strings.TrimSpace(req.Email)); email != "" {
+		grantee := s.db.GetUserByEmail(email)
+		switch {
+		case email == strings.ToLower(user.Email):
+			invalid = append(invalid, FieldError{Field: "email", Message: "Must not be yours", Value: req.Email})
+		case grantee.ID == uuid.Nil:
+			invalid = append(invalid, FieldError{Field: "email", Message: "No account uses this email, share a link instead", Value: req.Email})
+		default:
+			grant.Email = email
+			grant.GranteeID = &grantee.ID
+		}
+	}
+	if len(invalid) > 0 {
+		return NewAPIError(fiber.StatusUnprocessableEntity, CodeValidationFailed, "Invalid share").WithDetails(invalid...)
+	}
+	grant.From, grant.To = *req.From, *req.To
+
+	response := fiber.Map{"grant": grant}
+	if grant.GranteeID == nil {
+		token, err := s.tokens.GenerateShareToken(grant.ID, *grant.ExpiresAt)
+		if err != nil {
+			log.Error(err)
+			return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not generate the share link")
+		}
+		response["token"] = token
+		response["url"] = s.config.Server.AppURL + "/shared?token=" + url.QueryEscape(token)
+	}
+
+	if err := s.db.CreateShareGrant(&grant); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not create the share")
+	}
+	recipient := grant.Email
+	if recipient == "" {
+		recipient = "link"
+	}
+	s.audit(user.ID, "share.created", "share_grant", grant.ID, fmt.Sprintf("%s shared with %s", strings.Join(grant.Resources, ", "), recipient))
+
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+// GetShareGrants lists the grants given by the user, the latest first.
+func (s *FiberServer) GetShareGrants(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+
+	grants := s.db.GetShareGrants(user.ID)
+	if grants == nil {
+		grants = []types.ShareGrant{}
+	}
+	return c.JSON(grants)
+}
+
+// receivedShareGrant is a grant given to the user, with its owner.
+type receivedShareGrant struct {
+	types.ShareGrant
+	OwnerName  string `json:"owner_name"`
+	OwnerEmail string `json:"owner_email"`
+}
+
+// GetReceivedShareGrants lists the active grants given to the user, to be
+// read with the X-Share-Grant header.
+func (s *FiberServer) GetReceivedShareGrants(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+
+	grants := s.db.GetReceivedShareGrants(user.ID, time.Now())
+	received := make([]receivedShareGrant, 0, len(grants))
+	for _, grant := range grants {
+		owner := s.db.GetUserByID(grant.UserID)
+		received = append(received, receivedShareGrant{
+			ShareGrant: grant,
+			OwnerName:  strings.TrimSpace(owner.FirstName + " " + owner.LastName),
+			OwnerEmail: owner.Email,
+		})
+	}
+	return c.JSON(received)
+}
+
+// RevokeShareGrant revokes a grant of the user. The next request through it
+// is refused.
+func (s *FiberServer) RevokeShareGrant(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+
+	grant := s.db.GetShareGrantByID(c.Params("id"))
+	if grant.ID == uuid.Nil || grant.UserID != user.ID {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Share not found")
+	}
+	if grant.RevokedAt == nil {
+		if err := s.db.RevokeShareGrant(&grant, time.Now()); err != nil {
+			log.Error(err)
+			return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not revoke the share")
+		}
+		s.audit(user.ID, "share.revoked", "share_grant", grant.ID, "")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
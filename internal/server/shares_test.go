@@ -0,0 +1,267 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/internal/database"
+	"FinMa/types"
+	"FinMa/utils"
+)
+
+// sharesDB keeps the grants in memory, and records the filter of the
+// transactions listed.
+type sharesDB struct {
+	*adminDB
+	grants       []types.ShareGrant
+	account      types.BankAccount
+	transactions []types.Transaction
+	filter       types.TransactionFilter
+}
+
+func (db *sharesDB) WithContext(context.Context) database.Service {
+	return db
+}
+
+func (db *sharesDB) CreateShareGrant(grant *types.ShareGrant) error {
+	db.grants = append(db.grants, *grant)
+	return nil
+}
+
+func (db *sharesDB) GetShareGrants(userID uuid.UUID) []types.ShareGrant {
+	var grants []types.ShareGrant
+	for _, grant := range db.grants {
+		if grant.UserID == userID {
+			grants = append(grants, grant)
+		}
+	}
+	return grants
+}
+
+func (db *sharesDB) GetReceivedShareGrants(granteeID uuid.UUID, now time.Time) []types.ShareGrant {
+	var grants []types.ShareGrant
+	for _, grant := range db.grants {
+		if grant.GranteeID != nil && *grant.GranteeID == granteeID && grant.Active(now) {
+			grants = append(grants, grant)
+		}
+	}
+	return grants
+}
+
+func (db *sharesDB) GetShareGrantByID(id string) types.ShareGrant {
+	for _, grant := range db.grants {
+		if grant.ID.String() == id {
+			return grant
+		}
+	}
+	return types.ShareGrant{}
+}
+
+func (db *sharesDB) RevokeShareGrant(grant *types.ShareGrant, at time.Time) error {
+	for i := range db.grants {
+		if db.grants[i].ID == grant.ID {
+			db.grants[i].RevokedAt = &at
+		}
+	}
+	grant.RevokedAt = &at
+	return nil
+}
+
+func (db *sharesDB) TransactionsChangeToken(user *types.User, filter types.TransactionFilter) (string, error) {
+	return "token", nil
+}
+
+func (db *sharesDB) GetTransactions(user *types.User, filter types.TransactionFilter) []types.Transaction {
+	db.filter = filter
+	return db.transactions
+}
+
+func (db *sharesDB) GetTransactionByID(id string) types.Transaction {
+	for _, transaction := range db.transactions {
+		if transaction.ID.String() == id {
+			return transaction
+		}
+	}
+	return types.Transaction{}
+}
+
+func (db *sharesDB) GetBankAccountByID(id string) types.BankAccount {
+	if db.account.ID.String() == id {
+		return db.account
+	}
+	return types.BankAccount{}
+}
+
+func newSharesTestServer(t *testing.T) (*FiberServer, *sharesDB, types.User) {
+	s, admin, _, user := newAdminTestServer(t)
+	db := &sharesDB{adminDB: admin}
+	db.account = types.BankAccount{ID: uuid.New(), BankName: "Checking", UserID: user.ID}
+	db.transactions = []types.Transaction{
+		{ID: uuid.New(), Description: "Rent", Amount: money(900), Type: "expense", Date: time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC), BankAccountID: db.account.ID, UserID: user.ID},
+		{ID: uuid.New(), Description: "Groceries", Amount: money(54), Type: "expense", Date: time.Date(2025, time.February, 3, 0, 0, 0, 0, time.UTC), BankAccountID: db.account.ID, UserID: user.ID},
+	}
+	s.db = db
+	return s, db, user
+}
+
+// createShare creates a share of 2024 as the user, and returns the response.
+func createShare(t *testing.T, s *FiberServer, user types.User, fields string) (*http.Response, types.ShareGrant, string) {
+	t.Helper()
+	resp := adminRequest(t, s, user, "POST", "/api/v1/shares", `{"label":"Accountant 2024","resources":["transactions","reports"],
+		"from":"2024-01-01T00:00:00Z","to":"2024-12-31T23:59:59Z"`+fields+`}`)
+	var created struct {
+		Grant types.ShareGrant `json:"grant"`
+		Token string           `json:"token"`
+	}
+	json.NewDecoder(resp.Body).Decode(&created)
+	return resp, created.Grant, created.Token
+}
+
+// shareRequest sends the request with the token of a share link.
+func shareRequest(t *testing.T, s *FiberServer, token, method, path string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(method, path, strings.NewReader(""))
+	req.Header.Set("Authorization", "Share "+token)
+	resp, err := s.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestShareLink(t *testing.T) {
+	s, db, user := newSharesTestServer(t)
+
+	resp, _, _ := createShare(t, s, user, "")
+	if resp.StatusCode != fiber.StatusUnprocessableEntity {
+		t.Errorf("expected status 422 for a link without expiry; got %d", resp.StatusCode)
+	}
+	resp, grant, token := createShare(t, s, user, `,"expires_at":"`+time.Now().Add(time.Hour).Format(time.RFC3339)+`"`)
+	if resp.StatusCode != fiber.StatusCreated || token == "" || grant.GranteeID != nil {
+		t.Fatalf("expected a link; got %d %+v", resp.StatusCode, grant)
+	}
+
+	// The dates asked for are narrowed to the grant, on the accounts of the owner
+	resp = shareRequest(t, s, token, "GET", "/api/v1/transactions?from=2020-01-01T00:00:00Z")
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("expected status 200; got %d", resp.StatusCode)
+	}
+	if !db.filter.From.Equal(grant.From) || !db.filter.To.Equal(grant.To) || !db.filter.ExcludeShared {
+		t.Errorf("expected the filter narrowed to 2024 and the owned accounts; got %+v", db.filter)
+	}
+	if resp := shareRequest(t, s, token, "GET", "/api/v1/transactions/"+db.transactions[0].ID.String()); resp.StatusCode != fiber.StatusOK {
+		t.Errorf("expected the rent of 2024 shared; got %d", resp.StatusCode)
+	}
+	if resp := shareRequest(t, s, token, "GET", "/api/v1/transactions/"+db.transactions[1].ID.String()); resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("expected the groceries of 2025 not found; got %d", resp.StatusCode)
+	}
+
+	for _, request := range []struct{ method, path string }{
+		{"GET", "/api/v1/budgets"},
+		{"GET", "/api/v1/settings/tax"},
+		{"GET", "/api/v1/shares"},
+		{"GET", "/api/v1/transactions?include=category"},
+		{"DELETE", "/api/v1/transactions/" + db.transactions[0].ID.String()},
+	} {
+		if resp := shareRequest(t, s, token, request.method, request.path); resp.StatusCode != fiber.StatusForbidden {
+			t.Errorf("expected status 403 for %s %s; got %d", request.method, request.path, resp.StatusCode)
+		}
+	}
+
+	accessed := 0
+	for _, entry := range db.audits {
+		if entry.Action == "share.accessed" && entry.EntityID == grant.ID && entry.UserID == user.ID {
+			accessed++
+		}
+	}
+	if accessed != 3 {
+		t.Errorf("expected the 3 accesses audited; got %d", accessed)
+	}
+
+	if resp := adminRequest(t, s, user, "DELETE", "/api/v1/shares/"+grant.ID.String(), ""); resp.StatusCode != fiber.StatusNoContent {
+		t.Fatalf("expected status 204; got %d", resp.StatusCode)
+	}
+	if resp := shareRequest(t, s, token, "GET", "/api/v1/transactions"); resp.StatusCode != fiber.StatusForbidden {
+		t.Errorf("expected the revoked link refused; got %d", resp.StatusCode)
+	}
+}
+
+func TestShareInvite(t *testing.T) {
+	s, db, user := newSharesTestServer(t)
+	accountant := types.User{ID: uuid.New(), FirstName: "Grace", Email: "grace@example.com", Role: "user"}
+	db.users[accountant.ID] = accountant
+
+	resp, _, _ := createShare(t, s, user, `,"email":"nobody@example.com"`)
+	if resp.StatusCode != fiber.StatusUnprocessableEntity {
+		t.Errorf("expected status 422 for an unknown email; got %d", resp.StatusCode)
+	}
+	resp, grant, token := createShare(t, s, user, `,"email":"Grace@example.com"`)
+	if resp.StatusCode != fiber.StatusCreated || token != "" || grant.GranteeID == nil || *grant.GranteeID != accountant.ID {
+		t.Fatalf("expected an invite of Grace; got %d %+v", resp.StatusCode, grant)
+	}
+
+	resp = adminRequest(t, s, accountant, "GET", "/api/v1/shares/received", "")
+	var received []receivedShareGrant
+	json.NewDecoder(resp.Body).Decode(&received)
+	if len(received) != 1 || received[0].ID != grant.ID || received[0].OwnerEmail != user.Email {
+		t.Fatalf("expected the share received; got %+v", received)
+	}
+
+	read := func(as types.User, path string) *http.Response {
+		token, _ := s.tokens.GenerateAccessToken(utils.Payload{UserID: as.ID, Email: as.Email})
+		req, _ := http.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set(shareGrantHeader, grant.ID.String())
+		resp, err := s.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	if resp := read(accountant, "/api/v1/transactions"); resp.StatusCode != fiber.StatusOK {
+		t.Errorf("expected the accountant to read the transactions; got %d", resp.StatusCode)
+	}
+	if resp := read(accountant, "/api/v1/budgets"); resp.StatusCode != fiber.StatusForbidden {
+		t.Errorf("expected the budgets refused; got %d", resp.StatusCode)
+	}
+	other := types.User{ID: uuid.New(), Email: "eve@example.com", Role: "user"}
+	db.users[other.ID] = other
+	if resp := read(other, "/api/v1/transactions"); resp.StatusCode != fiber.StatusForbidden {
+		t.Errorf("expected the grant refused to another user; got %d", resp.StatusCode)
+	}
+
+	// The link of the token cannot be used for an invite
+	link, _ := s.tokens.GenerateShareToken(grant.ID, time.Now().Add(time.Hour))
+	if resp := shareRequest(t, s, link, "GET", "/api/v1/transactions"); resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("expected a link to an invite refused; got %d", resp.StatusCode)
+	}
+}
+
+func TestClampToGrant(t *testing.T) {
+	day := func(month time.Month, d int) time.Time { return time.Date(2024, month, d, 0, 0, 0, 0, time.UTC) }
+	grant := types.ShareGrant{From: day(time.January, 1), To: day(time.June, 30)}
+
+	tests := []struct {
+		name             string
+		from, to         time.Time
+		wantFrom, wantTo time.Time
+	}{
+		{"inside", day(time.March, 1), day(time.April, 1), day(time.March, 1), day(time.April, 1)},
+		{"overlapping", day(time.May, 1), day(time.December, 1), day(time.May, 1), day(time.June, 30)},
+		{"after", day(time.August, 1), day(time.September, 1), day(time.January, 1), day(time.January, 1)},
+		{"before", time.Date(2023, time.March, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, time.April, 1, 0, 0, 0, 0, time.UTC), day(time.January, 1), day(time.January, 1)},
+	}
+	for _, tt := range tests {
+		from, to := clampToGrant(grant, tt.from, tt.to)
+		if !from.Equal(tt.wantFrom) || !to.Equal(tt.wantTo) {
+			t.Errorf("%s: expected %v - %v; got %v - %v", tt.name, tt.wantFrom, tt.wantTo, from, to)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+)
+
+// drainingRetryAfter is the Retry-After, in seconds, of the requests refused
+// while the server drains.
+const drainingRetryAfter = 5
+
+// rejectWhileDraining refuses the requests received once the shutdown
+// started, the in-flight ones are left to finish. The probes are still
+// answered, the process is alive but not ready.
+func (s *FiberServer) rejectWhileDraining(c *fiber.Ctx) error {
+	if !s.draining.Load() || c.Path() == livenessPath || c.Path() == readinessPath {
+		return c.Next()
+	}
+
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(drainingRetryAfter))
+	return NewAPIError(fiber.StatusServiceUnavailable, CodeUnavailable, "Server is shutting down")
+}
+
+// ListenUntilSignal serves on addr, with TLS when it is configured, until
+// SIGINT or SIGTERM is received. SIGHUP reloads the TLS certificate. The
+// server then reports not ready and keeps serving for readinessDelay, and
+// shuts down within the grace period.
+func (s *FiberServer) ListenUntilSignal(addr string, readinessDelay, grace time.Duration) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	ln, err := s.listen(addr)
+	if err != nil {
+		return err
+	}
+
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- s.Listener(ln)
+	}()
+
+	if s.redirect = s.newRedirectServer(addr); s.redirect != nil {
+		go func() {
+			if err := s.redirect.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				log.Error("HTTPS redirect listener stopped: ", err)
+			}
+		}()
+	}
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	for waiting := true; waiting; {
+		select {
+		case err := <-listenErr:
+			return err
+		case <-hangup:
+			s.reloadCertificate()
+		case <-ctx.Done():
+			waiting = false
+		}
+	}
+	stop()
+
+	s.stopping.Store(true)
+	if readinessDelay > 0 {
+		log.Infof("Shutdown signal received, reporting not ready for %s", readinessDelay)
+		select {
+		case err := <-listenErr:
+			return err
+		case <-time.After(readinessDelay):
+		}
+	}
+	log.Infof("Shutdown signal received, draining for up to %s", grace)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	if err := s.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	return <-listenErr
+}
+
+// Shutdown stops the server: new requests are refused, the background jobs
+// are stopped, the in-flight requests are drained, then the queued emails are
+// sent and the database is closed. Each phase is logged with its duration.
+func (s *FiberServer) Shutdown(ctx context.Context) error {
+	start := time.Now()
+	s.draining.Store(true)
+
+	var errs []error
+	phase := func(name string, run func() error) {
+		phaseStart := time.Now()
+		if err := run(); err != nil {
+			log.Errorf("Shutdown: %s failed after %s: %v", name, time.Since(phaseStart), err)
+			errs = append(errs, err)
+			return
+		}
+		log.Infof("Shutdown: %s in %s", name, time.Since(phaseStart))
+	}
+
+	phase("stopped background jobs", func() error {
+		return s.jobs.Stop(ctx)
+	})
+	phase("drained HTTP connections", func() error {
+		return s.ShutdownWithContext(ctx)
+	})
+	if s.redirect != nil {
+		phase("closed HTTPS redirect listener", func() error {
+			return s.redirect.Shutdown(ctx)
+		})
+	}
+	if s.mailQueue != nil {
+		phase("flushed email queue", func() error {
+			s.mailQueue.Close()
+			return nil
+		})
+	}
+	if s.db != nil {
+		phase("closed database", s.db.Close)
+	}
+
+	log.Infof("Shutdown completed in %s", time.Since(start))
+	return errors.Join(errs...)
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRejectWhileDraining(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: errorHandler})
+	s := &FiberServer{App: app}
+	app.Use(s.rejectWhileDraining)
+	app.Get("/", s.HelloWorldHandler)
+
+	s.draining.Store(true)
+	req, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatalf("error creating request. Err: %v", err)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503; got %v", resp.Status)
+	}
+	if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "5" {
+		t.Errorf("expected Retry-After 5; got %q", retryAfter)
+	}
+}
+
+func TestListenUntilSignalDrainsRequests(t *testing.T) {
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	s := &FiberServer{App: app}
+	app.Use(s.rejectWhileDraining)
+
+	started := make(chan struct{})
+	app.Get("/slow", func(c *fiber.Ctx) error {
+		close(started)
+		time.Sleep(300 * time.Millisecond)
+		return c.SendString("done")
+	})
+
+	var runs atomic.Int64
+	s.every("count", 10*time.Millisecond, func(time.Time) error {
+		runs.Add(1)
+		return nil
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening. Err: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	served := make(chan error, 1)
+	go func() { served <- s.ListenUntilSignal(addr, 0, 5*time.Second) }()
+
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server did not start. Err: %v", err)
+		}
+	}
+
+	type result struct {
+		status int
+		body   string
+		err    error
+	}
+	response := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/slow")
+		if err != nil {
+			response <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		response <- result{resp.StatusCode, string(body), err}
+	}()
+
+	<-started
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatalf("error sending SIGTERM. Err: %v", err)
+	}
+
+	got := <-response
+	if got.err != nil || got.status != http.StatusOK || got.body != "done" {
+		t.Errorf("expected the in-flight request to complete; got %+v", got)
+	}
+
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("expected a clean shutdown; got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("server did not stop within the grace period")
+	}
+
+	stoppedAt := runs.Load()
+	time.Sleep(50 * time.Millisecond)
+	if runs.Load() != stoppedAt {
+		t.Errorf("expected the background jobs to be stopped")
+	}
+}
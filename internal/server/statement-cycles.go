@@ -0,0 +1,163 @@
+package server
+
+import (
+	"FinMa/internal/i18n"
+	"FinMa/types"
+	"context"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+)
+
+// clampedDate returns the given day of the month at midnight, clamped to the
+// last day of the month: day 31 of February is February 28 (or 29).
+func clampedDate(year int, month time.Month, day int, loc *time.Location) time.Time {
+	first := time.Date(year, month, 1, 0, 0, 0, 0, loc)
+	lastDay := first.AddDate(0, 1, -1).Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return time.Date(first.Year(), first.Month(), day, 0, 0, 0, 0, loc)
+}
+
+// statementClose returns the instant the statement of the given month closes,
+// the end of the statement day.
+func statementClose(year int, month time.Month, statementDay int, loc *time.Location) time.Time {
+	return clampedDate(year, month, statementDay, loc).AddDate(0, 0, 1)
+}
+
+// statementCloses returns the closes surrounding now: the close before the
+// last statement, the last statement close and the close of the current cycle.
+func statementCloses(now time.Time, statementDay int, loc *time.Location) (time.Time, time.Time, time.Time) {
+	local := now.In(loc)
+	year, month := local.Year(), local.Month()
+
+	if now.Before(statementClose(year, month, statementDay, loc)) {
+		month--
+	}
+	return statementClose(year, month-1, statementDay, loc),
+		statementClose(year, month, statementDay, loc),
+		statementClose(year, month+1, statementDay, loc)
+}
+
+// paymentDueDate returns the first payment due day after the statement that
+// closed at lastClose.
+func paymentDueDate(lastClose time.Time, paymentDueDay int, loc *time.Location) time.Time {
+	statementDate := lastClose.In(loc).AddDate(0, 0, -1)
+	due := clampedDate(statementDate.Year(), statementDate.Month(), paymentDueDay, loc)
+	if !due.After(statementDate) {
+		due = clampedDate(statementDate.Year(), statementDate.Month()+1, paymentDueDay, loc)
+	}
+	return due
+}
+
+// buildStatementCycle computes the statement cycle of a credit card account at now.
+func (s *FiberServer) buildStatementCycle(account types.BankAccount, now time.Time, loc *time.Location) (types.StatementCycle, error) {
+	prevClose, lastClose, nextClose := statementCloses(now, account.StatementDay, loc)
+
+	cycle := types.StatementCycle{
+		AccountID:      account.ID,
+		StatementStart: prevClose,
+		StatementEnd:   lastClose,
+		DueDate:        paymentDueDate(lastClose, account.PaymentDueDay, loc),
+		CycleStart:     lastClose,
+		CycleEnd:       nextClose,
+	}
+
+	statement, err := s.db.GetCardCycleTotals(account.ID, prevClose, lastClose)
+	if err != nil {
+		return cycle, err
+	}
+	current, err := s.db.GetCardCycleTotals(account.ID, lastClose, nextClose)
+	if err != nil {
+		return cycle, err
+	}
+
+	// The balance at the statement close is the current balance without the
+	// transactions of the current cycle, in unbound minor units
+	payments, charges := current.Payments.Unbound().Minor, current.Charges.Unbound().Minor
+	balanceAtClose := account.Balance.Unbound().Minor - (payments - charges)
+
+	cycle.StatementSpend = statement.Charges.Unbound()
+	cycle.StatementBalance = types.NewMoney(max(0, -balanceAtClose), "")
+	cycle.PaidSinceClose = types.NewMoney(payments, "")
+	cycle.RemainingToPay = types.NewMoney(max(0, cycle.StatementBalance.Minor-payments), "")
+	cycle.CycleSpend = types.NewMoney(charges, "")
+
+	return cycle, nil
+}
+
+// GetStatementCycle returns the last statement of a credit card account with
+// its due date and what remains to pay, and the spend of the current cycle.
+// Payments are transfers to the card and refunds credited to it.
+func (s *FiberServer) GetStatementCycle(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	account, ok := s.findUserBankAccount(user, c.Params("id"), "viewer")
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Bank account not found")
+	}
+
+	if account.AccountType != "credit_card" || account.StatementDay == 0 || account.PaymentDueDay == 0 {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Account has no statement cycle")
+	}
+
+	cycle, err := s.buildStatementCycle(account, time.Now(), userLocation(user))
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not compute statement cycle")
+	}
+
+	return c.JSON(cycle)
+}
+
+// StartDueReminders periodically notifies the owners of credit cards with a
+// non-zero balance when the payment due date is near.
+func (s *FiberServer) StartDueReminders(interval time.Duration) {
+	s.every("due_reminders", interval, func(now time.Time) error {
+		s.sendDueReminders(now)
+		return nil
+	})
+}
+
+func (s *FiberServer) sendDueReminders(now time.Time) {
+	for _, account := range s.db.GetCreditCardsDueReminder() {
+		if account.Balance.IsZero() {
+			continue
+		}
+
+		location := userLocation(account.User)
+		_, lastClose, _ := statementCloses(now, account.StatementDay, location)
+		dueDate := paymentDueDate(lastClose, account.PaymentDueDay, location)
+
+		if now.Before(dueDate.AddDate(0, 0, -account.DueReminderDays)) || !now.Before(dueDate.AddDate(0, 0, 1)) {
+			continue
+		}
+		if account.DueReminderSentFor != nil && account.DueReminderSentFor.Equal(dueDate) {
+			continue
+		}
+
+		cycle, err := s.buildStatementCycle(account, now, location)
+		if err != nil {
+			log.Error("Error computing statement cycle: ", err)
+			continue
+		}
+
+		err = s.Notify(context.Background(), account.UserID, "payment_due", NotificationPayload{
+			Params: i18n.Params{"account": account.BankName, "amount": i18n.Amount(cycle.RemainingToPay.Float64()), "due_date": dueDate},
+			Details: fiber.Map{
+				"bank_account_id": account.ID,
+				"amount":          cycle.RemainingToPay,
+				"due_date":        dueDate,
+			},
+		})
+		if err != nil {
+			log.Error("Error notifying payment due: ", err)
+			continue
+		}
+
+		if err := s.db.SetDueReminderSent(account.ID, dueDate); err != nil {
+			log.Error(err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatementCloses(t *testing.T) {
+	tests := []struct {
+		name         string
+		now          time.Time
+		statementDay int
+		expected     [3]time.Time
+	}{
+		{
+			"mid cycle",
+			time.Date(2024, time.May, 20, 12, 0, 0, 0, time.UTC),
+			15,
+			[3]time.Time{
+				time.Date(2024, time.April, 16, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, time.May, 16, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, time.June, 16, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			"statement day 31 clamped to the month length",
+			time.Date(2024, time.March, 10, 0, 0, 0, 0, time.UTC),
+			31,
+			[3]time.Time{
+				time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			"cycle spanning the year boundary",
+			time.Date(2025, time.January, 5, 0, 0, 0, 0, time.UTC),
+			20,
+			[3]time.Time{
+				time.Date(2024, time.November, 21, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, time.December, 21, 0, 0, 0, 0, time.UTC),
+				time.Date(2025, time.January, 21, 0, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev, last, next := statementCloses(tt.now, tt.statementDay, time.UTC)
+			got := [3]time.Time{prev, last, next}
+			for i := range got {
+				if !got[i].Equal(tt.expected[i]) {
+					t.Errorf("expected close %d to be %v; got %v", i, tt.expected[i], got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPaymentDueDate(t *testing.T) {
+	tests := []struct {
+		name          string
+		lastClose     time.Time
+		paymentDueDay int
+		expected      time.Time
+	}{
+		{"due later in the month", time.Date(2024, time.May, 6, 0, 0, 0, 0, time.UTC), 25, time.Date(2024, time.May, 25, 0, 0, 0, 0, time.UTC)},
+		{"due the next month", time.Date(2024, time.May, 21, 0, 0, 0, 0, time.UTC), 10, time.Date(2024, time.June, 10, 0, 0, 0, 0, time.UTC)},
+		{"due the next year", time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC), 15, time.Date(2025, time.January, 15, 0, 0, 0, 0, time.UTC)},
+		{"due day clamped", time.Date(2024, time.January, 21, 0, 0, 0, 0, time.UTC), 31, time.Date(2024, time.January, 31, 0, 0, 0, 0, time.UTC)},
+		{"due day clamped the next month", time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC), 30, time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			due := paymentDueDate(tt.lastClose, tt.paymentDueDay, time.UTC)
+			if !due.Equal(tt.expected) {
+				t.Errorf("expected %v; got %v", tt.expected, due)
+			}
+		})
+	}
+}
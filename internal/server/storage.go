@@ -0,0 +1,47 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"FinMa/internal/config"
+	"FinMa/internal/storage"
+)
+
+// newStorage returns the storage selected by the driver: "s3" keeps the
+// files in the bucket, anything else on the local disk.
+func newStorage(cfg config.Storage) (storage.Storage, error) {
+	if cfg.Driver != "s3" {
+		return storage.NewLocal(cfg.LocalDir)
+	}
+	return newS3Storage(cfg)
+}
+
+func newS3Storage(cfg config.Storage) (*storage.S3, error) {
+	return storage.NewS3(storage.S3Config{
+		Endpoint:        cfg.S3Endpoint,
+		Region:          cfg.S3Region,
+		Bucket:          cfg.S3Bucket,
+		AccessKeyID:     cfg.S3AccessKeyID,
+		SecretAccessKey: cfg.S3SecretAccessKey,
+		PathStyle:       cfg.S3PathStyle,
+	})
+}
+
+// MigrateStorage copies the files of the local directory to the configured
+// bucket, before STORAGE_DRIVER is switched to s3. It returns the number of
+// files copied.
+func MigrateStorage(ctx context.Context, cfg config.Storage) (int, error) {
+	if cfg.S3Endpoint == "" || cfg.S3Bucket == "" {
+		return 0, fmt.Errorf("S3_ENDPOINT and S3_BUCKET are required to migrate the storage")
+	}
+	src, err := storage.NewLocal(cfg.LocalDir)
+	if err != nil {
+		return 0, err
+	}
+	dst, err := newS3Storage(cfg)
+	if err != nil {
+		return 0, err
+	}
+	return storage.Copy(ctx, src, dst)
+}
@@ -0,0 +1,403 @@
+package server
+
+import (
+	"FinMa/internal/i18n"
+	"FinMa/types"
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// subscriptionLookback is the history scanned for subscriptions, a yearly
+// one is seen twice.
+const subscriptionLookback = 13 // Months
+
+// subscriptionAmountTolerance is how far from their median the amounts of
+// the charges of a subscription may be, a price change included.
+const subscriptionAmountTolerance = 0.1
+
+// subscriptionCadence is a cadence of subscriptions: the days between two
+// charges and the number of charges before it is detected.
+type subscriptionCadence struct {
+	name     string
+	minDays  float64
+	maxDays  float64
+	charges  int
+	next     func(time.Time) time.Time
+	schedule int // Due dates of the explicit schedule of its bill
+}
+
+// subscriptionCadences are tried in order: weekly within a day, monthly
+// within three days of a month, yearly within a week of a year.
+var subscriptionCadences = []subscriptionCadence{
+	{name: "weekly", minDays: 6, maxDays: 8, charges: 3, next: func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }, schedule: 52},
+	{name: "monthly", minDays: 25, maxDays: 34, charges: 3, next: func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+	{name: "yearly", minDays: 358, maxDays: 372, charges: 2, next: func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }, schedule: 5},
+}
+
+// nonLetters matches what the merchant of a description drops.
+var nonLetters = regexp.MustCompile(`[^\p{L}]+`)
+
+// merchantOf returns the merchant of a description, the way the database
+// groups the charges: lowercased, the runs of other characters than letters
+// replaced by a space.
+func merchantOf(description string) string {
+	return strings.TrimSpace(nonLetters.ReplaceAllString(strings.ToLower(description), " "))
+}
+
+// detectSubscription returns the candidate of the charges of a merchant, by
+// date, when their amounts are near constant and they follow each other at
+// a cadence, the last one recently enough for the next to be due at now.
+// Their average is rounded to the minor unit of the currency.
+func detectSubscription(charges []types.MerchantCharge, currency string, now time.Time) (types.SubscriptionCandidate, bool) {
+	amounts := make([]int64, len(charges))
+	for i, charge := range charges {
+		amounts[i] = charge.Amount.Unbound().Minor
+	}
+	slices.Sort(amounts)
+	if len(amounts) == 0 {
+		return types.SubscriptionCandidate{}, false
+	}
+	median := amounts[len(amounts)/2]
+	tolerance := types.NewMoney(median, "").Mul(subscriptionAmountTolerance).Minor
+	for _, amount := range amounts {
+		if difference := amount - median; max(difference, -difference) > tolerance {
+			return types.SubscriptionCandidate{}, false
+		}
+	}
+
+	for _, cadence := range subscriptionCadences {
+		if len(charges) < cadence.charges {
+			continue
+		}
+		regular := true
+		for i := 1; i < len(charges); i++ {
+			gap := daysBetween(charges[i-1].Date, charges[i].Date)
+			if gap < cadence.minDays || gap > cadence.maxDays {
+				regular = false
+				break
+			}
+		}
+		last := charges[len(charges)-1]
+		// A charge missed by more than the tolerance ended the subscription
+		if !regular || daysBetween(last.Date, now) > 2*cadence.maxDays-cadence.minDays {
+			continue
+		}
+
+		var total int64
+		for _, amount := range amounts {
+			total += amount
+		}
+		return types.SubscriptionCandidate{
+			Merchant:      last.Merchant,
+			Cadence:       cadence.name,
+			AverageAmount: types.NewMoney(total, "").Mul(1 / float64(len(charges))).Round(currency),
+			LastAmount:    last.Amount,
+			Count:         len(charges),
+			LastCharge:    last.Date,
+			NextCharge:    cadence.next(last.Date),
+			Category:      last.Category,
+			BankAccountID: last.BankAccountID,
+		}, true
+	}
+	return types.SubscriptionCandidate{}, false
+}
+
+// detectSubscriptions returns the candidates of the charges, by merchant
+// and date, by merchant, with the currencies of their accounts.
+func detectSubscriptions(charges []types.MerchantCharge, currencies map[uuid.UUID]string, now time.Time) []types.SubscriptionCandidate {
+	candidates := []types.SubscriptionCandidate{}
+	for start := 0; start < len(charges); {
+		end := start + 1
+		for end < len(charges) && charges[end].Merchant == charges[start].Merchant {
+			end++
+		}
+		if candidate, ok := detectSubscription(charges[start:end], currencies[charges[end-1].BankAccountID], now); ok {
+			candidates = append(candidates, candidate)
+		}
+		start = end
+	}
+	return candidates
+}
+
+// subscriptionBill returns the autopaid bill tracking the subscription of
+// the candidate: due on the day of its last charge every month, or on the
+// dates of its next charges for the other cadences. Its merchant is the
+// first word of the merchant of the charges, which their descriptions all
+// contain.
+func subscriptionBill(candidate types.SubscriptionCandidate, userID uuid.UUID, loc *time.Location) *types.Bill {
+	merchant, _, _ := strings.Cut(candidate.Merchant, " ")
+	accountID := candidate.BankAccountID
+	bill := &types.Bill{
+		ID:            uuid.New(),
+		Name:          candidate.Merchant,
+		Amount:        candidate.LastAmount,
+		Merchant:      merchant,
+		Tolerance:     5,
+		Category:      candidate.Category,
+		Autopay:       true,
+		BankAccountID: &accountID,
+		UserID:        userID,
+	}
+
+	last := calendarDate(candidate.LastCharge, loc)
+	for _, cadence := range subscriptionCadences {
+		if cadence.name != candidate.Cadence {
+			continue
+		}
+		if cadence.schedule == 0 {
+			bill.DueDay = last.Day()
+			break
+		}
+		for date := cadence.next(last); len(bill.DueDates) < cadence.schedule; date = cadence.next(date) {
+			bill.DueDates = append(bill.DueDates, date)
+		}
+	}
+	return bill
+}
+
+// undecidedSubscriptions returns the candidates of the user from their
+// history at now, without the ones they confirmed or dismissed, and their
+// subscriptions by merchant.
+func (s *FiberServer) undecidedSubscriptions(user types.User, now time.Time) ([]types.SubscriptionCandidate, map[string]types.Subscription, error) {
+	charges, err := s.db.GetMerchantCharges(user.ID, now.AddDate(0, -subscriptionLookback, 0))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	decided := map[string]types.Subscription{}
+	for _, subscription := range s.db.GetSubscriptions(user.ID) {
+		decided[subscription.Merchant] = subscription
+	}
+
+	currencies := map[uuid.UUID]string{}
+	for _, account := range s.db.GetBankAccounts(&user, true) {
+		currencies[account.ID] = s.accountCurrency(account)
+	}
+
+	candidates := []types.SubscriptionCandidate{}
+	for _, candidate := range detectSubscriptions(charges, currencies, now) {
+		if status := decided[candidate.Merchant].Status; status != "confirmed" && status != "dismissed" {
+			candidates = append(candidates, candidate)
+		}
+	}
+	return candidates, decided, nil
+}
+
+// StartSubscriptionDetection periodically scans the history of the users
+// for subscriptions, and notifies them once of each new one.
+func (s *FiberServer) StartSubscriptionDetection(interval time.Duration) {
+	s.every("subscription_detection", interval, func(now time.Time) error {
+		s.detectUserSubscriptions(now)
+		return nil
+	})
+}
+
+func (s *FiberServer) detectUserSubscriptions(now time.Time) {
+	for _, user := range s.db.GetUsers() {
+		candidates, _, err := s.undecidedSubscriptions(user, now)
+		if err != nil {
+			log.Error("Error detecting subscriptions: ", err)
+			continue
+		}
+
+		for _, candidate := range candidates {
+			suggested, err := s.db.SuggestSubscription(&types.Subscription{
+				ID:           uuid.New(),
+				Merchant:     candidate.Merchant,
+				Status:       "suggested",
+				Cadence:      candidate.Cadence,
+				Amount:       candidate.LastAmount,
+				LastChargeAt: candidate.LastCharge,
+				UserID:       user.ID,
+			})
+			if err != nil {
+				log.Error("Error suggesting subscription: ", err)
+				continue
+			}
+			if !suggested {
+				continue
+			}
+
+			err = s.Notify(context.Background(), user.ID, "subscription_detected", NotificationPayload{
+				Params:  i18n.Params{"merchant": candidate.Merchant, "amount": i18n.Amount(candidate.LastAmount.Float64()), "cadence": candidate.Cadence},
+				Details: fiber.Map{"merchant": candidate.Merchant, "cadence": candidate.Cadence, "amount": candidate.LastAmount},
+			})
+			if err != nil {
+				log.Error("Error notifying subscription: ", err)
+			}
+		}
+	}
+}
+
+// checkSubscriptionPrice is called after a transaction change is committed.
+// A new charge of a confirmed subscription, dated after its last one,
+// updates its price and the amount of its bill, so that the bill keeps
+// matching it. A price increase is notified.
+func (s *FiberServer) checkSubscriptionPrice(previous, current *types.Transaction) {
+	if previous != nil || current == nil || current.Type != "expense" {
+		return
+	}
+
+	merchant := merchantOf(current.Description)
+	for _, subscription := range s.db.GetSubscriptions(current.UserID) {
+		if subscription.Status != "confirmed" || subscription.Merchant != merchant || !current.Date.After(subscription.LastChargeAt) {
+			continue
+		}
+
+		price, amount := subscription.Amount.Unbound(), current.Amount.Unbound()
+		subscription.LastChargeAt = current.Date
+		subscription.Amount = amount
+		subscription.UpdatedAt = time.Now()
+		if err := s.db.SaveSubscription(&subscription); err != nil {
+			log.Error("Error updating subscription: ", err)
+			return
+		}
+		if amount.Minor == price.Minor {
+			return
+		}
+
+		if subscription.BillID != nil {
+			if bill := s.db.GetBillByID(subscription.BillID.String()); bill.ID != uuid.Nil {
+				bill.Amount = amount
+				bill.UpdatedAt = time.Now()
+				if err := s.db.UpdateBill(&bill); err != nil {
+					log.Error("Error updating subscription bill: ", err)
+				}
+			}
+		}
+		if amount.Minor < price.Minor {
+			return
+		}
+
+		err := s.Notify(context.Background(), current.UserID, "subscription_price_increase", NotificationPayload{
+			Params: i18n.Params{"merchant": merchant, "previous": i18n.Amount(price.Float64()), "amount": i18n.Amount(amount.Float64())},
+			Details: fiber.Map{
+				"subscription_id": subscription.ID,
+				"transaction_id":  current.ID,
+				"previous_amount": price,
+				"amount":          amount,
+			},
+		})
+		if err != nil {
+			log.Error("Error notifying subscription price increase: ", err)
+		}
+		return
+	}
+}
+
+// GetSubscriptions lists the subscriptions suggested to the user, confirmed
+// or dismissed by them.
+func (s *FiberServer) GetSubscriptions(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	subscriptions := s.db.GetSubscriptions(user.ID)
+	if subscriptions == nil {
+		subscriptions = []types.Subscription{}
+	}
+	return c.JSON(subscriptions)
+}
+
+// DetectSubscriptions scans the expenses of the last 13 months of the user
+// for subscriptions: merchants charging a near constant amount every week,
+// month or year, the last charge recent enough. The merchants confirmed or
+// dismissed before are left out. Nothing is stored.
+func (s *FiberServer) DetectSubscriptions(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+
+	candidates, _, err := s.undecidedSubscriptions(user, time.Now())
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not detect subscriptions")
+	}
+	return c.JSON(candidates)
+}
+
+// subscriptionRequest is the body confirming or dismissing a candidate.
+type subscriptionRequest struct {
+	Merchant string `json:"merchant" validate:"required"`
+}
+
+// ConfirmSubscription turns the detected candidate of the merchant into a
+// tracked subscription, with the autopaid bill which its charges pay and
+// the balance forecast projects.
+func (s *FiberServer) ConfirmSubscription(c *fiber.Ctx) error {
+	var body subscriptionRequest
+	if err := c.BodyParser(&body); err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+	if err := validate.Struct(body); err != nil {
+		return err
+	}
+
+	user := c.Locals("user").(types.User)
+	merchant := merchantOf(body.Merchant)
+	now := time.Now()
+	candidates, decided, err := s.undecidedSubscriptions(user, now)
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not detect subscriptions")
+	}
+	if decided[merchant].Status == "confirmed" {
+		return NewAPIError(fiber.StatusConflict, CodeConflict, "Subscription already confirmed")
+	}
+
+	for _, candidate := range candidates {
+		if candidate.Merchant != merchant {
+			continue
+		}
+
+		subscription := decided[candidate.Merchant]
+		if subscription.ID == uuid.Nil {
+			subscription = types.Subscription{ID: uuid.New(), Merchant: candidate.Merchant, UserID: user.ID, CreatedAt: now}
+		}
+		subscription.Cadence = candidate.Cadence
+		subscription.Amount = candidate.LastAmount
+		subscription.LastChargeAt = candidate.LastCharge
+		subscription.UpdatedAt = now
+
+		bill := subscriptionBill(candidate, user.ID, userLocation(user))
+		if err := s.db.ConfirmSubscription(&subscription, bill); err != nil {
+			log.Error(err)
+			return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not confirm subscription")
+		}
+		return c.Status(fiber.StatusCreated).JSON(subscription)
+	}
+	return NewAPIError(fiber.StatusNotFound, CodeNotFound, "No subscription detected for this merchant")
+}
+
+// DismissSubscription stops suggesting the merchant as a subscription.
+func (s *FiberServer) DismissSubscription(c *fiber.Ctx) error {
+	var body subscriptionRequest
+	if err := c.BodyParser(&body); err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+	if err := validate.Struct(body); err != nil {
+		return err
+	}
+
+	user := c.Locals("user").(types.User)
+	now := time.Now()
+	subscription := types.Subscription{ID: uuid.New(), Merchant: merchantOf(body.Merchant), UserID: user.ID, CreatedAt: now}
+	for _, existing := range s.db.GetSubscriptions(user.ID) {
+		if existing.Merchant == subscription.Merchant {
+			subscription = existing
+		}
+	}
+	if subscription.Status == "confirmed" {
+		return NewAPIError(fiber.StatusConflict, CodeConflict, "Subscription already confirmed, delete its bill instead")
+	}
+	subscription.Status = "dismissed"
+	subscription.UpdatedAt = now
+
+	if err := s.db.SaveSubscription(&subscription); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not dismiss subscription")
+	}
+	return c.JSON(subscription)
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"FinMa/types"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestMerchantOf(t *testing.T) {
+	for description, expected := range map[string]string{
+		"NETFLIX.COM 0412":   "netflix com",
+		"  Carrefour #0519 ": "carrefour",
+		"Prélèvement EDF":    "prélèvement edf",
+		"1234":               "",
+	} {
+		if merchant := merchantOf(description); merchant != expected {
+			t.Errorf("expected %q for %q; got %q", expected, description, merchant)
+		}
+	}
+}
+
+func TestDetectSubscriptions(t *testing.T) {
+	account := uuid.New()
+	date := func(month time.Month, day int) time.Time {
+		return time.Date(2024, month, day, 0, 0, 0, 0, time.UTC)
+	}
+	charge := func(merchant string, amount float64, date time.Time) types.MerchantCharge {
+		return types.MerchantCharge{Merchant: merchant, Amount: money(amount), Date: date, Category: "others", BankAccountID: account}
+	}
+	now := date(time.May, 20)
+	charges := []types.MerchantCharge{
+		// Irregular
+		charge("bakery", 4.2, date(time.March, 2)),
+		charge("bakery", 4.2, date(time.March, 3)),
+		charge("bakery", 4.2, date(time.April, 20)),
+		// Monthly, with a price increase
+		charge("netflix com", 13.49, date(time.February, 4)),
+		charge("netflix com", 13.49, date(time.March, 4)),
+		charge("netflix com", 13.49, date(time.April, 5)),
+		charge("netflix com", 14.49, date(time.May, 4)),
+		// Weekly amounts varying too much
+		charge("supermarket", 52, date(time.May, 1)),
+		charge("supermarket", 87, date(time.May, 8)),
+		charge("supermarket", 35, date(time.May, 15)),
+		// Monthly, stopped in March
+		charge("vpn", 5, date(time.January, 10)),
+		charge("vpn", 5, date(time.February, 10)),
+		charge("vpn", 5, date(time.March, 10)),
+		// Weekly
+		charge("yoga", 12, date(time.May, 2)),
+		charge("yoga", 12, date(time.May, 9)),
+		charge("yoga", 12, date(time.May, 16)),
+	}
+
+	candidates := detectSubscriptions(charges, map[uuid.UUID]string{account: "EUR"}, now)
+	if len(candidates) != 2 {
+		t.Fatalf("expected netflix and yoga; got %+v", candidates)
+	}
+	netflix, yoga := candidates[0], candidates[1]
+	if netflix.Merchant != "netflix com" || netflix.Cadence != "monthly" || netflix.AverageAmount != money(13.74) || netflix.LastAmount != money(14.49) || netflix.Count != 4 {
+		t.Errorf("expected the monthly netflix subscription; got %+v", netflix)
+	}
+	if !netflix.LastCharge.Equal(date(time.May, 4)) || !netflix.NextCharge.Equal(date(time.June, 4)) {
+		t.Errorf("expected the next charge a month after the last; got %+v", netflix)
+	}
+	if yoga.Cadence != "weekly" || !yoga.NextCharge.Equal(date(time.May, 23)) {
+		t.Errorf("expected the weekly yoga class; got %+v", yoga)
+	}
+
+	// The bill of a monthly subscription is due on the day of its charges
+	bill := subscriptionBill(netflix, uuid.New(), time.UTC)
+	if bill.DueDay != 4 || bill.Merchant != "netflix" || bill.Amount != money(14.49) || !bill.Autopay || *bill.BankAccountID != account {
+		t.Errorf("expected an autopaid bill due on the 4th; got %+v", bill)
+	}
+	bill = subscriptionBill(yoga, uuid.New(), time.UTC)
+	if bill.DueDay != 0 || len(bill.DueDates) != 52 || !bill.DueDates[0].Equal(date(time.May, 23)) {
+		t.Errorf("expected a bill due every week; got %+v", bill)
+	}
+}
@@ -0,0 +1,229 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/internal/database"
+	"FinMa/types"
+)
+
+// syncResponse is a page of the entities changed after a cursor.
+type syncResponse struct {
+	Cursor       string                  `json:"cursor"`   // Passed as since to get the next page, or the next changes
+	HasMore      bool                    `json:"has_more"` // More changes follow the cursor, get them right away
+	Transactions []types.Transaction     `json:"transactions"`
+	Accounts     []types.BankAccount     `json:"accounts"`
+	Budgets      []budgetResponse        `json:"budgets"` // Without their progress, which the transactions change
+	Categories   []types.CategorySetting `json:"categories"`
+	Deleted      []types.SyncTombstone   `json:"deleted"`
+}
+
+// GetSyncChanges returns the transactions, the accounts, the budgets and
+// the category settings the user sees that were created, updated or
+// deleted after the cursor, as they are now, with the cursor to pass next.
+// Without a cursor it returns the current one only: the starting point of
+// a client loading everything. A cursor older than the changes kept is
+// refused with a 410, the client must load everything again.
+// - since: cursor of the previous response
+// - limit: changes per page, defaults to 500 and is capped at 1000
+func (s *FiberServer) GetSyncChanges(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+
+	limit := c.QueryInt("limit", 500)
+	if limit <= 0 || limit > 1000 {
+		limit = 500
+	}
+
+	response := syncResponse{
+		Transactions: []types.Transaction{},
+		Accounts:     []types.BankAccount{},
+		Budgets:      []budgetResponse{},
+		Categories:   []types.CategorySetting{},
+		Deleted:      []types.SyncTombstone{},
+	}
+	value := c.Query("since")
+	if value == "" {
+		cursor, err := s.db.LatestSyncCursor()
+		if err != nil {
+			return err
+		}
+		response.Cursor = strconv.FormatInt(cursor, 10)
+		return c.JSON(response)
+	}
+
+	since, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || since < 0 {
+		return NewAPIError(fiber.StatusUnprocessableEntity, CodeValidationFailed, "Invalid sync cursor").
+			WithDetails(FieldError{Field: "since", Message: "Invalid cursor", Value: value})
+	}
+	page, err := s.db.GetSyncChanges(&user, since, limit)
+	if errors.Is(err, database.ErrSyncCursorExpired) {
+		return NewAPIError(fiber.StatusGone, CodeResyncRequired, "The sync cursor expired, sync everything again")
+	}
+	if err != nil {
+		return err
+	}
+
+	response.Cursor = strconv.FormatInt(page.Cursor, 10)
+	response.HasMore = page.HasMore
+	response.Transactions = append(response.Transactions, page.Transactions...)
+	for _, account := range page.Accounts {
+		account.Class = accountClass(account.AccountType)
+		response.Accounts = append(response.Accounts, account)
+	}
+	for _, budget := range page.Budgets {
+		response.Budgets = append(response.Budgets, newBudgetResponse(budget, nil))
+	}
+	response.Categories = append(response.Categories, page.Categories...)
+	response.Deleted = append(response.Deleted, page.Deleted...)
+	return c.JSON(response)
+}
+
+// syncTransactionChange is a change of a transaction made offline, at the
+// version the client had.
+type syncTransactionChange struct {
+	ID uuid.UUID `json:"id"`
+	updateTransactionRequest
+}
+
+// syncBudgetChange is a change of a budget made offline, at the version the
+// client had.
+type syncBudgetChange struct {
+	ID uuid.UUID `json:"id"`
+	updateBudgetRequest
+}
+
+// syncPushResponse tells what became of every change pushed.
+type syncPushResponse struct {
+	Transactions []types.Transaction `json:"transactions"` // Updated, as they are now
+	Budgets      []budgetResponse    `json:"budgets"`
+	Conflicts    syncConflicts       `json:"conflicts"` // Changed since the version the client had, as they are now
+	Rejected     []syncRejection     `json:"rejected"`
+}
+
+// syncConflicts are the entities whose changes were made on a stale version.
+type syncConflicts struct {
+	Transactions []types.Transaction `json:"transactions"`
+	Budgets      []budgetResponse    `json:"budgets"`
+}
+
+// syncRejection is a change refused for another reason than its version,
+// with the error the PATCH of the entity returns.
+type syncRejection struct {
+	Entity  string    `json:"entity"`
+	ID      uuid.UUID `json:"id"`
+	Code    string    `json:"code"`
+	Message string    `json:"message"`
+}
+
+// refuse records the change refused with the error: its entity as it is now
+// for a stale version, the error otherwise. The server errors are returned.
+func (r *syncPushResponse) refuse(entity string, id uuid.UUID, err error) error {
+	apiErr, known := toAPIError(err)
+	if !known || apiErr.Status >= fiber.StatusInternalServerError {
+		return err
+	}
+
+	switch current := apiErr.Current.(type) {
+	case types.Transaction:
+		r.Conflicts.Transactions = append(r.Conflicts.Transactions, current)
+	case budgetResponse:
+		r.Conflicts.Budgets = append(r.Conflicts.Budgets, current)
+	default:
+		r.Rejected = append(r.Rejected, syncRejection{Entity: entity, ID: id, Code: apiErr.Code, Message: apiErr.Message})
+	}
+	return nil
+}
+
+// syncVersion checks a change carries the version of the entity it was made on.
+func syncVersion(version *int64) error {
+	if version == nil {
+		return NewAPIError(fiber.StatusPreconditionRequired, CodeVersionRequired, "The version of the entity changed is required")
+	}
+	if *version <= 0 {
+		return NewAPIError(fiber.StatusUnprocessableEntity, CodeValidationFailed, "Invalid version").
+			WithDetails(FieldError{Field: "version", Message: "Must be positive", Value: *version})
+	}
+	return nil
+}
+
+// PushSyncChanges applies the changes of the transactions and the budgets a
+// client made offline, one by one like their PATCH. Each change carries the
+// version of the entity it was made on: the ones made on a stale version
+// are not applied and the entity is returned as it is now in conflicts, to
+// merge and push again. The changes refused for another reason are listed
+// in rejected with their error code.
+func (s *FiberServer) PushSyncChanges(c *fiber.Ctx) error {
+	var body struct {
+		Transactions []syncTransactionChange `json:"transactions"`
+		Budgets      []syncBudgetChange      `json:"budgets"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+	if count := len(body.Transactions) + len(body.Budgets); count == 0 || count > bulkUpdateLimit {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("Between 1 and %d changes are required", bulkUpdateLimit))
+	}
+
+	user := c.Locals("user").(types.User)
+	response := syncPushResponse{
+		Transactions: []types.Transaction{},
+		Budgets:      []budgetResponse{},
+		Conflicts:    syncConflicts{Transactions: []types.Transaction{}, Budgets: []budgetResponse{}},
+		Rejected:     []syncRejection{},
+	}
+	for _, change := range body.Transactions {
+		if err := syncVersion(change.Version); err != nil {
+			response.refuse("transaction", change.ID, err)
+			continue
+		}
+		transaction, err := s.updateTransaction(user, change.ID.String(), *change.Version, change.updateTransactionRequest)
+		if err != nil {
+			if err := response.refuse("transaction", change.ID, err); err != nil {
+				return err
+			}
+			continue
+		}
+		response.Transactions = append(response.Transactions, transaction)
+	}
+	for _, change := range body.Budgets {
+		if err := syncVersion(change.Version); err != nil {
+			response.refuse("budget", change.ID, err)
+			continue
+		}
+		budget, err := s.updateBudget(user, change.ID.String(), *change.Version, change.updateBudgetRequest)
+		if err != nil {
+			if err := response.refuse("budget", change.ID, err); err != nil {
+				return err
+			}
+			continue
+		}
+		response.Budgets = append(response.Budgets, budget)
+	}
+
+	return c.JSON(response)
+}
+
+// StartSyncCleanup periodically deletes the changes past the retention of
+// the delta sync.
+func (s *FiberServer) StartSyncCleanup(interval time.Duration) {
+	s.every("sync_cleanup", interval, s.cleanupSyncChanges)
+}
+
+func (s *FiberServer) cleanupSyncChanges(now time.Time) error {
+	deleted, err := s.db.DeleteSyncChanges(now.AddDate(0, 0, -s.config.Features.SyncRetentionDays))
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		log.Infof("Deleted %d sync changes", deleted)
+	}
+	return nil
+}
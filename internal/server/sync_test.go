@@ -0,0 +1,134 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/internal/database"
+	"FinMa/types"
+)
+
+// syncDB answers a page of changes after cursor 10, older cursors expired.
+type syncDB struct {
+	*adminDB
+	page    types.SyncPage
+	limit   int
+	deleted time.Time
+}
+
+func (db *syncDB) LatestSyncCursor() (int64, error) {
+	return 42, nil
+}
+
+func (db *syncDB) GetSyncChanges(user *types.User, since int64, limit int) (types.SyncPage, error) {
+	if since < 10 {
+		return types.SyncPage{}, database.ErrSyncCursorExpired
+	}
+	db.limit = limit
+	return db.page, nil
+}
+
+func (db *syncDB) DeleteSyncChanges(before time.Time) (int64, error) {
+	db.deleted = before
+	return 3, nil
+}
+
+func TestGetSyncChanges(t *testing.T) {
+	s, admin, _, user := newAdminTestServer(t)
+	deleted := uuid.New()
+	db := &syncDB{adminDB: admin, page: types.SyncPage{
+		Cursor:       17,
+		HasMore:      true,
+		Transactions: []types.Transaction{{ID: uuid.New(), Amount: types.MoneyFromFloat(12.5, "EUR"), Type: "expense"}},
+		Accounts:     []types.BankAccount{{ID: uuid.New(), AccountType: "credit_card"}},
+		Budgets:      []types.Budget{{ID: uuid.New(), Amount: money(300), Categories: []types.BudgetCategory{{Category: "food"}}}},
+		Deleted:      []types.SyncTombstone{{Entity: "transaction", ID: deleted}},
+	}}
+	s.db = db
+
+	sync := func(query string) (int, syncResponse, errorBody) {
+		resp := adminRequest(t, s, user, "GET", "/api/v1/sync"+query, "")
+		var raw json.RawMessage
+		json.NewDecoder(resp.Body).Decode(&raw)
+		var response syncResponse
+		var body errorBody
+		json.Unmarshal(raw, &response)
+		json.Unmarshal(raw, &body)
+		return resp.StatusCode, response, body
+	}
+
+	// A client loading everything starts from the current cursor
+	if status, response, _ := sync(""); status != fiber.StatusOK || response.Cursor != "42" || len(response.Transactions) != 0 || response.Deleted == nil {
+		t.Fatalf("expected the current cursor alone; got %d %+v", status, response)
+	}
+
+	status, response, _ := sync("?since=10&limit=5000")
+	if status != fiber.StatusOK || response.Cursor != "17" || !response.HasMore || db.limit != 500 {
+		t.Fatalf("expected a page with the default limit; got %d %+v, limit %d", status, response, db.limit)
+	}
+	if len(response.Transactions) != 1 || len(response.Accounts) != 1 || response.Accounts[0].Class != "liability" ||
+		len(response.Budgets) != 1 || len(response.Budgets[0].Categories) != 1 || response.Budgets[0].Categories[0] != "food" {
+		t.Errorf("unexpected entities: %+v", response)
+	}
+	if len(response.Deleted) != 1 || response.Deleted[0].ID != deleted || response.Categories == nil {
+		t.Errorf("expected the tombstone; got %+v", response)
+	}
+
+	if status, _, body := sync("?since=3"); status != fiber.StatusGone || body.Error.Code != CodeResyncRequired {
+		t.Errorf("expected an expired cursor refused; got %d %+v", status, body)
+	}
+	if status, _, body := sync("?since=abc"); status != fiber.StatusUnprocessableEntity || len(body.Error.Details) != 1 || body.Error.Details[0].Field != "since" {
+		t.Errorf("expected an invalid cursor refused; got %d %+v", status, body)
+	}
+
+	now := time.Now()
+	s.config.Features.SyncRetentionDays = 30
+	if err := s.cleanupSyncChanges(now); err != nil || !db.deleted.Equal(now.AddDate(0, 0, -30)) {
+		t.Errorf("expected the changes older than the retention deleted; got %v %v", db.deleted, err)
+	}
+}
+
+func TestPushSyncChanges(t *testing.T) {
+	s, admin, _, user := newAdminTestServer(t)
+	fresh := types.Transaction{ID: uuid.New(), Category: "food", Type: "expense", UserID: user.ID, Version: 1}
+	stale := types.Transaction{ID: uuid.New(), Category: "food", Type: "expense", UserID: user.ID, Version: 3}
+	reconciled := types.Transaction{ID: uuid.New(), Type: "expense", UserID: user.ID, Version: 1, IsReconciled: true}
+	budget := types.Budget{ID: uuid.New(), Name: "Food", Amount: money(300), PeriodType: "monthly", StartDate: time.Now(),
+		Categories: []types.BudgetCategory{{Category: "food"}}, UserID: user.ID, Version: 2}
+	db := &versionsDB{adminDB: admin,
+		transactions: map[uuid.UUID]types.Transaction{fresh.ID: fresh, stale.ID: stale, reconciled.ID: reconciled},
+		budgets:      map[uuid.UUID]types.Budget{budget.ID: budget}}
+	s.db = db
+
+	status, _, raw := versionRequest(t, s, user, "POST", "/api/v1/sync", `{"transactions":[`+
+		`{"id":"`+fresh.ID.String()+`","version":1,"description":"Groceries"},`+
+		`{"id":"`+stale.ID.String()+`","version":2,"category":"transport"},`+
+		`{"id":"`+reconciled.ID.String()+`","version":1,"date":"2026-01-02T00:00:00Z"},`+
+		`{"id":"`+uuid.NewString()+`","description":"Bus"}],`+
+		`"budgets":[{"id":"`+budget.ID.String()+`","version":2,"amount":500}]}`, "")
+	var response syncPushResponse
+	json.Unmarshal(raw, &response)
+	if status != fiber.StatusOK {
+		t.Fatalf("expected the changes pushed; got %d %s", status, raw)
+	}
+	if len(response.Transactions) != 1 || response.Transactions[0].Version != 2 || db.transactions[fresh.ID].Description != "Groceries" {
+		t.Errorf("expected the fresh transaction updated; got %s", raw)
+	}
+	if len(response.Budgets) != 1 || response.Budgets[0].Version != 3 || db.budgets[budget.ID].Amount != money(500) {
+		t.Errorf("expected the budget updated; got %s", raw)
+	}
+	if len(response.Conflicts.Transactions) != 1 || response.Conflicts.Transactions[0].Version != 3 || db.transactions[stale.ID].Category != "food" {
+		t.Errorf("expected the stale transaction returned untouched; got %s", raw)
+	}
+	if len(response.Rejected) != 2 || response.Rejected[0].Code != CodeTransactionReconciled || response.Rejected[1].Code != CodeVersionRequired {
+		t.Errorf("expected the reconciled and unversioned changes rejected; got %s", raw)
+	}
+
+	if status, body, _ := versionRequest(t, s, user, "POST", "/api/v1/sync", `{}`, ""); status != fiber.StatusBadRequest || body.Error.Code != CodeInvalidRequest {
+		t.Errorf("expected an empty push refused; got %d %+v", status, body)
+	}
+}
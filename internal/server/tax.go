@@ -0,0 +1,186 @@
+package server
+
+import (
+	"FinMa/types"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// taxYearRange returns the bounds of the tax year, from the first of its
+// start month in the year to the same day a year later, in loc.
+func taxYearRange(year, startMonth int, loc *time.Location) (time.Time, time.Time) {
+	from := time.Date(year, time.Month(startMonth), 1, 0, 0, 0, 0, loc)
+	return from, from.AddDate(1, 0, 0)
+}
+
+// currentTaxYear returns the tax year now falls in, named after the year it
+// starts in.
+func currentTaxYear(now time.Time, startMonth int) int {
+	if int(now.Month()) < startMonth {
+		return now.Year() - 1
+	}
+	return now.Year()
+}
+
+// buildTaxReport sets the totals of the report, one per category of the
+// setting in its order, and its transactions with the label of their
+// category.
+func buildTaxReport(report *types.TaxReport, setting types.TaxSetting, transactions []types.TaxTransaction) {
+	index := map[string]int{}
+	report.Categories = make([]types.TaxCategoryTotal, 0, len(setting.Categories))
+	for _, category := range setting.Categories {
+		index[category.Category] = len(report.Categories)
+		report.Categories = append(report.Categories, types.TaxCategoryTotal{Category: category.Category, Label: category.Label})
+	}
+
+	var total int64
+	for i, transaction := range transactions {
+		category := &report.Categories[index[transaction.Category]]
+		transactions[i].Label = category.Label
+		amount := transaction.Amount.Unbound().Minor
+		category.Total = types.NewMoney(category.Total.Minor+amount, "")
+		category.Count++
+		total += amount
+	}
+	report.Total = types.NewMoney(total, "")
+	report.Transactions = transactions
+}
+
+// GetTaxSetting returns the tax configuration of the user, the calendar
+// year without categories when they have none.
+func (s *FiberServer) GetTaxSetting(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+
+	setting, ok := s.db.GetTaxSetting(user.ID)
+	if !ok {
+		setting = types.TaxSetting{StartMonth: 1, Categories: []types.TaxCategory{}, UserID: user.ID}
+	}
+	return c.JSON(setting)
+}
+
+// UpdateTaxSetting replaces the tax configuration of the user: the month
+// the tax year starts on and the categories reported, each with the line of
+// the tax form it goes on, the category name without one.
+func (s *FiberServer) UpdateTaxSetting(c *fiber.Ctx) error {
+	type TaxCategoryRequest struct {
+		Category string `json:"category"`
+		Label    string `json:"label" validate:"max=100"`
+	}
+	type UpdateTaxSettingRequest struct {
+		StartMonth int                  `json:"start_month" validate:"min=1,max=12"`
+		Categories []TaxCategoryRequest `json:"categories" validate:"max=50,dive"`
+	}
+
+	var body UpdateTaxSettingRequest
+	if err := c.BodyParser(&body); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+	if err := validate.Struct(body); err != nil {
+		return err
+	}
+
+	user := c.Locals("user").(types.User)
+	setting := &types.TaxSetting{
+		ID:         uuid.New(),
+		StartMonth: body.StartMonth,
+		Categories: make([]types.TaxCategory, 0, len(body.Categories)),
+		UserID:     user.ID,
+	}
+	seen := map[string]bool{}
+	for _, item := range body.Categories {
+		if !isValidCategory(item.Category) || seen[item.Category] {
+			return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid or duplicate transaction category").
+				WithDetails(FieldError{Field: "categories", Message: "Invalid or duplicate category", Value: item.Category})
+		}
+		seen[item.Category] = true
+
+		label := strings.TrimSpace(item.Label)
+		if label == "" {
+			label = item.Category
+		}
+		setting.Categories = append(setting.Categories, types.TaxCategory{ID: uuid.New(), Category: item.Category, Label: label})
+	}
+
+	if err := s.db.SaveTaxSetting(setting); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not update the tax settings")
+	}
+
+	stored, _ := s.db.GetTaxSetting(user.ID)
+	return c.JSON(stored)
+}
+
+// DeleteTaxSetting removes the tax configuration of the user.
+func (s *FiberServer) DeleteTaxSetting(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+
+	if err := s.db.DeleteTaxSetting(user.ID); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not delete the tax settings")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// GetTaxReport sums the categories of the tax configuration of the user
+// over the tax year ?year= (the current one by default), named after the
+// year it starts in, with the transactions counted. The income of the
+// categories is counted against their expenses as refunds; the transactions
+// excluded from the budgets are included. The amounts are in the base
+// currency of the user, converted at the rate of their day. The CSV holds
+// the transactions.
+func (s *FiberServer) GetTaxReport(c *fiber.Ctx) error {
+	db := s.dbFor(c)
+
+	user := c.Locals("user").(types.User)
+
+	setting, ok := db.GetTaxSetting(user.ID)
+	if !ok || len(setting.Categories) == 0 {
+		return NewAPIError(fiber.StatusUnprocessableEntity, CodeUnprocessable, "No category is configured for the tax report, see /api/settings/tax")
+	}
+
+	location := userLocation(user)
+	now := time.Now().In(location)
+	year := currentTaxYear(now, setting.StartMonth)
+	if value := c.Query("year"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1970 || parsed > year {
+			return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "year must be a tax year up to the current one").
+				WithDetails(FieldError{Field: "year", Message: "invalid year", Value: value})
+		}
+		year = parsed
+	}
+	from, to := taxYearRange(year, setting.StartMonth, location)
+
+	// The configuration changes the report as much as the transactions do
+	key := []string{strconv.Itoa(year), setting.UpdatedAt.Format(time.RFC3339Nano)}
+	return cachedReport(s, c, "tax", key, func() (types.TaxReport, error) {
+		report := types.TaxReport{
+			Year:       year,
+			StartMonth: setting.StartMonth,
+			From:       from,
+			To:         to,
+			Timezone:   userTimezone(user),
+			Currency:   s.baseCurrency(user),
+		}
+
+		categories := make([]string, len(setting.Categories))
+		for i, category := range setting.Categories {
+			categories[i] = category.Category
+		}
+		transactions, err := db.GetTaxTransactions(&user, categories, from, to)
+		if err != nil {
+			log.Error(err)
+			return report, NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not compute the tax report")
+		}
+		buildTaxReport(&report, setting, transactions)
+		return report, nil
+	}, func(report types.TaxReport) any {
+		return report.Transactions
+	})
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"FinMa/types"
+	"testing"
+	"time"
+)
+
+func TestTaxYearRange(t *testing.T) {
+	location, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	from, to := taxYearRange(2024, 4, location)
+	if !from.Equal(time.Date(2024, time.April, 1, 0, 0, 0, 0, location)) || !to.Equal(time.Date(2025, time.April, 1, 0, 0, 0, 0, location)) {
+		t.Errorf("expected April to April; got %v to %v", from, to)
+	}
+
+	for now, expected := range map[time.Time]int{
+		time.Date(2025, time.March, 31, 0, 0, 0, 0, location): 2024,
+		time.Date(2025, time.April, 1, 0, 0, 0, 0, location):  2025,
+	} {
+		if year := currentTaxYear(now, 4); year != expected {
+			t.Errorf("expected the tax year %d on %v; got %d", expected, now, year)
+		}
+	}
+	if year := currentTaxYear(time.Date(2025, time.January, 1, 0, 0, 0, 0, location), 1); year != 2025 {
+		t.Errorf("expected the calendar year; got %d", year)
+	}
+}
+
+func TestBuildTaxReport(t *testing.T) {
+	setting := types.TaxSetting{StartMonth: 4, Categories: []types.TaxCategory{
+		{Category: "others", Label: "Donations"},
+		{Category: "transport", Label: "Work travel"},
+	}}
+	transactions := []types.TaxTransaction{
+		{Description: "Red Cross", Category: "others", Amount: money(50)},
+		{Description: "Train", Category: "transport", Amount: money(32.1)},
+		{Description: "Train refund", Category: "transport", Amount: money(-12.1)},
+		{Description: "UNICEF", Category: "others", Amount: money(20.2)},
+	}
+
+	report := types.TaxReport{}
+	buildTaxReport(&report, setting, transactions)
+
+	if len(report.Categories) != 2 {
+		t.Fatalf("expected a total per category; got %+v", report.Categories)
+	}
+	if donations := report.Categories[0]; donations.Label != "Donations" || donations.Total != money(70.2) || donations.Count != 2 {
+		t.Errorf("expected the donations; got %+v", donations)
+	}
+	if travel := report.Categories[1]; travel.Label != "Work travel" || travel.Total != money(20) || travel.Count != 2 {
+		t.Errorf("expected the refund counted against the travel; got %+v", travel)
+	}
+	if report.Total != money(90.2) {
+		t.Errorf("expected a total of 90.2; got %v", report.Total)
+	}
+	if report.Transactions[1].Label != "Work travel" {
+		t.Errorf("expected the transactions labelled; got %+v", report.Transactions[1])
+	}
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"FinMa/internal/database"
+)
+
+// longRequestPaths are the routes known to be slow, given the long timeout:
+// the bank connections wait on the provider, the batches on their
+// sub-requests, each bounded by the timeout, the restores on the rows of
+// every table.
+var longRequestPaths = []string{
+	APIPrefix + "/bank-connections",
+	"/api/bank-connections",
+	APIPrefix + "/batch",
+	"/api/batch",
+	APIPrefix + "/admin/restore",
+	"/api/admin/restore",
+}
+
+// requestTimeouts bounds how long a request may run. The deadline is set on
+// the user context of the request, the queries run with dbFor are canceled
+// with it. A request past its deadline is answered with a 504, whatever the
+// handler returned: the data it read may be incomplete. The event stream
+// and the websocket are long-lived and not bounded.
+func requestTimeouts(timeout, longTimeout time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		path := c.Path()
+		if hasPathPrefix(path, streamingPaths) {
+			return c.Next()
+		}
+
+		limit := timeout
+		if hasPathPrefix(path, longRequestPaths) {
+			limit = longTimeout
+		}
+		ctx, cancel := context.WithTimeout(c.UserContext(), limit)
+		defer cancel()
+		c.SetUserContext(ctx)
+
+		err := c.Next()
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return NewAPIError(fiber.StatusGatewayTimeout, CodeTimeout, "The request took too long")
+		}
+		return err
+	}
+}
+
+// dbFor returns the database service running its queries with the context
+// of the request, canceled with its deadline.
+func (s *FiberServer) dbFor(c *fiber.Ctx) database.Service {
+	return s.db.WithContext(c.UserContext())
+}
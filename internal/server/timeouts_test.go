@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/internal/database"
+	"FinMa/types"
+)
+
+// slowDB is a database whose spending patterns query runs until its
+// context is canceled, like a pathological report query.
+type slowDB struct {
+	database.Service
+	ctx      context.Context
+	canceled chan error
+}
+
+func (db *slowDB) WithContext(ctx context.Context) database.Service {
+	return &slowDB{ctx: ctx, canceled: db.canceled}
+}
+
+func (db *slowDB) GetSpendingPatterns(*types.User, time.Time, time.Time, string, string) (types.SpendingPatterns, error) {
+	if db.ctx == nil {
+		return types.SpendingPatterns{}, nil
+	}
+	<-db.ctx.Done()
+	db.canceled <- db.ctx.Err()
+	return types.SpendingPatterns{}, db.ctx.Err()
+}
+
+func TestRequestTimeoutCancelsQueries(t *testing.T) {
+	db := &slowDB{canceled: make(chan error, 1)}
+	s := &FiberServer{App: fiber.New(fiber.Config{ErrorHandler: errorHandler}), db: db}
+	s.Use(requestTimeouts(50*time.Millisecond, time.Second))
+	s.Get("/api/v1/reports/patterns", func(c *fiber.Ctx) error {
+		c.Locals("user", types.User{ID: uuid.New()})
+		return c.Next()
+	}, s.GetSpendingPatterns)
+
+	req, err := http.NewRequest("GET", "/api/v1/reports/patterns", nil)
+	if err != nil {
+		t.Fatalf("error creating request. Err: %v", err)
+	}
+	start := time.Now()
+	resp, err := s.Test(req, 5000)
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+
+	if resp.StatusCode != fiber.StatusGatewayTimeout {
+		t.Errorf("expected status 504; got %d", resp.StatusCode)
+	}
+	var body errorBody
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Error.Code != CodeTimeout {
+		t.Errorf("expected the timeout error envelope; got %+v, %v", body, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the request to stop at its deadline; took %s", elapsed)
+	}
+
+	select {
+	case err := <-db.canceled:
+		if err != context.DeadlineExceeded {
+			t.Errorf("expected the query to see the deadline; got %v", err)
+		}
+	default:
+		t.Errorf("expected the query to run with the context of the request")
+	}
+}
+
+func TestRequestTimeoutLongRoutes(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: errorHandler})
+	app.Use(requestTimeouts(20*time.Millisecond, time.Second))
+	slow := func(c *fiber.Ctx) error {
+		select {
+		case <-time.After(50 * time.Millisecond):
+			return c.SendStatus(fiber.StatusOK)
+		case <-c.UserContext().Done():
+			return c.UserContext().Err()
+		}
+	}
+	app.Get("/api/v1/bank-connections/institutions", slow)
+	app.Get("/api/v1/events", slow)
+	app.Get("/api/v1/transactions", slow)
+
+	tests := []struct {
+		path     string
+		expected int
+	}{
+		{"/api/v1/bank-connections/institutions", fiber.StatusOK},
+		{"/api/v1/events", fiber.StatusOK},
+		{"/api/v1/transactions", fiber.StatusGatewayTimeout},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", tt.path, nil)
+		if err != nil {
+			t.Fatalf("error creating request. Err: %v", err)
+		}
+		resp, err := app.Test(req, 5000)
+		if err != nil {
+			t.Fatalf("error making request to server. Err: %v", err)
+		}
+		if resp.StatusCode != tt.expected {
+			t.Errorf("expected status %d for %s; got %d", tt.expected, tt.path, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"FinMa/types"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+)
+
+// userTimezone returns the timezone configured by the user, falling back to
+// UTC when it is missing or unknown.
+func userTimezone(user types.User) string {
+	if user.Timezone == "" {
+		return "UTC"
+	}
+	if _, err := time.LoadLocation(user.Timezone); err != nil {
+		log.Warnf("Unknown timezone %s for user %s", user.Timezone, user.ID)
+		return "UTC"
+	}
+	return user.Timezone
+}
+
+// userLocation returns the location of the timezone configured by the user.
+func userLocation(user types.User) *time.Location {
+	location, _ := time.LoadLocation(userTimezone(user))
+	return location
+}
+
+// isValidTimezone reports whether name is an IANA timezone of the tz
+// database. "Local" is refused, it is the timezone of the server.
+func isValidTimezone(name string) bool {
+	if name == "" || strings.EqualFold(name, "local") {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+// SetTimezone stores the IANA timezone of the user, like "Europe/Paris".
+// The days, weeks and months of the reports, the budget periods and the
+// digest are counted in it from then on; the stored dates are instants and
+// are left unchanged.
+func (s *FiberServer) SetTimezone(c *fiber.Ctx) error {
+	type SetTimezoneRequest struct {
+		Timezone string `json:"timezone"`
+	}
+
+	var body SetTimezoneRequest
+	if err := c.BodyParser(&body); err != nil || !isValidTimezone(body.Timezone) {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid timezone").
+			WithDetails(FieldError{Field: "timezone", Message: "must be an IANA timezone, like Europe/Paris", Value: body.Timezone})
+	}
+
+	user := c.Locals("user").(types.User)
+	user.Timezone = body.Timezone
+	if err := s.db.UpdateUserTimezone(&user); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not update the timezone")
+	}
+
+	return c.JSON(fiber.Map{"timezone": user.Timezone})
+}
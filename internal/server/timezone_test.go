@@ -0,0 +1,119 @@
+package server
+
+import (
+	"FinMa/internal/database"
+	"FinMa/types"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// timezoneDB records the timezone stored.
+type timezoneDB struct {
+	database.Service
+	timezone string
+}
+
+func (db *timezoneDB) UpdateUserTimezone(user *types.User) error {
+	db.timezone = user.Timezone
+	return nil
+}
+
+func TestSetTimezone(t *testing.T) {
+	db := &timezoneDB{}
+	s := &FiberServer{App: fiber.New(fiber.Config{ErrorHandler: errorHandler}), db: db}
+	s.Put("/timezone", func(c *fiber.Ctx) error {
+		c.Locals("user", types.User{Timezone: "UTC"})
+		return c.Next()
+	}, s.SetTimezone)
+
+	tests := []struct {
+		body     string
+		expected int
+		stored   string
+	}{
+		{`{"timezone":"Europe/Paris"}`, fiber.StatusOK, "Europe/Paris"},
+		{`{"timezone":"America/Argentina/Buenos_Aires"}`, fiber.StatusOK, "America/Argentina/Buenos_Aires"},
+		{`{"timezone":"Mars/Olympus_Mons"}`, fiber.StatusBadRequest, ""},
+		{`{"timezone":"Local"}`, fiber.StatusBadRequest, ""},
+		{`{"timezone":""}`, fiber.StatusBadRequest, ""},
+		{`{"timezone":"+02:00"}`, fiber.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			db.timezone = ""
+			req, err := http.NewRequest("PUT", "/timezone", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("error creating request. Err: %v", err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := s.Test(req)
+			if err != nil {
+				t.Fatalf("error making request to server. Err: %v", err)
+			}
+			if resp.StatusCode != tt.expected || db.timezone != tt.stored {
+				t.Errorf("expected %d storing %q; got %d storing %q", tt.expected, tt.stored, resp.StatusCode, db.timezone)
+			}
+		})
+	}
+}
+
+func TestSignUpValidatesTheTimezone(t *testing.T) {
+	user := types.User{FirstName: "Ada", LastName: "Lovelace", Email: "ada@example.com", Password: "Correct-horse-1"}
+	if err := validate.Struct(user); err != nil {
+		t.Errorf("expected no timezone to be valid; got %v", err)
+	}
+	user.Timezone = "Europe/Paris"
+	if err := validate.Struct(user); err != nil {
+		t.Errorf("expected Europe/Paris to be valid; got %v", err)
+	}
+	user.Timezone = "Europe/Atlantis"
+	if err := validate.Struct(user); err == nil {
+		t.Errorf("expected an unknown timezone to be refused")
+	}
+}
+
+// The clocks go forward on March 31, 2024 and back on October 27, 2024 in
+// Paris: the periods containing these days last an hour less or more, and
+// count the evening of the day in full.
+func TestPeriodsAcrossDaylightSavingTime(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Fatalf("error loading the timezone. Err: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		period   string
+		at       time.Time
+		start    time.Time
+		duration time.Duration
+	}{
+		{"week losing an hour", "weekly", time.Date(2024, time.March, 31, 23, 30, 0, 0, paris), time.Date(2024, time.March, 25, 0, 0, 0, 0, paris), 7*24*time.Hour - time.Hour},
+		{"week gaining an hour", "weekly", time.Date(2024, time.October, 27, 23, 30, 0, 0, paris), time.Date(2024, time.October, 21, 0, 0, 0, 0, paris), 7*24*time.Hour + time.Hour},
+		{"month losing an hour", "monthly", time.Date(2024, time.March, 31, 23, 30, 0, 0, paris), time.Date(2024, time.March, 1, 0, 0, 0, 0, paris), 31*24*time.Hour - time.Hour},
+		{"next month", "monthly", time.Date(2024, time.April, 1, 0, 30, 0, 0, paris), time.Date(2024, time.April, 1, 0, 0, 0, 0, paris), 30 * 24 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := calendarPeriod(tt.period, int(time.Monday), tt.at, paris)
+			if !start.Equal(tt.start) || end.Sub(start) != tt.duration {
+				t.Errorf("expected %v lasting %v; got %v lasting %v", tt.start, tt.duration, start, end.Sub(start))
+			}
+			if tt.at.Before(start) || !tt.at.Before(end) {
+				t.Errorf("expected %v inside [%v, %v)", tt.at, start, end)
+			}
+		})
+	}
+
+	// The digest of the week after the change is still sent at 8:00 local time
+	scheduledAt := digestSchedule(time.Date(2024, time.April, 3, 12, 0, 0, 0, time.UTC), paris, 8)
+	if expected := time.Date(2024, time.April, 1, 6, 0, 0, 0, time.UTC); !scheduledAt.Equal(expected) {
+		t.Errorf("expected the digest at %v; got %v", expected, scheduledAt)
+	}
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/acme/autocert"
+
+	"FinMa/internal/config"
+)
+
+// redirectReadHeaderTimeout bounds the reading of the request headers by the
+// HTTPS redirect listener.
+const redirectReadHeaderTimeout = 10 * time.Second
+
+// certificateReloader serves a certificate read from files, reloaded on
+// demand so that a renewal does not need a restart.
+type certificateReloader struct {
+	certFile, keyFile string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// newCertificateReloader loads the certificate and its key.
+func newCertificateReloader(certFile, keyFile string) (*certificateReloader, error) {
+	r := &certificateReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// reload reads the files again. The previous certificate is kept when they
+// are invalid, a renewal written halfway must not take the server down.
+func (r *certificateReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("cannot load the TLS certificate: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	return nil
+}
+
+// GetCertificate returns the current certificate, for tls.Config.
+func (r *certificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// serverTLS is the TLS setup of the listener: the configuration, and the
+// reloader or the autocert manager the certificates come from.
+type serverTLS struct {
+	config   *tls.Config
+	reloader *certificateReloader
+	autocert *autocert.Manager
+}
+
+// newServerTLS builds the TLS setup from the configuration, nil when TLS is
+// off. The certificates come from files, or from Let's Encrypt for the
+// autocert hosts.
+func newServerTLS(cfg config.TLS) (*serverTLS, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+
+	if len(cfg.AutocertHosts) > 0 {
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.AutocertHosts...),
+			Cache:      autocert.DirCache(cfg.AutocertCacheDir),
+			Email:      cfg.AutocertEmail,
+		}
+		tlsConfig := manager.TLSConfig()
+		tlsConfig.MinVersion = tls.VersionTLS12
+		return &serverTLS{config: tlsConfig, autocert: manager}, nil
+	}
+
+	reloader, err := newCertificateReloader(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &serverTLS{
+		config: &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: reloader.GetCertificate,
+		},
+		reloader: reloader,
+	}, nil
+}
+
+// listen returns the listener of the server on addr, with TLS when it is
+// configured.
+func (s *FiberServer) listen(addr string) (net.Listener, error) {
+	if s.tls == nil {
+		return net.Listen("tcp", addr)
+	}
+	return tls.Listen("tcp", addr, s.tls.config)
+}
+
+// reloadCertificate reads the certificate files again, when the
+// certificate comes from files. Autocert renews its certificates itself.
+func (s *FiberServer) reloadCertificate() {
+	if s.tls == nil || s.tls.reloader == nil {
+		return
+	}
+	if err := s.tls.reloader.reload(); err != nil {
+		log.Error("Keeping the previous TLS certificate: ", err)
+		return
+	}
+	log.Info("TLS certificate reloaded")
+}
+
+// newRedirectServer returns the plain HTTP server redirecting to the HTTPS
+// listener on httpsAddr, nil without a redirect address. With autocert it
+// also answers the ACME HTTP challenges.
+func (s *FiberServer) newRedirectServer(httpsAddr string) *http.Server {
+	if s.tls == nil || s.config.Server.TLS.RedirectAddr == "" {
+		return nil
+	}
+
+	var handler http.Handler = httpsRedirect(httpsAddr)
+	if s.tls.autocert != nil {
+		handler = s.tls.autocert.HTTPHandler(handler)
+	}
+	return &http.Server{
+		Addr:              s.config.Server.TLS.RedirectAddr,
+		Handler:           handler,
+		ReadHeaderTimeout: redirectReadHeaderTimeout,
+	}
+}
+
+// httpsRedirect permanently redirects the requests to the same URL on the
+// HTTPS listener on httpsAddr. 308 keeps the method and the body.
+func httpsRedirect(httpsAddr string) http.HandlerFunc {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(strings.Trim(host, "[]"), port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	}
+}
+
+// strictTransportSecurity tells the browsers to only use HTTPS for maxAge
+// seconds (HSTS). It is only registered when the server listens with TLS.
+func strictTransportSecurity(maxAge int) fiber.Handler {
+	value := fmt.Sprintf("max-age=%d", maxAge)
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderStrictTransportSecurity, value)
+		return c.Next()
+	}
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"FinMa/internal/config"
+)
+
+// writeCertificate writes a self-signed certificate for the common name
+// and its key to the files.
+func writeCertificate(t *testing.T, certFile, keyFile, commonName string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key. Err: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("error creating certificate. Err: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("error encoding key. Err: %v", err)
+	}
+
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("error writing certificate. Err: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("error writing key. Err: %v", err)
+	}
+}
+
+func commonName(t *testing.T, r *certificateReloader) string {
+	t.Helper()
+	cert, _ := r.GetCertificate(nil)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("error parsing certificate. Err: %v", err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestCertificateReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeCertificate(t, certFile, keyFile, "before.example.com")
+
+	reloader, err := newCertificateReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("unexpected error. Err: %v", err)
+	}
+
+	writeCertificate(t, certFile, keyFile, "after.example.com")
+	if err := reloader.reload(); err != nil {
+		t.Fatalf("unexpected error. Err: %v", err)
+	}
+	if name := commonName(t, reloader); name != "after.example.com" {
+		t.Errorf("expected the renewed certificate; got %s", name)
+	}
+
+	// A renewal written halfway keeps the previous certificate
+	if err := os.WriteFile(keyFile, []byte("partial"), 0o600); err != nil {
+		t.Fatalf("error writing key. Err: %v", err)
+	}
+	if err := reloader.reload(); err == nil {
+		t.Errorf("expected an error for the invalid key")
+	}
+	if name := commonName(t, reloader); name != "after.example.com" {
+		t.Errorf("expected the previous certificate to be kept; got %s", name)
+	}
+}
+
+func TestListenWithTLS(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.Default()
+	cfg.Server.TLS.CertFile, cfg.Server.TLS.KeyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeCertificate(t, cfg.Server.TLS.CertFile, cfg.Server.TLS.KeyFile, "localhost")
+
+	tlsSetup, err := newServerTLS(cfg.Server.TLS)
+	if err != nil {
+		t.Fatalf("unexpected error. Err: %v", err)
+	}
+	s := &FiberServer{App: fiber.New(fiber.Config{DisableStartupMessage: true}), config: cfg, tls: tlsSetup}
+	s.Use(strictTransportSecurity(cfg.Server.TLS.HSTSMaxAge))
+	s.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(c.Protocol())
+	})
+
+	ln, err := s.listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error. Err: %v", err)
+	}
+	go s.Listener(ln)
+	defer s.App.Shutdown()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := client.Get("https://" + ln.Addr().String() + "/")
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.TLS == nil {
+		t.Errorf("expected a TLS connection")
+	}
+	if hsts := resp.Header.Get("Strict-Transport-Security"); hsts != "max-age=31536000" {
+		t.Errorf("expected the HSTS header; got %q", hsts)
+	}
+}
+
+func TestHTTPSRedirect(t *testing.T) {
+	tests := []struct {
+		httpsAddr string
+		host      string
+		target    string
+		expected  string
+	}{
+		{":443", "finma.example.com", "/api/v1/accounts?page=2", "https://finma.example.com/api/v1/accounts?page=2"},
+		{":443", "finma.example.com:80", "/", "https://finma.example.com/"},
+		{":8443", "finma.example.com", "/", "https://finma.example.com:8443/"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", tt.target, nil)
+		req.Host = tt.host
+		rec := httptest.NewRecorder()
+		httpsRedirect(tt.httpsAddr)(rec, req)
+
+		if rec.Code != http.StatusPermanentRedirect {
+			t.Errorf("expected status 308; got %d", rec.Code)
+		}
+		if location := rec.Header().Get("Location"); location != tt.expected {
+			t.Errorf("expected %s; got %s", tt.expected, location)
+		}
+	}
+}
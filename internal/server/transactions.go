@@ -2,7 +2,12 @@ package server
 
 import (
 	"FinMa/constants"
+	"FinMa/internal/database"
 	"FinMa/types"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/charmbracelet/log"
@@ -10,108 +15,636 @@ import (
 	"github.com/google/uuid"
 )
 
+// normalizeTransactionAmount returns the canonical form of a transaction amount.
+// Amounts are stored as absolute values and the direction is carried by the type:
+// - a negative amount without a type is treated as an expense, a positive one as an income
+// - a negative amount is accepted for expenses and transfers for backward compatibility
+// - a negative income and a zero amount are rejected
+func normalizeTransactionAmount(amount types.Money, transactionType string) (types.Money, string, error) {
+	if amount.IsZero() {
+		return types.Money{}, "", errors.New("amount must not be zero")
+	}
+
+	if transactionType == "" {
+		if amount.Sign() < 0 {
+			return amount.Neg(), "expense", nil
+		}
+		return amount, "income", nil
+	}
+
+	validType := false
+	for _, t := range constants.GetTransactionTypes() {
+		if t == transactionType {
+			validType = true
+			break
+		}
+	}
+	if !validType {
+		return types.Money{}, "", errors.New("Invalid transaction type")
+	}
+
+	if transactionType == "income" && amount.Sign() < 0 {
+		return types.Money{}, "", errors.New("income amount must be positive")
+	}
+
+	if amount.Sign() < 0 {
+		amount = amount.Neg()
+	}
+	return amount, transactionType, nil
+}
+
+func isValidCategory(category string) bool {
+	for _, cat := range constants.GetTransactionCategories() {
+		if cat == category {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateTransaction creates a new transaction for the authenticated user.
+// The amount in the response is always positive, the type ("income", "expense"
+// or "transfer") tells in which direction the money moved.
+// Transactions dated before the account opening date are refused with a 422,
+// or accepted with before_opening set when ALLOW_TRANSACTIONS_BEFORE_OPENING is on.
 func (s *FiberServer) CreateTransaction(c *fiber.Ctx) error {
 	type CreateTransactionRequest struct {
-		Category      string    `json:"category"`
-		Amount        float64   `json:"amount"`
-		Date          string    `json:"date"` // Change to string for custom parsing
-		Type          string    `json:"type"` // income/expense
-		IsRecurring   bool      `json:"is_recurring"`
-		Description   string    `json:"description"`
-		BankAccountID uuid.UUID `json:"bank_account_id"`
+		Category      string      `json:"category"`
+		Amount        types.Money `json:"amount"` // Decimal string, like "12.34", numbers are deprecated
+		Date          string      `json:"date"`   // Change to string for custom parsing
+		Type          string      `json:"type"`   // income/expense/transfer
+		IsRecurring   bool        `json:"is_recurring"`
+		Description   string      `json:"description"`
+		BankAccountID uuid.UUID   `json:"bank_account_id"`
+		// ExcludeFromBudgets defaults to the exclude_by_default setting of the category
+		ExcludeFromBudgets *bool `json:"exclude_from_budgets"`
+		// TransferAccountID is the account receiving a transfer, like a credit card being paid
+		TransferAccountID *uuid.UUID `json:"transfer_account_id"`
 	}
 
 	var body CreateTransactionRequest
 	if err := c.BodyParser(&body); err != nil {
 		log.Error(err)
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid request body",
-		})
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
 	}
 
 	// Validate the date format
 	parsedDate, err := time.Parse(time.RFC3339, body.Date)
 	if err != nil {
 		log.Error(err)
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid date format",
-		})
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid date format")
 	}
 
-	// Validate the types
-	validType := false
-	for _, t := range constants.GetTransactionTypes() {
-		if t == body.Type {
-			validType = true
-			break
-		}
-	}
-	if !validType {
-		log.Error("Invalid transaction type")
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid transaction type",
-		})
+	// Validate the amount against the type
+	amount, transactionType, err := normalizeTransactionAmount(body.Amount, body.Type)
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, err.Error())
 	}
 
 	// Validate the category
-	validCategory := false
-	for _, cat := range constants.GetTransactionCategories() {
-		if cat == body.Category {
-			validCategory = true
-			break
-		}
-	}
-	if !validCategory {
+	if !isValidCategory(body.Category) {
 		log.Error("Invalid transaction category")
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid transaction category",
-		})
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid transaction category")
 	}
 
 	user := c.Locals("user").(types.User)
 
 	if user.ID == uuid.Nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Unauthorized",
-		})
+		return NewAPIError(fiber.StatusUnauthorized, CodeUnauthorized, "Unauthorized")
+	}
+
+	if err := s.checkLimit(c, user, limitMonthlyTransactions, 1); err != nil {
+		return err
+	}
+
+	account, ok := s.findUserBankAccount(user, body.BankAccountID.String(), "editor")
+	if !ok {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid bank account")
+	}
+
+	if account.ArchivedAt != nil {
+		return NewAPIError(fiber.StatusConflict, CodeAccountArchived, "Bank account is archived")
+	}
+
+	if err := s.checkAccountAmount("amount", amount, account); err != nil {
+		return err
+	}
+
+	if body.TransferAccountID != nil {
+		if transactionType != "transfer" || *body.TransferAccountID == account.ID {
+			return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid transfer account")
+		}
+		if _, ok := s.findUserBankAccount(user, body.TransferAccountID.String(), "editor"); !ok {
+			return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid transfer account")
+		}
+	}
+
+	beforeOpening := isBeforeOpening(account, parsedDate)
+	if beforeOpening && !s.config.Features.AllowTransactionsBeforeOpening {
+		return NewAPIError(fiber.StatusUnprocessableEntity, CodeUnprocessable, "Transaction date is before the account opening date")
 	}
 
 	transaction := &types.Transaction{
-		Category:      body.Category,
-		Amount:        body.Amount,
-		Date:          parsedDate,
-		Type:          body.Type,
-		IsRecurring:   body.IsRecurring,
-		Description:   body.Description,
-		BankAccountID: body.BankAccountID,
-		User:          user,
+		ID:                uuid.New(),
+		Category:          body.Category,
+		Amount:            amount,
+		Date:              parsedDate,
+		Type:              transactionType,
+		IsRecurring:       body.IsRecurring,
+		Description:       body.Description,
+		BankAccountID:     body.BankAccountID,
+		TransferAccountID: body.TransferAccountID,
+		UserID:            user.ID,
+		BeforeOpening:     beforeOpening,
 	}
 
+	if body.ExcludeFromBudgets != nil {
+		transaction.ExcludeFromBudgets = *body.ExcludeFromBudgets
+	} else {
+		transaction.ExcludeFromBudgets = s.db.IsCategoryExcludedByDefault(user.ID, transaction.Category)
+	}
+
+	s.flagAnomaly(transaction)
+
 	if err := s.db.CreateTransaction(transaction); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Could not create transaction",
-		})
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not create transaction")
 	}
 
+	s.notifyAnomaly(transaction)
+	s.audit(user.ID, "transaction.created", "transaction", transaction.ID, transaction.Description)
+
 	return c.Status(fiber.StatusCreated).JSON(transaction)
 }
 
+// updateTransactionRequest holds the fields of a transaction to change, the
+// ones left out are kept.
+type updateTransactionRequest struct {
+	Version     *int64       `json:"version"`
+	Category    *string      `json:"category"`
+	Amount      *types.Money `json:"amount"`
+	Date        *string      `json:"date"`
+	Type        *string      `json:"type"`
+	IsRecurring *bool        `json:"is_recurring"`
+	Description *string      `json:"description"`
+
+	ExcludeFromBudgets *bool `json:"exclude_from_budgets"`
+}
+
+// UpdateTransaction partially updates a transaction owned by the authenticated user.
+// Amount and type are normalized the same way as in CreateTransaction.
+// The version read is required, a transaction changed since is not updated.
+func (s *FiberServer) UpdateTransaction(c *fiber.Ctx) error {
+	var body updateTransactionRequest
+	if err := c.BodyParser(&body); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+
+	version, err := expectedVersion(c, body.Version)
+	if err != nil {
+		return err
+	}
+
+	user := c.Locals("user").(types.User)
+	transaction, err := s.updateTransaction(user, c.Params("id"), version, body)
+	if err != nil {
+		return err
+	}
+	return c.JSON(transaction)
+}
+
+// updateTransaction applies the changes to the transaction if the user can
+// edit it and it is still at the version read.
+func (s *FiberServer) updateTransaction(user types.User, id string, version int64, body updateTransactionRequest) (types.Transaction, error) {
+	transaction, ok := s.findUserTransaction(user, id, "editor")
+
+	if !ok {
+		return types.Transaction{}, NewAPIError(fiber.StatusNotFound, CodeNotFound, "Transaction not found")
+	}
+	if transaction.Version != version {
+		return types.Transaction{}, versionConflict(transaction)
+	}
+
+	if transaction.IsReconciled && (body.Date != nil || body.Amount != nil || body.Type != nil) {
+		return types.Transaction{}, NewAPIError(fiber.StatusConflict, CodeTransactionReconciled, "Transaction is reconciled, unreconcile it before editing its amount or date")
+	}
+
+	if body.Date != nil {
+		parsedDate, err := time.Parse(time.RFC3339, *body.Date)
+		if err != nil {
+			return types.Transaction{}, NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid date format")
+		}
+
+		account := s.db.GetBankAccountByID(transaction.BankAccountID.String())
+		if isBeforeOpening(account, parsedDate) {
+			if !s.config.Features.AllowTransactionsBeforeOpening {
+				return types.Transaction{}, NewAPIError(fiber.StatusUnprocessableEntity, CodeUnprocessable, "Transaction date is before the account opening date")
+			}
+			transaction.BeforeOpening = true
+		}
+		transaction.Date = parsedDate
+	}
+
+	if body.Amount != nil || body.Type != nil {
+		amount := transaction.Amount
+		if body.Amount != nil {
+			amount = *body.Amount
+		}
+		transactionType := transaction.Type
+		if body.Type != nil {
+			transactionType = *body.Type
+		}
+
+		normalizedAmount, normalizedType, err := normalizeTransactionAmount(amount, transactionType)
+		if err != nil {
+			return types.Transaction{}, NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, err.Error())
+		}
+		if body.Amount != nil {
+			account := s.db.GetBankAccountByID(transaction.BankAccountID.String())
+			if err := s.checkAccountAmount("amount", normalizedAmount, account); err != nil {
+				return types.Transaction{}, err
+			}
+		}
+		transaction.Amount = normalizedAmount
+		transaction.Type = normalizedType
+	}
+
+	if body.Category != nil {
+		if !isValidCategory(*body.Category) {
+			return types.Transaction{}, NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid transaction category")
+		}
+		transaction.Category = *body.Category
+	}
+
+	if body.IsRecurring != nil {
+		transaction.IsRecurring = *body.IsRecurring
+	}
+	if body.Description != nil {
+		transaction.Description = *body.Description
+	}
+	if body.ExcludeFromBudgets != nil {
+		transaction.ExcludeFromBudgets = *body.ExcludeFromBudgets
+	}
+
+	if err := s.db.UpdateTransaction(&transaction); err != nil {
+		return types.Transaction{}, s.updateTransactionError(err, transaction.ID)
+	}
+
+	var fields []string
+	for name, set := range map[string]bool{
+		"category": body.Category != nil, "amount": body.Amount != nil, "date": body.Date != nil, "type": body.Type != nil,
+		"is_recurring": body.IsRecurring != nil, "description": body.Description != nil, "exclude_from_budgets": body.ExcludeFromBudgets != nil,
+	} {
+		if set {
+			fields = append(fields, name)
+		}
+	}
+	slices.Sort(fields)
+	s.audit(user.ID, "transaction.updated", "transaction", transaction.ID, strings.Join(fields, ", "))
+
+	return transaction, nil
+}
+
+// updateTransactionError is the error returned for a failed update of the
+// transaction: a conflict with its current state if it changed meanwhile.
+func (s *FiberServer) updateTransactionError(err error, id uuid.UUID) error {
+	if errors.Is(err, database.ErrVersionConflict) {
+		return versionConflict(s.db.GetTransactionByID(id.String()))
+	}
+	log.Error(err)
+	return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not update transaction")
+}
+
+// findUserTransaction returns the transaction with the given ID if the user
+// has at least the given role on its account. Transactions without an
+// account are only visible to the user who created them.
+func (s *FiberServer) findUserTransaction(user types.User, id string, role string) (types.Transaction, bool) {
+	transaction := s.db.GetTransactionByID(id)
+	if transaction.ID == uuid.Nil {
+		return types.Transaction{}, false
+	}
+
+	if transaction.BankAccountID == uuid.Nil {
+		return transaction, transaction.UserID == user.ID
+	}
+
+	if _, ok := s.findUserBankAccount(user, transaction.BankAccountID.String(), role); !ok {
+		return types.Transaction{}, false
+	}
+	return transaction, true
+}
+
+// parseTransactionFilter reads the filtering and pagination query parameters
+// shared by the transaction listing endpoints:
+// - from, to: RFC3339 dates bounding the transaction date (inclusive)
+// - category, type: exact match on the transaction category and type
+// - flagged: only return the transactions flagged (true) or not flagged (false) as unusually large
+// - excluded: only return the transactions excluded (true) or not excluded (false) from the budgets
+// - with_balance: set the running balance of the account on each transaction
+// - batch_id: only return the transactions of a batch of the activity feed, like an import
+// - limit, offset: pagination, limit defaults to 50 and is capped at 500
+// Read through a share grant, the dates are narrowed to the grant.
+func parseTransactionFilter(c *fiber.Ctx) (types.TransactionFilter, error) {
+	filter := types.TransactionFilter{
+		Category:    c.Query("category"),
+		Type:        c.Query("type"),
+		WithBalance: c.QueryBool("with_balance"),
+		Limit:       c.QueryInt("limit", 50),
+		Offset:      c.QueryInt("offset", 0),
+	}
+
+	if from := c.Query("from"); from != "" {
+		parsedFrom, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return filter, errors.New("Invalid from date format")
+		}
+		filter.From = &parsedFrom
+	}
+
+	if to := c.Query("to"); to != "" {
+		parsedTo, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return filter, errors.New("Invalid to date format")
+		}
+		filter.To = &parsedTo
+	}
+
+	if flagged := c.Query("flagged"); flagged != "" {
+		value := c.QueryBool("flagged")
+		filter.Flagged = &value
+	}
+
+	if excluded := c.Query("excluded"); excluded != "" {
+		value := c.QueryBool("excluded")
+		filter.Excluded = &value
+	}
+
+	if batchID := c.Query("batch_id"); batchID != "" {
+		parsedBatchID, err := uuid.Parse(batchID)
+		if err != nil {
+			return filter, errors.New("Invalid batch_id")
+		}
+		filter.BatchID = &parsedBatchID
+	}
+
+	if grant, ok := sharedGrant(c); ok {
+		from, to := grant.From, grant.To
+		if filter.From != nil {
+			from = *filter.From
+		}
+		if filter.To != nil {
+			to = *filter.To
+		}
+		from, to = clampToGrant(grant, from, to)
+		filter.From, filter.To = &from, &to
+	}
+
+	if filter.Limit <= 0 || filter.Limit > 500 {
+		filter.Limit = 50
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	return filter, nil
+}
+
+// GetTransactions lists the transactions of the accounts the user owns or is
+// a member of. ?include_shared=false restricts it to the accounts the user owns.
+// With ?format=csv or Accept: text/csv the whole filtered set is sent as CSV,
+// up to csvRowLimit rows, X-Truncated is set past it. ?format=xlsx sends it
+// as an XLSX workbook the same way.
 func (s *FiberServer) GetTransactions(c *fiber.Ctx) error {
-	user := c.Locals("user").(*types.User)
-	transactions := s.db.GetTransactions(user)
+	db := s.dbFor(c)
+
+	user := c.Locals("user").(types.User)
+
+	format, err := responseFormat(c, formatJSON, formatCSV, formatXLSX)
+	if err != nil {
+		return err
+	}
+	filter, err := parseTransactionFilter(c)
+	if err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, err.Error())
+	}
+	// A share grant gives access to the accounts of its owner only
+	_, shared := sharedGrant(c)
+	filter.ExcludeShared = c.Query("include_shared") == "false" || shared
+	if format == formatCSV || format == formatXLSX {
+		// Paging a CSV makes no sense, one more row tells it was truncated
+		filter.Limit, filter.Offset = csvRowLimit+1, 0
+	}
+	sel, err := transactionResource.selection(c)
+	if err != nil {
+		return err
+	}
+
+	token, err := db.TransactionsChangeToken(&user, filter)
+	if err != nil {
+		return err
+	}
+	embeddedToken, err := transactionResource.changeToken(s, c, sel)
+	if err != nil {
+		return err
+	}
+	// The ETag is keyed by the URL, the format may come from the Accept header
+	c.Vary(fiber.HeaderAccept)
+	if notModified(c, token+embeddedToken+format) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	if format == formatCSV || format == formatXLSX {
+		rows := db.GetTransactions(&user, filter)
+		if len(rows) > csvRowLimit {
+			rows = rows[:csvRowLimit]
+			c.Set("X-Truncated", "true")
+		}
+		if format == formatXLSX {
+			return s.sendXLSX(c, user, "transactions", xlsxSheet{"Transactions", rows})
+		}
+		return sendCSV(c, "transactions", rows)
+	}
+
+	transactions, err := transactionResource.list(s, c, sel, db.GetTransactions(&user, filter))
+	if err != nil {
+		return err
+	}
 
 	return c.JSON(transactions)
 }
 
+// GetAccountTransactions lists the transactions of one account, with the same
+// filters as GetTransactions, and a summary of the account in meta.
+func (s *FiberServer) GetAccountTransactions(c *fiber.Ctx) error {
+	db := s.dbFor(c)
+
+	user := c.Locals("user").(types.User)
+	account, ok := s.findUserBankAccount(user, c.Params("id"), "viewer")
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Bank account not found")
+	}
+
+	filter, err := parseTransactionFilter(c)
+	if err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, err.Error())
+	}
+	filter.AccountID = &account.ID
+	sel, err := transactionResource.selection(c)
+	if err != nil {
+		return err
+	}
+
+	count, err := db.CountTransactions(&user, filter)
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not count transactions")
+	}
+
+	pending, err := db.GetPendingTotal(account.ID)
+	if err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not compute pending total")
+	}
+
+	transactions, err := transactionResource.list(s, c, sel, db.GetTransactions(&user, filter))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"transactions": transactions,
+		"meta": types.AccountTransactionsMeta{
+			AccountID:        account.ID,
+			Balance:          account.Balance,
+			PendingTotal:     pending,
+			TransactionCount: count,
+		},
+	})
+}
+
+// bulkUpdateLimit is the maximum number of transactions updated at once.
+const bulkUpdateLimit = 500
+
+// BulkUpdateTransactions sets exclude_from_budgets on every transaction of
+// ids the user can edit. The transactions are updated one by one so that
+// their budget attribution and the budget history follow; the IDs the user
+// cannot edit are returned in not_found and nothing is done for them.
+// versions holds the version read of every transaction; the ones changed
+// since are returned as they are now in conflicts and are not updated.
+func (s *FiberServer) BulkUpdateTransactions(c *fiber.Ctx) error {
+	type BulkUpdateTransactionsRequest struct {
+		IDs                []uuid.UUID         `json:"ids"`
+		Versions           map[uuid.UUID]int64 `json:"versions"`
+		ExcludeFromBudgets *bool               `json:"exclude_from_budgets"`
+	}
+
+	var body BulkUpdateTransactionsRequest
+	if err := c.BodyParser(&body); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+	}
+
+	if len(body.IDs) == 0 || len(body.IDs) > bulkUpdateLimit {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("Between 1 and %d transaction IDs are required", bulkUpdateLimit))
+	}
+	if body.ExcludeFromBudgets == nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Nothing to update")
+	}
+	var missing []FieldError
+	for _, id := range body.IDs {
+		if _, ok := body.Versions[id]; !ok {
+			missing = append(missing, FieldError{Field: "versions", Message: "The version of the transaction is required", Value: id})
+		}
+	}
+	if len(missing) > 0 {
+		return NewAPIError(fiber.StatusPreconditionRequired, CodeVersionRequired, "The version read of every transaction is required").
+			WithDetails(missing...)
+	}
+
+	user := c.Locals("user").(types.User)
+	updated := 0
+	notFound := make([]uuid.UUID, 0)
+	conflicts := make([]types.Transaction, 0)
+	var changed []uuid.UUID
+	defer func() {
+		s.auditBatch(uuid.New(), user.ID, "transaction.updated", "transaction", changed, "exclude_from_budgets")
+	}()
+	for _, id := range body.IDs {
+		transaction, ok := s.findUserTransaction(user, id.String(), "editor")
+		if !ok {
+			notFound = append(notFound, id)
+			continue
+		}
+		if transaction.Version != body.Versions[id] {
+			conflicts = append(conflicts, transaction)
+			continue
+		}
+		if transaction.ExcludeFromBudgets == *body.ExcludeFromBudgets {
+			updated++
+			continue
+		}
+
+		transaction.ExcludeFromBudgets = *body.ExcludeFromBudgets
+		err := s.db.UpdateTransaction(&transaction)
+		if errors.Is(err, database.ErrVersionConflict) {
+			conflicts = append(conflicts, s.db.GetTransactionByID(id.String()))
+			continue
+		}
+		if err != nil {
+			log.Error(err)
+			return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not update transactions")
+		}
+		changed = append(changed, transaction.ID)
+		updated++
+	}
+
+	return c.JSON(fiber.Map{
+		"updated":   updated,
+		"not_found": notFound,
+		"conflicts": conflicts,
+	})
+}
+
 func (s *FiberServer) GetTransactionByID(c *fiber.Ctx) error {
-	id := c.Params("id")
-	transaction := s.db.GetTransactionByID(id)
+	sel, err := transactionResource.selection(c)
+	if err != nil {
+		return err
+	}
 
-	if transaction.ID == uuid.Nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Transaction not found",
-		})
+	user := c.Locals("user").(types.User)
+	transaction, ok := s.findUserTransaction(user, c.Params("id"), "viewer")
+
+	if !ok || !s.sharesTransaction(c, transaction) {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Transaction not found")
 	}
 
-	return c.JSON(transaction)
+	shaped, err := transactionResource.one(s, c, sel, transaction)
+	if err != nil {
+		return err
+	}
+	return c.JSON(shaped)
+}
+
+// DeleteTransaction deletes a transaction owned by the authenticated user and
+// reverts its effect on the account balance.
+func (s *FiberServer) DeleteTransaction(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	transaction, ok := s.findUserTransaction(user, c.Params("id"), "editor")
+
+	if !ok {
+		return NewAPIError(fiber.StatusNotFound, CodeNotFound, "Transaction not found")
+	}
+
+	if transaction.IsReconciled {
+		return NewAPIError(fiber.StatusConflict, CodeTransactionReconciled, "Transaction is reconciled, unreconcile it before deleting it")
+	}
+
+	if err := s.db.DeleteTransaction(&transaction); err != nil {
+		log.Error(err)
+		return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not delete transaction")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
 }
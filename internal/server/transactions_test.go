@@ -0,0 +1,60 @@
+package server
+
+import (
+	"testing"
+
+	"FinMa/types"
+)
+
+// money returns the amount without a currency, as read from the database.
+func money(amount float64) types.Money {
+	return types.MoneyFromFloat(amount, "")
+}
+
+// moneys returns the amounts without a currency.
+func moneys(amounts ...float64) []types.Money {
+	list := make([]types.Money, len(amounts))
+	for i, amount := range amounts {
+		list[i] = money(amount)
+	}
+	return list
+}
+
+func TestNormalizeTransactionAmount(t *testing.T) {
+	tests := []struct {
+		name            string
+		amount          float64
+		transactionType string
+		expectedAmount  float64
+		expectedType    string
+		expectErr       bool
+	}{
+		{"income", 100, "income", 100, "income", false},
+		{"negative income", -100, "income", 0, "", true},
+		{"expense", 42.5, "expense", 42.5, "expense", false},
+		{"signed expense", -42.5, "expense", 42.5, "expense", false},
+		{"signed transfer", -10, "transfer", 10, "transfer", false},
+		{"untyped negative", -15, "", 15, "expense", false},
+		{"untyped positive", 15, "", 15, "income", false},
+		{"zero amount", 0, "expense", 0, "", true},
+		{"unknown type", 10, "gift", 0, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			amount, transactionType, err := normalizeTransactionAmount(money(tt.amount), tt.transactionType)
+			if tt.expectErr {
+				if err == nil {
+					t.Fatalf("expected an error for amount %v and type %q", tt.amount, tt.transactionType)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if amount != money(tt.expectedAmount) || transactionType != tt.expectedType {
+				t.Errorf("expected (%v, %q); got (%v, %q)", tt.expectedAmount, tt.expectedType, amount, transactionType)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// expectedVersion returns the version of the resource the client read, the
+// "version" of the body or else the If-Match header, like "3" or W/"3".
+// The updates without one are refused: they would overwrite the changes
+// made since the client read the resource.
+func expectedVersion(c *fiber.Ctx, version *int64) (int64, error) {
+	if version != nil {
+		if *version <= 0 {
+			return 0, NewAPIError(fiber.StatusUnprocessableEntity, CodeValidationFailed, "Invalid version").
+				WithDetails(FieldError{Field: "version", Message: "Must be positive", Value: *version})
+		}
+		return *version, nil
+	}
+
+	header := strings.TrimSpace(c.Get(fiber.HeaderIfMatch))
+	if header == "" {
+		return 0, NewAPIError(fiber.StatusPreconditionRequired, CodeVersionRequired, "The version of the resource read is required, in the body or the If-Match header")
+	}
+	parsed, err := strconv.ParseInt(strings.Trim(strings.TrimPrefix(header, "W/"), `"`), 10, 64)
+	if err != nil || parsed <= 0 {
+		return 0, NewAPIError(fiber.StatusUnprocessableEntity, CodeValidationFailed, "Invalid version").
+			WithDetails(FieldError{Field: "If-Match", Message: "Must be a version", Value: header})
+	}
+	return parsed, nil
+}
+
+// versionConflict is the error of an update of a resource changed since the
+// client read it, with the resource as it is now.
+func versionConflict(current interface{}) *APIError {
+	return NewAPIError(fiber.StatusConflict, CodeVersionConflict, "The resource changed since it was read").WithCurrent(current)
+}
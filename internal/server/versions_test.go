@@ -0,0 +1,202 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/internal/database"
+	"FinMa/types"
+	"FinMa/utils"
+)
+
+// versionsDB stores transactions and budgets, updating them only at the
+// version they were read like the repository does. race bumps a transaction
+// right before its next update, as another request would.
+type versionsDB struct {
+	*adminDB
+	transactions map[uuid.UUID]types.Transaction
+	budgets      map[uuid.UUID]types.Budget
+	race         bool
+}
+
+func (db *versionsDB) GetTransactionByID(id string) types.Transaction {
+	return db.transactions[uuid.MustParse(id)]
+}
+
+func (db *versionsDB) UpdateTransaction(transaction *types.Transaction) error {
+	stored := db.transactions[transaction.ID]
+	if db.race {
+		db.race = false
+		stored.Version++
+		db.transactions[stored.ID] = stored
+	}
+	if stored.Version != transaction.Version {
+		return database.ErrVersionConflict
+	}
+	transaction.Version++
+	db.transactions[transaction.ID] = *transaction
+	return nil
+}
+
+func (db *versionsDB) GetBudgetByID(id string) types.Budget {
+	return db.budgets[uuid.MustParse(id)]
+}
+
+func (db *versionsDB) GetBudgets(user *types.User) []types.Budget {
+	return nil
+}
+
+func (db *versionsDB) UpdateBudget(budget *types.Budget) error {
+	if db.budgets[budget.ID].Version != budget.Version {
+		return database.ErrVersionConflict
+	}
+	budget.Version++
+	db.budgets[budget.ID] = *budget
+	return nil
+}
+
+func (db *versionsDB) GetLatestClosedBudgetPeriods(budgetIDs []uuid.UUID) (map[uuid.UUID]types.ClosedBudgetPeriod, error) {
+	return map[uuid.UUID]types.ClosedBudgetPeriod{}, nil
+}
+
+func (db *versionsDB) GetBudgetsSpent(periods []types.BudgetPeriodRange) ([]types.Money, error) {
+	return make([]types.Money, len(periods)), nil
+}
+
+// versionRequest sends the request with the If-Match header, if any.
+func versionRequest(t *testing.T, s *FiberServer, as types.User, method, path, body, ifMatch string) (int, errorBody, json.RawMessage) {
+	token, err := s.tokens.GenerateAccessToken(utils.Payload{UserID: as.ID, Email: as.Email})
+	if err != nil {
+		t.Fatalf("error generating the token. Err: %v", err)
+	}
+	req, err := http.NewRequest(method, path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("error creating request. Err: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	resp, err := s.Test(req)
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+
+	var raw json.RawMessage
+	json.NewDecoder(resp.Body).Decode(&raw)
+	var errBody errorBody
+	json.Unmarshal(raw, &errBody)
+	return resp.StatusCode, errBody, raw
+}
+
+func TestUpdateTransactionVersion(t *testing.T) {
+	s, admin, _, user := newAdminTestServer(t)
+	transaction := types.Transaction{ID: uuid.New(), Category: "food", Amount: types.MoneyFromFloat(12, "EUR"), Type: "expense", UserID: user.ID, Version: 1}
+	db := &versionsDB{adminDB: admin, transactions: map[uuid.UUID]types.Transaction{transaction.ID: transaction}}
+	s.db = db
+	path := "/api/v1/transactions/" + transaction.ID.String()
+
+	if status, body, _ := versionRequest(t, s, user, "PATCH", path, `{"description":"Groceries"}`, ""); status != fiber.StatusPreconditionRequired || body.Error.Code != CodeVersionRequired {
+		t.Fatalf("expected an update without a version refused; got %d %+v", status, body)
+	}
+
+	// Two clients read version 1, the first one to update wins
+	status, _, raw := versionRequest(t, s, user, "PATCH", path, `{"version":1,"description":"Groceries"}`, "")
+	var updated types.Transaction
+	json.Unmarshal(raw, &updated)
+	if status != fiber.StatusOK || updated.Version != 2 || updated.Description != "Groceries" {
+		t.Fatalf("expected the first update applied; got %d %+v", status, updated)
+	}
+
+	status, body, raw := versionRequest(t, s, user, "PATCH", path, `{"category":"transport"}`, `"1"`)
+	var conflict struct {
+		Error struct {
+			Current types.Transaction `json:"current"`
+		} `json:"error"`
+	}
+	json.Unmarshal(raw, &conflict)
+	if status != fiber.StatusConflict || body.Error.Code != CodeVersionConflict || conflict.Error.Current.Version != 2 || conflict.Error.Current.Description != "Groceries" {
+		t.Fatalf("expected the stale update refused with the current state; got %d %s", status, raw)
+	}
+	if stored := db.transactions[transaction.ID]; stored.Category != "food" || stored.Description != "Groceries" {
+		t.Fatalf("expected the first update kept; got %+v", stored)
+	}
+
+	// The second client merges and sends the current version
+	if status, _, raw := versionRequest(t, s, user, "PATCH", path, `{"category":"transport"}`, `W/"2"`); status != fiber.StatusOK || db.transactions[transaction.ID].Version != 3 {
+		t.Fatalf("expected the update at the current version applied; got %d %s", status, raw)
+	}
+
+	// A change between the read and the write of the handler is caught too
+	db.race = true
+	if status, body, _ := versionRequest(t, s, user, "PATCH", path, `{"version":3,"description":"Bus"}`, ""); status != fiber.StatusConflict || body.Error.Code != CodeVersionConflict {
+		t.Errorf("expected the concurrent update refused; got %d %+v", status, body)
+	}
+	if status, body, _ := versionRequest(t, s, user, "PATCH", path, `{"description":"Bus"}`, `"abc"`); status != fiber.StatusUnprocessableEntity || len(body.Error.Details) != 1 || body.Error.Details[0].Field != "If-Match" {
+		t.Errorf("expected an invalid If-Match refused; got %d %+v", status, body)
+	}
+}
+
+func TestBulkUpdateTransactionsVersion(t *testing.T) {
+	s, admin, _, user := newAdminTestServer(t)
+	fresh := types.Transaction{ID: uuid.New(), Type: "expense", UserID: user.ID, Version: 1}
+	stale := types.Transaction{ID: uuid.New(), Type: "expense", UserID: user.ID, Version: 4}
+	db := &versionsDB{adminDB: admin, transactions: map[uuid.UUID]types.Transaction{fresh.ID: fresh, stale.ID: stale}}
+	s.db = db
+
+	ids := `"ids":["` + fresh.ID.String() + `","` + stale.ID.String() + `"]`
+	if status, body, _ := versionRequest(t, s, user, "PATCH", "/api/v1/transactions/bulk", `{`+ids+`,"exclude_from_budgets":true}`, ""); status != fiber.StatusPreconditionRequired || len(body.Error.Details) != 2 {
+		t.Fatalf("expected the versions required; got %d %+v", status, body)
+	}
+
+	status, _, raw := versionRequest(t, s, user, "PATCH", "/api/v1/transactions/bulk",
+		`{`+ids+`,"versions":{"`+fresh.ID.String()+`":1,"`+stale.ID.String()+`":3},"exclude_from_budgets":true}`, "")
+	var result struct {
+		Updated   int                 `json:"updated"`
+		Conflicts []types.Transaction `json:"conflicts"`
+	}
+	json.Unmarshal(raw, &result)
+	if status != fiber.StatusOK || result.Updated != 1 || len(result.Conflicts) != 1 || result.Conflicts[0].ID != stale.ID || result.Conflicts[0].Version != 4 {
+		t.Fatalf("expected the stale transaction returned as a conflict; got %d %s", status, raw)
+	}
+	if !db.transactions[fresh.ID].ExcludeFromBudgets || db.transactions[stale.ID].ExcludeFromBudgets {
+		t.Errorf("expected only the fresh transaction updated; got %+v", db.transactions)
+	}
+}
+
+func TestUpdateBudgetVersion(t *testing.T) {
+	s, admin, _, user := newAdminTestServer(t)
+	budget := types.Budget{ID: uuid.New(), Name: "Food", Amount: money(300), PeriodType: "monthly", StartDate: time.Now(),
+		Categories: []types.BudgetCategory{{Category: "food"}}, UserID: user.ID, Version: 2}
+	db := &versionsDB{adminDB: admin, budgets: map[uuid.UUID]types.Budget{budget.ID: budget}}
+	s.db = db
+	path := "/api/v1/budgets/" + budget.ID.String()
+
+	status, body, raw := versionRequest(t, s, user, "PATCH", path, `{"version":1,"amount":500}`, "")
+	var conflict struct {
+		Error struct {
+			Current budgetResponse `json:"current"`
+		} `json:"error"`
+	}
+	json.Unmarshal(raw, &conflict)
+	if status != fiber.StatusConflict || body.Error.Code != CodeVersionConflict || conflict.Error.Current.Version != 2 || conflict.Error.Current.Amount != money(300) {
+		t.Fatalf("expected the stale update refused with the current budget; got %d %s", status, raw)
+	}
+	if db.budgets[budget.ID].Amount != money(300) {
+		t.Fatalf("expected the budget untouched; got %+v", db.budgets[budget.ID])
+	}
+
+	status, _, raw = versionRequest(t, s, user, "PATCH", path, `{"amount":500}`, `"2"`)
+	var updated budgetResponse
+	json.Unmarshal(raw, &updated)
+	if status != fiber.StatusOK || updated.Version != 3 || db.budgets[budget.ID].Amount != money(500) {
+		t.Errorf("expected the update at the current version applied; got %d %s", status, raw)
+	}
+}
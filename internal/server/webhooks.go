@@ -0,0 +1,163 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+
+	"FinMa/internal/config"
+	"FinMa/types"
+)
+
+// webhookScheme is how a provider signs the webhooks it sends: the hex HMAC
+// SHA-256, with a secret shared with the provider, of "<timestamp>.<body>".
+type webhookScheme struct {
+	// provider names the provider in the logs and in the events handled
+	provider string
+	// header carries the signatures. With timestampHeader set it holds the
+	// signatures, comma separated; otherwise it holds the timestamp and the
+	// signatures as "t=<timestamp>,v1=<signature>", like Stripe.
+	header          string
+	timestampHeader string
+	// tolerance is how far the timestamp may be from now, the payloads
+	// older are refused as replays
+	tolerance time.Duration
+	secret    func(cfg config.Config) string
+}
+
+var stripeWebhooks = webhookScheme{
+	provider:  "stripe",
+	header:    "Stripe-Signature",
+	tolerance: 5 * time.Minute,
+	secret:    func(cfg config.Config) string { return cfg.Billing.StripeWebhookSecret },
+}
+
+var bankSyncWebhooks = webhookScheme{
+	provider:        "bank_sync",
+	header:          "X-Webhook-Signature",
+	timestampHeader: "X-Webhook-Timestamp",
+	tolerance:       5 * time.Minute,
+	secret:          func(cfg config.Config) string { return cfg.BankSync.WebhookSecret },
+}
+
+var errWebhookSignature = errors.New("invalid webhook signature")
+
+// verify checks the signature of the body against the secret, signature
+// and timestamp being the values of the headers of the scheme.
+func (scheme webhookScheme) verify(signature, timestamp string, body []byte, secret string, now time.Time) error {
+	var signatures []string
+	if scheme.timestampHeader != "" {
+		for _, part := range strings.Split(signature, ",") {
+			signatures = append(signatures, strings.TrimSpace(part))
+		}
+	} else {
+		for _, part := range strings.Split(signature, ",") {
+			key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+			switch key {
+			case "t":
+				timestamp = value
+			case "v1":
+				signatures = append(signatures, value)
+			}
+		}
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || secret == "" {
+		return errWebhookSignature
+	}
+	if skew := now.Sub(time.Unix(seconds, 0)); skew > scheme.tolerance || skew < -scheme.tolerance {
+		return errWebhookSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	expected := mac.Sum(nil)
+	// Any of the signatures may match, the provider signs with every secret
+	// while one is rotated
+	for _, candidate := range signatures {
+		decoded, err := hex.DecodeString(candidate)
+		if err == nil && hmac.Equal(decoded, expected) {
+			return nil
+		}
+	}
+	return errWebhookSignature
+}
+
+// verifyWebhook refuses the webhooks whose signature does not match the
+// scheme with a 401, the same whatever is wrong. The events verified are
+// handled once: the "id" of their JSON body is claimed before the handler
+// runs, and the deliveries of the same event again, concurrent ones
+// included, are acknowledged without calling it. The claim is released when
+// the handler fails, so that the provider retries. The handler reads the
+// body verified with webhookBody.
+func (s *FiberServer) verifyWebhook(scheme webhookScheme) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		secret := scheme.secret(s.config)
+		if secret == "" {
+			return NewAPIError(fiber.StatusServiceUnavailable, CodeUnavailable, "Webhooks are not configured")
+		}
+
+		// The body as sent, not decompressed by c.Body(), copied since
+		// fasthttp reuses its buffer once the request is answered
+		body := append([]byte(nil), c.Request().Body()...)
+		var timestamp string
+		if scheme.timestampHeader != "" {
+			timestamp = c.Get(scheme.timestampHeader)
+		}
+		if err := scheme.verify(c.Get(scheme.header), timestamp, body, secret, time.Now()); err != nil {
+			log.Warn("Webhook refused", "provider", scheme.provider, "ip", c.IP())
+			return NewAPIError(fiber.StatusUnauthorized, CodeUnauthorized, "Invalid signature")
+		}
+
+		var event struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(body, &event); err != nil || event.ID == "" {
+			return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid event")
+		}
+		claimed, err := s.db.ClaimWebhookEvent(&types.WebhookEvent{Provider: scheme.provider, ID: event.ID})
+		if err != nil {
+			// Answering 500 makes the provider deliver the event again
+			log.Error("Error claiming a webhook event: ", err)
+			return NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not handle the event")
+		}
+		if !claimed {
+			return c.JSON(fiber.Map{"received": true})
+		}
+
+		release := func() {
+			if err := s.db.ReleaseWebhookEvent(scheme.provider, event.ID); err != nil {
+				log.Error("Error releasing a webhook event: ", err)
+			}
+		}
+		defer func() {
+			if r := recover(); r != nil {
+				release()
+				panic(r)
+			}
+		}()
+
+		c.Locals("webhook_body", body)
+		err = c.Next()
+		if err != nil || c.Response().StatusCode() >= fiber.StatusMultipleChoices {
+			release()
+		}
+		return err
+	}
+}
+
+// webhookBody returns the body verified by verifyWebhook.
+func webhookBody(c *fiber.Ctx) []byte {
+	body, _ := c.Locals("webhook_body").([]byte)
+	return body
+}
@@ -0,0 +1,281 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/internal/banksync"
+	"FinMa/types"
+)
+
+// signWebhook returns the timestamp and the signature of the payload sent
+// at the time.
+func signWebhook(payload, secret string, at time.Time) (string, string) {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + payload))
+	return timestamp, hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebhookSchemeVerify(t *testing.T) {
+	now := time.Unix(1760000000, 0)
+	body := `{"id":"evt_1","type":"customer.subscription.updated"}`
+	timestamp, signature := signWebhook(body, "whsec", now)
+	_, other := signWebhook(body, "whsec_old", now)
+	stripe := func(timestamp string, signatures ...string) string {
+		header := "t=" + timestamp
+		for _, signature := range signatures {
+			header += ",v1=" + signature
+		}
+		return header
+	}
+
+	tests := []struct {
+		name      string
+		scheme    webhookScheme
+		signature string
+		timestamp string
+		body      string
+		valid     bool
+	}{
+		{"stripe", stripeWebhooks, stripe(timestamp, signature), "", body, true},
+		{"stripe rotating its secret", stripeWebhooks, stripe(timestamp, other, signature), "", body, true},
+		{"stripe tampered", stripeWebhooks, stripe(timestamp, signature), "", strings.Replace(body, "updated", "deleted", 1), false},
+		{"stripe other secret", stripeWebhooks, stripe(timestamp, other), "", body, false},
+		{"stripe without timestamp", stripeWebhooks, "v1=" + signature, "", body, false},
+		{"stripe unsigned", stripeWebhooks, "", "", body, false},
+		{"headers", bankSyncWebhooks, signature, timestamp, body, true},
+		{"headers rotating their secret", bankSyncWebhooks, other + ", " + signature, timestamp, body, true},
+		{"headers tampered", bankSyncWebhooks, signature, timestamp, body + " ", false},
+		{"headers timestamp changed", bankSyncWebhooks, signature, strconv.FormatInt(now.Unix()+1, 10), body, false},
+		{"headers not hex", bankSyncWebhooks, "not-hex", timestamp, body, false},
+	}
+	for _, tt := range tests {
+		err := tt.scheme.verify(tt.signature, tt.timestamp, []byte(tt.body), "whsec", now)
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: expected valid %v; got %v", tt.name, tt.valid, err)
+		}
+	}
+
+	// The timestamp is signed: a payload captured then replayed later, or
+	// sent by a provider whose clock is off, is refused past the tolerance
+	for _, at := range []time.Time{now.Add(-6 * time.Minute), now.Add(6 * time.Minute)} {
+		timestamp, signature := signWebhook(body, "whsec", at)
+		if err := bankSyncWebhooks.verify(signature, timestamp, []byte(body), "whsec", now); err == nil {
+			t.Errorf("expected a payload signed at %v refused", at)
+		}
+	}
+	timestamp, signature = signWebhook(body, "whsec", now.Add(-4*time.Minute))
+	if err := bankSyncWebhooks.verify(signature, timestamp, []byte(body), "whsec", now); err != nil {
+		t.Errorf("expected a payload within the tolerance accepted; got %v", err)
+	}
+}
+
+// expiredBankSync answers that the link of every account expired.
+type expiredBankSync struct {
+	banksync.BankSyncProvider
+	fetched int
+}
+
+func (p *expiredBankSync) FetchTransactions(ctx context.Context, accountID, cursor string) ([]banksync.ExternalTransaction, string, error) {
+	p.fetched++
+	return nil, "", banksync.ErrLinkExpired
+}
+
+// webhookEvents keeps the webhook events claimed. The claims fail with
+// claimErr, if set.
+type webhookEvents struct {
+	mu       sync.Mutex
+	handled  map[string]bool
+	claimErr error
+}
+
+func (e *webhookEvents) ClaimWebhookEvent(event *types.WebhookEvent) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.claimErr != nil {
+		return false, e.claimErr
+	}
+	if e.handled == nil {
+		e.handled = map[string]bool{}
+	}
+	key := event.Provider + "/" + event.ID
+	if e.handled[key] {
+		return false, nil
+	}
+	e.handled[key] = true
+	return true, nil
+}
+
+func (e *webhookEvents) ReleaseWebhookEvent(provider, id string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.handled, provider+"/"+id)
+	return nil
+}
+
+// webhooksDB keeps a bank connection and the webhook events handled.
+type webhooksDB struct {
+	*adminDB
+	webhookEvents
+	connection types.BankConnection
+}
+
+func (db *webhooksDB) GetBankConnectionByID(id string) types.BankConnection {
+	if id != db.connection.ID.String() {
+		return types.BankConnection{}
+	}
+	return db.connection
+}
+
+func (db *webhooksDB) UpdateBankConnection(connection *types.BankConnection) error {
+	db.connection.Status = connection.Status
+	return nil
+}
+
+func TestBankSyncWebhook(t *testing.T) {
+	s, admin, _, user := newAdminTestServer(t)
+	connection := types.BankConnection{ID: uuid.New(), Status: "linked", UserID: user.ID,
+		Accounts: []types.BankAccount{{ID: uuid.New(), ExternalAccountID: "ext-1"}}}
+	db := &webhooksDB{adminDB: admin, connection: connection}
+	s.db = db
+	provider := &expiredBankSync{}
+	s.bankSync = provider
+
+	send := func(payload, secret string, at time.Time) (int, errorBody) {
+		req, _ := http.NewRequest("POST", "/api/v1/bank-connections/webhook", strings.NewReader(payload))
+		timestamp, signature := signWebhook(payload, secret, at)
+		req.Header.Set("X-Webhook-Timestamp", timestamp)
+		req.Header.Set("X-Webhook-Signature", signature)
+		resp, err := s.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body errorBody
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body
+	}
+	payload := `{"id":"evt_1","type":"link.updated","reference":"` + connection.ID.String() + `"}`
+
+	if status, _ := send(payload, "whsec", time.Now()); status != fiber.StatusServiceUnavailable {
+		t.Fatalf("expected the webhooks refused without a secret; got %d", status)
+	}
+	s.config.BankSync.WebhookSecret = "whsec"
+
+	// Every refusal looks the same, nothing tells what was wrong
+	for name, status := range map[string]func() (int, errorBody){
+		"forged":   func() (int, errorBody) { return send(payload, "whsec_other", time.Now()) },
+		"replayed": func() (int, errorBody) { return send(payload, "whsec", time.Now().Add(-time.Hour)) },
+	} {
+		code, body := status()
+		if code != fiber.StatusUnauthorized || body.Error.Code != CodeUnauthorized || body.Error.Message != "Invalid signature" || len(body.Error.Details) != 0 {
+			t.Errorf("%s: expected a bare 401; got %d %+v", name, code, body)
+		}
+	}
+	if provider.fetched != 0 || len(db.handled) != 0 {
+		t.Fatalf("expected the refused webhooks not handled; fetched %d, handled %v", provider.fetched, db.handled)
+	}
+
+	if status, _ := send(payload, "whsec", time.Now()); status != fiber.StatusOK || provider.fetched != 1 || db.connection.Status != "expired" {
+		t.Fatalf("expected the connection synced; got %d, fetched %d, %q", status, provider.fetched, db.connection.Status)
+	}
+	if status, _ := send(payload, "whsec", time.Now()); status != fiber.StatusOK || provider.fetched != 1 {
+		t.Errorf("expected the event delivered again skipped; got %d, fetched %d", status, provider.fetched)
+	}
+	if status, _ := send(`{"type":"link.updated"}`, "whsec", time.Now()); status != fiber.StatusBadRequest {
+		t.Errorf("expected an event without ID refused; got %d", status)
+	}
+
+	// A failed claim is not an event handled, the provider delivers it again
+	db.claimErr = errors.New("connection lost")
+	retried := `{"id":"evt_3","type":"link.updated","reference":"` + connection.ID.String() + `"}`
+	if status, _ := send(retried, "whsec", time.Now()); status < fiber.StatusMultipleChoices || provider.fetched != 1 || db.handled["bank_sync/evt_3"] {
+		t.Errorf("expected the event refused for a retry; got %d, fetched %d", status, provider.fetched)
+	}
+	db.claimErr = nil
+
+	// The expired connection is left alone, the event still recorded
+	other := `{"id":"evt_2","type":"link.updated","reference":"` + connection.ID.String() + `"}`
+	if status, _ := send(other, "whsec", time.Now()); status != fiber.StatusOK || provider.fetched != 1 || !db.handled["bank_sync/evt_2"] {
+		t.Errorf("expected the expired connection not synced; got %d, fetched %d", status, provider.fetched)
+	}
+}
+
+func TestWebhookHandledOnce(t *testing.T) {
+	s, admin, _, _ := newAdminTestServer(t)
+	db := &webhooksDB{adminDB: admin}
+	s.db = db
+	s.config.BankSync.WebhookSecret = "whsec"
+
+	// The handler holds the first delivery until the others are answered,
+	// fails while fail is set
+	var calls atomic.Int32
+	var fail atomic.Bool
+	unblock := make(chan struct{})
+	app := fiber.New(fiber.Config{ErrorHandler: errorHandler})
+	app.Post("/webhook", s.verifyWebhook(bankSyncWebhooks), func(c *fiber.Ctx) error {
+		calls.Add(1)
+		<-unblock
+		if fail.Load() {
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+		return c.JSON(fiber.Map{"received": true})
+	})
+	send := func(payload string) int {
+		req, _ := http.NewRequest("POST", "/webhook", strings.NewReader(payload))
+		timestamp, signature := signWebhook(payload, "whsec", time.Now())
+		req.Header.Set("X-Webhook-Timestamp", timestamp)
+		req.Header.Set("X-Webhook-Signature", signature)
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Error(err)
+			return 0
+		}
+		return resp.StatusCode
+	}
+
+	const deliveries = 5
+	statuses := make(chan int, deliveries)
+	for range deliveries {
+		go func() { statuses <- send(`{"id":"evt_1"}`) }()
+	}
+	for range deliveries - 1 {
+		select {
+		case status := <-statuses:
+			if status != fiber.StatusOK {
+				t.Errorf("expected the duplicate delivery acknowledged; got %d", status)
+			}
+		case <-time.After(5 * time.Second):
+			close(unblock)
+			t.Fatalf("expected the duplicate deliveries answered without the handler; %d calls", calls.Load())
+		}
+	}
+	close(unblock)
+	if status := <-statuses; status != fiber.StatusOK || calls.Load() != 1 {
+		t.Errorf("expected the event handled once; got %d, %d calls", status, calls.Load())
+	}
+
+	// A failed handling releases the event, the retry handles it
+	fail.Store(true)
+	if status := send(`{"id":"evt_2"}`); status != fiber.StatusInternalServerError || db.handled["bank_sync/evt_2"] {
+		t.Fatalf("expected the failed event released; got %d", status)
+	}
+	fail.Store(false)
+	if status := send(`{"id":"evt_2"}`); status != fiber.StatusOK || calls.Load() != 3 {
+		t.Errorf("expected the retry handled; got %d, %d calls", status, calls.Load())
+	}
+}
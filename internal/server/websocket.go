@@ -0,0 +1,104 @@
+package server
+
+import (
+	"FinMa/internal/realtime"
+	"FinMa/types"
+	"encoding/json"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	// websocketWriteWait is the time allowed to write a message to the client.
+	websocketWriteWait = 10 * time.Second
+	// websocketPongWait is the time allowed between two pongs of the client
+	// before the connection is considered dead.
+	websocketPongWait = 60 * time.Second
+	// websocketPingPeriod is how often the client is pinged, it must be
+	// shorter than websocketPongWait.
+	websocketPingPeriod = websocketPongWait * 9 / 10
+)
+
+// queryAccessToken lets browsers, which cannot set headers on a websocket
+// handshake or an EventSource, pass the access token in ?access_token=.
+func queryAccessToken(c *fiber.Ctx) error {
+	if token := c.Query("access_token"); token != "" && c.Get(fiber.HeaderAuthorization) == "" {
+		c.Request().Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	}
+	return c.Next()
+}
+
+// WebSocket upgrades the request to a websocket pushing the events of the
+// user as they happen: {"id", "type": "notification", "data"} for every
+// in-app notification and {"id", "type": "transaction.created", "data"} for
+// every new transaction. Each connection of the user receives every event.
+// Messages sent by the client are ignored.
+func (s *FiberServer) WebSocket(c *fiber.Ctx) error {
+	user := c.Locals("user").(types.User)
+	upgraded := realtime.Upgrade(c, func(conn *realtime.Conn) {
+		s.serveWebSocket(conn, user.ID)
+	})
+	if !upgraded {
+		return NewAPIError(fiber.StatusUpgradeRequired, CodeUpgradeRequired, "Websocket handshake expected")
+	}
+	return nil
+}
+
+// serveWebSocket writes the events of the user to the connection and pings
+// it until the client goes away or stops answering. The subscription is
+// released when it returns and the connection is closed, which ends the
+// reading goroutine too.
+func (s *FiberServer) serveWebSocket(conn *realtime.Conn, userID uuid.UUID) {
+	subscription := s.hub.Subscribe(userID)
+	defer s.hub.Unsubscribe(subscription)
+
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		extend := func() { _ = conn.SetReadDeadline(time.Now().Add(websocketPongWait)) }
+		extend()
+		for {
+			if _, err := conn.ReadMessage(extend); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(websocketPingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event, ok := <-subscription.Events:
+			if !ok {
+				return
+			}
+			message, err := json.Marshal(event)
+			if err != nil {
+				log.Error("Error encoding websocket event: ", err)
+				continue
+			}
+			if err := conn.WriteText(message, time.Now().Add(websocketWriteWait)); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WritePing(time.Now().Add(websocketWriteWait)); err != nil {
+				return
+			}
+		case <-gone:
+			return
+		}
+	}
+}
+
+// publishTransactionEvents is called after a transaction change is committed
+// and pushes the created transactions to the connections of their creator.
+func (s *FiberServer) publishTransactionEvents(previous, current *types.Transaction) {
+	if previous != nil || current == nil {
+		return
+	}
+	s.hub.Publish(current.UserID, realtime.Event{Type: "transaction.created", Data: current})
+}
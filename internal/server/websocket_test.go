@@ -0,0 +1,100 @@
+package server
+
+import (
+	"FinMa/internal/realtime"
+	"FinMa/types"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"golang.org/x/net/websocket"
+)
+
+// waitForSubscribers waits until the user has the expected number of
+// websocket subscriptions.
+func waitForSubscribers(t *testing.T, hub *realtime.Hub, userID uuid.UUID, expected int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for hub.Subscribers(userID) != expected {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d subscribers; got %d", expected, hub.Subscribers(userID))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWebSocketPushesEventsToEveryConnection(t *testing.T) {
+	userID := uuid.New()
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	s := &FiberServer{App: app, hub: realtime.NewHub(0)}
+	app.Get("/ws", func(c *fiber.Ctx) error {
+		c.Locals("user", types.User{ID: userID})
+		return c.Next()
+	}, s.WebSocket)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening. Err: %v", err)
+	}
+	go app.Listener(listener)
+	defer app.Shutdown()
+
+	url := "ws://" + listener.Addr().String() + "/ws"
+	phone, err := websocket.Dial(url, "", "http://localhost/")
+	if err != nil {
+		t.Fatalf("error dialing websocket. Err: %v", err)
+	}
+	laptop, err := websocket.Dial(url, "", "http://localhost/")
+	if err != nil {
+		t.Fatalf("error dialing websocket. Err: %v", err)
+	}
+	waitForSubscribers(t, s.hub, userID, 2)
+
+	transaction := &types.Transaction{ID: uuid.New(), UserID: userID, Amount: money(12.5), Type: "expense"}
+	s.publishTransactionEvents(nil, transaction)
+	s.publishTransactionEvents(transaction, transaction) // Updates are not pushed
+	s.hub.Publish(uuid.New(), realtime.Event{Type: "notification"})
+
+	for name, conn := range map[string]*websocket.Conn{"phone": phone, "laptop": laptop} {
+		var event struct {
+			Type string            `json:"type"`
+			Data types.Transaction `json:"data"`
+		}
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if err := websocket.JSON.Receive(conn, &event); err != nil {
+			t.Fatalf("error receiving event on %s. Err: %v", name, err)
+		}
+		if event.Type != "transaction.created" || event.Data.ID != transaction.ID {
+			t.Errorf("expected transaction.created for %s on %s; got %s for %s", transaction.ID, name, event.Type, event.Data.ID)
+		}
+	}
+
+	phone.Close()
+	waitForSubscribers(t, s.hub, userID, 1)
+	laptop.Close()
+	waitForSubscribers(t, s.hub, userID, 0)
+}
+
+func TestWebSocketRequiresHandshake(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: errorHandler})
+	s := &FiberServer{App: app, hub: realtime.NewHub(0)}
+	app.Get("/ws", func(c *fiber.Ctx) error {
+		c.Locals("user", types.User{ID: uuid.New()})
+		return c.Next()
+	}, s.WebSocket)
+
+	req, err := http.NewRequest("GET", "/ws", nil)
+	if err != nil {
+		t.Fatalf("error creating request. Err: %v", err)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusUpgradeRequired {
+		t.Errorf("expected status %d; got %d", fiber.StatusUpgradeRequired, resp.StatusCode)
+	}
+}
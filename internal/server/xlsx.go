@@ -0,0 +1,156 @@
+package server
+
+import (
+	"FinMa/internal/xlsx"
+	"FinMa/types"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// xlsxSheet is a sheet of a workbook: its rows, a slice of structs with the
+// columns of their CSV.
+type xlsxSheet struct {
+	Name string
+	Rows any
+}
+
+// xlsxColumns returns the columns of the CSV of the struct, typed after
+// their field: the times are dates with their time, or without it when
+// tagged xlsx:"date", the floats are numbers, or amounts when tagged
+// xlsx:"amount", the money is amounts, the integers are integers and the
+// booleans booleans. The other fields are text.
+func xlsxColumns(t reflect.Type) []xlsx.Column {
+	columns := csvColumns(t)
+	typed := make([]xlsx.Column, len(columns))
+	for i, column := range columns {
+		field := t.FieldByIndex(column.index)
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+
+		typed[i] = xlsx.Column{Name: column.name, Type: xlsx.Text}
+		switch {
+		case fieldType == reflect.TypeOf(time.Time{}):
+			typed[i].Type = xlsx.DateTime
+			if field.Tag.Get("xlsx") == "date" {
+				typed[i].Type = xlsx.Date
+			}
+		case fieldType == reflect.TypeOf(types.Money{}):
+			typed[i].Type = xlsx.Amount
+		case fieldType.Kind() == reflect.Float32 || fieldType.Kind() == reflect.Float64:
+			typed[i].Type = xlsx.Number
+			if field.Tag.Get("xlsx") == "amount" {
+				typed[i].Type = xlsx.Amount
+			}
+		case fieldType.Kind() >= reflect.Int && fieldType.Kind() <= reflect.Uint64:
+			typed[i].Type = xlsx.Integer
+		case fieldType.Kind() == reflect.Bool:
+			typed[i].Type = xlsx.Bool
+		}
+	}
+	return typed
+}
+
+// xlsxValue returns a field of a row as written in the workbook: nil for the
+// nil pointers, the numbers, booleans and times as is, the money as a float,
+// the rest as in the CSV, without the quote of the texts starting like a
+// formula as a workbook holds them as text.
+func xlsxValue(value reflect.Value) any {
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		return value.String()
+	case reflect.Float32, reflect.Float64:
+		return value.Float()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return value.Uint()
+	case reflect.Bool:
+		return value.Bool()
+	}
+	switch field := value.Interface().(type) {
+	case time.Time:
+		return field
+	case types.Money:
+		// Excel holds its numbers as floats
+		return field.Float64()
+	}
+	return csvValue(value)
+}
+
+// writeXLSX writes the sheets to the workbook and closes it. The rows are
+// written one by one, the workbook is never held uncompressed.
+func writeXLSX(w *xlsx.Writer, sheets []xlsxSheet) error {
+	for _, sheet := range sheets {
+		value := reflect.ValueOf(sheet.Rows)
+		if value.Kind() != reflect.Slice || value.Type().Elem().Kind() != reflect.Struct {
+			return fmt.Errorf("xlsx rows must be a slice of structs, got %T", sheet.Rows)
+		}
+
+		columns := csvColumns(value.Type().Elem())
+		if err := w.AddSheet(sheet.Name, xlsxColumns(value.Type().Elem())); err != nil {
+			return err
+		}
+		record := make([]any, len(columns))
+		for i := 0; i < value.Len(); i++ {
+			row := value.Index(i)
+			for j, column := range columns {
+				record[j] = xlsxValue(row.FieldByIndex(column.index))
+			}
+			if err := w.WriteRow(record...); err != nil {
+				return err
+			}
+		}
+	}
+	return w.Close()
+}
+
+// sendXLSX answers with the sheets as an XLSX workbook named after the
+// report, the amounts in the base currency of the user and the dates in the
+// user's timezone. The response varies with the Accept header, which may
+// have chosen the format.
+func (s *FiberServer) sendXLSX(c *fiber.Ctx, user types.User, name string, sheets ...xlsxSheet) error {
+	c.Vary(fiber.HeaderAccept)
+	c.Set(fiber.HeaderContentType, xlsx.ContentType)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s.xlsx"`, name))
+
+	w := xlsx.NewWriter(c.Response().BodyWriter(), xlsx.Options{
+		AmountFormat: s.localizer(user).AmountFormat(),
+		Location:     userLocation(user),
+	})
+	return writeXLSX(w, sheets)
+}
+
+// cachedSheetsReport answers like cachedReport, or with the sheets of the
+// report as an XLSX workbook when the request asks for it. The CSV holds
+// the rows of the first sheet. The workbook is computed on every request.
+func cachedSheetsReport[T any](s *FiberServer, c *fiber.Ctx, user types.User, name string, parts []string, compute func() (T, error), sheets func(T) []xlsxSheet) error {
+	format, err := responseFormat(c, formatJSON, formatCSV, formatXLSX)
+	if err != nil {
+		return err
+	}
+	if format == formatXLSX {
+		s.fetchMissingRates(c, user)
+		report, err := compute()
+		if err != nil {
+			return err
+		}
+		return s.sendXLSX(c, user, strings.ReplaceAll(name, "_", "-"), sheets(report)...)
+	}
+
+	return cachedReport(s, c, name, parts, compute, func(report T) any {
+		return sheets(report)[0].Rows
+	})
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"FinMa/internal/xlsx"
+	"FinMa/types"
+)
+
+func TestXLSXColumns(t *testing.T) {
+	type row struct {
+		Name    string      `csv:"name"`
+		Amount  float64     `csv:"amount" xlsx:"amount"`
+		Rate    float64     `csv:"rate"`
+		Balance types.Money `csv:"balance"`
+		Count   int         `csv:"count"`
+		Done    bool        `csv:"done"`
+		Due     *time.Time  `csv:"due" xlsx:"date"`
+		Created time.Time   `csv:"created"`
+		Ignored string
+	}
+
+	expected := []xlsx.Column{
+		{Name: "name", Type: xlsx.Text},
+		{Name: "amount", Type: xlsx.Amount},
+		{Name: "rate", Type: xlsx.Number},
+		{Name: "balance", Type: xlsx.Amount},
+		{Name: "count", Type: xlsx.Integer},
+		{Name: "done", Type: xlsx.Bool},
+		{Name: "due", Type: xlsx.Date},
+		{Name: "created", Type: xlsx.DateTime},
+	}
+	if columns := xlsxColumns(reflect.TypeOf(row{})); !reflect.DeepEqual(columns, expected) {
+		t.Errorf("expected %+v; got %+v", expected, columns)
+	}
+	if value := xlsxValue(reflect.ValueOf(money(-12.5))); value != -12.5 {
+		t.Errorf("expected the money as a number; got %v", value)
+	}
+}
+
+func TestWriteXLSX(t *testing.T) {
+	type row struct {
+		Name   string   `csv:"name"`
+		Amount *float64 `csv:"amount" xlsx:"amount"`
+	}
+	amount := 12.5
+
+	var out bytes.Buffer
+	err := writeXLSX(xlsx.NewWriter(&out, xlsx.Options{}), []xlsxSheet{
+		{"Rows", []row{{Name: "=1+1", Amount: &amount}, {Name: "none"}}},
+		{"Empty", []row(nil)},
+	})
+	if err != nil {
+		t.Fatalf("error writing the workbook. Err: %v", err)
+	}
+
+	sheet := readXLSXPart(t, out.Bytes(), "xl/worksheets/sheet1.xml")
+	for _, cell := range []string{
+		`<c r="A2" t="inlineStr"><is><t xml:space="preserve">=1+1</t></is></c>`,
+		`<c r="B2" s="4"><v>12.5</v></c>`,
+		`<row r="3"><c r="A3" t="inlineStr"><is><t xml:space="preserve">none</t></is></c></row>`,
+	} {
+		if !strings.Contains(sheet, cell) {
+			t.Errorf("expected %s in the sheet; got %s", cell, sheet)
+		}
+	}
+	if workbook := readXLSXPart(t, out.Bytes(), "xl/workbook.xml"); !strings.Contains(workbook, `name="Empty"`) {
+		t.Errorf("expected the empty sheet; got %s", workbook)
+	}
+
+	if err := writeXLSX(xlsx.NewWriter(io.Discard, xlsx.Options{}), []xlsxSheet{{"Rows", row{}}}); err == nil {
+		t.Error("expected an error for rows that are not a slice")
+	}
+}
+
+func TestTransactionsXLSX(t *testing.T) {
+	s, _ := newFieldsetsTestServer(3)
+
+	req, err := http.NewRequest("GET", "/transactions?format=xlsx&limit=1", nil)
+	if err != nil {
+		t.Fatalf("error creating request. Err: %v", err)
+	}
+	resp, err := s.Test(req)
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusOK || resp.Header.Get("Content-Type") != xlsx.ContentType {
+		t.Fatalf("expected a workbook; got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if disposition := resp.Header.Get("Content-Disposition"); disposition != `attachment; filename="transactions.xlsx"` {
+		t.Errorf("expected the transactions.xlsx attachment; got %s", disposition)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	sheet := readXLSXPart(t, body, "xl/worksheets/sheet1.xml")
+	// Not paginated, the header and 3 rows
+	if rows := strings.Count(sheet, "<row "); rows != 4 {
+		t.Errorf("expected 4 rows; got %d", rows)
+	}
+}
+
+// readXLSXPart returns a part of the workbook.
+func readXLSXPart(t *testing.T, workbook []byte, name string) string {
+	t.Helper()
+	archive, err := zip.NewReader(bytes.NewReader(workbook), int64(len(workbook)))
+	if err != nil {
+		t.Fatalf("expected a zip archive. Err: %v", err)
+	}
+	f, err := archive.Open(name)
+	if err != nil {
+		t.Fatalf("expected the part %s. Err: %v", name, err)
+	}
+	defer f.Close()
+	content, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
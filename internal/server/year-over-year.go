@@ -0,0 +1,232 @@
+package server
+
+import (
+	"FinMa/types"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+)
+
+// yearOverYearMaxYears bounds the years compared at once.
+const yearOverYearMaxYears = 5
+
+// metricValue returns the value of the metric of the report in a bucket, in
+// unbound minor units.
+func metricValue(bucket types.CashFlowBucket, metric string) int64 {
+	switch metric {
+	case "income":
+		return bucket.Income.Unbound().Minor
+	case "net":
+		return bucket.Income.Unbound().Minor - bucket.Expenses.Unbound().Minor
+	}
+	return bucket.Expenses.Unbound().Minor
+}
+
+// percentChange returns the change from previous to current in percent, nil
+// when either is unknown or previous is zero. A negative previous value, a
+// net loss, changes by its magnitude.
+func percentChange(previous, current *types.Money) *float64 {
+	if previous == nil || current == nil || previous.IsZero() {
+		return nil
+	}
+	from, to := previous.Unbound().Minor, current.Unbound().Minor
+	change := math.Round(float64(to-from)/math.Abs(float64(from))*10000) / 100
+	return &change
+}
+
+// monthKey numbers the months so that they compare in order.
+func monthKey(year int, month time.Month) int {
+	return year*12 + int(month) - 1
+}
+
+// buildYearOverYear sets the months and the year to date of the report from
+// the monthly totals of its years, dated on the local first of the month.
+// The months before the month of the first transaction are not covered by
+// the history, nor the months from the current one on, unless
+// includeCurrent; their values are null.
+func buildYearOverYear(report *types.YearOverYear, totals []types.CashFlowBucket, first *time.Time, now time.Time) {
+	byMonth := make(map[int]int64, len(totals))
+	for _, bucket := range totals {
+		byMonth[monthKey(bucket.Start.Year(), bucket.Start.Month())] = metricValue(bucket, report.Metric)
+	}
+
+	coveredFrom := monthKey(now.Year(), now.Month())
+	if first != nil {
+		coveredFrom = monthKey(first.Year(), first.Month())
+	}
+	coveredUntil := monthKey(now.Year(), now.Month())
+	if report.IncludesCurrent {
+		coveredUntil++
+	}
+	value := func(year int, month time.Month) *types.Money {
+		key := monthKey(year, month)
+		if key < coveredFrom || key >= coveredUntil {
+			return nil
+		}
+		total := types.NewMoney(byMonth[key], "")
+		return &total
+	}
+
+	report.ComparedMonths = 12
+	for _, year := range report.Years {
+		if year == now.Year() {
+			report.ComparedMonths = coveredUntil - monthKey(year, time.January)
+		}
+	}
+
+	report.Months = make([]types.YearOverYearMonth, 12)
+	report.YearToDate = types.YearOverYearMonth{Values: map[string]*types.Money{}, Changes: map[string]*float64{}}
+	for i := range report.Months {
+		month := time.Month(i + 1)
+		report.Months[i] = types.YearOverYearMonth{Month: i + 1, Values: map[string]*types.Money{}, Changes: map[string]*float64{}}
+		for _, year := range report.Years {
+			report.Months[i].Values[strconv.Itoa(year)] = value(year, month)
+		}
+	}
+
+	for _, year := range report.Years {
+		// The year to date is unknown unless the history covers every month
+		var sum *types.Money
+		for month := time.January; int(month) <= report.ComparedMonths; month++ {
+			v := value(year, month)
+			if v == nil {
+				sum = nil
+				break
+			}
+			if sum == nil {
+				sum = new(types.Money)
+			}
+			*sum = types.NewMoney(sum.Minor+v.Minor, "")
+		}
+		report.YearToDate.Values[strconv.Itoa(year)] = sum
+	}
+
+	for i := 1; i < len(report.Years); i++ {
+		previous, year := strconv.Itoa(report.Years[i-1]), strconv.Itoa(report.Years[i])
+		for _, month := range report.Months {
+			month.Changes[year] = percentChange(month.Values[previous], month.Values[year])
+		}
+		report.YearToDate.Changes[year] = percentChange(report.YearToDate.Values[previous], report.YearToDate.Values[year])
+	}
+}
+
+// parseYears reads the comma separated years of the report, oldest first,
+// the previous and the current year by default.
+func parseYears(value string, now time.Time) ([]int, error) {
+	if value == "" {
+		return []int{now.Year() - 1, now.Year()}, nil
+	}
+
+	seen := map[int]bool{}
+	years := []int{}
+	for _, part := range strings.Split(value, ",") {
+		year, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || year < 1970 || year > now.Year() {
+			return nil, NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "years must be comma separated years up to the current one").
+				WithDetails(FieldError{Field: "years", Message: "invalid year", Value: part})
+		}
+		if !seen[year] {
+			seen[year] = true
+			years = append(years, year)
+		}
+	}
+	if len(years) > yearOverYearMaxYears {
+		return nil, NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "At most 5 years may be compared")
+	}
+	sort.Ints(years)
+	return years, nil
+}
+
+// yearOverYearRow is the value of a month of a year in CSV, the month is
+// "ytd" for the year to date.
+type yearOverYearRow struct {
+	Year   int          `csv:"year"`
+	Month  string       `csv:"month"`
+	Value  *types.Money `csv:"value"`
+	Change *float64     `csv:"change"`
+}
+
+// yearOverYearRows returns a row per year and month, then the years to date.
+func yearOverYearRows(report types.YearOverYear) any {
+	rows := []yearOverYearRow{}
+	for _, year := range report.Years {
+		key := strconv.Itoa(year)
+		for _, month := range report.Months {
+			rows = append(rows, yearOverYearRow{Year: year, Month: strconv.Itoa(month.Month), Value: month.Values[key], Change: month.Changes[key]})
+		}
+		rows = append(rows, yearOverYearRow{Year: year, Month: "ytd", Value: report.YearToDate.Values[key], Change: report.YearToDate.Changes[key]})
+	}
+	return rows
+}
+
+// GetYearOverYear compares the ?metric=expenses (default), income or net of
+// ?years=2023,2024 (the previous and the current year by default) month by
+// month, side by side, with the change in percent from one year to the
+// next, and over the year to date. In the current year only the completed
+// months are compared, unless ?include_current=true. The months the history
+// does not cover are null rather than zero. ?category= restricts it to one
+// category. The transfers and the transactions excluded from the budgets
+// are left out.
+func (s *FiberServer) GetYearOverYear(c *fiber.Ctx) error {
+	db := s.dbFor(c)
+
+	user := c.Locals("user").(types.User)
+	location := userLocation(user)
+	now := time.Now().In(location)
+
+	metric := c.Query("metric", "expenses")
+	if metric != "expenses" && metric != "income" && metric != "net" {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "metric must be expenses, income or net")
+	}
+	years, err := parseYears(c.Query("years"), now)
+	if err != nil {
+		return err
+	}
+	filter := types.ReportFilter{Category: c.Query("category")}
+	if filter.Category != "" && !isValidCategory(filter.Category) {
+		return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid transaction category")
+	}
+	includeCurrent := c.QueryBool("include_current")
+
+	yearsKey := make([]string, len(years))
+	for i, year := range years {
+		yearsKey[i] = strconv.Itoa(year)
+	}
+	// The completed months move with the month
+	key := []string{metric, strings.Join(yearsKey, ","), filter.Category, strconv.FormatBool(includeCurrent), now.Format("2006-01")}
+	return cachedReport(s, c, "year_over_year", key, func() (types.YearOverYear, error) {
+		report := types.YearOverYear{
+			Metric:          metric,
+			Category:        filter.Category,
+			Years:           years,
+			Timezone:        userTimezone(user),
+			Currency:        s.baseCurrency(user),
+			IncludesCurrent: includeCurrent,
+		}
+
+		from := time.Date(years[0], time.January, 1, 0, 0, 0, 0, location)
+		to := time.Date(years[len(years)-1]+1, time.January, 1, 0, 0, 0, 0, location)
+		totals, err := db.GetCashFlow(&user, from, to, "month", report.Timezone, filter)
+		if err != nil {
+			log.Error(err)
+			return report, NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not compute the year over year report")
+		}
+		first, err := db.GetFirstTransactionDate(&user)
+		if err != nil {
+			log.Error(err)
+			return report, NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Could not compute the year over year report")
+		}
+		if first != nil {
+			local := first.In(location)
+			first = &local
+		}
+
+		buildYearOverYear(&report, totals, first, now)
+		return report, nil
+	}, yearOverYearRows)
+}
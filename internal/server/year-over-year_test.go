@@ -0,0 +1,79 @@
+package server
+
+import (
+	"FinMa/types"
+	"testing"
+	"time"
+)
+
+func TestBuildYearOverYear(t *testing.T) {
+	// The history starts in February 2023, the report runs in April 2024
+	first := time.Date(2023, time.February, 12, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2024, time.April, 20, 0, 0, 0, 0, time.UTC)
+	totals := []types.CashFlowBucket{
+		{Start: time.Date(2023, time.February, 1, 0, 0, 0, 0, time.UTC), Expenses: money(400)},
+		{Start: time.Date(2023, time.March, 1, 0, 0, 0, 0, time.UTC), Expenses: money(500)},
+		{Start: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC), Expenses: money(300)},
+		{Start: time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC), Expenses: money(500)},
+		{Start: time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC), Expenses: money(450)},
+		{Start: time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC), Expenses: money(80)},
+	}
+
+	report := types.YearOverYear{Metric: "expenses", Years: []int{2023, 2024}}
+	buildYearOverYear(&report, totals, &first, now)
+
+	// January 2023 is before the history, April 2024 still in progress
+	if v := report.Months[0].Values["2023"]; v != nil {
+		t.Errorf("expected no data before the history; got %v", *v)
+	}
+	if v := report.Months[3].Values["2024"]; v != nil {
+		t.Errorf("expected the month in progress to be left out; got %v", *v)
+	}
+	// Covered months without spending are zero
+	if v := report.Months[3].Values["2023"]; v == nil || *v != money(0) {
+		t.Errorf("expected no spending in April 2023; got %v", v)
+	}
+	if change := report.Months[1].Changes["2024"]; change == nil || *change != 25 {
+		t.Errorf("expected February up 25%%; got %v", change)
+	}
+	if change := report.Months[2].Changes["2024"]; change == nil || *change != -10 {
+		t.Errorf("expected March down 10%%; got %v", change)
+	}
+
+	// The year to date compares January to March, which 2023 does not cover
+	if report.ComparedMonths != 3 {
+		t.Errorf("expected 3 compared months; got %d", report.ComparedMonths)
+	}
+	if v := report.YearToDate.Values["2024"]; v == nil || *v != money(1250) {
+		t.Errorf("expected 1250 spent in 2024; got %v", v)
+	}
+	if report.YearToDate.Values["2023"] != nil || report.YearToDate.Changes["2024"] != nil {
+		t.Errorf("expected no year to date for 2023; got %v", report.YearToDate)
+	}
+
+	// With the month in progress
+	report = types.YearOverYear{Metric: "net", Years: []int{2023, 2024}, IncludesCurrent: true}
+	buildYearOverYear(&report, totals, &first, now)
+	if v := report.Months[3].Values["2024"]; v == nil || *v != money(-80) || report.ComparedMonths != 4 {
+		t.Errorf("expected the net of April; got %v over %d months", v, report.ComparedMonths)
+	}
+	if change := report.Months[3].Changes["2024"]; change != nil {
+		t.Errorf("expected no change from zero; got %v", *change)
+	}
+}
+
+func TestParseYears(t *testing.T) {
+	now := time.Date(2024, time.April, 20, 0, 0, 0, 0, time.UTC)
+
+	if years, err := parseYears("", now); err != nil || len(years) != 2 || years[0] != 2023 {
+		t.Errorf("expected the previous and the current year; got %v, %v", years, err)
+	}
+	if years, err := parseYears("2024, 2022,2024", now); err != nil || len(years) != 2 || years[0] != 2022 || years[1] != 2024 {
+		t.Errorf("expected the years sorted and deduplicated; got %v, %v", years, err)
+	}
+	for _, value := range []string{"2025", "twenty", "2018,2019,2020,2021,2022,2023"} {
+		if _, err := parseYears(value, now); err == nil {
+			t.Errorf("expected %q to be refused", value)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalObjects(t *testing.T) {
+	local, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatalf("error creating the storage. Err: %v", err)
+	}
+	ctx := context.Background()
+
+	if err := local.Put(ctx, "attachments/1/receipt.pdf", strings.NewReader("receipt"), 7, "application/pdf"); err != nil {
+		t.Fatalf("error storing the object. Err: %v", err)
+	}
+	r, object, err := local.Get(ctx, "attachments/1/receipt.pdf")
+	if err != nil {
+		t.Fatalf("error reading the object. Err: %v", err)
+	}
+	body, _ := io.ReadAll(r)
+	r.Close()
+	if string(body) != "receipt" || object.Size != 7 || object.ContentType != "application/pdf" {
+		t.Errorf("expected the stored object; got %q, %+v", body, object)
+	}
+
+	if _, err := local.SignedURL(ctx, "attachments/1/receipt.pdf", time.Minute); !errors.Is(err, ErrSignedURLUnsupported) {
+		t.Errorf("expected ErrSignedURLUnsupported; got %v", err)
+	}
+
+	if err := local.Delete(ctx, "attachments/1/receipt.pdf"); err != nil {
+		t.Fatalf("error deleting the object. Err: %v", err)
+	}
+	if err := local.Delete(ctx, "attachments/1/receipt.pdf"); err != nil {
+		t.Errorf("expected deleting a missing object to succeed; got %v", err)
+	}
+	if _, _, err := local.Get(ctx, "attachments/1/receipt.pdf"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound; got %v", err)
+	}
+}
+
+func TestLocalTruncatedUpload(t *testing.T) {
+	dir := t.TempDir()
+	local, err := NewLocal(dir)
+	if err != nil {
+		t.Fatalf("error creating the storage. Err: %v", err)
+	}
+
+	if err := local.Put(context.Background(), "receipt.pdf", strings.NewReader("rec"), 7, ""); err == nil {
+		t.Errorf("expected a short upload to fail")
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("expected no file left; got %d", len(entries))
+	}
+}
+
+func TestInvalidKeys(t *testing.T) {
+	dir := t.TempDir()
+	local, err := NewLocal(filepath.Join(dir, "storage"))
+	if err != nil {
+		t.Fatalf("error creating the storage. Err: %v", err)
+	}
+
+	for _, key := range []string{"", "/etc/passwd", "../secret", "attachments/../../secret", "attachments//receipt.pdf"} {
+		if err := local.Put(context.Background(), key, strings.NewReader("x"), 1, ""); err == nil {
+			t.Errorf("expected the key %q to be refused", key)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "secret")); err == nil {
+		t.Errorf("expected nothing written outside of the storage")
+	}
+}
+
+func TestCopy(t *testing.T) {
+	ctx := context.Background()
+	src, _ := NewLocal(t.TempDir())
+	dst, bucket := newFakeBucket(t)
+
+	for _, key := range []string{"attachments/1/receipt.pdf", "attachments/2/invoice.png"} {
+		if err := src.Put(ctx, key, strings.NewReader(key), int64(len(key)), ""); err != nil {
+			t.Fatalf("error storing the object. Err: %v", err)
+		}
+	}
+
+	copied, err := Copy(ctx, src, dst)
+	if err != nil {
+		t.Fatalf("error copying the objects. Err: %v", err)
+	}
+	if copied != 2 || len(bucket.objects) != 2 {
+		t.Errorf("expected 2 objects copied; got %d, %d in the bucket", copied, len(bucket.objects))
+	}
+	if bucket.types["attachments/2/invoice.png"] != "image/png" {
+		t.Errorf("expected the content type to be kept; got %q", bucket.types["attachments/2/invoice.png"])
+	}
+}
@@ -0,0 +1,117 @@
+//go:build integration
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// startMinIO starts a MinIO container and returns the storage of a new
+// bucket in it. Run with: go test -tags integration ./internal/storage
+func startMinIO(t *testing.T) *S3 {
+	ctx := context.Background()
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        "minio/minio:latest",
+			Cmd:          []string{"server", "/data"},
+			ExposedPorts: []string{"9000/tcp"},
+			Env: map[string]string{
+				"MINIO_ROOT_USER":     "finma",
+				"MINIO_ROOT_PASSWORD": "finma-secret",
+			},
+			WaitingFor: wait.ForHTTP("/minio/health/live").WithPort("9000").WithStartupTimeout(30 * time.Second),
+		},
+		Started: true,
+	})
+	if err != nil {
+		t.Fatalf("could not start minio container: %v", err)
+	}
+	t.Cleanup(func() { container.Terminate(ctx) })
+
+	endpoint, err := container.PortEndpoint(ctx, "9000/tcp", "http")
+	if err != nil {
+		t.Fatalf("could not get the minio endpoint: %v", err)
+	}
+	s, err := NewS3(S3Config{
+		Endpoint:        endpoint,
+		Bucket:          "finma",
+		AccessKeyID:     "finma",
+		SecretAccessKey: "finma-secret",
+		PathStyle:       true,
+	})
+	if err != nil {
+		t.Fatalf("error creating the storage. Err: %v", err)
+	}
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPut, endpoint+"/finma", nil)
+	resp, err := s.do(req)
+	if err != nil {
+		t.Fatalf("could not create the bucket: %v", err)
+	}
+	resp.Body.Close()
+	return s
+}
+
+func TestMinIOObjects(t *testing.T) {
+	s := startMinIO(t)
+	ctx := context.Background()
+
+	content := bytes.Repeat([]byte("receipt "), 1<<17)
+	if err := s.Put(ctx, "attachments/1/receipt 01.pdf", bytes.NewReader(content), int64(len(content)), "application/pdf"); err != nil {
+		t.Fatalf("error storing the object. Err: %v", err)
+	}
+
+	r, object, err := s.Get(ctx, "attachments/1/receipt 01.pdf")
+	if err != nil {
+		t.Fatalf("error reading the object. Err: %v", err)
+	}
+	body, _ := io.ReadAll(r)
+	r.Close()
+	if !bytes.Equal(body, content) || object.ContentType != "application/pdf" {
+		t.Errorf("expected the stored object; got %d bytes, %+v", len(body), object)
+	}
+
+	signed, err := s.SignedURL(ctx, "attachments/1/receipt 01.pdf", time.Minute)
+	if err != nil {
+		t.Fatalf("error signing the URL. Err: %v", err)
+	}
+	resp, err := http.Get(signed)
+	if err != nil {
+		t.Fatalf("error downloading the signed URL. Err: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.ContentLength != int64(len(content)) {
+		t.Errorf("expected the signed URL to download the object; got %s", resp.Status)
+	}
+
+	if err := s.Delete(ctx, "attachments/1/receipt 01.pdf"); err != nil {
+		t.Fatalf("error deleting the object. Err: %v", err)
+	}
+	if _, _, err := s.Get(ctx, "attachments/1/receipt 01.pdf"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound; got %v", err)
+	}
+}
+
+func TestMinIOCopy(t *testing.T) {
+	s := startMinIO(t)
+	ctx := context.Background()
+	local, _ := NewLocal(t.TempDir())
+	local.Put(ctx, "attachments/1/receipt.pdf", strings.NewReader("receipt"), 7, "")
+
+	if copied, err := Copy(ctx, local, s); err != nil || copied != 1 {
+		t.Fatalf("expected 1 object copied; got %d, %v", copied, err)
+	}
+	if _, _, err := s.Get(ctx, "attachments/1/receipt.pdf"); err != nil {
+		t.Errorf("expected the object in the bucket; got %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+// Package storage keeps the files uploaded by the users, such as the
+// attachments, on the local disk or in an S3 compatible bucket shared by
+// every instance of the server.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when no object is stored under the key.
+	ErrNotFound = errors.New("object not found")
+	// ErrSignedURLUnsupported is returned by the storages whose objects
+	// can only be downloaded through the API.
+	ErrSignedURLUnsupported = errors.New("signed URLs are not supported")
+)
+
+// Object describes a stored object.
+type Object struct {
+	Size        int64
+	ContentType string
+}
+
+// Storage stores objects under keys like "attachments/<id>/receipt.pdf".
+// The contents are streamed, never buffered whole.
+type Storage interface {
+	// Put stores the size bytes read from r under the key, replacing the
+	// object stored under it.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens the object, the caller closes it. It returns ErrNotFound
+	// when the key is unknown.
+	Get(ctx context.Context, key string) (io.ReadCloser, Object, error)
+	// Delete removes the object, a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+	// SignedURL returns a URL downloading the object without going through
+	// the API, valid for expiry, or ErrSignedURLUnsupported.
+	SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
+
+// validateKey refuses the keys escaping the storage root: absolute, empty
+// segments or "..".
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return fmt.Errorf("invalid key %q", key)
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." || strings.Contains(segment, "\\") {
+			return fmt.Errorf("invalid key %q", key)
+		}
+	}
+	return nil
+}
+
+// Copy copies every object of the local storage to dst, for the switch to
+// a bucket. The objects already in dst are replaced, so an interrupted copy
+// can be run again. It returns the number of objects copied.
+func Copy(ctx context.Context, src *Local, dst Storage) (int, error) {
+	copied := 0
+	err := src.Walk(ctx, func(key string) error {
+		r, object, err := src.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		if err := dst.Put(ctx, key, r, object.Size, object.ContentType); err != nil {
+			return fmt.Errorf("copying %s: %w", key, err)
+		}
+		copied++
+		return nil
+	})
+	return copied, err
+}
@@ -0,0 +1,95 @@
+package webpush
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrSubscriptionGone is returned when the push service no longer knows the
+// subscription (404 or 410), it must be deleted.
+var ErrSubscriptionGone = errors.New("push subscription expired or unsubscribed")
+
+// Subscription is the PushSubscription of a browser, its keys base64url encoded.
+type Subscription struct {
+	Endpoint string
+	P256dh   string
+	Auth     string
+}
+
+// Client sends push messages signed with the VAPID keys of the application.
+type Client struct {
+	keys *VAPIDKeys
+	// subject is the contact of the application, a mailto: or https: URL
+	subject string
+	http    *http.Client
+}
+
+func NewClient(keys *VAPIDKeys, subject string) *Client {
+	return &Client{keys: keys, subject: subject, http: &http.Client{Timeout: 15 * time.Second}}
+}
+
+// Send encrypts the payload for the subscription and posts it to its push
+// service. ttl is how long the push service keeps the message for an
+// offline browser.
+func (c *Client) Send(ctx context.Context, subscription Subscription, payload []byte, ttl time.Duration) error {
+	uaPublic, err := decodeKey(subscription.P256dh)
+	if err != nil {
+		return fmt.Errorf("invalid subscription p256dh key: %w", err)
+	}
+	authSecret, err := decodeKey(subscription.Auth)
+	if err != nil {
+		return fmt.Errorf("invalid subscription auth secret: %w", err)
+	}
+
+	body, err := encrypt(payload, uaPublic, authSecret)
+	if err != nil {
+		return err
+	}
+	authorization, err := c.keys.authorization(subscription.Endpoint, c.subject, time.Now())
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", strconv.Itoa(int(ttl.Seconds())))
+	req.Header.Set("Urgency", "normal")
+	req.Header.Set("Authorization", authorization)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrSubscriptionGone
+	case resp.StatusCode >= 300:
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("push service returned %d: %s", resp.StatusCode, message)
+	}
+	return nil
+}
+
+// decodeKey accepts the keys of a subscription with or without padding, in
+// the base64url or standard alphabet.
+func decodeKey(key string) ([]byte, error) {
+	for _, encoding := range []*base64.Encoding{base64.RawURLEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.StdEncoding} {
+		if decoded, err := encoding.DecodeString(key); err == nil {
+			return decoded, nil
+		}
+	}
+	return nil, errors.New("invalid base64 key")
+}
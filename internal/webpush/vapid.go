@@ -0,0 +1,99 @@
+package webpush
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"time"
+)
+
+// vapidExpiration is the lifetime of the VAPID tokens, the push services
+// refuse tokens valid for more than 24 hours.
+const vapidExpiration = 12 * time.Hour
+
+// VAPIDKeys identify the application to the push services (RFC 8292).
+// Browsers are given the public key when subscribing.
+type VAPIDKeys struct {
+	private *ecdsa.PrivateKey
+	// Public is the uncompressed P-256 public key, base64url encoded
+	Public string
+}
+
+// ParseVAPIDKeys reads a keypair in the base64url format used by the
+// web-push tools: the 32 bytes private scalar and the 65 bytes public point.
+func ParseVAPIDKeys(public, private string) (*VAPIDKeys, error) {
+	scalar, err := base64.RawURLEncoding.DecodeString(private)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+	ecdhKey, err := ecdh.P256().NewPrivateKey(scalar)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+	if base64.RawURLEncoding.EncodeToString(ecdhKey.PublicKey().Bytes()) != public {
+		return nil, errors.New("VAPID public key does not match the private key")
+	}
+
+	point := ecdhKey.PublicKey().Bytes()
+	key := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(point[1:33]),
+			Y:     new(big.Int).SetBytes(point[33:]),
+		},
+		D: new(big.Int).SetBytes(scalar),
+	}
+	return &VAPIDKeys{private: key, Public: public}, nil
+}
+
+// GenerateVAPIDKeys creates a new keypair and returns it in the format read
+// by ParseVAPIDKeys.
+func GenerateVAPIDKeys() (public, private string, err error) {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()),
+		base64.RawURLEncoding.EncodeToString(key.Bytes()), nil
+}
+
+// authorization returns the Authorization header of a request to endpoint:
+// an ES256 JWT for the origin of the endpoint and the public key.
+func (k *VAPIDKeys) authorization(endpoint, subject string, now time.Time) (string, error) {
+	target, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	header, _ := json.Marshal(map[string]string{"typ": "JWT", "alg": "ES256"})
+	claims, err := json.Marshal(map[string]any{
+		"aud": target.Scheme + "://" + target.Host,
+		"exp": now.Add(vapidExpiration).Unix(),
+		"sub": subject,
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, k.private, digest[:])
+	if err != nil {
+		return "", err
+	}
+	// JWS signatures are the fixed size concatenation of r and s
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+
+	token := unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)
+	return "vapid t=" + token + ", k=" + k.Public, nil
+}
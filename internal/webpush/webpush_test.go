@@ -0,0 +1,152 @@
+package webpush
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// decrypt reverses encrypt from the browser side, as in RFC 8291 section 3.
+func decrypt(t *testing.T, body []byte, uaPrivate *ecdh.PrivateKey, authSecret []byte) []byte {
+	t.Helper()
+	salt := body[:16]
+	if rs := binary.BigEndian.Uint32(body[16:20]); rs != recordSize {
+		t.Fatalf("expected record size %d; got %d", recordSize, rs)
+	}
+	idLen := int(body[20])
+	asPublic := body[21 : 21+idLen]
+
+	asKey, err := ecdh.P256().NewPublicKey(asPublic)
+	if err != nil {
+		t.Fatalf("invalid application server key: %v", err)
+	}
+	ecdhSecret, err := uaPrivate.ECDH(asKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyInfo := append(append([]byte("WebPush: info\x00"), uaPrivate.PublicKey().Bytes()...), asPublic...)
+	ikm, _ := expand(ecdhSecret, authSecret, keyInfo, 32)
+	cek, _ := expand(ikm, salt, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce, _ := expand(ikm, salt, []byte("Content-Encoding: nonce\x00"), 12)
+
+	block, _ := aes.NewCipher(cek)
+	gcm, _ := cipher.NewGCM(block)
+	plaintext, err := gcm.Open(nil, nonce, body[21+idLen:], nil)
+	if err != nil {
+		t.Fatalf("failed to decrypt: %v", err)
+	}
+	if plaintext[len(plaintext)-1] != 0x02 {
+		t.Fatalf("expected the last record delimiter; got %x", plaintext[len(plaintext)-1])
+	}
+	return plaintext[:len(plaintext)-1]
+}
+
+func newSubscriber(t *testing.T) (*ecdh.PrivateKey, []byte) {
+	t.Helper()
+	uaPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authSecret := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, authSecret); err != nil {
+		t.Fatal(err)
+	}
+	return uaPrivate, authSecret
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	uaPrivate, authSecret := newSubscriber(t)
+	payload := []byte(`{"title":"Budget exceeded","body":"Groceries","url":"/budgets/1"}`)
+
+	body, err := encrypt(payload, uaPrivate.PublicKey().Bytes(), authSecret)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := decrypt(t, body, uaPrivate, authSecret); !bytes.Equal(got, payload) {
+		t.Errorf("expected %q; got %q", payload, got)
+	}
+
+	if _, err := encrypt(make([]byte, MaxPayloadSize+1), uaPrivate.PublicKey().Bytes(), authSecret); !errors.Is(err, ErrPayloadTooLarge) {
+		t.Errorf("expected ErrPayloadTooLarge; got %v", err)
+	}
+}
+
+func TestParseVAPIDKeys(t *testing.T) {
+	public, private, err := GenerateVAPIDKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseVAPIDKeys(public, private); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	otherPublic, _, _ := GenerateVAPIDKeys()
+	if _, err := ParseVAPIDKeys(otherPublic, private); err == nil {
+		t.Error("expected an error for mismatched keys")
+	}
+}
+
+func TestClientSend(t *testing.T) {
+	public, private, _ := GenerateVAPIDKeys()
+	keys, err := ParseVAPIDKeys(public, private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uaPrivate, authSecret := newSubscriber(t)
+	payload := []byte(`{"title":"Hello"}`)
+
+	tests := []struct {
+		name     string
+		status   int
+		expected error
+	}{
+		{"delivered", http.StatusCreated, nil},
+		{"not found", http.StatusNotFound, ErrSubscriptionGone},
+		{"gone", http.StatusGone, ErrSubscriptionGone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Content-Encoding") != "aes128gcm" {
+					t.Errorf("expected aes128gcm encoding; got %q", r.Header.Get("Content-Encoding"))
+				}
+				if r.Header.Get("TTL") != "3600" {
+					t.Errorf("expected TTL 3600; got %q", r.Header.Get("TTL"))
+				}
+				if !strings.HasPrefix(r.Header.Get("Authorization"), "vapid t=") || !strings.HasSuffix(r.Header.Get("Authorization"), ", k="+public) {
+					t.Errorf("expected a VAPID authorization; got %q", r.Header.Get("Authorization"))
+				}
+				body, _ := io.ReadAll(r.Body)
+				if got := decrypt(t, body, uaPrivate, authSecret); !bytes.Equal(got, payload) {
+					t.Errorf("expected %q; got %q", payload, got)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			client := NewClient(keys, "mailto:admin@example.com")
+			subscription := Subscription{
+				Endpoint: server.URL + "/push/abc",
+				P256dh:   base64.RawURLEncoding.EncodeToString(uaPrivate.PublicKey().Bytes()),
+				Auth:     base64.URLEncoding.EncodeToString(authSecret),
+			}
+			err := client.Send(context.Background(), subscription, payload, time.Hour)
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("expected %v; got %v", tt.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package xlsx
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	xmlHeader              = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+	mainNamespace          = "http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+	relationshipsNamespace = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+	packageRelationships   = "http://schemas.openxmlformats.org/package/2006/relationships"
+)
+
+// rootRelationships points the package to the workbook.
+const rootRelationships = xmlHeader +
+	`<Relationships xmlns="` + packageRelationships + `">` +
+	`<Relationship Id="rId1" Type="` + relationshipsNamespace + `/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+// contentTypes returns the media types of the parts of the workbook.
+func (w *Writer) contentTypes() string {
+	var b strings.Builder
+	b.WriteString(xmlHeader)
+	b.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	b.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	b.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	b.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	for i := range w.sheets {
+		fmt.Fprintf(&b, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1)
+	}
+	b.WriteString(`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	b.WriteString(`</Types>`)
+	return b.String()
+}
+
+// workbook returns the list of the sheets, in their order.
+func (w *Writer) workbook() string {
+	var b strings.Builder
+	b.WriteString(xmlHeader)
+	b.WriteString(`<workbook xmlns="` + mainNamespace + `" xmlns:r="` + relationshipsNamespace + `"><sheets>`)
+	for i, name := range w.sheets {
+		fmt.Fprintf(&b, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, escape(name), i+1, i+1)
+	}
+	b.WriteString(`</sheets></workbook>`)
+	return b.String()
+}
+
+// workbookRelationships points the workbook to its sheets and its styles,
+// the sheet i is rIdi.
+func (w *Writer) workbookRelationships() string {
+	var b strings.Builder
+	b.WriteString(xmlHeader)
+	b.WriteString(`<Relationships xmlns="` + packageRelationships + `">`)
+	for i := range w.sheets {
+		fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="%s/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, relationshipsNamespace, i+1)
+	}
+	fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="%s/styles" Target="styles.xml"/>`, len(w.sheets)+1, relationshipsNamespace)
+	b.WriteString(`</Relationships>`)
+	return b.String()
+}
+
+// styles returns the styles of the cells, in the order of the style
+// constants: the default, the bold header, the dates, the amounts and the
+// integers.
+func (w *Writer) styles() string {
+	var b strings.Builder
+	b.WriteString(xmlHeader)
+	b.WriteString(`<styleSheet xmlns="` + mainNamespace + `">`)
+	fmt.Fprintf(&b, `<numFmts count="3"><numFmt numFmtId="164" formatCode="yyyy-mm-dd"/><numFmt numFmtId="165" formatCode="yyyy-mm-dd hh:mm"/><numFmt numFmtId="166" formatCode="%s"/></numFmts>`, escape(w.options.AmountFormat))
+	b.WriteString(`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>`)
+	b.WriteString(`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>`)
+	b.WriteString(`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>`)
+	b.WriteString(`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>`)
+	b.WriteString(`<cellXfs count="6">`)
+	b.WriteString(`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>`)
+	b.WriteString(`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>`)
+	for _, format := range []int{164, 165, 166, 1} {
+		fmt.Fprintf(&b, `<xf numFmtId="%d" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>`, format)
+	}
+	b.WriteString(`</cellXfs>`)
+	b.WriteString(`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>`)
+	b.WriteString(`</styleSheet>`)
+	return b.String()
+}
@@ -0,0 +1,426 @@
+// Package xlsx writes Excel workbooks (Office Open XML spreadsheets) as a
+// stream: the rows are encoded and compressed as they are written, so the
+// memory used does not grow with them. The sheets are written one after
+// the other, each with a frozen header row and typed columns.
+package xlsx
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MaxRows is the number of rows of a sheet in Excel, its header included.
+const MaxRows = 1 << 20
+
+// ContentType is the media type of the workbooks.
+const ContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+var (
+	// ErrNoSheet is returned when writing a row before adding a sheet.
+	ErrNoSheet = errors.New("xlsx: no sheet added")
+	// ErrTooManyRows is returned when a sheet would not open in Excel.
+	ErrTooManyRows = errors.New("xlsx: too many rows in the sheet")
+	// ErrClosed is returned when writing after Close.
+	ErrClosed = errors.New("xlsx: writer closed")
+)
+
+// Type is how the values of a column are stored and displayed.
+type Type int
+
+const (
+	Text     Type = iota // Strings, any other value is written as text
+	Number               // With the general format
+	Integer              // Without decimals
+	Amount               // With the amount format of the options
+	Date                 // yyyy-mm-dd
+	DateTime             // yyyy-mm-dd hh:mm
+	Bool                 // TRUE or FALSE
+)
+
+// The styles of the cells, indexes of the cellXfs of styles.xml.
+const (
+	styleDefault = iota
+	styleHeader
+	styleDate
+	styleDateTime
+	styleAmount
+	styleInteger
+)
+
+// Column is a column of a sheet: its header and the type of its values.
+type Column struct {
+	Name  string
+	Type  Type
+	Width float64 // In characters, from the name and the type when 0
+}
+
+// Options are the formats of a workbook.
+type Options struct {
+	// AmountFormat is the Excel number format of the amounts, #,##0.00 by
+	// default
+	AmountFormat string
+	// Location is the timezone the dates are written in, as Excel has
+	// none, UTC by default
+	Location *time.Location
+}
+
+// Writer writes a workbook to an io.Writer.
+type Writer struct {
+	zip     *zip.Writer
+	options Options
+
+	sheets  []string
+	sheet   io.Writer
+	columns []Column
+	rows    int
+	closed  bool
+}
+
+// NewWriter returns a Writer of a workbook to w. The workbook is complete
+// once Close returns.
+func NewWriter(w io.Writer, options Options) *Writer {
+	if options.AmountFormat == "" {
+		options.AmountFormat = "#,##0.00"
+	}
+	if options.Location == nil {
+		options.Location = time.UTC
+	}
+	return &Writer{zip: zip.NewWriter(w), options: options}
+}
+
+// AddSheet ends the current sheet and starts the next one, with a header row
+// naming the columns. The name is cut to the 31 characters Excel allows,
+// without the characters it refuses, and made unique.
+func (w *Writer) AddSheet(name string, columns []Column) error {
+	if w.closed {
+		return ErrClosed
+	}
+	if err := w.endSheet(); err != nil {
+		return err
+	}
+
+	name = w.sheetName(name)
+	w.sheets = append(w.sheets, name)
+	sheet, err := w.zip.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", len(w.sheets)))
+	if err != nil {
+		return err
+	}
+	w.sheet, w.columns, w.rows = sheet, columns, 0
+
+	var b strings.Builder
+	b.WriteString(xmlHeader)
+	b.WriteString(`<worksheet xmlns="` + mainNamespace + `" xmlns:r="` + relationshipsNamespace + `">`)
+	b.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	if len(columns) > 0 {
+		b.WriteString("<cols>")
+		for i, column := range columns {
+			fmt.Fprintf(&b, `<col min="%d" max="%d" width="%s" customWidth="1"/>`, i+1, i+1, strconv.FormatFloat(columnWidth(column), 'f', -1, 64))
+		}
+		b.WriteString("</cols>")
+	}
+	b.WriteString("<sheetData>")
+	if _, err := io.WriteString(w.sheet, b.String()); err != nil {
+		return err
+	}
+
+	header := make([]any, len(columns))
+	for i, column := range columns {
+		header[i] = column.Name
+	}
+	return w.writeRow(header, true)
+}
+
+// WriteRow writes a row of the current sheet, a value per column: strings,
+// numbers, booleans and times, written as the type of their column, or nil
+// for an empty cell. The zero times, NaN and infinities are empty too.
+func (w *Writer) WriteRow(values ...any) error {
+	if w.closed {
+		return ErrClosed
+	}
+	if w.sheet == nil {
+		return ErrNoSheet
+	}
+	return w.writeRow(values, false)
+}
+
+func (w *Writer) writeRow(values []any, header bool) error {
+	if w.rows >= MaxRows {
+		return ErrTooManyRows
+	}
+	w.rows++
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<row r="%d">`, w.rows)
+	for i, value := range values {
+		var column Column
+		if i < len(w.columns) {
+			column = w.columns[i]
+		}
+		if header {
+			column.Type = Text
+		}
+		w.writeCell(&b, cellName(i, w.rows), column.Type, value, header)
+	}
+	b.WriteString("</row>")
+	_, err := io.WriteString(w.sheet, b.String())
+	return err
+}
+
+// writeCell writes the value as the type, as text when it is not one of
+// the type.
+func (w *Writer) writeCell(b *strings.Builder, ref string, t Type, value any, header bool) {
+	if value == nil {
+		return
+	}
+
+	switch t {
+	case Number, Integer, Amount:
+		if number, ok := toFloat(value); ok {
+			if math.IsNaN(number) || math.IsInf(number, 0) {
+				return
+			}
+			style := styleDefault
+			if t == Integer {
+				style = styleInteger
+			} else if t == Amount {
+				style = styleAmount
+			}
+			writeNumber(b, ref, style, number)
+			return
+		}
+	case Date, DateTime:
+		if date, ok := value.(time.Time); ok {
+			if date.IsZero() {
+				return
+			}
+			style := styleDate
+			if t == DateTime {
+				style = styleDateTime
+			}
+			writeNumber(b, ref, style, w.serial(date))
+			return
+		}
+	case Bool:
+		if boolean, ok := value.(bool); ok {
+			v := "0"
+			if boolean {
+				v = "1"
+			}
+			fmt.Fprintf(b, `<c r="%s" t="b"><v>%s</v></c>`, ref, v)
+			return
+		}
+	}
+
+	text, ok := value.(string)
+	if !ok {
+		text = fmt.Sprint(value)
+	}
+	style := ""
+	if header {
+		style = fmt.Sprintf(` s="%d"`, styleHeader)
+	}
+	fmt.Fprintf(b, `<c r="%s"%s t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, style, escape(text))
+}
+
+func writeNumber(b *strings.Builder, ref string, style int, number float64) {
+	fmt.Fprintf(b, `<c r="%s"`, ref)
+	if style != styleDefault {
+		fmt.Fprintf(b, ` s="%d"`, style)
+	}
+	fmt.Fprintf(b, `><v>%s</v></c>`, strconv.FormatFloat(number, 'f', -1, 64))
+}
+
+// excelEpoch is day 0 of the Excel dates, which count 1900 as a leap year.
+var excelEpoch = time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC)
+
+// serial returns the Excel date of the time: the days since the epoch of
+// its wall clock in the timezone of the options, the time of the day as
+// the fraction.
+func (w *Writer) serial(date time.Time) float64 {
+	local := date.In(w.options.Location)
+	wall := time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), local.Minute(), local.Second(), local.Nanosecond(), time.UTC)
+	days := wall.Sub(excelEpoch).Hours() / 24
+	// Rounded to the millisecond, the precision of Excel
+	return math.Round(days*86400000) / 86400000
+}
+
+func toFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// endSheet closes the XML of the current sheet, if any.
+func (w *Writer) endSheet() error {
+	if w.sheet == nil {
+		return nil
+	}
+	_, err := io.WriteString(w.sheet, "</sheetData></worksheet>")
+	w.sheet = nil
+	return err
+}
+
+// Close ends the current sheet and writes the parts of the workbook listing
+// the sheets. A workbook without sheets gets an empty one, Excel refuses
+// them otherwise.
+func (w *Writer) Close() error {
+	if w.closed {
+		return ErrClosed
+	}
+	if len(w.sheets) == 0 {
+		if err := w.AddSheet("", nil); err != nil {
+			return err
+		}
+	}
+	if err := w.endSheet(); err != nil {
+		return err
+	}
+	w.closed = true
+
+	parts := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", w.contentTypes()},
+		{"_rels/.rels", rootRelationships},
+		{"xl/workbook.xml", w.workbook()},
+		{"xl/_rels/workbook.xml.rels", w.workbookRelationships()},
+		{"xl/styles.xml", w.styles()},
+	}
+	for _, part := range parts {
+		f, err := w.zip.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return err
+		}
+	}
+	return w.zip.Close()
+}
+
+// sheetName returns the name of the next sheet as Excel accepts it.
+func (w *Writer) sheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) || r < ' ' {
+			return ' '
+		}
+		return r
+	}, name)
+	name = strings.Trim(strings.TrimSpace(name), "'")
+	if name == "" {
+		name = fmt.Sprintf("Sheet%d", len(w.sheets)+1)
+	}
+
+	base := name
+	for i := 2; ; i++ {
+		if utf8.RuneCountInString(name) > 31 {
+			name = string([]rune(name)[:31])
+		}
+		if !w.hasSheet(name) {
+			return name
+		}
+		suffix := fmt.Sprintf(" (%d)", i)
+		name = base
+		if utf8.RuneCountInString(name)+len(suffix) > 31 {
+			name = string([]rune(name)[:31-len(suffix)])
+		}
+		name += suffix
+	}
+}
+
+// hasSheet reports whether a sheet has the name, ignoring the case as Excel.
+func (w *Writer) hasSheet(name string) bool {
+	for _, sheet := range w.sheets {
+		if strings.EqualFold(sheet, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// columnWidth returns the width of the column, wide enough for its header
+// and for the values of its type.
+func columnWidth(column Column) float64 {
+	if column.Width > 0 {
+		return column.Width
+	}
+	width := 12.0
+	switch column.Type {
+	case Text:
+		width = 16
+	case DateTime:
+		width = 17
+	case Amount:
+		width = 14
+	case Bool, Integer:
+		width = 8
+	}
+	return math.Max(width, float64(utf8.RuneCountInString(column.Name)+2))
+}
+
+// cellName returns the reference of the cell of the zero-based column in
+// the row, A1 for the first one.
+func cellName(column, row int) string {
+	name := ""
+	for column++; column > 0; column = (column - 1) / 26 {
+		name = string(rune('A'+(column-1)%26)) + name
+	}
+	return name + strconv.Itoa(row)
+}
+
+// escape returns the text escaped for XML, without the control characters
+// XML cannot hold.
+func escape(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '&':
+			b.WriteString("&amp;")
+		case r == '<':
+			b.WriteString("&lt;")
+		case r == '>':
+			b.WriteString("&gt;")
+		case r == '"':
+			b.WriteString("&quot;")
+		case r == '\t' || r == '\n' || r == '\r':
+			b.WriteRune(r)
+		case r < ' ' || r == utf8.RuneError || r == 0xFFFE || r == 0xFFFF:
+			continue
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
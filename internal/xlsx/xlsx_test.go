@@ -0,0 +1,152 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"flag"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of testdata")
+
+func TestWorkbookGolden(t *testing.T) {
+	location, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buffer bytes.Buffer
+	w := NewWriter(&buffer, Options{AmountFormat: `#,##0.00" €"`, Location: location})
+	err = w.AddSheet("Transactions", []Column{
+		{Name: "date", Type: DateTime},
+		{Name: "description", Type: Text},
+		{Name: "amount", Type: Amount},
+		{Name: "count", Type: Integer},
+		{Name: "flagged", Type: Bool},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := [][]any{
+		// 2024-03-05 13:30 in Paris
+		{time.Date(2024, time.March, 5, 12, 30, 0, 0, time.UTC), "Café & <croissant>", 4.5, 1, false},
+		{time.Time{}, "=SUM(A1)", -1234.56, int64(3), true},
+		{nil, nil, math.NaN(), "n/a", "yes"},
+	}
+	for _, row := range rows {
+		if err := w.WriteRow(row...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.AddSheet("Totals: by [period]", []Column{{Name: "period_start", Type: Date}, {Name: "total", Type: Number, Width: 20}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteRow(time.Date(2024, time.March, 1, 0, 0, 0, 0, location), 1.25); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if err != nil {
+		t.Fatalf("expected a zip archive: %v", err)
+	}
+	var names []string
+	for _, file := range archive.File {
+		names = append(names, file.Name)
+		f, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		golden := filepath.Join("testdata", "workbook", filepath.FromSlash(file.Name)+".golden")
+		if *update {
+			if err := os.MkdirAll(filepath.Dir(golden), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(golden, content, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		expected, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatalf("missing golden file, run the test with -update: %v", err)
+		}
+		if !bytes.Equal(content, expected) {
+			t.Errorf("%s differs from its golden file:\n%s", file.Name, content)
+		}
+	}
+
+	expected := "xl/worksheets/sheet1.xml xl/worksheets/sheet2.xml [Content_Types].xml _rels/.rels xl/workbook.xml xl/_rels/workbook.xml.rels xl/styles.xml"
+	if strings.Join(names, " ") != expected {
+		t.Errorf("expected the parts %s; got %v", expected, names)
+	}
+}
+
+func TestWriterErrors(t *testing.T) {
+	w := NewWriter(io.Discard, Options{})
+	if err := w.WriteRow("a"); !errors.Is(err, ErrNoSheet) {
+		t.Errorf("expected ErrNoSheet; got %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("expected an empty workbook to close; got %v", err)
+	}
+	if len(w.sheets) != 1 || w.sheets[0] != "Sheet1" {
+		t.Errorf("expected an empty sheet; got %v", w.sheets)
+	}
+	if err := w.AddSheet("More", nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed; got %v", err)
+	}
+
+	w = NewWriter(io.Discard, Options{})
+	if err := w.AddSheet("Rows", []Column{{Name: "n", Type: Integer}}); err != nil {
+		t.Fatal(err)
+	}
+	w.rows = MaxRows
+	if err := w.WriteRow(1); !errors.Is(err, ErrTooManyRows) {
+		t.Errorf("expected ErrTooManyRows; got %v", err)
+	}
+}
+
+func TestSheetName(t *testing.T) {
+	w := &Writer{}
+	for _, tt := range []struct {
+		name     string
+		expected string
+	}{
+		{"Budgets", "Budgets"},
+		{"budgets", "budgets (2)"},
+		{"a/b:c", "a b c"},
+		{"", "Sheet4"},
+		{strings.Repeat("x", 40), strings.Repeat("x", 31)},
+		{strings.Repeat("x", 40), strings.Repeat("x", 27) + " (2)"},
+	} {
+		name := w.sheetName(tt.name)
+		if name != tt.expected {
+			t.Errorf("expected %q for %q; got %q", tt.expected, tt.name, name)
+		}
+		w.sheets = append(w.sheets, name)
+	}
+}
+
+func TestCellName(t *testing.T) {
+	for column, expected := range map[int]string{0: "A1", 25: "Z1", 26: "AA1", 701: "ZZ1", 702: "AAA1"} {
+		if name := cellName(column, 1); name != expected {
+			t.Errorf("expected %s for the column %d; got %s", expected, column, name)
+		}
+	}
+}
@@ -1,39 +1,15 @@
 package main
 
 import (
-	"FinMa/internal/server"
-	"fmt"
+	"FinMa/internal/cli"
 	"os"
-	"strconv"
+	// The timezones of the users are checked against the tz database
+	// embedded in the binary, whatever the host has installed
+	_ "time/tzdata"
 
-	"github.com/gofiber/fiber/v2/middleware/cors"
-	"github.com/gofiber/fiber/v2/middleware/helmet"
-	"github.com/gofiber/fiber/v2/middleware/limiter"
 	_ "github.com/joho/godotenv/autoload"
 )
 
-type Payload struct {
-	UserID   int
-	Username string
-	Email    string
-}
-
 func main() {
-
-	server := server.New()
-
-	server.RegisterFiberRoutes()
-	server.Use(helmet.New())
-	server.Use(limiter.New())
-	server.Use(cors.New(cors.Config{
-		AllowOrigins: "*",
-		AllowMethods: "GET,POST,HEAD,PUT,DELETE,PATCH",
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
-	}))
-
-	port, _ := strconv.Atoi(os.Getenv("PORT"))
-	err := server.Listen(fmt.Sprintf(":%d", port))
-	if err != nil {
-		panic(fmt.Sprintf("cannot start server: %s", err))
-	}
+	os.Exit(cli.Run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
 }
@@ -0,0 +1,71 @@
+package types
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TransactionFilter holds the filtering and pagination options shared by every
+// endpoint listing transactions.
+type TransactionFilter struct {
+	From     *time.Time
+	To       *time.Time
+	Category string
+	Type     string
+	Flagged  *bool
+	// Excluded restricts the list to the transactions excluded (true) or not
+	// excluded (false) from the budgets
+	Excluded *bool
+	// AccountID restricts the list to the transactions of one account
+	AccountID *uuid.UUID
+	// ExcludeShared restricts the list to the accounts owned by the user
+	ExcludeShared bool
+	// BatchID restricts the list to the transactions of a batch of the
+	// audit log, like the ones created by an import
+	BatchID *uuid.UUID
+	// WithBalance sets the running balance of the account on each transaction
+	WithBalance bool
+	Limit       int
+	Offset      int
+}
+
+// ReportFilter restricts the transactions summed by a report.
+type ReportFilter struct {
+	// AccountIDs restricts the report to some accounts, every account when empty
+	AccountIDs []uuid.UUID
+	// Category restricts the report to one category, every category when empty
+	Category string
+}
+
+// ExchangeRateFilter restricts the stored exchange rates listed to the
+// admins. The empty fields match every rate.
+type ExchangeRateFilter struct {
+	Base  string
+	Quote string
+	From  *time.Time
+	To    *time.Time
+	Limit int
+}
+
+// NotificationRetention is the age from which notifications are deleted:
+// read ones before ReadBefore, unread ones before UnreadBefore, and those of
+// the SecurityEvents before SecurityBefore whether read or not.
+type NotificationRetention struct {
+	ReadBefore     time.Time
+	UnreadBefore   time.Time
+	SecurityBefore time.Time
+	SecurityEvents []string
+}
+
+// ActivityFilter holds the filtering and pagination options of the activity
+// feed. The items are listed the latest first, from the cursor excluded.
+type ActivityFilter struct {
+	Actions []string // Audit actions listed
+	Events  []string // Notification events listed
+	// Before and BeforeID are the date and the ID of the last item of the
+	// previous page
+	Before   *time.Time
+	BeforeID uuid.UUID
+	Limit    int
+}
@@ -1,23 +1,39 @@
 package types
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type User struct {
-	ID            uuid.UUID      `json:"id" gorm:"primary_key"`
-	FirstName     string         `json:"first_name" validate:"required"`
-	LastName      string         `json:"last_name" validate:"required"`
-	Email         string         `json:"email" gorm:"uniqueIndex" validate:"required,email"`
-	Password      string         `json:"password" validate:"required"`
-	Role          string         `json:"role"`
-	Transactions  []Transaction  `json:"transactions" gorm:"foreignKey:UserID"`
-	BankAccounts  []BankAccount  `json:"bank_accounts" gorm:"foreignKey:UserID"`
-	Budgets       []Budget       `json:"budgets" gorm:"foreignKey:UserID"`
-	Notifications []Notification `json:"notifications" gorm:"foreignKey:UserID"`
-	RefreshTokens []RefreshToken `json:"refresh_tokens" gorm:"foreignKey:UserID"`
+	ID             uuid.UUID        `json:"id" gorm:"primary_key"`
+	FirstName      string           `json:"first_name" validate:"required"`
+	LastName       string           `json:"last_name" validate:"required"`
+	Email          string           `json:"email" gorm:"uniqueIndex" validate:"required,email"`
+	Password       string           `json:"password" validate:"required"`
+	Role           string           `json:"role"`
+	Timezone       string           `json:"timezone" gorm:"default:UTC" validate:"omitempty,timezone"`   // IANA timezone name used to bucket dates
+	HouseholdView  string           `json:"household_view" gorm:"default:household"`                     // "household" to see the data shared in the household, "mine" for own data only
+	BudgetingMode  string           `json:"budgeting_mode" gorm:"default:classic"`                       // "classic" budgets against their limit, "envelope" against the income allocated to them
+	Locale         string           `json:"locale"`                                                      // Language of the messages, "en" or "fr", empty to follow the Accept-Language of the requests
+	BaseCurrency   string           `json:"base_currency" gorm:"size:3"`                                 // ISO 4217 code the reports are converted to, empty for the currency of the instance
+	AvatarVersion  int64            `json:"avatar_version"`                                              // Upload time of the avatar in milliseconds, part of its URLs to bust the caches, 0 without one
+	DigestSentAt   *time.Time       `json:"-"`                                                           // When the last weekly digest was sent, to never send one twice
+	IsDemo         bool             `json:"is_demo" gorm:"index"`                                        // Sandbox user of the demo mode, purged after its lifetime
+	Plan           string           `json:"plan"`                                                        // Plan of the hosted offering, "free" or "pro", empty for PLAN_DEFAULT
+	LimitOverrides map[string]int64 `json:"limit_overrides,omitempty" gorm:"serializer:json;type:jsonb"` // Limits set by an admin over the plan, by name, 0 for unlimited
+	Transactions   []Transaction    `json:"transactions" gorm:"foreignKey:UserID"`
+	BankAccounts   []BankAccount    `json:"bank_accounts" gorm:"foreignKey:UserID"`
+	Budgets        []Budget         `json:"budgets" gorm:"foreignKey:UserID"`
+	Notifications  []Notification   `json:"notifications" gorm:"foreignKey:UserID"`
+	RefreshTokens  []RefreshToken   `json:"refresh_tokens" gorm:"foreignKey:UserID"`
 
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
@@ -39,12 +55,43 @@ type RefreshToken struct {
 type BankAccount struct {
 	ID            uuid.UUID `json:"id" gorm:"primary_key"`
 	BankName      string    `json:"bank_name"`
-	AccountType   string    `json:"account_type"`
+	AccountType   string    `json:"account_type"` // See constants.ACCOUNT_TYPES
 	AccountNumber string    `json:"account_number" gorm:"uniqueIndex"`
-	Balance       float64   `json:"balance"`
+	Balance       Money     `json:"balance"`
+	CreditLimit   Money     `json:"credit_limit"`   // Only used by liability accounts
+	Class         string    `json:"class" gorm:"-"` // "asset" or "liability", derived from the account type
+
+	Currency string `json:"currency" gorm:"size:3"` // ISO 4217 code of the balance and the transactions of the account
+
+	SortOrder  int    `json:"sort_order"`
+	Color      string `json:"color"` // Hex color, like "#1e88e5"
+	IsFavorite bool   `json:"is_favorite"`
+
+	InitialBalance Money      `json:"initial_balance"` // Balance before the first transaction
+	OpeningDate    *time.Time `json:"opening_date"`    // Transactions cannot be dated before it
+
+	// Credit card statement cycle, days of the month clamped to the month length
+	StatementDay       int        `json:"statement_day"`
+	PaymentDueDay      int        `json:"payment_due_day"`
+	DueReminderDays    int        `json:"due_reminder_days" gorm:"default:3"` // Days before the due date to notify, 0 disables the reminder
+	DueReminderSentFor *time.Time `json:"-"`                                  // Due date of the last reminder sent
+
+	LowBalanceThreshold *Money `json:"low_balance_threshold"` // Notify when a transaction takes the balance below it, null disables the alert
+	LowBalanceAlerted   bool   `json:"-"`                     // The balance is below the threshold, re-armed once it recovers
+
+	CompoundingFrequency string `json:"compounding_frequency"` // Savings accounts: "daily", "monthly", "quarterly" or "yearly"
+
+	BankConnectionID  *uuid.UUID `json:"bank_connection_id"`
+	ExternalAccountID string     `json:"external_account_id" gorm:"column:encrypted_external_account_id;serializer:encrypted"`
+	SyncCursor        string     `json:"-"`
+	SyncError         string     `json:"sync_error"`
+
+	ArchivedAt     *time.Time `json:"archived_at"`
+	KeepInNetWorth bool       `json:"keep_in_net_worth"` // Keep counting the balance in the net worth once archived
 
 	UserID       uuid.UUID     `json:"user_id"`
 	User         User          `json:"user"`
+	HouseholdID  *uuid.UUID    `json:"household_id" gorm:"index"` // Set when shared with the household of its owner
 	Transactions []Transaction `json:"transactions" gorm:"foreignKey:BankAccountID"`
 
 	CreatedAt time.Time `json:"created_at"`
@@ -53,46 +100,882 @@ type BankAccount struct {
 }
 
 type Transaction struct {
-	ID          uuid.UUID `json:"id" gorm:"primary_key"`
-	Category    string    `json:"category"`
-	Amount      float64   `json:"amount"`
-	Date        time.Time `json:"date"`
-	Type        string    `json:"type"` // E.g., "expense", "income"
-	IsRecurring bool      `json:"is_recurring"`
-	Description string    `json:"description"`
-
-	UserID        uuid.UUID   `json:"user_id"`
+	ID          uuid.UUID `json:"id" csv:"id" gorm:"primary_key"`
+	Category    string    `json:"category" csv:"category"`
+	Amount      Money     `json:"amount" csv:"amount" xlsx:"amount"` // Always positive, see Type for the direction
+	Date        time.Time `json:"date" csv:"date" gorm:"index:idx_transactions_user_date,priority:2"`
+	Type        string    `json:"type" csv:"type"` // "income", "expense" or "transfer"
+	IsRecurring bool      `json:"is_recurring" csv:"is_recurring"`
+	Description string    `json:"description" csv:"description"`
+	IsFlagged   bool      `json:"is_flagged" csv:"is_flagged"` // Unusually large amount for its category
+
+	// ExcludeFromBudgets keeps the transaction out of the budgets and the
+	// spending reports, like a reimbursed work expense
+	ExcludeFromBudgets bool `json:"exclude_from_budgets" csv:"exclude_from_budgets" gorm:"not null;default:false"`
+
+	BeforeOpening  bool   `json:"before_opening,omitempty" gorm:"-"`                                      // Warning: dated before the account opening date
+	RunningBalance *Money `json:"running_balance,omitempty" csv:"running_balance" xlsx:"amount" gorm:"-"` // Balance of the account after the transaction, when requested
+
+	ExternalID string `json:"external_id" gorm:"index"` // ID of the transaction at the bank, for synced accounts
+	Source     string `json:"-" gorm:"-"`               // "bank_sync" or "import" while the transaction is created, empty when entered by hand
+
+	IsReconciled     bool       `json:"is_reconciled" csv:"is_reconciled"`
+	ReconciliationID *uuid.UUID `json:"reconciliation_id" gorm:"index"`
+
+	UserID        uuid.UUID   `json:"user_id" gorm:"index:idx_transactions_user_date,priority:1"` // Member who created the transaction
 	User          User        `json:"user"`
-	BankAccountID uuid.UUID   `json:"bank_account_id"`
+	BankAccountID uuid.UUID   `json:"bank_account_id" csv:"bank_account_id"`
 	BankAccount   BankAccount `json:"bank_account"`
+	BudgetID      *uuid.UUID  `json:"budget_id" csv:"budget_id" gorm:"index"` // Budget this transaction is counted against, if any
+
+	TransferAccountID *uuid.UUID `json:"transfer_account_id" csv:"transfer_account_id" gorm:"index"` // Account credited by a transfer, like a card receiving a payment
+
+	Version int64 `json:"version" gorm:"not null;default:1"` // Bumped by every edit, sent back by the clients updating the transaction
 
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	DeletedAt time.Time `json:"deleted_at"`
 }
 
+// Budget limits the expenses of a set of categories, or of every category
+// except a set when ExcludeCategories is on.
 type Budget struct {
+	ID                uuid.UUID `json:"id" csv:"id" gorm:"primary_key"`
+	Name              string    `json:"name" csv:"name"`
+	ExcludeCategories bool      `json:"exclude_categories"`
+	Amount            Money     `json:"amount"`
+	StartDate         time.Time `json:"start_date" csv:"start_date"`
+	EndDate           time.Time `json:"end_date" csv:"end_date"` // Last day of a custom budget, unset for recurring budgets
+
+	PeriodType   string `json:"period_type" csv:"period_type" gorm:"default:custom"` // Current period type, see constants.BUDGET_PERIOD_TYPES
+	WeekStartDay int    `json:"week_start_day"`                                      // Weekly budgets, 0 is Sunday
+	Rollover     bool   `json:"rollover" csv:"rollover"`                             // Carry the unused (or overspent) amount over to the next period
+
+	AlertThresholds Thresholds `json:"alert_thresholds" gorm:"type:text;default:'50,80,100'"` // Percentages of the limit notified once per period
+	RearmAlerts     bool       `json:"rearm_alerts"`                                          // Notify again after dropping back below a threshold
+
+	UserID       uuid.UUID        `json:"user_id"`
+	User         User             `json:"user"`
+	HouseholdID  *uuid.UUID       `json:"household_id" gorm:"index"` // Set when shared with the household of its owner, it then counts the expenses of every member
+	Transactions []Transaction    `json:"-" gorm:"foreignKey:BudgetID"`
+	Periods      []BudgetPeriod   `json:"-" gorm:"foreignKey:BudgetID"`
+	Categories   []BudgetCategory `json:"-" gorm:"foreignKey:BudgetID"`
+
+	Version int64 `json:"version" gorm:"not null;default:1"` // Bumped by every edit, sent back by the clients updating the budget
+
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"deleted_at" gorm:"index"` // Deleted budgets are kept for the reports of the periods they covered
+}
+
+// BudgetPeriod sets how the periods of a budget are cut from a date on.
+// Changing the period type of a budget adds a new one, so past periods keep
+// the period type they had.
+type BudgetPeriod struct {
+	ID            uuid.UUID `json:"id" gorm:"primary_key"`
+	PeriodType    string    `json:"period_type"`
+	WeekStartDay  int       `json:"week_start_day"`
+	EffectiveFrom time.Time `json:"effective_from"`
+
+	BudgetID uuid.UUID `json:"budget_id" gorm:"index"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ClosedBudgetPeriod records how a period of a budget finished. It is
+// written once the period closes and the rollover of the following period
+// is computed from it. Expenses dated in the period afterwards update it
+// and mark it as amended.
+type ClosedBudgetPeriod struct {
+	BudgetID       uuid.UUID  `json:"budget_id" gorm:"primaryKey"`
+	PeriodStart    time.Time  `json:"period_start" gorm:"primaryKey"`
+	PeriodEnd      time.Time  `json:"period_end"`
+	Limit          Money      `json:"limit" gorm:"column:base_limit"` // Budget amount, or amount allocated in envelope budgeting mode
+	EffectiveLimit Money      `json:"effective_limit"`                // Limit plus the rollover
+	Spent          Money      `json:"spent"`
+	Status         string     `json:"status"` // "within_budget" or "over_budget"
+	Amended        bool       `json:"amended"`
+	AmendedAt      *time.Time `json:"amended_at"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Thresholds is a list of percentages stored as comma separated text.
+type Thresholds []int
+
+func (t Thresholds) Value() (driver.Value, error) {
+	values := make([]string, 0, len(t))
+	for _, threshold := range t {
+		values = append(values, strconv.Itoa(threshold))
+	}
+	return strings.Join(values, ","), nil
+}
+
+func (t *Thresholds) Scan(value interface{}) error {
+	var text string
+	switch v := value.(type) {
+	case nil:
+		*t = nil
+		return nil
+	case string:
+		text = v
+	case []byte:
+		text = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Thresholds", value)
+	}
+
+	thresholds := Thresholds{}
+	for _, value := range strings.Split(text, ",") {
+		if value == "" {
+			continue
+		}
+		threshold, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		thresholds = append(thresholds, threshold)
+	}
+	*t = thresholds
+	return nil
+}
+
+// Categories is a list of category names stored as comma separated text.
+type Categories []string
+
+func (c Categories) Value() (driver.Value, error) {
+	return strings.Join(c, ","), nil
+}
+
+func (c *Categories) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*c = nil
+	case string:
+		*c = splitCategories(v)
+	case []byte:
+		*c = splitCategories(string(v))
+	default:
+		return fmt.Errorf("cannot scan %T into Categories", value)
+	}
+	return nil
+}
+
+func splitCategories(text string) Categories {
+	categories := Categories{}
+	for _, category := range strings.Split(text, ",") {
+		if category != "" {
+			categories = append(categories, category)
+		}
+	}
+	return categories
+}
+
+// BudgetTemplate is a named set of budgets that can be applied to a month.
+type BudgetTemplate struct {
+	ID    uuid.UUID            `json:"id" gorm:"primary_key"`
+	Name  string               `json:"name"`
+	Items []BudgetTemplateItem `json:"items" gorm:"foreignKey:TemplateID"`
+
+	UserID uuid.UUID `json:"user_id" gorm:"index"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BudgetTemplateItem holds the settings of a budget saved in a template.
+type BudgetTemplateItem struct {
+	ID                uuid.UUID  `json:"id" gorm:"primary_key"`
+	Name              string     `json:"name"`
+	Categories        Categories `json:"categories" gorm:"type:text"`
+	ExcludeCategories bool       `json:"exclude_categories"`
+	Amount            Money      `json:"amount"`
+	Rollover          bool       `json:"rollover"`
+	AlertThresholds   Thresholds `json:"alert_thresholds" gorm:"type:text"`
+	RearmAlerts       bool       `json:"rearm_alerts"`
+
+	TemplateID uuid.UUID `json:"template_id" gorm:"index"`
+}
+
+// Goal is a savings goal. Money reaching the linked account, if any, is
+// counted as a contribution until the goal is completed; contributions can
+// also be recorded manually or by linking transactions.
+type Goal struct {
+	ID            uuid.UUID  `json:"id" gorm:"primary_key"`
+	Name          string     `json:"name"`
+	TargetAmount  Money      `json:"target_amount"`
+	TargetDate    *time.Time `json:"target_date"`
+	BankAccountID *uuid.UUID `json:"bank_account_id" gorm:"index"` // Account the money is saved on, if any
+	CompletedAt   *time.Time `json:"completed_at"`                 // Set once the target is reached
+
+	UserID        uuid.UUID          `json:"user_id" gorm:"index"`
+	Contributions []GoalContribution `json:"-" gorm:"foreignKey:GoalID"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// GoalContribution is money put towards a goal, entered manually or coming
+// from a transaction.
+type GoalContribution struct {
+	ID            uuid.UUID  `json:"id" gorm:"primary_key"`
+	Amount        Money      `json:"amount"`
+	Date          time.Time  `json:"date"`
+	Note          string     `json:"note"`
+	GoalID        uuid.UUID  `json:"goal_id" gorm:"uniqueIndex:idx_goal_contribution_transaction"`
+	TransactionID *uuid.UUID `json:"transaction_id" gorm:"uniqueIndex:idx_goal_contribution_transaction"` // Set when linked to a transaction
+	RuleID        *uuid.UUID `json:"rule_id"`                                                             // Set when a share of the transaction was sent by an allocation rule
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Bill is a recurring payment the user is reminded of. It is due on
+// DueDay every month, or on the dates of DueDates for an explicit schedule.
+// An expense matching its merchant and amount pays the occurrence due in
+// the month of the expense.
+type Bill struct {
+	ID           uuid.UUID `json:"id" gorm:"primary_key"`
+	Name         string    `json:"name"`
+	Amount       Money     `json:"amount"`
+	DueDay       int       `json:"due_day"`                        // Day of the month, clamped to the month length, 0 with an explicit schedule
+	DueDates     Dates     `json:"due_dates" gorm:"type:text"`     // Explicit schedule, used when DueDay is 0
+	Merchant     string    `json:"merchant"`                       // Matched in the description of the expenses, case insensitive
+	Tolerance    float64   `json:"tolerance" gorm:"default:5"`     // Percentage of the amount a matching expense may differ by
+	Category     string    `json:"category"`                       // Category of the bill, see constants.TRANSACTION_CATEGORIES
+	ReminderDays int       `json:"reminder_days" gorm:"default:3"` // Days before the due date to notify, 0 disables the reminder
+	Autopay      bool      `json:"autopay"`                        // Paid automatically, no reminder is sent before the due date
+
+	BankAccountID *uuid.UUID `json:"bank_account_id" gorm:"index"` // Account the bill is paid from, if any, only its expenses are matched
+
+	UserID uuid.UUID `json:"user_id" gorm:"index"`
+	User   User      `json:"-"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BillPayment records what happened to the occurrence of a bill due on
+// DueDate: the reminders sent for it and the expense that paid it.
+type BillPayment struct {
+	BillID         uuid.UUID  `json:"bill_id" gorm:"primaryKey"`
+	DueDate        time.Time  `json:"due_date" gorm:"primaryKey;type:date"`
+	PaidAt         *time.Time `json:"paid_at"`
+	TransactionID  *uuid.UUID `json:"transaction_id" gorm:"index"` // Expense matched as the payment
+	ReminderSentAt *time.Time `json:"-"`
+	OverdueSentAt  *time.Time `json:"-"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Dates is a list of days stored as comma separated ISO dates.
+type Dates []time.Time
+
+func (d Dates) Value() (driver.Value, error) {
+	values := make([]string, 0, len(d))
+	for _, date := range d {
+		values = append(values, date.Format(time.DateOnly))
+	}
+	return strings.Join(values, ","), nil
+}
+
+func (d *Dates) Scan(value interface{}) error {
+	var text string
+	switch v := value.(type) {
+	case nil:
+		*d = nil
+		return nil
+	case string:
+		text = v
+	case []byte:
+		text = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Dates", value)
+	}
+
+	dates := Dates{}
+	for _, value := range strings.Split(text, ",") {
+		if value == "" {
+			continue
+		}
+		date, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			return err
+		}
+		dates = append(dates, date)
+	}
+	*d = dates
+	return nil
+}
+
+// Subscription is a recurring charge detected in the history of a user,
+// by merchant: suggested to them, then confirmed or dismissed. A confirmed
+// one is tracked as an autopaid bill, which its charges pay and the balance
+// forecast projects; a dismissed one is never suggested again.
+type Subscription struct {
+	ID       uuid.UUID  `json:"id" gorm:"primary_key"`
+	Merchant string     `json:"merchant" gorm:"uniqueIndex:idx_subscriptions_user_merchant"` // Normalized description of the charges
+	Status   string     `json:"status"`                                                      // "suggested", "confirmed" or "dismissed"
+	Cadence  string     `json:"cadence"`                                                     // "weekly", "monthly" or "yearly"
+	Amount   Money      `json:"amount"`                                                      // Price of the last charge, the price increases are notified
+	BillID   *uuid.UUID `json:"bill_id"`                                                     // Bill tracking a confirmed subscription
+
+	LastChargeAt time.Time `json:"last_charge_at"` // The charges dated after it are compared with Amount
+
+	UserID uuid.UUID `json:"user_id" gorm:"uniqueIndex:idx_subscriptions_user_merchant"`
+	User   User      `json:"-"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Allocation gives a job to part of the income of a user in envelope
+// budgeting mode: the amount is assigned to a budget, in the period of the
+// budget containing its date.
+type Allocation struct {
+	ID            uuid.UUID  `json:"id" gorm:"primary_key"`
+	Amount        Money      `json:"amount"`
+	Date          time.Time  `json:"date"`
+	UserID        uuid.UUID  `json:"user_id" gorm:"index"`
+	BudgetID      uuid.UUID  `json:"budget_id" gorm:"index"`
+	TransactionID *uuid.UUID `json:"transaction_id" gorm:"index"` // Income transaction the money comes from, if any
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AllocationRule distributes the income matching it across goals and
+// budgets as soon as it is recorded. Its steps run in order, what is left
+// after the last step stays unallocated.
+type AllocationRule struct {
+	ID        uuid.UUID            `json:"id" gorm:"primary_key"`
+	Name      string               `json:"name"`
+	Merchant  string               `json:"merchant"`   // Matched in the description of the income, case insensitive
+	MinAmount Money                `json:"min_amount"` // Smallest income matched
+	Steps     []AllocationRuleStep `json:"steps" gorm:"foreignKey:RuleID"`
+
+	UserID uuid.UUID `json:"user_id" gorm:"index"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AllocationRuleStep sends a percentage of the income, or a fixed amount,
+// to a savings goal or a budget envelope.
+type AllocationRuleStep struct {
+	ID       uuid.UUID  `json:"id" gorm:"primary_key"`
+	Position int        `json:"position"`
+	Kind     string     `json:"kind"`  // "percentage" or "fixed"
+	Value    Money      `json:"value"` // Percentage of the income or fixed amount
+	GoalID   *uuid.UUID `json:"goal_id"`
+	BudgetID *uuid.UUID `json:"budget_id"`
+
+	RuleID uuid.UUID `json:"rule_id" gorm:"index"`
+}
+
+// AllocationRuleRun records that an income transaction was distributed by
+// a rule, so that it is never distributed twice.
+type AllocationRuleRun struct {
+	TransactionID uuid.UUID `json:"transaction_id" gorm:"primaryKey"`
+	RuleID        uuid.UUID `json:"rule_id"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BudgetAlert records that a threshold of a budget was notified for the
+// period starting at PeriodStart.
+type BudgetAlert struct {
+	BudgetID    uuid.UUID `json:"budget_id" gorm:"primaryKey"`
+	Threshold   int       `json:"threshold" gorm:"primaryKey"`
+	PeriodStart time.Time `json:"period_start" gorm:"primaryKey"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BudgetCategory is a category included in (or excluded from) a budget.
+type BudgetCategory struct {
+	BudgetID uuid.UUID `json:"budget_id" gorm:"primaryKey"`
+	Category string    `json:"category" gorm:"primaryKey"`
+}
+
+// CategoryNames returns the categories of the budget.
+func (b Budget) CategoryNames() []string {
+	names := make([]string, 0, len(b.Categories))
+	for _, category := range b.Categories {
+		names = append(names, category.Category)
+	}
+	return names
+}
+
+// BankConnection is a link with a bank through a bank sync provider.
+// Consent is the provider link ID, encrypted in the database.
+type BankConnection struct {
+	ID            uuid.UUID  `json:"id" gorm:"primary_key"`
+	Provider      string     `json:"provider"`
+	InstitutionID string     `json:"institution_id"`
+	Consent       string     `json:"-" gorm:"serializer:encrypted"`
+	Status        string     `json:"status"` // "pending", "linked", "partial_error", "error", "rate_limited" or "expired"
+	LastError     string     `json:"last_error"`
+	LastSyncedAt  *time.Time `json:"last_synced_at"`
+	RetryAfter    *time.Time `json:"retry_after"`
+
+	UserID   uuid.UUID     `json:"user_id" gorm:"index"`
+	Accounts []BankAccount `json:"accounts" gorm:"foreignKey:BankConnectionID"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BalanceSnapshot is the balance of an account at the end of a UTC day.
+type BalanceSnapshot struct {
+	BankAccountID uuid.UUID `json:"bank_account_id" gorm:"primaryKey"`
+	Date          time.Time `json:"date" gorm:"primaryKey;type:date"`
+	Balance       Money     `json:"balance"`
+}
+
+// InterestRate is the annual interest rate of a savings account from a date
+// on. Past rates are kept so projections use the rate in effect per period.
+type InterestRate struct {
+	ID            uuid.UUID `json:"id" gorm:"primary_key"`
+	Rate          float64   `json:"rate"` // Annual rate in percent
+	EffectiveFrom time.Time `json:"effective_from"`
+
+	BankAccountID uuid.UUID `json:"bank_account_id" gorm:"index"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ExchangeRate is the rate of a currency pair on a UTC day: 1 Base is worth
+// Rate Quote. It is fetched once and kept, so that the conversions of a
+// past day are reproducible. RateDate is the day the rate was published,
+// before Date for the weekends and the holidays.
+type ExchangeRate struct {
+	ID       uuid.UUID `json:"id" gorm:"primary_key"`
+	Base     string    `json:"base" gorm:"size:3;uniqueIndex:idx_exchange_rates_pair_date"`
+	Quote    string    `json:"quote" gorm:"size:3;uniqueIndex:idx_exchange_rates_pair_date"`
+	Date     time.Time `json:"date" gorm:"type:date;uniqueIndex:idx_exchange_rates_pair_date"`
+	Rate     float64   `json:"rate"`
+	RateDate time.Time `json:"rate_date" gorm:"type:date"`
+	Fallback bool      `json:"fallback"` // No rate was published on Date, RateDate is the last day before it with one
+	Source   string    `json:"source"`   // Provider of the rate, or "manual" once corrected by an admin
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AccountMember gives a user access to a bank account owned by someone else.
+// Invites are pending until the invited user accepts them.
+type AccountMember struct {
+	ID     uuid.UUID `json:"id" gorm:"primary_key"`
+	Email  string    `json:"email"`
+	Role   string    `json:"role"`   // "owner", "editor" or "viewer"
+	Status string    `json:"status"` // "pending" or "active"
+
+	BankAccountID uuid.UUID   `json:"bank_account_id" gorm:"index"`
+	BankAccount   BankAccount `json:"-"`
+	UserID        *uuid.UUID  `json:"user_id" gorm:"index"` // Set once the invite is accepted
+	InvitedByID   uuid.UUID   `json:"invited_by_id"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Household groups users sharing accounts and budgets.
+type Household struct {
+	ID      uuid.UUID         `json:"id" gorm:"primary_key"`
+	Name    string            `json:"name"`
+	Members []HouseholdMember `json:"members" gorm:"foreignKey:HouseholdID"`
+
+	OwnerID uuid.UUID `json:"owner_id"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// HouseholdMember is a user, or a pending invite, of a household.
+type HouseholdMember struct {
+	ID     uuid.UUID `json:"id" gorm:"primary_key"`
+	Email  string    `json:"email"`
+	Role   string    `json:"role"`   // "owner" or "member"
+	Status string    `json:"status"` // "pending" or "active"
+
+	HouseholdID uuid.UUID  `json:"household_id" gorm:"index"`
+	UserID      *uuid.UUID `json:"user_id" gorm:"index"` // Set once the invite is accepted
+	InvitedByID uuid.UUID  `json:"invited_by_id"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Reconciliation is a session reconciling an account against a bank statement.
+// It is closed, and locked, once the reconciled transactions match the statement balance.
+type Reconciliation struct {
+	ID               uuid.UUID  `json:"id" gorm:"primary_key"`
+	StatementDate    time.Time  `json:"statement_date"`
+	StatementBalance Money      `json:"statement_balance"`
+	Status           string     `json:"status"` // "open" or "closed"
+	ClosedAt         *time.Time `json:"closed_at"`
+
+	BankAccountID uuid.UUID `json:"bank_account_id" gorm:"index"`
+	UserID        uuid.UUID `json:"user_id"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AuditLog records a sensitive change made by a user.
+type AuditLog struct {
+	ID         uuid.UUID `json:"id" gorm:"primary_key"`
+	Action     string    `json:"action"`
+	EntityType string    `json:"entity_type"`
+	EntityID   uuid.UUID `json:"entity_id" gorm:"index"`
+	Details    string    `json:"details"`
+	// BatchID groups the entries of one operation, like the transactions
+	// of an import. The entries of a batch share their action.
+	BatchID *uuid.UUID `json:"batch_id,omitempty" gorm:"index"`
+
+	UserID uuid.UUID `json:"user_id" gorm:"index"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PrivacyRequest is a request of a user under the GDPR: the export of their
+// data or its erasure. A completed erasure outlives the user, with its
+// certificate as the only record.
+type PrivacyRequest struct {
+	ID     uuid.UUID `json:"id" gorm:"primary_key"`
+	Kind   string    `json:"kind"`                // "export" or "erasure"
+	Status string    `json:"status" gorm:"index"` // See constants.PRIVACY_REQUEST_STATUSES
+
+	// Export
+	ArchiveKey  string     `json:"-"`                      // Key of the archive in the storage
+	ArchiveSize int64      `json:"archive_size,omitempty"` // Bytes
+	ExpiresAt   *time.Time `json:"expires_at"`             // The archive is deleted past it
+
+	// Erasure
+	ConfirmedAt  *time.Time          `json:"confirmed_at"`
+	ScheduledFor *time.Time          `json:"scheduled_for" gorm:"index"` // End of the grace period, the request can be canceled until then
+	Certificate  *ErasureCertificate `json:"certificate,omitempty" gorm:"serializer:json;type:jsonb"`
+
+	Error       string     `json:"error,omitempty"`
+	CompletedAt *time.Time `json:"completed_at"`
+
+	UserID uuid.UUID `json:"user_id" gorm:"index"` // Not a foreign key, the erasures outlive the user
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ErasureCertificate records what the erasure of a user deleted and when,
+// without any personal data.
+type ErasureCertificate struct {
+	RequestedAt time.Time        `json:"requested_at"`
+	ErasedAt    time.Time        `json:"erased_at"`
+	Deleted     map[string]int64 `json:"deleted"`    // Rows deleted per table
+	Anonymized  map[string]int64 `json:"anonymized"` // Rows kept without the user, like the audit log and the transactions on the accounts of others
+	Files       int              `json:"files"`      // Stored files deleted, like the avatar and the export archives
+}
+
+// ShareGrant gives read access to the data of a user, restricted to the
+// transactions dated in a range and to some resources, to another user or to
+// the holders of a link. It stops working once revoked or expired.
+type ShareGrant struct {
+	ID        uuid.UUID  `json:"id" gorm:"primary_key"`
+	Label     string     `json:"label"`                                       // Like "Accountant 2024"
+	Resources []string   `json:"resources" gorm:"serializer:json;type:jsonb"` // See constants.SHARE_RESOURCES
+	From      time.Time  `json:"from"`                                        // First date of the transactions shared
+	To        time.Time  `json:"to"`                                          // Last date, inclusive
+	ExpiresAt *time.Time `json:"expires_at"`                                  // Required for the links
+	RevokedAt *time.Time `json:"revoked_at"`
+
+	// Invite, unset for a link
+	Email     string     `json:"email,omitempty"`
+	GranteeID *uuid.UUID `json:"grantee_id,omitempty" gorm:"index"`
+
+	UserID uuid.UUID `json:"user_id" gorm:"index"` // Owner of the data
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Active reports whether the grant gives access at the time.
+func (g ShareGrant) Active(at time.Time) bool {
+	return g.RevokedAt == nil && (g.ExpiresAt == nil || at.Before(*g.ExpiresAt))
+}
+
+// Covers reports whether the date is in the range of the grant.
+func (g ShareGrant) Covers(date time.Time) bool {
+	return !date.Before(g.From) && !date.After(g.To)
+}
+
+// CategorySetting holds the preferences of a user for a transaction category.
+// New transactions of a category excluded by default are excluded from the
+// budgets, the existing ones are left unchanged. The expenses of the
+// essential categories are told apart from the discretionary ones.
+type CategorySetting struct {
+	ID               uuid.UUID `json:"id" gorm:"primary_key"`
+	Category         string    `json:"category" gorm:"uniqueIndex:idx_category_settings_user_category"`
+	ExcludeByDefault bool      `json:"exclude_by_default"`
+	Essential        bool      `json:"essential"` // Needs rather than wants, split apart in the health metrics
+
+	UserID uuid.UUID `json:"user_id" gorm:"uniqueIndex:idx_category_settings_user_category"`
+	User   User      `json:"-"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TaxSetting is the tax configuration of a user: the month their tax year
+// starts on and the categories reported for the tax return, each with the
+// line of the tax form it goes on.
+type TaxSetting struct {
+	ID         uuid.UUID     `json:"id" gorm:"primary_key"`
+	StartMonth int           `json:"start_month" gorm:"default:1"` // Month the tax year starts on, 1 for the calendar year
+	Categories []TaxCategory `json:"categories" gorm:"foreignKey:SettingID"`
+
+	UserID uuid.UUID `json:"user_id" gorm:"uniqueIndex"`
+	User   User      `json:"-"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TaxCategory is a category reported for the tax return.
+type TaxCategory struct {
+	ID       uuid.UUID `json:"id" gorm:"primary_key"`
+	Category string    `json:"category"` // See constants.TRANSACTION_CATEGORIES
+	Label    string    `json:"label"`    // Line of the tax form, like "Donations"
+
+	SettingID uuid.UUID `json:"-" gorm:"index"`
+}
+
+// CustomReportSpec defines a custom report: the metric of the amounts of
+// the transactions matching the filters, dated in the window, by group.
+// Every field is checked against a fixed set of values, the report is never
+// run from raw SQL.
+type CustomReportSpec struct {
+	Metric  string `json:"metric" validate:"required,oneof=sum count avg"`
+	GroupBy string `json:"group_by" validate:"required,oneof=category merchant account month type"`
+
+	Types           []string    `json:"types,omitempty" validate:"max=3,dive,oneof=income expense transfer"` // The expenses when empty
+	Categories      []string    `json:"categories,omitempty" validate:"max=20"`                              // Every category when empty
+	AccountIDs      []uuid.UUID `json:"account_ids,omitempty" validate:"max=20"`                             // Every account when empty
+	Search          string      `json:"search,omitempty" validate:"max=100"`                                 // Matched in the description, case insensitive
+	MinAmount       *Money      `json:"min_amount,omitempty"`
+	MaxAmount       *Money      `json:"max_amount,omitempty"`
+	IncludeExcluded bool        `json:"include_excluded,omitempty"` // Counts the transactions excluded from the budgets
+
+	// Window is the dates of the transactions, the last 90 days when empty;
+	// a custom one runs from From to To excluded
+	Window string     `json:"window,omitempty" validate:"omitempty,oneof=last_30_days last_90_days last_365_days month_to_date year_to_date previous_month previous_year custom"`
+	From   *time.Time `json:"from,omitempty"`
+	To     *time.Time `json:"to,omitempty"`
+
+	Limit int `json:"limit,omitempty" validate:"omitempty,min=1,max=1000"` // Groups returned, 100 when 0
+}
+
+// ReportDefinition is a custom report saved by a user to be run again.
+type ReportDefinition struct {
+	ID         uuid.UUID        `json:"id" gorm:"primary_key"`
+	Name       string           `json:"name"`
+	Definition CustomReportSpec `json:"definition" gorm:"serializer:json;type:jsonb"`
+
+	UserID uuid.UUID `json:"user_id" gorm:"index"`
+	User   User      `json:"-"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ReportSchedule emails a report to its user weekly or monthly, at Hour in
+// their timezone: one of their custom reports, or a canned report. It is
+// paused by the user, or after failing too many times in a row.
+type ReportSchedule struct {
+	ID                 uuid.UUID  `json:"id" gorm:"primary_key"`
+	Report             string     `json:"report"`                            // "custom" or a canned report, see constants.SCHEDULED_REPORTS
+	ReportDefinitionID *uuid.UUID `json:"report_definition_id" gorm:"index"` // The custom report delivered
+	Frequency          string     `json:"frequency"`                         // "weekly" or "monthly"
+	Weekday            int        `json:"weekday"`                           // Day of the weekly ones, 0 is Sunday
+	Day                int        `json:"day"`                               // Day of the month of the monthly ones, up to 28
+	Hour               int        `json:"hour"`                              // Local hour of the delivery
+	Format             string     `json:"format"`                            // "inline" for an HTML table or "csv" for an attachment
+
+	Paused     bool       `json:"paused"`
+	Failures   int        `json:"failures"` // Failed runs in a row
+	LastRunAt  *time.Time `json:"last_run_at"`
+	LastStatus string     `json:"last_status"` // "queued" or "failed", empty before the first run
+	LastError  string     `json:"last_error"`
+	NextRunAt  time.Time  `json:"next_run_at" gorm:"index"`
+
+	UserID uuid.UUID `json:"user_id" gorm:"index"`
+	User   User      `json:"-"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ReportDelivery is a run of a report schedule. The email of a queued run
+// has a delivery record of its own, whose status is EmailStatus.
+type ReportDelivery struct {
+	ID              uuid.UUID  `json:"id" gorm:"primary_key"`
+	ScheduleID      uuid.UUID  `json:"schedule_id" gorm:"index"`
+	UserID          uuid.UUID  `json:"user_id" gorm:"index"`
+	Report          string     `json:"report"`
+	ScheduledAt     time.Time  `json:"scheduled_at"`
+	Status          string     `json:"status"` // "queued" or "failed"
+	Rows            int        `json:"rows"`
+	Attached        bool       `json:"attached"` // The rows were attached as CSV rather than inlined
+	Error           string     `json:"error"`
+	EmailDeliveryID *uuid.UUID `json:"email_delivery_id"`
+	EmailStatus     string     `json:"email_status" gorm:"->;-:migration"` // "queued", "sent" or "failed"
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AnomalyMute silences the large transaction alerts for a merchant, it is
+// created when the user dismisses a flagged transaction.
+type AnomalyMute struct {
+	ID       uuid.UUID `json:"id" gorm:"primary_key"`
+	Merchant string    `json:"merchant" gorm:"uniqueIndex:idx_anomaly_mutes_user_merchant"`
+
+	UserID uuid.UUID `json:"user_id" gorm:"uniqueIndex:idx_anomaly_mutes_user_merchant"`
+	User   User      `json:"-"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Maintenance is the maintenance mode set by the admins, a single row. The
+// MAINTENANCE_MODE configuration applies until it is first set.
+type Maintenance struct {
+	ID      int    `json:"-" gorm:"primaryKey"`
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message"` // Shown to the refused users, a default one when empty
+
+	UpdatedBy *uuid.UUID `json:"updated_by" gorm:"type:uuid"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// FeatureFlagOverride turns a feature flag on or off for a user, over its
+// default and the configuration.
+type FeatureFlagOverride struct {
+	UserID  uuid.UUID `json:"-" gorm:"primaryKey"`
+	Flag    string    `json:"flag" gorm:"primaryKey"`
+	Enabled bool      `json:"enabled"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BillingAccount is the customer of a user at the payment provider and the
+// state of their subscription to the pro plan, as last sent by its webhook.
+type BillingAccount struct {
+	UserID            uuid.UUID  `json:"-" gorm:"primaryKey"`
+	CustomerID        string     `json:"-" gorm:"uniqueIndex"`
+	SubscriptionID    string     `json:"-"`
+	Status            string     `json:"status"` // Of the subscription at the provider, like "active" or "past_due", empty without one
+	CurrentPeriodEnd  *time.Time `json:"current_period_end"`
+	CancelAtPeriodEnd bool       `json:"cancel_at_period_end"`
+	PastDueSince      *time.Time `json:"past_due_since"` // When the payments started failing, the user is downgraded after BILLING_GRACE_DAYS
+	DowngradedAt      *time.Time `json:"downgraded_at"`  // When the user was moved to the free plan for not paying
+	EventAt           time.Time  `json:"-"`              // Creation time of the last event applied, the older ones are ignored
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// WebhookEvent is a webhook event of a provider claimed by a delivery, the
+// deliveries of the same event again are skipped.
+type WebhookEvent struct {
+	Provider string `json:"provider" gorm:"primaryKey"` // "stripe" or "bank_sync"
+	ID       string `json:"id" gorm:"primaryKey"`       // Of the event at the provider
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SyncChange records that a synced entity, a transaction, an account, a
+// budget or a category setting, was created, updated or deleted. The rows
+// are written by triggers in the transaction of the change, with the owners
+// of the entity, then numbered in the order of the commits: Seq is the
+// cursor of the delta sync.
+type SyncChange struct {
+	ID       int64     `json:"-" gorm:"primaryKey;autoIncrement"`
+	Seq      *int64    `json:"seq" gorm:"uniqueIndex"`                   // Set once the transactions that could commit before it finished
+	TxID     string    `json:"-" gorm:"column:tx_id;type:xid8;not null"` // Transaction that wrote the change
+	Entity   string    `json:"entity"`                                   // "transaction", "account", "budget" or "category"
+	EntityID uuid.UUID `json:"entity_id"`
+
+	UserID        *uuid.UUID `json:"user_id" gorm:"type:uuid"`
+	BankAccountID *uuid.UUID `json:"bank_account_id" gorm:"type:uuid"`
+	HouseholdID   *uuid.UUID `json:"household_id" gorm:"type:uuid"`
+
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// NotificationPreference tells on which channels a user is notified of an
+// event. Events without a stored preference use the defaults.
+type NotificationPreference struct {
+	UserID uuid.UUID `json:"-" gorm:"primaryKey"`
+	Event  string    `json:"event" gorm:"primaryKey"`
+	InApp  bool      `json:"in_app"`
+	Email  bool      `json:"email"`
+	Push   bool      `json:"push"`
+
+	// Locked lists the channels the user cannot turn off for the event
+	Locked []string `json:"locked,omitempty" gorm:"-"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// EmailDelivery records an email handed to the mail queue and what became
+// of it, to debug delivery problems.
+type EmailDelivery struct {
+	ID        uuid.UUID  `json:"id" gorm:"primary_key"`
+	UserID    *uuid.UUID `json:"user_id" gorm:"index"`
+	Recipient string     `json:"recipient"`
+	Template  string     `json:"template"`
+	Subject   string     `json:"subject"`
+	Status    string     `json:"status"` // "queued", "sent" or "failed"
+	Attempts  int        `json:"attempts"`
+	LastError string     `json:"last_error"`
+	SentAt    *time.Time `json:"sent_at"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// KnownDevice is a device the user logged in from, identified by a hash of
+// its user agent. Logging in from an unknown device notifies the user.
+type KnownDevice struct {
+	ID          uuid.UUID `json:"id" gorm:"primary_key"`
+	Fingerprint string    `json:"-" gorm:"uniqueIndex:idx_known_devices_user_fingerprint"`
+	UserAgent   string    `json:"user_agent"`
+
+	UserID uuid.UUID `json:"user_id" gorm:"uniqueIndex:idx_known_devices_user_fingerprint"`
+	User   User      `json:"-"`
+
+	LastSeenAt time.Time `json:"last_seen_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// PushSubscription is the Web Push subscription of a browser of the user,
+// the keys encrypt the payloads for it (RFC 8291).
+type PushSubscription struct {
 	ID        uuid.UUID `json:"id" gorm:"primary_key"`
-	Category  string    `json:"category"`
-	Amount    float64   `json:"amount"`
-	StartDate time.Time `json:"start_date"`
-	EndDate   time.Time `json:"end_date"`
+	Endpoint  string    `json:"endpoint" gorm:"uniqueIndex"`
+	P256dh    string    `json:"-"`
+	Auth      string    `json:"-"`
+	UserAgent string    `json:"user_agent"`
 
-	UserID uuid.UUID `json:"user_id"`
-	User   User      `json:"user"`
+	UserID uuid.UUID `json:"user_id" gorm:"index"`
+	User   User      `json:"-"`
 
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
-	DeletedAt time.Time `json:"deleted_at"`
 }
 
 type Notification struct {
 	ID       uuid.UUID `json:"id" gorm:"primary_key"`
 	Type     string    `json:"type"`
 	Message  string    `json:"message"`
-	IsActive bool      `json:"is_active"`
+	IsActive bool      `json:"is_active" gorm:"index:idx_notifications_user_active,priority:2"`
 
-	UserID uuid.UUID `json:"user_id"`
+	Payload json.RawMessage `json:"payload,omitempty" gorm:"type:jsonb"` // Details of the event, depending on the type
+
+	UserID uuid.UUID `json:"user_id" gorm:"index:idx_notifications_user_active,priority:1"`
 	User   User      `json:"user"`
 
 	CreatedAt time.Time `json:"created_at"`
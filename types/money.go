@@ -0,0 +1,343 @@
+package types
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrCurrencyMismatch is returned by the arithmetic of amounts of
+	// different currencies, which must be converted first.
+	ErrCurrencyMismatch = errors.New("amounts of different currencies")
+	// ErrMoneyPrecision is returned for an amount finer than the minor unit
+	// of its currency, like "12.345" euros.
+	ErrMoneyPrecision = errors.New("amount finer than the minor unit of its currency")
+	// ErrMoneyOverflow is returned for an amount out of the range of the
+	// minor units.
+	ErrMoneyOverflow = errors.New("amount out of range")
+)
+
+// decimalPattern matches the decimal amounts, with the exponents of the JSON
+// numbers but not the fractions and bases big.Rat would parse.
+var decimalPattern = regexp.MustCompile(`^[+-]?(\d+(\.\d*)?|\.\d+)([eE][+-]?\d{1,2})?$`)
+
+// unboundDigits is the number of minor digits of an amount without a
+// currency, the finest minor unit of ISO 4217: the amounts read from the
+// database are bound to the currency of their account later, if ever.
+const unboundDigits = 4
+
+// currencyDigits lists the ISO 4217 currencies whose minor unit is not the
+// hundredth.
+var currencyDigits = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0,
+	"PYG": 0, "RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// CurrencyDigits returns the number of decimals of the minor unit of the
+// currency: 2 unless listed, 4 without a currency.
+func CurrencyDigits(currency string) int {
+	if currency == "" {
+		return unboundDigits
+	}
+	if digits, ok := currencyDigits[currency]; ok {
+		return digits
+	}
+	return 2
+}
+
+// CurrencyDigitsSQL returns the SQL of the number of decimals of the minor
+// unit of the currency of the column, 2 for an empty one.
+func CurrencyDigitsSQL(column string) string {
+	byDigits := map[int][]string{}
+	for currency, digits := range currencyDigits {
+		byDigits[digits] = append(byDigits[digits], "'"+currency+"'")
+	}
+	sql := "CASE"
+	for _, digits := range []int{0, 3} {
+		codes := byDigits[digits]
+		sort.Strings(codes)
+		sql += fmt.Sprintf(" WHEN %s IN (%s) THEN %d", column, strings.Join(codes, ", "), digits)
+	}
+	return sql + " ELSE 2 END"
+}
+
+// Money is an amount of a currency in integer minor units, like 1234 for
+// 12.34 EUR. Amounts without a currency, read from the database or a
+// request before the account is known, are in ten-thousandths.
+//
+// It is marshaled to JSON as a decimal string, like "12.34", and stored as
+// a numeric. JSON numbers are still accepted while the clients move to
+// strings, they are read from their decimal text, never as floats.
+type Money struct {
+	Minor    int64
+	Currency string
+}
+
+// NewMoney returns minor units of the currency.
+func NewMoney(minor int64, currency string) Money {
+	return Money{Minor: minor, Currency: currency}
+}
+
+// ParseMoney parses a decimal amount of the currency, like "-12.34". It
+// refuses the amounts finer than the minor unit of the currency.
+func ParseMoney(s, currency string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if !decimalPattern.MatchString(s) {
+		return Money{}, fmt.Errorf("invalid amount %q", s)
+	}
+	value, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return Money{}, fmt.Errorf("invalid amount %q", s)
+	}
+	value.Mul(value, new(big.Rat).SetInt(scale(CurrencyDigits(currency))))
+	if !value.IsInt() {
+		return Money{}, ErrMoneyPrecision
+	}
+	if !value.Num().IsInt64() {
+		return Money{}, ErrMoneyOverflow
+	}
+	return Money{Minor: value.Num().Int64(), Currency: currency}, nil
+}
+
+// MoneyFromFloat rounds a float amount of the currency to its minor unit,
+// half away from zero. It is meant for the amounts computed as floats, like
+// the rates of a conversion.
+func MoneyFromFloat(amount float64, currency string) Money {
+	minor := math.Round(amount * math.Pow10(CurrencyDigits(currency)))
+	// A float is exact up to 2^53, far below the range of the minor units
+	return Money{Minor: int64(minor), Currency: currency}
+}
+
+// Float64 returns the amount as a float, for the ratios and the reports
+// computed as floats.
+func (m Money) Float64() float64 {
+	return float64(m.Minor) / math.Pow10(CurrencyDigits(m.Currency))
+}
+
+// String returns the decimal amount, like "-12.34", with every decimal of
+// the minor unit of its currency. An amount without a currency has at least
+// 2 decimals.
+func (m Money) String() string {
+	digits := CurrencyDigits(m.Currency)
+	s := new(big.Rat).SetFrac(big.NewInt(m.Minor), scale(digits)).FloatString(digits)
+	if m.Currency == "" {
+		s = strings.TrimRight(s, "0")
+		if dot := strings.IndexByte(s, '.'); len(s)-dot-1 < 2 {
+			s += strings.Repeat("0", 2-(len(s)-dot-1))
+		}
+	}
+	return s
+}
+
+// IsZero reports whether the amount is zero.
+func (m Money) IsZero() bool {
+	return m.Minor == 0
+}
+
+// Sign returns -1, 0 or 1 for a negative, zero or positive amount.
+func (m Money) Sign() int {
+	switch {
+	case m.Minor < 0:
+		return -1
+	case m.Minor > 0:
+		return 1
+	}
+	return 0
+}
+
+// Neg returns the opposite amount.
+func (m Money) Neg() Money {
+	return Money{Minor: -m.Minor, Currency: m.Currency}
+}
+
+// Add returns the sum of the amounts, which must be of the same currency.
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.currencyName(), other.currencyName())
+	}
+	sum := m.Minor + other.Minor
+	if (sum > m.Minor) != (other.Minor > 0) {
+		return Money{}, ErrMoneyOverflow
+	}
+	return Money{Minor: sum, Currency: m.Currency}, nil
+}
+
+// Sub returns the difference of the amounts, which must be of the same
+// currency.
+func (m Money) Sub(other Money) (Money, error) {
+	if other.Minor == math.MinInt64 {
+		return Money{}, ErrMoneyOverflow
+	}
+	return m.Add(other.Neg())
+}
+
+// Cmp compares the amounts, which must be of the same currency: -1 if m is
+// smaller, 0 if equal, 1 if larger.
+func (m Money) Cmp(other Money) (int, error) {
+	if m.Currency != other.Currency {
+		return 0, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.currencyName(), other.currencyName())
+	}
+	switch {
+	case m.Minor < other.Minor:
+		return -1, nil
+	case m.Minor > other.Minor:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// SumMoney returns the sum of the amounts, of the currency of the first
+// one. The sum of no amount is zero without a currency.
+func SumMoney(amounts ...Money) (Money, error) {
+	if len(amounts) == 0 {
+		return Money{}, nil
+	}
+	sum := Money{Currency: amounts[0].Currency}
+	for _, amount := range amounts {
+		var err error
+		if sum, err = sum.Add(amount); err != nil {
+			return Money{}, err
+		}
+	}
+	return sum, nil
+}
+
+// Mul returns the amount multiplied by the ratio, rounded to its minor unit
+// half away from zero, like the share of an amount given by a percentage.
+func (m Money) Mul(ratio float64) Money {
+	return Money{Minor: int64(math.Round(float64(m.Minor) * ratio)), Currency: m.Currency}
+}
+
+// Round rounds an amount without a currency to the minor unit of the
+// currency, half away from zero, and keeps it without a currency: the
+// amounts computed from ratios, like an average, are then whole amounts of
+// the currency they are stated in. An amount of a currency is returned as
+// is.
+func (m Money) Round(currency string) Money {
+	if m.Currency != "" {
+		return m
+	}
+	unit := scale(unboundDigits - CurrencyDigits(currency)).Int64()
+	minor, rest := m.Minor/unit, m.Minor%unit
+	if 2*rest >= unit {
+		minor++
+	} else if 2*rest <= -unit {
+		minor--
+	}
+	return Money{Minor: minor * unit}
+}
+
+// In binds an amount without a currency to the currency, in its minor
+// units. It refuses an amount finer than them, and an amount of another
+// currency, which must be converted.
+func (m Money) In(currency string) (Money, error) {
+	if m.Currency == currency {
+		return m, nil
+	}
+	if m.Currency != "" {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.currencyName(), currency)
+	}
+	return ParseMoney(m.String(), currency)
+}
+
+// Unbound returns the amount without its currency, in ten-thousandths, to
+// be combined with the amounts read from the database.
+func (m Money) Unbound() Money {
+	if m.Currency == "" {
+		return m
+	}
+	unbound, err := ParseMoney(m.String(), "")
+	if err != nil {
+		// Only the amounts past a hundred trillion units cannot be unbound
+		panic(err)
+	}
+	return unbound
+}
+
+func (m Money) currencyName() string {
+	if m.Currency == "" {
+		return "no currency"
+	}
+	return m.Currency
+}
+
+// MarshalJSON marshals the amount as a decimal string.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+// UnmarshalJSON reads a decimal string or, during the deprecation of the
+// numbers, a JSON number. The amount is without a currency until bound to
+// the currency of its account.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	text := string(data)
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+	}
+	amount, err := ParseMoney(text, "")
+	if err != nil {
+		return err
+	}
+	*m = amount
+	return nil
+}
+
+// Scan reads a numeric column, without a currency.
+func (m *Money) Scan(src interface{}) error {
+	var text string
+	switch value := src.(type) {
+	case nil:
+		*m = Money{}
+		return nil
+	case []byte:
+		text = string(value)
+	case string:
+		text = value
+	case int64:
+		text = strconv.FormatInt(value, 10)
+	case float64:
+		// Only the float columns of the installations before the migration
+		*m = MoneyFromFloat(value, "")
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into an amount", src)
+	}
+	amount, err := ParseMoney(text, "")
+	if err != nil {
+		return err
+	}
+	*m = amount
+	return nil
+}
+
+// Value stores the amount as its decimal string, cast to a numeric by the
+// database.
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// GormDataType stores the amounts as numerics, exact unlike floats.
+func (Money) GormDataType() string {
+	return "numeric"
+}
+
+// scale returns 10^digits.
+func scale(digits int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil)
+}
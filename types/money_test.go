@@ -0,0 +1,227 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"math/big"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
+	"testing/quick"
+)
+
+// moneyCurrencies covers the minor units of 0, 2 and 3 decimals, and the
+// amounts without a currency.
+var moneyCurrencies = []string{"JPY", "EUR", "USD", "KWD", ""}
+
+// randomMoney is a quick generator of amounts far from the overflows.
+type randomMoney Money
+
+func (randomMoney) Generate(random *rand.Rand, _ int) reflect.Value {
+	minor := random.Int63n(2_000_000_000_000) - 1_000_000_000_000
+	if random.Intn(4) == 0 {
+		// Small amounts, where the decimals are the most likely to go wrong
+		minor = random.Int63n(2001) - 1000
+	}
+	return reflect.ValueOf(randomMoney{Minor: minor, Currency: moneyCurrencies[random.Intn(len(moneyCurrencies))]})
+}
+
+func TestMoneyStringRoundTrip(t *testing.T) {
+	roundTrip := func(r randomMoney) bool {
+		m := Money(r)
+		parsed, err := ParseMoney(m.String(), m.Currency)
+		return err == nil && parsed == m
+	}
+	if err := quick.Check(roundTrip, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMoneyJSONRoundTrip(t *testing.T) {
+	roundTrip := func(r randomMoney) bool {
+		m := Money(r)
+		data, err := json.Marshal(m)
+		if err != nil {
+			return false
+		}
+		var decoded Money
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			return false
+		}
+		// The currency is not part of the JSON, the account carries it
+		bound, err := decoded.In(m.Currency)
+		return err == nil && bound == m && decoded.Float64() == m.Float64()
+	}
+	if err := quick.Check(roundTrip, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMoneyJSONNumbersAreDeprecatedButRead(t *testing.T) {
+	// The number is read from its text, not through a float
+	var fromNumber, fromString Money
+	if err := json.Unmarshal([]byte(`1234567890123.45`), &fromNumber); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(`"1234567890123.45"`), &fromString); err != nil {
+		t.Fatal(err)
+	}
+	if fromNumber != fromString || fromNumber.String() != "1234567890123.45" {
+		t.Errorf("expected the number read exactly; got %s and %s", fromNumber, fromString)
+	}
+
+	for _, invalid := range []string{`"12,34"`, `"1/3"`, `"0x10"`, `"1e400"`, `"12.34 EUR"`, `true`, `""`} {
+		var m Money
+		if err := json.Unmarshal([]byte(invalid), &m); err == nil {
+			t.Errorf("%s: expected an error; got %s", invalid, m)
+		}
+	}
+}
+
+func TestMoneySum(t *testing.T) {
+	sum := func(amounts []randomMoney, currency uint8) bool {
+		// The amounts of one currency, summed in two orders
+		code := moneyCurrencies[int(currency)%len(moneyCurrencies)]
+		forward := make([]Money, len(amounts))
+		expected := new(big.Int)
+		for i, amount := range amounts {
+			forward[i] = Money{Minor: amount.Minor, Currency: code}
+			expected.Add(expected, big.NewInt(amount.Minor))
+		}
+		backward := make([]Money, len(forward))
+		for i := range forward {
+			backward[len(forward)-1-i] = forward[i]
+		}
+
+		total, err := SumMoney(forward...)
+		if err != nil {
+			return false
+		}
+		reversed, err := SumMoney(backward...)
+		if err != nil {
+			return false
+		}
+		return total.Minor == expected.Int64() && total == reversed && (len(amounts) == 0 || total.Currency == code)
+	}
+	if err := quick.Check(sum, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMoneySubUndoesAdd(t *testing.T) {
+	undo := func(a, b randomMoney) bool {
+		b.Currency = a.Currency
+		sum, err := Money(a).Add(Money(b))
+		if err != nil {
+			return false
+		}
+		difference, err := sum.Sub(Money(b))
+		return err == nil && difference == Money(a)
+	}
+	if err := quick.Check(undo, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMoneyRound(t *testing.T) {
+	rounding := func(r randomMoney, currency uint8) bool {
+		// An unbound amount rounded to the minor unit of a currency
+		amount := Money{Minor: r.Minor}
+		code := moneyCurrencies[int(currency)%len(moneyCurrencies)]
+		rounded := amount.Round(code)
+		if _, err := rounded.In(code); err != nil || rounded.Round(code) != rounded {
+			return false
+		}
+		// Off by at most half a minor unit
+		half := scale(unboundDigits-CurrencyDigits(code)).Int64() / 2
+		difference := rounded.Minor - amount.Minor
+		return rounded.Currency == "" && max(difference, -difference) <= max(half, 0)
+	}
+	if err := quick.Check(rounding, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMoneyMul(t *testing.T) {
+	product := func(r randomMoney, ratio float64) bool {
+		amount := Money(r)
+		if amount.Mul(1) != amount || amount.Mul(-1) != amount.Neg() || !amount.Mul(0).IsZero() {
+			return false
+		}
+		// Rounded to the minor unit, within half of it give or take the
+		// precision of the float product
+		ratio = math.Mod(ratio, 10)
+		exact := new(big.Float).Mul(new(big.Float).SetInt64(amount.Minor), big.NewFloat(ratio))
+		difference, _ := exact.Sub(exact, new(big.Float).SetInt64(amount.Mul(ratio).Minor)).Float64()
+		return amount.Mul(ratio).Currency == amount.Currency && math.Abs(difference) <= 0.51
+	}
+	if err := quick.Check(product, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMoneyDecimalsAreExact(t *testing.T) {
+	// 0.1 + 0.2 is 0.30000000000000004 in floats
+	a, _ := ParseMoney("0.1", "EUR")
+	b, _ := ParseMoney("0.2", "EUR")
+	sum, err := a.Add(b)
+	if err != nil || sum.String() != "0.30" {
+		t.Errorf("expected 0.30; got %s, %v", sum, err)
+	}
+
+	// A float rounded to the cent matches the decimal text
+	rounding := func(cents int32) bool {
+		text := strconv.FormatFloat(float64(cents)/100, 'f', 2, 64)
+		parsed, err := ParseMoney(text, "EUR")
+		return err == nil && MoneyFromFloat(float64(cents)/100, "EUR") == parsed && parsed.Minor == int64(cents)
+	}
+	if err := quick.Check(rounding, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMoneyRefusesCrossCurrency(t *testing.T) {
+	euros := NewMoney(1000, "EUR")
+	dollars := NewMoney(1000, "USD")
+	if _, err := euros.Add(dollars); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("expected a currency mismatch; got %v", err)
+	}
+	if _, err := euros.Cmp(dollars); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("expected a currency mismatch; got %v", err)
+	}
+	if _, err := SumMoney(euros, euros, dollars); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("expected a currency mismatch; got %v", err)
+	}
+	if _, err := euros.In("USD"); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("expected a currency mismatch; got %v", err)
+	}
+}
+
+func TestMoneyPrecision(t *testing.T) {
+	tests := []struct {
+		amount, currency string
+		minor            int64
+		err              error
+	}{
+		{"12.34", "EUR", 1234, nil},
+		{"-12.3", "EUR", -1230, nil},
+		{"12.345", "EUR", 0, ErrMoneyPrecision},
+		{"1500", "JPY", 1500, nil},
+		{"1500.5", "JPY", 0, ErrMoneyPrecision},
+		{"1.234", "KWD", 1234, nil},
+		{"1.2345", "", 12345, nil},
+		{"92233720368547758.08", "EUR", 0, ErrMoneyOverflow},
+	}
+	for _, tt := range tests {
+		m, err := ParseMoney(tt.amount, tt.currency)
+		if !errors.Is(err, tt.err) || (err == nil && m.Minor != tt.minor) {
+			t.Errorf("%s %s: expected %d, %v; got %d, %v", tt.amount, tt.currency, tt.minor, tt.err, m.Minor, err)
+		}
+	}
+
+	if _, err := NewMoney(9223372036854775807, "EUR").Add(NewMoney(1, "EUR")); !errors.Is(err, ErrMoneyOverflow) {
+		t.Errorf("expected an overflow; got %v", err)
+	}
+}
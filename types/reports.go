@@ -0,0 +1,938 @@
+package types
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SpendingPatternBucket holds the spending aggregated over one bucket of a
+// spending pattern report (a day of the week or a day of the month).
+type SpendingPatternBucket struct {
+	Bucket  int   `json:"bucket" csv:"bucket"`
+	Total   Money `json:"total" csv:"total"`
+	Average Money `json:"average" csv:"average"`
+	Count   int   `json:"count" csv:"count"`
+}
+
+// SpendingPatterns is the response of the spending pattern report.
+// ByWeekday buckets go from 0 (Sunday) to 6 (Saturday), ByDayOfMonth from 1 to 31.
+type SpendingPatterns struct {
+	From         time.Time               `json:"from"`
+	To           time.Time               `json:"to"`
+	Timezone     string                  `json:"timezone"`
+	Currency     string                  `json:"currency"`
+	ByWeekday    []SpendingPatternBucket `json:"by_weekday"`
+	ByDayOfMonth []SpendingPatternBucket `json:"by_day_of_month"`
+	// Excluded sums the expenses of the range left out of the report because
+	// they are excluded from the budgets
+	Excluded ExcludedSpending `json:"excluded"`
+}
+
+// ExcludedSpending sums the expenses excluded from the budgets, so that the
+// totals of a report can be explained.
+type ExcludedSpending struct {
+	Total Money `json:"total"`
+	Count int   `json:"count"`
+}
+
+// CategoryStatistics summarizes the past expenses of a category, it is used
+// to detect unusually large transactions.
+type CategoryStatistics struct {
+	Count  int   `json:"count"`
+	Mean   Money `json:"mean"`
+	StdDev Money `json:"stddev"`
+}
+
+// AdminStats is the overview of the instance given to the admins.
+type AdminStats struct {
+	Users             int64 `json:"users"`
+	Transactions      int64 `json:"transactions"`
+	DatabaseSizeBytes int64 `json:"database_size_bytes"`
+	// ActiveSessions counts the devices seen within the lifetime of a
+	// refresh token
+	ActiveSessions int64 `json:"active_sessions"`
+}
+
+// ExportSchemaVersion is the version of the format of the user exports and
+// of the backups, bumped when the tables change in a way a document of the
+// previous version cannot be read into.
+const ExportSchemaVersion = 1
+
+// UserExport is the data owned by a user, exported as one document.
+type UserExport struct {
+	SchemaVersion           int                      `json:"schema_version"`
+	ExportedAt              time.Time                `json:"exported_at"`
+	User                    User                     `json:"user"`
+	BankAccounts            []BankAccount            `json:"bank_accounts"`
+	Transactions            []Transaction            `json:"transactions"`
+	Budgets                 []Budget                 `json:"budgets"`
+	BudgetTemplates         []BudgetTemplate         `json:"budget_templates"`
+	Goals                   []Goal                   `json:"goals"`
+	Bills                   []Bill                   `json:"bills"`
+	AllocationRules         []AllocationRule         `json:"allocation_rules"`
+	CategorySettings        []CategorySetting        `json:"category_settings"`
+	NotificationPreferences []NotificationPreference `json:"notification_preferences"`
+	Notifications           []Notification           `json:"notifications"`
+	Subscriptions           []Subscription           `json:"subscriptions"`
+	ReportDefinitions       []ReportDefinition       `json:"report_definitions"`
+	ReportSchedules         []ReportSchedule         `json:"report_schedules"`
+	KnownDevices            []KnownDevice            `json:"known_devices"`
+	ShareGrants             []ShareGrant             `json:"share_grants"`
+	AuditLogs               []AuditLog               `json:"audit_logs"` // Sensitive changes made by the user
+}
+
+// RestoreSummary describes a restored backup: its version, when it was
+// taken and the rows restored per table.
+type RestoreSummary struct {
+	SchemaVersion int              `json:"schema_version"`
+	BackedUpAt    time.Time        `json:"backed_up_at"`
+	Rows          map[string]int64 `json:"rows"`
+}
+
+// SettingsExport is the portable document of the settings of a user, to
+// carry them to another instance: their preferences and what they
+// configured, without their transactions nor any ID. The categories are
+// referenced by name.
+type SettingsExport struct {
+	Version                 int                      `json:"version"`
+	ExportedAt              time.Time                `json:"exported_at"`
+	Preferences             SettingsPreferences      `json:"preferences"`
+	Categories              []SettingsCategory       `json:"categories"`
+	Tax                     *SettingsTax             `json:"tax"` // Nil without a tax configuration
+	MutedMerchants          []string                 `json:"muted_merchants"`
+	BudgetTemplates         []SettingsBudgetTemplate `json:"budget_templates"`
+	NotificationPreferences []SettingsNotification   `json:"notification_preferences"`
+}
+
+// SettingsPreferences are the preferences of the user, empty when left to
+// the default.
+type SettingsPreferences struct {
+	Timezone      string `json:"timezone,omitempty"`
+	Locale        string `json:"locale,omitempty"`
+	BaseCurrency  string `json:"base_currency,omitempty"`
+	BudgetingMode string `json:"budgeting_mode,omitempty"`
+}
+
+// SettingsCategory is the setting of a category.
+type SettingsCategory struct {
+	Category         string `json:"category"`
+	ExcludeByDefault bool   `json:"exclude_by_default"`
+	Essential        bool   `json:"essential"`
+}
+
+// SettingsTax is the tax configuration.
+type SettingsTax struct {
+	StartMonth int                   `json:"start_month"`
+	Categories []SettingsTaxCategory `json:"categories"`
+}
+
+// SettingsTaxCategory is a category reported for the tax return.
+type SettingsTaxCategory struct {
+	Category string `json:"category"`
+	Label    string `json:"label"`
+}
+
+// SettingsBudgetTemplate is a budget template with its items.
+type SettingsBudgetTemplate struct {
+	Name  string                       `json:"name"`
+	Items []SettingsBudgetTemplateItem `json:"items"`
+}
+
+// SettingsBudgetTemplateItem is a budget saved in a template.
+type SettingsBudgetTemplateItem struct {
+	Name              string     `json:"name"`
+	Categories        Categories `json:"categories"`
+	ExcludeCategories bool       `json:"exclude_categories"`
+	Amount            Money      `json:"amount"`
+	Rollover          bool       `json:"rollover"`
+	AlertThresholds   Thresholds `json:"alert_thresholds"`
+	RearmAlerts       bool       `json:"rearm_alerts"`
+}
+
+// SettingsNotification is the channels of a notification event.
+type SettingsNotification struct {
+	Event string `json:"event"`
+	InApp bool   `json:"in_app"`
+	Email bool   `json:"email"`
+	Push  bool   `json:"push"`
+}
+
+// SettingsImport is what an import of settings writes, resolved against the
+// settings of the user. The rows are complete, with their IDs and their
+// user.
+type SettingsImport struct {
+	Preferences             map[string]any // Columns of the user updated
+	Categories              []CategorySetting
+	Tax                     *TaxSetting
+	MutedMerchants          []string
+	BudgetTemplates         []BudgetTemplate
+	ReplacedTemplateIDs     []uuid.UUID // Templates overwritten by one of BudgetTemplates, deleted first
+	NotificationPreferences []NotificationPreference
+}
+
+// SettingsImportResult lists what an import of settings changes, or would
+// change on a dry run.
+type SettingsImportResult struct {
+	DryRun   bool             `json:"dry_run"`
+	Strategy string           `json:"strategy"`
+	Changes  []SettingsChange `json:"changes"`
+}
+
+// SettingsChange is what an import does with one setting.
+type SettingsChange struct {
+	Kind   string `json:"kind"`             // "preference", "category", "tax", "muted_merchant", "budget_template" or "notification_preference"
+	Key    string `json:"key"`              // Name of the setting, like the category or the template
+	Action string `json:"action"`           // "create", "update", "rename", "skip" or "unchanged"
+	Name   string `json:"name,omitempty"`   // New name of a renamed template
+	Reason string `json:"reason,omitempty"` // Why it is skipped: "exists", "unknown_category", "unknown_event" or "invalid"
+}
+
+// SyncPage is the entities changed after a cursor of the delta sync, as
+// they are now, and the ones deleted since.
+type SyncPage struct {
+	Cursor       int64
+	HasMore      bool
+	Transactions []Transaction
+	Accounts     []BankAccount
+	Budgets      []Budget
+	Categories   []CategorySetting
+	Deleted      []SyncTombstone
+}
+
+// SyncTombstone is an entity deleted, or no longer visible to the user.
+type SyncTombstone struct {
+	Entity string    `json:"entity"` // "transaction", "account", "budget" or "category"
+	ID     uuid.UUID `json:"id"`
+}
+
+// BalanceDrift compares the stored balance of an account with the balance
+// computed from its transactions.
+type BalanceDrift struct {
+	AccountID uuid.UUID `json:"account_id"`
+	Stored    Money     `json:"stored"`
+	Computed  Money     `json:"computed"`
+}
+
+// AccountMonthlyFlow is the net amount that entered (positive) or left
+// (negative) an account during a month.
+type AccountMonthlyFlow struct {
+	AccountID uuid.UUID `json:"account_id"`
+	Month     time.Time `json:"month"`
+	Net       Money     `json:"net"`
+}
+
+// MissingExchangeRate is a currency and a UTC day the conversions of the
+// reports have no stored rate for yet.
+type MissingExchangeRate struct {
+	Currency string
+	Day      time.Time
+}
+
+// NetWorthPoint is the net worth at the end of a month.
+type NetWorthPoint struct {
+	Month    time.Time `json:"month" csv:"month"`
+	NetWorth Money     `json:"net_worth" csv:"net_worth"`
+}
+
+// NetWorth is the response of the net worth report.
+type NetWorth struct {
+	Currency    string          `json:"currency"`
+	Current     Money           `json:"current"`
+	Assets      Money           `json:"assets"`
+	Liabilities Money           `json:"liabilities"`
+	History     []NetWorthPoint `json:"history"`
+}
+
+// CashFlowBucket is the income and the expenses of a month or a week of the
+// cash flow report, and the net since the start of the report.
+type CashFlowBucket struct {
+	Start         time.Time `json:"start" csv:"start" xlsx:"date"`
+	Income        Money     `json:"income" csv:"income" xlsx:"amount"`
+	Expenses      Money     `json:"expenses" csv:"expenses" xlsx:"amount"`
+	Net           Money     `json:"net" csv:"net" xlsx:"amount"`
+	CumulativeNet Money     `json:"cumulative_net" csv:"cumulative_net" xlsx:"amount"`
+}
+
+// CashFlow is the response of the cash flow report. The buckets cover
+// [From, To) without gaps, the empty ones are zero.
+type CashFlow struct {
+	From        time.Time        `json:"from"`
+	To          time.Time        `json:"to"`
+	Granularity string           `json:"granularity"` // "month" or "week", starting on Monday
+	Timezone    string           `json:"timezone"`
+	Currency    string           `json:"currency"`
+	Buckets     []CashFlowBucket `json:"buckets"`
+}
+
+// YearOverYearMonth is a month of the year over year report: the value of
+// the metric in each year, and its change in percent from the previous year
+// of the report. The values are null for the months not covered by the
+// history, or not compared yet in the current year, the changes when either
+// value is null or the previous one is zero. Both are keyed by year.
+type YearOverYearMonth struct {
+	Month   int                 `json:"month"` // 1 to 12, or 0 for the year to date
+	Values  map[string]*Money   `json:"values"`
+	Changes map[string]*float64 `json:"changes"`
+}
+
+// YearOverYear is the response of the year over year report. The year to
+// date sums the months compared in every year: up to the last completed
+// month when the current year is part of the report.
+type YearOverYear struct {
+	Metric          string              `json:"metric"` // "expenses", "income" or "net"
+	Category        string              `json:"category,omitempty"`
+	Years           []int               `json:"years"`
+	Timezone        string              `json:"timezone"`
+	Currency        string              `json:"currency"`
+	ComparedMonths  int                 `json:"compared_months"` // Months of the year to date
+	IncludesCurrent bool                `json:"includes_current"`
+	Months          []YearOverYearMonth `json:"months"`
+	YearToDate      YearOverYearMonth   `json:"year_to_date"`
+}
+
+// CategoryMonthTotal sums the expenses of a category over a month.
+type CategoryMonthTotal struct {
+	Category string    `json:"category"`
+	Month    time.Time `json:"month"`
+	Total    Money     `json:"total"`
+	Count    int       `json:"count"`
+}
+
+// CategoryTrendPoint is a month of the spending of a category, with the
+// average of the three months ending with it.
+type CategoryTrendPoint struct {
+	Month          time.Time `json:"month" csv:"month"`
+	Total          Money     `json:"total" csv:"total"`
+	Count          int       `json:"count" csv:"count"`
+	RollingAverage Money     `json:"rolling_average" csv:"rolling_average"`
+}
+
+// CategoryTrendSeries is the spending of a category month by month. Slope is
+// the change per month of the linear trend, SlopePercent the same relative
+// to the monthly average, null when nothing was spent. The series lumping
+// the categories out of the top has Other set and lists them.
+type CategoryTrendSeries struct {
+	Category     string               `json:"category"`
+	Other        bool                 `json:"other,omitempty"`
+	Categories   []string             `json:"categories,omitempty"`
+	Total        Money                `json:"total"`
+	Slope        Money                `json:"slope"`
+	SlopePercent *float64             `json:"slope_percent"`
+	Points       []CategoryTrendPoint `json:"points"`
+}
+
+// CategoryTrend is the response of the category trend report.
+type CategoryTrend struct {
+	From     time.Time             `json:"from"`
+	To       time.Time             `json:"to"`
+	Timezone string                `json:"timezone"`
+	Currency string                `json:"currency"`
+	Series   []CategoryTrendSeries `json:"series"`
+}
+
+// MerchantSpending sums the expenses at a merchant, grouped by the
+// normalized description of the transactions. Cadence is "monthly" or
+// "weekly" when the charges are roughly periodic, like a subscription.
+type MerchantSpending struct {
+	Merchant  string    `json:"merchant" csv:"merchant"`
+	Total     Money     `json:"total" csv:"total"`
+	Count     int       `json:"count" csv:"count"`
+	Average   Money     `json:"average" csv:"average"`
+	FirstSeen time.Time `json:"first_seen" csv:"first_seen"`
+	LastSeen  time.Time `json:"last_seen" csv:"last_seen"`
+	Recurring bool      `json:"recurring" csv:"recurring"`
+	Cadence   *string   `json:"cadence" csv:"cadence"`
+}
+
+// MerchantReport is a page of the merchants of the merchant report, ranked
+// by total spent. Total counts the merchants of every page.
+type MerchantReport struct {
+	From      time.Time          `json:"from"`
+	To        time.Time          `json:"to"`
+	Currency  string             `json:"currency"`
+	Total     int64              `json:"total"`
+	Limit     int                `json:"limit"`
+	Offset    int                `json:"offset"`
+	Merchants []MerchantSpending `json:"merchants"`
+}
+
+// FlowTotal sums the transactions of a type between an account and a
+// counterpart: the source of an income, the category of an expense, or the
+// account credited by a transfer.
+type FlowTotal struct {
+	Type        string    `json:"type"`
+	AccountID   uuid.UUID `json:"account_id"`
+	Counterpart string    `json:"counterpart"`
+	Total       Money     `json:"total"`
+}
+
+// FlowNode is a node of the flows: an income source, an account, an expense
+// category, or the net saved or drawn over the range, of kind "balance".
+// The nodes merging the small flows have Other set and list their labels.
+type FlowNode struct {
+	ID     string   `json:"id"`
+	Kind   string   `json:"kind"`
+	Label  string   `json:"label"`
+	Total  Money    `json:"total"`
+	Other  bool     `json:"other,omitempty"`
+	Merged []string `json:"merged,omitempty"`
+}
+
+// FlowLink is a weighted link between two nodes of the flows, of kind
+// "income", "expense", "transfer" or "balance".
+type FlowLink struct {
+	Source string `json:"source" csv:"source"`
+	Target string `json:"target" csv:"target"`
+	Kind   string `json:"kind" csv:"kind"`
+	Value  Money  `json:"value" csv:"value"`
+}
+
+// Flows is the response of the flows report, ready for a Sankey diagram.
+// The income plus the net drawn equals the expenses plus the net saved.
+type Flows struct {
+	From       time.Time  `json:"from"`
+	To         time.Time  `json:"to"`
+	Currency   string     `json:"currency"`
+	MinPercent float64    `json:"min_percent"`
+	Income     Money      `json:"income"`
+	Expenses   Money      `json:"expenses"`
+	NetSaved   Money      `json:"net_saved"`
+	NetDrawn   Money      `json:"net_drawn"`
+	Nodes      []FlowNode `json:"nodes"`
+	Links      []FlowLink `json:"links"`
+}
+
+// ForecastItem is a committed change of the balance of an account in the
+// balance forecast, signed: a transaction already entered ahead of its date
+// ("scheduled"), the next occurrence of a recurring transaction
+// ("recurring"), a bill ("bill") or a credit card payment ("card_payment").
+type ForecastItem struct {
+	Date        time.Time `json:"date"`
+	Description string    `json:"description"`
+	Amount      Money     `json:"amount"`
+	Source      string    `json:"source"`
+}
+
+// ForecastPoint is the projected balance at the end of a day, with the
+// committed items only and with the estimated discretionary spending too.
+type ForecastPoint struct {
+	Date      time.Time `json:"date" csv:"date"`
+	Committed Money     `json:"committed" csv:"committed"`
+	Estimated Money     `json:"estimated" csv:"estimated"`
+}
+
+// BalanceForecast is the response of the balance forecast report. It is an
+// estimate, always flagged as such. The first negative dates are the first
+// days a projection goes below zero, or below the credit limit of a
+// liability, null when it does not within the horizon. Floor is the balance
+// under which it is flagged, null for a liability without a credit limit.
+type BalanceForecast struct {
+	Estimate               bool            `json:"estimate"`
+	AccountID              uuid.UUID       `json:"account_id"`
+	Days                   int             `json:"days"`
+	Timezone               string          `json:"timezone"`
+	Currency               string          `json:"currency"`
+	StartingBalance        Money           `json:"starting_balance"`
+	Floor                  *Money          `json:"floor"`
+	DailyDiscretionary     Money           `json:"daily_discretionary"`
+	FirstNegativeCommitted *time.Time      `json:"first_negative_committed"`
+	FirstNegativeEstimated *time.Time      `json:"first_negative_estimated"`
+	Items                  []ForecastItem  `json:"items"`
+	Points                 []ForecastPoint `json:"points"`
+}
+
+// MerchantCharge is an expense of a user with its merchant, the normalized
+// description, for the subscription detection.
+type MerchantCharge struct {
+	Merchant      string    `json:"merchant"`
+	Amount        Money     `json:"amount"`
+	Date          time.Time `json:"date"`
+	Category      string    `json:"category"`
+	BankAccountID uuid.UUID `json:"bank_account_id"`
+}
+
+// SubscriptionCandidate is a merchant charging the user at a regular
+// cadence a near constant amount, which may be a subscription.
+type SubscriptionCandidate struct {
+	Merchant      string    `json:"merchant"`
+	Cadence       string    `json:"cadence"` // "weekly", "monthly" or "yearly"
+	AverageAmount Money     `json:"average_amount"`
+	LastAmount    Money     `json:"last_amount"`
+	Count         int       `json:"count"`
+	LastCharge    time.Time `json:"last_charge"`
+	NextCharge    time.Time `json:"next_charge"` // Projected from the last charge and the cadence
+	Category      string    `json:"category"`
+	BankAccountID uuid.UUID `json:"bank_account_id"`
+}
+
+// TaxTransaction is a transaction counted in the tax report, signed: the
+// refunds, income of a reported category, are negative.
+type TaxTransaction struct {
+	ID            uuid.UUID `json:"id" csv:"id"`
+	Date          time.Time `json:"date" csv:"date"`
+	Description   string    `json:"description" csv:"description"`
+	Category      string    `json:"category" csv:"category"`
+	Label         string    `json:"label" csv:"label"`
+	Amount        Money     `json:"amount" csv:"amount"`
+	BankAccountID uuid.UUID `json:"bank_account_id" csv:"bank_account_id"`
+}
+
+// TaxCategoryTotal is the total of a reported category over a tax year.
+type TaxCategoryTotal struct {
+	Category string `json:"category"`
+	Label    string `json:"label"`
+	Total    Money  `json:"total"`
+	Count    int    `json:"count"`
+}
+
+// TaxReport is the response of the tax report: the reported categories
+// summed over the tax year, from From to To excluded, with their
+// transactions.
+type TaxReport struct {
+	Year         int                `json:"year"`
+	StartMonth   int                `json:"start_month"`
+	From         time.Time          `json:"from"`
+	To           time.Time          `json:"to"`
+	Timezone     string             `json:"timezone"`
+	Currency     string             `json:"currency"`
+	Total        Money              `json:"total"`
+	Categories   []TaxCategoryTotal `json:"categories"`
+	Transactions []TaxTransaction   `json:"transactions"`
+}
+
+// DailySpending sums the income and the expenses of a user on a local day,
+// the expenses split between the essential categories and the others.
+type DailySpending struct {
+	Day           time.Time `json:"day"`
+	Income        Money     `json:"income"`
+	Essential     Money     `json:"essential"`
+	Discretionary Money     `json:"discretionary"`
+}
+
+// HealthMetrics are the financial health metrics of a period. The savings
+// rate is null without income, NoIncome then tells why; the essential share
+// is null without expenses.
+type HealthMetrics struct {
+	Days              int      `json:"days" csv:"days"`
+	Income            Money    `json:"income" csv:"income"`
+	Expenses          Money    `json:"expenses" csv:"expenses"`
+	SavingsRate       *float64 `json:"savings_rate" csv:"savings_rate"` // Percent of the income not spent
+	NoIncome          bool     `json:"no_income" csv:"no_income"`
+	Essential         Money    `json:"essential" csv:"essential"`
+	Discretionary     Money    `json:"discretionary" csv:"discretionary"`
+	EssentialShare    *float64 `json:"essential_share" csv:"essential_share"` // Percent of the expenses
+	AverageDailySpend Money    `json:"average_daily_spend" csv:"average_daily_spend"`
+	NoSpendDays       int      `json:"no_spend_days" csv:"no_spend_days"`
+}
+
+// HealthMetricsChange is the change of the health metrics from a month to
+// the next: the rates in percentage points, null when either is, the
+// amounts and the days as differences.
+type HealthMetricsChange struct {
+	SavingsRate       *float64 `json:"savings_rate"`
+	EssentialShare    *float64 `json:"essential_share"`
+	Essential         Money    `json:"essential"`
+	Discretionary     Money    `json:"discretionary"`
+	AverageDailySpend Money    `json:"average_daily_spend"`
+	NoSpendDays       int      `json:"no_spend_days"`
+}
+
+// HealthMonth holds the health metrics of a month, the current one up to
+// today, with their change since the previous month, null for the first.
+type HealthMonth struct {
+	Month time.Time `json:"month" csv:"month"`
+	HealthMetrics
+	Change *HealthMetricsChange `json:"change"`
+}
+
+// HealthMetricsReport is the response of the health metrics report: the
+// metrics over the months, from From to To, and month by month.
+type HealthMetricsReport struct {
+	Months   int           `json:"months"`
+	From     time.Time     `json:"from"`
+	To       time.Time     `json:"to"`
+	Timezone string        `json:"timezone"`
+	Currency string        `json:"currency"`
+	Summary  HealthMetrics `json:"summary"`
+	Monthly  []HealthMonth `json:"monthly"`
+}
+
+// DayTotal sums the expenses of a user on a local day.
+type DayTotal struct {
+	Day   time.Time `json:"day"`
+	Total Money     `json:"total"`
+	Count int       `json:"count"`
+}
+
+// HeatmapDay is the spending of a day of the heatmap with its intensity,
+// 0 without spending, then 1 to 4 by quartile of the days with spending.
+type HeatmapDay struct {
+	Date  time.Time `json:"date" csv:"date"`
+	Total Money     `json:"total" csv:"total"`
+	Count int       `json:"count" csv:"count"`
+	Level int       `json:"level" csv:"level"`
+}
+
+// Heatmap is the response of the heatmap report: a day per day of the year,
+// up to today in the current year, which Partial flags. Thresholds are the
+// upper bounds of the levels 1 to 3, the level 4 is above the last.
+type Heatmap struct {
+	Year       int          `json:"year"`
+	Timezone   string       `json:"timezone"`
+	Currency   string       `json:"currency"`
+	Category   string       `json:"category,omitempty"`
+	Partial    bool         `json:"partial"`
+	Total      Money        `json:"total"`
+	Thresholds []Money      `json:"thresholds"`
+	Days       []HeatmapDay `json:"days"`
+}
+
+// CustomReportRow is a group of a custom report with the metric of its
+// transactions. Label names the accounts, the other groups are their own.
+type CustomReportRow struct {
+	Group string `json:"group" csv:"group"`
+	Label string `json:"label,omitempty" csv:"label"`
+	Value Money  `json:"value" csv:"value"`
+	Count int    `json:"count" csv:"count"`
+}
+
+// CustomReport is the response of a custom report, saved or not. The rows
+// are by value, or by month for the monthly groups; Truncated tells when
+// there were more groups than the limit.
+type CustomReport struct {
+	ReportID   *uuid.UUID        `json:"report_id,omitempty"`
+	Name       string            `json:"name,omitempty"`
+	Definition CustomReportSpec  `json:"definition"`
+	From       time.Time         `json:"from"`
+	To         time.Time         `json:"to"`
+	Timezone   string            `json:"timezone"`
+	Currency   string            `json:"currency"`
+	Truncated  bool              `json:"truncated"`
+	Rows       []CustomReportRow `json:"rows"`
+}
+
+// AccountTransactionsMeta summarizes an account next to its transactions list.
+// Pending transactions are the ones dated in the future.
+type AccountTransactionsMeta struct {
+	AccountID        uuid.UUID `json:"account_id"`
+	Balance          Money     `json:"balance"`
+	PendingTotal     Money     `json:"pending_total"`
+	TransactionCount int64     `json:"transaction_count"` // Transactions matching the filters, ignoring pagination
+}
+
+// BalancePoint is the balance of an account at the end of a day, week or month.
+type BalancePoint struct {
+	Date    time.Time `json:"date"`
+	Balance Money     `json:"balance"`
+}
+
+// CardCycleTotals sums the charges and the payments of a credit card over a period.
+type CardCycleTotals struct {
+	Charges  Money `json:"charges"`
+	Payments Money `json:"payments"`
+}
+
+// StatementCycle describes the billing cycle of a credit card account. The
+// statement is the last closed cycle, the current cycle is still open.
+type StatementCycle struct {
+	AccountID uuid.UUID `json:"account_id"`
+
+	StatementStart   time.Time `json:"statement_start"`
+	StatementEnd     time.Time `json:"statement_end"`
+	StatementSpend   Money     `json:"statement_spend"`
+	StatementBalance Money     `json:"statement_balance"` // Amount owed when the statement closed
+	DueDate          time.Time `json:"due_date"`
+	PaidSinceClose   Money     `json:"paid_since_close"`
+	RemainingToPay   Money     `json:"remaining_to_pay"`
+
+	CycleStart time.Time `json:"cycle_start"`
+	CycleEnd   time.Time `json:"cycle_end"`
+	CycleSpend Money     `json:"cycle_spend"`
+}
+
+// ProjectionPoint is the projected balance of an account at the end of a month.
+type ProjectionPoint struct {
+	Month        time.Time `json:"month"`
+	Rate         float64   `json:"rate"`
+	Interest     Money     `json:"interest"`
+	Contribution Money     `json:"contribution"`
+	Balance      Money     `json:"balance"`
+}
+
+// BalanceProjection is an estimate of the future balance of a savings account,
+// nothing is stored.
+type BalanceProjection struct {
+	AccountID            uuid.UUID         `json:"account_id"`
+	IsEstimate           bool              `json:"is_estimate"`
+	Disclaimer           string            `json:"disclaimer"`
+	CompoundingFrequency string            `json:"compounding_frequency"`
+	StartingBalance      Money             `json:"starting_balance"`
+	MonthlyContribution  Money             `json:"monthly_contribution"`
+	Points               []ProjectionPoint `json:"points"`
+}
+
+// BudgetPeriodRange is the half-open range [Start, End) of a period of a budget.
+type BudgetPeriodRange struct {
+	BudgetID uuid.UUID
+	Start    time.Time
+	End      time.Time
+}
+
+// BudgetProgress tells how much of a budget was spent in its current period,
+// and whether the spending is ahead of a linear burn-down of the limit.
+type BudgetProgress struct {
+	BudgetID          uuid.UUID `json:"budget_id"`
+	Categories        []string  `json:"categories"`
+	ExcludeCategories bool      `json:"exclude_categories"`
+	PeriodStart       time.Time `json:"period_start"`
+	PeriodEnd         time.Time `json:"period_end"`
+	Currency          string    `json:"currency"`        // Base currency of the owner of the budget, the currency of the amounts
+	Limit             Money     `json:"limit"`           // Base limit of the budget
+	RolloverAmount    Money     `json:"rollover_amount"` // Carried over from the previous periods
+	EffectiveLimit    Money     `json:"effective_limit"` // Base limit plus the rollover
+	Spent             Money     `json:"spent"`
+	Remaining         Money     `json:"remaining"`
+	Percentage        float64   `json:"percentage"`
+	DaysLeft          int       `json:"days_left"`
+	Pace              string    `json:"pace"`                // "on_track" or "over_pace"
+	Allocated         *Money    `json:"allocated,omitempty"` // Allocated in the period, in envelope budgeting mode
+
+	Forecast *BudgetForecast `json:"forecast,omitempty"` // Only when requested
+}
+
+// GoalProgress is a savings goal with what was contributed to it and the
+// monthly contribution required to reach the target by the target date.
+type GoalProgress struct {
+	Goal
+	Contributed     Money   `json:"contributed"`
+	Remaining       Money   `json:"remaining"`
+	Percentage      float64 `json:"percentage"`
+	RequiredMonthly *Money  `json:"required_monthly"` // Null without a target date
+	Behind          bool    `json:"behind"`           // Less contributed than a steady pace towards the target date
+}
+
+// AllocationPool is the income of a user in envelope budgeting mode and
+// how much of it was allocated to budgets. Unassigned is the money not
+// given a job yet.
+type AllocationPool struct {
+	Income     Money `json:"income"`
+	Allocated  Money `json:"allocated"`
+	Unassigned Money `json:"unassigned"`
+}
+
+// AllocationStepResult is the amount a step of an allocation rule sends to
+// its goal or budget.
+type AllocationStepResult struct {
+	Position int        `json:"position"`
+	GoalID   *uuid.UUID `json:"goal_id,omitempty"`
+	BudgetID *uuid.UUID `json:"budget_id,omitempty"`
+	Amount   Money      `json:"amount"`
+}
+
+// AllocationPreview shows how an allocation rule distributes an income.
+type AllocationPreview struct {
+	TransactionID uuid.UUID              `json:"transaction_id"`
+	Date          time.Time              `json:"date"`
+	Description   string                 `json:"description"`
+	Amount        Money                  `json:"amount"`
+	Steps         []AllocationStepResult `json:"steps"`
+	Unallocated   Money                  `json:"unallocated"`
+}
+
+// CommittedExpense is an upcoming occurrence of a recurring expense.
+type CommittedExpense struct {
+	Description string    `json:"description"`
+	Amount      Money     `json:"amount"`
+	DueDate     time.Time `json:"due_date"`
+}
+
+// BudgetForecast projects the spending of a budget at the end of its current
+// period. Committed spending comes from the recurring expenses due before the
+// end of the period, extrapolated spending from the daily run rate of the
+// other expenses.
+type BudgetForecast struct {
+	BudgetID           uuid.UUID          `json:"budget_id"`
+	PeriodEnd          time.Time          `json:"period_end"`
+	Limit              Money              `json:"limit"` // Effective limit, rollover included
+	SpentToDate        Money              `json:"spent_to_date"`
+	Committed          Money              `json:"committed"`
+	CommittedItems     []CommittedExpense `json:"committed_items"`
+	DailyRate          Money              `json:"daily_rate"`
+	Extrapolated       Money              `json:"extrapolated"`
+	ProjectedTotal     Money              `json:"projected_total"`
+	ProjectedOvershoot Money              `json:"projected_overshoot"`
+	ExhaustionDate     *time.Time         `json:"exhaustion_date"` // Null when the limit is not expected to be reached
+}
+
+// BudgetVsActual compares the effective limit of a budget with what was
+// actually spent in one of its periods. Variance is positive under budget.
+type BudgetVsActual struct {
+	BudgetID       uuid.UUID `json:"budget_id" csv:"budget_id"`
+	Name           string    `json:"name" csv:"name"`
+	Deleted        bool      `json:"deleted" csv:"deleted"`
+	Limit          Money     `json:"limit" csv:"limit" xlsx:"amount"`
+	EffectiveLimit Money     `json:"effective_limit" csv:"effective_limit" xlsx:"amount"`
+	Actual         Money     `json:"actual" csv:"actual" xlsx:"amount"`
+	Variance       Money     `json:"variance" csv:"variance" xlsx:"amount"`
+}
+
+// BudgetVsActualPeriod groups the budgets sharing a period, with their totals.
+type BudgetVsActualPeriod struct {
+	PeriodStart   time.Time        `json:"period_start"`
+	PeriodEnd     time.Time        `json:"period_end"`
+	Budgets       []BudgetVsActual `json:"budgets"`
+	TotalLimit    Money            `json:"total_limit"`
+	TotalActual   Money            `json:"total_actual"`
+	TotalVariance Money            `json:"total_variance"`
+}
+
+// BudgetApplyResult tells whether a budget was created when copying budgets
+// forward or applying a template, or why it was skipped.
+type BudgetApplyResult struct {
+	Name       string     `json:"name"`
+	Categories []string   `json:"categories"`
+	Status     string     `json:"status"` // "created" or "skipped"
+	BudgetID   *uuid.UUID `json:"budget_id,omitempty"`
+	Reason     string     `json:"reason,omitempty"`
+}
+
+// DashboardBalances sums the balances of the accounts the user can access,
+// archived accounts left out. Liabilities count negatively.
+type DashboardBalances struct {
+	Total    Money `json:"total"`
+	Accounts int   `json:"accounts"`
+}
+
+// DashboardMonth sums the income and the expenses of the current month,
+// leaving out the transactions excluded from the budgets.
+type DashboardMonth struct {
+	From     time.Time `json:"from"`
+	Income   Money     `json:"income"`
+	Expenses Money     `json:"expenses"`
+	Net      Money     `json:"net"`
+}
+
+// CategoryTotal sums the expenses of a category over a range.
+type CategoryTotal struct {
+	Category string `json:"category"`
+	Total    Money  `json:"total"`
+	Count    int    `json:"count"`
+}
+
+// UpcomingTransaction is the next expected occurrence of a recurring
+// transaction.
+type UpcomingTransaction struct {
+	Description string    `json:"description"`
+	Type        string    `json:"type"`
+	Amount      Money     `json:"amount"`
+	DueDate     time.Time `json:"due_date"`
+}
+
+// BillOccurrence is a bill due on a date and whether it was paid.
+type BillOccurrence struct {
+	BillID        uuid.UUID  `json:"bill_id"`
+	Name          string     `json:"name"`
+	Amount        Money      `json:"amount"`
+	DueDate       time.Time  `json:"due_date"`
+	Autopay       bool       `json:"autopay"`
+	Status        string     `json:"status"` // "paid" or "unpaid"
+	PaidAt        *time.Time `json:"paid_at"`
+	TransactionID *uuid.UUID `json:"transaction_id"`
+}
+
+// ImportSummary tells what an import of the export of another app created,
+// or would create in a dry run.
+type ImportSummary struct {
+	DryRun       bool              `json:"dry_run"`
+	Accounts     ImportCount       `json:"accounts"`     // Skipped are the accounts of the user matched by name
+	Transactions ImportCount       `json:"transactions"` // Skipped are the rows imported before
+	SplitRows    int               `json:"split_rows"`   // Parts of split transactions, imported as transactions of their own
+	Budgets      ImportCount       `json:"budgets"`      // Skipped are the categories already covered by a monthly budget
+	Categories   map[string]string `json:"categories"`   // Category of FinMa of each category of the export
+	Errors       []ImportRowError  `json:"errors"`       // Rows skipped
+
+	// InitialBalances counts the accounts whose initial balance was set from
+	// the opening balance of the export, with ?initial_balance=true
+	InitialBalances int `json:"initial_balances"`
+}
+
+// ImportCount counts the entities of a type an import created and skipped.
+type ImportCount struct {
+	Created int `json:"created"`
+	Skipped int `json:"skipped"`
+}
+
+// ImportRowError is a row of an export that could not be imported.
+type ImportRowError struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// ActivityItem is an event of the activity feed of a user, read from the
+// audit log or the notifications. The entries of a batch are one item
+// counting them.
+type ActivityItem struct {
+	ID         uuid.UUID       `json:"id"` // Of the entry, or of the batch
+	Type       string          `json:"type"`
+	OccurredAt time.Time       `json:"occurred_at"` // Of the latest entry
+	Count      int             `json:"count"`
+	EntityType string          `json:"entity_type,omitempty"`
+	EntityID   *uuid.UUID      `json:"entity_id,omitempty"` // Of a single entry
+	BatchID    *uuid.UUID      `json:"batch_id,omitempty"`
+	Details    string          `json:"details,omitempty"` // Of the latest audit entry
+	Payload    json.RawMessage `json:"payload,omitempty"` // Of the notification
+	Link       string          `json:"link"`              // Path of the screen of the app showing it
+}
+
+// ActivityPage is a page of the activity feed.
+type ActivityPage struct {
+	Items      []ActivityItem `json:"items"`
+	NextCursor string         `json:"next_cursor,omitempty"` // Cursor of the next page, empty on the last one
+}
+
+// Onboarding is the starter data of a new user, created at once from their
+// answers to the first-run questions.
+type Onboarding struct {
+	Currency      string        `json:"currency"` // Base currency of the user and currency of the accounts
+	Accounts      []BankAccount `json:"accounts"`
+	MonthlyIncome Money         `json:"monthly_income"` // Estimate given by the user, not stored
+	Budgets       []Budget      `json:"budgets"`        // Monthly, one per category
+	Bills         []Bill        `json:"bills"`          // Example recurring payments kept by the user
+	Unbudgeted    Money         `json:"unbudgeted"`     // Monthly income left once the budgets are funded, negative past it
+}
+
+// PlanLimits are the limits of a plan, 0 for unlimited.
+type PlanLimits struct {
+	Accounts            int64 `json:"accounts"`             // Bank accounts owned
+	MonthlyTransactions int64 `json:"monthly_transactions"` // Transactions created in a calendar month
+}
+
+// Usage counts what a user uses of the limits of their plan.
+type Usage struct {
+	Accounts            int64 `json:"accounts"`
+	MonthlyTransactions int64 `json:"monthly_transactions"` // Created this month, in the timezone of the user
+}
+
+// PlanUsage tells a user where they stand against the limits of their plan.
+type PlanUsage struct {
+	Plan      string           `json:"plan"`
+	Period    string           `json:"period"` // Month of the monthly limits, YYYY-MM
+	Usage     Usage            `json:"usage"`
+	Limits    PlanLimits       `json:"limits"`              // Of the plan, with the overrides of the user
+	Overrides map[string]int64 `json:"overrides,omitempty"` // Limits set by an admin for the user
+}
+
+// BillingStatus tells a user the state of their subscription to the pro
+// plan.
+type BillingStatus struct {
+	Plan              string     `json:"plan"`
+	Enabled           bool       `json:"enabled"` // Whether the instance sells the pro plan
+	Status            string     `json:"status"`  // Of the subscription, like "active" or "past_due", empty without one
+	CurrentPeriodEnd  *time.Time `json:"current_period_end"`
+	CancelAtPeriodEnd bool       `json:"cancel_at_period_end"`
+	PastDueSince      *time.Time `json:"past_due_since"`
+	DowngradeAt       *time.Time `json:"downgrade_at"` // When the user moves to the free plan unless they pay
+}
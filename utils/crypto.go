@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Cipher encrypts the sensitive values stored in the database with the key
+// of the configuration, held by the server.
+type Cipher struct {
+	// Key is the base64 encoded 32 bytes key.
+	Key string
+	// PreviousKeys are the keys replaced by Key, still accepted by Decrypt
+	// until every value is encrypted again with Key.
+	PreviousKeys []string
+}
+
+func newGCM(encoded string) (cipher.AEAD, error) {
+	if encoded == "" {
+		return nil, errors.New("encryption key is not set")
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, errors.New("encryption key must be 32 bytes long")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt encrypts the value with AES-GCM and returns it base64 encoded,
+// prefixed with its random nonce.
+func (c Cipher) Encrypt(value string) (string, error) {
+	gcm, err := newGCM(c.Key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(value), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts a value encrypted with Encrypt, with Key or one of the
+// PreviousKeys.
+func (c Cipher) Decrypt(value string) (string, error) {
+	plaintext, _, err := c.decrypt(value)
+	return plaintext, err
+}
+
+// Reencrypt returns the value encrypted with Key, and whether it changed:
+// the values already encrypted with Key are returned as is.
+func (c Cipher) Reencrypt(value string) (string, bool, error) {
+	plaintext, previous, err := c.decrypt(value)
+	if err != nil || !previous {
+		return value, false, err
+	}
+	encrypted, err := c.Encrypt(plaintext)
+	return encrypted, err == nil, err
+}
+
+// decrypt decrypts the value and tells whether it was with a previous key.
+func (c Cipher) decrypt(value string) (string, bool, error) {
+	sealed, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid encrypted value: %w", err)
+	}
+
+	for i, key := range append([]string{c.Key}, c.PreviousKeys...) {
+		gcm, err := newGCM(key)
+		if err != nil {
+			return "", false, err
+		}
+		if len(sealed) < gcm.NonceSize() {
+			return "", false, errors.New("invalid encrypted value")
+		}
+
+		nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+		if plaintext, err := gcm.Open(nil, nonce, ciphertext, nil); err == nil {
+			return string(plaintext), i > 0, nil
+		}
+	}
+	return "", false, errors.New("failed to decrypt value: no key matches")
+}
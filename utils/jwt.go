@@ -1,8 +1,10 @@
 package utils
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/charmbracelet/log"
@@ -16,18 +18,20 @@ type Payload struct {
 	Email  string    `json:"email"`
 }
 
-var (
-	// AccessTokenSecret is the secret key used to sign the access token.
-	AccessTokenSecret = os.Getenv("ACCESS_TOKEN_SECRET")
-	// RefreshTokenSecret is the secret key used to sign the refresh token.
-	RefreshTokenSecret = os.Getenv("REFRESH_TOKEN_SECRET")
-)
+// Tokens signs and verifies the tokens with the secrets of the
+// configuration, held by the server.
+type Tokens struct {
+	// AccessSecret is the secret key used to sign the access token.
+	AccessSecret string
+	// RefreshSecret is the secret key used to sign the refresh token.
+	RefreshSecret string
+}
 
 // GenerateAccessToken generates a new JWT access token.
 // The payload is the data that will be stored in the token.
 // The function returns the signed token as a string.
-func GenerateAccessToken(payload Payload) (string, error) {
-	if AccessTokenSecret == "" {
+func (t Tokens) GenerateAccessToken(payload Payload) (string, error) {
+	if t.AccessSecret == "" {
 		return "", fmt.Errorf("access token secret is not set")
 	}
 
@@ -43,7 +47,7 @@ func GenerateAccessToken(payload Payload) (string, error) {
 	token.Set(jwt.AudienceKey, "users")
 
 	// Sign the token
-	signedToken, err := jwt.Sign(token, jwt.WithKey(jwa.HS256, []byte(AccessTokenSecret)))
+	signedToken, err := jwt.Sign(token, jwt.WithKey(jwa.HS256, []byte(t.AccessSecret)))
 	if err != nil {
 		return "", fmt.Errorf("failed to sign token: %w", err)
 	}
@@ -51,8 +55,15 @@ func GenerateAccessToken(payload Payload) (string, error) {
 	return string(signedToken), nil
 }
 
-func GenerateRefreshToken(payload Payload) (string, error) {
-	if RefreshTokenSecret == "" {
+// GenerateRefreshToken generates a new JWT refresh token, valid for 7 days.
+func (t Tokens) GenerateRefreshToken(payload Payload) (string, error) {
+	return t.GenerateRefreshTokenUntil(payload, time.Now().Add(time.Hour*24*7))
+}
+
+// GenerateRefreshTokenUntil generates a new JWT refresh token expiring at
+// expiresAt, for the sessions shorter than a login.
+func (t Tokens) GenerateRefreshTokenUntil(payload Payload, expiresAt time.Time) (string, error) {
+	if t.RefreshSecret == "" {
 		return "", fmt.Errorf("refresh token secret is not set")
 	}
 
@@ -62,13 +73,13 @@ func GenerateRefreshToken(payload Payload) (string, error) {
 	// Set the token claims
 	token.Set("payload", payload)
 	token.Set(jwt.IssuedAtKey, time.Now().Unix())
-	token.Set(jwt.ExpirationKey, time.Now().Add(time.Hour*24*7).Unix())
+	token.Set(jwt.ExpirationKey, expiresAt.Unix())
 	token.Set(jwt.IssuerKey, "FinMa")
 	token.Set(jwt.SubjectKey, "refresh")
 	token.Set(jwt.AudienceKey, "users")
 
 	// Sign the token
-	signedToken, err := jwt.Sign(token, jwt.WithKey(jwa.HS256, []byte(RefreshTokenSecret)))
+	signedToken, err := jwt.Sign(token, jwt.WithKey(jwa.HS256, []byte(t.RefreshSecret)))
 	if err != nil {
 		return "", fmt.Errorf("failed to sign token: %w", err)
 	}
@@ -78,13 +89,13 @@ func GenerateRefreshToken(payload Payload) (string, error) {
 
 // VerifyAccessToken verifies the JWT access token.
 // The function returns the payload stored in the token.
-func VerifyAccessToken(tokenString string) (Payload, error) {
-	if AccessTokenSecret == "" {
+func (t Tokens) VerifyAccessToken(tokenString string) (Payload, error) {
+	if t.AccessSecret == "" {
 		return Payload{}, fmt.Errorf("access token secret is not set")
 	}
 
 	// Parse the token
-	token, err := jwt.Parse([]byte(tokenString), jwt.WithKey(jwa.HS256, []byte(AccessTokenSecret)), jwt.WithValidate(true))
+	token, err := jwt.Parse([]byte(tokenString), jwt.WithKey(jwa.HS256, []byte(t.AccessSecret)), jwt.WithValidate(true))
 
 	if err != nil {
 		return Payload{}, err
@@ -113,13 +124,13 @@ func VerifyAccessToken(tokenString string) (Payload, error) {
 
 // VerifyRefreshToken verifies the JWT refresh token.
 // The function returns the payload stored in the token.
-func VerifyRefreshToken(tokenString string) (Payload, error) {
-	if RefreshTokenSecret == "" {
+func (t Tokens) VerifyRefreshToken(tokenString string) (Payload, error) {
+	if t.RefreshSecret == "" {
 		return Payload{}, fmt.Errorf("refresh token secret is not set")
 	}
 
 	// Parse the token
-	token, err := jwt.Parse([]byte(tokenString), jwt.WithKey(jwa.HS256, []byte(RefreshTokenSecret)), jwt.WithValidate(true))
+	token, err := jwt.Parse([]byte(tokenString), jwt.WithKey(jwa.HS256, []byte(t.RefreshSecret)), jwt.WithValidate(true))
 
 	if err != nil {
 		return Payload{}, err
@@ -146,3 +157,197 @@ func VerifyRefreshToken(tokenString string) (Payload, error) {
 		Email:  email.(string),
 	}, nil
 }
+
+// GenerateUnsubscribeToken generates the token of an unsubscribe link, so
+// that the user can turn off the emails of an event without logging in.
+// The token does not expire: old emails must keep working.
+func (t Tokens) GenerateUnsubscribeToken(userID uuid.UUID, event string) (string, error) {
+	if t.AccessSecret == "" {
+		return "", fmt.Errorf("access token secret is not set")
+	}
+
+	token := jwt.New()
+	token.Set("user_id", userID.String())
+	token.Set("event", event)
+	token.Set(jwt.IssuedAtKey, time.Now().Unix())
+	token.Set(jwt.IssuerKey, "FinMa")
+	token.Set(jwt.SubjectKey, "unsubscribe")
+
+	signedToken, err := jwt.Sign(token, jwt.WithKey(jwa.HS256, []byte(t.AccessSecret)))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+
+	return string(signedToken), nil
+}
+
+// VerifyUnsubscribeToken verifies the token of an unsubscribe link.
+// The function returns the user and the event to unsubscribe from.
+func (t Tokens) VerifyUnsubscribeToken(tokenString string) (uuid.UUID, string, error) {
+	if t.AccessSecret == "" {
+		return uuid.Nil, "", fmt.Errorf("access token secret is not set")
+	}
+
+	token, err := jwt.Parse([]byte(tokenString), jwt.WithKey(jwa.HS256, []byte(t.AccessSecret)), jwt.WithValidate(true), jwt.WithSubject("unsubscribe"))
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+
+	rawUserID, _ := token.Get("user_id")
+	rawEvent, _ := token.Get("event")
+	userIDString, _ := rawUserID.(string)
+	event, _ := rawEvent.(string)
+	userID, err := uuid.Parse(userIDString)
+	if err != nil || event == "" {
+		return uuid.Nil, "", fmt.Errorf("invalid unsubscribe token")
+	}
+
+	return userID, event, nil
+}
+
+// GeneratePasswordResetToken generates the token of a password reset link,
+// valid for an hour. It carries a fingerprint of the current password hash,
+// so that it stops working once the password is changed.
+func (t Tokens) GeneratePasswordResetToken(userID uuid.UUID, passwordHash string) (string, time.Time, error) {
+	if t.AccessSecret == "" {
+		return "", time.Time{}, fmt.Errorf("access token secret is not set")
+	}
+
+	expiresAt := time.Now().Add(time.Hour)
+	token := jwt.New()
+	token.Set("user_id", userID.String())
+	token.Set("password", passwordFingerprint(passwordHash))
+	token.Set(jwt.IssuedAtKey, time.Now().Unix())
+	token.Set(jwt.ExpirationKey, expiresAt.Unix())
+	token.Set(jwt.IssuerKey, "FinMa")
+	token.Set(jwt.SubjectKey, "password_reset")
+
+	signedToken, err := jwt.Sign(token, jwt.WithKey(jwa.HS256, []byte(t.AccessSecret)))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to sign token: %w", err)
+	}
+
+	return string(signedToken), expiresAt, nil
+}
+
+// VerifyPasswordResetToken verifies the token of a password reset link
+// against the current password hash of the user it names.
+func (t Tokens) VerifyPasswordResetToken(tokenString string, currentHash func(userID uuid.UUID) string) (uuid.UUID, error) {
+	if t.AccessSecret == "" {
+		return uuid.Nil, fmt.Errorf("access token secret is not set")
+	}
+
+	token, err := jwt.Parse([]byte(tokenString), jwt.WithKey(jwa.HS256, []byte(t.AccessSecret)), jwt.WithValidate(true), jwt.WithSubject("password_reset"))
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	rawUserID, _ := token.Get("user_id")
+	rawFingerprint, _ := token.Get("password")
+	userIDString, _ := rawUserID.(string)
+	fingerprint, _ := rawFingerprint.(string)
+	userID, err := uuid.Parse(userIDString)
+	if err != nil || fingerprint == "" {
+		return uuid.Nil, fmt.Errorf("invalid password reset token")
+	}
+	if subtle.ConstantTimeCompare([]byte(fingerprint), []byte(passwordFingerprint(currentHash(userID)))) != 1 {
+		return uuid.Nil, fmt.Errorf("password reset token already used")
+	}
+
+	return userID, nil
+}
+
+func passwordFingerprint(passwordHash string) string {
+	sum := sha256.Sum256([]byte(passwordHash))
+	return hex.EncodeToString(sum[:8])
+}
+
+// GenerateErasureToken generates the token of the link confirming an
+// erasure request, valid for a day.
+func (t Tokens) GenerateErasureToken(requestID uuid.UUID) (string, time.Time, error) {
+	if t.AccessSecret == "" {
+		return "", time.Time{}, fmt.Errorf("access token secret is not set")
+	}
+
+	expiresAt := time.Now().Add(24 * time.Hour)
+	token := jwt.New()
+	token.Set("request_id", requestID.String())
+	token.Set(jwt.IssuedAtKey, time.Now().Unix())
+	token.Set(jwt.ExpirationKey, expiresAt.Unix())
+	token.Set(jwt.IssuerKey, "FinMa")
+	token.Set(jwt.SubjectKey, "erasure_confirmation")
+
+	signedToken, err := jwt.Sign(token, jwt.WithKey(jwa.HS256, []byte(t.AccessSecret)))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to sign token: %w", err)
+	}
+
+	return string(signedToken), expiresAt, nil
+}
+
+// VerifyErasureToken verifies the token of an erasure confirmation link.
+// The function returns the request to confirm.
+func (t Tokens) VerifyErasureToken(tokenString string) (uuid.UUID, error) {
+	if t.AccessSecret == "" {
+		return uuid.Nil, fmt.Errorf("access token secret is not set")
+	}
+
+	token, err := jwt.Parse([]byte(tokenString), jwt.WithKey(jwa.HS256, []byte(t.AccessSecret)), jwt.WithValidate(true), jwt.WithSubject("erasure_confirmation"))
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	rawRequestID, _ := token.Get("request_id")
+	requestIDString, _ := rawRequestID.(string)
+	requestID, err := uuid.Parse(requestIDString)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid erasure token")
+	}
+
+	return requestID, nil
+}
+
+// GenerateShareToken generates the token of a share link, valid until the
+// expiry of the grant. The grant is checked on every use, so that revoking
+// it disables the link.
+func (t Tokens) GenerateShareToken(grantID uuid.UUID, expiresAt time.Time) (string, error) {
+	if t.AccessSecret == "" {
+		return "", fmt.Errorf("access token secret is not set")
+	}
+
+	token := jwt.New()
+	token.Set("grant_id", grantID.String())
+	token.Set(jwt.IssuedAtKey, time.Now().Unix())
+	token.Set(jwt.ExpirationKey, expiresAt.Unix())
+	token.Set(jwt.IssuerKey, "FinMa")
+	token.Set(jwt.SubjectKey, "share")
+
+	signedToken, err := jwt.Sign(token, jwt.WithKey(jwa.HS256, []byte(t.AccessSecret)))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+
+	return string(signedToken), nil
+}
+
+// VerifyShareToken verifies the token of a share link. The function returns
+// the grant of the link.
+func (t Tokens) VerifyShareToken(tokenString string) (uuid.UUID, error) {
+	if t.AccessSecret == "" {
+		return uuid.Nil, fmt.Errorf("access token secret is not set")
+	}
+
+	token, err := jwt.Parse([]byte(tokenString), jwt.WithKey(jwa.HS256, []byte(t.AccessSecret)), jwt.WithValidate(true), jwt.WithSubject("share"))
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	rawGrantID, _ := token.Get("grant_id")
+	grantIDString, _ := rawGrantID.(string)
+	grantID, err := uuid.Parse(grantIDString)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid share token")
+	}
+
+	return grantID, nil
+}